@@ -84,7 +84,30 @@ func main() {
 	repos := repository.NewRepositories(dbWrapper.GormDB)
 
 	// Initialize services
-	services := service.NewServices(repos, cfg, dbWrapper.GormDB)
+	services, err := service.NewServices(repos, cfg, dbWrapper.GormDB)
+	if err != nil {
+		log.Fatal("Failed to initialize services:", err)
+	}
+
+	// Background services
+	if err := serviceRegistry.Register(service.NewTrackingPoller(services.Tracking, repos.JobRun, 5*time.Minute)); err != nil {
+		log.Fatal("Failed to register tracking poller:", err)
+	}
+	if err := serviceRegistry.Register(service.NewDunningScheduler(services.Dunning, repos.JobRun, 24*time.Hour)); err != nil {
+		log.Fatal("Failed to register dunning scheduler:", err)
+	}
+	if err := serviceRegistry.Register(service.NewCashForecastScheduler(services.CashForecast, repos.JobRun, 24*time.Hour)); err != nil {
+		log.Fatal("Failed to register cash forecast scheduler:", err)
+	}
+	if err := serviceRegistry.Register(service.NewCostCalibrationScheduler(services.CostCalibration, repos.JobRun, 24*time.Hour)); err != nil {
+		log.Fatal("Failed to register cost calibration scheduler:", err)
+	}
+	if err := serviceRegistry.Register(service.NewSupplierScorecardScheduler(services.SupplierScorecard, repos.JobRun, 24*time.Hour)); err != nil {
+		log.Fatal("Failed to register supplier scorecard scheduler:", err)
+	}
+	if err := serviceRegistry.StartAll(context.Background()); err != nil {
+		log.Fatal("Failed to start background services:", err)
+	}
 
 	// Initialize handlers
 	h := handler.NewHandlers(services)
@@ -170,6 +193,10 @@ func setupRoutes(e *echo.Echo, h *handler.Handlers, cfg *config.Config) {
 		public.POST("/auth/login", h.Auth.Login)
 		public.POST("/auth/refresh", h.Auth.RefreshToken)
 		public.POST("/auth/register", h.Auth.Register)
+		public.GET("/certificates/verify/:hash", h.Certificate.VerifyCertificate)
+		public.GET("/rfq-bids/:token", h.Supplier.GetBidderRFQ)
+		public.POST("/rfq-bids/:token", h.Supplier.SubmitBid)
+		public.POST("/rfq-bids/:token/decline", h.Supplier.DeclineRFQ)
 	}
 
 	// Protected routes
@@ -244,13 +271,22 @@ func setupRoutes(e *echo.Echo, h *handler.Handlers, cfg *config.Config) {
 		protected.GET("/process-costs/templates", h.ProcessCost.GetCostTemplates)
 		protected.POST("/process-costs/templates", h.ProcessCost.CreateCostTemplate)
 		protected.PUT("/process-costs/templates/:id", h.ProcessCost.UpdateCostTemplate)
+		protected.GET("/process-costs/templates/:id/versions", h.ProcessCost.GetCostTemplateVersions)
 		protected.DELETE("/process-costs/templates/:id", h.ProcessCost.DeleteCostTemplate)
 		protected.POST("/process-costs/calculate", h.ProcessCost.CalculateProcessCost)
 		protected.GET("/process-costs/history", h.ProcessCost.GetCostHistory)
 		protected.GET("/process-costs/materials", h.ProcessCost.GetMaterialCosts)
 		protected.PUT("/process-costs/materials/:id", h.ProcessCost.UpdateMaterialCost)
+		protected.GET("/process-costs/materials/:id/versions", h.ProcessCost.GetMaterialCostVersions)
 		protected.GET("/process-costs/processing-rates", h.ProcessCost.GetProcessingRates)
 		protected.PUT("/process-costs/processing-rates/:id", h.ProcessCost.UpdateProcessingRate)
+		protected.GET("/process-costs/processing-rates/:id/versions", h.ProcessCost.GetProcessingRateVersions)
+		protected.GET("/process-costs/surface-treatment-rates", h.ProcessCost.GetSurfaceTreatmentRates)
+		protected.PUT("/process-costs/surface-treatment-rates/:id", h.ProcessCost.UpdateSurfaceTreatmentRate)
+		protected.GET("/process-costs/surface-treatment-rates/:id/versions", h.ProcessCost.GetSurfaceTreatmentRateVersions)
+		protected.GET("/process-costs/overhead-rates", h.ProcessCost.GetOverheadRates)
+		protected.PUT("/process-costs/overhead-rates/:id", h.ProcessCost.UpdateOverheadRate)
+		protected.GET("/process-costs/overhead-rates/:id/versions", h.ProcessCost.GetOverheadRateVersions)
 		protected.POST("/process-costs/batch-calculate", h.ProcessCost.BatchCalculateCost)
 		protected.GET("/process-costs/analysis", h.ProcessCost.GetCostAnalysis)
 		protected.GET("/process-costs/export", h.ProcessCost.ExportCostReport)
@@ -296,16 +332,41 @@ func setupRoutes(e *echo.Echo, h *handler.Handlers, cfg *config.Config) {
 		protected.GET("/trade/shipments/:id", h.Trade.GetShipment)
 		protected.PUT("/trade/shipments/:id", h.Trade.UpdateShipment)
 		protected.GET("/trade/shipments/:shipment_id/documents", h.Trade.GetTradeDocumentsByShipment)
+		protected.POST("/trade/shipments/:shipment_id/document-pack", h.ExportDocument.GenerateDocumentPack)
+		protected.GET("/trade/documents/:id/download", h.ExportDocument.DownloadDocument)
 
 		// Shipment events
 		protected.POST("/trade/shipments/:shipment_id/events", h.Trade.CreateShipmentEvent)
 		protected.GET("/trade/shipments/:shipment_id/events", h.Trade.GetShipmentEvents)
+		protected.POST("/trade/shipments/:shipment_id/tracking/poll", h.Tracking.PollShipment)
+		protected.GET("/trade/shipments/:shipment_id/load-plans", h.LoadPlan.ListLoadPlans)
+		protected.POST("/trade/shipments/:shipment_id/load-plans", h.LoadPlan.PlanShipment)
+		protected.POST("/trade/load-plans/preview", h.LoadPlan.PreviewPlan)
+		protected.GET("/trade/load-plans/:id", h.LoadPlan.GetLoadPlan)
+		protected.POST("/trade/load-plans/:id/apply", h.LoadPlan.ApplyLoadPlan)
+		protected.GET("/trade/freight-rates", h.LoadPlan.ListFreightRates)
+		protected.POST("/trade/freight-rates", h.LoadPlan.CreateFreightRate)
+		protected.PUT("/trade/freight-rates/:id", h.LoadPlan.UpdateFreightRate)
+		protected.DELETE("/trade/freight-rates/:id", h.LoadPlan.DeleteFreightRate)
+		protected.POST("/trade/tracking/import", h.Tracking.ImportEvents)
+		protected.GET("/trade/tracking/carriers", h.Tracking.ListCarrierIntegrations)
+		protected.POST("/trade/tracking/carriers", h.Tracking.CreateCarrierIntegration)
+		protected.PUT("/trade/tracking/carriers/:id", h.Tracking.UpdateCarrierIntegration)
+		protected.DELETE("/trade/tracking/carriers/:id", h.Tracking.DeleteCarrierIntegration)
 
 		// Letter of Credits
 		protected.GET("/trade/letter-of-credits", h.Trade.ListLetterOfCredits)
 		protected.POST("/trade/letter-of-credits", h.Trade.CreateLetterOfCredit)
 		protected.GET("/trade/letter-of-credits/:id", h.Trade.GetLetterOfCredit)
 		protected.GET("/trade/letter-of-credits/expiring", h.Trade.GetExpiringLetterOfCredits)
+		protected.GET("/trade/letter-of-credits/:id/terms", h.Trade.GetLCTerms)
+		protected.GET("/trade/letter-of-credits/:id/shipment-check", h.Trade.CheckShipmentAgainstLC)
+
+		// LC Amendments
+		protected.POST("/trade/letter-of-credits/:id/amendments", h.Trade.ProposeLCAmendment)
+		protected.GET("/trade/letter-of-credits/:id/amendments", h.Trade.ListLCAmendments)
+		protected.POST("/trade/lc-amendments/:id/accept", h.Trade.AcceptLCAmendment)
+		protected.POST("/trade/lc-amendments/:id/reject", h.Trade.RejectLCAmendment)
 
 		// LC Utilizations
 		protected.POST("/trade/lc-utilizations", h.Trade.CreateLCUtilization)
@@ -316,6 +377,18 @@ func setupRoutes(e *echo.Echo, h *handler.Handlers, cfg *config.Config) {
 		protected.GET("/trade/compliance/checks", h.Trade.GetComplianceChecksByResource)
 		protected.GET("/trade/compliance/failed-checks", h.Trade.GetFailedComplianceChecks)
 
+		// Sanctions screening
+		protected.GET("/screening/lists", h.Screening.ListSanctionsLists)
+		protected.POST("/screening/lists/:source/import", h.Screening.ImportSanctionsList)
+		protected.POST("/screening/lists/:source/download", h.Screening.DownloadSanctionsList)
+		protected.GET("/screening/policy", h.Screening.GetPolicy)
+		protected.PUT("/screening/policy", h.Screening.UpdatePolicy)
+		protected.POST("/screening/rescreen", h.Screening.Rescreen)
+		protected.GET("/screening/hits", h.Screening.ListHits)
+		protected.GET("/screening/hits/:id", h.Screening.GetHit)
+		protected.POST("/screening/hits/:id/clear", h.Screening.ClearHit)
+		protected.POST("/screening/hits/:id/confirm", h.Screening.ConfirmHit)
+
 		// Exchange rates
 		protected.GET("/trade/exchange-rates", h.Trade.ListExchangeRates)
 		protected.POST("/trade/exchange-rates", h.Trade.CreateExchangeRate)
@@ -330,6 +403,228 @@ func setupRoutes(e *echo.Echo, h *handler.Handlers, cfg *config.Config) {
 		protected.POST("/trade/utils/calculate-tariff-duty", h.Trade.CalculateTariffDuty)
 		protected.POST("/trade/utils/convert-currency", h.Trade.ConvertCurrency)
 
+		// General ledger routes
+		protected.POST("/finance/gl/accounts/setup", h.Ledger.SetupChartOfAccounts)
+		protected.GET("/finance/gl/accounts", h.Ledger.ListAccounts)
+		protected.POST("/finance/gl/accounts", h.Ledger.CreateAccount)
+		protected.GET("/finance/gl/accounts/:id", h.Ledger.GetAccount)
+		protected.PUT("/finance/gl/accounts/:id", h.Ledger.UpdateAccount)
+		protected.GET("/finance/gl/posting-rules", h.Ledger.ListPostingRules)
+		protected.POST("/finance/gl/posting-rules", h.Ledger.CreatePostingRule)
+		protected.PUT("/finance/gl/posting-rules/:id", h.Ledger.UpdatePostingRule)
+		protected.DELETE("/finance/gl/posting-rules/:id", h.Ledger.DeletePostingRule)
+		protected.GET("/finance/gl/journal-entries", h.Ledger.ListJournalEntries)
+		protected.POST("/finance/gl/journal-entries", h.Ledger.CreateJournalEntry)
+		protected.GET("/finance/gl/journal-entries/:id", h.Ledger.GetJournalEntry)
+		protected.POST("/finance/gl/journal-entries/:id/reverse", h.Ledger.ReverseJournalEntry)
+		protected.GET("/finance/gl/trial-balance", h.Ledger.GetTrialBalance)
+		protected.GET("/finance/gl/detail", h.Ledger.GetGeneralLedgerDetail)
+
+		// Bank reconciliation routes
+		protected.POST("/finance/bank-accounts/:id/statements", h.BankReconciliation.ImportStatement)
+		protected.GET("/finance/bank-statements", h.BankReconciliation.ListStatements)
+		protected.GET("/finance/bank-statements/:id", h.BankReconciliation.GetStatement)
+		protected.POST("/finance/bank-statements/:id/auto-reconcile", h.BankReconciliation.AutoReconcile)
+		protected.GET("/finance/bank-statement-lines", h.BankReconciliation.ListLines)
+		protected.GET("/finance/bank-statement-lines/:id", h.BankReconciliation.GetLine)
+		protected.POST("/finance/bank-statement-lines/:id/suggestions", h.BankReconciliation.RefreshSuggestions)
+		protected.POST("/finance/bank-statement-lines/:id/reconcile", h.BankReconciliation.ReconcileLine)
+		protected.POST("/finance/bank-statement-lines/:id/ignore", h.BankReconciliation.IgnoreLine)
+
+		// Foreign exchange routes
+		protected.POST("/finance/fx/revaluations", h.FX.RunRevaluation)
+		protected.GET("/finance/fx/revaluations", h.FX.ListRevaluations)
+		protected.GET("/finance/fx/revaluations/:id", h.FX.GetRevaluation)
+		protected.GET("/finance/fx/exposure", h.FX.GetExposureReport)
+		protected.GET("/finance/fx/realized", h.FX.GetRealizedReport)
+
+		// Credit routes
+		protected.GET("/credit/customers/:id/exposure", h.Credit.GetExposure)
+		protected.GET("/credit/customers/:id/profile", h.Credit.GetProfile)
+		protected.PUT("/credit/customers/:id/profile", h.Credit.UpdateProfile)
+		protected.POST("/credit/customers/:id/assess", h.Credit.AssessCustomer)
+		protected.POST("/credit/assess", h.Credit.AssessCompany)
+		protected.GET("/credit/holds", h.Credit.ListHolds)
+		protected.GET("/credit/holds/:id", h.Credit.GetHold)
+		protected.POST("/credit/holds/:id/override", h.Credit.RequestOverride)
+		protected.POST("/credit/holds/:id/approve", h.Credit.ApproveHold)
+		protected.POST("/credit/holds/:id/reject", h.Credit.RejectHold)
+
+		// Dunning routes
+		protected.GET("/collections/policies", h.Dunning.ListPolicies)
+		protected.POST("/collections/policies", h.Dunning.CreatePolicy)
+		protected.GET("/collections/policies/:id", h.Dunning.GetPolicy)
+		protected.PUT("/collections/policies/:id", h.Dunning.UpdatePolicy)
+		protected.GET("/collections/templates", h.Dunning.ListTemplates)
+		protected.POST("/collections/templates", h.Dunning.CreateTemplate)
+		protected.PUT("/collections/templates/:id", h.Dunning.UpdateTemplate)
+		protected.POST("/collections/runs", h.Dunning.Run)
+		protected.GET("/collections/customers/:id/statement", h.Dunning.GetStatement)
+		protected.GET("/collections/notices", h.Dunning.ListNotices)
+		protected.GET("/collections/notices/:id", h.Dunning.GetNotice)
+		protected.POST("/collections/notices/:id/sent", h.Dunning.MarkNoticeSent)
+		protected.GET("/collections/promises", h.Dunning.ListPromises)
+		protected.POST("/collections/promises", h.Dunning.CreatePromise)
+		protected.POST("/collections/promises/:id/cancel", h.Dunning.CancelPromise)
+		protected.GET("/collections/notes", h.Dunning.ListNotes)
+		protected.POST("/collections/notes", h.Dunning.CreateNote)
+		protected.GET("/collections/worklist", h.Dunning.GetWorklist)
+		protected.POST("/collections/worklist/push", h.Dunning.PushWorklist)
+
+		// E-invoice routes
+		protected.GET("/einvoice/parties", h.EInvoice.ListParties)
+		protected.PUT("/einvoice/parties", h.EInvoice.SaveParty)
+		protected.POST("/invoices/:id/einvoice", h.EInvoice.Generate)
+		protected.POST("/invoices/:id/einvoice/validate", h.EInvoice.Validate)
+		protected.GET("/einvoices", h.EInvoice.List)
+		protected.GET("/einvoices/:id", h.EInvoice.Get)
+		protected.GET("/einvoices/:id/download", h.EInvoice.Download)
+		protected.POST("/einvoices/:id/verify", h.EInvoice.Verify)
+		protected.POST("/einvoices/:id/transmit", h.EInvoice.Transmit)
+
+		// Cash forecast routes
+		protected.GET("/finance/cash-forecast", h.CashForecast.GetForecast)
+		protected.GET("/finance/cash-forecast/recurring-expenses", h.CashForecast.ListRecurringExpenses)
+		protected.POST("/finance/cash-forecast/recurring-expenses", h.CashForecast.CreateRecurringExpense)
+		protected.PUT("/finance/cash-forecast/recurring-expenses/:id", h.CashForecast.UpdateRecurringExpense)
+		protected.GET("/finance/cash-forecast/scenarios", h.CashForecast.ListScenarios)
+		protected.POST("/finance/cash-forecast/scenarios", h.CashForecast.CreateScenario)
+		protected.GET("/finance/cash-forecast/scenarios/:id", h.CashForecast.GetScenario)
+		protected.PUT("/finance/cash-forecast/scenarios/:id", h.CashForecast.UpdateScenario)
+		protected.GET("/finance/cash-forecast/snapshots", h.CashForecast.ListSnapshots)
+		protected.POST("/finance/cash-forecast/snapshots", h.CashForecast.TakeSnapshot)
+		protected.GET("/finance/cash-forecast/snapshots/:id", h.CashForecast.GetSnapshot)
+		protected.GET("/finance/cash-forecast/snapshots/:id/accuracy", h.CashForecast.GetAccuracy)
+
+		// Job costing routes
+		protected.GET("/production-orders/:id/job-cost", h.JobCost.Get)
+		protected.POST("/production-orders/:id/job-cost/recalculate", h.JobCost.Recalculate)
+		protected.GET("/job-costs", h.JobCost.List)
+		protected.GET("/job-costs/variances", h.JobCost.Variances)
+
+		// Cost calibration routes
+		protected.POST("/process-costs/calibrations", h.CostCalibration.Calibrate)
+		protected.GET("/process-costs/calibrations", h.CostCalibration.ListCalibrations)
+		protected.GET("/process-costs/calibrations/:id", h.CostCalibration.GetCalibration)
+		protected.GET("/process-costs/calibration-suggestions", h.CostCalibration.ListSuggestions)
+		protected.GET("/process-costs/calibration-suggestions/:id", h.CostCalibration.GetSuggestion)
+		protected.POST("/process-costs/calibration-suggestions/:id/accept", h.CostCalibration.AcceptSuggestion)
+		protected.POST("/process-costs/calibration-suggestions/:id/dismiss", h.CostCalibration.DismissSuggestion)
+
+		// Sampling plan routes
+		protected.POST("/sampling-plans", h.Sampling.CreatePlan)
+		protected.GET("/sampling-plans", h.Sampling.ListPlans)
+		protected.GET("/sampling-plans/preview", h.Sampling.PreviewPlan)
+		protected.GET("/sampling-plans/:id", h.Sampling.GetPlan)
+		protected.PUT("/sampling-plans/:id", h.Sampling.UpdatePlan)
+		protected.GET("/sampling-states", h.Sampling.ListStates)
+		protected.GET("/sampling-states/:id", h.Sampling.GetState)
+		protected.POST("/sampling-states/:id/switch", h.Sampling.SwitchState)
+
+		// SPC routes
+		protected.POST("/quality-characteristics", h.SPC.CreateCharacteristic)
+		protected.GET("/quality-characteristics", h.SPC.ListCharacteristics)
+		protected.GET("/quality-characteristics/:id", h.SPC.GetCharacteristic)
+		protected.PUT("/quality-characteristics/:id", h.SPC.UpdateCharacteristic)
+		protected.POST("/quality-characteristics/:id/measurements", h.SPC.RecordMeasurements)
+		protected.GET("/quality-characteristics/:id/measurements", h.SPC.ListMeasurements)
+		protected.GET("/quality-characteristics/:id/spc", h.SPC.GetSPC)
+		protected.GET("/spc-alerts", h.SPC.ListAlerts)
+
+		// Nonconformance (NCR/8D) routes
+		protected.POST("/ncrs", h.NCR.CreateNCR)
+		protected.GET("/ncrs", h.NCR.ListNCRs)
+		protected.GET("/ncrs/:id", h.NCR.GetNCR)
+		protected.PUT("/ncrs/:id", h.NCR.UpdateNCR)
+		protected.POST("/ncrs/:id/cancel", h.NCR.CancelNCR)
+		protected.PUT("/ncrs/:id/steps/:discipline", h.NCR.UpdateStep)
+		protected.POST("/ncrs/:id/disposition", h.NCR.SetDisposition)
+		protected.POST("/ncrs/:id/root-cause", h.NCR.SetRootCause)
+		protected.POST("/ncrs/:id/verify", h.NCR.VerifyEffectiveness)
+		protected.POST("/ncrs/:id/containments", h.NCR.AddContainment)
+		protected.PUT("/ncrs/:id/containments/:containment_id", h.NCR.UpdateContainment)
+		protected.GET("/ncr-containments", h.NCR.ListLotContainments)
+
+		// Certificate routes
+		protected.POST("/mill-certificates", h.Certificate.CreateMillCertificate)
+		protected.GET("/mill-certificates", h.Certificate.ListMillCertificates)
+		protected.GET("/mill-certificates/:id", h.Certificate.GetMillCertificate)
+		protected.PUT("/mill-certificates/:id", h.Certificate.UpdateMillCertificate)
+		protected.POST("/trade/shipments/:shipment_id/inspection-certificates", h.Certificate.IssueCertificate)
+		protected.GET("/inspection-certificates", h.Certificate.ListCertificates)
+		protected.GET("/inspection-certificates/:id", h.Certificate.GetCertificate)
+		protected.GET("/inspection-certificates/:id/download", h.Certificate.DownloadCertificate)
+		protected.POST("/inspection-certificates/:id/revoke", h.Certificate.RevokeCertificate)
+
+		// PPAP routes
+		protected.POST("/ppaps", h.PPAP.CreateSubmission)
+		protected.GET("/ppaps", h.PPAP.ListSubmissions)
+		protected.GET("/ppaps/:id", h.PPAP.GetSubmission)
+		protected.PUT("/ppaps/:id", h.PPAP.UpdateSubmission)
+		protected.PUT("/ppaps/:id/elements/:element", h.PPAP.UpdateElement)
+		protected.POST("/ppaps/:id/elements/:element/documents", h.PPAP.UploadDocument)
+		protected.GET("/ppaps/:id/documents/:document_id/download", h.PPAP.DownloadDocument)
+		protected.POST("/ppaps/:id/submit", h.PPAP.SubmitSubmission)
+		protected.POST("/ppaps/:id/decision", h.PPAP.DecideSubmission)
+		protected.GET("/ppap-warnings", h.PPAP.ListReleaseWarnings)
+		protected.POST("/ppap-warnings/:id/acknowledge", h.PPAP.AcknowledgeReleaseWarning)
+
+		// Supplier scorecard routes
+		protected.GET("/supplier-scorecards/config", h.Scorecard.GetConfig)
+		protected.PUT("/supplier-scorecards/config", h.Scorecard.UpdateConfig)
+		protected.POST("/supplier-scorecards/compute", h.Scorecard.ComputeScorecards)
+		protected.GET("/supplier-scorecards", h.Scorecard.ListScorecards)
+		protected.GET("/supplier-scorecards/:id", h.Scorecard.GetScorecard)
+		protected.GET("/suppliers/:supplier_id/scorecard-trend", h.Scorecard.GetTrend)
+
+		// Purchase requisition and supplier RFQ routes
+		protected.POST("/purchase-requisitions", h.Supplier.CreateRequisition)
+		protected.GET("/purchase-requisitions", h.Supplier.ListRequisitions)
+		protected.GET("/purchase-requisitions/:id", h.Supplier.GetRequisition)
+		protected.POST("/purchase-requisitions/:id/rfqs", h.Supplier.CreateRFQ)
+		protected.GET("/supplier-rfqs", h.Supplier.ListRFQs)
+		protected.GET("/supplier-rfqs/:id", h.Supplier.GetRFQ)
+		protected.POST("/supplier-rfqs/:id/invitations", h.Supplier.InviteSuppliers)
+		protected.POST("/supplier-rfqs/:id/send", h.Supplier.SendRFQ)
+		protected.GET("/supplier-rfqs/:id/comparison", h.Supplier.CompareBids)
+		protected.POST("/supplier-rfqs/:id/award", h.Supplier.AwardBid)
+
+		// Three-way match routes
+		protected.GET("/invoice-matching/config", h.InvoiceMatch.GetConfig)
+		protected.PUT("/invoice-matching/config", h.InvoiceMatch.UpdateConfig)
+		protected.POST("/supplier-invoices", h.InvoiceMatch.RecordSupplierInvoice)
+		protected.POST("/invoices/:id/match", h.InvoiceMatch.MatchInvoice)
+		protected.POST("/purchase-orders/:id/rematch", h.InvoiceMatch.RematchOrder)
+		protected.GET("/invoice-matches", h.InvoiceMatch.ListMatches)
+		protected.GET("/invoice-matches/:id", h.InvoiceMatch.GetMatch)
+		protected.POST("/invoice-matches/:id/release", h.InvoiceMatch.ReleaseMatch)
+		protected.POST("/invoice-matches/:id/reject", h.InvoiceMatch.RejectMatch)
+
+		// Subcontract routes
+		protected.POST("/subcontract-orders", h.Subcontract.CreateOrder)
+		protected.GET("/subcontract-orders", h.Subcontract.ListOrders)
+		protected.GET("/subcontract-orders/:id", h.Subcontract.GetOrder)
+		protected.POST("/subcontract-orders/:id/shipments", h.Subcontract.Ship)
+		protected.POST("/subcontract-orders/:id/receipts", h.Subcontract.Receive)
+		protected.POST("/subcontract-orders/:id/cancel", h.Subcontract.Cancel)
+		protected.GET("/subcontract-stock", h.Subcontract.ListVendorStock)
+
+		// Product master routes
+		protected.GET("/fastener-standards", h.ProductMaster.ListStandards)
+		protected.GET("/fastener-specs", h.ProductMaster.ListSpecifications)
+		protected.GET("/fastener-specs/:inventory_id", h.ProductMaster.GetSpecification)
+		protected.PUT("/fastener-specs/:inventory_id", h.ProductMaster.SaveSpecification)
+		protected.POST("/customer-parts", h.ProductMaster.CreatePart)
+		protected.GET("/customer-parts", h.ProductMaster.ListParts)
+		protected.GET("/customer-parts/resolve", h.ProductMaster.ResolvePart)
+		protected.GET("/customer-parts/:id", h.ProductMaster.GetPart)
+		protected.PUT("/customer-parts/:id", h.ProductMaster.UpdatePart)
+		protected.POST("/customer-parts/:id/drawings", h.ProductMaster.UploadDrawing)
+		protected.GET("/customer-parts/:id/drawings/:drawing_id", h.ProductMaster.DownloadDrawing)
+		protected.GET("/revision-flags", h.ProductMaster.ListFlags)
+		protected.GET("/revision-flags/:id", h.ProductMaster.GetFlag)
+		protected.POST("/revision-flags/:id/resolve", h.ProductMaster.ResolveFlag)
+
 		// Advanced Feature routes
 		// AI Assistant
 		protected.GET("/advanced/ai-assistants", h.Advanced.ListAIAssistants)
@@ -15,6 +15,8 @@ type Config struct {
 	CORS     CORSConfig
 	Upload   UploadConfig
 	Email    EmailConfig
+	Signing  SigningConfig
+	Documents DocumentsConfig
 	Messaging MessagingConfig
 	Tracing   TracingConfig
 	CQRS      CQRSConfig
@@ -79,6 +81,25 @@ type UploadConfig struct {
 	Path    string
 }
 
+// SigningConfig holds the key used to sign issued documents. Without a
+// key file, e-invoices are signed with a key derived from the signing
+// secret and inspection certificates cannot be issued, since customers
+// could not verify them. The server does not start without either, or with
+// a key file that cannot be loaded.
+type SigningConfig struct {
+	PrivateKeyFile string
+	Secret         string
+}
+
+// DocumentsConfig holds the TrueType font generated export documents are
+// printed in. Without a font file, the embedded DejaVu Sans is used, which
+// has no CJK glyphs; set a CJK font such as Noto Sans TC to print Chinese
+// names and addresses. A font file that cannot be loaded stops the server
+// from starting.
+type DocumentsConfig struct {
+	FontFile string
+}
+
 type EmailConfig struct {
 	SMTPHost     string
 	SMTPPort     int
@@ -136,6 +157,13 @@ func New() *Config {
 			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
 			FromAddress:  getEnv("SMTP_FROM", "noreply@fastenmind.com"),
 		},
+		Signing: SigningConfig{
+			PrivateKeyFile: getEnv("SIGNING_PRIVATE_KEY_FILE", ""),
+			Secret:         getEnv("SIGNING_SECRET", ""),
+		},
+		Documents: DocumentsConfig{
+			FontFile: getEnv("DOCUMENT_FONT_FILE", ""),
+		},
 	}
 	
 	// Load messaging and other configs
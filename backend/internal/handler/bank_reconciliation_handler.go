@@ -0,0 +1,275 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/bankstatement"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// BankReconciliationHandler handles bank statement imports and the
+// reconciliation workspace
+type BankReconciliationHandler struct {
+	reconciliationService service.BankReconciliationService
+}
+
+// NewBankReconciliationHandler creates a new bank reconciliation handler
+func NewBankReconciliationHandler(reconciliationService service.BankReconciliationService) *BankReconciliationHandler {
+	return &BankReconciliationHandler{
+		reconciliationService: reconciliationService,
+	}
+}
+
+// Statements
+
+// ImportStatement imports an uploaded CAMT.053, MT940 or CSV statement of a
+// bank account. CSV columns may be given as a JSON mapping.
+func (h *BankReconciliationHandler) ImportStatement(c echo.Context) error {
+	bankAccountID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid bank account ID"})
+	}
+	format := c.FormValue("format")
+	if format == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "format is required"})
+	}
+
+	var mapping *bankstatement.CSVMapping
+	if raw := c.FormValue("mapping"); raw != "" {
+		mapping = &bankstatement.CSVMapping{}
+		if err := json.Unmarshal([]byte(raw), mapping); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid CSV mapping"})
+		}
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No file provided"})
+	}
+	src, err := file.Open()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open file"})
+	}
+	defer src.Close()
+
+	result, err := h.reconciliationService.ImportStatement(c.Request().Context(), service.ImportBankStatementRequest{
+		CompanyID:     c.Get("company_id").(uuid.UUID),
+		BankAccountID: bankAccountID,
+		Format:        format,
+		FileName:      file.Filename,
+		Reader:        src,
+		Mapping:       mapping,
+		AutoReconcile: c.FormValue("auto_reconcile") == "true",
+		UserID:        getUserIDFromContext(c),
+	})
+	if err != nil {
+		return h.reconciliationError(c, err)
+	}
+	return c.JSON(http.StatusCreated, result)
+}
+
+// ListStatements lists imported statements, optionally of one bank account
+func (h *BankReconciliationHandler) ListStatements(c echo.Context) error {
+	params := map[string]interface{}{
+		"status": c.QueryParam("status"),
+	}
+	if id := c.QueryParam("bank_account_id"); id != "" {
+		bankAccountID, err := uuid.Parse(id)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid bank account ID"})
+		}
+		params["bank_account_id"] = bankAccountID
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	statements, total, err := h.reconciliationService.ListStatements(c.Request().Context(), c.Get("company_id").(uuid.UUID), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list bank statements"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  statements,
+		"total": total,
+	})
+}
+
+// GetStatement returns a statement with its lines and their allocations
+func (h *BankReconciliationHandler) GetStatement(c echo.Context) error {
+	statement, err := h.getStatement(c)
+	if err != nil {
+		return h.reconciliationError(c, err)
+	}
+	return c.JSON(http.StatusOK, statement)
+}
+
+// AutoReconcile matches the open lines of a statement again and reconciles
+// the confident matches
+func (h *BankReconciliationHandler) AutoReconcile(c echo.Context) error {
+	statement, err := h.getStatement(c)
+	if err != nil {
+		return h.reconciliationError(c, err)
+	}
+
+	result, err := h.reconciliationService.AutoReconcile(c.Request().Context(), statement.ID, getUserIDFromContext(c))
+	if err != nil {
+		return h.reconciliationError(c, err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// getStatement loads the statement in the path, hiding those of other companies
+func (h *BankReconciliationHandler) getStatement(c echo.Context) (*models.BankStatement, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrBankStatementNotFound
+	}
+	statement, err := h.reconciliationService.GetStatement(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if statement.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrBankStatementNotFound
+	}
+	return statement, nil
+}
+
+// Reconciliation workspace
+
+// ListLines lists statement lines; status=open returns the lines still to
+// be reconciled
+func (h *BankReconciliationHandler) ListLines(c echo.Context) error {
+	params := map[string]interface{}{}
+	switch status := c.QueryParam("status"); status {
+	case "":
+	case "open":
+		params["statuses"] = []string{"unmatched", "suggested", "partially_reconciled"}
+	default:
+		params["status"] = status
+	}
+	for _, key := range []string{"statement_id", "bank_account_id"} {
+		if value := c.QueryParam(key); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid " + key})
+			}
+			params[key] = id
+		}
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	lines, total, err := h.reconciliationService.ListLines(c.Request().Context(), c.Get("company_id").(uuid.UUID), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list statement lines"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  lines,
+		"total": total,
+	})
+}
+
+// GetLine returns a statement line with its suggestions and allocations
+func (h *BankReconciliationHandler) GetLine(c echo.Context) error {
+	line, err := h.getLine(c)
+	if err != nil {
+		return h.reconciliationError(c, err)
+	}
+	return c.JSON(http.StatusOK, line)
+}
+
+// RefreshSuggestions matches a line again against the current open items
+func (h *BankReconciliationHandler) RefreshSuggestions(c echo.Context) error {
+	line, err := h.getLine(c)
+	if err != nil {
+		return h.reconciliationError(c, err)
+	}
+
+	line, err = h.reconciliationService.RefreshSuggestions(c.Request().Context(), line.ID)
+	if err != nil {
+		return h.reconciliationError(c, err)
+	}
+	return c.JSON(http.StatusOK, line)
+}
+
+// ReconcileLine allocates a line to invoices, pending payments, a partner's
+// account or bank charges
+func (h *BankReconciliationHandler) ReconcileLine(c echo.Context) error {
+	line, err := h.getLine(c)
+	if err != nil {
+		return h.reconciliationError(c, err)
+	}
+
+	var req service.ReconcileLineRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.LineID = line.ID
+	req.UserID = getUserIDFromContext(c)
+
+	line, err = h.reconciliationService.ReconcileLine(c.Request().Context(), req)
+	if err != nil {
+		return h.reconciliationError(c, err)
+	}
+	return c.JSON(http.StatusOK, line)
+}
+
+// IgnoreLine closes a line that settles nothing in the books
+func (h *BankReconciliationHandler) IgnoreLine(c echo.Context) error {
+	line, err := h.getLine(c)
+	if err != nil {
+		return h.reconciliationError(c, err)
+	}
+
+	line, err = h.reconciliationService.IgnoreLine(c.Request().Context(), line.ID, getUserIDFromContext(c))
+	if err != nil {
+		return h.reconciliationError(c, err)
+	}
+	return c.JSON(http.StatusOK, line)
+}
+
+// getLine loads the line in the path, hiding those of other companies
+func (h *BankReconciliationHandler) getLine(c echo.Context) (*models.BankStatementLine, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrBankStatementLineNotFound
+	}
+	line, err := h.reconciliationService.GetLine(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if line.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrBankStatementLineNotFound
+	}
+	return line, nil
+}
+
+func (h *BankReconciliationHandler) reconciliationError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrBankAccountNotFound), errors.Is(err, service.ErrBankStatementNotFound),
+		errors.Is(err, service.ErrBankStatementLineNotFound), errors.Is(err, service.ErrInvoiceNotFound),
+		errors.Is(err, service.ErrPaymentNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidBankStatement), errors.Is(err, service.ErrInvalidReconciliation):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrDuplicateBankStatement), errors.Is(err, service.ErrLineAlreadyReconciled),
+		errors.Is(err, service.ErrPeriodClosed):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrStatementCurrencyMismatch), errors.Is(err, service.ErrPostingAccountMissing):
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process bank reconciliation request"})
+}
@@ -0,0 +1,303 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// CashForecastHandler handles the 13-week cash forecast, its recurring
+// expenses and scenarios, and the snapshots used to track its accuracy
+type CashForecastHandler struct {
+	forecastService service.CashForecastService
+}
+
+// NewCashForecastHandler creates a new cash forecast handler
+func NewCashForecastHandler(forecastService service.CashForecastService) *CashForecastHandler {
+	return &CashForecastHandler{
+		forecastService: forecastService,
+	}
+}
+
+// Forecast
+
+// GetForecast returns the forecast as of ?as_of (default today), under
+// ?scenario_id when given; ?flows=true lists the individual flows
+func (h *CashForecastHandler) GetForecast(c echo.Context) error {
+	req, err := h.forecastRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	req.IncludeFlows = c.QueryParam("flows") == "true"
+
+	forecast, err := h.forecastService.GetForecast(c.Request().Context(), req)
+	if err != nil {
+		return h.forecastError(c, err)
+	}
+	return c.JSON(http.StatusOK, forecast)
+}
+
+// Recurring expenses
+
+// ListRecurringExpenses lists the recurring expenses of the company
+func (h *CashForecastHandler) ListRecurringExpenses(c echo.Context) error {
+	expenses, err := h.forecastService.ListRecurringExpenses(c.Request().Context(), c.Get("company_id").(uuid.UUID))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list recurring expenses"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  expenses,
+		"total": len(expenses),
+	})
+}
+
+// CreateRecurringExpense adds a recurring expense to the forecast
+func (h *CashForecastHandler) CreateRecurringExpense(c echo.Context) error {
+	var req service.RecurringExpenseRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	expense, err := h.forecastService.CreateRecurringExpense(c.Request().Context(), c.Get("company_id").(uuid.UUID), getUserIDFromContext(c), req)
+	if err != nil {
+		return h.forecastError(c, err)
+	}
+	return c.JSON(http.StatusCreated, expense)
+}
+
+// UpdateRecurringExpense changes a recurring expense
+func (h *CashForecastHandler) UpdateRecurringExpense(c echo.Context) error {
+	expense, err := h.getRecurringExpense(c)
+	if err != nil {
+		return h.forecastError(c, err)
+	}
+	var req service.RecurringExpenseRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	expense, err = h.forecastService.UpdateRecurringExpense(c.Request().Context(), expense.ID, getUserIDFromContext(c), req)
+	if err != nil {
+		return h.forecastError(c, err)
+	}
+	return c.JSON(http.StatusOK, expense)
+}
+
+// Scenarios
+
+// ListScenarios lists the forecast scenarios of the company
+func (h *CashForecastHandler) ListScenarios(c echo.Context) error {
+	scenarios, err := h.forecastService.ListScenarios(c.Request().Context(), c.Get("company_id").(uuid.UUID))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list forecast scenarios"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  scenarios,
+		"total": len(scenarios),
+	})
+}
+
+// CreateScenario creates a forecast scenario
+func (h *CashForecastHandler) CreateScenario(c echo.Context) error {
+	var req service.CashForecastScenarioRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	scenario, err := h.forecastService.CreateScenario(c.Request().Context(), c.Get("company_id").(uuid.UUID), getUserIDFromContext(c), req)
+	if err != nil {
+		return h.forecastError(c, err)
+	}
+	return c.JSON(http.StatusCreated, scenario)
+}
+
+// GetScenario returns a forecast scenario
+func (h *CashForecastHandler) GetScenario(c echo.Context) error {
+	scenario, err := h.getScenario(c)
+	if err != nil {
+		return h.forecastError(c, err)
+	}
+	return c.JSON(http.StatusOK, scenario)
+}
+
+// UpdateScenario changes the overrides of a forecast scenario
+func (h *CashForecastHandler) UpdateScenario(c echo.Context) error {
+	scenario, err := h.getScenario(c)
+	if err != nil {
+		return h.forecastError(c, err)
+	}
+	var req service.CashForecastScenarioRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	scenario, err = h.forecastService.UpdateScenario(c.Request().Context(), scenario.ID, getUserIDFromContext(c), req)
+	if err != nil {
+		return h.forecastError(c, err)
+	}
+	return c.JSON(http.StatusOK, scenario)
+}
+
+// Snapshots
+
+// TakeSnapshot stores the current forecast for accuracy tracking
+func (h *CashForecastHandler) TakeSnapshot(c echo.Context) error {
+	req, err := h.forecastRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	userID := getUserIDFromContext(c)
+	snapshot, err := h.forecastService.TakeSnapshot(c.Request().Context(), req, &userID)
+	if err != nil {
+		return h.forecastError(c, err)
+	}
+	return c.JSON(http.StatusCreated, snapshot)
+}
+
+// ListSnapshots lists the forecast snapshots of the company
+func (h *CashForecastHandler) ListSnapshots(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+	}
+	if scenarioID, err := uuid.Parse(c.QueryParam("scenario_id")); err == nil {
+		params["scenario_id"] = scenarioID
+	}
+	if from, err := time.Parse("2006-01-02", c.QueryParam("from")); err == nil {
+		params["from"] = from
+	}
+	if to, err := time.Parse("2006-01-02", c.QueryParam("to")); err == nil {
+		params["to"] = to
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	snapshots, total, err := h.forecastService.ListSnapshots(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list forecast snapshots"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  snapshots,
+		"total": total,
+	})
+}
+
+// GetSnapshot returns a forecast snapshot with its lines
+func (h *CashForecastHandler) GetSnapshot(c echo.Context) error {
+	snapshot, err := h.getSnapshot(c)
+	if err != nil {
+		return h.forecastError(c, err)
+	}
+	return c.JSON(http.StatusOK, snapshot)
+}
+
+// GetAccuracy compares a snapshot with the actual payments of the weeks
+// closed by ?through (default today)
+func (h *CashForecastHandler) GetAccuracy(c echo.Context) error {
+	snapshot, err := h.getSnapshot(c)
+	if err != nil {
+		return h.forecastError(c, err)
+	}
+	var through time.Time
+	if v := c.QueryParam("through"); v != "" {
+		through, err = time.Parse("2006-01-02", v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid through date"})
+		}
+	}
+
+	accuracy, err := h.forecastService.GetAccuracy(c.Request().Context(), snapshot.ID, through)
+	if err != nil {
+		return h.forecastError(c, err)
+	}
+	return c.JSON(http.StatusOK, accuracy)
+}
+
+func (h *CashForecastHandler) forecastRequest(c echo.Context) (service.CashForecastRequest, error) {
+	req := service.CashForecastRequest{CompanyID: c.Get("company_id").(uuid.UUID)}
+	if v := c.QueryParam("as_of"); v != "" {
+		asOf, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return req, errors.New("Invalid as_of date")
+		}
+		req.AsOf = asOf
+	}
+	if v := c.QueryParam("scenario_id"); v != "" {
+		scenarioID, err := uuid.Parse(v)
+		if err != nil {
+			return req, errors.New("Invalid scenario ID")
+		}
+		req.ScenarioID = &scenarioID
+	}
+	return req, nil
+}
+
+// getRecurringExpense loads the recurring expense in the path, hiding those
+// of other companies
+func (h *CashForecastHandler) getRecurringExpense(c echo.Context) (*models.RecurringExpense, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrRecurringExpenseNotFound
+	}
+	expense, err := h.forecastService.GetRecurringExpense(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if expense.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrRecurringExpenseNotFound
+	}
+	return expense, nil
+}
+
+// getScenario loads the scenario in the path, hiding those of other companies
+func (h *CashForecastHandler) getScenario(c echo.Context) (*models.CashForecastScenario, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrCashForecastScenarioNotFound
+	}
+	scenario, err := h.forecastService.GetScenario(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if scenario.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrCashForecastScenarioNotFound
+	}
+	return scenario, nil
+}
+
+// getSnapshot loads the snapshot in the path, hiding those of other companies
+func (h *CashForecastHandler) getSnapshot(c echo.Context) (*models.CashForecastSnapshot, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrCashForecastSnapshotNotFound
+	}
+	snapshot, err := h.forecastService.GetSnapshot(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrCashForecastSnapshotNotFound
+	}
+	return snapshot, nil
+}
+
+func (h *CashForecastHandler) forecastError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrRecurringExpenseNotFound), errors.Is(err, service.ErrCashForecastScenarioNotFound),
+		errors.Is(err, service.ErrCashForecastSnapshotNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRecurringExpense), errors.Is(err, service.ErrInvalidCashForecastScenario):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process cash forecast request"})
+}
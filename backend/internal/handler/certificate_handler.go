@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// CertificateHandler handles mill certificates of material heats and the
+// inspection certificates issued with shipments, including their public
+// verification
+type CertificateHandler struct {
+	certificateService service.CertificateService
+}
+
+// NewCertificateHandler creates a new certificate handler
+func NewCertificateHandler(certificateService service.CertificateService) *CertificateHandler {
+	return &CertificateHandler{
+		certificateService: certificateService,
+	}
+}
+
+// Mill certificates
+
+// CreateMillCertificate records the mill certificate of a heat
+func (h *CertificateHandler) CreateMillCertificate(c echo.Context) error {
+	var cert models.MillCertificate
+	if err := c.Bind(&cert); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	cert.ID = uuid.Nil
+	cert.CompanyID = c.Get("company_id").(uuid.UUID)
+	userID := getUserIDFromContext(c)
+	cert.CreatedBy = &userID
+
+	if err := h.certificateService.CreateMillCertificate(c.Request().Context(), &cert); err != nil {
+		return h.certificateError(c, err)
+	}
+	return c.JSON(http.StatusCreated, cert)
+}
+
+// ListMillCertificates lists mill certificates; filter on ?supplier_id,
+// ?inventory_id and ?search
+func (h *CertificateHandler) ListMillCertificates(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+		"search":     c.QueryParam("search"),
+	}
+	for _, field := range []string{"supplier_id", "inventory_id"} {
+		if id, err := uuid.Parse(c.QueryParam(field)); err == nil {
+			params[field] = id
+		}
+	}
+	certificatePageParams(c, params)
+
+	certs, total, err := h.certificateService.ListMillCertificates(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list mill certificates"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  certs,
+		"total": total,
+	})
+}
+
+// GetMillCertificate returns a mill certificate
+func (h *CertificateHandler) GetMillCertificate(c echo.Context) error {
+	cert, err := h.getMillCertificate(c)
+	if err != nil {
+		return h.certificateError(c, err)
+	}
+	return c.JSON(http.StatusOK, cert)
+}
+
+// UpdateMillCertificate corrects a mill certificate
+func (h *CertificateHandler) UpdateMillCertificate(c echo.Context) error {
+	cert, err := h.getMillCertificate(c)
+	if err != nil {
+		return h.certificateError(c, err)
+	}
+	var req models.MillCertificate
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	cert, err = h.certificateService.UpdateMillCertificate(c.Request().Context(), cert.ID, &req)
+	if err != nil {
+		return h.certificateError(c, err)
+	}
+	return c.JSON(http.StatusOK, cert)
+}
+
+// Inspection certificates
+
+// IssueCertificate issues the signed EN 10204 3.1 certificate of a shipment
+func (h *CertificateHandler) IssueCertificate(c echo.Context) error {
+	shipmentID, err := uuid.Parse(c.Param("shipment_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid shipment ID"})
+	}
+	var req service.IssueCertificateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.CompanyID = c.Get("company_id").(uuid.UUID)
+	req.ShipmentID = shipmentID
+	req.UserID = getUserIDFromContext(c)
+	req.VerifyURL = fmt.Sprintf("%s://%s/api/v1/certificates/verify", c.Scheme(), c.Request().Host)
+
+	cert, err := h.certificateService.IssueCertificate(c.Request().Context(), req)
+	if err != nil {
+		return h.certificateError(c, err)
+	}
+	return c.JSON(http.StatusCreated, cert)
+}
+
+// ListCertificates lists inspection certificates; filter on ?shipment_id,
+// ?customer_id, ?status and ?search
+func (h *CertificateHandler) ListCertificates(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+		"status":     c.QueryParam("status"),
+		"search":     c.QueryParam("search"),
+	}
+	for _, field := range []string{"shipment_id", "customer_id"} {
+		if id, err := uuid.Parse(c.QueryParam(field)); err == nil {
+			params[field] = id
+		}
+	}
+	certificatePageParams(c, params)
+
+	certs, total, err := h.certificateService.ListCertificates(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list inspection certificates"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  certs,
+		"total": total,
+	})
+}
+
+// GetCertificate returns an inspection certificate with its lines
+func (h *CertificateHandler) GetCertificate(c echo.Context) error {
+	cert, err := h.getCertificate(c)
+	if err != nil {
+		return h.certificateError(c, err)
+	}
+	return c.JSON(http.StatusOK, cert)
+}
+
+// DownloadCertificate returns the signed PDF of a certificate
+func (h *CertificateHandler) DownloadCertificate(c echo.Context) error {
+	cert, err := h.getCertificate(c)
+	if err != nil {
+		return h.certificateError(c, err)
+	}
+
+	cert, content, err := h.certificateService.OpenCertificate(c.Request().Context(), cert.ID)
+	if err != nil {
+		return h.certificateError(c, err)
+	}
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.pdf", cert.CertificateNo))
+	return c.Blob(http.StatusOK, "application/pdf", content)
+}
+
+// RevokeCertificate withdraws a certificate issued in error
+func (h *CertificateHandler) RevokeCertificate(c echo.Context) error {
+	cert, err := h.getCertificate(c)
+	if err != nil {
+		return h.certificateError(c, err)
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if req.Reason == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "reason is required"})
+	}
+
+	cert, err = h.certificateService.RevokeCertificate(c.Request().Context(), cert.ID, req.Reason, getUserIDFromContext(c))
+	if err != nil {
+		return h.certificateError(c, err)
+	}
+	return c.JSON(http.StatusOK, cert)
+}
+
+// VerifyCertificate looks a certificate up by the SHA-256 hash of its PDF.
+// The route is public so customers can check the certificates they receive.
+func (h *CertificateHandler) VerifyCertificate(c echo.Context) error {
+	result, err := h.certificateService.VerifyCertificate(c.Request().Context(), c.Param("hash"))
+	if err != nil {
+		if errors.Is(err, service.ErrCertificateNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "No certificate with this hash was issued"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to verify certificate"})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// getMillCertificate loads the mill certificate in the path, hiding those
+// of other companies
+func (h *CertificateHandler) getMillCertificate(c echo.Context) (*models.MillCertificate, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrMillCertificateNotFound
+	}
+	cert, err := h.certificateService.GetMillCertificate(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if cert.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrMillCertificateNotFound
+	}
+	return cert, nil
+}
+
+// getCertificate loads the inspection certificate in the path, hiding those
+// of other companies
+func (h *CertificateHandler) getCertificate(c echo.Context) (*models.InspectionCertificate, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrCertificateNotFound
+	}
+	cert, err := h.certificateService.GetCertificate(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if cert.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrCertificateNotFound
+	}
+	return cert, nil
+}
+
+func (h *CertificateHandler) certificateError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrMillCertificateNotFound), errors.Is(err, service.ErrCertificateNotFound),
+		errors.Is(err, service.ErrShipmentNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrMillCertificateExists), errors.Is(err, service.ErrCertificateRevoked),
+		errors.Is(err, service.ErrCertificateNonconforming):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidMillCertificate), errors.Is(err, service.ErrCertificateIncomplete),
+		errors.Is(err, service.ErrShipmentHasNoItems):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrCertificateSigningKey):
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process certificate request"})
+}
+
+func certificatePageParams(c echo.Context, params map[string]interface{}) {
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+}
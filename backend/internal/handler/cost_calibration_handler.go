@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// CostCalibrationHandler handles the calibration of process cost rates
+// against completed production orders and the review of its suggestions
+type CostCalibrationHandler struct {
+	calibrationService service.CostCalibrationService
+}
+
+// NewCostCalibrationHandler creates a new cost calibration handler
+func NewCostCalibrationHandler(calibrationService service.CostCalibrationService) *CostCalibrationHandler {
+	return &CostCalibrationHandler{
+		calibrationService: calibrationService,
+	}
+}
+
+// Calibrations
+
+// Calibrate runs a calibration over the orders completed between from and
+// to (inclusive, YYYY-MM-DD); without from the last year is used
+func (h *CostCalibrationHandler) Calibrate(c echo.Context) error {
+	var body struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	req := service.CostCalibrationRequest{CompanyID: c.Get("company_id").(uuid.UUID)}
+	if body.From != "" {
+		from, err := time.Parse("2006-01-02", body.From)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid from date"})
+		}
+		req.From = &from
+	} else {
+		from := time.Now().UTC().AddDate(-1, 0, 0)
+		req.From = &from
+	}
+	if body.To != "" {
+		to, err := time.Parse("2006-01-02", body.To)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid to date"})
+		}
+		to = to.AddDate(0, 0, 1)
+		req.To = &to
+	}
+
+	userID := getUserIDFromContext(c)
+	record, err := h.calibrationService.Calibrate(c.Request().Context(), req, &userID)
+	if err != nil {
+		return h.calibrationError(c, err)
+	}
+	return c.JSON(http.StatusCreated, record)
+}
+
+// ListCalibrations lists the calibrations of the company, latest first
+func (h *CostCalibrationHandler) ListCalibrations(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+	}
+	calibrationPageParams(c, params)
+
+	records, total, err := h.calibrationService.ListCalibrations(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list cost calibrations"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  records,
+		"total": total,
+	})
+}
+
+// GetCalibration returns a calibration with its suggestions
+func (h *CostCalibrationHandler) GetCalibration(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return h.calibrationError(c, service.ErrCostCalibrationNotFound)
+	}
+	record, err := h.calibrationService.GetCalibration(c.Request().Context(), id)
+	if err == nil && record.CompanyID != c.Get("company_id").(uuid.UUID) {
+		err = service.ErrCostCalibrationNotFound
+	}
+	if err != nil {
+		return h.calibrationError(c, err)
+	}
+	return c.JSON(http.StatusOK, record)
+}
+
+// Suggestions
+
+// ListSuggestions lists rate suggestions; filter on ?status, ?process_type
+// and ?calibration_id
+func (h *CostCalibrationHandler) ListSuggestions(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id":   c.Get("company_id").(uuid.UUID),
+		"status":       c.QueryParam("status"),
+		"process_type": c.QueryParam("process_type"),
+	}
+	if calibrationID, err := uuid.Parse(c.QueryParam("calibration_id")); err == nil {
+		params["calibration_id"] = calibrationID
+	}
+	calibrationPageParams(c, params)
+
+	suggestions, total, err := h.calibrationService.ListSuggestions(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list cost rate suggestions"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  suggestions,
+		"total": total,
+	})
+}
+
+// GetSuggestion returns a rate suggestion with the fit behind it
+func (h *CostCalibrationHandler) GetSuggestion(c echo.Context) error {
+	suggestion, err := h.getSuggestion(c)
+	if err != nil {
+		return h.calibrationError(c, err)
+	}
+	return c.JSON(http.StatusOK, suggestion)
+}
+
+// AcceptSuggestion creates a new template version from a suggestion; the
+// body may override the base rate, name and description
+func (h *CostCalibrationHandler) AcceptSuggestion(c echo.Context) error {
+	suggestion, err := h.getSuggestion(c)
+	if err != nil {
+		return h.calibrationError(c, err)
+	}
+	var req service.AcceptCostSuggestionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	template, err := h.calibrationService.AcceptSuggestion(c.Request().Context(), suggestion.ID, req, getUserIDFromContext(c))
+	if err != nil {
+		return h.calibrationError(c, err)
+	}
+	return c.JSON(http.StatusCreated, template)
+}
+
+// DismissSuggestion closes a suggestion without changing any template
+func (h *CostCalibrationHandler) DismissSuggestion(c echo.Context) error {
+	suggestion, err := h.getSuggestion(c)
+	if err != nil {
+		return h.calibrationError(c, err)
+	}
+	suggestion, err = h.calibrationService.DismissSuggestion(c.Request().Context(), suggestion.ID, getUserIDFromContext(c))
+	if err != nil {
+		return h.calibrationError(c, err)
+	}
+	return c.JSON(http.StatusOK, suggestion)
+}
+
+// getSuggestion loads the suggestion in the path, hiding those of other
+// companies
+func (h *CostCalibrationHandler) getSuggestion(c echo.Context) (*models.CostRateSuggestion, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrCostSuggestionNotFound
+	}
+	suggestion, err := h.calibrationService.GetSuggestion(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if suggestion.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrCostSuggestionNotFound
+	}
+	return suggestion, nil
+}
+
+func (h *CostCalibrationHandler) calibrationError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrCostCalibrationNotFound), errors.Is(err, service.ErrCostSuggestionNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrCostSuggestionDecided), errors.Is(err, service.ErrCostSuggestionStale):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidCostSuggestion), errors.Is(err, service.ErrNoCalibrationJobs):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process cost calibration request"})
+}
+
+func calibrationPageParams(c echo.Context, params map[string]interface{}) {
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+}
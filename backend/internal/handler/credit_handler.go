@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// CreditHandler handles customer credit exposure, profiles and credit holds
+type CreditHandler struct {
+	creditService service.CreditService
+}
+
+// NewCreditHandler creates a new credit handler
+func NewCreditHandler(creditService service.CreditService) *CreditHandler {
+	return &CreditHandler{
+		creditService: creditService,
+	}
+}
+
+// Customers
+
+// GetExposure returns the live exposure of a customer against its credit limit
+func (h *CreditHandler) GetExposure(c echo.Context) error {
+	customerID, err := h.customerID(c)
+	if err != nil {
+		return h.creditError(c, err)
+	}
+	exposure, err := h.creditService.GetExposure(c.Request().Context(), customerID)
+	if err != nil {
+		return h.creditError(c, err)
+	}
+	return c.JSON(http.StatusOK, exposure)
+}
+
+// GetProfile returns the credit profile of a customer
+func (h *CreditHandler) GetProfile(c echo.Context) error {
+	customerID, err := h.customerID(c)
+	if err != nil {
+		return h.creditError(c, err)
+	}
+	profile, err := h.creditService.GetProfile(c.Request().Context(), customerID)
+	if err != nil {
+		return h.creditError(c, err)
+	}
+	return c.JSON(http.StatusOK, profile)
+}
+
+// UpdateProfile sets the credit status manually or changes credit insurance
+func (h *CreditHandler) UpdateProfile(c echo.Context) error {
+	customerID, err := h.customerID(c)
+	if err != nil {
+		return h.creditError(c, err)
+	}
+	var req service.UpdateCreditProfileRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	profile, err := h.creditService.UpdateProfile(c.Request().Context(), customerID, getUserIDFromContext(c), req)
+	if err != nil {
+		return h.creditError(c, err)
+	}
+	return c.JSON(http.StatusOK, profile)
+}
+
+// AssessCustomer adjusts the credit status of a customer from its payment behavior
+func (h *CreditHandler) AssessCustomer(c echo.Context) error {
+	customerID, err := h.customerID(c)
+	if err != nil {
+		return h.creditError(c, err)
+	}
+	profile, err := h.creditService.AssessCustomer(c.Request().Context(), customerID)
+	if err != nil {
+		return h.creditError(c, err)
+	}
+	return c.JSON(http.StatusOK, profile)
+}
+
+// AssessCompany adjusts the credit status of all customers of the company
+func (h *CreditHandler) AssessCompany(c echo.Context) error {
+	result, err := h.creditService.AssessCompany(c.Request().Context(), c.Get("company_id").(uuid.UUID))
+	if err != nil {
+		return h.creditError(c, err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// customerID parses the customer in the path, hiding those of other companies
+func (h *CreditHandler) customerID(c echo.Context) (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, service.ErrCustomerNotFound
+	}
+	profile, err := h.creditService.GetProfile(c.Request().Context(), id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if profile.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return uuid.Nil, service.ErrCustomerNotFound
+	}
+	return id, nil
+}
+
+// Holds
+
+// ListHolds lists credit holds, filtered by customer_id, source_type and status
+func (h *CreditHandler) ListHolds(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id":  c.Get("company_id").(uuid.UUID),
+		"source_type": c.QueryParam("source_type"),
+		"status":      c.QueryParam("status"),
+	}
+	if customerID, err := uuid.Parse(c.QueryParam("customer_id")); err == nil {
+		params["customer_id"] = customerID
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	holds, total, err := h.creditService.ListHolds(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list credit holds"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  holds,
+		"total": total,
+	})
+}
+
+// GetHold returns a credit hold
+func (h *CreditHandler) GetHold(c echo.Context) error {
+	hold, err := h.getHold(c)
+	if err != nil {
+		return h.creditError(c, err)
+	}
+	return c.JSON(http.StatusOK, hold)
+}
+
+// RequestOverride asks for a held order or shipment to be released
+func (h *CreditHandler) RequestOverride(c echo.Context) error {
+	hold, err := h.getHold(c)
+	if err != nil {
+		return h.creditError(c, err)
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	hold, err = h.creditService.RequestOverride(c.Request().Context(), hold.ID, getUserIDFromContext(c), body.Reason)
+	if err != nil {
+		return h.creditError(c, err)
+	}
+	return c.JSON(http.StatusOK, hold)
+}
+
+// ApproveHold approves a requested override
+func (h *CreditHandler) ApproveHold(c echo.Context) error {
+	return h.decideHold(c, h.creditService.ApproveHold)
+}
+
+// RejectHold rejects the override of a hold
+func (h *CreditHandler) RejectHold(c echo.Context) error {
+	return h.decideHold(c, h.creditService.RejectHold)
+}
+
+func (h *CreditHandler) decideHold(c echo.Context, decide func(ctx context.Context, id, userID uuid.UUID, notes string) (*models.CreditHold, error)) error {
+	hold, err := h.getHold(c)
+	if err != nil {
+		return h.creditError(c, err)
+	}
+	var body struct {
+		Notes string `json:"notes"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	hold, err = decide(c.Request().Context(), hold.ID, getUserIDFromContext(c), body.Notes)
+	if err != nil {
+		return h.creditError(c, err)
+	}
+	return c.JSON(http.StatusOK, hold)
+}
+
+// getHold loads the hold in the path, hiding those of other companies
+func (h *CreditHandler) getHold(c echo.Context) (*models.CreditHold, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrCreditHoldNotFound
+	}
+	hold, err := h.creditService.GetHold(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if hold.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrCreditHoldNotFound
+	}
+	return hold, nil
+}
+
+func (h *CreditHandler) creditError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrCustomerNotFound), errors.Is(err, service.ErrCreditHoldNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidCreditStatus), errors.Is(err, service.ErrInvalidInsuredAmount),
+		errors.Is(err, service.ErrCreditOverrideReason):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrCreditHoldDecided), errors.Is(err, service.ErrCreditOverrideNotRequested):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrCreditSelfApproval):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrExchangeRateMissing):
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process credit request"})
+}
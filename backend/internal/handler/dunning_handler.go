@@ -0,0 +1,415 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// DunningHandler handles dunning policies, notices, promises to pay,
+// collector notes and the collection worklist
+type DunningHandler struct {
+	dunningService service.DunningService
+}
+
+// NewDunningHandler creates a new dunning handler
+func NewDunningHandler(dunningService service.DunningService) *DunningHandler {
+	return &DunningHandler{
+		dunningService: dunningService,
+	}
+}
+
+// Policies
+
+// ListPolicies lists the dunning policies of the company
+func (h *DunningHandler) ListPolicies(c echo.Context) error {
+	policies, err := h.dunningService.ListPolicies(c.Request().Context(), c.Get("company_id").(uuid.UUID))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list dunning policies"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  policies,
+		"total": len(policies),
+	})
+}
+
+// CreatePolicy creates a dunning policy for a customer group
+func (h *DunningHandler) CreatePolicy(c echo.Context) error {
+	var req service.DunningPolicyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	policy, err := h.dunningService.CreatePolicy(c.Request().Context(), c.Get("company_id").(uuid.UUID), getUserIDFromContext(c), req)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	return c.JSON(http.StatusCreated, policy)
+}
+
+// GetPolicy returns a dunning policy with its stages
+func (h *DunningHandler) GetPolicy(c echo.Context) error {
+	policy, err := h.getPolicy(c)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	return c.JSON(http.StatusOK, policy)
+}
+
+// UpdatePolicy changes a dunning policy and replaces its stages
+func (h *DunningHandler) UpdatePolicy(c echo.Context) error {
+	policy, err := h.getPolicy(c)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	var req service.DunningPolicyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	policy, err = h.dunningService.UpdatePolicy(c.Request().Context(), policy.ID, getUserIDFromContext(c), req)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	return c.JSON(http.StatusOK, policy)
+}
+
+// getPolicy loads the policy in the path, hiding those of other companies
+func (h *DunningHandler) getPolicy(c echo.Context) (*models.DunningPolicy, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrDunningPolicyNotFound
+	}
+	policy, err := h.dunningService.GetPolicy(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if policy.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrDunningPolicyNotFound
+	}
+	return policy, nil
+}
+
+// Templates
+
+// ListTemplates lists the notice templates of the company
+func (h *DunningHandler) ListTemplates(c echo.Context) error {
+	templates, err := h.dunningService.ListTemplates(c.Request().Context(), c.Get("company_id").(uuid.UUID))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list dunning templates"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  templates,
+		"total": len(templates),
+	})
+}
+
+// CreateTemplate creates a notice template
+func (h *DunningHandler) CreateTemplate(c echo.Context) error {
+	var req service.DunningTemplateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	template, err := h.dunningService.CreateTemplate(c.Request().Context(), c.Get("company_id").(uuid.UUID), getUserIDFromContext(c), req)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	return c.JSON(http.StatusCreated, template)
+}
+
+// UpdateTemplate changes a notice template
+func (h *DunningHandler) UpdateTemplate(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return h.dunningError(c, service.ErrDunningTemplateNotFound)
+	}
+	template, err := h.dunningService.GetTemplate(c.Request().Context(), id)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	if template.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return h.dunningError(c, service.ErrDunningTemplateNotFound)
+	}
+	var req service.DunningTemplateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	template, err = h.dunningService.UpdateTemplate(c.Request().Context(), id, getUserIDFromContext(c), req)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	return c.JSON(http.StatusOK, template)
+}
+
+// Runs and notices
+
+// Run runs dunning for the company; dry_run renders notices without sending them
+func (h *DunningHandler) Run(c echo.Context) error {
+	var req service.RunDunningRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.CompanyID = c.Get("company_id").(uuid.UUID)
+	req.UserID = getUserIDFromContext(c)
+
+	result, err := h.dunningService.Run(c.Request().Context(), req)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// GetStatement returns the overdue statement of a customer with interest
+// accrued at as_of, by default today
+func (h *DunningHandler) GetStatement(c echo.Context) error {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return h.dunningError(c, service.ErrCustomerNotFound)
+	}
+	asOf := time.Now()
+	if value := c.QueryParam("as_of"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid as_of date, expected YYYY-MM-DD"})
+		}
+		asOf = parsed
+	}
+
+	statement, err := h.dunningService.GetStatement(c.Request().Context(), c.Get("company_id").(uuid.UUID), customerID, asOf)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	return c.JSON(http.StatusOK, statement)
+}
+
+// ListNotices lists dunning notices, filtered by customer_id, level, status, from and to
+func (h *DunningHandler) ListNotices(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+		"level":      c.QueryParam("level"),
+		"status":     c.QueryParam("status"),
+	}
+	if customerID, err := uuid.Parse(c.QueryParam("customer_id")); err == nil {
+		params["customer_id"] = customerID
+	}
+	if from, err := time.Parse("2006-01-02", c.QueryParam("from")); err == nil {
+		params["from"] = from
+	}
+	if to, err := time.Parse("2006-01-02", c.QueryParam("to")); err == nil {
+		params["to"] = to.AddDate(0, 0, 1)
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	notices, total, err := h.dunningService.ListNotices(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list dunning notices"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  notices,
+		"total": total,
+	})
+}
+
+// GetNotice returns a dunning notice with its lines
+func (h *DunningHandler) GetNotice(c echo.Context) error {
+	notice, err := h.getNotice(c)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	return c.JSON(http.StatusOK, notice)
+}
+
+// MarkNoticeSent records that a printed letter was posted
+func (h *DunningHandler) MarkNoticeSent(c echo.Context) error {
+	notice, err := h.getNotice(c)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	notice, err = h.dunningService.MarkNoticeSent(c.Request().Context(), notice.ID)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	return c.JSON(http.StatusOK, notice)
+}
+
+// getNotice loads the notice in the path, hiding those of other companies
+func (h *DunningHandler) getNotice(c echo.Context) (*models.DunningNotice, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrDunningNoticeNotFound
+	}
+	notice, err := h.dunningService.GetNotice(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if notice.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrDunningNoticeNotFound
+	}
+	return notice, nil
+}
+
+// Promises to pay
+
+// ListPromises lists promises to pay, filtered by customer_id and status
+func (h *DunningHandler) ListPromises(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+		"status":     c.QueryParam("status"),
+		"page_size":  20,
+	}
+	if customerID, err := uuid.Parse(c.QueryParam("customer_id")); err == nil {
+		params["customer_id"] = customerID
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	promises, total, err := h.dunningService.ListPromises(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list promises to pay"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  promises,
+		"total": total,
+	})
+}
+
+// CreatePromise records a promise to pay
+func (h *DunningHandler) CreatePromise(c echo.Context) error {
+	var req service.PromiseToPayRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	promise, err := h.dunningService.CreatePromise(c.Request().Context(), c.Get("company_id").(uuid.UUID), getUserIDFromContext(c), req)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	return c.JSON(http.StatusCreated, promise)
+}
+
+// CancelPromise withdraws an open promise to pay
+func (h *DunningHandler) CancelPromise(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return h.dunningError(c, service.ErrPromiseNotFound)
+	}
+	promise, err := h.dunningService.GetPromise(c.Request().Context(), id)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	if promise.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return h.dunningError(c, service.ErrPromiseNotFound)
+	}
+
+	promise, err = h.dunningService.CancelPromise(c.Request().Context(), id)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	return c.JSON(http.StatusOK, promise)
+}
+
+// Collector notes
+
+// ListNotes lists collector notes, filtered by customer_id and invoice_id
+func (h *DunningHandler) ListNotes(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+		"page_size":  20,
+	}
+	if customerID, err := uuid.Parse(c.QueryParam("customer_id")); err == nil {
+		params["customer_id"] = customerID
+	}
+	if invoiceID, err := uuid.Parse(c.QueryParam("invoice_id")); err == nil {
+		params["invoice_id"] = invoiceID
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	notes, total, err := h.dunningService.ListNotes(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list collector notes"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  notes,
+		"total": total,
+	})
+}
+
+// CreateNote logs a collection contact
+func (h *DunningHandler) CreateNote(c echo.Context) error {
+	var req service.CollectorNoteRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	note, err := h.dunningService.CreateNote(c.Request().Context(), c.Get("company_id").(uuid.UUID), getUserIDFromContext(c), req)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	return c.JSON(http.StatusCreated, note)
+}
+
+// Worklist
+
+// GetWorklist returns the accounts to chase on as_of, by default today,
+// ranked by priority
+func (h *DunningHandler) GetWorklist(c echo.Context) error {
+	asOf := time.Now()
+	if value := c.QueryParam("as_of"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid as_of date, expected YYYY-MM-DD"})
+		}
+		asOf = parsed
+	}
+	worklist, err := h.dunningService.GetWorklist(c.Request().Context(), c.Get("company_id").(uuid.UUID), asOf)
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	return c.JSON(http.StatusOK, worklist)
+}
+
+// PushWorklist sends today's worklist to the collectors' mobile devices
+func (h *DunningHandler) PushWorklist(c echo.Context) error {
+	result, err := h.dunningService.PushWorklist(c.Request().Context(), c.Get("company_id").(uuid.UUID), time.Now())
+	if err != nil {
+		return h.dunningError(c, err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+func (h *DunningHandler) dunningError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrDunningPolicyNotFound), errors.Is(err, service.ErrDunningTemplateNotFound),
+		errors.Is(err, service.ErrDunningNoticeNotFound), errors.Is(err, service.ErrPromiseNotFound),
+		errors.Is(err, service.ErrCustomerNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidDunningPolicy), errors.Is(err, service.ErrInvalidDunningTemplate),
+		errors.Is(err, service.ErrInvalidPromise), errors.Is(err, service.ErrInvalidCollectorNote):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrPromiseClosed):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process collections request"})
+}
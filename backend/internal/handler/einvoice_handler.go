@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// EInvoiceHandler handles e-invoicing addresses and the generation,
+// download, verification and transmission of e-invoices
+type EInvoiceHandler struct {
+	einvoiceService service.EInvoiceService
+}
+
+// NewEInvoiceHandler creates a new e-invoice handler
+func NewEInvoiceHandler(einvoiceService service.EInvoiceService) *EInvoiceHandler {
+	return &EInvoiceHandler{
+		einvoiceService: einvoiceService,
+	}
+}
+
+// Parties
+
+// ListParties lists the e-invoicing addresses of the company and its customers
+func (h *EInvoiceHandler) ListParties(c echo.Context) error {
+	parties, err := h.einvoiceService.ListParties(c.Request().Context(), c.Get("company_id").(uuid.UUID))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list e-invoice parties"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  parties,
+		"total": len(parties),
+	})
+}
+
+// SaveParty sets the e-invoicing address of the company or a customer
+func (h *EInvoiceHandler) SaveParty(c echo.Context) error {
+	var req service.EInvoicePartyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	party, err := h.einvoiceService.SaveParty(c.Request().Context(), c.Get("company_id").(uuid.UUID), getUserIDFromContext(c), req)
+	if err != nil {
+		return h.einvoiceError(c, err)
+	}
+	return c.JSON(http.StatusOK, party)
+}
+
+// Invoices
+
+// Generate creates a new e-invoice version of an invoice
+func (h *EInvoiceHandler) Generate(c echo.Context) error {
+	req, err := h.generateRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	record, err := h.einvoiceService.Generate(c.Request().Context(), req)
+	if err != nil {
+		return h.einvoiceError(c, err)
+	}
+	return c.JSON(http.StatusCreated, record)
+}
+
+// Validate checks an invoice against the business rules of a format
+// without storing anything
+func (h *EInvoiceHandler) Validate(c echo.Context) error {
+	req, err := h.generateRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	result, err := h.einvoiceService.Validate(c.Request().Context(), req)
+	if err != nil {
+		return h.einvoiceError(c, err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// E-invoices
+
+// List lists the e-invoices of the company
+func (h *EInvoiceHandler) List(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+		"format":     c.QueryParam("format"),
+		"status":     c.QueryParam("status"),
+	}
+	if invoiceID, err := uuid.Parse(c.QueryParam("invoice_id")); err == nil {
+		params["invoice_id"] = invoiceID
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	records, total, err := h.einvoiceService.ListEInvoices(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list e-invoices"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  records,
+		"total": total,
+	})
+}
+
+// Get returns an e-invoice with its rule violations
+func (h *EInvoiceHandler) Get(c echo.Context) error {
+	record, err := h.getEInvoice(c)
+	if err != nil {
+		return h.einvoiceError(c, err)
+	}
+	return c.JSON(http.StatusOK, record)
+}
+
+// Download returns the e-invoice XML, or its detached signature with ?part=signature
+func (h *EInvoiceHandler) Download(c echo.Context) error {
+	record, err := h.getEInvoice(c)
+	if err != nil {
+		return h.einvoiceError(c, err)
+	}
+	signature := c.QueryParam("part") == "signature"
+
+	_, content, err := h.einvoiceService.OpenEInvoice(c.Request().Context(), record.ID, signature)
+	if err != nil {
+		return h.einvoiceError(c, err)
+	}
+	name := fmt.Sprintf("%s-v%d.xml", record.DocumentNo, record.Version)
+	if signature {
+		name = fmt.Sprintf("%s-v%d.sig.xml", record.DocumentNo, record.Version)
+	}
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", name))
+	return c.Blob(http.StatusOK, "application/xml", content)
+}
+
+// Verify checks the stored e-invoice against its signature
+func (h *EInvoiceHandler) Verify(c echo.Context) error {
+	record, err := h.getEInvoice(c)
+	if err != nil {
+		return h.einvoiceError(c, err)
+	}
+
+	result, err := h.einvoiceService.Verify(c.Request().Context(), record.ID)
+	if err != nil {
+		return h.einvoiceError(c, err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// Transmit sends a signed e-invoice through the buyer's transport
+func (h *EInvoiceHandler) Transmit(c echo.Context) error {
+	record, err := h.getEInvoice(c)
+	if err != nil {
+		return h.einvoiceError(c, err)
+	}
+
+	record, err = h.einvoiceService.Transmit(c.Request().Context(), record.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrEInvoiceTransmissionFailed) {
+			return c.JSON(http.StatusBadGateway, map[string]interface{}{"error": err.Error(), "einvoice": record})
+		}
+		return h.einvoiceError(c, err)
+	}
+	return c.JSON(http.StatusOK, record)
+}
+
+func (h *EInvoiceHandler) generateRequest(c echo.Context) (service.GenerateEInvoiceRequest, error) {
+	var req service.GenerateEInvoiceRequest
+	invoiceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return req, errors.New("Invalid invoice ID")
+	}
+	if c.Request().ContentLength > 0 {
+		if err := c.Bind(&req); err != nil {
+			return req, errors.New("Invalid request body")
+		}
+	}
+	if format := c.QueryParam("format"); format != "" {
+		req.Format = format
+	}
+	req.CompanyID = c.Get("company_id").(uuid.UUID)
+	req.InvoiceID = invoiceID
+	req.UserID = getUserIDFromContext(c)
+	return req, nil
+}
+
+// getEInvoice loads the e-invoice in the path, hiding those of other companies
+func (h *EInvoiceHandler) getEInvoice(c echo.Context) (*models.EInvoice, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrEInvoiceNotFound
+	}
+	record, err := h.einvoiceService.GetEInvoice(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if record.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrEInvoiceNotFound
+	}
+	return record, nil
+}
+
+func (h *EInvoiceHandler) einvoiceError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrEInvoiceNotFound), errors.Is(err, service.ErrInvoiceNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrUnsupportedEInvoiceFormat), errors.Is(err, service.ErrUnknownEInvoiceTransport):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvoiceNotIssuable), errors.Is(err, service.ErrEInvoiceNotSigned),
+		errors.Is(err, service.ErrEInvoiceAlreadySent):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process e-invoice request"})
+}
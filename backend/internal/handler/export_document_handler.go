@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// ExportDocumentHandler handles generation and download of shipment export documents
+type ExportDocumentHandler struct {
+	exportDocumentService service.ExportDocumentService
+}
+
+// NewExportDocumentHandler creates a new export document handler
+func NewExportDocumentHandler(exportDocumentService service.ExportDocumentService) *ExportDocumentHandler {
+	return &ExportDocumentHandler{
+		exportDocumentService: exportDocumentService,
+	}
+}
+
+// GenerateDocumentPack generates commercial invoice, packing list and certificate of origin for a shipment
+func (h *ExportDocumentHandler) GenerateDocumentPack(c echo.Context) error {
+	shipmentID, err := uuid.Parse(c.Param("shipment_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid shipment ID"})
+	}
+
+	var req service.GenerateDocumentPackRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.ShipmentID = shipmentID
+	req.UserID = getUserIDFromContext(c)
+
+	docs, err := h.exportDocumentService.GenerateDocumentPack(c.Request().Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrShipmentNotFound):
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Shipment not found"})
+		case errors.Is(err, service.ErrShipmentHasNoItems), errors.Is(err, service.ErrUnsupportedDocumentFormat),
+			errors.Is(err, service.ErrMixedDocumentCurrency):
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate document pack: " + err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, docs)
+}
+
+// DownloadDocument streams a stored trade document file
+func (h *ExportDocumentHandler) DownloadDocument(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid document ID"})
+	}
+
+	doc, content, err := h.exportDocumentService.OpenDocument(c.Request().Context(), id)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to read document"})
+	}
+
+	contentType := "application/pdf"
+	if doc.FileType == "xlsx" {
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", doc.DocumentNo, doc.FileType))
+	return c.Blob(http.StatusOK, contentType, content)
+}
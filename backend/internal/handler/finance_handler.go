@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -103,6 +104,9 @@ func (h *FinanceHandler) UpdateInvoice(c echo.Context) error {
 	req.ID = id
 	
 	if err := h.financeService.UpdateInvoice(&req); err != nil {
+		if errors.Is(err, service.ErrInvoicePosted) || errors.Is(err, service.ErrPeriodClosed) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 	
@@ -224,6 +228,9 @@ func (h *FinanceHandler) ProcessPayment(c echo.Context) error {
 	req.CreatedBy = user.ID
 	
 	if err := h.financeService.ProcessPayment(&req); err != nil {
+		if errors.Is(err, service.ErrInvoiceNotPayable) || errors.Is(err, service.ErrPeriodClosed) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 	
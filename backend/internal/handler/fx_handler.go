@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// FXHandler handles foreign currency revaluation and exchange reports
+type FXHandler struct {
+	fxService service.FXService
+}
+
+// NewFXHandler creates a new FX handler
+func NewFXHandler(fxService service.FXService) *FXHandler {
+	return &FXHandler{
+		fxService: fxService,
+	}
+}
+
+// Revaluations
+
+// RunRevaluation revalues open foreign receivables and payables on a date,
+// by default the last day of the previous month
+func (h *FXHandler) RunRevaluation(c echo.Context) error {
+	var body struct {
+		Date string `json:"date"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req := service.RunFXRevaluationRequest{
+		CompanyID: c.Get("company_id").(uuid.UUID),
+		UserID:    getUserIDFromContext(c),
+	}
+	if body.Date != "" {
+		date, err := time.Parse("2006-01-02", body.Date)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid date, expected YYYY-MM-DD"})
+		}
+		req.Date = date
+	}
+
+	revaluation, err := h.fxService.RunRevaluation(c.Request().Context(), req)
+	if err != nil {
+		return h.fxError(c, err)
+	}
+	return c.JSON(http.StatusCreated, revaluation)
+}
+
+// ListRevaluations lists the revaluations of the company
+func (h *FXHandler) ListRevaluations(c echo.Context) error {
+	params := map[string]interface{}{}
+	if from, err := time.Parse("2006-01-02", c.QueryParam("from")); err == nil {
+		params["from"] = from
+	}
+	if to, err := time.Parse("2006-01-02", c.QueryParam("to")); err == nil {
+		params["to"] = to.AddDate(0, 0, 1)
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	revaluations, total, err := h.fxService.ListRevaluations(c.Request().Context(), c.Get("company_id").(uuid.UUID), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list revaluations"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  revaluations,
+		"total": total,
+	})
+}
+
+// GetRevaluation returns a revaluation with the valuation of each open item
+func (h *FXHandler) GetRevaluation(c echo.Context) error {
+	revaluation, err := h.getRevaluation(c)
+	if err != nil {
+		return h.fxError(c, err)
+	}
+	return c.JSON(http.StatusOK, revaluation)
+}
+
+// getRevaluation loads the revaluation in the path, hiding those of other companies
+func (h *FXHandler) getRevaluation(c echo.Context) (*models.FXRevaluation, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrFXRevaluationNotFound
+	}
+	revaluation, err := h.fxService.GetRevaluation(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if revaluation.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrFXRevaluationNotFound
+	}
+	return revaluation, nil
+}
+
+// Reports
+
+// GetExposureReport values open foreign items in their currency and in the
+// base currency at the rates of as_of, by default today
+func (h *FXHandler) GetExposureReport(c echo.Context) error {
+	asOf := time.Now()
+	if value := c.QueryParam("as_of"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid as_of date, expected YYYY-MM-DD"})
+		}
+		asOf = parsed
+	}
+
+	report, err := h.fxService.GetExposureReport(c.Request().Context(), c.Get("company_id").(uuid.UUID), asOf)
+	if err != nil {
+		return h.fxError(c, err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// GetRealizedReport lists exchange differences realized by payments from
+// from to to, by default in the current month
+func (h *FXHandler) GetRealizedReport(c echo.Context) error {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if value := c.QueryParam("from"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid from date, expected YYYY-MM-DD"})
+		}
+		from = parsed
+	}
+	if value := c.QueryParam("to"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid to date, expected YYYY-MM-DD"})
+		}
+		to = parsed
+	}
+	if from.After(to) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "From date is after to date"})
+	}
+
+	report, err := h.fxService.GetRealizedReport(c.Request().Context(), c.Get("company_id").(uuid.UUID), from, to)
+	if err != nil {
+		return h.fxError(c, err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func (h *FXHandler) fxError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrFXRevaluationNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrFXRevaluationExists), errors.Is(err, service.ErrPeriodClosed):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrExchangeRateMissing), errors.Is(err, service.ErrPostingAccountMissing):
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process FX request"})
+}
@@ -21,6 +21,29 @@ type Handlers struct {
 	Order              *OrderHandler
 	Inventory          *InventoryHandler
 	Trade              *TradeHandler
+	ExportDocument     *ExportDocumentHandler
+	Screening          *ScreeningHandler
+	Tracking           *TrackingHandler
+	LoadPlan           *LoadPlanHandler
+	Ledger             *LedgerHandler
+	BankReconciliation *BankReconciliationHandler
+	FX                 *FXHandler
+	Credit             *CreditHandler
+	Dunning            *DunningHandler
+	EInvoice           *EInvoiceHandler
+	CashForecast       *CashForecastHandler
+	JobCost            *JobCostHandler
+	CostCalibration    *CostCalibrationHandler
+	Sampling           *SamplingHandler
+	SPC                *SPCHandler
+	NCR                *NCRHandler
+	Certificate        *CertificateHandler
+	PPAP               *PPAPHandler
+	Scorecard          *ScorecardHandler
+	InvoiceMatch       *InvoiceMatchHandler
+	Subcontract        *SubcontractHandler
+	ProductMaster      *ProductMasterHandler
+	Supplier           *SupplierHandler
 	Advanced           *AdvancedHandler
 	Integration        *IntegrationHandler
 	Report             *ReportHandler
@@ -45,7 +68,30 @@ func NewHandlers(services *service.Services) *Handlers {
 		Quote:              NewQuoteHandler(services.Quote),
 		Order:              NewOrderHandler(services.Order),
 		Inventory:          NewInventoryHandler(services.Inventory),
-		Trade:              NewTradeHandler(services.Trade),
+		Trade:              NewTradeHandler(services.Trade, services.Screening),
+		ExportDocument:     NewExportDocumentHandler(services.ExportDocument),
+		Screening:          NewScreeningHandler(services.Screening),
+		Tracking:           NewTrackingHandler(services.Tracking),
+		LoadPlan:           NewLoadPlanHandler(services.LoadPlan),
+		Ledger:             NewLedgerHandler(services.Ledger),
+		BankReconciliation: NewBankReconciliationHandler(services.BankReconciliation),
+		FX:                 NewFXHandler(services.FX),
+		Credit:             NewCreditHandler(services.Credit),
+		Dunning:            NewDunningHandler(services.Dunning),
+		EInvoice:           NewEInvoiceHandler(services.EInvoice),
+		CashForecast:       NewCashForecastHandler(services.CashForecast),
+		JobCost:            NewJobCostHandler(services.JobCost, services.Production),
+		CostCalibration:    NewCostCalibrationHandler(services.CostCalibration),
+		Sampling:           NewSamplingHandler(services.Sampling),
+		SPC:                NewSPCHandler(services.SPC),
+		NCR:                NewNCRHandler(services.NCR),
+		Certificate:        NewCertificateHandler(services.Certificate),
+		PPAP:               NewPPAPHandler(services.PPAP),
+		Scorecard:          NewScorecardHandler(services.SupplierScorecard),
+		InvoiceMatch:       NewInvoiceMatchHandler(services.InvoiceMatch, services.Finance, services.Supplier),
+		Subcontract:        NewSubcontractHandler(services.Subcontract),
+		ProductMaster:      NewProductMasterHandler(services.ProductMaster),
+		Supplier:           NewSupplierHandler(services.Supplier),
 		Advanced:           NewAdvancedHandler(services.Advanced),
 		Integration:        NewIntegrationHandler(services.Integration),
 		Report:             NewReportHandler(services.Report),
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// InvoiceMatchHandler handles the three-way match of supplier invoices and
+// the AP review of held ones
+type InvoiceMatchHandler struct {
+	matchService    service.InvoiceMatchService
+	financeService  service.FinanceService
+	supplierService service.SupplierService
+}
+
+// NewInvoiceMatchHandler creates a new invoice match handler
+func NewInvoiceMatchHandler(matchService service.InvoiceMatchService, financeService service.FinanceService, supplierService service.SupplierService) *InvoiceMatchHandler {
+	return &InvoiceMatchHandler{
+		matchService:    matchService,
+		financeService:  financeService,
+		supplierService: supplierService,
+	}
+}
+
+// GetConfig returns the match tolerances of the company
+func (h *InvoiceMatchHandler) GetConfig(c echo.Context) error {
+	config, err := h.matchService.GetConfig(c.Request().Context(), c.Get("company_id").(uuid.UUID))
+	if err != nil {
+		return h.invoiceMatchError(c, err)
+	}
+	return c.JSON(http.StatusOK, config)
+}
+
+// UpdateConfig sets the match tolerances of the company
+func (h *InvoiceMatchHandler) UpdateConfig(c echo.Context) error {
+	var req models.InvoiceMatchConfig
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.CompanyID = c.Get("company_id").(uuid.UUID)
+	userID := getUserIDFromContext(c)
+	req.UpdatedBy = &userID
+
+	config, err := h.matchService.UpdateConfig(c.Request().Context(), &req)
+	if err != nil {
+		return h.invoiceMatchError(c, err)
+	}
+	return c.JSON(http.StatusOK, config)
+}
+
+// RecordSupplierInvoice records a supplier invoice billing a purchase order
+// and returns its match
+func (h *InvoiceMatchHandler) RecordSupplierInvoice(c echo.Context) error {
+	var req service.SupplierInvoiceRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.CompanyID = c.Get("company_id").(uuid.UUID)
+
+	match, err := h.matchService.RecordSupplierInvoice(c.Request().Context(), &req, getUserIDFromContext(c))
+	if err != nil {
+		return h.invoiceMatchError(c, err)
+	}
+	return c.JSON(http.StatusCreated, match)
+}
+
+// MatchInvoice matches an invoice billing a purchase order
+func (h *InvoiceMatchHandler) MatchInvoice(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return h.invoiceMatchError(c, service.ErrInvoiceNotFound)
+	}
+	invoice, err := h.financeService.GetInvoice(id)
+	if err != nil || invoice.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return h.invoiceMatchError(c, service.ErrInvoiceNotFound)
+	}
+
+	match, err := h.matchService.MatchInvoice(c.Request().Context(), invoice.ID)
+	if err != nil {
+		return h.invoiceMatchError(c, err)
+	}
+	return c.JSON(http.StatusOK, match)
+}
+
+// RematchOrder matches the held invoices of a purchase order again
+func (h *InvoiceMatchHandler) RematchOrder(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return h.invoiceMatchError(c, service.ErrPurchaseOrderNotFound)
+	}
+	order, err := h.supplierService.GetPurchaseOrder(id)
+	if err != nil || order.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return h.invoiceMatchError(c, service.ErrPurchaseOrderNotFound)
+	}
+
+	matches, err := h.matchService.RematchOrder(c.Request().Context(), order.ID)
+	if err != nil {
+		return h.invoiceMatchError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  matches,
+		"total": len(matches),
+	})
+}
+
+// ListMatches lists invoice matches; filter on ?status, ?supplier_id and
+// ?purchase_order_id
+func (h *InvoiceMatchHandler) ListMatches(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+		"status":     c.QueryParam("status"),
+	}
+	if id, err := uuid.Parse(c.QueryParam("supplier_id")); err == nil {
+		params["supplier_id"] = id
+	}
+	if id, err := uuid.Parse(c.QueryParam("purchase_order_id")); err == nil {
+		params["purchase_order_id"] = id
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	matches, total, err := h.matchService.ListMatches(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list invoice matches"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  matches,
+		"total": total,
+	})
+}
+
+// GetMatch returns an invoice match with its lines and reasons
+func (h *InvoiceMatchHandler) GetMatch(c echo.Context) error {
+	match, err := h.getMatch(c)
+	if err != nil {
+		return h.invoiceMatchError(c, err)
+	}
+	return c.JSON(http.StatusOK, match)
+}
+
+// ReleaseMatch releases a held invoice to accounts payable
+func (h *InvoiceMatchHandler) ReleaseMatch(c echo.Context) error {
+	return h.review(c, h.matchService.Release)
+}
+
+// RejectMatch returns a held invoice to the supplier
+func (h *InvoiceMatchHandler) RejectMatch(c echo.Context) error {
+	return h.review(c, h.matchService.Reject)
+}
+
+// invoiceMatchReview is Release or Reject
+type invoiceMatchReview func(ctx context.Context, id uuid.UUID, userID uuid.UUID, note string) (*models.InvoiceMatch, error)
+
+func (h *InvoiceMatchHandler) review(c echo.Context, review invoiceMatchReview) error {
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	match, err := h.getMatch(c)
+	if err != nil {
+		return h.invoiceMatchError(c, err)
+	}
+
+	match, err = review(c.Request().Context(), match.ID, getUserIDFromContext(c), req.Note)
+	if err != nil {
+		return h.invoiceMatchError(c, err)
+	}
+	return c.JSON(http.StatusOK, match)
+}
+
+// getMatch loads the match in the id path parameter, hiding those of other
+// companies
+func (h *InvoiceMatchHandler) getMatch(c echo.Context) (*models.InvoiceMatch, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrInvoiceMatchNotFound
+	}
+	match, err := h.matchService.GetMatch(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if match.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrInvoiceMatchNotFound
+	}
+	return match, nil
+}
+
+func (h *InvoiceMatchHandler) invoiceMatchError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvoiceMatchNotFound), errors.Is(err, service.ErrInvoiceNotFound),
+		errors.Is(err, service.ErrPurchaseOrderNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvoiceMatchNotHeld), errors.Is(err, service.ErrDuplicateSupplierInvoice),
+		errors.Is(err, service.ErrPeriodClosed):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidSupplierInvoice), errors.Is(err, service.ErrInvoiceNotMatchable),
+		errors.Is(err, service.ErrReviewNoteRequired), errors.Is(err, service.ErrInvalidMatchTolerance):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrExchangeRateMissing), errors.Is(err, service.ErrPostingAccountMissing):
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process invoice match request"})
+}
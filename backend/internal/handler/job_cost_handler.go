@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// JobCostHandler handles the actual cost of production orders and its
+// variance against their estimates
+type JobCostHandler struct {
+	jobCostService    service.JobCostService
+	productionService service.ProductionService
+}
+
+// NewJobCostHandler creates a new job cost handler
+func NewJobCostHandler(jobCostService service.JobCostService, productionService service.ProductionService) *JobCostHandler {
+	return &JobCostHandler{
+		jobCostService:    jobCostService,
+		productionService: productionService,
+	}
+}
+
+// Get returns the job cost of a production order
+func (h *JobCostHandler) Get(c echo.Context) error {
+	id, err := h.productionOrderID(c)
+	if err != nil {
+		return h.jobCostError(c, err)
+	}
+
+	record, err := h.jobCostService.GetJobCost(c.Request().Context(), id)
+	if err != nil {
+		return h.jobCostError(c, err)
+	}
+	return c.JSON(http.StatusOK, record)
+}
+
+// Recalculate costs a production order again from its current issues and tasks
+func (h *JobCostHandler) Recalculate(c echo.Context) error {
+	id, err := h.productionOrderID(c)
+	if err != nil {
+		return h.jobCostError(c, err)
+	}
+
+	record, err := h.jobCostService.Recalculate(c.Request().Context(), id)
+	if err != nil {
+		return h.jobCostError(c, err)
+	}
+	return c.JSON(http.StatusOK, record)
+}
+
+// List lists job costs; ?final=true for completed orders, from and to on
+// the completion date
+func (h *JobCostHandler) List(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+	}
+	if final, err := strconv.ParseBool(c.QueryParam("final")); err == nil {
+		params["final"] = final
+	}
+	if inventoryID, err := uuid.Parse(c.QueryParam("inventory_id")); err == nil {
+		params["inventory_id"] = inventoryID
+	}
+	if from, err := time.Parse("2006-01-02", c.QueryParam("from")); err == nil {
+		params["from"] = from
+	}
+	if to, err := time.Parse("2006-01-02", c.QueryParam("to")); err == nil {
+		params["to"] = to.AddDate(0, 0, 1)
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	records, total, err := h.jobCostService.ListJobCosts(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list job costs"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  records,
+		"total": total,
+	})
+}
+
+// Variances totals the variance per cost driver of the orders completed
+// between ?from and ?to
+func (h *JobCostHandler) Variances(c echo.Context) error {
+	var from, to *time.Time
+	if v := c.QueryParam("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid from date"})
+		}
+		from = &t
+	}
+	if v := c.QueryParam("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid to date"})
+		}
+		t = t.AddDate(0, 0, 1)
+		to = &t
+	}
+
+	summary, err := h.jobCostService.SummarizeVariances(c.Request().Context(), c.Get("company_id").(uuid.UUID), from, to)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to summarize job cost variances"})
+	}
+	return c.JSON(http.StatusOK, summary)
+}
+
+// productionOrderID reads the production order in the path, hiding those of
+// other companies
+func (h *JobCostHandler) productionOrderID(c echo.Context) (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, service.ErrProductionOrderNotFound
+	}
+	order, err := h.productionService.GetProductionOrder(id)
+	if err != nil || order.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return uuid.Nil, service.ErrProductionOrderNotFound
+	}
+	return order.ID, nil
+}
+
+func (h *JobCostHandler) jobCostError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrProductionOrderNotFound), errors.Is(err, service.ErrJobCostNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process job cost request"})
+}
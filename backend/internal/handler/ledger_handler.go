@@ -0,0 +1,368 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// LedgerHandler handles the chart of accounts, journal entries and ledger reports
+type LedgerHandler struct {
+	ledgerService service.LedgerService
+}
+
+// NewLedgerHandler creates a new ledger handler
+func NewLedgerHandler(ledgerService service.LedgerService) *LedgerHandler {
+	return &LedgerHandler{
+		ledgerService: ledgerService,
+	}
+}
+
+// Chart of accounts
+
+// SetupChartOfAccounts seeds the default chart when the company has none
+func (h *LedgerHandler) SetupChartOfAccounts(c echo.Context) error {
+	accounts, err := h.ledgerService.SetupChartOfAccounts(c.Request().Context(), c.Get("company_id").(uuid.UUID))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to set up chart of accounts"})
+	}
+	return c.JSON(http.StatusOK, accounts)
+}
+
+// ListAccounts lists the company's chart of accounts
+func (h *LedgerHandler) ListAccounts(c echo.Context) error {
+	params := map[string]interface{}{
+		"type": c.QueryParam("type"),
+	}
+	if active := c.QueryParam("is_active"); active != "" {
+		params["is_active"] = active == "true"
+	}
+
+	accounts, err := h.ledgerService.ListAccounts(c.Request().Context(), c.Get("company_id").(uuid.UUID), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list accounts"})
+	}
+	return c.JSON(http.StatusOK, accounts)
+}
+
+// CreateAccount adds an account to the chart
+func (h *LedgerHandler) CreateAccount(c echo.Context) error {
+	var account models.GLAccount
+	if err := c.Bind(&account); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	account.ID = uuid.Nil
+	account.CompanyID = c.Get("company_id").(uuid.UUID)
+
+	if err := h.ledgerService.CreateAccount(c.Request().Context(), &account); err != nil {
+		return h.ledgerError(c, err)
+	}
+	return c.JSON(http.StatusCreated, account)
+}
+
+// UpdateAccount updates an account of the chart
+func (h *LedgerHandler) UpdateAccount(c echo.Context) error {
+	existing, err := h.getAccount(c)
+	if err != nil {
+		return h.ledgerError(c, err)
+	}
+
+	var account models.GLAccount
+	if err := c.Bind(&account); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	account.ID = existing.ID
+	account.CompanyID = existing.CompanyID
+	account.CreatedAt = existing.CreatedAt
+
+	if err := h.ledgerService.UpdateAccount(c.Request().Context(), &account); err != nil {
+		return h.ledgerError(c, err)
+	}
+	return c.JSON(http.StatusOK, account)
+}
+
+// GetAccount returns an account
+func (h *LedgerHandler) GetAccount(c echo.Context) error {
+	account, err := h.getAccount(c)
+	if err != nil {
+		return h.ledgerError(c, err)
+	}
+	return c.JSON(http.StatusOK, account)
+}
+
+// getAccount loads the account in the path, hiding those of other companies
+func (h *LedgerHandler) getAccount(c echo.Context) (*models.GLAccount, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrGLAccountNotFound
+	}
+	account, err := h.ledgerService.GetAccount(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if account.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrGLAccountNotFound
+	}
+	return account, nil
+}
+
+// Posting rules
+
+// ListPostingRules lists the company's posting rules
+func (h *LedgerHandler) ListPostingRules(c echo.Context) error {
+	rules, err := h.ledgerService.ListPostingRules(c.Request().Context(), c.Get("company_id").(uuid.UUID))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list posting rules"})
+	}
+	return c.JSON(http.StatusOK, rules)
+}
+
+// CreatePostingRule maps a posting role to an account for an event
+func (h *LedgerHandler) CreatePostingRule(c echo.Context) error {
+	var rule models.PostingRule
+	if err := c.Bind(&rule); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	rule.ID = uuid.Nil
+	rule.CompanyID = c.Get("company_id").(uuid.UUID)
+	rule.CreatedBy = getUserIDFromContext(c)
+
+	if err := h.ledgerService.CreatePostingRule(c.Request().Context(), &rule); err != nil {
+		return h.ledgerError(c, err)
+	}
+	return c.JSON(http.StatusCreated, rule)
+}
+
+// UpdatePostingRule updates a posting rule
+func (h *LedgerHandler) UpdatePostingRule(c echo.Context) error {
+	existing, err := h.getPostingRule(c)
+	if err != nil {
+		return h.ledgerError(c, err)
+	}
+
+	var rule models.PostingRule
+	if err := c.Bind(&rule); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	rule.ID = existing.ID
+	rule.CompanyID = existing.CompanyID
+	rule.CreatedAt = existing.CreatedAt
+	rule.CreatedBy = existing.CreatedBy
+	rule.Account = nil
+
+	if err := h.ledgerService.UpdatePostingRule(c.Request().Context(), &rule); err != nil {
+		return h.ledgerError(c, err)
+	}
+	return c.JSON(http.StatusOK, rule)
+}
+
+// DeletePostingRule deletes a posting rule
+func (h *LedgerHandler) DeletePostingRule(c echo.Context) error {
+	rule, err := h.getPostingRule(c)
+	if err != nil {
+		return h.ledgerError(c, err)
+	}
+	if err := h.ledgerService.DeletePostingRule(c.Request().Context(), rule.ID); err != nil {
+		return h.ledgerError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getPostingRule loads the rule in the path, hiding those of other companies
+func (h *LedgerHandler) getPostingRule(c echo.Context) (*models.PostingRule, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrPostingRuleNotFound
+	}
+	rule, err := h.ledgerService.GetPostingRule(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if rule.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrPostingRuleNotFound
+	}
+	return rule, nil
+}
+
+// Journal entries
+
+// ListJournalEntries lists journal entries, filtered by event, source, status and date
+func (h *LedgerHandler) ListJournalEntries(c echo.Context) error {
+	params := map[string]interface{}{
+		"event":       c.QueryParam("event"),
+		"source_type": c.QueryParam("source_type"),
+		"status":      c.QueryParam("status"),
+	}
+	if sourceID, err := uuid.Parse(c.QueryParam("source_id")); err == nil {
+		params["source_id"] = sourceID
+	}
+	if from, err := time.Parse("2006-01-02", c.QueryParam("from")); err == nil {
+		params["from"] = from
+	}
+	if to, err := time.Parse("2006-01-02", c.QueryParam("to")); err == nil {
+		params["to"] = to.AddDate(0, 0, 1)
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	entries, total, err := h.ledgerService.ListJournalEntries(c.Request().Context(), c.Get("company_id").(uuid.UUID), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list journal entries"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  entries,
+		"total": total,
+	})
+}
+
+// CreateJournalEntry posts a manual journal entry
+func (h *LedgerHandler) CreateJournalEntry(c echo.Context) error {
+	var req service.CreateJournalEntryRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.CompanyID = c.Get("company_id").(uuid.UUID)
+	req.UserID = getUserIDFromContext(c)
+
+	entry, err := h.ledgerService.CreateJournalEntry(c.Request().Context(), req)
+	if err != nil {
+		return h.ledgerError(c, err)
+	}
+	return c.JSON(http.StatusCreated, entry)
+}
+
+// GetJournalEntry returns a journal entry with its lines
+func (h *LedgerHandler) GetJournalEntry(c echo.Context) error {
+	entry, err := h.getEntry(c)
+	if err != nil {
+		return h.ledgerError(c, err)
+	}
+	return c.JSON(http.StatusOK, entry)
+}
+
+// ReverseJournalEntry posts the reversal of a journal entry
+func (h *LedgerHandler) ReverseJournalEntry(c echo.Context) error {
+	entry, err := h.getEntry(c)
+	if err != nil {
+		return h.ledgerError(c, err)
+	}
+
+	var req service.ReverseJournalEntryRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.EntryID = entry.ID
+	req.UserID = getUserIDFromContext(c)
+
+	reversal, err := h.ledgerService.ReverseJournalEntry(c.Request().Context(), req)
+	if err != nil {
+		return h.ledgerError(c, err)
+	}
+	return c.JSON(http.StatusCreated, reversal)
+}
+
+// getEntry loads the entry in the path, hiding those of other companies
+func (h *LedgerHandler) getEntry(c echo.Context) (*models.JournalEntry, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrJournalEntryNotFound
+	}
+	entry, err := h.ledgerService.GetJournalEntry(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if entry.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrJournalEntryNotFound
+	}
+	return entry, nil
+}
+
+// Reports
+
+// GetTrialBalance returns the trial balance for an optional from date up to a to date
+func (h *LedgerHandler) GetTrialBalance(c echo.Context) error {
+	req, err := h.reportRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	report, err := h.ledgerService.GetTrialBalance(c.Request().Context(), req)
+	if err != nil {
+		return h.ledgerError(c, err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// GetGeneralLedgerDetail returns the posted lines per account with running balances
+func (h *LedgerHandler) GetGeneralLedgerDetail(c echo.Context) error {
+	req, err := h.reportRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if accountID := c.QueryParam("account_id"); accountID != "" {
+		id, err := uuid.Parse(accountID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid account ID"})
+		}
+		req.AccountID = &id
+	}
+
+	report, err := h.ledgerService.GetGeneralLedgerDetail(c.Request().Context(), req)
+	if err != nil {
+		return h.ledgerError(c, err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// reportRequest reads the from and to dates of a ledger report; to defaults to today
+func (h *LedgerHandler) reportRequest(c echo.Context) (service.LedgerReportRequest, error) {
+	req := service.LedgerReportRequest{CompanyID: c.Get("company_id").(uuid.UUID)}
+
+	now := time.Now()
+	req.To = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if to := c.QueryParam("to"); to != "" {
+		parsed, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return req, errors.New("Invalid to date, expected YYYY-MM-DD")
+		}
+		req.To = parsed
+	}
+	if from := c.QueryParam("from"); from != "" {
+		parsed, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return req, errors.New("Invalid from date, expected YYYY-MM-DD")
+		}
+		if parsed.After(req.To) {
+			return req, errors.New("From date is after to date")
+		}
+		req.From = &parsed
+	}
+	return req, nil
+}
+
+func (h *LedgerHandler) ledgerError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrGLAccountNotFound), errors.Is(err, service.ErrPostingRuleNotFound),
+		errors.Is(err, service.ErrJournalEntryNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidGLAccount), errors.Is(err, service.ErrInvalidPostingRule),
+		errors.Is(err, service.ErrUnbalancedEntry):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrDuplicateGLAccount), errors.Is(err, service.ErrEntryAlreadyReversed),
+		errors.Is(err, service.ErrPeriodClosed):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrPostingAccountMissing):
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process ledger request"})
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// LoadPlanHandler handles container load planning and freight rates
+type LoadPlanHandler struct {
+	loadPlanService service.LoadPlanService
+}
+
+// NewLoadPlanHandler creates a new load plan handler
+func NewLoadPlanHandler(loadPlanService service.LoadPlanService) *LoadPlanHandler {
+	return &LoadPlanHandler{
+		loadPlanService: loadPlanService,
+	}
+}
+
+// PlanShipment computes a draft load plan for a shipment
+func (h *LoadPlanHandler) PlanShipment(c echo.Context) error {
+	shipmentID, err := uuid.Parse(c.Param("shipment_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid shipment ID"})
+	}
+
+	var opts service.LoadPlanOptions
+	if err := c.Bind(&opts); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	plan, err := h.loadPlanService.PlanShipment(c.Request().Context(), service.PlanShipmentRequest{
+		ShipmentID: shipmentID,
+		Options:    opts,
+		UserID:     getUserIDFromContext(c),
+	})
+	if err != nil {
+		return h.planError(c, err)
+	}
+	return c.JSON(http.StatusCreated, plan)
+}
+
+// PreviewPlan plans product quantities without a shipment, e.g. to answer how
+// many pallets fit a 20ft versus a 40ft
+func (h *LoadPlanHandler) PreviewPlan(c echo.Context) error {
+	var req service.PlanProductsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if len(req.Lines) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "At least one line is required"})
+	}
+	req.CompanyID = c.Get("company_id").(uuid.UUID)
+
+	preview, err := h.loadPlanService.PlanProducts(c.Request().Context(), req)
+	if err != nil {
+		return h.planError(c, err)
+	}
+	return c.JSON(http.StatusOK, preview)
+}
+
+// ListLoadPlans lists the load plans of a shipment
+func (h *LoadPlanHandler) ListLoadPlans(c echo.Context) error {
+	shipmentID, err := uuid.Parse(c.Param("shipment_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid shipment ID"})
+	}
+
+	plans, err := h.loadPlanService.ListLoadPlans(c.Request().Context(), shipmentID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list load plans"})
+	}
+	return c.JSON(http.StatusOK, plans)
+}
+
+// GetLoadPlan returns a load plan
+func (h *LoadPlanHandler) GetLoadPlan(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid load plan ID"})
+	}
+
+	plan, err := h.loadPlanService.GetLoadPlan(c.Request().Context(), id)
+	if err != nil {
+		return h.planError(c, err)
+	}
+	return c.JSON(http.StatusOK, plan)
+}
+
+// ApplyLoadPlan writes a draft plan's totals and freight estimate to its shipment
+func (h *LoadPlanHandler) ApplyLoadPlan(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid load plan ID"})
+	}
+
+	plan, err := h.loadPlanService.ApplyLoadPlan(c.Request().Context(), id, getUserIDFromContext(c))
+	if err != nil {
+		return h.planError(c, err)
+	}
+	return c.JSON(http.StatusOK, plan)
+}
+
+func (h *LoadPlanHandler) planError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrShipmentNotFound), errors.Is(err, service.ErrLoadPlanNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrLoadPlanMissingData), errors.Is(err, service.ErrUnknownContainerType):
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrLoadPlanNotDraft), errors.Is(err, service.ErrLoadPlanStale):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process load plan"})
+}
+
+// Freight rates
+
+// ListFreightRates lists the company's freight rates
+func (h *LoadPlanHandler) ListFreightRates(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id":  c.Get("company_id").(uuid.UUID),
+		"origin_port": c.QueryParam("origin_port"),
+		"dest_port":   c.QueryParam("dest_port"),
+		"method":      c.QueryParam("method"),
+	}
+
+	rates, err := h.loadPlanService.ListFreightRates(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list freight rates"})
+	}
+	return c.JSON(http.StatusOK, rates)
+}
+
+// CreateFreightRate creates a freight rate
+func (h *LoadPlanHandler) CreateFreightRate(c echo.Context) error {
+	var rate models.FreightRate
+	if err := c.Bind(&rate); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	rate.ID = uuid.Nil
+	rate.CompanyID = c.Get("company_id").(uuid.UUID)
+	rate.CreatedBy = getUserIDFromContext(c)
+
+	if err := h.loadPlanService.CreateFreightRate(c.Request().Context(), &rate); err != nil {
+		return h.rateError(c, err)
+	}
+	return c.JSON(http.StatusCreated, rate)
+}
+
+// UpdateFreightRate updates a freight rate
+func (h *LoadPlanHandler) UpdateFreightRate(c echo.Context) error {
+	existing, err := h.getRate(c)
+	if err != nil {
+		return h.rateError(c, err)
+	}
+
+	var rate models.FreightRate
+	if err := c.Bind(&rate); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	rate.ID = existing.ID
+	rate.CompanyID = existing.CompanyID
+	rate.CreatedAt = existing.CreatedAt
+	rate.CreatedBy = existing.CreatedBy
+
+	if err := h.loadPlanService.UpdateFreightRate(c.Request().Context(), &rate); err != nil {
+		return h.rateError(c, err)
+	}
+	return c.JSON(http.StatusOK, rate)
+}
+
+// DeleteFreightRate deletes a freight rate
+func (h *LoadPlanHandler) DeleteFreightRate(c echo.Context) error {
+	rate, err := h.getRate(c)
+	if err != nil {
+		return h.rateError(c, err)
+	}
+	if err := h.loadPlanService.DeleteFreightRate(c.Request().Context(), rate.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete freight rate"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getRate loads the rate in the path, hiding those of other companies
+func (h *LoadPlanHandler) getRate(c echo.Context) (*models.FreightRate, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrFreightRateNotFound
+	}
+	rate, err := h.loadPlanService.GetFreightRate(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if rate.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrFreightRateNotFound
+	}
+	return rate, nil
+}
+
+func (h *LoadPlanHandler) rateError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrFreightRateNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidFreightRate):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save freight rate"})
+}
@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// NCRHandler handles nonconformance reports and their 8D corrective action
+// workflow
+type NCRHandler struct {
+	ncrService service.NCRService
+}
+
+// NewNCRHandler creates a new NCR handler
+func NewNCRHandler(ncrService service.NCRService) *NCRHandler {
+	return &NCRHandler{
+		ncrService: ncrService,
+	}
+}
+
+// Reports
+
+// CreateNCR opens a nonconformance report, e.g. for a customer complaint
+func (h *NCRHandler) CreateNCR(c echo.Context) error {
+	var ncr models.NonconformanceReport
+	if err := c.Bind(&ncr); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	ncr.ID = uuid.Nil
+	ncr.CompanyID = c.Get("company_id").(uuid.UUID)
+
+	if err := h.ncrService.Create(c.Request().Context(), &ncr, getUserIDFromContext(c)); err != nil {
+		return h.ncrError(c, err)
+	}
+	return c.JSON(http.StatusCreated, ncr)
+}
+
+// ListNCRs lists nonconformance reports; filter on ?status, ?source,
+// ?severity, ?responsibility, ?supplier_id, ?customer_id, ?inventory_id and
+// ?search
+func (h *NCRHandler) ListNCRs(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+	}
+	for _, field := range []string{"status", "source", "severity", "responsibility", "search"} {
+		params[field] = c.QueryParam(field)
+	}
+	for _, field := range []string{"supplier_id", "customer_id", "inventory_id"} {
+		if id, err := uuid.Parse(c.QueryParam(field)); err == nil {
+			params[field] = id
+		}
+	}
+	ncrPageParams(c, params)
+
+	ncrs, total, err := h.ncrService.List(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list nonconformance reports"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  ncrs,
+		"total": total,
+	})
+}
+
+// GetNCR returns a report with its 8D steps and containment actions
+func (h *NCRHandler) GetNCR(c echo.Context) error {
+	ncr, err := h.getNCR(c)
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	return c.JSON(http.StatusOK, ncr)
+}
+
+// UpdateNCR changes the description and references of an open report
+func (h *NCRHandler) UpdateNCR(c echo.Context) error {
+	ncr, err := h.getNCR(c)
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	var req models.NonconformanceReport
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	ncr, err = h.ncrService.Update(c.Request().Context(), ncr.ID, &req)
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	return c.JSON(http.StatusOK, ncr)
+}
+
+// CancelNCR withdraws a report raised in error
+func (h *NCRHandler) CancelNCR(c echo.Context) error {
+	ncr, err := h.getNCR(c)
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	ncr, err = h.ncrService.Cancel(c.Request().Context(), ncr.ID, req.Reason, getUserIDFromContext(c))
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	return c.JSON(http.StatusOK, ncr)
+}
+
+// Workflow
+
+// UpdateStep assigns or completes the 8D discipline in the path (1 to 8)
+func (h *NCRHandler) UpdateStep(c echo.Context) error {
+	ncr, err := h.getNCR(c)
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	discipline, err := strconv.Atoi(c.Param("discipline"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid discipline"})
+	}
+	var req service.NCRStepRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	ncr, err = h.ncrService.UpdateStep(c.Request().Context(), ncr.ID, discipline, req, getUserIDFromContext(c))
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	return c.JSON(http.StatusOK, ncr)
+}
+
+// SetDisposition decides what happens to the nonconforming material
+func (h *NCRHandler) SetDisposition(c echo.Context) error {
+	ncr, err := h.getNCR(c)
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	var req service.NCRDispositionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	ncr, err = h.ncrService.SetDisposition(c.Request().Context(), ncr.ID, req, getUserIDFromContext(c))
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	return c.JSON(http.StatusOK, ncr)
+}
+
+// SetRootCause records the root cause and responsibility
+func (h *NCRHandler) SetRootCause(c echo.Context) error {
+	ncr, err := h.getNCR(c)
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	var req service.NCRRootCauseRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	ncr, err = h.ncrService.SetRootCause(c.Request().Context(), ncr.ID, req, getUserIDFromContext(c))
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	return c.JSON(http.StatusOK, ncr)
+}
+
+// VerifyEffectiveness records whether the corrective actions worked
+func (h *NCRHandler) VerifyEffectiveness(c echo.Context) error {
+	ncr, err := h.getNCR(c)
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	var req service.NCRVerificationRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	ncr, err = h.ncrService.VerifyEffectiveness(c.Request().Context(), ncr.ID, req, getUserIDFromContext(c))
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	return c.JSON(http.StatusOK, ncr)
+}
+
+// Containment
+
+// AddContainment adds a containment action to a report
+func (h *NCRHandler) AddContainment(c echo.Context) error {
+	ncr, err := h.getNCR(c)
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	var req models.NCRContainment
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	containment, err := h.ncrService.AddContainment(c.Request().Context(), ncr.ID, &req)
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	return c.JSON(http.StatusCreated, containment)
+}
+
+// UpdateContainment records the progress of a containment action
+func (h *NCRHandler) UpdateContainment(c echo.Context) error {
+	ncr, err := h.getNCR(c)
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	containmentID, err := uuid.Parse(c.Param("containment_id"))
+	if err != nil {
+		return h.ncrError(c, service.ErrContainmentNotFound)
+	}
+	var req models.NCRContainment
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	containment, err := h.ncrService.UpdateContainment(c.Request().Context(), ncr.ID, containmentID, &req)
+	if err != nil {
+		return h.ncrError(c, err)
+	}
+	return c.JSON(http.StatusOK, containment)
+}
+
+// ListLotContainments lists the containment actions taken on the lot in
+// ?lot_no
+func (h *NCRHandler) ListLotContainments(c echo.Context) error {
+	lotNo := c.QueryParam("lot_no")
+	if lotNo == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "lot_no is required"})
+	}
+
+	containments, err := h.ncrService.ListContainmentsByLot(c.Request().Context(), c.Get("company_id").(uuid.UUID), lotNo)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list containment actions"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  containments,
+		"total": len(containments),
+	})
+}
+
+// getNCR loads the report in the path, hiding those of other companies
+func (h *NCRHandler) getNCR(c echo.Context) (*models.NonconformanceReport, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrNCRNotFound
+	}
+	ncr, err := h.ncrService.Get(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if ncr.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrNCRNotFound
+	}
+	return ncr, nil
+}
+
+func (h *NCRHandler) ncrError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrNCRNotFound), errors.Is(err, service.ErrContainmentNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrNCRClosed), errors.Is(err, service.ErrNCRStepOrder), errors.Is(err, service.ErrNCRStepIncomplete):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidNCR):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process nonconformance request"})
+}
+
+func ncrPageParams(c echo.Context, params map[string]interface{}) {
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -194,6 +195,9 @@ func (h *OrderHandler) UpdateStatus(c echo.Context) error {
 	
 	order, err := h.service.UpdateStatus(id, userID, req.Status, req.Notes)
 	if err != nil {
+		if errors.Is(err, service.ErrCreditHold) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 	
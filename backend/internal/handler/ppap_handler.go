@@ -0,0 +1,301 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// PPAPHandler handles production part approval submissions of customer
+// part numbers and the warnings of releases without approval
+type PPAPHandler struct {
+	ppapService service.PPAPService
+}
+
+// NewPPAPHandler creates a new PPAP handler
+func NewPPAPHandler(ppapService service.PPAPService) *PPAPHandler {
+	return &PPAPHandler{
+		ppapService: ppapService,
+	}
+}
+
+// CreateSubmission opens a PPAP submission with the checklist of its level
+func (h *PPAPHandler) CreateSubmission(c echo.Context) error {
+	var submission models.PPAPSubmission
+	if err := c.Bind(&submission); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	submission.ID = uuid.Nil
+	submission.CompanyID = c.Get("company_id").(uuid.UUID)
+	submission.CreatedBy = getUserIDFromContext(c)
+	submission.Customer, submission.Inventory, submission.Route = nil, nil, nil
+
+	if err := h.ppapService.CreateSubmission(c.Request().Context(), &submission); err != nil {
+		return h.ppapError(c, err)
+	}
+	return c.JSON(http.StatusCreated, submission)
+}
+
+// ListSubmissions lists PPAP submissions; filter on ?customer_id,
+// ?inventory_id, ?status, ?level and ?search
+func (h *PPAPHandler) ListSubmissions(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+		"status":     c.QueryParam("status"),
+		"search":     c.QueryParam("search"),
+	}
+	for _, field := range []string{"customer_id", "inventory_id"} {
+		if id, err := uuid.Parse(c.QueryParam(field)); err == nil {
+			params[field] = id
+		}
+	}
+	if level, err := strconv.Atoi(c.QueryParam("level")); err == nil {
+		params["level"] = level
+	}
+	ppapPageParams(c, params)
+
+	submissions, total, err := h.ppapService.ListSubmissions(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list PPAP submissions"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  submissions,
+		"total": total,
+	})
+}
+
+// GetSubmission returns a submission with its elements and documents
+func (h *PPAPHandler) GetSubmission(c echo.Context) error {
+	submission, err := h.getSubmission(c)
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+	return c.JSON(http.StatusOK, submission)
+}
+
+// UpdateSubmission changes a draft or rejected submission
+func (h *PPAPHandler) UpdateSubmission(c echo.Context) error {
+	submission, err := h.getSubmission(c)
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+	var req models.PPAPSubmission
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	submission, err = h.ppapService.UpdateSubmission(c.Request().Context(), submission.ID, &req)
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+	return c.JSON(http.StatusOK, submission)
+}
+
+// UpdateElement sets the requirement, applicability or notes of an element
+func (h *PPAPHandler) UpdateElement(c echo.Context) error {
+	submission, err := h.getSubmission(c)
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+	element, err := strconv.Atoi(c.Param("element"))
+	if err != nil {
+		return h.ppapError(c, service.ErrPPAPElementNotFound)
+	}
+	var req service.UpdatePPAPElementRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	updated, err := h.ppapService.UpdateElement(c.Request().Context(), submission.ID, element, req)
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+	return c.JSON(http.StatusOK, updated)
+}
+
+// UploadDocument uploads a new version of the document of an element as
+// multipart form field "file" with an optional "comment"
+func (h *PPAPHandler) UploadDocument(c echo.Context) error {
+	submission, err := h.getSubmission(c)
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+	element, err := strconv.Atoi(c.Param("element"))
+	if err != nil {
+		return h.ppapError(c, service.ErrPPAPElementNotFound)
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No file provided"})
+	}
+	src, err := file.Open()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open file"})
+	}
+	defer src.Close()
+
+	doc, err := h.ppapService.UploadDocument(c.Request().Context(), service.UploadPPAPDocumentRequest{
+		SubmissionID: submission.ID,
+		Element:      element,
+		FileName:     file.Filename,
+		ContentType:  file.Header.Get("Content-Type"),
+		Comment:      c.FormValue("comment"),
+		UserID:       getUserIDFromContext(c),
+		Content:      src,
+	})
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+	return c.JSON(http.StatusCreated, doc)
+}
+
+// DownloadDocument returns a document version of a submission
+func (h *PPAPHandler) DownloadDocument(c echo.Context) error {
+	submission, err := h.getSubmission(c)
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+	documentID, err := uuid.Parse(c.Param("document_id"))
+	if err != nil {
+		return h.ppapError(c, service.ErrPPAPDocumentNotFound)
+	}
+
+	doc, content, err := h.ppapService.OpenDocument(c.Request().Context(), submission.ID, documentID)
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+	contentType := doc.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", doc.FileName))
+	return c.Blob(http.StatusOK, contentType, content)
+}
+
+// SubmitSubmission sends a complete submission to the customer
+func (h *PPAPHandler) SubmitSubmission(c echo.Context) error {
+	submission, err := h.getSubmission(c)
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+
+	submission, err = h.ppapService.SubmitSubmission(c.Request().Context(), submission.ID, getUserIDFromContext(c))
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+	return c.JSON(http.StatusOK, submission)
+}
+
+// DecideSubmission records the customer's approval, interim approval or
+// rejection
+func (h *PPAPHandler) DecideSubmission(c echo.Context) error {
+	submission, err := h.getSubmission(c)
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+	var req service.PPAPDecisionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.UserID = getUserIDFromContext(c)
+
+	submission, err = h.ppapService.DecideSubmission(c.Request().Context(), submission.ID, req)
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+	return c.JSON(http.StatusOK, submission)
+}
+
+// ListReleaseWarnings lists production orders released without an
+// approved PPAP; filter on ?inventory_id, ?customer_id and ?acknowledged
+func (h *PPAPHandler) ListReleaseWarnings(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+	}
+	for _, field := range []string{"inventory_id", "customer_id"} {
+		if id, err := uuid.Parse(c.QueryParam(field)); err == nil {
+			params[field] = id
+		}
+	}
+	if acknowledged, err := strconv.ParseBool(c.QueryParam("acknowledged")); err == nil {
+		params["acknowledged"] = acknowledged
+	}
+	ppapPageParams(c, params)
+
+	warnings, total, err := h.ppapService.ListReleaseWarnings(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list PPAP release warnings"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  warnings,
+		"total": total,
+	})
+}
+
+// AcknowledgeReleaseWarning marks a release warning as seen
+func (h *PPAPHandler) AcknowledgeReleaseWarning(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return h.ppapError(c, service.ErrPPAPWarningNotFound)
+	}
+	warning, err := h.ppapService.GetReleaseWarning(c.Request().Context(), id)
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+	if warning.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return h.ppapError(c, service.ErrPPAPWarningNotFound)
+	}
+
+	warning, err = h.ppapService.AcknowledgeReleaseWarning(c.Request().Context(), warning.ID, getUserIDFromContext(c))
+	if err != nil {
+		return h.ppapError(c, err)
+	}
+	return c.JSON(http.StatusOK, warning)
+}
+
+// getSubmission loads the submission in the path, hiding those of other
+// companies
+func (h *PPAPHandler) getSubmission(c echo.Context) (*models.PPAPSubmission, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrPPAPNotFound
+	}
+	submission, err := h.ppapService.GetSubmission(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if submission.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrPPAPNotFound
+	}
+	return submission, nil
+}
+
+func (h *PPAPHandler) ppapError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrPPAPNotFound), errors.Is(err, service.ErrPPAPElementNotFound),
+		errors.Is(err, service.ErrPPAPDocumentNotFound), errors.Is(err, service.ErrPPAPWarningNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrPPAPNotEditable), errors.Is(err, service.ErrPPAPNotSubmitted),
+		errors.Is(err, service.ErrPPAPIncomplete):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidPPAP), errors.Is(err, service.ErrInvalidPPAPDecision):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process PPAP request"})
+}
+
+func ppapPageParams(c echo.Context, params map[string]interface{}) {
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+}
@@ -1,14 +1,17 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
 	"github.com/fastenmind/fastener-api/internal/service"
 	"github.com/fastenmind/fastener-api/pkg/response"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 type ProcessCostHandler struct {
@@ -82,7 +85,7 @@ func (h *ProcessCostHandler) UpdateCostTemplate(c echo.Context) error {
 	
 	template, err := h.processCostService.UpdateCostTemplate(templateID, &req, companyID, userID)
 	if err != nil {
-		return response.Error(c, http.StatusInternalServerError, "Failed to update cost template", err)
+		return response.Error(c, revisionErrorStatus(err), "Failed to update cost template", err)
 	}
 	
 	return response.Success(c, template, "Cost template updated successfully")
@@ -183,7 +186,7 @@ func (h *ProcessCostHandler) UpdateMaterialCost(c echo.Context) error {
 	
 	material, err := h.processCostService.UpdateMaterialCost(materialID, &req, companyID, userID)
 	if err != nil {
-		return response.Error(c, http.StatusInternalServerError, "Failed to update material cost", err)
+		return response.Error(c, revisionErrorStatus(err), "Failed to update material cost", err)
 	}
 	
 	return response.Success(c, material, "Material cost updated successfully")
@@ -217,12 +220,138 @@ func (h *ProcessCostHandler) UpdateProcessingRate(c echo.Context) error {
 	
 	rate, err := h.processCostService.UpdateProcessingRate(rateID, &req, companyID, userID)
 	if err != nil {
-		return response.Error(c, http.StatusInternalServerError, "Failed to update processing rate", err)
+		return response.Error(c, revisionErrorStatus(err), "Failed to update processing rate", err)
 	}
 	
 	return response.Success(c, rate, "Processing rate updated successfully")
 }
 
+// GetCostTemplateVersions 獲取成本模板的所有版本
+func (h *ProcessCostHandler) GetCostTemplateVersions(c echo.Context) error {
+	companyID := c.Get("company_id").(string)
+	
+	versions, err := h.processCostService.GetCostTemplateVersions(c.Param("id"), companyID)
+	if err != nil {
+		return response.Error(c, revisionErrorStatus(err), "Failed to get cost template versions", err)
+	}
+	
+	return response.Success(c, versions, "Cost template versions retrieved successfully")
+}
+
+// GetMaterialCostVersions 獲取材料成本的所有版本
+func (h *ProcessCostHandler) GetMaterialCostVersions(c echo.Context) error {
+	companyID := c.Get("company_id").(string)
+	
+	versions, err := h.processCostService.GetMaterialCostVersions(c.Param("id"), companyID)
+	if err != nil {
+		return response.Error(c, revisionErrorStatus(err), "Failed to get material cost versions", err)
+	}
+	
+	return response.Success(c, versions, "Material cost versions retrieved successfully")
+}
+
+// GetProcessingRateVersions 獲取加工費率的所有版本
+func (h *ProcessCostHandler) GetProcessingRateVersions(c echo.Context) error {
+	companyID := c.Get("company_id").(string)
+	
+	versions, err := h.processCostService.GetProcessingRateVersions(c.Param("id"), companyID)
+	if err != nil {
+		return response.Error(c, revisionErrorStatus(err), "Failed to get processing rate versions", err)
+	}
+	
+	return response.Success(c, versions, "Processing rate versions retrieved successfully")
+}
+
+// GetSurfaceTreatmentRates 獲取表面處理費率
+func (h *ProcessCostHandler) GetSurfaceTreatmentRates(c echo.Context) error {
+	companyID := c.Get("company_id").(string)
+	treatmentType := c.QueryParam("treatment_type")
+	
+	rates, err := h.processCostService.GetSurfaceTreatmentRates(companyID, treatmentType)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, "Failed to get surface treatment rates", err)
+	}
+	
+	return response.Success(c, rates, "Surface treatment rates retrieved successfully")
+}
+
+// UpdateSurfaceTreatmentRate 更新表面處理費率
+func (h *ProcessCostHandler) UpdateSurfaceTreatmentRate(c echo.Context) error {
+	rateID := c.Param("id")
+	
+	var req models.SurfaceTreatmentRate
+	if err := c.Bind(&req); err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid request", err)
+	}
+	
+	companyID := c.Get("company_id").(string)
+	userID := c.Get("user_id").(string)
+	
+	rate, err := h.processCostService.UpdateSurfaceTreatmentRate(rateID, &req, companyID, userID)
+	if err != nil {
+		return response.Error(c, revisionErrorStatus(err), "Failed to update surface treatment rate", err)
+	}
+	
+	return response.Success(c, rate, "Surface treatment rate updated successfully")
+}
+
+// GetSurfaceTreatmentRateVersions 獲取表面處理費率的所有版本
+func (h *ProcessCostHandler) GetSurfaceTreatmentRateVersions(c echo.Context) error {
+	companyID := c.Get("company_id").(string)
+	
+	versions, err := h.processCostService.GetSurfaceTreatmentRateVersions(c.Param("id"), companyID)
+	if err != nil {
+		return response.Error(c, revisionErrorStatus(err), "Failed to get surface treatment rate versions", err)
+	}
+	
+	return response.Success(c, versions, "Surface treatment rate versions retrieved successfully")
+}
+
+// GetOverheadRates 獲取管理費率
+func (h *ProcessCostHandler) GetOverheadRates(c echo.Context) error {
+	companyID := c.Get("company_id").(string)
+	department := c.QueryParam("department")
+	
+	rates, err := h.processCostService.GetOverheadRates(companyID, department)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, "Failed to get overhead rates", err)
+	}
+	
+	return response.Success(c, rates, "Overhead rates retrieved successfully")
+}
+
+// UpdateOverheadRate 更新管理費率
+func (h *ProcessCostHandler) UpdateOverheadRate(c echo.Context) error {
+	rateID := c.Param("id")
+	
+	var req models.OverheadRate
+	if err := c.Bind(&req); err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid request", err)
+	}
+	
+	companyID := c.Get("company_id").(string)
+	userID := c.Get("user_id").(string)
+	
+	rate, err := h.processCostService.UpdateOverheadRate(rateID, &req, companyID, userID)
+	if err != nil {
+		return response.Error(c, revisionErrorStatus(err), "Failed to update overhead rate", err)
+	}
+	
+	return response.Success(c, rate, "Overhead rate updated successfully")
+}
+
+// GetOverheadRateVersions 獲取管理費率的所有版本
+func (h *ProcessCostHandler) GetOverheadRateVersions(c echo.Context) error {
+	companyID := c.Get("company_id").(string)
+	
+	versions, err := h.processCostService.GetOverheadRateVersions(c.Param("id"), companyID)
+	if err != nil {
+		return response.Error(c, revisionErrorStatus(err), "Failed to get overhead rate versions", err)
+	}
+	
+	return response.Success(c, versions, "Overhead rate versions retrieved successfully")
+}
+
 // BatchCalculateCost 批量計算成本
 func (h *ProcessCostHandler) BatchCalculateCost(c echo.Context) error {
 	var req models.BatchCostCalculationRequest
@@ -326,4 +455,17 @@ func getContentType(format string) string {
 	default:
 		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
 	}
-}
\ No newline at end of file
+}
+
+// revisionErrorStatus 版本修改錯誤對應的 HTTP 狀態碼
+func revisionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrVersionSuperseded):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidEffectiveDate):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,365 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// ProductMasterHandler handles the fastener specification library,
+// customer part numbers with their drawing revisions and the revision
+// change flags of open quotes and orders
+type ProductMasterHandler struct {
+	productService service.ProductMasterService
+}
+
+// NewProductMasterHandler creates a new product master handler
+func NewProductMasterHandler(productService service.ProductMasterService) *ProductMasterHandler {
+	return &ProductMasterHandler{
+		productService: productService,
+	}
+}
+
+// ListStandards returns the product standards specifications are made to
+func (h *ProductMasterHandler) ListStandards(c echo.Context) error {
+	standards := h.productService.ListStandards()
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  standards,
+		"total": len(standards),
+	})
+}
+
+// ListSpecifications searches the specification library; filter on
+// ?standard (matching its equivalents), ?size, ?grade, ?finish and ?search
+func (h *ProductMasterHandler) ListSpecifications(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+		"standard":   c.QueryParam("standard"),
+		"size":       c.QueryParam("size"),
+		"grade":      c.QueryParam("grade"),
+		"finish":     c.QueryParam("finish"),
+		"search":     c.QueryParam("search"),
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	specs, total, err := h.productService.ListSpecifications(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list fastener specifications"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  specs,
+		"total": total,
+	})
+}
+
+// GetSpecification returns the specification of an inventory item
+func (h *ProductMasterHandler) GetSpecification(c echo.Context) error {
+	inventoryID, err := uuid.Parse(c.Param("inventory_id"))
+	if err != nil {
+		return h.productMasterError(c, service.ErrFastenerSpecNotFound)
+	}
+	spec, err := h.productService.GetSpecification(c.Request().Context(), inventoryID)
+	if err != nil {
+		return h.productMasterError(c, err)
+	}
+	if spec.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return h.productMasterError(c, service.ErrFastenerSpecNotFound)
+	}
+	return c.JSON(http.StatusOK, spec)
+}
+
+// SaveSpecification sets the specification of an inventory item
+func (h *ProductMasterHandler) SaveSpecification(c echo.Context) error {
+	inventoryID, err := uuid.Parse(c.Param("inventory_id"))
+	if err != nil {
+		return h.productMasterError(c, service.ErrInventoryItemNotFound)
+	}
+	var req service.FastenerSpecRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.CompanyID = c.Get("company_id").(uuid.UUID)
+	req.InventoryID = inventoryID
+	req.UserID = getUserIDFromContext(c)
+
+	spec, err := h.productService.SaveSpecification(c.Request().Context(), &req)
+	if err != nil {
+		return h.productMasterError(c, err)
+	}
+	return c.JSON(http.StatusOK, spec)
+}
+
+// CreatePart maps a customer part number to an inventory item
+func (h *ProductMasterHandler) CreatePart(c echo.Context) error {
+	var req service.CustomerPartRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.CompanyID = c.Get("company_id").(uuid.UUID)
+
+	part, err := h.productService.CreatePart(c.Request().Context(), &req, getUserIDFromContext(c))
+	if err != nil {
+		return h.productMasterError(c, err)
+	}
+	return c.JSON(http.StatusCreated, part)
+}
+
+// ListParts lists customer parts; filter on ?customer_id, ?inventory_id,
+// ?active and ?search
+func (h *ProductMasterHandler) ListParts(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+		"search":     c.QueryParam("search"),
+	}
+	if id, err := uuid.Parse(c.QueryParam("customer_id")); err == nil {
+		params["customer_id"] = id
+	}
+	if id, err := uuid.Parse(c.QueryParam("inventory_id")); err == nil {
+		params["inventory_id"] = id
+	}
+	if active, err := strconv.ParseBool(c.QueryParam("active")); err == nil {
+		params["active"] = active
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	parts, total, err := h.productService.ListParts(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list customer parts"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  parts,
+		"total": total,
+	})
+}
+
+// ResolvePart finds our part by the number a customer knows it by, given
+// ?customer_id and ?part_no
+func (h *ProductMasterHandler) ResolvePart(c echo.Context) error {
+	customerID, err := uuid.Parse(c.QueryParam("customer_id"))
+	if err != nil || c.QueryParam("part_no") == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "customer_id and part_no are required"})
+	}
+	part, err := h.productService.ResolvePart(c.Request().Context(), c.Get("company_id").(uuid.UUID), customerID, c.QueryParam("part_no"))
+	if err != nil {
+		return h.productMasterError(c, err)
+	}
+	return c.JSON(http.StatusOK, part)
+}
+
+// GetPart returns a customer part with its drawing revisions
+func (h *ProductMasterHandler) GetPart(c echo.Context) error {
+	part, err := h.getPart(c)
+	if err != nil {
+		return h.productMasterError(c, err)
+	}
+	return c.JSON(http.StatusOK, part)
+}
+
+// UpdatePart updates the number, name, inventory item or status of a
+// customer part
+func (h *ProductMasterHandler) UpdatePart(c echo.Context) error {
+	var req service.CustomerPartRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	part, err := h.getPart(c)
+	if err != nil {
+		return h.productMasterError(c, err)
+	}
+
+	part, err = h.productService.UpdatePart(c.Request().Context(), part.ID, &req)
+	if err != nil {
+		return h.productMasterError(c, err)
+	}
+	return c.JSON(http.StatusOK, part)
+}
+
+// UploadDrawing uploads a new drawing revision as multipart form field
+// "file" with "revision" and optional "drawing_no", "change_description"
+// and "effective_date" (YYYY-MM-DD)
+func (h *ProductMasterHandler) UploadDrawing(c echo.Context) error {
+	part, err := h.getPart(c)
+	if err != nil {
+		return h.productMasterError(c, err)
+	}
+
+	var effectiveDate *time.Time
+	if v := c.FormValue("effective_date"); v != "" {
+		date, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "effective_date must be YYYY-MM-DD"})
+		}
+		effectiveDate = &date
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No file provided"})
+	}
+	src, err := file.Open()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open file"})
+	}
+	defer src.Close()
+
+	result, err := h.productService.UploadDrawing(c.Request().Context(), service.UploadDrawingRequest{
+		PartID:            part.ID,
+		Revision:          c.FormValue("revision"),
+		DrawingNo:         c.FormValue("drawing_no"),
+		ChangeDescription: c.FormValue("change_description"),
+		EffectiveDate:     effectiveDate,
+		FileName:          file.Filename,
+		ContentType:       file.Header.Get("Content-Type"),
+		UserID:            getUserIDFromContext(c),
+		Content:           src,
+	})
+	if err != nil {
+		return h.productMasterError(c, err)
+	}
+	return c.JSON(http.StatusCreated, result)
+}
+
+// DownloadDrawing returns a drawing revision of a customer part
+func (h *ProductMasterHandler) DownloadDrawing(c echo.Context) error {
+	part, err := h.getPart(c)
+	if err != nil {
+		return h.productMasterError(c, err)
+	}
+	drawingID, err := uuid.Parse(c.Param("drawing_id"))
+	if err != nil {
+		return h.productMasterError(c, service.ErrDrawingNotFound)
+	}
+
+	drawing, content, err := h.productService.OpenDrawing(c.Request().Context(), part.ID, drawingID)
+	if err != nil {
+		return h.productMasterError(c, err)
+	}
+	contentType := drawing.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", drawing.FileName))
+	return c.Blob(http.StatusOK, contentType, content)
+}
+
+// ListFlags lists revision change flags; filter on ?status,
+// ?customer_part_id and ?document_type
+func (h *ProductMasterHandler) ListFlags(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id":    c.Get("company_id").(uuid.UUID),
+		"status":        c.QueryParam("status"),
+		"document_type": c.QueryParam("document_type"),
+	}
+	if id, err := uuid.Parse(c.QueryParam("customer_part_id")); err == nil {
+		params["customer_part_id"] = id
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	flags, total, err := h.productService.ListFlags(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list revision change flags"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  flags,
+		"total": total,
+	})
+}
+
+// GetFlag returns a revision change flag
+func (h *ProductMasterHandler) GetFlag(c echo.Context) error {
+	flag, err := h.getFlag(c)
+	if err != nil {
+		return h.productMasterError(c, err)
+	}
+	return c.JSON(http.StatusOK, flag)
+}
+
+// ResolveFlag moves a flagged document to the new revision or accepts it
+// on its own revision with a note
+func (h *ProductMasterHandler) ResolveFlag(c echo.Context) error {
+	var req service.ResolveRevisionFlagRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	flag, err := h.getFlag(c)
+	if err != nil {
+		return h.productMasterError(c, err)
+	}
+
+	flag, err = h.productService.ResolveFlag(c.Request().Context(), flag.ID, &req, getUserIDFromContext(c))
+	if err != nil {
+		return h.productMasterError(c, err)
+	}
+	return c.JSON(http.StatusOK, flag)
+}
+
+// getPart loads the customer part in the id path parameter, hiding those of
+// other companies
+func (h *ProductMasterHandler) getPart(c echo.Context) (*models.CustomerPart, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrCustomerPartNotFound
+	}
+	part, err := h.productService.GetPart(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if part.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrCustomerPartNotFound
+	}
+	return part, nil
+}
+
+// getFlag loads the revision change flag in the id path parameter, hiding
+// those of other companies
+func (h *ProductMasterHandler) getFlag(c echo.Context) (*models.RevisionChangeFlag, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrRevisionFlagNotFound
+	}
+	flag, err := h.productService.GetFlag(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if flag.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrRevisionFlagNotFound
+	}
+	return flag, nil
+}
+
+func (h *ProductMasterHandler) productMasterError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrCustomerPartNotFound), errors.Is(err, service.ErrFastenerSpecNotFound),
+		errors.Is(err, service.ErrInventoryItemNotFound), errors.Is(err, service.ErrDrawingNotFound),
+		errors.Is(err, service.ErrRevisionFlagNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrDuplicateCustomerPart), errors.Is(err, service.ErrDrawingRevisionExists),
+		errors.Is(err, service.ErrDrawingRevisionNotNewer), errors.Is(err, service.ErrRevisionFlagResolved):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidCustomerPart), errors.Is(err, service.ErrInvalidFastenerSpec),
+		errors.Is(err, service.ErrInvalidDrawing), errors.Is(err, service.ErrInvalidRevisionResolution):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process product master request"})
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	
@@ -355,6 +356,9 @@ func (h *ProductionHandler) CreateRouteOperation(c echo.Context) error {
 	req.RouteID = routeID
 	
 	if err := h.productionService.CreateRouteOperation(&req); err != nil {
+		if errors.Is(err, service.ErrInvalidSubcontractOrder) || errors.Is(err, service.ErrInvalidSubcontractFee) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 	
@@ -375,6 +379,9 @@ func (h *ProductionHandler) UpdateRouteOperation(c echo.Context) error {
 	req.ID = id
 	
 	if err := h.productionService.UpdateRouteOperation(&req); err != nil {
+		if errors.Is(err, service.ErrInvalidSubcontractOrder) || errors.Is(err, service.ErrInvalidSubcontractFee) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 	
@@ -696,7 +703,7 @@ func (h *ProductionHandler) CreateQualityInspection(c echo.Context) error {
 	req.InspectorID = user.ID
 	
 	if err := h.productionService.CreateQualityInspection(&req); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return echo.NewHTTPError(inspectionErrorStatus(err), err.Error())
 	}
 	
 	return c.JSON(http.StatusCreated, req)
@@ -716,7 +723,7 @@ func (h *ProductionHandler) UpdateQualityInspection(c echo.Context) error {
 	req.ID = id
 	
 	if err := h.productionService.UpdateQualityInspection(&req); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return echo.NewHTTPError(inspectionErrorStatus(err), err.Error())
 	}
 	
 	return c.JSON(http.StatusOK, req)
@@ -848,4 +855,18 @@ func (h *ProductionHandler) GetProductionStats(c echo.Context) error {
 	}
 	
 	return c.JSON(http.StatusOK, stats)
-}
\ No newline at end of file
+}
+
+// inspectionErrorStatus maps sampling errors of quality inspections to
+// their HTTP status
+func inspectionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrSamplingPlanNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrSamplingDiscontinued), errors.Is(err, service.ErrInspectionDecided):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrSampleIncomplete), errors.Is(err, service.ErrInvalidSamplingPlan):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/sampling"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// SamplingHandler handles ISO 2859-1 sampling plans and the switching
+// state of the suppliers and products inspected under them
+type SamplingHandler struct {
+	samplingService service.SamplingService
+}
+
+// NewSamplingHandler creates a new sampling handler
+func NewSamplingHandler(samplingService service.SamplingService) *SamplingHandler {
+	return &SamplingHandler{
+		samplingService: samplingService,
+	}
+}
+
+// Plans
+
+// CreatePlan creates a sampling plan
+func (h *SamplingHandler) CreatePlan(c echo.Context) error {
+	var plan models.SamplingPlan
+	if err := c.Bind(&plan); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	plan.ID = uuid.Nil
+	plan.CompanyID = c.Get("company_id").(uuid.UUID)
+	userID := getUserIDFromContext(c)
+	plan.CreatedBy = &userID
+
+	if err := h.samplingService.CreatePlan(c.Request().Context(), &plan); err != nil {
+		return h.samplingError(c, err)
+	}
+	return c.JSON(http.StatusCreated, plan)
+}
+
+// ListPlans lists sampling plans; filter on ?inspection_type, ?supplier_id,
+// ?inventory_id and ?is_active
+func (h *SamplingHandler) ListPlans(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id":      c.Get("company_id").(uuid.UUID),
+		"inspection_type": c.QueryParam("inspection_type"),
+	}
+	if supplierID, err := uuid.Parse(c.QueryParam("supplier_id")); err == nil {
+		params["supplier_id"] = supplierID
+	}
+	if inventoryID, err := uuid.Parse(c.QueryParam("inventory_id")); err == nil {
+		params["inventory_id"] = inventoryID
+	}
+	if isActive, err := strconv.ParseBool(c.QueryParam("is_active")); err == nil {
+		params["is_active"] = isActive
+	}
+	samplingPageParams(c, params)
+
+	plans, total, err := h.samplingService.ListPlans(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list sampling plans"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  plans,
+		"total": total,
+	})
+}
+
+// GetPlan returns a sampling plan
+func (h *SamplingHandler) GetPlan(c echo.Context) error {
+	plan, err := h.getPlan(c)
+	if err != nil {
+		return h.samplingError(c, err)
+	}
+	return c.JSON(http.StatusOK, plan)
+}
+
+// UpdatePlan changes a sampling plan
+func (h *SamplingHandler) UpdatePlan(c echo.Context) error {
+	plan, err := h.getPlan(c)
+	if err != nil {
+		return h.samplingError(c, err)
+	}
+	var req models.SamplingPlan
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	plan, err = h.samplingService.UpdatePlan(c.Request().Context(), plan.ID, &req)
+	if err != nil {
+		return h.samplingError(c, err)
+	}
+	return c.JSON(http.StatusOK, plan)
+}
+
+// PreviewPlan returns the single sampling plan for ?lot, ?level, ?aql and
+// ?severity without storing anything
+func (h *SamplingHandler) PreviewPlan(c echo.Context) error {
+	lot, err := strconv.Atoi(c.QueryParam("lot"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid lot size"})
+	}
+	aql, err := strconv.ParseFloat(c.QueryParam("aql"), 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid AQL"})
+	}
+	level := c.QueryParam("level")
+	if level == "" {
+		level = sampling.LevelII
+	}
+	severity := c.QueryParam("severity")
+	if severity == "" {
+		severity = sampling.Normal
+	}
+
+	plan, err := sampling.Single(lot, level, aql, severity)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, plan)
+}
+
+// States
+
+// ListStates lists switching states; filter on ?plan_id, ?supplier_id,
+// ?inventory_id and ?severity
+func (h *SamplingHandler) ListStates(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+		"severity":   c.QueryParam("severity"),
+	}
+	if planID, err := uuid.Parse(c.QueryParam("plan_id")); err == nil {
+		params["plan_id"] = planID
+	}
+	if supplierID, err := uuid.Parse(c.QueryParam("supplier_id")); err == nil {
+		params["supplier_id"] = supplierID
+	}
+	if inventoryID, err := uuid.Parse(c.QueryParam("inventory_id")); err == nil {
+		params["inventory_id"] = inventoryID
+	}
+	samplingPageParams(c, params)
+
+	states, total, err := h.samplingService.ListStates(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list sampling states"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  states,
+		"total": total,
+	})
+}
+
+// GetState returns a switching state with its history of switches
+func (h *SamplingHandler) GetState(c echo.Context) error {
+	state, err := h.getState(c)
+	if err != nil {
+		return h.samplingError(c, err)
+	}
+	return c.JSON(http.StatusOK, state)
+}
+
+// SwitchState records a switch decided by the responsible authority, such
+// as approving reduced inspection or resuming after discontinuation
+func (h *SamplingHandler) SwitchState(c echo.Context) error {
+	state, err := h.getState(c)
+	if err != nil {
+		return h.samplingError(c, err)
+	}
+	var req struct {
+		Severity string `json:"severity"`
+		Reason   string `json:"reason"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	state, err = h.samplingService.SwitchState(c.Request().Context(), state.ID, req.Severity, req.Reason, getUserIDFromContext(c))
+	if err != nil {
+		return h.samplingError(c, err)
+	}
+	return c.JSON(http.StatusOK, state)
+}
+
+// getPlan loads the plan in the path, hiding those of other companies
+func (h *SamplingHandler) getPlan(c echo.Context) (*models.SamplingPlan, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrSamplingPlanNotFound
+	}
+	plan, err := h.samplingService.GetPlan(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if plan.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrSamplingPlanNotFound
+	}
+	return plan, nil
+}
+
+// getState loads the state in the path, hiding those of other companies
+func (h *SamplingHandler) getState(c echo.Context) (*models.SamplingState, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrSamplingStateNotFound
+	}
+	state, err := h.samplingService.GetState(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if state.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrSamplingStateNotFound
+	}
+	return state, nil
+}
+
+func (h *SamplingHandler) samplingError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrSamplingPlanNotFound), errors.Is(err, service.ErrSamplingStateNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidSamplingPlan):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process sampling request"})
+}
+
+func samplingPageParams(c echo.Context, params map[string]interface{}) {
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+}
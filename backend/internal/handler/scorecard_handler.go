@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// ScorecardHandler handles supplier scorecards, their configuration and
+// trends
+type ScorecardHandler struct {
+	scorecardService service.SupplierScorecardService
+}
+
+// NewScorecardHandler creates a new scorecard handler
+func NewScorecardHandler(scorecardService service.SupplierScorecardService) *ScorecardHandler {
+	return &ScorecardHandler{
+		scorecardService: scorecardService,
+	}
+}
+
+// GetConfig returns the scorecard weights and limits of the company
+func (h *ScorecardHandler) GetConfig(c echo.Context) error {
+	config, err := h.scorecardService.GetConfig(c.Request().Context(), c.Get("company_id").(uuid.UUID))
+	if err != nil {
+		return h.scorecardError(c, err)
+	}
+	return c.JSON(http.StatusOK, config)
+}
+
+// UpdateConfig sets the scorecard weights and limits of the company
+func (h *ScorecardHandler) UpdateConfig(c echo.Context) error {
+	var req models.SupplierScorecardConfig
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.CompanyID = c.Get("company_id").(uuid.UUID)
+	userID := getUserIDFromContext(c)
+	req.UpdatedBy = &userID
+
+	config, err := h.scorecardService.UpdateConfig(c.Request().Context(), &req)
+	if err != nil {
+		return h.scorecardError(c, err)
+	}
+	return c.JSON(http.StatusOK, config)
+}
+
+// ComputeScorecards scores the suppliers of the company, or the one in
+// supplier_id, for a month given as YYYY-MM; the current month by default
+func (h *ScorecardHandler) ComputeScorecards(c echo.Context) error {
+	var req struct {
+		Period     string     `json:"period"`
+		SupplierID *uuid.UUID `json:"supplier_id"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	period := time.Now()
+	if req.Period != "" {
+		var err error
+		if period, err = time.Parse("2006-01", req.Period); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "period must be YYYY-MM"})
+		}
+	}
+	companyID := c.Get("company_id").(uuid.UUID)
+
+	if req.SupplierID != nil {
+		card, err := h.scorecardService.ComputeScorecard(c.Request().Context(), companyID, *req.SupplierID, period)
+		if err != nil {
+			return h.scorecardError(c, err)
+		}
+		return c.JSON(http.StatusOK, card)
+	}
+	run, err := h.scorecardService.ComputeScorecards(c.Request().Context(), companyID, period)
+	if err != nil {
+		return h.scorecardError(c, err)
+	}
+	return c.JSON(http.StatusOK, run)
+}
+
+// ListScorecards lists scorecards; filter on ?supplier_id, ?period
+// (YYYY-MM) and ?risk_level
+func (h *ScorecardHandler) ListScorecards(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+		"risk_level": c.QueryParam("risk_level"),
+	}
+	if id, err := uuid.Parse(c.QueryParam("supplier_id")); err == nil {
+		params["supplier_id"] = id
+	}
+	if period, err := time.Parse("2006-01", c.QueryParam("period")); err == nil {
+		params["period_start"] = period
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	cards, total, err := h.scorecardService.ListScorecards(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list supplier scorecards"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  cards,
+		"total": total,
+	})
+}
+
+// GetScorecard returns a scorecard with its risk explanation
+func (h *ScorecardHandler) GetScorecard(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return h.scorecardError(c, service.ErrScorecardNotFound)
+	}
+	card, err := h.scorecardService.GetScorecard(c.Request().Context(), id)
+	if err != nil {
+		return h.scorecardError(c, err)
+	}
+	if card.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return h.scorecardError(c, service.ErrScorecardNotFound)
+	}
+	return c.JSON(http.StatusOK, card)
+}
+
+// GetTrend returns the monthly scorecards of a supplier for charting over
+// ?months (12 by default)
+func (h *ScorecardHandler) GetTrend(c echo.Context) error {
+	supplierID, err := uuid.Parse(c.Param("supplier_id"))
+	if err != nil {
+		return h.scorecardError(c, service.ErrSupplierNotFound)
+	}
+	months, _ := strconv.Atoi(c.QueryParam("months"))
+
+	trend, err := h.scorecardService.GetTrend(c.Request().Context(), c.Get("company_id").(uuid.UUID), supplierID, months)
+	if err != nil {
+		return h.scorecardError(c, err)
+	}
+	return c.JSON(http.StatusOK, trend)
+}
+
+func (h *ScorecardHandler) scorecardError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrScorecardNotFound), errors.Is(err, service.ErrSupplierNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidScorecardConfig):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process scorecard request"})
+}
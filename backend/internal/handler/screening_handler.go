@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/screening"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// ScreeningHandler handles sanctions lists, screening policy and hit review
+type ScreeningHandler struct {
+	screeningService service.ScreeningService
+}
+
+// NewScreeningHandler creates a new screening handler
+func NewScreeningHandler(screeningService service.ScreeningService) *ScreeningHandler {
+	return &ScreeningHandler{
+		screeningService: screeningService,
+	}
+}
+
+// ListSanctionsLists lists the loaded sanctions lists
+func (h *ScreeningHandler) ListSanctionsLists(c echo.Context) error {
+	lists, err := h.screeningService.ListSanctionsLists(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list sanctions lists"})
+	}
+	return c.JSON(http.StatusOK, lists)
+}
+
+// ImportSanctionsList loads an uploaded list file, for system administrators
+// only. OFAC accepts the optional alt_file and add_file parts next to file
+// (sdn.csv).
+func (h *ScreeningHandler) ImportSanctionsList(c echo.Context) error {
+	req := service.ImportSanctionsListRequest{
+		Source: c.Param("source"),
+		UserID: getUserIDFromContext(c),
+	}
+
+	files := map[string]*io.Reader{
+		"file":     &req.Primary,
+		"alt_file": &req.AltNames,
+		"add_file": &req.Addresses,
+	}
+	for field, target := range files {
+		header, err := c.FormFile(field)
+		if err == http.ErrMissingFile {
+			continue
+		}
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid upload: " + field})
+		}
+		src, err := header.Open()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open file"})
+		}
+		defer src.Close()
+		*target = src
+	}
+	if req.Primary == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No file provided"})
+	}
+
+	result, err := h.screeningService.ImportSanctionsList(c.Request().Context(), req)
+	return h.importResult(c, result, err)
+}
+
+// DownloadSanctionsList fetches a list from its publisher
+func (h *ScreeningHandler) DownloadSanctionsList(c echo.Context) error {
+	result, err := h.screeningService.DownloadSanctionsList(c.Request().Context(), c.Param("source"), getUserIDFromContext(c))
+	return h.importResult(c, result, err)
+}
+
+func (h *ScreeningHandler) importResult(c echo.Context, result *service.SanctionsImportResult, err error) error {
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownSanctionsSource) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		if errors.Is(err, service.ErrSanctionsListForbidden) {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+		}
+		if result != nil {
+			// The list was stored but re-screening did not finish
+			return c.JSON(http.StatusAccepted, map[string]interface{}{"result": result, "error": err.Error()})
+		}
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// GetPolicy returns the company's screening thresholds
+func (h *ScreeningHandler) GetPolicy(c echo.Context) error {
+	companyID := c.Get("company_id").(uuid.UUID)
+	policy, err := h.screeningService.GetPolicy(c.Request().Context(), companyID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get screening policy"})
+	}
+	return c.JSON(http.StatusOK, policy)
+}
+
+// UpdatePolicy updates the company's screening thresholds
+func (h *ScreeningHandler) UpdatePolicy(c echo.Context) error {
+	var thresholds screening.Thresholds
+	if err := c.Bind(&thresholds); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	companyID := c.Get("company_id").(uuid.UUID)
+	policy, err := h.screeningService.UpdatePolicy(c.Request().Context(), companyID, getUserIDFromContext(c), thresholds)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidScreeningThresholds) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update screening policy"})
+	}
+	return c.JSON(http.StatusOK, policy)
+}
+
+// Rescreen screens all customers and suppliers of the company
+func (h *ScreeningHandler) Rescreen(c echo.Context) error {
+	companyID := c.Get("company_id").(uuid.UUID)
+	result, err := h.screeningService.RescreenAll(c.Request().Context(), companyID, "manual")
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to re-screen partners"})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// ListHits lists screening hits of the company
+func (h *ScreeningHandler) ListHits(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id":  c.Get("company_id").(uuid.UUID),
+		"status":      c.QueryParam("status"),
+		"party_type":  c.QueryParam("party_type"),
+		"list_source": c.QueryParam("list_source"),
+	}
+	if partyID := c.QueryParam("party_id"); partyID != "" {
+		id, err := uuid.Parse(partyID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid party ID"})
+		}
+		params["party_id"] = id
+	}
+
+	page := 1
+	pageSize := 20
+	if p := c.QueryParam("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+	if ps := c.QueryParam("page_size"); ps != "" {
+		if parsed, err := strconv.Atoi(ps); err == nil && parsed > 0 {
+			pageSize = parsed
+		}
+	}
+	params["page"] = page
+	params["page_size"] = pageSize
+
+	hits, total, err := h.screeningService.ListHits(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list screening hits"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": hits,
+		"pagination": map[string]interface{}{
+			"page":        page,
+			"page_size":   pageSize,
+			"total":       total,
+			"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+		},
+	})
+}
+
+// GetHit returns a screening hit
+func (h *ScreeningHandler) GetHit(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid hit ID"})
+	}
+
+	hit, err := h.screeningService.GetHit(c.Request().Context(), c.Get("company_id").(uuid.UUID), id)
+	if err != nil {
+		return h.hitError(c, err)
+	}
+	return c.JSON(http.StatusOK, hit)
+}
+
+// ClearHit marks a hit as a false positive, releasing the party
+func (h *ScreeningHandler) ClearHit(c echo.Context) error {
+	id, notes, err := bindHitReview(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	hit, err := h.screeningService.ClearHit(c.Request().Context(), c.Get("company_id").(uuid.UUID), id, getUserIDFromContext(c), notes)
+	if err != nil {
+		return h.hitError(c, err)
+	}
+	return c.JSON(http.StatusOK, hit)
+}
+
+// ConfirmHit marks a hit as a true match; the party stays blocked
+func (h *ScreeningHandler) ConfirmHit(c echo.Context) error {
+	id, notes, err := bindHitReview(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	hit, err := h.screeningService.ConfirmHit(c.Request().Context(), c.Get("company_id").(uuid.UUID), id, getUserIDFromContext(c), notes)
+	if err != nil {
+		return h.hitError(c, err)
+	}
+	return c.JSON(http.StatusOK, hit)
+}
+
+func bindHitReview(c echo.Context) (uuid.UUID, string, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, "", errors.New("Invalid hit ID")
+	}
+	var req struct {
+		Notes string `json:"notes"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return uuid.Nil, "", errors.New("Invalid request body")
+	}
+	return id, req.Notes, nil
+}
+
+func (h *ScreeningHandler) hitError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrScreeningHitNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrScreeningHitNotOpen):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrScreeningReviewNotes):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process screening hit"})
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/spc"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// SPCHandler handles quality characteristics, the capture of their
+// measurements and their control charts
+type SPCHandler struct {
+	spcService service.SPCService
+}
+
+// NewSPCHandler creates a new SPC handler
+func NewSPCHandler(spcService service.SPCService) *SPCHandler {
+	return &SPCHandler{
+		spcService: spcService,
+	}
+}
+
+// Characteristics
+
+// CreateCharacteristic creates a quality characteristic of a product
+func (h *SPCHandler) CreateCharacteristic(c echo.Context) error {
+	var characteristic models.QualityCharacteristic
+	if err := c.Bind(&characteristic); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	characteristic.ID = uuid.Nil
+	characteristic.CompanyID = c.Get("company_id").(uuid.UUID)
+	userID := getUserIDFromContext(c)
+	characteristic.CreatedBy = &userID
+
+	if err := h.spcService.CreateCharacteristic(c.Request().Context(), &characteristic); err != nil {
+		return h.spcError(c, err)
+	}
+	return c.JSON(http.StatusCreated, characteristic)
+}
+
+// ListCharacteristics lists quality characteristics; filter on
+// ?inventory_id, ?type and ?is_active
+func (h *SPCHandler) ListCharacteristics(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+		"type":       c.QueryParam("type"),
+	}
+	if inventoryID, err := uuid.Parse(c.QueryParam("inventory_id")); err == nil {
+		params["inventory_id"] = inventoryID
+	}
+	if isActive, err := strconv.ParseBool(c.QueryParam("is_active")); err == nil {
+		params["is_active"] = isActive
+	}
+	spcPageParams(c, params)
+
+	characteristics, total, err := h.spcService.ListCharacteristics(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list quality characteristics"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  characteristics,
+		"total": total,
+	})
+}
+
+// GetCharacteristic returns a quality characteristic
+func (h *SPCHandler) GetCharacteristic(c echo.Context) error {
+	characteristic, err := h.getCharacteristic(c)
+	if err != nil {
+		return h.spcError(c, err)
+	}
+	return c.JSON(http.StatusOK, characteristic)
+}
+
+// UpdateCharacteristic changes a quality characteristic
+func (h *SPCHandler) UpdateCharacteristic(c echo.Context) error {
+	characteristic, err := h.getCharacteristic(c)
+	if err != nil {
+		return h.spcError(c, err)
+	}
+	var req models.QualityCharacteristic
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	characteristic, err = h.spcService.UpdateCharacteristic(c.Request().Context(), characteristic.ID, &req)
+	if err != nil {
+		return h.spcError(c, err)
+	}
+	return c.JSON(http.StatusOK, characteristic)
+}
+
+// Measurements
+
+// RecordMeasurements captures one or more subgroups of measurements and
+// returns the charts they were checked against with any alerts raised
+func (h *SPCHandler) RecordMeasurements(c echo.Context) error {
+	characteristic, err := h.getCharacteristic(c)
+	if err != nil {
+		return h.spcError(c, err)
+	}
+	var req service.MeasurementRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	result, err := h.spcService.RecordMeasurements(c.Request().Context(), characteristic.ID, req, getUserIDFromContext(c))
+	if err != nil {
+		return h.spcError(c, err)
+	}
+	return c.JSON(http.StatusCreated, result)
+}
+
+// ListMeasurements lists the measurements of a characteristic; filter on
+// ?inspection_id, ?production_order_id, ?from, ?to (YYYY-MM-DD) and
+// ?subgroups (the last n)
+func (h *SPCHandler) ListMeasurements(c echo.Context) error {
+	characteristic, err := h.getCharacteristic(c)
+	if err != nil {
+		return h.spcError(c, err)
+	}
+	params, err := spcRangeParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if inspectionID, err := uuid.Parse(c.QueryParam("inspection_id")); err == nil {
+		params["inspection_id"] = inspectionID
+	}
+	if orderID, err := uuid.Parse(c.QueryParam("production_order_id")); err == nil {
+		params["production_order_id"] = orderID
+	}
+
+	measurements, err := h.spcService.ListMeasurements(c.Request().Context(), characteristic.ID, params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list measurements"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  measurements,
+		"total": len(measurements),
+	})
+}
+
+// Charts
+
+// GetSPC returns the control charts, rule violations and capability of a
+// characteristic over ?from and ?to (YYYY-MM-DD) or the last ?subgroups,
+// by default its chart window
+func (h *SPCHandler) GetSPC(c echo.Context) error {
+	characteristic, err := h.getCharacteristic(c)
+	if err != nil {
+		return h.spcError(c, err)
+	}
+	params, err := spcRangeParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	report, err := h.spcService.GetSPC(c.Request().Context(), characteristic.ID, params)
+	if err != nil {
+		return h.spcError(c, err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// ListAlerts lists out-of-control alerts, latest first; filter on
+// ?characteristic_id and ?rule
+func (h *SPCHandler) ListAlerts(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+	}
+	if characteristicID, err := uuid.Parse(c.QueryParam("characteristic_id")); err == nil {
+		params["characteristic_id"] = characteristicID
+	}
+	if rule, err := strconv.Atoi(c.QueryParam("rule")); err == nil {
+		params["rule"] = rule
+	}
+	spcPageParams(c, params)
+
+	alerts, total, err := h.spcService.ListAlerts(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list SPC alerts"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  alerts,
+		"total": total,
+	})
+}
+
+// getCharacteristic loads the characteristic in the path, hiding those of
+// other companies
+func (h *SPCHandler) getCharacteristic(c echo.Context) (*models.QualityCharacteristic, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrCharacteristicNotFound
+	}
+	characteristic, err := h.spcService.GetCharacteristic(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if characteristic.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrCharacteristicNotFound
+	}
+	return characteristic, nil
+}
+
+func (h *SPCHandler) spcError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrCharacteristicNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrCharacteristicInactive):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidCharacteristic), errors.Is(err, service.ErrInvalidMeasurements),
+		errors.Is(err, spc.ErrTooFewSubgroups), errors.Is(err, spc.ErrSubgroupSize):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process SPC request"})
+}
+
+// spcRangeParams reads ?from, ?to (inclusive, YYYY-MM-DD) and ?subgroups
+func spcRangeParams(c echo.Context) (map[string]interface{}, error) {
+	params := map[string]interface{}{}
+	if from := c.QueryParam("from"); from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return nil, errors.New("invalid from date")
+		}
+		params["from"] = t
+	}
+	if to := c.QueryParam("to"); to != "" {
+		t, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return nil, errors.New("invalid to date")
+		}
+		params["to"] = t.AddDate(0, 0, 1)
+	}
+	if subgroups, err := strconv.Atoi(c.QueryParam("subgroups")); err == nil && subgroups > 0 {
+		params["subgroups"] = subgroups
+	}
+	return params, nil
+}
+
+func spcPageParams(c echo.Context, params map[string]interface{}) {
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// SubcontractHandler handles subcontract orders shipping our own material
+// out for plating and heat treatment, and the stock kept at subcontractors
+type SubcontractHandler struct {
+	subcontractService service.SubcontractService
+}
+
+// NewSubcontractHandler creates a new subcontract handler
+func NewSubcontractHandler(subcontractService service.SubcontractService) *SubcontractHandler {
+	return &SubcontractHandler{
+		subcontractService: subcontractService,
+	}
+}
+
+// CreateOrder opens a subcontract order and its draft fee purchase order
+func (h *SubcontractHandler) CreateOrder(c echo.Context) error {
+	var req service.SubcontractOrderRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.CompanyID = c.Get("company_id").(uuid.UUID)
+
+	order, err := h.subcontractService.CreateOrder(c.Request().Context(), &req, getUserIDFromContext(c))
+	if err != nil {
+		return h.subcontractError(c, err)
+	}
+	return c.JSON(http.StatusCreated, order)
+}
+
+// ListOrders lists subcontract orders; filter on ?status, ?supplier_id,
+// ?production_order_id, ?process and ?open=true
+func (h *SubcontractHandler) ListOrders(c echo.Context) error {
+	params := map[string]interface{}{
+		"company_id": c.Get("company_id").(uuid.UUID),
+		"status":     c.QueryParam("status"),
+		"process":    c.QueryParam("process"),
+	}
+	if id, err := uuid.Parse(c.QueryParam("supplier_id")); err == nil {
+		params["supplier_id"] = id
+	}
+	if id, err := uuid.Parse(c.QueryParam("production_order_id")); err == nil {
+		params["production_order_id"] = id
+	}
+	if open, err := strconv.ParseBool(c.QueryParam("open")); err == nil {
+		params["open"] = open
+	}
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+
+	orders, total, err := h.subcontractService.ListOrders(c.Request().Context(), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list subcontract orders"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  orders,
+		"total": total,
+	})
+}
+
+// GetOrder returns a subcontract order with its shipments and receipts
+func (h *SubcontractHandler) GetOrder(c echo.Context) error {
+	order, err := h.getOrder(c)
+	if err != nil {
+		return h.subcontractError(c, err)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// Ship ships material to the subcontractor
+func (h *SubcontractHandler) Ship(c echo.Context) error {
+	var req service.SubcontractShipmentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	order, err := h.getOrder(c)
+	if err != nil {
+		return h.subcontractError(c, err)
+	}
+
+	order, err = h.subcontractService.Ship(c.Request().Context(), order.ID, &req, getUserIDFromContext(c))
+	if err != nil {
+		return h.subcontractError(c, err)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// Receive receives processed goods back from the subcontractor
+func (h *SubcontractHandler) Receive(c echo.Context) error {
+	var req service.SubcontractReceiptRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	order, err := h.getOrder(c)
+	if err != nil {
+		return h.subcontractError(c, err)
+	}
+
+	order, err = h.subcontractService.Receive(c.Request().Context(), order.ID, &req, getUserIDFromContext(c))
+	if err != nil {
+		return h.subcontractError(c, err)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// Cancel cancels a subcontract order nothing was shipped on
+func (h *SubcontractHandler) Cancel(c echo.Context) error {
+	order, err := h.getOrder(c)
+	if err != nil {
+		return h.subcontractError(c, err)
+	}
+
+	order, err = h.subcontractService.Cancel(c.Request().Context(), order.ID, getUserIDFromContext(c))
+	if err != nil {
+		return h.subcontractError(c, err)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// ListVendorStock returns our material at each subcontractor
+func (h *SubcontractHandler) ListVendorStock(c echo.Context) error {
+	stock, err := h.subcontractService.ListVendorStock(c.Request().Context(), c.Get("company_id").(uuid.UUID))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list stock at subcontractors"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  stock,
+		"total": len(stock),
+	})
+}
+
+// getOrder loads the subcontract order in the id path parameter, hiding
+// those of other companies
+func (h *SubcontractHandler) getOrder(c echo.Context) (*models.SubcontractOrder, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrSubcontractOrderNotFound
+	}
+	order, err := h.subcontractService.GetOrder(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if order.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrSubcontractOrderNotFound
+	}
+	return order, nil
+}
+
+func (h *SubcontractHandler) subcontractError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrSubcontractOrderNotFound), errors.Is(err, service.ErrSupplierNotFound),
+		errors.Is(err, service.ErrProductionOrderNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrSubcontractOrderClosed), errors.Is(err, service.ErrSubcontractShipped),
+		errors.Is(err, service.ErrSubcontractOrderChanged), errors.Is(err, service.ErrInsufficientStock):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidSubcontractOrder), errors.Is(err, service.ErrInvalidSubcontractFee),
+		errors.Is(err, service.ErrOperationNotSubcontracted), errors.Is(err, service.ErrSubcontractOverReceipt):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process subcontract request"})
+}
@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Purchase Requisition operations
+
+// CreateRequisition creates a purchase requisition
+func (h *SupplierHandler) CreateRequisition(c echo.Context) error {
+	var req service.CreateRequisitionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.CompanyID = c.Get("company_id").(uuid.UUID)
+
+	requisition, err := h.supplierService.CreateRequisition(&req, getUserIDFromContext(c))
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	return c.JSON(http.StatusCreated, requisition)
+}
+
+// ListRequisitions lists purchase requisitions; filter on ?status and
+// ?search
+func (h *SupplierHandler) ListRequisitions(c echo.Context) error {
+	params := map[string]interface{}{
+		"status": c.QueryParam("status"),
+		"search": c.QueryParam("search"),
+	}
+	rfqPageParams(c, params)
+
+	requisitions, total, err := h.supplierService.ListRequisitions(c.Get("company_id").(uuid.UUID), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list purchase requisitions"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  requisitions,
+		"total": total,
+	})
+}
+
+// GetRequisition returns a purchase requisition with its items
+func (h *SupplierHandler) GetRequisition(c echo.Context) error {
+	requisition, err := h.getRequisition(c)
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	return c.JSON(http.StatusOK, requisition)
+}
+
+// CreateRFQ creates a draft RFQ from a requisition's items, optionally
+// inviting suppliers
+func (h *SupplierHandler) CreateRFQ(c echo.Context) error {
+	requisition, err := h.getRequisition(c)
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	var req service.CreateRFQRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	rfq, err := h.supplierService.CreateRFQ(requisition.ID, &req, getUserIDFromContext(c))
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	return c.JSON(http.StatusCreated, rfq)
+}
+
+// RFQ operations
+
+// ListRFQs lists RFQs; filter on ?status, ?requisition_id, ?supplier_id
+// and ?search
+func (h *SupplierHandler) ListRFQs(c echo.Context) error {
+	params := map[string]interface{}{
+		"status": c.QueryParam("status"),
+		"search": c.QueryParam("search"),
+	}
+	for _, field := range []string{"requisition_id", "supplier_id"} {
+		if id, err := uuid.Parse(c.QueryParam(field)); err == nil {
+			params[field] = id
+		}
+	}
+	rfqPageParams(c, params)
+
+	rfqs, total, err := h.supplierService.ListRFQs(c.Get("company_id").(uuid.UUID), params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list RFQs"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  rfqs,
+		"total": total,
+	})
+}
+
+// GetRFQ returns an RFQ with its items and invitations
+func (h *SupplierHandler) GetRFQ(c echo.Context) error {
+	rfq, err := h.getRFQ(c)
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	return c.JSON(http.StatusOK, rfq)
+}
+
+// InviteSuppliers invites more suppliers to an RFQ
+func (h *SupplierHandler) InviteSuppliers(c echo.Context) error {
+	rfq, err := h.getRFQ(c)
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	var req service.InviteSuppliersRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.BidURL = rfqBidURL(c)
+
+	invitations, err := h.supplierService.InviteSuppliers(rfq.ID, &req)
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	return c.JSON(http.StatusCreated, invitations)
+}
+
+// SendRFQ opens an RFQ for bids and emails the invited suppliers
+func (h *SupplierHandler) SendRFQ(c echo.Context) error {
+	rfq, err := h.getRFQ(c)
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	rfq, err = h.supplierService.SendRFQ(rfq.ID, rfqBidURL(c))
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	return c.JSON(http.StatusOK, rfq)
+}
+
+// CompareBids returns the bid comparison matrix of an RFQ
+func (h *SupplierHandler) CompareBids(c echo.Context) error {
+	rfq, err := h.getRFQ(c)
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	comparison, err := h.supplierService.CompareBids(rfq.ID)
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	return c.JSON(http.StatusOK, comparison)
+}
+
+// AwardBid awards the bid in the body and returns the purchase order
+// created for it
+func (h *SupplierHandler) AwardBid(c echo.Context) error {
+	rfq, err := h.getRFQ(c)
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	var req struct {
+		BidID uuid.UUID `json:"bid_id"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	order, err := h.supplierService.AwardBid(rfq.ID, req.BidID, getUserIDFromContext(c))
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	return c.JSON(http.StatusCreated, order)
+}
+
+// Supplier-facing bid operations. The routes are public; the invitation
+// token in the path identifies the supplier and the RFQ.
+
+// GetBidderRFQ returns the RFQ and the supplier's bid so far
+func (h *SupplierHandler) GetBidderRFQ(c echo.Context) error {
+	view, err := h.supplierService.GetRFQForBidder(c.Param("token"))
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	return c.JSON(http.StatusOK, view)
+}
+
+// SubmitBid submits or replaces the supplier's bid
+func (h *SupplierHandler) SubmitBid(c echo.Context) error {
+	var req service.SubmitBidRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	bid, err := h.supplierService.SubmitBid(c.Param("token"), &req)
+	if err != nil {
+		return h.rfqError(c, err)
+	}
+	return c.JSON(http.StatusOK, bid)
+}
+
+// DeclineRFQ records that the supplier will not bid
+func (h *SupplierHandler) DeclineRFQ(c echo.Context) error {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if err := h.supplierService.DeclineRFQ(c.Param("token"), req.Reason); err != nil {
+		return h.rfqError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getRequisition loads the requisition in the path, hiding those of other
+// companies
+func (h *SupplierHandler) getRequisition(c echo.Context) (*models.PurchaseRequisition, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrRequisitionNotFound
+	}
+	requisition, err := h.supplierService.GetRequisition(id)
+	if err != nil {
+		return nil, err
+	}
+	if requisition.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrRequisitionNotFound
+	}
+	return requisition, nil
+}
+
+// getRFQ loads the RFQ in the path, hiding those of other companies
+func (h *SupplierHandler) getRFQ(c echo.Context) (*models.SupplierRFQ, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrRFQNotFound
+	}
+	rfq, err := h.supplierService.GetRFQ(id)
+	if err != nil {
+		return nil, err
+	}
+	if rfq.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrRFQNotFound
+	}
+	return rfq, nil
+}
+
+func (h *SupplierHandler) rfqError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrRequisitionNotFound), errors.Is(err, service.ErrRFQNotFound),
+		errors.Is(err, service.ErrBidNotFound), errors.Is(err, service.ErrSupplierNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrRequisitionClosed), errors.Is(err, service.ErrRFQClosed),
+		errors.Is(err, service.ErrBidNotAwardable):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRequisition), errors.Is(err, service.ErrInvalidBid),
+		errors.Is(err, service.ErrRFQNoSuppliers), errors.Is(err, service.ErrExchangeRateMissing):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process RFQ request"})
+}
+
+// rfqBidURL is the public bid endpoint invitation tokens are appended to
+func rfqBidURL(c echo.Context) string {
+	return fmt.Sprintf("%s://%s/api/v1/rfq-bids", c.Scheme(), c.Request().Host)
+}
+
+func rfqPageParams(c echo.Context, params map[string]interface{}) {
+	if page, err := strconv.Atoi(c.QueryParam("page")); err == nil {
+		params["page"] = page
+	}
+	if pageSize, err := strconv.Atoi(c.QueryParam("page_size")); err == nil {
+		params["page_size"] = pageSize
+	}
+}
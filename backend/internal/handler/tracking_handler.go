@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// TrackingHandler handles carrier integrations and tracking event ingestion
+type TrackingHandler struct {
+	trackingService service.TrackingService
+}
+
+// NewTrackingHandler creates a new tracking handler
+func NewTrackingHandler(trackingService service.TrackingService) *TrackingHandler {
+	return &TrackingHandler{
+		trackingService: trackingService,
+	}
+}
+
+// ListCarrierIntegrations lists the company's carrier integrations
+func (h *TrackingHandler) ListCarrierIntegrations(c echo.Context) error {
+	companyID := c.Get("company_id").(uuid.UUID)
+	integrations, err := h.trackingService.ListCarrierIntegrations(c.Request().Context(), companyID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list carrier integrations"})
+	}
+	return c.JSON(http.StatusOK, integrations)
+}
+
+// CreateCarrierIntegration creates a carrier integration
+func (h *TrackingHandler) CreateCarrierIntegration(c echo.Context) error {
+	var integration models.CarrierIntegration
+	if err := c.Bind(&integration); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	integration.ID = uuid.Nil
+	integration.CompanyID = c.Get("company_id").(uuid.UUID)
+	integration.CreatedBy = getUserIDFromContext(c)
+	integration.LastPolledAt = nil
+	integration.LastError = ""
+
+	if err := h.trackingService.CreateCarrierIntegration(c.Request().Context(), &integration); err != nil {
+		return h.integrationError(c, err)
+	}
+	return c.JSON(http.StatusCreated, integration)
+}
+
+// UpdateCarrierIntegration updates a carrier integration
+func (h *TrackingHandler) UpdateCarrierIntegration(c echo.Context) error {
+	existing, err := h.getIntegration(c)
+	if err != nil {
+		return h.integrationError(c, err)
+	}
+
+	var integration models.CarrierIntegration
+	if err := c.Bind(&integration); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	integration.ID = existing.ID
+	integration.CompanyID = existing.CompanyID
+	integration.CreatedAt = existing.CreatedAt
+	integration.CreatedBy = existing.CreatedBy
+	integration.LastPolledAt = existing.LastPolledAt
+	integration.LastError = existing.LastError
+
+	if err := h.trackingService.UpdateCarrierIntegration(c.Request().Context(), &integration); err != nil {
+		return h.integrationError(c, err)
+	}
+	return c.JSON(http.StatusOK, integration)
+}
+
+// DeleteCarrierIntegration deletes a carrier integration
+func (h *TrackingHandler) DeleteCarrierIntegration(c echo.Context) error {
+	integration, err := h.getIntegration(c)
+	if err != nil {
+		return h.integrationError(c, err)
+	}
+	if err := h.trackingService.DeleteCarrierIntegration(c.Request().Context(), integration.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete carrier integration"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getIntegration loads the integration in the path, hiding those of other companies
+func (h *TrackingHandler) getIntegration(c echo.Context) (*models.CarrierIntegration, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, service.ErrCarrierIntegrationNotFound
+	}
+	integration, err := h.trackingService.GetCarrierIntegration(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if integration.CompanyID != c.Get("company_id").(uuid.UUID) {
+		return nil, service.ErrCarrierIntegrationNotFound
+	}
+	return integration, nil
+}
+
+func (h *TrackingHandler) integrationError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrCarrierIntegrationNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidCarrierIntegration):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save carrier integration"})
+}
+
+// ImportEvents applies an uploaded carrier tracking file (JSON, CSV or IFTSTA)
+func (h *TrackingHandler) ImportEvents(c echo.Context) error {
+	carrier := c.FormValue("carrier_name")
+	if carrier == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "carrier_name is required"})
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No file provided"})
+	}
+	src, err := file.Open()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open file"})
+	}
+	defer src.Close()
+
+	result, err := h.trackingService.ImportEvents(c.Request().Context(), service.ImportTrackingEventsRequest{
+		CompanyID:   c.Get("company_id").(uuid.UUID),
+		CarrierName: carrier,
+		Format:      c.FormValue("format"),
+		Reader:      src,
+		UserID:      getUserIDFromContext(c),
+	})
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// PollShipment fetches the latest carrier events of a shipment
+func (h *TrackingHandler) PollShipment(c echo.Context) error {
+	shipmentID, err := uuid.Parse(c.Param("shipment_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid shipment ID"})
+	}
+
+	result, err := h.trackingService.PollShipment(c.Request().Context(), shipmentID, getUserIDFromContext(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrShipmentNotFound):
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case errors.Is(err, service.ErrShipmentNotTrackable), errors.Is(err, service.ErrCarrierNotPollable):
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, result)
+}
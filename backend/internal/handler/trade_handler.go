@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -13,13 +15,15 @@ import (
 
 // TradeHandler handles trade-related HTTP requests
 type TradeHandler struct {
-	tradeService service.TradeService
+	tradeService     service.TradeService
+	screeningService service.ScreeningService
 }
 
 // NewTradeHandler creates a new trade handler
-func NewTradeHandler(tradeService service.TradeService) *TradeHandler {
+func NewTradeHandler(tradeService service.TradeService, screeningService service.ScreeningService) *TradeHandler {
 	return &TradeHandler{
-		tradeService: tradeService,
+		tradeService:     tradeService,
+		screeningService: screeningService,
 	}
 }
 
@@ -296,6 +300,9 @@ func (h *TradeHandler) CreateShipment(c echo.Context) error {
 	shipment.CompanyID = c.Get("company_id").(uuid.UUID)
 
 	if err := h.tradeService.CreateShipment(c.Request().Context(), &shipment); err != nil {
+		if errors.Is(err, service.ErrPartyBlockedByScreening) || errors.Is(err, service.ErrCreditHold) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create shipment"})
 	}
 
@@ -339,6 +346,9 @@ func (h *TradeHandler) UpdateShipment(c echo.Context) error {
 		if err == service.ErrShipmentNotFound {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "Shipment not found"})
 		}
+		if errors.Is(err, service.ErrPartyBlockedByScreening) || errors.Is(err, service.ErrCreditHold) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update shipment"})
 	}
 
@@ -347,11 +357,19 @@ func (h *TradeHandler) UpdateShipment(c echo.Context) error {
 
 // GetTradeDocumentsByShipment gets documents for a shipment
 func (h *TradeHandler) GetTradeDocumentsByShipment(c echo.Context) error {
-	shipmentID := c.Param("id")
+	shipmentID, err := uuid.Parse(c.Param("shipment_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid shipment ID"})
+	}
 
 	params := map[string]interface{}{
-		"resource_type": "shipment",
-		"resource_id":   shipmentID,
+		"shipment_id": shipmentID,
+	}
+	if docType := c.QueryParam("document_type"); docType != "" {
+		params["document_type"] = docType
+	}
+	if status := c.QueryParam("status"); status != "" {
+		params["status"] = status
 	}
 
 	docs, err := h.tradeService.ListTradeDocuments(c.Request().Context(), params)
@@ -476,6 +494,9 @@ func (h *TradeHandler) GetLetterOfCredit(c echo.Context) error {
 
 	lc, err := h.tradeService.GetLetterOfCredit(c.Request().Context(), id)
 	if err != nil {
+		if err == service.ErrLetterOfCreditNotFound {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Letter of credit not found"})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get letter of credit"})
 	}
 
@@ -507,34 +528,196 @@ func (h *TradeHandler) GetExpiringLetterOfCredits(c echo.Context) error {
 
 // CreateLCUtilization creates a new LC utilization
 func (h *TradeHandler) CreateLCUtilization(c echo.Context) error {
-	lcID, err := uuid.Parse(c.Param("id"))
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid letter of credit ID"})
-	}
-
 	var util models.LCUtilization
 	if err := c.Bind(&util); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
 	}
+	if util.LCID == uuid.Nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "lc_id is required"})
+	}
 
-	util.LCID = lcID
 	util.CompanyID = c.Get("company_id").(uuid.UUID)
+	util.CreatedBy = getUserIDFromContext(c)
+
+	if err := h.tradeService.CreateLCUtilization(c.Request().Context(), &util); err != nil {
+		switch {
+		case errors.Is(err, service.ErrLetterOfCreditNotFound), errors.Is(err, service.ErrShipmentNotFound):
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case errors.Is(err, service.ErrLCNotUsable), errors.Is(err, service.ErrLCInsufficientAmount),
+			errors.Is(err, service.ErrLCShipmentDiscrepancy):
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create LC utilization"})
+	}
 
-	// TODO: Implement LC utilization in service
-	return c.JSON(http.StatusNotImplemented, map[string]string{"error": "Not implemented"})
+	return c.JSON(http.StatusCreated, util)
 }
 
 // GetLCUtilizations gets utilizations for a letter of credit
 func (h *TradeHandler) GetLCUtilizations(c echo.Context) error {
-	lcID := c.Param("id")
-	
-	// TODO: Implement LC utilization retrieval in service
-	return c.JSON(http.StatusNotImplemented, map[string]string{"error": "Not implemented", "lc_id": lcID})
+	lcID, err := uuid.Parse(c.Param("lc_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid letter of credit ID"})
+	}
+
+	utilizations, err := h.tradeService.ListLCUtilizations(c.Request().Context(), lcID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get LC utilizations"})
+	}
+
+	return c.JSON(http.StatusOK, utilizations)
+}
+
+// LC Amendments
+
+// ProposeLCAmendment registers an amendment issued by the bank, pending beneficiary response
+func (h *TradeHandler) ProposeLCAmendment(c echo.Context) error {
+	lcID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid letter of credit ID"})
+	}
+
+	var amendment models.LCAmendment
+	if err := c.Bind(&amendment); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	amendment.LCID = lcID
+	amendment.CreatedBy = getUserIDFromContext(c)
+
+	if err := h.tradeService.ProposeLCAmendment(c.Request().Context(), &amendment); err != nil {
+		switch err {
+		case service.ErrLetterOfCreditNotFound:
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Letter of credit not found"})
+		case service.ErrLCAmendmentEmpty, service.ErrLCAmountBelowUtilized:
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create LC amendment"})
+	}
+
+	return c.JSON(http.StatusCreated, amendment)
+}
+
+// ListLCAmendments lists the amendment history of a letter of credit
+func (h *TradeHandler) ListLCAmendments(c echo.Context) error {
+	lcID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid letter of credit ID"})
+	}
+
+	amendments, err := h.tradeService.ListLCAmendments(c.Request().Context(), lcID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list LC amendments"})
+	}
+
+	return c.JSON(http.StatusOK, amendments)
+}
+
+// AcceptLCAmendment accepts an amendment on behalf of the beneficiary
+func (h *TradeHandler) AcceptLCAmendment(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid amendment ID"})
+	}
+
+	amendment, err := h.tradeService.AcceptLCAmendment(c.Request().Context(), id, getUserIDFromContext(c))
+	if err != nil {
+		return h.lcAmendmentError(c, err, "Failed to accept LC amendment")
+	}
+
+	return c.JSON(http.StatusOK, amendment)
+}
+
+// RejectLCAmendment rejects an amendment on behalf of the beneficiary
+func (h *TradeHandler) RejectLCAmendment(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid amendment ID"})
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	amendment, err := h.tradeService.RejectLCAmendment(c.Request().Context(), id, getUserIDFromContext(c), req.Reason)
+	if err != nil {
+		return h.lcAmendmentError(c, err, "Failed to reject LC amendment")
+	}
+
+	return c.JSON(http.StatusOK, amendment)
+}
+
+// GetLCTerms returns the LC terms in force on the as_of date (default today)
+func (h *TradeHandler) GetLCTerms(c echo.Context) error {
+	lcID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid letter of credit ID"})
+	}
+
+	asOf := time.Now()
+	if d := c.QueryParam("as_of"); d != "" {
+		t, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid as_of date"})
+		}
+		// Include everything that happened during the requested day
+		asOf = t.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	terms, err := h.tradeService.GetLCTermsAsOf(c.Request().Context(), lcID, asOf)
+	if err != nil {
+		if err == service.ErrLetterOfCreditNotFound {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Letter of credit not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get LC terms"})
+	}
+
+	return c.JSON(http.StatusOK, terms)
+}
+
+// CheckShipmentAgainstLC lists discrepancies between a shipment and the accepted LC terms
+func (h *TradeHandler) CheckShipmentAgainstLC(c echo.Context) error {
+	lcID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid letter of credit ID"})
+	}
+	shipmentID, err := uuid.Parse(c.QueryParam("shipment_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid shipment ID"})
+	}
+
+	issues, err := h.tradeService.CheckShipmentAgainstLC(c.Request().Context(), lcID, shipmentID)
+	if err != nil {
+		switch err {
+		case service.ErrLetterOfCreditNotFound, service.ErrShipmentNotFound:
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check shipment"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"compliant":     len(issues) == 0,
+		"discrepancies": issues,
+	})
+}
+
+func (h *TradeHandler) lcAmendmentError(c echo.Context, err error, message string) error {
+	switch err {
+	case service.ErrLCAmendmentNotFound, service.ErrLetterOfCreditNotFound:
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case service.ErrLCAmendmentNotPending, service.ErrLCAmountBelowUtilized:
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": message})
 }
 
 // Compliance Management
 
-// RunComplianceCheck runs a compliance check
+// RunComplianceCheck screens a customer, supplier or shipment against the sanctions lists
+// and records the outcome as a compliance check
 func (h *TradeHandler) RunComplianceCheck(c echo.Context) error {
 	var req struct {
 		ResourceType string `json:"resource_type"`
@@ -545,22 +728,64 @@ func (h *TradeHandler) RunComplianceCheck(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
 	}
 
+	resourceID, err := uuid.Parse(req.ResourceID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid resource ID"})
+	}
+
+	ctx := c.Request().Context()
+	var hits []*models.ScreeningHit
+	switch req.ResourceType {
+	case service.ScreeningPartyCustomer:
+		hits, err = h.screeningService.ScreenCustomer(ctx, resourceID, "manual")
+	case service.ScreeningPartySupplier:
+		hits, err = h.screeningService.ScreenSupplier(ctx, resourceID, "manual")
+	case service.ScreeningPartyShipment:
+		var shipment *models.Shipment
+		shipment, err = h.tradeService.GetShipment(ctx, resourceID)
+		if err == nil {
+			hits, err = h.screeningService.ScreenShipment(ctx, shipment, "manual")
+		}
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "resource_type must be customer, supplier or shipment"})
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrCustomerNotFound), errors.Is(err, service.ErrSupplierNotFound), errors.Is(err, service.ErrShipmentNotFound):
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to run sanctions screening"})
+	}
+
+	status := "passed"
+	unresolved := 0
+	for _, hit := range hits {
+		if hit.Status != "cleared" {
+			unresolved++
+		}
+	}
+	if unresolved > 0 {
+		status = "failed"
+	}
+
 	checkResult := map[string]interface{}{
-		"status": "pending",
-		"message": "Compliance check initiated",
-		"company_id": c.Get("company_id").(uuid.UUID).String(),
+		"status":          status,
+		"message":         fmt.Sprintf("%d potential match(es), %d unresolved", len(hits), unresolved),
+		"company_id":      c.Get("company_id").(uuid.UUID).String(),
+		"hits":            hits,
+		"unresolved_hits": unresolved,
 	}
 	
 	check := &models.TradeComplianceCheck{
 		ResourceType: req.ResourceType,
 		ResourceID:   req.ResourceID,
-		CheckType:    "manual",
-		Status:       "pending",
+		CheckType:    "sanctions_screening",
+		Status:       status,
 		Result:       models.JSONB(checkResult),
 		CheckedAt:    time.Now(),
 	}
 
-	if err := h.tradeService.CreateComplianceCheck(c.Request().Context(), check); err != nil {
+	if err := h.tradeService.CreateComplianceCheck(ctx, check); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create compliance check"})
 	}
 
@@ -0,0 +1,250 @@
+package bankstatement
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openFixture(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseCAMT053(t *testing.T) {
+	statements, err := Parse(FormatCAMT053, openFixture(t, "camt053.xml"), nil)
+	require.NoError(t, err)
+	require.Len(t, statements, 1)
+
+	s := statements[0]
+	assert.Equal(t, "105", s.StatementNo)
+	assert.Equal(t, "DE89370400440532013000", s.Account)
+	assert.Equal(t, "EUR", s.Currency)
+	assert.Equal(t, date(2024, 5, 30), s.FromDate)
+	assert.Equal(t, date(2024, 5, 31), s.ToDate)
+	assert.True(t, s.HasBalances)
+	assert.Equal(t, 10000.0, s.OpeningBalance)
+	assert.Equal(t, 14725.50, s.ClosingBalance)
+
+	// The pending entry is skipped and the batch debit is split in two
+	require.Len(t, s.Lines, 4)
+
+	received := s.Lines[0]
+	assert.Equal(t, 5250.0, received.Amount)
+	assert.Equal(t, "E2E-7781", received.Reference)
+	assert.Equal(t, "BANKREF-0001", received.BankReference)
+	assert.Equal(t, "Weber Schrauben GmbH", received.CounterpartyName)
+	assert.Equal(t, "DE02120300000000202051", received.CounterpartyAccount)
+	assert.Contains(t, received.Description, "INV-202405-000123")
+
+	assert.Equal(t, -300.0, s.Lines[1].Amount)
+	assert.Empty(t, s.Lines[1].Reference)
+	assert.Equal(t, "Stahlwerk Nord AG", s.Lines[1].CounterpartyName)
+	assert.Equal(t, "PINV-202405-000045", s.Lines[1].Description)
+	assert.Equal(t, -200.0, s.Lines[2].Amount)
+	assert.Equal(t, "Galvano Süd GmbH", s.Lines[2].CounterpartyName)
+
+	assert.Equal(t, -24.50, s.Lines[3].Amount)
+	assert.Equal(t, "Account maintenance fee", s.Lines[3].Description)
+
+	var total float64
+	for _, l := range s.Lines {
+		total += l.Amount
+	}
+	assert.InDelta(t, s.ClosingBalance-s.OpeningBalance, total, 0.001)
+}
+
+func TestParseMT940(t *testing.T) {
+	statements, err := Parse(FormatMT940, openFixture(t, "mt940.txt"), nil)
+	require.NoError(t, err)
+	require.Len(t, statements, 1)
+
+	s := statements[0]
+	assert.Equal(t, "105/1", s.StatementNo)
+	assert.Equal(t, "12345678/0532013000", s.Account)
+	assert.Equal(t, "EUR", s.Currency)
+	assert.Equal(t, date(2024, 5, 30), s.FromDate)
+	assert.Equal(t, date(2024, 5, 31), s.ToDate)
+	assert.Equal(t, 10000.0, s.OpeningBalance)
+	assert.Equal(t, 14925.50, s.ClosingBalance)
+	require.Len(t, s.Lines, 3)
+
+	received := s.Lines[0]
+	assert.Equal(t, 5250.0, received.Amount)
+	assert.Equal(t, "EUR", received.Currency)
+	assert.Equal(t, date(2024, 5, 30), received.BookingDate)
+	assert.Equal(t, "E2E-7781", received.Reference)
+	assert.Equal(t, "BANKREF-0001", received.BankReference)
+	assert.Equal(t, "Weber Schrauben GmbH", received.CounterpartyName)
+	assert.Equal(t, "DE02120300000000202051", received.CounterpartyAccount)
+	assert.Equal(t, "Invoice INV-202405-000123", received.Description)
+
+	paid := s.Lines[1]
+	assert.Equal(t, -300.0, paid.Amount)
+	assert.Empty(t, paid.Reference)
+	assert.Equal(t, "Stahlwerk Nord AG", paid.CounterpartyName)
+	assert.Equal(t, "PINV-202405-000045", paid.Description)
+
+	assert.Equal(t, -24.50, s.Lines[2].Amount)
+	assert.Equal(t, "Account maintenance fee", s.Lines[2].Description)
+}
+
+func TestParseMT940BookingDateAcrossYearEnd(t *testing.T) {
+	line, err := parseMT940Line("2401021231D10,00NTRFNONREF")
+	require.NoError(t, err)
+	assert.Equal(t, date(2024, 1, 2), line.ValueDate)
+	assert.Equal(t, date(2023, 12, 31), line.BookingDate)
+	assert.Equal(t, -10.0, line.Amount)
+
+	line, err = parseMT940Line("240102RC10,00NTRFNONREF")
+	require.NoError(t, err)
+	assert.Equal(t, -10.0, line.Amount, "reversal of a credit takes money out")
+}
+
+func TestParseCSVDetectsColumns(t *testing.T) {
+	statements, err := Parse(FormatCSV, openFixture(t, "statement.csv"), nil)
+	require.NoError(t, err)
+	require.Len(t, statements, 1)
+
+	s := statements[0]
+	require.Len(t, s.Lines, 3)
+	assert.Equal(t, date(2024, 5, 30), s.FromDate)
+	assert.Equal(t, date(2024, 5, 31), s.ToDate)
+	assert.True(t, s.HasBalances)
+	assert.Equal(t, 10000.0, s.OpeningBalance)
+	assert.Equal(t, 14935.0, s.ClosingBalance)
+
+	received := s.Lines[0]
+	assert.Equal(t, 5250.0, received.Amount)
+	assert.Equal(t, "威博螺絲股份有限公司", received.CounterpartyName)
+	assert.Equal(t, "INV-202405-000123", received.Reference)
+	assert.Equal(t, "匯入匯款", received.Description)
+
+	assert.Equal(t, -300.0, s.Lines[1].Amount)
+	assert.Equal(t, -15.0, s.Lines[2].Amount)
+}
+
+func TestParseCSVWithMapping(t *testing.T) {
+	data := "Buchungstag;Betrag;Verwendungszweck;Auftraggeber\n" +
+		"31.05.2024;1.234,56;RE INV-202405-000130;Weber Schrauben GmbH\n" +
+		"30.05.2024;-20,00;Gebühren;\n"
+	statements, err := ParseCSV(strings.NewReader(data), &CSVMapping{
+		Date:         "Buchungstag",
+		Amount:       "Betrag",
+		Description:  "Verwendungszweck",
+		Counterparty: "Auftraggeber",
+		DateFormat:   "02.01.2006",
+		DecimalComma: true,
+	})
+	require.NoError(t, err)
+	require.Len(t, statements[0].Lines, 2)
+
+	// Newest-first files are put in date order
+	lines := statements[0].Lines
+	assert.Equal(t, -20.0, lines[0].Amount)
+	assert.Equal(t, 1234.56, lines[1].Amount)
+	assert.Equal(t, "Weber Schrauben GmbH", lines[1].CounterpartyName)
+	assert.False(t, statements[0].HasBalances)
+
+	_, err = ParseCSV(strings.NewReader("foo,bar\n1,2\n"), nil)
+	assert.ErrorIs(t, err, ErrCSVColumns)
+}
+
+func TestParseUnsupportedFormat(t *testing.T) {
+	_, err := Parse("bai2", strings.NewReader(""), nil)
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+var openInvoices = []Candidate{
+	{ID: "a", Kind: KindInvoice, Number: "INV-202405-000123", Partner: "Weber Schrauben GmbH", PartnerID: "weber", Amount: 5250, Currency: "EUR", Date: date(2024, 5, 2), Incoming: true},
+	{ID: "b", Kind: KindInvoice, Number: "INV-202405-000124", Partner: "Weber Schrauben GmbH", PartnerID: "weber", Amount: 1800, Currency: "EUR", Date: date(2024, 5, 6), Incoming: true},
+	{ID: "c", Kind: KindInvoice, Number: "INV-202405-000125", Partner: "Weber Schrauben GmbH", PartnerID: "weber", Amount: 700, Currency: "EUR", Date: date(2024, 5, 9), Incoming: true},
+	{ID: "d", Kind: KindInvoice, Number: "INV-202405-000126", Partner: "Müller Industrietechnik", PartnerID: "mueller", Amount: 5250, Currency: "EUR", Date: date(2024, 5, 9), Incoming: true},
+	{ID: "e", Kind: KindInvoice, Number: "PINV-202405-000045", Partner: "Stahlwerk Nord AG", PartnerID: "stahl", Amount: 300, Currency: "EUR", Date: date(2024, 5, 1), Incoming: false},
+}
+
+func TestSuggestByInvoiceNumber(t *testing.T) {
+	line := Line{Amount: 5250, Currency: "EUR", Description: "Invoice inv 202405/000123", CounterpartyName: "WEBER SCHRAUBEN GMBH"}
+	suggestions := Suggest(line, openInvoices, 5)
+	require.NotEmpty(t, suggestions)
+
+	best := suggestions[0]
+	require.Len(t, best.Allocations, 1)
+	assert.Equal(t, "a", best.Allocations[0].CandidateID)
+	assert.Equal(t, 5250.0, best.Allocations[0].Amount)
+	assert.True(t, best.Exact)
+	assert.True(t, best.AutoReconcilable())
+
+	// Same amount at another customer ranks lower and is not auto-reconciled
+	for _, s := range suggestions[1:] {
+		assert.Less(t, s.Score, best.Score)
+		if s.Allocations[0].CandidateID == "d" {
+			assert.False(t, s.AutoReconcilable())
+		}
+	}
+}
+
+func TestSuggestSplitByNamedInvoices(t *testing.T) {
+	line := Line{Amount: 2500, Currency: "EUR", Description: "INV-202405-000124 INV-202405-000125"}
+	suggestions := Suggest(line, openInvoices, 3)
+	require.NotEmpty(t, suggestions)
+
+	best := suggestions[0]
+	require.Len(t, best.Allocations, 2)
+	assert.Equal(t, "b", best.Allocations[0].CandidateID)
+	assert.Equal(t, 1800.0, best.Allocations[0].Amount)
+	assert.Equal(t, "c", best.Allocations[1].CandidateID)
+	assert.Equal(t, 700.0, best.Allocations[1].Amount)
+	assert.True(t, best.AutoReconcilable())
+}
+
+func TestSuggestSplitBySubsetOfPartnerInvoices(t *testing.T) {
+	line := Line{Amount: 2500, Currency: "EUR", CounterpartyName: "Weber Schrauben"}
+	suggestions := Suggest(line, openInvoices, 3)
+	require.NotEmpty(t, suggestions)
+
+	best := suggestions[0]
+	require.Len(t, best.Allocations, 2)
+	assert.ElementsMatch(t, []string{"b", "c"}, []string{best.Allocations[0].CandidateID, best.Allocations[1].CandidateID})
+	assert.True(t, best.Exact)
+	assert.False(t, best.AutoReconcilable(), "amount-only splits need review")
+}
+
+func TestSuggestPartialPayment(t *testing.T) {
+	line := Line{Amount: 2000, Currency: "EUR", Reference: "INV-202405-000123"}
+	suggestions := Suggest(line, openInvoices, 3)
+	require.NotEmpty(t, suggestions)
+
+	best := suggestions[0]
+	assert.Equal(t, "a", best.Allocations[0].CandidateID)
+	assert.Equal(t, 2000.0, best.Allocations[0].Amount)
+	assert.True(t, best.Exact)
+	assert.False(t, best.AutoReconcilable())
+}
+
+func TestSuggestRespectsDirectionAndCurrency(t *testing.T) {
+	line := Line{Amount: -300, Currency: "EUR", Description: "PINV-202405-000045"}
+	suggestions := Suggest(line, openInvoices, 3)
+	require.NotEmpty(t, suggestions)
+	assert.Equal(t, "e", suggestions[0].Allocations[0].CandidateID)
+
+	line.Currency = "USD"
+	assert.Empty(t, Suggest(line, openInvoices, 3))
+}
+
+func TestNameTokens(t *testing.T) {
+	assert.Equal(t, []string{"WEBER", "SCHRAUBEN"}, nameTokens("Weber Schrauben GmbH"))
+	assert.Equal(t, []string{"威博螺絲"}, nameTokens("威博螺絲股份有限公司"))
+	assert.Equal(t, []string{"ACME", "FASTENERS"}, nameTokens("The ACME Fasteners Co., Ltd."))
+}
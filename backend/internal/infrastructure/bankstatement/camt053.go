@@ -0,0 +1,253 @@
+package bankstatement
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// camtDocument covers the parts of camt.053.001.xx the importer reads. Tags
+// carry no namespace so every schema version matches.
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	ID           string        `xml:"Id"`
+	ElctrncSeqNb string        `xml:"ElctrncSeqNb"`
+	FromDate     string        `xml:"FrToDt>FrDtTm"`
+	ToDate       string        `xml:"FrToDt>ToDtTm"`
+	IBAN         string        `xml:"Acct>Id>IBAN"`
+	Other        string        `xml:"Acct>Id>Othr>Id"`
+	Currency     string        `xml:"Acct>Ccy"`
+	Balances     []camtBalance `xml:"Bal"`
+	Entries      []camtEntry   `xml:"Ntry"`
+}
+
+type camtBalance struct {
+	Code      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    camtAmount `xml:"Amt"`
+	Indicator string     `xml:"CdtDbtInd"`
+	Date      string     `xml:"Dt>Dt"`
+	DateTime  string     `xml:"Dt>DtTm"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtEntry struct {
+	Amount         camtAmount      `xml:"Amt"`
+	Indicator      string          `xml:"CdtDbtInd"`
+	Reversal       bool            `xml:"RvslInd"`
+	Status         camtStatus      `xml:"Sts"`
+	BookingDate    string          `xml:"BookgDt>Dt"`
+	BookingTime    string          `xml:"BookgDt>DtTm"`
+	ValueDate      string          `xml:"ValDt>Dt"`
+	ValueTime      string          `xml:"ValDt>DtTm"`
+	ServicerRef    string          `xml:"AcctSvcrRef"`
+	AdditionalInfo string          `xml:"AddtlNtryInf"`
+	Transactions   []camtTxDetails `xml:"NtryDtls>TxDtls"`
+}
+
+// camtStatus is a plain code up to version 08 and a Cd element from 09 on
+type camtStatus struct {
+	Value string `xml:",chardata"`
+	Code  string `xml:"Cd"`
+}
+
+type camtTxDetails struct {
+	Amount         camtAmount `xml:"Amt"`
+	TxAmount       camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+	Indicator      string     `xml:"CdtDbtInd"`
+	EndToEndID     string     `xml:"Refs>EndToEndId"`
+	ServicerRef    string     `xml:"Refs>AcctSvcrRef"`
+	DebtorName     string     `xml:"RltdPties>Dbtr>Nm"`
+	DebtorPtyName  string     `xml:"RltdPties>Dbtr>Pty>Nm"`
+	DebtorIBAN     string     `xml:"RltdPties>DbtrAcct>Id>IBAN"`
+	DebtorOther    string     `xml:"RltdPties>DbtrAcct>Id>Othr>Id"`
+	CreditorName   string     `xml:"RltdPties>Cdtr>Nm"`
+	CreditorPty    string     `xml:"RltdPties>Cdtr>Pty>Nm"`
+	CreditorIBAN   string     `xml:"RltdPties>CdtrAcct>Id>IBAN"`
+	CreditorOther  string     `xml:"RltdPties>CdtrAcct>Id>Othr>Id"`
+	Unstructured   []string   `xml:"RmtInf>Ustrd"`
+	CreditorRefs   []string   `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	DocumentNos    []string   `xml:"RmtInf>Strd>RfrdDocInf>Nb"`
+	AdditionalInfo string     `xml:"AddtlTxInf"`
+}
+
+// ParseCAMT053 reads an ISO 20022 bank-to-customer statement. Batch entries
+// with several transaction details become one line per transaction when the
+// details carry their own amounts.
+func ParseCAMT053(r io.Reader) ([]Statement, error) {
+	var doc camtDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid camt.053 document: %w", err)
+	}
+
+	var statements []Statement
+	for _, cs := range doc.Statements {
+		s := Statement{
+			StatementNo: firstNonEmpty(cs.ElctrncSeqNb, cs.ID),
+			Account:     firstNonEmpty(cs.IBAN, cs.Other),
+			Currency:    cs.Currency,
+			FromDate:    parseISODate(cs.FromDate),
+			ToDate:      parseISODate(cs.ToDate),
+		}
+
+		for _, b := range cs.Balances {
+			amount, err := camtSigned(b.Amount.Value, b.Indicator)
+			if err != nil {
+				return nil, err
+			}
+			if s.Currency == "" {
+				s.Currency = b.Amount.Currency
+			}
+			switch b.Code {
+			case "OPBD", "PRCD":
+				s.OpeningBalance = amount
+				s.HasBalances = true
+			case "CLBD":
+				s.ClosingBalance = amount
+				s.HasBalances = true
+			}
+		}
+
+		for _, e := range cs.Entries {
+			status := firstNonEmpty(e.Status.Code, e.Status.Value)
+			if status != "" && status != "BOOK" {
+				continue
+			}
+			lines, err := camtEntryLines(e, s.Currency)
+			if err != nil {
+				return nil, err
+			}
+			s.Lines = append(s.Lines, lines...)
+		}
+		statements = append(statements, s)
+	}
+	return statements, nil
+}
+
+func camtEntryLines(e camtEntry, currency string) ([]Line, error) {
+	indicator := e.Indicator
+	if e.Reversal {
+		// A reversal books the opposite way of its indicator
+		if indicator == "CRDT" {
+			indicator = "DBIT"
+		} else {
+			indicator = "CRDT"
+		}
+	}
+	amount, err := camtSigned(e.Amount.Value, indicator)
+	if err != nil {
+		return nil, err
+	}
+	base := Line{
+		BookingDate:   parseISODate(firstNonEmpty(e.BookingDate, e.BookingTime)),
+		ValueDate:     parseISODate(firstNonEmpty(e.ValueDate, e.ValueTime)),
+		Amount:        amount,
+		Currency:      firstNonEmpty(e.Amount.Currency, currency),
+		BankReference: e.ServicerRef,
+		Description:   e.AdditionalInfo,
+	}
+
+	split := len(e.Transactions) > 1
+	for _, tx := range e.Transactions {
+		if firstNonEmpty(tx.Amount.Value, tx.TxAmount.Value) == "" {
+			split = false
+		}
+	}
+	if !split {
+		line := base
+		if len(e.Transactions) == 1 {
+			applyCAMTDetails(&line, e.Transactions[0], amount > 0)
+		}
+		return []Line{line}, nil
+	}
+
+	lines := make([]Line, 0, len(e.Transactions))
+	for _, tx := range e.Transactions {
+		value := tx.Amount
+		if value.Value == "" {
+			value = tx.TxAmount
+		}
+		txIndicator := firstNonEmpty(tx.Indicator, indicator)
+		txAmount, err := camtSigned(value.Value, txIndicator)
+		if err != nil {
+			return nil, err
+		}
+		line := base
+		line.Amount = txAmount
+		line.Currency = firstNonEmpty(value.Currency, base.Currency)
+		applyCAMTDetails(&line, tx, txAmount > 0)
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// applyCAMTDetails copies references, remittance information and the
+// counterparty, which is the debtor of money received and the creditor of
+// money paid
+func applyCAMTDetails(line *Line, tx camtTxDetails, incoming bool) {
+	if tx.EndToEndID != "" && tx.EndToEndID != "NOTPROVIDED" {
+		line.Reference = tx.EndToEndID
+	}
+	if tx.ServicerRef != "" {
+		line.BankReference = tx.ServicerRef
+	}
+
+	var remittance []string
+	remittance = append(remittance, tx.CreditorRefs...)
+	remittance = append(remittance, tx.DocumentNos...)
+	remittance = append(remittance, tx.Unstructured...)
+	if tx.AdditionalInfo != "" {
+		remittance = append(remittance, tx.AdditionalInfo)
+	}
+	if len(remittance) > 0 {
+		line.Description = strings.Join(remittance, " ")
+	}
+
+	if incoming {
+		line.CounterpartyName = firstNonEmpty(tx.DebtorName, tx.DebtorPtyName)
+		line.CounterpartyAccount = firstNonEmpty(tx.DebtorIBAN, tx.DebtorOther)
+	} else {
+		line.CounterpartyName = firstNonEmpty(tx.CreditorName, tx.CreditorPty)
+		line.CounterpartyAccount = firstNonEmpty(tx.CreditorIBAN, tx.CreditorOther)
+	}
+}
+
+func camtSigned(value, indicator string) (float64, error) {
+	amount, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid camt.053 amount %q", value)
+	}
+	if indicator == "DBIT" {
+		amount = -amount
+	}
+	return round(amount), nil
+}
+
+// parseISODate reads an ISO date or date-time and keeps the calendar day
+func parseISODate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if len(value) >= 10 {
+		if t, err := time.Parse("2006-01-02", value[:10]); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,299 @@
+package bankstatement
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCSVColumns is returned when the date or amount columns of a CSV file
+// cannot be found
+var ErrCSVColumns = errors.New("csv statement needs a date column and an amount or credit/debit column")
+
+// CSVMapping names the columns of a bank's CSV export. Empty column names are
+// detected from the header row.
+type CSVMapping struct {
+	Date         string `json:"date"`
+	ValueDate    string `json:"value_date"`
+	Amount       string `json:"amount"` // signed amount
+	Credit       string `json:"credit"` // money received, when the bank uses two columns
+	Debit        string `json:"debit"`  // money paid out
+	Currency     string `json:"currency"`
+	Reference    string `json:"reference"`
+	Description  string `json:"description"`
+	Counterparty string `json:"counterparty"`
+	Account      string `json:"counterparty_account"`
+	Balance      string `json:"balance"`       // running balance after the line
+	DateFormat   string `json:"date_format"`   // Go layout, tried before the common layouts
+	Delimiter    string `json:"delimiter"`     // defaults to comma, or semicolon when the header uses it
+	DecimalComma bool   `json:"decimal_comma"` // amounts written as 1.234,56
+}
+
+// csvSynonyms lists header names used by common bank exports, including
+// Taiwanese banks
+var csvSynonyms = map[string][]string{
+	"date":                 {"date", "booking date", "transaction date", "posting date", "交易日期", "交易日", "記帳日"},
+	"value_date":           {"value date", "valuta", "起息日"},
+	"amount":               {"amount", "transaction amount", "金額", "交易金額"},
+	"credit":               {"credit", "deposit", "money in", "存入", "存入金額", "收入"},
+	"debit":                {"debit", "withdrawal", "money out", "支出", "支出金額", "提款"},
+	"currency":             {"currency", "ccy", "幣別"},
+	"reference":            {"reference", "ref", "end to end id", "參考號碼", "備註"},
+	"description":          {"description", "details", "narrative", "remittance", "memo", "摘要", "說明"},
+	"counterparty":         {"counterparty", "name", "payer", "payee", "beneficiary", "對方戶名", "戶名"},
+	"counterparty_account": {"counterparty account", "account", "iban", "對方帳號", "轉出入帳號"},
+	"balance":              {"balance", "running balance", "餘額"},
+}
+
+var csvDateLayouts = []string{
+	"2006-01-02", "2006/01/02", "2006.01.02", "20060102",
+	"02.01.2006", "02/01/2006", "01/02/2006", "2006-01-02 15:04:05", "2006/01/02 15:04:05",
+}
+
+// ParseCSV reads a CSV export as a single statement. The statement balances
+// come from a running-balance column when there is one.
+func ParseCSV(r io.Reader, mapping *CSVMapping) ([]Statement, error) {
+	m := CSVMapping{}
+	if mapping != nil {
+		m = *mapping
+	}
+
+	br := bufio.NewReader(r)
+	// Excel writes a byte order mark in front of UTF-8 exports
+	if bom, err := br.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		_, _ = br.Discard(3)
+	}
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if m.Delimiter != "" {
+		reader.Comma = []rune(m.Delimiter)[0]
+	} else {
+		head, _ := br.Peek(4096)
+		header, _, _ := strings.Cut(string(head), "\n")
+		if strings.Count(header, ";") > strings.Count(header, ",") {
+			reader.Comma = ';'
+		}
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv statement: %w", err)
+	}
+	if len(records) < 2 {
+		return nil, ErrNoStatements
+	}
+
+	columns := csvColumns(records[0], m)
+	if columns["date"] < 0 || (columns["amount"] < 0 && columns["credit"] < 0 && columns["debit"] < 0) {
+		return nil, ErrCSVColumns
+	}
+
+	s := Statement{}
+	var firstBalance, lastBalance *float64
+	for i, record := range records[1:] {
+		if csvBlank(record) {
+			continue
+		}
+		date, err := parseCSVDate(csvValue(record, columns["date"]), m.DateFormat)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+2, err)
+		}
+
+		var amount float64
+		if columns["amount"] >= 0 {
+			if amount, err = parseCSVAmount(csvValue(record, columns["amount"]), m.DecimalComma); err != nil {
+				return nil, fmt.Errorf("row %d: %w", i+2, err)
+			}
+		} else {
+			credit, err := parseCSVAmount(csvValue(record, columns["credit"]), m.DecimalComma)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", i+2, err)
+			}
+			debit, err := parseCSVAmount(csvValue(record, columns["debit"]), m.DecimalComma)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", i+2, err)
+			}
+			// Some banks print debits as negative numbers in the debit column
+			if debit < 0 {
+				debit = -debit
+			}
+			amount = round(credit - debit)
+		}
+		if amount == 0 {
+			continue
+		}
+
+		line := Line{
+			BookingDate:         date,
+			ValueDate:           date,
+			Amount:              amount,
+			Currency:            csvValue(record, columns["currency"]),
+			Reference:           csvValue(record, columns["reference"]),
+			Description:         csvValue(record, columns["description"]),
+			CounterpartyName:    csvValue(record, columns["counterparty"]),
+			CounterpartyAccount: csvValue(record, columns["counterparty_account"]),
+		}
+		if v := csvValue(record, columns["value_date"]); v != "" {
+			if valueDate, err := parseCSVDate(v, m.DateFormat); err == nil {
+				line.ValueDate = valueDate
+			}
+		}
+		if s.Currency == "" {
+			s.Currency = line.Currency
+		}
+		if v := csvValue(record, columns["balance"]); v != "" {
+			if balance, err := parseCSVAmount(v, m.DecimalComma); err == nil {
+				if firstBalance == nil {
+					opening := round(balance - amount)
+					firstBalance = &opening
+				}
+				lastBalance = &balance
+			}
+		}
+		s.Lines = append(s.Lines, line)
+	}
+
+	// Banks list newest first as often as oldest first; a running balance
+	// is only trusted when the file is in date order
+	if len(s.Lines) > 1 && s.Lines[0].BookingDate.After(s.Lines[len(s.Lines)-1].BookingDate) {
+		for i, j := 0, len(s.Lines)-1; i < j; i, j = i+1, j-1 {
+			s.Lines[i], s.Lines[j] = s.Lines[j], s.Lines[i]
+		}
+		firstBalance, lastBalance = nil, nil
+	}
+	if firstBalance != nil && lastBalance != nil {
+		s.OpeningBalance = *firstBalance
+		s.ClosingBalance = *lastBalance
+		s.HasBalances = true
+	}
+	return []Statement{s}, nil
+}
+
+// csvColumns resolves each field to a column index, -1 when absent
+func csvColumns(header []string, m CSVMapping) map[string]int {
+	configured := map[string]string{
+		"date":                 m.Date,
+		"value_date":           m.ValueDate,
+		"amount":               m.Amount,
+		"credit":               m.Credit,
+		"debit":                m.Debit,
+		"currency":             m.Currency,
+		"reference":            m.Reference,
+		"description":          m.Description,
+		"counterparty":         m.Counterparty,
+		"counterparty_account": m.Account,
+		"balance":              m.Balance,
+	}
+
+	normalized := make([]string, len(header))
+	for i, h := range header {
+		normalized[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+	}
+	find := func(name string) int {
+		for i, h := range normalized {
+			if h == strings.ToLower(strings.TrimSpace(name)) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	columns := make(map[string]int, len(configured))
+	used := make(map[int]bool)
+	for field, name := range configured {
+		columns[field] = -1
+		if name != "" {
+			if i := find(name); i >= 0 {
+				columns[field] = i
+				used[i] = true
+			}
+		}
+	}
+	// Detect the rest in a fixed order so "amount" wins over the looser
+	// synonyms of other fields
+	for _, field := range []string{"date", "value_date", "amount", "credit", "debit", "currency", "balance", "reference", "description", "counterparty_account", "counterparty"} {
+		if columns[field] >= 0 || configured[field] != "" {
+			continue
+		}
+		for _, synonym := range csvSynonyms[field] {
+			if i := find(synonym); i >= 0 && !used[i] {
+				columns[field] = i
+				used[i] = true
+				break
+			}
+		}
+	}
+	return columns
+}
+
+func csvValue(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func csvBlank(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func parseCSVDate(value, layout string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	layouts := csvDateLayouts
+	if layout != "" {
+		layouts = append([]string{layout}, layouts...)
+	}
+	for _, l := range layouts {
+		if t, err := time.Parse(l, value); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	// ROC calendar dates such as 113/05/02 used by Taiwanese banks
+	if parts := strings.Split(value, "/"); len(parts) == 3 && len(parts[0]) <= 3 {
+		year, errY := strconv.Atoi(parts[0])
+		month, errM := strconv.Atoi(parts[1])
+		day, errD := strconv.Atoi(parts[2])
+		if errY == nil && errM == nil && errD == nil && month >= 1 && month <= 12 && day >= 1 && day <= 31 {
+			return time.Date(year+1911, time.Month(month), day, 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+func parseCSVAmount(value string, decimalComma bool) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "-" {
+		return 0, nil
+	}
+	negative := false
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = strings.Trim(value, "()")
+	}
+	value = strings.NewReplacer(" ", "", "$", "", "NT", "", " ", "").Replace(value)
+	if decimalComma {
+		value = strings.ReplaceAll(value, ".", "")
+		value = strings.Replace(value, ",", ".", 1)
+	} else {
+		value = strings.ReplaceAll(value, ",", "")
+	}
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if negative {
+		amount = -amount
+	}
+	return round(amount), nil
+}
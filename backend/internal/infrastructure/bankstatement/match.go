@@ -0,0 +1,328 @@
+package bankstatement
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Candidate kinds
+const (
+	KindInvoice = "invoice"
+	KindPayment = "payment"
+)
+
+// AutoReconcileScore is the score from which a suggestion that covers the
+// line amount exactly may be reconciled without review
+const AutoReconcileScore = 0.8
+
+// maxSplitInvoices caps the number of invoices combined to explain one line
+const maxSplitInvoices = 4
+
+// Candidate is an open item a statement line may settle. Amount is the open
+// amount, positive, in the candidate's currency.
+type Candidate struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Number    string    `json:"number"`
+	Reference string    `json:"reference,omitempty"`
+	Partner   string    `json:"partner,omitempty"`
+	PartnerID string    `json:"partner_id,omitempty"`
+	Amount    float64   `json:"amount"`
+	Currency  string    `json:"currency"`
+	Date      time.Time `json:"date"`
+	Incoming  bool      `json:"incoming"` // money expected in: sales invoices and incoming payments
+}
+
+// Allocation is the part of a line assigned to one candidate
+type Allocation struct {
+	CandidateID string  `json:"candidate_id"`
+	Kind        string  `json:"kind"`
+	Number      string  `json:"number"`
+	Amount      float64 `json:"amount"`
+}
+
+// Suggestion proposes how a line settles one or more candidates
+type Suggestion struct {
+	Allocations []Allocation `json:"allocations"`
+	Score       float64      `json:"score"`
+	Reasons     []string     `json:"reasons"`
+	Exact       bool         `json:"exact"` // allocations add up to the line amount
+}
+
+// AutoReconcilable reports whether the suggestion is safe to apply without
+// review
+func (s Suggestion) AutoReconcilable() bool {
+	return s.Exact && s.Score >= AutoReconcileScore
+}
+
+// Suggest ranks the candidates a line may settle. Candidates are scored on
+// amount, invoice number and reference found in the remittance text, and
+// counterparty name. Several invoices named in the text, or of the same
+// partner summing up to the line amount, are suggested as a split payment.
+func Suggest(line Line, candidates []Candidate, limit int) []Suggestion {
+	amount := math.Abs(line.Amount)
+	incoming := line.Amount > 0
+	text := normalize(line.Text())
+	lineTokens := nameTokens(line.CounterpartyName)
+
+	type scored struct {
+		candidate Candidate
+		score     float64
+		reasons   []string
+		named     bool
+		partner   bool
+	}
+
+	var pool []scored
+	for _, c := range candidates {
+		if c.Incoming != incoming || c.Amount <= 0 {
+			continue
+		}
+		if line.Currency != "" && c.Currency != "" && !strings.EqualFold(line.Currency, c.Currency) {
+			continue
+		}
+		s := scored{candidate: c}
+		if sameAmount(c.Amount, amount) {
+			s.score += 0.4
+			s.reasons = append(s.reasons, "amount matches")
+		}
+		if n := normalize(c.Number); len(n) >= 4 && strings.Contains(text, n) {
+			s.score += 0.4
+			s.named = true
+			s.reasons = append(s.reasons, "number "+c.Number+" in remittance")
+		}
+		if r := normalize(c.Reference); len(r) >= 4 && r != normalize(c.Number) && strings.Contains(text, r) {
+			s.score += 0.4
+			s.named = true
+			s.reasons = append(s.reasons, "reference "+c.Reference+" in remittance")
+		}
+		if overlap := tokenOverlap(lineTokens, nameTokens(c.Partner)); overlap > 0 {
+			s.score += 0.2 * overlap
+			s.partner = overlap >= 0.5
+			s.reasons = append(s.reasons, "counterparty name matches "+c.Partner)
+		}
+		if s.score > 0 {
+			pool = append(pool, s)
+		}
+	}
+
+	var suggestions []Suggestion
+	for _, s := range pool {
+		allocated := math.Min(s.candidate.Amount, amount)
+		suggestions = append(suggestions, Suggestion{
+			Allocations: []Allocation{{CandidateID: s.candidate.ID, Kind: s.candidate.Kind, Number: s.candidate.Number, Amount: round(allocated)}},
+			Score:       math.Min(round(s.score), 1),
+			Reasons:     s.reasons,
+			Exact:       sameAmount(allocated, amount),
+		})
+	}
+
+	// Split payment: invoices named in the remittance text
+	var named []Candidate
+	var namedReasons []string
+	for _, s := range pool {
+		if s.named && s.candidate.Kind == KindInvoice {
+			named = append(named, s.candidate)
+			namedReasons = append(namedReasons, s.reasons...)
+		}
+	}
+	if len(named) > 1 {
+		if split, ok := splitSuggestion(named, amount, 0.9, namedReasons); ok {
+			suggestions = append(suggestions, split)
+		}
+	}
+
+	// Split payment: a subset of one partner's open invoices sums up to the
+	// line amount. Scored below the auto-reconcile threshold since nothing
+	// but the amounts ties the invoices to the line.
+	byPartner := make(map[string][]Candidate)
+	for _, s := range pool {
+		if s.partner && s.candidate.Kind == KindInvoice && s.candidate.PartnerID != "" {
+			byPartner[s.candidate.PartnerID] = append(byPartner[s.candidate.PartnerID], s.candidate)
+		}
+	}
+	for _, group := range byPartner {
+		if len(group) < 2 || hasExact(group, amount) {
+			continue
+		}
+		if subset := subsetSum(group, amount); len(subset) > 1 {
+			if split, ok := splitSuggestion(subset, amount, 0.6, []string{"open invoices of " + subset[0].Partner + " add up to the amount"}); ok {
+				suggestions = append(suggestions, split)
+			}
+		}
+	}
+
+	suggestions = dedupe(suggestions)
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		if suggestions[i].Exact != suggestions[j].Exact {
+			return suggestions[i].Exact
+		}
+		return len(suggestions[i].Allocations) < len(suggestions[j].Allocations)
+	})
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// splitSuggestion allocates the amount over the candidates oldest first and
+// scores it at base, raised by 0.1 when their open amounts add up exactly
+func splitSuggestion(candidates []Candidate, amount, base float64, reasons []string) (Suggestion, bool) {
+	sorted := append([]Candidate(nil), candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	remaining := amount
+	var allocations []Allocation
+	var total float64
+	for _, c := range sorted {
+		if remaining <= 0.005 {
+			break
+		}
+		a := round(math.Min(c.Amount, remaining))
+		allocations = append(allocations, Allocation{CandidateID: c.ID, Kind: c.Kind, Number: c.Number, Amount: a})
+		remaining = round(remaining - a)
+		total += c.Amount
+	}
+	if len(allocations) < 2 {
+		return Suggestion{}, false
+	}
+
+	score := base
+	if sameAmount(total, amount) {
+		score = math.Min(base+0.1, 1)
+	}
+	return Suggestion{
+		Allocations: allocations,
+		Score:       score,
+		Reasons:     append([]string{"split over several invoices"}, reasons...),
+		Exact:       remaining <= 0.005,
+	}, true
+}
+
+// subsetSum finds the smallest set of up to maxSplitInvoices candidates
+// whose open amounts add up to the target
+func subsetSum(candidates []Candidate, target float64) []Candidate {
+	if len(candidates) > 12 {
+		// Keep the search small; older invoices are paid first
+		sorted := append([]Candidate(nil), candidates...)
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+		candidates = sorted[:12]
+	}
+	var best []Candidate
+	var walk func(start int, chosen []Candidate, sum float64)
+	walk = func(start int, chosen []Candidate, sum float64) {
+		if best != nil && len(chosen) >= len(best) {
+			return
+		}
+		if len(chosen) > 1 && sameAmount(sum, target) {
+			best = append([]Candidate(nil), chosen...)
+			return
+		}
+		if len(chosen) == maxSplitInvoices || sum > target+0.005 {
+			return
+		}
+		for i := start; i < len(candidates); i++ {
+			walk(i+1, append(chosen, candidates[i]), sum+candidates[i].Amount)
+		}
+	}
+	walk(0, nil, 0)
+	return best
+}
+
+func dedupe(suggestions []Suggestion) []Suggestion {
+	seen := make(map[string]bool)
+	var out []Suggestion
+	for _, s := range suggestions {
+		ids := make([]string, len(s.Allocations))
+		for i, a := range s.Allocations {
+			ids[i] = a.CandidateID
+		}
+		sort.Strings(ids)
+		key := strings.Join(ids, ",")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, s)
+	}
+	return out
+}
+
+func hasExact(candidates []Candidate, amount float64) bool {
+	for _, c := range candidates {
+		if sameAmount(c.Amount, amount) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameAmount(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
+
+// normalize keeps letters and digits in upper case so "INV-2024/001" and
+// "inv2024001" compare equal
+func normalize(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+// corporateSuffixes are left out of name matching
+var corporateSuffixes = map[string]bool{
+	"CO": true, "LTD": true, "INC": true, "CORP": true, "CORPORATION": true, "LLC": true, "GMBH": true,
+	"AG": true, "BV": true, "SA": true, "SRL": true, "PLC": true, "LIMITED": true, "COMPANY": true, "THE": true,
+}
+
+// cjkSuffixes are written without a space, longest first
+var cjkSuffixes = []string{"股份有限公司", "有限公司", "公司"}
+
+func nameTokens(name string) []string {
+	fields := strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var tokens []string
+	for _, f := range fields {
+		for _, suffix := range cjkSuffixes {
+			if strings.HasSuffix(f, suffix) {
+				f = strings.TrimSuffix(f, suffix)
+				break
+			}
+		}
+		if corporateSuffixes[f] || len([]rune(f)) < 2 {
+			continue
+		}
+		tokens = append(tokens, f)
+	}
+	return tokens
+}
+
+// tokenOverlap is the share of the candidate's name tokens found in the
+// line's counterparty name
+func tokenOverlap(line, candidate []string) float64 {
+	if len(line) == 0 || len(candidate) == 0 {
+		return 0
+	}
+	set := make(map[string]bool, len(line))
+	for _, t := range line {
+		set[t] = true
+	}
+	var hits int
+	for _, t := range candidate {
+		if set[t] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(candidate))
+}
@@ -0,0 +1,262 @@
+package bankstatement
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mt940Line matches the :61: statement line: value date, optional booking
+// date, debit/credit mark, funds code, amount, transaction type and references
+var mt940Line = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+,\d*)([A-Z0-9]{4})?([^/]*)(?://(.*))?$`)
+
+// mt940Balance matches the :60F:, :60M:, :62F: and :62M: balances
+var mt940Balance = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})(\d+,\d*)$`)
+
+// ParseMT940 reads a SWIFT MT940 customer statement. Several statements may
+// follow each other in one file.
+func ParseMT940(r io.Reader) ([]Statement, error) {
+	fields, err := mt940Fields(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []Statement
+	var current *Statement
+	var line *Line
+	flushLine := func() {
+		if current != nil && line != nil {
+			current.Lines = append(current.Lines, *line)
+		}
+		line = nil
+	}
+	flush := func() {
+		flushLine()
+		if current != nil {
+			statements = append(statements, *current)
+		}
+		current = nil
+	}
+
+	for _, f := range fields {
+		switch f.tag {
+		case "20":
+			flush()
+			current = &Statement{}
+		case "25":
+			if current == nil {
+				current = &Statement{}
+			}
+			current.Account = strings.TrimSpace(f.value)
+		case "28C":
+			if current != nil {
+				current.StatementNo = strings.TrimSpace(f.value)
+			}
+		case "60F", "60M":
+			if current == nil {
+				current = &Statement{}
+			}
+			amount, currency, date, err := parseMT940Balance(f.value)
+			if err != nil {
+				return nil, err
+			}
+			current.OpeningBalance = amount
+			current.Currency = currency
+			current.HasBalances = true
+			if current.FromDate.IsZero() {
+				current.FromDate = date
+			}
+		case "61":
+			if current == nil {
+				return nil, fmt.Errorf("invalid mt940 statement: :61: before :20:")
+			}
+			flushLine()
+			parsed, err := parseMT940Line(f.value)
+			if err != nil {
+				return nil, err
+			}
+			parsed.Currency = current.Currency
+			line = &parsed
+		case "86":
+			if line != nil {
+				applyMT940Details(line, f.value)
+			}
+		case "62F", "62M":
+			if current == nil {
+				continue
+			}
+			flushLine()
+			amount, _, date, err := parseMT940Balance(f.value)
+			if err != nil {
+				return nil, err
+			}
+			current.ClosingBalance = amount
+			current.ToDate = date
+		}
+	}
+	flush()
+	return statements, nil
+}
+
+type mt940Field struct {
+	tag   string
+	value string
+}
+
+// mt940Fields splits the message into tagged fields, joining continuation
+// lines and skipping SWIFT block headers and trailers
+func mt940Fields(r io.Reader) ([]mt940Field, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var fields []mt940Field
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), "\r ")
+		if text == "" || text == "-" || strings.HasPrefix(text, "-}") || strings.HasPrefix(text, "{") && !strings.Contains(text, "{4:") {
+			continue
+		}
+		if i := strings.Index(text, "{4:"); i >= 0 {
+			text = text[i+3:]
+			if text == "" {
+				continue
+			}
+		}
+		if strings.HasPrefix(text, ":") {
+			if end := strings.Index(text[1:], ":"); end > 0 {
+				fields = append(fields, mt940Field{tag: text[1 : end+1], value: text[end+2:]})
+				continue
+			}
+		}
+		if len(fields) > 0 {
+			fields[len(fields)-1].value += "\n" + text
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func parseMT940Balance(value string) (float64, string, time.Time, error) {
+	m := mt940Balance.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, "", time.Time{}, fmt.Errorf("invalid mt940 balance %q", value)
+	}
+	date, err := time.Parse("060102", m[2])
+	if err != nil {
+		return 0, "", time.Time{}, fmt.Errorf("invalid mt940 balance date %q", m[2])
+	}
+	amount, err := parseCommaAmount(m[4])
+	if err != nil {
+		return 0, "", time.Time{}, err
+	}
+	if m[1] == "D" {
+		amount = -amount
+	}
+	return amount, m[3], date, nil
+}
+
+func parseMT940Line(value string) (Line, error) {
+	first, rest, _ := strings.Cut(value, "\n")
+	m := mt940Line.FindStringSubmatch(strings.TrimSpace(first))
+	if m == nil {
+		return Line{}, fmt.Errorf("invalid mt940 statement line %q", first)
+	}
+	valueDate, err := time.Parse("060102", m[1])
+	if err != nil {
+		return Line{}, fmt.Errorf("invalid mt940 value date %q", m[1])
+	}
+	bookingDate := valueDate
+	if m[2] != "" {
+		// The booking date has no year; take the one closest to the value date
+		month, _ := strconv.Atoi(m[2][:2])
+		day, _ := strconv.Atoi(m[2][2:])
+		bookingDate = time.Date(valueDate.Year(), time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		if bookingDate.Sub(valueDate) > 180*24*time.Hour {
+			bookingDate = bookingDate.AddDate(-1, 0, 0)
+		} else if valueDate.Sub(bookingDate) > 180*24*time.Hour {
+			bookingDate = bookingDate.AddDate(1, 0, 0)
+		}
+	}
+
+	amount, err := parseCommaAmount(m[5])
+	if err != nil {
+		return Line{}, err
+	}
+	// D and RC (reversal of credit) take money out of the account
+	if m[3] == "D" || m[3] == "RC" {
+		amount = -amount
+	}
+
+	line := Line{
+		BookingDate:   bookingDate,
+		ValueDate:     valueDate,
+		Amount:        amount,
+		BankReference: strings.TrimSpace(m[8]),
+		Description:   strings.TrimSpace(rest),
+	}
+	if ref := strings.TrimSpace(m[7]); ref != "NONREF" {
+		line.Reference = ref
+	}
+	return line, nil
+}
+
+// applyMT940Details reads the :86: information, either structured with ?NN
+// subfields (German banks), with /CODE/ keywords or as free text
+func applyMT940Details(line *Line, value string) {
+	value = strings.ReplaceAll(value, "\n", "")
+	switch {
+	case strings.Contains(value, "?"):
+		var remittance, name []string
+		for _, part := range strings.Split(value, "?")[1:] {
+			if len(part) < 2 {
+				continue
+			}
+			code, text := part[:2], strings.TrimSpace(part[2:])
+			switch {
+			case code >= "20" && code <= "29", code >= "60" && code <= "63":
+				remittance = append(remittance, text)
+			case code == "31":
+				line.CounterpartyAccount = text
+			case code == "32" || code == "33":
+				name = append(name, text)
+			}
+		}
+		line.Description = strings.Join(remittance, "")
+		line.CounterpartyName = strings.Join(name, "")
+	case strings.HasPrefix(value, "/"):
+		parts := strings.Split(value, "/")
+		var description []string
+		for i := 1; i+1 < len(parts); i += 2 {
+			key, text := parts[i], strings.TrimSpace(parts[i+1])
+			switch key {
+			case "NAME":
+				line.CounterpartyName = text
+			case "IBAN", "ACCW":
+				line.CounterpartyAccount = text
+			case "REMI", "EREF", "TXT", "INV":
+				if key == "EREF" && line.Reference == "" {
+					line.Reference = text
+				}
+				description = append(description, text)
+			}
+		}
+		if len(description) > 0 {
+			line.Description = strings.Join(description, " ")
+		}
+	default:
+		line.Description = strings.TrimSpace(value)
+	}
+}
+
+func parseCommaAmount(value string) (float64, error) {
+	amount, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mt940 amount %q", value)
+	}
+	return round(amount), nil
+}
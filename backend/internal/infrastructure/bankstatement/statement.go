@@ -0,0 +1,111 @@
+// Package bankstatement parses bank statements in ISO 20022 CAMT.053, SWIFT
+// MT940 and CSV formats and matches their lines against open items.
+//
+// Line amounts are signed from the account holder's view: positive for money
+// received, negative for money paid out.
+package bankstatement
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Supported statement formats
+const (
+	FormatCAMT053 = "camt053"
+	FormatMT940   = "mt940"
+	FormatCSV     = "csv"
+)
+
+// Errors returned by the parsers
+var (
+	ErrUnsupportedFormat = errors.New("unsupported bank statement format")
+	ErrNoStatements      = errors.New("no statements found in file")
+)
+
+// Statement is one account statement of a file
+type Statement struct {
+	StatementNo    string
+	Account        string // IBAN or account number as printed by the bank
+	Currency       string
+	FromDate       time.Time
+	ToDate         time.Time
+	OpeningBalance float64
+	ClosingBalance float64
+	HasBalances    bool
+	Lines          []Line
+}
+
+// Line is a booked transaction of a statement
+type Line struct {
+	BookingDate         time.Time
+	ValueDate           time.Time
+	Amount              float64
+	Currency            string
+	Reference           string // end-to-end or customer reference
+	BankReference       string
+	Description         string // remittance information
+	CounterpartyName    string
+	CounterpartyAccount string
+}
+
+// Text returns the line's references and remittance information for
+// reference matching
+func (l Line) Text() string {
+	return strings.Join([]string{l.Reference, l.Description, l.BankReference}, " ")
+}
+
+// Parse reads the statements of a file in the given format. mapping is only
+// used for CSV files and may be nil to detect columns from the header.
+func Parse(format string, r io.Reader, mapping *CSVMapping) ([]Statement, error) {
+	var statements []Statement
+	var err error
+	switch strings.ToLower(format) {
+	case FormatCAMT053:
+		statements, err = ParseCAMT053(r)
+	case FormatMT940:
+		statements, err = ParseMT940(r)
+	case FormatCSV:
+		statements, err = ParseCSV(r, mapping)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(statements) == 0 {
+		return nil, ErrNoStatements
+	}
+	for i := range statements {
+		fillDates(&statements[i])
+	}
+	return statements, nil
+}
+
+// fillDates derives missing statement dates from the booked lines
+func fillDates(s *Statement) {
+	var from, to time.Time
+	for _, l := range s.Lines {
+		if from.IsZero() || l.BookingDate.Before(from) {
+			from = l.BookingDate
+		}
+		if to.IsZero() || l.BookingDate.After(to) {
+			to = l.BookingDate
+		}
+	}
+	if s.FromDate.IsZero() {
+		s.FromDate = from
+	}
+	if s.ToDate.IsZero() {
+		s.ToDate = to
+	}
+}
+
+// round rounds an amount to cents
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
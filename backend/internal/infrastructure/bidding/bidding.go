@@ -0,0 +1,258 @@
+// Package bidding compares supplier bids on a request for quotation. Each bid
+// quotes price breaks, a minimum order quantity and a lead time per item;
+// bids are valued in the base currency at the quantity that would actually
+// be ordered, and their total cost of ownership is scored together with
+// lead time and the supplier's rating.
+package bidding
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ErrInvalidBid is returned for price breaks that are not usable
+var ErrInvalidBid = errors.New("invalid bid")
+
+// PriceBreak is the unit price from a minimum quantity on
+type PriceBreak struct {
+	MinQuantity float64 `json:"min_quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+}
+
+// ValidateBreaks checks price breaks have positive prices and distinct
+// quantities
+func ValidateBreaks(breaks []PriceBreak) error {
+	if len(breaks) == 0 {
+		return fmt.Errorf("%w: at least one price break is required", ErrInvalidBid)
+	}
+	seen := make(map[float64]bool, len(breaks))
+	for _, b := range breaks {
+		if b.MinQuantity < 0 || b.UnitPrice <= 0 {
+			return fmt.Errorf("%w: price breaks need a positive price and a quantity of 0 or more", ErrInvalidBid)
+		}
+		if seen[b.MinQuantity] {
+			return fmt.Errorf("%w: duplicate price break at %g", ErrInvalidBid, b.MinQuantity)
+		}
+		seen[b.MinQuantity] = true
+	}
+	return nil
+}
+
+// UnitPrice returns the price of the highest break reached by quantity. A
+// quantity below every break is priced at the lowest one.
+func UnitPrice(breaks []PriceBreak, quantity float64) float64 {
+	if len(breaks) == 0 {
+		return 0
+	}
+	sorted := append([]PriceBreak(nil), breaks...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].MinQuantity < sorted[j].MinQuantity })
+	price := sorted[0].UnitPrice
+	for _, b := range sorted {
+		if quantity >= b.MinQuantity {
+			price = b.UnitPrice
+		}
+	}
+	return price
+}
+
+// Item is a line of the request for quotation
+type Item struct {
+	ID       string  `json:"id"`
+	Quantity float64 `json:"quantity"`
+}
+
+// Quote is what a bid offers for an item
+type Quote struct {
+	ItemID       string       `json:"item_id"`
+	Breaks       []PriceBreak `json:"breaks"`
+	MOQ          float64      `json:"moq"`
+	LeadTimeDays int          `json:"lead_time_days"`
+}
+
+// Bid is a supplier's bid. Amounts are in the bid currency and Rate
+// converts them into the base currency.
+type Bid struct {
+	ID          string   `json:"id"`
+	Rate        float64  `json:"rate"`
+	Quotes      []Quote  `json:"quotes"`
+	FreightCost float64  `json:"freight_cost"`
+	ToolingCost float64  `json:"tooling_cost"`
+	Rating      *float64 `json:"rating"` // supplier rating 0 to 100, nil if unrated
+	Expired     bool     `json:"expired"`
+}
+
+// Weights are the relative weights of cost, lead time and supplier rating
+// in the bid score
+type Weights struct {
+	Cost     float64 `json:"cost"`
+	LeadTime float64 `json:"lead_time"`
+	Rating   float64 `json:"rating"`
+}
+
+// DefaultWeights weighs the total cost of ownership most
+func DefaultWeights() Weights {
+	return Weights{Cost: 60, LeadTime: 20, Rating: 20}
+}
+
+// Line is a bid's offer for an item valued in the base currency
+type Line struct {
+	ItemID         string  `json:"item_id"`
+	Quoted         bool    `json:"quoted"`
+	OrderQuantity  float64 `json:"order_quantity"`  // required quantity raised to the MOQ
+	ExcessQuantity float64 `json:"excess_quantity"` // ordered over the required quantity
+	UnitPrice      float64 `json:"unit_price"`      // in the bid currency
+	UnitPriceBase  float64 `json:"unit_price_base"`
+	AmountBase     float64 `json:"amount_base"`
+	ExcessBase     float64 `json:"excess_base"` // part of the amount spent on the excess
+	LeadTimeDays   int     `json:"lead_time_days"`
+}
+
+// Evaluation is a bid valued and scored against the other bids. Only
+// complete bids that have not expired are scored and ranked.
+type Evaluation struct {
+	BidID         string   `json:"bid_id"`
+	Lines         []Line   `json:"lines"`
+	Complete      bool     `json:"complete"` // quotes every item
+	Expired       bool     `json:"expired"`
+	MaterialBase  float64  `json:"material_base"`
+	FreightBase   float64  `json:"freight_base"`
+	ToolingBase   float64  `json:"tooling_base"`
+	ExcessBase    float64  `json:"excess_base"`
+	TCO           float64  `json:"tco"` // material, freight and tooling in the base currency
+	LeadTimeDays  int      `json:"lead_time_days"`
+	CostScore     *float64 `json:"cost_score"`
+	LeadTimeScore *float64 `json:"lead_time_score"`
+	RatingScore   *float64 `json:"rating_score"`
+	Score         *float64 `json:"score"`
+	Rank          int      `json:"rank"` // 1 for the best bid, 0 when not ranked
+}
+
+// Eligible reports whether the bid can be scored and awarded
+func (e Evaluation) Eligible() bool {
+	return e.Complete && !e.Expired
+}
+
+// Evaluate values every bid against the items and scores the eligible ones.
+// The cheapest total cost of ownership and the shortest lead time score 100
+// and the others in proportion; the score is the weighted mean of the cost,
+// lead time and rating scores, leaving out a missing rating.
+func Evaluate(items []Item, bids []Bid, w Weights) []Evaluation {
+	evaluations := make([]Evaluation, 0, len(bids))
+	for _, bid := range bids {
+		evaluations = append(evaluations, value(items, bid))
+	}
+
+	minTCO, minLead := math.Inf(1), math.MaxInt
+	for _, e := range evaluations {
+		if e.Eligible() {
+			minTCO = math.Min(minTCO, e.TCO)
+			if e.LeadTimeDays < minLead {
+				minLead = e.LeadTimeDays
+			}
+		}
+	}
+
+	var ranked []*Evaluation
+	for i := range evaluations {
+		e := &evaluations[i]
+		if !e.Eligible() {
+			continue
+		}
+		if e.TCO > 0 {
+			e.CostScore = round(minTCO / e.TCO * 100)
+		} else {
+			e.CostScore = round(100)
+		}
+		e.LeadTimeScore = round(float64(max(minLead, 1)) / float64(max(e.LeadTimeDays, 1)) * 100)
+		if rating := bids[i].Rating; rating != nil {
+			e.RatingScore = round(math.Max(0, math.Min(100, *rating)))
+		}
+
+		var total, weights float64
+		for _, f := range []struct {
+			score  *float64
+			weight float64
+		}{
+			{e.CostScore, w.Cost},
+			{e.LeadTimeScore, w.LeadTime},
+			{e.RatingScore, w.Rating},
+		} {
+			if f.score != nil && f.weight > 0 {
+				total += *f.score * f.weight
+				weights += f.weight
+			}
+		}
+		if weights > 0 {
+			e.Score = round(total / weights)
+		} else {
+			e.Score = e.CostScore
+		}
+		ranked = append(ranked, e)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if *ranked[i].Score != *ranked[j].Score {
+			return *ranked[i].Score > *ranked[j].Score
+		}
+		return ranked[i].TCO < ranked[j].TCO
+	})
+	for i, e := range ranked {
+		e.Rank = i + 1
+	}
+	return evaluations
+}
+
+// value prices a bid's quotes at the quantities that would be ordered
+func value(items []Item, bid Bid) Evaluation {
+	e := Evaluation{BidID: bid.ID, Complete: true, Expired: bid.Expired}
+	quotes := make(map[string]Quote, len(bid.Quotes))
+	for _, q := range bid.Quotes {
+		quotes[q.ItemID] = q
+	}
+
+	for _, item := range items {
+		q, ok := quotes[item.ID]
+		if !ok || len(q.Breaks) == 0 {
+			e.Complete = false
+			e.Lines = append(e.Lines, Line{ItemID: item.ID})
+			continue
+		}
+		qty := math.Max(item.Quantity, q.MOQ)
+		price := UnitPrice(q.Breaks, qty)
+		line := Line{
+			ItemID:         item.ID,
+			Quoted:         true,
+			OrderQuantity:  qty,
+			ExcessQuantity: qty - item.Quantity,
+			UnitPrice:      price,
+			UnitPriceBase:  price * bid.Rate,
+			AmountBase:     money(qty * price * bid.Rate),
+			ExcessBase:     money((qty - item.Quantity) * price * bid.Rate),
+			LeadTimeDays:   q.LeadTimeDays,
+		}
+		e.Lines = append(e.Lines, line)
+		e.MaterialBase += line.AmountBase
+		e.ExcessBase += line.ExcessBase
+		if q.LeadTimeDays > e.LeadTimeDays {
+			e.LeadTimeDays = q.LeadTimeDays
+		}
+	}
+
+	e.FreightBase = money(bid.FreightCost * bid.Rate)
+	e.ToolingBase = money(bid.ToolingCost * bid.Rate)
+	e.MaterialBase = money(e.MaterialBase)
+	e.ExcessBase = money(e.ExcessBase)
+	e.TCO = money(e.MaterialBase + e.FreightBase + e.ToolingBase)
+	return e
+}
+
+func money(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func round(v float64) *float64 {
+	r := math.Round(v*10) / 10
+	return &r
+}
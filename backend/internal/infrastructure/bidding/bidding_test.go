@@ -0,0 +1,110 @@
+package bidding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnitPrice(t *testing.T) {
+	breaks := []PriceBreak{{MinQuantity: 5000, UnitPrice: 1.5}, {MinQuantity: 0, UnitPrice: 2}, {MinQuantity: 1000, UnitPrice: 1.8}}
+	assert.Equal(t, 2.0, UnitPrice(breaks, 999))
+	assert.Equal(t, 1.8, UnitPrice(breaks, 1000))
+	assert.Equal(t, 1.5, UnitPrice(breaks, 8000))
+
+	// below every break the lowest one applies
+	assert.Equal(t, 3.0, UnitPrice([]PriceBreak{{MinQuantity: 100, UnitPrice: 3}}, 10))
+	assert.Equal(t, 0.0, UnitPrice(nil, 10))
+}
+
+func TestValidateBreaks(t *testing.T) {
+	assert.NoError(t, ValidateBreaks([]PriceBreak{{MinQuantity: 0, UnitPrice: 2}, {MinQuantity: 1000, UnitPrice: 1.8}}))
+	assert.ErrorIs(t, ValidateBreaks(nil), ErrInvalidBid)
+	assert.ErrorIs(t, ValidateBreaks([]PriceBreak{{MinQuantity: 0, UnitPrice: 0}}), ErrInvalidBid)
+	assert.ErrorIs(t, ValidateBreaks([]PriceBreak{{MinQuantity: 10, UnitPrice: 1}, {MinQuantity: 10, UnitPrice: 2}}), ErrInvalidBid)
+}
+
+func rating(v float64) *float64 { return &v }
+
+func testBids() ([]Item, []Bid) {
+	items := []Item{{ID: "rod", Quantity: 1000}, {ID: "plating", Quantity: 50}}
+	bids := []Bid{
+		{
+			ID:   "local",
+			Rate: 1,
+			Quotes: []Quote{
+				{ItemID: "rod", Breaks: []PriceBreak{{0, 2}, {1000, 1.8}}, LeadTimeDays: 10},
+				{ItemID: "plating", Breaks: []PriceBreak{{0, 10}}, MOQ: 100, LeadTimeDays: 20},
+			},
+			FreightCost: 200,
+			Rating:      rating(80),
+		},
+		{
+			ID:   "import",
+			Rate: 30,
+			Quotes: []Quote{
+				{ItemID: "rod", Breaks: []PriceBreak{{0, 0.05}}, LeadTimeDays: 15},
+				{ItemID: "plating", Breaks: []PriceBreak{{0, 0.3}}, LeadTimeDays: 15},
+			},
+			FreightCost: 10,
+			ToolingCost: 20,
+		},
+		{
+			ID:     "partial",
+			Rate:   1,
+			Quotes: []Quote{{ItemID: "rod", Breaks: []PriceBreak{{0, 1}}, LeadTimeDays: 5}},
+		},
+	}
+	return items, bids
+}
+
+func TestEvaluate(t *testing.T) {
+	items, bids := testBids()
+	evals := Evaluate(items, bids, DefaultWeights())
+	require.Len(t, evals, 3)
+
+	local := evals[0]
+	assert.True(t, local.Complete)
+	assert.Equal(t, 1800.0, local.Lines[0].AmountBase)
+	// the MOQ forces 100 platings where 50 are needed
+	assert.Equal(t, 100.0, local.Lines[1].OrderQuantity)
+	assert.Equal(t, 50.0, local.Lines[1].ExcessQuantity)
+	assert.Equal(t, 500.0, local.ExcessBase)
+	assert.Equal(t, 3000.0, local.TCO)
+	assert.Equal(t, 20, local.LeadTimeDays)
+
+	imported := evals[1]
+	assert.Equal(t, 1950.0, imported.MaterialBase)
+	assert.Equal(t, 300.0, imported.FreightBase)
+	assert.Equal(t, 600.0, imported.ToolingBase)
+	assert.Equal(t, 2850.0, imported.TCO)
+
+	// cost 2850/3000, lead time 15/20, rating 80
+	assert.Equal(t, 95.0, *local.CostScore)
+	assert.Equal(t, 75.0, *local.LeadTimeScore)
+	assert.Equal(t, 88.0, *local.Score)
+	// an unrated supplier is scored on cost and lead time only
+	assert.Nil(t, imported.RatingScore)
+	assert.Equal(t, 100.0, *imported.Score)
+	assert.Equal(t, 1, imported.Rank)
+	assert.Equal(t, 2, local.Rank)
+
+	partial := evals[2]
+	assert.False(t, partial.Complete)
+	assert.False(t, partial.Lines[1].Quoted)
+	assert.Nil(t, partial.Score)
+	assert.Equal(t, 0, partial.Rank)
+}
+
+func TestEvaluateSkipsExpiredBids(t *testing.T) {
+	items, bids := testBids()
+	bids[1].Expired = true
+	evals := Evaluate(items, bids, DefaultWeights())
+
+	assert.False(t, evals[1].Eligible())
+	assert.Equal(t, 0, evals[1].Rank)
+	assert.Equal(t, 2850.0, evals[1].TCO, "expired bids are still valued")
+	assert.Equal(t, 1, evals[0].Rank)
+	assert.Equal(t, 96.0, *evals[0].Score) // (100*60 + 100*20 + 80*20) / 100
+}
@@ -0,0 +1,480 @@
+// Package calibration fits the cost model to what production actually
+// took. Each completed job contributes a sample per process; the samples
+// of a process give its actual cycle time, hourly cost, scrap rate and the
+// ratio of actual to estimated time and cost, each with a 95% confidence
+// interval, and a regression of cycle time and cost per piece on the
+// part's diameter, length and material.
+package calibration
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MinSamples is the fewest samples a process needs to be calibrated
+const MinSamples = 3
+
+// Regression terms
+const (
+	TermIntercept = "intercept"
+	TermDiameter  = "diameter"
+	TermLength    = "length"
+
+	// materialTermPrefix prefixes the term of each material other than the
+	// most common one, which the intercept covers
+	materialTermPrefix = "material:"
+)
+
+// ErrSingular is returned when the samples cannot separate the terms of a
+// regression, e.g. when every sample has the same diameter
+var ErrSingular = errors.New("calibration: regression terms are not independent")
+
+// Sample is one completed job's run of a process. Estimates are scaled to
+// the quantity the job produced.
+type Sample struct {
+	Reference      string  `json:"reference"`
+	Diameter       float64 `json:"diameter"` // mm, 0 when unknown
+	Length         float64 `json:"length"`   // mm, 0 when unknown
+	Material       string  `json:"material"`
+	Quantity       float64 `json:"quantity"` // pieces completed
+	Defects        float64 `json:"defects"`
+	EstimatedHours float64 `json:"estimated_hours"`
+	ActualHours    float64 `json:"actual_hours"`
+	EstimatedCost  float64 `json:"estimated_cost"`
+	ActualCost     float64 `json:"actual_cost"`
+}
+
+// Interval is an estimate with its 95% confidence interval over N samples.
+// With a single sample the interval collapses onto the value.
+type Interval struct {
+	Value float64 `json:"value"`
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	N     int     `json:"n"`
+}
+
+// Scale multiplies the estimate and its bounds by f
+func (i Interval) Scale(f float64) Interval {
+	i.Value, i.Lower, i.Upper = i.Value*f, i.Lower*f, i.Upper*f
+	if i.Lower > i.Upper {
+		i.Lower, i.Upper = i.Upper, i.Lower
+	}
+	return i
+}
+
+// Coefficient is a regression coefficient with its standard error and 95%
+// confidence interval
+type Coefficient struct {
+	Term     string  `json:"term"`
+	Estimate float64 `json:"estimate"`
+	StdErr   float64 `json:"std_err"`
+	Lower    float64 `json:"lower"`
+	Upper    float64 `json:"upper"`
+}
+
+// Regression is an ordinary least squares fit
+type Regression struct {
+	Coefficients   []Coefficient `json:"coefficients"`
+	N              int           `json:"n"`
+	RSquared       float64       `json:"r_squared"`
+	ResidualStdErr float64       `json:"residual_std_err"`
+	Baseline       string        `json:"baseline,omitempty"` // material the intercept stands for
+}
+
+// Coefficient returns the coefficient of a term
+func (r *Regression) Coefficient(term string) (Coefficient, bool) {
+	for _, c := range r.Coefficients {
+		if c.Term == term {
+			return c, true
+		}
+	}
+	return Coefficient{}, false
+}
+
+// Fit is the calibration of one process
+type Fit struct {
+	Samples      int         `json:"samples"`
+	CycleSeconds Interval    `json:"cycle_seconds"` // actual seconds per piece
+	CostPerPiece Interval    `json:"cost_per_piece"`
+	HourlyCost   Interval    `json:"hourly_cost"`
+	TimeFactor   Interval    `json:"time_factor"` // actual / estimated hours
+	CostFactor   Interval    `json:"cost_factor"` // actual / estimated cost
+	ScrapRate    Interval    `json:"scrap_rate"`  // defects / pieces completed
+	CycleModel   *Regression `json:"cycle_model,omitempty"`
+	CostModel    *Regression `json:"cost_model,omitempty"`
+}
+
+// Calibrate fits a process from its samples. Samples without a quantity
+// or without actual hours are ignored; ratios only use samples that have
+// an estimate.
+func Calibrate(samples []Sample) Fit {
+	var used []Sample
+	var cycle, costPerPiece, hourly, timeFactor, costFactor []float64
+	var defects, completed float64
+	for _, s := range samples {
+		if s.Quantity <= 0 || s.ActualHours <= 0 {
+			continue
+		}
+		used = append(used, s)
+		cycle = append(cycle, s.ActualHours*3600/s.Quantity)
+		costPerPiece = append(costPerPiece, s.ActualCost/s.Quantity)
+		if s.ActualCost > 0 {
+			hourly = append(hourly, s.ActualCost/s.ActualHours)
+		}
+		if s.EstimatedHours > 0 {
+			timeFactor = append(timeFactor, s.ActualHours/s.EstimatedHours)
+		}
+		if s.EstimatedCost > 0 && s.ActualCost > 0 {
+			costFactor = append(costFactor, s.ActualCost/s.EstimatedCost)
+		}
+		defects += s.Defects
+		completed += s.Quantity
+	}
+
+	fit := Fit{
+		Samples:      len(used),
+		CycleSeconds: Mean(cycle),
+		CostPerPiece: Mean(costPerPiece),
+		HourlyCost:   Mean(hourly),
+		TimeFactor:   Mean(timeFactor),
+		CostFactor:   Mean(costFactor),
+		ScrapRate:    Proportion(defects, completed),
+	}
+	if model, err := fitModel(used, cycle); err == nil {
+		fit.CycleModel = model
+	}
+	if model, err := fitModel(used, costPerPiece); err == nil {
+		fit.CostModel = model
+	}
+	return fit
+}
+
+// fitModel regresses y on diameter, length and material, dropping the
+// terms the samples cannot support: materials first, then length and
+// diameter. Sizes are only used when every sample has them.
+func fitModel(samples []Sample, y []float64) (*Regression, error) {
+	if len(samples) < MinSamples {
+		return nil, ErrSingular
+	}
+
+	sized := true
+	diameters := map[float64]bool{}
+	lengths := map[float64]bool{}
+	materials := map[string]int{}
+	for _, s := range samples {
+		if s.Diameter <= 0 || s.Length <= 0 {
+			sized = false
+		}
+		diameters[s.Diameter] = true
+		lengths[s.Length] = true
+		materials[materialName(s.Material)]++
+	}
+
+	var baseline string
+	var others []string
+	for m := range materials {
+		others = append(others, m)
+	}
+	sort.Slice(others, func(i, j int) bool {
+		if materials[others[i]] != materials[others[j]] {
+			return materials[others[i]] > materials[others[j]]
+		}
+		return others[i] < others[j]
+	})
+	baseline, others = others[0], others[1:]
+
+	useDiameter := sized && len(diameters) > 1
+	useLength := sized && len(lengths) > 1
+	for {
+		terms := []string{TermIntercept}
+		if useDiameter {
+			terms = append(terms, TermDiameter)
+		}
+		if useLength {
+			terms = append(terms, TermLength)
+		}
+		for _, m := range others {
+			terms = append(terms, materialTermPrefix+m)
+		}
+
+		if len(samples) > len(terms) {
+			x := make([][]float64, len(samples))
+			for i, s := range samples {
+				row := []float64{1}
+				if useDiameter {
+					row = append(row, s.Diameter)
+				}
+				if useLength {
+					row = append(row, s.Length)
+				}
+				for _, m := range others {
+					v := 0.0
+					if materialName(s.Material) == m {
+						v = 1
+					}
+					row = append(row, v)
+				}
+				x[i] = row
+			}
+			model, err := Regress(terms, x, y)
+			if err == nil {
+				if len(others) > 0 {
+					model.Baseline = baseline
+				}
+				return model, nil
+			}
+		}
+
+		switch {
+		case len(others) > 0:
+			others = nil
+		case useLength:
+			useLength = false
+		case useDiameter:
+			useDiameter = false
+		default:
+			return nil, ErrSingular
+		}
+	}
+}
+
+func materialName(material string) string {
+	material = strings.TrimSpace(material)
+	if material == "" {
+		return "unknown"
+	}
+	return strings.ToUpper(material)
+}
+
+// Regress fits y = X·β by ordinary least squares. Each row of x holds the
+// values of terms, including a column of ones for an intercept if wanted.
+func Regress(terms []string, x [][]float64, y []float64) (*Regression, error) {
+	n, p := len(x), len(terms)
+	if n != len(y) || n <= p || p == 0 {
+		return nil, ErrSingular
+	}
+
+	xtx := make([][]float64, p)
+	xty := make([]float64, p)
+	for j := range xtx {
+		xtx[j] = make([]float64, p)
+	}
+	for i, row := range x {
+		if len(row) != p {
+			return nil, ErrSingular
+		}
+		for j := 0; j < p; j++ {
+			xty[j] += row[j] * y[i]
+			for k := 0; k < p; k++ {
+				xtx[j][k] += row[j] * row[k]
+			}
+		}
+	}
+	inverse, err := invert(xtx)
+	if err != nil {
+		return nil, err
+	}
+
+	beta := make([]float64, p)
+	for j := 0; j < p; j++ {
+		for k := 0; k < p; k++ {
+			beta[j] += inverse[j][k] * xty[k]
+		}
+	}
+
+	var mean, ssr, sst float64
+	for _, v := range y {
+		mean += v
+	}
+	mean /= float64(n)
+	for i, row := range x {
+		var fitted float64
+		for j := 0; j < p; j++ {
+			fitted += row[j] * beta[j]
+		}
+		ssr += (y[i] - fitted) * (y[i] - fitted)
+		sst += (y[i] - mean) * (y[i] - mean)
+	}
+
+	df := n - p
+	variance := ssr / float64(df)
+	t := TCritical(df)
+	model := &Regression{
+		N:              n,
+		ResidualStdErr: Round(math.Sqrt(variance)),
+	}
+	if sst > 0 {
+		model.RSquared = Round(1 - ssr/sst)
+	}
+	for j, term := range terms {
+		se := math.Sqrt(math.Max(variance*inverse[j][j], 0))
+		model.Coefficients = append(model.Coefficients, Coefficient{
+			Term:     term,
+			Estimate: Round(beta[j]),
+			StdErr:   Round(se),
+			Lower:    Round(beta[j] - t*se),
+			Upper:    Round(beta[j] + t*se),
+		})
+	}
+	return model, nil
+}
+
+// invert inverts a square matrix by Gauss-Jordan elimination with partial
+// pivoting
+func invert(m [][]float64) ([][]float64, error) {
+	p := len(m)
+	a := make([][]float64, p)
+	for i := range m {
+		a[i] = make([]float64, 2*p)
+		copy(a[i], m[i])
+		a[i][p+i] = 1
+	}
+
+	for col := 0; col < p; col++ {
+		pivot := col
+		for row := col + 1; row < p; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-9 {
+			return nil, ErrSingular
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+
+		scale := a[col][col]
+		for k := range a[col] {
+			a[col][k] /= scale
+		}
+		for row := 0; row < p; row++ {
+			if row == col || a[row][col] == 0 {
+				continue
+			}
+			factor := a[row][col]
+			for k := range a[row] {
+				a[row][k] -= factor * a[col][k]
+			}
+		}
+	}
+
+	inverse := make([][]float64, p)
+	for i := range a {
+		inverse[i] = a[i][p:]
+	}
+	return inverse, nil
+}
+
+// Mean is the mean of values with its t confidence interval
+func Mean(values []float64) Interval {
+	n := len(values)
+	if n == 0 {
+		return Interval{}
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(n)
+	if n == 1 {
+		return Interval{Value: Round(mean), Lower: Round(mean), Upper: Round(mean), N: 1}
+	}
+
+	var ss float64
+	for _, v := range values {
+		ss += (v - mean) * (v - mean)
+	}
+	half := TCritical(n-1) * math.Sqrt(ss/float64(n-1)) / math.Sqrt(float64(n))
+	return Interval{Value: Round(mean), Lower: Round(mean - half), Upper: Round(mean + half), N: n}
+}
+
+// Proportion is successes/trials with its Wilson score interval, which
+// stays within [0, 1] for the small scrap counts of a few jobs
+func Proportion(successes, trials float64) Interval {
+	if trials <= 0 {
+		return Interval{}
+	}
+	const z = 1.959964
+	p := successes / trials
+	denominator := 1 + z*z/trials
+	centre := (p + z*z/(2*trials)) / denominator
+	half := z * math.Sqrt(p*(1-p)/trials+z*z/(4*trials*trials)) / denominator
+	return Interval{
+		Value: Round(p),
+		Lower: Round(math.Max(centre-half, 0)),
+		Upper: Round(math.Min(centre+half, 1)),
+		N:     int(trials),
+	}
+}
+
+// tTable holds the two-sided 95% critical values of Student's t for 1 to
+// 30 degrees of freedom
+var tTable = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tTail continues the table for larger degrees of freedom; 0 stands for
+// infinity
+var tTail = []struct {
+	df    int
+	value float64
+}{
+	{30, 2.042}, {40, 2.021}, {60, 2.000}, {120, 1.980}, {0, 1.960},
+}
+
+// TCritical is the two-sided 95% critical value of Student's t, interpolated
+// in 1/df past 30 degrees of freedom
+func TCritical(df int) float64 {
+	if df < 1 {
+		return math.Inf(1)
+	}
+	if df <= len(tTable) {
+		return tTable[df-1]
+	}
+	inv := 1 / float64(df)
+	for i := 1; i < len(tTail); i++ {
+		lo, hi := tTail[i-1], tTail[i]
+		if hi.df != 0 && df > hi.df {
+			continue
+		}
+		loInv := 1 / float64(lo.df)
+		hiInv := 0.0
+		if hi.df != 0 {
+			hiInv = 1 / float64(hi.df)
+		}
+		return lo.value + (hi.value-lo.value)*(loInv-inv)/(loInv-hiInv)
+	}
+	return 1.960
+}
+
+// sizePattern matches metric fastener sizes such as M8x40, M10x1.25x60 or
+// 8 x 40: diameter, optional pitch, length
+var sizePattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9.])M?(\d+(?:\.\d+)?)\s*(?:[x×*]\s*\d+(?:\.\d+)?\s*)?[x×*]\s*(\d+(?:\.\d+)?)`)
+
+// ParseSize reads the diameter and length in mm from a size or product
+// description such as "Hex bolt M8x40 8.8 zinc"
+func ParseSize(text string) (diameter, length float64, ok bool) {
+	match := sizePattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0, 0, false
+	}
+	diameter, err := strconv.ParseFloat(match[1], 64)
+	if err != nil || diameter <= 0 {
+		return 0, 0, false
+	}
+	length, err = strconv.ParseFloat(match[2], 64)
+	if err != nil || length <= 0 {
+		return 0, 0, false
+	}
+	return diameter, length, true
+}
+
+// Round rounds to 4 decimals
+func Round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
@@ -0,0 +1,141 @@
+package calibration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := []struct {
+		text             string
+		diameter, length float64
+		ok               bool
+	}{
+		{"M8x40", 8, 40, true},
+		{"Hex bolt M10 x 50 8.8 zinc", 10, 50, true},
+		{"M10x1.25x60", 10, 60, true},
+		{"DIN 933 M6*20", 6, 20, true},
+		{"3.5x25 self tapping", 3.5, 25, true},
+		{"Washer M8", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, c := range cases {
+		diameter, length, ok := ParseSize(c.text)
+		assert.Equal(t, c.ok, ok, c.text)
+		assert.Equal(t, c.diameter, diameter, c.text)
+		assert.Equal(t, c.length, length, c.text)
+	}
+}
+
+func TestMean(t *testing.T) {
+	assert.Equal(t, Interval{}, Mean(nil))
+	assert.Equal(t, Interval{Value: 4, Lower: 4, Upper: 4, N: 1}, Mean([]float64{4}))
+
+	// sd 1.291, n 4: 2.5 ± 3.182 × 1.291/2
+	i := Mean([]float64{1, 2, 3, 4})
+	assert.Equal(t, 2.5, i.Value)
+	assert.Equal(t, 0.446, i.Lower)
+	assert.Equal(t, 4.554, i.Upper)
+	assert.Equal(t, 4, i.N)
+
+	scaled := Interval{Value: 1, Lower: -2, Upper: 3}.Scale(-2)
+	assert.Equal(t, Interval{Value: -2, Lower: -6, Upper: 4}, scaled)
+}
+
+func TestProportion(t *testing.T) {
+	assert.Equal(t, Interval{}, Proportion(0, 0))
+
+	p := Proportion(0, 100)
+	assert.Equal(t, 0.0, p.Value)
+	assert.Equal(t, 0.0, p.Lower)
+	assert.InDelta(t, 0.037, p.Upper, 0.001)
+
+	p = Proportion(5, 100)
+	assert.Equal(t, 0.05, p.Value)
+	assert.InDelta(t, 0.0215, p.Lower, 0.001)
+	assert.InDelta(t, 0.1118, p.Upper, 0.001)
+}
+
+func TestTCritical(t *testing.T) {
+	assert.Equal(t, 12.706, TCritical(1))
+	assert.Equal(t, 2.042, TCritical(30))
+	assert.InDelta(t, 2.021, TCritical(40), 1e-9)
+	assert.InDelta(t, 2.0, TCritical(60), 1e-9)
+	assert.True(t, TCritical(500) > 1.96 && TCritical(500) < 1.98)
+}
+
+func TestRegress(t *testing.T) {
+	// y = 2 + 3x exactly
+	x := [][]float64{{1, 1}, {1, 2}, {1, 3}, {1, 4}}
+	y := []float64{5, 8, 11, 14}
+	model, err := Regress([]string{TermIntercept, "x"}, x, y)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, model.RSquared)
+	slope, ok := model.Coefficient("x")
+	require.True(t, ok)
+	assert.Equal(t, 3.0, slope.Estimate)
+	assert.Equal(t, 0.0, slope.StdErr)
+
+	_, err = Regress([]string{TermIntercept, "x"}, [][]float64{{1, 2}, {1, 2}, {1, 2}}, []float64{1, 2, 3})
+	assert.ErrorIs(t, err, ErrSingular)
+	_, err = Regress([]string{TermIntercept, "x"}, x[:2], y[:2])
+	assert.ErrorIs(t, err, ErrSingular)
+}
+
+func TestCalibrate(t *testing.T) {
+	samples := []Sample{
+		{Diameter: 6, Length: 20, Material: "10B21", Quantity: 1000, Defects: 10, EstimatedHours: 0.6, ActualHours: 0.7, EstimatedCost: 24, ActualCost: 28},
+		{Diameter: 8, Length: 40, Material: "10B21", Quantity: 1000, Defects: 5, EstimatedHours: 0.8, ActualHours: 0.85, EstimatedCost: 32, ActualCost: 34},
+		{Diameter: 10, Length: 30, Material: "10B21", Quantity: 2000, Defects: 30, EstimatedHours: 1.8, ActualHours: 1.95, EstimatedCost: 72, ActualCost: 78},
+		{Diameter: 12, Length: 60, Material: "SCM435", Quantity: 500, Defects: 0, EstimatedHours: 0.5, ActualHours: 0.55, EstimatedCost: 20, ActualCost: 22},
+		{Diameter: 16, Length: 80, Material: "10B21", Quantity: 500, Defects: 5, EstimatedHours: 0.7, ActualHours: 0.7, EstimatedCost: 28, ActualCost: 28},
+		{Quantity: 100, ActualHours: 0}, // never started: ignored
+	}
+
+	fit := Calibrate(samples)
+	assert.Equal(t, 5, fit.Samples)
+	assert.Equal(t, 40.0, fit.HourlyCost.Value)
+	assert.Equal(t, 40.0, fit.HourlyCost.Lower)
+	assert.True(t, fit.TimeFactor.Value > 1 && fit.TimeFactor.Lower < fit.TimeFactor.Value)
+	assert.Equal(t, fit.TimeFactor, fit.CostFactor)
+	assert.Equal(t, 0.0100, fit.ScrapRate.Value)
+	assert.True(t, fit.ScrapRate.Lower > 0 && fit.ScrapRate.Upper < 0.02)
+	assert.Equal(t, 5, fit.CycleSeconds.N)
+
+	require.NotNil(t, fit.CycleModel)
+	assert.Equal(t, "10B21", fit.CycleModel.Baseline)
+	_, ok := fit.CycleModel.Coefficient("material:SCM435")
+	assert.True(t, ok)
+	diameter, ok := fit.CycleModel.Coefficient(TermDiameter)
+	require.True(t, ok)
+	assert.True(t, diameter.Lower <= diameter.Estimate && diameter.Estimate <= diameter.Upper)
+	_, ok = fit.CycleModel.Coefficient(TermLength)
+	assert.True(t, ok)
+	require.NotNil(t, fit.CostModel)
+
+	// Without a spare degree of freedom the material term goes first
+	fit = Calibrate(samples[:4])
+	require.NotNil(t, fit.CycleModel)
+	assert.Empty(t, fit.CycleModel.Baseline)
+	assert.Len(t, fit.CycleModel.Coefficients, 3)
+
+	// Unsized samples are regressed on material alone
+	unsized := []Sample{
+		{Material: "a", Quantity: 100, ActualHours: 1, ActualCost: 40},
+		{Material: "A", Quantity: 100, ActualHours: 1.2, ActualCost: 48},
+		{Material: "a", Quantity: 100, ActualHours: 1.1, ActualCost: 44},
+		{Material: "b", Quantity: 100, ActualHours: 2, ActualCost: 80},
+	}
+	fit = Calibrate(unsized)
+	require.NotNil(t, fit.CycleModel)
+	assert.Equal(t, "A", fit.CycleModel.Baseline)
+	b, ok := fit.CycleModel.Coefficient("material:B")
+	require.True(t, ok)
+	// 72 s against the 39.6 s mean of A
+	assert.Equal(t, 32.4, b.Estimate)
+	assert.Equal(t, Interval{}, fit.TimeFactor)
+
+	assert.Nil(t, Calibrate(unsized[:2]).CycleModel)
+}
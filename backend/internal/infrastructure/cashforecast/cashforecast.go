@@ -0,0 +1,438 @@
+// Package cashforecast builds the rolling 13-week cash forecast. Expected
+// receipts and payments are bucketed into weeks per currency, shifted by
+// customers' actual payment behaviour and scenario overrides, and later
+// compared with actual cash movements to measure forecast accuracy.
+package cashforecast
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Weeks is the forecast horizon
+const Weeks = 13
+
+// Flow sources
+const (
+	SourceReceivable       = "receivable"
+	SourcePayable          = "payable"
+	SourceOrderDownPayment = "order_down_payment"
+	SourceOrderBalance     = "order_balance"
+	SourcePurchaseOrder    = "purchase_order"
+	SourceRecurring        = "recurring_expense"
+	SourceLC               = "lc_utilization"
+	SourceAdjustment       = "adjustment"
+)
+
+// Recurrence frequencies
+const (
+	FrequencyWeekly    = "weekly"
+	FrequencyMonthly   = "monthly"
+	FrequencyQuarterly = "quarterly"
+	FrequencyYearly    = "yearly"
+)
+
+// ValidSource reports whether source is a known flow source
+func ValidSource(source string) bool {
+	switch source {
+	case SourceReceivable, SourcePayable, SourceOrderDownPayment, SourceOrderBalance,
+		SourcePurchaseOrder, SourceRecurring, SourceLC, SourceAdjustment:
+		return true
+	}
+	return false
+}
+
+// ValidFrequency reports whether frequency is a known recurrence
+func ValidFrequency(frequency string) bool {
+	switch frequency {
+	case FrequencyWeekly, FrequencyMonthly, FrequencyQuarterly, FrequencyYearly:
+		return true
+	}
+	return false
+}
+
+// Flow is one expected cash movement
+type Flow struct {
+	Source    string    `json:"source"`
+	Reference string    `json:"reference"`
+	Currency  string    `json:"currency"`
+	Date      time.Time `json:"date"`
+	Amount    float64   `json:"amount"` // positive for receipts, negative for payments
+}
+
+// WeekStart returns the Monday starting the week of t
+func WeekStart(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// Week is one bucket of a currency's forecast
+type Week struct {
+	Start    time.Time          `json:"start"`
+	Inflows  float64            `json:"inflows"`
+	Outflows float64            `json:"outflows"` // as a positive amount
+	Net      float64            `json:"net"`
+	Opening  float64            `json:"opening"`
+	Closing  float64            `json:"closing"`
+	BySource map[string]float64 `json:"by_source"`
+}
+
+// Forecast is the 13-week forecast of one currency
+type Forecast struct {
+	Currency   string    `json:"currency"`
+	Opening    float64   `json:"opening"`
+	Weeks      []Week    `json:"weeks"`
+	Beyond     float64   `json:"beyond"` // net flows expected after the horizon
+	MinClosing float64   `json:"min_closing"`
+	MinWeek    time.Time `json:"min_week"`
+}
+
+// Build buckets flows into the weeks starting with the week of start, per
+// currency. Flows dated before start are still expected and fall into the
+// first week; opening holds the cash on hand per currency.
+func Build(start time.Time, opening map[string]float64, flows []Flow) []Forecast {
+	first := WeekStart(start)
+	horizon := first.AddDate(0, 0, 7*Weeks)
+
+	byCurrency := map[string]*Forecast{}
+	get := func(currency string) *Forecast {
+		f, ok := byCurrency[currency]
+		if !ok {
+			f = &Forecast{Currency: currency, Weeks: make([]Week, Weeks)}
+			for i := range f.Weeks {
+				f.Weeks[i].Start = first.AddDate(0, 0, 7*i)
+				f.Weeks[i].BySource = map[string]float64{}
+			}
+			byCurrency[currency] = f
+		}
+		return f
+	}
+	for currency, amount := range opening {
+		get(strings.ToUpper(currency)).Opening += amount
+	}
+
+	for _, flow := range flows {
+		if flow.Amount == 0 {
+			continue
+		}
+		f := get(strings.ToUpper(flow.Currency))
+		if !flow.Date.Before(horizon) {
+			f.Beyond += flow.Amount
+			continue
+		}
+		i := 0
+		if flow.Date.After(first) {
+			i = int(flow.Date.Sub(first).Hours() / 24 / 7)
+		}
+		w := &f.Weeks[i]
+		if flow.Amount > 0 {
+			w.Inflows += flow.Amount
+		} else {
+			w.Outflows -= flow.Amount
+		}
+		w.BySource[flow.Source] += flow.Amount
+	}
+
+	forecasts := make([]Forecast, 0, len(byCurrency))
+	for _, f := range byCurrency {
+		balance := f.Opening
+		f.MinClosing = math.Inf(1)
+		for i := range f.Weeks {
+			w := &f.Weeks[i]
+			w.Inflows = Round(w.Inflows)
+			w.Outflows = Round(w.Outflows)
+			for source, amount := range w.BySource {
+				w.BySource[source] = Round(amount)
+			}
+			w.Net = Round(w.Inflows - w.Outflows)
+			w.Opening = Round(balance)
+			balance += w.Net
+			w.Closing = Round(balance)
+			if w.Closing < f.MinClosing {
+				f.MinClosing = w.Closing
+				f.MinWeek = w.Start
+			}
+		}
+		f.Opening = Round(f.Opening)
+		f.Beyond = Round(f.Beyond)
+		forecasts = append(forecasts, *f)
+	}
+	sort.Slice(forecasts, func(i, j int) bool { return forecasts[i].Currency < forecasts[j].Currency })
+	return forecasts
+}
+
+// Settlement is a paid invoice, used to learn how late a customer pays
+type Settlement struct {
+	DueDate  time.Time
+	PaidDate time.Time
+	Amount   float64
+}
+
+// AverageDelay returns the amount weighted average number of days between
+// due date and payment; negative when the customer pays early. ok is false
+// without history.
+func AverageDelay(settlements []Settlement) (days float64, ok bool) {
+	var weighted, total float64
+	for _, s := range settlements {
+		if s.Amount <= 0 || s.DueDate.IsZero() || s.PaidDate.IsZero() {
+			continue
+		}
+		weighted += s.PaidDate.Sub(s.DueDate).Hours() / 24 * s.Amount
+		total += s.Amount
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return weighted / total, true
+}
+
+// ExpectedDate shifts a due date by a payment delay. Amounts that should
+// already have arrived are expected as of asOf.
+func ExpectedDate(due time.Time, delayDays float64, asOf time.Time) time.Time {
+	expected := due.AddDate(0, 0, int(math.Round(delayDays)))
+	if expected.Before(asOf) {
+		return asOf
+	}
+	return expected
+}
+
+var termsNumber = regexp.MustCompile(`\d+`)
+
+// TermsDays reads the credit days of payment terms such as "NET30",
+// "Net 60" or "T/T 45 days". Terms paid up front count as zero days;
+// terms without a number fall back to fallback.
+func TermsDays(terms string, fallback int) int {
+	upper := strings.ToUpper(terms)
+	for _, prepaid := range []string{"CIA", "CASH IN ADVANCE", "PREPAY", "PREPAID", "IN ADVANCE", "COD"} {
+		if strings.Contains(upper, prepaid) {
+			return 0
+		}
+	}
+	if m := termsNumber.FindString(upper); m != "" {
+		if days, err := strconv.Atoi(m); err == nil {
+			return days
+		}
+	}
+	return fallback
+}
+
+// Occurrences returns the dates of a recurring item from first, every
+// frequency, that fall in [from, to). Items stop after until when it is set.
+// Monthly dates keep the day of first, clamped to the end of shorter months.
+func Occurrences(first time.Time, frequency string, until *time.Time, from, to time.Time) []time.Time {
+	var dates []time.Time
+	for n := 0; ; n++ {
+		var d time.Time
+		switch frequency {
+		case FrequencyWeekly:
+			d = first.AddDate(0, 0, 7*n)
+		case FrequencyMonthly:
+			d = addMonths(first, n)
+		case FrequencyQuarterly:
+			d = addMonths(first, 3*n)
+		case FrequencyYearly:
+			d = addMonths(first, 12*n)
+		default:
+			return dates
+		}
+		if !d.Before(to) || (until != nil && d.After(*until)) {
+			return dates
+		}
+		if !d.Before(from) {
+			dates = append(dates, d)
+		}
+	}
+}
+
+func addMonths(t time.Time, months int) time.Time {
+	y, m, _ := t.Date()
+	target := time.Date(y, m+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	last := target.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > last {
+		day = last
+	}
+	return target.AddDate(0, 0, day-1)
+}
+
+// Adjustment is a manual amount a user adds to one week of a scenario
+type Adjustment struct {
+	Currency  string    `json:"currency"`
+	WeekStart time.Time `json:"week_start"`
+	Amount    float64   `json:"amount"`
+	Note      string    `json:"note"`
+}
+
+// Scenario overrides the base forecast: receipts and payments can be
+// delayed, sources scaled and manual amounts added
+type Scenario struct {
+	ReceiptDelayDays int                `json:"receipt_delay_days"` // days added to every receipt
+	PaymentDelayDays int                `json:"payment_delay_days"` // days added to every payment
+	Factors          map[string]float64 `json:"factors"`            // multiplier per source, 1 when missing
+	Adjustments      []Adjustment       `json:"adjustments"`
+}
+
+// Apply returns the flows as the scenario expects them
+func (s Scenario) Apply(flows []Flow) []Flow {
+	out := make([]Flow, 0, len(flows)+len(s.Adjustments))
+	for _, f := range flows {
+		if factor, ok := s.Factors[f.Source]; ok {
+			f.Amount *= factor
+		}
+		if f.Amount > 0 && s.ReceiptDelayDays != 0 {
+			f.Date = f.Date.AddDate(0, 0, s.ReceiptDelayDays)
+		}
+		if f.Amount < 0 && s.PaymentDelayDays != 0 {
+			f.Date = f.Date.AddDate(0, 0, s.PaymentDelayDays)
+		}
+		out = append(out, f)
+	}
+	for _, a := range s.Adjustments {
+		out = append(out, Flow{
+			Source:    SourceAdjustment,
+			Reference: a.Note,
+			Currency:  strings.ToUpper(a.Currency),
+			Date:      WeekStart(a.WeekStart),
+			Amount:    a.Amount,
+		})
+	}
+	return out
+}
+
+// Line is the inflow and outflow of one currency in one week, forecast or
+// actual
+type Line struct {
+	Currency  string    `json:"currency"`
+	WeekStart time.Time `json:"week_start"`
+	Inflows   float64   `json:"inflows"`
+	Outflows  float64   `json:"outflows"`
+}
+
+// Lines flattens forecasts into lines
+func Lines(forecasts []Forecast) []Line {
+	var lines []Line
+	for _, f := range forecasts {
+		for _, w := range f.Weeks {
+			lines = append(lines, Line{Currency: f.Currency, WeekStart: w.Start, Inflows: w.Inflows, Outflows: w.Outflows})
+		}
+	}
+	return lines
+}
+
+// WeekVariance compares one forecast week with what happened
+type WeekVariance struct {
+	Currency         string    `json:"currency"`
+	WeekStart        time.Time `json:"week_start"`
+	ForecastInflows  float64   `json:"forecast_inflows"`
+	ActualInflows    float64   `json:"actual_inflows"`
+	ForecastOutflows float64   `json:"forecast_outflows"`
+	ActualOutflows   float64   `json:"actual_outflows"`
+	NetVariance      float64   `json:"net_variance"` // actual net minus forecast net
+}
+
+// CurrencyAccuracy summarizes the closed weeks of one currency. WAPE is the
+// weighted absolute percentage error: total absolute error over total
+// actuals. Bias is the forecast net minus the actual net; positive when
+// the forecast was too optimistic.
+type CurrencyAccuracy struct {
+	Currency    string  `json:"currency"`
+	Weeks       int     `json:"weeks"`
+	InflowWAPE  float64 `json:"inflow_wape"`
+	OutflowWAPE float64 `json:"outflow_wape"`
+	NetBias     float64 `json:"net_bias"`
+}
+
+// Accuracy compares forecast lines with actual lines
+type Accuracy struct {
+	Weeks      []WeekVariance     `json:"weeks"`
+	Currencies []CurrencyAccuracy `json:"currencies"`
+}
+
+// Compare measures forecast lines against actuals for the weeks that ended
+// before through
+func Compare(forecast, actual []Line, through time.Time) Accuracy {
+	type key struct {
+		currency string
+		week     int64
+	}
+	actuals := map[key]Line{}
+	for _, a := range actual {
+		k := key{strings.ToUpper(a.Currency), WeekStart(a.WeekStart).Unix()}
+		l := actuals[k]
+		l.Inflows += a.Inflows
+		l.Outflows += a.Outflows
+		actuals[k] = l
+	}
+
+	type totals struct {
+		weeks                   int
+		inErr, inAct            float64
+		outErr, outAct, netBias float64
+	}
+	sums := map[string]*totals{}
+	result := Accuracy{Weeks: []WeekVariance{}, Currencies: []CurrencyAccuracy{}}
+	for _, f := range forecast {
+		if f.WeekStart.AddDate(0, 0, 7).After(through) {
+			continue
+		}
+		currency := strings.ToUpper(f.Currency)
+		a := actuals[key{currency, WeekStart(f.WeekStart).Unix()}]
+		result.Weeks = append(result.Weeks, WeekVariance{
+			Currency:         currency,
+			WeekStart:        f.WeekStart,
+			ForecastInflows:  f.Inflows,
+			ActualInflows:    Round(a.Inflows),
+			ForecastOutflows: f.Outflows,
+			ActualOutflows:   Round(a.Outflows),
+			NetVariance:      Round((a.Inflows - a.Outflows) - (f.Inflows - f.Outflows)),
+		})
+		t, ok := sums[currency]
+		if !ok {
+			t = &totals{}
+			sums[currency] = t
+		}
+		t.weeks++
+		t.inErr += math.Abs(f.Inflows - a.Inflows)
+		t.inAct += a.Inflows
+		t.outErr += math.Abs(f.Outflows - a.Outflows)
+		t.outAct += a.Outflows
+		t.netBias += (f.Inflows - f.Outflows) - (a.Inflows - a.Outflows)
+	}
+
+	for currency, t := range sums {
+		result.Currencies = append(result.Currencies, CurrencyAccuracy{
+			Currency:    currency,
+			Weeks:       t.weeks,
+			InflowWAPE:  percentage(t.inErr, t.inAct),
+			OutflowWAPE: percentage(t.outErr, t.outAct),
+			NetBias:     Round(t.netBias),
+		})
+	}
+	sort.Slice(result.Weeks, func(i, j int) bool {
+		if result.Weeks[i].Currency != result.Weeks[j].Currency {
+			return result.Weeks[i].Currency < result.Weeks[j].Currency
+		}
+		return result.Weeks[i].WeekStart.Before(result.Weeks[j].WeekStart)
+	})
+	sort.Slice(result.Currencies, func(i, j int) bool { return result.Currencies[i].Currency < result.Currencies[j].Currency })
+	return result
+}
+
+func percentage(err, actual float64) float64 {
+	if actual == 0 {
+		if err == 0 {
+			return 0
+		}
+		return 100
+	}
+	return Round(err / actual * 100)
+}
+
+// Round rounds to cents
+func Round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
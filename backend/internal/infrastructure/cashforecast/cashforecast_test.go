@@ -0,0 +1,147 @@
+package cashforecast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestWeekStart(t *testing.T) {
+	assert.Equal(t, date("2024-07-01"), WeekStart(date("2024-07-01")))
+	assert.Equal(t, date("2024-07-01"), WeekStart(date("2024-07-04")))
+	assert.Equal(t, date("2024-07-01"), WeekStart(date("2024-07-07").Add(15*time.Hour)))
+}
+
+func TestBuild(t *testing.T) {
+	start := date("2024-07-03")
+	flows := []Flow{
+		{Source: SourceReceivable, Currency: "usd", Date: date("2024-06-20"), Amount: 1000}, // overdue
+		{Source: SourceReceivable, Currency: "USD", Date: date("2024-07-09"), Amount: 500},
+		{Source: SourcePayable, Currency: "USD", Date: date("2024-07-10"), Amount: -2500},
+		{Source: SourceRecurring, Currency: "TWD", Date: date("2024-07-05"), Amount: -30000},
+		{Source: SourceOrderBalance, Currency: "USD", Date: date("2024-12-01"), Amount: 800}, // after the horizon
+	}
+	forecasts := Build(start, map[string]float64{"USD": 2000, "EUR": 100}, flows)
+	require.Len(t, forecasts, 3)
+	assert.Equal(t, "EUR", forecasts[0].Currency)
+	assert.Equal(t, 100.0, forecasts[0].Weeks[Weeks-1].Closing)
+
+	twd := forecasts[1]
+	assert.Equal(t, "TWD", twd.Currency)
+	assert.Equal(t, 30000.0, twd.Weeks[0].Outflows)
+	assert.Equal(t, -30000.0, twd.MinClosing)
+
+	usd := forecasts[2]
+	require.Len(t, usd.Weeks, Weeks)
+	assert.Equal(t, date("2024-07-01"), usd.Weeks[0].Start)
+	assert.Equal(t, 1000.0, usd.Weeks[0].Inflows)
+	assert.Equal(t, 3000.0, usd.Weeks[0].Closing)
+	assert.Equal(t, 500.0, usd.Weeks[1].Inflows)
+	assert.Equal(t, 2500.0, usd.Weeks[1].Outflows)
+	assert.Equal(t, -2500.0, usd.Weeks[1].BySource[SourcePayable])
+	assert.Equal(t, 3000.0, usd.Weeks[1].Opening)
+	assert.Equal(t, 1000.0, usd.Weeks[1].Closing)
+	assert.Equal(t, 1000.0, usd.MinClosing)
+	assert.Equal(t, date("2024-07-08"), usd.MinWeek)
+	assert.Equal(t, 800.0, usd.Beyond)
+}
+
+func TestAverageDelay(t *testing.T) {
+	_, ok := AverageDelay(nil)
+	assert.False(t, ok)
+
+	days, ok := AverageDelay([]Settlement{
+		{DueDate: date("2024-05-01"), PaidDate: date("2024-05-11"), Amount: 3000},
+		{DueDate: date("2024-06-01"), PaidDate: date("2024-05-31"), Amount: 1000},
+	})
+	require.True(t, ok)
+	assert.InDelta(t, 7.25, days, 0.001)
+
+	asOf := date("2024-07-03")
+	assert.Equal(t, date("2024-07-17"), ExpectedDate(date("2024-07-10"), 7.25, asOf))
+	assert.Equal(t, asOf, ExpectedDate(date("2024-06-10"), 7.25, asOf))
+}
+
+func TestTermsDays(t *testing.T) {
+	assert.Equal(t, 30, TermsDays("NET30", 14))
+	assert.Equal(t, 60, TermsDays("Net 60 days", 14))
+	assert.Equal(t, 45, TermsDays("T/T 45 days after B/L", 14))
+	assert.Equal(t, 0, TermsDays("T/T in advance", 14))
+	assert.Equal(t, 0, TermsDays("COD", 14))
+	assert.Equal(t, 14, TermsDays("", 14))
+}
+
+func TestOccurrences(t *testing.T) {
+	from, to := date("2024-07-01"), date("2024-09-30")
+	monthly := Occurrences(date("2024-01-31"), FrequencyMonthly, nil, from, to)
+	assert.Equal(t, []time.Time{date("2024-07-31"), date("2024-08-31")}, monthly)
+
+	feb := Occurrences(date("2024-01-31"), FrequencyMonthly, nil, date("2024-02-01"), date("2024-03-01"))
+	assert.Equal(t, []time.Time{date("2024-02-29")}, feb)
+
+	until := date("2024-07-20")
+	weekly := Occurrences(date("2024-06-28"), FrequencyWeekly, &until, from, to)
+	assert.Equal(t, []time.Time{date("2024-07-05"), date("2024-07-12"), date("2024-07-19")}, weekly)
+
+	quarterly := Occurrences(date("2024-03-15"), FrequencyQuarterly, nil, from, to)
+	assert.Equal(t, []time.Time{date("2024-09-15")}, quarterly)
+
+	assert.Empty(t, Occurrences(date("2024-03-15"), "daily", nil, from, to))
+}
+
+func TestScenarioApply(t *testing.T) {
+	flows := []Flow{
+		{Source: SourceReceivable, Currency: "USD", Date: date("2024-07-10"), Amount: 1000},
+		{Source: SourcePurchaseOrder, Currency: "USD", Date: date("2024-07-10"), Amount: -400},
+	}
+	s := Scenario{
+		ReceiptDelayDays: 14,
+		Factors:          map[string]float64{SourceReceivable: 0.9},
+		Adjustments:      []Adjustment{{Currency: "usd", WeekStart: date("2024-07-17"), Amount: -250, Note: "Tax payment"}},
+	}
+	out := s.Apply(flows)
+	require.Len(t, out, 3)
+	assert.Equal(t, 900.0, out[0].Amount)
+	assert.Equal(t, date("2024-07-24"), out[0].Date)
+	assert.Equal(t, date("2024-07-10"), out[1].Date)
+	assert.Equal(t, -400.0, out[1].Amount)
+	assert.Equal(t, Flow{Source: SourceAdjustment, Reference: "Tax payment", Currency: "USD", Date: date("2024-07-15"), Amount: -250}, out[2])
+
+	// The base flows are untouched
+	assert.Equal(t, 1000.0, flows[0].Amount)
+}
+
+func TestCompare(t *testing.T) {
+	forecast := []Line{
+		{Currency: "USD", WeekStart: date("2024-07-01"), Inflows: 1000, Outflows: 500},
+		{Currency: "USD", WeekStart: date("2024-07-08"), Inflows: 1000, Outflows: 0},
+		{Currency: "USD", WeekStart: date("2024-07-15"), Inflows: 700, Outflows: 0}, // not closed yet
+	}
+	actual := []Line{
+		{Currency: "usd", WeekStart: date("2024-07-03"), Inflows: 600, Outflows: 500},
+		{Currency: "USD", WeekStart: date("2024-07-05"), Inflows: 200},
+		{Currency: "USD", WeekStart: date("2024-07-08"), Inflows: 1200, Outflows: 100},
+	}
+	acc := Compare(forecast, actual, date("2024-07-16"))
+	require.Len(t, acc.Weeks, 2)
+	assert.Equal(t, 800.0, acc.Weeks[0].ActualInflows)
+	assert.Equal(t, -200.0, acc.Weeks[0].NetVariance)
+	assert.Equal(t, 100.0, acc.Weeks[1].NetVariance)
+
+	require.Len(t, acc.Currencies, 1)
+	c := acc.Currencies[0]
+	assert.Equal(t, 2, c.Weeks)
+	assert.Equal(t, 20.0, c.InflowWAPE) // (200 + 200) / 2000
+	assert.Equal(t, 16.67, c.OutflowWAPE)
+	assert.Equal(t, 100.0, c.NetBias)
+}
@@ -0,0 +1,327 @@
+// Package certificate lays out EN 10204 inspection certificates: the
+// material heats with their mill test results, the results of the final
+// inspection and the shipped quantities, rendered as PDF. The SHA-256
+// digest of the rendered file identifies a certificate when verifying it.
+package certificate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Certificate types of EN 10204:2004
+const (
+	Type22 = "2.2" // test report, non-specific inspection
+	Type31 = "3.1" // inspection certificate, specific inspection by the manufacturer
+	Type32 = "3.2" // inspection certificate, countersigned by the purchaser's inspector
+)
+
+// ErrNoLines is returned when rendering a certificate without lines
+var ErrNoLines = errors.New("certificate has no lines")
+
+// Property is a chemical or mechanical property of a heat with its
+// specified range, e.g. C 0.35 % (0.33 to 0.38) or tensile strength
+// 1040 MPa (min 1000)
+type Property struct {
+	Name  string   `json:"name"`
+	Unit  string   `json:"unit"`
+	Value float64  `json:"value"`
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+}
+
+// Conforms reports whether the value is within the specified range
+func (p Property) Conforms() bool {
+	return (p.Min == nil || p.Value >= *p.Min) && (p.Max == nil || p.Value <= *p.Max)
+}
+
+// Heat is a material heat the products were made from, as certified by
+// the mill
+type Heat struct {
+	HeatNo        string     `json:"heat_no"`
+	Mill          string     `json:"mill"`
+	CertificateNo string     `json:"certificate_no"`
+	MaterialGrade string     `json:"material_grade"`
+	Standard      string     `json:"standard"`
+	Chemical      []Property `json:"chemical"`
+	Mechanical    []Property `json:"mechanical"`
+}
+
+// Result summarizes the measurements of one characteristic in the final
+// inspection
+type Result struct {
+	Characteristic string   `json:"characteristic"`
+	Unit           string   `json:"unit"`
+	Nominal        float64  `json:"nominal"`
+	LSL            *float64 `json:"lsl,omitempty"`
+	USL            *float64 `json:"usl,omitempty"`
+	Count          int      `json:"count"`
+	Min            float64  `json:"min"`
+	Max            float64  `json:"max"`
+	Mean           float64  `json:"mean"`
+	OutOfSpec      int      `json:"out_of_spec"`
+}
+
+// Summarize summarizes the measured values of a characteristic against its
+// specification limits
+func Summarize(characteristic, unit string, nominal float64, lsl, usl *float64, values []float64) Result {
+	r := Result{Characteristic: characteristic, Unit: unit, Nominal: nominal, LSL: lsl, USL: usl, Count: len(values)}
+	if len(values) == 0 {
+		return r
+	}
+	r.Min, r.Max = math.Inf(1), math.Inf(-1)
+	sum := 0.0
+	for _, v := range values {
+		r.Min = math.Min(r.Min, v)
+		r.Max = math.Max(r.Max, v)
+		sum += v
+		if (lsl != nil && v < *lsl) || (usl != nil && v > *usl) {
+			r.OutOfSpec++
+		}
+	}
+	r.Mean = sum / float64(len(values))
+	return r
+}
+
+// Conforms reports whether the characteristic was measured and all
+// measurements are within the specification limits
+func (r Result) Conforms() bool {
+	return r.Count > 0 && r.OutOfSpec == 0
+}
+
+// Line is one shipped product with the inspection and heats it is
+// certified by
+type Line struct {
+	Item              int      `json:"item"`
+	Description       string   `json:"description"`
+	Quantity          float64  `json:"quantity"`
+	Unit              string   `json:"unit"`
+	InspectionNo      string   `json:"inspection_no"`
+	InspectedQuantity float64  `json:"inspected_quantity"`
+	SampleSize        int      `json:"sample_size"`
+	InspectedAt       string   `json:"inspected_at"`
+	Heats             []Heat   `json:"heats"`
+	Results           []Result `json:"results"`
+}
+
+// Document is the content of a certificate
+type Document struct {
+	CertificateNo       string
+	Type                string
+	IssuedAt            time.Time
+	Manufacturer        string
+	ManufacturerAddress string
+	Purchaser           string
+	OrderNo             string
+	CustomerPO          string
+	ShipmentNo          string
+	Lines               []Line
+	Representative      string // authorized inspection representative of the manufacturer
+	KeyID               string
+	VerifyURL           string
+}
+
+// Nonconformities lists the heat properties and inspection results that do
+// not meet their specification; a certificate of conformity cannot be
+// issued while there are any
+func Nonconformities(doc *Document) []string {
+	var found []string
+	for _, line := range doc.Lines {
+		for _, heat := range line.Heats {
+			for _, p := range append(append([]Property{}, heat.Chemical...), heat.Mechanical...) {
+				if !p.Conforms() {
+					found = append(found, fmt.Sprintf("item %d heat %s: %s %s outside %s",
+						line.Item, heat.HeatNo, p.Name, formatValue(p.Value), formatRange(p.Min, p.Max)))
+				}
+			}
+		}
+		for _, r := range line.Results {
+			switch {
+			case r.Count == 0:
+				found = append(found, fmt.Sprintf("item %d: %s not measured", line.Item, r.Characteristic))
+			case r.OutOfSpec > 0:
+				found = append(found, fmt.Sprintf("item %d: %d of %d %s measurements outside %s",
+					line.Item, r.OutOfSpec, r.Count, r.Characteristic, formatRange(r.LSL, r.USL)))
+			}
+		}
+	}
+	return found
+}
+
+// Digest returns the hex encoded SHA-256 digest a certificate file is
+// looked up by
+func Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Render renders the certificate as PDF. The output only depends on the
+// document, so a certificate renders to the same digest every time.
+func Render(doc *Document) ([]byte, error) {
+	if len(doc.Lines) == 0 {
+		return nil, ErrNoLines
+	}
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetCreationDate(doc.IssuedAt)
+	pdf.SetModificationDate(doc.IssuedAt)
+	pdf.SetTitle("Inspection certificate "+doc.CertificateNo, true)
+	pdf.SetAuthor(doc.Manufacturer, true)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Arial", "I", 7)
+		pdf.CellFormat(0, 5, tr(fmt.Sprintf("%s - page %d/{nb}", doc.CertificateNo, pdf.PageNo())), "", 0, "R", false, 0, "")
+	})
+	pdf.AliasNbPages("")
+	pdf.AddPage()
+
+	pdf.SetFont("Arial", "B", 15)
+	pdf.CellFormat(0, 8, "INSPECTION CERTIFICATE "+doc.Type, "", 1, "C", false, 0, "")
+	pdf.SetFont("Arial", "", 9)
+	pdf.CellFormat(0, 5, "according to EN 10204:2004", "", 1, "C", false, 0, "")
+	pdf.Ln(3)
+
+	// Parties and references
+	y := pdf.GetY()
+	pdf.SetXY(10, y)
+	pdf.MultiCell(95, 5, tr(fmt.Sprintf("Manufacturer:\n%s\n%s\n\nPurchaser:\n%s",
+		doc.Manufacturer, doc.ManufacturerAddress, doc.Purchaser)), "1", "L", false)
+	left := pdf.GetY()
+	pdf.SetXY(105, y)
+	pdf.MultiCell(95, 5, tr(fmt.Sprintf("Certificate No: %s\nDate of issue: %s\nShipment No: %s\nOrder No: %s\nCustomer PO: %s",
+		doc.CertificateNo, doc.IssuedAt.Format("2006-01-02"), doc.ShipmentNo, doc.OrderNo, doc.CustomerPO)), "1", "L", false)
+	pdf.SetY(math.Max(left, pdf.GetY()) + 4)
+
+	for _, line := range doc.Lines {
+		pdf.SetFont("Arial", "B", 10)
+		pdf.SetFillColor(230, 230, 230)
+		pdf.CellFormat(0, 7, tr(fmt.Sprintf("Item %d: %s - %s %s", line.Item, line.Description, formatValue(line.Quantity), line.Unit)),
+			"1", 1, "L", true, 0, "")
+		pdf.SetFont("Arial", "", 8)
+		pdf.CellFormat(0, 5, tr(fmt.Sprintf("Final inspection %s on %s: %s %s inspected, sample size %d",
+			line.InspectionNo, line.InspectedAt, formatValue(line.InspectedQuantity), line.Unit, line.SampleSize)), "", 1, "L", false, 0, "")
+		pdf.Ln(1)
+
+		for _, heat := range line.Heats {
+			pdf.SetFont("Arial", "B", 8)
+			pdf.CellFormat(0, 5, tr(fmt.Sprintf("Heat %s - %s %s, mill %s, mill certificate %s",
+				heat.HeatNo, heat.MaterialGrade, heat.Standard, heat.Mill, heat.CertificateNo)), "", 1, "L", false, 0, "")
+			writePropertyTable(pdf, tr, "Chemical composition", heat.Chemical)
+			writePropertyTable(pdf, tr, "Mechanical properties", heat.Mechanical)
+		}
+
+		if len(line.Results) > 0 {
+			pdf.SetFont("Arial", "B", 8)
+			pdf.CellFormat(0, 5, "Inspection results", "", 1, "L", false, 0, "")
+			writeTable(pdf, tr,
+				[]string{"Characteristic", "Unit", "Nominal", "LSL", "USL", "n", "Min", "Max", "Mean", "Result"},
+				[]float64{40, 14, 18, 18, 18, 10, 18, 18, 18, 18},
+				resultRows(line.Results))
+		}
+		pdf.Ln(3)
+	}
+
+	pdf.Ln(2)
+	pdf.SetFont("Arial", "", 8)
+	pdf.MultiCell(0, 4.5, "We hereby certify that the products described above comply with the requirements of the order "+
+		"and that the test results are based on specific inspection carried out on the products supplied or on "+
+		"products of the same manufacturing lot, with the material test results as certified by the mill.", "", "L", false)
+	pdf.Ln(2)
+	pdf.CellFormat(0, 5, tr("Authorized inspection representative: "+doc.Representative), "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+	pdf.SetFont("Arial", "I", 7)
+	verify := "This certificate is signed electronically with key " + doc.KeyID + ". Its authenticity can be verified by looking up the SHA-256 hash of this file"
+	if doc.VerifyURL != "" {
+		verify += " at " + doc.VerifyURL
+	}
+	pdf.MultiCell(0, 4, tr(verify+"."), "", "L", false)
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writePropertyTable(pdf *gofpdf.Fpdf, tr func(string) string, title string, properties []Property) {
+	if len(properties) == 0 {
+		return
+	}
+	rows := make([][]string, len(properties))
+	for i, p := range properties {
+		rows[i] = []string{p.Name, p.Unit, formatBound(p.Min), formatBound(p.Max), formatValue(p.Value), conformity(p.Conforms())}
+	}
+	pdf.SetFont("Arial", "", 8)
+	pdf.CellFormat(0, 5, title, "", 1, "L", false, 0, "")
+	writeTable(pdf, tr, []string{"Property", "Unit", "Min", "Max", "Actual", "Result"}, []float64{50, 20, 25, 25, 25, 20}, rows)
+}
+
+func resultRows(results []Result) [][]string {
+	rows := make([][]string, len(results))
+	for i, r := range results {
+		rows[i] = []string{r.Characteristic, r.Unit, formatValue(r.Nominal), formatBound(r.LSL), formatBound(r.USL),
+			strconv.Itoa(r.Count), formatValue(r.Min), formatValue(r.Max), formatValue(math.Round(r.Mean*1e4)/1e4), conformity(r.Conforms())}
+	}
+	return rows
+}
+
+func writeTable(pdf *gofpdf.Fpdf, tr func(string) string, headers []string, widths []float64, rows [][]string) {
+	pdf.SetFont("Arial", "B", 7)
+	pdf.SetFillColor(240, 240, 240)
+	for i, h := range headers {
+		pdf.CellFormat(widths[i], 5, h, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Arial", "", 7)
+	for _, row := range rows {
+		for i, v := range row {
+			align := "R"
+			if i == 0 {
+				align = "L"
+			}
+			pdf.CellFormat(widths[i], 5, tr(v), "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.Ln(1)
+}
+
+func conformity(ok bool) string {
+	if ok {
+		return "OK"
+	}
+	return "NOT OK"
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func formatBound(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return formatValue(*v)
+}
+
+func formatRange(min, max *float64) string {
+	switch {
+	case min != nil && max != nil:
+		return fmt.Sprintf("%s to %s", formatValue(*min), formatValue(*max))
+	case min != nil:
+		return "min " + formatValue(*min)
+	case max != nil:
+		return "max " + formatValue(*max)
+	}
+	return "no limits"
+}
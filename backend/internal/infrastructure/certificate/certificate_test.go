@@ -0,0 +1,114 @@
+package certificate
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func limit(v float64) *float64 { return &v }
+
+func sampleDocument() *Document {
+	return &Document{
+		CertificateNo:       "CERT-202610-000001",
+		Type:                Type31,
+		IssuedAt:            time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC),
+		Manufacturer:        "FastenMind Corporation",
+		ManufacturerAddress: "123 Industrial Avenue",
+		Purchaser:           "Müller Bau GmbH",
+		OrderNo:             "SO-202610-000123",
+		ShipmentNo:          "SH-202610-000045",
+		Representative:      "QA Manager",
+		KeyID:               "rsa-0011223344556677",
+		VerifyURL:           "https://erp.example.com/api/v1/certificates/verify",
+		Lines: []Line{{
+			Item:              1,
+			Description:       "Hex bolt ISO 4017 M10x40 8.8",
+			Quantity:          20000,
+			Unit:              "PCS",
+			InspectionNo:      "QI-202610-000007",
+			InspectedQuantity: 20000,
+			SampleSize:        125,
+			InspectedAt:       "2026-10-15",
+			Heats: []Heat{{
+				HeatNo:        "H24-1187",
+				Mill:          "China Steel",
+				CertificateNo: "CS-MTC-55120",
+				MaterialGrade: "SCM435",
+				Standard:      "JIS G4053",
+				Chemical: []Property{
+					{Name: "C", Unit: "%", Value: 0.36, Min: limit(0.33), Max: limit(0.38)},
+					{Name: "P", Unit: "%", Value: 0.012, Max: limit(0.030)},
+				},
+				Mechanical: []Property{
+					{Name: "Tensile strength", Unit: "MPa", Value: 860, Min: limit(800)},
+				},
+			}},
+			Results: []Result{
+				Summarize("Pitch diameter", "mm", 9.026, limit(8.862), limit(9.026), []float64{8.95, 8.97, 8.99}),
+				Summarize("Hardness", "HRC", 27, limit(22), limit(32), []float64{26, 27, 28}),
+			},
+		}},
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	r := Summarize("Head height", "mm", 6.4, limit(6.22), limit(6.58), []float64{6.30, 6.40, 6.60})
+	assert.Equal(t, 3, r.Count)
+	assert.InDelta(t, 6.30, r.Min, 1e-9)
+	assert.InDelta(t, 6.60, r.Max, 1e-9)
+	assert.InDelta(t, 6.4333333, r.Mean, 1e-6)
+	assert.Equal(t, 1, r.OutOfSpec)
+	assert.False(t, r.Conforms())
+
+	empty := Summarize("Torque", "N·m", 50, nil, nil, nil)
+	assert.Zero(t, empty.Count)
+	assert.False(t, empty.Conforms(), "an unmeasured characteristic does not conform")
+}
+
+func TestPropertyConforms(t *testing.T) {
+	assert.True(t, Property{Value: 0.35, Min: limit(0.33), Max: limit(0.38)}.Conforms())
+	assert.True(t, Property{Value: 0.38, Max: limit(0.38)}.Conforms(), "limits are inclusive")
+	assert.False(t, Property{Value: 780, Min: limit(800)}.Conforms())
+	assert.True(t, Property{Value: 12}.Conforms(), "no limits")
+}
+
+func TestNonconformities(t *testing.T) {
+	doc := sampleDocument()
+	assert.Empty(t, Nonconformities(doc))
+
+	doc.Lines[0].Heats[0].Mechanical[0].Value = 780
+	doc.Lines[0].Results = append(doc.Lines[0].Results,
+		Summarize("Pitch diameter", "mm", 9.026, limit(8.862), limit(9.026), []float64{9.03}))
+	found := Nonconformities(doc)
+	require.Len(t, found, 2)
+	assert.Equal(t, "item 1 heat H24-1187: Tensile strength 780 outside min 800", found[0])
+	assert.Equal(t, "item 1: 1 of 1 Pitch diameter measurements outside 8.862 to 9.026", found[1])
+}
+
+func TestRender(t *testing.T) {
+	doc := sampleDocument()
+	content, err := Render(doc)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(content, []byte("%PDF-")))
+
+	again, err := Render(doc)
+	require.NoError(t, err)
+	assert.Equal(t, Digest(content), Digest(again), "rendering is deterministic")
+
+	doc.Lines[0].Quantity = 19000
+	changed, err := Render(doc)
+	require.NoError(t, err)
+	assert.NotEqual(t, Digest(content), Digest(changed))
+
+	_, err = Render(&Document{})
+	assert.ErrorIs(t, err, ErrNoLines)
+}
+
+func TestDigest(t *testing.T) {
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", Digest(nil))
+	assert.Len(t, Digest([]byte("certificate")), 64)
+}
@@ -0,0 +1,142 @@
+// Package costversion keeps effective-dated versions of cost templates and
+// rate tables. A revision ends the current version on the day the next one
+// takes effect and links the next one to it, so all versions of a template
+// or rate form one chain, and the version valid on a given day can be found
+// to re-cost a quote as of the day it was issued.
+package costversion
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrSuperseded is returned when revising a version that has already
+	// been ended by another revision
+	ErrSuperseded = errors.New("version has already been superseded")
+	// ErrInvalidEffectiveDate is returned when a revision would take effect
+	// before the version it replaces
+	ErrInvalidEffectiveDate = errors.New("valid_from must be after the valid_from of the current version")
+)
+
+// Version is one version of a template or rate: its number and the period
+// it is valid, from ValidFrom up to but excluding ValidTo. A zero ValidFrom,
+// left by rows stored before versioning, is valid from the beginning; a nil
+// ValidTo is the open, current version.
+type Version struct {
+	Number    int
+	ValidFrom time.Time
+	ValidTo   *time.Time
+}
+
+// ValidAt reports whether the version is valid at t
+func (v Version) ValidAt(t time.Time) bool {
+	if !v.ValidFrom.IsZero() && v.ValidFrom.After(t) {
+		return false
+	}
+	return v.ValidTo == nil || v.ValidTo.After(t)
+}
+
+// At returns the index of the version valid at t, the highest numbered one
+// when periods overlap, or -1 when none is
+func At(versions []Version, t time.Time) int {
+	found := -1
+	for i, v := range versions {
+		if v.ValidAt(t) && (found < 0 || v.Number > versions[found].Number) {
+			found = i
+		}
+	}
+	return found
+}
+
+// CheckRevision checks that current can be revised by a version taking
+// effect on effective: only the open version can be revised, and the new
+// one has to take effect after it
+func CheckRevision(current Version, effective time.Time) error {
+	if current.ValidTo != nil {
+		return ErrSuperseded
+	}
+	if !effective.After(current.ValidFrom) {
+		return ErrInvalidEffectiveDate
+	}
+	return nil
+}
+
+// NextNumber is the number of the version revising number. Rows stored
+// before versioning have no number and count as version 1.
+func NextNumber(number int) int {
+	if number < 1 {
+		return 2
+	}
+	return number + 1
+}
+
+// Link is a version in a chain: its ID and the ID of the version it
+// superseded, empty for the first version
+type Link struct {
+	ID           string
+	SupersedesID string
+}
+
+// Store reads and writes the versions of one table
+type Store interface {
+	// Get returns the version with id; ok is false when there is none
+	Get(id string) (link Link, ok bool, err error)
+	// SupersededBy returns the version superseding id; ok is false when id
+	// is the latest version
+	SupersededBy(id string) (link Link, ok bool, err error)
+	// End sets the valid_to of id to effective if id is still open and
+	// reports whether it was
+	End(id string, effective time.Time) (bool, error)
+	// Create stores a new version
+	Create(version interface{}) error
+}
+
+// Chain returns the IDs of the chain start belongs to: start, the versions
+// it superseded from the newest back, then the versions superseding it. A
+// missing or repeated link ends the walk in that direction.
+func Chain(store Store, start Link) ([]string, error) {
+	ids := []string{start.ID}
+	seen := map[string]bool{start.ID: true}
+
+	for prev := start.SupersedesID; prev != "" && !seen[prev]; {
+		older, ok, err := store.Get(prev)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		ids = append(ids, older.ID)
+		seen[older.ID] = true
+		prev = older.SupersedesID
+	}
+
+	for next := start.ID; ; {
+		newer, ok, err := store.SupersededBy(next)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || seen[newer.ID] {
+			break
+		}
+		ids = append(ids, newer.ID)
+		seen[newer.ID] = true
+		next = newer.ID
+	}
+	return ids, nil
+}
+
+// Revise ends the version currentID on effective and stores next. Run it in
+// a transaction: when another revision ended currentID first, nothing is
+// stored and ErrSuperseded is returned.
+func Revise(store Store, currentID string, effective time.Time, next interface{}) error {
+	ended, err := store.End(currentID, effective)
+	if err != nil {
+		return err
+	}
+	if !ended {
+		return ErrSuperseded
+	}
+	return store.Create(next)
+}
@@ -0,0 +1,184 @@
+package costversion
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func day(d int) time.Time {
+	return time.Date(2026, time.January, d, 0, 0, 0, 0, time.UTC)
+}
+
+func dayPtr(d int) *time.Time {
+	t := day(d)
+	return &t
+}
+
+// memoryStore keeps versions in memory, keyed by ID
+type memoryStore struct {
+	links   map[string]Link
+	open    map[string]bool
+	ended   map[string]time.Time
+	created []interface{}
+	err     error
+}
+
+func newMemoryStore(links ...Link) *memoryStore {
+	s := &memoryStore{links: map[string]Link{}, open: map[string]bool{}, ended: map[string]time.Time{}}
+	for _, l := range links {
+		s.links[l.ID] = l
+		s.open[l.ID] = true
+	}
+	return s
+}
+
+func (s *memoryStore) Get(id string) (Link, bool, error) {
+	l, ok := s.links[id]
+	return l, ok, s.err
+}
+
+func (s *memoryStore) SupersededBy(id string) (Link, bool, error) {
+	for _, l := range s.links {
+		if l.SupersedesID == id {
+			return l, true, s.err
+		}
+	}
+	return Link{}, false, s.err
+}
+
+func (s *memoryStore) End(id string, effective time.Time) (bool, error) {
+	if s.err != nil || !s.open[id] {
+		return false, s.err
+	}
+	s.open[id] = false
+	s.ended[id] = effective
+	return true, nil
+}
+
+func (s *memoryStore) Create(version interface{}) error {
+	s.created = append(s.created, version)
+	return nil
+}
+
+func TestVersionValidAt(t *testing.T) {
+	tests := []struct {
+		name    string
+		version Version
+		at      time.Time
+		want    bool
+	}{
+		{"before valid_from", Version{ValidFrom: day(10)}, day(9), false},
+		{"on valid_from", Version{ValidFrom: day(10)}, day(10), true},
+		{"open version", Version{ValidFrom: day(10)}, day(31), true},
+		{"before valid_to", Version{ValidFrom: day(10), ValidTo: dayPtr(20)}, day(19), true},
+		{"valid_to is excluded", Version{ValidFrom: day(10), ValidTo: dayPtr(20)}, day(20), false},
+		{"no valid_from is valid from the beginning", Version{}, day(1), true},
+		{"no valid_from still ends", Version{ValidTo: dayPtr(5)}, day(5), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.version.ValidAt(tt.at))
+		})
+	}
+}
+
+func TestAt(t *testing.T) {
+	// version 1 predates versioning and has no valid_from
+	versions := []Version{
+		{Number: 3, ValidFrom: day(20)},
+		{Number: 1, ValidTo: dayPtr(10)},
+		{Number: 2, ValidFrom: day(10), ValidTo: dayPtr(20)},
+	}
+	assert.Equal(t, 1, At(versions, day(1)))
+	assert.Equal(t, 1, At(versions, day(9)))
+	assert.Equal(t, 2, At(versions, day(10)))
+	assert.Equal(t, 0, At(versions, day(20)))
+	assert.Equal(t, 0, At(versions, day(31)))
+
+	future := []Version{{Number: 1, ValidFrom: day(15)}}
+	assert.Equal(t, -1, At(future, day(14)))
+	assert.Equal(t, -1, At(nil, day(14)))
+
+	// overlapping periods prefer the later version
+	overlap := []Version{{Number: 1, ValidFrom: day(1)}, {Number: 2, ValidFrom: day(1)}}
+	assert.Equal(t, 1, At(overlap, day(5)))
+}
+
+func TestCheckRevision(t *testing.T) {
+	assert.NoError(t, CheckRevision(Version{ValidFrom: day(10)}, day(11)))
+	assert.NoError(t, CheckRevision(Version{}, day(1)), "rows from before versioning can be revised")
+	assert.ErrorIs(t, CheckRevision(Version{ValidFrom: day(10)}, day(10)), ErrInvalidEffectiveDate)
+	assert.ErrorIs(t, CheckRevision(Version{ValidFrom: day(10)}, day(9)), ErrInvalidEffectiveDate)
+	assert.ErrorIs(t, CheckRevision(Version{ValidFrom: day(10), ValidTo: dayPtr(20)}, day(25)), ErrSuperseded)
+}
+
+func TestNextNumber(t *testing.T) {
+	assert.Equal(t, 2, NextNumber(0))
+	assert.Equal(t, 2, NextNumber(1))
+	assert.Equal(t, 6, NextNumber(5))
+}
+
+func TestChain(t *testing.T) {
+	store := newMemoryStore(
+		Link{ID: "v1"},
+		Link{ID: "v2", SupersedesID: "v1"},
+		Link{ID: "v3", SupersedesID: "v2"},
+		Link{ID: "v4", SupersedesID: "v3"},
+		Link{ID: "other"},
+	)
+
+	tests := []struct {
+		start string
+		want  []string
+	}{
+		{"v1", []string{"v1", "v2", "v3", "v4"}},
+		{"v3", []string{"v3", "v2", "v1", "v4"}},
+		{"v4", []string{"v4", "v3", "v2", "v1"}},
+		{"other", []string{"other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.start, func(t *testing.T) {
+			ids, err := Chain(store, store.links[tt.start])
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+}
+
+func TestChainStopsAtBrokenAndCyclicLinks(t *testing.T) {
+	// v1 was deleted
+	broken := newMemoryStore(Link{ID: "v2", SupersedesID: "v1"}, Link{ID: "v3", SupersedesID: "v2"})
+	ids, err := Chain(broken, broken.links["v3"])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v3", "v2"}, ids)
+
+	cyclic := newMemoryStore(Link{ID: "a", SupersedesID: "b"}, Link{ID: "b", SupersedesID: "a"})
+	ids, err = Chain(cyclic, cyclic.links["a"])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids)
+
+	failing := newMemoryStore(Link{ID: "v2", SupersedesID: "v1"})
+	failing.err = errors.New("connection reset")
+	_, err = Chain(failing, failing.links["v2"])
+	assert.EqualError(t, err, "connection reset")
+}
+
+func TestRevise(t *testing.T) {
+	store := newMemoryStore(Link{ID: "v1"})
+
+	require.NoError(t, Revise(store, "v1", day(15), "v2"))
+	assert.Equal(t, day(15), store.ended["v1"])
+	assert.Equal(t, []interface{}{"v2"}, store.created)
+
+	// a second revision of v1 lost the race to the first
+	assert.ErrorIs(t, Revise(store, "v1", day(20), "v2b"), ErrSuperseded)
+	assert.Equal(t, []interface{}{"v2"}, store.created, "nothing is stored for the losing revision")
+
+	store.err = errors.New("connection reset")
+	assert.EqualError(t, Revise(store, "v2", day(25), "v3"), "connection reset")
+	assert.Equal(t, []interface{}{"v2"}, store.created)
+}
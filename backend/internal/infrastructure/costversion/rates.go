@@ -0,0 +1,64 @@
+package costversion
+
+// SurfaceRate is a surface treatment rate version: BaseRate per piece, kg
+// or m², raised to MinCharge for small lots
+type SurfaceRate struct {
+	BaseRate  float64
+	Unit      string // per_piece, per_kg, per_m2
+	MinCharge float64
+}
+
+// SurfaceCharge prices the surface treatment of pieces parts weighing
+// weightKg with a surface of areaCm2 each. It returns the quantity billed in
+// the unit of the rate, the cost and whether the minimum charge applied.
+func SurfaceCharge(rate SurfaceRate, pieces int, weightKg, areaCm2 float64) (billed, cost float64, minimum bool) {
+	billed = float64(pieces)
+	switch rate.Unit {
+	case "per_kg":
+		billed = weightKg * float64(pieces)
+	case "per_m2":
+		billed = areaCm2 / 10000 * float64(pieces)
+	}
+	cost = billed * rate.BaseRate
+	if cost < rate.MinCharge {
+		return billed, rate.MinCharge, true
+	}
+	return billed, cost, false
+}
+
+// OverheadRate is an overhead rate version of a department: a percentage of
+// the cost it is based on, or a fixed amount
+type OverheadRate struct {
+	RateType  string // percentage, fixed
+	RateValue float64
+	BasedOn   string // material_cost, process_cost, total_cost
+}
+
+// CostBase is the cost overhead percentages apply to
+type CostBase struct {
+	Material float64
+	Process  float64
+	Surface  float64
+}
+
+// Overhead sums the overhead of the department rates in force. Percentages
+// based on total cost, or on nothing named, apply to material, processing
+// and surface treatment cost together.
+func Overhead(rates []OverheadRate, base CostBase) float64 {
+	total := 0.0
+	for _, rate := range rates {
+		if rate.RateType != "percentage" {
+			total += rate.RateValue
+			continue
+		}
+		amount := base.Material + base.Process + base.Surface
+		switch rate.BasedOn {
+		case "material_cost":
+			amount = base.Material
+		case "process_cost":
+			amount = base.Process
+		}
+		total += amount * rate.RateValue / 100
+	}
+	return total
+}
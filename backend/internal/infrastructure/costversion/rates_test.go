@@ -0,0 +1,77 @@
+package costversion
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSurfaceCharge(t *testing.T) {
+	tests := []struct {
+		name        string
+		rate        SurfaceRate
+		wantBilled  float64
+		wantCost    float64
+		wantMinimum bool
+	}{
+		{"per piece", SurfaceRate{BaseRate: 0.02, Unit: "per_piece"}, 10000, 200, false},
+		{"per kg", SurfaceRate{BaseRate: 1.5, Unit: "per_kg"}, 400, 600, false},
+		{"per m2", SurfaceRate{BaseRate: 8, Unit: "per_m2"}, 25, 200, false},
+		{"minimum charge", SurfaceRate{BaseRate: 0.02, Unit: "per_piece", MinCharge: 500}, 10000, 500, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 10,000 bolts of 40 g with 25 cm² of surface each
+			billed, cost, minimum := SurfaceCharge(tt.rate, 10000, 0.04, 25)
+			assert.InDelta(t, tt.wantBilled, billed, 1e-9)
+			assert.InDelta(t, tt.wantCost, cost, 1e-9)
+			assert.Equal(t, tt.wantMinimum, minimum)
+		})
+	}
+}
+
+func TestOverhead(t *testing.T) {
+	base := CostBase{Material: 1000, Process: 600, Surface: 400}
+	rates := []OverheadRate{
+		{RateType: "percentage", RateValue: 10, BasedOn: "material_cost"},
+		{RateType: "percentage", RateValue: 5, BasedOn: "process_cost"},
+		{RateType: "percentage", RateValue: 2, BasedOn: "total_cost"},
+		{RateType: "fixed", RateValue: 25},
+	}
+	assert.InDelta(t, 100+30+40+25, Overhead(rates, base), 1e-9)
+	assert.Zero(t, Overhead(nil, base))
+}
+
+// A quote costed as of a day before a rate revision is priced at the version
+// in force that day, not at the current one
+func TestRatesAsOfBeforeRevision(t *testing.T) {
+	// Zinc plating went from 0.02 to 0.03 per piece on the 15th; factory
+	// overhead went from 8% to 12% on the 20th
+	surface := []Version{{Number: 1, ValidTo: dayPtr(15)}, {Number: 2, ValidFrom: day(15)}}
+	surfaceRates := []SurfaceRate{{BaseRate: 0.02, Unit: "per_piece"}, {BaseRate: 0.03, Unit: "per_piece"}}
+	overhead := []Version{{Number: 1, ValidFrom: day(1), ValidTo: dayPtr(20)}, {Number: 2, ValidFrom: day(20)}}
+	overheadRates := []OverheadRate{
+		{RateType: "percentage", RateValue: 8, BasedOn: "total_cost"},
+		{RateType: "percentage", RateValue: 12, BasedOn: "total_cost"},
+	}
+	base := CostBase{Material: 1000, Process: 500, Surface: 500}
+
+	tests := []struct {
+		name         string
+		asOf         int
+		wantSurface  float64
+		wantOverhead float64
+	}{
+		{"before both revisions", 10, 200, 160},
+		{"between the revisions", 17, 300, 160},
+		{"after both revisions", 25, 300, 240},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, cost, _ := SurfaceCharge(surfaceRates[At(surface, day(tt.asOf))], 10000, 0.04, 25)
+			assert.InDelta(t, tt.wantSurface, cost, 1e-9)
+			rate := overheadRates[At(overhead, day(tt.asOf))]
+			assert.InDelta(t, tt.wantOverhead, Overhead([]OverheadRate{rate}, base), 1e-9)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// Package credit holds the rules of the customer credit engine: exposure
+// against the credit limit, the decision to hold an order or shipment, and
+// the credit status derived from payment behavior.
+//
+// Exposure is open receivables plus confirmed orders not yet shipped plus
+// approved quotes not yet converted, less what credit insurance covers. All
+// amounts are in the currency of the credit limit; converting them is left
+// to the caller.
+package credit
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/domain/valueobject"
+)
+
+// Exposure is a customer's live credit exposure
+type Exposure struct {
+	Currency       string                   `json:"currency"`
+	OpenAR         float64                  `json:"open_ar"`
+	OpenOrders     float64                  `json:"open_orders"` // confirmed, not yet shipped
+	OpenQuotes     float64                  `json:"open_quotes"` // approved, not yet converted
+	Gross          float64                  `json:"gross"`
+	Insured        float64                  `json:"insured"` // covered by credit insurance
+	Net            float64                  `json:"net"`
+	CreditLimit    float64                  `json:"credit_limit"` // zero when the customer has no limit
+	Status         valueobject.CreditStatus `json:"status"`
+	EffectiveLimit float64                  `json:"effective_limit"` // credit limit scaled by the status
+	Available      float64                  `json:"available"`
+	Utilization    float64                  `json:"utilization"` // net exposure over the effective limit, in percent
+}
+
+// NewExposure totals the components of an exposure. Insurance covers the
+// exposure up to insuredAmount.
+func NewExposure(currency string, openAR, openOrders, openQuotes, insuredAmount, creditLimit float64, status valueobject.CreditStatus) Exposure {
+	e := Exposure{
+		Currency:    currency,
+		OpenAR:      round(openAR),
+		OpenOrders:  round(openOrders),
+		OpenQuotes:  round(openQuotes),
+		CreditLimit: round(creditLimit),
+		Status:      status,
+	}
+	e.Gross = round(e.OpenAR + e.OpenOrders + e.OpenQuotes)
+	e.Insured = round(math.Max(0, math.Min(insuredAmount, e.Gross)))
+	e.Net = round(e.Gross - e.Insured)
+	if e.CreditLimit > 0 {
+		e.EffectiveLimit = round(e.CreditLimit * status.GetCreditLimit())
+		e.Available = round(e.EffectiveLimit - e.Net)
+		if e.EffectiveLimit > 0 {
+			e.Utilization = round(e.Net / e.EffectiveLimit * 100)
+		}
+	}
+	return e
+}
+
+// Decision is the outcome of a credit check
+type Decision struct {
+	Hold      bool    `json:"hold"`
+	Reason    string  `json:"reason,omitempty"`
+	Amount    float64 `json:"amount"`    // added by the checked document
+	Projected float64 `json:"projected"` // net exposure with the document
+}
+
+// Check decides whether a document adding amount to the exposure is held.
+// Blocked customers are always held; otherwise the projected exposure may
+// not exceed the effective limit. Customers without a limit are only held
+// when blocked.
+func Check(e Exposure, amount float64) Decision {
+	d := Decision{Amount: round(amount), Projected: round(e.Net + amount)}
+	switch {
+	case e.Status == valueobject.CreditStatusBlocked:
+		d.Hold, d.Reason = true, "credit status is BLOCKED"
+	case e.CreditLimit > 0 && d.Projected > e.EffectiveLimit:
+		d.Hold = true
+		d.Reason = fmt.Sprintf("exposure %.2f %s exceeds the %s credit limit of %.2f", d.Projected, e.Currency, e.Status, e.EffectiveLimit)
+	}
+	return d
+}
+
+// Settlement is an invoice amount with the date it was due and the date it
+// was paid; open amounts have no settlement date
+type Settlement struct {
+	Amount    float64
+	DueDate   time.Time
+	SettledAt *time.Time
+}
+
+// History summarizes a customer's payment behavior
+type History struct {
+	Settled         int     `json:"settled"`           // paid amounts considered
+	DaysBeyondTerms float64 `json:"days_beyond_terms"` // amount-weighted average days paid after due
+	OverdueAmount   float64 `json:"overdue_amount"`
+	MaxOverdueDays  int     `json:"max_overdue_days"` // oldest open amount past due
+}
+
+// PaymentHistory weighs how late settlements were paid by their amount.
+// Early payments count as on time. Open amounts past due count with their
+// days overdue so far, so a customer who stops paying deteriorates.
+func PaymentHistory(settlements []Settlement, now time.Time) History {
+	var h History
+	var weighted, total float64
+	for _, s := range settlements {
+		if s.Amount <= 0 {
+			continue
+		}
+		end := now
+		if s.SettledAt != nil {
+			end = *s.SettledAt
+			h.Settled++
+		}
+		days := daysBetween(s.DueDate, end)
+		if s.SettledAt == nil {
+			if days <= 0 {
+				continue
+			}
+			h.OverdueAmount += s.Amount
+			if days > h.MaxOverdueDays {
+				h.MaxOverdueDays = days
+			}
+		}
+		if days < 0 {
+			days = 0
+		}
+		weighted += float64(days) * s.Amount
+		total += s.Amount
+	}
+	if total > 0 {
+		h.DaysBeyondTerms = math.Round(weighted/total*10) / 10
+	}
+	h.OverdueAmount = round(h.OverdueAmount)
+	return h
+}
+
+// Policy holds the thresholds that move a customer between credit statuses
+type Policy struct {
+	WarningDaysBeyondTerms float64 `json:"warning_days_beyond_terms"`
+	BlockDaysBeyondTerms   float64 `json:"block_days_beyond_terms"`
+	WarningOverdueDays     int     `json:"warning_overdue_days"`
+	BlockOverdueDays       int     `json:"block_overdue_days"`
+}
+
+// DefaultPolicy warns at two weeks beyond terms or a month overdue and
+// blocks at six weeks beyond terms or three months overdue
+func DefaultPolicy() Policy {
+	return Policy{
+		WarningDaysBeyondTerms: 15,
+		BlockDaysBeyondTerms:   45,
+		WarningOverdueDays:     30,
+		BlockOverdueDays:       90,
+	}
+}
+
+// Assess derives the credit status a payment history earns and the reason.
+// Customers without any paid or overdue amount stay NEW.
+func Assess(h History, p Policy) (valueobject.CreditStatus, string) {
+	switch {
+	case h.MaxOverdueDays >= p.BlockOverdueDays:
+		return valueobject.CreditStatusBlocked, fmt.Sprintf("%.2f overdue for %d days", h.OverdueAmount, h.MaxOverdueDays)
+	case h.DaysBeyondTerms >= p.BlockDaysBeyondTerms:
+		return valueobject.CreditStatusBlocked, fmt.Sprintf("pays %.1f days beyond terms on average", h.DaysBeyondTerms)
+	case h.MaxOverdueDays >= p.WarningOverdueDays:
+		return valueobject.CreditStatusWarning, fmt.Sprintf("%.2f overdue for %d days", h.OverdueAmount, h.MaxOverdueDays)
+	case h.DaysBeyondTerms >= p.WarningDaysBeyondTerms:
+		return valueobject.CreditStatusWarning, fmt.Sprintf("pays %.1f days beyond terms on average", h.DaysBeyondTerms)
+	case h.Settled == 0 && h.OverdueAmount == 0:
+		return valueobject.CreditStatusNew, "no payment history"
+	}
+	return valueobject.CreditStatusGood, fmt.Sprintf("pays %.1f days beyond terms on average", h.DaysBeyondTerms)
+}
+
+// Next returns the status a customer moves to from current when the history
+// earns assessed. Moves the status rules do not allow, such as back to NEW,
+// keep the current status.
+func Next(current, assessed valueobject.CreditStatus) valueobject.CreditStatus {
+	if current == "" {
+		return assessed
+	}
+	if current == assessed || !current.CanTransitionTo(assessed) {
+		return current
+	}
+	return assessed
+}
+
+func daysBetween(from, to time.Time) int {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
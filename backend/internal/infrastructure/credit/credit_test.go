@@ -0,0 +1,112 @@
+package credit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/domain/valueobject"
+	"github.com/stretchr/testify/assert"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func datePtr(s string) *time.Time {
+	t := date(s)
+	return &t
+}
+
+func TestNewExposure(t *testing.T) {
+	e := NewExposure("USD", 40000, 25000, 10000, 30000, 100000, valueobject.CreditStatusGood)
+	assert.Equal(t, 75000.0, e.Gross)
+	assert.Equal(t, 30000.0, e.Insured)
+	assert.Equal(t, 45000.0, e.Net)
+	assert.Equal(t, 100000.0, e.EffectiveLimit)
+	assert.Equal(t, 55000.0, e.Available)
+	assert.Equal(t, 45.0, e.Utilization)
+
+	// Insurance never covers more than the exposure
+	e = NewExposure("USD", 5000, 0, 0, 30000, 100000, valueobject.CreditStatusGood)
+	assert.Equal(t, 5000.0, e.Insured)
+	assert.Equal(t, 0.0, e.Net)
+
+	// A warning halves the limit
+	e = NewExposure("USD", 40000, 0, 0, 0, 100000, valueobject.CreditStatusWarning)
+	assert.Equal(t, 50000.0, e.EffectiveLimit)
+	assert.Equal(t, 80.0, e.Utilization)
+}
+
+func TestCheck(t *testing.T) {
+	e := NewExposure("USD", 40000, 25000, 10000, 0, 100000, valueobject.CreditStatusGood)
+	assert.False(t, Check(e, 25000).Hold)
+
+	d := Check(e, 25000.01)
+	assert.True(t, d.Hold)
+	assert.Equal(t, 100000.01, d.Projected)
+	assert.Contains(t, d.Reason, "exceeds the GOOD credit limit of 100000.00")
+
+	// Without a limit only the status holds
+	e = NewExposure("USD", 1e9, 0, 0, 0, 0, valueobject.CreditStatusGood)
+	assert.False(t, Check(e, 1e6).Hold)
+	e = NewExposure("USD", 0, 0, 0, 0, 0, valueobject.CreditStatusBlocked)
+	d = Check(e, 1)
+	assert.True(t, d.Hold)
+	assert.Equal(t, "credit status is BLOCKED", d.Reason)
+}
+
+func TestPaymentHistory(t *testing.T) {
+	now := date("2024-06-30")
+	h := PaymentHistory([]Settlement{
+		// 10 days late on 1,000, early on 3,000
+		{Amount: 1000, DueDate: date("2024-03-31"), SettledAt: datePtr("2024-04-10")},
+		{Amount: 3000, DueDate: date("2024-04-30"), SettledAt: datePtr("2024-04-25")},
+		// open 20 days past due
+		{Amount: 1000, DueDate: date("2024-06-10")},
+		// open, not yet due
+		{Amount: 5000, DueDate: date("2024-07-15")},
+	}, now)
+
+	assert.Equal(t, 2, h.Settled)
+	assert.Equal(t, 1000.0, h.OverdueAmount)
+	assert.Equal(t, 20, h.MaxOverdueDays)
+	// (10*1000 + 0*3000 + 20*1000) / 5000
+	assert.Equal(t, 6.0, h.DaysBeyondTerms)
+}
+
+func TestAssess(t *testing.T) {
+	p := DefaultPolicy()
+
+	status, reason := Assess(History{}, p)
+	assert.Equal(t, valueobject.CreditStatusNew, status)
+	assert.Equal(t, "no payment history", reason)
+
+	status, _ = Assess(History{Settled: 12, DaysBeyondTerms: 4}, p)
+	assert.Equal(t, valueobject.CreditStatusGood, status)
+
+	status, _ = Assess(History{Settled: 12, DaysBeyondTerms: 18}, p)
+	assert.Equal(t, valueobject.CreditStatusWarning, status)
+
+	status, reason = Assess(History{Settled: 12, DaysBeyondTerms: 5, OverdueAmount: 800, MaxOverdueDays: 35}, p)
+	assert.Equal(t, valueobject.CreditStatusWarning, status)
+	assert.Equal(t, "800.00 overdue for 35 days", reason)
+
+	status, _ = Assess(History{Settled: 12, DaysBeyondTerms: 50}, p)
+	assert.Equal(t, valueobject.CreditStatusBlocked, status)
+
+	status, _ = Assess(History{Settled: 0, OverdueAmount: 100, MaxOverdueDays: 95}, p)
+	assert.Equal(t, valueobject.CreditStatusBlocked, status)
+}
+
+func TestNext(t *testing.T) {
+	assert.Equal(t, valueobject.CreditStatusGood, Next(valueobject.CreditStatusNew, valueobject.CreditStatusGood))
+	assert.Equal(t, valueobject.CreditStatusWarning, Next(valueobject.CreditStatusGood, valueobject.CreditStatusWarning))
+	assert.Equal(t, valueobject.CreditStatusGood, Next(valueobject.CreditStatusBlocked, valueobject.CreditStatusGood))
+	// Established customers never return to NEW
+	assert.Equal(t, valueobject.CreditStatusGood, Next(valueobject.CreditStatusGood, valueobject.CreditStatusNew))
+	assert.Equal(t, valueobject.CreditStatusNew, Next("", valueobject.CreditStatusNew))
+}
@@ -0,0 +1,278 @@
+// Package dunning holds the rules of the collections workflow: which
+// dunning stage an overdue invoice has reached, interest on late balances,
+// rendering of notices from templates, the outcome of promises to pay and
+// the priority of accounts on the daily collection worklist.
+package dunning
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Stage levels in escalating order
+const (
+	LevelReminder    = "reminder"
+	LevelFirstNotice = "first_notice"
+	LevelFinalNotice = "final_notice"
+	LevelCreditHold  = "credit_hold"
+)
+
+// Promise outcomes
+const (
+	PromiseOpen   = "open"
+	PromiseKept   = "kept"
+	PromiseBroken = "broken"
+)
+
+// ErrInvalidStages is returned when stages are not ordered by days overdue
+var ErrInvalidStages = errors.New("dunning stages must have increasing sequence and days overdue")
+
+var levelRank = map[string]int{
+	LevelReminder:    1,
+	LevelFirstNotice: 2,
+	LevelFinalNotice: 3,
+	LevelCreditHold:  4,
+}
+
+// ValidLevel reports whether level is a known stage level
+func ValidLevel(level string) bool {
+	_, ok := levelRank[level]
+	return ok
+}
+
+// Escalates reports whether level a is more severe than level b
+func Escalates(a, b string) bool {
+	return levelRank[a] > levelRank[b]
+}
+
+// Stage is one step of a dunning policy
+type Stage struct {
+	Sequence    int
+	Level       string
+	DaysOverdue int // days past due before the stage applies
+}
+
+// ValidateStages checks that stages escalate with both sequence and days
+// overdue
+func ValidateStages(stages []Stage) error {
+	for i, s := range stages {
+		if !ValidLevel(s.Level) || s.DaysOverdue < 0 {
+			return fmt.Errorf("%w: stage %d", ErrInvalidStages, s.Sequence)
+		}
+		if i > 0 && (s.Sequence <= stages[i-1].Sequence || s.DaysOverdue <= stages[i-1].DaysOverdue) {
+			return fmt.Errorf("%w: stage %d", ErrInvalidStages, s.Sequence)
+		}
+	}
+	return nil
+}
+
+// NextStage returns the stage following current, the sequence an invoice
+// was last dunned at, once the invoice is overdue long enough for it.
+// Invoices advance one stage at a time so no notice is skipped.
+func NextStage(stages []Stage, current, daysOverdue int) (Stage, bool) {
+	sorted := append([]Stage(nil), stages...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Sequence < sorted[j].Sequence })
+	for _, s := range sorted {
+		if s.Sequence <= current {
+			continue
+		}
+		if daysOverdue >= s.DaysOverdue {
+			return s, true
+		}
+		return Stage{}, false
+	}
+	return Stage{}, false
+}
+
+// DaysOverdue counts whole days from the due date to date
+func DaysOverdue(dueDate, date time.Time) int {
+	due := time.Date(dueDate.Year(), dueDate.Month(), dueDate.Day(), 0, 0, 0, 0, time.UTC)
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(day.Sub(due).Hours() / 24)
+	if days < 0 {
+		return 0
+	}
+	return days
+}
+
+// Interest is simple interest at an annual percentage rate on a balance
+// overdue for more than graceDays, counted from the due date
+func Interest(balance, annualRate float64, daysOverdue, graceDays int) float64 {
+	if balance <= 0 || annualRate <= 0 || daysOverdue <= graceDays {
+		return 0
+	}
+	return Round(balance * annualRate / 100 * float64(daysOverdue) / 365)
+}
+
+// Line is one overdue invoice on a statement
+type Line struct {
+	InvoiceNo   string
+	IssueDate   time.Time
+	DueDate     time.Time
+	DaysOverdue int
+	Balance     float64
+	Interest    float64
+	Level       string
+}
+
+// Statement is the data a notice template is rendered with
+type Statement struct {
+	CustomerName string
+	Date         time.Time
+	Level        string
+	Currency     string
+	Lines        []Line
+	Balance      float64
+	Interest     float64
+	Fee          float64
+	TotalDue     float64
+	PayBy        time.Time
+}
+
+// NewStatement totals the lines of a statement
+func NewStatement(customerName, currency, level string, date time.Time, lines []Line, fee float64, payWithinDays int) Statement {
+	st := Statement{
+		CustomerName: customerName,
+		Date:         date,
+		Level:        level,
+		Currency:     currency,
+		Lines:        lines,
+		Fee:          Round(fee),
+		PayBy:        date.AddDate(0, 0, payWithinDays),
+	}
+	for _, l := range lines {
+		st.Balance += l.Balance
+		st.Interest += l.Interest
+	}
+	st.Balance = Round(st.Balance)
+	st.Interest = Round(st.Interest)
+	st.TotalDue = Round(st.Balance + st.Interest + st.Fee)
+	return st
+}
+
+var templateFuncs = template.FuncMap{
+	"date":  func(t time.Time) string { return t.Format("2006-01-02") },
+	"money": func(v float64) string { return formatMoney(v) },
+	"title": levelTitle,
+}
+
+// ParseTemplate checks that a subject and body can be rendered
+func ParseTemplate(subject, body string) error {
+	if _, err := template.New("subject").Funcs(templateFuncs).Parse(subject); err != nil {
+		return err
+	}
+	_, err := template.New("body").Funcs(templateFuncs).Parse(body)
+	return err
+}
+
+// Render fills a subject and body template with a statement. Templates use
+// text/template syntax with the date, money and title functions.
+func Render(subject, body string, st Statement) (string, string, error) {
+	renderedSubject, err := render("subject", subject, st)
+	if err != nil {
+		return "", "", err
+	}
+	renderedBody, err := render("body", body, st)
+	if err != nil {
+		return "", "", err
+	}
+	return renderedSubject, renderedBody, nil
+}
+
+func render(name, text string, st Statement) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, st); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// DefaultTemplate returns the built-in subject and body for a level, used
+// when a stage has no template of its own
+func DefaultTemplate(level string) (string, string) {
+	subjects := map[string]string{
+		LevelReminder:    "Payment reminder: {{money .Balance}} {{.Currency}} overdue",
+		LevelFirstNotice: "First notice: {{money .TotalDue}} {{.Currency}} overdue",
+		LevelFinalNotice: "Final notice: {{money .TotalDue}} {{.Currency}} overdue",
+		LevelCreditHold:  "Account on hold: {{money .TotalDue}} {{.Currency}} overdue",
+	}
+	intro := map[string]string{
+		LevelReminder:    "This is a friendly reminder that the invoices below are past due.",
+		LevelFirstNotice: "Despite our reminder, the invoices below remain unpaid.",
+		LevelFinalNotice: "This is our final notice. Unless the balance below is settled, we will suspend deliveries to your account.",
+		LevelCreditHold:  "Your account has been placed on credit hold. Orders and shipments are suspended until the balance below is settled.",
+	}
+	body := "Dear {{.CustomerName}},\n\n" + intro[level] + "\n\n" +
+		"{{range .Lines}}{{.InvoiceNo}}  due {{date .DueDate}}  {{.DaysOverdue}} days  {{money .Balance}}{{if .Interest}}  interest {{money .Interest}}{{end}}\n{{end}}\n" +
+		"Balance:  {{money .Balance}} {{.Currency}}\n" +
+		"{{if .Interest}}Interest: {{money .Interest}} {{.Currency}}\n{{end}}" +
+		"{{if .Fee}}Fee:      {{money .Fee}} {{.Currency}}\n{{end}}" +
+		"Total:    {{money .TotalDue}} {{.Currency}}\n\n" +
+		"Please pay by {{date .PayBy}}. If you have already paid, please disregard this notice.\n"
+	return subjects[level], body
+}
+
+// PromiseOutcome decides a promise to pay: kept once the promised amount
+// was paid, broken when the promised date passed without it, open otherwise
+func PromiseOutcome(promised, paid float64, promisedDate, date time.Time) string {
+	if paid >= promised-0.005 {
+		return PromiseKept
+	}
+	if DaysOverdue(promisedDate, date) > 0 {
+		return PromiseBroken
+	}
+	return PromiseOpen
+}
+
+// Priority ranks an account on the collection worklist. Larger and older
+// balances come first; broken promises and the escalation level raise the
+// rank.
+func Priority(balance float64, maxDaysOverdue, brokenPromises int, level string) float64 {
+	if balance <= 0 {
+		return 0
+	}
+	score := math.Log10(1+balance) * (1 + float64(maxDaysOverdue)/30)
+	score *= 1 + 0.5*float64(brokenPromises)
+	score *= 1 + 0.25*float64(levelRank[level])
+	return math.Round(score*100) / 100
+}
+
+// Round rounds an amount to cents
+func Round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// levelTitle turns a level such as final_notice into "Final Notice"
+func levelTitle(level string) string {
+	words := strings.Fields(strings.ReplaceAll(level, "_", " "))
+	for i, w := range words {
+		words[i] = strings.ToUpper(w[:1]) + w[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+func formatMoney(v float64) string {
+	s := fmt.Sprintf("%.2f", math.Abs(v))
+	whole, frac := s[:len(s)-3], s[len(s)-3:]
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	if v < 0 {
+		return "-" + b.String() + frac
+	}
+	return b.String() + frac
+}
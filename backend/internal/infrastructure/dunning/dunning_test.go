@@ -0,0 +1,110 @@
+package dunning
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+var stages = []Stage{
+	{Sequence: 1, Level: LevelReminder, DaysOverdue: 1},
+	{Sequence: 2, Level: LevelFirstNotice, DaysOverdue: 15},
+	{Sequence: 3, Level: LevelFinalNotice, DaysOverdue: 30},
+	{Sequence: 4, Level: LevelCreditHold, DaysOverdue: 45},
+}
+
+func TestValidateStages(t *testing.T) {
+	assert.NoError(t, ValidateStages(stages))
+	assert.ErrorIs(t, ValidateStages([]Stage{
+		{Sequence: 1, Level: LevelReminder, DaysOverdue: 10},
+		{Sequence: 2, Level: LevelFirstNotice, DaysOverdue: 10},
+	}), ErrInvalidStages)
+	assert.ErrorIs(t, ValidateStages([]Stage{{Sequence: 1, Level: "letter", DaysOverdue: 1}}), ErrInvalidStages)
+}
+
+func TestNextStage(t *testing.T) {
+	_, ok := NextStage(stages, 0, 0)
+	assert.False(t, ok)
+
+	s, ok := NextStage(stages, 0, 3)
+	require.True(t, ok)
+	assert.Equal(t, LevelReminder, s.Level)
+
+	// An invoice first dunned at 40 days still gets the reminder first
+	s, ok = NextStage(stages, 0, 40)
+	require.True(t, ok)
+	assert.Equal(t, LevelReminder, s.Level)
+
+	s, ok = NextStage(stages, 1, 40)
+	require.True(t, ok)
+	assert.Equal(t, LevelFirstNotice, s.Level)
+
+	_, ok = NextStage(stages, 3, 40)
+	assert.False(t, ok)
+
+	_, ok = NextStage(stages, 4, 400)
+	assert.False(t, ok)
+}
+
+func TestDaysOverdue(t *testing.T) {
+	assert.Equal(t, 0, DaysOverdue(date("2024-06-10"), date("2024-06-01")))
+	assert.Equal(t, 0, DaysOverdue(date("2024-06-10"), date("2024-06-10")))
+	assert.Equal(t, 21, DaysOverdue(date("2024-06-10"), date("2024-07-01").Add(15*time.Hour)))
+}
+
+func TestInterest(t *testing.T) {
+	// 10,000 at 12% for 73 days
+	assert.Equal(t, 240.0, Interest(10000, 12, 73, 0))
+	assert.Equal(t, 0.0, Interest(10000, 12, 10, 10))
+	assert.Equal(t, 0.0, Interest(10000, 0, 73, 0))
+}
+
+func TestRender(t *testing.T) {
+	st := NewStatement("Acme GmbH", "EUR", LevelFirstNotice, date("2024-07-01"), []Line{
+		{InvoiceNo: "INV-1", DueDate: date("2024-06-01"), DaysOverdue: 30, Balance: 12500, Interest: 82.19},
+		{InvoiceNo: "INV-2", DueDate: date("2024-06-15"), DaysOverdue: 16, Balance: 500},
+	}, 25, 7)
+	assert.Equal(t, 13000.0, st.Balance)
+	assert.Equal(t, 13107.19, st.TotalDue)
+
+	subjectTmpl, bodyTmpl := DefaultTemplate(LevelFirstNotice)
+	subject, body, err := Render(subjectTmpl, bodyTmpl, st)
+	require.NoError(t, err)
+	assert.Equal(t, "First notice: 13,107.19 EUR overdue", subject)
+	assert.Contains(t, body, "Dear Acme GmbH,")
+	assert.Contains(t, body, "INV-1  due 2024-06-01  30 days  12,500.00  interest 82.19\n")
+	assert.Contains(t, body, "INV-2  due 2024-06-15  16 days  500.00\n")
+	assert.Contains(t, body, "Fee:      25.00 EUR")
+	assert.Contains(t, body, "Please pay by 2024-07-08.")
+
+	_, _, err = Render("{{.Unknown}}", "", st)
+	assert.Error(t, err)
+	assert.Error(t, ParseTemplate("{{.Balance", ""))
+}
+
+func TestPromiseOutcome(t *testing.T) {
+	assert.Equal(t, PromiseOpen, PromiseOutcome(1000, 400, date("2024-07-10"), date("2024-07-10")))
+	assert.Equal(t, PromiseKept, PromiseOutcome(1000, 1000, date("2024-07-10"), date("2024-07-12")))
+	assert.Equal(t, PromiseBroken, PromiseOutcome(1000, 400, date("2024-07-10"), date("2024-07-11")))
+}
+
+func TestPriority(t *testing.T) {
+	small := Priority(1000, 10, 0, LevelReminder)
+	large := Priority(100000, 10, 0, LevelReminder)
+	older := Priority(1000, 90, 0, LevelReminder)
+	broken := Priority(1000, 10, 1, LevelReminder)
+	assert.Greater(t, large, small)
+	assert.Greater(t, older, small)
+	assert.Greater(t, broken, small)
+	assert.Equal(t, 0.0, Priority(0, 90, 2, LevelCreditHold))
+}
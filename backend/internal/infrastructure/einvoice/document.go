@@ -0,0 +1,290 @@
+// Package einvoice turns invoices and credit notes into structured
+// e-invoices: UBL 2.1 following Peppol BIS Billing 3.0 and the Taiwan MOF
+// e-invoice MIG. It holds the format-neutral document, the serializers, the
+// schematron-like business rules, detached XML signatures and the
+// transports that deliver signed documents.
+package einvoice
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Formats
+const (
+	FormatPeppol = "peppol_bis3"
+	FormatTWMIG  = "tw_mig"
+)
+
+// Document types
+const (
+	TypeInvoice    = "invoice"
+	TypeCreditNote = "credit_note"
+)
+
+// VAT categories of the UNCL5305 code list
+const (
+	TaxStandard   = "S" // standard rated
+	TaxZero       = "Z" // zero rated goods
+	TaxExempt     = "E" // exempt from tax
+	TaxExport     = "G" // free export item, tax not charged
+	TaxOutOfScope = "O" // services outside scope of tax
+)
+
+// ValidFormat reports whether format is a supported e-invoice format
+func ValidFormat(format string) bool {
+	return format == FormatPeppol || format == FormatTWMIG
+}
+
+// Party is the seller or buyer of a document
+type Party struct {
+	Name           string
+	TaxID          string // VAT number, or the unified business number in Taiwan
+	Country        string // ISO 3166-1 alpha-2
+	Address        string
+	City           string
+	PostalCode     string
+	Email          string
+	EndpointScheme string // Peppol EAS code, e.g. 0088 or 9930
+	EndpointID     string
+}
+
+// Line is one invoiced or credited item
+type Line struct {
+	ID          string
+	Description string
+	Quantity    float64
+	UnitCode    string // UN/ECE Recommendation 20
+	UnitPrice   float64
+	Amount      float64 // net line amount
+	TaxCategory string
+	TaxPercent  float64
+}
+
+// Allowance is a document level discount
+type Allowance struct {
+	Reason      string
+	Amount      float64
+	TaxCategory string
+	TaxPercent  float64
+}
+
+// Reference identifies the invoice a credit note corrects
+type Reference struct {
+	ID        string
+	IssueDate time.Time
+}
+
+// TaxSubtotal is the tax of one category and rate
+type TaxSubtotal struct {
+	Category      string
+	Percent       float64
+	TaxableAmount float64
+	TaxAmount     float64
+	ExemptionCode string
+	ExemptionText string
+}
+
+// Totals are the monetary totals of a document
+type Totals struct {
+	LineExtension  float64
+	AllowanceTotal float64
+	TaxExclusive   float64
+	TaxTotal       float64
+	TaxInclusive   float64
+	Prepaid        float64
+	Payable        float64
+	Subtotals      []TaxSubtotal
+}
+
+// Document is an invoice or credit note independent of its format
+type Document struct {
+	Type           string
+	ID             string
+	IssueDate      time.Time
+	DueDate        time.Time
+	Currency       string
+	ExchangeRate   float64 // to New Taiwan dollars, for the Taiwan MIG
+	BuyerReference string
+	OrderReference string
+	Note           string
+	PaymentTerms   string
+	Billing        *Reference // invoice corrected by a credit note
+	Seller         Party
+	Buyer          Party
+	Lines          []Line
+	Allowances     []Allowance
+	Prepaid        float64
+	Totals         Totals
+}
+
+// Compute rounds line amounts and fills the document totals and tax
+// breakdown from the lines and allowances
+func (d *Document) Compute() {
+	type key struct {
+		category string
+		percent  float64
+	}
+	taxable := map[key]float64{}
+	var keys []key
+
+	var t Totals
+	for i := range d.Lines {
+		l := &d.Lines[i]
+		l.Amount = Round(l.Quantity * l.UnitPrice)
+		t.LineExtension += l.Amount
+		k := key{l.TaxCategory, l.TaxPercent}
+		if _, ok := taxable[k]; !ok {
+			keys = append(keys, k)
+		}
+		taxable[k] += l.Amount
+	}
+	for i := range d.Allowances {
+		a := &d.Allowances[i]
+		a.Amount = Round(a.Amount)
+		t.AllowanceTotal += a.Amount
+		k := key{a.TaxCategory, a.TaxPercent}
+		if _, ok := taxable[k]; !ok {
+			keys = append(keys, k)
+		}
+		taxable[k] -= a.Amount
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].category != keys[j].category {
+			return keys[i].category < keys[j].category
+		}
+		return keys[i].percent > keys[j].percent
+	})
+	for _, k := range keys {
+		base := Round(taxable[k])
+		sub := TaxSubtotal{
+			Category:      k.category,
+			Percent:       k.percent,
+			TaxableAmount: base,
+			TaxAmount:     Round(base * k.percent / 100),
+		}
+		sub.ExemptionCode, sub.ExemptionText = exemption(k.category)
+		t.TaxTotal += sub.TaxAmount
+		t.Subtotals = append(t.Subtotals, sub)
+	}
+
+	t.LineExtension = Round(t.LineExtension)
+	t.AllowanceTotal = Round(t.AllowanceTotal)
+	t.TaxExclusive = Round(t.LineExtension - t.AllowanceTotal)
+	t.TaxTotal = Round(t.TaxTotal)
+	t.TaxInclusive = Round(t.TaxExclusive + t.TaxTotal)
+	t.Prepaid = Round(d.Prepaid)
+	t.Payable = Round(t.TaxInclusive - t.Prepaid)
+	d.Totals = t
+}
+
+// SplitAllowance spreads a document discount over the tax groups of the
+// lines in proportion to their amounts, so each part carries the tax
+// category it reduces
+func SplitAllowance(reason string, amount float64, lines []Line) []Allowance {
+	if amount <= 0 || len(lines) == 0 {
+		return nil
+	}
+	type key struct {
+		category string
+		percent  float64
+	}
+	totals := map[key]float64{}
+	var keys []key
+	var sum float64
+	for _, l := range lines {
+		k := key{l.TaxCategory, l.TaxPercent}
+		if _, ok := totals[k]; !ok {
+			keys = append(keys, k)
+		}
+		amt := Round(l.Quantity * l.UnitPrice)
+		totals[k] += amt
+		sum += amt
+	}
+	if sum <= 0 {
+		return nil
+	}
+
+	allowances := make([]Allowance, 0, len(keys))
+	remaining := Round(amount)
+	for i, k := range keys {
+		part := Round(amount * totals[k] / sum)
+		if i == len(keys)-1 {
+			part = remaining
+		}
+		remaining = Round(remaining - part)
+		allowances = append(allowances, Allowance{Reason: reason, Amount: part, TaxCategory: k.category, TaxPercent: k.percent})
+	}
+	return allowances
+}
+
+// TaxCategory picks the VAT category of a line from its rate and whether
+// the sale leaves the seller's country
+func TaxCategory(percent float64, export bool) string {
+	switch {
+	case percent > 0:
+		return TaxStandard
+	case export:
+		return TaxExport
+	default:
+		return TaxZero
+	}
+}
+
+func exemption(category string) (string, string) {
+	switch category {
+	case TaxExport:
+		return "VATEX-EU-G", "Export outside the EU"
+	case TaxExempt:
+		return "VATEX-EU-132", "Exempt"
+	case TaxOutOfScope:
+		return "VATEX-EU-O", "Not subject to VAT"
+	}
+	return "", ""
+}
+
+var unitCodes = map[string]string{
+	"":        "C62",
+	"pc":      "C62",
+	"pcs":     "C62",
+	"piece":   "C62",
+	"pieces":  "C62",
+	"ea":      "C62",
+	"each":    "C62",
+	"unit":    "C62",
+	"1000pcs": "MIL",
+	"kpcs":    "MIL",
+	"mil":     "MIL",
+	"kg":      "KGM",
+	"g":       "GRM",
+	"t":       "TNE",
+	"ton":     "TNE",
+	"m":       "MTR",
+	"set":     "SET",
+	"box":     "XBX",
+	"ctn":     "XCT",
+	"carton":  "XCT",
+	"pallet":  "XPX",
+}
+
+// UnitCode maps a unit as entered on an invoice to its UN/ECE
+// Recommendation 20 code. Unknown units return an empty code.
+func UnitCode(unit string) string {
+	trimmed := strings.TrimSpace(unit)
+	if code, ok := unitCodes[strings.ToLower(trimmed)]; ok {
+		return code
+	}
+	if len(trimmed) == 3 && trimmed == strings.ToUpper(trimmed) {
+		// Already a code
+		return trimmed
+	}
+	return ""
+}
+
+// Round rounds an amount to cents
+func Round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
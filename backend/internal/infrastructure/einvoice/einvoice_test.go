@@ -0,0 +1,274 @@
+package einvoice
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSigner struct{ key []byte }
+
+func (s testSigner) KeyID() string     { return "test" }
+func (s testSigner) Algorithm() string { return "http://www.w3.org/2001/04/xmldsig-more#hmac-sha256" }
+func (s testSigner) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+func (s testSigner) Verify(data, sig []byte) error {
+	expected, _ := s.Sign(data)
+	if !hmac.Equal(expected, sig) {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
+func exportInvoice() *Document {
+	d := &Document{
+		Type:           TypeInvoice,
+		ID:             "INV-2024-0042",
+		IssueDate:      time.Date(2024, 7, 1, 10, 30, 0, 0, time.UTC),
+		DueDate:        time.Date(2024, 7, 31, 0, 0, 0, 0, time.UTC),
+		Currency:       "EUR",
+		ExchangeRate:   35,
+		OrderReference: "PO-778",
+		Seller: Party{
+			Name: "FastenMind Co., Ltd.", TaxID: "12345678", Country: "TW", Address: "No. 1, Gangshan Rd., Kaohsiung",
+			EndpointScheme: "0242", EndpointID: "12345678",
+		},
+		Buyer: Party{
+			Name: "Schrauben GmbH", TaxID: "DE123456789", Country: "DE", City: "Stuttgart",
+			EndpointScheme: "9930", EndpointID: "DE123456789",
+		},
+		Lines: []Line{
+			{ID: "1", Description: "Hex bolt DIN 933 M8x30 8.8", Quantity: 10000, UnitCode: UnitCode("pcs"), UnitPrice: 0.042, TaxCategory: TaxExport},
+			{ID: "2", Description: "Hex nut DIN 934 M8", Quantity: 10000, UnitCode: UnitCode("pcs"), UnitPrice: 0.0125, TaxCategory: TaxExport},
+		},
+	}
+	d.Allowances = SplitAllowance("Discount", 20, d.Lines)
+	d.Compute()
+	return d
+}
+
+func TestComputeAndSplitAllowance(t *testing.T) {
+	d := exportInvoice()
+	assert.Equal(t, 420.0, d.Lines[0].Amount)
+	assert.Equal(t, 125.0, d.Lines[1].Amount)
+	require.Len(t, d.Allowances, 1)
+	assert.Equal(t, 545.0, d.Totals.LineExtension)
+	assert.Equal(t, 525.0, d.Totals.TaxExclusive)
+	assert.Equal(t, 0.0, d.Totals.TaxTotal)
+	assert.Equal(t, 525.0, d.Totals.Payable)
+
+	mixed := []Line{
+		{Quantity: 1, UnitPrice: 300, TaxCategory: TaxStandard, TaxPercent: 5},
+		{Quantity: 1, UnitPrice: 100, TaxCategory: TaxZero},
+	}
+	parts := SplitAllowance("Discount", 10, mixed)
+	require.Len(t, parts, 2)
+	assert.Equal(t, 7.5, parts[0].Amount)
+	assert.Equal(t, 2.5, parts[1].Amount)
+
+	d2 := &Document{Lines: mixed, Allowances: parts}
+	d2.Compute()
+	require.Len(t, d2.Totals.Subtotals, 2)
+	assert.Equal(t, 292.5, d2.Totals.Subtotals[0].TaxableAmount)
+	assert.Equal(t, 14.63, d2.Totals.TaxTotal)
+	assert.Equal(t, 404.63, d2.Totals.TaxInclusive)
+}
+
+func TestUnitCode(t *testing.T) {
+	assert.Equal(t, "C62", UnitCode("PCS"))
+	assert.Equal(t, "KGM", UnitCode("kg"))
+	assert.Equal(t, "MIL", UnitCode("1000pcs"))
+	assert.Equal(t, "H87", UnitCode("H87"))
+	assert.Equal(t, "", UnitCode("bag of"))
+}
+
+func TestMarshalUBL(t *testing.T) {
+	d := exportInvoice()
+	out, err := MarshalUBL(d)
+	require.NoError(t, err)
+	s := string(out)
+	assert.True(t, strings.HasPrefix(s, xml.Header))
+	assert.Contains(t, s, `<Invoice xmlns="urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"`)
+	assert.Contains(t, s, "<cbc:CustomizationID>"+PeppolCustomizationID+"</cbc:CustomizationID>")
+	assert.Contains(t, s, "<cbc:InvoiceTypeCode>380</cbc:InvoiceTypeCode>")
+	assert.Contains(t, s, `<cbc:EndpointID schemeID="9930">DE123456789</cbc:EndpointID>`)
+	assert.Contains(t, s, `<cbc:InvoicedQuantity unitCode="C62">10000</cbc:InvoicedQuantity>`)
+	assert.Contains(t, s, `<cbc:PriceAmount currencyID="EUR">0.042</cbc:PriceAmount>`)
+	assert.Contains(t, s, `<cbc:TaxExemptionReasonCode>VATEX-EU-G</cbc:TaxExemptionReasonCode>`)
+	assert.Contains(t, s, `<cbc:PayableAmount currencyID="EUR">525.00</cbc:PayableAmount>`)
+
+	// The output is well formed
+	require.NoError(t, xml.Unmarshal(out, new(interface{})))
+
+	d.Type = TypeCreditNote
+	d.Billing = &Reference{ID: "INV-2024-0041", IssueDate: d.IssueDate}
+	out, err = MarshalUBL(d)
+	require.NoError(t, err)
+	s = string(out)
+	assert.Contains(t, s, `<CreditNote xmlns="urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"`)
+	assert.Contains(t, s, "<cbc:CreditNoteTypeCode>381</cbc:CreditNoteTypeCode>")
+	assert.Contains(t, s, "<cac:CreditNoteLine>")
+	assert.Contains(t, s, "<cbc:CreditedQuantity")
+	assert.NotContains(t, s, "<cbc:DueDate>")
+}
+
+func domesticInvoice() *Document {
+	d := &Document{
+		Type:      TypeInvoice,
+		ID:        "AB12345678",
+		IssueDate: time.Date(2024, 7, 1, 10, 30, 0, 0, time.UTC),
+		Currency:  "TWD",
+		Seller:    Party{Name: "FastenMind Co., Ltd.", TaxID: "12345678", Country: "TW", Address: "No. 1, Gangshan Rd., Kaohsiung"},
+		Buyer:     Party{Name: "Taichung Machinery", TaxID: "87654321", Country: "TW"},
+		Lines: []Line{
+			{ID: "1", Description: "Hex bolt M10x40", Quantity: 2000, UnitCode: "C62", UnitPrice: 3.5, TaxCategory: TaxStandard, TaxPercent: 5},
+		},
+	}
+	d.Compute()
+	return d
+}
+
+func TestMarshalMIG(t *testing.T) {
+	d := domesticInvoice()
+	a := ComputeMIG(d)
+	assert.Equal(t, int64(7000), a.Sales)
+	assert.Equal(t, int64(350), a.Tax)
+	assert.Equal(t, int64(7350), a.Total)
+
+	out, err := MarshalMIG(d)
+	require.NoError(t, err)
+	s := string(out)
+	assert.Contains(t, s, `<Invoice xmlns="urn:GEINV:eInvoiceMessage:A0401:4.0">`)
+	assert.Contains(t, s, "<InvoiceNumber>AB12345678</InvoiceNumber><InvoiceDate>20240701</InvoiceDate><InvoiceTime>10:30:00</InvoiceTime>")
+	assert.Contains(t, s, "<SalesAmount>7000</SalesAmount>")
+	assert.Contains(t, s, "<TaxType>1</TaxType><TaxRate>0.05</TaxRate><TaxAmount>350</TaxAmount><TotalAmount>7350</TotalAmount>")
+
+	// Foreign currency invoices are converted to TWD
+	exp := exportInvoice()
+	exp.ID = "AB12345679"
+	out, err = MarshalMIG(exp)
+	require.NoError(t, err)
+	s = string(out)
+	assert.Contains(t, s, "<ZeroTaxSalesAmount>18375</ZeroTaxSalesAmount>")
+	assert.Contains(t, s, "<TaxType>2</TaxType>")
+	assert.Contains(t, s, "<Currency>EUR</Currency>")
+
+	credit := domesticInvoice()
+	credit.Type = TypeCreditNote
+	credit.ID = "AB12345680"
+	credit.Billing = &Reference{ID: "AB12345678", IssueDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}
+	out, err = MarshalMIG(credit)
+	require.NoError(t, err)
+	s = string(out)
+	assert.Contains(t, s, `<Allowance xmlns="urn:GEINV:eInvoiceMessage:B0401:4.0">`)
+	assert.Contains(t, s, "<OriginalInvoiceDate>20240601</OriginalInvoiceDate><OriginalInvoiceNumber>AB12345678</OriginalInvoiceNumber>")
+	assert.Contains(t, s, "<Tax>350</Tax>")
+	assert.Contains(t, s, "<Amount><TaxAmount>350</TaxAmount><TotalAmount>7000</TotalAmount></Amount>")
+}
+
+func ruleIDs(violations []Violation) []string {
+	var ids []string
+	for _, v := range violations {
+		ids = append(ids, v.RuleID)
+	}
+	return ids
+}
+
+func TestValidatePeppol(t *testing.T) {
+	d := exportInvoice()
+	assert.Empty(t, Validate(d, FormatPeppol))
+
+	d.Buyer.EndpointID = ""
+	d.OrderReference = ""
+	d.Lines[1].UnitCode = ""
+	d.Lines[0].Amount = 1
+	violations := Validate(d, FormatPeppol)
+	assert.True(t, Fatal(violations))
+	ids := ruleIDs(violations)
+	assert.Contains(t, ids, "PEPPOL-EN16931-R010")
+	assert.Contains(t, ids, "PEPPOL-EN16931-R003")
+	assert.Contains(t, ids, "BR-23")
+	assert.Contains(t, ids, "PEPPOL-EN16931-R120")
+	for _, v := range violations {
+		if v.RuleID == "BR-23" {
+			assert.Equal(t, "line 2", v.Location)
+		}
+	}
+
+	credit := exportInvoice()
+	credit.Type = TypeCreditNote
+	violations = Validate(credit, FormatPeppol)
+	assert.Equal(t, []string{"FM-01"}, ruleIDs(violations))
+	assert.False(t, Fatal(violations))
+}
+
+func TestValidateMIG(t *testing.T) {
+	assert.Empty(t, Validate(domesticInvoice(), FormatTWMIG))
+
+	d := domesticInvoice()
+	d.ID = "INV-1"
+	d.Buyer.TaxID = "DE123"
+	d.Lines[0].TaxPercent = 10
+	d.Compute()
+	ids := ruleIDs(Validate(d, FormatTWMIG))
+	assert.Contains(t, ids, "TW-01")
+	assert.Contains(t, ids, "TW-04")
+	assert.Contains(t, ids, "TW-11")
+
+	credit := domesticInvoice()
+	credit.Type = TypeCreditNote
+	assert.Contains(t, ruleIDs(Validate(credit, FormatTWMIG)), "TW-13")
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signer := testSigner{key: []byte("secret")}
+	content, err := MarshalUBL(exportInvoice())
+	require.NoError(t, err)
+
+	sig, err := Sign("INV-2024-0042.xml", content, signer)
+	require.NoError(t, err)
+	assert.Equal(t, "test", sig.KeyID)
+	assert.Contains(t, string(sig.XML), `<ds:Reference URI="INV-2024-0042.xml">`)
+	assert.Contains(t, string(sig.XML), "<ds:DigestValue>"+sig.Digest+"</ds:DigestValue>")
+
+	require.NoError(t, Verify(content, sig.XML, signer))
+
+	tampered := bytes.Replace(content, []byte("525.00"), []byte("425.00"), 1)
+	assert.ErrorIs(t, Verify(tampered, sig.XML, signer), ErrSignatureMismatch)
+	assert.ErrorIs(t, Verify(content, sig.XML, testSigner{key: []byte("other")}), ErrSignatureMismatch)
+}
+
+func TestFileOutbox(t *testing.T) {
+	dir := t.TempDir()
+	outbox := NewFileOutbox(dir)
+	receipt, err := outbox.Send(context.Background(), Envelope{
+		DocumentNo: "INV-2024-0042",
+		Format:     FormatPeppol,
+		FileName:   "INV-2024-0042-v1.xml",
+		Content:    []byte("<Invoice/>"),
+		Signature:  []byte("<ds:Signature/>"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(FormatPeppol, "INV-2024-0042-v1"), receipt.Reference)
+
+	for _, name := range []string{"INV-2024-0042-v1.xml", "INV-2024-0042-v1.sig.xml", "INV-2024-0042-v1.json"} {
+		_, err := os.Stat(filepath.Join(dir, FormatPeppol, name))
+		assert.NoError(t, err, name)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dir, FormatPeppol, "*.tmp"))
+	assert.Empty(t, leftovers)
+}
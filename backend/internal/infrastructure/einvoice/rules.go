@@ -0,0 +1,258 @@
+package einvoice
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"unicode/utf8"
+)
+
+// Rule flags, as in schematron
+const (
+	FlagFatal   = "fatal"
+	FlagWarning = "warning"
+)
+
+// Violation is a business rule a document breaks
+type Violation struct {
+	RuleID   string `json:"rule_id"`
+	Flag     string `json:"flag"`
+	Location string `json:"location"`
+	Message  string `json:"message"`
+}
+
+// Fatal reports whether any violation blocks the document
+func Fatal(violations []Violation) bool {
+	for _, v := range violations {
+		if v.Flag == FlagFatal {
+			return true
+		}
+	}
+	return false
+}
+
+// rule asserts a condition on the document; failures name the location
+type rule struct {
+	id      string
+	flag    string
+	message string
+	check   func(d *Document) []string
+}
+
+// whole returns the document location when ok is false
+func whole(location string, ok bool) []string {
+	if ok {
+		return nil
+	}
+	return []string{location}
+}
+
+// eachLine returns the location of every line that fails ok
+func eachLine(d *Document, ok func(l Line) bool) []string {
+	var failed []string
+	for i, l := range d.Lines {
+		if !ok(l) {
+			failed = append(failed, fmt.Sprintf("line %d", i+1))
+		}
+	}
+	return failed
+}
+
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+// EN 16931 core rules and Peppol BIS Billing 3.0 rules that apply to the
+// documents we produce. Codes follow the official rule identifiers; FM rules
+// are our own.
+var peppolRules = []rule{
+	{"BR-02", FlagFatal, "An invoice shall have an invoice number",
+		func(d *Document) []string { return whole("ID", d.ID != "") }},
+	{"BR-03", FlagFatal, "An invoice shall have an issue date",
+		func(d *Document) []string { return whole("IssueDate", !d.IssueDate.IsZero()) }},
+	{"BR-05", FlagFatal, "An invoice shall have a currency code",
+		func(d *Document) []string { return whole("DocumentCurrencyCode", len(d.Currency) == 3) }},
+	{"BR-06", FlagFatal, "An invoice shall contain the seller name",
+		func(d *Document) []string { return whole("AccountingSupplierParty", d.Seller.Name != "") }},
+	{"BR-07", FlagFatal, "An invoice shall contain the buyer name",
+		func(d *Document) []string { return whole("AccountingCustomerParty", d.Buyer.Name != "") }},
+	{"BR-09", FlagFatal, "The seller postal address shall contain a country code",
+		func(d *Document) []string {
+			return whole("AccountingSupplierParty/PostalAddress", len(d.Seller.Country) == 2)
+		}},
+	{"BR-11", FlagFatal, "The buyer postal address shall contain a country code",
+		func(d *Document) []string {
+			return whole("AccountingCustomerParty/PostalAddress", len(d.Buyer.Country) == 2)
+		}},
+	{"BR-16", FlagFatal, "An invoice shall have at least one invoice line",
+		func(d *Document) []string { return whole("InvoiceLine", len(d.Lines) > 0) }},
+	{"BR-21", FlagFatal, "Each invoice line shall have an identifier",
+		func(d *Document) []string { return eachLine(d, func(l Line) bool { return l.ID != "" }) }},
+	{"BR-22", FlagFatal, "Each invoice line shall have an invoiced quantity",
+		func(d *Document) []string { return eachLine(d, func(l Line) bool { return l.Quantity != 0 }) }},
+	{"BR-23", FlagFatal, "An invoiced quantity shall have a unit of measure code",
+		func(d *Document) []string { return eachLine(d, func(l Line) bool { return l.UnitCode != "" }) }},
+	{"BR-25", FlagFatal, "Each invoice line shall contain the item name",
+		func(d *Document) []string { return eachLine(d, func(l Line) bool { return l.Description != "" }) }},
+	{"BR-27", FlagFatal, "The item net price shall not be negative",
+		func(d *Document) []string { return eachLine(d, func(l Line) bool { return l.UnitPrice >= 0 }) }},
+	{"BR-CO-10", FlagFatal, "Sum of invoice line net amount shall equal the sum of the line amounts",
+		func(d *Document) []string {
+			var sum float64
+			for _, l := range d.Lines {
+				sum += l.Amount
+			}
+			return whole("LegalMonetaryTotal/LineExtensionAmount", near(Round(sum), d.Totals.LineExtension, 0.005))
+		}},
+	{"BR-CO-13", FlagFatal, "Invoice total without VAT shall equal the line total minus allowances",
+		func(d *Document) []string {
+			return whole("LegalMonetaryTotal/TaxExclusiveAmount",
+				near(d.Totals.TaxExclusive, Round(d.Totals.LineExtension-d.Totals.AllowanceTotal), 0.005))
+		}},
+	{"BR-CO-14", FlagFatal, "Invoice total VAT amount shall equal the sum of the VAT category tax amounts",
+		func(d *Document) []string {
+			var sum float64
+			for _, s := range d.Totals.Subtotals {
+				sum += s.TaxAmount
+			}
+			return whole("TaxTotal/TaxAmount", near(Round(sum), d.Totals.TaxTotal, 0.005))
+		}},
+	{"BR-CO-15", FlagFatal, "Invoice total with VAT shall equal the total without VAT plus the VAT",
+		func(d *Document) []string {
+			return whole("LegalMonetaryTotal/TaxInclusiveAmount",
+				near(d.Totals.TaxInclusive, Round(d.Totals.TaxExclusive+d.Totals.TaxTotal), 0.005))
+		}},
+	{"BR-CO-26", FlagFatal, "The seller VAT identifier or legal registration identifier shall be present",
+		func(d *Document) []string {
+			return whole("AccountingSupplierParty/PartyTaxScheme", d.Seller.TaxID != "")
+		}},
+	{"BR-S-05", FlagFatal, "Standard rated items shall have a VAT rate greater than zero",
+		func(d *Document) []string {
+			return eachLine(d, func(l Line) bool { return l.TaxCategory != TaxStandard || l.TaxPercent > 0 })
+		}},
+	{"BR-G-05", FlagFatal, "Export items shall have a VAT rate of zero",
+		func(d *Document) []string {
+			return eachLine(d, func(l Line) bool { return l.TaxCategory != TaxExport || l.TaxPercent == 0 })
+		}},
+	{"BR-CL-18", FlagFatal, "VAT category code shall be from the UNCL5305 subset",
+		func(d *Document) []string {
+			return eachLine(d, func(l Line) bool {
+				switch l.TaxCategory {
+				case TaxStandard, TaxZero, TaxExempt, TaxExport, TaxOutOfScope:
+					return true
+				}
+				return false
+			})
+		}},
+	{"FM-01", FlagWarning, "A credit note should reference the preceding invoice",
+		func(d *Document) []string {
+			return whole("BillingReference", d.Type != TypeCreditNote || (d.Billing != nil && d.Billing.ID != ""))
+		}},
+	{"PEPPOL-EN16931-R003", FlagFatal, "A buyer reference or purchase order reference must be provided",
+		func(d *Document) []string {
+			return whole("BuyerReference", d.BuyerReference != "" || d.OrderReference != "")
+		}},
+	{"PEPPOL-EN16931-R010", FlagFatal, "Buyer electronic address must be provided",
+		func(d *Document) []string {
+			return whole("AccountingCustomerParty/EndpointID", d.Buyer.EndpointID != "" && d.Buyer.EndpointScheme != "")
+		}},
+	{"PEPPOL-EN16931-R020", FlagFatal, "Seller electronic address must be provided",
+		func(d *Document) []string {
+			return whole("AccountingSupplierParty/EndpointID", d.Seller.EndpointID != "" && d.Seller.EndpointScheme != "")
+		}},
+	{"BR-31", FlagFatal, "Each document level allowance shall have an allowance amount",
+		func(d *Document) []string {
+			for _, a := range d.Allowances {
+				if a.Amount <= 0 {
+					return []string{"AllowanceCharge"}
+				}
+			}
+			return nil
+		}},
+	{"PEPPOL-EN16931-R120", FlagFatal, "Invoice line net amount must equal quantity times net price",
+		func(d *Document) []string {
+			return eachLine(d, func(l Line) bool { return near(l.Amount, Round(l.Quantity*l.UnitPrice), 0.005) })
+		}},
+}
+
+var (
+	twInvoiceNumber = regexp.MustCompile(`^[A-Z]{2}[0-9]{8}$`)
+	twIdentifier    = regexp.MustCompile(`^[0-9]{8}$`)
+)
+
+// Taiwan MIG 4.0 field rules for A0401 and B0401, numbered locally
+var twRules = []rule{
+	{"TW-01", FlagFatal, "Invoice number must be two capital letters followed by eight digits",
+		func(d *Document) []string { return whole("InvoiceNumber", twInvoiceNumber.MatchString(d.ID)) }},
+	{"TW-02", FlagFatal, "Invoice date is required",
+		func(d *Document) []string { return whole("InvoiceDate", !d.IssueDate.IsZero()) }},
+	{"TW-03", FlagFatal, "Seller identifier must be an eight digit unified business number",
+		func(d *Document) []string {
+			return whole("Seller/Identifier", twIdentifier.MatchString(d.Seller.TaxID))
+		}},
+	{"TW-04", FlagFatal, "Buyer identifier must be an eight digit unified business number or empty",
+		func(d *Document) []string {
+			return whole("Buyer/Identifier", d.Buyer.TaxID == "" || twIdentifier.MatchString(d.Buyer.TaxID))
+		}},
+	{"TW-05", FlagFatal, "Seller name is required and at most 60 characters",
+		func(d *Document) []string {
+			return whole("Seller/Name", d.Seller.Name != "" && utf8.RuneCountInString(d.Seller.Name) <= 60)
+		}},
+	{"TW-06", FlagFatal, "Seller address is required",
+		func(d *Document) []string { return whole("Seller/Address", d.Seller.Address != "") }},
+	{"TW-07", FlagFatal, "Buyer name is required and at most 60 characters",
+		func(d *Document) []string {
+			return whole("Buyer/Name", d.Buyer.Name != "" && utf8.RuneCountInString(d.Buyer.Name) <= 60)
+		}},
+	{"TW-08", FlagFatal, "An invoice has between 1 and 9999 items",
+		func(d *Document) []string { return whole("Details", len(d.Lines) > 0 && len(d.Lines) <= 9999) }},
+	{"TW-09", FlagFatal, "Item description is required and at most 256 characters",
+		func(d *Document) []string {
+			return eachLine(d, func(l Line) bool {
+				return l.Description != "" && utf8.RuneCountInString(l.Description) <= 256
+			})
+		}},
+	{"TW-10", FlagFatal, "Documents in a foreign currency need an exchange rate to TWD",
+		func(d *Document) []string {
+			return whole("Amount/ExchangeRate", d.Currency == "TWD" || d.ExchangeRate > 0)
+		}},
+	{"TW-11", FlagFatal, "Taxable items carry the 5% business tax",
+		func(d *Document) []string {
+			return eachLine(d, func(l Line) bool { return l.TaxCategory != TaxStandard || l.TaxPercent == 5 })
+		}},
+	{"TW-12", FlagFatal, "Tax amount must equal taxable sales times the tax rate, to the dollar",
+		func(d *Document) []string {
+			a := ComputeMIG(d)
+			return whole("Amount/TaxAmount", math.Abs(float64(a.Tax)-float64(a.Sales)*a.TaxRate/100) <= 1)
+		}},
+	{"TW-13", FlagFatal, "An allowance must reference the original invoice number and date",
+		func(d *Document) []string {
+			return whole("Details/ProductItem/OriginalInvoiceNumber", d.Type != TypeCreditNote ||
+				(d.Billing != nil && twInvoiceNumber.MatchString(d.Billing.ID) && !d.Billing.IssueDate.IsZero()))
+		}},
+	{"TW-14", FlagWarning, "Zero rated sales are normally exports with a customs clearance",
+		func(d *Document) []string {
+			return eachLine(d, func(l Line) bool { return MIGTaxType(l.TaxCategory) != migZeroRated || d.Buyer.Country != "TW" })
+		}},
+}
+
+// Validate checks a computed document against the business rules of a
+// format. Fatal violations block signing and transmission.
+func Validate(d *Document, format string) []Violation {
+	rules := peppolRules
+	if format == FormatTWMIG {
+		rules = twRules
+	}
+	violations := []Violation{}
+	for _, r := range rules {
+		for _, location := range r.check(d) {
+			violations = append(violations, Violation{
+				RuleID:   r.id,
+				Flag:     r.flag,
+				Location: location,
+				Message:  r.message,
+			})
+		}
+	}
+	return violations
+}
@@ -0,0 +1,157 @@
+package einvoice
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+)
+
+// XML signature identifiers
+const (
+	dsNamespace    = "http://www.w3.org/2000/09/xmldsig#"
+	dsExcC14N      = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	dsDigestSHA256 = "http://www.w3.org/2001/04/xmlenc#sha256"
+)
+
+// ErrSignatureMismatch is returned when a document does not match its signature
+var ErrSignatureMismatch = errors.New("document does not match its signature")
+
+// Signer signs document bytes; security.DocumentSigner implements it
+type Signer interface {
+	KeyID() string
+	Algorithm() string
+	Sign(data []byte) ([]byte, error)
+	Verify(data, signature []byte) error
+}
+
+// Signature is a detached XML signature over a stored e-invoice. The
+// document itself stays untouched, as neither Peppol nor the MIG allow an
+// enveloped signature.
+type Signature struct {
+	Digest    string // base64 SHA-256 of the document octets
+	Value     string // base64 signature over the canonical SignedInfo
+	KeyID     string
+	Algorithm string
+	XML       []byte
+}
+
+type dsSignature struct {
+	XMLName        xml.Name `xml:"ds:Signature"`
+	Xmlns          string   `xml:"xmlns:ds,attr"`
+	SignedInfo     dsSignedInfo
+	SignatureValue string `xml:"ds:SignatureValue"`
+	KeyName        string `xml:"ds:KeyInfo>ds:KeyName"`
+}
+
+type dsMethod struct {
+	Algorithm string `xml:"Algorithm,attr"`
+}
+
+type dsReference struct {
+	URI          string   `xml:"URI,attr"`
+	DigestMethod dsMethod `xml:"ds:DigestMethod"`
+	DigestValue  string   `xml:"ds:DigestValue"`
+}
+
+type dsSignedInfo struct {
+	XMLName                xml.Name    `xml:"ds:SignedInfo"`
+	Xmlns                  string      `xml:"xmlns:ds,attr,omitempty"`
+	CanonicalizationMethod dsMethod    `xml:"ds:CanonicalizationMethod"`
+	SignatureMethod        dsMethod    `xml:"ds:SignatureMethod"`
+	Reference              dsReference `xml:"ds:Reference"`
+}
+
+// signedInfo renders SignedInfo in exclusive canonical form: namespace
+// declared on the element itself, no whitespace, explicit end tags
+func signedInfo(uri, algorithm, digest string) ([]byte, error) {
+	return xml.Marshal(dsSignedInfo{
+		Xmlns:                  dsNamespace,
+		CanonicalizationMethod: dsMethod{Algorithm: dsExcC14N},
+		SignatureMethod:        dsMethod{Algorithm: algorithm},
+		Reference: dsReference{
+			URI:          uri,
+			DigestMethod: dsMethod{Algorithm: dsDigestSHA256},
+			DigestValue:  digest,
+		},
+	})
+}
+
+// Sign creates a detached signature for content stored under uri
+func Sign(uri string, content []byte, signer Signer) (*Signature, error) {
+	sum := sha256.Sum256(content)
+	digest := base64.StdEncoding.EncodeToString(sum[:])
+
+	info, err := signedInfo(uri, signer.Algorithm(), digest)
+	if err != nil {
+		return nil, err
+	}
+	value, err := signer.Sign(info)
+	if err != nil {
+		return nil, fmt.Errorf("sign: %w", err)
+	}
+
+	sig := &Signature{
+		Digest:    digest,
+		Value:     base64.StdEncoding.EncodeToString(value),
+		KeyID:     signer.KeyID(),
+		Algorithm: signer.Algorithm(),
+	}
+	out, err := xml.Marshal(dsSignature{
+		Xmlns: dsNamespace,
+		SignedInfo: dsSignedInfo{
+			CanonicalizationMethod: dsMethod{Algorithm: dsExcC14N},
+			SignatureMethod:        dsMethod{Algorithm: sig.Algorithm},
+			Reference: dsReference{
+				URI:          uri,
+				DigestMethod: dsMethod{Algorithm: dsDigestSHA256},
+				DigestValue:  digest,
+			},
+		},
+		SignatureValue: sig.Value,
+		KeyName:        sig.KeyID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sig.XML = append([]byte(xml.Header), out...)
+	return sig, nil
+}
+
+// Verify checks content against a detached signature made by Sign
+func Verify(content, signatureXML []byte, signer Signer) error {
+	var parsed struct {
+		SignedInfo struct {
+			SignatureMethod dsMethod `xml:"SignatureMethod"`
+			Reference       struct {
+				URI         string `xml:"URI,attr"`
+				DigestValue string `xml:"DigestValue"`
+			} `xml:"Reference"`
+		} `xml:"SignedInfo"`
+		SignatureValue string `xml:"SignatureValue"`
+	}
+	if err := xml.Unmarshal(signatureXML, &parsed); err != nil {
+		return fmt.Errorf("parse signature: %w", err)
+	}
+
+	sum := sha256.Sum256(content)
+	if base64.StdEncoding.EncodeToString(sum[:]) != parsed.SignedInfo.Reference.DigestValue {
+		return ErrSignatureMismatch
+	}
+	if parsed.SignedInfo.SignatureMethod.Algorithm != signer.Algorithm() {
+		return ErrSignatureMismatch
+	}
+	value, err := base64.StdEncoding.DecodeString(parsed.SignatureValue)
+	if err != nil {
+		return ErrSignatureMismatch
+	}
+	info, err := signedInfo(parsed.SignedInfo.Reference.URI, parsed.SignedInfo.SignatureMethod.Algorithm, parsed.SignedInfo.Reference.DigestValue)
+	if err != nil {
+		return err
+	}
+	if err := signer.Verify(info, value); err != nil {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
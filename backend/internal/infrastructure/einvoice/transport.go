@@ -0,0 +1,97 @@
+package einvoice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Envelope is a signed document ready for delivery
+type Envelope struct {
+	DocumentNo string    `json:"document_no"`
+	Format     string    `json:"format"`
+	Type       string    `json:"type"`
+	Sender     string    `json:"sender"`   // scheme:id of the seller endpoint, or its tax id
+	Receiver   string    `json:"receiver"` // scheme:id of the buyer endpoint, or its tax id
+	FileName   string    `json:"file_name"`
+	Digest     string    `json:"digest"`
+	CreatedAt  time.Time `json:"created_at"`
+	Content    []byte    `json:"-"`
+	Signature  []byte    `json:"-"`
+}
+
+// Receipt confirms that a transport accepted an envelope
+type Receipt struct {
+	Reference  string
+	AcceptedAt time.Time
+}
+
+// Transport delivers e-invoices, for example to a Peppol access point or
+// the Taiwan turnkey system
+type Transport interface {
+	Name() string
+	Send(ctx context.Context, env Envelope) (*Receipt, error)
+}
+
+// FileOutbox is the default transport. It drops each envelope into a
+// directory per format, from where an access point or the MOF turnkey
+// client picks it up. Files are written under a temporary name and renamed
+// so pollers never read half-written documents.
+type FileOutbox struct {
+	dir string
+}
+
+// NewFileOutbox creates an outbox rooted at dir
+func NewFileOutbox(dir string) *FileOutbox {
+	return &FileOutbox{dir: dir}
+}
+
+func (o *FileOutbox) Name() string {
+	return "outbox"
+}
+
+func (o *FileOutbox) Send(ctx context.Context, env Envelope) (*Receipt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(o.dir, env.Format)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(env.FileName), filepath.Ext(env.FileName))
+	manifest, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// The manifest goes last: its arrival marks the envelope complete
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{base + ".xml", env.Content},
+		{base + ".sig.xml", env.Signature},
+		{base + ".json", manifest},
+	}
+	for _, f := range files {
+		if f.content == nil {
+			continue
+		}
+		if err := writeAtomic(filepath.Join(dir, f.name), f.content); err != nil {
+			return nil, fmt.Errorf("outbox: %w", err)
+		}
+	}
+	return &Receipt{Reference: filepath.Join(env.Format, base), AcceptedAt: time.Now()}, nil
+}
+
+func writeAtomic(path string, content []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,322 @@
+package einvoice
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+)
+
+// Taiwan MIG 4.0 messages: A0401 issues a B2B invoice, B0401 issues an
+// allowance (the Taiwan credit note) against earlier invoices
+const (
+	migInvoiceNS   = "urn:GEINV:eInvoiceMessage:A0401:4.0"
+	migAllowanceNS = "urn:GEINV:eInvoiceMessage:B0401:4.0"
+)
+
+// MIG tax types
+const (
+	migTaxable    = "1"
+	migZeroRated  = "2"
+	migTaxFree    = "3"
+	migMixedTaxes = "9"
+)
+
+// NoBuyerIdentifier is the buyer identifier of buyers without a unified
+// business number
+const NoBuyerIdentifier = "0000000000"
+
+type migParty struct {
+	Identifier   string `xml:"Identifier"`
+	Name         string `xml:"Name"`
+	Address      string `xml:"Address,omitempty"`
+	EmailAddress string `xml:"EmailAddress,omitempty"`
+}
+
+type migInvoiceMain struct {
+	InvoiceNumber string   `xml:"InvoiceNumber"`
+	InvoiceDate   string   `xml:"InvoiceDate"`
+	InvoiceTime   string   `xml:"InvoiceTime"`
+	Seller        migParty `xml:"Seller"`
+	Buyer         migParty `xml:"Buyer"`
+	MainRemark    string   `xml:"MainRemark,omitempty"`
+	InvoiceType   string   `xml:"InvoiceType"`
+	DonateMark    string   `xml:"DonateMark"`
+}
+
+type migInvoiceItem struct {
+	Description    string `xml:"Description"`
+	Quantity       string `xml:"Quantity"`
+	Unit           string `xml:"Unit,omitempty"`
+	UnitPrice      string `xml:"UnitPrice"`
+	TaxType        string `xml:"TaxType,omitempty"`
+	Amount         string `xml:"Amount"`
+	SequenceNumber string `xml:"SequenceNumber"`
+}
+
+type migInvoiceAmount struct {
+	SalesAmount            int64  `xml:"SalesAmount"`
+	FreeTaxSalesAmount     int64  `xml:"FreeTaxSalesAmount"`
+	ZeroTaxSalesAmount     int64  `xml:"ZeroTaxSalesAmount"`
+	TaxType                string `xml:"TaxType"`
+	TaxRate                string `xml:"TaxRate"`
+	TaxAmount              int64  `xml:"TaxAmount"`
+	TotalAmount            int64  `xml:"TotalAmount"`
+	DiscountAmount         int64  `xml:"DiscountAmount,omitempty"`
+	OriginalCurrencyAmount string `xml:"OriginalCurrencyAmount,omitempty"`
+	ExchangeRate           string `xml:"ExchangeRate,omitempty"`
+	Currency               string `xml:"Currency,omitempty"`
+}
+
+type migInvoice struct {
+	XMLName xml.Name         `xml:"Invoice"`
+	Xmlns   string           `xml:"xmlns,attr"`
+	Main    migInvoiceMain   `xml:"Main"`
+	Details []migInvoiceItem `xml:"Details>ProductItem"`
+	Amount  migInvoiceAmount `xml:"Amount"`
+}
+
+type migAllowanceMain struct {
+	AllowanceNumber string   `xml:"AllowanceNumber"`
+	AllowanceDate   string   `xml:"AllowanceDate"`
+	Seller          migParty `xml:"Seller"`
+	Buyer           migParty `xml:"Buyer"`
+	AllowanceType   string   `xml:"AllowanceType"`
+}
+
+type migAllowanceItem struct {
+	OriginalInvoiceDate     string `xml:"OriginalInvoiceDate"`
+	OriginalInvoiceNumber   string `xml:"OriginalInvoiceNumber"`
+	OriginalDescription     string `xml:"OriginalDescription"`
+	Quantity                string `xml:"Quantity"`
+	Unit                    string `xml:"Unit,omitempty"`
+	UnitPrice               string `xml:"UnitPrice"`
+	Amount                  string `xml:"Amount"`
+	Tax                     int64  `xml:"Tax"`
+	AllowanceSequenceNumber string `xml:"AllowanceSequenceNumber"`
+	TaxType                 string `xml:"TaxType"`
+}
+
+type migAllowanceAmount struct {
+	TaxAmount   int64 `xml:"TaxAmount"`
+	TotalAmount int64 `xml:"TotalAmount"`
+}
+
+type migAllowance struct {
+	XMLName xml.Name           `xml:"Allowance"`
+	Xmlns   string             `xml:"xmlns,attr"`
+	Main    migAllowanceMain   `xml:"Main"`
+	Details []migAllowanceItem `xml:"Details>ProductItem"`
+	Amount  migAllowanceAmount `xml:"Amount"`
+}
+
+// MIGTaxType maps a VAT category to the MIG tax type
+func MIGTaxType(category string) string {
+	switch category {
+	case TaxStandard:
+		return migTaxable
+	case TaxZero, TaxExport:
+		return migZeroRated
+	default:
+		return migTaxFree
+	}
+}
+
+// MIGAmounts are the document totals in whole New Taiwan dollars
+type MIGAmounts struct {
+	Sales     int64 // taxable sales
+	ZeroTax   int64
+	FreeTax   int64
+	Discount  int64
+	Tax       int64
+	Total     int64
+	TaxType   string
+	TaxRate   float64
+	LineTaxes []int64 // tax per line, used by allowances
+}
+
+// ComputeMIG converts a computed document to New Taiwan dollars at its
+// exchange rate and totals it the way the MIG expects: whole dollars, with
+// sales split by tax type
+func ComputeMIG(d *Document) MIGAmounts {
+	rate := d.twdRate()
+	var a MIGAmounts
+	types := map[string]bool{}
+	for _, l := range d.Lines {
+		amount := twd(l.Amount * rate)
+		switch MIGTaxType(l.TaxCategory) {
+		case migTaxable:
+			a.Sales += amount
+			if l.TaxPercent > a.TaxRate {
+				a.TaxRate = l.TaxPercent
+			}
+		case migZeroRated:
+			a.ZeroTax += amount
+		default:
+			a.FreeTax += amount
+		}
+		types[MIGTaxType(l.TaxCategory)] = true
+		a.LineTaxes = append(a.LineTaxes, twd(l.Amount*rate*l.TaxPercent/100))
+	}
+	a.Discount = twd(d.Totals.AllowanceTotal * rate)
+	// The discount reduces taxable sales first
+	a.Sales -= a.Discount
+	if a.Sales < 0 {
+		a.ZeroTax += a.Sales
+		a.Sales = 0
+	}
+	a.Tax = twd(d.Totals.TaxTotal * rate)
+	a.Total = a.Sales + a.ZeroTax + a.FreeTax + a.Tax
+
+	switch {
+	case len(types) > 1:
+		a.TaxType = migMixedTaxes
+	case types[migZeroRated]:
+		a.TaxType = migZeroRated
+	case types[migTaxFree]:
+		a.TaxType = migTaxFree
+	default:
+		a.TaxType = migTaxable
+	}
+	return a
+}
+
+// MarshalMIG serializes a computed document to the Taiwan MIG 4.0: an A0401
+// invoice, or a B0401 allowance for credit notes
+func MarshalMIG(d *Document) ([]byte, error) {
+	var v interface{}
+	if d.Type == TypeCreditNote {
+		v = migAllowanceOf(d)
+	} else {
+		v = migInvoiceOf(d)
+	}
+	out, err := xml.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshal MIG: %w", err)
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func migInvoiceOf(d *Document) migInvoice {
+	a := ComputeMIG(d)
+	rate := d.twdRate()
+	inv := migInvoice{
+		Xmlns: migInvoiceNS,
+		Main: migInvoiceMain{
+			InvoiceNumber: d.ID,
+			InvoiceDate:   d.IssueDate.Format("20060102"),
+			InvoiceTime:   d.IssueDate.Format("15:04:05"),
+			Seller:        migPartyOf(d.Seller),
+			Buyer:         migPartyOf(d.Buyer),
+			MainRemark:    truncate(d.Note, 200),
+			InvoiceType:   "07", // general tax invoice
+			DonateMark:    "0",
+		},
+		Amount: migInvoiceAmount{
+			SalesAmount:        a.Sales,
+			FreeTaxSalesAmount: a.FreeTax,
+			ZeroTaxSalesAmount: a.ZeroTax,
+			TaxType:            a.TaxType,
+			TaxRate:            formatDecimal(a.TaxRate / 100),
+			TaxAmount:          a.Tax,
+			TotalAmount:        a.Total,
+			DiscountAmount:     a.Discount,
+		},
+	}
+	if d.Currency != "TWD" {
+		inv.Amount.OriginalCurrencyAmount = formatAmount(d.Totals.Payable)
+		inv.Amount.ExchangeRate = formatDecimal(rate)
+		inv.Amount.Currency = d.Currency
+	}
+	for i, l := range d.Lines {
+		item := migInvoiceItem{
+			Description:    l.Description,
+			Quantity:       formatDecimal(l.Quantity),
+			Unit:           l.UnitCode,
+			UnitPrice:      formatDecimal(roundTo(l.UnitPrice*rate, 7)),
+			Amount:         formatDecimal(roundTo(l.Amount*rate, 7)),
+			SequenceNumber: fmt.Sprintf("%d", i+1),
+		}
+		if a.TaxType == migMixedTaxes {
+			item.TaxType = MIGTaxType(l.TaxCategory)
+		}
+		inv.Details = append(inv.Details, item)
+	}
+	return inv
+}
+
+func migAllowanceOf(d *Document) migAllowance {
+	a := ComputeMIG(d)
+	rate := d.twdRate()
+	al := migAllowance{
+		Xmlns: migAllowanceNS,
+		Main: migAllowanceMain{
+			AllowanceNumber: d.ID,
+			AllowanceDate:   d.IssueDate.Format("20060102"),
+			Seller:          migPartyOf(d.Seller),
+			Buyer:           migPartyOf(d.Buyer),
+			AllowanceType:   "2", // issued by the seller
+		},
+	}
+	var original Reference
+	if d.Billing != nil {
+		original = *d.Billing
+	}
+	var total, tax int64
+	for i, l := range d.Lines {
+		amount := twd(l.Amount * rate)
+		total += amount
+		tax += a.LineTaxes[i]
+		al.Details = append(al.Details, migAllowanceItem{
+			OriginalInvoiceDate:     original.IssueDate.Format("20060102"),
+			OriginalInvoiceNumber:   original.ID,
+			OriginalDescription:     l.Description,
+			Quantity:                formatDecimal(l.Quantity),
+			Unit:                    l.UnitCode,
+			UnitPrice:               formatDecimal(roundTo(l.UnitPrice*rate, 7)),
+			Amount:                  formatDecimal(float64(amount)),
+			Tax:                     a.LineTaxes[i],
+			AllowanceSequenceNumber: fmt.Sprintf("%d", i+1),
+			TaxType:                 MIGTaxType(l.TaxCategory),
+		})
+	}
+	al.Amount = migAllowanceAmount{TaxAmount: tax, TotalAmount: total}
+	return al
+}
+
+func migPartyOf(p Party) migParty {
+	id := p.TaxID
+	if id == "" {
+		id = NoBuyerIdentifier
+	}
+	return migParty{
+		Identifier:   id,
+		Name:         p.Name,
+		Address:      p.Address,
+		EmailAddress: p.Email,
+	}
+}
+
+// twdRate is the rate converting document amounts to New Taiwan dollars
+func (d *Document) twdRate() float64 {
+	if d.Currency == "TWD" || d.ExchangeRate <= 0 {
+		return 1
+	}
+	return d.ExchangeRate
+}
+
+func twd(v float64) int64 {
+	return int64(math.Round(v))
+}
+
+func roundTo(v float64, places int) float64 {
+	p := math.Pow10(places)
+	return math.Round(v*p) / p
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
@@ -0,0 +1,346 @@
+package einvoice
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Peppol BIS Billing 3.0 identifiers
+const (
+	PeppolCustomizationID = "urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0"
+	PeppolProfileID       = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+)
+
+const (
+	ublInvoiceNS    = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	ublCreditNoteNS = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+	ublCACNS        = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	ublCBCNS        = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+// UNCL1001 document type codes
+const (
+	ublInvoiceTypeCode    = "380"
+	ublCreditNoteTypeCode = "381"
+)
+
+type ublAmount struct {
+	CurrencyID string `xml:"currencyID,attr"`
+	Value      string `xml:",chardata"`
+}
+
+type ublQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublID struct {
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+type ublTaxScheme struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type ublCountry struct {
+	Code string `xml:"cbc:IdentificationCode"`
+}
+
+type ublAddress struct {
+	Street     string     `xml:"cbc:StreetName,omitempty"`
+	City       string     `xml:"cbc:CityName,omitempty"`
+	PostalZone string     `xml:"cbc:PostalZone,omitempty"`
+	Country    ublCountry `xml:"cac:Country"`
+}
+
+type ublPartyTaxScheme struct {
+	CompanyID string       `xml:"cbc:CompanyID"`
+	TaxScheme ublTaxScheme `xml:"cac:TaxScheme"`
+}
+
+type ublLegalEntity struct {
+	Name string `xml:"cbc:RegistrationName"`
+}
+
+type ublContact struct {
+	Email string `xml:"cbc:ElectronicMail,omitempty"`
+}
+
+type ublParty struct {
+	EndpointID     *ublID             `xml:"cbc:EndpointID,omitempty"`
+	Address        ublAddress         `xml:"cac:PostalAddress"`
+	PartyTaxScheme *ublPartyTaxScheme `xml:"cac:PartyTaxScheme,omitempty"`
+	LegalEntity    ublLegalEntity     `xml:"cac:PartyLegalEntity"`
+	Contact        *ublContact        `xml:"cac:Contact,omitempty"`
+}
+
+type ublPartyWrapper struct {
+	Party ublParty `xml:"cac:Party"`
+}
+
+type ublDocumentReference struct {
+	ID        string `xml:"cbc:ID"`
+	IssueDate string `xml:"cbc:IssueDate,omitempty"`
+}
+
+type ublBillingReference struct {
+	InvoiceDocumentReference ublDocumentReference `xml:"cac:InvoiceDocumentReference"`
+}
+
+type ublOrderReference struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type ublPaymentTerms struct {
+	Note string `xml:"cbc:Note"`
+}
+
+type ublTaxCategory struct {
+	ID              string       `xml:"cbc:ID"`
+	Percent         string       `xml:"cbc:Percent,omitempty"`
+	ExemptionCode   string       `xml:"cbc:TaxExemptionReasonCode,omitempty"`
+	ExemptionReason string       `xml:"cbc:TaxExemptionReason,omitempty"`
+	TaxScheme       ublTaxScheme `xml:"cac:TaxScheme"`
+}
+
+type ublAllowanceCharge struct {
+	ChargeIndicator bool           `xml:"cbc:ChargeIndicator"`
+	Reason          string         `xml:"cbc:AllowanceChargeReason"`
+	Amount          ublAmount      `xml:"cbc:Amount"`
+	TaxCategory     ublTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type ublTaxSubtotal struct {
+	TaxableAmount ublAmount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     ublAmount      `xml:"cbc:TaxAmount"`
+	TaxCategory   ublTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type ublTaxTotal struct {
+	TaxAmount ublAmount        `xml:"cbc:TaxAmount"`
+	Subtotals []ublTaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type ublMonetaryTotal struct {
+	LineExtension  ublAmount  `xml:"cbc:LineExtensionAmount"`
+	TaxExclusive   ublAmount  `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusive   ublAmount  `xml:"cbc:TaxInclusiveAmount"`
+	AllowanceTotal *ublAmount `xml:"cbc:AllowanceTotalAmount,omitempty"`
+	Prepaid        *ublAmount `xml:"cbc:PrepaidAmount,omitempty"`
+	Payable        ublAmount  `xml:"cbc:PayableAmount"`
+}
+
+type ublClassifiedTaxCategory struct {
+	ID        string       `xml:"cbc:ID"`
+	Percent   string       `xml:"cbc:Percent,omitempty"`
+	TaxScheme ublTaxScheme `xml:"cac:TaxScheme"`
+}
+
+type ublItem struct {
+	Name        string                   `xml:"cbc:Name"`
+	TaxCategory ublClassifiedTaxCategory `xml:"cac:ClassifiedTaxCategory"`
+}
+
+type ublPrice struct {
+	Amount ublAmount `xml:"cbc:PriceAmount"`
+}
+
+type ublLine struct {
+	ID               string       `xml:"cbc:ID"`
+	InvoicedQuantity *ublQuantity `xml:"cbc:InvoicedQuantity,omitempty"`
+	CreditedQuantity *ublQuantity `xml:"cbc:CreditedQuantity,omitempty"`
+	LineExtension    ublAmount    `xml:"cbc:LineExtensionAmount"`
+	Item             ublItem      `xml:"cac:Item"`
+	Price            ublPrice     `xml:"cac:Price"`
+}
+
+type ublDocument struct {
+	XMLName            xml.Name
+	XmlnsCAC           string               `xml:"xmlns:cac,attr"`
+	XmlnsCBC           string               `xml:"xmlns:cbc,attr"`
+	CustomizationID    string               `xml:"cbc:CustomizationID"`
+	ProfileID          string               `xml:"cbc:ProfileID"`
+	ID                 string               `xml:"cbc:ID"`
+	IssueDate          string               `xml:"cbc:IssueDate"`
+	DueDate            string               `xml:"cbc:DueDate,omitempty"`
+	InvoiceTypeCode    string               `xml:"cbc:InvoiceTypeCode,omitempty"`
+	CreditNoteTypeCode string               `xml:"cbc:CreditNoteTypeCode,omitempty"`
+	Note               string               `xml:"cbc:Note,omitempty"`
+	DocumentCurrency   string               `xml:"cbc:DocumentCurrencyCode"`
+	BuyerReference     string               `xml:"cbc:BuyerReference,omitempty"`
+	OrderReference     *ublOrderReference   `xml:"cac:OrderReference,omitempty"`
+	BillingReference   *ublBillingReference `xml:"cac:BillingReference,omitempty"`
+	Supplier           ublPartyWrapper      `xml:"cac:AccountingSupplierParty"`
+	Customer           ublPartyWrapper      `xml:"cac:AccountingCustomerParty"`
+	PaymentTerms       *ublPaymentTerms     `xml:"cac:PaymentTerms,omitempty"`
+	AllowanceCharges   []ublAllowanceCharge `xml:"cac:AllowanceCharge"`
+	TaxTotal           ublTaxTotal          `xml:"cac:TaxTotal"`
+	LegalMonetaryTotal ublMonetaryTotal     `xml:"cac:LegalMonetaryTotal"`
+	InvoiceLines       []ublLine            `xml:"cac:InvoiceLine"`
+	CreditNoteLines    []ublLine            `xml:"cac:CreditNoteLine"`
+}
+
+// MarshalUBL serializes a computed document to UBL 2.1 following Peppol BIS
+// Billing 3.0: an Invoice, or a CreditNote for credit notes
+func MarshalUBL(d *Document) ([]byte, error) {
+	cur := d.Currency
+	amount := func(v float64) ublAmount { return ublAmount{CurrencyID: cur, Value: formatAmount(v)} }
+
+	doc := ublDocument{
+		XmlnsCAC:         ublCACNS,
+		XmlnsCBC:         ublCBCNS,
+		CustomizationID:  PeppolCustomizationID,
+		ProfileID:        PeppolProfileID,
+		ID:               d.ID,
+		IssueDate:        formatDate(d.IssueDate),
+		Note:             d.Note,
+		DocumentCurrency: cur,
+		BuyerReference:   d.BuyerReference,
+		Supplier:         ublPartyWrapper{Party: ublPartyOf(d.Seller)},
+		Customer:         ublPartyWrapper{Party: ublPartyOf(d.Buyer)},
+	}
+	if d.Type == TypeCreditNote {
+		doc.XMLName = xml.Name{Local: "CreditNote", Space: ublCreditNoteNS}
+		doc.CreditNoteTypeCode = ublCreditNoteTypeCode
+	} else {
+		doc.XMLName = xml.Name{Local: "Invoice", Space: ublInvoiceNS}
+		doc.InvoiceTypeCode = ublInvoiceTypeCode
+		if !d.DueDate.IsZero() {
+			doc.DueDate = formatDate(d.DueDate)
+		}
+	}
+	if d.OrderReference != "" {
+		doc.OrderReference = &ublOrderReference{ID: d.OrderReference}
+	}
+	if d.Billing != nil {
+		doc.BillingReference = &ublBillingReference{InvoiceDocumentReference: ublDocumentReference{
+			ID:        d.Billing.ID,
+			IssueDate: formatDate(d.Billing.IssueDate),
+		}}
+	}
+	if d.PaymentTerms != "" {
+		doc.PaymentTerms = &ublPaymentTerms{Note: d.PaymentTerms}
+	}
+
+	for _, a := range d.Allowances {
+		doc.AllowanceCharges = append(doc.AllowanceCharges, ublAllowanceCharge{
+			Reason:      a.Reason,
+			Amount:      amount(a.Amount),
+			TaxCategory: ublTaxCategoryOf(a.TaxCategory, a.TaxPercent, "", ""),
+		})
+	}
+
+	t := d.Totals
+	doc.TaxTotal = ublTaxTotal{TaxAmount: amount(t.TaxTotal)}
+	for _, s := range t.Subtotals {
+		doc.TaxTotal.Subtotals = append(doc.TaxTotal.Subtotals, ublTaxSubtotal{
+			TaxableAmount: amount(s.TaxableAmount),
+			TaxAmount:     amount(s.TaxAmount),
+			TaxCategory:   ublTaxCategoryOf(s.Category, s.Percent, s.ExemptionCode, s.ExemptionText),
+		})
+	}
+	doc.LegalMonetaryTotal = ublMonetaryTotal{
+		LineExtension: amount(t.LineExtension),
+		TaxExclusive:  amount(t.TaxExclusive),
+		TaxInclusive:  amount(t.TaxInclusive),
+		Payable:       amount(t.Payable),
+	}
+	if t.AllowanceTotal != 0 {
+		a := amount(t.AllowanceTotal)
+		doc.LegalMonetaryTotal.AllowanceTotal = &a
+	}
+	if t.Prepaid != 0 {
+		p := amount(t.Prepaid)
+		doc.LegalMonetaryTotal.Prepaid = &p
+	}
+
+	for _, l := range d.Lines {
+		line := ublLine{
+			ID:            l.ID,
+			LineExtension: amount(l.Amount),
+			Item: ublItem{
+				Name: l.Description,
+				TaxCategory: ublClassifiedTaxCategory{
+					ID:        l.TaxCategory,
+					Percent:   taxPercent(l.TaxCategory, l.TaxPercent),
+					TaxScheme: ublTaxScheme{ID: "VAT"},
+				},
+			},
+			Price: ublPrice{Amount: ublAmount{CurrencyID: cur, Value: formatDecimal(l.UnitPrice)}},
+		}
+		qty := &ublQuantity{UnitCode: l.UnitCode, Value: formatDecimal(l.Quantity)}
+		if d.Type == TypeCreditNote {
+			line.CreditedQuantity = qty
+			doc.CreditNoteLines = append(doc.CreditNoteLines, line)
+		} else {
+			line.InvoicedQuantity = qty
+			doc.InvoiceLines = append(doc.InvoiceLines, line)
+		}
+	}
+
+	out, err := xml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("marshal UBL: %w", err)
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func ublPartyOf(p Party) ublParty {
+	party := ublParty{
+		Address: ublAddress{
+			Street:     p.Address,
+			City:       p.City,
+			PostalZone: p.PostalCode,
+			Country:    ublCountry{Code: p.Country},
+		},
+		LegalEntity: ublLegalEntity{Name: p.Name},
+	}
+	if p.EndpointID != "" {
+		party.EndpointID = &ublID{SchemeID: p.EndpointScheme, Value: p.EndpointID}
+	}
+	if p.TaxID != "" {
+		party.PartyTaxScheme = &ublPartyTaxScheme{CompanyID: p.TaxID, TaxScheme: ublTaxScheme{ID: "VAT"}}
+	}
+	if p.Email != "" {
+		party.Contact = &ublContact{Email: p.Email}
+	}
+	return party
+}
+
+func ublTaxCategoryOf(category string, percent float64, code, reason string) ublTaxCategory {
+	return ublTaxCategory{
+		ID:              category,
+		Percent:         taxPercent(category, percent),
+		ExemptionCode:   code,
+		ExemptionReason: reason,
+		TaxScheme:       ublTaxScheme{ID: "VAT"},
+	}
+}
+
+// taxPercent leaves out the rate of items outside the scope of tax, which
+// carry none
+func taxPercent(category string, percent float64) string {
+	if category == TaxOutOfScope {
+		return ""
+	}
+	return formatDecimal(percent)
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(Round(v), 'f', 2, 64)
+}
+
+// formatDecimal writes quantities, prices and rates without trailing zeros
+func formatDecimal(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
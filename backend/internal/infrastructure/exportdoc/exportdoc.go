@@ -0,0 +1,236 @@
+// Package exportdoc builds the commercial invoice, packing list and
+// certificate of origin for a shipment and renders them as PDF and XLSX.
+//
+// Line weights prefer the carton weights recorded when packing; shipment
+// totals prefer the applied load plan, whose gross weight includes pallets.
+// Weights are in kg.
+package exportdoc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Export document types, matching TradeDocument.DocumentType
+const (
+	CommercialInvoice   = "invoice"
+	PackingList         = "packing_list"
+	CertificateOfOrigin = "co"
+)
+
+// StatusSuperseded is the status of a document replaced by a later version
+const StatusSuperseded = "superseded"
+
+// ErrMixedCurrency is returned when a line is valued in another currency
+// than the document, since the documents print a single total
+var ErrMixedCurrency = errors.New("shipment lines are valued in more than one currency")
+
+// Titles maps each document type to the title printed on it
+var Titles = map[string]string{
+	CommercialInvoice:   "COMMERCIAL INVOICE",
+	PackingList:         "PACKING LIST",
+	CertificateOfOrigin: "CERTIFICATE OF ORIGIN",
+}
+
+// Item is one shipment line as recorded on the shipment
+type Item struct {
+	Marks                string
+	ProductName          string
+	Description          string
+	HSCode               string
+	Quantity             float64
+	Unit                 string
+	UnitValue            float64
+	TotalValue           float64
+	Currency             string
+	CartonCount          int
+	QuantityPerCarton    float64
+	NetWeightPerCarton   float64
+	GrossWeightPerCarton float64
+	TotalWeight          float64
+	UnitWeight           float64
+	CountryOfOrigin      string
+}
+
+// Line is one shipment line as printed on the export documents
+type Line struct {
+	Marks                string
+	Description          string
+	HSCode               string
+	Quantity             float64
+	Unit                 string
+	UnitPrice            float64
+	Amount               float64
+	Cartons              int
+	QuantityPerCarton    float64
+	NetWeightPerCarton   float64
+	GrossWeightPerCarton float64
+	NetWeight            float64
+	GrossWeight          float64
+	CountryOfOrigin      string
+}
+
+// Data collects everything the document templates need
+type Data struct {
+	DocumentNo       string
+	Date             time.Time
+	ShipmentNo       string
+	OrderNo          string
+	CustomerPO       string
+	ExporterName     string
+	ExporterAddress  string
+	ConsigneeName    string
+	ConsigneeAddress string
+	ConsigneeCountry string
+	Incoterm         string
+	PaymentTerms     string
+	Method           string
+	Carrier          string
+	PortOfLoading    string
+	PortOfDischarge  string
+	Currency         string
+	Lines            []Line
+	TotalAmount      float64
+	TotalCartons     int
+	TotalNetWeight   float64
+	TotalGrossWeight float64
+
+	// Shipment totals from the applied load plan; gross weight includes pallets
+	PackageCount        int
+	PackageType         string
+	ShipmentGrossWeight float64
+	ShipmentNetWeight   float64
+	Volume              float64
+	Containers          string
+}
+
+// AddItem adds a shipment line and its amount, cartons and weights to the
+// document totals. The document takes the currency of the order, or of the
+// first line that names one; a line in another currency is rejected with
+// ErrMixedCurrency.
+func (d *Data) AddItem(item Item) error {
+	if item.Currency != "" {
+		if d.Currency == "" {
+			d.Currency = item.Currency
+		} else if !strings.EqualFold(d.Currency, item.Currency) {
+			return fmt.Errorf("%w: %s is valued in %s, the document in %s", ErrMixedCurrency, item.ProductName, item.Currency, d.Currency)
+		}
+	}
+
+	line := Line{
+		Marks:                item.Marks,
+		Description:          item.ProductName,
+		HSCode:               item.HSCode,
+		Quantity:             item.Quantity,
+		Unit:                 item.Unit,
+		UnitPrice:            item.UnitValue,
+		Amount:               item.TotalValue,
+		Cartons:              item.CartonCount,
+		QuantityPerCarton:    item.QuantityPerCarton,
+		NetWeightPerCarton:   item.NetWeightPerCarton,
+		GrossWeightPerCarton: item.GrossWeightPerCarton,
+		CountryOfOrigin:      item.CountryOfOrigin,
+	}
+	if item.Description != "" {
+		line.Description = item.ProductName + " - " + item.Description
+	}
+	if line.Amount == 0 {
+		line.Amount = item.Quantity * item.UnitValue
+	}
+
+	// Carton weights are authoritative; fall back to the unit weights otherwise
+	if item.CartonCount > 0 && item.NetWeightPerCarton > 0 {
+		line.NetWeight = float64(item.CartonCount) * item.NetWeightPerCarton
+	} else if item.TotalWeight > 0 {
+		line.NetWeight = item.TotalWeight
+	} else {
+		line.NetWeight = item.Quantity * item.UnitWeight
+	}
+	if item.CartonCount > 0 && item.GrossWeightPerCarton > 0 {
+		line.GrossWeight = float64(item.CartonCount) * item.GrossWeightPerCarton
+	} else {
+		line.GrossWeight = line.NetWeight
+	}
+
+	d.TotalAmount += line.Amount
+	d.TotalCartons += line.Cartons
+	d.TotalNetWeight += line.NetWeight
+	d.TotalGrossWeight += line.GrossWeight
+	d.Lines = append(d.Lines, line)
+	return nil
+}
+
+// CompleteShipmentTotals fills the shipment totals the load plan left open
+// from the line totals. Call it after the last AddItem.
+func (d *Data) CompleteShipmentTotals() {
+	// Line gross weights exclude pallets, so the shipment weighs at least as much
+	if d.ShipmentGrossWeight < d.TotalGrossWeight {
+		d.ShipmentGrossWeight = d.TotalGrossWeight
+	}
+	if d.ShipmentNetWeight == 0 {
+		d.ShipmentNetWeight = d.TotalNetWeight
+	}
+	if d.PackageCount == 0 {
+		d.PackageCount = d.TotalCartons
+		d.PackageType = "carton"
+	}
+}
+
+// PackingSummary is the shipment total block printed under the packing list
+func (d *Data) PackingSummary() [][]interface{} {
+	packages := fmt.Sprintf("%d %s(s)", d.PackageCount, d.PackageType)
+	if d.PackageType == "pallet" {
+		packages = fmt.Sprintf("%d pallet(s), %d carton(s)", d.PackageCount, d.TotalCartons)
+	}
+	rows := [][]interface{}{
+		{"Total Packages", packages},
+		{"Total Net Weight (kg)", fmt.Sprintf("%.2f", d.ShipmentNetWeight)},
+		{"Total Gross Weight (kg)", fmt.Sprintf("%.2f", d.ShipmentGrossWeight)},
+	}
+	if d.Volume > 0 {
+		rows = append(rows, []interface{}{"Measurement (CBM)", fmt.Sprintf("%.3f", d.Volume)})
+	}
+	if d.Containers != "" {
+		rows = append(rows, []interface{}{"Containers", d.Containers})
+	}
+	return rows
+}
+
+// Stored is a document of one type already generated for the shipment
+type Stored struct {
+	ID      uuid.UUID
+	Version int
+	Status  string
+}
+
+// Revision returns the version of the next generated documents of a type
+// and the IDs of the stored documents it supersedes: every version that has
+// not been superseded yet, in every format
+func Revision(stored []Stored) (version int, supersedes []uuid.UUID) {
+	version = 1
+	for _, doc := range stored {
+		if doc.Version >= version {
+			version = doc.Version + 1
+		}
+		if doc.Status != StatusSuperseded {
+			supersedes = append(supersedes, doc.ID)
+		}
+	}
+	return version, supersedes
+}
+
+// DocumentNo numbers a document by type, shipment and version, e.g. CI-SH001-V2
+func DocumentNo(docType, shipmentNo string, version int) string {
+	prefix := "CO"
+	switch docType {
+	case CommercialInvoice:
+		prefix = "CI"
+	case PackingList:
+		prefix = "PL"
+	}
+	return fmt.Sprintf("%s-%s-V%d", prefix, shipmentNo, version)
+}
@@ -0,0 +1,245 @@
+package exportdoc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddItemLineWeights(t *testing.T) {
+	tests := []struct {
+		name      string
+		item      Item
+		wantNet   float64
+		wantGross float64
+	}{
+		{"carton weights", Item{Quantity: 5000, CartonCount: 10, NetWeightPerCarton: 24.5, GrossWeightPerCarton: 25, TotalWeight: 200, UnitWeight: 0.04}, 245, 250},
+		{"total weight without carton weights", Item{Quantity: 5000, CartonCount: 10, TotalWeight: 200, UnitWeight: 0.04}, 200, 200},
+		{"unit weight", Item{Quantity: 5000, UnitWeight: 0.04}, 200, 200},
+		{"carton gross weight over unit net weight", Item{Quantity: 5000, CartonCount: 10, GrossWeightPerCarton: 21, UnitWeight: 0.04}, 200, 210},
+		{"no weights", Item{Quantity: 5000}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data Data
+			require.NoError(t, data.AddItem(tt.item))
+			require.Len(t, data.Lines, 1)
+			assert.InDelta(t, tt.wantNet, data.Lines[0].NetWeight, 1e-9)
+			assert.InDelta(t, tt.wantGross, data.Lines[0].GrossWeight, 1e-9)
+		})
+	}
+}
+
+func TestAddItemTotals(t *testing.T) {
+	data := Data{}
+	require.NoError(t, data.AddItem(Item{ProductName: "Hex Bolt M8x40", Description: "zinc plated", Quantity: 10000, UnitValue: 0.05,
+		Currency: "USD", CartonCount: 20, NetWeightPerCarton: 24.5, GrossWeightPerCarton: 25}))
+	require.NoError(t, data.AddItem(Item{ProductName: "Hex Nut M8", Quantity: 20000, UnitValue: 0.01, TotalValue: 210,
+		Currency: "usd", CartonCount: 8, NetWeightPerCarton: 19.6, GrossWeightPerCarton: 20}))
+	require.NoError(t, data.AddItem(Item{ProductName: "Washer M8", Quantity: 1000, UnitValue: 0.02, UnitWeight: 0.003}))
+
+	require.Len(t, data.Lines, 3)
+	assert.Equal(t, "Hex Bolt M8x40 - zinc plated", data.Lines[0].Description)
+	assert.Equal(t, "Hex Nut M8", data.Lines[1].Description)
+	assert.InDelta(t, 500, data.Lines[0].Amount, 1e-9, "amount falls back to quantity x unit value")
+	assert.InDelta(t, 210, data.Lines[1].Amount, 1e-9, "a recorded total value is kept")
+
+	assert.InDelta(t, 730, data.TotalAmount, 1e-9)
+	assert.Equal(t, 28, data.TotalCartons)
+	assert.InDelta(t, 490+156.8+3, data.TotalNetWeight, 1e-9)
+	assert.InDelta(t, 500+160+3, data.TotalGrossWeight, 1e-9)
+	assert.Equal(t, "USD", data.Currency, "the first line's currency is used when the order has none")
+
+}
+
+func TestAddItemRejectsOtherCurrencies(t *testing.T) {
+	order := Data{Currency: "USD"}
+	require.NoError(t, order.AddItem(Item{ProductName: "Hex Bolt M8x40", Quantity: 100, UnitValue: 0.05, Currency: "USD"}))
+
+	err := order.AddItem(Item{ProductName: "Hex Nut M8", Quantity: 100, UnitValue: 0.01, Currency: "EUR"})
+	assert.ErrorIs(t, err, ErrMixedCurrency)
+	assert.EqualError(t, err, "shipment lines are valued in more than one currency: Hex Nut M8 is valued in EUR, the document in USD")
+	assert.Len(t, order.Lines, 1, "the rejected line is not added")
+	assert.InDelta(t, 5, order.TotalAmount, 1e-9)
+
+	lines := Data{}
+	require.NoError(t, lines.AddItem(Item{Quantity: 1, Currency: "EUR"}))
+	assert.ErrorIs(t, lines.AddItem(Item{Quantity: 1, Currency: "USD"}), ErrMixedCurrency, "the first line sets the currency without an order")
+}
+
+func TestCompleteShipmentTotals(t *testing.T) {
+	lines := func(d Data) Data {
+		require.NoError(t, d.AddItem(Item{Quantity: 10000, CartonCount: 20, NetWeightPerCarton: 24.5, GrossWeightPerCarton: 25}))
+		d.CompleteShipmentTotals()
+		return d
+	}
+
+	fromLines := lines(Data{})
+	assert.InDelta(t, 500, fromLines.ShipmentGrossWeight, 1e-9)
+	assert.InDelta(t, 490, fromLines.ShipmentNetWeight, 1e-9)
+	assert.Equal(t, 20, fromLines.PackageCount)
+	assert.Equal(t, "carton", fromLines.PackageType)
+
+	palletized := lines(Data{PackageCount: 2, PackageType: "pallet", ShipmentGrossWeight: 540, ShipmentNetWeight: 490})
+	assert.InDelta(t, 540, palletized.ShipmentGrossWeight, 1e-9, "the load plan gross weight includes pallets")
+	assert.Equal(t, 2, palletized.PackageCount)
+	assert.Equal(t, "pallet", palletized.PackageType)
+	assert.Equal(t, []interface{}{"Total Packages", "2 pallet(s), 20 carton(s)"}, palletized.PackingSummary()[0])
+
+	stale := lines(Data{ShipmentGrossWeight: 300})
+	assert.InDelta(t, 500, stale.ShipmentGrossWeight, 1e-9, "the shipment never weighs less than its lines")
+}
+
+// runeWidth measures one unit per character, wide characters two
+func runeWidth(s string) float64 {
+	w := 0.0
+	for _, r := range s {
+		if r >= 0x1100 {
+			w += 2
+		} else {
+			w++
+		}
+	}
+	return w
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name  string
+		v     string
+		width float64
+		want  string
+	}{
+		{"fits", "Hex Bolt", 8, "Hex Bolt"},
+		{"latin", "Hex Bolt M8x40", 10, "Hex Bol..."},
+		{"trailing space is dropped", "Hex Bolt M8x40", 12, "Hex Bolt..."},
+		{"chinese", "六角螺栓鍍鋅處理", 9, "六角螺..."},
+		{"chinese rounds down to whole characters", "六角螺栓鍍鋅處理", 10, "六角螺..."},
+		{"accented", "Écrou hexagonal à embase", 9, "Écrou..."},
+		{"nothing fits", "六角螺栓", 3, ""},
+		{"empty", "", 5, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncate(tt.v, tt.width, runeWidth)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, utf8.ValidString(got))
+			assert.LessOrEqual(t, runeWidth(got), tt.width)
+		})
+	}
+}
+
+func TestTruncateWithFont(t *testing.T) {
+	pdf, err := newPDF(DefaultFont())
+	require.NoError(t, err)
+	pdf.SetFont(DefaultFont().Family, "", 8)
+
+	for _, v := range []string{
+		strings.Repeat("Hex Bolt M8x40 zinc plated ", 5),
+		strings.Repeat("Болт с шестигранной головкой ", 5),
+		strings.Repeat("Βίδα εξάγωνη ", 8),
+	} {
+		got := truncate(v, 40, pdf.GetStringWidth)
+		assert.True(t, utf8.ValidString(got), got)
+		assert.True(t, strings.HasSuffix(got, ellipsis), got)
+		assert.LessOrEqual(t, pdf.GetStringWidth(got), 40.0, got)
+		assert.Greater(t, pdf.GetStringWidth(got), 30.0, "cut at the cell width, not short of it: %s", got)
+	}
+}
+
+func TestRevision(t *testing.T) {
+	v1pdf, v1xlsx, v2pdf, v2xlsx := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	tests := []struct {
+		name           string
+		stored         []Stored
+		wantVersion    int
+		wantSupersedes []uuid.UUID
+	}{
+		{"first generation", nil, 1, nil},
+		{"both formats of the current version", []Stored{
+			{ID: v1pdf, Version: 1, Status: "draft"},
+			{ID: v1xlsx, Version: 1, Status: "draft"},
+		}, 2, []uuid.UUID{v1pdf, v1xlsx}},
+		{"earlier versions stay superseded", []Stored{
+			{ID: v2pdf, Version: 2, Status: "approved"},
+			{ID: v2xlsx, Version: 2, Status: "draft"},
+			{ID: v1pdf, Version: 1, Status: StatusSuperseded},
+			{ID: v1xlsx, Version: 1, Status: StatusSuperseded},
+		}, 3, []uuid.UUID{v2pdf, v2xlsx}},
+		{"unordered", []Stored{
+			{ID: v1pdf, Version: 1, Status: StatusSuperseded},
+			{ID: v2pdf, Version: 2, Status: "draft"},
+		}, 3, []uuid.UUID{v2pdf}},
+		{"all superseded", []Stored{
+			{ID: v1pdf, Version: 1, Status: StatusSuperseded},
+		}, 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, supersedes := Revision(tt.stored)
+			assert.Equal(t, tt.wantVersion, version)
+			assert.Equal(t, tt.wantSupersedes, supersedes)
+		})
+	}
+}
+
+func TestDocumentNo(t *testing.T) {
+	assert.Equal(t, "CI-SH2026001-V1", DocumentNo(CommercialInvoice, "SH2026001", 1))
+	assert.Equal(t, "PL-SH2026001-V2", DocumentNo(PackingList, "SH2026001", 2))
+	assert.Equal(t, "CO-SH2026001-V3", DocumentNo(CertificateOfOrigin, "SH2026001", 3))
+}
+
+func TestLoadFont(t *testing.T) {
+	font, err := LoadFont("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultFont().Family, font.Family)
+
+	_, err = LoadFont(filepath.Join(t.TempDir(), "missing.ttf"))
+	assert.Error(t, err)
+
+	garbage := filepath.Join(t.TempDir(), "garbage.ttf")
+	require.NoError(t, os.WriteFile(garbage, []byte("not a font"), 0644))
+	_, err = LoadFont(garbage)
+	assert.Error(t, err)
+
+	font, err = LoadFont("fonts/DejaVuSansCondensed.ttf")
+	require.NoError(t, err)
+	assert.Equal(t, font.Regular, font.Bold)
+}
+
+func TestRender(t *testing.T) {
+	data := &Data{
+		DocumentNo:    "CI-SH2026001-V1",
+		Date:          time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC),
+		ShipmentNo:    "SH2026001",
+		ExporterName:  "Fastenmind Co., Ltd.",
+		ConsigneeName: "ООО Крепёж",
+		Currency:      "USD",
+	}
+	require.NoError(t, data.AddItem(Item{ProductName: "Болт с шестигранной головкой M8x40, оцинкованный, класс прочности 8.8",
+		Quantity: 10000, UnitValue: 0.05, CartonCount: 20, NetWeightPerCarton: 24.5, GrossWeightPerCarton: 25}))
+	data.CompleteShipmentTotals()
+
+	for docType := range Titles {
+		content, err := RenderPDF(docType, data, DefaultFont())
+		require.NoError(t, err, docType)
+		assert.True(t, strings.HasPrefix(string(content), "%PDF"), docType)
+
+		content, err = RenderXLSX(docType, data)
+		require.NoError(t, err, docType)
+		assert.NotEmpty(t, content, docType)
+	}
+
+	_, err := RenderPDF("bl", data, DefaultFont())
+	assert.EqualError(t, err, "unsupported export document type: bl")
+	_, err = RenderXLSX("bl", data)
+	assert.EqualError(t, err, "unsupported export document type: bl")
+}
@@ -0,0 +1,282 @@
+package exportdoc
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/xuri/excelize/v2"
+)
+
+// DejaVu Sans covers Latin, Greek and Cyrillic. Names and addresses in
+// Chinese, Japanese or Korean need a CJK font configured with LoadFont.
+var (
+	//go:embed fonts/DejaVuSansCondensed.ttf
+	dejaVuRegular []byte
+	//go:embed fonts/DejaVuSansCondensed-Bold.ttf
+	dejaVuBold []byte
+)
+
+// ellipsis marks text cut to fit its cell
+const ellipsis = "..."
+
+// Font is the TrueType font the PDF documents are printed in
+type Font struct {
+	Family  string
+	Regular []byte
+	Bold    []byte
+}
+
+// DefaultFont returns the embedded DejaVu Sans Condensed
+func DefaultFont() Font {
+	return Font{Family: "DejaVuSansCondensed", Regular: dejaVuRegular, Bold: dejaVuBold}
+}
+
+// LoadFont loads the TrueType font file at path, used for regular and bold
+// text alike, or returns the default font when path is empty
+func LoadFont(path string) (Font, error) {
+	if path == "" {
+		return DefaultFont(), nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Font{}, err
+	}
+	font := Font{Family: "DocumentFont", Regular: content, Bold: content}
+	if _, err := newPDF(font); err != nil {
+		return Font{}, err
+	}
+	return font, nil
+}
+
+// newPDF starts a landscape A4 document with font registered
+func newPDF(font Font) (pdf *gofpdf.Fpdf, err error) {
+	// The TrueType parser panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid font %s: %v", font.Family, r)
+		}
+	}()
+
+	pdf = gofpdf.New("L", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes(font.Family, "", font.Regular)
+	pdf.AddUTF8FontFromBytes(font.Family, "B", font.Bold)
+	pdf.SetFont(font.Family, "", 9)
+	if err := pdf.Error(); err != nil {
+		return nil, fmt.Errorf("invalid font %s: %w", font.Family, err)
+	}
+	return pdf, nil
+}
+
+// RenderPDF renders one export document type as PDF
+func RenderPDF(docType string, data *Data, font Font) ([]byte, error) {
+	title, ok := Titles[docType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported export document type: %s", docType)
+	}
+
+	pdf, err := newPDF(font)
+	if err != nil {
+		return nil, err
+	}
+	pdf.AddPage()
+
+	pdf.SetFont(font.Family, "B", 16)
+	pdf.CellFormat(0, 10, title, "", 1, "C", false, 0, "")
+	pdf.Ln(2)
+
+	// Parties and shipment header
+	pdf.SetFont(font.Family, "", 9)
+	y := pdf.GetY()
+	pdf.SetXY(10, y)
+	pdf.MultiCell(135, 5, fmt.Sprintf("Exporter:\n%s\n%s", data.ExporterName, data.ExporterAddress), "1", "L", false)
+	pdf.SetXY(150, y)
+	pdf.MultiCell(137, 5, fmt.Sprintf("Document No: %s\nDate: %s\nShipment No: %s\nOrder No: %s   Customer PO: %s",
+		data.DocumentNo, data.Date.Format("2006-01-02"), data.ShipmentNo, data.OrderNo, data.CustomerPO), "1", "L", false)
+	y = pdf.GetY() + 2
+	pdf.SetXY(10, y)
+	pdf.MultiCell(135, 5, fmt.Sprintf("Consignee:\n%s\n%s\n%s", data.ConsigneeName, data.ConsigneeAddress, data.ConsigneeCountry), "1", "L", false)
+	pdf.SetXY(150, y)
+	pdf.MultiCell(137, 5, fmt.Sprintf("Incoterm: %s\nPayment Terms: %s\nTransport: %s %s\nFrom %s to %s",
+		data.Incoterm, data.PaymentTerms, data.Method, data.Carrier, data.PortOfLoading, data.PortOfDischarge), "1", "L", false)
+	pdf.Ln(4)
+
+	switch docType {
+	case CommercialInvoice:
+		writePDFTable(pdf, font,
+			[]string{"Marks", "Description", "HS Code", "Qty", "Unit", "Unit Price", "Amount (" + data.Currency + ")"},
+			[]float64{35, 95, 25, 25, 15, 40, 42},
+			func(l Line) []string {
+				return []string{l.Marks, l.Description, l.HSCode, formatQty(l.Quantity), l.Unit,
+					fmt.Sprintf("%.4f", l.UnitPrice), fmt.Sprintf("%.2f", l.Amount)}
+			}, data.Lines)
+		pdf.SetFont(font.Family, "B", 9)
+		pdf.CellFormat(235, 6, "TOTAL", "1", 0, "R", false, 0, "")
+		pdf.CellFormat(42, 6, fmt.Sprintf("%s %.2f", data.Currency, data.TotalAmount), "1", 1, "R", false, 0, "")
+	case PackingList:
+		writePDFTable(pdf, font,
+			[]string{"Marks", "Description", "HS Code", "Qty", "Cartons", "Qty/Ctn", "N.W./Ctn", "G.W./Ctn", "N.W. (kg)", "G.W. (kg)"},
+			[]float64{35, 80, 22, 22, 18, 20, 20, 20, 20, 20},
+			func(l Line) []string {
+				return []string{l.Marks, l.Description, l.HSCode, formatQty(l.Quantity), fmt.Sprintf("%d", l.Cartons),
+					formatQty(l.QuantityPerCarton), fmt.Sprintf("%.2f", l.NetWeightPerCarton), fmt.Sprintf("%.2f", l.GrossWeightPerCarton),
+					fmt.Sprintf("%.2f", l.NetWeight), fmt.Sprintf("%.2f", l.GrossWeight)}
+			}, data.Lines)
+		pdf.SetFont(font.Family, "B", 9)
+		pdf.CellFormat(159, 6, "TOTAL", "1", 0, "R", false, 0, "")
+		pdf.CellFormat(18, 6, fmt.Sprintf("%d", data.TotalCartons), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(60, 6, "", "1", 0, "R", false, 0, "")
+		pdf.CellFormat(20, 6, fmt.Sprintf("%.2f", data.TotalNetWeight), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(20, 6, fmt.Sprintf("%.2f", data.TotalGrossWeight), "1", 1, "R", false, 0, "")
+		pdf.Ln(4)
+		pdf.SetFont(font.Family, "", 9)
+		for _, row := range data.PackingSummary() {
+			pdf.CellFormat(50, 5, row[0].(string)+":", "", 0, "L", false, 0, "")
+			pdf.CellFormat(0, 5, row[1].(string), "", 1, "L", false, 0, "")
+		}
+	case CertificateOfOrigin:
+		writePDFTable(pdf, font,
+			[]string{"Marks", "Description of Goods", "HS Code", "Qty", "Unit", "G.W. (kg)", "Origin"},
+			[]float64{35, 110, 25, 25, 15, 30, 37},
+			func(l Line) []string {
+				return []string{l.Marks, l.Description, l.HSCode, formatQty(l.Quantity), l.Unit,
+					fmt.Sprintf("%.2f", l.GrossWeight), l.CountryOfOrigin}
+			}, data.Lines)
+		pdf.Ln(6)
+		pdf.SetFont(font.Family, "", 9)
+		pdf.MultiCell(0, 5, "The undersigned hereby declares that the above details and statements are correct "+
+			"and that all the goods were produced in the country of origin stated above.", "", "L", false)
+		pdf.Ln(12)
+		pdf.CellFormat(0, 5, "Authorized Signature: ______________________________", "", 1, "L", false, 0, "")
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writePDFTable(pdf *gofpdf.Fpdf, font Font, headers []string, widths []float64, row func(Line) []string, lines []Line) {
+	pdf.SetFont(font.Family, "B", 8)
+	pdf.SetFillColor(220, 220, 220)
+	for i, h := range headers {
+		pdf.CellFormat(widths[i], 7, h, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont(font.Family, "", 8)
+	margins := 2 * pdf.GetCellMargin()
+	for _, l := range lines {
+		for i, v := range row(l) {
+			align := "R"
+			if i < 3 {
+				align = "L"
+			}
+			pdf.CellFormat(widths[i], 6, truncate(v, widths[i]-margins, pdf.GetStringWidth), "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+}
+
+// truncate cuts v to whole characters so it fits width as measured in the
+// current font, keeping long descriptions from overflowing fixed-width cells
+func truncate(v string, width float64, measure func(string) float64) string {
+	if measure(v) <= width {
+		return v
+	}
+	runes := []rune(v)
+	for n := len(runes) - 1; n > 0; n-- {
+		cut := strings.TrimRight(string(runes[:n]), " ") + ellipsis
+		if measure(cut) <= width {
+			return cut
+		}
+	}
+	return ""
+}
+
+// RenderXLSX renders one export document type as a spreadsheet
+func RenderXLSX(docType string, data *Data) ([]byte, error) {
+	title, ok := Titles[docType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported export document type: %s", docType)
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := "Sheet1"
+	f.SetCellValue(sheet, "A1", title)
+	header := [][]interface{}{
+		{"Document No", data.DocumentNo, "Date", data.Date.Format("2006-01-02")},
+		{"Shipment No", data.ShipmentNo, "Order No", data.OrderNo},
+		{"Exporter", data.ExporterName, "Customer PO", data.CustomerPO},
+		{"Exporter Address", data.ExporterAddress, "Incoterm", data.Incoterm},
+		{"Consignee", data.ConsigneeName, "Payment Terms", data.PaymentTerms},
+		{"Consignee Address", data.ConsigneeAddress, "Transport", strings.TrimSpace(data.Method + " " + data.Carrier)},
+		{"Port of Loading", data.PortOfLoading, "Port of Discharge", data.PortOfDischarge},
+	}
+	for i, row := range header {
+		cell, _ := excelize.CoordinatesToCellName(1, i+3)
+		f.SetSheetRow(sheet, cell, &row)
+	}
+
+	var columns []interface{}
+	var row func(Line) []interface{}
+	var totals []interface{}
+	switch docType {
+	case CommercialInvoice:
+		columns = []interface{}{"Marks", "Description", "HS Code", "Quantity", "Unit", "Unit Price", "Amount (" + data.Currency + ")"}
+		row = func(l Line) []interface{} {
+			return []interface{}{l.Marks, l.Description, l.HSCode, l.Quantity, l.Unit, l.UnitPrice, l.Amount}
+		}
+		totals = []interface{}{"TOTAL", "", "", "", "", "", data.TotalAmount}
+	case PackingList:
+		columns = []interface{}{"Marks", "Description", "HS Code", "Quantity", "Cartons", "Qty/Carton", "N.W./Carton (kg)", "G.W./Carton (kg)", "N.W. (kg)", "G.W. (kg)"}
+		row = func(l Line) []interface{} {
+			return []interface{}{l.Marks, l.Description, l.HSCode, l.Quantity, l.Cartons, l.QuantityPerCarton,
+				l.NetWeightPerCarton, l.GrossWeightPerCarton, l.NetWeight, l.GrossWeight}
+		}
+		totals = []interface{}{"TOTAL", "", "", "", data.TotalCartons, "", "", "", data.TotalNetWeight, data.TotalGrossWeight}
+	case CertificateOfOrigin:
+		columns = []interface{}{"Marks", "Description of Goods", "HS Code", "Quantity", "Unit", "G.W. (kg)", "Country of Origin"}
+		row = func(l Line) []interface{} {
+			return []interface{}{l.Marks, l.Description, l.HSCode, l.Quantity, l.Unit, l.GrossWeight, l.CountryOfOrigin}
+		}
+		totals = []interface{}{"TOTAL", "", "", "", "", data.TotalGrossWeight, ""}
+	}
+
+	r := len(header) + 4
+	cell, _ := excelize.CoordinatesToCellName(1, r)
+	f.SetSheetRow(sheet, cell, &columns)
+	for _, l := range data.Lines {
+		r++
+		values := row(l)
+		cell, _ = excelize.CoordinatesToCellName(1, r)
+		f.SetSheetRow(sheet, cell, &values)
+	}
+	cell, _ = excelize.CoordinatesToCellName(1, r+1)
+	f.SetSheetRow(sheet, cell, &totals)
+	if docType == PackingList {
+		for i, summary := range data.PackingSummary() {
+			cell, _ = excelize.CoordinatesToCellName(1, r+3+i)
+			f.SetSheetRow(sheet, cell, &summary)
+		}
+	}
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func formatQty(q float64) string {
+	if q == float64(int64(q)) {
+		return fmt.Sprintf("%d", int64(q))
+	}
+	return fmt.Sprintf("%.3f", q)
+}
@@ -0,0 +1,279 @@
+// Package fastenerspec describes fasteners by the standard they are made
+// to, their nominal size and length, property class or grade and finish,
+// so that a part specified to DIN 933 can be found when a customer asks
+// for ISO 4017. It also orders the revisions of customer drawings.
+package fastenerspec
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Unit systems
+const (
+	Metric = "metric" // sizes M<diameter>[x<pitch>], lengths in mm
+	Inch   = "inch"   // sizes <diameter>-<threads per inch>, lengths in inches
+)
+
+// ErrInvalidSpec is returned for specifications with an unknown standard
+// or a size, length or grade the standard does not use
+var ErrInvalidSpec = errors.New("invalid fastener specification")
+
+// Standard is a product standard
+type Standard struct {
+	Code   string `json:"code"`
+	Title  string `json:"title"`
+	System string `json:"system"` // metric, inch
+	// HasLength is false for nuts and washers
+	HasLength bool `json:"has_length"`
+	// Equivalents are standards of the same product, such as the ISO
+	// standard that replaced a DIN standard
+	Equivalents []string `json:"equivalents,omitempty"`
+}
+
+// Standards are the product standards known
+var Standards = []Standard{
+	{Code: "DIN 931", Title: "Hexagon head bolts, partially threaded", System: Metric, HasLength: true, Equivalents: []string{"ISO 4014"}},
+	{Code: "ISO 4014", Title: "Hexagon head bolts, partially threaded", System: Metric, HasLength: true, Equivalents: []string{"DIN 931"}},
+	{Code: "DIN 933", Title: "Hexagon head screws, fully threaded", System: Metric, HasLength: true, Equivalents: []string{"ISO 4017"}},
+	{Code: "ISO 4017", Title: "Hexagon head screws, fully threaded", System: Metric, HasLength: true, Equivalents: []string{"DIN 933"}},
+	{Code: "DIN 912", Title: "Hexagon socket head cap screws", System: Metric, HasLength: true, Equivalents: []string{"ISO 4762"}},
+	{Code: "ISO 4762", Title: "Hexagon socket head cap screws", System: Metric, HasLength: true, Equivalents: []string{"DIN 912"}},
+	{Code: "DIN 934", Title: "Hexagon nuts", System: Metric, Equivalents: []string{"ISO 4032"}},
+	{Code: "ISO 4032", Title: "Hexagon nuts", System: Metric, Equivalents: []string{"DIN 934"}},
+	{Code: "DIN 125", Title: "Plain washers", System: Metric, Equivalents: []string{"ISO 7089"}},
+	{Code: "ISO 7089", Title: "Plain washers", System: Metric, Equivalents: []string{"DIN 125"}},
+	{Code: "ASME B18.2.1", Title: "Hex bolts and hex cap screws (inch series)", System: Inch, HasLength: true},
+	{Code: "ASME B18.2.2", Title: "Nuts for general applications (inch series)", System: Inch},
+	{Code: "ASME B18.3", Title: "Socket cap screws (inch series)", System: Inch, HasLength: true},
+}
+
+// Grades are the property classes and grades of each unit system
+var Grades = map[string][]string{
+	Metric: {
+		// bolts and screws, ISO 898-1
+		"4.6", "4.8", "5.6", "5.8", "6.8", "8.8", "9.8", "10.9", "12.9",
+		// nuts, ISO 898-2
+		"4", "5", "6", "8", "9", "10", "12",
+		// stainless steel, ISO 3506
+		"A2-50", "A2-70", "A2-80", "A4-50", "A4-70", "A4-80",
+		// washers, ISO 7089
+		"100HV", "200HV", "300HV",
+	},
+	Inch: {
+		"Grade 2", "Grade 5", "Grade 8",
+		"A307", "A325", "A449", "A490", "18-8", "316",
+	},
+}
+
+// LookupStandard finds a standard by its code, ignoring case and spaces,
+// so "din933" finds DIN 933
+func LookupStandard(code string) (Standard, bool) {
+	key := standardKey(code)
+	for _, s := range Standards {
+		if standardKey(s.Code) == key {
+			return s, true
+		}
+	}
+	return Standard{}, false
+}
+
+// EquivalentCodes returns the code of a standard and of its equivalents,
+// or nil for an unknown standard
+func EquivalentCodes(code string) []string {
+	s, ok := LookupStandard(code)
+	if !ok {
+		return nil
+	}
+	return append([]string{s.Code}, s.Equivalents...)
+}
+
+func standardKey(code string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(code), ""))
+}
+
+// Spec is the specification of a fastener
+type Spec struct {
+	Standard string  `json:"standard"`
+	Size     string  `json:"size"`   // M10, M10x1.25, 3/8-16, #10-24
+	Length   float64 `json:"length"` // mm for metric, inches for inch standards; 0 for nuts and washers
+	Grade    string  `json:"grade"`  // 8.8, A2-70, Grade 5
+	Finish   string  `json:"finish"` // zinc plated, hot-dip galvanized, plain
+	Material string  `json:"material"`
+}
+
+var (
+	metricSize = regexp.MustCompile(`^M(\d+(?:\.\d+)?)(?:X(\d+(?:\.\d+)?))?$`)
+	inchSize   = regexp.MustCompile(`^(#\d{1,2}|\d+/\d+|\d+(?:-\d+/\d+)?)-(\d+)(?:(UNC|UNF|UNEF|UN))?$`)
+	gradeWord  = regexp.MustCompile(`^(?:GRADE|GR\.?)\s*`)
+)
+
+// Normalize validates a specification and returns it in canonical form:
+// the standard code as listed, sizes such as "M10x1.25" and "3/8-16" and
+// grades as listed in Grades. Grade, finish and material are optional.
+func (s Spec) Normalize() (Spec, error) {
+	standard, ok := LookupStandard(s.Standard)
+	if !ok {
+		return s, fmt.Errorf("%w: unknown standard %q", ErrInvalidSpec, s.Standard)
+	}
+	out := Spec{
+		Standard: standard.Code,
+		Length:   s.Length,
+		Finish:   strings.Join(strings.Fields(s.Finish), " "),
+		Material: strings.Join(strings.Fields(s.Material), " "),
+	}
+
+	size, ok := normalizeSize(standard.System, s.Size)
+	if !ok && standard.System == Metric {
+		return s, fmt.Errorf("%w: %s sizes are M<diameter>[x<pitch>], got %q", ErrInvalidSpec, standard.Code, s.Size)
+	}
+	if !ok {
+		return s, fmt.Errorf("%w: %s sizes are <diameter>-<threads per inch>, got %q", ErrInvalidSpec, standard.Code, s.Size)
+	}
+	out.Size = size
+
+	if standard.HasLength && s.Length <= 0 {
+		return s, fmt.Errorf("%w: %s needs a length", ErrInvalidSpec, standard.Code)
+	}
+	if !standard.HasLength && s.Length != 0 {
+		return s, fmt.Errorf("%w: %s has no length", ErrInvalidSpec, standard.Code)
+	}
+
+	if grade := strings.TrimSpace(s.Grade); grade != "" {
+		normalized, ok := normalizeGrade(standard.System, grade)
+		if !ok {
+			return s, fmt.Errorf("%w: unknown %s grade %q", ErrInvalidSpec, standard.System, s.Grade)
+		}
+		out.Grade = normalized
+	}
+	return out, nil
+}
+
+// NormalizeSize writes a metric or inch size in canonical form, such as
+// "M10x1.25" for "m10 x 1.25", or returns it trimmed when it is neither
+func NormalizeSize(size string) string {
+	for _, system := range []string{Metric, Inch} {
+		if normalized, ok := normalizeSize(system, size); ok {
+			return normalized
+		}
+	}
+	return strings.TrimSpace(size)
+}
+
+func normalizeSize(system, size string) (string, bool) {
+	key := strings.ToUpper(strings.Join(strings.Fields(size), ""))
+	key = strings.ReplaceAll(key, "×", "X")
+	switch system {
+	case Metric:
+		if m := metricSize.FindStringSubmatch(key); m != nil {
+			if m[2] != "" {
+				return "M" + m[1] + "x" + m[2], true
+			}
+			return "M" + m[1], true
+		}
+	case Inch:
+		if m := inchSize.FindStringSubmatch(key); m != nil {
+			if m[3] != "" {
+				return m[1] + "-" + m[2] + " " + m[3], true
+			}
+			return m[1] + "-" + m[2], true
+		}
+	}
+	return "", false
+}
+
+func normalizeGrade(system, grade string) (string, bool) {
+	key := strings.ToUpper(strings.Join(strings.Fields(grade), ""))
+	if system == Inch {
+		if n := gradeWord.ReplaceAllString(strings.ToUpper(grade), ""); n == "2" || n == "5" || n == "8" {
+			return "Grade " + n, true
+		}
+	}
+	for _, g := range Grades[system] {
+		if strings.ToUpper(strings.ReplaceAll(g, " ", "")) == key {
+			return g, true
+		}
+	}
+	return "", false
+}
+
+// System is the unit system of the specification's standard, "" for an
+// unknown standard
+func (s Spec) System() string {
+	standard, _ := LookupStandard(s.Standard)
+	return standard.System
+}
+
+// Describe writes a specification the way it is written on drawings and
+// purchase orders, such as "DIN 933 M10x30 8.8 zinc plated" or
+// "ASME B18.2.1 3/8-16 x 1.5in Grade 5"
+func (s Spec) Describe() string {
+	size := s.Size
+	if s.Length > 0 {
+		length := strconv.FormatFloat(s.Length, 'f', -1, 64)
+		if s.System() == Inch {
+			size += " x " + length + "in"
+		} else {
+			size += "x" + length
+		}
+	}
+	parts := make([]string, 0, 5)
+	for _, p := range []string{s.Standard, size, s.Grade, s.Material, s.Finish} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+var (
+	revisionPrefix = regexp.MustCompile(`^REV(?:ISION)?\.?`)
+	revisionParts  = regexp.MustCompile(`^([A-Z]*)(\d*)$`)
+)
+
+// NormalizeRevision writes a drawing revision in canonical form, so
+// "rev. b" becomes "B"
+func NormalizeRevision(revision string) string {
+	r := strings.ToUpper(strings.Join(strings.Fields(revision), ""))
+	r = revisionPrefix.ReplaceAllString(r, "")
+	return strings.Trim(r, "-_.")
+}
+
+// CompareRevisions orders drawing revisions, returning -1, 0 or 1. Letters
+// count like spreadsheet columns, so Z comes before AA, and numbers
+// numerically, so 2 comes before 10. Numeric revisions, used before a
+// drawing is released, come before lettered ones, and a letter with a
+// number such as A1 orders by the letter first. Revisions of any other
+// form are compared as text.
+func CompareRevisions(a, b string) int {
+	a, b = NormalizeRevision(a), NormalizeRevision(b)
+	ma, mb := revisionParts.FindStringSubmatch(a), revisionParts.FindStringSubmatch(b)
+	if ma == nil || mb == nil {
+		return strings.Compare(a, b)
+	}
+	if c := compareLetters(ma[1], mb[1]); c != 0 {
+		return c
+	}
+	na, _ := strconv.Atoi(ma[2])
+	nb, _ := strconv.Atoi(mb[2])
+	switch {
+	case na < nb:
+		return -1
+	case na > nb:
+		return 1
+	}
+	return 0
+}
+
+func compareLetters(a, b string) int {
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return strings.Compare(a, b)
+}
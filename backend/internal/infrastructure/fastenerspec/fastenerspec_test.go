@@ -0,0 +1,75 @@
+package fastenerspec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeMetric(t *testing.T) {
+	spec, err := Spec{Standard: "din933", Size: "m10 x 1.25", Length: 30, Grade: "8.8", Finish: " zinc  plated "}.Normalize()
+	require.NoError(t, err)
+	assert.Equal(t, Spec{Standard: "DIN 933", Size: "M10x1.25", Length: 30, Grade: "8.8", Finish: "zinc plated"}, spec)
+	assert.Equal(t, "DIN 933 M10x1.25x30 8.8 zinc plated", spec.Describe())
+
+	spec, err = Spec{Standard: "ISO 4032", Size: "M12", Grade: "8"}.Normalize()
+	require.NoError(t, err)
+	assert.Equal(t, "ISO 4032 M12 8", spec.Describe())
+
+	spec, err = Spec{Standard: "ISO 4017", Size: "M8", Length: 20, Grade: "a2-70"}.Normalize()
+	require.NoError(t, err)
+	assert.Equal(t, "A2-70", spec.Grade)
+}
+
+func TestNormalizeInch(t *testing.T) {
+	spec, err := Spec{Standard: "ASME B18.2.1", Size: "3/8-16 UNC", Length: 1.5, Grade: "gr 5"}.Normalize()
+	require.NoError(t, err)
+	assert.Equal(t, "3/8-16 UNC", spec.Size)
+	assert.Equal(t, "Grade 5", spec.Grade)
+	assert.Equal(t, "ASME B18.2.1 3/8-16 UNC x 1.5in Grade 5", spec.Describe())
+
+	spec, err = Spec{Standard: "asme b18.2.1", Size: "1-1/4-7", Length: 4}.Normalize()
+	require.NoError(t, err)
+	assert.Equal(t, "1-1/4-7", spec.Size)
+}
+
+func TestNormalizeSize(t *testing.T) {
+	assert.Equal(t, "M10x1.25", NormalizeSize("m10 x 1.25"))
+	assert.Equal(t, "3/8-16 UNC", NormalizeSize("3/8-16unc"))
+	assert.Equal(t, "#10-24", NormalizeSize(" #10-24 "))
+	assert.Equal(t, "10 mm", NormalizeSize(" 10 mm "))
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	cases := map[string]Spec{
+		"unknown standard": {Standard: "DIN 999", Size: "M10", Length: 30},
+		"inch size":        {Standard: "DIN 933", Size: "3/8-16", Length: 30},
+		"metric size":      {Standard: "ASME B18.2.1", Size: "M10", Length: 1},
+		"no length":        {Standard: "ISO 4017", Size: "M10"},
+		"nut length":       {Standard: "DIN 934", Size: "M10", Length: 10},
+		"grade of system":  {Standard: "DIN 933", Size: "M10", Length: 30, Grade: "Grade 5"},
+	}
+	for name, spec := range cases {
+		_, err := spec.Normalize()
+		assert.ErrorIs(t, err, ErrInvalidSpec, name)
+	}
+}
+
+func TestEquivalentCodes(t *testing.T) {
+	assert.Equal(t, []string{"DIN 933", "ISO 4017"}, EquivalentCodes("din 933"))
+	assert.Equal(t, []string{"ISO 4017", "DIN 933"}, EquivalentCodes("ISO4017"))
+	assert.Equal(t, []string{"ASME B18.2.1"}, EquivalentCodes("ASME B18.2.1"))
+	assert.Nil(t, EquivalentCodes("JIS B1180"))
+}
+
+func TestCompareRevisions(t *testing.T) {
+	assert.Equal(t, "B", NormalizeRevision("rev. b"))
+	assert.Equal(t, 0, CompareRevisions("Rev B", "b"))
+
+	ordered := []string{"01", "2", "10", "A", "A1", "A2", "B", "Z", "AA", "AB"}
+	for i := 1; i < len(ordered); i++ {
+		assert.Equal(t, -1, CompareRevisions(ordered[i-1], ordered[i]), "%s < %s", ordered[i-1], ordered[i])
+		assert.Equal(t, 1, CompareRevisions(ordered[i], ordered[i-1]), "%s > %s", ordered[i], ordered[i-1])
+	}
+}
@@ -0,0 +1,148 @@
+// Package fx values open items held in foreign currencies in the base
+// currency: period-end revaluation at a closing rate, the realized
+// difference when an item is settled at another rate than it was booked at,
+// and per-currency summaries for reports.
+//
+// Gains are signed from the company's point of view: a receivable gains when
+// the currency strengthens, a payable when it weakens. Base amounts are
+// rounded to cents.
+package fx
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Kinds of open items
+const (
+	Receivable = "receivable"
+	Payable    = "payable"
+)
+
+// ErrInvalidRate is returned for rates that are not positive
+var ErrInvalidRate = errors.New("exchange rate must be positive")
+
+// Item is an open item in its transaction currency
+type Item struct {
+	Kind       string  `json:"kind"`
+	Currency   string  `json:"currency"`
+	Amount     float64 `json:"amount"`      // open amount in the transaction currency
+	BookedRate float64 `json:"booked_rate"` // rate the item was booked at
+}
+
+// Valuation is an item valued at another rate than it was booked at
+type Valuation struct {
+	Item
+	Rate       float64 `json:"rate"`
+	BookedBase float64 `json:"booked_base"`
+	ValuedBase float64 `json:"valued_base"`
+	Gain       float64 `json:"gain"` // negative for a loss
+}
+
+// Revalue values item at rate
+func Revalue(item Item, rate float64) (Valuation, error) {
+	if rate <= 0 || item.BookedRate <= 0 {
+		return Valuation{}, ErrInvalidRate
+	}
+	v := Valuation{
+		Item:       item,
+		Rate:       rate,
+		BookedBase: Round(item.Amount * item.BookedRate),
+		ValuedBase: Round(item.Amount * rate),
+	}
+	v.Gain = Gain(item.Kind, v.BookedBase, v.ValuedBase)
+	return v, nil
+}
+
+// Realized returns the gain on settling amount of an item booked at
+// bookedRate at settlementRate
+func Realized(kind string, amount, bookedRate, settlementRate float64) (float64, error) {
+	if bookedRate <= 0 || settlementRate <= 0 {
+		return 0, ErrInvalidRate
+	}
+	return Gain(kind, Round(amount*bookedRate), Round(amount*settlementRate)), nil
+}
+
+// Gain returns the gain of an item whose base value moved from bookedBase to
+// valuedBase
+func Gain(kind string, bookedBase, valuedBase float64) float64 {
+	if kind == Payable {
+		return Round(bookedBase - valuedBase)
+	}
+	return Round(valuedBase - bookedBase)
+}
+
+// Invert returns the rate of the opposite direction, for rates stored as
+// base to foreign
+func Invert(rate float64) float64 {
+	if rate <= 0 {
+		return 0
+	}
+	return 1 / rate
+}
+
+// CurrencyTotal sums valuations of one currency and kind
+type CurrencyTotal struct {
+	Currency   string  `json:"currency"`
+	Kind       string  `json:"kind"`
+	Count      int     `json:"count"`
+	Amount     float64 `json:"amount"`
+	BookedBase float64 `json:"booked_base"`
+	ValuedBase float64 `json:"valued_base"`
+	Gain       float64 `json:"gain"`
+}
+
+// Summarize totals valuations per currency and kind, ordered by currency
+// with receivables first
+func Summarize(valuations []Valuation) []CurrencyTotal {
+	index := map[string]int{}
+	var totals []CurrencyTotal
+	for _, v := range valuations {
+		key := strings.ToUpper(v.Currency) + "|" + v.Kind
+		i, ok := index[key]
+		if !ok {
+			i = len(totals)
+			index[key] = i
+			totals = append(totals, CurrencyTotal{Currency: strings.ToUpper(v.Currency), Kind: v.Kind})
+		}
+		t := &totals[i]
+		t.Count++
+		t.Amount = Round(t.Amount + v.Amount)
+		t.BookedBase = Round(t.BookedBase + v.BookedBase)
+		t.ValuedBase = Round(t.ValuedBase + v.ValuedBase)
+		t.Gain = Round(t.Gain + v.Gain)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Currency != totals[j].Currency {
+			return totals[i].Currency < totals[j].Currency
+		}
+		return totals[i].Kind == Receivable && totals[j].Kind != Receivable
+	})
+	return totals
+}
+
+// Net splits the gains of valuations by kind. Receivable and payable are the
+// net adjustments of the two balances; gain and loss the totals of the items
+// that gained and lost.
+func Net(valuations []Valuation) (receivable, payable, gain, loss float64) {
+	for _, v := range valuations {
+		if v.Kind == Payable {
+			payable += v.Gain
+		} else {
+			receivable += v.Gain
+		}
+		if v.Gain > 0 {
+			gain += v.Gain
+		} else {
+			loss -= v.Gain
+		}
+	}
+	return Round(receivable), Round(payable), Round(gain), Round(loss)
+}
+
+// Round rounds to cents
+func Round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
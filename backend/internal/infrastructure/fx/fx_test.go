@@ -0,0 +1,87 @@
+package fx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevalueReceivable(t *testing.T) {
+	// USD 10,000 invoiced at 31.50, closing at 32.10
+	v, err := Revalue(Item{Kind: Receivable, Currency: "USD", Amount: 10000, BookedRate: 31.5}, 32.1)
+	require.NoError(t, err)
+	assert.Equal(t, 315000.0, v.BookedBase)
+	assert.Equal(t, 321000.0, v.ValuedBase)
+	assert.Equal(t, 6000.0, v.Gain)
+
+	// The same move on a payable is a loss
+	v, err = Revalue(Item{Kind: Payable, Currency: "USD", Amount: 10000, BookedRate: 31.5}, 32.1)
+	require.NoError(t, err)
+	assert.Equal(t, -6000.0, v.Gain)
+}
+
+func TestRevalueRoundsToCents(t *testing.T) {
+	// JPY 1,234,567 booked at 0.2143, closing at 0.2089
+	v, err := Revalue(Item{Kind: Receivable, Currency: "JPY", Amount: 1234567, BookedRate: 0.2143}, 0.2089)
+	require.NoError(t, err)
+	assert.Equal(t, 264567.71, v.BookedBase)
+	assert.Equal(t, 257901.05, v.ValuedBase)
+	assert.Equal(t, -6666.66, v.Gain)
+}
+
+func TestRevalueRejectsMissingRates(t *testing.T) {
+	_, err := Revalue(Item{Kind: Receivable, Amount: 100, BookedRate: 0}, 30)
+	assert.ErrorIs(t, err, ErrInvalidRate)
+	_, err = Revalue(Item{Kind: Receivable, Amount: 100, BookedRate: 30}, 0)
+	assert.ErrorIs(t, err, ErrInvalidRate)
+}
+
+func TestRealized(t *testing.T) {
+	// EUR 2,000 booked at 34.80 and received at 35.20
+	gain, err := Realized(Receivable, 2000, 34.8, 35.2)
+	require.NoError(t, err)
+	assert.Equal(t, 800.0, gain)
+
+	// Paying a supplier after the currency strengthened costs more
+	gain, err = Realized(Payable, 2000, 34.8, 35.2)
+	require.NoError(t, err)
+	assert.Equal(t, -800.0, gain)
+
+	_, err = Realized(Receivable, 2000, 0, 35.2)
+	assert.ErrorIs(t, err, ErrInvalidRate)
+}
+
+func TestSummarizeAndNet(t *testing.T) {
+	var valuations []Valuation
+	for _, item := range []struct {
+		item Item
+		rate float64
+	}{
+		{Item{Kind: Payable, Currency: "usd", Amount: 500, BookedRate: 31}, 32},
+		{Item{Kind: Receivable, Currency: "USD", Amount: 1000, BookedRate: 31}, 32},
+		{Item{Kind: Receivable, Currency: "USD", Amount: 2000, BookedRate: 32.5}, 32},
+		{Item{Kind: Receivable, Currency: "EUR", Amount: 100, BookedRate: 35}, 36},
+	} {
+		v, err := Revalue(item.item, item.rate)
+		require.NoError(t, err)
+		valuations = append(valuations, v)
+	}
+
+	totals := Summarize(valuations)
+	require.Len(t, totals, 3)
+	assert.Equal(t, CurrencyTotal{Currency: "EUR", Kind: Receivable, Count: 1, Amount: 100, BookedBase: 3500, ValuedBase: 3600, Gain: 100}, totals[0])
+	assert.Equal(t, CurrencyTotal{Currency: "USD", Kind: Receivable, Count: 2, Amount: 3000, BookedBase: 96000, ValuedBase: 96000, Gain: 0}, totals[1])
+	assert.Equal(t, CurrencyTotal{Currency: "USD", Kind: Payable, Count: 1, Amount: 500, BookedBase: 15500, ValuedBase: 16000, Gain: -500}, totals[2])
+
+	receivable, payable, gain, loss := Net(valuations)
+	assert.Equal(t, 100.0, receivable)
+	assert.Equal(t, -500.0, payable)
+	assert.Equal(t, 1100.0, gain)
+	assert.Equal(t, 1500.0, loss)
+}
+
+func TestInvert(t *testing.T) {
+	assert.InDelta(t, 0.03125, Invert(32), 1e-12)
+	assert.Equal(t, 0.0, Invert(0))
+}
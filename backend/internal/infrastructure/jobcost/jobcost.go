@@ -0,0 +1,309 @@
+// Package jobcost accumulates the actual cost of a production order from
+// its material issues, the time its tasks took on their work stations, the
+// fees of subcontracted operations and the overhead rates, and compares it
+// with the estimate it was quoted on.
+package jobcost
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Cost drivers
+const (
+	DriverMaterial        = "material"
+	DriverLabor           = "labor"
+	DriverLaborRate       = "labor_rate"       // part of the labor variance due to the hourly cost
+	DriverLaborEfficiency = "labor_efficiency" // part of the labor variance due to the hours taken
+	DriverSubcontract     = "subcontract"
+	DriverOverhead        = "overhead"
+	DriverTotal           = "total"
+)
+
+// Overhead rate types and bases, as stored on models.OverheadRate
+const (
+	RateTypePercentage = "percentage"
+	RateTypeFixed      = "fixed"
+
+	BasedOnMaterial = "material_cost"
+	BasedOnProcess  = "process_cost"
+	BasedOnTotal    = "total_cost"
+)
+
+// MaterialIssue is material issued to the job at its inventory cost.
+// Quantity is net of what was returned.
+type MaterialIssue struct {
+	Reference string  `json:"reference"`
+	Quantity  float64 `json:"quantity"`
+	UnitCost  float64 `json:"unit_cost"`
+}
+
+// LaborEntry is the time a task spent on a work station
+type LaborEntry struct {
+	Reference  string  `json:"reference"`
+	Department string  `json:"department"`
+	Hours      float64 `json:"hours"`
+	HourlyCost float64 `json:"hourly_cost"`
+}
+
+// SubcontractFee is what a subcontractor charged for processing part of
+// the job, such as plating or heat treatment
+type SubcontractFee struct {
+	Reference string  `json:"reference"`
+	Process   string  `json:"process"`
+	Supplier  string  `json:"supplier"`
+	Quantity  float64 `json:"quantity"`
+	Amount    float64 `json:"amount"`
+}
+
+// OverheadRule is an overhead rate in force for the job. A percentage rule
+// charges a share of its base; a fixed rule charges its value once per job.
+// A rule with a department only applies to the labor of that department's
+// work stations, as material is not departmental.
+type OverheadRule struct {
+	Department string  `json:"department"`
+	Type       string  `json:"type"`
+	Value      float64 `json:"value"`
+	BasedOn    string  `json:"based_on"`
+}
+
+// OverheadCharge is the overhead one rule charged
+type OverheadCharge struct {
+	Department string  `json:"department"`
+	Type       string  `json:"type"`
+	BasedOn    string  `json:"based_on"`
+	Base       float64 `json:"base"`
+	Amount     float64 `json:"amount"`
+}
+
+// Actual is the accumulated cost of a job
+type Actual struct {
+	Material    float64          `json:"material"`
+	Labor       float64          `json:"labor"`
+	Subcontract float64          `json:"subcontract"`
+	Overhead    float64          `json:"overhead"`
+	Total       float64          `json:"total"`
+	LaborHours  float64          `json:"labor_hours"`
+	Overheads   []OverheadCharge `json:"overheads"`
+}
+
+// Hours is the time between the start and end of a task. A task that has
+// started but not ended counts up to asOf; one that has not started counts
+// nothing.
+func Hours(start, end *time.Time, asOf time.Time) float64 {
+	if start == nil {
+		return 0
+	}
+	stop := asOf
+	if end != nil {
+		stop = *end
+	}
+	if !stop.After(*start) {
+		return 0
+	}
+	return stop.Sub(*start).Hours()
+}
+
+// Accumulate totals the material, labor, subcontract and overhead cost of
+// a job. Subcontract fees bear no overhead: the subcontractor's price
+// already covers its own.
+func Accumulate(materials []MaterialIssue, labor []LaborEntry, fees []SubcontractFee, rules []OverheadRule) Actual {
+	var actual Actual
+	for _, m := range materials {
+		if m.Quantity > 0 {
+			actual.Material += m.Quantity * m.UnitCost
+		}
+	}
+	laborByDepartment := map[string]float64{}
+	for _, l := range labor {
+		if l.Hours <= 0 {
+			continue
+		}
+		cost := l.Hours * l.HourlyCost
+		actual.Labor += cost
+		actual.LaborHours += l.Hours
+		laborByDepartment[l.Department] += cost
+	}
+	for _, f := range fees {
+		actual.Subcontract += f.Amount
+	}
+
+	for _, rule := range rules {
+		charge := OverheadCharge{Department: rule.Department, Type: rule.Type, BasedOn: rule.BasedOn}
+		if rule.Type == RateTypeFixed {
+			charge.Amount = rule.Value
+		} else {
+			labor := actual.Labor
+			if rule.Department != "" {
+				labor = laborByDepartment[rule.Department]
+			}
+			switch rule.BasedOn {
+			case BasedOnMaterial:
+				charge.Base = actual.Material
+			case BasedOnProcess:
+				charge.Base = labor
+			default:
+				charge.Base = actual.Material + labor
+			}
+			charge.Amount = charge.Base * rule.Value / 100
+		}
+		charge.Base = Round(charge.Base)
+		charge.Amount = Round(charge.Amount)
+		actual.Overhead += charge.Amount
+		actual.Overheads = append(actual.Overheads, charge)
+	}
+
+	actual.Material = Round(actual.Material)
+	actual.Labor = Round(actual.Labor)
+	actual.Subcontract = Round(actual.Subcontract)
+	actual.Overhead = Round(actual.Overhead)
+	actual.LaborHours = math.Round(actual.LaborHours*1000) / 1000
+	actual.Total = Round(actual.Material + actual.Labor + actual.Subcontract + actual.Overhead)
+	return actual
+}
+
+// Estimate is the cost a job was expected to have for Quantity units.
+// Without a breakdown only the total is known.
+type Estimate struct {
+	Source      string  `json:"source"` // cost_calculation, quote, production_order
+	Quantity    float64 `json:"quantity"`
+	Material    float64 `json:"material"`
+	Labor       float64 `json:"labor"`
+	Subcontract float64 `json:"subcontract"`
+	Overhead    float64 `json:"overhead"`
+	Total       float64 `json:"total"`
+	LaborHours  float64 `json:"labor_hours"`
+	Breakdown   bool    `json:"breakdown"`
+}
+
+// Scale restates the estimate for another quantity, assuming cost
+// proportional to quantity
+func (e Estimate) Scale(quantity float64) Estimate {
+	if e.Quantity <= 0 || quantity <= 0 {
+		return e
+	}
+	f := quantity / e.Quantity
+	return Estimate{
+		Source:      e.Source,
+		Quantity:    quantity,
+		Material:    Round(e.Material * f),
+		Labor:       Round(e.Labor * f),
+		Subcontract: Round(e.Subcontract * f),
+		Overhead:    Round(e.Overhead * f),
+		Total:       Round(e.Total * f),
+		LaborHours:  math.Round(e.LaborHours*f*1000) / 1000,
+		Breakdown:   e.Breakdown,
+	}
+}
+
+// Variance of one driver. A positive variance is unfavourable: the job
+// cost more than estimated.
+type Variance struct {
+	Driver    string  `json:"driver"`
+	Estimated float64 `json:"estimated"`
+	Actual    float64 `json:"actual"`
+	Variance  float64 `json:"variance"`
+	Percent   float64 `json:"percent"` // of the estimate; 0 without one
+}
+
+func variance(driver string, estimated, actual float64) Variance {
+	v := Variance{Driver: driver, Estimated: Round(estimated), Actual: Round(actual), Variance: Round(actual - estimated)}
+	if estimated != 0 {
+		v.Percent = Round(v.Variance / math.Abs(estimated) * 100)
+	}
+	return v
+}
+
+// Compare gives the variance per driver and in total. When both sides know
+// the labor hours, the labor variance is split into the part due to the
+// hourly cost, (actual rate - estimated rate) x actual hours, and the part
+// due to the hours, (actual hours - estimated hours) x estimated rate.
+// Subcontract fees get a row of their own once either side has any.
+func Compare(estimate Estimate, actual Actual) []Variance {
+	var out []Variance
+	if estimate.Breakdown {
+		out = append(out,
+			variance(DriverMaterial, estimate.Material, actual.Material),
+			variance(DriverLabor, estimate.Labor, actual.Labor),
+		)
+		if estimate.LaborHours > 0 && actual.LaborHours > 0 {
+			estimatedRate := estimate.Labor / estimate.LaborHours
+			actualRate := actual.Labor / actual.LaborHours
+			rate := (actualRate - estimatedRate) * actual.LaborHours
+			efficiency := (actual.LaborHours - estimate.LaborHours) * estimatedRate
+			out = append(out,
+				Variance{Driver: DriverLaborRate, Estimated: Round(estimatedRate), Actual: Round(actualRate), Variance: Round(rate)},
+				Variance{Driver: DriverLaborEfficiency, Estimated: estimate.LaborHours, Actual: actual.LaborHours, Variance: Round(efficiency)},
+			)
+		}
+		if estimate.Subcontract != 0 || actual.Subcontract != 0 {
+			out = append(out, variance(DriverSubcontract, estimate.Subcontract, actual.Subcontract))
+		}
+		out = append(out, variance(DriverOverhead, estimate.Overhead, actual.Overhead))
+	}
+	return append(out, variance(DriverTotal, estimate.Total, actual.Total))
+}
+
+// DriverSummary totals the variance of one driver over many jobs.
+// Factor is actual over estimated cost, the multiplier an estimator would
+// apply to the template rates behind the driver.
+type DriverSummary struct {
+	Driver       string  `json:"driver"`
+	Jobs         int     `json:"jobs"`
+	Estimated    float64 `json:"estimated"`
+	Actual       float64 `json:"actual"`
+	Variance     float64 `json:"variance"`
+	Percent      float64 `json:"percent"`
+	Factor       float64 `json:"factor"`
+	Unfavourable int     `json:"unfavourable"` // jobs that cost more than estimated
+}
+
+// Summarize totals the variances of many jobs per driver, largest
+// absolute variance first. Labor rate and efficiency rows are not
+// additive in estimate and actual, so only their variance is totalled.
+func Summarize(jobs [][]Variance) []DriverSummary {
+	byDriver := map[string]*DriverSummary{}
+	for _, job := range jobs {
+		for _, v := range job {
+			s, ok := byDriver[v.Driver]
+			if !ok {
+				s = &DriverSummary{Driver: v.Driver}
+				byDriver[v.Driver] = s
+			}
+			s.Jobs++
+			s.Variance += v.Variance
+			if v.Driver != DriverLaborRate && v.Driver != DriverLaborEfficiency {
+				s.Estimated += v.Estimated
+				s.Actual += v.Actual
+			}
+			if v.Variance > 0 {
+				s.Unfavourable++
+			}
+		}
+	}
+
+	out := make([]DriverSummary, 0, len(byDriver))
+	for _, s := range byDriver {
+		s.Estimated = Round(s.Estimated)
+		s.Actual = Round(s.Actual)
+		s.Variance = Round(s.Variance)
+		if s.Estimated != 0 {
+			s.Percent = Round(s.Variance / math.Abs(s.Estimated) * 100)
+			s.Factor = math.Round(s.Actual/s.Estimated*10000) / 10000
+		}
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if math.Abs(out[i].Variance) != math.Abs(out[j].Variance) {
+			return math.Abs(out[i].Variance) > math.Abs(out[j].Variance)
+		}
+		return out[i].Driver < out[j].Driver
+	})
+	return out
+}
+
+// Round rounds an amount to cents
+func Round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,126 @@
+package jobcost
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHours(t *testing.T) {
+	start := time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC)
+	end := start.Add(150 * time.Minute)
+	asOf := start.Add(4 * time.Hour)
+
+	assert.Equal(t, 2.5, Hours(&start, &end, asOf))
+	assert.Equal(t, 4.0, Hours(&start, nil, asOf))
+	assert.Equal(t, 0.0, Hours(nil, nil, asOf))
+	assert.Equal(t, 0.0, Hours(&end, &start, asOf))
+}
+
+func TestAccumulate(t *testing.T) {
+	materials := []MaterialIssue{
+		{Reference: "WIRE-10B21", Quantity: 500, UnitCost: 1.2},
+		{Reference: "ZINC", Quantity: 20, UnitCost: 3.5},
+		{Reference: "RETURNED", Quantity: 0, UnitCost: 9},
+	}
+	labor := []LaborEntry{
+		{Reference: "Heading", Department: "forming", Hours: 4, HourlyCost: 40},
+		{Reference: "Rolling", Department: "forming", Hours: 2, HourlyCost: 30},
+		{Reference: "Plating", Department: "finishing", Hours: 1.5, HourlyCost: 20},
+	}
+	rules := []OverheadRule{
+		{Type: RateTypePercentage, Value: 10, BasedOn: BasedOnTotal},
+		{Department: "forming", Type: RateTypePercentage, Value: 50, BasedOn: BasedOnProcess},
+		{Type: RateTypeFixed, Value: 25},
+	}
+
+	actual := Accumulate(materials, labor, nil, rules)
+	assert.Equal(t, 670.0, actual.Material)
+	assert.Equal(t, 250.0, actual.Labor)
+	assert.Equal(t, 7.5, actual.LaborHours)
+	require.Len(t, actual.Overheads, 3)
+	assert.Equal(t, 920.0, actual.Overheads[0].Base)
+	assert.Equal(t, 92.0, actual.Overheads[0].Amount)
+	assert.Equal(t, 220.0, actual.Overheads[1].Base)
+	assert.Equal(t, 110.0, actual.Overheads[1].Amount)
+	assert.Equal(t, 25.0, actual.Overheads[2].Amount)
+	assert.Equal(t, 227.0, actual.Overhead)
+	assert.Equal(t, 1147.0, actual.Total)
+}
+
+func TestAccumulateSubcontract(t *testing.T) {
+	materials := []MaterialIssue{{Reference: "WIRE-10B21", Quantity: 500, UnitCost: 1.2}}
+	fees := []SubcontractFee{
+		{Reference: "SCO-1", Process: "plating", Quantity: 10200, Amount: 510},
+		{Reference: "SCO-2", Process: "heat_treatment", Quantity: 500, Amount: 6000},
+	}
+	rules := []OverheadRule{{Type: RateTypePercentage, Value: 10, BasedOn: BasedOnTotal}}
+
+	actual := Accumulate(materials, nil, fees, rules)
+	assert.Equal(t, 6510.0, actual.Subcontract)
+	assert.Equal(t, 60.0, actual.Overhead, "fees bear no overhead")
+	assert.Equal(t, 7170.0, actual.Total)
+
+	variances := Compare(Estimate{Material: 600, Subcontract: 6000, Overhead: 60, Total: 6660, Breakdown: true}, actual)
+	require.Len(t, variances, 5)
+	assert.Equal(t, Variance{Driver: DriverSubcontract, Estimated: 6000, Actual: 6510, Variance: 510, Percent: 8.5}, variances[2])
+}
+
+func TestEstimateScale(t *testing.T) {
+	e := Estimate{Source: "cost_calculation", Quantity: 1000, Material: 600, Labor: 200, Overhead: 80, Total: 880, LaborHours: 5, Breakdown: true}
+	s := e.Scale(1250)
+	assert.Equal(t, 1250.0, s.Quantity)
+	assert.Equal(t, 750.0, s.Material)
+	assert.Equal(t, 250.0, s.Labor)
+	assert.Equal(t, 100.0, s.Overhead)
+	assert.Equal(t, 1100.0, s.Total)
+	assert.Equal(t, 6.25, s.LaborHours)
+
+	assert.Equal(t, e, e.Scale(0))
+}
+
+func TestCompare(t *testing.T) {
+	estimate := Estimate{Quantity: 1000, Material: 600, Labor: 200, Overhead: 80, Total: 880, LaborHours: 5, Breakdown: true}
+	actual := Actual{Material: 670, Labor: 250, Overhead: 100, Total: 1020, LaborHours: 7.5}
+
+	variances := Compare(estimate, actual)
+	require.Len(t, variances, 6)
+	assert.Equal(t, Variance{Driver: DriverMaterial, Estimated: 600, Actual: 670, Variance: 70, Percent: 11.67}, variances[0])
+	assert.Equal(t, 50.0, variances[1].Variance)
+
+	// Rate 33.33/h against 40/h over 7.5 hours, 2.5 hours over at 40/h
+	assert.Equal(t, DriverLaborRate, variances[2].Driver)
+	assert.Equal(t, -50.0, variances[2].Variance)
+	assert.Equal(t, DriverLaborEfficiency, variances[3].Driver)
+	assert.Equal(t, 100.0, variances[3].Variance)
+	assert.Equal(t, variances[1].Variance, variances[2].Variance+variances[3].Variance)
+
+	assert.Equal(t, 20.0, variances[4].Variance)
+	assert.Equal(t, Variance{Driver: DriverTotal, Estimated: 880, Actual: 1020, Variance: 140, Percent: 15.91}, variances[5])
+
+	totalOnly := Compare(Estimate{Source: "production_order", Total: 900}, actual)
+	require.Len(t, totalOnly, 1)
+	assert.Equal(t, 120.0, totalOnly[0].Variance)
+}
+
+func TestSummarize(t *testing.T) {
+	jobs := [][]Variance{
+		{
+			{Driver: DriverMaterial, Estimated: 600, Actual: 670, Variance: 70},
+			{Driver: DriverLabor, Estimated: 200, Actual: 180, Variance: -20},
+			{Driver: DriverLaborRate, Estimated: 40, Actual: 36, Variance: -20},
+		},
+		{
+			{Driver: DriverMaterial, Estimated: 400, Actual: 430, Variance: 30},
+			{Driver: DriverLabor, Estimated: 100, Actual: 95, Variance: -5},
+		},
+	}
+	summary := Summarize(jobs)
+	require.Len(t, summary, 3)
+	assert.Equal(t, DriverSummary{Driver: DriverMaterial, Jobs: 2, Estimated: 1000, Actual: 1100, Variance: 100, Percent: 10, Factor: 1.1, Unfavourable: 2}, summary[0])
+	assert.Equal(t, DriverLabor, summary[1].Driver)
+	assert.Equal(t, 0.9167, summary[1].Factor)
+	assert.Equal(t, DriverSummary{Driver: DriverLaborRate, Jobs: 1, Variance: -20}, summary[2])
+}
@@ -0,0 +1,145 @@
+// Package lcterms reconstructs the terms of a letter of credit in force on
+// a given date and checks shipments against them.
+//
+// The LC row always carries the latest accepted terms; each accepted
+// amendment records the terms it replaced, so rolling back the amendments
+// that took effect after a date yields the terms in force on that date.
+package lcterms
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Amendment statuses
+const (
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+	StatusRejected = "rejected"
+)
+
+// Terms are the amendable terms of an LC and its utilization
+type Terms struct {
+	Amount           float64
+	ExpiryDate       time.Time
+	LastShipmentDate *time.Time
+	PortOfLoading    string
+	PortOfDischarge  string
+	UtilizedAmount   float64
+	AvailableAmount  float64
+	AmendmentNo      int // Last accepted amendment in force, 0 if none
+}
+
+// Amendment is an amendment and the terms it replaced when accepted. Old*
+// fields are nil for terms the amendment left unchanged, except
+// OldLastShipmentDate, which is also nil when the LC had no latest shipment
+// date; ChangesLastShipmentDate tells the two apart.
+type Amendment struct {
+	No                      int
+	Status                  string
+	EffectiveAt             *time.Time
+	ChangesLastShipmentDate bool
+	OldAmount               *float64
+	OldExpiryDate           *time.Time
+	OldLastShipmentDate     *time.Time
+	OldPortOfLoading        *string
+	OldPortOfDischarge      *string
+}
+
+// Utilization is a drawing on the LC
+type Utilization struct {
+	Amount     float64
+	Status     string
+	UtilizedAt time.Time
+}
+
+// AsOf rolls back the accepted amendments that became effective after asOf,
+// newest first, and sums the utilizations drawn by then
+func AsOf(current Terms, amendments []Amendment, utilizations []Utilization, asOf time.Time) Terms {
+	terms := current
+	terms.AmendmentNo = 0
+	terms.UtilizedAmount = 0
+
+	accepted := make([]Amendment, 0, len(amendments))
+	for _, a := range amendments {
+		if a.Status == StatusAccepted && a.EffectiveAt != nil {
+			accepted = append(accepted, a)
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].EffectiveAt.After(*accepted[j].EffectiveAt)
+	})
+
+	for _, a := range accepted {
+		if !a.EffectiveAt.After(asOf) {
+			if a.No > terms.AmendmentNo {
+				terms.AmendmentNo = a.No
+			}
+			continue
+		}
+		if a.OldAmount != nil {
+			terms.Amount = *a.OldAmount
+		}
+		if a.OldExpiryDate != nil {
+			terms.ExpiryDate = *a.OldExpiryDate
+		}
+		if a.ChangesLastShipmentDate {
+			terms.LastShipmentDate = a.OldLastShipmentDate
+		}
+		if a.OldPortOfLoading != nil {
+			terms.PortOfLoading = *a.OldPortOfLoading
+		}
+		if a.OldPortOfDischarge != nil {
+			terms.PortOfDischarge = *a.OldPortOfDischarge
+		}
+	}
+
+	for _, u := range utilizations {
+		if u.Status != StatusRejected && !u.UtilizedAt.After(asOf) {
+			terms.UtilizedAmount += u.Amount
+		}
+	}
+	terms.AvailableAmount = terms.Amount - terms.UtilizedAmount
+
+	return terms
+}
+
+// Shipment is what a shipment presents against the LC
+type Shipment struct {
+	ActualDeparture    *time.Time
+	EstimatedDeparture *time.Time
+	PortOfLoading      string
+	PortOfDischarge    string
+}
+
+// Discrepancies compares a shipment with the LC terms. The shipment date is
+// the actual departure, or the estimated one before the goods have left;
+// ports are compared only when both sides name one.
+func Discrepancies(terms Terms, shipment Shipment) []string {
+	var issues []string
+
+	shippedAt := shipment.ActualDeparture
+	if shippedAt == nil {
+		shippedAt = shipment.EstimatedDeparture
+	}
+	if shippedAt != nil {
+		if terms.LastShipmentDate != nil && shippedAt.After(*terms.LastShipmentDate) {
+			issues = append(issues, fmt.Sprintf("shipment date %s is after latest shipment date %s",
+				shippedAt.Format("2006-01-02"), terms.LastShipmentDate.Format("2006-01-02")))
+		}
+		if shippedAt.After(terms.ExpiryDate) {
+			issues = append(issues, fmt.Sprintf("shipment date %s is after LC expiry %s",
+				shippedAt.Format("2006-01-02"), terms.ExpiryDate.Format("2006-01-02")))
+		}
+	}
+	if terms.PortOfLoading != "" && shipment.PortOfLoading != "" && !strings.EqualFold(terms.PortOfLoading, shipment.PortOfLoading) {
+		issues = append(issues, fmt.Sprintf("port of loading %s does not match LC port %s", shipment.PortOfLoading, terms.PortOfLoading))
+	}
+	if terms.PortOfDischarge != "" && shipment.PortOfDischarge != "" && !strings.EqualFold(terms.PortOfDischarge, shipment.PortOfDischarge) {
+		issues = append(issues, fmt.Sprintf("port of discharge %s does not match LC port %s", shipment.PortOfDischarge, terms.PortOfDischarge))
+	}
+
+	return issues
+}
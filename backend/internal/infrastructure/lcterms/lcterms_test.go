@@ -0,0 +1,143 @@
+package lcterms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func day(month time.Month, d int) time.Time {
+	return time.Date(2026, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func dayPtr(month time.Month, d int) *time.Time {
+	t := day(month, d)
+	return &t
+}
+
+func amount(v float64) *float64 { return &v }
+
+func port(v string) *string { return &v }
+
+// The LC was issued on 1 March for 100,000 expiring 30 June, shipping
+// Kaohsiung to Hamburg by 31 May, then amended three times:
+//
+//	1, effective 10 April: amount 100,000 -> 120,000, expiry 30 June -> 31 July
+//	2, effective 20 April: rejected
+//	3, effective 5 May:    discharge Hamburg -> Rotterdam, latest shipment 31 May -> 15 June
+//	4, effective 1 June:   amount 120,000 -> 150,000, latest shipment 15 June -> 30 June
+//	5, pending
+var (
+	current = Terms{
+		Amount:           150000,
+		ExpiryDate:       day(time.July, 31),
+		LastShipmentDate: dayPtr(time.June, 30),
+		PortOfLoading:    "Kaohsiung",
+		PortOfDischarge:  "Rotterdam",
+		UtilizedAmount:   90000,
+		AvailableAmount:  60000,
+	}
+	history = []Amendment{
+		{No: 4, Status: StatusAccepted, EffectiveAt: dayPtr(time.June, 1), OldAmount: amount(120000),
+			ChangesLastShipmentDate: true, OldLastShipmentDate: dayPtr(time.June, 15)},
+		{No: 1, Status: StatusAccepted, EffectiveAt: dayPtr(time.April, 10), OldAmount: amount(100000),
+			OldExpiryDate: dayPtr(time.June, 30)},
+		{No: 2, Status: StatusRejected, EffectiveAt: dayPtr(time.April, 20), OldAmount: amount(1)},
+		{No: 5, Status: StatusPending, OldPortOfLoading: port("Taichung")},
+		{No: 3, Status: StatusAccepted, EffectiveAt: dayPtr(time.May, 5), OldPortOfDischarge: port("Hamburg"),
+			ChangesLastShipmentDate: true, OldLastShipmentDate: dayPtr(time.May, 31)},
+	}
+	drawings = []Utilization{
+		{Amount: 40000, Status: "accepted", UtilizedAt: day(time.April, 15)},
+		{Amount: 25000, Status: StatusRejected, UtilizedAt: day(time.May, 1)},
+		{Amount: 50000, Status: "pending", UtilizedAt: day(time.June, 10)},
+	}
+)
+
+func TestAsOf(t *testing.T) {
+	tests := []struct {
+		name string
+		asOf time.Time
+		want Terms
+	}{
+		{"as issued", day(time.March, 15), Terms{
+			Amount: 100000, ExpiryDate: day(time.June, 30), LastShipmentDate: dayPtr(time.May, 31),
+			PortOfLoading: "Kaohsiung", PortOfDischarge: "Hamburg", AvailableAmount: 100000,
+		}},
+		{"on the day amendment 1 took effect", day(time.April, 10), Terms{
+			Amount: 120000, ExpiryDate: day(time.July, 31), LastShipmentDate: dayPtr(time.May, 31),
+			PortOfLoading: "Kaohsiung", PortOfDischarge: "Hamburg", AvailableAmount: 120000, AmendmentNo: 1,
+		}},
+		{"rejected amendment is skipped", day(time.April, 25), Terms{
+			Amount: 120000, ExpiryDate: day(time.July, 31), LastShipmentDate: dayPtr(time.May, 31),
+			PortOfLoading: "Kaohsiung", PortOfDischarge: "Hamburg", UtilizedAmount: 40000, AvailableAmount: 80000, AmendmentNo: 1,
+		}},
+		{"after amendment 3", day(time.May, 20), Terms{
+			Amount: 120000, ExpiryDate: day(time.July, 31), LastShipmentDate: dayPtr(time.June, 15),
+			PortOfLoading: "Kaohsiung", PortOfDischarge: "Rotterdam", UtilizedAmount: 40000, AvailableAmount: 80000, AmendmentNo: 3,
+		}},
+		{"current terms", day(time.June, 20), Terms{
+			Amount: 150000, ExpiryDate: day(time.July, 31), LastShipmentDate: dayPtr(time.June, 30),
+			PortOfLoading: "Kaohsiung", PortOfDischarge: "Rotterdam", UtilizedAmount: 90000, AvailableAmount: 60000, AmendmentNo: 4,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, AsOf(current, history, drawings, tt.asOf))
+		})
+	}
+}
+
+func TestAsOfRestoresMissingLastShipmentDate(t *testing.T) {
+	// The LC was issued without a latest shipment date; an amendment added one
+	terms := Terms{Amount: 1000, ExpiryDate: day(time.July, 31), LastShipmentDate: dayPtr(time.June, 30)}
+	added := []Amendment{{No: 1, Status: StatusAccepted, EffectiveAt: dayPtr(time.May, 1), ChangesLastShipmentDate: true}}
+
+	assert.Nil(t, AsOf(terms, added, nil, day(time.April, 1)).LastShipmentDate)
+	assert.Equal(t, dayPtr(time.June, 30), AsOf(terms, added, nil, day(time.May, 1)).LastShipmentDate)
+
+	// An amendment that left the date alone does not clear it
+	untouched := []Amendment{{No: 1, Status: StatusAccepted, EffectiveAt: dayPtr(time.May, 1), OldAmount: amount(800)}}
+	assert.Equal(t, dayPtr(time.June, 30), AsOf(terms, untouched, nil, day(time.April, 1)).LastShipmentDate)
+}
+
+func TestDiscrepancies(t *testing.T) {
+	terms := Terms{
+		ExpiryDate:       day(time.July, 31),
+		LastShipmentDate: dayPtr(time.June, 30),
+		PortOfLoading:    "Kaohsiung",
+		PortOfDischarge:  "Rotterdam",
+	}
+
+	tests := []struct {
+		name     string
+		terms    Terms
+		shipment Shipment
+		want     []string
+	}{
+		{"complies", terms, Shipment{ActualDeparture: dayPtr(time.June, 30), PortOfLoading: "KAOHSIUNG", PortOfDischarge: "rotterdam"}, nil},
+		{"late shipment", terms, Shipment{ActualDeparture: dayPtr(time.July, 2)},
+			[]string{"shipment date 2026-07-02 is after latest shipment date 2026-06-30"}},
+		{"estimated departure before the goods have left", terms, Shipment{EstimatedDeparture: dayPtr(time.July, 2)},
+			[]string{"shipment date 2026-07-02 is after latest shipment date 2026-06-30"}},
+		{"actual departure wins over the estimate", terms, Shipment{ActualDeparture: dayPtr(time.June, 28), EstimatedDeparture: dayPtr(time.July, 2)}, nil},
+		{"shipped after expiry", terms, Shipment{ActualDeparture: dayPtr(time.August, 3)}, []string{
+			"shipment date 2026-08-03 is after latest shipment date 2026-06-30",
+			"shipment date 2026-08-03 is after LC expiry 2026-07-31",
+		}},
+		{"after expiry without a latest shipment date", Terms{ExpiryDate: day(time.July, 31)}, Shipment{ActualDeparture: dayPtr(time.August, 3)},
+			[]string{"shipment date 2026-08-03 is after LC expiry 2026-07-31"}},
+		{"port of loading", terms, Shipment{PortOfLoading: "Taichung"},
+			[]string{"port of loading Taichung does not match LC port Kaohsiung"}},
+		{"port of discharge", terms, Shipment{PortOfDischarge: "Hamburg"},
+			[]string{"port of discharge Hamburg does not match LC port Rotterdam"}},
+		{"no shipment date or ports yet", terms, Shipment{}, nil},
+		{"LC without ports", Terms{ExpiryDate: day(time.July, 31)}, Shipment{PortOfLoading: "Taichung", PortOfDischarge: "Hamburg"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Discrepancies(tt.terms, tt.shipment))
+		})
+	}
+}
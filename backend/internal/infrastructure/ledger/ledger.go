@@ -0,0 +1,274 @@
+// Package ledger holds the double-entry rules behind the general ledger:
+// balance validation, posting templates for business events and trial
+// balance aggregation.
+//
+// Posting templates produce lines keyed by a posting role (for example
+// accounts_receivable) rather than by account; the caller resolves roles to
+// accounts of the company's chart. Amounts are rounded to cents.
+package ledger
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Errors returned by entry validation
+var (
+	ErrEmptyEntry  = errors.New("journal entry needs at least two lines")
+	ErrInvalidLine = errors.New("journal line must carry either a positive debit or a positive credit")
+	ErrUnbalanced  = errors.New("journal entry debits and credits do not balance")
+)
+
+// Account types
+const (
+	TypeAsset     = "asset"
+	TypeLiability = "liability"
+	TypeEquity    = "equity"
+	TypeRevenue   = "revenue"
+	TypeExpense   = "expense"
+)
+
+// Balance sides
+const (
+	Debit  = "debit"
+	Credit = "credit"
+)
+
+// tolerance absorbs float noise below half a cent
+const tolerance = 0.005
+
+// Line is one side of a journal entry
+type Line struct {
+	Role   string  `json:"role"`
+	Debit  float64 `json:"debit"`
+	Credit float64 `json:"credit"`
+	Memo   string  `json:"memo,omitempty"`
+}
+
+// Amount returns the signed line amount, positive for a debit
+func (l Line) Amount() float64 {
+	return l.Debit - l.Credit
+}
+
+// ValidAccountType reports whether t is a known account type
+func ValidAccountType(t string) bool {
+	switch t {
+	case TypeAsset, TypeLiability, TypeEquity, TypeRevenue, TypeExpense:
+		return true
+	}
+	return false
+}
+
+// NormalBalance returns the side on which an account type increases
+func NormalBalance(accountType string) string {
+	switch accountType {
+	case TypeLiability, TypeEquity, TypeRevenue:
+		return Credit
+	}
+	return Debit
+}
+
+// Signed expresses debit and credit totals as a balance on the normal side
+// of the account type, so a liability with more credits than debits is
+// positive.
+func Signed(accountType string, debit, credit float64) float64 {
+	if NormalBalance(accountType) == Credit {
+		return Round(credit - debit)
+	}
+	return Round(debit - credit)
+}
+
+// Round rounds an amount to cents
+func Round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// Totals sums the debit and credit sides of lines
+func Totals(lines []Line) (debit, credit float64) {
+	for _, l := range lines {
+		debit += l.Debit
+		credit += l.Credit
+	}
+	return Round(debit), Round(credit)
+}
+
+// Validate checks that an entry has at least two lines, that every line
+// carries exactly one positive side and that debits equal credits.
+func Validate(lines []Line) error {
+	if len(lines) < 2 {
+		return ErrEmptyEntry
+	}
+	for _, l := range lines {
+		if l.Debit < 0 || l.Credit < 0 {
+			return ErrInvalidLine
+		}
+		if (l.Debit > 0) == (l.Credit > 0) {
+			return ErrInvalidLine
+		}
+	}
+	debit, credit := Totals(lines)
+	if math.Abs(debit-credit) >= tolerance {
+		return ErrUnbalanced
+	}
+	return nil
+}
+
+// Reverse swaps the sides of every line
+func Reverse(lines []Line) []Line {
+	out := make([]Line, len(lines))
+	for i, l := range lines {
+		out[i] = Line{Role: l.Role, Debit: l.Credit, Credit: l.Debit, Memo: l.Memo}
+	}
+	return out
+}
+
+// Convert multiplies lines by an exchange rate and rounds them to cents.
+// Rounding each line separately can leave the entry a few cents out of
+// balance; the difference is booked on the largest line of the lighter side
+// so the converted entry still balances.
+func Convert(lines []Line, rate float64) []Line {
+	if rate <= 0 {
+		rate = 1
+	}
+	out := make([]Line, len(lines))
+	for i, l := range lines {
+		out[i] = Line{Role: l.Role, Debit: Round(l.Debit * rate), Credit: Round(l.Credit * rate), Memo: l.Memo}
+	}
+	debit, credit := Totals(out)
+	diff := Round(debit - credit)
+	if diff == 0 {
+		return out
+	}
+
+	// Adjust the largest line on the lighter side
+	idx := -1
+	for i, l := range out {
+		if diff > 0 && l.Credit > 0 && (idx < 0 || l.Credit > out[idx].Credit) {
+			idx = i
+		}
+		if diff < 0 && l.Debit > 0 && (idx < 0 || l.Debit > out[idx].Debit) {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return out
+	}
+	if diff > 0 {
+		out[idx].Credit = Round(out[idx].Credit + diff)
+	} else {
+		out[idx].Debit = Round(out[idx].Debit - diff)
+	}
+	return out
+}
+
+// compact drops zero lines, rounds the rest and merges lines that share a
+// role and side.
+func compact(lines []Line) []Line {
+	out := make([]Line, 0, len(lines))
+	for _, l := range lines {
+		l.Debit, l.Credit = Round(l.Debit), Round(l.Credit)
+		if l.Debit < 0 {
+			l.Debit, l.Credit = l.Credit, -l.Debit
+		}
+		if l.Credit < 0 {
+			l.Debit, l.Credit = -l.Credit, l.Debit
+		}
+		if l.Debit == 0 && l.Credit == 0 {
+			continue
+		}
+		merged := false
+		for i := range out {
+			if out[i].Role == l.Role && (out[i].Debit > 0) == (l.Debit > 0) && out[i].Memo == l.Memo {
+				out[i].Debit = Round(out[i].Debit + l.Debit)
+				out[i].Credit = Round(out[i].Credit + l.Credit)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// AccountTotals are the posted amounts of one account, split into the
+// balance brought forward and the movements of the reporting range
+type AccountTotals struct {
+	ID            string
+	Code          string
+	Name          string
+	Type          string
+	OpeningDebit  float64
+	OpeningCredit float64
+	Debit         float64
+	Credit        float64
+}
+
+// TrialBalanceRow is one account line of a trial balance. Opening and
+// Closing are expressed on the account's normal side.
+type TrialBalanceRow struct {
+	AccountID     string  `json:"account_id"`
+	Code          string  `json:"code"`
+	Name          string  `json:"name"`
+	Type          string  `json:"type"`
+	Opening       float64 `json:"opening"`
+	Debit         float64 `json:"debit"`
+	Credit        float64 `json:"credit"`
+	Closing       float64 `json:"closing"`
+	ClosingDebit  float64 `json:"closing_debit"`
+	ClosingCredit float64 `json:"closing_credit"`
+}
+
+// TrialBalance lists closing balances per account and proves that the
+// ledger balances
+type TrialBalance struct {
+	Rows               []TrialBalanceRow `json:"rows"`
+	TotalDebit         float64           `json:"total_debit"`
+	TotalCredit        float64           `json:"total_credit"`
+	TotalClosingDebit  float64           `json:"total_closing_debit"`
+	TotalClosingCredit float64           `json:"total_closing_credit"`
+	Balanced           bool              `json:"balanced"`
+}
+
+// BuildTrialBalance turns per-account totals into a trial balance sorted by
+// account code. Accounts without any balance or movement are left out.
+func BuildTrialBalance(totals []AccountTotals) *TrialBalance {
+	tb := &TrialBalance{Rows: []TrialBalanceRow{}}
+	for _, t := range totals {
+		net := Round(t.OpeningDebit + t.Debit - t.OpeningCredit - t.Credit)
+		row := TrialBalanceRow{
+			AccountID: t.ID,
+			Code:      t.Code,
+			Name:      t.Name,
+			Type:      t.Type,
+			Opening:   Signed(t.Type, t.OpeningDebit, t.OpeningCredit),
+			Debit:     Round(t.Debit),
+			Credit:    Round(t.Credit),
+			Closing:   Signed(t.Type, t.OpeningDebit+t.Debit, t.OpeningCredit+t.Credit),
+		}
+		if net > 0 {
+			row.ClosingDebit = net
+		} else {
+			row.ClosingCredit = -net
+		}
+		if row.Opening == 0 && row.Debit == 0 && row.Credit == 0 && net == 0 {
+			continue
+		}
+		tb.Rows = append(tb.Rows, row)
+		tb.TotalDebit += row.Debit
+		tb.TotalCredit += row.Credit
+		tb.TotalClosingDebit += row.ClosingDebit
+		tb.TotalClosingCredit += row.ClosingCredit
+	}
+	sort.Slice(tb.Rows, func(i, j int) bool { return tb.Rows[i].Code < tb.Rows[j].Code })
+
+	tb.TotalDebit = Round(tb.TotalDebit)
+	tb.TotalCredit = Round(tb.TotalCredit)
+	tb.TotalClosingDebit = Round(tb.TotalClosingDebit)
+	tb.TotalClosingCredit = Round(tb.TotalClosingCredit)
+	tb.Balanced = math.Abs(tb.TotalDebit-tb.TotalCredit) < tolerance &&
+		math.Abs(tb.TotalClosingDebit-tb.TotalClosingCredit) < tolerance
+	return tb
+}
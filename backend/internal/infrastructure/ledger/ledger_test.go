@@ -0,0 +1,165 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	assert.ErrorIs(t, Validate(nil), ErrEmptyEntry)
+	assert.ErrorIs(t, Validate([]Line{{Role: RoleCash, Debit: 10}}), ErrEmptyEntry)
+
+	assert.ErrorIs(t, Validate([]Line{
+		{Role: RoleCash, Debit: 10, Credit: 10},
+		{Role: RoleReceivable, Credit: 10},
+	}), ErrInvalidLine)
+	assert.ErrorIs(t, Validate([]Line{
+		{Role: RoleCash, Debit: -10},
+		{Role: RoleReceivable, Credit: -10},
+	}), ErrInvalidLine)
+	assert.ErrorIs(t, Validate([]Line{
+		{Role: RoleCash, Debit: 10},
+		{Role: RoleReceivable, Credit: 9.99},
+	}), ErrUnbalanced)
+
+	assert.NoError(t, Validate([]Line{
+		{Role: RoleCash, Debit: 0.1},
+		{Role: RoleCash, Debit: 0.2},
+		{Role: RoleReceivable, Credit: 0.3},
+	}))
+}
+
+func TestTemplatesBalance(t *testing.T) {
+	cases := map[string][]Line{
+		"sales":       SalesInvoice(1000, 50),
+		"purchase":    PurchaseInvoice(800, 40),
+		"received":    PaymentReceived(1050),
+		"made":        PaymentMade(840),
+		"expense":     ExpenseApproved(300, 15, RoleAccruedExpenses),
+		"stock in":    StockMovement(DirectionIn, "purchase", RoleRawMaterials, 500),
+		"stock out":   StockMovement(DirectionOut, "sales", RoleFinishedGoods, 420),
+		"production":  ProductionCompleted(RoleFinishedGoods, 1200),
+		"bank fee":    BankCharge(15),
+		"fx gain":     RealizedFX(RoleReceivable, 120),
+		"fx loss":     RealizedFX(RolePayable, -80),
+		"revaluation": Revaluation(250, -90),
+	}
+	for name, lines := range cases {
+		assert.NoError(t, Validate(lines), name)
+	}
+}
+
+func TestFXLines(t *testing.T) {
+	// A receivable settled at a higher rate leaves a debit to clear
+	assert.Equal(t, []Line{
+		{Role: RoleReceivable, Debit: 120},
+		{Role: RoleFXGain, Credit: 120},
+	}, RealizedFX(RoleReceivable, 120))
+	// A payable settled at a higher rate costs more than it was booked at
+	assert.Equal(t, []Line{
+		{Role: RoleFXLoss, Debit: 80},
+		{Role: RolePayable, Credit: 80},
+	}, RealizedFX(RolePayable, -80))
+	assert.Empty(t, RealizedFX(RoleReceivable, 0))
+
+	assert.Equal(t, []Line{
+		{Role: RoleReceivable, Debit: 250},
+		{Role: RoleUnrealizedFXGain, Credit: 250},
+		{Role: RoleUnrealizedFXLoss, Debit: 90},
+		{Role: RolePayable, Credit: 90},
+	}, Revaluation(250, -90))
+}
+
+func TestSalesInvoiceLines(t *testing.T) {
+	lines := SalesInvoice(1000, 50)
+	require.Len(t, lines, 3)
+	assert.Equal(t, Line{Role: RoleReceivable, Debit: 1050}, lines[0])
+	assert.Equal(t, Line{Role: RoleRevenue, Credit: 1000}, lines[1])
+	assert.Equal(t, Line{Role: RoleOutputTax, Credit: 50}, lines[2])
+
+	// Tax-free invoices have no tax line
+	assert.Len(t, SalesInvoice(1000, 0), 2)
+
+	credit := Reverse(lines)
+	assert.Equal(t, 1050.0, credit[0].Credit)
+	assert.Equal(t, 1000.0, credit[1].Debit)
+	assert.NoError(t, Validate(credit))
+}
+
+func TestStockMovementOffsets(t *testing.T) {
+	lines := StockMovement(DirectionOut, "production", RoleRawMaterials, 200)
+	require.Len(t, lines, 2)
+	assert.Equal(t, Line{Role: RoleWorkInProcess, Debit: 200}, lines[0])
+	assert.Equal(t, Line{Role: RoleRawMaterials, Credit: 200}, lines[1])
+
+	lines = StockMovement(DirectionOut, "damage", RoleFinishedGoods, -75)
+	require.Len(t, lines, 2)
+	assert.Equal(t, RoleInventoryAdjustment, lines[0].Role)
+	assert.Equal(t, 75.0, lines[0].Debit)
+
+	lines = StockMovement(DirectionIn, "initial", RoleRawMaterials, 90)
+	assert.Equal(t, RoleOpeningBalance, lines[1].Role)
+
+	assert.Nil(t, StockMovement(DirectionIn, "transfer", RoleRawMaterials, 90))
+	assert.Nil(t, StockMovement(DirectionIn, "production", RoleFinishedGoods, 90))
+	assert.Nil(t, StockMovement(DirectionOut, "sales", RoleFinishedGoods, 0))
+}
+
+func TestConvertKeepsBalance(t *testing.T) {
+	lines := SalesInvoice(33.33, 1.67)
+	adjusted := 0
+	for _, rate := range []float64{1, 0.0311, 29.87, 30.125, 32.123, 145.67} {
+		naive := 0.0
+		for _, l := range lines {
+			naive += Round(l.Debit*rate) - Round(l.Credit*rate)
+		}
+		if Round(naive) != 0 {
+			adjusted++
+		}
+
+		converted := Convert(lines, rate)
+		assert.NoError(t, Validate(converted), "rate %v", rate)
+		assert.Len(t, converted, len(lines))
+	}
+	// At least one rate must exercise the rounding adjustment
+	assert.Greater(t, adjusted, 0)
+}
+
+func TestNormalBalance(t *testing.T) {
+	assert.Equal(t, Debit, NormalBalance(TypeAsset))
+	assert.Equal(t, Debit, NormalBalance(TypeExpense))
+	assert.Equal(t, Credit, NormalBalance(TypeLiability))
+	assert.Equal(t, Credit, NormalBalance(TypeRevenue))
+	assert.Equal(t, 50.0, Signed(TypeLiability, 100, 150))
+	assert.Equal(t, -50.0, Signed(TypeAsset, 100, 150))
+}
+
+func TestBuildTrialBalance(t *testing.T) {
+	tb := BuildTrialBalance([]AccountTotals{
+		{ID: "4", Code: "4110", Name: "Sales Revenue", Type: TypeRevenue, OpeningCredit: 500, Credit: 1000},
+		{ID: "1", Code: "1170", Name: "Accounts Receivable", Type: TypeAsset, OpeningDebit: 500, Debit: 1050, Credit: 400},
+		{ID: "2", Code: "1110", Name: "Cash and Bank", Type: TypeAsset, Debit: 400},
+		{ID: "3", Code: "2270", Name: "Output VAT", Type: TypeLiability, Credit: 50},
+		{ID: "5", Code: "6100", Name: "Operating Expenses", Type: TypeExpense},
+	})
+
+	require.Len(t, tb.Rows, 4)
+	assert.Equal(t, "1110", tb.Rows[0].Code)
+	assert.Equal(t, "4110", tb.Rows[3].Code)
+
+	ar := tb.Rows[1]
+	assert.Equal(t, 500.0, ar.Opening)
+	assert.Equal(t, 1150.0, ar.Closing)
+	assert.Equal(t, 1150.0, ar.ClosingDebit)
+
+	revenue := tb.Rows[3]
+	assert.Equal(t, 1500.0, revenue.Closing)
+	assert.Equal(t, 1500.0, revenue.ClosingCredit)
+
+	assert.Equal(t, 1450.0, tb.TotalDebit)
+	assert.Equal(t, 1450.0, tb.TotalCredit)
+	assert.Equal(t, 1550.0, tb.TotalClosingDebit)
+	assert.True(t, tb.Balanced)
+}
@@ -0,0 +1,266 @@
+package ledger
+
+// Posting roles resolved to accounts of a company's chart
+const (
+	RoleCash                = "cash"
+	RoleReceivable          = "accounts_receivable"
+	RolePayable             = "accounts_payable"
+	RoleInputTax            = "input_tax"
+	RoleOutputTax           = "output_tax"
+	RoleRawMaterials        = "raw_materials"
+	RoleWorkInProcess       = "work_in_process"
+	RoleSemiFinished        = "semi_finished"
+	RoleFinishedGoods       = "finished_goods"
+	RoleGoodsReceived       = "goods_received_not_invoiced"
+	RoleAccruedExpenses     = "accrued_expenses"
+	RoleRetainedEarnings    = "retained_earnings"
+	RoleOpeningBalance      = "opening_balance_equity"
+	RoleRevenue             = "sales_revenue"
+	RoleCostOfSales         = "cost_of_goods_sold"
+	RoleInventoryAdjustment = "inventory_adjustment"
+	RoleOperatingExpense    = "operating_expense"
+	RoleBankCharges         = "bank_charges"
+	RoleFXGain              = "fx_gain"
+	RoleFXLoss              = "fx_loss"
+	RoleUnrealizedFXGain    = "unrealized_fx_gain"
+	RoleUnrealizedFXLoss    = "unrealized_fx_loss"
+)
+
+// FallbackRoles maps roles added after a chart may have been seeded to the
+// role whose account is used when the chart has none for them. Fallbacks
+// are followed until a role with an account is found.
+var FallbackRoles = map[string]string{
+	RoleBankCharges:      RoleOperatingExpense,
+	RoleFXGain:           RoleRevenue,
+	RoleFXLoss:           RoleOperatingExpense,
+	RoleUnrealizedFXGain: RoleFXGain,
+	RoleUnrealizedFXLoss: RoleFXLoss,
+}
+
+// Posting events that generate journal entries
+const (
+	EventSalesInvoice        = "invoice.sales"
+	EventSalesCreditNote     = "invoice.sales_credit_note"
+	EventPurchaseInvoice     = "invoice.purchase"
+	EventPurchaseCreditNote  = "invoice.purchase_credit_note"
+	EventPaymentReceived     = "payment.incoming"
+	EventPaymentMade         = "payment.outgoing"
+	EventExpenseApproved     = "expense.approved"
+	EventStockMovement       = "stock.movement"
+	EventProductionCompleted = "production.completed"
+	EventBankCharge          = "bank.charge"
+	EventFXRealized          = "fx.realized"
+	EventFXRevaluation       = "fx.revaluation"
+	EventManual              = "manual"
+	EventReversal            = "reversal"
+)
+
+// Events lists every automatic posting event
+var Events = []string{
+	EventSalesInvoice,
+	EventSalesCreditNote,
+	EventPurchaseInvoice,
+	EventPurchaseCreditNote,
+	EventPaymentReceived,
+	EventPaymentMade,
+	EventExpenseApproved,
+	EventStockMovement,
+	EventProductionCompleted,
+	EventBankCharge,
+	EventFXRealized,
+	EventFXRevaluation,
+}
+
+// AccountDef is an account of the default chart
+type AccountDef struct {
+	Code string
+	Name string
+	Type string
+	Role string
+}
+
+// DefaultChart is the chart of accounts seeded for a company without one.
+// Codes follow the four-digit grouping common in Taiwan.
+var DefaultChart = []AccountDef{
+	{"1110", "Cash and Bank", TypeAsset, RoleCash},
+	{"1170", "Accounts Receivable", TypeAsset, RoleReceivable},
+	{"1210", "Raw Materials", TypeAsset, RoleRawMaterials},
+	{"1220", "Work in Process", TypeAsset, RoleWorkInProcess},
+	{"1230", "Semi-finished Goods", TypeAsset, RoleSemiFinished},
+	{"1240", "Finished Goods", TypeAsset, RoleFinishedGoods},
+	{"1470", "Input VAT", TypeAsset, RoleInputTax},
+	{"2150", "Accounts Payable", TypeLiability, RolePayable},
+	{"2160", "Goods Received Not Invoiced", TypeLiability, RoleGoodsReceived},
+	{"2200", "Accrued Expenses", TypeLiability, RoleAccruedExpenses},
+	{"2270", "Output VAT", TypeLiability, RoleOutputTax},
+	{"3110", "Share Capital", TypeEquity, ""},
+	{"3350", "Retained Earnings", TypeEquity, RoleRetainedEarnings},
+	{"3900", "Opening Balance Equity", TypeEquity, RoleOpeningBalance},
+	{"4110", "Sales Revenue", TypeRevenue, RoleRevenue},
+	{"5110", "Cost of Goods Sold", TypeExpense, RoleCostOfSales},
+	{"5120", "Inventory Adjustments", TypeExpense, RoleInventoryAdjustment},
+	{"6100", "Operating Expenses", TypeExpense, RoleOperatingExpense},
+	{"6150", "Bank Charges", TypeExpense, RoleBankCharges},
+	{"7130", "Foreign Exchange Gain", TypeRevenue, RoleFXGain},
+	{"7140", "Unrealized Foreign Exchange Gain", TypeRevenue, RoleUnrealizedFXGain},
+	{"7630", "Foreign Exchange Loss", TypeExpense, RoleFXLoss},
+	{"7640", "Unrealized Foreign Exchange Loss", TypeExpense, RoleUnrealizedFXLoss},
+}
+
+// Stock movement directions
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// SalesInvoice books revenue and output tax against the receivable
+func SalesInvoice(net, tax float64) []Line {
+	return compact([]Line{
+		{Role: RoleReceivable, Debit: net + tax},
+		{Role: RoleRevenue, Credit: net},
+		{Role: RoleOutputTax, Credit: tax},
+	})
+}
+
+// PurchaseInvoice clears goods received and books input tax against the
+// payable
+func PurchaseInvoice(net, tax float64) []Line {
+	return compact([]Line{
+		{Role: RoleGoodsReceived, Debit: net},
+		{Role: RoleInputTax, Debit: tax},
+		{Role: RolePayable, Credit: net + tax},
+	})
+}
+
+// PaymentReceived books an incoming payment against the receivable
+func PaymentReceived(amount float64) []Line {
+	return compact([]Line{
+		{Role: RoleCash, Debit: amount},
+		{Role: RoleReceivable, Credit: amount},
+	})
+}
+
+// PaymentMade books an outgoing payment against the payable
+func PaymentMade(amount float64) []Line {
+	return compact([]Line{
+		{Role: RolePayable, Debit: amount},
+		{Role: RoleCash, Credit: amount},
+	})
+}
+
+// BankCharge books a fee the bank deducted from the account
+func BankCharge(amount float64) []Line {
+	return compact([]Line{
+		{Role: RoleBankCharges, Debit: amount},
+		{Role: RoleCash, Credit: amount},
+	})
+}
+
+// RealizedFX settles the base-currency difference left on the receivable
+// or payable role after a foreign payment was booked at its own rate. A
+// positive gain debits the balance, a loss credits it.
+func RealizedFX(role string, gain float64) []Line {
+	return fxDifference(role, gain, RoleFXGain, RoleFXLoss)
+}
+
+// Revaluation adjusts receivables and payables to their value at the
+// closing rate. receivable and payable are the net gains on each balance.
+func Revaluation(receivable, payable float64) []Line {
+	return compact(append(
+		fxDifference(RoleReceivable, receivable, RoleUnrealizedFXGain, RoleUnrealizedFXLoss),
+		fxDifference(RolePayable, payable, RoleUnrealizedFXGain, RoleUnrealizedFXLoss)...,
+	))
+}
+
+func fxDifference(role string, gain float64, gainRole, lossRole string) []Line {
+	if gain < 0 {
+		return compact([]Line{
+			{Role: lossRole, Debit: -gain},
+			{Role: role, Credit: -gain},
+		})
+	}
+	return compact([]Line{
+		{Role: role, Debit: gain},
+		{Role: gainRole, Credit: gain},
+	})
+}
+
+// ExpenseApproved books an approved expense and its input tax against
+// payableRole, which is the supplier payable or accrued expenses
+func ExpenseApproved(amount, tax float64, payableRole string) []Line {
+	return compact([]Line{
+		{Role: RoleOperatingExpense, Debit: amount},
+		{Role: RoleInputTax, Debit: tax},
+		{Role: payableRole, Credit: amount + tax},
+	})
+}
+
+// StockMovement books a valued stock movement on inventoryRole. The offset
+// account depends on the movement reason. Transfers and production output
+// return no lines: transfers keep the value on the same account and
+// production output is booked on completion of the production order.
+func StockMovement(direction, reason, inventoryRole string, value float64) []Line {
+	if value < 0 {
+		value = -value
+	}
+	if value == 0 || reason == "transfer" {
+		return nil
+	}
+
+	var offset string
+	switch direction {
+	case DirectionIn:
+		switch reason {
+		case "purchase":
+			offset = RoleGoodsReceived
+		case "initial":
+			offset = RoleOpeningBalance
+		case "return", "sales":
+			offset = RoleCostOfSales
+		case "production":
+			return nil
+		default:
+			offset = RoleInventoryAdjustment
+		}
+		return compact([]Line{
+			{Role: inventoryRole, Debit: value},
+			{Role: offset, Credit: value},
+		})
+	case DirectionOut:
+		switch reason {
+		case "sales":
+			offset = RoleCostOfSales
+		case "production":
+			offset = RoleWorkInProcess
+		case "return", "purchase":
+			offset = RoleGoodsReceived
+		default:
+			offset = RoleInventoryAdjustment
+		}
+		return compact([]Line{
+			{Role: offset, Debit: value},
+			{Role: inventoryRole, Credit: value},
+		})
+	}
+	return nil
+}
+
+// ProductionCompleted moves the value of a completed production order out
+// of work in process onto inventoryRole
+func ProductionCompleted(inventoryRole string, value float64) []Line {
+	return compact([]Line{
+		{Role: inventoryRole, Debit: value},
+		{Role: RoleWorkInProcess, Credit: value},
+	})
+}
+
+// InventoryRole returns the inventory posting role for an inventory category
+func InventoryRole(category string) string {
+	switch category {
+	case "raw_material":
+		return RoleRawMaterials
+	case "semi_finished":
+		return RoleSemiFinished
+	}
+	return RoleFinishedGoods
+}
@@ -0,0 +1,597 @@
+// Package loadplan palletizes shipment lines and plans the container mix.
+//
+// Fastener cargo is dense: a container usually reaches its payload limit long
+// before it is full, so every placement is checked against weight first and
+// floor space or volume second. Dimensions are in cm, weights in kg and
+// volumes in m3.
+package loadplan
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Errors returned when a plan cannot be computed
+var (
+	ErrNoContainerTypes = errors.New("no container types to plan with")
+	ErrInvalidItem      = errors.New("invalid load item")
+	ErrDoesNotFit       = errors.New("load unit does not fit any container")
+)
+
+// Limits reported on plans and capacities
+const (
+	LimitedByWeight = "weight"
+	LimitedBySpace  = "space"
+	LimitedByHeight = "height"
+	LimitedByFixed  = "fixed"
+)
+
+// ContainerType describes the usable interior and payload of a container
+type ContainerType struct {
+	Code        string  `json:"code"`
+	InnerLength float64 `json:"inner_length"`
+	InnerWidth  float64 `json:"inner_width"`
+	InnerHeight float64 `json:"inner_height"`
+	MaxPayload  float64 `json:"max_payload"`
+	TEU         float64 `json:"teu"`
+}
+
+// Volume returns the inner volume in m3
+func (c ContainerType) Volume() float64 {
+	return c.InnerLength * c.InnerWidth * c.InnerHeight / 1e6
+}
+
+// DefaultContainerTypes returns ISO dry containers with typical payloads.
+// Note that a 40ft takes less payload than a 20ft.
+func DefaultContainerTypes() []ContainerType {
+	return []ContainerType{
+		{Code: "20ft", InnerLength: 589, InnerWidth: 235, InnerHeight: 239, MaxPayload: 28200, TEU: 1},
+		{Code: "40ft", InnerLength: 1203, InnerWidth: 235, InnerHeight: 239, MaxPayload: 26700, TEU: 2},
+		{Code: "40hc", InnerLength: 1203, InnerWidth: 235, InnerHeight: 269, MaxPayload: 26500, TEU: 2},
+	}
+}
+
+// Carton is one shipping carton
+type Carton struct {
+	Length      float64 `json:"length"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	GrossWeight float64 `json:"gross_weight"`
+	NetWeight   float64 `json:"net_weight"`
+}
+
+// Volume returns the carton volume in m3
+func (c Carton) Volume() float64 {
+	return c.Length * c.Width * c.Height / 1e6
+}
+
+// PalletSpec describes how cartons are built up on a pallet
+type PalletSpec struct {
+	Length     float64 `json:"length"`
+	Width      float64 `json:"width"`
+	DeckHeight float64 `json:"deck_height"`
+	MaxHeight  float64 `json:"max_height"` // overall height including the deck
+	TareWeight float64 `json:"tare_weight"`
+	MaxWeight  float64 `json:"max_weight"` // gross weight including the tare, 0 for no limit
+	// CartonsPerPallet fixes the pallet pattern instead of computing it
+	CartonsPerPallet int `json:"cartons_per_pallet"`
+	// Stackable allows a second tier of pallets when the height permits
+	Stackable bool `json:"stackable"`
+}
+
+// DefaultPallet returns a 120x100 cm pallet built up to 110 cm and 1,000 kg,
+// the usual limits for fastener pallets
+func DefaultPallet() PalletSpec {
+	return PalletSpec{Length: 120, Width: 100, DeckHeight: 15, MaxHeight: 110, TareWeight: 25, MaxWeight: 1000}
+}
+
+// Item is one shipment line to load
+type Item struct {
+	Key         string      `json:"key"`
+	Description string      `json:"description"`
+	Cartons     int         `json:"cartons"`
+	Carton      Carton      `json:"carton"`
+	Pallet      *PalletSpec `json:"pallet,omitempty"` // nil ships the cartons floor-loaded
+}
+
+// Options controls planning
+type Options struct {
+	ContainerTypes []ContainerType
+	// VolumeFillFactor is the usable share of the container volume for
+	// floor-loaded cartons; defaults to 0.85
+	VolumeFillFactor float64
+	// Cost per container by type code. When every type has a cost the mix
+	// with the lowest total cost is chosen, otherwise the one with the fewest
+	// containers and TEU.
+	Cost map[string]float64
+}
+
+// Palletization is the pallet pattern of one item
+type Palletization struct {
+	Key              string  `json:"key"`
+	CartonsPerLayer  int     `json:"cartons_per_layer"`
+	Layers           int     `json:"layers"`
+	CartonsPerPallet int     `json:"cartons_per_pallet"`
+	FullPallets      int     `json:"full_pallets"`
+	PartialCartons   int     `json:"partial_cartons"` // cartons on the last, partial pallet
+	Pallets          int     `json:"pallets"`
+	PalletHeight     float64 `json:"pallet_height"`      // height of a full pallet
+	FullPalletWeight float64 `json:"full_pallet_weight"` // gross weight of a full pallet including the tare
+	LimitedBy        string  `json:"limited_by"`
+}
+
+// Capacity answers how many pallets (or loose cartons) of an item fit one container
+type Capacity struct {
+	Key           string `json:"key"`
+	ContainerType string `json:"container_type"`
+	Pallets       int    `json:"pallets,omitempty"`
+	Cartons       int    `json:"cartons"`
+	LimitedBy     string `json:"limited_by"`
+}
+
+// LoadLine is the part of an item loaded into one container
+type LoadLine struct {
+	Key         string  `json:"key"`
+	Pallets     int     `json:"pallets"`
+	Cartons     int     `json:"cartons"`
+	GrossWeight float64 `json:"gross_weight"`
+	Volume      float64 `json:"volume"`
+}
+
+// ContainerLoad is one planned container
+type ContainerLoad struct {
+	Type              string     `json:"type"`
+	Lines             []LoadLine `json:"lines"`
+	Pallets           int        `json:"pallets"`
+	Cartons           int        `json:"cartons"`
+	GrossWeight       float64    `json:"gross_weight"`
+	Volume            float64    `json:"volume"`
+	WeightUtilization float64    `json:"weight_utilization"`
+	SpaceUtilization  float64    `json:"space_utilization"`
+	LimitedBy         string     `json:"limited_by"`
+}
+
+// Plan is the result of planning a set of items
+type Plan struct {
+	Palletization    []Palletization `json:"palletization"`
+	Capacities       []Capacity      `json:"capacities"`
+	Containers       []ContainerLoad `json:"containers"`
+	Mix              map[string]int  `json:"mix"`
+	TotalPallets     int             `json:"total_pallets"`
+	TotalCartons     int             `json:"total_cartons"`
+	TotalGrossWeight float64         `json:"total_gross_weight"`
+	TotalNetWeight   float64         `json:"total_net_weight"`
+	TotalVolume      float64         `json:"total_volume"`
+	TEU              float64         `json:"teu"`
+	Cost             float64         `json:"cost,omitempty"`
+	Warnings         []string        `json:"warnings,omitempty"`
+}
+
+// MixString renders the container mix as e.g. "1x40ft + 2x20ft", largest first
+func (p *Plan) MixString() string {
+	if len(p.Mix) == 0 {
+		return ""
+	}
+	codes := make([]string, 0, len(p.Mix))
+	for code := range p.Mix {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] > codes[j] })
+	parts := make([]string, 0, len(codes))
+	for _, code := range codes {
+		parts = append(parts, fmt.Sprintf("%dx%s", p.Mix[code], code))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// group is a batch of identical load units: full pallets, a partial pallet or loose cartons
+type group struct {
+	item          int
+	count         int
+	cartons       int     // cartons per unit
+	weight        float64 // gross weight per unit
+	volume        float64 // outer volume per unit
+	pallet        bool
+	length, width float64
+	height        float64
+	stackable     bool
+}
+
+// Compute palletizes the items and plans the container mix
+func Compute(items []Item, opts Options) (*Plan, error) {
+	if len(opts.ContainerTypes) == 0 {
+		return nil, ErrNoContainerTypes
+	}
+	if opts.VolumeFillFactor <= 0 || opts.VolumeFillFactor > 1 {
+		opts.VolumeFillFactor = 0.85
+	}
+
+	plan := &Plan{Mix: make(map[string]int)}
+	var groups []group
+	for i, item := range items {
+		if item.Cartons <= 0 {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s: no cartons to load", item.Key))
+			continue
+		}
+		c := item.Carton
+		if c.Length <= 0 || c.Width <= 0 || c.Height <= 0 || c.GrossWeight <= 0 {
+			return nil, fmt.Errorf("%w: %s needs carton dimensions and gross weight", ErrInvalidItem, item.Key)
+		}
+
+		plan.TotalCartons += item.Cartons
+		plan.TotalGrossWeight += float64(item.Cartons) * c.GrossWeight
+		plan.TotalNetWeight += float64(item.Cartons) * c.NetWeight
+
+		if item.Pallet == nil {
+			groups = append(groups, group{
+				item: i, count: item.Cartons, cartons: 1, weight: c.GrossWeight, volume: c.Volume(),
+				length: c.Length, width: c.Width, height: c.Height,
+			})
+			plan.TotalVolume += float64(item.Cartons) * c.Volume()
+			continue
+		}
+
+		p, err := palletize(item)
+		if err != nil {
+			return nil, err
+		}
+		plan.Palletization = append(plan.Palletization, p)
+		plan.TotalPallets += p.Pallets
+		plan.TotalGrossWeight += float64(p.Pallets) * item.Pallet.TareWeight
+		if item.Pallet.MaxWeight > 0 && p.FullPalletWeight > item.Pallet.MaxWeight {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s: a full pallet weighs %.0f kg, above the %.0f kg pallet limit", item.Key, p.FullPalletWeight, item.Pallet.MaxWeight))
+		}
+
+		spec := item.Pallet
+		if p.FullPallets > 0 {
+			volume := spec.Length * spec.Width * p.PalletHeight / 1e6
+			groups = append(groups, group{
+				item: i, count: p.FullPallets, cartons: p.CartonsPerPallet, weight: p.FullPalletWeight, volume: volume,
+				pallet: true, length: spec.Length, width: spec.Width, height: p.PalletHeight, stackable: spec.Stackable,
+			})
+			plan.TotalVolume += float64(p.FullPallets) * volume
+		}
+		if p.PartialCartons > 0 {
+			height := spec.DeckHeight + math.Ceil(float64(p.PartialCartons)/float64(p.CartonsPerLayer))*c.Height
+			volume := spec.Length * spec.Width * height / 1e6
+			groups = append(groups, group{
+				item: i, count: 1, cartons: p.PartialCartons, weight: float64(p.PartialCartons)*c.GrossWeight + spec.TareWeight, volume: volume,
+				pallet: true, length: spec.Length, width: spec.Width, height: height, stackable: spec.Stackable,
+			})
+			plan.TotalVolume += volume
+		}
+	}
+
+	for _, g := range groups {
+		if !fitsAny(g, opts) {
+			return nil, fmt.Errorf("%w: %s (%.0f kg, %.0fx%.0fx%.0f cm)", ErrDoesNotFit, items[g.item].Key, g.weight, g.length, g.width, g.height)
+		}
+	}
+	plan.Capacities = capacities(items, plan.Palletization, opts)
+
+	if len(groups) == 0 {
+		return plan, nil
+	}
+
+	best := bestPacking(groups, opts)
+	for _, load := range best.loads {
+		plan.Containers = append(plan.Containers, load.result(items, opts))
+		plan.Mix[load.ct.Code]++
+		plan.TEU += load.ct.TEU
+	}
+	plan.Cost = best.cost
+	return plan, nil
+}
+
+// palletize computes how many cartons of an item go on one pallet
+func palletize(item Item) (Palletization, error) {
+	spec := *item.Pallet
+	c := item.Carton
+	p := Palletization{Key: item.Key}
+
+	p.CartonsPerLayer = maxInt(
+		int(spec.Length/c.Length)*int(spec.Width/c.Width),
+		int(spec.Length/c.Width)*int(spec.Width/c.Length),
+	)
+	if p.CartonsPerLayer == 0 {
+		return p, fmt.Errorf("%w: %s cartons are larger than the pallet", ErrInvalidItem, item.Key)
+	}
+
+	switch {
+	case spec.CartonsPerPallet > 0:
+		p.CartonsPerPallet = spec.CartonsPerPallet
+		p.LimitedBy = LimitedByFixed
+	default:
+		p.Layers = int((spec.MaxHeight - spec.DeckHeight) / c.Height)
+		if p.Layers <= 0 {
+			return p, fmt.Errorf("%w: %s cartons exceed the pallet height limit", ErrInvalidItem, item.Key)
+		}
+		p.CartonsPerPallet = p.CartonsPerLayer * p.Layers
+		p.LimitedBy = LimitedByHeight
+		if spec.MaxWeight > 0 {
+			byWeight := int((spec.MaxWeight - spec.TareWeight) / c.GrossWeight)
+			if byWeight <= 0 {
+				return p, fmt.Errorf("%w: one %s carton exceeds the pallet weight limit", ErrInvalidItem, item.Key)
+			}
+			if byWeight < p.CartonsPerPallet {
+				p.CartonsPerPallet = byWeight
+				p.LimitedBy = LimitedByWeight
+			}
+		}
+	}
+	p.Layers = int(math.Ceil(float64(p.CartonsPerPallet) / float64(p.CartonsPerLayer)))
+
+	p.FullPallets = item.Cartons / p.CartonsPerPallet
+	p.PartialCartons = item.Cartons % p.CartonsPerPallet
+	p.Pallets = p.FullPallets
+	if p.PartialCartons > 0 {
+		p.Pallets++
+	}
+	p.PalletHeight = spec.DeckHeight + float64(p.Layers)*c.Height
+	p.FullPalletWeight = float64(p.CartonsPerPallet)*c.GrossWeight + spec.TareWeight
+	return p, nil
+}
+
+// floorPositions returns how many pallets of a footprint fit on the container
+// floor, mixing lengthwise and crosswise rows
+func floorPositions(ct ContainerType, length, width float64) int {
+	along := int(ct.InnerWidth / width)   // pallets per row with the long side along the container
+	across := int(ct.InnerWidth / length) // pallets per row with the long side across
+	best := 0
+	for rows := 0; float64(rows)*length <= ct.InnerLength; rows++ {
+		rest := ct.InnerLength - float64(rows)*length
+		n := rows*along + int(rest/width)*across
+		if n > best {
+			best = n
+		}
+	}
+	return best
+}
+
+// tiers returns how many pallets of the group can be stacked in the container
+func (g group) tiers(ct ContainerType) int {
+	if g.stackable && 2*g.height <= ct.InnerHeight {
+		return 2
+	}
+	return 1
+}
+
+// space returns the share of the container one unit of the group occupies:
+// floor positions for pallets, usable volume for loose cartons
+func (g group) space(ct ContainerType, fill float64) float64 {
+	if g.pallet {
+		positions := floorPositions(ct, g.length, g.width) * g.tiers(ct)
+		if positions == 0 || g.height > ct.InnerHeight {
+			return math.Inf(1)
+		}
+		return 1 / float64(positions)
+	}
+	if g.height > ct.InnerHeight {
+		return math.Inf(1)
+	}
+	return g.volume / (ct.Volume() * fill)
+}
+
+func fitsAny(g group, opts Options) bool {
+	for _, ct := range opts.ContainerTypes {
+		if g.weight <= ct.MaxPayload && g.space(ct, opts.VolumeFillFactor) <= 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func capacities(items []Item, pallets []Palletization, opts Options) []Capacity {
+	byKey := make(map[string]Palletization, len(pallets))
+	for _, p := range pallets {
+		byKey[p.Key] = p
+	}
+
+	var out []Capacity
+	for _, item := range items {
+		if item.Cartons <= 0 {
+			continue
+		}
+		for _, ct := range opts.ContainerTypes {
+			c := Capacity{Key: item.Key, ContainerType: ct.Code}
+			if p, ok := byKey[item.Key]; ok && item.Pallet != nil {
+				g := group{pallet: true, length: item.Pallet.Length, width: item.Pallet.Width, height: p.PalletHeight, stackable: item.Pallet.Stackable}
+				bySpace := floorPositions(ct, g.length, g.width) * g.tiers(ct)
+				if g.height > ct.InnerHeight {
+					bySpace = 0
+				}
+				byWeight := int(ct.MaxPayload / p.FullPalletWeight)
+				c.Pallets, c.LimitedBy = limit(bySpace, byWeight)
+				c.Cartons = c.Pallets * p.CartonsPerPallet
+			} else {
+				bySpace := int(ct.Volume() * opts.VolumeFillFactor / item.Carton.Volume())
+				byWeight := int(ct.MaxPayload / item.Carton.GrossWeight)
+				c.Cartons, c.LimitedBy = limit(bySpace, byWeight)
+			}
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func limit(bySpace, byWeight int) (int, string) {
+	if byWeight < bySpace {
+		return byWeight, LimitedByWeight
+	}
+	return bySpace, LimitedBySpace
+}
+
+// load is a container being filled
+type load struct {
+	ct     ContainerType
+	weight float64
+	space  float64
+	placed map[int]*placement
+	order  []int
+}
+
+type placement struct {
+	pallets int
+	cartons int
+	weight  float64
+	volume  float64
+}
+
+func (l *load) place(g group, n int) {
+	p, ok := l.placed[g.item]
+	if !ok {
+		p = &placement{}
+		l.placed[g.item] = p
+		l.order = append(l.order, g.item)
+	}
+	if g.pallet {
+		p.pallets += n
+	}
+	p.cartons += n * g.cartons
+	p.weight += float64(n) * g.weight
+	p.volume += float64(n) * g.volume
+}
+
+func (l *load) result(items []Item, opts Options) ContainerLoad {
+	cl := ContainerLoad{Type: l.ct.Code}
+	for _, idx := range l.order {
+		p := l.placed[idx]
+		cl.Lines = append(cl.Lines, LoadLine{Key: items[idx].Key, Pallets: p.pallets, Cartons: p.cartons, GrossWeight: round(p.weight, 2), Volume: round(p.volume, 3)})
+		cl.Pallets += p.pallets
+		cl.Cartons += p.cartons
+		cl.GrossWeight += p.weight
+		cl.Volume += p.volume
+	}
+	cl.GrossWeight = round(cl.GrossWeight, 2)
+	cl.Volume = round(cl.Volume, 3)
+	cl.WeightUtilization = round(l.weight/l.ct.MaxPayload, 4)
+	cl.SpaceUtilization = round(l.space, 4)
+	cl.LimitedBy = LimitedBySpace
+	if cl.WeightUtilization >= cl.SpaceUtilization {
+		cl.LimitedBy = LimitedByWeight
+	}
+	return cl
+}
+
+type packing struct {
+	loads []*load
+	cost  float64
+	teu   float64
+}
+
+// pack fills containers in sequence: count containers of first, then second
+// for the remainder. Heavy units are placed first so that light units can top
+// up containers that reached their weight limit.
+func pack(groups []group, first ContainerType, count int, second ContainerType, opts Options) packing {
+	remaining := make([]int, len(groups))
+	left := 0
+	for i, g := range groups {
+		remaining[i] = g.count
+		left += g.count
+	}
+
+	var res packing
+	for left > 0 {
+		ct := second
+		if len(res.loads) < count {
+			ct = first
+		}
+		l := &load{ct: ct, placed: make(map[int]*placement)}
+		for i, g := range groups {
+			if remaining[i] == 0 {
+				continue
+			}
+			space := g.space(ct, opts.VolumeFillFactor)
+			n := remaining[i]
+			if byWeight := int((ct.MaxPayload - l.weight + 1e-9) / g.weight); byWeight < n {
+				n = byWeight
+			}
+			if bySpace := int((1 - l.space + 1e-9) / space); bySpace < n {
+				n = bySpace
+			}
+			if n <= 0 {
+				continue
+			}
+			l.place(g, n)
+			l.weight += float64(n) * g.weight
+			l.space += float64(n) * space
+			remaining[i] -= n
+			left -= n
+		}
+		if len(l.placed) == 0 {
+			// Nothing fits this container type; the caller discards the packing
+			res.loads = nil
+			res.cost = math.Inf(1)
+			return res
+		}
+		res.loads = append(res.loads, l)
+		res.teu += ct.TEU
+		res.cost += opts.Cost[ct.Code]
+	}
+	return res
+}
+
+func bestPacking(groups []group, opts Options) packing {
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].weight > groups[j].weight })
+
+	costed := len(opts.Cost) > 0
+	for _, ct := range opts.ContainerTypes {
+		if _, ok := opts.Cost[ct.Code]; !ok {
+			costed = false
+		}
+	}
+	better := func(a, b packing) bool {
+		if b.loads == nil {
+			return a.loads != nil
+		}
+		if a.loads == nil {
+			return false
+		}
+		if costed && math.Abs(a.cost-b.cost) > 1e-6 {
+			return a.cost < b.cost
+		}
+		if len(a.loads) != len(b.loads) {
+			return len(a.loads) < len(b.loads)
+		}
+		return a.teu < b.teu
+	}
+
+	var best packing
+	for _, second := range opts.ContainerTypes {
+		single := pack(groups, second, 0, second, opts)
+		if better(single, best) {
+			best = single
+		}
+		for _, first := range opts.ContainerTypes {
+			if first.Code == second.Code {
+				continue
+			}
+			limit := len(pack(groups, first, 0, first, opts).loads)
+			for k := 1; k < limit; k++ {
+				candidate := pack(groups, first, k, second, opts)
+				if better(candidate, best) {
+					best = candidate
+				}
+			}
+		}
+	}
+	if !costed {
+		best.cost = 0
+	}
+	return best
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func round(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,116 @@
+package loadplan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// boltCarton is a typical 25 kg carton of hex bolts
+var boltCarton = Carton{Length: 30, Width: 20, Height: 15, GrossWeight: 25, NetWeight: 24.5}
+
+func palletized(key string, cartons int) Item {
+	pallet := DefaultPallet()
+	return Item{Key: key, Cartons: cartons, Carton: boltCarton, Pallet: &pallet}
+}
+
+func TestPalletizeIsWeightLimited(t *testing.T) {
+	p, err := palletize(palletized("M10", 100))
+	require.NoError(t, err)
+
+	// 4x5 = 20 cartons per layer, 6 layers by height, but only 39 cartons by weight
+	assert.Equal(t, 20, p.CartonsPerLayer)
+	assert.Equal(t, 39, p.CartonsPerPallet)
+	assert.Equal(t, LimitedByWeight, p.LimitedBy)
+	assert.Equal(t, 2, p.Layers)
+	assert.Equal(t, 2, p.FullPallets)
+	assert.Equal(t, 22, p.PartialCartons)
+	assert.Equal(t, 3, p.Pallets)
+	assert.Equal(t, 39*25.0+25, p.FullPalletWeight)
+}
+
+func TestFloorPositions(t *testing.T) {
+	types := DefaultContainerTypes()
+	assert.Equal(t, 9, floorPositions(types[0], 120, 100))
+	assert.Equal(t, 20, floorPositions(types[1], 120, 100))
+}
+
+func TestCapacityAnswersTwentyVersusForty(t *testing.T) {
+	plan, err := Compute([]Item{palletized("M10", 39*30)}, Options{ContainerTypes: DefaultContainerTypes()[:2]})
+	require.NoError(t, err)
+
+	capacity := map[string]Capacity{}
+	for _, c := range plan.Capacities {
+		capacity[c.ContainerType] = c
+	}
+	// Floor space limits the 20ft; the 40ft has 20 positions but payload for only 26 pallets of 1,000 kg
+	assert.Equal(t, 9, capacity["20ft"].Pallets)
+	assert.Equal(t, LimitedBySpace, capacity["20ft"].LimitedBy)
+	assert.Equal(t, 20, capacity["40ft"].Pallets)
+
+	stackable := palletized("M10", 39*30)
+	stackable.Pallet.Stackable = true
+	plan, err = Compute([]Item{stackable}, Options{ContainerTypes: DefaultContainerTypes()[:2]})
+	require.NoError(t, err)
+	for _, c := range plan.Capacities {
+		if c.ContainerType == "40ft" {
+			assert.Equal(t, 26, c.Pallets)
+			assert.Equal(t, LimitedByWeight, c.LimitedBy)
+		}
+	}
+}
+
+func TestComputeRespectsPayload(t *testing.T) {
+	// Heavy 2 t pallets, double stacked: payload runs out long before floor space
+	item := palletized("M12", 79*26)
+	item.Pallet.MaxWeight = 2000
+	item.Pallet.Stackable = true
+	plan, err := Compute([]Item{item}, Options{ContainerTypes: DefaultContainerTypes()[:2]})
+	require.NoError(t, err)
+
+	assert.Equal(t, 26, plan.TotalPallets)
+	assert.InDelta(t, 26*2000.0, plan.TotalGrossWeight, 0.001)
+	pallets := 0
+	for _, c := range plan.Containers {
+		assert.LessOrEqual(t, c.GrossWeight, 28200.0)
+		assert.Equal(t, LimitedByWeight, c.LimitedBy)
+		pallets += c.Pallets
+	}
+	assert.Equal(t, 26, pallets)
+	// A 40ft takes only 13 of these pallets, so two 20ft beat 40ft + 20ft on TEU
+	assert.Equal(t, map[string]int{"20ft": 2}, plan.Mix)
+	assert.Equal(t, "2x20ft", plan.MixString())
+	assert.Equal(t, 2.0, plan.TEU)
+}
+
+func TestComputeUsesCost(t *testing.T) {
+	item := palletized("M8", 39*12)
+	opts := Options{ContainerTypes: DefaultContainerTypes()[:2], Cost: map[string]float64{"20ft": 1500, "40ft": 1800}}
+	plan, err := Compute([]Item{item}, opts)
+	require.NoError(t, err)
+
+	// 12 pallets need two 20ft (3,000) or one 40ft (1,800)
+	assert.Equal(t, map[string]int{"40ft": 1}, plan.Mix)
+	assert.Equal(t, 1800.0, plan.Cost)
+	assert.Equal(t, LimitedBySpace, plan.Containers[0].LimitedBy)
+}
+
+func TestComputeLooseCartons(t *testing.T) {
+	plan, err := Compute([]Item{{Key: "nuts", Cartons: 1200, Carton: boltCarton}}, Options{ContainerTypes: DefaultContainerTypes()[:1]})
+	require.NoError(t, err)
+
+	// 1,200 cartons weigh 30 t: the 20ft takes 1,128 by weight long before it is full
+	require.Len(t, plan.Containers, 2)
+	assert.Equal(t, 1128, plan.Containers[0].Cartons)
+	assert.Equal(t, LimitedByWeight, plan.Containers[0].LimitedBy)
+	assert.Equal(t, 0, plan.TotalPallets)
+}
+
+func TestComputeRejectsMissingData(t *testing.T) {
+	_, err := Compute([]Item{{Key: "x", Cartons: 1}}, Options{ContainerTypes: DefaultContainerTypes()})
+	assert.ErrorIs(t, err, ErrInvalidItem)
+
+	_, err = Compute([]Item{palletized("x", 1)}, Options{})
+	assert.ErrorIs(t, err, ErrNoContainerTypes)
+}
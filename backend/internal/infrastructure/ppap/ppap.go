@@ -0,0 +1,175 @@
+// Package ppap implements the submission requirements of the AIAG
+// Production Part Approval Process (4th edition): the 18 PPAP elements and
+// which of them are submitted to the customer or retained at the supplier
+// for each of the five submission levels.
+package ppap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Submission levels
+const (
+	Level1 = 1 // warrant only (and appearance approval report for appearance items)
+	Level2 = 2 // warrant with product samples and limited supporting data
+	Level3 = 3 // warrant with product samples and complete supporting data
+	Level4 = 4 // warrant and other requirements as defined by the customer
+	Level5 = 5 // warrant with product samples and complete supporting data reviewed at the supplier
+)
+
+// Requirements of an element at a level
+const (
+	Submit          = "submit"   // submitted to the customer
+	Retain          = "retain"   // retained at the supplier and made available on request
+	CustomerDefined = "customer" // as defined by the customer; retained unless the customer asks for it
+)
+
+// PPAP elements
+const (
+	DesignRecords = iota + 1
+	EngineeringChangeDocuments
+	CustomerEngineeringApproval
+	DesignFMEA
+	ProcessFlowDiagram
+	ProcessFMEA
+	ControlPlan
+	MeasurementSystemAnalysis
+	DimensionalResults
+	MaterialPerformanceResults
+	InitialProcessStudies
+	QualifiedLaboratoryDocumentation
+	AppearanceApprovalReport
+	SampleProduct
+	MasterSample
+	CheckingAids
+	CustomerSpecificRequirements
+	PartSubmissionWarrant
+)
+
+// ElementCount is the number of PPAP elements
+const ElementCount = PartSubmissionWarrant
+
+// ErrInvalidLevel is returned for a submission level outside 1 to 5
+var ErrInvalidLevel = errors.New("PPAP level must be between 1 and 5")
+
+// ElementNames are the names of the elements, element 1 at index 1
+var ElementNames = [...]string{
+	DesignRecords:                    "Design records",
+	EngineeringChangeDocuments:       "Authorized engineering change documents",
+	CustomerEngineeringApproval:      "Customer engineering approval",
+	DesignFMEA:                       "Design FMEA",
+	ProcessFlowDiagram:               "Process flow diagram",
+	ProcessFMEA:                      "Process FMEA",
+	ControlPlan:                      "Control plan",
+	MeasurementSystemAnalysis:        "Measurement system analysis (MSA)",
+	DimensionalResults:               "Dimensional results",
+	MaterialPerformanceResults:       "Records of material / performance test results",
+	InitialProcessStudies:            "Initial process studies",
+	QualifiedLaboratoryDocumentation: "Qualified laboratory documentation",
+	AppearanceApprovalReport:         "Appearance approval report (AAR)",
+	SampleProduct:                    "Sample production parts",
+	MasterSample:                     "Master sample",
+	CheckingAids:                     "Checking aids",
+	CustomerSpecificRequirements:     "Customer-specific requirements",
+	PartSubmissionWarrant:            "Part submission warrant (PSW)",
+}
+
+// Shorthands of the requirement table
+const (
+	sub = Submit
+	ret = Retain
+	cus = CustomerDefined
+)
+
+// requirements is the retention/submission table of the PPAP manual by
+// element and level 1 to 5
+var requirements = [...][6]string{
+	DesignRecords:                    {1: ret, sub, sub, cus, ret},
+	EngineeringChangeDocuments:       {1: ret, sub, sub, cus, ret},
+	CustomerEngineeringApproval:      {1: ret, ret, sub, cus, ret},
+	DesignFMEA:                       {1: ret, ret, sub, cus, ret},
+	ProcessFlowDiagram:               {1: ret, ret, sub, cus, ret},
+	ProcessFMEA:                      {1: ret, ret, sub, cus, ret},
+	ControlPlan:                      {1: ret, ret, sub, cus, ret},
+	MeasurementSystemAnalysis:        {1: ret, ret, sub, cus, ret},
+	DimensionalResults:               {1: ret, sub, sub, cus, ret},
+	MaterialPerformanceResults:       {1: ret, sub, sub, cus, ret},
+	InitialProcessStudies:            {1: ret, ret, sub, cus, ret},
+	QualifiedLaboratoryDocumentation: {1: ret, sub, sub, cus, ret},
+	AppearanceApprovalReport:         {1: sub, sub, sub, cus, ret},
+	SampleProduct:                    {1: ret, sub, sub, cus, ret},
+	MasterSample:                     {1: ret, ret, ret, cus, ret},
+	CheckingAids:                     {1: ret, ret, ret, cus, ret},
+	CustomerSpecificRequirements:     {1: ret, ret, sub, cus, ret},
+	PartSubmissionWarrant:            {1: sub, sub, sub, sub, ret},
+}
+
+// Item is an element on the checklist of a submission
+type Item struct {
+	Element     int    `json:"element"`
+	Name        string `json:"name"`
+	Requirement string `json:"requirement"` // submit, retain, customer
+}
+
+// Requirement returns whether an element is submitted or retained at a
+// level
+func Requirement(level, element int) (string, error) {
+	if level < Level1 || level > Level5 {
+		return "", ErrInvalidLevel
+	}
+	if element < 1 || element > ElementCount {
+		return "", fmt.Errorf("PPAP element must be between 1 and %d", ElementCount)
+	}
+	return requirements[element][level], nil
+}
+
+// Checklist returns the elements of a submission at a level in order
+func Checklist(level int) ([]Item, error) {
+	if level < Level1 || level > Level5 {
+		return nil, ErrInvalidLevel
+	}
+	items := make([]Item, 0, ElementCount)
+	for element := 1; element <= ElementCount; element++ {
+		items = append(items, Item{
+			Element:     element,
+			Name:        ElementNames[element],
+			Requirement: requirements[element][level],
+		})
+	}
+	return items, nil
+}
+
+// Waivable reports whether an element can be marked not applicable, e.g.
+// the design FMEA for a supplier that is not design responsible or the
+// appearance approval report for parts without appearance requirements.
+// The warrant is always required.
+func Waivable(element int) bool {
+	return element != PartSubmissionWarrant
+}
+
+// Status is the completion of an element of a submission
+type Status struct {
+	Element       int
+	Complete      bool // a current document is on file
+	NotApplicable bool
+}
+
+// Outstanding returns the elements that keep a submission from being
+// submitted: all records must be complete before the warrant is signed,
+// whether they are submitted or retained.
+func Outstanding(statuses []Status) []int {
+	seen := make(map[int]Status, len(statuses))
+	for _, st := range statuses {
+		seen[st.Element] = st
+	}
+	var outstanding []int
+	for element := 1; element <= ElementCount; element++ {
+		st := seen[element]
+		if st.Complete || (st.NotApplicable && Waivable(element)) {
+			continue
+		}
+		outstanding = append(outstanding, element)
+	}
+	return outstanding
+}
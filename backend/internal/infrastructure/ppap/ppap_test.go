@@ -0,0 +1,72 @@
+package ppap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequirement(t *testing.T) {
+	cases := []struct {
+		level, element int
+		want           string
+	}{
+		{Level1, PartSubmissionWarrant, Submit},
+		{Level1, AppearanceApprovalReport, Submit},
+		{Level1, DimensionalResults, Retain},
+		{Level2, DimensionalResults, Submit},
+		{Level2, ControlPlan, Retain},
+		{Level3, ControlPlan, Submit},
+		{Level3, MasterSample, Retain},
+		{Level4, ProcessFMEA, CustomerDefined},
+		{Level4, PartSubmissionWarrant, Submit},
+		{Level5, PartSubmissionWarrant, Retain},
+	}
+	for _, tc := range cases {
+		got, err := Requirement(tc.level, tc.element)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, got, "level %d element %d", tc.level, tc.element)
+	}
+
+	_, err := Requirement(6, DesignRecords)
+	assert.ErrorIs(t, err, ErrInvalidLevel)
+	_, err = Requirement(Level3, 19)
+	assert.Error(t, err)
+}
+
+func TestChecklist(t *testing.T) {
+	items, err := Checklist(Level3)
+	require.NoError(t, err)
+	require.Len(t, items, ElementCount)
+	assert.Equal(t, DesignRecords, items[0].Element)
+	assert.Equal(t, "Part submission warrant (PSW)", items[ElementCount-1].Name)
+
+	submitted := 0
+	for _, item := range items {
+		assert.NotEmpty(t, item.Name)
+		if item.Requirement == Submit {
+			submitted++
+		}
+	}
+	assert.Equal(t, 16, submitted, "level 3 submits all but master sample and checking aids")
+
+	_, err = Checklist(0)
+	assert.ErrorIs(t, err, ErrInvalidLevel)
+}
+
+func TestOutstanding(t *testing.T) {
+	var statuses []Status
+	for element := 1; element <= ElementCount; element++ {
+		statuses = append(statuses, Status{Element: element, Complete: true})
+	}
+	assert.Empty(t, Outstanding(statuses))
+
+	statuses[DesignFMEA-1] = Status{Element: DesignFMEA, NotApplicable: true}
+	statuses[ControlPlan-1] = Status{Element: ControlPlan}
+	statuses[PartSubmissionWarrant-1] = Status{Element: PartSubmissionWarrant, NotApplicable: true}
+	assert.Equal(t, []int{ControlPlan, PartSubmissionWarrant}, Outstanding(statuses),
+		"the warrant cannot be waived")
+
+	assert.Len(t, Outstanding(nil), ElementCount)
+}
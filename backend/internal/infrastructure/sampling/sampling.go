@@ -0,0 +1,413 @@
+// Package sampling implements single sampling plans for inspection by
+// attributes after ISO 2859-1 (ANSI/ASQ Z1.4): the sample size code letter
+// of a lot, the sample size and acceptance/rejection numbers for an AQL
+// under normal, tightened and reduced inspection, and the switching rules
+// between those severities.
+package sampling
+
+import (
+	"errors"
+	"math"
+)
+
+// Inspection levels; II is the default general level
+const (
+	LevelS1  = "S-1"
+	LevelS2  = "S-2"
+	LevelS3  = "S-3"
+	LevelS4  = "S-4"
+	LevelI   = "I"
+	LevelII  = "II"
+	LevelIII = "III"
+)
+
+// Inspection severities. Discontinued is not a severity of the standard
+// but the state in which acceptance inspection is suspended.
+const (
+	Normal       = "normal"
+	Tightened    = "tightened"
+	Reduced      = "reduced"
+	Discontinued = "discontinued"
+)
+
+// Switching thresholds of ISO 2859-1 clause 9
+const (
+	// NormalWindow lots on normal inspection of which TightenAfter not
+	// accepted switch to tightened inspection
+	NormalWindow = 5
+	TightenAfter = 2
+	// RelaxAfter consecutive lots accepted on tightened inspection return
+	// to normal inspection
+	RelaxAfter = 5
+	// DiscontinueAfter lots not accepted while on tightened inspection
+	// discontinue acceptance inspection
+	DiscontinueAfter = 5
+	// ReduceScore is the switching score from which reduced inspection may
+	// be approved
+	ReduceScore = 30
+)
+
+var (
+	// ErrInvalidLevel is returned for an unknown inspection level
+	ErrInvalidLevel = errors.New("unknown inspection level")
+	// ErrInvalidAQL is returned for an AQL that is not a preferred value
+	ErrInvalidAQL = errors.New("AQL must be one of the preferred values of ISO 2859-1")
+	// ErrInvalidLot is returned for a lot size below 2
+	ErrInvalidLot = errors.New("lot size must be at least 2")
+	// ErrInvalidSeverity is returned for a severity without sampling plans
+	ErrInvalidSeverity = errors.New("unknown inspection severity")
+)
+
+// AQLs are the preferred acceptance quality limits, in percent nonconforming
+// up to 10 and nonconformities per hundred units above
+var AQLs = []float64{
+	0.010, 0.015, 0.025, 0.040, 0.065, 0.10, 0.15, 0.25, 0.40, 0.65,
+	1.0, 1.5, 2.5, 4.0, 6.5, 10, 15, 25, 40, 65,
+	100, 150, 250, 400, 650, 1000,
+}
+
+var letters = []string{"A", "B", "C", "D", "E", "F", "G", "H", "J", "K", "L", "M", "N", "P", "Q", "R"}
+
+// sampleSizes of each code letter under normal and tightened inspection
+var sampleSizes = []int{2, 3, 5, 8, 13, 20, 32, 50, 80, 125, 200, 315, 500, 800, 1250, 2000}
+
+// lotLimits are the upper lot sizes of the rows of Table 1
+var lotLimits = []int{8, 15, 25, 50, 90, 150, 280, 500, 1200, 3200, 10000, 35000, 150000, 500000, math.MaxInt}
+
+var levelColumns = map[string]int{LevelS1: 0, LevelS2: 1, LevelS3: 2, LevelS4: 3, LevelI: 4, LevelII: 5, LevelIII: 6}
+
+// codeLetters is Table 1: sample size code letter by lot size and level
+var codeLetters = [][7]string{
+	{"A", "A", "A", "A", "A", "A", "B"},
+	{"A", "A", "A", "A", "A", "B", "C"},
+	{"A", "A", "B", "B", "B", "C", "D"},
+	{"A", "B", "B", "C", "C", "D", "E"},
+	{"B", "B", "C", "C", "C", "E", "F"},
+	{"B", "B", "C", "D", "D", "F", "G"},
+	{"B", "C", "D", "E", "E", "G", "H"},
+	{"B", "C", "D", "E", "F", "H", "J"},
+	{"C", "C", "E", "F", "G", "J", "K"},
+	{"C", "D", "E", "G", "H", "K", "L"},
+	{"C", "D", "F", "G", "J", "L", "M"},
+	{"C", "D", "F", "H", "K", "M", "N"},
+	{"D", "E", "G", "J", "L", "N", "P"},
+	{"D", "E", "G", "J", "M", "P", "Q"},
+	{"D", "E", "H", "K", "N", "Q", "R"},
+}
+
+// Cells of the master tables are laid out on diagonals: moving one code
+// letter down and one AQL to the left keeps the plan. A diagonal is either
+// an Ac/Re pair or an arrow to the first plan below or above.
+const (
+	arrowDown = -1
+	arrowUp   = -2
+)
+
+// normalDiagonals and tightenedDiagonals give the acceptance number on the
+// diagonal letter index + AQL index, starting at the first diagonal with a
+// plan; Re is always Ac + 1 for single sampling
+var (
+	normalFirst        = 14
+	normalDiagonals    = []int{0, arrowUp, arrowDown, 1, 2, 3, 5, 7, 10, 14, 21, 30, 44}
+	tightenedFirst     = 16
+	tightenedDiagonals = []int{0, arrowDown, 1, 2, 3, 5, 8, 12, 18, 27, 41}
+)
+
+// largeAcceptance is the acceptance number from which plans only exist for
+// AQLs in nonconformities per hundred units, i.e. above 10
+var largeAcceptance = map[string]int{Normal: 30, Tightened: 27}
+
+// Plan is a single sampling plan: inspect SampleSize units, accept the lot
+// with at most Ac nonconforming units and reject it from Re
+type Plan struct {
+	CodeLetter     string  `json:"code_letter"`
+	Severity       string  `json:"severity"`
+	AQL            float64 `json:"aql"`
+	SampleSize     int     `json:"sample_size"`
+	Ac             int     `json:"ac"`
+	Re             int     `json:"re"`
+	FullInspection bool    `json:"full_inspection"` // the sample covers the whole lot
+}
+
+// Accepts reports whether a sample with the given nonconforming count
+// accepts the lot
+func (p Plan) Accepts(defects int) bool {
+	return defects <= p.Ac
+}
+
+// ValidLevel reports whether level is a known inspection level
+func ValidLevel(level string) bool {
+	_, ok := levelColumns[level]
+	return ok
+}
+
+// ValidAQL reports whether aql is a preferred AQL; zero stands for zero
+// acceptance and is valid as well
+func ValidAQL(aql float64) bool {
+	return aql == 0 || aqlIndex(aql) >= 0
+}
+
+// TighterAQL returns the preferred AQL one step below aql
+func TighterAQL(aql float64) (float64, bool) {
+	i := aqlIndex(aql)
+	if i <= 0 {
+		return 0, false
+	}
+	return AQLs[i-1], true
+}
+
+// CodeLetter returns the sample size code letter of a lot
+func CodeLetter(lotSize int, level string) (string, error) {
+	column, ok := levelColumns[level]
+	if !ok {
+		return "", ErrInvalidLevel
+	}
+	if lotSize < 2 {
+		return "", ErrInvalidLot
+	}
+	for row, limit := range lotLimits {
+		if lotSize <= limit {
+			return codeLetters[row][column], nil
+		}
+	}
+	return codeLetters[len(codeLetters)-1][column], nil
+}
+
+// Single returns the single sampling plan of a lot at an AQL and severity.
+// An AQL of zero means zero acceptance at the sample size of the code
+// letter. When the sample size reaches the lot size every unit is
+// inspected.
+func Single(lotSize int, level string, aql float64, severity string) (Plan, error) {
+	letter, err := CodeLetter(lotSize, level)
+	if err != nil {
+		return Plan{}, err
+	}
+	plan, err := Lookup(letter, aql, severity)
+	if err != nil {
+		return Plan{}, err
+	}
+	if plan.SampleSize >= lotSize {
+		plan.SampleSize = lotSize
+		plan.FullInspection = true
+	}
+	return plan, nil
+}
+
+// Lookup returns the plan of the master table of a severity for a code
+// letter and AQL, following the arrows to the first plan below or above
+func Lookup(letter string, aql float64, severity string) (Plan, error) {
+	row := letterIndex(letter)
+	if row < 0 {
+		return Plan{}, errors.New("unknown sample size code letter")
+	}
+
+	// Reduced plans are the normal plans two code letters up, which have
+	// the reduced sample sizes
+	start := row
+	switch severity {
+	case Normal, Tightened:
+	case Reduced:
+		start = row - 2
+		if start < 0 {
+			start = 0
+		}
+	default:
+		return Plan{}, ErrInvalidSeverity
+	}
+
+	if aql == 0 {
+		size := sampleSizes[start]
+		return Plan{CodeLetter: letter, Severity: severity, SampleSize: size, Ac: 0, Re: 1}, nil
+	}
+	column := aqlIndex(aql)
+	if column < 0 {
+		return Plan{}, ErrInvalidAQL
+	}
+
+	table := severity
+	if table == Reduced {
+		table = Normal
+	}
+	found, ac := resolve(start, column, table)
+	plan := Plan{CodeLetter: letters[found], Severity: severity, AQL: aql, SampleSize: sampleSizes[found], Ac: ac, Re: ac + 1}
+	if severity == Reduced {
+		plan.CodeLetter = letter
+		if found != start {
+			plan.CodeLetter = letters[min(found+2, len(letters)-1)]
+		}
+	}
+	return plan, nil
+}
+
+// resolve walks a column from a row along the arrows; an arrow leading out
+// of the table is followed the other way
+func resolve(row, column int, table string) (int, int) {
+	direction := 0
+	for steps := 0; steps < 2*len(letters); steps++ {
+		cell := cellAt(row, column, table)
+		if cell >= 0 {
+			return row, cell
+		}
+		if direction == 0 {
+			direction = 1
+			if cell == arrowUp {
+				direction = -1
+			}
+		}
+		next := row + direction
+		if next < 0 || next >= len(letters) {
+			direction = -direction
+			next = row + direction
+		}
+		row = next
+	}
+	return row, 0
+}
+
+func cellAt(row, column int, table string) int {
+	first, diagonals := normalFirst, normalDiagonals
+	if table == Tightened {
+		first, diagonals = tightenedFirst, tightenedDiagonals
+	}
+	d := row + column - first
+	switch {
+	case d < 0:
+		return arrowDown
+	case d >= len(diagonals):
+		return arrowUp
+	}
+	ac := diagonals[d]
+	if ac >= largeAcceptance[table] && AQLs[column] <= 10 {
+		return arrowUp
+	}
+	return ac
+}
+
+func letterIndex(letter string) int {
+	for i, l := range letters {
+		if l == letter {
+			return i
+		}
+	}
+	return -1
+}
+
+func aqlIndex(aql float64) int {
+	for i, a := range AQLs {
+		if math.Abs(a-aql) < 1e-9 {
+			return i
+		}
+	}
+	return -1
+}
+
+// Lot is the outcome of one lot for the switching rules
+type Lot struct {
+	Accepted bool
+	// Ac is the largest acceptance number of the plans the lot was
+	// inspected with
+	Ac int
+	// TighterAccepted reports whether the lot would also have been accepted
+	// with the AQL one step tighter; it only counts when Ac is 2 or more
+	TighterAccepted bool
+}
+
+// State is where a supplier or product stands in the switching rules
+type State struct {
+	Severity string `json:"severity"`
+	// Score is the switching score towards reduced inspection
+	Score int `json:"score"`
+	// Recent holds the outcomes of the last lots on normal inspection,
+	// oldest first
+	Recent []bool `json:"recent"`
+	// Accepted counts consecutive lots accepted on tightened inspection
+	Accepted int `json:"accepted"`
+	// Rejected counts lots not accepted since tightened inspection started
+	Rejected int `json:"rejected"`
+}
+
+// ReducedEligible reports whether the switching score allows reduced
+// inspection; the switch itself needs steady production and the approval
+// of the responsible authority
+func (s State) ReducedEligible() bool {
+	return s.Severity == Normal && s.Score >= ReduceScore
+}
+
+// Record applies the switching rules to the outcome of a lot and returns
+// the reason when the severity changed
+func (s *State) Record(lot Lot) string {
+	switch s.Severity {
+	case Tightened:
+		if lot.Accepted {
+			s.Accepted++
+			if s.Accepted >= RelaxAfter {
+				s.reset(Normal)
+				return "5 consecutive lots accepted on tightened inspection"
+			}
+			return ""
+		}
+		s.Accepted = 0
+		s.Rejected++
+		if s.Rejected >= DiscontinueAfter {
+			s.reset(Discontinued)
+			return "5 lots not accepted on tightened inspection"
+		}
+		return ""
+
+	case Reduced:
+		if !lot.Accepted {
+			s.reset(Normal)
+			return "lot not accepted on reduced inspection"
+		}
+		return ""
+
+	case Discontinued:
+		return ""
+	}
+
+	s.Severity = Normal
+	s.Recent = append(s.Recent, lot.Accepted)
+	if len(s.Recent) > NormalWindow {
+		s.Recent = s.Recent[len(s.Recent)-NormalWindow:]
+	}
+	rejected := 0
+	for _, accepted := range s.Recent {
+		if !accepted {
+			rejected++
+		}
+	}
+	if rejected >= TightenAfter {
+		s.reset(Tightened)
+		return "2 of 5 or fewer consecutive lots not accepted on normal inspection"
+	}
+
+	switch {
+	case lot.Ac >= 2 && lot.Accepted && lot.TighterAccepted:
+		s.Score += 3
+	case lot.Ac < 2 && lot.Accepted:
+		s.Score += 2
+	default:
+		s.Score = 0
+	}
+	return ""
+}
+
+// Switch moves to a severity by decision of the responsible authority:
+// reduced inspection once the switching score allows it, back to normal
+// from reduced at any time, and tightened inspection again after
+// discontinuation once corrective action has been taken
+func (s *State) Switch(severity string) error {
+	switch {
+	case severity == Reduced && s.ReducedEligible():
+	case severity == Normal && s.Severity == Reduced:
+	case severity == Tightened && s.Severity == Discontinued:
+	default:
+		return errors.New("switch from " + s.Severity + " to " + severity + " inspection is not allowed")
+	}
+	s.reset(severity)
+	return nil
+}
+
+func (s *State) reset(severity string) {
+	*s = State{Severity: severity}
+}
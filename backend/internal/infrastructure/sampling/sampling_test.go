@@ -0,0 +1,179 @@
+package sampling
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodeLetter(t *testing.T) {
+	cases := []struct {
+		lot    int
+		level  string
+		letter string
+	}{
+		{9, LevelII, "B"},
+		{500, LevelII, "H"},
+		{501, LevelII, "J"},
+		{5000, LevelII, "L"},
+		{1000, LevelS3, "E"},
+		{600000, LevelIII, "R"},
+		{2, LevelS1, "A"},
+	}
+	for _, c := range cases {
+		letter, err := CodeLetter(c.lot, c.level)
+		require.NoError(t, err)
+		assert.Equal(t, c.letter, letter, "%d %s", c.lot, c.level)
+	}
+
+	_, err := CodeLetter(1, LevelII)
+	assert.ErrorIs(t, err, ErrInvalidLot)
+	_, err = CodeLetter(100, "IV")
+	assert.ErrorIs(t, err, ErrInvalidLevel)
+}
+
+func TestLookupNormal(t *testing.T) {
+	cases := []struct {
+		letter       string
+		aql          float64
+		found        string
+		size, ac, re int
+	}{
+		{"H", 1.0, "H", 50, 1, 2},
+		{"H", 2.5, "H", 50, 3, 4},
+		{"H", 0.65, "J", 80, 1, 2},  // arrow down
+		{"J", 0.25, "H", 50, 0, 1},  // arrow up
+		{"J", 0.40, "K", 125, 1, 2}, // arrow down past the gap
+		{"L", 2.5, "L", 200, 10, 11},
+		{"L", 6.5, "L", 200, 21, 22},
+		{"L", 10, "K", 125, 21, 22}, // no Ac 30 at AQL 10
+		{"A", 1000, "A", 2, 30, 31},
+		{"N", 0.65, "N", 500, 7, 8},
+		{"R", 0.010, "Q", 1250, 0, 1},
+	}
+	for _, c := range cases {
+		plan, err := Lookup(c.letter, c.aql, Normal)
+		require.NoError(t, err)
+		assert.Equal(t, Plan{CodeLetter: c.found, Severity: Normal, AQL: c.aql, SampleSize: c.size, Ac: c.ac, Re: c.re}, plan, "%s %v", c.letter, c.aql)
+	}
+
+	_, err := Lookup("H", 0.3, Normal)
+	assert.ErrorIs(t, err, ErrInvalidAQL)
+	_, err = Lookup("H", 1.0, Discontinued)
+	assert.ErrorIs(t, err, ErrInvalidSeverity)
+}
+
+func TestLookupTightenedAndReduced(t *testing.T) {
+	plan, err := Lookup("K", 1.0, Tightened)
+	require.NoError(t, err)
+	assert.Equal(t, 125, plan.SampleSize)
+	assert.Equal(t, 2, plan.Ac)
+	assert.Equal(t, 3, plan.Re)
+
+	plan, err = Lookup("K", 4.0, Tightened)
+	require.NoError(t, err)
+	assert.Equal(t, 8, plan.Ac)
+
+	// Reduced L has the sample size and plan of normal J
+	plan, err = Lookup("L", 1.0, Reduced)
+	require.NoError(t, err)
+	assert.Equal(t, "L", plan.CodeLetter)
+	assert.Equal(t, 80, plan.SampleSize)
+	assert.Equal(t, 2, plan.Ac)
+
+	plan, err = Lookup("B", 6.5, Reduced)
+	require.NoError(t, err)
+	assert.Equal(t, 2, plan.SampleSize)
+	assert.Equal(t, 0, plan.Ac)
+
+	// Zero acceptance
+	plan, err = Lookup("H", 0, Normal)
+	require.NoError(t, err)
+	assert.Equal(t, Plan{CodeLetter: "H", Severity: Normal, SampleSize: 50, Ac: 0, Re: 1}, plan)
+}
+
+func TestSingle(t *testing.T) {
+	plan, err := Single(500, LevelII, 1.0, Normal)
+	require.NoError(t, err)
+	assert.Equal(t, 50, plan.SampleSize)
+	assert.False(t, plan.FullInspection)
+	assert.True(t, plan.Accepts(1))
+	assert.False(t, plan.Accepts(2))
+
+	// The arrow leads to a sample larger than the lot
+	plan, err = Single(5, LevelII, 0.65, Normal)
+	require.NoError(t, err)
+	assert.Equal(t, 5, plan.SampleSize)
+	assert.True(t, plan.FullInspection)
+	assert.Equal(t, 0, plan.Ac)
+}
+
+func TestTighterAQL(t *testing.T) {
+	aql, ok := TighterAQL(1.0)
+	assert.True(t, ok)
+	assert.Equal(t, 0.65, aql)
+	_, ok = TighterAQL(0.010)
+	assert.False(t, ok)
+	assert.True(t, ValidAQL(0))
+	assert.False(t, ValidAQL(0.3))
+}
+
+func TestSwitching(t *testing.T) {
+	state := State{Severity: Normal}
+
+	// Accepted lots with Ac 0 or 1 add 2, with Ac 2 or more 3 when the lot
+	// also passes one AQL step tighter
+	assert.Empty(t, state.Record(Lot{Accepted: true, Ac: 1}))
+	assert.Equal(t, 2, state.Score)
+	assert.Empty(t, state.Record(Lot{Accepted: true, Ac: 3, TighterAccepted: true}))
+	assert.Equal(t, 5, state.Score)
+	assert.Empty(t, state.Record(Lot{Accepted: true, Ac: 3}))
+	assert.Equal(t, 0, state.Score)
+
+	// One rejection in five keeps normal inspection, two switch to tightened
+	assert.Empty(t, state.Record(Lot{Accepted: false, Ac: 1}))
+	assert.Equal(t, Normal, state.Severity)
+	assert.Empty(t, state.Record(Lot{Accepted: true, Ac: 1}))
+	assert.NotEmpty(t, state.Record(Lot{Accepted: false, Ac: 1}))
+	assert.Equal(t, Tightened, state.Severity)
+
+	// Five consecutive acceptances return to normal
+	for i := 0; i < 4; i++ {
+		assert.Empty(t, state.Record(Lot{Accepted: true}))
+	}
+	assert.NotEmpty(t, state.Record(Lot{Accepted: true}))
+	assert.Equal(t, State{Severity: Normal}, state)
+
+	// A rejection more than five lots back no longer counts
+	state.Record(Lot{Accepted: false})
+	for i := 0; i < 4; i++ {
+		state.Record(Lot{Accepted: true})
+	}
+	state.Record(Lot{Accepted: false})
+	assert.Equal(t, Normal, state.Severity)
+
+	// Five rejections on tightened discontinue inspection
+	state = State{Severity: Tightened}
+	for i := 0; i < 4; i++ {
+		assert.Empty(t, state.Record(Lot{Accepted: false}))
+		assert.Empty(t, state.Record(Lot{Accepted: true}))
+	}
+	assert.NotEmpty(t, state.Record(Lot{Accepted: false}))
+	assert.Equal(t, Discontinued, state.Severity)
+	assert.Error(t, state.Switch(Normal))
+	require.NoError(t, state.Switch(Tightened))
+	assert.Equal(t, Tightened, state.Severity)
+
+	// Reduced inspection needs the switching score and ends on a rejection
+	state = State{Severity: Normal}
+	assert.Error(t, state.Switch(Reduced))
+	for i := 0; i < 15; i++ {
+		state.Record(Lot{Accepted: true, Ac: 1})
+	}
+	assert.True(t, state.ReducedEligible())
+	require.NoError(t, state.Switch(Reduced))
+	assert.Empty(t, state.Record(Lot{Accepted: true}))
+	assert.NotEmpty(t, state.Record(Lot{Accepted: false}))
+	assert.Equal(t, Normal, state.Severity)
+}
@@ -0,0 +1,31 @@
+// Package schedule decides when a periodic background job is due.
+//
+// The last run of each job is stored, so a restarted server neither waits a
+// full interval before the first run nor repeats a run it has just made.
+package schedule
+
+import "time"
+
+// Wait returns how long to wait before the next run of a job that runs every
+// interval and last ran at last, nil if it never ran. A job that never ran
+// or is overdue runs right away.
+func Wait(last *time.Time, interval time.Duration, now time.Time) time.Duration {
+	if last == nil {
+		return 0
+	}
+	wait := last.Add(interval).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	if wait > interval {
+		// The clock went back; do not wait longer than one interval
+		return interval
+	}
+	return wait
+}
+
+// DueBefore is the latest last run at which a job running every interval is
+// due at now
+func DueBefore(interval time.Duration, now time.Time) time.Time {
+	return now.Add(-interval)
+}
@@ -0,0 +1,41 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWait(t *testing.T) {
+	now := time.Date(2026, time.October, 19, 8, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name string
+		last *time.Time
+		want time.Duration
+	}{
+		{"never ran", nil, 0},
+		{"ran an hour ago", at(-time.Hour), 23 * time.Hour},
+		{"due now", at(-24 * time.Hour), 0},
+		{"overdue after downtime", at(-72 * time.Hour), 0},
+		{"last run in the future", at(6 * time.Hour), 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Wait(tt.last, 24*time.Hour, now))
+		})
+	}
+}
+
+func TestDueBefore(t *testing.T) {
+	now := time.Date(2026, time.October, 19, 8, 0, 0, 0, time.UTC)
+	last := now.Add(-24 * time.Hour)
+
+	assert.False(t, last.After(DueBefore(24*time.Hour, now)), "due exactly one interval after the last run")
+	assert.True(t, last.Add(time.Second).After(DueBefore(24*time.Hour, now)))
+}
@@ -0,0 +1,300 @@
+// Package scorecard scores supplier performance over a period from measured
+// metrics: on-time delivery, incoming quality in defective parts per
+// million, price variance against list prices and the time taken to
+// confirm purchase orders. Factor scores of 0 to 100 are combined with
+// configurable weights, and a risk level is assessed with the factors
+// that contribute to it.
+package scorecard
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Factors
+const (
+	FactorDelivery = "delivery"
+	FactorQuality  = "quality"
+	FactorPrice    = "price"
+	FactorResponse = "response"
+)
+
+// Risk levels
+const (
+	RiskLow      = "low"
+	RiskMedium   = "medium"
+	RiskHigh     = "high"
+	RiskCritical = "critical"
+)
+
+// ErrInvalidConfig is returned for negative weights or limits, weights
+// that sum to zero or a response limit below the target
+var ErrInvalidConfig = errors.New("invalid scorecard configuration")
+
+// Weights are the relative weights of the factors in the overall score;
+// they need not sum to 1
+type Weights struct {
+	Delivery float64 `json:"delivery"`
+	Quality  float64 `json:"quality"`
+	Price    float64 `json:"price"`
+	Response float64 `json:"response"`
+}
+
+// Config sets the weights and the limits factor scores are scaled against
+type Config struct {
+	Weights Weights `json:"weights"`
+	// LateToleranceDays are days after the promised date a receipt still
+	// counts as on time
+	LateToleranceDays int `json:"late_tolerance_days"`
+	// PPMLimit is the defect rate that scores 0; 0 ppm scores 100
+	PPMLimit float64 `json:"ppm_limit"`
+	// PriceVarianceLimit is the percentage paid over list price that
+	// scores 0; paying list price or less scores 100
+	PriceVarianceLimit float64 `json:"price_variance_limit"`
+	// ResponseTargetHours is the confirmation time that still scores 100
+	// and ResponseLimitHours the one that scores 0
+	ResponseTargetHours float64 `json:"response_target_hours"`
+	ResponseLimitHours  float64 `json:"response_limit_hours"`
+}
+
+// DefaultConfig weighs delivery and quality most
+func DefaultConfig() Config {
+	return Config{
+		Weights:             Weights{Delivery: 35, Quality: 35, Price: 15, Response: 15},
+		LateToleranceDays:   0,
+		PPMLimit:            10000,
+		PriceVarianceLimit:  10,
+		ResponseTargetHours: 24,
+		ResponseLimitHours:  168,
+	}
+}
+
+// Validate checks the weights and limits
+func (c Config) Validate() error {
+	w := c.Weights
+	if w.Delivery < 0 || w.Quality < 0 || w.Price < 0 || w.Response < 0 {
+		return fmt.Errorf("%w: weights must not be negative", ErrInvalidConfig)
+	}
+	if w.Delivery+w.Quality+w.Price+w.Response == 0 {
+		return fmt.Errorf("%w: at least one weight must be positive", ErrInvalidConfig)
+	}
+	if c.LateToleranceDays < 0 {
+		return fmt.Errorf("%w: late tolerance must not be negative", ErrInvalidConfig)
+	}
+	if c.PPMLimit <= 0 || c.PriceVarianceLimit <= 0 {
+		return fmt.Errorf("%w: PPM and price variance limits must be positive", ErrInvalidConfig)
+	}
+	if c.ResponseTargetHours < 0 || c.ResponseLimitHours <= c.ResponseTargetHours {
+		return fmt.Errorf("%w: response limit must exceed the response target", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Metrics are what a supplier did in a period
+type Metrics struct {
+	Deliveries        int     `json:"deliveries"`
+	OnTimeDeliveries  int     `json:"on_time_deliveries"`
+	InspectedQuantity float64 `json:"inspected_quantity"`
+	DefectQuantity    float64 `json:"defect_quantity"`
+	ListValue         float64 `json:"list_value"` // ordered quantities at list price
+	PaidValue         float64 `json:"paid_value"` // ordered quantities at order price
+	Responses         int     `json:"responses"`
+	ResponseHours     float64 `json:"response_hours"` // total over the responses
+}
+
+// OnTimeRate returns the percentage of deliveries on time
+func (m Metrics) OnTimeRate() (float64, bool) {
+	if m.Deliveries == 0 {
+		return 0, false
+	}
+	return float64(m.OnTimeDeliveries) / float64(m.Deliveries) * 100, true
+}
+
+// PPM returns the defective parts per million inspected
+func (m Metrics) PPM() (float64, bool) {
+	if m.InspectedQuantity <= 0 {
+		return 0, false
+	}
+	return m.DefectQuantity / m.InspectedQuantity * 1e6, true
+}
+
+// PriceVariance returns the percentage paid over list price, negative when
+// paid under it
+func (m Metrics) PriceVariance() (float64, bool) {
+	if m.ListValue <= 0 {
+		return 0, false
+	}
+	return (m.PaidValue - m.ListValue) / m.ListValue * 100, true
+}
+
+// AverageResponseHours returns the mean time to confirm an order
+func (m Metrics) AverageResponseHours() (float64, bool) {
+	if m.Responses == 0 {
+		return 0, false
+	}
+	return m.ResponseHours / float64(m.Responses), true
+}
+
+// Scores are the factor scores of a period, nil for factors without data
+type Scores struct {
+	Delivery *float64 `json:"delivery"`
+	Quality  *float64 `json:"quality"`
+	Price    *float64 `json:"price"`
+	Response *float64 `json:"response"`
+	Overall  *float64 `json:"overall"`
+}
+
+// Score scores the metrics of a period. The overall score is the weighted
+// mean of the factors with data; it is nil when none has data.
+func Score(m Metrics, c Config) Scores {
+	var s Scores
+	if rate, ok := m.OnTimeRate(); ok {
+		s.Delivery = score(rate)
+	}
+	if ppm, ok := m.PPM(); ok {
+		s.Quality = score(100 * (1 - ppm/c.PPMLimit))
+	}
+	if variance, ok := m.PriceVariance(); ok {
+		s.Price = score(100 * (1 - math.Max(0, variance)/c.PriceVarianceLimit))
+	}
+	if hours, ok := m.AverageResponseHours(); ok {
+		over := math.Max(0, hours-c.ResponseTargetHours)
+		s.Response = score(100 * (1 - over/(c.ResponseLimitHours-c.ResponseTargetHours)))
+	}
+
+	var total, weights float64
+	for _, f := range []struct {
+		score  *float64
+		weight float64
+	}{
+		{s.Delivery, c.Weights.Delivery},
+		{s.Quality, c.Weights.Quality},
+		{s.Price, c.Weights.Price},
+		{s.Response, c.Weights.Response},
+	} {
+		if f.score != nil && f.weight > 0 {
+			total += *f.score * f.weight
+			weights += f.weight
+		}
+	}
+	if weights > 0 {
+		s.Overall = round(total / weights)
+	}
+	return s
+}
+
+// Profile is what is known about a supplier besides its performance
+type Profile struct {
+	FinancialHealth string // excellent, good, fair, poor
+	CreditRating    string // AAA to D
+	Certified       bool   // holds ISO 9001, ISO 14001 or IATF 16949
+	CertExpired     bool
+}
+
+// Factor is a contribution to the risk of a supplier
+type Factor struct {
+	Factor string `json:"factor"`
+	Points int    `json:"points"`
+	Detail string `json:"detail"`
+}
+
+// Risk is the assessed risk of a supplier with the factors contributing
+type Risk struct {
+	Level   string   `json:"level"`
+	Points  int      `json:"points"`
+	Factors []Factor `json:"factors"`
+}
+
+// Explain returns the contributing factors as a sentence
+func (r Risk) Explain() string {
+	level := strings.ToUpper(r.Level[:1]) + r.Level[1:]
+	if len(r.Factors) == 0 {
+		return level + " risk: no contributing factors"
+	}
+	details := make([]string, 0, len(r.Factors))
+	for _, f := range r.Factors {
+		details = append(details, fmt.Sprintf("%s (+%d)", f.Detail, f.Points))
+	}
+	return fmt.Sprintf("%s risk (%d points): %s", level, r.Points, strings.Join(details, "; "))
+}
+
+// Assess assesses the risk of a supplier from its scores, the overall
+// score of the period before (nil if none) and its profile. Performance
+// weighs most; a falling overall score, weak finances, a poor credit
+// rating and missing certification add to it.
+func Assess(current Scores, previousOverall *float64, profile Profile) Risk {
+	var r Risk
+	add := func(factor string, points int, format string, args ...interface{}) {
+		r.Factors = append(r.Factors, Factor{Factor: factor, Points: points, Detail: fmt.Sprintf(format, args...)})
+		r.Points += points
+	}
+
+	if current.Overall != nil {
+		switch overall := *current.Overall; {
+		case overall < 50:
+			add("overall", 40, "overall score %.0f is below 50", overall)
+		case overall < 70:
+			add("overall", 25, "overall score %.0f is below 70", overall)
+		case overall < 85:
+			add("overall", 10, "overall score %.0f is below 85", overall)
+		}
+		if previousOverall != nil && *previousOverall-*current.Overall >= 10 {
+			add("trend", 15, "overall score fell from %.0f to %.0f", *previousOverall, *current.Overall)
+		}
+	}
+	for _, f := range []struct {
+		factor, name string
+		score        *float64
+	}{
+		{FactorDelivery, "on-time delivery", current.Delivery},
+		{FactorQuality, "quality", current.Quality},
+		{FactorPrice, "price", current.Price},
+		{FactorResponse, "response", current.Response},
+	} {
+		if f.score != nil && *f.score < 60 {
+			add(f.factor, 10, "%s score %.0f is below 60", f.name, *f.score)
+		}
+	}
+
+	switch profile.FinancialHealth {
+	case "poor":
+		add("financial", 20, "financial health is poor")
+	case "fair":
+		add("financial", 10, "financial health is fair")
+	}
+	switch profile.CreditRating {
+	case "D", "C", "CC", "CCC":
+		add("credit", 20, "credit rating %s", profile.CreditRating)
+	case "B", "BB":
+		add("credit", 10, "credit rating %s", profile.CreditRating)
+	}
+	switch {
+	case !profile.Certified:
+		add("certification", 15, "no quality or environmental certification")
+	case profile.CertExpired:
+		add("certification", 10, "certification expired")
+	}
+
+	switch {
+	case r.Points >= 70:
+		r.Level = RiskCritical
+	case r.Points >= 50:
+		r.Level = RiskHigh
+	case r.Points >= 30:
+		r.Level = RiskMedium
+	default:
+		r.Level = RiskLow
+	}
+	return r
+}
+
+func score(v float64) *float64 {
+	return round(math.Max(0, math.Min(100, v)))
+}
+
+func round(v float64) *float64 {
+	r := math.Round(v*10) / 10
+	return &r
+}
@@ -0,0 +1,90 @@
+package scorecard
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScore(t *testing.T) {
+	c := DefaultConfig()
+	require.NoError(t, c.Validate())
+
+	s := Score(Metrics{
+		Deliveries:        20,
+		OnTimeDeliveries:  18,
+		InspectedQuantity: 200000,
+		DefectQuantity:    500, // 2500 ppm
+		ListValue:         1000,
+		PaidValue:         1050, // 5% over list
+		Responses:         2,
+		ResponseHours:     120, // 60 h average, 36 h over target
+	}, c)
+	require.NotNil(t, s.Delivery)
+	assert.Equal(t, 90.0, *s.Delivery)
+	assert.Equal(t, 75.0, *s.Quality)
+	assert.Equal(t, 50.0, *s.Price)
+	assert.Equal(t, 75.0, *s.Response)
+	// (90*35 + 75*35 + 50*15 + 75*15) / 100
+	assert.Equal(t, 76.5, *s.Overall)
+}
+
+func TestScoreWithoutData(t *testing.T) {
+	c := DefaultConfig()
+	s := Score(Metrics{}, c)
+	assert.Nil(t, s.Delivery)
+	assert.Nil(t, s.Overall)
+
+	// factors without data are left out of the weighted mean
+	s = Score(Metrics{Deliveries: 4, OnTimeDeliveries: 3, ListValue: 100, PaidValue: 90}, c)
+	assert.Nil(t, s.Quality)
+	assert.Equal(t, 100.0, *s.Price, "paying under list price scores full")
+	assert.Equal(t, 82.5, *s.Overall) // (75*35 + 100*15) / 50
+}
+
+func TestScoreClamps(t *testing.T) {
+	s := Score(Metrics{InspectedQuantity: 100, DefectQuantity: 10, Responses: 1, ResponseHours: 1000}, DefaultConfig())
+	assert.Equal(t, 0.0, *s.Quality)
+	assert.Equal(t, 0.0, *s.Response)
+}
+
+func TestValidate(t *testing.T) {
+	c := DefaultConfig()
+	c.Weights = Weights{}
+	assert.ErrorIs(t, c.Validate(), ErrInvalidConfig)
+
+	c = DefaultConfig()
+	c.Weights.Price = -1
+	assert.ErrorIs(t, c.Validate(), ErrInvalidConfig)
+
+	c = DefaultConfig()
+	c.ResponseLimitHours = c.ResponseTargetHours
+	assert.ErrorIs(t, c.Validate(), ErrInvalidConfig)
+}
+
+func TestAssess(t *testing.T) {
+	v := func(f float64) *float64 { return &f }
+
+	r := Assess(Scores{Delivery: v(95), Quality: v(92), Overall: v(93)}, v(94), Profile{Certified: true, FinancialHealth: "good"})
+	assert.Equal(t, RiskLow, r.Level)
+	assert.Empty(t, r.Factors)
+	assert.Equal(t, "Low risk: no contributing factors", r.Explain())
+
+	r = Assess(Scores{Delivery: v(40), Quality: v(80), Overall: v(62)}, v(80), Profile{Certified: true})
+	assert.Equal(t, RiskHigh, r.Level, "25 overall + 15 trend + 10 delivery")
+	assert.Equal(t, 50, r.Points)
+	require.Len(t, r.Factors, 3)
+	assert.Equal(t, "trend", r.Factors[1].Factor)
+	assert.Contains(t, r.Explain(), "overall score fell from 80 to 62 (+15)")
+
+	r = Assess(Scores{}, nil, Profile{FinancialHealth: "poor", CreditRating: "CCC", CertExpired: true})
+	assert.Equal(t, RiskHigh, r.Level, "20 financial + 20 credit + 15 no certification")
+	assert.Equal(t, 55, r.Points)
+
+	r = Assess(Scores{Overall: v(45)}, nil, Profile{FinancialHealth: "fair", Certified: true, CertExpired: true})
+	assert.Equal(t, RiskHigh, r.Level, "40 overall + 10 financial + 10 expired certification")
+
+	r = Assess(Scores{Overall: v(45)}, nil, Profile{FinancialHealth: "poor", Certified: true, CertExpired: true})
+	assert.Equal(t, RiskCritical, r.Level)
+}
@@ -0,0 +1,52 @@
+// Package screening parses consolidated sanctions lists and fuzzy-matches
+// business partners against them.
+package screening
+
+// Supported list sources
+const (
+	SourceOFAC = "ofac_sdn"
+	SourceEU   = "eu"
+	SourceUN   = "un"
+)
+
+// Entry types
+const (
+	EntryTypeIndividual = "individual"
+	EntryTypeEntity     = "entity"
+	EntryTypeVessel     = "vessel"
+	EntryTypeAircraft   = "aircraft"
+)
+
+// Entry is a single designated party from a sanctions list
+type Entry struct {
+	Source     string
+	ExternalID string
+	EntryType  string
+	Name       string
+	Aliases    []string
+	Addresses  []string
+	Countries  []string
+	Programs   []string
+	Remarks    string
+}
+
+// Names returns the primary name followed by all aliases
+func (e *Entry) Names() []string {
+	names := make([]string, 0, len(e.Aliases)+1)
+	if e.Name != "" {
+		names = append(names, e.Name)
+	}
+	return append(names, e.Aliases...)
+}
+
+func appendUnique(values []string, value string) []string {
+	if value == "" {
+		return values
+	}
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
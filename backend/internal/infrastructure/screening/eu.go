@@ -0,0 +1,100 @@
+package screening
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type euExport struct {
+	Entities []euSanctionEntity `xml:"sanctionEntity"`
+}
+
+type euSanctionEntity struct {
+	LogicalID   string `xml:"logicalId,attr"`
+	EUReference string `xml:"euReferenceNumber,attr"`
+	Remark      string `xml:"remark"`
+	Regulations []struct {
+		Programme string `xml:"programme,attr"`
+	} `xml:"regulation"`
+	SubjectType struct {
+		Code string `xml:"code,attr"`
+	} `xml:"subjectType"`
+	NameAliases []struct {
+		WholeName string `xml:"wholeName,attr"`
+		Strong    string `xml:"strong,attr"`
+	} `xml:"nameAlias"`
+	Addresses []struct {
+		Street      string `xml:"street,attr"`
+		City        string `xml:"city,attr"`
+		ZipCode     string `xml:"zipCode,attr"`
+		Region      string `xml:"region,attr"`
+		CountryCode string `xml:"countryIso2Code,attr"`
+		CountryName string `xml:"countryDescription,attr"`
+	} `xml:"address"`
+	Citizenships []struct {
+		CountryCode string `xml:"countryIso2Code,attr"`
+	} `xml:"citizenship"`
+}
+
+// ParseEU parses the EU consolidated financial sanctions list (FSF XML 1.1)
+func ParseEU(r io.Reader) ([]Entry, error) {
+	var export euExport
+	if err := xml.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("failed to decode EU list: %w", err)
+	}
+
+	entries := make([]Entry, 0, len(export.Entities))
+	for _, e := range export.Entities {
+		entry := Entry{
+			Source:     SourceEU,
+			ExternalID: e.LogicalID,
+			EntryType:  euEntryType(e.SubjectType.Code),
+			Remarks:    strings.TrimSpace(e.Remark),
+		}
+		if entry.ExternalID == "" {
+			entry.ExternalID = e.EUReference
+		}
+		for _, alias := range e.NameAliases {
+			name := strings.TrimSpace(alias.WholeName)
+			if entry.Name == "" {
+				entry.Name = name
+				continue
+			}
+			if name != entry.Name {
+				entry.Aliases = appendUnique(entry.Aliases, name)
+			}
+		}
+		if entry.Name == "" || entry.ExternalID == "" {
+			continue
+		}
+		for _, reg := range e.Regulations {
+			entry.Programs = appendUnique(entry.Programs, reg.Programme)
+		}
+		for _, addr := range e.Addresses {
+			parts := make([]string, 0, 5)
+			for _, v := range []string{addr.Street, addr.City, addr.ZipCode, addr.Region, addr.CountryName} {
+				if v = strings.TrimSpace(v); v != "" && !strings.EqualFold(v, "unknown") {
+					parts = append(parts, v)
+				}
+			}
+			entry.Addresses = appendUnique(entry.Addresses, strings.Join(parts, ", "))
+			entry.Countries = appendUnique(entry.Countries, addr.CountryCode)
+		}
+		for _, c := range e.Citizenships {
+			entry.Countries = appendUnique(entry.Countries, c.CountryCode)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func euEntryType(code string) string {
+	switch code {
+	case "person":
+		return EntryTypeIndividual
+	default:
+		return EntryTypeEntity
+	}
+}
@@ -0,0 +1,344 @@
+package screening
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Thresholds tune how aggressively partners are matched against list entries
+type Thresholds struct {
+	// MatchScore is the minimum combined score reported as a hit
+	MatchScore float64 `json:"match_score"`
+	// NameScore is the minimum name similarity before address data is considered
+	NameScore float64 `json:"name_score"`
+	// AddressWeight is the share of the remaining gap to a perfect score that
+	// a matching address or country closes
+	AddressWeight float64 `json:"address_weight"`
+}
+
+// DefaultThresholds returns thresholds suited to company and person names
+func DefaultThresholds() Thresholds {
+	return Thresholds{
+		MatchScore:    0.88,
+		NameScore:     0.80,
+		AddressWeight: 0.5,
+	}
+}
+
+// Party is a business partner to be screened
+type Party struct {
+	Names   []string
+	Address string
+	Country string
+}
+
+// Match is a list entry that scored above the match threshold
+type Match struct {
+	// Index of the entry in the slice the matcher was built from
+	Index        int
+	MatchedName  string
+	NameScore    float64
+	AddressScore float64
+	Score        float64
+}
+
+type preparedName struct {
+	raw    string
+	tokens []string
+	joined string
+}
+
+type preparedEntry struct {
+	names     []preparedName
+	addresses [][]string
+	countries []string
+}
+
+// Matcher screens parties against a fixed set of list entries. It is safe
+// for concurrent use.
+type Matcher struct {
+	entries []preparedEntry
+}
+
+// NewMatcher normalizes the entries once so that screening many parties is cheap
+func NewMatcher(entries []Entry) *Matcher {
+	m := &Matcher{
+		entries: make([]preparedEntry, len(entries)),
+	}
+	for i := range entries {
+		e := &entries[i]
+		p := preparedEntry{}
+		for _, name := range e.Names() {
+			if pn, ok := prepareName(name); ok {
+				p.names = append(p.names, pn)
+			}
+		}
+		for _, addr := range e.Addresses {
+			if tokens := Tokenize(addr); len(tokens) > 0 {
+				p.addresses = append(p.addresses, tokens)
+			}
+		}
+		for _, c := range e.Countries {
+			if key := countryKey(c); key != "" {
+				p.countries = append(p.countries, key)
+			}
+		}
+		m.entries[i] = p
+	}
+	return m
+}
+
+// Len returns the number of entries the matcher screens against
+func (m *Matcher) Len() int {
+	return len(m.entries)
+}
+
+// Screen returns every entry matching the party, best score first
+func (m *Matcher) Screen(party Party, thresholds Thresholds) []Match {
+	var names []preparedName
+	for _, name := range party.Names {
+		if pn, ok := prepareName(name); ok {
+			names = append(names, pn)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	country := countryKey(party.Country)
+	addressTokens := Tokenize(party.Address)
+	if len(addressTokens) > 0 && country != "" {
+		addressTokens = append(addressTokens, strings.Fields(country)...)
+	}
+
+	var matches []Match
+	for i, entry := range m.entries {
+		best := Match{Index: i}
+		for _, en := range entry.names {
+			for _, pn := range names {
+				if score := nameSimilarity(pn, en); score > best.NameScore {
+					best.NameScore = score
+					best.MatchedName = en.raw
+				}
+			}
+		}
+		if best.NameScore < thresholds.NameScore {
+			continue
+		}
+
+		best.AddressScore = addressSimilarity(addressTokens, country, entry)
+		best.Score = best.NameScore + thresholds.AddressWeight*best.AddressScore*(1-best.NameScore)
+		if best.Score >= thresholds.MatchScore {
+			matches = append(matches, best)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches
+}
+
+func prepareName(name string) (preparedName, bool) {
+	tokens := Tokenize(name)
+	if len(tokens) == 0 {
+		return preparedName{}, false
+	}
+	return preparedName{raw: name, tokens: tokens, joined: strings.Join(tokens, "")}, true
+}
+
+// nameSimilarity combines a token-set comparison, which tolerates word order
+// and extra words, with a comparison of the concatenated tokens, which
+// tolerates differently split words ("Hua Wei" vs "Huawei").
+func nameSimilarity(a, b preparedName) float64 {
+	tokenScore := (directionalSimilarity(a.tokens, b.tokens) + directionalSimilarity(b.tokens, a.tokens)) / 2
+	if joined := JaroWinkler(a.joined, b.joined); joined > tokenScore {
+		return joined
+	}
+	return tokenScore
+}
+
+// directionalSimilarity is the length-weighted average best match of each
+// token in from against the tokens in to
+func directionalSimilarity(from, to []string) float64 {
+	var total, weight float64
+	for _, f := range from {
+		best := 0.0
+		for _, t := range to {
+			if s := JaroWinkler(f, t); s > best {
+				best = s
+			}
+		}
+		w := float64(len([]rune(f)))
+		total += best * w
+		weight += w
+	}
+	if weight == 0 {
+		return 0
+	}
+	return total / weight
+}
+
+func addressSimilarity(tokens []string, country string, entry preparedEntry) float64 {
+	countryScore := 0.0
+	if country != "" {
+		for _, c := range entry.countries {
+			if c == country {
+				countryScore = 1
+				break
+			}
+		}
+	}
+	if len(tokens) == 0 || len(entry.addresses) == 0 {
+		return countryScore
+	}
+
+	best := 0.0
+	for _, addr := range entry.addresses {
+		// List addresses are often just a city and country, so measure how
+		// much of the list address is covered by the partner's address
+		if s := directionalSimilarity(addr, tokens); s > best {
+			best = s
+		}
+	}
+	return 0.7*best + 0.3*countryScore
+}
+
+// countryKey maps ISO codes and English country names to a comparable form
+func countryKey(country string) string {
+	country = strings.TrimSpace(country)
+	if len(country) == 2 || len(country) == 3 {
+		if region, err := language.ParseRegion(country); err == nil {
+			if name := display.English.Regions().Name(region); name != "" {
+				country = name
+			}
+		}
+	}
+	return strings.Join(Tokenize(country), " ")
+}
+
+// legalForms are dropped from names before comparison; they carry no
+// identifying information and inflate similarity between unrelated companies
+var legalForms = map[string]bool{
+	"co": true, "company": true, "corp": true, "corporation": true, "inc": true,
+	"incorporated": true, "ltd": true, "limited": true, "llc": true, "llp": true,
+	"lp": true, "plc": true, "gmbh": true, "ag": true, "sa": true, "sas": true,
+	"sarl": true, "srl": true, "spa": true, "bv": true, "nv": true, "oy": true,
+	"ab": true, "kg": true, "jsc": true, "ojsc": true, "pjsc": true, "cjsc": true,
+	"ooo": true, "oao": true, "zao": true, "pao": true, "pte": true, "pvt": true,
+	"sdn": true, "bhd": true, "the": true, "and": true, "of": true,
+}
+
+// Tokenize transliterates, lowercases and splits a name or address into
+// comparable tokens, dropping punctuation and legal-form suffixes
+func Tokenize(s string) []string {
+	s = Transliterate(s)
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := fields[:0]
+	for _, f := range fields {
+		if !legalForms[f] {
+			tokens = append(tokens, f)
+		}
+	}
+	return tokens
+}
+
+// Transliterate folds accented Latin letters to ASCII and romanizes Cyrillic
+// and Greek. Other scripts are left as they are; the lists carry Latin
+// spellings for those names as aliases.
+func Transliterate(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range norm.NFKD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if t, ok := transliterations[unicode.ToLower(r)]; ok {
+			b.WriteString(t)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+var transliterations = map[rune]string{
+	// Latin letters without a decomposition
+	'ß': "ss", 'æ': "ae", 'ø': "o", 'œ': "oe", 'đ': "d", 'ð': "d", 'ł': "l",
+	'þ': "th", 'ı': "i", 'ħ': "h",
+	// Cyrillic (BGN/PCGN style)
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "w",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+	'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+	'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+}
+
+// JaroWinkler returns the Jaro-Winkler similarity of two strings in [0, 1]
+func JaroWinkler(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	window := max(len(ra), len(rb))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		lo := max(0, i-window)
+		hi := min(len(rb), i+window+1)
+		for j := lo; j < hi; j++ {
+			if !matchedB[j] && ra[i] == rb[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	j := 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(ra), len(rb)) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
@@ -0,0 +1,134 @@
+package screening
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ofacNull is the placeholder OFAC uses for empty columns
+const ofacNull = "-0-"
+
+// ParseOFAC parses the OFAC SDN list in its legacy CSV distribution.
+// sdn is required; alt (alternate names) and add (addresses) may be nil.
+func ParseOFAC(sdn, alt, add io.Reader) ([]Entry, error) {
+	rows, err := readOFACFile(sdn)
+	if err != nil {
+		return nil, fmt.Errorf("sdn.csv: %w", err)
+	}
+
+	entries := make([]Entry, 0, len(rows))
+	index := make(map[string]int, len(rows))
+	for _, row := range rows {
+		// ent_num, SDN_Name, SDN_Type, Program, Title, Call_Sign, Vess_type, Tonnage, GRT, Vess_flag, Vess_owner, Remarks
+		if len(row) < 4 {
+			continue
+		}
+		entry := Entry{
+			Source:     SourceOFAC,
+			ExternalID: ofacValue(row[0]),
+			Name:       ofacValue(row[1]),
+			EntryType:  ofacEntryType(ofacValue(row[2])),
+		}
+		if entry.ExternalID == "" || entry.Name == "" {
+			continue
+		}
+		for _, program := range strings.Split(ofacValue(row[3]), "]") {
+			program = strings.TrimSpace(strings.Trim(program, "[ "))
+			entry.Programs = appendUnique(entry.Programs, program)
+		}
+		if len(row) > 11 {
+			entry.Remarks = ofacValue(row[11])
+		}
+		index[entry.ExternalID] = len(entries)
+		entries = append(entries, entry)
+	}
+
+	if alt != nil {
+		rows, err := readOFACFile(alt)
+		if err != nil {
+			return nil, fmt.Errorf("alt.csv: %w", err)
+		}
+		for _, row := range rows {
+			// ent_num, alt_num, alt_type, alt_name, alt_remarks
+			if len(row) < 4 {
+				continue
+			}
+			if i, ok := index[ofacValue(row[0])]; ok {
+				entries[i].Aliases = appendUnique(entries[i].Aliases, ofacValue(row[3]))
+			}
+		}
+	}
+
+	if add != nil {
+		rows, err := readOFACFile(add)
+		if err != nil {
+			return nil, fmt.Errorf("add.csv: %w", err)
+		}
+		for _, row := range rows {
+			// ent_num, add_num, address, city/state/postal, country, add_remarks
+			if len(row) < 5 {
+				continue
+			}
+			i, ok := index[ofacValue(row[0])]
+			if !ok {
+				continue
+			}
+			parts := make([]string, 0, 3)
+			for _, col := range row[2:5] {
+				if v := ofacValue(col); v != "" {
+					parts = append(parts, v)
+				}
+			}
+			entries[i].Addresses = appendUnique(entries[i].Addresses, strings.Join(parts, ", "))
+			entries[i].Countries = appendUnique(entries[i].Countries, ofacValue(row[4]))
+		}
+	}
+
+	return entries, nil
+}
+
+func readOFACFile(r io.Reader) ([][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var rows [][]string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The files are terminated with a DOS end-of-file marker
+		if len(row) == 1 && strings.Trim(row[0], "\x1a \r\n") == "" {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func ofacValue(v string) string {
+	v = strings.TrimSpace(v)
+	if v == ofacNull {
+		return ""
+	}
+	return v
+}
+
+func ofacEntryType(sdnType string) string {
+	switch strings.ToLower(sdnType) {
+	case "individual":
+		return EntryTypeIndividual
+	case "vessel":
+		return EntryTypeVessel
+	case "aircraft":
+		return EntryTypeAircraft
+	default:
+		return EntryTypeEntity
+	}
+}
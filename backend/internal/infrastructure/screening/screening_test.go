@@ -0,0 +1,153 @@
+package screening
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ofacSDN = `36,"AEROCARIBBEAN AIRLINES","-0- ","CUBA","-0- ","-0- ","-0- ","-0- ","-0- ","-0- ","-0- ","-0- "
+173,"ANGLO-CARIBBEAN CO., LTD.","-0- ","CUBA] [IRAN","-0- ","-0- ","-0- ","-0- ","-0- ","-0- ","-0- ","-0- "
+306,"IVANOV, Petr","individual","UKRAINE-EO13660","-0- ","-0- ","-0- ","-0- ","-0- ","-0- ","-0- ","DOB 1960."
+` + "\x1a"
+
+const ofacAlt = `173,1,"aka","AVIA IMPORT",""
+`
+
+const ofacAdd = `36,25,"-0- ","Havana","Cuba","-0- "
+173,26,"Ibex House, The Minories","London EC3N 1DY","United Kingdom","-0- "
+`
+
+const euXML = `<?xml version="1.0" encoding="UTF-8"?>
+<export xmlns="http://eu.europa.ec/fpi/fsd/export" generationDate="2026-01-01T00:00:00">
+  <sanctionEntity logicalId="13" euReferenceNumber="EU.27.28">
+    <regulation programme="IRQ"/>
+    <subjectType code="person" classificationCode="P"/>
+    <nameAlias wholeName="Saddam Hussein Al-Tikriti" strong="true"/>
+    <nameAlias wholeName="Abu Ali" strong="false"/>
+    <address city="Baghdad" street="" countryIso2Code="IQ" countryDescription="IRAQ"/>
+    <citizenship countryIso2Code="IQ"/>
+  </sanctionEntity>
+</export>`
+
+const unXML = `<CONSOLIDATED_LIST>
+  <INDIVIDUALS>
+    <INDIVIDUAL>
+      <DATAID>6908555</DATAID>
+      <FIRST_NAME>RI</FIRST_NAME>
+      <SECOND_NAME>WON HO</SECOND_NAME>
+      <UN_LIST_TYPE>DPRK</UN_LIST_TYPE>
+      <REFERENCE_NUMBER>KPi.001</REFERENCE_NUMBER>
+      <NATIONALITY><VALUE>Democratic People's Republic of Korea</VALUE></NATIONALITY>
+      <INDIVIDUAL_ALIAS><QUALITY>Good</QUALITY><ALIAS_NAME>Ri Won-ho</ALIAS_NAME></INDIVIDUAL_ALIAS>
+      <INDIVIDUAL_ALIAS><QUALITY>Low</QUALITY><ALIAS_NAME>Ri</ALIAS_NAME></INDIVIDUAL_ALIAS>
+    </INDIVIDUAL>
+  </INDIVIDUALS>
+  <ENTITIES>
+    <ENTITY>
+      <DATAID>110403</DATAID>
+      <FIRST_NAME>KOREA MINING DEVELOPMENT TRADING CORPORATION</FIRST_NAME>
+      <UN_LIST_TYPE>DPRK</UN_LIST_TYPE>
+      <REFERENCE_NUMBER>KPe.001</REFERENCE_NUMBER>
+      <ENTITY_ALIAS><QUALITY>a.k.a.</QUALITY><ALIAS_NAME>KOMID</ALIAS_NAME></ENTITY_ALIAS>
+      <ENTITY_ADDRESS><CITY>Pyongyang</CITY><COUNTRY>Democratic People's Republic of Korea</COUNTRY></ENTITY_ADDRESS>
+    </ENTITY>
+  </ENTITIES>
+</CONSOLIDATED_LIST>`
+
+func TestParseOFAC(t *testing.T) {
+	entries, err := ParseOFAC(strings.NewReader(ofacSDN), strings.NewReader(ofacAlt), strings.NewReader(ofacAdd))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, "36", entries[0].ExternalID)
+	assert.Equal(t, EntryTypeEntity, entries[0].EntryType)
+	assert.Equal(t, []string{"Havana, Cuba"}, entries[0].Addresses)
+
+	assert.Equal(t, []string{"CUBA", "IRAN"}, entries[1].Programs)
+	assert.Equal(t, []string{"AVIA IMPORT"}, entries[1].Aliases)
+	assert.Equal(t, []string{"United Kingdom"}, entries[1].Countries)
+
+	assert.Equal(t, EntryTypeIndividual, entries[2].EntryType)
+	assert.Equal(t, "DOB 1960.", entries[2].Remarks)
+}
+
+func TestParseEU(t *testing.T) {
+	entries, err := ParseEU(strings.NewReader(euXML))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	e := entries[0]
+	assert.Equal(t, "13", e.ExternalID)
+	assert.Equal(t, EntryTypeIndividual, e.EntryType)
+	assert.Equal(t, "Saddam Hussein Al-Tikriti", e.Name)
+	assert.Equal(t, []string{"Abu Ali"}, e.Aliases)
+	assert.Equal(t, []string{"Baghdad, IRAQ"}, e.Addresses)
+	assert.Equal(t, []string{"IQ"}, e.Countries)
+}
+
+func TestParseUN(t *testing.T) {
+	entries, err := ParseUN(strings.NewReader(unXML))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "RI WON HO", entries[0].Name)
+	assert.Equal(t, []string{"Ri Won-ho"}, entries[0].Aliases)
+	assert.Equal(t, EntryTypeEntity, entries[1].EntryType)
+	assert.Equal(t, []string{"KOMID"}, entries[1].Aliases)
+	assert.Equal(t, []string{"Pyongyang, Democratic People's Republic of Korea"}, entries[1].Addresses)
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"muller", "stahl"}, Tokenize("Müller Stahl GmbH"))
+	assert.Equal(t, []string{"ivanov", "petr"}, Tokenize("ИВАНОВ, Пётр"))
+	assert.Equal(t, []string{"anglo", "caribbean"}, Tokenize("ANGLO-CARIBBEAN CO., LTD."))
+}
+
+func TestJaroWinkler(t *testing.T) {
+	assert.Equal(t, 1.0, JaroWinkler("martha", "martha"))
+	assert.InDelta(t, 0.961, JaroWinkler("martha", "marhta"), 0.001)
+	assert.InDelta(t, 0.840, JaroWinkler("dwayne", "duane"), 0.001)
+	assert.Equal(t, 0.0, JaroWinkler("abc", ""))
+}
+
+func TestMatcherScreen(t *testing.T) {
+	entries, err := ParseOFAC(strings.NewReader(ofacSDN), strings.NewReader(ofacAlt), strings.NewReader(ofacAdd))
+	require.NoError(t, err)
+	m := NewMatcher(entries)
+	thresholds := DefaultThresholds()
+
+	t.Run("word order, punctuation and transliteration", func(t *testing.T) {
+		matches := m.Screen(Party{Names: []string{"Пётр Иванов"}}, thresholds)
+		require.Len(t, matches, 1)
+		assert.Equal(t, 2, matches[0].Index)
+		assert.InDelta(t, 1.0, matches[0].NameScore, 0.001)
+	})
+
+	t.Run("alias and legal form", func(t *testing.T) {
+		matches := m.Screen(Party{Names: []string{"Avia-Import Ltd"}}, thresholds)
+		require.Len(t, matches, 1)
+		assert.Equal(t, 1, matches[0].Index)
+		assert.Equal(t, "AVIA IMPORT", matches[0].MatchedName)
+	})
+
+	t.Run("address corroborates a near match", func(t *testing.T) {
+		party := Party{Names: []string{"Aerocaribean Airline"}}
+		withoutAddress := m.Screen(party, thresholds)
+
+		party.Address = "Calle 23, Havana"
+		party.Country = "CU"
+		withAddress := m.Screen(party, thresholds)
+		require.Len(t, withAddress, 1)
+		assert.Equal(t, 1.0, withAddress[0].AddressScore)
+		if len(withoutAddress) > 0 {
+			assert.Greater(t, withAddress[0].Score, withoutAddress[0].Score)
+		}
+	})
+
+	t.Run("unrelated name", func(t *testing.T) {
+		assert.Empty(t, m.Screen(Party{Names: []string{"Taiwan Precision Screw Co., Ltd."}, Country: "TW"}, thresholds))
+	})
+}
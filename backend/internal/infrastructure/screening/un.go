@@ -0,0 +1,108 @@
+package screening
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type unConsolidatedList struct {
+	Individuals []unParty `xml:"INDIVIDUALS>INDIVIDUAL"`
+	Entities    []unParty `xml:"ENTITIES>ENTITY"`
+}
+
+type unParty struct {
+	DataID          string      `xml:"DATAID"`
+	FirstName       string      `xml:"FIRST_NAME"`
+	SecondName      string      `xml:"SECOND_NAME"`
+	ThirdName       string      `xml:"THIRD_NAME"`
+	FourthName      string      `xml:"FOURTH_NAME"`
+	ListType        string      `xml:"UN_LIST_TYPE"`
+	ReferenceNumber string      `xml:"REFERENCE_NUMBER"`
+	Comments        string      `xml:"COMMENTS1"`
+	Nationalities   []string    `xml:"NATIONALITY>VALUE"`
+	Aliases         []unAlias   `xml:"INDIVIDUAL_ALIAS"`
+	EntityAliases   []unAlias   `xml:"ENTITY_ALIAS"`
+	Addresses       []unAddress `xml:"INDIVIDUAL_ADDRESS"`
+	EntityAddresses []unAddress `xml:"ENTITY_ADDRESS"`
+}
+
+type unAlias struct {
+	Quality string `xml:"QUALITY"`
+	Name    string `xml:"ALIAS_NAME"`
+}
+
+type unAddress struct {
+	Street  string `xml:"STREET"`
+	City    string `xml:"CITY"`
+	State   string `xml:"STATE_PROVINCE"`
+	Zip     string `xml:"ZIP_CODE"`
+	Country string `xml:"COUNTRY"`
+}
+
+// ParseUN parses the UN Security Council consolidated list XML
+func ParseUN(r io.Reader) ([]Entry, error) {
+	var list unConsolidatedList
+	if err := xml.NewDecoder(r).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode UN list: %w", err)
+	}
+
+	entries := make([]Entry, 0, len(list.Individuals)+len(list.Entities))
+	for _, p := range list.Individuals {
+		if entry, ok := unEntry(p, EntryTypeIndividual); ok {
+			entries = append(entries, entry)
+		}
+	}
+	for _, p := range list.Entities {
+		if entry, ok := unEntry(p, EntryTypeEntity); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func unEntry(p unParty, entryType string) (Entry, bool) {
+	parts := make([]string, 0, 4)
+	for _, v := range []string{p.FirstName, p.SecondName, p.ThirdName, p.FourthName} {
+		if v = strings.TrimSpace(v); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	entry := Entry{
+		Source:     SourceUN,
+		ExternalID: strings.TrimSpace(p.ReferenceNumber),
+		EntryType:  entryType,
+		Name:       strings.Join(parts, " "),
+		Remarks:    strings.TrimSpace(p.Comments),
+	}
+	if entry.ExternalID == "" {
+		entry.ExternalID = strings.TrimSpace(p.DataID)
+	}
+	if entry.Name == "" || entry.ExternalID == "" {
+		return entry, false
+	}
+	entry.Programs = appendUnique(entry.Programs, strings.TrimSpace(p.ListType))
+
+	for _, alias := range append(p.Aliases, p.EntityAliases...) {
+		// Low quality aliases are too generic to screen against
+		if strings.EqualFold(alias.Quality, "Low") {
+			continue
+		}
+		entry.Aliases = appendUnique(entry.Aliases, strings.TrimSpace(alias.Name))
+	}
+	for _, n := range p.Nationalities {
+		entry.Countries = appendUnique(entry.Countries, strings.TrimSpace(n))
+	}
+	for _, addr := range append(p.Addresses, p.EntityAddresses...) {
+		parts := make([]string, 0, 5)
+		for _, v := range []string{addr.Street, addr.City, addr.State, addr.Zip, addr.Country} {
+			if v = strings.TrimSpace(v); v != "" {
+				parts = append(parts, v)
+			}
+		}
+		entry.Addresses = appendUnique(entry.Addresses, strings.Join(parts, ", "))
+		entry.Countries = appendUnique(entry.Countries, strings.TrimSpace(addr.Country))
+	}
+	return entry, true
+}
@@ -0,0 +1,366 @@
+// Package spc computes statistical process control charts for measured
+// characteristics: X̄-R charts for subgroups of 2 to 10 measurements, I-MR
+// charts for individual measurements, process capability (Cp, Cpk, Pp,
+// Ppk) and the Western Electric rules for out-of-control signals.
+package spc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Chart types
+const (
+	ChartXbarR = "xbar_r"
+	ChartIMR   = "i_mr"
+)
+
+// Charts of a chart type
+const (
+	ChartXbar        = "xbar"
+	ChartRange       = "r"
+	ChartIndividual  = "i"
+	ChartMovingRange = "mr"
+)
+
+// Western Electric rules
+const (
+	RuleBeyondLimits = 1 // one point beyond 3σ
+	RuleTwoOfThree   = 2 // two of three consecutive points beyond 2σ on the same side
+	RuleFourOfFive   = 3 // four of five consecutive points beyond 1σ on the same side
+	RuleEightInARow  = 4 // eight consecutive points on the same side of the center line
+)
+
+// MaxSubgroupSize is the largest subgroup an X̄-R chart is computed for
+const MaxSubgroupSize = 10
+
+var (
+	// ErrTooFewSubgroups is returned when fewer than two complete subgroups
+	// or individual values are available
+	ErrTooFewSubgroups = errors.New("at least two complete subgroups are needed")
+	// ErrSubgroupSize is returned for a subgroup size outside 1 to 10
+	ErrSubgroupSize = fmt.Errorf("subgroup size must be between 1 and %d", MaxSubgroupSize)
+)
+
+// Control chart constants by subgroup size (ASTM STP 15D)
+var (
+	a2 = [...]float64{2: 1.880, 1.023, 0.729, 0.577, 0.483, 0.419, 0.373, 0.337, 0.308}
+	d2 = [...]float64{2: 1.128, 1.693, 2.059, 2.326, 2.534, 2.704, 2.847, 2.970, 3.078}
+	d3 = [...]float64{2: 0, 0, 0, 0, 0, 0.076, 0.136, 0.184, 0.223}
+	d4 = [...]float64{2: 3.267, 2.574, 2.282, 2.114, 2.004, 1.924, 1.864, 1.816, 1.777}
+)
+
+// Subgroup is a numbered group of measurements taken together; for I-MR
+// charts each subgroup holds a single value
+type Subgroup struct {
+	No     int       `json:"no"`
+	Values []float64 `json:"values"`
+}
+
+// Point is a plotted statistic of a subgroup
+type Point struct {
+	Subgroup int     `json:"subgroup"`
+	Value    float64 `json:"value"`
+}
+
+// Chart is a control chart with its limits, points and the rule
+// violations found on it
+type Chart struct {
+	Chart      string      `json:"chart"`
+	Center     float64     `json:"center"`
+	UCL        float64     `json:"ucl"`
+	LCL        float64     `json:"lcl"`
+	Points     []Point     `json:"points"`
+	Violations []Violation `json:"violations"`
+}
+
+// Violation is a Western Electric rule signalled at the subgroup that
+// completes the pattern
+type Violation struct {
+	Chart       string  `json:"chart"`
+	Rule        int     `json:"rule"`
+	Subgroup    int     `json:"subgroup"`
+	Value       float64 `json:"value"`
+	Description string  `json:"description"`
+}
+
+// Capability is the process capability against the specification limits;
+// indices that need a missing limit are nil
+type Capability struct {
+	N            int      `json:"n"`
+	Mean         float64  `json:"mean"`
+	SigmaWithin  float64  `json:"sigma_within"`  // from the average range
+	SigmaOverall float64  `json:"sigma_overall"` // sample standard deviation
+	LSL          *float64 `json:"lsl,omitempty"`
+	USL          *float64 `json:"usl,omitempty"`
+	Cp           *float64 `json:"cp,omitempty"`
+	Cpk          *float64 `json:"cpk,omitempty"`
+	Pp           *float64 `json:"pp,omitempty"`
+	Ppk          *float64 `json:"ppk,omitempty"`
+	OutOfSpec    int      `json:"out_of_spec"`
+}
+
+// Analysis is the control charts, capability and violations of a
+// characteristic
+type Analysis struct {
+	ChartType  string      `json:"chart_type"`
+	Subgroups  int         `json:"subgroups"`
+	Charts     []Chart     `json:"charts"`
+	Capability Capability  `json:"capability"`
+	Violations []Violation `json:"violations"`
+}
+
+// Analyze charts the complete subgroups of size n, X̄-R when n is 2 or more
+// and I-MR when it is 1, checks them against the Western Electric rules
+// and computes the capability against lsl and usl
+func Analyze(groups []Subgroup, n int, lsl, usl *float64) (*Analysis, error) {
+	if n < 1 || n > MaxSubgroupSize {
+		return nil, ErrSubgroupSize
+	}
+
+	var (
+		location, spread Chart
+		sigma            float64
+		values           []float64
+		err              error
+	)
+	analysis := &Analysis{ChartType: ChartXbarR}
+	if n == 1 {
+		analysis.ChartType = ChartIMR
+		location, spread, sigma, err = IMR(groups)
+	} else {
+		location, spread, sigma, err = XbarR(groups, n)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	location.Violations = WesternElectric(location)
+	spread.Violations = BeyondLimits(spread)
+	analysis.Charts = []Chart{location, spread}
+	analysis.Subgroups = len(location.Points)
+	analysis.Violations = append(append([]Violation{}, location.Violations...), spread.Violations...)
+
+	for _, g := range groups {
+		if len(g.Values) == n {
+			values = append(values, g.Values...)
+		}
+	}
+	analysis.Capability = Capable(values, sigma, lsl, usl)
+	return analysis, nil
+}
+
+// XbarR computes the X̄ and R charts of the subgroups with exactly n values
+// and the within-subgroup sigma R̄/d2
+func XbarR(groups []Subgroup, n int) (xbar, r Chart, sigma float64, err error) {
+	if n < 2 || n > MaxSubgroupSize {
+		return xbar, r, 0, ErrSubgroupSize
+	}
+	xbar = Chart{Chart: ChartXbar}
+	r = Chart{Chart: ChartRange}
+	for _, g := range groups {
+		if len(g.Values) != n {
+			continue
+		}
+		lo, hi := g.Values[0], g.Values[0]
+		for _, v := range g.Values[1:] {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+		xbar.Points = append(xbar.Points, Point{Subgroup: g.No, Value: mean(g.Values)})
+		r.Points = append(r.Points, Point{Subgroup: g.No, Value: hi - lo})
+	}
+	if len(xbar.Points) < 2 {
+		return xbar, r, 0, ErrTooFewSubgroups
+	}
+
+	grand, rbar := pointMean(xbar.Points), pointMean(r.Points)
+	xbar.Center, xbar.UCL, xbar.LCL = grand, grand+a2[n]*rbar, grand-a2[n]*rbar
+	r.Center, r.UCL, r.LCL = rbar, d4[n]*rbar, d3[n]*rbar
+	return xbar, r, rbar / d2[n], nil
+}
+
+// IMR computes the individuals and moving range charts of the first value
+// of each subgroup and the sigma MR̄/d2
+func IMR(groups []Subgroup) (individuals, movingRange Chart, sigma float64, err error) {
+	individuals = Chart{Chart: ChartIndividual}
+	movingRange = Chart{Chart: ChartMovingRange}
+	for _, g := range groups {
+		if len(g.Values) == 0 {
+			continue
+		}
+		v := g.Values[0]
+		if k := len(individuals.Points); k > 0 {
+			movingRange.Points = append(movingRange.Points, Point{Subgroup: g.No, Value: math.Abs(v - individuals.Points[k-1].Value)})
+		}
+		individuals.Points = append(individuals.Points, Point{Subgroup: g.No, Value: v})
+	}
+	if len(individuals.Points) < 2 {
+		return individuals, movingRange, 0, ErrTooFewSubgroups
+	}
+
+	center, mrbar := pointMean(individuals.Points), pointMean(movingRange.Points)
+	sigma = mrbar / d2[2]
+	individuals.Center, individuals.UCL, individuals.LCL = center, center+3*sigma, center-3*sigma
+	movingRange.Center, movingRange.UCL, movingRange.LCL = mrbar, d4[2]*mrbar, 0
+	return individuals, movingRange, sigma, nil
+}
+
+// WesternElectric checks a location chart against the four Western
+// Electric rules, taking σ as a third of the distance to the control
+// limits. Each violation is reported at the point completing the pattern;
+// a run of eight is reported once, at its eighth point.
+func WesternElectric(chart Chart) []Violation {
+	sigma := (chart.UCL - chart.Center) / 3
+	if sigma <= 0 {
+		return nil
+	}
+
+	// zone is the signed number of whole sigmas a point lies from the
+	// center line, capped at 3
+	zone := make([]int, len(chart.Points))
+	for i, p := range chart.Points {
+		z := int(math.Min(3, math.Floor(math.Abs(p.Value-chart.Center)/sigma)))
+		if p.Value < chart.Center {
+			z = -z
+		}
+		zone[i] = z
+	}
+
+	var violations []Violation
+	run, side := 0, 0
+	for i, p := range chart.Points {
+		add := func(rule int, description string) {
+			violations = append(violations, Violation{Chart: chart.Chart, Rule: rule, Subgroup: p.Subgroup, Value: p.Value, Description: description})
+		}
+
+		if p.Value > chart.UCL || p.Value < chart.LCL {
+			add(RuleBeyondLimits, "point beyond the control limits")
+		}
+		if beyond(zone, i, 3, 2) {
+			add(RuleTwoOfThree, "2 of 3 consecutive points beyond 2σ on the same side")
+		}
+		if beyond(zone, i, 5, 4) {
+			add(RuleFourOfFive, "4 of 5 consecutive points beyond 1σ on the same side")
+		}
+
+		s := 0
+		if p.Value > chart.Center {
+			s = 1
+		} else if p.Value < chart.Center {
+			s = -1
+		}
+		if s != 0 && s == side {
+			run++
+		} else {
+			run, side = 1, s
+		}
+		if side != 0 && run == 8 {
+			add(RuleEightInARow, "8 consecutive points on the same side of the center line")
+		}
+	}
+	return violations
+}
+
+// BeyondLimits checks a range chart for points outside its control limits
+func BeyondLimits(chart Chart) []Violation {
+	var violations []Violation
+	for _, p := range chart.Points {
+		if p.Value > chart.UCL || (chart.LCL > 0 && p.Value < chart.LCL) {
+			violations = append(violations, Violation{Chart: chart.Chart, Rule: RuleBeyondLimits, Subgroup: p.Subgroup, Value: p.Value, Description: "range beyond the control limits"})
+		}
+	}
+	return violations
+}
+
+// beyond reports whether, in the window of size points ending at i, at
+// least count points lie beyond |zone| 2 (for a window of 3) or 1 (for a
+// window of 5) on the side of point i, point i being one of them
+func beyond(zone []int, i, size, count int) bool {
+	if i+1 < size {
+		return false
+	}
+	limit := 1
+	if size == 3 {
+		limit = 2
+	}
+	side := 1
+	if zone[i] < 0 {
+		side = -1
+	}
+	if zone[i]*side < limit {
+		return false
+	}
+	n := 0
+	for _, z := range zone[i+1-size : i+1] {
+		if z*side >= limit {
+			n++
+		}
+	}
+	return n >= count
+}
+
+// Capable computes the capability of the values with the within-subgroup
+// sigma for Cp/Cpk and the overall sample standard deviation for Pp/Ppk
+func Capable(values []float64, sigmaWithin float64, lsl, usl *float64) Capability {
+	c := Capability{N: len(values), SigmaWithin: sigmaWithin, LSL: lsl, USL: usl}
+	if len(values) == 0 {
+		return c
+	}
+	c.Mean = mean(values)
+	if len(values) > 1 {
+		var ss float64
+		for _, v := range values {
+			ss += (v - c.Mean) * (v - c.Mean)
+		}
+		c.SigmaOverall = math.Sqrt(ss / float64(len(values)-1))
+	}
+	for _, v := range values {
+		if (lsl != nil && v < *lsl) || (usl != nil && v > *usl) {
+			c.OutOfSpec++
+		}
+	}
+
+	c.Cp, c.Cpk = indices(c.Mean, sigmaWithin, lsl, usl)
+	c.Pp, c.Ppk = indices(c.Mean, c.SigmaOverall, lsl, usl)
+	return c
+}
+
+// indices returns the potential (needs both limits) and the performance
+// index (the worse side of those given) for a sigma
+func indices(mean, sigma float64, lsl, usl *float64) (potential, performance *float64) {
+	if sigma <= 0 {
+		return nil, nil
+	}
+	if lsl != nil && usl != nil {
+		p := (*usl - *lsl) / (6 * sigma)
+		potential = &p
+	}
+	k := math.Inf(1)
+	if usl != nil {
+		k = (*usl - mean) / (3 * sigma)
+	}
+	if lsl != nil {
+		k = math.Min(k, (mean-*lsl)/(3*sigma))
+	}
+	if !math.IsInf(k, 1) {
+		performance = &k
+	}
+	return potential, performance
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func pointMean(points []Point) float64 {
+	var sum float64
+	for _, p := range points {
+		sum += p.Value
+	}
+	return sum / float64(len(points))
+}
@@ -0,0 +1,166 @@
+package spc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func groupsOf(values ...[]float64) []Subgroup {
+	groups := make([]Subgroup, len(values))
+	for i, v := range values {
+		groups[i] = Subgroup{No: i + 1, Values: v}
+	}
+	return groups
+}
+
+func rules(violations []Violation) []int {
+	var out []int
+	for _, v := range violations {
+		out = append(out, v.Rule)
+	}
+	return out
+}
+
+func TestXbarR(t *testing.T) {
+	groups := groupsOf(
+		[]float64{10.0, 10.2, 9.8, 10.1, 9.9},
+		[]float64{10.1, 10.3, 9.9, 10.0, 10.2},
+		[]float64{9.9, 10.0, 9.7, 10.1, 9.8},
+		[]float64{10.0}, // incomplete, still being measured
+	)
+
+	xbar, r, sigma, err := XbarR(groups, 5)
+	require.NoError(t, err)
+	require.Len(t, xbar.Points, 3)
+	assert.InDelta(t, 10.0, xbar.Points[0].Value, 1e-9)
+	assert.InDelta(t, 0.4, r.Points[0].Value, 1e-9)
+
+	// R̄ = 0.4, X̄̄ = 10.0
+	assert.InDelta(t, 10.0, xbar.Center, 1e-9)
+	assert.InDelta(t, 10.0+0.577*0.4, xbar.UCL, 1e-9)
+	assert.InDelta(t, 10.0-0.577*0.4, xbar.LCL, 1e-9)
+	assert.InDelta(t, 0.4, r.Center, 1e-9)
+	assert.InDelta(t, 2.114*0.4, r.UCL, 1e-9)
+	assert.Equal(t, 0.0, r.LCL)
+	assert.InDelta(t, 0.4/2.326, sigma, 1e-9)
+
+	_, _, _, err = XbarR(groups[:1], 5)
+	assert.ErrorIs(t, err, ErrTooFewSubgroups)
+	_, _, _, err = XbarR(groups, 11)
+	assert.ErrorIs(t, err, ErrSubgroupSize)
+}
+
+func TestIMR(t *testing.T) {
+	groups := groupsOf([]float64{40}, []float64{42}, []float64{41}, []float64{43})
+
+	i, mr, sigma, err := IMR(groups)
+	require.NoError(t, err)
+	require.Len(t, mr.Points, 3)
+	assert.Equal(t, 2, mr.Points[0].Subgroup)
+
+	// MR̄ = (2+1+2)/3
+	mrbar := 5.0 / 3
+	assert.InDelta(t, 41.5, i.Center, 1e-9)
+	assert.InDelta(t, mrbar/1.128, sigma, 1e-9)
+	assert.InDelta(t, 41.5+3*mrbar/1.128, i.UCL, 1e-9)
+	assert.InDelta(t, 3.267*mrbar, mr.UCL, 1e-9)
+}
+
+func TestWesternElectric(t *testing.T) {
+	chart := func(values ...float64) Chart {
+		c := Chart{Chart: ChartXbar, Center: 0, UCL: 3, LCL: -3}
+		for i, v := range values {
+			c.Points = append(c.Points, Point{Subgroup: i + 1, Value: v})
+		}
+		return c
+	}
+
+	t.Run("beyond limits", func(t *testing.T) {
+		v := WesternElectric(chart(0.5, -3.5, 0.2))
+		require.Len(t, v, 1)
+		assert.Equal(t, RuleBeyondLimits, v[0].Rule)
+		assert.Equal(t, 2, v[0].Subgroup)
+	})
+
+	t.Run("two of three", func(t *testing.T) {
+		v := WesternElectric(chart(2.5, 0.5, 2.2))
+		assert.Equal(t, []int{RuleTwoOfThree}, rules(v))
+		assert.Equal(t, 3, v[0].Subgroup)
+
+		// on opposite sides they do not count together
+		assert.Empty(t, WesternElectric(chart(2.5, 0.5, -2.2)))
+	})
+
+	t.Run("four of five", func(t *testing.T) {
+		v := WesternElectric(chart(1.5, 1.2, -0.5, 1.1, 1.8))
+		assert.Equal(t, []int{RuleFourOfFive}, rules(v))
+		assert.Equal(t, 5, v[0].Subgroup)
+	})
+
+	t.Run("eight in a row", func(t *testing.T) {
+		v := WesternElectric(chart(-0.1, 0.2, 0.3, 0.1, 0.4, 0.2, 0.3, 0.1, 0.5, 0.2))
+		assert.Equal(t, []int{RuleEightInARow}, rules(v))
+		assert.Equal(t, 9, v[0].Subgroup)
+	})
+
+	t.Run("in control", func(t *testing.T) {
+		assert.Empty(t, WesternElectric(chart(0.5, -0.4, 1.2, -1.1, 0.3, -0.2, 0.8, -0.9)))
+	})
+}
+
+func TestBeyondLimits(t *testing.T) {
+	r := Chart{Chart: ChartRange, Center: 1, UCL: 2, LCL: 0,
+		Points: []Point{{1, 0}, {2, 2.5}, {3, 1}}}
+	v := BeyondLimits(r)
+	require.Len(t, v, 1)
+	assert.Equal(t, 2, v[0].Subgroup)
+}
+
+func TestCapable(t *testing.T) {
+	lsl, usl := 9.0, 11.0
+	values := []float64{9.8, 10.0, 10.2, 10.0}
+
+	c := Capable(values, 0.2, &lsl, &usl)
+	assert.Equal(t, 4, c.N)
+	assert.InDelta(t, 10.0, c.Mean, 1e-9)
+	require.NotNil(t, c.Cp)
+	assert.InDelta(t, 2.0/1.2, *c.Cp, 1e-9)
+	assert.InDelta(t, 1.0/0.6, *c.Cpk, 1e-9)
+	assert.InDelta(t, 0.163299, c.SigmaOverall, 1e-6)
+	assert.InDelta(t, 2.0/(6*c.SigmaOverall), *c.Pp, 1e-9)
+	assert.Equal(t, 0, c.OutOfSpec)
+
+	// one-sided specification, e.g. a minimum hardness
+	c = Capable([]float64{8.5, 10, 10.5}, 0.5, &lsl, nil)
+	assert.Nil(t, c.Cp)
+	assert.Nil(t, c.Pp)
+	require.NotNil(t, c.Cpk)
+	assert.InDelta(t, (c.Mean-9)/1.5, *c.Cpk, 1e-9)
+	assert.Equal(t, 1, c.OutOfSpec)
+}
+
+func TestAnalyze(t *testing.T) {
+	usl := 10.5
+	groups := groupsOf(
+		[]float64{10.0, 10.2}, []float64{10.1, 9.9}, []float64{10.0, 10.1},
+		[]float64{9.9, 10.0}, []float64{12.0, 12.1},
+	)
+
+	a, err := Analyze(groups, 2, nil, &usl)
+	require.NoError(t, err)
+	assert.Equal(t, ChartXbarR, a.ChartType)
+	assert.Equal(t, 5, a.Subgroups)
+	require.Len(t, a.Charts, 2)
+	assert.Contains(t, rules(a.Violations), RuleBeyondLimits)
+	assert.Equal(t, 2, a.Capability.OutOfSpec)
+
+	a, err = Analyze(groups, 1, nil, &usl)
+	require.NoError(t, err)
+	assert.Equal(t, ChartIMR, a.ChartType)
+	assert.Equal(t, ChartIndividual, a.Charts[0].Chart)
+
+	_, err = Analyze(groups, 0, nil, nil)
+	assert.ErrorIs(t, err, ErrSubgroupSize)
+}
@@ -0,0 +1,178 @@
+// Package subcontract keeps the balance of material sent to a
+// subcontractor for processing, such as plating or heat treatment, and
+// what came back. Processing changes the weight of the parts: plating adds
+// a coating, heat treatment burns off scale. Receipts are compared with
+// the weight change and yield expected of the process, and the processing
+// fee is charged per piece, per kilogram or per lot.
+package subcontract
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Fee bases
+const (
+	BasisPiece = "piece"
+	BasisKg    = "kg"
+	BasisLot   = "lot"
+)
+
+// Deviation codes
+const (
+	CodeOverReceived = "over_received"
+	CodeWeightChange = "weight_change_out_of_range"
+	CodeYield        = "yield_below_minimum"
+)
+
+// ErrInvalidFee is returned for unknown fee bases and negative rates
+var ErrInvalidFee = errors.New("invalid subcontract fee")
+
+// Fee is what a subcontractor charges for processing
+type Fee struct {
+	Basis   string  `json:"basis"` // piece, kg, lot
+	Rate    float64 `json:"rate"`
+	Minimum float64 `json:"minimum"` // minimum charge per receipt
+}
+
+// Validate checks the basis is known and the amounts are not negative
+func (f Fee) Validate() error {
+	switch f.Basis {
+	case BasisPiece, BasisKg, BasisLot:
+	default:
+		return fmt.Errorf("%w: unknown basis %q", ErrInvalidFee, f.Basis)
+	}
+	if f.Rate < 0 || f.Minimum < 0 {
+		return fmt.Errorf("%w: rate and minimum must not be negative", ErrInvalidFee)
+	}
+	return nil
+}
+
+// Charge is the fee of one receipt
+type Charge struct {
+	Quantity float64 `json:"quantity"` // pieces, kilograms or 1 lot charged
+	Amount   float64 `json:"amount"`
+}
+
+// Charge prices a receipt of quantity pieces weighing weightKg. Scrapped
+// pieces were processed too and are charged like good ones.
+func (f Fee) Charge(quantity, scrap, weightKg float64) Charge {
+	var c Charge
+	switch f.Basis {
+	case BasisKg:
+		c.Quantity = weightKg
+		if quantity > 0 {
+			c.Quantity = weightKg * (quantity + scrap) / quantity
+		}
+	case BasisLot:
+		c.Quantity = 1
+	default:
+		c.Quantity = quantity + scrap
+	}
+	c.Quantity = math.Round(c.Quantity*1000) / 1000
+	c.Amount = round(c.Quantity * f.Rate)
+	if c.Amount < f.Minimum {
+		c.Amount = f.Minimum
+	}
+	return c
+}
+
+// Expectation is how a process is expected to treat the parts
+type Expectation struct {
+	// WeightChangePct is the expected weight change in percent, positive
+	// for a gain
+	WeightChangePct float64 `json:"weight_change_pct"`
+	// WeightTolerancePct is how many percentage points the change may
+	// deviate; 0 leaves the weight unchecked
+	WeightTolerancePct float64 `json:"weight_tolerance_pct"`
+	// MinYieldPct is the lowest acceptable share of good parts; 0 leaves
+	// the yield unchecked
+	MinYieldPct float64 `json:"min_yield_pct"`
+}
+
+// Balance is the material of an order shipped and returned so far
+type Balance struct {
+	ShippedQuantity  float64 `json:"shipped_quantity"`
+	ShippedWeight    float64 `json:"shipped_weight"` // kg
+	ReceivedQuantity float64 `json:"received_quantity"`
+	ReceivedWeight   float64 `json:"received_weight"` // kg
+	ScrapQuantity    float64 `json:"scrap_quantity"`  // scrapped or lost at the subcontractor
+}
+
+// AtVendor is the quantity still at the subcontractor
+func (b Balance) AtVendor() float64 {
+	return math.Max(0, b.ShippedQuantity-b.ReceivedQuantity-b.ScrapQuantity)
+}
+
+// YieldPct is the share of good parts among those returned or scrapped,
+// 0 before any came back
+func (b Balance) YieldPct() float64 {
+	processed := b.ReceivedQuantity + b.ScrapQuantity
+	if processed <= 0 {
+		return 0
+	}
+	return round(b.ReceivedQuantity / processed * 100)
+}
+
+// WeightChangePct is the change of the received weight against the
+// shipped weight of as many pieces, 0 when either weight is unknown
+func (b Balance) WeightChangePct() float64 {
+	if b.ShippedQuantity <= 0 || b.ShippedWeight <= 0 || b.ReceivedQuantity <= 0 || b.ReceivedWeight <= 0 {
+		return 0
+	}
+	expected := b.ShippedWeight / b.ShippedQuantity * b.ReceivedQuantity
+	return round((b.ReceivedWeight - expected) / expected * 100)
+}
+
+// Deviation is a way the returned material differs from what was shipped
+// or expected
+type Deviation struct {
+	Code     string  `json:"code"`
+	Expected float64 `json:"expected"`
+	Actual   float64 `json:"actual"`
+	Message  string  `json:"message"`
+}
+
+// epsilon absorbs floating point noise in quantity comparisons
+const epsilon = 1e-9
+
+// Check compares a balance with the expectation of its process
+func Check(b Balance, e Expectation) []Deviation {
+	var out []Deviation
+	if returned := b.ReceivedQuantity + b.ScrapQuantity; returned > b.ShippedQuantity+epsilon {
+		out = append(out, Deviation{
+			Code:     CodeOverReceived,
+			Expected: b.ShippedQuantity,
+			Actual:   returned,
+			Message:  fmt.Sprintf("%g returned or scrapped exceeds the %g shipped", returned, b.ShippedQuantity),
+		})
+	}
+	if e.WeightTolerancePct > 0 && b.ShippedWeight > 0 && b.ReceivedWeight > 0 {
+		change := b.WeightChangePct()
+		if math.Abs(change-e.WeightChangePct) > e.WeightTolerancePct+epsilon {
+			out = append(out, Deviation{
+				Code:     CodeWeightChange,
+				Expected: e.WeightChangePct,
+				Actual:   change,
+				Message: fmt.Sprintf("weight changed %+.2f%%, expected %+.2f%% ± %g",
+					change, e.WeightChangePct, e.WeightTolerancePct),
+			})
+		}
+	}
+	if e.MinYieldPct > 0 && b.ReceivedQuantity+b.ScrapQuantity > 0 {
+		if y := b.YieldPct(); y < e.MinYieldPct-epsilon {
+			out = append(out, Deviation{
+				Code:     CodeYield,
+				Expected: e.MinYieldPct,
+				Actual:   y,
+				Message:  fmt.Sprintf("yield %.2f%% is below the minimum %g%%", y, e.MinYieldPct),
+			})
+		}
+	}
+	return out
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,58 @@
+package subcontract
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeeCharge(t *testing.T) {
+	piece := Fee{Basis: BasisPiece, Rate: 0.05, Minimum: 500}
+	assert.Equal(t, Charge{Quantity: 10200, Amount: 510}, piece.Charge(10000, 200, 0))
+	assert.Equal(t, Charge{Quantity: 1000, Amount: 500}, piece.Charge(1000, 0, 0), "minimum charge")
+
+	// scrapped parts are charged at the weight of the good ones
+	kg := Fee{Basis: BasisKg, Rate: 12}
+	assert.Equal(t, Charge{Quantity: 500, Amount: 6000}, kg.Charge(9800, 200, 490))
+
+	lot := Fee{Basis: BasisLot, Rate: 3000}
+	assert.Equal(t, Charge{Quantity: 1, Amount: 3000}, lot.Charge(9800, 200, 490))
+}
+
+func TestFeeValidate(t *testing.T) {
+	assert.NoError(t, Fee{Basis: BasisKg, Rate: 12}.Validate())
+	assert.ErrorIs(t, Fee{Basis: "ton", Rate: 12}.Validate(), ErrInvalidFee)
+	assert.ErrorIs(t, Fee{Basis: BasisPiece, Rate: -1}.Validate(), ErrInvalidFee)
+}
+
+func TestBalance(t *testing.T) {
+	b := Balance{ShippedQuantity: 10000, ShippedWeight: 500, ReceivedQuantity: 6000, ReceivedWeight: 301.5, ScrapQuantity: 100}
+	assert.Equal(t, 3900.0, b.AtVendor())
+	assert.Equal(t, 98.36, b.YieldPct())
+	assert.Equal(t, 0.5, b.WeightChangePct(), "6000 pieces shipped at 300 kg came back at 301.5 kg")
+
+	assert.Equal(t, 0.0, Balance{ShippedQuantity: 100}.YieldPct())
+	assert.Equal(t, 0.0, Balance{ShippedQuantity: 100, ReceivedQuantity: 100, ReceivedWeight: 5}.WeightChangePct())
+}
+
+func TestCheck(t *testing.T) {
+	plating := Expectation{WeightChangePct: 0.5, WeightTolerancePct: 0.3, MinYieldPct: 99}
+	b := Balance{ShippedQuantity: 10000, ShippedWeight: 500, ReceivedQuantity: 9950, ReceivedWeight: 500, ScrapQuantity: 50}
+	assert.Empty(t, Check(b, plating))
+
+	b.ReceivedQuantity, b.ReceivedWeight, b.ScrapQuantity = 9800, 480, 200
+	deviations := Check(b, plating)
+	require.Len(t, deviations, 2)
+	assert.Equal(t, CodeWeightChange, deviations[0].Code)
+	assert.Equal(t, -2.04, deviations[0].Actual)
+	assert.Equal(t, CodeYield, deviations[1].Code)
+	assert.Equal(t, 98.0, deviations[1].Actual)
+
+	// unchecked without tolerances, but returning more than shipped is
+	// always a deviation
+	b.ScrapQuantity = 300
+	deviations = Check(b, Expectation{})
+	require.Len(t, deviations, 1)
+	assert.Equal(t, CodeOverReceived, deviations[0].Code)
+}
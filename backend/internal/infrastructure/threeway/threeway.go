@@ -0,0 +1,247 @@
+// Package threeway matches supplier invoices against their purchase order
+// and the goods received on it. An invoice line matches when its unit
+// price is within the price tolerance of the order price and the quantity
+// invoiced so far on the order line is covered, within the quantity
+// tolerance, by both the quantity ordered and the quantity received and
+// accepted. Every deviation is reported as a discrepancy with a reason.
+package threeway
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Discrepancy codes
+const (
+	CodeSupplier     = "supplier_mismatch"
+	CodeCurrency     = "currency_mismatch"
+	CodeNoLines      = "no_lines"
+	CodeUnknownLine  = "unknown_order_line"
+	CodePrice        = "price_variance"
+	CodeOverOrdered  = "quantity_over_ordered"
+	CodeNotReceived  = "quantity_not_received"
+	CodeLot          = "lot_not_received"
+	CodeSubTotal     = "subtotal_mismatch"
+	CodeOrderNotOpen = "order_not_open"
+)
+
+// ErrInvalidTolerance is returned for negative tolerances
+var ErrInvalidTolerance = errors.New("invalid match tolerance")
+
+// Tolerance is how far an invoice may deviate and still match
+type Tolerance struct {
+	// PricePct is the allowed deviation of an invoice unit price from the
+	// order price in percent, either way
+	PricePct float64 `json:"price_pct"`
+	// QuantityPct is the percentage by which the quantity invoiced may
+	// exceed the quantity ordered or received
+	QuantityPct float64 `json:"quantity_pct"`
+	// Amount is the allowed difference between the invoice subtotal and
+	// the sum of its lines, for rounding
+	Amount float64 `json:"amount"`
+}
+
+// DefaultTolerance allows 2% on price, 5% on quantity and 1.00 of rounding
+func DefaultTolerance() Tolerance {
+	return Tolerance{PricePct: 2, QuantityPct: 5, Amount: 1}
+}
+
+// Validate checks the tolerances are not negative
+func (t Tolerance) Validate() error {
+	if t.PricePct < 0 || t.QuantityPct < 0 || t.Amount < 0 {
+		return fmt.Errorf("%w: tolerances must not be negative", ErrInvalidTolerance)
+	}
+	return nil
+}
+
+// OrderLine is a purchase order line with what was received and invoiced
+// on it before
+type OrderLine struct {
+	ID                 string   `json:"id"`
+	Description        string   `json:"description"`
+	Ordered            float64  `json:"ordered"`
+	UnitPrice          float64  `json:"unit_price"`
+	Received           float64  `json:"received"` // received and accepted
+	PreviouslyInvoiced float64  `json:"previously_invoiced"`
+	Lots               []string `json:"lots"` // lot numbers received
+}
+
+// Order is the purchase order side of the match
+type Order struct {
+	SupplierID string      `json:"supplier_id"`
+	Currency   string      `json:"currency"`
+	Open       bool        `json:"open"` // neither a draft nor cancelled
+	Lines      []OrderLine `json:"lines"`
+}
+
+// InvoiceLine is a supplier invoice line referring to an order line
+type InvoiceLine struct {
+	ID          string  `json:"id"`
+	OrderLineID string  `json:"order_line_id"`
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	LotNo       string  `json:"lot_no"`
+}
+
+// Invoice is the supplier invoice side of the match
+type Invoice struct {
+	SupplierID string        `json:"supplier_id"`
+	Currency   string        `json:"currency"`
+	SubTotal   float64       `json:"sub_total"`
+	Lines      []InvoiceLine `json:"lines"`
+}
+
+// Discrepancy is a reason an invoice does not match
+type Discrepancy struct {
+	Code          string `json:"code"`
+	InvoiceLineID string `json:"invoice_line_id,omitempty"`
+	OrderLineID   string `json:"order_line_id,omitempty"`
+	Message       string `json:"message"`
+}
+
+// LineResult is an invoice line compared with its order line
+type LineResult struct {
+	InvoiceLineID      string   `json:"invoice_line_id"`
+	OrderLineID        string   `json:"order_line_id"`
+	Invoiced           float64  `json:"invoiced"`
+	PreviouslyInvoiced float64  `json:"previously_invoiced"` // before this line
+	Ordered            float64  `json:"ordered"`
+	Received           float64  `json:"received"`
+	InvoicePrice       float64  `json:"invoice_price"`
+	OrderPrice         float64  `json:"order_price"`
+	PriceVariancePct   float64  `json:"price_variance_pct"`
+	Matched            bool     `json:"matched"`
+	Reasons            []string `json:"reasons"`
+}
+
+// Result is the outcome of a match
+type Result struct {
+	Matched       bool          `json:"matched"`
+	Lines         []LineResult  `json:"lines"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// Reasons returns the discrepancy messages as one line each
+func (r Result) Reasons() string {
+	messages := make([]string, 0, len(r.Discrepancies))
+	for _, d := range r.Discrepancies {
+		messages = append(messages, d.Message)
+	}
+	return strings.Join(messages, "\n")
+}
+
+// epsilon absorbs floating point noise in quantity comparisons
+const epsilon = 1e-9
+
+// Match matches an invoice against its order within the tolerances
+func Match(order Order, invoice Invoice, t Tolerance) Result {
+	r := Result{Lines: []LineResult{}, Discrepancies: []Discrepancy{}}
+	add := func(d Discrepancy) {
+		r.Discrepancies = append(r.Discrepancies, d)
+	}
+
+	if !order.Open {
+		add(Discrepancy{Code: CodeOrderNotOpen, Message: "the purchase order is a draft or cancelled"})
+	}
+	if invoice.SupplierID != order.SupplierID {
+		add(Discrepancy{Code: CodeSupplier, Message: "the invoice is from another supplier than the purchase order"})
+	}
+	if !strings.EqualFold(invoice.Currency, order.Currency) {
+		add(Discrepancy{Code: CodeCurrency, Message: fmt.Sprintf("invoiced in %s, ordered in %s", invoice.Currency, order.Currency)})
+	}
+	if len(invoice.Lines) == 0 {
+		add(Discrepancy{Code: CodeNoLines, Message: "the invoice has no lines"})
+	}
+
+	lines := make(map[string]OrderLine, len(order.Lines))
+	invoiced := make(map[string]float64, len(order.Lines))
+	for _, l := range order.Lines {
+		lines[l.ID] = l
+		invoiced[l.ID] = l.PreviouslyInvoiced
+	}
+
+	var sum float64
+	for _, il := range invoice.Lines {
+		sum += il.Quantity * il.UnitPrice
+		ol, ok := lines[il.OrderLineID]
+		if !ok {
+			reason := fmt.Sprintf("%s is not on the purchase order", lineName(il))
+			add(Discrepancy{Code: CodeUnknownLine, InvoiceLineID: il.ID, Message: reason})
+			r.Lines = append(r.Lines, LineResult{
+				InvoiceLineID: il.ID,
+				Invoiced:      il.Quantity,
+				InvoicePrice:  il.UnitPrice,
+				Reasons:       []string{reason},
+			})
+			continue
+		}
+
+		lr := LineResult{
+			InvoiceLineID:      il.ID,
+			OrderLineID:        ol.ID,
+			Invoiced:           il.Quantity,
+			PreviouslyInvoiced: invoiced[ol.ID],
+			Ordered:            ol.Ordered,
+			Received:           ol.Received,
+			InvoicePrice:       il.UnitPrice,
+			OrderPrice:         ol.UnitPrice,
+			Reasons:            []string{},
+		}
+		flag := func(code, reason string) {
+			lr.Reasons = append(lr.Reasons, reason)
+			add(Discrepancy{Code: code, InvoiceLineID: il.ID, OrderLineID: ol.ID, Message: reason})
+		}
+
+		if ol.UnitPrice > 0 {
+			lr.PriceVariancePct = math.Round((il.UnitPrice-ol.UnitPrice)/ol.UnitPrice*10000) / 100
+		} else if il.UnitPrice > 0 {
+			lr.PriceVariancePct = 100
+		}
+		if math.Abs(lr.PriceVariancePct) > t.PricePct+epsilon {
+			flag(CodePrice, fmt.Sprintf("%s: unit price %g deviates %+.2f%% from the ordered %g (tolerance %g%%)",
+				lineName(il), il.UnitPrice, lr.PriceVariancePct, ol.UnitPrice, t.PricePct))
+		}
+
+		cumulative := invoiced[ol.ID] + il.Quantity
+		invoiced[ol.ID] = cumulative
+		allowance := 1 + t.QuantityPct/100
+		if cumulative > ol.Ordered*allowance+epsilon {
+			flag(CodeOverOrdered, fmt.Sprintf("%s: %g invoiced in total exceeds the %g ordered", lineName(il), cumulative, ol.Ordered))
+		}
+		if cumulative > ol.Received*allowance+epsilon {
+			flag(CodeNotReceived, fmt.Sprintf("%s: %g invoiced in total exceeds the %g received and accepted", lineName(il), cumulative, ol.Received))
+		}
+		if il.LotNo != "" && !contains(ol.Lots, il.LotNo) {
+			flag(CodeLot, fmt.Sprintf("%s: lot %s was not received on the order line", lineName(il), il.LotNo))
+		}
+
+		lr.Matched = len(lr.Reasons) == 0
+		r.Lines = append(r.Lines, lr)
+	}
+
+	if len(invoice.Lines) > 0 && math.Abs(invoice.SubTotal-sum) > t.Amount+epsilon {
+		add(Discrepancy{Code: CodeSubTotal, Message: fmt.Sprintf("the invoice subtotal %.2f differs from its lines totalling %.2f", invoice.SubTotal, sum)})
+	}
+
+	r.Matched = len(r.Discrepancies) == 0
+	return r
+}
+
+func lineName(l InvoiceLine) string {
+	if l.Description != "" {
+		return l.Description
+	}
+	return "invoice line " + l.ID
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if strings.EqualFold(strings.TrimSpace(s), strings.TrimSpace(v)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package threeway
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testOrder() Order {
+	return Order{
+		SupplierID: "s1",
+		Currency:   "TWD",
+		Open:       true,
+		Lines: []OrderLine{
+			{ID: "rod", Description: "SWCH10A wire rod", Ordered: 1000, UnitPrice: 30, Received: 1000, Lots: []string{"H2401"}},
+			{ID: "plating", Description: "Zinc plating", Ordered: 500, UnitPrice: 2, Received: 300},
+		},
+	}
+}
+
+func codes(r Result) []string {
+	var out []string
+	for _, d := range r.Discrepancies {
+		out = append(out, d.Code)
+	}
+	return out
+}
+
+func TestMatch(t *testing.T) {
+	invoice := Invoice{
+		SupplierID: "s1",
+		Currency:   "twd",
+		SubTotal:   30612.4,
+		Lines: []InvoiceLine{
+			{ID: "1", OrderLineID: "rod", Quantity: 1000, UnitPrice: 30, LotNo: "h2401"},
+			{ID: "2", OrderLineID: "plating", Quantity: 300, UnitPrice: 2.04}, // 2% over
+		},
+	}
+	r := Match(testOrder(), invoice, DefaultTolerance())
+	assert.True(t, r.Matched, r.Reasons())
+	require.Len(t, r.Lines, 2)
+	assert.True(t, r.Lines[1].Matched)
+	assert.Equal(t, 2.0, r.Lines[1].PriceVariancePct)
+}
+
+func TestMatchDiscrepancies(t *testing.T) {
+	order := testOrder()
+	order.Lines[1].PreviouslyInvoiced = 200
+
+	invoice := Invoice{
+		SupplierID: "s2",
+		Currency:   "USD",
+		SubTotal:   100,
+		Lines: []InvoiceLine{
+			{ID: "1", OrderLineID: "rod", Description: "Wire rod", Quantity: 1000, UnitPrice: 31, LotNo: "H9999"},
+			{ID: "2", OrderLineID: "plating", Description: "Plating", Quantity: 200, UnitPrice: 2},
+			{ID: "3", OrderLineID: "freight", Description: "Freight", Quantity: 1, UnitPrice: 50},
+		},
+	}
+	r := Match(order, invoice, DefaultTolerance())
+	assert.False(t, r.Matched)
+	assert.ElementsMatch(t, []string{
+		CodeSupplier, CodeCurrency,
+		CodePrice, CodeLot, // rod: 3.33% over and an unknown lot
+		CodeNotReceived, // plating: 400 invoiced in total, 300 received
+		CodeUnknownLine, CodeSubTotal,
+	}, codes(r))
+
+	assert.Equal(t, 3.33, r.Lines[0].PriceVariancePct)
+	assert.Equal(t, 200.0, r.Lines[1].PreviouslyInvoiced)
+	assert.False(t, r.Lines[2].Matched)
+	assert.Contains(t, r.Reasons(), "400 invoiced in total exceeds the 300 received and accepted")
+}
+
+func TestMatchQuantityTolerance(t *testing.T) {
+	order := testOrder()
+	invoice := Invoice{SupplierID: "s1", Currency: "TWD", SubTotal: 31500, Lines: []InvoiceLine{
+		{ID: "1", OrderLineID: "rod", Quantity: 1050, UnitPrice: 30},
+	}}
+	assert.True(t, Match(order, invoice, DefaultTolerance()).Matched, "5% over is within tolerance")
+
+	// lines of one invoice on the same order line add up
+	invoice.Lines = append(invoice.Lines, InvoiceLine{ID: "2", OrderLineID: "rod", Quantity: 1, UnitPrice: 30})
+	invoice.SubTotal = 31530
+	assert.ElementsMatch(t, []string{CodeOverOrdered, CodeNotReceived}, codes(Match(order, invoice, DefaultTolerance())))
+}
+
+func TestMatchClosedOrderWithoutLines(t *testing.T) {
+	order := testOrder()
+	order.Open = false
+	r := Match(order, Invoice{SupplierID: "s1", Currency: "TWD"}, DefaultTolerance())
+	assert.ElementsMatch(t, []string{CodeOrderNotOpen, CodeNoLines}, codes(r))
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, DefaultTolerance().Validate())
+	assert.ErrorIs(t, Tolerance{PricePct: -1}.Validate(), ErrInvalidTolerance)
+}
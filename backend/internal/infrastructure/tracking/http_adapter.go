@@ -0,0 +1,71 @@
+package tracking
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPAdapter polls a carrier tracking endpoint that returns JSON, CSV or
+// IFTSTA documents. The URL template may contain {tracking_no} and
+// {container_no} placeholders.
+type HTTPAdapter struct {
+	CarrierName string
+	URLTemplate string
+	Format      string
+	Fields      FieldMap
+	Headers     map[string]string
+	Client      *http.Client
+}
+
+// NewHTTPAdapter creates an adapter with a default HTTP client
+func NewHTTPAdapter(carrierName, urlTemplate, format string, fields FieldMap, headers map[string]string) *HTTPAdapter {
+	return &HTTPAdapter{
+		CarrierName: carrierName,
+		URLTemplate: urlTemplate,
+		Format:      format,
+		Fields:      fields,
+		Headers:     headers,
+		Client:      &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name returns the carrier name
+func (a *HTTPAdapter) Name() string {
+	return a.CarrierName
+}
+
+// Fetch requests the tracking document for a shipment and parses its events
+func (a *HTTPAdapter) Fetch(ctx context.Context, ref Reference) ([]Event, error) {
+	target := strings.NewReplacer(
+		"{tracking_no}", url.QueryEscape(ref.TrackingNo),
+		"{container_no}", url.QueryEscape(ref.ContainerNo),
+	).Replace(a.URLTemplate)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range a.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s tracking request failed: %w", a.CarrierName, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s tracking request failed: status %d: %s", a.CarrierName, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return Parse(a.Format, resp.Body, a.Fields)
+}
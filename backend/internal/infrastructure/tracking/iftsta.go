@@ -0,0 +1,186 @@
+package tracking
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// edifactSyntax holds the separators of an EDIFACT interchange
+type edifactSyntax struct {
+	component byte
+	element   byte
+	release   byte
+	segment   byte
+}
+
+var defaultEdifactSyntax = edifactSyntax{component: ':', element: '+', release: '?', segment: '\''}
+
+// ParseIFTSTA reads status events from an EDIFACT IFTSTA message. Each STS
+// segment starts an event; the DTM, LOC, RFF and EQD segments that follow it
+// belong to that event. References given before the first STS of a consignment
+// (CNI group) apply to all of its events.
+func ParseIFTSTA(r io.Reader) ([]Event, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimLeft(string(data), "\ufeff \r\n\t")
+
+	syntax := defaultEdifactSyntax
+	if strings.HasPrefix(text, "UNA") && len(text) >= 9 {
+		syntax = edifactSyntax{component: text[3], element: text[4], release: text[6], segment: text[8]}
+		text = text[9:]
+	}
+
+	var events []Event
+	var consignmentRefs []string
+	var current *Event
+	flush := func() {
+		if current != nil {
+			events = append(events, *current)
+			current = nil
+		}
+	}
+
+	for _, segment := range splitEscaped(text, syntax.segment, syntax.release) {
+		segment = strings.TrimSpace(segment)
+		if segment == "" {
+			continue
+		}
+		elements := splitEscaped(segment, syntax.element, syntax.release)
+		component := func(element, index int) string {
+			if element >= len(elements) {
+				return ""
+			}
+			parts := splitEscaped(elements[element], syntax.component, syntax.release)
+			if index >= len(parts) {
+				return ""
+			}
+			return unescape(parts[index], syntax.release)
+		}
+
+		switch elements[0] {
+		case "CNI":
+			flush()
+			consignmentRefs = nil
+			if ref := component(2, 0); ref != "" {
+				consignmentRefs = append(consignmentRefs, ref)
+			}
+		case "STS":
+			flush()
+			current = &Event{
+				RawStatus:   component(2, 0),
+				Description: component(2, 3),
+				References:  append([]string(nil), consignmentRefs...),
+			}
+		case "RFF", "EQD":
+			// RFF+BM:<bill of lading>, EQD+CN+<container number>
+			ref := component(1, 1)
+			if elements[0] == "EQD" {
+				ref = component(2, 0)
+			}
+			if ref == "" {
+				continue
+			}
+			if current != nil {
+				current.References = appendReference(current.References, ref)
+			} else {
+				consignmentRefs = appendReference(consignmentRefs, ref)
+			}
+		case "DTM":
+			if current == nil {
+				continue
+			}
+			t, ok := parseEdifactTime(component(1, 1), component(1, 2))
+			if !ok {
+				continue
+			}
+			switch component(1, 0) {
+			case "132": // arrival date/time, estimated
+				current.EstimatedArrival = &t
+			case "334", "178", "136", "11": // status change, actual arrival, actual departure, dispatch
+				if current.EventTime.IsZero() {
+					current.EventTime = t
+				}
+			}
+		case "LOC":
+			if current == nil || current.Location != "" {
+				continue
+			}
+			// LOC+<qualifier>+<code>:<list>:<agency>:<name>
+			current.Location = component(2, 3)
+			if current.Location == "" {
+				current.Location = component(2, 0)
+			}
+		case "FTX":
+			if current != nil && current.Description == "" {
+				current.Description = component(4, 0)
+			}
+		case "UNT", "UNZ":
+			flush()
+		}
+	}
+	flush()
+
+	for i, event := range events {
+		if event.EventTime.IsZero() {
+			return nil, fmt.Errorf("IFTSTA status %d (%s) has no event date", i+1, event.RawStatus)
+		}
+	}
+	return events, nil
+}
+
+// splitEscaped splits s on sep, ignoring separators preceded by the release character
+func splitEscaped(s string, sep, release byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case release:
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescape(s string, release byte) string {
+	if strings.IndexByte(s, release) < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == release && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func parseEdifactTime(value, format string) (time.Time, bool) {
+	layouts := map[string]string{
+		"102": "20060102",
+		"203": "200601021504",
+		"204": "20060102150405",
+	}
+	layout, ok := layouts[format]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(layout, value)
+	return t, err == nil
+}
+
+func appendReference(refs []string, ref string) []string {
+	for _, r := range refs {
+		if r == ref {
+			return refs
+		}
+	}
+	return append(refs, ref)
+}
@@ -0,0 +1,200 @@
+package tracking
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Import formats
+const (
+	FormatJSON   = "json"
+	FormatCSV    = "csv"
+	FormatIFTSTA = "iftsta"
+)
+
+// FieldMap tells the JSON and CSV importers where each event attribute is.
+// For JSON the values are dot separated paths inside an event object, for CSV
+// they are column headers. Empty fields fall back to DefaultFieldMap.
+type FieldMap struct {
+	Events      string `json:"events"` // JSON path to the event array; "." for a top-level array
+	Reference   string `json:"reference"`
+	Container   string `json:"container"`
+	Status      string `json:"status"`
+	Description string `json:"description"`
+	Location    string `json:"location"`
+	Time        string `json:"time"`
+	ETA         string `json:"eta"`
+	TimeLayout  string `json:"time_layout"` // Go time layout; common formats are tried when empty
+}
+
+// DefaultFieldMap returns the field names of the generic tracking format
+func DefaultFieldMap() FieldMap {
+	return FieldMap{
+		Events:      "events",
+		Reference:   "reference",
+		Container:   "container_no",
+		Status:      "status",
+		Description: "description",
+		Location:    "location",
+		Time:        "event_time",
+		ETA:         "eta",
+	}
+}
+
+func (m FieldMap) withDefaults() FieldMap {
+	d := DefaultFieldMap()
+	fill := func(v *string, def string) {
+		if *v == "" {
+			*v = def
+		}
+	}
+	fill(&m.Events, d.Events)
+	fill(&m.Reference, d.Reference)
+	fill(&m.Container, d.Container)
+	fill(&m.Status, d.Status)
+	fill(&m.Description, d.Description)
+	fill(&m.Location, d.Location)
+	fill(&m.Time, d.Time)
+	fill(&m.ETA, d.ETA)
+	return m
+}
+
+// Parse reads events in the given format
+func Parse(format string, r io.Reader, fields FieldMap) ([]Event, error) {
+	switch format {
+	case FormatJSON:
+		return ParseJSON(r, fields)
+	case FormatCSV:
+		return ParseCSV(r, fields)
+	case FormatIFTSTA:
+		return ParseIFTSTA(r)
+	}
+	return nil, fmt.Errorf("unsupported tracking format: %s", format)
+}
+
+// ParseJSON reads events from a JSON document
+func ParseJSON(r io.Reader, fields FieldMap) ([]Event, error) {
+	fields = fields.withDefaults()
+
+	var doc interface{}
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode tracking JSON: %w", err)
+	}
+
+	// Fall back to a top-level array when the configured path is absent
+	items, ok := lookupPath(doc, fields.Events).([]interface{})
+	if !ok {
+		if items, ok = doc.([]interface{}); !ok {
+			return nil, fmt.Errorf("tracking JSON has no event array at %q", fields.Events)
+		}
+	}
+
+	events := make([]Event, 0, len(items))
+	for i, item := range items {
+		get := func(path string) string {
+			return stringify(lookupPath(item, path))
+		}
+		event, err := buildEvent(get, fields)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", i+1, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// ParseCSV reads events from a CSV file with a header row
+func ParseCSV(r io.Reader, fields FieldMap) ([]Event, error) {
+	fields = fields.withDefaults()
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tracking CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	var events []Event
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		get := func(column string) string {
+			if i, ok := columns[strings.ToLower(column)]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		event, err := buildEvent(get, fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func buildEvent(get func(string) string, fields FieldMap) (Event, error) {
+	event := Event{
+		RawStatus:   get(fields.Status),
+		Description: get(fields.Description),
+		Location:    get(fields.Location),
+	}
+	for _, ref := range []string{get(fields.Reference), get(fields.Container)} {
+		if ref != "" {
+			event.References = append(event.References, ref)
+		}
+	}
+
+	t, ok := parseTime(get(fields.Time), fields.TimeLayout)
+	if !ok {
+		return event, fmt.Errorf("invalid or missing %s", fields.Time)
+	}
+	event.EventTime = t
+	if eta, ok := parseTime(get(fields.ETA), fields.TimeLayout); ok {
+		event.EstimatedArrival = &eta
+	}
+	return event, nil
+}
+
+func lookupPath(doc interface{}, path string) interface{} {
+	if path == "" || path == "." {
+		return doc
+	}
+	current := doc
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = obj[key]
+	}
+	return current
+}
+
+func stringify(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(value)
+	case json.Number:
+		return value.String()
+	default:
+		return strings.TrimSpace(fmt.Sprint(value))
+	}
+}
@@ -0,0 +1,173 @@
+// Package tracking imports carrier tracking events and normalizes carrier
+// statuses into shipment milestones.
+package tracking
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Milestones of the shipment lifecycle, in the order they normally occur
+const (
+	MilestoneGateIn         = "gate_in"
+	MilestoneLoaded         = "loaded"
+	MilestoneDeparted       = "departed"
+	MilestoneArrived        = "arrived"
+	MilestoneCustomsCleared = "customs_cleared"
+	MilestoneDelivered      = "delivered"
+)
+
+var milestoneRank = map[string]int{
+	MilestoneGateIn:         1,
+	MilestoneLoaded:         2,
+	MilestoneDeparted:       3,
+	MilestoneArrived:        4,
+	MilestoneCustomsCleared: 5,
+	MilestoneDelivered:      6,
+}
+
+// Rank returns the position of a milestone in the lifecycle, 0 when unknown
+func Rank(milestone string) int {
+	return milestoneRank[milestone]
+}
+
+// Event is a single status report from a carrier
+type Event struct {
+	// References holds every identifier the carrier reported with the event:
+	// tracking, booking, bill of lading or container numbers
+	References       []string
+	RawStatus        string
+	Milestone        string
+	Description      string
+	Location         string
+	EventTime        time.Time
+	EstimatedArrival *time.Time
+}
+
+// Reference identifies a shipment towards a carrier
+type Reference struct {
+	TrackingNo  string
+	ContainerNo string
+}
+
+// Adapter fetches tracking events for a shipment from a carrier
+type Adapter interface {
+	Name() string
+	Fetch(ctx context.Context, ref Reference) ([]Event, error)
+}
+
+// Normalizer maps carrier statuses to milestones. Carrier specific codes can
+// be supplied as overrides; everything else goes through the common codes and
+// keyword rules.
+type Normalizer struct {
+	overrides map[string]string
+}
+
+// NewNormalizer creates a normalizer with carrier specific status overrides
+func NewNormalizer(overrides map[string]string) *Normalizer {
+	n := &Normalizer{overrides: make(map[string]string, len(overrides))}
+	for status, milestone := range overrides {
+		n.overrides[normalizeStatusKey(status)] = milestone
+	}
+	return n
+}
+
+// commonStatusCodes are event codes widely used by ocean carriers in EDI and API feeds
+var commonStatusCodes = map[string]string{
+	"GTIN": MilestoneGateIn,
+	"RCVD": MilestoneGateIn,
+	"LOAD": MilestoneLoaded,
+	"VDL":  MilestoneDeparted,
+	"DEPA": MilestoneDeparted,
+	"VAD":  MilestoneArrived,
+	"ARRI": MilestoneArrived,
+	"DISC": MilestoneArrived,
+	"CUS":  MilestoneCustomsCleared,
+	"CREL": MilestoneCustomsCleared,
+	"DLV":  MilestoneDelivered,
+	"DELI": MilestoneDelivered,
+}
+
+// Milestone returns the milestone for a status, or "" when it has no equivalent
+func (n *Normalizer) Milestone(status string) string {
+	key := normalizeStatusKey(status)
+	if key == "" {
+		return ""
+	}
+	if milestone, ok := n.overrides[key]; ok {
+		return milestone
+	}
+	if milestone, ok := commonStatusCodes[key]; ok {
+		return milestone
+	}
+
+	text := strings.ToLower(status)
+	switch {
+	case strings.Contains(text, "customs") && (strings.Contains(text, "clear") || strings.Contains(text, "releas")):
+		return MilestoneCustomsCleared
+	case strings.Contains(text, "out for delivery"), strings.Contains(text, "delivery attempt"):
+		return ""
+	case strings.Contains(text, "deliver"):
+		return MilestoneDelivered
+	case strings.Contains(text, "gate in"), strings.Contains(text, "gate-in"), strings.Contains(text, "gated in"), strings.Contains(text, "received at"):
+		return MilestoneGateIn
+	case strings.Contains(text, "unload"), strings.Contains(text, "discharg"):
+		return MilestoneArrived
+	case strings.Contains(text, "arriv"):
+		return MilestoneArrived
+	case strings.Contains(text, "depart"), strings.Contains(text, "sailed"):
+		return MilestoneDeparted
+	case strings.Contains(text, "load"):
+		return MilestoneLoaded
+	}
+	return ""
+}
+
+// Apply fills in the milestone of every event from its raw status and description
+func (n *Normalizer) Apply(events []Event) {
+	for i := range events {
+		if events[i].Milestone != "" {
+			continue
+		}
+		events[i].Milestone = n.Milestone(events[i].RawStatus)
+		if events[i].Milestone == "" && events[i].Description != "" {
+			events[i].Milestone = n.Milestone(events[i].Description)
+		}
+	}
+}
+
+func normalizeStatusKey(status string) string {
+	return strings.ToUpper(strings.TrimSpace(status))
+}
+
+// timeLayouts are tried in order when no explicit layout is configured
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04",
+	"2006/01/02",
+	"02/01/2006 15:04",
+	"200601021504",
+	"20060102",
+}
+
+func parseTime(value, layout string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	if layout != "" {
+		t, err := time.Parse(layout, value)
+		return t, err == nil
+	}
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
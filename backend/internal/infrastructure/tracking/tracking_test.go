@@ -0,0 +1,116 @@
+package tracking
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openFixture(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestNormalizerMilestone(t *testing.T) {
+	n := NewNormalizer(map[string]string{"IN TRANSIT": MilestoneDeparted})
+
+	tests := map[string]string{
+		"GTIN":                        MilestoneGateIn,
+		"Loaded on vessel":            MilestoneLoaded,
+		"Unloaded from vessel":        MilestoneArrived,
+		"Vessel departure":            MilestoneDeparted,
+		"in transit":                  MilestoneDeparted,
+		"Customs clearance completed": MilestoneCustomsCleared,
+		"Out for delivery":            "",
+		"Delivered - signed by WEBER": MilestoneDelivered,
+		"Booking confirmed":           "",
+	}
+	for status, want := range tests {
+		assert.Equal(t, want, n.Milestone(status), status)
+	}
+}
+
+func TestParseJSONWithFieldMap(t *testing.T) {
+	fields := FieldMap{
+		Events:      "shipment.events",
+		Reference:   "container",
+		Status:      "code",
+		Description: "text",
+		Location:    "port",
+		Time:        "at",
+	}
+	events, err := ParseJSON(openFixture(t, "carrier_events.json"), fields)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+
+	NewNormalizer(nil).Apply(events)
+	assert.Equal(t, []string{"MSCU1234567"}, events[0].References)
+	assert.Equal(t, MilestoneGateIn, events[0].Milestone)
+	assert.Equal(t, MilestoneLoaded, events[1].Milestone)
+	assert.Equal(t, MilestoneDeparted, events[2].Milestone)
+	require.NotNil(t, events[2].EstimatedArrival)
+	assert.Equal(t, time.Date(2026, 3, 28, 11, 0, 0, 0, time.UTC), events[2].EstimatedArrival.UTC())
+}
+
+func TestParseCSV(t *testing.T) {
+	fields := FieldMap{Reference: "Tracking Number", Time: "Date", Location: "Location"}
+	events, err := ParseCSV(openFixture(t, "carrier_events.csv"), fields)
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+
+	NewNormalizer(map[string]string{"IN TRANSIT": MilestoneDeparted}).Apply(events)
+	milestones := make([]string, len(events))
+	for i, e := range events {
+		milestones[i] = e.Milestone
+	}
+	assert.Equal(t, []string{MilestoneDeparted, MilestoneArrived, MilestoneCustomsCleared, MilestoneDelivered}, milestones)
+	assert.Equal(t, "Stuttgart", events[3].Location)
+	require.NotNil(t, events[0].EstimatedArrival)
+}
+
+func TestParseIFTSTA(t *testing.T) {
+	events, err := ParseIFTSTA(openFixture(t, "iftsta.edi"))
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	NewNormalizer(nil).Apply(events)
+	assert.Equal(t, MilestoneArrived, events[0].Milestone)
+	assert.Equal(t, []string{"MEDUKH123456", "MSCU1234567"}, events[0].References)
+	assert.Equal(t, "Hamburg", events[0].Location)
+	assert.Equal(t, time.Date(2026, 3, 27, 15, 30, 0, 0, time.UTC), events[0].EventTime)
+
+	assert.Equal(t, MilestoneCustomsCleared, events[1].Milestone)
+	assert.Equal(t, "Customs release'd", events[1].Description)
+	require.NotNil(t, events[1].EstimatedArrival)
+}
+
+func TestHTTPAdapterReplaysFixture(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/carrier_events.json")
+	require.NoError(t, err)
+
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		assert.Equal(t, "secret", r.Header.Get("X-API-Key"))
+		w.Write(fixture)
+	}))
+	defer server.Close()
+
+	adapter := NewHTTPAdapter("MSC", server.URL+"/track?bl={tracking_no}", FormatJSON,
+		FieldMap{Events: "shipment.events", Reference: "container", Status: "code", Time: "at"},
+		map[string]string{"X-API-Key": "secret"})
+
+	events, err := adapter.Fetch(context.Background(), Reference{TrackingNo: "MEDUKH123456"})
+	require.NoError(t, err)
+	assert.Equal(t, "/track?bl=MEDUKH123456", requested)
+	assert.Len(t, events, 3)
+}
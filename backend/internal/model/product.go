@@ -19,6 +19,21 @@ type Product struct {
 	Weight       float64   `json:"weight" db:"weight"`
 	Unit         string    `json:"unit" db:"unit"`
 	IsActive     bool      `json:"is_active" db:"is_active"`
+
+	// Packaging used for load planning; dimensions in cm, weights in kg.
+	// Zero pallet dimensions use the standard 120x100 pallet.
+	QuantityPerCarton float64 `json:"quantity_per_carton" db:"quantity_per_carton"`
+	CartonLength      float64 `json:"carton_length" db:"carton_length"`
+	CartonWidth       float64 `json:"carton_width" db:"carton_width"`
+	CartonHeight      float64 `json:"carton_height" db:"carton_height"`
+	CartonGrossWeight float64 `json:"carton_gross_weight" db:"carton_gross_weight"`
+	PalletLength      float64 `json:"pallet_length" db:"pallet_length"`
+	PalletWidth       float64 `json:"pallet_width" db:"pallet_width"`
+	PalletMaxHeight   float64 `json:"pallet_max_height" db:"pallet_max_height"` // including the pallet
+	PalletTareWeight  float64 `json:"pallet_tare_weight" db:"pallet_tare_weight"`
+	PalletMaxWeight   float64 `json:"pallet_max_weight" db:"pallet_max_weight"`
+	CartonsPerPallet  int     `json:"cartons_per_pallet" db:"cartons_per_pallet"` // 0 computes the pattern
+	PalletStackable   bool    `json:"pallet_stackable" db:"pallet_stackable"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 	
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// BankStatement is an imported statement of a bank account
+type BankStatement struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID      uuid.UUID `gorm:"type:uuid;not null;index" json:"company_id"`
+	BankAccountID  uuid.UUID `gorm:"type:uuid;not null;index" json:"bank_account_id"`
+	Format         string    `gorm:"not null" json:"format"` // camt053, mt940, csv
+	StatementNo    string    `json:"statement_no"`
+	FromDate       time.Time `json:"from_date"`
+	ToDate         time.Time `json:"to_date"`
+	Currency       string    `gorm:"not null" json:"currency"`
+	OpeningBalance float64   `json:"opening_balance"`
+	ClosingBalance float64   `json:"closing_balance"`
+	HasBalances    bool      `json:"has_balances"` // the file carried opening and closing balances
+	LineCount      int       `json:"line_count"`
+	FileName       string    `json:"file_name"`
+	FileHash       string    `gorm:"index" json:"file_hash"` // sha256 of the file and statement number, rejects double imports
+	Status         string    `gorm:"not null" json:"status"` // open, reconciled
+	ImportedBy     uuid.UUID `gorm:"type:uuid;not null" json:"imported_by"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Relations
+	BankAccount *BankAccount        `gorm:"foreignKey:BankAccountID" json:"bank_account,omitempty"`
+	Lines       []BankStatementLine `gorm:"foreignKey:StatementID" json:"lines,omitempty"`
+}
+
+// BankStatementLine is a booked transaction of a statement. Amounts are
+// signed: positive for money received, negative for money paid out.
+type BankStatementLine struct {
+	ID                  uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID           uuid.UUID      `gorm:"type:uuid;not null;index" json:"company_id"`
+	StatementID         uuid.UUID      `gorm:"type:uuid;not null;index" json:"statement_id"`
+	BankAccountID       uuid.UUID      `gorm:"type:uuid;not null;index" json:"bank_account_id"`
+	LineNo              int            `json:"line_no"`
+	BookingDate         time.Time      `gorm:"index" json:"booking_date"`
+	ValueDate           time.Time      `json:"value_date"`
+	Amount              float64        `gorm:"not null" json:"amount"`
+	Currency            string         `gorm:"not null" json:"currency"`
+	Reference           string         `json:"reference"`
+	BankReference       string         `json:"bank_reference"`
+	Description         string         `json:"description"`
+	CounterpartyName    string         `json:"counterparty_name"`
+	CounterpartyAccount string         `json:"counterparty_account"`
+	Status              string         `gorm:"not null;index" json:"status"` // unmatched, suggested, partially_reconciled, reconciled, ignored
+	ReconciledAmount    float64        `json:"reconciled_amount"`            // absolute amount allocated so far
+	Suggestions         datatypes.JSON `gorm:"type:jsonb" json:"suggestions"`
+	ReconciledAt        *time.Time     `json:"reconciled_at"`
+	ReconciledBy        *uuid.UUID     `gorm:"type:uuid" json:"reconciled_by"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+
+	// Relations
+	Statement       *BankStatement       `gorm:"foreignKey:StatementID" json:"statement,omitempty"`
+	Reconciliations []BankReconciliation `gorm:"foreignKey:LineID" json:"reconciliations,omitempty"`
+}
+
+// BankReconciliation allocates part of a statement line to what it settles
+type BankReconciliation struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	LineID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"line_id"`
+	Type       string     `gorm:"not null" json:"type"` // invoice, payment, on_account, charge
+	InvoiceID  *uuid.UUID `gorm:"type:uuid;index" json:"invoice_id"`
+	PaymentID  *uuid.UUID `gorm:"type:uuid;index" json:"payment_id"` // payment settled, or created for an invoice or on account
+	CustomerID *uuid.UUID `gorm:"type:uuid" json:"customer_id"`
+	SupplierID *uuid.UUID `gorm:"type:uuid" json:"supplier_id"`
+	Amount     float64    `gorm:"not null" json:"amount"` // positive, in the line currency
+	Notes      string     `json:"notes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	CreatedBy  uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
+
+	// Relations
+	Invoice *Invoice `gorm:"foreignKey:InvoiceID" json:"invoice,omitempty"`
+	Payment *Payment `gorm:"foreignKey:PaymentID" json:"payment,omitempty"`
+}
+
+// BeforeCreate hooks
+func (s *BankStatement) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+func (l *BankStatementLine) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
+
+func (r *BankReconciliation) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
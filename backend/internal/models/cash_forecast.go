@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// RecurringExpense is a regular payment such as rent, payroll or a loan
+// instalment that is not invoiced but must be in the cash forecast
+type RecurringExpense struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	Name      string     `gorm:"not null" json:"name"`
+	Category  string     `json:"category"` // payroll, rent, utility, loan, tax, other
+	Amount    float64    `gorm:"not null" json:"amount"`
+	Currency  string     `gorm:"not null" json:"currency"`
+	Frequency string     `gorm:"not null" json:"frequency"`  // weekly, monthly, quarterly, yearly
+	StartDate time.Time  `gorm:"not null" json:"start_date"` // first payment; later ones keep its day
+	EndDate   *time.Time `json:"end_date"`
+	IsActive  bool       `gorm:"default:true" json:"is_active"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	UpdatedBy *uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+}
+
+// CashForecastScenario overrides the base forecast, e.g. customers paying
+// two weeks later or a one-off tax payment
+type CashForecastScenario struct {
+	ID               uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID        uuid.UUID      `gorm:"type:uuid;not null;index" json:"company_id"`
+	Name             string         `gorm:"not null" json:"name"`
+	Description      string         `json:"description"`
+	ReceiptDelayDays int            `json:"receipt_delay_days"`
+	PaymentDelayDays int            `json:"payment_delay_days"`
+	Factors          datatypes.JSON `gorm:"type:jsonb" json:"factors"`     // multiplier per flow source
+	Adjustments      datatypes.JSON `gorm:"type:jsonb" json:"adjustments"` // manual amounts per currency and week
+	IsActive         bool           `gorm:"default:true" json:"is_active"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	UpdatedBy        *uuid.UUID     `gorm:"type:uuid" json:"updated_by"`
+}
+
+// CashForecastSnapshot freezes a forecast so it can later be compared with
+// what actually happened
+type CashForecastSnapshot struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	ScenarioID   *uuid.UUID `gorm:"type:uuid" json:"scenario_id"` // nil for the base forecast
+	ScenarioName string     `json:"scenario_name"`
+	WeekStart    time.Time  `gorm:"not null;index" json:"week_start"` // first week of the forecast
+	Automatic    bool       `json:"automatic"`                        // taken by the weekly scheduler
+	CreatedAt    time.Time  `json:"created_at"`
+	CreatedBy    *uuid.UUID `gorm:"type:uuid" json:"created_by"`
+
+	// Relations
+	Lines []CashForecastSnapshotLine `gorm:"foreignKey:SnapshotID" json:"lines,omitempty"`
+}
+
+// CashForecastSnapshotLine is the forecast of one currency in one week
+type CashForecastSnapshotLine struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	SnapshotID uuid.UUID      `gorm:"type:uuid;not null;index" json:"snapshot_id"`
+	Currency   string         `gorm:"not null" json:"currency"`
+	WeekStart  time.Time      `gorm:"not null" json:"week_start"`
+	Inflows    float64        `json:"inflows"`
+	Outflows   float64        `json:"outflows"`
+	Closing    float64        `json:"closing"`
+	BySource   datatypes.JSON `gorm:"type:jsonb" json:"by_source"`
+}
+
+// BeforeCreate hooks
+func (e *RecurringExpense) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+func (s *CashForecastScenario) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+func (s *CashForecastSnapshot) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+func (l *CashForecastSnapshotLine) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Inspection certificate statuses
+const (
+	CertificateStatusIssued     = "issued"
+	CertificateStatusSuperseded = "superseded" // reissued for the same shipment
+	CertificateStatusRevoked    = "revoked"
+)
+
+// TradeDocumentInspectionCertificate is the TradeDocument type of inspection
+// certificates
+const TradeDocumentInspectionCertificate = "inspection_certificate"
+
+// MillCertificate is the mill test certificate of a material heat: the
+// chemical composition and mechanical properties certified by the steel
+// mill, quoted on the certificates of the products made from it
+type MillCertificate struct {
+	ID              uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID       uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_mill_certificate_heat" json:"company_id"`
+	HeatNo          string         `gorm:"not null;uniqueIndex:idx_mill_certificate_heat" json:"heat_no"`
+	CertificateNo   string         `json:"certificate_no"` // the mill's certificate number
+	CertificateType string         `gorm:"default:'3.1'" json:"certificate_type"`
+	Mill            string         `json:"mill"`
+	SupplierID      *uuid.UUID     `gorm:"type:uuid;index" json:"supplier_id"`
+	InventoryID     *uuid.UUID     `gorm:"type:uuid;index" json:"inventory_id"` // the raw material
+	MaterialGrade   string         `json:"material_grade"`                      // SCM435, 10B21, 1022
+	Standard        string         `json:"standard"`                            // JIS G4053, ASTM A29
+	Chemical        datatypes.JSON `gorm:"type:jsonb" json:"chemical"`          // [{name, unit, value, min, max}], in %
+	Mechanical      datatypes.JSON `gorm:"type:jsonb" json:"mechanical"`        // [{name, unit, value, min, max}]
+	IssuedAt        *time.Time     `gorm:"type:date" json:"issued_at"`
+	Notes           string         `json:"notes"`
+	CreatedBy       *uuid.UUID     `gorm:"type:uuid" json:"created_by"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+
+	// Relations
+	Supplier  *Supplier  `gorm:"foreignKey:SupplierID" json:"supplier,omitempty"`
+	Inventory *Inventory `gorm:"foreignKey:InventoryID" json:"inventory,omitempty"`
+}
+
+// InspectionCertificate is a signed EN 10204 certificate issued with a
+// shipment. The PDF is attached to the shipment as a TradeDocument and
+// can be verified by anyone through the SHA-256 hash of the file.
+type InspectionCertificate struct {
+	ID                 uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID          uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	CertificateNo      string     `gorm:"not null;unique" json:"certificate_no"`
+	Type               string     `gorm:"not null;default:'3.1'" json:"type"` // EN 10204 type: 2.2, 3.1, 3.2
+	Status             string     `gorm:"not null;index" json:"status"`       // issued, superseded, revoked
+	Version            int        `gorm:"not null" json:"version"`
+	ShipmentID         uuid.UUID  `gorm:"type:uuid;not null;index" json:"shipment_id"`
+	ShipmentNo         string     `json:"shipment_no"`
+	OrderID            *uuid.UUID `gorm:"type:uuid" json:"order_id"`
+	CustomerID         *uuid.UUID `gorm:"type:uuid;index" json:"customer_id"`
+	Manufacturer       string     `json:"manufacturer"` // issuer as printed on the certificate
+	Purchaser          string     `json:"purchaser"`
+	TradeDocumentID    uuid.UUID  `gorm:"type:uuid;not null" json:"trade_document_id"`
+	FilePath           string     `json:"-"`
+	Hash               string     `gorm:"not null;uniqueIndex" json:"hash"` // hex SHA-256 of the PDF
+	Signature          string     `gorm:"type:text" json:"signature"`       // base64
+	SignatureAlgorithm string     `json:"signature_algorithm"`
+	KeyID              string     `json:"key_id"`
+	IssuedBy           uuid.UUID  `gorm:"type:uuid;not null" json:"issued_by"`
+	IssuedAt           time.Time  `gorm:"not null" json:"issued_at"`
+	RevokedBy          *uuid.UUID `gorm:"type:uuid" json:"revoked_by"`
+	RevokedAt          *time.Time `json:"revoked_at"`
+	RevokedReason      string     `json:"revoked_reason"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+
+	// Relations
+	Lines         []InspectionCertificateLine `gorm:"foreignKey:CertificateID" json:"lines,omitempty"`
+	TradeDocument *TradeDocument              `gorm:"foreignKey:TradeDocumentID" json:"trade_document,omitempty"`
+}
+
+// InspectionCertificateLine is a shipment line as certified, with the final
+// inspection and material heats behind it
+type InspectionCertificateLine struct {
+	ID             uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	CertificateID  uuid.UUID      `gorm:"type:uuid;not null;index" json:"certificate_id"`
+	ShipmentItemID uuid.UUID      `gorm:"type:uuid;not null" json:"shipment_item_id"`
+	Item           int            `json:"item"`
+	Description    string         `json:"description"`
+	Quantity       float64        `json:"quantity"`
+	Unit           string         `json:"unit"`
+	InspectionID   uuid.UUID      `gorm:"type:uuid;not null;index" json:"inspection_id"`
+	HeatNos        string         `json:"heat_nos"`                  // comma separated
+	Content        datatypes.JSON `gorm:"type:jsonb" json:"content"` // heats and inspection results as printed
+	CreatedAt      time.Time      `json:"created_at"`
+}
+
+// BeforeCreate hooks
+func (m *MillCertificate) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+func (c *InspectionCertificate) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+func (l *InspectionCertificateLine) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Cost rate suggestion statuses
+const (
+	CostSuggestionPending   = "pending"
+	CostSuggestionAccepted  = "accepted"
+	CostSuggestionDismissed = "dismissed"
+)
+
+// CostCalibration is a run of the cost model against the completed
+// production orders of a period: each process the orders went through gets
+// a suggested rate when there were enough of them
+type CostCalibration struct {
+	ID        uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID uuid.UUID      `gorm:"type:uuid;not null;index" json:"company_id"`
+	From      *time.Time     `json:"from"` // completion dates
+	To        *time.Time     `json:"to"`
+	Jobs      int            `json:"jobs"`                      // completed orders with a cost calculation
+	Samples   int            `json:"samples"`                   // process runs matched to a calculation step
+	Skipped   datatypes.JSON `gorm:"type:jsonb" json:"skipped"` // processes with too few samples, and why
+	Automatic bool           `json:"automatic"`                 // run by the calibration scheduler
+	CreatedAt time.Time      `json:"created_at"`
+	CreatedBy *uuid.UUID     `gorm:"type:uuid" json:"created_by"`
+
+	// Relations
+	Suggestions []CostRateSuggestion `gorm:"foreignKey:CalibrationID" json:"suggestions,omitempty"`
+}
+
+// CostRateSuggestion is the calibrated rate of one process next to the
+// template and processing rate in force. Accepting it creates a new
+// version of the template.
+type CostRateSuggestion struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	CalibrationID uuid.UUID `gorm:"type:uuid;not null;index" json:"calibration_id"`
+	CompanyID     uuid.UUID `gorm:"type:uuid;not null;index" json:"company_id"`
+	ProcessType   string    `gorm:"not null;index" json:"process_type"` // process step code, as on templates and rates
+	ProcessName   string    `json:"process_name"`
+	Samples       int       `json:"samples"`
+
+	// Template base rate, per piece unless the template is hourly
+	TemplateID        string  `json:"template_id"` // active template when calibrated, empty if none
+	TemplateVersion   int     `json:"template_version"`
+	CurrentBaseRate   float64 `json:"current_base_rate"`
+	SuggestedBaseRate float64 `json:"suggested_base_rate"`
+	BaseRateLower     float64 `json:"base_rate_lower"` // 95% confidence interval
+	BaseRateUpper     float64 `json:"base_rate_upper"`
+
+	// Processing hourly rate
+	CurrentHourlyRate   float64 `json:"current_hourly_rate"`
+	SuggestedHourlyRate float64 `json:"suggested_hourly_rate"`
+	HourlyRateLower     float64 `json:"hourly_rate_lower"`
+	HourlyRateUpper     float64 `json:"hourly_rate_upper"`
+
+	ScrapRate float64        `json:"scrap_rate"`
+	Fit       datatypes.JSON `gorm:"type:jsonb" json:"fit"` // intervals and regressions behind the suggestion
+
+	Status             string     `gorm:"not null;default:'pending'" json:"status"`
+	AcceptedTemplateID string     `json:"accepted_template_id"`
+	DecidedBy          *uuid.UUID `gorm:"type:uuid" json:"decided_by"`
+	DecidedAt          *time.Time `json:"decided_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hooks
+func (c *CostCalibration) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+func (s *CostRateSuggestion) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CustomerCreditProfile holds the credit standing of a customer next to the
+// credit limit kept on the customer
+type CustomerCreditProfile struct {
+	ID                 uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID          uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	CustomerID         uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"customer_id"`
+	CustomerGroup      string     `gorm:"index" json:"customer_group"`   // selects the dunning policy
+	CreditStatus       string     `gorm:"not null" json:"credit_status"` // NEW, GOOD, WARNING, BLOCKED
+	StatusReason       string     `json:"status_reason"`
+	StatusLocked       bool       `json:"status_locked"` // set manually, not adjusted from payment behavior
+	DunningHold        bool       `json:"dunning_hold"`  // blocked by dunning until the overdue balance is cleared
+	DaysBeyondTerms    float64    `json:"days_beyond_terms"`
+	OverdueAmount      float64    `json:"overdue_amount"`
+	MaxOverdueDays     int        `json:"max_overdue_days"`
+	LastAssessedAt     *time.Time `json:"last_assessed_at"`
+	InsuredAmount      float64    `json:"insured_amount"`
+	InsuranceCurrency  string     `json:"insurance_currency"`
+	Insurer            string     `json:"insurer"`
+	InsurancePolicyNo  string     `json:"insurance_policy_no"`
+	InsuranceExpiresAt *time.Time `json:"insurance_expires_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	UpdatedBy          *uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+}
+
+// CreditHold stops an order or shipment that would take a customer beyond
+// its credit limit until the customer is back within the limit or an
+// override is approved
+type CreditHold struct {
+	ID                  uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	CustomerID          uuid.UUID  `gorm:"type:uuid;not null;index" json:"customer_id"`
+	CustomerName        string     `json:"customer_name"`
+	SourceType          string     `gorm:"not null;index:idx_credit_hold_source" json:"source_type"` // order, shipment
+	SourceID            uuid.UUID  `gorm:"type:uuid;not null;index:idx_credit_hold_source" json:"source_id"`
+	SourceNo            string     `json:"source_no"`
+	Currency            string     `json:"currency"` // of the credit limit
+	Amount              float64    `json:"amount"`   // added to the exposure by the source
+	Exposure            float64    `json:"exposure"` // net exposure including the source
+	CreditLimit         float64    `json:"credit_limit"`
+	CreditStatus        string     `json:"credit_status"`
+	Reason              string     `json:"reason"`
+	Status              string     `gorm:"not null;index" json:"status"` // open, override_requested, approved, rejected, released
+	OverrideRequestedBy *uuid.UUID `gorm:"type:uuid" json:"override_requested_by"`
+	OverrideRequestedAt *time.Time `json:"override_requested_at"`
+	OverrideReason      string     `json:"override_reason"`
+	DecidedBy           *uuid.UUID `gorm:"type:uuid" json:"decided_by"`
+	DecidedAt           *time.Time `json:"decided_at"`
+	DecisionNotes       string     `json:"decision_notes"`
+	ReleasedAt          *time.Time `json:"released_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	CreatedBy           *uuid.UUID `gorm:"type:uuid" json:"created_by"`
+}
+
+// BeforeCreate hooks
+func (p *CustomerCreditProfile) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+func (h *CreditHold) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DocumentSequence hands out document numbers, such as journal entry and
+// payment numbers, one at a time. Sequences shared by all companies use the
+// nil company ID.
+type DocumentSequence struct {
+	CompanyID uuid.UUID `gorm:"type:uuid;primaryKey" json:"company_id"`
+	Name      string    `gorm:"primaryKey" json:"name"` // the number prefix, e.g. JE-202610-
+	LastValue int64     `gorm:"not null" json:"last_value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// DunningPolicy defines how overdue invoices of a customer group are
+// chased: the escalating stages, late interest and the responsible collector
+type DunningPolicy struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID         uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_dunning_policy_group" json:"company_id"`
+	CustomerGroup     string     `gorm:"not null;uniqueIndex:idx_dunning_policy_group" json:"customer_group"` // default applies to customers without a group
+	Name              string     `gorm:"not null" json:"name"`
+	InterestRate      float64    `json:"interest_rate"`       // annual percentage charged on late balances
+	InterestGraceDays int        `json:"interest_grace_days"` // days overdue before interest is charged
+	PayWithinDays     int        `json:"pay_within_days"`     // payment deadline given on notices
+	CollectorID       *uuid.UUID `gorm:"type:uuid" json:"collector_id"`
+	IsActive          bool       `gorm:"default:true" json:"is_active"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	UpdatedBy         *uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+
+	// Relations
+	Stages []DunningStage `gorm:"foreignKey:PolicyID" json:"stages,omitempty"`
+}
+
+// DunningStage is one escalation step of a policy
+type DunningStage struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	PolicyID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"policy_id"`
+	Sequence    int        `gorm:"not null" json:"sequence"`
+	Level       string     `gorm:"not null" json:"level"` // reminder, first_notice, final_notice, credit_hold
+	DaysOverdue int        `json:"days_overdue"`
+	Channel     string     `gorm:"not null" json:"channel"` // email, letter
+	TemplateID  *uuid.UUID `gorm:"type:uuid" json:"template_id"`
+	Fee         float64    `json:"fee"`
+}
+
+// DunningTemplate is the subject and body of a notice in text/template
+// syntax, rendered with the customer's statement
+type DunningTemplate struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	Name      string     `gorm:"not null" json:"name"`
+	Level     string     `gorm:"not null" json:"level"`
+	Language  string     `json:"language"`
+	Subject   string     `gorm:"not null" json:"subject"`
+	Body      string     `gorm:"type:text;not null" json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	UpdatedBy *uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+}
+
+// DunningNotice is a letter or email sent to a customer for its overdue
+// invoices in one currency
+type DunningNotice struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID  uuid.UUID      `gorm:"type:uuid;not null;index" json:"company_id"`
+	CustomerID uuid.UUID      `gorm:"type:uuid;not null;index" json:"customer_id"`
+	PolicyID   uuid.UUID      `gorm:"type:uuid;not null" json:"policy_id"`
+	Level      string         `gorm:"not null" json:"level"`
+	Channel    string         `gorm:"not null" json:"channel"` // email, letter
+	Recipient  string         `json:"recipient"`
+	NoticeDate time.Time      `gorm:"not null;index" json:"notice_date"`
+	Currency   string         `json:"currency"`
+	Balance    float64        `json:"balance"`
+	Interest   float64        `json:"interest"`
+	Fee        float64        `json:"fee"`
+	TotalDue   float64        `json:"total_due"`
+	Subject    string         `json:"subject"`
+	Body       string         `gorm:"type:text" json:"body"`
+	Statement  datatypes.JSON `gorm:"type:jsonb" json:"statement"`
+	Status     string         `gorm:"not null" json:"status"` // generated, sent, failed
+	SendError  string         `json:"send_error,omitempty"`
+	SentAt     *time.Time     `json:"sent_at"`
+	CreatedAt  time.Time      `json:"created_at"`
+	CreatedBy  *uuid.UUID     `gorm:"type:uuid" json:"created_by"`
+
+	// Relations
+	Lines []DunningNoticeLine `gorm:"foreignKey:NoticeID" json:"lines,omitempty"`
+}
+
+// DunningNoticeLine is one overdue invoice on a notice
+type DunningNoticeLine struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	NoticeID    uuid.UUID `gorm:"type:uuid;not null;index" json:"notice_id"`
+	InvoiceID   uuid.UUID `gorm:"type:uuid;not null;index" json:"invoice_id"`
+	InvoiceNo   string    `json:"invoice_no"`
+	DueDate     time.Time `json:"due_date"`
+	DaysOverdue int       `json:"days_overdue"`
+	Balance     float64   `json:"balance"`
+	Interest    float64   `json:"interest"`
+	Sequence    int       `json:"sequence"` // stage the invoice reached with this notice
+	Level       string    `json:"level"`
+}
+
+// PromiseToPay records a customer's commitment to pay an amount by a date.
+// Open promises suspend dunning of the customer's invoices.
+type PromiseToPay struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	CustomerID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"customer_id"`
+	InvoiceID    *uuid.UUID `gorm:"type:uuid;index" json:"invoice_id"` // nil for the whole account
+	Amount       float64    `gorm:"not null" json:"amount"`
+	Currency     string     `json:"currency"`
+	PromisedDate time.Time  `gorm:"not null" json:"promised_date"`
+	PaidAmount   float64    `json:"paid_amount"`                  // received since the promise was made
+	Status       string     `gorm:"not null;index" json:"status"` // open, kept, broken, cancelled
+	Notes        string     `json:"notes"`
+	ResolvedAt   *time.Time `json:"resolved_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	CreatedBy    uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
+}
+
+// CollectorNote logs a collection contact with a customer
+type CollectorNote struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	CustomerID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"customer_id"`
+	InvoiceID     *uuid.UUID `gorm:"type:uuid" json:"invoice_id"`
+	ContactMethod string     `json:"contact_method"` // call, email, visit, letter
+	Note          string     `gorm:"type:text;not null" json:"note"`
+	FollowUpDate  *time.Time `gorm:"index" json:"follow_up_date"`
+	CreatedAt     time.Time  `json:"created_at"`
+	CreatedBy     uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
+}
+
+// BeforeCreate hooks
+func (p *DunningPolicy) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+func (s *DunningStage) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+func (t *DunningTemplate) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+func (n *DunningNotice) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == uuid.Nil {
+		n.ID = uuid.New()
+	}
+	return nil
+}
+
+func (l *DunningNoticeLine) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
+
+func (p *PromiseToPay) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+func (n *CollectorNote) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == uuid.Nil {
+		n.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// EInvoiceParty holds the e-invoicing address of the company itself
+// (CustomerID nil) or of one of its customers
+type EInvoiceParty struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	CustomerID     *uuid.UUID `gorm:"type:uuid;index" json:"customer_id"`
+	Format         string     `json:"format"`          // peppol_bis3, tw_mig; empty to choose by country
+	EndpointScheme string     `json:"endpoint_scheme"` // Peppol EAS code, e.g. 0088, 9930, 0242
+	EndpointID     string     `json:"endpoint_id"`
+	BuyerReference string     `json:"buyer_reference"`
+	Transport      string     `json:"transport"` // empty for the default outbox
+	IsActive       bool       `gorm:"default:true" json:"is_active"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	UpdatedBy      *uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+
+	// Relations
+	Customer *Customer `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+}
+
+// EInvoice is one generated electronic version of an invoice or credit
+// note. Regenerating an invoice adds a version and supersedes the previous.
+type EInvoice struct {
+	ID                 uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID          uuid.UUID      `gorm:"type:uuid;not null;index" json:"company_id"`
+	InvoiceID          uuid.UUID      `gorm:"type:uuid;not null;index" json:"invoice_id"`
+	Format             string         `gorm:"not null" json:"format"`        // peppol_bis3, tw_mig
+	DocumentType       string         `gorm:"not null" json:"document_type"` // invoice, credit_note
+	DocumentNo         string         `gorm:"not null" json:"document_no"`
+	Version            int            `gorm:"not null" json:"version"`
+	Status             string         `gorm:"not null;index" json:"status"` // generated, invalid, signed, transmitted, failed, superseded
+	FilePath           string         `json:"-"`
+	SignaturePath      string         `json:"-"`
+	Digest             string         `json:"digest"`
+	Signature          string         `gorm:"type:text" json:"signature,omitempty"`
+	SignatureAlgorithm string         `json:"signature_algorithm"`
+	KeyID              string         `json:"key_id"`
+	Violations         datatypes.JSON `gorm:"type:jsonb" json:"violations"`
+	Transport          string         `json:"transport"`
+	TransmissionRef    string         `json:"transmission_ref"`
+	TransmittedAt      *time.Time     `json:"transmitted_at"`
+	TransmitError      string         `json:"transmit_error,omitempty"`
+	CreatedAt          time.Time      `json:"created_at"`
+	CreatedBy          uuid.UUID      `gorm:"type:uuid;not null" json:"created_by"`
+
+	// Relations
+	Invoice *Invoice `gorm:"foreignKey:InvoiceID" json:"invoice,omitempty"`
+}
+
+// BeforeCreate hooks
+func (p *EInvoiceParty) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+func (e *EInvoice) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
@@ -19,6 +19,9 @@ type Invoice struct {
 	OrderID           *uuid.UUID `gorm:"type:uuid" json:"order_id"`
 	CustomerID        *uuid.UUID `gorm:"type:uuid" json:"customer_id"`
 	SupplierID        *uuid.UUID `gorm:"type:uuid" json:"supplier_id"`
+	OriginalInvoiceID *uuid.UUID `gorm:"type:uuid" json:"original_invoice_id"` // invoice corrected by a credit or debit note
+	PurchaseOrderID   *uuid.UUID `gorm:"type:uuid;index" json:"purchase_order_id"`    // purchase order a supplier invoice bills
+	SupplierInvoiceNo string     `gorm:"index" json:"supplier_invoice_no"`          // the supplier's own number
 	
 	// Dates
 	IssueDate         time.Time  `json:"issue_date"`
@@ -42,6 +45,13 @@ type Invoice struct {
 	PaymentMethod     string     `json:"payment_method"`
 	BankAccount       string     `json:"bank_account"`
 	
+	// Three-way match of supplier invoices billing a purchase order
+	MatchStatus       string     `json:"match_status"`                         // matched, held, released, rejected; empty when not matched
+	
+	// Dunning
+	DunningLevel      int        `json:"dunning_level"`                        // sequence of the last dunning stage sent, 0 when never dunned
+	LastDunnedAt      *time.Time `json:"last_dunned_at"`
+	
 	// Additional Info
 	Notes             string     `json:"notes"`
 	InternalNotes     string     `json:"internal_notes"`
@@ -78,6 +88,8 @@ type InvoiceItem struct {
 	
 	// Reference
 	OrderItemID       *uuid.UUID `gorm:"type:uuid" json:"order_item_id"`
+	PurchaseOrderItemID *uuid.UUID `gorm:"type:uuid;index" json:"purchase_order_item_id"`
+	LotNo             string     `json:"lot_no"`                               // lot billed, for supplier invoices
 	InventoryID       *uuid.UUID `gorm:"type:uuid" json:"inventory_id"`
 	
 	// Timestamps
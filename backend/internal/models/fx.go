@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// FXRevaluation is a period-end revaluation of open foreign-currency
+// receivables and payables. Its journal entry is reversed on the first day
+// of the next period.
+type FXRevaluation struct {
+	ID              uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID       uuid.UUID      `gorm:"type:uuid;not null;index" json:"company_id"`
+	RevaluationDate time.Time      `gorm:"not null;index" json:"revaluation_date"`
+	PeriodID        *uuid.UUID     `gorm:"type:uuid;index" json:"period_id"`
+	BaseCurrency    string         `gorm:"not null" json:"base_currency"`
+	Rates           datatypes.JSON `gorm:"type:jsonb" json:"rates"` // closing rate per currency
+	TotalGain       float64        `json:"total_gain"`
+	TotalLoss       float64        `json:"total_loss"`
+	NetGain         float64        `json:"net_gain"`
+	EntryID         *uuid.UUID     `gorm:"type:uuid" json:"entry_id"`
+	ReversalDate    time.Time      `json:"reversal_date"`
+	ReversalEntryID *uuid.UUID     `gorm:"type:uuid" json:"reversal_entry_id"`
+	Status          string         `gorm:"not null" json:"status"` // posted
+	CreatedAt       time.Time      `json:"created_at"`
+	CreatedBy       uuid.UUID      `gorm:"type:uuid;not null" json:"created_by"`
+
+	// Relations
+	Lines []FXRevaluationLine `gorm:"foreignKey:RevaluationID" json:"lines,omitempty"`
+}
+
+// FXRevaluationLine is one open invoice valued at the closing rate
+type FXRevaluationLine struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	RevaluationID uuid.UUID  `gorm:"type:uuid;not null;index" json:"revaluation_id"`
+	InvoiceID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"invoice_id"`
+	InvoiceNo     string     `json:"invoice_no"`
+	Kind          string     `gorm:"not null" json:"kind"` // receivable, payable
+	PartnerType   string     `json:"partner_type"`         // customer, supplier
+	PartnerID     *uuid.UUID `gorm:"type:uuid" json:"partner_id"`
+	PartnerName   string     `json:"partner_name"`
+	Currency      string     `gorm:"not null" json:"currency"`
+	OpenAmount    float64    `json:"open_amount"` // in the invoice currency
+	BookedRate    float64    `json:"booked_rate"`
+	ClosingRate   float64    `json:"closing_rate"`
+	BookedBase    float64    `json:"booked_base"`
+	RevaluedBase  float64    `json:"revalued_base"`
+	Gain          float64    `json:"gain"` // negative for a loss
+}
+
+// FXRealization is the exchange difference realized when a payment settled
+// an invoice at another rate than the invoice was booked at
+type FXRealization struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	PaymentID      uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"payment_id"`
+	PaymentNo      string     `json:"payment_no"`
+	InvoiceID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"invoice_id"`
+	Kind           string     `gorm:"not null" json:"kind"` // receivable, payable
+	PaymentDate    time.Time  `gorm:"index" json:"payment_date"`
+	Currency       string     `gorm:"not null" json:"currency"`
+	Amount         float64    `json:"amount"` // settled, in the invoice currency
+	BookedRate     float64    `json:"booked_rate"`
+	SettlementRate float64    `json:"settlement_rate"`
+	Gain           float64    `json:"gain"` // in the base currency, negative for a loss
+	EntryID        *uuid.UUID `gorm:"type:uuid" json:"entry_id"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// BeforeCreate hooks
+func (r *FXRevaluation) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+func (l *FXRevaluationLine) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
+
+func (r *FXRealization) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
@@ -28,6 +28,7 @@ type Inventory struct {
 	CurrentStock       float64    `json:"current_stock"`
 	AvailableStock     float64    `json:"available_stock"`                     // Current - Reserved
 	ReservedStock      float64    `json:"reserved_stock"`                      // Reserved for orders
+	AtVendorStock      float64    `json:"at_vendor_stock"`                     // At subcontractors, not in CurrentStock
 	MinStock           float64    `json:"min_stock"`                           // Minimum stock level
 	MaxStock           float64    `json:"max_stock"`                           // Maximum stock level
 	ReorderPoint       float64    `json:"reorder_point"`                       // Reorder trigger point
@@ -73,7 +74,8 @@ type Warehouse struct {
 	CompanyID   uuid.UUID `gorm:"type:uuid;not null" json:"company_id"`
 	Code        string    `gorm:"not null;unique" json:"code"`
 	Name        string    `gorm:"not null" json:"name"`
-	Type        string    `json:"type"`         // main, branch, consignment
+	Type        string    `json:"type"`         // main, branch, consignment, subcontractor
+	SupplierID  *uuid.UUID `gorm:"type:uuid" json:"supplier_id"` // subcontractor holding our material
 	Address     string    `json:"address"`
 	Manager     string    `json:"manager"`
 	Phone       string    `json:"phone"`
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Invoice match statuses
+const (
+	MatchStatusMatched  = "matched"  // released to accounts payable
+	MatchStatusHeld     = "held"     // waiting for AP review
+	MatchStatusReleased = "released" // released by AP despite discrepancies
+	MatchStatusRejected = "rejected" // returned to the supplier
+)
+
+// InvoiceMatchConfig holds a company's three-way match tolerances
+type InvoiceMatchConfig struct {
+	ID                   uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID            uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"company_id"`
+	PriceTolerancePct    float64    `json:"price_tolerance_pct"`    // allowed unit price deviation either way
+	QuantityTolerancePct float64    `json:"quantity_tolerance_pct"` // allowed quantity over ordered or received
+	AmountTolerance      float64    `json:"amount_tolerance"`       // allowed subtotal rounding difference
+	UpdatedBy            *uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+// InvoiceMatch is the three-way match of a supplier invoice against its
+// purchase order and receipts. Held matches wait for AP review; only
+// matched and released ones have an account payable.
+type InvoiceMatch struct {
+	ID                   uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID            uuid.UUID      `gorm:"type:uuid;not null;index" json:"company_id"`
+	InvoiceID            uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex" json:"invoice_id"`
+	PurchaseOrderID      uuid.UUID      `gorm:"type:uuid;not null;index" json:"purchase_order_id"`
+	SupplierID           uuid.UUID      `gorm:"type:uuid;not null;index" json:"supplier_id"`
+	Status               string         `gorm:"not null;index" json:"status"` // matched, held, released, rejected
+	PriceTolerancePct    float64        `json:"price_tolerance_pct"`          // tolerances matched with
+	QuantityTolerancePct float64        `json:"quantity_tolerance_pct"`
+	AmountTolerance      float64        `json:"amount_tolerance"`
+	Discrepancies        datatypes.JSON `gorm:"type:jsonb" json:"discrepancies"` // [{code, invoice_line_id, order_line_id, message}]
+	Reasons              string         `json:"reasons"`                         // discrepancy messages, one per line
+	Attempts             int            `json:"attempts"`
+	MatchedAt            time.Time      `gorm:"not null" json:"matched_at"` // last attempt
+	AccountPayableID     *uuid.UUID     `gorm:"type:uuid" json:"account_payable_id"`
+	ReviewedBy           *uuid.UUID     `gorm:"type:uuid" json:"reviewed_by"`
+	ReviewedAt           *time.Time     `json:"reviewed_at"`
+	ReviewNote           string         `json:"review_note"`
+	CreatedAt            time.Time      `json:"created_at"`
+	UpdatedAt            time.Time      `json:"updated_at"`
+
+	// Relations
+	Lines         []InvoiceMatchLine `gorm:"foreignKey:MatchID" json:"lines,omitempty"`
+	Invoice       *Invoice           `gorm:"foreignKey:InvoiceID" json:"invoice,omitempty"`
+	PurchaseOrder *PurchaseOrder     `gorm:"foreignKey:PurchaseOrderID" json:"purchase_order,omitempty"`
+	Supplier      *Supplier          `gorm:"foreignKey:SupplierID" json:"supplier,omitempty"`
+}
+
+// InvoiceMatchLine compares an invoice line with its purchase order line
+type InvoiceMatchLine struct {
+	ID                  uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	MatchID             uuid.UUID  `gorm:"type:uuid;not null;index" json:"match_id"`
+	InvoiceItemID       uuid.UUID  `gorm:"type:uuid;not null" json:"invoice_item_id"`
+	PurchaseOrderItemID *uuid.UUID `gorm:"type:uuid" json:"purchase_order_item_id"`
+	InvoicedQuantity    float64    `json:"invoiced_quantity"`
+	PreviouslyInvoiced  float64    `json:"previously_invoiced"`
+	OrderedQuantity     float64    `json:"ordered_quantity"`
+	ReceivedQuantity    float64    `json:"received_quantity"` // received and accepted
+	InvoicePrice        float64    `json:"invoice_price"`
+	OrderPrice          float64    `json:"order_price"`
+	PriceVariancePct    float64    `json:"price_variance_pct"`
+	Matched             bool       `json:"matched"`
+	Reasons             string     `json:"reasons"`
+}
+
+// BeforeCreate hooks
+func (c *InvoiceMatchConfig) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+func (m *InvoiceMatch) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+func (l *InvoiceMatchLine) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
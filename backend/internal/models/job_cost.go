@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ProductionJobCost is the actual cost of a production order next to the
+// estimate it was quoted on. It is recalculated while the order runs and
+// final once the order is completed.
+type ProductionJobCost struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID         uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	ProductionOrderID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"production_order_id"`
+	OrderNo           string     `json:"order_no"`
+	ProductName       string     `json:"product_name"`
+	InventoryID       uuid.UUID  `gorm:"type:uuid" json:"inventory_id"`
+	Currency          string     `json:"currency"`
+	Quantity          float64    `json:"quantity"` // produced quantity, or planned before anything is produced
+	Final             bool       `json:"final"`
+	CompletedAt       *time.Time `gorm:"index" json:"completed_at"`
+
+	// Estimate, scaled to Quantity
+	EstimateSource       string     `json:"estimate_source"` // cost_calculation, quote, production_order, none
+	CostCalculationID    *uuid.UUID `gorm:"type:uuid" json:"cost_calculation_id"`
+	QuoteID              *uuid.UUID `gorm:"type:uuid" json:"quote_id"`
+	EstimateBreakdown    bool       `json:"estimate_breakdown"` // false when only the total is known
+	EstimatedMaterial    float64    `json:"estimated_material"`
+	EstimatedLabor       float64    `json:"estimated_labor"`
+	EstimatedSubcontract float64    `json:"estimated_subcontract"`
+	EstimatedOverhead    float64    `json:"estimated_overhead"`
+	EstimatedTotal       float64    `json:"estimated_total"`
+	EstimatedHours       float64    `json:"estimated_hours"`
+
+	// Actual
+	ActualMaterial    float64        `json:"actual_material"`
+	ActualLabor       float64        `json:"actual_labor"`
+	ActualSubcontract float64        `json:"actual_subcontract"`
+	ActualOverhead    float64        `json:"actual_overhead"`
+	ActualTotal       float64        `json:"actual_total"`
+	ActualHours       float64        `json:"actual_hours"`
+	Details           datatypes.JSON `gorm:"type:jsonb" json:"details"`   // material issues, labor entries, subcontract fees and overhead charges
+	Variances         datatypes.JSON `gorm:"type:jsonb" json:"variances"` // per cost driver
+
+	CalculatedAt time.Time `json:"calculated_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hooks
+func (j *ProductionJobCost) BeforeCreate(tx *gorm.DB) error {
+	if j.ID == uuid.Nil {
+		j.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// JobRun records the last run of a periodic background job, so a restarted
+// server resumes the schedule instead of starting it over
+type JobRun struct {
+	Name      string    `gorm:"primaryKey" json:"name"`
+	LastRunAt time.Time `gorm:"not null" json:"last_run_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
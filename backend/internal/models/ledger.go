@@ -0,0 +1,122 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GLAccount is an account in a company's chart of accounts
+type GLAccount struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_gl_account_code" json:"company_id"`
+	Code          string     `gorm:"not null;uniqueIndex:idx_gl_account_code" json:"code"`
+	Name          string     `gorm:"not null" json:"name"`
+	Type          string     `gorm:"not null" json:"type"`           // asset, liability, equity, revenue, expense
+	NormalBalance string     `gorm:"not null" json:"normal_balance"` // debit, credit
+	Role          string     `gorm:"index" json:"role"`              // default posting role, e.g. accounts_receivable
+	ParentID      *uuid.UUID `gorm:"type:uuid" json:"parent_id"`
+	Description   string     `json:"description"`
+	IsActive      bool       `gorm:"default:true" json:"is_active"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// Relations
+	Parent *GLAccount `gorm:"foreignKey:ParentID" json:"parent,omitempty"`
+}
+
+// PostingRule overrides the account a posting role resolves to for an event
+type PostingRule struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID uuid.UUID `gorm:"type:uuid;not null;index" json:"company_id"`
+	Event     string    `json:"event"` // e.g. invoice.sales; empty applies to every event
+	Match     string    `json:"match"` // expense category or stock movement reason; empty matches all
+	Role      string    `gorm:"not null" json:"role"`
+	AccountID uuid.UUID `gorm:"type:uuid;not null" json:"account_id"`
+	IsActive  bool      `gorm:"default:true" json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreatedBy uuid.UUID `gorm:"type:uuid" json:"created_by"`
+
+	// Relations
+	Account *GLAccount `gorm:"foreignKey:AccountID" json:"account,omitempty"`
+}
+
+// JournalEntry is a balanced posting to the general ledger. Line amounts
+// are in the base currency; the transaction currency and rate are kept for
+// reference.
+type JournalEntry struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_journal_entry_no" json:"company_id"`
+	EntryNo      string     `gorm:"not null;uniqueIndex:idx_journal_entry_no" json:"entry_no"`
+	EntryDate    time.Time  `gorm:"not null;index" json:"entry_date"`
+	PeriodID     *uuid.UUID `gorm:"type:uuid;index" json:"period_id"`
+	Event        string     `gorm:"not null" json:"event"`    // invoice.sales, payment.incoming, manual, reversal, ...
+	SourceType   string     `gorm:"index" json:"source_type"` // invoice, payment, expense, stock_movement, production_order
+	SourceID     *uuid.UUID `gorm:"type:uuid;index" json:"source_id"`
+	SourceNo     string     `json:"source_no"`
+	Description  string     `json:"description"`
+	Currency     string     `gorm:"not null" json:"currency"` // transaction currency
+	ExchangeRate float64    `gorm:"default:1" json:"exchange_rate"`
+	TotalDebit   float64    `json:"total_debit"`            // in base currency
+	TotalCredit  float64    `json:"total_credit"`           // in base currency
+	Status       string     `gorm:"not null" json:"status"` // posted, reversed
+	ReversalOfID *uuid.UUID `gorm:"type:uuid" json:"reversal_of_id"`
+	ReversedByID *uuid.UUID `gorm:"type:uuid" json:"reversed_by_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	CreatedBy    uuid.UUID  `gorm:"type:uuid" json:"created_by"`
+
+	// Relations
+	Lines  []JournalLine    `gorm:"foreignKey:EntryID" json:"lines,omitempty"`
+	Period *FinancialPeriod `gorm:"foreignKey:PeriodID" json:"period,omitempty"`
+}
+
+// JournalLine is one debit or credit of a journal entry
+type JournalLine struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	EntryID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"entry_id"`
+	CompanyID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	AccountID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"account_id"`
+	LineNo         int        `json:"line_no"`
+	Role           string     `json:"role"`
+	Debit          float64    `json:"debit"`           // in base currency
+	Credit         float64    `json:"credit"`          // in base currency
+	AmountCurrency float64    `json:"amount_currency"` // signed amount in transaction currency, positive for a debit
+	PartnerType    string     `json:"partner_type"`    // customer, supplier
+	PartnerID      *uuid.UUID `gorm:"type:uuid;index" json:"partner_id"`
+	Memo           string     `json:"memo"`
+
+	// Relations
+	Account *GLAccount    `gorm:"foreignKey:AccountID" json:"account,omitempty"`
+	Entry   *JournalEntry `gorm:"foreignKey:EntryID" json:"entry,omitempty"`
+}
+
+// BeforeCreate hooks
+func (a *GLAccount) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+func (r *PostingRule) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+func (e *JournalEntry) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+func (l *JournalLine) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// LoadPlan is a computed pallet and container plan for a shipment
+type LoadPlan struct {
+	ID              uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID       uuid.UUID      `gorm:"type:uuid;not null;index" json:"company_id"`
+	ShipmentID      uuid.UUID      `gorm:"type:uuid;not null;index" json:"shipment_id"`
+	Status          string         `gorm:"not null" json:"status"` // draft, applied, superseded
+	ContainerMix    string         `json:"container_mix"`          // e.g. 1x40ft + 1x20ft
+	ContainerCount  int            `json:"container_count"`
+	TEU             float64        `json:"teu"`
+	PalletCount     int            `json:"pallet_count"`
+	CartonCount     int            `json:"carton_count"`
+	GrossWeight     float64        `json:"gross_weight"`  // in kg, including pallets
+	NetWeight       float64        `json:"net_weight"`    // in kg
+	Volume          float64        `json:"volume"`        // in m3
+	FreightBasis    string         `json:"freight_basis"` // fcl, lcl; empty without a matching rate
+	FreightEstimate float64        `json:"freight_estimate"`
+	FreightCurrency string         `json:"freight_currency"`
+	Details         datatypes.JSON `gorm:"type:jsonb" json:"details"` // palletization, capacities and container loads
+	AppliedAt       *time.Time     `json:"applied_at"`
+	CreatedAt       time.Time      `json:"created_at"`
+	CreatedBy       uuid.UUID      `gorm:"type:uuid" json:"created_by"`
+
+	// Relations
+	Shipment *Shipment `gorm:"foreignKey:ShipmentID" json:"shipment,omitempty"`
+}
+
+// FreightRate is a freight tariff for a lane and container type
+type FreightRate struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	CarrierName   string     `json:"carrier_name"`                         // empty applies to every carrier
+	Method        string     `gorm:"not null;default:'sea'" json:"method"` // sea, air, land
+	OriginPort    string     `gorm:"not null" json:"origin_port"`
+	DestPort      string     `gorm:"not null" json:"dest_port"`
+	ContainerType string     `gorm:"not null" json:"container_type"` // 20ft, 40ft, 40hc, or lcl
+	Rate          float64    `gorm:"not null" json:"rate"`           // per container; per revenue ton (1 m3 or 1,000 kg) for lcl
+	MinCharge     float64    `json:"min_charge"`                     // lcl only
+	Currency      string     `gorm:"not null;default:'USD'" json:"currency"`
+	ValidFrom     time.Time  `gorm:"not null" json:"valid_from"`
+	ValidTo       *time.Time `json:"valid_to"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	CreatedBy     uuid.UUID  `gorm:"type:uuid" json:"created_by"`
+}
+
+// BeforeCreate hooks
+func (lp *LoadPlan) BeforeCreate(tx *gorm.DB) error {
+	if lp.ID == uuid.Nil {
+		lp.ID = uuid.New()
+	}
+	return nil
+}
+
+func (fr *FreightRate) BeforeCreate(tx *gorm.DB) error {
+	if fr.ID == uuid.Nil {
+		fr.ID = uuid.New()
+	}
+	return nil
+}
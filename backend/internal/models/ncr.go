@@ -0,0 +1,196 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// NCR sources
+const (
+	NCRSourceInspection     = "inspection"
+	NCRSourceCustomerReturn = "customer_return"
+	NCRSourceComplaint      = "customer_complaint"
+	NCRSourceInternal       = "internal"
+)
+
+// NCR statuses
+const (
+	NCRStatusOpen         = "open"
+	NCRStatusInProgress   = "in_progress"
+	NCRStatusVerification = "verification" // corrective actions done, awaiting the effectiveness check
+	NCRStatusClosed       = "closed"
+	NCRStatusCancelled    = "cancelled"
+)
+
+// NCR dispositions of nonconforming material
+const (
+	DispositionScrap            = "scrap"
+	DispositionRework           = "rework"
+	DispositionUseAsIs          = "use_as_is"
+	DispositionReturnToSupplier = "return_to_supplier"
+)
+
+// Parties responsible for a nonconformance
+const (
+	ResponsibilityInternal = "internal"
+	ResponsibilitySupplier = "supplier"
+	ResponsibilityCustomer = "customer"
+)
+
+// Root cause categories (6M plus design)
+const (
+	RootCauseMan         = "man"
+	RootCauseMachine     = "machine"
+	RootCauseMethod      = "method"
+	RootCauseMaterial    = "material"
+	RootCauseMeasurement = "measurement"
+	RootCauseEnvironment = "environment"
+	RootCauseDesign      = "design"
+)
+
+// Effectiveness verification results
+const (
+	EffectivenessEffective    = "effective"
+	EffectivenessNotEffective = "not_effective"
+)
+
+// 8D disciplines
+const (
+	D1Team = iota + 1
+	D2Problem
+	D3Containment
+	D4RootCause
+	D5CorrectiveActions
+	D6Implementation
+	D7Prevention
+	D8Closure
+)
+
+// EightDTitles are the titles of the 8D disciplines, D1 at index 1
+var EightDTitles = [...]string{
+	D1Team:              "Form the team",
+	D2Problem:           "Describe the problem",
+	D3Containment:       "Interim containment actions",
+	D4RootCause:         "Root cause analysis",
+	D5CorrectiveActions: "Choose permanent corrective actions",
+	D6Implementation:    "Implement and validate corrective actions",
+	D7Prevention:        "Prevent recurrence",
+	D8Closure:           "Recognize the team and close",
+}
+
+// NonconformanceReport records a nonconformance found in an inspection,
+// returned by a customer or raised by a complaint, its disposition and the
+// 8D corrective action taken
+type NonconformanceReport struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID   uuid.UUID `gorm:"type:uuid;not null;index" json:"company_id"`
+	NCRNo       string    `gorm:"not null;unique" json:"ncr_no"`
+	Source      string    `gorm:"not null" json:"source"`                   // inspection, customer_return, customer_complaint, internal
+	Status      string    `gorm:"not null;default:'open'" json:"status"`    // open, in_progress, verification, closed, cancelled
+	Severity    string    `gorm:"not null;default:'major'" json:"severity"` // critical, major, minor
+	Title       string    `gorm:"not null" json:"title"`
+	Description string    `json:"description"`
+
+	// References
+	InventoryID       *uuid.UUID `gorm:"type:uuid;index" json:"inventory_id"`
+	InspectionID      *uuid.UUID `gorm:"type:uuid;index" json:"inspection_id"`
+	ProductionOrderID *uuid.UUID `gorm:"type:uuid" json:"production_order_id"`
+	PurchaseOrderID   *uuid.UUID `gorm:"type:uuid" json:"purchase_order_id"`
+	OrderID           *uuid.UUID `gorm:"type:uuid" json:"order_id"`
+	CustomerID        *uuid.UUID `gorm:"type:uuid;index" json:"customer_id"`
+	SupplierID        *uuid.UUID `gorm:"type:uuid;index" json:"supplier_id"`
+	ComplaintRef      string     `json:"complaint_ref"` // customer's complaint or RMA number
+	NonconformingQty  float64    `json:"nonconforming_qty"`
+	Unit              string     `json:"unit"`
+
+	// Disposition
+	Disposition      string     `json:"disposition"` // scrap, rework, use_as_is, return_to_supplier
+	DispositionQty   float64    `json:"disposition_qty"`
+	DispositionNotes string     `json:"disposition_notes"`
+	DispositionBy    *uuid.UUID `gorm:"type:uuid" json:"disposition_by"`
+	DispositionAt    *time.Time `json:"disposition_at"`
+
+	// Root cause
+	Responsibility    string `json:"responsibility"`      // internal, supplier, customer; empty while unknown
+	RootCauseCategory string `json:"root_cause_category"` // man, machine, method, material, measurement, environment, design
+	RootCause         string `json:"root_cause"`
+
+	// Effectiveness verification
+	VerifyAfter        *time.Time `json:"verify_after"`  // earliest date the corrective action can be judged
+	Effectiveness      string     `json:"effectiveness"` // effective, not_effective
+	EffectivenessNotes string     `json:"effectiveness_notes"`
+	VerifiedBy         *uuid.UUID `gorm:"type:uuid" json:"verified_by"`
+	VerifiedAt         *time.Time `json:"verified_at"`
+
+	ReportedBy uuid.UUID  `gorm:"type:uuid;not null" json:"reported_by"`
+	ReportedAt time.Time  `gorm:"not null" json:"reported_at"`
+	ClosedBy   *uuid.UUID `gorm:"type:uuid" json:"closed_by"`
+	ClosedAt   *time.Time `json:"closed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	// Relations
+	Steps        []NCRStep        `gorm:"foreignKey:NCRID" json:"steps,omitempty"`
+	Containments []NCRContainment `gorm:"foreignKey:NCRID" json:"containments,omitempty"`
+}
+
+// NCRStep is one discipline of the 8D with its owner and due date
+type NCRStep struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	NCRID       uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_ncr_step" json:"ncr_id"`
+	Discipline  int        `gorm:"not null;uniqueIndex:idx_ncr_step" json:"discipline"` // 1 to 8
+	Title       string     `json:"title"`
+	OwnerID     *uuid.UUID `gorm:"type:uuid" json:"owner_id"`
+	DueDate     *time.Time `gorm:"type:date" json:"due_date"`
+	Status      string     `gorm:"not null;default:'open'" json:"status"` // open, done
+	Notes       string     `json:"notes"`
+	CompletedBy *uuid.UUID `gorm:"type:uuid" json:"completed_by"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// NCRContainment is an interim containment action on a lot: quarantine,
+// sorting, recall or stopping shipment of the suspect quantity
+type NCRContainment struct {
+	ID               uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	NCRID            uuid.UUID  `gorm:"type:uuid;not null;index" json:"ncr_id"`
+	Action           string     `gorm:"not null" json:"action"` // quarantine, sort, recall, stop_shipment, rework
+	InventoryID      *uuid.UUID `gorm:"type:uuid" json:"inventory_id"`
+	WarehouseID      *uuid.UUID `gorm:"type:uuid" json:"warehouse_id"`
+	LotNo            string     `gorm:"index" json:"lot_no"` // batch number of the inventory movements
+	Location         string     `json:"location"`            // warehouse, in transit, customer site
+	SuspectQty       float64    `json:"suspect_qty"`
+	NonconformingQty float64    `json:"nonconforming_qty"` // found when sorting
+	OwnerID          *uuid.UUID `gorm:"type:uuid" json:"owner_id"`
+	DueDate          *time.Time `gorm:"type:date" json:"due_date"`
+	Status           string     `gorm:"not null;default:'open'" json:"status"` // open, done
+	Notes            string     `json:"notes"`
+	CompletedAt      *time.Time `json:"completed_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hooks
+func (n *NonconformanceReport) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == uuid.Nil {
+		n.ID = uuid.New()
+	}
+	return nil
+}
+
+func (s *NCRStep) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+func (c *NCRContainment) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
@@ -79,6 +79,8 @@ type OrderItem struct {
 	ProductName    string     `json:"product_name"`
 	Description    string     `json:"description"`
 	Specification  string     `json:"specification"`
+	CustomerPartID *uuid.UUID `gorm:"type:uuid;index" json:"customer_part_id"`
+	DrawingRevision string    `json:"drawing_revision"` // revision of the customer drawing ordered
 	Quantity       float64    `gorm:"not null" json:"quantity"`
 	Unit           string     `json:"unit"`
 	UnitPrice      float64    `gorm:"not null" json:"unit_price"`
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PPAP submission statuses
+const (
+	PPAPStatusDraft           = "draft"
+	PPAPStatusSubmitted       = "submitted"
+	PPAPStatusApproved        = "approved"
+	PPAPStatusInterimApproved = "interim_approved" // approved for a limited time or quantity
+	PPAPStatusRejected        = "rejected"
+	PPAPStatusSuperseded      = "superseded" // replaced by a later approved submission
+)
+
+// PPAP submission reasons of the part submission warrant
+const (
+	PPAPReasonInitial           = "initial_submission"
+	PPAPReasonEngineeringChange = "engineering_change"
+	PPAPReasonTooling           = "tooling_change"
+	PPAPReasonCorrection        = "correction_of_discrepancy"
+	PPAPReasonSubcontractor     = "subcontractor_or_material_change"
+	PPAPReasonProcess           = "process_change"
+	PPAPReasonOther             = "other"
+)
+
+// PPAP element statuses
+const (
+	PPAPElementPending       = "pending"
+	PPAPElementComplete      = "complete"
+	PPAPElementNotApplicable = "not_applicable"
+)
+
+// PPAPSubmission is a production part approval of a customer part number,
+// made on a production route at a submission level of 1 to 5
+type PPAPSubmission struct {
+	ID                 uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID          uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	SubmissionNo       string     `gorm:"not null;unique" json:"submission_no"`
+	CustomerID         uuid.UUID  `gorm:"type:uuid;not null;index:idx_ppap_customer_part" json:"customer_id"`
+	CustomerPartNo     string     `gorm:"not null;index:idx_ppap_customer_part" json:"customer_part_no"`
+	CustomerPartName   string     `json:"customer_part_name"`
+	DrawingRevision    string     `json:"drawing_revision"` // engineering change level of the design record
+	InventoryID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"inventory_id"`
+	RouteID            *uuid.UUID `gorm:"type:uuid" json:"route_id"` // production route the samples were made on
+	Level              int        `gorm:"not null;default:3" json:"level"`
+	Reason             string     `gorm:"not null;default:'initial_submission'" json:"reason"`
+	Status             string     `gorm:"not null;default:'draft';index" json:"status"` // draft, submitted, approved, interim_approved, rejected, superseded
+	SubmittedBy        *uuid.UUID `gorm:"type:uuid" json:"submitted_by"`
+	SubmittedAt        *time.Time `json:"submitted_at"`
+	CustomerDecisionBy string     `json:"customer_decision_by"` // customer representative
+	DecidedAt          *time.Time `json:"decided_at"`
+	RecordedBy         *uuid.UUID `gorm:"type:uuid" json:"recorded_by"`
+	CustomerComments   string     `json:"customer_comments"`
+	InterimExpiresAt   *time.Time `gorm:"type:date" json:"interim_expires_at"`
+	Notes              string     `json:"notes"`
+	CreatedBy          uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+
+	// Relations
+	Customer  *Customer        `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	Inventory *Inventory       `gorm:"foreignKey:InventoryID" json:"inventory,omitempty"`
+	Route     *ProductionRoute `gorm:"foreignKey:RouteID" json:"route,omitempty"`
+	Elements  []PPAPElement    `gorm:"foreignKey:SubmissionID" json:"elements,omitempty"`
+}
+
+// PPAPElement is one of the 18 elements of a submission with its
+// requirement at the submission level
+type PPAPElement struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	SubmissionID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_ppap_element" json:"submission_id"`
+	Element        int       `gorm:"not null;uniqueIndex:idx_ppap_element" json:"element"` // 1 to 18
+	Name           string    `json:"name"`
+	Requirement    string    `gorm:"not null" json:"requirement"`              // submit, retain, customer
+	Status         string    `gorm:"not null;default:'pending'" json:"status"` // pending, complete, not_applicable
+	CurrentVersion int       `json:"current_version"`
+	Notes          string    `json:"notes"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Relations
+	Documents []PPAPDocument `gorm:"foreignKey:ElementID" json:"documents,omitempty"`
+}
+
+// PPAPDocument is an uploaded version of the document of an element
+type PPAPDocument struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	SubmissionID uuid.UUID `gorm:"type:uuid;not null;index" json:"submission_id"`
+	ElementID    uuid.UUID `gorm:"type:uuid;not null;index" json:"element_id"`
+	Version      int       `gorm:"not null" json:"version"`
+	FileName     string    `gorm:"not null" json:"file_name"`
+	FilePath     string    `json:"-"`
+	FileSize     int64     `json:"file_size"`
+	ContentType  string    `json:"content_type"`
+	Hash         string    `json:"hash"` // hex SHA-256
+	Comment      string    `json:"comment"`
+	UploadedBy   uuid.UUID `gorm:"type:uuid;not null" json:"uploaded_by"`
+	UploadedAt   time.Time `gorm:"not null" json:"uploaded_at"`
+}
+
+// PPAPReleaseWarning records a production order released for a part
+// without an approved PPAP
+type PPAPReleaseWarning struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID         uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	ProductionOrderID uuid.UUID  `gorm:"type:uuid;not null;index" json:"production_order_id"`
+	OrderNo           string     `json:"order_no"`
+	InventoryID       uuid.UUID  `gorm:"type:uuid;not null" json:"inventory_id"`
+	CustomerID        *uuid.UUID `gorm:"type:uuid" json:"customer_id"`
+	SubmissionID      *uuid.UUID `gorm:"type:uuid" json:"submission_id"` // latest submission of the part, if any
+	Reason            string     `gorm:"not null" json:"reason"`
+	ReleasedBy        uuid.UUID  `gorm:"type:uuid" json:"released_by"`
+	AcknowledgedBy    *uuid.UUID `gorm:"type:uuid" json:"acknowledged_by"`
+	AcknowledgedAt    *time.Time `json:"acknowledged_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// BeforeCreate hooks
+func (p *PPAPSubmission) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+func (e *PPAPElement) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+func (d *PPAPDocument) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+func (w *PPAPReleaseWarning) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	return nil
+}
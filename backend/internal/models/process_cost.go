@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/datatypes"
 )
 
 // ProcessCategory 製程類別
@@ -111,6 +112,9 @@ type CostCalculation struct {
 	QuoteID           *uuid.UUID               `json:"quote_id" gorm:"type:uuid"`
 	CalculationNo     string                   `json:"calculation_no" gorm:"type:varchar(50);unique;not null"`
 	ProductName       string                   `json:"product_name" gorm:"type:varchar(200);not null"`
+	Diameter          float64                  `json:"diameter" gorm:"type:decimal(10,2)"`      // mm，成本校準用
+	Length            float64                  `json:"length" gorm:"type:decimal(10,2)"`        // mm
+	MaterialType      string                   `json:"material_type" gorm:"type:varchar(50)"`
 	Quantity          int                      `json:"quantity" gorm:"not null"`
 	MaterialCost      float64                  `json:"material_cost" gorm:"type:decimal(15,4)"`
 	ProcessCost       float64                  `json:"process_cost" gorm:"type:decimal(15,4)"`
@@ -128,6 +132,8 @@ type CostCalculation struct {
 	ApprovedByUser    *Account                 `json:"approved_by_user" gorm:"foreignKey:ApprovedBy"`
 	ApprovedAt        *time.Time               `json:"approved_at"`
 	Status            string                   `json:"status" gorm:"type:varchar(20);default:'draft'"`
+	AsOf              time.Time                `json:"as_of" gorm:"type:date"`                  // 成本參數生效基準日
+	RateVersions      datatypes.JSON           `json:"rate_versions" gorm:"type:jsonb"`         // 使用的參數與費率版本
 	Details           []CostCalculationDetail  `json:"details" gorm:"foreignKey:CalculationID"`
 	CreatedAt         time.Time                `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt         time.Time                `json:"updated_at" gorm:"autoUpdateTime"`
@@ -157,42 +163,52 @@ type CostCalculationDetail struct {
 
 // ProcessCostTemplate 製程成本模板
 type ProcessCostTemplate struct {
-	ID          string    `json:"id" gorm:"primaryKey"`
-	CompanyID   string    `json:"company_id" gorm:"index"`
-	ProcessType string    `json:"process_type"`
-	Category    string    `json:"category"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	BaseRate    float64   `json:"base_rate"`
-	SetupCost   float64   `json:"setup_cost"`
-	MinQuantity int       `json:"min_quantity"`
-	MaxQuantity int       `json:"max_quantity"`
-	Unit        string    `json:"unit"`
-	IsActive    bool      `json:"is_active"`
-	CreatedBy   string    `json:"created_by"`
-	UpdatedBy   string    `json:"updated_by"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID           string     `json:"id" gorm:"primaryKey"`
+	CompanyID    string     `json:"company_id" gorm:"index"`
+	ProcessType  string     `json:"process_type"`
+	Category     string     `json:"category"`
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	BaseRate     float64    `json:"base_rate"`
+	SetupCost    float64    `json:"setup_cost"`
+	MinQuantity  int        `json:"min_quantity"`
+	MaxQuantity  int        `json:"max_quantity"`
+	Unit         string     `json:"unit"`
+	Version      int        `json:"version" gorm:"default:1"`
+	SupersedesID string     `json:"supersedes_id,omitempty"` // 前一版本
+	SuggestionID string     `json:"suggestion_id,omitempty"` // 由成本校準建議產生
+	ValidFrom    time.Time  `json:"valid_from"`              // 生效日，修改時產生新版本
+	ValidTo      *time.Time `json:"valid_to"`
+	IsActive     bool       `json:"is_active"`
+	CreatedBy    string     `json:"created_by"`
+	UpdatedBy    string     `json:"updated_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
 // ProcessCostTemplateNew 新版製程成本模板
 type ProcessCostTemplateNew struct {
-	ID          string    `json:"id" gorm:"primaryKey"`
-	CompanyID   string    `json:"company_id" gorm:"index"`
-	ProcessType string    `json:"process_type"`
-	Category    string    `json:"category"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	BaseRate    float64   `json:"base_rate"`
-	SetupCost   float64   `json:"setup_cost"`
-	MinQuantity int       `json:"min_quantity"`
-	MaxQuantity int       `json:"max_quantity"`
-	Unit        string    `json:"unit"`
-	IsActive    bool      `json:"is_active"`
-	CreatedBy   string    `json:"created_by"`
-	UpdatedBy   string    `json:"updated_by"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID           string     `json:"id" gorm:"primaryKey"`
+	CompanyID    string     `json:"company_id" gorm:"index"`
+	ProcessType  string     `json:"process_type"`
+	Category     string     `json:"category"`
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	BaseRate     float64    `json:"base_rate"`
+	SetupCost    float64    `json:"setup_cost"`
+	MinQuantity  int        `json:"min_quantity"`
+	MaxQuantity  int        `json:"max_quantity"`
+	Unit         string     `json:"unit"`
+	Version      int        `json:"version" gorm:"default:1"`
+	SupersedesID string     `json:"supersedes_id,omitempty"` // 前一版本
+	SuggestionID string     `json:"suggestion_id,omitempty"` // 由成本校準建議產生
+	ValidFrom    time.Time  `json:"valid_from"`              // 生效日，修改時產生新版本
+	ValidTo      *time.Time `json:"valid_to"`
+	IsActive     bool       `json:"is_active"`
+	CreatedBy    string     `json:"created_by"`
+	UpdatedBy    string     `json:"updated_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
 // CostCalculationHistory 成本計算歷史
@@ -218,58 +234,64 @@ type CostCalculationHistory struct {
 
 // MaterialCostNew 材料成本
 type MaterialCostNew struct {
-	ID           string    `json:"id" gorm:"primaryKey"`
-	CompanyID    string    `json:"company_id" gorm:"index"`
-	MaterialCode string    `json:"material_code"`
-	MaterialName string    `json:"material_name"`
-	Category     string    `json:"category"`
-	Unit         string    `json:"unit"`
-	UnitCost     float64   `json:"unit_cost"`
-	UnitPrice    float64   `json:"unit_price"`
-	Currency     string    `json:"currency"`
-	Supplier     string    `json:"supplier"`
-	ValidFrom    time.Time `json:"valid_from"`
+	ID           string     `json:"id" gorm:"primaryKey"`
+	CompanyID    string     `json:"company_id" gorm:"index"`
+	MaterialCode string     `json:"material_code"`
+	MaterialName string     `json:"material_name"`
+	Category     string     `json:"category"`
+	Unit         string     `json:"unit"`
+	UnitCost     float64    `json:"unit_cost"`
+	UnitPrice    float64    `json:"unit_price"`
+	Currency     string     `json:"currency"`
+	Supplier     string     `json:"supplier"`
+	ValidFrom    time.Time  `json:"valid_from"`
 	ValidTo      *time.Time `json:"valid_to"`
-	IsActive     bool      `json:"is_active"`
-	CreatedBy    string    `json:"created_by"`
-	UpdatedBy    string    `json:"updated_by"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	Version      int        `json:"version" gorm:"default:1"`
+	SupersedesID string     `json:"supersedes_id,omitempty"` // 前一版本
+	IsActive     bool       `json:"is_active"`
+	CreatedBy    string     `json:"created_by"`
+	UpdatedBy    string     `json:"updated_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
 // ProcessingRate 加工費率
 type ProcessingRate struct {
-	ID          string    `json:"id" gorm:"primaryKey"`
-	CompanyID   string    `json:"company_id" gorm:"index"`
-	ProcessType string    `json:"process_type"`
-	EquipmentID string    `json:"equipment_id,omitempty"`
-	HourlyRate  float64   `json:"hourly_rate"`
-	SetupRate   float64   `json:"setup_rate"`
-	Currency    string    `json:"currency"`
-	ValidFrom   time.Time `json:"valid_from"`
-	ValidTo     *time.Time `json:"valid_to"`
-	IsActive    bool      `json:"is_active"`
-	CreatedBy   string    `json:"created_by"`
-	UpdatedBy   string    `json:"updated_by"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID           string     `json:"id" gorm:"primaryKey"`
+	CompanyID    string     `json:"company_id" gorm:"index"`
+	ProcessType  string     `json:"process_type"`
+	EquipmentID  string     `json:"equipment_id,omitempty"`
+	HourlyRate   float64    `json:"hourly_rate"`
+	SetupRate    float64    `json:"setup_rate"`
+	Currency     string     `json:"currency"`
+	ValidFrom    time.Time  `json:"valid_from"`
+	ValidTo      *time.Time `json:"valid_to"`
+	Version      int        `json:"version" gorm:"default:1"`
+	SupersedesID string     `json:"supersedes_id,omitempty"` // 前一版本
+	IsActive     bool       `json:"is_active"`
+	CreatedBy    string     `json:"created_by"`
+	UpdatedBy    string     `json:"updated_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
 // OverheadRate 管理費率
 type OverheadRate struct {
-	ID             string    `json:"id" gorm:"primaryKey"`
-	CompanyID      string    `json:"company_id" gorm:"index"`
-	Department     string    `json:"department"`
-	RateType       string    `json:"rate_type"` // percentage, fixed
-	RateValue      float64   `json:"rate_value"`
-	BasedOn        string    `json:"based_on"` // material_cost, process_cost, total_cost
-	ValidFrom      time.Time `json:"valid_from"`
-	ValidTo        *time.Time `json:"valid_to"`
-	IsActive       bool      `json:"is_active"`
-	CreatedBy      string    `json:"created_by"`
-	UpdatedBy      string    `json:"updated_by"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID           string     `json:"id" gorm:"primaryKey"`
+	CompanyID    string     `json:"company_id" gorm:"index"`
+	Department   string     `json:"department"`
+	RateType     string     `json:"rate_type"`               // percentage, fixed
+	RateValue    float64    `json:"rate_value"`
+	BasedOn      string     `json:"based_on"`                // material_cost, process_cost, total_cost
+	ValidFrom    time.Time  `json:"valid_from"`
+	ValidTo      *time.Time `json:"valid_to"`
+	Version      int        `json:"version" gorm:"default:1"`
+	SupersedesID string     `json:"supersedes_id,omitempty"` // 前一版本
+	IsActive     bool       `json:"is_active"`
+	CreatedBy    string     `json:"created_by"`
+	UpdatedBy    string     `json:"updated_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
 // TableName overrides
@@ -292,20 +314,22 @@ func (CostSettings) TableName() string            { return "cost_settings" }
 
 // SurfaceTreatmentRate 表面處理費率
 type SurfaceTreatmentRate struct {
-	ID            string    `json:"id" gorm:"primaryKey"`
-	CompanyID     string    `json:"company_id" gorm:"index"`
-	TreatmentType string    `json:"treatment_type"`
-	TreatmentName string    `json:"treatment_name"`
-	BaseRate      float64   `json:"base_rate"`
-	Unit          string    `json:"unit"` // per_piece, per_kg, per_m2
-	MinCharge     float64   `json:"min_charge"`
-	ValidFrom     time.Time `json:"valid_from"`
+	ID            string     `json:"id" gorm:"primaryKey"`
+	CompanyID     string     `json:"company_id" gorm:"index"`
+	TreatmentType string     `json:"treatment_type"`
+	TreatmentName string     `json:"treatment_name"`
+	BaseRate      float64    `json:"base_rate"`
+	Unit          string     `json:"unit"`                    // per_piece, per_kg, per_m2
+	MinCharge     float64    `json:"min_charge"`
+	ValidFrom     time.Time  `json:"valid_from"`
 	ValidTo       *time.Time `json:"valid_to"`
-	IsActive      bool      `json:"is_active"`
-	CreatedBy     string    `json:"created_by"`
-	UpdatedBy     string    `json:"updated_by"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	Version       int        `json:"version" gorm:"default:1"`
+	SupersedesID  string     `json:"supersedes_id,omitempty"` // 前一版本
+	IsActive      bool       `json:"is_active"`
+	CreatedBy     string     `json:"created_by"`
+	UpdatedBy     string     `json:"updated_by"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
 }
 
 // CostData 成本數據
@@ -346,6 +370,9 @@ type CostCalculationRequest struct {
 	ProductCategory string     `json:"product_category" binding:"required"`
 	MaterialType    string     `json:"material_type"`
 	SizeRange       string     `json:"size_range"`
+	Diameter        float64    `json:"diameter"` // mm，未填時由 size_range 或品名解析
+	Length          float64    `json:"length"`   // mm
+	AsOf            *time.Time `json:"as_of"`    // 依該日有效的成本參數計算，預設今日
 	Quantity        int        `json:"quantity" binding:"required,min=1"`
 	MaterialCost    float64    `json:"material_cost"`
 	RouteID         *uuid.UUID `json:"route_id"`
@@ -397,6 +424,7 @@ type ProcessCostCalculationRequestNew struct {
 	BaseCurrency        string                 `json:"base_currency"`
 	TargetCurrency      string                 `json:"target_currency"`
 	UserID              string                 `json:"user_id"`
+	AsOf                *time.Time             `json:"as_of"` // 依該日有效的模板與費率版本計算，預設今日
 }
 
 // ProcessCostResult 製程成本計算結果
@@ -415,10 +443,32 @@ type ProcessCostResult struct {
 	ProfitMargin     float64            `json:"profit_margin"`
 	Currency         string             `json:"currency"`
 	CostBreakdown    []CostDetail       `json:"cost_breakdown"`
+	AsOf             time.Time          `json:"as_of"`
+	RateVersions     []RateVersionPin   `json:"rate_versions"`
 	CalculatedAt     time.Time          `json:"calculated_at"`
 	CalculatedBy     string             `json:"calculated_by"`
 }
 
+// 費率版本種類
+const (
+	RateKindTemplate         = "template"
+	RateKindMaterial         = "material"
+	RateKindProcessingRate   = "processing_rate"
+	RateKindSurfaceTreatment = "surface_treatment_rate"
+	RateKindOverheadRate     = "overhead_rate"
+	RateKindCostParameter    = "cost_parameter"
+)
+
+// RateVersionPin 成本計算所使用的模板或費率版本
+type RateVersionPin struct {
+	Kind      string    `json:"kind"`
+	ID        string    `json:"id"`
+	Key       string    `json:"key"` // 製程類型、材料代碼、處理類型、部門或參數類型
+	Version   int       `json:"version"`
+	ValidFrom time.Time `json:"valid_from"`
+	Value     float64   `json:"value"`
+}
+
 // CostDetail 成本明細
 type CostDetail struct {
 	Category     string  `json:"category"`
@@ -471,6 +521,8 @@ type CostAnalysis struct {
 	TrendData        []TrendPoint       `json:"trend_data"`
 	CostDrivers      []CostDriver       `json:"cost_drivers"`
 	TopProducts      []ProductCostInfo  `json:"top_products"`
+	JobsCosted       int                `json:"jobs_costed"`      // completed production orders compared with their estimate
+	VarianceDrivers  []CostVariance     `json:"variance_drivers"` // actual against estimated cost per driver
 }
 
 // TrendPoint 趨勢點
@@ -488,6 +540,19 @@ type CostDriver struct {
 	Description string  `json:"description"`
 }
 
+// CostVariance 成本差異
+type CostVariance struct {
+	Driver       string  `json:"driver"`
+	Jobs         int     `json:"jobs"`
+	Estimated    float64 `json:"estimated"`
+	Actual       float64 `json:"actual"`
+	Variance     float64 `json:"variance"`
+	Percentage   float64 `json:"percentage"`
+	Factor       float64 `json:"factor"` // actual / estimated, to apply to template rates
+	Unfavourable int     `json:"unfavourable"`
+	Description  string  `json:"description"`
+}
+
 // ProductCostInfo 產品成本資訊
 type ProductCostInfo struct {
 	ProductID    string  `json:"product_id"`
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Drawing revision statuses
+const (
+	DrawingStatusCurrent    = "current"
+	DrawingStatusSuperseded = "superseded"
+)
+
+// Revision change flag statuses
+const (
+	RevisionFlagOpen       = "open"
+	RevisionFlagUpdated    = "updated"    // the document was moved to the new revision
+	RevisionFlagAccepted   = "accepted"   // the document stays on its revision, with a note why
+	RevisionFlagSuperseded = "superseded" // a later revision flagged the document again
+)
+
+// Documents a revision change is flagged on
+const (
+	RevisionDocumentQuoteItem       = "quote_item"
+	RevisionDocumentOrderItem       = "order_item"
+	RevisionDocumentProductionOrder = "production_order"
+)
+
+// FastenerSpecification is the structured specification of an inventory
+// item: the standard it is made to, its size, length, grade and finish
+type FastenerSpecification struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	InventoryID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"inventory_id"`
+	Standard    string     `gorm:"not null;index" json:"standard"` // DIN 933, ISO 4017, ASME B18.2.1
+	System      string     `gorm:"not null" json:"system"`         // metric, inch
+	Size        string     `gorm:"not null;index" json:"size"`     // M10, M10x1.25, 3/8-16
+	Length      float64    `json:"length"`                         // mm for metric, inches for inch standards
+	Grade       string     `gorm:"index" json:"grade"`             // 8.8, A2-70, Grade 5
+	Finish      string     `json:"finish"`
+	Material    string     `json:"material"`
+	Description string     `json:"description"` // e.g. DIN 933 M10x30 8.8 zinc plated
+	Notes       string     `json:"notes"`
+	UpdatedBy   *uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Relations
+	Inventory *Inventory `gorm:"foreignKey:InventoryID" json:"inventory,omitempty"`
+}
+
+// CustomerPart maps a customer's part number to our inventory item and
+// keeps the revision history of the customer's drawing of it
+type CustomerPart struct {
+	ID               uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	CustomerID       uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_customer_part_no" json:"customer_id"`
+	CustomerPartNo   string     `gorm:"not null;uniqueIndex:idx_customer_part_no" json:"customer_part_no"`
+	CustomerPartName string     `json:"customer_part_name"`
+	InventoryID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"inventory_id"`
+	CurrentRevision  string     `json:"current_revision"`
+	CurrentDrawingID *uuid.UUID `gorm:"type:uuid" json:"current_drawing_id"`
+	IsActive         bool       `gorm:"default:true" json:"is_active"`
+	Notes            string     `json:"notes"`
+	CreatedBy        uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+
+	// Relations
+	Customer      *Customer              `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	Inventory     *Inventory             `gorm:"foreignKey:InventoryID" json:"inventory,omitempty"`
+	Specification *FastenerSpecification `gorm:"foreignKey:InventoryID;references:InventoryID" json:"specification,omitempty"`
+	Drawings      []DrawingRevision      `gorm:"foreignKey:CustomerPartID" json:"drawings,omitempty"`
+}
+
+// DrawingRevision is an uploaded revision of the customer's drawing of a
+// part
+type DrawingRevision struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CustomerPartID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_drawing_revision" json:"customer_part_id"`
+	Revision          string     `gorm:"not null;uniqueIndex:idx_drawing_revision" json:"revision"`
+	Status            string     `gorm:"not null;default:'current'" json:"status"` // current, superseded
+	DrawingNo         string     `json:"drawing_no"`
+	ChangeDescription string     `json:"change_description"`
+	EffectiveDate     *time.Time `gorm:"type:date" json:"effective_date"`
+	FileName          string     `gorm:"not null" json:"file_name"`
+	FilePath          string     `json:"-"`
+	FileSize          int64      `json:"file_size"`
+	ContentType       string     `json:"content_type"`
+	Hash              string     `json:"hash"` // hex SHA-256
+	UploadedBy        uuid.UUID  `gorm:"type:uuid;not null" json:"uploaded_by"`
+	UploadedAt        time.Time  `gorm:"not null" json:"uploaded_at"`
+}
+
+// RevisionChangeFlag marks an open quote, order or production order made
+// to an earlier drawing revision than the part's current one, until it is
+// moved to the new revision or accepted on its own
+type RevisionChangeFlag struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID         uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	CustomerPartID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"customer_part_id"`
+	DrawingRevisionID uuid.UUID  `gorm:"type:uuid;not null" json:"drawing_revision_id"`
+	DocumentType      string     `gorm:"not null;index:idx_revision_flag_document" json:"document_type"` // quote_item, order_item, production_order
+	DocumentID        uuid.UUID  `gorm:"type:uuid;not null;index:idx_revision_flag_document" json:"document_id"`
+	DocumentNo        string     `json:"document_no"`                                 // quote or order number
+	ParentID          *uuid.UUID `gorm:"type:uuid" json:"parent_id"`                  // quote or order of an item
+	DocumentRevision  string     `json:"document_revision"`                           // revision the document was made to
+	Revision          string     `gorm:"not null" json:"revision"`                    // the new revision
+	Status            string     `gorm:"not null;default:'open';index" json:"status"` // open, updated, accepted, superseded
+	Resolution        string     `json:"resolution"`
+	ResolvedBy        *uuid.UUID `gorm:"type:uuid" json:"resolved_by"`
+	ResolvedAt        *time.Time `json:"resolved_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+
+	// Relations
+	CustomerPart *CustomerPart `gorm:"foreignKey:CustomerPartID" json:"customer_part,omitempty"`
+}
+
+// BeforeCreate hooks
+func (s *FastenerSpecification) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+func (p *CustomerPart) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+func (d *DrawingRevision) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+func (f *RevisionChangeFlag) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -23,6 +24,8 @@ type ProductionOrder struct {
 	// Production Details
 	ProductName       string     `gorm:"not null" json:"product_name"`
 	ProductSpec       string     `json:"product_spec"`
+	CustomerPartID    *uuid.UUID `gorm:"type:uuid;index" json:"customer_part_id"`
+	DrawingRevision   string     `json:"drawing_revision"` // revision of the customer drawing to make
 	PlannedQuantity   float64    `gorm:"not null" json:"planned_quantity"`
 	ProducedQuantity  float64    `json:"produced_quantity"`
 	QualifiedQuantity float64    `json:"qualified_quantity"`
@@ -132,6 +135,19 @@ type RouteOperation struct {
 	QCRequired        bool       `gorm:"default:false" json:"qc_required"`
 	QCInstructions    string     `json:"qc_instructions"`
 	
+	// Subcontracting: the operation is done by a subcontractor, its work
+	// station being where the material is dispatched from
+	Subcontracted           bool       `gorm:"default:false" json:"subcontracted"`
+	SubcontractorID         *uuid.UUID `gorm:"type:uuid" json:"subcontractor_id"`         // default supplier
+	SubcontractProcess      string     `json:"subcontract_process"`                        // plating, heat_treatment, other
+	SubcontractFeeBasis     string     `json:"subcontract_fee_basis"`                      // piece, kg, lot
+	SubcontractFeeRate      float64    `json:"subcontract_fee_rate"`
+	SubcontractMinimumFee   float64    `json:"subcontract_minimum_fee"`                    // per receipt
+	SubcontractCurrency     string     `json:"subcontract_currency"`
+	ExpectedWeightChangePct float64    `json:"expected_weight_change_pct"`                 // positive for a gain
+	WeightTolerancePct      float64    `json:"weight_tolerance_pct"`                       // percentage points either way
+	MinYieldPct             float64    `json:"min_yield_pct"`
+	
 	// Next Operation
 	NextOperationID   *uuid.UUID `gorm:"type:uuid" json:"next_operation_id"`
 	
@@ -142,6 +158,7 @@ type RouteOperation struct {
 	// Relations
 	Route             *ProductionRoute `gorm:"foreignKey:RouteID" json:"route,omitempty"`
 	WorkStation       *WorkStation     `gorm:"foreignKey:WorkStationID" json:"work_station,omitempty"`
+	Subcontractor     *Supplier        `gorm:"foreignKey:SubcontractorID" json:"subcontractor,omitempty"`
 	NextOperation     *RouteOperation  `gorm:"foreignKey:NextOperationID" json:"next_operation,omitempty"`
 }
 
@@ -267,6 +284,7 @@ type ProductionMaterial struct {
 	ConsumedQuantity  float64    `json:"consumed_quantity"`
 	ReturnedQuantity  float64    `json:"returned_quantity"`
 	Unit              string     `gorm:"not null" json:"unit"`
+	HeatNo            string     `json:"heat_no"`                         // heat of the material issued, for the mill certificate
 	
 	// Cost
 	UnitCost          float64    `json:"unit_cost"`
@@ -310,6 +328,18 @@ type QualityInspection struct {
 	DefectQuantity    float64    `json:"defect_quantity"`
 	Unit              string     `gorm:"not null" json:"unit"`
 	
+	// Sampling (ISO 2859-1); set when the lot is inspected under a sampling plan
+	SupplierID        *uuid.UUID `gorm:"type:uuid" json:"supplier_id"`
+	SamplingPlanID    *uuid.UUID `gorm:"type:uuid" json:"sampling_plan_id"`
+	SamplingStateID   *uuid.UUID `gorm:"type:uuid" json:"sampling_state_id"`
+	LotQuantity       float64    `json:"lot_quantity"`
+	InspectionLevel   string     `json:"inspection_level"`
+	Severity          string     `json:"severity"`         // normal, tightened, reduced
+	SampleSize        int        `json:"sample_size"`      // largest sample of the defect classes
+	SamplingPlans     datatypes.JSON `gorm:"type:jsonb" json:"sampling_plans"` // sample size, Ac/Re and outcome per defect class
+	Decision          string     `json:"decision"`         // accept, reject
+	DecidedAt         *time.Time `json:"decided_at"`
+	
 	// Defect Analysis
 	DefectTypes       string     `json:"defect_types"`     // JSON array of defect types
 	DefectReasons     string     `json:"defect_reasons"`   // JSON array of defect reasons
@@ -343,6 +373,7 @@ type QualityInspection struct {
 	Inventory         *Inventory       `gorm:"foreignKey:InventoryID" json:"inventory,omitempty"`
 	Inspector         *User            `gorm:"foreignKey:InspectorID" json:"inspector,omitempty"`
 	Approver          *User            `gorm:"foreignKey:ApprovedBy" json:"approver,omitempty"`
+	SamplingPlan      *SamplingPlan    `gorm:"foreignKey:SamplingPlanID" json:"sampling_plan,omitempty"`
 }
 
 func (qi *QualityInspection) BeforeCreate(tx *gorm.DB) error {
@@ -44,6 +44,8 @@ type QuoteItem struct {
 	ItemNo            int               `json:"item_no" gorm:"not null"`
 	ProductName       string            `json:"product_name" gorm:"type:varchar(200);not null"`
 	ProductSpecs      string            `json:"product_specs" gorm:"type:text"`
+	CustomerPartID    *uuid.UUID        `json:"customer_part_id" gorm:"type:uuid;index"`
+	DrawingRevision   string            `json:"drawing_revision" gorm:"type:varchar(20)"` // revision of the customer drawing quoted
 	Quantity          int               `json:"quantity" gorm:"not null"`
 	Unit              string            `json:"unit" gorm:"type:varchar(20);not null"`
 	UnitPrice         float64           `json:"unit_price" gorm:"type:decimal(15,4);not null"`
@@ -197,6 +199,8 @@ type CreateQuoteRequest struct {
 type QuoteItemRequest struct {
 	ProductName       string     `json:"product_name" binding:"required"`
 	ProductSpecs      string     `json:"product_specs"`
+	CustomerPartID    *uuid.UUID `json:"customer_part_id"`
+	DrawingRevision   string     `json:"drawing_revision"`
 	Quantity          int        `json:"quantity" binding:"required,min=1"`
 	Unit              string     `json:"unit" binding:"required"`
 	UnitPrice         float64    `json:"unit_price" binding:"required,min=0"`
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Purchase requisition statuses
+const (
+	RequisitionStatusOpen      = "open"
+	RequisitionStatusRFQ       = "rfq"
+	RequisitionStatusOrdered   = "ordered"
+	RequisitionStatusCancelled = "cancelled"
+)
+
+// Supplier RFQ statuses
+const (
+	RFQStatusDraft     = "draft"
+	RFQStatusSent      = "sent"
+	RFQStatusAwarded   = "awarded"
+	RFQStatusCancelled = "cancelled"
+)
+
+// RFQ invitation statuses
+const (
+	RFQInvitationInvited   = "invited"
+	RFQInvitationViewed    = "viewed"
+	RFQInvitationSubmitted = "submitted"
+	RFQInvitationDeclined  = "declined"
+)
+
+// Supplier bid statuses
+const (
+	BidStatusSubmitted = "submitted"
+	BidStatusAwarded   = "awarded"
+	BidStatusRejected  = "rejected"
+)
+
+// PurchaseRequisition is an internal request to buy materials or services
+// that purchasing turns into an RFQ and then a purchase order
+type PurchaseRequisition struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	RequisitionNo string     `gorm:"not null;uniqueIndex" json:"requisition_no"`
+	Title         string     `gorm:"not null" json:"title"`
+	Status        string     `gorm:"not null;index" json:"status"` // open, rfq, ordered, cancelled
+	NeededBy      *time.Time `json:"needed_by"`
+	Notes         string     `json:"notes"`
+	RequestedBy   uuid.UUID  `gorm:"type:uuid;not null" json:"requested_by"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// Relations
+	Items []PurchaseRequisitionItem `gorm:"foreignKey:RequisitionID" json:"items,omitempty"`
+}
+
+// PurchaseRequisitionItem is a material or service requested
+type PurchaseRequisitionItem struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	RequisitionID uuid.UUID  `gorm:"type:uuid;not null;index" json:"requisition_id"`
+	LineNo        int        `gorm:"not null" json:"line_no"`
+	InventoryID   *uuid.UUID `gorm:"type:uuid" json:"inventory_id"`
+	Category      string     `json:"category"` // wire_rod, plating, heat_treatment, ...
+	Description   string     `gorm:"not null" json:"description"`
+	Specification string     `json:"specification"`
+	Quantity      float64    `gorm:"not null" json:"quantity"`
+	Unit          string     `gorm:"not null" json:"unit"`
+}
+
+// SupplierRFQ is a request for quotation sent to several suppliers. Bids
+// are compared in BaseCurrency with the cost, lead time and rating weights
+// of the RFQ.
+type SupplierRFQ struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	RFQNo           string     `gorm:"column:rfq_no;not null;uniqueIndex" json:"rfq_no"`
+	RequisitionID   *uuid.UUID `gorm:"type:uuid;index" json:"requisition_id"`
+	Title           string     `gorm:"not null" json:"title"`
+	Status          string     `gorm:"not null;index" json:"status"` // draft, sent, awarded, cancelled
+	ResponseDue     time.Time  `gorm:"not null" json:"response_due"`
+	NeededBy        *time.Time `json:"needed_by"`
+	Terms           string     `json:"terms"` // shown to the suppliers
+	BaseCurrency    string     `gorm:"not null" json:"base_currency"`
+	CostWeight      float64    `json:"cost_weight"`
+	LeadTimeWeight  float64    `json:"lead_time_weight"`
+	RatingWeight    float64    `json:"rating_weight"`
+	SentAt          *time.Time `json:"sent_at"`
+	AwardedBidID    *uuid.UUID `gorm:"type:uuid" json:"awarded_bid_id"`
+	PurchaseOrderID *uuid.UUID `gorm:"type:uuid" json:"purchase_order_id"`
+	AwardedBy       *uuid.UUID `gorm:"type:uuid" json:"awarded_by"`
+	AwardedAt       *time.Time `json:"awarded_at"`
+	CreatedBy       uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	// Relations
+	Items       []SupplierRFQItem       `gorm:"foreignKey:RFQID" json:"items,omitempty"`
+	Invitations []SupplierRFQInvitation `gorm:"foreignKey:RFQID" json:"invitations,omitempty"`
+}
+
+// SupplierRFQItem is a line suppliers are asked to quote
+type SupplierRFQItem struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	RFQID             uuid.UUID  `gorm:"column:rfq_id;type:uuid;not null;index" json:"rfq_id"`
+	LineNo            int        `gorm:"not null" json:"line_no"`
+	RequisitionItemID *uuid.UUID `gorm:"type:uuid" json:"requisition_item_id"`
+	InventoryID       *uuid.UUID `gorm:"type:uuid" json:"inventory_id"`
+	Category          string     `json:"category"`
+	Description       string     `gorm:"not null" json:"description"`
+	Specification     string     `json:"specification"`
+	Quantity          float64    `gorm:"not null" json:"quantity"`
+	Unit              string     `gorm:"not null" json:"unit"`
+}
+
+// SupplierRFQInvitation invites a supplier to bid. The supplier reaches the
+// RFQ and submits its bid with Token, without an account.
+type SupplierRFQInvitation struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	RFQID         uuid.UUID  `gorm:"column:rfq_id;type:uuid;not null;uniqueIndex:idx_rfq_invitation_supplier" json:"rfq_id"`
+	SupplierID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_rfq_invitation_supplier" json:"supplier_id"`
+	Token         string     `gorm:"not null;uniqueIndex" json:"token"`
+	Email         string     `json:"email"`
+	Status        string     `gorm:"not null" json:"status"` // invited, viewed, submitted, declined
+	SentAt        *time.Time `json:"sent_at"`
+	SendError     string     `json:"send_error"`
+	ViewedAt      *time.Time `json:"viewed_at"`
+	RespondedAt   *time.Time `json:"responded_at"`
+	DeclineReason string     `json:"decline_reason"`
+	CreatedAt     time.Time  `json:"created_at"`
+
+	// Relations
+	Supplier *Supplier `gorm:"foreignKey:SupplierID" json:"supplier,omitempty"`
+}
+
+// SupplierBid is a supplier's answer to an RFQ; resubmitting replaces its
+// lines until the response is due
+type SupplierBid struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	RFQID        uuid.UUID `gorm:"column:rfq_id;type:uuid;not null;index" json:"rfq_id"`
+	InvitationID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex" json:"invitation_id"`
+	SupplierID   uuid.UUID `gorm:"type:uuid;not null;index" json:"supplier_id"`
+	Status       string    `gorm:"not null" json:"status"` // submitted, awarded, rejected
+	Currency     string    `gorm:"not null" json:"currency"`
+	ValidUntil   time.Time `gorm:"type:date;not null" json:"valid_until"`
+	PaymentTerms string    `json:"payment_terms"`
+	Incoterm     string    `json:"incoterm"`
+	FreightCost  float64   `json:"freight_cost"` // in Currency
+	ToolingCost  float64   `json:"tooling_cost"` // one-off, in Currency
+	Notes        string    `json:"notes"`
+	SubmittedAt  time.Time `gorm:"not null" json:"submitted_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// Relations
+	Lines    []SupplierBidLine `gorm:"foreignKey:BidID" json:"lines,omitempty"`
+	Supplier *Supplier         `gorm:"foreignKey:SupplierID" json:"supplier,omitempty"`
+}
+
+// SupplierBidLine quotes an RFQ item
+type SupplierBidLine struct {
+	ID           uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	BidID        uuid.UUID      `gorm:"type:uuid;not null;index" json:"bid_id"`
+	RFQItemID    uuid.UUID      `gorm:"column:rfq_item_id;type:uuid;not null" json:"rfq_item_id"`
+	PriceBreaks  datatypes.JSON `gorm:"type:jsonb" json:"price_breaks"` // [{min_quantity, unit_price}]
+	MOQ          float64        `gorm:"column:moq" json:"moq"`
+	LeadTimeDays int            `json:"lead_time_days"`
+	Notes        string         `json:"notes"`
+}
+
+// BeforeCreate hooks
+func (r *PurchaseRequisition) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+func (i *PurchaseRequisitionItem) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
+func (r *SupplierRFQ) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+func (i *SupplierRFQItem) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
+func (i *SupplierRFQInvitation) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
+func (b *SupplierBid) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	return nil
+}
+
+func (l *SupplierBidLine) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
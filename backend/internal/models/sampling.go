@@ -0,0 +1,125 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Defect classes of a sampling plan
+const (
+	DefectClassCritical = "critical"
+	DefectClassMajor    = "major"
+	DefectClassMinor    = "minor"
+)
+
+// Inspection decisions
+const (
+	InspectionAccept = "accept"
+	InspectionReject = "reject"
+)
+
+// Sampling switching scopes
+const (
+	SamplingScopeSupplier        = "supplier"
+	SamplingScopeProduct         = "product"
+	SamplingScopeSupplierProduct = "supplier_product"
+)
+
+// SamplingPlan configures inspection by attributes after ISO 2859-1: the
+// inspection level and an AQL per defect class. A plan applies to the
+// inspections of its type, supplier and product; empty fields match any.
+type SamplingPlan struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	Name            string     `gorm:"not null" json:"name"`
+	InspectionType  string     `json:"inspection_type"` // incoming, in_process, final, customer_return; empty for all
+	SupplierID      *uuid.UUID `gorm:"type:uuid;index" json:"supplier_id"`
+	InventoryID     *uuid.UUID `gorm:"type:uuid;index" json:"inventory_id"`
+	InspectionLevel string     `gorm:"not null;default:'II'" json:"inspection_level"` // S-1 to S-4, I, II, III
+	CriticalAQL     float64    `json:"critical_aql"`                                  // 0 for zero acceptance
+	MajorAQL        float64    `json:"major_aql"`
+	MinorAQL        float64    `json:"minor_aql"`
+	SwitchingScope  string     `gorm:"not null;default:'supplier'" json:"switching_scope"` // supplier, product, supplier_product
+	IsActive        bool       `gorm:"default:true" json:"is_active"`
+	CreatedBy       *uuid.UUID `gorm:"type:uuid" json:"created_by"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// SamplingState tracks the switching rules of a plan for one supplier,
+// product or supplier and product
+type SamplingState struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	PlanID         uuid.UUID  `gorm:"type:uuid;not null;index" json:"plan_id"`
+	SupplierID     *uuid.UUID `gorm:"type:uuid" json:"supplier_id"`
+	InventoryID    *uuid.UUID `gorm:"type:uuid" json:"inventory_id"`
+	Severity       string     `gorm:"not null;default:'normal'" json:"severity"` // normal, tightened, reduced, discontinued
+	SwitchingScore int        `json:"switching_score"`
+	// RecentResults are the last lots on normal inspection, oldest first:
+	// A accepted, R not accepted
+	RecentResults       string     `json:"recent_results"`
+	ConsecutiveAccepted int        `json:"consecutive_accepted"` // on tightened inspection
+	TightenedRejected   int        `json:"tightened_rejected"`   // lots not accepted since tightened inspection started
+	ReducedEligible     bool       `json:"reduced_eligible"`
+	LotsInspected       int        `json:"lots_inspected"`
+	LastInspectionID    *uuid.UUID `gorm:"type:uuid" json:"last_inspection_id"`
+	SwitchedAt          *time.Time `json:"switched_at"`
+	SwitchReason        string     `json:"switch_reason"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+
+	// Relations
+	Plan     *SamplingPlan    `gorm:"foreignKey:PlanID" json:"plan,omitempty"`
+	Switches []SamplingSwitch `gorm:"foreignKey:StateID" json:"switches,omitempty"`
+}
+
+// SamplingSwitch records a change of inspection severity
+type SamplingSwitch struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	StateID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"state_id"`
+	FromSeverity string     `json:"from_severity"`
+	ToSeverity   string     `json:"to_severity"`
+	Reason       string     `json:"reason"`
+	InspectionID *uuid.UUID `gorm:"type:uuid" json:"inspection_id"` // lot that triggered the switch; empty for manual switches
+	SwitchedBy   *uuid.UUID `gorm:"type:uuid" json:"switched_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// SamplingClassPlan is the sampling plan and outcome of one defect class of
+// an inspection, kept on QualityInspection.SamplingPlans
+type SamplingClassPlan struct {
+	Class          string  `json:"class"`
+	AQL            float64 `json:"aql"`
+	CodeLetter     string  `json:"code_letter"`
+	SampleSize     int     `json:"sample_size"`
+	Ac             int     `json:"ac"`
+	Re             int     `json:"re"`
+	FullInspection bool    `json:"full_inspection"`
+	Defects        *int    `json:"defects,omitempty"`
+	Accepted       *bool   `json:"accepted,omitempty"`
+}
+
+// BeforeCreate hooks
+func (p *SamplingPlan) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+func (s *SamplingState) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+func (s *SamplingSwitch) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// SupplierScorecardConfig sets how a company scores its suppliers; the
+// weights are relative and need not sum to 100
+type SupplierScorecardConfig struct {
+	ID                  uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID           uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"company_id"`
+	DeliveryWeight      float64    `gorm:"not null" json:"delivery_weight"`
+	QualityWeight       float64    `gorm:"not null" json:"quality_weight"`
+	PriceWeight         float64    `gorm:"not null" json:"price_weight"`
+	ResponseWeight      float64    `gorm:"not null" json:"response_weight"`
+	LateToleranceDays   int        `json:"late_tolerance_days"`   // days after the promised date still on time
+	PPMLimit            float64    `json:"ppm_limit"`             // defect rate scoring 0
+	PriceVarianceLimit  float64    `json:"price_variance_limit"`  // % over list price scoring 0
+	ResponseTargetHours float64    `json:"response_target_hours"` // confirmation time scoring 100
+	ResponseLimitHours  float64    `json:"response_limit_hours"`  // confirmation time scoring 0
+	UpdatedBy           *uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// SupplierScorecard is the performance of a supplier in a month measured
+// from its receipts, incoming inspections, order prices and confirmations.
+// Scores are 0 to 100 and nil for factors without data in the month.
+type SupplierScorecard struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_supplier_scorecard_period" json:"company_id"`
+	SupplierID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_supplier_scorecard_period" json:"supplier_id"`
+	PeriodStart time.Time `gorm:"type:date;not null;uniqueIndex:idx_supplier_scorecard_period" json:"period_start"`
+	PeriodEnd   time.Time `gorm:"type:date;not null" json:"period_end"`
+
+	// Metrics
+	Deliveries        int      `json:"deliveries"`
+	OnTimeDeliveries  int      `json:"on_time_deliveries"`
+	OnTimeRate        *float64 `json:"on_time_rate"` // %
+	InspectedQuantity float64  `json:"inspected_quantity"`
+	DefectQuantity    float64  `json:"defect_quantity"`
+	PPM               *float64 `gorm:"column:ppm" json:"ppm"`
+	ListValue         float64  `json:"list_value"`
+	PaidValue         float64  `json:"paid_value"`
+	PriceVariance     *float64 `json:"price_variance"` // % paid over list price
+	Responses         int      `json:"responses"`
+	AvgResponseHours  *float64 `json:"avg_response_hours"`
+	OpenConfirmations int      `json:"open_confirmations"` // orders sent and not yet confirmed, counted at their age
+
+	// Scores
+	DeliveryScore *float64       `json:"delivery_score"`
+	QualityScore  *float64       `json:"quality_score"`
+	PriceScore    *float64       `json:"price_score"`
+	ResponseScore *float64       `json:"response_score"`
+	OverallScore  *float64       `json:"overall_score"`
+	Weights       datatypes.JSON `gorm:"type:jsonb" json:"weights"` // configuration scored with
+
+	// Risk
+	RiskLevel   string         `json:"risk_level"` // low, medium, high, critical
+	RiskPoints  int            `json:"risk_points"`
+	RiskFactors datatypes.JSON `gorm:"type:jsonb" json:"risk_factors"`
+	Explanation string         `json:"explanation"`
+
+	ComputedAt time.Time `gorm:"not null" json:"computed_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// Relations
+	Supplier *Supplier `gorm:"foreignKey:SupplierID" json:"supplier,omitempty"`
+}
+
+// BeforeCreate hooks
+func (c *SupplierScorecardConfig) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+func (s *SupplierScorecard) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// SanctionsList records the currently loaded version of a consolidated sanctions list
+type SanctionsList struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	Source     string     `gorm:"not null;uniqueIndex" json:"source"` // ofac_sdn, eu, un
+	Name       string     `json:"name"`
+	SourceURL  string     `json:"source_url"`
+	Checksum   string     `json:"checksum"` // sha256 of the loaded files
+	EntryCount int        `json:"entry_count"`
+	LoadedAt   time.Time  `json:"loaded_at"`
+	LoadedBy   *uuid.UUID `gorm:"type:uuid" json:"loaded_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// SanctionsEntry is a designated party from a sanctions list
+type SanctionsEntry struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	ListID     uuid.UUID      `gorm:"type:uuid;not null;index" json:"list_id"`
+	Source     string         `gorm:"not null;index" json:"source"`
+	ExternalID string         `gorm:"not null" json:"external_id"` // list's own reference number
+	EntryType  string         `json:"entry_type"`                  // individual, entity, vessel, aircraft
+	Name       string         `gorm:"not null" json:"name"`
+	Aliases    datatypes.JSON `gorm:"type:jsonb" json:"aliases"`   // []string
+	Addresses  datatypes.JSON `gorm:"type:jsonb" json:"addresses"` // []string
+	Countries  datatypes.JSON `gorm:"type:jsonb" json:"countries"` // []string
+	Programs   datatypes.JSON `gorm:"type:jsonb" json:"programs"`  // []string
+	Remarks    string         `json:"remarks"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// ScreeningPolicy holds a company's matching thresholds
+type ScreeningPolicy struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"company_id"`
+	MatchScore    float64    `gorm:"not null" json:"match_score"`    // minimum combined score stored as a hit
+	NameScore     float64    `gorm:"not null" json:"name_score"`     // minimum name similarity
+	AddressWeight float64    `gorm:"not null" json:"address_weight"` // how much a matching address raises the score
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	UpdatedBy     *uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+}
+
+// ScreeningHit is a potential match between a business partner and a sanctions list entry
+type ScreeningHit struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	PartyType       string     `gorm:"not null;index:idx_screening_hit_party" json:"party_type"` // customer, supplier, shipment
+	PartyID         uuid.UUID  `gorm:"type:uuid;not null;index:idx_screening_hit_party" json:"party_id"`
+	PartyName       string     `json:"party_name"`
+	PartyAddress    string     `json:"party_address"`
+	PartyCountry    string     `json:"party_country"`
+	ListSource      string     `gorm:"not null" json:"list_source"`
+	EntryExternalID string     `gorm:"not null" json:"entry_external_id"`
+	EntryName       string     `json:"entry_name"`
+	EntryType       string     `json:"entry_type"`
+	MatchedName     string     `json:"matched_name"`
+	Programs        string     `json:"programs"`
+	Score           float64    `json:"score"`
+	NameScore       float64    `json:"name_score"`
+	AddressScore    float64    `json:"address_score"`
+	Trigger         string     `json:"trigger"`                      // manual, partner, order, shipment, list_update
+	Status          string     `gorm:"not null;index" json:"status"` // open, cleared, confirmed
+	ReviewedBy      *uuid.UUID `gorm:"type:uuid" json:"reviewed_by"`
+	ReviewedAt      *time.Time `json:"reviewed_at"`
+	ReviewNotes     string     `json:"review_notes"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	// Relations
+	Company  *Company `gorm:"foreignKey:CompanyID" json:"company,omitempty"`
+	Reviewer *User    `gorm:"foreignKey:ReviewedBy" json:"reviewer,omitempty"`
+}
+
+// BeforeCreate hooks
+func (l *SanctionsList) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
+
+func (e *SanctionsEntry) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+func (p *ScreeningPolicy) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+func (h *ScreeningHit) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Characteristic types of fasteners
+const (
+	CharacteristicPitchDiameter = "pitch_diameter"
+	CharacteristicHeadHeight    = "head_height"
+	CharacteristicHardness      = "hardness"
+	CharacteristicTorque        = "torque"
+	CharacteristicOther         = "other"
+)
+
+// QualityCharacteristic is a measured characteristic of a product with its
+// nominal value, tolerance and gauge. Measurements are taken in subgroups
+// of SubgroupSize; 1 charts them as individuals (I-MR), 2 to 10 as X̄-R.
+type QualityCharacteristic struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	InventoryID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"inventory_id"`
+	Code           string     `json:"code"`
+	Name           string     `gorm:"not null" json:"name"`
+	Type           string     `gorm:"not null;default:'other'" json:"type"` // pitch_diameter, head_height, hardness, torque, other
+	Unit           string     `json:"unit"`                                 // mm, HRC, N·m
+	Nominal        float64    `json:"nominal"`
+	LowerTolerance *float64   `json:"lower_tolerance"` // signed deviation from nominal, e.g. -0.05; nil for no lower limit
+	UpperTolerance *float64   `json:"upper_tolerance"` // nil for no upper limit
+	Gauge          string     `json:"gauge"`           // instrument used, e.g. thread micrometer, Rockwell tester
+	SubgroupSize   int        `gorm:"not null;default:5" json:"subgroup_size"`
+	ChartWindow    int        `gorm:"not null;default:25" json:"chart_window"` // subgroups the control limits are computed over
+	IsActive       bool       `gorm:"default:true" json:"is_active"`
+	CreatedBy      *uuid.UUID `gorm:"type:uuid" json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relations
+	Inventory *Inventory `gorm:"foreignKey:InventoryID" json:"inventory,omitempty"`
+}
+
+// Limits returns the lower and upper specification limits
+func (c *QualityCharacteristic) Limits() (lsl, usl *float64) {
+	if c.LowerTolerance != nil {
+		l := c.Nominal + *c.LowerTolerance
+		lsl = &l
+	}
+	if c.UpperTolerance != nil {
+		u := c.Nominal + *c.UpperTolerance
+		usl = &u
+	}
+	return lsl, usl
+}
+
+// CharacteristicMeasurement is one measured value of a characteristic,
+// numbered by subgroup and its position in the subgroup
+type CharacteristicMeasurement struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID         uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	CharacteristicID  uuid.UUID  `gorm:"type:uuid;not null;index:idx_characteristic_subgroup" json:"characteristic_id"`
+	Subgroup          int        `gorm:"not null;index:idx_characteristic_subgroup" json:"subgroup"`
+	Sequence          int        `gorm:"not null" json:"sequence"`
+	Value             float64    `gorm:"not null" json:"value"`
+	OutOfSpec         bool       `json:"out_of_spec"`
+	InspectionID      *uuid.UUID `gorm:"type:uuid;index" json:"inspection_id"`
+	ProductionOrderID *uuid.UUID `gorm:"type:uuid;index" json:"production_order_id"`
+	GaugeID           string     `json:"gauge_id"` // serial of the gauge used
+	MeasuredBy        *uuid.UUID `gorm:"type:uuid" json:"measured_by"`
+	MeasuredAt        time.Time  `gorm:"not null" json:"measured_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// SPCAlert is a Western Electric rule violation on a characteristic's
+// control chart, raised once per chart, rule and subgroup
+type SPCAlert struct {
+	ID               uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	CharacteristicID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_spc_alert" json:"characteristic_id"`
+	Chart            string     `gorm:"not null;uniqueIndex:idx_spc_alert" json:"chart"` // xbar, r, i, mr
+	Rule             int        `gorm:"not null;uniqueIndex:idx_spc_alert" json:"rule"`
+	Subgroup         int        `gorm:"not null;uniqueIndex:idx_spc_alert" json:"subgroup"`
+	Value            float64    `json:"value"`
+	Center           float64    `json:"center"`
+	UCL              float64    `json:"ucl"`
+	LCL              float64    `json:"lcl"`
+	Description      string     `json:"description"`
+	NotificationID   *uuid.UUID `gorm:"type:uuid" json:"notification_id"`
+	CreatedAt        time.Time  `json:"created_at"`
+
+	// Relations
+	Characteristic *QualityCharacteristic `gorm:"foreignKey:CharacteristicID" json:"characteristic,omitempty"`
+}
+
+// BeforeCreate hooks
+func (c *QualityCharacteristic) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+func (m *CharacteristicMeasurement) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+func (a *SPCAlert) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Subcontract order statuses
+const (
+	SubcontractStatusOpen            = "open"             // nothing shipped yet
+	SubcontractStatusAtVendor        = "at_vendor"        // shipped, nothing back yet
+	SubcontractStatusPartialReceived = "partial_received" // some back, some still at the subcontractor
+	SubcontractStatusReceived        = "received"         // everything shipped is back or scrapped
+	SubcontractStatusCancelled       = "cancelled"
+)
+
+// Subcontract processes
+const (
+	SubcontractProcessPlating       = "plating"
+	SubcontractProcessHeatTreatment = "heat_treatment"
+	SubcontractProcessOther         = "other"
+)
+
+// SubcontractOrder sends our own material to a subcontractor for an
+// operation of its route, such as zinc plating or heat treatment, and
+// receives the processed goods back into stock. The processing fee is
+// ordered on PurchaseOrderID, so the subcontractor's invoice is matched
+// like any other; receipts charge it to the production order's job cost.
+type SubcontractOrder struct {
+	ID                  uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	OrderNo             string     `gorm:"not null;uniqueIndex" json:"order_no"`
+	Status              string     `gorm:"not null;index" json:"status"` // open, at_vendor, partial_received, received, cancelled
+	Process             string     `gorm:"not null" json:"process"`      // plating, heat_treatment, other
+	SupplierID          uuid.UUID  `gorm:"type:uuid;not null;index" json:"supplier_id"`
+	VendorWarehouseID   uuid.UUID  `gorm:"type:uuid;not null" json:"vendor_warehouse_id"` // the subcontractor's location
+	PurchaseOrderID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"purchase_order_id"`
+	PurchaseOrderItemID uuid.UUID  `gorm:"type:uuid;not null" json:"purchase_order_item_id"` // the processing fee line
+	ProductionOrderID   *uuid.UUID `gorm:"type:uuid;index" json:"production_order_id"`
+	RouteOperationID    *uuid.UUID `gorm:"type:uuid" json:"route_operation_id"`
+	InventoryID         uuid.UUID  `gorm:"type:uuid;not null" json:"inventory_id"`        // material shipped
+	OutputInventoryID   uuid.UUID  `gorm:"type:uuid;not null" json:"output_inventory_id"` // processed goods received
+	PlannedQuantity     float64    `json:"planned_quantity"`
+	DueDate             *time.Time `json:"due_date"`
+
+	// Fee
+	FeeBasis   string  `gorm:"not null" json:"fee_basis"` // piece, kg, lot
+	FeeRate    float64 `json:"fee_rate"`
+	MinimumFee float64 `json:"minimum_fee"` // per receipt
+	Currency   string  `json:"currency"`
+	FeeAmount  float64 `json:"fee_amount"` // charged so far
+
+	// Expected of the process, copied from the route operation
+	ExpectedWeightChangePct float64 `json:"expected_weight_change_pct"`
+	WeightTolerancePct      float64 `json:"weight_tolerance_pct"`
+	MinYieldPct             float64 `json:"min_yield_pct"`
+
+	// Balance, weights in kg
+	ShippedQuantity  float64        `json:"shipped_quantity"`
+	ShippedWeight    float64        `json:"shipped_weight"`
+	ReceivedQuantity float64        `json:"received_quantity"`
+	ReceivedWeight   float64        `json:"received_weight"`
+	ScrapQuantity    float64        `json:"scrap_quantity"`
+	AtVendorQuantity float64        `json:"at_vendor_quantity"`
+	YieldPct         float64        `json:"yield_pct"`
+	WeightChangePct  float64        `json:"weight_change_pct"`
+	Deviations       datatypes.JSON `gorm:"type:jsonb" json:"deviations"` // [{code, expected, actual, message}]
+
+	Notes     string     `json:"notes"`
+	CreatedBy uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
+	ClosedAt  *time.Time `json:"closed_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	// Relations
+	Supplier        *Supplier             `gorm:"foreignKey:SupplierID" json:"supplier,omitempty"`
+	VendorWarehouse *Warehouse            `gorm:"foreignKey:VendorWarehouseID" json:"vendor_warehouse,omitempty"`
+	PurchaseOrder   *PurchaseOrder        `gorm:"foreignKey:PurchaseOrderID" json:"purchase_order,omitempty"`
+	ProductionOrder *ProductionOrder      `gorm:"foreignKey:ProductionOrderID" json:"production_order,omitempty"`
+	RouteOperation  *RouteOperation       `gorm:"foreignKey:RouteOperationID" json:"route_operation,omitempty"`
+	Inventory       *Inventory            `gorm:"foreignKey:InventoryID" json:"inventory,omitempty"`
+	OutputInventory *Inventory            `gorm:"foreignKey:OutputInventoryID" json:"output_inventory,omitempty"`
+	Shipments       []SubcontractShipment `gorm:"foreignKey:SubcontractOrderID" json:"shipments,omitempty"`
+	Receipts        []SubcontractReceipt  `gorm:"foreignKey:SubcontractOrderID" json:"receipts,omitempty"`
+}
+
+// SubcontractShipment is material shipped to the subcontractor
+type SubcontractShipment struct {
+	ID                 uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	SubcontractOrderID uuid.UUID  `gorm:"type:uuid;not null;index" json:"subcontract_order_id"`
+	Quantity           float64    `gorm:"not null" json:"quantity"`
+	Weight             float64    `json:"weight"` // kg
+	LotNo              string     `json:"lot_no"`
+	StockMovementID    *uuid.UUID `gorm:"type:uuid" json:"stock_movement_id"`
+	ShippedAt          time.Time  `gorm:"not null" json:"shipped_at"`
+	ShippedBy          uuid.UUID  `gorm:"type:uuid;not null" json:"shipped_by"`
+	Notes              string     `json:"notes"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// SubcontractReceipt is processed goods received back from the
+// subcontractor, with what was scrapped there and the fee it was charged
+type SubcontractReceipt struct {
+	ID                     uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	SubcontractOrderID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"subcontract_order_id"`
+	Quantity               float64    `json:"quantity"`
+	ScrapQuantity          float64    `json:"scrap_quantity"`
+	Weight                 float64    `json:"weight"` // kg
+	LotNo                  string     `json:"lot_no"`
+	ChargedQuantity        float64    `json:"charged_quantity"` // pieces, kg or lots
+	FeeAmount              float64    `json:"fee_amount"`
+	PurchaseOrderReceiptID *uuid.UUID `gorm:"type:uuid" json:"purchase_order_receipt_id"`
+	StockMovementID        *uuid.UUID `gorm:"type:uuid" json:"stock_movement_id"`
+	ReceivedAt             time.Time  `gorm:"not null" json:"received_at"`
+	ReceivedBy             uuid.UUID  `gorm:"type:uuid;not null" json:"received_by"`
+	Notes                  string     `json:"notes"`
+	CreatedAt              time.Time  `json:"created_at"`
+
+	// Relations
+	SubcontractOrder *SubcontractOrder `gorm:"foreignKey:SubcontractOrderID" json:"subcontract_order,omitempty"`
+}
+
+// BeforeCreate hooks
+func (o *SubcontractOrder) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
+func (s *SubcontractShipment) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+func (r *SubcontractReceipt) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
@@ -225,6 +225,7 @@ type PurchaseOrder struct {
 	CreatedBy         uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
 	ApprovedBy        *uuid.UUID `gorm:"type:uuid" json:"approved_by"`
 	ApprovedAt        *time.Time `json:"approved_at"`
+	ConfirmedAt       *time.Time `json:"confirmed_at"`       // confirmed by the supplier
 	
 	// Relations
 	Company           *Company              `gorm:"foreignKey:CompanyID" json:"company,omitempty"`
@@ -281,6 +282,30 @@ func (poi *PurchaseOrderItem) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// PurchaseOrderReceipt records a quantity of a purchase order item received
+type PurchaseOrderReceipt struct {
+	ID                  uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"company_id"`
+	PurchaseOrderID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"purchase_order_id"`
+	PurchaseOrderItemID uuid.UUID  `gorm:"type:uuid;not null" json:"purchase_order_item_id"`
+	SupplierID          uuid.UUID  `gorm:"type:uuid;not null;index" json:"supplier_id"`
+	InventoryID         *uuid.UUID `gorm:"type:uuid" json:"inventory_id"`
+	Quantity            float64    `gorm:"not null" json:"quantity"`
+	LotNo               string     `json:"lot_no"`
+	ReceivedAt          time.Time  `gorm:"not null" json:"received_at"`
+	QualityPassed       bool       `json:"quality_passed"`
+	InspectionNotes     string     `json:"inspection_notes"`
+	CreatedAt           time.Time  `json:"created_at"`
+	
+	// Relations
+	PurchaseOrder       *PurchaseOrder `gorm:"foreignKey:PurchaseOrderID" json:"purchase_order,omitempty"`
+}
+
+func (por *PurchaseOrderReceipt) BeforeCreate(tx *gorm.DB) error {
+	por.ID = uuid.New()
+	return nil
+}
+
 // SupplierEvaluation represents supplier performance evaluation
 type SupplierEvaluation struct {
 	ID                uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
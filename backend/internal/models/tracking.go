@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// CarrierIntegration configures how tracking events are obtained from a carrier
+type CarrierIntegration struct {
+	ID                  uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID           uuid.UUID      `gorm:"type:uuid;not null;index" json:"company_id"`
+	CarrierName         string         `gorm:"not null" json:"carrier_name"` // matched against Shipment.CarrierName
+	AdapterType         string         `gorm:"not null" json:"adapter_type"` // http, file
+	Endpoint            string         `json:"endpoint"`                     // URL template with {tracking_no} and {container_no}
+	Format              string         `gorm:"not null" json:"format"`       // json, csv, iftsta
+	FieldMap            datatypes.JSON `gorm:"type:jsonb" json:"field_map"`  // tracking.FieldMap
+	StatusMap           datatypes.JSON `gorm:"type:jsonb" json:"status_map"` // carrier status -> milestone overrides
+	Headers             datatypes.JSON `gorm:"type:jsonb" json:"headers,omitempty"`
+	PollIntervalMinutes int            `gorm:"default:60" json:"poll_interval_minutes"`
+	DelayThresholdHours int            `gorm:"default:24" json:"delay_threshold_hours"` // ETA slips beyond this notify the customer
+	IsActive            bool           `gorm:"default:true" json:"is_active"`
+	LastPolledAt        *time.Time     `json:"last_polled_at"`
+	LastError           string         `json:"last_error"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	CreatedBy           uuid.UUID      `gorm:"type:uuid" json:"created_by"`
+}
+
+// BeforeCreate hooks
+func (ci *CarrierIntegration) BeforeCreate(tx *gorm.DB) error {
+	if ci.ID == uuid.Nil {
+		ci.ID = uuid.New()
+	}
+	return nil
+}
@@ -72,7 +72,7 @@ type TradeDocument struct {
 	FileSize      int64      `json:"file_size"`
 	FileType      string     `json:"file_type"`
 	Version       int        `gorm:"default:1" json:"version"`
-	Status        string     `gorm:"not null" json:"status"`                  // draft, submitted, approved, rejected, expired
+	Status        string     `gorm:"not null" json:"status"`                  // draft, submitted, approved, rejected, expired, superseded
 	IsRequired    bool       `gorm:"default:false" json:"is_required"`
 	ValidFrom     *time.Time `json:"valid_from"`
 	ValidTo       *time.Time `json:"valid_to"`
@@ -102,6 +102,7 @@ type Shipment struct {
 	Type              string     `gorm:"not null" json:"type"`                 // import, export
 	Status            string     `gorm:"not null" json:"status"`               // pending, in_transit, customs, delivered, cancelled
 	Method            string     `gorm:"not null" json:"method"`               // sea, air, land, express
+	Incoterm          string     `json:"incoterm"`                             // EXW, FOB, CIF, etc.; falls back to the order's delivery method
 	CarrierName       string     `json:"carrier_name"`
 	TrackingNo        string     `json:"tracking_no"`
 	ContainerNo       string     `json:"container_no"`
@@ -112,10 +113,13 @@ type Shipment struct {
 	DestCountry       string     `gorm:"not null" json:"dest_country"`
 	DestPort          string     `json:"dest_port"`
 	DestAddress       string     `json:"dest_address"`
+	ConsigneeName     string     `json:"consignee_name"`                       // defaults to the order's customer
+	ConsigneeAddress  string     `json:"consignee_address"`                    // defaults to dest_address
 	EstimatedDeparture *time.Time `json:"estimated_departure"`
 	ActualDeparture   *time.Time `json:"actual_departure"`
 	EstimatedArrival  *time.Time `json:"estimated_arrival"`
 	ActualArrival     *time.Time `json:"actual_arrival"`
+	LastMilestone     string     `json:"last_milestone"`                       // gate_in, loaded, departed, arrived, customs_cleared, delivered
 	GrossWeight       float64    `json:"gross_weight"`                         // in kg
 	NetWeight         float64    `json:"net_weight"`                           // in kg
 	Volume            float64    `json:"volume"`                               // in m3
@@ -160,6 +164,11 @@ type ShipmentItem struct {
 	Currency      string    `gorm:"default:'USD'" json:"currency"`
 	TotalWeight   float64   `json:"total_weight"`                             // quantity * unit_weight
 	TotalValue    float64   `json:"total_value"`                              // quantity * unit_value
+	CartonCount          int     `json:"carton_count"`
+	QuantityPerCarton    float64 `json:"quantity_per_carton"`
+	NetWeightPerCarton   float64 `json:"net_weight_per_carton"`                // in kg
+	GrossWeightPerCarton float64 `json:"gross_weight_per_carton"`              // in kg
+	CartonMarks          string  `json:"carton_marks"`                         // Shipping marks printed on the cartons
 	CountryOrigin string    `json:"country_origin"`
 	Manufacturer  string    `json:"manufacturer"`
 	CreatedAt     time.Time `json:"created_at"`
@@ -176,7 +185,8 @@ type ShipmentEvent struct {
 	ID          uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
 	CompanyID   uuid.UUID  `gorm:"type:uuid;not null" json:"company_id"`
 	ShipmentID  uuid.UUID  `gorm:"type:uuid;not null" json:"shipment_id"`
-	EventType   string     `gorm:"not null" json:"event_type"`               // departure, arrival, customs_clearance, delivery, delay, etc.
+	EventType   string     `gorm:"not null" json:"event_type"`               // departure, arrival, customs_clearance, delivery, delay, etc.; tracking milestones for carrier events
+	CarrierStatus string   `json:"carrier_status"`                           // status as reported by the carrier
 	Status      string     `gorm:"not null" json:"status"`                   // completed, in_progress, pending, cancelled
 	Location    string     `json:"location"`
 	Description string     `json:"description"`
@@ -184,7 +194,7 @@ type ShipmentEvent struct {
 	Latitude    float64    `json:"latitude"`
 	EventTime   time.Time  `gorm:"not null" json:"event_time"`
 	RecordedAt  time.Time  `gorm:"not null" json:"recorded_at"`
-	Source      string     `json:"source"`                                   // manual, api, tracking, etc.
+	Source      string     `json:"source"`                                   // manual, api, tracking:<carrier>, etc.
 	CreatedAt   time.Time  `json:"created_at"`
 	CreatedBy   uuid.UUID  `gorm:"type:uuid" json:"created_by"`
 
@@ -222,7 +232,7 @@ type LetterOfCredit struct {
 	Terms             string     `json:"terms"`                                // JSON terms and conditions
 	UtilizedAmount    float64    `gorm:"default:0" json:"utilized_amount"`
 	AvailableAmount   float64    `json:"available_amount"`                     // amount - utilized_amount
-	Amendments        string     `json:"amendments"`                           // JSON amendments history
+	Amendments        string     `json:"amendments"`                           // Deprecated: legacy JSON history, see AmendmentHistory
 	CreatedAt         time.Time  `json:"created_at"`
 	UpdatedAt         time.Time  `json:"updated_at"`
 	CreatedBy         uuid.UUID  `gorm:"type:uuid" json:"created_by"`
@@ -232,6 +242,7 @@ type LetterOfCredit struct {
 	Creator    *User             `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
 	Shipments  []Shipment        `gorm:"foreignKey:LCID" json:"shipments,omitempty"`
 	Utilizations []LCUtilization `gorm:"foreignKey:LCID" json:"utilizations,omitempty"`
+	AmendmentHistory []LCAmendment `gorm:"foreignKey:LCID" json:"amendment_history,omitempty"`
 }
 
 // LCUtilization 信用狀使用記錄
@@ -256,6 +267,58 @@ type LCUtilization struct {
 	Creator *User          `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
 }
 
+// LCAmendment 信用狀修改
+// New* fields hold the proposed terms; nil means the term is unchanged.
+// Old* fields are captured when the beneficiary accepts the amendment so
+// that the terms in force on any past date can be reconstructed.
+type LCAmendment struct {
+	ID                  uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	CompanyID           uuid.UUID  `gorm:"type:uuid;not null" json:"company_id"`
+	LCID                uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_lc_amendment_no" json:"lc_id"`
+	AmendmentNo         int        `gorm:"not null;uniqueIndex:idx_lc_amendment_no" json:"amendment_no"`
+	Status              string     `gorm:"not null" json:"status"`               // pending, accepted, rejected
+	Reason              string     `json:"reason"`
+	NewAmount           *float64   `json:"new_amount"`
+	NewExpiryDate       *time.Time `json:"new_expiry_date"`
+	NewLastShipmentDate *time.Time `json:"new_last_shipment_date"`
+	NewPortOfLoading    *string    `json:"new_port_of_loading"`
+	NewPortOfDischarge  *string    `json:"new_port_of_discharge"`
+	OldAmount           *float64   `json:"old_amount"`
+	OldExpiryDate       *time.Time `json:"old_expiry_date"`
+	OldLastShipmentDate *time.Time `json:"old_last_shipment_date"`
+	OldPortOfLoading    *string    `json:"old_port_of_loading"`
+	OldPortOfDischarge  *string    `json:"old_port_of_discharge"`
+	IssuedAt            time.Time  `gorm:"not null" json:"issued_at"`            // Date the issuing bank issued the amendment
+	EffectiveAt         *time.Time `json:"effective_at"`                         // Set on acceptance
+	RespondedAt         *time.Time `json:"responded_at"`
+	RespondedBy         *uuid.UUID `gorm:"type:uuid" json:"responded_by"`
+	RejectedReason      string     `json:"rejected_reason"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	CreatedBy           uuid.UUID  `gorm:"type:uuid" json:"created_by"`
+
+	// Relations
+	Company   *Company        `gorm:"foreignKey:CompanyID" json:"company,omitempty"`
+	LC        *LetterOfCredit `gorm:"foreignKey:LCID" json:"lc,omitempty"`
+	Creator   *User           `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	Responder *User           `gorm:"foreignKey:RespondedBy" json:"responder,omitempty"`
+}
+
+// LCTerms 信用狀條款快照
+type LCTerms struct {
+	LCID             uuid.UUID  `json:"lc_id"`
+	AsOf             time.Time  `json:"as_of"`
+	Amount           float64    `json:"amount"`
+	Currency         string     `json:"currency"`
+	ExpiryDate       time.Time  `json:"expiry_date"`
+	LastShipmentDate *time.Time `json:"last_shipment_date"`
+	PortOfLoading    string     `json:"port_of_loading"`
+	PortOfDischarge  string     `json:"port_of_discharge"`
+	UtilizedAmount   float64    `json:"utilized_amount"`
+	AvailableAmount  float64    `json:"available_amount"`
+	AmendmentNo      int        `json:"amendment_no"`                         // Last accepted amendment in force, 0 if none
+}
+
 // TradeCompliance 貿易合規
 type TradeCompliance struct {
 	ID             uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
@@ -446,6 +509,13 @@ func (lcu *LCUtilization) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (la *LCAmendment) BeforeCreate(tx *gorm.DB) error {
+	if la.ID == uuid.Nil {
+		la.ID = uuid.New()
+	}
+	return nil
+}
+
 func (tc *TradeCompliance) BeforeCreate(tx *gorm.DB) error {
 	if tc.ID == uuid.Nil {
 		tc.ID = uuid.New()
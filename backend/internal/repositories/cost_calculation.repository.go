@@ -18,10 +18,14 @@ func NewCostCalculationRepository(db *gorm.DB) *CostCalculationRepository {
 
 // GetCurrentCostParameters 獲取當前有效的成本參數
 func (r *CostCalculationRepository) GetCurrentCostParameters() (map[string]models.CostParameter, error) {
+	return r.GetCostParametersAt(time.Now())
+}
+
+// GetCostParametersAt 獲取指定日期有效的成本參數
+func (r *CostCalculationRepository) GetCostParametersAt(at time.Time) (map[string]models.CostParameter, error) {
 	var params []models.CostParameter
-	now := time.Now()
 	
-	err := r.db.Where("effective_date <= ? AND (end_date IS NULL OR end_date >= ?)", now, now).
+	err := r.db.Where("effective_date <= ? AND (end_date IS NULL OR end_date >= ?)", at, at).
 		Find(&params).Error
 	if err != nil {
 		return nil, err
@@ -0,0 +1,288 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BankStatementRepository persists imported bank statements and the
+// reconciliation of their lines
+type BankStatementRepository interface {
+	// Statements
+	CreateStatement(ctx context.Context, statement *models.BankStatement) error
+	GetStatement(ctx context.Context, id uuid.UUID) (*models.BankStatement, error)
+	UpdateStatement(ctx context.Context, statement *models.BankStatement) error
+	ListStatements(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.BankStatement, int64, error)
+	FindStatementByHash(ctx context.Context, bankAccountID uuid.UUID, hash string) (*models.BankStatement, error)
+	LatestStatement(ctx context.Context, bankAccountID uuid.UUID) (*models.BankStatement, error)
+
+	// Lines
+	GetLine(ctx context.Context, id uuid.UUID) (*models.BankStatementLine, error)
+	LockLine(ctx context.Context, id uuid.UUID) (*models.BankStatementLine, error)
+	UpdateLine(ctx context.Context, line *models.BankStatementLine) error
+	ListLines(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.BankStatementLine, int64, error)
+	CountOpenLines(ctx context.Context, statementID uuid.UUID) (int64, error)
+
+	// Reconciliation
+	CreateReconciliation(ctx context.Context, reconciliation *models.BankReconciliation) error
+	SumReconciledForPayment(ctx context.Context, paymentID uuid.UUID) (float64, error)
+
+	// Open items
+	ListOpenInvoices(ctx context.Context, companyID uuid.UUID, currency string) ([]*models.Invoice, error)
+	ListPendingPayments(ctx context.Context, companyID uuid.UUID, currency string) ([]*models.Payment, error)
+	LockInvoice(ctx context.Context, id uuid.UUID) (*models.Invoice, error)
+	LockPayment(ctx context.Context, id uuid.UUID) (*models.Payment, error)
+}
+
+type bankStatementRepository struct {
+	db *gorm.DB
+}
+
+// NewBankStatementRepository creates a new bank statement repository
+func NewBankStatementRepository(db *gorm.DB) BankStatementRepository {
+	return &bankStatementRepository{db: db}
+}
+
+// Statements
+
+// CreateStatement stores the statement together with its lines
+func (r *bankStatementRepository) CreateStatement(ctx context.Context, statement *models.BankStatement) error {
+	return dbFor(ctx, r.db).Omit("BankAccount").Create(statement).Error
+}
+
+func (r *bankStatementRepository) GetStatement(ctx context.Context, id uuid.UUID) (*models.BankStatement, error) {
+	var statement models.BankStatement
+	err := dbFor(ctx, r.db).
+		Preload("BankAccount").
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("line_no") }).
+		Preload("Lines.Reconciliations").
+		Where("id = ?", id).
+		First(&statement).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &statement, nil
+}
+
+func (r *bankStatementRepository) UpdateStatement(ctx context.Context, statement *models.BankStatement) error {
+	return dbFor(ctx, r.db).Omit("BankAccount", "Lines").Save(statement).Error
+}
+
+func (r *bankStatementRepository) ListStatements(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.BankStatement, int64, error) {
+	var statements []*models.BankStatement
+	var total int64
+
+	query := dbFor(ctx, r.db).Model(&models.BankStatement{}).Where("company_id = ?", companyID)
+	if bankAccountID, ok := params["bank_account_id"].(uuid.UUID); ok {
+		query = query.Where("bank_account_id = ?", bankAccountID)
+	}
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, _ := params["page"].(int)
+	pageSize, _ := params["page_size"].(int)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+
+	err := query.Preload("BankAccount").
+		Order("to_date DESC, created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&statements).Error
+	return statements, total, err
+}
+
+func (r *bankStatementRepository) FindStatementByHash(ctx context.Context, bankAccountID uuid.UUID, hash string) (*models.BankStatement, error) {
+	var statement models.BankStatement
+	err := dbFor(ctx, r.db).Where("bank_account_id = ? AND file_hash = ?", bankAccountID, hash).First(&statement).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &statement, nil
+}
+
+// LatestStatement returns the statement with balances that ends last
+func (r *bankStatementRepository) LatestStatement(ctx context.Context, bankAccountID uuid.UUID) (*models.BankStatement, error) {
+	var statement models.BankStatement
+	err := dbFor(ctx, r.db).
+		Where("bank_account_id = ? AND has_balances = ?", bankAccountID, true).
+		Order("to_date DESC, created_at DESC").
+		First(&statement).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &statement, nil
+}
+
+// Lines
+
+func (r *bankStatementRepository) GetLine(ctx context.Context, id uuid.UUID) (*models.BankStatementLine, error) {
+	var line models.BankStatementLine
+	err := dbFor(ctx, r.db).
+		Preload("Reconciliations").
+		Where("id = ?", id).
+		First(&line).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &line, nil
+}
+
+// LockLine loads a line and locks it until the transaction in ctx ends
+func (r *bankStatementRepository) LockLine(ctx context.Context, id uuid.UUID) (*models.BankStatementLine, error) {
+	var line models.BankStatementLine
+	if err := lockRow(ctx, r.db, &line, id); err != nil {
+		return nil, err
+	}
+	return &line, nil
+}
+
+func (r *bankStatementRepository) UpdateLine(ctx context.Context, line *models.BankStatementLine) error {
+	return dbFor(ctx, r.db).Omit("Statement", "Reconciliations").Save(line).Error
+}
+
+func (r *bankStatementRepository) ListLines(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.BankStatementLine, int64, error) {
+	var lines []*models.BankStatementLine
+	var total int64
+
+	query := dbFor(ctx, r.db).Model(&models.BankStatementLine{}).Where("company_id = ?", companyID)
+	if statementID, ok := params["statement_id"].(uuid.UUID); ok {
+		query = query.Where("statement_id = ?", statementID)
+	}
+	if bankAccountID, ok := params["bank_account_id"].(uuid.UUID); ok {
+		query = query.Where("bank_account_id = ?", bankAccountID)
+	}
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if statuses, ok := params["statuses"].([]string); ok && len(statuses) > 0 {
+		query = query.Where("status IN ?", statuses)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, _ := params["page"].(int)
+	pageSize, _ := params["page_size"].(int)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+
+	err := query.Preload("Reconciliations").
+		Order("booking_date, line_no").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&lines).Error
+	return lines, total, err
+}
+
+// CountOpenLines counts the lines of a statement still to be reconciled
+func (r *bankStatementRepository) CountOpenLines(ctx context.Context, statementID uuid.UUID) (int64, error) {
+	var count int64
+	err := dbFor(ctx, r.db).Model(&models.BankStatementLine{}).
+		Where("statement_id = ? AND status NOT IN ?", statementID, []string{"reconciled", "ignored"}).
+		Count(&count).Error
+	return count, err
+}
+
+// Reconciliation
+
+func (r *bankStatementRepository) CreateReconciliation(ctx context.Context, reconciliation *models.BankReconciliation) error {
+	return dbFor(ctx, r.db).Omit("Invoice", "Payment").Create(reconciliation).Error
+}
+
+// SumReconciledForPayment returns the statement amounts allocated to a
+// pending payment so far
+func (r *bankStatementRepository) SumReconciledForPayment(ctx context.Context, paymentID uuid.UUID) (float64, error) {
+	var sum float64
+	err := dbFor(ctx, r.db).Model(&models.BankReconciliation{}).
+		Where("payment_id = ? AND type = ?", paymentID, "payment").
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&sum).Error
+	return sum, err
+}
+
+// Open items
+
+// ListOpenInvoices returns issued invoices with a balance in the currency
+func (r *bankStatementRepository) ListOpenInvoices(ctx context.Context, companyID uuid.UUID, currency string) ([]*models.Invoice, error) {
+	var invoices []*models.Invoice
+	err := dbFor(ctx, r.db).
+		Preload("Customer").
+		Preload("Supplier").
+		Where("company_id = ? AND currency = ? AND balance_amount > 0", companyID, currency).
+		Where("status IN ?", []string{"issued", "sent", "partial_paid", "overdue"}).
+		Order("due_date").
+		Find(&invoices).Error
+	return invoices, err
+}
+
+// ListPendingPayments returns recorded payments waiting for the bank
+func (r *bankStatementRepository) ListPendingPayments(ctx context.Context, companyID uuid.UUID, currency string) ([]*models.Payment, error) {
+	var payments []*models.Payment
+	err := dbFor(ctx, r.db).
+		Preload("Invoice").
+		Preload("Customer").
+		Preload("Supplier").
+		Where("company_id = ? AND currency = ? AND status = ?", companyID, currency, "pending").
+		Order("payment_date").
+		Find(&payments).Error
+	return payments, err
+}
+
+// LockInvoice loads an invoice allocated to a line and locks it until the
+// transaction in ctx ends
+func (r *bankStatementRepository) LockInvoice(ctx context.Context, id uuid.UUID) (*models.Invoice, error) {
+	var invoice models.Invoice
+	if err := lockRow(ctx, r.db, &invoice, id); err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// LockPayment loads a payment allocated to a line and locks it until the
+// transaction in ctx ends
+func (r *bankStatementRepository) LockPayment(ctx context.Context, id uuid.UUID) (*models.Payment, error) {
+	var payment models.Payment
+	if err := lockRow(ctx, r.db, &payment, id); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func lockRow(ctx context.Context, db *gorm.DB, row interface{}, id uuid.UUID) error {
+	err := dbFor(ctx, db).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		First(row).Error
+	if err == gorm.ErrRecordNotFound {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,306 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CustomerSettlement is a payment received on a sales invoice, with the
+// due date of the invoice
+type CustomerSettlement struct {
+	CustomerID  uuid.UUID
+	Amount      float64
+	DueDate     time.Time
+	PaymentDate time.Time
+}
+
+// Purchase order statuses with goods still to be received and paid for
+var forecastOpenPurchaseOrderStatuses = []string{"sent", "confirmed", "partial_received"}
+
+// Order statuses whose balance is expected but not yet invoiced
+var forecastOpenOrderStatuses = []string{"confirmed", "in_production", "quality_check", "ready_to_ship", "shipped"}
+
+// CashForecastRepository reads the documents that make up the cash forecast
+// and persists recurring expenses, scenarios and forecast snapshots
+type CashForecastRepository interface {
+	// Sources
+	ListBankAccounts(ctx context.Context, companyID uuid.UUID) ([]*models.BankAccount, error)
+	ListOpenReceivables(ctx context.Context, companyID uuid.UUID) ([]*models.Invoice, error)
+	ListSettlements(ctx context.Context, companyID uuid.UUID, since time.Time) ([]CustomerSettlement, error)
+	ListOpenPayables(ctx context.Context, companyID uuid.UUID) ([]*models.AccountPayable, error)
+	ListOpenOrders(ctx context.Context, companyID uuid.UUID) ([]*models.Order, error)
+	ListOpenPurchaseOrders(ctx context.Context, companyID uuid.UUID) ([]*models.PurchaseOrder, error)
+	ListOpenLCUtilizations(ctx context.Context, companyID uuid.UUID) ([]*models.LCUtilization, error)
+	ListPayments(ctx context.Context, companyID uuid.UUID, from, to time.Time) ([]*models.Payment, error)
+	ListCompanyIDs(ctx context.Context) ([]uuid.UUID, error)
+
+	// Recurring expenses
+	CreateRecurringExpense(ctx context.Context, expense *models.RecurringExpense) error
+	UpdateRecurringExpense(ctx context.Context, expense *models.RecurringExpense) error
+	GetRecurringExpense(ctx context.Context, id uuid.UUID) (*models.RecurringExpense, error)
+	ListRecurringExpenses(ctx context.Context, companyID uuid.UUID, activeOnly bool) ([]*models.RecurringExpense, error)
+
+	// Scenarios
+	CreateScenario(ctx context.Context, scenario *models.CashForecastScenario) error
+	UpdateScenario(ctx context.Context, scenario *models.CashForecastScenario) error
+	GetScenario(ctx context.Context, id uuid.UUID) (*models.CashForecastScenario, error)
+	ListScenarios(ctx context.Context, companyID uuid.UUID) ([]*models.CashForecastScenario, error)
+
+	// Snapshots
+	CreateSnapshot(ctx context.Context, snapshot *models.CashForecastSnapshot) error
+	GetSnapshot(ctx context.Context, id uuid.UUID) (*models.CashForecastSnapshot, error)
+	FindSnapshot(ctx context.Context, companyID uuid.UUID, scenarioID *uuid.UUID, weekStart time.Time) (*models.CashForecastSnapshot, error)
+	ListSnapshots(ctx context.Context, params map[string]interface{}) ([]*models.CashForecastSnapshot, int64, error)
+}
+
+type cashForecastRepository struct {
+	db *gorm.DB
+}
+
+// NewCashForecastRepository creates a new cash forecast repository
+func NewCashForecastRepository(db *gorm.DB) CashForecastRepository {
+	return &cashForecastRepository{db: db}
+}
+
+// Sources
+
+func (r *cashForecastRepository) ListBankAccounts(ctx context.Context, companyID uuid.UUID) ([]*models.BankAccount, error) {
+	var accounts []*models.BankAccount
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND status = ?", companyID, "active").
+		Find(&accounts).Error
+	return accounts, err
+}
+
+// ListOpenReceivables returns issued sales invoices with a balance
+func (r *cashForecastRepository) ListOpenReceivables(ctx context.Context, companyID uuid.UUID) ([]*models.Invoice, error) {
+	var invoices []*models.Invoice
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND type = ? AND balance_amount > 0", companyID, "sales").
+		Where("status IN ?", dunningOpenInvoiceStatuses).
+		Order("due_date").
+		Find(&invoices).Error
+	return invoices, err
+}
+
+// ListSettlements returns the payments received on sales invoices since a date
+func (r *cashForecastRepository) ListSettlements(ctx context.Context, companyID uuid.UUID, since time.Time) ([]CustomerSettlement, error) {
+	var settlements []CustomerSettlement
+	err := r.db.WithContext(ctx).Model(&models.Payment{}).
+		Select("invoices.customer_id, payments.amount, invoices.due_date, payments.payment_date").
+		Joins("JOIN invoices ON invoices.id = payments.invoice_id").
+		Where("invoices.company_id = ? AND invoices.type = ? AND invoices.customer_id IS NOT NULL", companyID, "sales").
+		Where("payments.status = ? AND payments.payment_date >= ?", "completed", since).
+		Scan(&settlements).Error
+	return settlements, err
+}
+
+// ListOpenPayables returns supplier invoices with a balance
+func (r *cashForecastRepository) ListOpenPayables(ctx context.Context, companyID uuid.UUID) ([]*models.AccountPayable, error) {
+	var payables []*models.AccountPayable
+	err := r.db.WithContext(ctx).
+		Preload("Invoice").
+		Where("company_id = ? AND balance_amount > 0 AND status IN ?", companyID, []string{"open", "partial"}).
+		Order("due_date").
+		Find(&payables).Error
+	return payables, err
+}
+
+// ListOpenOrders returns confirmed sales orders that are not invoiced yet
+func (r *cashForecastRepository) ListOpenOrders(ctx context.Context, companyID uuid.UUID) ([]*models.Order, error) {
+	var orders []*models.Order
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND invoice_id IS NULL AND status IN ?", companyID, forecastOpenOrderStatuses).
+		Order("delivery_date").
+		Find(&orders).Error
+	return orders, err
+}
+
+// ListOpenPurchaseOrders returns purchase orders with goods still to come
+func (r *cashForecastRepository) ListOpenPurchaseOrders(ctx context.Context, companyID uuid.UUID) ([]*models.PurchaseOrder, error) {
+	var orders []*models.PurchaseOrder
+	err := r.db.WithContext(ctx).
+		Preload("Items").
+		Where("company_id = ? AND status IN ?", companyID, forecastOpenPurchaseOrderStatuses).
+		Order("required_date").
+		Find(&orders).Error
+	return orders, err
+}
+
+// ListOpenLCUtilizations returns drawings under letters of credit that were
+// presented or accepted but not rejected. Drawings for shipments whose order
+// is invoiced are left out, as the invoice is already a receivable.
+func (r *cashForecastRepository) ListOpenLCUtilizations(ctx context.Context, companyID uuid.UUID) ([]*models.LCUtilization, error) {
+	var utilizations []*models.LCUtilization
+	err := r.db.WithContext(ctx).
+		Preload("LC").
+		Where("company_id = ? AND status IN ?", companyID, []string{"pending", "accepted"}).
+		Where("NOT EXISTS (SELECT 1 FROM shipments JOIN orders ON orders.id = shipments.order_id " +
+			"WHERE shipments.id = lc_utilizations.shipment_id AND orders.invoice_id IS NOT NULL)").
+		Order("utilized_at").
+		Find(&utilizations).Error
+	return utilizations, err
+}
+
+// ListPayments returns completed payments made in [from, to)
+func (r *cashForecastRepository) ListPayments(ctx context.Context, companyID uuid.UUID, from, to time.Time) ([]*models.Payment, error) {
+	var payments []*models.Payment
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND status = ?", companyID, "completed").
+		Where("payment_date >= ? AND payment_date < ?", from, to).
+		Find(&payments).Error
+	return payments, err
+}
+
+// ListCompanyIDs returns the companies with an active bank account
+func (r *cashForecastRepository) ListCompanyIDs(ctx context.Context) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).Model(&models.BankAccount{}).
+		Where("status = ?", "active").
+		Distinct().
+		Pluck("company_id", &ids).Error
+	return ids, err
+}
+
+// Recurring expenses
+
+func (r *cashForecastRepository) CreateRecurringExpense(ctx context.Context, expense *models.RecurringExpense) error {
+	return r.db.WithContext(ctx).Create(expense).Error
+}
+
+func (r *cashForecastRepository) UpdateRecurringExpense(ctx context.Context, expense *models.RecurringExpense) error {
+	return r.db.WithContext(ctx).Save(expense).Error
+}
+
+func (r *cashForecastRepository) GetRecurringExpense(ctx context.Context, id uuid.UUID) (*models.RecurringExpense, error) {
+	var expense models.RecurringExpense
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&expense).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &expense, nil
+}
+
+func (r *cashForecastRepository) ListRecurringExpenses(ctx context.Context, companyID uuid.UUID, activeOnly bool) ([]*models.RecurringExpense, error) {
+	var expenses []*models.RecurringExpense
+	query := r.db.WithContext(ctx).Where("company_id = ?", companyID)
+	if activeOnly {
+		query = query.Where("is_active = ?", true)
+	}
+	err := query.Order("name").Find(&expenses).Error
+	return expenses, err
+}
+
+// Scenarios
+
+func (r *cashForecastRepository) CreateScenario(ctx context.Context, scenario *models.CashForecastScenario) error {
+	return r.db.WithContext(ctx).Create(scenario).Error
+}
+
+func (r *cashForecastRepository) UpdateScenario(ctx context.Context, scenario *models.CashForecastScenario) error {
+	return r.db.WithContext(ctx).Save(scenario).Error
+}
+
+func (r *cashForecastRepository) GetScenario(ctx context.Context, id uuid.UUID) (*models.CashForecastScenario, error) {
+	var scenario models.CashForecastScenario
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&scenario).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &scenario, nil
+}
+
+func (r *cashForecastRepository) ListScenarios(ctx context.Context, companyID uuid.UUID) ([]*models.CashForecastScenario, error) {
+	var scenarios []*models.CashForecastScenario
+	err := r.db.WithContext(ctx).Where("company_id = ?", companyID).Order("name").Find(&scenarios).Error
+	return scenarios, err
+}
+
+// Snapshots
+
+func (r *cashForecastRepository) CreateSnapshot(ctx context.Context, snapshot *models.CashForecastSnapshot) error {
+	return r.db.WithContext(ctx).Create(snapshot).Error
+}
+
+func (r *cashForecastRepository) GetSnapshot(ctx context.Context, id uuid.UUID) (*models.CashForecastSnapshot, error) {
+	var snapshot models.CashForecastSnapshot
+	err := r.db.WithContext(ctx).
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("currency, week_start") }).
+		Where("id = ?", id).
+		First(&snapshot).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// FindSnapshot returns the latest snapshot of a scenario taken for a week,
+// the base forecast when scenarioID is nil
+func (r *cashForecastRepository) FindSnapshot(ctx context.Context, companyID uuid.UUID, scenarioID *uuid.UUID, weekStart time.Time) (*models.CashForecastSnapshot, error) {
+	var snapshot models.CashForecastSnapshot
+	query := r.db.WithContext(ctx).Where("company_id = ? AND week_start = ?", companyID, weekStart)
+	if scenarioID != nil {
+		query = query.Where("scenario_id = ?", *scenarioID)
+	} else {
+		query = query.Where("scenario_id IS NULL")
+	}
+	err := query.Order("created_at DESC").First(&snapshot).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (r *cashForecastRepository) ListSnapshots(ctx context.Context, params map[string]interface{}) ([]*models.CashForecastSnapshot, int64, error) {
+	var snapshots []*models.CashForecastSnapshot
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.CashForecastSnapshot{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if scenarioID, ok := params["scenario_id"].(uuid.UUID); ok {
+		query = query.Where("scenario_id = ?", scenarioID)
+	}
+	if from, ok := params["from"].(time.Time); ok {
+		query = query.Where("week_start >= ?", from)
+	}
+	if to, ok := params["to"].(time.Time); ok {
+		query = query.Where("week_start < ?", to)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+
+	err := query.Order("week_start DESC, created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&snapshots).Error
+	return snapshots, total, err
+}
@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CertificateRepository persists mill certificates of material heats and
+// the inspection certificates issued with shipments, and reads the
+// inspection data the certificates are made from
+type CertificateRepository interface {
+	// Mill certificates
+	CreateMillCertificate(ctx context.Context, cert *models.MillCertificate) error
+	UpdateMillCertificate(ctx context.Context, cert *models.MillCertificate) error
+	GetMillCertificate(ctx context.Context, id uuid.UUID) (*models.MillCertificate, error)
+	ListMillCertificates(ctx context.Context, params map[string]interface{}) ([]*models.MillCertificate, int64, error)
+	FindMillCertificatesByHeat(ctx context.Context, companyID uuid.UUID, heatNos []string) ([]*models.MillCertificate, error)
+
+	// Inspection data
+
+	GetInspection(ctx context.Context, id uuid.UUID) (*models.QualityInspection, error)
+	// ListFinalInspections returns the passed final inspections of the
+	// production orders of a sales order, latest first
+	ListFinalInspections(ctx context.Context, companyID, salesOrderID uuid.UUID) ([]*models.QualityInspection, error)
+	// ListHeatNos returns the heats of the materials issued to a production
+	// order
+	ListHeatNos(ctx context.Context, productionOrderID uuid.UUID) ([]string, error)
+	ListInspectionMeasurements(ctx context.Context, inspectionID uuid.UUID) ([]*models.CharacteristicMeasurement, error)
+	GetCharacteristics(ctx context.Context, ids []uuid.UUID) ([]*models.QualityCharacteristic, error)
+
+	// Inspection certificates
+
+	// IssueCertificate supersedes the certificates issued before for the
+	// shipment and stores the new one with its trade document linked to
+	// the shipment
+	IssueCertificate(ctx context.Context, cert *models.InspectionCertificate, doc *models.TradeDocument) error
+	UpdateCertificate(ctx context.Context, cert *models.InspectionCertificate) error
+	GetCertificate(ctx context.Context, id uuid.UUID) (*models.InspectionCertificate, error)
+	ListCertificates(ctx context.Context, params map[string]interface{}) ([]*models.InspectionCertificate, int64, error)
+	FindCertificateByHash(ctx context.Context, hash string) (*models.InspectionCertificate, error)
+	// LatestCertificateVersion returns the highest version issued for a
+	// shipment, 0 if none
+	LatestCertificateVersion(ctx context.Context, shipmentID uuid.UUID) (int, error)
+}
+
+type certificateRepository struct {
+	db *gorm.DB
+}
+
+// NewCertificateRepository creates a new certificate repository
+func NewCertificateRepository(db *gorm.DB) CertificateRepository {
+	return &certificateRepository{db: db}
+}
+
+// Mill certificates
+
+func (r *certificateRepository) CreateMillCertificate(ctx context.Context, cert *models.MillCertificate) error {
+	return r.db.WithContext(ctx).Create(cert).Error
+}
+
+func (r *certificateRepository) UpdateMillCertificate(ctx context.Context, cert *models.MillCertificate) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(cert).Error
+}
+
+func (r *certificateRepository) GetMillCertificate(ctx context.Context, id uuid.UUID) (*models.MillCertificate, error) {
+	var cert models.MillCertificate
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&cert).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// ListMillCertificates lists mill certificates, latest first, filtered on
+// company_id, supplier_id, inventory_id and a search on heat, certificate
+// number and grade
+func (r *certificateRepository) ListMillCertificates(ctx context.Context, params map[string]interface{}) ([]*models.MillCertificate, int64, error) {
+	var certs []*models.MillCertificate
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.MillCertificate{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	for _, field := range []string{"supplier_id", "inventory_id"} {
+		if id, ok := params[field].(uuid.UUID); ok {
+			query = query.Where(field+" = ?", id)
+		}
+	}
+	if search, ok := params["search"].(string); ok && search != "" {
+		query = query.Where("heat_no ILIKE ? OR certificate_no ILIKE ? OR material_grade ILIKE ?",
+			"%"+search+"%", "%"+search+"%", "%"+search+"%")
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := certificatePage(params)
+	err := query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&certs).Error
+	return certs, total, err
+}
+
+func (r *certificateRepository) FindMillCertificatesByHeat(ctx context.Context, companyID uuid.UUID, heatNos []string) ([]*models.MillCertificate, error) {
+	var certs []*models.MillCertificate
+	if len(heatNos) == 0 {
+		return certs, nil
+	}
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND heat_no IN ?", companyID, heatNos).
+		Find(&certs).Error
+	return certs, err
+}
+
+// Inspection data
+
+func (r *certificateRepository) GetInspection(ctx context.Context, id uuid.UUID) (*models.QualityInspection, error) {
+	var inspection models.QualityInspection
+	err := r.db.WithContext(ctx).
+		Preload("ProductionOrder").
+		Preload("Inspector").
+		Where("id = ?", id).
+		First(&inspection).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &inspection, nil
+}
+
+func (r *certificateRepository) ListFinalInspections(ctx context.Context, companyID, salesOrderID uuid.UUID) ([]*models.QualityInspection, error) {
+	var inspections []*models.QualityInspection
+	err := r.db.WithContext(ctx).
+		Preload("ProductionOrder").
+		Preload("Inspector").
+		Joins("JOIN production_orders ON production_orders.id = quality_inspections.production_order_id").
+		Where("quality_inspections.company_id = ? AND production_orders.sales_order_id = ?", companyID, salesOrderID).
+		Where("quality_inspections.type = ? AND quality_inspections.status = ?", "final", "passed").
+		Order("quality_inspections.inspected_at DESC").
+		Find(&inspections).Error
+	return inspections, err
+}
+
+func (r *certificateRepository) ListHeatNos(ctx context.Context, productionOrderID uuid.UUID) ([]string, error) {
+	var heatNos []string
+	err := r.db.WithContext(ctx).Model(&models.ProductionMaterial{}).
+		Distinct("heat_no").
+		Where("production_order_id = ? AND heat_no <> ''", productionOrderID).
+		Order("heat_no").
+		Pluck("heat_no", &heatNos).Error
+	return heatNos, err
+}
+
+// ListInspectionMeasurements returns the measurements taken in an
+// inspection by characteristic, subgroup and sequence
+func (r *certificateRepository) ListInspectionMeasurements(ctx context.Context, inspectionID uuid.UUID) ([]*models.CharacteristicMeasurement, error) {
+	var measurements []*models.CharacteristicMeasurement
+	err := r.db.WithContext(ctx).
+		Where("inspection_id = ?", inspectionID).
+		Order("characteristic_id, subgroup, sequence").
+		Find(&measurements).Error
+	return measurements, err
+}
+
+func (r *certificateRepository) GetCharacteristics(ctx context.Context, ids []uuid.UUID) ([]*models.QualityCharacteristic, error) {
+	var characteristics []*models.QualityCharacteristic
+	if len(ids) == 0 {
+		return characteristics, nil
+	}
+	err := r.db.WithContext(ctx).Where("id IN ?", ids).Order("code, name").Find(&characteristics).Error
+	return characteristics, err
+}
+
+// Inspection certificates
+
+func (r *certificateRepository) IssueCertificate(ctx context.Context, cert *models.InspectionCertificate, doc *models.TradeDocument) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.InspectionCertificate{}).
+			Where("shipment_id = ? AND status = ?", cert.ShipmentID, models.CertificateStatusIssued).
+			Update("status", models.CertificateStatusSuperseded).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&models.TradeDocument{}).
+			Where("document_type = ? AND status <> ?", doc.DocumentType, "superseded").
+			Where("id IN (?)", tx.Table("shipment_documents").Select("trade_document_id").Where("shipment_id = ?", cert.ShipmentID)).
+			Update("status", "superseded").Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Create(doc).Error; err != nil {
+			return err
+		}
+		shipment := models.Shipment{ID: cert.ShipmentID}
+		if err := tx.Model(&shipment).Association("Documents").Append(doc); err != nil {
+			return err
+		}
+		cert.TradeDocumentID = doc.ID
+		return tx.Omit("TradeDocument").Create(cert).Error
+	})
+}
+
+func (r *certificateRepository) UpdateCertificate(ctx context.Context, cert *models.InspectionCertificate) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(cert).Error
+}
+
+// GetCertificate returns a certificate with its lines in order
+func (r *certificateRepository) GetCertificate(ctx context.Context, id uuid.UUID) (*models.InspectionCertificate, error) {
+	return r.findCertificate(ctx, "id = ?", id)
+}
+
+func (r *certificateRepository) FindCertificateByHash(ctx context.Context, hash string) (*models.InspectionCertificate, error) {
+	return r.findCertificate(ctx, "hash = ?", hash)
+}
+
+func (r *certificateRepository) findCertificate(ctx context.Context, query string, args ...interface{}) (*models.InspectionCertificate, error) {
+	var cert models.InspectionCertificate
+	err := r.db.WithContext(ctx).
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("item") }).
+		Where(query, args...).
+		First(&cert).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// ListCertificates lists certificates, latest first, filtered on
+// company_id, shipment_id, customer_id, status and a search on the
+// certificate and shipment numbers
+func (r *certificateRepository) ListCertificates(ctx context.Context, params map[string]interface{}) ([]*models.InspectionCertificate, int64, error) {
+	var certs []*models.InspectionCertificate
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.InspectionCertificate{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	for _, field := range []string{"shipment_id", "customer_id"} {
+		if id, ok := params[field].(uuid.UUID); ok {
+			query = query.Where(field+" = ?", id)
+		}
+	}
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if search, ok := params["search"].(string); ok && search != "" {
+		query = query.Where("certificate_no ILIKE ? OR shipment_no ILIKE ?", "%"+search+"%", "%"+search+"%")
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := certificatePage(params)
+	err := query.Order("issued_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&certs).Error
+	return certs, total, err
+}
+
+func (r *certificateRepository) LatestCertificateVersion(ctx context.Context, shipmentID uuid.UUID) (int, error) {
+	var version int
+	err := r.db.WithContext(ctx).Model(&models.InspectionCertificate{}).
+		Select("COALESCE(MAX(version), 0)").
+		Where("shipment_id = ?", shipmentID).
+		Scan(&version).Error
+	return version, err
+}
+
+func certificatePage(params map[string]interface{}) (int, int) {
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+	return page, pageSize
+}
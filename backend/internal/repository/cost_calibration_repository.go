@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CostCalibrationRepository reads the completed jobs the cost model is
+// calibrated against and the templates and rates in force, and persists
+// calibrations and their rate suggestions
+type CostCalibrationRepository interface {
+	// Sources
+	ListCompanyIDs(ctx context.Context) ([]uuid.UUID, error)
+	ListCalibrationJobs(ctx context.Context, companyID uuid.UUID, from, to *time.Time) ([]*models.ProductionJobCost, error)
+	GetCostCalculation(ctx context.Context, id uuid.UUID) (*models.CostCalculation, error)
+	ListProductionTasks(ctx context.Context, productionOrderID uuid.UUID) ([]*models.ProductionTask, error)
+	FindActiveTemplate(ctx context.Context, companyID uuid.UUID, processType string) (*models.ProcessCostTemplate, error)
+	FindProcessingRate(ctx context.Context, companyID uuid.UUID, processType string) (*models.ProcessingRate, error)
+
+	// Calibrations
+	CreateCalibration(ctx context.Context, calibration *models.CostCalibration) error
+	GetCalibration(ctx context.Context, id uuid.UUID) (*models.CostCalibration, error)
+	FindLatestCalibration(ctx context.Context, companyID uuid.UUID) (*models.CostCalibration, error)
+	ListCalibrations(ctx context.Context, params map[string]interface{}) ([]*models.CostCalibration, int64, error)
+
+	// Suggestions
+	GetSuggestion(ctx context.Context, id uuid.UUID) (*models.CostRateSuggestion, error)
+	ListSuggestions(ctx context.Context, params map[string]interface{}) ([]*models.CostRateSuggestion, int64, error)
+	UpdateSuggestion(ctx context.Context, suggestion *models.CostRateSuggestion) error
+	AcceptSuggestion(ctx context.Context, suggestion *models.CostRateSuggestion, template, previous *models.ProcessCostTemplate) error
+}
+
+type costCalibrationRepository struct {
+	db *gorm.DB
+}
+
+// NewCostCalibrationRepository creates a new cost calibration repository
+func NewCostCalibrationRepository(db *gorm.DB) CostCalibrationRepository {
+	return &costCalibrationRepository{db: db}
+}
+
+// Sources
+
+// ListCompanyIDs returns the companies with completed jobs to calibrate on
+func (r *costCalibrationRepository) ListCompanyIDs(ctx context.Context) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).
+		Model(&models.ProductionJobCost{}).
+		Where("final = ? AND cost_calculation_id IS NOT NULL", true).
+		Distinct().
+		Pluck("company_id", &ids).Error
+	return ids, err
+}
+
+// ListCalibrationJobs returns the final job costs completed between from
+// and to that were estimated with a cost calculation
+func (r *costCalibrationRepository) ListCalibrationJobs(ctx context.Context, companyID uuid.UUID, from, to *time.Time) ([]*models.ProductionJobCost, error) {
+	var jobs []*models.ProductionJobCost
+	query := r.db.WithContext(ctx).
+		Where("company_id = ? AND final = ? AND cost_calculation_id IS NOT NULL", companyID, true)
+	if from != nil {
+		query = query.Where("completed_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("completed_at < ?", *to)
+	}
+	err := query.Order("completed_at").Find(&jobs).Error
+	return jobs, err
+}
+
+func (r *costCalibrationRepository) GetCostCalculation(ctx context.Context, id uuid.UUID) (*models.CostCalculation, error) {
+	var calculation models.CostCalculation
+	err := r.db.WithContext(ctx).
+		Preload("Details", func(db *gorm.DB) *gorm.DB { return db.Order("sequence") }).
+		Preload("Details.ProcessStep").
+		Preload("Inquiry").
+		Where("id = ?", id).
+		First(&calculation).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &calculation, nil
+}
+
+func (r *costCalibrationRepository) ListProductionTasks(ctx context.Context, productionOrderID uuid.UUID) ([]*models.ProductionTask, error) {
+	var tasks []*models.ProductionTask
+	err := r.db.WithContext(ctx).
+		Preload("WorkStation").
+		Where("production_order_id = ?", productionOrderID).
+		Order("task_no").
+		Find(&tasks).Error
+	return tasks, err
+}
+
+// FindActiveTemplate returns the template version of a process in force now
+func (r *costCalibrationRepository) FindActiveTemplate(ctx context.Context, companyID uuid.UUID, processType string) (*models.ProcessCostTemplate, error) {
+	var template models.ProcessCostTemplate
+	now := time.Now()
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND process_type = ? AND is_active = ? AND deleted_at IS NULL", companyID.String(), processType, true).
+		Where("valid_from <= ? AND (valid_to IS NULL OR valid_to > ?)", now, now).
+		Order("version DESC, updated_at DESC").
+		First(&template).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &template, nil
+}
+
+// FindProcessingRate returns the current general processing rate of a
+// process, preferring one not tied to a machine
+func (r *costCalibrationRepository) FindProcessingRate(ctx context.Context, companyID uuid.UUID, processType string) (*models.ProcessingRate, error) {
+	var rate models.ProcessingRate
+	now := time.Now()
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND process_type = ? AND is_active = ?", companyID.String(), processType, true).
+		Where("valid_from <= ? AND (valid_to IS NULL OR valid_to > ?)", now, now).
+		Order("CASE WHEN equipment_id = '' OR equipment_id IS NULL THEN 0 ELSE 1 END, valid_from DESC").
+		First(&rate).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// Calibrations
+
+// CreateCalibration stores a calibration with its suggestions
+func (r *costCalibrationRepository) CreateCalibration(ctx context.Context, calibration *models.CostCalibration) error {
+	return r.db.WithContext(ctx).Create(calibration).Error
+}
+
+func (r *costCalibrationRepository) GetCalibration(ctx context.Context, id uuid.UUID) (*models.CostCalibration, error) {
+	var calibration models.CostCalibration
+	err := r.db.WithContext(ctx).
+		Preload("Suggestions", func(db *gorm.DB) *gorm.DB { return db.Order("process_type") }).
+		Where("id = ?", id).
+		First(&calibration).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &calibration, nil
+}
+
+func (r *costCalibrationRepository) FindLatestCalibration(ctx context.Context, companyID uuid.UUID) (*models.CostCalibration, error) {
+	var calibration models.CostCalibration
+	err := r.db.WithContext(ctx).
+		Where("company_id = ?", companyID).
+		Order("created_at DESC").
+		First(&calibration).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &calibration, nil
+}
+
+// ListCalibrations lists calibrations, latest first, filtered on company_id
+func (r *costCalibrationRepository) ListCalibrations(ctx context.Context, params map[string]interface{}) ([]*models.CostCalibration, int64, error) {
+	var calibrations []*models.CostCalibration
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.CostCalibration{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := calibrationPage(params)
+	err := query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&calibrations).Error
+	return calibrations, total, err
+}
+
+// Suggestions
+
+func (r *costCalibrationRepository) GetSuggestion(ctx context.Context, id uuid.UUID) (*models.CostRateSuggestion, error) {
+	var suggestion models.CostRateSuggestion
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&suggestion).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &suggestion, nil
+}
+
+// ListSuggestions lists rate suggestions, latest first, filtered on
+// company_id, calibration_id, process_type and status
+func (r *costCalibrationRepository) ListSuggestions(ctx context.Context, params map[string]interface{}) ([]*models.CostRateSuggestion, int64, error) {
+	var suggestions []*models.CostRateSuggestion
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.CostRateSuggestion{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if calibrationID, ok := params["calibration_id"].(uuid.UUID); ok {
+		query = query.Where("calibration_id = ?", calibrationID)
+	}
+	if processType, ok := params["process_type"].(string); ok && processType != "" {
+		query = query.Where("process_type = ?", processType)
+	}
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := calibrationPage(params)
+	err := query.Order("created_at DESC, process_type").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&suggestions).Error
+	return suggestions, total, err
+}
+
+func (r *costCalibrationRepository) UpdateSuggestion(ctx context.Context, suggestion *models.CostRateSuggestion) error {
+	return r.db.WithContext(ctx).Save(suggestion).Error
+}
+
+// AcceptSuggestion stores the new template version, ends the version it
+// supersedes where the new one takes effect and marks the suggestion
+// accepted, all or nothing. ErrVersionSuperseded is returned when the
+// previous version has already been revised.
+func (r *costCalibrationRepository) AcceptSuggestion(ctx context.Context, suggestion *models.CostRateSuggestion, template, previous *models.ProcessCostTemplate) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if previous != nil {
+			result := tx.Model(&models.ProcessCostTemplate{}).
+				Where("id = ? AND valid_to IS NULL", previous.ID).
+				Updates(map[string]interface{}{"valid_to": template.ValidFrom, "updated_by": template.CreatedBy, "updated_at": template.CreatedAt})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrVersionSuperseded
+			}
+		}
+		if err := tx.Create(template).Error; err != nil {
+			return err
+		}
+		return tx.Save(suggestion).Error
+	})
+}
+
+func calibrationPage(params map[string]interface{}) (int, int) {
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+	return page, pageSize
+}
@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CurrencyAmount is an amount summed per currency
+type CurrencyAmount struct {
+	Currency string
+	Amount   float64
+}
+
+// CreditSettlement is an invoice amount with its due date and, once paid,
+// the payment date
+type CreditSettlement struct {
+	Amount       float64
+	ExchangeRate float64
+	DueDate      time.Time
+	SettledAt    *time.Time
+}
+
+// Order statuses counted as confirmed but not yet shipped
+var creditOpenOrderStatuses = []string{"confirmed", "in_production", "quality_check", "ready_to_ship"}
+
+// Quote statuses counted as approved but not yet converted
+var creditOpenQuoteStatuses = []string{"approved", "sent", "accepted"}
+
+// CreditRepository persists credit profiles and holds and sums the
+// documents that make up a customer's exposure
+type CreditRepository interface {
+	// Customers
+	GetCustomer(ctx context.Context, id uuid.UUID) (*models.Customer, error)
+	ListCustomerIDs(ctx context.Context, companyID uuid.UUID) ([]uuid.UUID, error)
+
+	// Profiles
+	GetProfile(ctx context.Context, customerID uuid.UUID) (*models.CustomerCreditProfile, error)
+	SaveProfile(ctx context.Context, profile *models.CustomerCreditProfile) error
+	ListDunningHoldCustomerIDs(ctx context.Context, companyID uuid.UUID) ([]uuid.UUID, error)
+
+	// Exposure
+	SumOpenReceivables(ctx context.Context, customerID uuid.UUID) ([]CurrencyAmount, error)
+	SumOpenOrders(ctx context.Context, customerID uuid.UUID) ([]CurrencyAmount, error)
+	SumOpenQuotes(ctx context.Context, customerID uuid.UUID) ([]CurrencyAmount, error)
+	ListSettlements(ctx context.Context, customerID uuid.UUID, since time.Time) ([]CreditSettlement, error)
+
+	// Holds
+	CreateHold(ctx context.Context, hold *models.CreditHold) error
+	GetHold(ctx context.Context, id uuid.UUID) (*models.CreditHold, error)
+	UpdateHold(ctx context.Context, hold *models.CreditHold) error
+	FindHold(ctx context.Context, sourceType string, sourceID uuid.UUID) (*models.CreditHold, error)
+	ListHolds(ctx context.Context, params map[string]interface{}) ([]*models.CreditHold, int64, error)
+}
+
+type creditRepository struct {
+	db *gorm.DB
+}
+
+// NewCreditRepository creates a new credit repository
+func NewCreditRepository(db *gorm.DB) CreditRepository {
+	return &creditRepository{db: db}
+}
+
+// Customers
+
+func (r *creditRepository) GetCustomer(ctx context.Context, id uuid.UUID) (*models.Customer, error) {
+	var customer models.Customer
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&customer).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &customer, nil
+}
+
+func (r *creditRepository) ListCustomerIDs(ctx context.Context, companyID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).Model(&models.Customer{}).
+		Where("company_id = ? AND is_active = ?", companyID, true).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// Profiles
+
+func (r *creditRepository) GetProfile(ctx context.Context, customerID uuid.UUID) (*models.CustomerCreditProfile, error) {
+	var profile models.CustomerCreditProfile
+	err := r.db.WithContext(ctx).Where("customer_id = ?", customerID).First(&profile).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (r *creditRepository) SaveProfile(ctx context.Context, profile *models.CustomerCreditProfile) error {
+	return r.db.WithContext(ctx).Save(profile).Error
+}
+
+// ListDunningHoldCustomerIDs lists the customers of a company whose credit
+// dunning has put on hold
+func (r *creditRepository) ListDunningHoldCustomerIDs(ctx context.Context, companyID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).Model(&models.CustomerCreditProfile{}).
+		Where("company_id = ? AND dunning_hold = ?", companyID, true).
+		Pluck("customer_id", &ids).Error
+	return ids, err
+}
+
+// Exposure
+
+// SumOpenReceivables sums the balance of issued sales invoices
+func (r *creditRepository) SumOpenReceivables(ctx context.Context, customerID uuid.UUID) ([]CurrencyAmount, error) {
+	var amounts []CurrencyAmount
+	err := r.db.WithContext(ctx).Model(&models.Invoice{}).
+		Select("currency, SUM(balance_amount) AS amount").
+		Where("customer_id = ? AND type = ? AND balance_amount > 0", customerID, "sales").
+		Where("status IN ?", []string{"issued", "sent", "partial_paid", "overdue"}).
+		Group("currency").
+		Scan(&amounts).Error
+	return amounts, err
+}
+
+// SumOpenOrders sums confirmed orders that are neither shipped nor invoiced,
+// less what was paid on them up front
+func (r *creditRepository) SumOpenOrders(ctx context.Context, customerID uuid.UUID) ([]CurrencyAmount, error) {
+	var amounts []CurrencyAmount
+	err := r.db.WithContext(ctx).Model(&models.Order{}).
+		Select("currency, SUM(total_amount - paid_amount) AS amount").
+		Where("customer_id = ? AND invoice_id IS NULL AND status IN ?", customerID, creditOpenOrderStatuses).
+		Group("currency").
+		Scan(&amounts).Error
+	return amounts, err
+}
+
+// SumOpenQuotes sums approved quotes no live order was created from
+func (r *creditRepository) SumOpenQuotes(ctx context.Context, customerID uuid.UUID) ([]CurrencyAmount, error) {
+	var amounts []CurrencyAmount
+	err := r.db.WithContext(ctx).Model(&models.Quote{}).
+		Select("currency, SUM(total_amount) AS amount").
+		Where("customer_id = ? AND status IN ?", customerID, creditOpenQuoteStatuses).
+		Where("(valid_until IS NULL OR valid_until >= ?)", time.Now()).
+		Where("NOT EXISTS (SELECT 1 FROM orders WHERE orders.quote_id = quotes.id AND orders.status <> ?)", "cancelled").
+		Group("currency").
+		Scan(&amounts).Error
+	return amounts, err
+}
+
+// ListSettlements returns the payments on sales invoices made since a date
+// together with the open balances of the customer's invoices
+func (r *creditRepository) ListSettlements(ctx context.Context, customerID uuid.UUID, since time.Time) ([]CreditSettlement, error) {
+	var settlements []CreditSettlement
+	err := r.db.WithContext(ctx).Model(&models.Payment{}).
+		Select("payments.amount, invoices.exchange_rate, invoices.due_date, payments.payment_date AS settled_at").
+		Joins("JOIN invoices ON invoices.id = payments.invoice_id").
+		Where("invoices.customer_id = ? AND invoices.type = ?", customerID, "sales").
+		Where("payments.status = ? AND payments.payment_date >= ?", "completed", since).
+		Scan(&settlements).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var open []CreditSettlement
+	err = r.db.WithContext(ctx).Model(&models.Invoice{}).
+		Select("balance_amount AS amount, exchange_rate, due_date").
+		Where("customer_id = ? AND type = ? AND balance_amount > 0", customerID, "sales").
+		Where("status IN ?", []string{"issued", "sent", "partial_paid", "overdue"}).
+		Scan(&open).Error
+	if err != nil {
+		return nil, err
+	}
+	return append(settlements, open...), nil
+}
+
+// Holds
+
+func (r *creditRepository) CreateHold(ctx context.Context, hold *models.CreditHold) error {
+	return r.db.WithContext(ctx).Create(hold).Error
+}
+
+func (r *creditRepository) GetHold(ctx context.Context, id uuid.UUID) (*models.CreditHold, error) {
+	var hold models.CreditHold
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&hold).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &hold, nil
+}
+
+func (r *creditRepository) UpdateHold(ctx context.Context, hold *models.CreditHold) error {
+	return r.db.WithContext(ctx).Save(hold).Error
+}
+
+// FindHold returns the latest hold placed on a document
+func (r *creditRepository) FindHold(ctx context.Context, sourceType string, sourceID uuid.UUID) (*models.CreditHold, error) {
+	var hold models.CreditHold
+	err := r.db.WithContext(ctx).
+		Where("source_type = ? AND source_id = ?", sourceType, sourceID).
+		Order("created_at DESC").
+		First(&hold).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &hold, nil
+}
+
+func (r *creditRepository) ListHolds(ctx context.Context, params map[string]interface{}) ([]*models.CreditHold, int64, error) {
+	var holds []*models.CreditHold
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.CreditHold{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if customerID, ok := params["customer_id"].(uuid.UUID); ok {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if sourceType, ok := params["source_type"].(string); ok && sourceType != "" {
+		query = query.Where("source_type = ?", sourceType)
+	}
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+
+	err := query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&holds).Error
+	return holds, total, err
+}
@@ -0,0 +1,388 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Invoice statuses that are due for payment
+var dunningOpenInvoiceStatuses = []string{"issued", "sent", "partial_paid", "overdue"}
+
+// DunningRepository persists dunning policies, templates, notices, promises
+// to pay and collector notes and finds the invoices to chase
+type DunningRepository interface {
+	// Policies
+	CreatePolicy(ctx context.Context, policy *models.DunningPolicy) error
+	UpdatePolicy(ctx context.Context, policy *models.DunningPolicy) error
+	GetPolicy(ctx context.Context, id uuid.UUID) (*models.DunningPolicy, error)
+	FindPolicy(ctx context.Context, companyID uuid.UUID, customerGroup string) (*models.DunningPolicy, error)
+	ListPolicies(ctx context.Context, companyID uuid.UUID) ([]*models.DunningPolicy, error)
+	ListPolicyCompanies(ctx context.Context) ([]uuid.UUID, error)
+
+	// Templates
+	CreateTemplate(ctx context.Context, template *models.DunningTemplate) error
+	UpdateTemplate(ctx context.Context, template *models.DunningTemplate) error
+	GetTemplate(ctx context.Context, id uuid.UUID) (*models.DunningTemplate, error)
+	ListTemplates(ctx context.Context, companyID uuid.UUID) ([]*models.DunningTemplate, error)
+
+	// Invoices
+	MarkOverdue(ctx context.Context, companyID uuid.UUID, date time.Time) (int64, error)
+	ListOverdueInvoices(ctx context.Context, companyID uuid.UUID, date time.Time) ([]*models.Invoice, error)
+	SumPayments(ctx context.Context, customerID uuid.UUID, invoiceID *uuid.UUID, since time.Time) (float64, error)
+
+	// Notices
+	CreateNotice(ctx context.Context, notice *models.DunningNotice) error
+	UpdateNotice(ctx context.Context, notice *models.DunningNotice) error
+	GetNotice(ctx context.Context, id uuid.UUID) (*models.DunningNotice, error)
+	ListNotices(ctx context.Context, params map[string]interface{}) ([]*models.DunningNotice, int64, error)
+
+	// Promises to pay
+	CreatePromise(ctx context.Context, promise *models.PromiseToPay) error
+	UpdatePromise(ctx context.Context, promise *models.PromiseToPay) error
+	GetPromise(ctx context.Context, id uuid.UUID) (*models.PromiseToPay, error)
+	ListPromises(ctx context.Context, params map[string]interface{}) ([]*models.PromiseToPay, int64, error)
+
+	// Collector notes
+	CreateNote(ctx context.Context, note *models.CollectorNote) error
+	ListNotes(ctx context.Context, params map[string]interface{}) ([]*models.CollectorNote, int64, error)
+}
+
+type dunningRepository struct {
+	db *gorm.DB
+}
+
+// NewDunningRepository creates a new dunning repository
+func NewDunningRepository(db *gorm.DB) DunningRepository {
+	return &dunningRepository{db: db}
+}
+
+// Policies
+
+func (r *dunningRepository) CreatePolicy(ctx context.Context, policy *models.DunningPolicy) error {
+	return r.db.WithContext(ctx).Create(policy).Error
+}
+
+// UpdatePolicy saves a policy and replaces its stages
+func (r *dunningRepository) UpdatePolicy(ctx context.Context, policy *models.DunningPolicy) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Stages").Save(policy).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("policy_id = ?", policy.ID).Delete(&models.DunningStage{}).Error; err != nil {
+			return err
+		}
+		for i := range policy.Stages {
+			policy.Stages[i].ID = uuid.Nil
+			policy.Stages[i].PolicyID = policy.ID
+		}
+		if len(policy.Stages) == 0 {
+			return nil
+		}
+		return tx.Create(&policy.Stages).Error
+	})
+}
+
+func (r *dunningRepository) GetPolicy(ctx context.Context, id uuid.UUID) (*models.DunningPolicy, error) {
+	var policy models.DunningPolicy
+	err := r.db.WithContext(ctx).
+		Preload("Stages", func(db *gorm.DB) *gorm.DB { return db.Order("sequence") }).
+		Where("id = ?", id).
+		First(&policy).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// FindPolicy returns the active policy of a customer group
+func (r *dunningRepository) FindPolicy(ctx context.Context, companyID uuid.UUID, customerGroup string) (*models.DunningPolicy, error) {
+	var policy models.DunningPolicy
+	err := r.db.WithContext(ctx).
+		Preload("Stages", func(db *gorm.DB) *gorm.DB { return db.Order("sequence") }).
+		Where("company_id = ? AND customer_group = ? AND is_active = ?", companyID, customerGroup, true).
+		First(&policy).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *dunningRepository) ListPolicies(ctx context.Context, companyID uuid.UUID) ([]*models.DunningPolicy, error) {
+	var policies []*models.DunningPolicy
+	err := r.db.WithContext(ctx).
+		Preload("Stages", func(db *gorm.DB) *gorm.DB { return db.Order("sequence") }).
+		Where("company_id = ?", companyID).
+		Order("customer_group").
+		Find(&policies).Error
+	return policies, err
+}
+
+// ListPolicyCompanies returns the companies with an active policy
+func (r *dunningRepository) ListPolicyCompanies(ctx context.Context) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).Model(&models.DunningPolicy{}).
+		Where("is_active = ?", true).
+		Distinct().
+		Pluck("company_id", &ids).Error
+	return ids, err
+}
+
+// Templates
+
+func (r *dunningRepository) CreateTemplate(ctx context.Context, template *models.DunningTemplate) error {
+	return r.db.WithContext(ctx).Create(template).Error
+}
+
+func (r *dunningRepository) UpdateTemplate(ctx context.Context, template *models.DunningTemplate) error {
+	return r.db.WithContext(ctx).Save(template).Error
+}
+
+func (r *dunningRepository) GetTemplate(ctx context.Context, id uuid.UUID) (*models.DunningTemplate, error) {
+	var template models.DunningTemplate
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&template).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (r *dunningRepository) ListTemplates(ctx context.Context, companyID uuid.UUID) ([]*models.DunningTemplate, error) {
+	var templates []*models.DunningTemplate
+	err := r.db.WithContext(ctx).Where("company_id = ?", companyID).Order("level, name").Find(&templates).Error
+	return templates, err
+}
+
+// Invoices
+
+// MarkOverdue moves sales invoices with a balance past their due date to overdue
+func (r *dunningRepository) MarkOverdue(ctx context.Context, companyID uuid.UUID, date time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&models.Invoice{}).
+		Where("company_id = ? AND type = ? AND balance_amount > 0 AND due_date < ?", companyID, "sales", date).
+		Where("status IN ?", []string{"issued", "sent", "partial_paid"}).
+		Updates(map[string]interface{}{"status": "overdue", "updated_at": time.Now()})
+	return result.RowsAffected, result.Error
+}
+
+// ListOverdueInvoices returns sales invoices with a balance due before date
+func (r *dunningRepository) ListOverdueInvoices(ctx context.Context, companyID uuid.UUID, date time.Time) ([]*models.Invoice, error) {
+	var invoices []*models.Invoice
+	err := r.db.WithContext(ctx).
+		Preload("Customer").
+		Where("company_id = ? AND type = ? AND balance_amount > 0 AND due_date < ?", companyID, "sales", date).
+		Where("status IN ?", dunningOpenInvoiceStatuses).
+		Where("customer_id IS NOT NULL").
+		Order("customer_id, currency, due_date").
+		Find(&invoices).Error
+	return invoices, err
+}
+
+// SumPayments sums completed payments on a customer's sales invoices, or on
+// one invoice, made since a date
+func (r *dunningRepository) SumPayments(ctx context.Context, customerID uuid.UUID, invoiceID *uuid.UUID, since time.Time) (float64, error) {
+	var total float64
+	query := r.db.WithContext(ctx).Model(&models.Payment{}).
+		Select("COALESCE(SUM(payments.amount), 0)").
+		Joins("JOIN invoices ON invoices.id = payments.invoice_id").
+		Where("invoices.customer_id = ? AND invoices.type = ?", customerID, "sales").
+		Where("payments.status = ? AND payments.created_at >= ?", "completed", since)
+	if invoiceID != nil {
+		query = query.Where("payments.invoice_id = ?", *invoiceID)
+	}
+	err := query.Scan(&total).Error
+	return total, err
+}
+
+// Notices
+
+// CreateNotice stores a notice with its lines and moves each invoice that
+// reached a new stage to that stage
+func (r *dunningRepository) CreateNotice(ctx context.Context, notice *models.DunningNotice) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(notice).Error; err != nil {
+			return err
+		}
+		for _, line := range notice.Lines {
+			if line.Sequence == 0 {
+				continue
+			}
+			err := tx.Model(&models.Invoice{}).Where("id = ?", line.InvoiceID).
+				Updates(map[string]interface{}{"dunning_level": line.Sequence, "last_dunned_at": notice.NoticeDate}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *dunningRepository) UpdateNotice(ctx context.Context, notice *models.DunningNotice) error {
+	return r.db.WithContext(ctx).Omit("Lines").Save(notice).Error
+}
+
+func (r *dunningRepository) GetNotice(ctx context.Context, id uuid.UUID) (*models.DunningNotice, error) {
+	var notice models.DunningNotice
+	err := r.db.WithContext(ctx).Preload("Lines").Where("id = ?", id).First(&notice).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &notice, nil
+}
+
+func (r *dunningRepository) ListNotices(ctx context.Context, params map[string]interface{}) ([]*models.DunningNotice, int64, error) {
+	var notices []*models.DunningNotice
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.DunningNotice{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if customerID, ok := params["customer_id"].(uuid.UUID); ok {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if level, ok := params["level"].(string); ok && level != "" {
+		query = query.Where("level = ?", level)
+	}
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if from, ok := params["from"].(time.Time); ok {
+		query = query.Where("notice_date >= ?", from)
+	}
+	if to, ok := params["to"].(time.Time); ok {
+		query = query.Where("notice_date < ?", to)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+
+	err := query.Order("notice_date DESC, created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&notices).Error
+	return notices, total, err
+}
+
+// Promises to pay
+
+func (r *dunningRepository) CreatePromise(ctx context.Context, promise *models.PromiseToPay) error {
+	return r.db.WithContext(ctx).Create(promise).Error
+}
+
+func (r *dunningRepository) UpdatePromise(ctx context.Context, promise *models.PromiseToPay) error {
+	return r.db.WithContext(ctx).Save(promise).Error
+}
+
+func (r *dunningRepository) GetPromise(ctx context.Context, id uuid.UUID) (*models.PromiseToPay, error) {
+	var promise models.PromiseToPay
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&promise).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &promise, nil
+}
+
+func (r *dunningRepository) ListPromises(ctx context.Context, params map[string]interface{}) ([]*models.PromiseToPay, int64, error) {
+	var promises []*models.PromiseToPay
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.PromiseToPay{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if customerID, ok := params["customer_id"].(uuid.UUID); ok {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if since, ok := params["resolved_since"].(time.Time); ok {
+		query = query.Where("resolved_at >= ?", since)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if pageSize, ok := params["page_size"].(int); ok && pageSize > 0 {
+		page := 1
+		if p, ok := params["page"].(int); ok && p > 0 {
+			page = p
+		}
+		query = query.Offset((page - 1) * pageSize).Limit(pageSize)
+	}
+
+	err := query.Order("promised_date, created_at").Find(&promises).Error
+	return promises, total, err
+}
+
+// Collector notes
+
+func (r *dunningRepository) CreateNote(ctx context.Context, note *models.CollectorNote) error {
+	return r.db.WithContext(ctx).Create(note).Error
+}
+
+func (r *dunningRepository) ListNotes(ctx context.Context, params map[string]interface{}) ([]*models.CollectorNote, int64, error) {
+	var notes []*models.CollectorNote
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.CollectorNote{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if customerID, ok := params["customer_id"].(uuid.UUID); ok {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if invoiceID, ok := params["invoice_id"].(uuid.UUID); ok {
+		query = query.Where("invoice_id = ?", invoiceID)
+	}
+	if followUpBy, ok := params["follow_up_before"].(time.Time); ok {
+		query = query.Where("follow_up_date IS NOT NULL AND follow_up_date < ?", followUpBy)
+	}
+	if followUpFrom, ok := params["follow_up_from"].(time.Time); ok {
+		query = query.Where("follow_up_date >= ?", followUpFrom)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if pageSize, ok := params["page_size"].(int); ok && pageSize > 0 {
+		page := 1
+		if p, ok := params["page"].(int); ok && p > 0 {
+			page = p
+		}
+		query = query.Offset((page - 1) * pageSize).Limit(pageSize)
+	}
+
+	err := query.Order("created_at DESC").Find(&notes).Error
+	return notes, total, err
+}
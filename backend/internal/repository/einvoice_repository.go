@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EInvoiceRepository persists e-invoicing addresses and the generated
+// electronic versions of invoices
+type EInvoiceRepository interface {
+	// Source documents
+	GetInvoice(ctx context.Context, id uuid.UUID) (*models.Invoice, error)
+	ListInvoiceItems(ctx context.Context, invoiceID uuid.UUID) ([]models.InvoiceItem, error)
+	GetCompany(ctx context.Context, id uuid.UUID) (*models.Company, error)
+
+	// Parties
+	SaveParty(ctx context.Context, party *models.EInvoiceParty) error
+	FindParty(ctx context.Context, companyID uuid.UUID, customerID *uuid.UUID) (*models.EInvoiceParty, error)
+	ListParties(ctx context.Context, companyID uuid.UUID) ([]*models.EInvoiceParty, error)
+
+	// E-invoices
+	Create(ctx context.Context, einvoice *models.EInvoice) error
+	Update(ctx context.Context, einvoice *models.EInvoice) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.EInvoice, error)
+	List(ctx context.Context, params map[string]interface{}) ([]*models.EInvoice, int64, error)
+	LatestVersion(ctx context.Context, invoiceID uuid.UUID, format string) (int, error)
+}
+
+type einvoiceRepository struct {
+	db *gorm.DB
+}
+
+// NewEInvoiceRepository creates a new e-invoice repository
+func NewEInvoiceRepository(db *gorm.DB) EInvoiceRepository {
+	return &einvoiceRepository{db: db}
+}
+
+// Source documents
+
+func (r *einvoiceRepository) GetInvoice(ctx context.Context, id uuid.UUID) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := r.db.WithContext(ctx).
+		Preload("Order").
+		Preload("Customer").
+		Where("id = ?", id).
+		First(&invoice).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+func (r *einvoiceRepository) ListInvoiceItems(ctx context.Context, invoiceID uuid.UUID) ([]models.InvoiceItem, error) {
+	var items []models.InvoiceItem
+	err := r.db.WithContext(ctx).Where("invoice_id = ?", invoiceID).Order("created_at").Find(&items).Error
+	return items, err
+}
+
+func (r *einvoiceRepository) GetCompany(ctx context.Context, id uuid.UUID) (*models.Company, error) {
+	var company models.Company
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&company).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &company, nil
+}
+
+// Parties
+
+func (r *einvoiceRepository) SaveParty(ctx context.Context, party *models.EInvoiceParty) error {
+	return r.db.WithContext(ctx).Save(party).Error
+}
+
+// FindParty returns the address of a customer, or of the company itself
+// when customerID is nil
+func (r *einvoiceRepository) FindParty(ctx context.Context, companyID uuid.UUID, customerID *uuid.UUID) (*models.EInvoiceParty, error) {
+	var party models.EInvoiceParty
+	query := r.db.WithContext(ctx).Where("company_id = ?", companyID)
+	if customerID != nil {
+		query = query.Where("customer_id = ?", *customerID)
+	} else {
+		query = query.Where("customer_id IS NULL")
+	}
+	err := query.First(&party).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &party, nil
+}
+
+func (r *einvoiceRepository) ListParties(ctx context.Context, companyID uuid.UUID) ([]*models.EInvoiceParty, error) {
+	var parties []*models.EInvoiceParty
+	err := r.db.WithContext(ctx).
+		Preload("Customer").
+		Where("company_id = ?", companyID).
+		Order("customer_id NULLS FIRST, created_at").
+		Find(&parties).Error
+	return parties, err
+}
+
+// E-invoices
+
+// Create stores a new version and supersedes the earlier versions of the
+// invoice in the same format that were not transmitted
+func (r *einvoiceRepository) Create(ctx context.Context, einvoice *models.EInvoice) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.EInvoice{}).
+			Where("invoice_id = ? AND format = ?", einvoice.InvoiceID, einvoice.Format).
+			Where("status IN ?", []string{"generated", "invalid", "signed", "failed"}).
+			Update("status", "superseded").Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(einvoice).Error
+	})
+}
+
+func (r *einvoiceRepository) Update(ctx context.Context, einvoice *models.EInvoice) error {
+	return r.db.WithContext(ctx).Omit("Invoice").Save(einvoice).Error
+}
+
+func (r *einvoiceRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.EInvoice, error) {
+	var einvoice models.EInvoice
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&einvoice).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &einvoice, nil
+}
+
+func (r *einvoiceRepository) List(ctx context.Context, params map[string]interface{}) ([]*models.EInvoice, int64, error) {
+	var einvoices []*models.EInvoice
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.EInvoice{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if invoiceID, ok := params["invoice_id"].(uuid.UUID); ok {
+		query = query.Where("invoice_id = ?", invoiceID)
+	}
+	if format, ok := params["format"].(string); ok && format != "" {
+		query = query.Where("format = ?", format)
+	}
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+
+	err := query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&einvoices).Error
+	return einvoices, total, err
+}
+
+// LatestVersion returns the highest version of an invoice in a format, or 0
+func (r *einvoiceRepository) LatestVersion(ctx context.Context, invoiceID uuid.UUID, format string) (int, error) {
+	var version int
+	err := r.db.WithContext(ctx).Model(&models.EInvoice{}).
+		Select("COALESCE(MAX(version), 0)").
+		Where("invoice_id = ? AND format = ?", invoiceID, format).
+		Scan(&version).Error
+	return version, err
+}
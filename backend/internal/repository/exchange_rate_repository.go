@@ -36,6 +36,24 @@ func (r *ExchangeRateRepository) GetLatestRate(fromCurrency, toCurrency, company
 	return &rate, err
 }
 
+// GetRateOn 獲取指定日期有效的匯率，找不到時返回 ErrNotFound
+func (r *ExchangeRateRepository) GetRateOn(fromCurrency, toCurrency, companyID string, date time.Time) (*models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+
+	err := r.db.Where("company_id = ? AND from_currency = ? AND to_currency = ? AND effective_date <= ? AND is_active = ?",
+		companyID, fromCurrency, toCurrency, date, true).
+		Order("effective_date DESC").
+		First(&rate).Error
+
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
 // CreateRate 創建匯率
 func (r *ExchangeRateRepository) CreateRate(rate *models.ExchangeRate) error {
 	return r.db.Create(rate).Error
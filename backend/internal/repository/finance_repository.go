@@ -1,15 +1,39 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"time"
 	
 	"github.com/fastenmind/fastener-api/internal/models"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrPaymentNotPending is returned when completing a payment that is no
+// longer pending
+var ErrPaymentNotPending = errors.New("payment is not pending")
+
+// ErrInvoiceNotPayable is returned when paying a purchase invoice that
+// three-way matching has held or rejected, so it has no AP record yet
+var ErrInvoiceNotPayable = errors.New("purchase invoice is not released for payment")
+
+// InvoicePayable reports whether payments can be applied to an invoice.
+// Purchase invoices that went through matching are payable once matched or
+// released; invoices never matched follow the normal flow.
+func InvoicePayable(invoice *models.Invoice) bool {
+	if invoice.Type != "purchase" || invoice.MatchStatus == "" {
+		return true
+	}
+	return invoice.MatchStatus == models.MatchStatusMatched || invoice.MatchStatus == models.MatchStatusReleased
+}
+
 type FinanceRepository interface {
+	// WithContext returns the repository on the transaction carried by ctx
+	WithContext(ctx context.Context) FinanceRepository
+	
 	// Invoice operations
 	CreateInvoice(invoice *models.Invoice) error
 	UpdateInvoice(invoice *models.Invoice) error
@@ -21,7 +45,9 @@ type FinanceRepository interface {
 	
 	// Payment operations
 	CreatePayment(payment *models.Payment) error
+	CompletePayment(payment *models.Payment) error
 	UpdatePayment(payment *models.Payment) error
+	NextPaymentNumber(prefix string) (int64, error)
 	GetPayment(id uuid.UUID) (*models.Payment, error)
 	ListPayments(companyID uuid.UUID, params map[string]interface{}) ([]models.Payment, int64, error)
 	GetPaymentsByInvoice(invoiceID uuid.UUID) ([]models.Payment, error)
@@ -71,6 +97,10 @@ func NewFinanceRepository(db interface{}) FinanceRepository {
 	return &financeRepository{db: gormDB}
 }
 
+func (r *financeRepository) WithContext(ctx context.Context) FinanceRepository {
+	return &financeRepository{db: dbFor(ctx, r.db)}
+}
+
 // Invoice operations
 func (r *financeRepository) CreateInvoice(invoice *models.Invoice) error {
 	return r.db.Create(invoice).Error
@@ -196,67 +226,108 @@ func (r *financeRepository) GetInvoiceItems(invoiceID uuid.UUID) ([]models.Invoi
 }
 
 // Payment operations
+
+// CreatePayment stores a payment. Completed payments are applied to their
+// invoice right away; pending ones wait for CompletePayment.
 func (r *financeRepository) CreatePayment(payment *models.Payment) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
-		// Create payment
 		if err := tx.Create(payment).Error; err != nil {
 			return err
 		}
-		
-		// Update invoice if linked
-		if payment.InvoiceID != nil {
-			var invoice models.Invoice
-			if err := tx.First(&invoice, payment.InvoiceID).Error; err != nil {
-				return err
-			}
-			
-			invoice.PaidAmount += payment.Amount
-			invoice.BalanceAmount = invoice.TotalAmount - invoice.PaidAmount
-			
-			if invoice.BalanceAmount <= 0 {
-				invoice.Status = "paid"
-				now := time.Now()
-				invoice.PaymentDate = &now
-			} else if invoice.PaidAmount > 0 {
-				invoice.Status = "partial_paid"
-			}
-			
-			if err := tx.Save(&invoice).Error; err != nil {
-				return err
+		if payment.Status != "completed" {
+			return nil
+		}
+		return applyPayment(tx, payment)
+	})
+}
+
+// CompletePayment marks a pending payment completed and applies it to its
+// invoice
+func (r *financeRepository) CompletePayment(payment *models.Payment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Payment{}).
+			Where("id = ? AND status = ?", payment.ID, "pending").
+			Updates(map[string]interface{}{"status": "completed", "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPaymentNotPending
+		}
+		payment.Status = "completed"
+		return applyPayment(tx, payment)
+	})
+}
+
+// applyPayment adds a completed payment to the paid amount of its invoice and
+// the invoice's AR/AP record. The invoice row stays locked until the
+// transaction ends so concurrent payments add up.
+func applyPayment(tx *gorm.DB, payment *models.Payment) error {
+	if payment.InvoiceID == nil {
+		return nil
+	}
+	var invoice models.Invoice
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&invoice, payment.InvoiceID).Error; err != nil {
+		return err
+	}
+	if !InvoicePayable(&invoice) {
+		return ErrInvoiceNotPayable
+	}
+	
+	invoice.PaidAmount += payment.Amount
+	invoice.BalanceAmount = invoice.TotalAmount - invoice.PaidAmount
+	
+	if invoice.BalanceAmount <= 0 {
+		invoice.Status = "paid"
+		now := time.Now()
+		invoice.PaymentDate = &now
+	} else if invoice.PaidAmount > 0 {
+		invoice.Status = "partial_paid"
+	}
+	
+	if err := tx.Save(&invoice).Error; err != nil {
+		return err
+	}
+	
+	// Update AR/AP
+	if invoice.Type == "sales" && invoice.CustomerID != nil {
+		var ar models.AccountReceivable
+		if err := tx.Where("invoice_id = ?", invoice.ID).First(&ar).Error; err == nil {
+			ar.PaidAmount = invoice.PaidAmount
+			ar.BalanceAmount = invoice.BalanceAmount
+			ar.LastPaymentDate = &payment.PaymentDate
+			if ar.BalanceAmount <= 0 {
+				ar.Status = "paid"
+			} else {
+				ar.Status = "partial"
 			}
-			
-			// Update AR/AP
-			if invoice.Type == "sales" && invoice.CustomerID != nil {
-				var ar models.AccountReceivable
-				if err := tx.Where("invoice_id = ?", invoice.ID).First(&ar).Error; err == nil {
-					ar.PaidAmount = invoice.PaidAmount
-					ar.BalanceAmount = invoice.BalanceAmount
-					ar.LastPaymentDate = &payment.PaymentDate
-					if ar.BalanceAmount <= 0 {
-						ar.Status = "paid"
-					} else {
-						ar.Status = "partial"
-					}
-					tx.Save(&ar)
-				}
-			} else if invoice.Type == "purchase" && invoice.SupplierID != nil {
-				var ap models.AccountPayable
-				if err := tx.Where("invoice_id = ?", invoice.ID).First(&ap).Error; err == nil {
-					ap.PaidAmount = invoice.PaidAmount
-					ap.BalanceAmount = invoice.BalanceAmount
-					ap.LastPaymentDate = &payment.PaymentDate
-					if ap.BalanceAmount <= 0 {
-						ap.Status = "paid"
-					} else {
-						ap.Status = "partial"
-					}
-					tx.Save(&ap)
-				}
+			return tx.Save(&ar).Error
+		}
+	} else if invoice.Type == "purchase" && invoice.SupplierID != nil {
+		var ap models.AccountPayable
+		if err := tx.Where("invoice_id = ?", invoice.ID).First(&ap).Error; err == nil {
+			ap.PaidAmount = invoice.PaidAmount
+			ap.BalanceAmount = invoice.BalanceAmount
+			ap.LastPaymentDate = &payment.PaymentDate
+			if ap.BalanceAmount <= 0 {
+				ap.Status = "paid"
+			} else {
+				ap.Status = "partial"
 			}
+			return tx.Save(&ap).Error
 		}
-		
-		return nil
-	})
+	}
+	return nil
+}
+
+// NextPaymentNumber returns the next number of payments numbered with
+// prefix, e.g. PAY-202610-. Payment numbers are unique across companies, so
+// the sequence is shared.
+func (r *financeRepository) NextPaymentNumber(prefix string) (int64, error) {
+	floor := r.db.Session(&gorm.Session{NewDB: true}).Model(&models.Payment{}).
+		Select("MAX(CAST(SUBSTRING(payment_no FROM ?) AS BIGINT))", len(prefix)+1).
+		Where("payment_no LIKE ? AND SUBSTRING(payment_no FROM ?) ~ '^[0-9]+$'", prefix+"%", len(prefix)+1)
+	return nextSequence(r.db, uuid.Nil, prefix, floor)
 }
 
 func (r *financeRepository) UpdatePayment(payment *models.Payment) error {
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"fmt"
 	"github.com/fastenmind/fastener-api/internal/models"
 	"github.com/google/uuid"
@@ -8,6 +9,9 @@ import (
 )
 
 type InventoryRepository interface {
+	// WithContext returns the repository on the transaction carried by ctx
+	WithContext(ctx context.Context) InventoryRepository
+	
 	// Inventory CRUD
 	Create(inventory *models.Inventory) error
 	Update(inventory *models.Inventory) error
@@ -60,6 +64,10 @@ func NewInventoryRepository(db interface{}) InventoryRepository {
 	return &inventoryRepository{db: gormDB}
 }
 
+func (r *inventoryRepository) WithContext(ctx context.Context) InventoryRepository {
+	return &inventoryRepository{db: dbFor(ctx, r.db)}
+}
+
 // Inventory CRUD
 func (r *inventoryRepository) Create(inventory *models.Inventory) error {
 	return r.db.Create(inventory).Error
@@ -0,0 +1,286 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InvoiceMatchRepository persists three-way matches of supplier invoices
+// and reads the purchase orders, receipts and invoices they compare
+type InvoiceMatchRepository interface {
+	GetConfig(ctx context.Context, companyID uuid.UUID) (*models.InvoiceMatchConfig, error)
+	SaveConfig(ctx context.Context, config *models.InvoiceMatchConfig) error
+
+	// Documents
+
+	// CreateInvoice creates a supplier invoice with its items
+	CreateInvoice(ctx context.Context, invoice *models.Invoice, items []models.InvoiceItem) error
+	// SupplierInvoiceExists reports whether a supplier's invoice number was
+	// recorded before
+	SupplierInvoiceExists(ctx context.Context, companyID, supplierID uuid.UUID, supplierInvoiceNo string) (bool, error)
+	GetInvoice(ctx context.Context, id uuid.UUID) (*models.Invoice, error)
+	ListInvoiceItems(ctx context.Context, invoiceID uuid.UUID) ([]models.InvoiceItem, error)
+	GetPurchaseOrder(ctx context.Context, id uuid.UUID) (*models.PurchaseOrder, error)
+	ListReceipts(ctx context.Context, purchaseOrderID uuid.UUID) ([]models.PurchaseOrderReceipt, error)
+	// InvoicedQuantities returns the quantity billed per purchase order item
+	// on the order's other invoices, leaving out cancelled and rejected ones
+	InvoicedQuantities(ctx context.Context, purchaseOrderID, excludeInvoiceID uuid.UUID) (map[uuid.UUID]float64, error)
+	// ListHeldInvoiceIDs returns the invoices of an order held for review
+	ListHeldInvoiceIDs(ctx context.Context, purchaseOrderID uuid.UUID) ([]uuid.UUID, error)
+
+	// Matches
+
+	// SaveMatch saves a match with its lines, replacing those of an earlier
+	// attempt, and the match status of its invoice
+	SaveMatch(ctx context.Context, match *models.InvoiceMatch) error
+	// ReleaseMatch creates the account payable of a match's invoice and
+	// saves the match and the invoice's match status
+	ReleaseMatch(ctx context.Context, match *models.InvoiceMatch, payable *models.AccountPayable) error
+	GetMatch(ctx context.Context, id uuid.UUID) (*models.InvoiceMatch, error)
+	GetMatchByInvoice(ctx context.Context, invoiceID uuid.UUID) (*models.InvoiceMatch, error)
+	ListMatches(ctx context.Context, params map[string]interface{}) ([]*models.InvoiceMatch, int64, error)
+}
+
+type invoiceMatchRepository struct {
+	db *gorm.DB
+}
+
+// NewInvoiceMatchRepository creates a new invoice match repository
+func NewInvoiceMatchRepository(db *gorm.DB) InvoiceMatchRepository {
+	return &invoiceMatchRepository{db: db}
+}
+
+func (r *invoiceMatchRepository) GetConfig(ctx context.Context, companyID uuid.UUID) (*models.InvoiceMatchConfig, error) {
+	var config models.InvoiceMatchConfig
+	err := dbFor(ctx, r.db).Where("company_id = ?", companyID).First(&config).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (r *invoiceMatchRepository) SaveConfig(ctx context.Context, config *models.InvoiceMatchConfig) error {
+	return dbFor(ctx, r.db).Save(config).Error
+}
+
+// Documents
+
+func (r *invoiceMatchRepository) CreateInvoice(ctx context.Context, invoice *models.Invoice, items []models.InvoiceItem) error {
+	return dbFor(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(invoice).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].InvoiceID = invoice.ID
+			if err := tx.Omit(clause.Associations).Create(&items[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *invoiceMatchRepository) SupplierInvoiceExists(ctx context.Context, companyID, supplierID uuid.UUID, supplierInvoiceNo string) (bool, error) {
+	var count int64
+	err := dbFor(ctx, r.db).Model(&models.Invoice{}).
+		Where("company_id = ? AND supplier_id = ? AND supplier_invoice_no = ?", companyID, supplierID, supplierInvoiceNo).
+		Where("status <> ?", "cancelled").
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *invoiceMatchRepository) GetInvoice(ctx context.Context, id uuid.UUID) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := dbFor(ctx, r.db).Where("id = ?", id).First(&invoice).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+func (r *invoiceMatchRepository) ListInvoiceItems(ctx context.Context, invoiceID uuid.UUID) ([]models.InvoiceItem, error) {
+	var items []models.InvoiceItem
+	err := dbFor(ctx, r.db).Where("invoice_id = ?", invoiceID).Order("created_at").Find(&items).Error
+	return items, err
+}
+
+func (r *invoiceMatchRepository) GetPurchaseOrder(ctx context.Context, id uuid.UUID) (*models.PurchaseOrder, error) {
+	var order models.PurchaseOrder
+	err := dbFor(ctx, r.db).Preload("Items").Where("id = ?", id).First(&order).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *invoiceMatchRepository) ListReceipts(ctx context.Context, purchaseOrderID uuid.UUID) ([]models.PurchaseOrderReceipt, error) {
+	var receipts []models.PurchaseOrderReceipt
+	err := dbFor(ctx, r.db).
+		Where("purchase_order_id = ?", purchaseOrderID).
+		Order("received_at").
+		Find(&receipts).Error
+	return receipts, err
+}
+
+func (r *invoiceMatchRepository) InvoicedQuantities(ctx context.Context, purchaseOrderID, excludeInvoiceID uuid.UUID) (map[uuid.UUID]float64, error) {
+	var rows []struct {
+		PurchaseOrderItemID uuid.UUID
+		Quantity            float64
+	}
+	err := dbFor(ctx, r.db).Table("invoice_items").
+		Select("invoice_items.purchase_order_item_id, SUM(invoice_items.quantity) AS quantity").
+		Joins("JOIN invoices ON invoices.id = invoice_items.invoice_id").
+		Where("invoices.purchase_order_id = ? AND invoices.id <> ?", purchaseOrderID, excludeInvoiceID).
+		Where("invoices.status <> ?", "cancelled").
+		Where("invoices.match_status IS NULL OR invoices.match_status <> ?", models.MatchStatusRejected).
+		Where("invoice_items.purchase_order_item_id IS NOT NULL").
+		Group("invoice_items.purchase_order_item_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	quantities := make(map[uuid.UUID]float64, len(rows))
+	for _, row := range rows {
+		quantities[row.PurchaseOrderItemID] = row.Quantity
+	}
+	return quantities, nil
+}
+
+func (r *invoiceMatchRepository) ListHeldInvoiceIDs(ctx context.Context, purchaseOrderID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := dbFor(ctx, r.db).Model(&models.InvoiceMatch{}).
+		Where("purchase_order_id = ? AND status = ?", purchaseOrderID, models.MatchStatusHeld).
+		Pluck("invoice_id", &ids).Error
+	return ids, err
+}
+
+// Matches
+
+func (r *invoiceMatchRepository) SaveMatch(ctx context.Context, match *models.InvoiceMatch) error {
+	return dbFor(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		return saveMatch(tx, match)
+	})
+}
+
+func (r *invoiceMatchRepository) ReleaseMatch(ctx context.Context, match *models.InvoiceMatch, payable *models.AccountPayable) error {
+	return dbFor(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		var existing models.AccountPayable
+		err := tx.Where("invoice_id = ?", payable.InvoiceID).First(&existing).Error
+		switch {
+		case err == nil:
+			payable.ID = existing.ID
+		case err == gorm.ErrRecordNotFound:
+			if err := tx.Omit(clause.Associations).Create(payable).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+		match.AccountPayableID = &payable.ID
+		return saveMatch(tx, match)
+	})
+}
+
+func saveMatch(tx *gorm.DB, match *models.InvoiceMatch) error {
+	if err := tx.Omit(clause.Associations).Save(match).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("match_id = ?", match.ID).Delete(&models.InvoiceMatchLine{}).Error; err != nil {
+		return err
+	}
+	for i := range match.Lines {
+		match.Lines[i].ID = uuid.Nil
+		match.Lines[i].MatchID = match.ID
+	}
+	if len(match.Lines) > 0 {
+		if err := tx.Create(&match.Lines).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Model(&models.Invoice{}).Where("id = ?", match.InvoiceID).Update("match_status", match.Status).Error
+}
+
+func (r *invoiceMatchRepository) GetMatch(ctx context.Context, id uuid.UUID) (*models.InvoiceMatch, error) {
+	return r.findMatch(ctx, "id = ?", id)
+}
+
+func (r *invoiceMatchRepository) GetMatchByInvoice(ctx context.Context, invoiceID uuid.UUID) (*models.InvoiceMatch, error) {
+	return r.findMatch(ctx, "invoice_id = ?", invoiceID)
+}
+
+func (r *invoiceMatchRepository) findMatch(ctx context.Context, query string, arg interface{}) (*models.InvoiceMatch, error) {
+	var match models.InvoiceMatch
+	err := dbFor(ctx, r.db).
+		Preload("Lines").
+		Preload("Invoice").
+		Preload("PurchaseOrder").
+		Preload("Supplier").
+		Where(query, arg).
+		First(&match).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &match, nil
+}
+
+// ListMatches lists matches, latest first, filtered on company_id, status,
+// supplier_id and purchase_order_id
+func (r *invoiceMatchRepository) ListMatches(ctx context.Context, params map[string]interface{}) ([]*models.InvoiceMatch, int64, error) {
+	var matches []*models.InvoiceMatch
+	var total int64
+
+	query := dbFor(ctx, r.db).Model(&models.InvoiceMatch{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if supplierID, ok := params["supplier_id"].(uuid.UUID); ok {
+		query = query.Where("supplier_id = ?", supplierID)
+	}
+	if orderID, ok := params["purchase_order_id"].(uuid.UUID); ok {
+		query = query.Where("purchase_order_id = ?", orderID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := invoiceMatchPage(params)
+	err := query.Preload("Invoice").
+		Preload("Supplier").
+		Order("matched_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&matches).Error
+	return matches, total, err
+}
+
+func invoiceMatchPage(params map[string]interface{}) (int, int) {
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+	return page, pageSize
+}
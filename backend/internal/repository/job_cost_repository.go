@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// JobCostRepository reads the estimates and overhead rates job costing
+// needs and persists the job cost of production orders
+type JobCostRepository interface {
+	// Estimates and rates
+	FindCostCalculation(ctx context.Context, quoteID uuid.UUID) (*models.CostCalculation, error)
+	GetQuote(ctx context.Context, id uuid.UUID) (*models.Quote, error)
+	ListOverheadRates(ctx context.Context, companyID uuid.UUID, at time.Time) ([]*models.OverheadRate, error)
+	// ListSubcontractReceipts returns what came back from the subcontract
+	// orders of a production order, with the fee charged
+	ListSubcontractReceipts(ctx context.Context, productionOrderID uuid.UUID) ([]*models.SubcontractReceipt, error)
+
+	// Job costs
+	SaveJobCost(ctx context.Context, jobCost *models.ProductionJobCost) error
+	GetJobCost(ctx context.Context, productionOrderID uuid.UUID) (*models.ProductionJobCost, error)
+	ListJobCosts(ctx context.Context, params map[string]interface{}) ([]*models.ProductionJobCost, int64, error)
+}
+
+type jobCostRepository struct {
+	db *gorm.DB
+}
+
+// NewJobCostRepository creates a new job cost repository
+func NewJobCostRepository(db *gorm.DB) JobCostRepository {
+	return &jobCostRepository{db: db}
+}
+
+// Estimates and rates
+
+// FindCostCalculation returns the cost calculation a quote was priced on,
+// preferring approved calculations and then the latest
+func (r *jobCostRepository) FindCostCalculation(ctx context.Context, quoteID uuid.UUID) (*models.CostCalculation, error) {
+	var calculation models.CostCalculation
+	err := r.db.WithContext(ctx).
+		Preload("Details").
+		Where("quote_id = ?", quoteID).
+		Order("CASE WHEN status = 'approved' THEN 0 ELSE 1 END, calculated_at DESC").
+		First(&calculation).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &calculation, nil
+}
+
+func (r *jobCostRepository) GetQuote(ctx context.Context, id uuid.UUID) (*models.Quote, error) {
+	var quote models.Quote
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&quote).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// ListOverheadRates returns the active overhead rates of a company valid on a date
+func (r *jobCostRepository) ListOverheadRates(ctx context.Context, companyID uuid.UUID, at time.Time) ([]*models.OverheadRate, error) {
+	var rates []*models.OverheadRate
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND is_active = ?", companyID.String(), true).
+		Where("valid_from <= ? AND (valid_to IS NULL OR valid_to > ?)", at, at).
+		Order("department, valid_from").
+		Find(&rates).Error
+	return rates, err
+}
+
+func (r *jobCostRepository) ListSubcontractReceipts(ctx context.Context, productionOrderID uuid.UUID) ([]*models.SubcontractReceipt, error) {
+	var receipts []*models.SubcontractReceipt
+	orders := r.db.Model(&models.SubcontractOrder{}).
+		Select("id").
+		Where("production_order_id = ? AND status <> ?", productionOrderID, models.SubcontractStatusCancelled)
+	err := r.db.WithContext(ctx).
+		Preload("SubcontractOrder.Supplier").
+		Where("subcontract_order_id IN (?)", orders).
+		Order("received_at").
+		Find(&receipts).Error
+	return receipts, err
+}
+
+// Job costs
+
+// SaveJobCost creates or replaces the job cost of a production order
+func (r *jobCostRepository) SaveJobCost(ctx context.Context, jobCost *models.ProductionJobCost) error {
+	var existing models.ProductionJobCost
+	err := r.db.WithContext(ctx).
+		Select("id", "created_at").
+		Where("production_order_id = ?", jobCost.ProductionOrderID).
+		First(&existing).Error
+	switch {
+	case err == nil:
+		jobCost.ID = existing.ID
+		jobCost.CreatedAt = existing.CreatedAt
+		return r.db.WithContext(ctx).Save(jobCost).Error
+	case err == gorm.ErrRecordNotFound:
+		return r.db.WithContext(ctx).Create(jobCost).Error
+	default:
+		return err
+	}
+}
+
+func (r *jobCostRepository) GetJobCost(ctx context.Context, productionOrderID uuid.UUID) (*models.ProductionJobCost, error) {
+	var jobCost models.ProductionJobCost
+	err := r.db.WithContext(ctx).Where("production_order_id = ?", productionOrderID).First(&jobCost).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &jobCost, nil
+}
+
+// ListJobCosts lists job costs, filtered on company_id, final, from and to
+// (completion dates) and inventory_id. all=true skips paging, for analysis.
+func (r *jobCostRepository) ListJobCosts(ctx context.Context, params map[string]interface{}) ([]*models.ProductionJobCost, int64, error) {
+	var jobCosts []*models.ProductionJobCost
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.ProductionJobCost{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if final, ok := params["final"].(bool); ok {
+		query = query.Where("final = ?", final)
+	}
+	if inventoryID, ok := params["inventory_id"].(uuid.UUID); ok {
+		query = query.Where("inventory_id = ?", inventoryID)
+	}
+	if from, ok := params["from"].(time.Time); ok {
+		query = query.Where("completed_at >= ?", from)
+	}
+	if to, ok := params["to"].(time.Time); ok {
+		query = query.Where("completed_at < ?", to)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = query.Order("completed_at DESC NULLS FIRST, calculated_at DESC")
+	if all, _ := params["all"].(bool); !all {
+		page := 1
+		if p, ok := params["page"].(int); ok && p > 0 {
+			page = p
+		}
+		pageSize := 20
+		if ps, ok := params["page_size"].(int); ok && ps > 0 {
+			pageSize = ps
+		}
+		query = query.Offset((page - 1) * pageSize).Limit(pageSize)
+	}
+
+	err := query.Find(&jobCosts).Error
+	return jobCosts, total, err
+}
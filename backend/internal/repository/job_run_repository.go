@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// JobRunRepository stores the last run of periodic background jobs
+type JobRunRepository interface {
+	GetLastRun(ctx context.Context, name string) (*time.Time, error)
+	ClaimRun(ctx context.Context, name string, at, dueBefore time.Time) (bool, error)
+}
+
+type jobRunRepository struct {
+	db *gorm.DB
+}
+
+// NewJobRunRepository creates a new job run repository
+func NewJobRunRepository(db *gorm.DB) JobRunRepository {
+	return &jobRunRepository{db: db}
+}
+
+// GetLastRun returns when the job last ran, nil if it never did
+func (r *jobRunRepository) GetLastRun(ctx context.Context, name string) (*time.Time, error) {
+	var run models.JobRun
+	err := r.db.WithContext(ctx).Where("name = ?", name).First(&run).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &run.LastRunAt, nil
+}
+
+// ClaimRun records a run of the job at at unless it already ran after
+// dueBefore. It reports whether the run was claimed, so only one server runs
+// a due job.
+func (r *jobRunRepository) ClaimRun(ctx context.Context, name string, at, dueBefore time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Exec(`INSERT INTO job_runs (name, last_run_at, updated_at)
+		VALUES (?, ?, NOW())
+		ON CONFLICT (name)
+		DO UPDATE SET last_run_at = EXCLUDED.last_run_at, updated_at = NOW()
+		WHERE job_runs.last_run_at <= ?`, name, at, dueBefore)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,504 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LedgerAccountTotal is the sum of posted lines of one account
+type LedgerAccountTotal struct {
+	AccountID uuid.UUID
+	Debit     float64
+	Credit    float64
+}
+
+// LedgerRepository persists the chart of accounts, posting rules, journal
+// entries and foreign exchange revaluations
+type LedgerRepository interface {
+	// Chart of accounts
+	CreateAccounts(ctx context.Context, accounts []*models.GLAccount) error
+	GetAccount(ctx context.Context, id uuid.UUID) (*models.GLAccount, error)
+	UpdateAccount(ctx context.Context, account *models.GLAccount) error
+	ListAccounts(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.GLAccount, error)
+	FindAccountByCode(ctx context.Context, companyID uuid.UUID, code string) (*models.GLAccount, error)
+	FindAccountByRole(ctx context.Context, companyID uuid.UUID, role string) (*models.GLAccount, error)
+	CountAccounts(ctx context.Context, companyID uuid.UUID) (int64, error)
+
+	// Posting rules
+	CreatePostingRule(ctx context.Context, rule *models.PostingRule) error
+	GetPostingRule(ctx context.Context, id uuid.UUID) (*models.PostingRule, error)
+	UpdatePostingRule(ctx context.Context, rule *models.PostingRule) error
+	DeletePostingRule(ctx context.Context, id uuid.UUID) error
+	ListPostingRules(ctx context.Context, companyID uuid.UUID) ([]*models.PostingRule, error)
+
+	// Periods
+	FindPeriodForDate(ctx context.Context, companyID uuid.UUID, date time.Time) (*models.FinancialPeriod, error)
+
+	// Journal entries
+	CreateEntry(ctx context.Context, entry *models.JournalEntry) error
+	GetEntry(ctx context.Context, id uuid.UUID) (*models.JournalEntry, error)
+	ListEntries(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.JournalEntry, int64, error)
+	FindEntryBySource(ctx context.Context, companyID uuid.UUID, sourceType string, sourceID uuid.UUID, event string) (*models.JournalEntry, error)
+	ReverseEntry(ctx context.Context, original, reversal *models.JournalEntry) error
+	NextEntryNumber(ctx context.Context, companyID uuid.UUID, prefix string) (int64, error)
+
+	// Reports
+	SumAccountLines(ctx context.Context, companyID uuid.UUID, from, to *time.Time) ([]LedgerAccountTotal, error)
+	ListLines(ctx context.Context, companyID uuid.UUID, accountID *uuid.UUID, from, to *time.Time) ([]*models.JournalLine, error)
+
+	// Foreign exchange
+	CreateRevaluation(ctx context.Context, revaluation *models.FXRevaluation) error
+	GetRevaluation(ctx context.Context, id uuid.UUID) (*models.FXRevaluation, error)
+	ListRevaluations(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.FXRevaluation, int64, error)
+	FindRevaluation(ctx context.Context, companyID uuid.UUID, date time.Time) (*models.FXRevaluation, error)
+	ListOpenForeignInvoices(ctx context.Context, companyID uuid.UUID, base string, before time.Time) ([]*models.Invoice, error)
+	CreateRealization(ctx context.Context, realization *models.FXRealization) error
+	ListRealizations(ctx context.Context, companyID uuid.UUID, from, to *time.Time) ([]*models.FXRealization, error)
+}
+
+type ledgerRepository struct {
+	db *gorm.DB
+}
+
+// NewLedgerRepository creates a new ledger repository
+func NewLedgerRepository(db *gorm.DB) LedgerRepository {
+	return &ledgerRepository{db: db}
+}
+
+// Chart of accounts
+
+func (r *ledgerRepository) CreateAccounts(ctx context.Context, accounts []*models.GLAccount) error {
+	return dbFor(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		for _, account := range accounts {
+			if err := tx.Omit("Parent").Create(account).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *ledgerRepository) GetAccount(ctx context.Context, id uuid.UUID) (*models.GLAccount, error) {
+	var account models.GLAccount
+	err := dbFor(ctx, r.db).Where("id = ?", id).First(&account).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *ledgerRepository) UpdateAccount(ctx context.Context, account *models.GLAccount) error {
+	return dbFor(ctx, r.db).Omit("Parent").Save(account).Error
+}
+
+func (r *ledgerRepository) ListAccounts(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.GLAccount, error) {
+	var accounts []*models.GLAccount
+	query := dbFor(ctx, r.db).Where("company_id = ?", companyID)
+
+	if accountType, ok := params["type"].(string); ok && accountType != "" {
+		query = query.Where("type = ?", accountType)
+	}
+	if active, ok := params["is_active"].(bool); ok {
+		query = query.Where("is_active = ?", active)
+	}
+
+	err := query.Order("code").Find(&accounts).Error
+	return accounts, err
+}
+
+func (r *ledgerRepository) FindAccountByCode(ctx context.Context, companyID uuid.UUID, code string) (*models.GLAccount, error) {
+	var account models.GLAccount
+	err := dbFor(ctx, r.db).Where("company_id = ? AND code = ?", companyID, code).First(&account).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *ledgerRepository) FindAccountByRole(ctx context.Context, companyID uuid.UUID, role string) (*models.GLAccount, error) {
+	var account models.GLAccount
+	err := dbFor(ctx, r.db).
+		Where("company_id = ? AND role = ? AND is_active = ?", companyID, role, true).
+		Order("code").
+		First(&account).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *ledgerRepository) CountAccounts(ctx context.Context, companyID uuid.UUID) (int64, error) {
+	var count int64
+	err := dbFor(ctx, r.db).Model(&models.GLAccount{}).Where("company_id = ?", companyID).Count(&count).Error
+	return count, err
+}
+
+// Posting rules
+
+func (r *ledgerRepository) CreatePostingRule(ctx context.Context, rule *models.PostingRule) error {
+	return dbFor(ctx, r.db).Omit("Account").Create(rule).Error
+}
+
+func (r *ledgerRepository) GetPostingRule(ctx context.Context, id uuid.UUID) (*models.PostingRule, error) {
+	var rule models.PostingRule
+	err := dbFor(ctx, r.db).Preload("Account").Where("id = ?", id).First(&rule).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r *ledgerRepository) UpdatePostingRule(ctx context.Context, rule *models.PostingRule) error {
+	return dbFor(ctx, r.db).Omit("Account").Save(rule).Error
+}
+
+func (r *ledgerRepository) DeletePostingRule(ctx context.Context, id uuid.UUID) error {
+	return dbFor(ctx, r.db).Delete(&models.PostingRule{}, "id = ?", id).Error
+}
+
+func (r *ledgerRepository) ListPostingRules(ctx context.Context, companyID uuid.UUID) ([]*models.PostingRule, error) {
+	var rules []*models.PostingRule
+	err := dbFor(ctx, r.db).
+		Preload("Account").
+		Where("company_id = ?", companyID).
+		Order("event, role, match").
+		Find(&rules).Error
+	return rules, err
+}
+
+// Periods
+
+// FindPeriodForDate returns the financial period covering the day of date
+func (r *ledgerRepository) FindPeriodForDate(ctx context.Context, companyID uuid.UUID, date time.Time) (*models.FinancialPeriod, error) {
+	dayStart := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	var period models.FinancialPeriod
+	err := dbFor(ctx, r.db).
+		Where("company_id = ? AND start_date < ? AND end_date >= ?", companyID, dayEnd, dayStart).
+		Order("start_date DESC").
+		First(&period).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &period, nil
+}
+
+// Journal entries
+
+func (r *ledgerRepository) CreateEntry(ctx context.Context, entry *models.JournalEntry) error {
+	return dbFor(ctx, r.db).Omit("Period").Create(entry).Error
+}
+
+func (r *ledgerRepository) GetEntry(ctx context.Context, id uuid.UUID) (*models.JournalEntry, error) {
+	var entry models.JournalEntry
+	err := dbFor(ctx, r.db).
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("line_no") }).
+		Preload("Lines.Account").
+		Where("id = ?", id).
+		First(&entry).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *ledgerRepository) ListEntries(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.JournalEntry, int64, error) {
+	var entries []*models.JournalEntry
+	var total int64
+
+	query := dbFor(ctx, r.db).Model(&models.JournalEntry{}).Where("company_id = ?", companyID)
+
+	if event, ok := params["event"].(string); ok && event != "" {
+		query = query.Where("event = ?", event)
+	}
+	if sourceType, ok := params["source_type"].(string); ok && sourceType != "" {
+		query = query.Where("source_type = ?", sourceType)
+	}
+	if sourceID, ok := params["source_id"].(uuid.UUID); ok {
+		query = query.Where("source_id = ?", sourceID)
+	}
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if from, ok := params["from"].(time.Time); ok {
+		query = query.Where("entry_date >= ?", from)
+	}
+	if to, ok := params["to"].(time.Time); ok {
+		query = query.Where("entry_date < ?", to)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, _ := params["page"].(int)
+	pageSize, _ := params["page_size"].(int)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+
+	err := query.
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("line_no") }).
+		Order("entry_date DESC, entry_no DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&entries).Error
+	return entries, total, err
+}
+
+func (r *ledgerRepository) FindEntryBySource(ctx context.Context, companyID uuid.UUID, sourceType string, sourceID uuid.UUID, event string) (*models.JournalEntry, error) {
+	var entry models.JournalEntry
+	err := dbFor(ctx, r.db).
+		Where("company_id = ? AND source_type = ? AND source_id = ? AND event = ? AND status = ?",
+			companyID, sourceType, sourceID, event, "posted").
+		First(&entry).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// ReverseEntry stores the reversal and marks the original entry reversed in
+// one transaction
+func (r *ledgerRepository) ReverseEntry(ctx context.Context, original, reversal *models.JournalEntry) error {
+	return dbFor(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Period").Create(reversal).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.JournalEntry{}).
+			Where("id = ? AND status = ?", original.ID, "posted").
+			Updates(map[string]interface{}{
+				"status":         "reversed",
+				"reversed_by_id": reversal.ID,
+			}).Error
+	})
+}
+
+// NextEntryNumber returns the next number of the entries numbered with
+// prefix. Entries numbered before the sequence existed were counted up, so
+// the sequence starts after their count.
+func (r *ledgerRepository) NextEntryNumber(ctx context.Context, companyID uuid.UUID, prefix string) (int64, error) {
+	db := dbFor(ctx, r.db)
+	floor := db.Session(&gorm.Session{NewDB: true}).Model(&models.JournalEntry{}).
+		Select("COUNT(*)").
+		Where("company_id = ? AND entry_no LIKE ?", companyID, prefix+"%")
+	return nextSequence(db, companyID, prefix, floor)
+}
+
+// Reports
+
+// SumAccountLines totals debits and credits per account for entries dated
+// in [from, to); a nil bound is open
+func (r *ledgerRepository) SumAccountLines(ctx context.Context, companyID uuid.UUID, from, to *time.Time) ([]LedgerAccountTotal, error) {
+	var totals []LedgerAccountTotal
+	query := dbFor(ctx, r.db).
+		Table("journal_lines").
+		Select("journal_lines.account_id, SUM(journal_lines.debit) AS debit, SUM(journal_lines.credit) AS credit").
+		Joins("JOIN journal_entries ON journal_entries.id = journal_lines.entry_id").
+		Where("journal_lines.company_id = ?", companyID)
+
+	if from != nil {
+		query = query.Where("journal_entries.entry_date >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("journal_entries.entry_date < ?", *to)
+	}
+
+	err := query.Group("journal_lines.account_id").Scan(&totals).Error
+	return totals, err
+}
+
+// ListLines returns posted lines in date order, optionally for one account
+func (r *ledgerRepository) ListLines(ctx context.Context, companyID uuid.UUID, accountID *uuid.UUID, from, to *time.Time) ([]*models.JournalLine, error) {
+	var lines []*models.JournalLine
+	query := dbFor(ctx, r.db).
+		Model(&models.JournalLine{}).
+		Select("journal_lines.*").
+		Joins("JOIN journal_entries ON journal_entries.id = journal_lines.entry_id").
+		Preload("Entry").
+		Preload("Account").
+		Where("journal_lines.company_id = ?", companyID)
+
+	if accountID != nil {
+		query = query.Where("journal_lines.account_id = ?", *accountID)
+	}
+	if from != nil {
+		query = query.Where("journal_entries.entry_date >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("journal_entries.entry_date < ?", *to)
+	}
+
+	err := query.
+		Order("journal_entries.entry_date, journal_entries.entry_no, journal_lines.line_no").
+		Find(&lines).Error
+	return lines, err
+}
+
+// Foreign exchange
+
+// CreateRevaluation stores a revaluation together with its lines
+func (r *ledgerRepository) CreateRevaluation(ctx context.Context, revaluation *models.FXRevaluation) error {
+	return dbFor(ctx, r.db).Create(revaluation).Error
+}
+
+func (r *ledgerRepository) GetRevaluation(ctx context.Context, id uuid.UUID) (*models.FXRevaluation, error) {
+	var revaluation models.FXRevaluation
+	err := dbFor(ctx, r.db).
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("currency, kind, invoice_no") }).
+		Where("id = ?", id).
+		First(&revaluation).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &revaluation, nil
+}
+
+func (r *ledgerRepository) ListRevaluations(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.FXRevaluation, int64, error) {
+	var revaluations []*models.FXRevaluation
+	var total int64
+
+	query := dbFor(ctx, r.db).Model(&models.FXRevaluation{}).Where("company_id = ?", companyID)
+	if from, ok := params["from"].(time.Time); ok {
+		query = query.Where("revaluation_date >= ?", from)
+	}
+	if to, ok := params["to"].(time.Time); ok {
+		query = query.Where("revaluation_date < ?", to)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, _ := params["page"].(int)
+	pageSize, _ := params["page_size"].(int)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+
+	err := query.
+		Order("revaluation_date DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&revaluations).Error
+	return revaluations, total, err
+}
+
+// FindRevaluation returns the revaluation of a company on a date
+func (r *ledgerRepository) FindRevaluation(ctx context.Context, companyID uuid.UUID, date time.Time) (*models.FXRevaluation, error) {
+	var revaluation models.FXRevaluation
+	err := dbFor(ctx, r.db).
+		Where("company_id = ? AND revaluation_date = ?", companyID, date).
+		First(&revaluation).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &revaluation, nil
+}
+
+// ListOpenForeignInvoices returns invoices issued before a time with a balance
+// in another currency than base at that time. BalanceAmount is rebuilt as of
+// before: completed payments dated from before on are added back, so invoices
+// paid since then are listed too.
+func (r *ledgerRepository) ListOpenForeignInvoices(ctx context.Context, companyID uuid.UUID, base string, before time.Time) ([]*models.Invoice, error) {
+	db := dbFor(ctx, r.db)
+	var later []struct {
+		InvoiceID uuid.UUID
+		Amount    float64
+	}
+	err := db.Model(&models.Payment{}).
+		Select("invoice_id, SUM(amount) AS amount").
+		Where("company_id = ? AND status = ? AND invoice_id IS NOT NULL AND payment_date >= ?", companyID, "completed", before).
+		Group("invoice_id").
+		Scan(&later).Error
+	if err != nil {
+		return nil, err
+	}
+	paidLater := make(map[uuid.UUID]float64, len(later))
+	ids := make([]uuid.UUID, 0, len(later))
+	for _, p := range later {
+		paidLater[p.InvoiceID] = p.Amount
+		ids = append(ids, p.InvoiceID)
+	}
+
+	query := db.
+		Preload("Customer").
+		Preload("Supplier").
+		Where("company_id = ? AND currency <> ? AND issue_date < ?", companyID, base, before).
+		Where("status IN ?", []string{"issued", "sent", "partial_paid", "overdue", "paid"})
+	if len(ids) > 0 {
+		query = query.Where("balance_amount > 0 OR id IN ?", ids)
+	} else {
+		query = query.Where("balance_amount > 0")
+	}
+	var invoices []*models.Invoice
+	if err := query.Order("currency, invoice_no").Find(&invoices).Error; err != nil {
+		return nil, err
+	}
+
+	open := invoices[:0]
+	for _, invoice := range invoices {
+		invoice.BalanceAmount = math.Round((invoice.BalanceAmount+paidLater[invoice.ID])*100) / 100
+		if invoice.BalanceAmount > 0 {
+			open = append(open, invoice)
+		}
+	}
+	return open, nil
+}
+
+func (r *ledgerRepository) CreateRealization(ctx context.Context, realization *models.FXRealization) error {
+	return dbFor(ctx, r.db).Create(realization).Error
+}
+
+// ListRealizations returns the exchange differences realized by payments
+// dated in the range
+func (r *ledgerRepository) ListRealizations(ctx context.Context, companyID uuid.UUID, from, to *time.Time) ([]*models.FXRealization, error) {
+	var realizations []*models.FXRealization
+	query := dbFor(ctx, r.db).Where("company_id = ?", companyID)
+	if from != nil {
+		query = query.Where("payment_date >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("payment_date < ?", *to)
+	}
+	err := query.Order("payment_date, payment_no").Find(&realizations).Error
+	return realizations, err
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LoadPlanRepository persists load plans and freight rates
+type LoadPlanRepository interface {
+	// Load plans
+	CreateLoadPlan(ctx context.Context, plan *models.LoadPlan) error
+	GetLoadPlan(ctx context.Context, id uuid.UUID) (*models.LoadPlan, error)
+	ListLoadPlans(ctx context.Context, shipmentID uuid.UUID) ([]*models.LoadPlan, error)
+	ApplyLoadPlan(ctx context.Context, plan *models.LoadPlan, shipment *models.Shipment) error
+
+	// Planning inputs
+	GetShipmentWithProducts(ctx context.Context, id uuid.UUID) (*models.Shipment, error)
+	GetProducts(ctx context.Context, companyID uuid.UUID, ids []uuid.UUID) ([]*models.Product, error)
+
+	// Freight rates
+	CreateFreightRate(ctx context.Context, rate *models.FreightRate) error
+	GetFreightRate(ctx context.Context, id uuid.UUID) (*models.FreightRate, error)
+	UpdateFreightRate(ctx context.Context, rate *models.FreightRate) error
+	DeleteFreightRate(ctx context.Context, id uuid.UUID) error
+	ListFreightRates(ctx context.Context, params map[string]interface{}) ([]*models.FreightRate, error)
+	FindFreightRates(ctx context.Context, companyID uuid.UUID, method, originPort, destPort string, at time.Time) ([]*models.FreightRate, error)
+}
+
+type loadPlanRepository struct {
+	db *gorm.DB
+}
+
+// NewLoadPlanRepository creates a new load plan repository
+func NewLoadPlanRepository(db *gorm.DB) LoadPlanRepository {
+	return &loadPlanRepository{db: db}
+}
+
+// Load plans
+
+func (r *loadPlanRepository) CreateLoadPlan(ctx context.Context, plan *models.LoadPlan) error {
+	return r.db.WithContext(ctx).Omit("Shipment").Create(plan).Error
+}
+
+func (r *loadPlanRepository) GetLoadPlan(ctx context.Context, id uuid.UUID) (*models.LoadPlan, error) {
+	var plan models.LoadPlan
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&plan).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func (r *loadPlanRepository) ListLoadPlans(ctx context.Context, shipmentID uuid.UUID) ([]*models.LoadPlan, error) {
+	var plans []*models.LoadPlan
+	err := r.db.WithContext(ctx).Where("shipment_id = ?", shipmentID).Order("created_at DESC").Find(&plans).Error
+	return plans, err
+}
+
+// ApplyLoadPlan marks the plan applied, supersedes the previously applied plan
+// and stores the updated shipment and its items in one transaction
+func (r *loadPlanRepository) ApplyLoadPlan(ctx context.Context, plan *models.LoadPlan, shipment *models.Shipment) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.LoadPlan{}).
+			Where("shipment_id = ? AND status = ? AND id <> ?", plan.ShipmentID, "applied", plan.ID).
+			Update("status", "superseded").Error; err != nil {
+			return err
+		}
+		if err := tx.Omit("Shipment").Save(plan).Error; err != nil {
+			return err
+		}
+		for i := range shipment.Items {
+			if err := tx.Omit("Company", "Shipment", "Product").Save(&shipment.Items[i]).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Omit("Company", "Order", "Items", "Events", "Documents").Save(shipment).Error
+	})
+}
+
+// Planning inputs
+
+func (r *loadPlanRepository) GetShipmentWithProducts(ctx context.Context, id uuid.UUID) (*models.Shipment, error) {
+	var shipment models.Shipment
+	err := r.db.WithContext(ctx).
+		Preload("Items").
+		Preload("Items.Product").
+		Where("id = ?", id).
+		First(&shipment).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &shipment, nil
+}
+
+func (r *loadPlanRepository) GetProducts(ctx context.Context, companyID uuid.UUID, ids []uuid.UUID) ([]*models.Product, error) {
+	var products []*models.Product
+	err := r.db.WithContext(ctx).Where("company_id = ? AND id IN ?", companyID, ids).Find(&products).Error
+	return products, err
+}
+
+// Freight rates
+
+func (r *loadPlanRepository) CreateFreightRate(ctx context.Context, rate *models.FreightRate) error {
+	return r.db.WithContext(ctx).Create(rate).Error
+}
+
+func (r *loadPlanRepository) GetFreightRate(ctx context.Context, id uuid.UUID) (*models.FreightRate, error) {
+	var rate models.FreightRate
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&rate).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &rate, nil
+}
+
+func (r *loadPlanRepository) UpdateFreightRate(ctx context.Context, rate *models.FreightRate) error {
+	return r.db.WithContext(ctx).Save(rate).Error
+}
+
+func (r *loadPlanRepository) DeleteFreightRate(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Delete(&models.FreightRate{}, "id = ?", id).Error
+}
+
+func (r *loadPlanRepository) ListFreightRates(ctx context.Context, params map[string]interface{}) ([]*models.FreightRate, error) {
+	var rates []*models.FreightRate
+	query := r.db.WithContext(ctx).Model(&models.FreightRate{})
+
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if origin, ok := params["origin_port"].(string); ok && origin != "" {
+		query = query.Where("origin_port = ?", origin)
+	}
+	if dest, ok := params["dest_port"].(string); ok && dest != "" {
+		query = query.Where("dest_port = ?", dest)
+	}
+	if method, ok := params["method"].(string); ok && method != "" {
+		query = query.Where("method = ?", method)
+	}
+
+	err := query.Order("origin_port, dest_port, container_type, valid_from DESC").Find(&rates).Error
+	return rates, err
+}
+
+// FindFreightRates returns the rates of a lane that are valid at the given time
+func (r *loadPlanRepository) FindFreightRates(ctx context.Context, companyID uuid.UUID, method, originPort, destPort string, at time.Time) ([]*models.FreightRate, error) {
+	var rates []*models.FreightRate
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND method = ? AND origin_port = ? AND dest_port = ?", companyID, method, originPort, destPort).
+		Where("valid_from <= ? AND (valid_to IS NULL OR valid_to >= ?)", at, at).
+		Order("valid_from DESC").
+		Find(&rates).Error
+	return rates, err
+}
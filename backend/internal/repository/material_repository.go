@@ -4,6 +4,7 @@ import (
 	"strings"
 	"time"
 	
+	"github.com/fastenmind/fastener-api/internal/infrastructure/costversion"
 	"github.com/fastenmind/fastener-api/internal/models"
 	"gorm.io/gorm"
 )
@@ -21,8 +22,10 @@ func (r *MaterialRepository) GetMaterials(companyID, materialType string, offset
 	var materials []models.MaterialCostNew
 	var total int64
 	
+	// 只列出目前與排定生效的版本
 	query := r.db.Model(&models.MaterialCostNew{}).
-		Where("company_id = ? AND deleted_at IS NULL", companyID)
+		Where("company_id = ? AND deleted_at IS NULL", companyID).
+		Where("valid_to IS NULL OR valid_to > ?", time.Now())
 	
 	if materialType != "" {
 		query = query.Where("type = ?", materialType)
@@ -49,6 +52,43 @@ func (r *MaterialRepository) GetByID(id, companyID string) (*models.MaterialCost
 	return &material, err
 }
 
+// GetVersionAt 獲取與指定材料同一版本鏈中，指定日期有效的版本
+func (r *MaterialRepository) GetVersionAt(id, companyID string, at time.Time) (*models.MaterialCostNew, error) {
+	ids, err := versionChainIDs(r.db, &models.MaterialCostNew{}, id, companyID)
+	if err != nil {
+		return nil, err
+	}
+	var materials []models.MaterialCostNew
+	if err := r.db.Where("id IN ? AND deleted_at IS NULL", ids).Find(&materials).Error; err != nil {
+		return nil, err
+	}
+	versions := make([]costversion.Version, len(materials))
+	for i, m := range materials {
+		versions[i] = costversion.Version{Number: m.Version, ValidFrom: m.ValidFrom, ValidTo: m.ValidTo}
+	}
+	i := costversion.At(versions, at)
+	if i < 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &materials[i], nil
+}
+
+// GetVersions 獲取材料成本的所有版本，新版本在前
+func (r *MaterialRepository) GetVersions(id, companyID string) ([]models.MaterialCostNew, error) {
+	ids, err := versionChainIDs(r.db, &models.MaterialCostNew{}, id, companyID)
+	if err != nil {
+		return nil, err
+	}
+	var versions []models.MaterialCostNew
+	err = r.db.Where("id IN ?", ids).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// Revise 結束目前材料成本版本並建立新版本
+func (r *MaterialRepository) Revise(currentID string, next *models.MaterialCostNew) error {
+	return reviseVersion(r.db, &models.MaterialCostNew{}, currentID, next.ValidFrom, next)
+}
+
 // Create 創建材料
 func (r *MaterialRepository) Create(material *models.MaterialCostNew) error {
 	return r.db.Create(material).Error
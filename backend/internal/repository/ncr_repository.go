@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NCRRepository persists nonconformance reports with their 8D steps and
+// containment actions
+type NCRRepository interface {
+	// Reports
+	Create(ctx context.Context, ncr *models.NonconformanceReport) error
+	Update(ctx context.Context, ncr *models.NonconformanceReport) error
+	Get(ctx context.Context, id uuid.UUID) (*models.NonconformanceReport, error)
+	List(ctx context.Context, params map[string]interface{}) ([]*models.NonconformanceReport, int64, error)
+	FindByInspection(ctx context.Context, inspectionID uuid.UUID) (*models.NonconformanceReport, error)
+
+	// Steps and containment
+
+	// SaveSteps stores the report and the given steps together
+	SaveSteps(ctx context.Context, ncr *models.NonconformanceReport, steps ...*models.NCRStep) error
+	CreateContainment(ctx context.Context, containment *models.NCRContainment) error
+	UpdateContainment(ctx context.Context, containment *models.NCRContainment) error
+	GetContainment(ctx context.Context, id uuid.UUID) (*models.NCRContainment, error)
+	ListContainmentsByLot(ctx context.Context, companyID uuid.UUID, lotNo string) ([]*models.NCRContainment, error)
+
+	// Supplier quality
+
+	// CountSupplierNCRs counts the supplier-caused reports of a supplier
+	// reported in [from, to) by severity, leaving out cancelled ones
+	CountSupplierNCRs(ctx context.Context, companyID, supplierID uuid.UUID, from, to time.Time) (map[string]int, error)
+	// FindSupplierEvaluation returns the evaluation of a supplier of a type
+	// starting on a date
+	FindSupplierEvaluation(ctx context.Context, companyID, supplierID uuid.UUID, evaluationType string, start time.Time) (*models.SupplierEvaluation, error)
+}
+
+type ncrRepository struct {
+	db *gorm.DB
+}
+
+// NewNCRRepository creates a new NCR repository
+func NewNCRRepository(db *gorm.DB) NCRRepository {
+	return &ncrRepository{db: db}
+}
+
+// Reports
+
+// Create stores a report with its steps and containment actions
+func (r *ncrRepository) Create(ctx context.Context, ncr *models.NonconformanceReport) error {
+	return r.db.WithContext(ctx).Create(ncr).Error
+}
+
+func (r *ncrRepository) Update(ctx context.Context, ncr *models.NonconformanceReport) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(ncr).Error
+}
+
+// Get returns a report with its steps in order and its containment actions
+func (r *ncrRepository) Get(ctx context.Context, id uuid.UUID) (*models.NonconformanceReport, error) {
+	var ncr models.NonconformanceReport
+	err := r.db.WithContext(ctx).
+		Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("discipline") }).
+		Preload("Containments", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		Where("id = ?", id).
+		First(&ncr).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &ncr, nil
+}
+
+// List lists reports, latest first, filtered on company_id, status, source,
+// severity, responsibility, supplier_id, customer_id, inventory_id and a
+// search on number and title
+func (r *ncrRepository) List(ctx context.Context, params map[string]interface{}) ([]*models.NonconformanceReport, int64, error) {
+	var ncrs []*models.NonconformanceReport
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.NonconformanceReport{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	for _, field := range []string{"status", "source", "severity", "responsibility"} {
+		if value, ok := params[field].(string); ok && value != "" {
+			query = query.Where(field+" = ?", value)
+		}
+	}
+	for _, field := range []string{"supplier_id", "customer_id", "inventory_id"} {
+		if id, ok := params[field].(uuid.UUID); ok {
+			query = query.Where(field+" = ?", id)
+		}
+	}
+	if search, ok := params["search"].(string); ok && search != "" {
+		query = query.Where("ncr_no ILIKE ? OR title ILIKE ?", "%"+search+"%", "%"+search+"%")
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := ncrPage(params)
+	err := query.Order("reported_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&ncrs).Error
+	return ncrs, total, err
+}
+
+// FindByInspection returns the report raised for an inspection that was not
+// cancelled
+func (r *ncrRepository) FindByInspection(ctx context.Context, inspectionID uuid.UUID) (*models.NonconformanceReport, error) {
+	var ncr models.NonconformanceReport
+	err := r.db.WithContext(ctx).
+		Where("inspection_id = ? AND status <> ?", inspectionID, models.NCRStatusCancelled).
+		First(&ncr).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &ncr, nil
+}
+
+// Steps and containment
+
+func (r *ncrRepository) SaveSteps(ctx context.Context, ncr *models.NonconformanceReport, steps ...*models.NCRStep) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(ncr).Error; err != nil {
+			return err
+		}
+		for _, step := range steps {
+			if err := tx.Save(step).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *ncrRepository) CreateContainment(ctx context.Context, containment *models.NCRContainment) error {
+	return r.db.WithContext(ctx).Create(containment).Error
+}
+
+func (r *ncrRepository) UpdateContainment(ctx context.Context, containment *models.NCRContainment) error {
+	return r.db.WithContext(ctx).Save(containment).Error
+}
+
+func (r *ncrRepository) GetContainment(ctx context.Context, id uuid.UUID) (*models.NCRContainment, error) {
+	var containment models.NCRContainment
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&containment).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &containment, nil
+}
+
+// ListContainmentsByLot returns the containment actions taken on a lot,
+// latest first
+func (r *ncrRepository) ListContainmentsByLot(ctx context.Context, companyID uuid.UUID, lotNo string) ([]*models.NCRContainment, error) {
+	var containments []*models.NCRContainment
+	err := r.db.WithContext(ctx).
+		Joins("JOIN nonconformance_reports ON nonconformance_reports.id = ncr_containments.ncr_id").
+		Where("nonconformance_reports.company_id = ? AND ncr_containments.lot_no = ?", companyID, lotNo).
+		Order("ncr_containments.created_at DESC").
+		Find(&containments).Error
+	return containments, err
+}
+
+// Supplier quality
+
+func (r *ncrRepository) CountSupplierNCRs(ctx context.Context, companyID, supplierID uuid.UUID, from, to time.Time) (map[string]int, error) {
+	var rows []struct {
+		Severity string
+		Count    int
+	}
+	err := r.db.WithContext(ctx).Model(&models.NonconformanceReport{}).
+		Select("severity, COUNT(*) AS count").
+		Where("company_id = ? AND supplier_id = ? AND responsibility = ?", companyID, supplierID, models.ResponsibilitySupplier).
+		Where("status <> ? AND reported_at >= ? AND reported_at < ?", models.NCRStatusCancelled, from, to).
+		Group("severity").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Severity] = row.Count
+	}
+	return counts, nil
+}
+
+func (r *ncrRepository) FindSupplierEvaluation(ctx context.Context, companyID, supplierID uuid.UUID, evaluationType string, start time.Time) (*models.SupplierEvaluation, error) {
+	var evaluation models.SupplierEvaluation
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND supplier_id = ? AND evaluation_type = ? AND start_date = ?", companyID, supplierID, evaluationType, start).
+		First(&evaluation).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &evaluation, nil
+}
+
+func ncrPage(params map[string]interface{}) (int, int) {
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+	return page, pageSize
+}
@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PPAPRepository persists PPAP submissions with their elements and document
+// versions, and the warnings of production orders released without an
+// approved PPAP
+type PPAPRepository interface {
+	// Submissions
+
+	// CreateSubmission stores a submission with its elements
+	CreateSubmission(ctx context.Context, submission *models.PPAPSubmission) error
+	UpdateSubmission(ctx context.Context, submission *models.PPAPSubmission) error
+	// SaveSubmission stores a submission with its elements in one
+	// transaction
+	SaveSubmission(ctx context.Context, submission *models.PPAPSubmission) error
+	GetSubmission(ctx context.Context, id uuid.UUID) (*models.PPAPSubmission, error)
+	ListSubmissions(ctx context.Context, params map[string]interface{}) ([]*models.PPAPSubmission, int64, error)
+	// ApproveSubmission supersedes the approvals before of the same customer
+	// part and stores the approved submission
+	ApproveSubmission(ctx context.Context, submission *models.PPAPSubmission) error
+	// ListPartSubmissions returns the submissions of a part other than
+	// drafts, latest first
+	ListPartSubmissions(ctx context.Context, companyID, inventoryID uuid.UUID) ([]*models.PPAPSubmission, error)
+	// CustomerRequiresPPAP reports whether any part of a customer has been
+	// submitted for approval
+	CustomerRequiresPPAP(ctx context.Context, companyID, customerID uuid.UUID) (bool, error)
+
+	// Documents
+
+	// AddDocument stores a new document version and the element it
+	// completes in one transaction
+	AddDocument(ctx context.Context, element *models.PPAPElement, doc *models.PPAPDocument) error
+	GetDocument(ctx context.Context, id uuid.UUID) (*models.PPAPDocument, error)
+
+	// Release warnings
+	CreateReleaseWarning(ctx context.Context, warning *models.PPAPReleaseWarning) error
+	UpdateReleaseWarning(ctx context.Context, warning *models.PPAPReleaseWarning) error
+	GetReleaseWarning(ctx context.Context, id uuid.UUID) (*models.PPAPReleaseWarning, error)
+	ListReleaseWarnings(ctx context.Context, params map[string]interface{}) ([]*models.PPAPReleaseWarning, int64, error)
+}
+
+type ppapRepository struct {
+	db *gorm.DB
+}
+
+// NewPPAPRepository creates a new PPAP repository
+func NewPPAPRepository(db *gorm.DB) PPAPRepository {
+	return &ppapRepository{db: db}
+}
+
+// Submissions
+
+func (r *ppapRepository) CreateSubmission(ctx context.Context, submission *models.PPAPSubmission) error {
+	return r.db.WithContext(ctx).Omit("Customer", "Inventory", "Route").Create(submission).Error
+}
+
+func (r *ppapRepository) UpdateSubmission(ctx context.Context, submission *models.PPAPSubmission) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(submission).Error
+}
+
+func (r *ppapRepository) SaveSubmission(ctx context.Context, submission *models.PPAPSubmission) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(submission).Error; err != nil {
+			return err
+		}
+		for i := range submission.Elements {
+			if err := tx.Omit(clause.Associations).Save(&submission.Elements[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetSubmission returns a submission with its elements in order and their
+// documents, latest version first
+func (r *ppapRepository) GetSubmission(ctx context.Context, id uuid.UUID) (*models.PPAPSubmission, error) {
+	var submission models.PPAPSubmission
+	err := r.db.WithContext(ctx).
+		Preload("Customer").
+		Preload("Route").
+		Preload("Elements", func(db *gorm.DB) *gorm.DB { return db.Order("element") }).
+		Preload("Elements.Documents", func(db *gorm.DB) *gorm.DB { return db.Order("version DESC") }).
+		Where("id = ?", id).
+		First(&submission).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &submission, nil
+}
+
+// ListSubmissions lists submissions, latest first, filtered on company_id,
+// customer_id, inventory_id, status, level and a search on the submission
+// and customer part numbers
+func (r *ppapRepository) ListSubmissions(ctx context.Context, params map[string]interface{}) ([]*models.PPAPSubmission, int64, error) {
+	var submissions []*models.PPAPSubmission
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.PPAPSubmission{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	for _, field := range []string{"customer_id", "inventory_id"} {
+		if id, ok := params[field].(uuid.UUID); ok {
+			query = query.Where(field+" = ?", id)
+		}
+	}
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if level, ok := params["level"].(int); ok && level > 0 {
+		query = query.Where("level = ?", level)
+	}
+	if search, ok := params["search"].(string); ok && search != "" {
+		query = query.Where("submission_no ILIKE ? OR customer_part_no ILIKE ? OR customer_part_name ILIKE ?",
+			"%"+search+"%", "%"+search+"%", "%"+search+"%")
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := ppapPage(params)
+	err := query.Preload("Customer").
+		Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&submissions).Error
+	return submissions, total, err
+}
+
+func (r *ppapRepository) ApproveSubmission(ctx context.Context, submission *models.PPAPSubmission) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.PPAPSubmission{}).
+			Where("company_id = ? AND customer_id = ? AND customer_part_no = ? AND id <> ?",
+				submission.CompanyID, submission.CustomerID, submission.CustomerPartNo, submission.ID).
+			Where("status IN ?", []string{models.PPAPStatusApproved, models.PPAPStatusInterimApproved}).
+			Update("status", models.PPAPStatusSuperseded).Error
+		if err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Save(submission).Error
+	})
+}
+
+func (r *ppapRepository) ListPartSubmissions(ctx context.Context, companyID, inventoryID uuid.UUID) ([]*models.PPAPSubmission, error) {
+	var submissions []*models.PPAPSubmission
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND inventory_id = ? AND status <> ?", companyID, inventoryID, models.PPAPStatusDraft).
+		Order("created_at DESC").
+		Find(&submissions).Error
+	return submissions, err
+}
+
+func (r *ppapRepository) CustomerRequiresPPAP(ctx context.Context, companyID, customerID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.PPAPSubmission{}).
+		Where("company_id = ? AND customer_id = ? AND status <> ?", companyID, customerID, models.PPAPStatusDraft).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Documents
+
+func (r *ppapRepository) AddDocument(ctx context.Context, element *models.PPAPElement, doc *models.PPAPDocument) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(doc).Error; err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Save(element).Error
+	})
+}
+
+func (r *ppapRepository) GetDocument(ctx context.Context, id uuid.UUID) (*models.PPAPDocument, error) {
+	var doc models.PPAPDocument
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&doc).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Release warnings
+
+func (r *ppapRepository) CreateReleaseWarning(ctx context.Context, warning *models.PPAPReleaseWarning) error {
+	return r.db.WithContext(ctx).Create(warning).Error
+}
+
+func (r *ppapRepository) UpdateReleaseWarning(ctx context.Context, warning *models.PPAPReleaseWarning) error {
+	return r.db.WithContext(ctx).Save(warning).Error
+}
+
+func (r *ppapRepository) GetReleaseWarning(ctx context.Context, id uuid.UUID) (*models.PPAPReleaseWarning, error) {
+	var warning models.PPAPReleaseWarning
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&warning).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &warning, nil
+}
+
+// ListReleaseWarnings lists release warnings, latest first, filtered on
+// company_id, inventory_id, customer_id and whether they are acknowledged
+func (r *ppapRepository) ListReleaseWarnings(ctx context.Context, params map[string]interface{}) ([]*models.PPAPReleaseWarning, int64, error) {
+	var warnings []*models.PPAPReleaseWarning
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.PPAPReleaseWarning{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	for _, field := range []string{"inventory_id", "customer_id"} {
+		if id, ok := params[field].(uuid.UUID); ok {
+			query = query.Where(field+" = ?", id)
+		}
+	}
+	if acknowledged, ok := params["acknowledged"].(bool); ok {
+		if acknowledged {
+			query = query.Where("acknowledged_at IS NOT NULL")
+		} else {
+			query = query.Where("acknowledged_at IS NULL")
+		}
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := ppapPage(params)
+	err := query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&warnings).Error
+	return warnings, total, err
+}
+
+func ppapPage(params map[string]interface{}) (int, int) {
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+	return page, pageSize
+}
@@ -3,10 +3,14 @@ package repository
 import (
 	"time"
 	"github.com/google/uuid"
+	"github.com/fastenmind/fastener-api/internal/infrastructure/costversion"
 	"github.com/fastenmind/fastener-api/internal/models"
 	"gorm.io/gorm"
 )
 
+// ErrVersionSuperseded 模板或費率版本已被取代，只能修改目前版本
+var ErrVersionSuperseded = costversion.ErrSuperseded
+
 type ProcessCostRepository struct {
 	db *gorm.DB
 }
@@ -20,8 +24,10 @@ func (r *ProcessCostRepository) GetTemplates(companyID, processType, category st
 	var templates []models.ProcessCostTemplate
 	var total int64
 	
+	// 只列出目前與排定生效的版本
 	query := r.db.Model(&models.ProcessCostTemplate{}).
-		Where("company_id = ? AND deleted_at IS NULL", companyID)
+		Where("company_id = ? AND deleted_at IS NULL", companyID).
+		Where("valid_to IS NULL OR valid_to > ?", time.Now())
 	
 	if processType != "" {
 		query = query.Where("process_type = ?", processType)
@@ -104,18 +110,27 @@ func (r *ProcessCostRepository) GetCalculationHistory(companyID, inquiryID, prod
 	return histories, total, err
 }
 
-// GetProcessingRate 獲取加工費率
+// GetProcessingRate 獲取目前有效的加工費率
 func (r *ProcessCostRepository) GetProcessingRate(processType, equipmentID, companyID string) (*models.ProcessingRate, error) {
+	return r.GetProcessingRateAt(processType, equipmentID, companyID, time.Now())
+}
+
+// GetProcessingRateAt 獲取指定日期有效的加工費率，未指定設備或無設備費率時使用通用費率
+func (r *ProcessCostRepository) GetProcessingRateAt(processType, equipmentID, companyID string, at time.Time) (*models.ProcessingRate, error) {
 	var rate models.ProcessingRate
 	
 	query := r.db.Where("company_id = ? AND process_type = ? AND is_active = ?", 
-		companyID, processType, true)
+		companyID, processType, true).
+		Where("valid_from <= ? AND (valid_to IS NULL OR valid_to > ?)", at, at)
 	
 	if equipmentID != "" {
-		query = query.Where("equipment_id = ?", equipmentID)
+		query = query.Where("equipment_id = ? OR equipment_id = '' OR equipment_id IS NULL", equipmentID).
+			Order(gorm.Expr("CASE WHEN equipment_id = ? THEN 0 ELSE 1 END", equipmentID))
+	} else {
+		query = query.Order("CASE WHEN equipment_id = '' OR equipment_id IS NULL THEN 0 ELSE 1 END")
 	}
 	
-	err := query.First(&rate).Error
+	err := query.Order("valid_from DESC").First(&rate).Error
 	return &rate, err
 }
 
@@ -123,7 +138,9 @@ func (r *ProcessCostRepository) GetProcessingRate(processType, equipmentID, comp
 func (r *ProcessCostRepository) GetProcessingRates(companyID, processType, equipmentID string) ([]models.ProcessingRate, error) {
 	var rates []models.ProcessingRate
 	
-	query := r.db.Where("company_id = ? AND is_active = ?", companyID, true)
+	// 只列出目前與排定生效的版本
+	query := r.db.Where("company_id = ? AND is_active = ?", companyID, true).
+		Where("valid_to IS NULL OR valid_to > ?", time.Now())
 	
 	if processType != "" {
 		query = query.Where("process_type = ?", processType)
@@ -149,14 +166,200 @@ func (r *ProcessCostRepository) UpdateProcessingRate(rate *models.ProcessingRate
 	return r.db.Save(rate).Error
 }
 
-// GetSurfaceTreatmentRate 獲取表面處理費率
+// GetSurfaceTreatmentRate 獲取目前有效的表面處理費率
 func (r *ProcessCostRepository) GetSurfaceTreatmentRate(treatmentType, companyID string) (*models.SurfaceTreatmentRate, error) {
-	var rate models.SurfaceTreatmentRate
+	return r.GetSurfaceTreatmentRateAt(treatmentType, companyID, time.Now())
+}
+
+// GetSurfaceTreatmentRateAt 獲取指定日期有效的表面處理費率
+func (r *ProcessCostRepository) GetSurfaceTreatmentRateAt(treatmentType, companyID string, at time.Time) (*models.SurfaceTreatmentRate, error) {
+	// 舊資料的 valid_from 為空，視為一直有效
+	var rates []models.SurfaceTreatmentRate
 	err := r.db.Where("company_id = ? AND treatment_type = ? AND is_active = ?", 
-		companyID, treatmentType, true).First(&rate).Error
+		companyID, treatmentType, true).
+		Where("valid_to IS NULL OR valid_to > ?", at).
+		Find(&rates).Error
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]costversion.Version, len(rates))
+	for i, rate := range rates {
+		versions[i] = costversion.Version{Number: rate.Version, ValidFrom: rate.ValidFrom, ValidTo: rate.ValidTo}
+	}
+	i := costversion.At(versions, at)
+	if i < 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &rates[i], nil
+}
+
+// GetSurfaceTreatmentRates 獲取目前與排定生效的表面處理費率
+func (r *ProcessCostRepository) GetSurfaceTreatmentRates(companyID, treatmentType string) ([]models.SurfaceTreatmentRate, error) {
+	var rates []models.SurfaceTreatmentRate
+	
+	query := r.db.Where("company_id = ? AND is_active = ?", companyID, true).
+		Where("valid_to IS NULL OR valid_to > ?", time.Now())
+	
+	if treatmentType != "" {
+		query = query.Where("treatment_type = ?", treatmentType)
+	}
+	
+	err := query.Order("treatment_type, valid_from").Find(&rates).Error
+	return rates, err
+}
+
+// GetSurfaceTreatmentRateByID 根據ID獲取表面處理費率
+func (r *ProcessCostRepository) GetSurfaceTreatmentRateByID(id, companyID string) (*models.SurfaceTreatmentRate, error) {
+	var rate models.SurfaceTreatmentRate
+	err := r.db.Where("id = ? AND company_id = ?", id, companyID).First(&rate).Error
+	return &rate, err
+}
+
+// GetOverheadRates 獲取目前與排定生效的管理費率
+func (r *ProcessCostRepository) GetOverheadRates(companyID, department string) ([]models.OverheadRate, error) {
+	var rates []models.OverheadRate
+	
+	query := r.db.Where("company_id = ? AND is_active = ?", companyID, true).
+		Where("valid_to IS NULL OR valid_to > ?", time.Now())
+	
+	if department != "" {
+		query = query.Where("department = ?", department)
+	}
+	
+	err := query.Order("department, valid_from").Find(&rates).Error
+	return rates, err
+}
+
+// GetOverheadRatesAt 獲取指定日期有效的管理費率，每個部門一筆
+func (r *ProcessCostRepository) GetOverheadRatesAt(companyID string, at time.Time) ([]models.OverheadRate, error) {
+	var rates []models.OverheadRate
+	err := r.db.Where("company_id = ? AND is_active = ?", companyID, true).
+		Where("valid_to IS NULL OR valid_to > ?", at).
+		Order("department, valid_from").
+		Find(&rates).Error
+	if err != nil {
+		return nil, err
+	}
+	
+	byDepartment := map[string][]int{}
+	var departments []string
+	for i, rate := range rates {
+		if _, ok := byDepartment[rate.Department]; !ok {
+			departments = append(departments, rate.Department)
+		}
+		byDepartment[rate.Department] = append(byDepartment[rate.Department], i)
+	}
+	
+	valid := make([]models.OverheadRate, 0, len(departments))
+	for _, department := range departments {
+		indexes := byDepartment[department]
+		versions := make([]costversion.Version, len(indexes))
+		for i, index := range indexes {
+			rate := rates[index]
+			versions[i] = costversion.Version{Number: rate.Version, ValidFrom: rate.ValidFrom, ValidTo: rate.ValidTo}
+		}
+		if i := costversion.At(versions, at); i >= 0 {
+			valid = append(valid, rates[indexes[i]])
+		}
+	}
+	return valid, nil
+}
+
+// GetOverheadRateByID 根據ID獲取管理費率
+func (r *ProcessCostRepository) GetOverheadRateByID(id, companyID string) (*models.OverheadRate, error) {
+	var rate models.OverheadRate
+	err := r.db.Where("id = ? AND company_id = ?", id, companyID).First(&rate).Error
 	return &rate, err
 }
 
+// 版本管理：修改模板或費率時結束目前版本並建立新版本，舊版本保留供依日期重算與稽核
+
+// GetTemplateAt 獲取與指定模板同一版本鏈中，指定日期有效的版本
+func (r *ProcessCostRepository) GetTemplateAt(id, companyID string, at time.Time) (*models.ProcessCostTemplate, error) {
+	ids, err := versionChainIDs(r.db, &models.ProcessCostTemplate{}, id, companyID)
+	if err != nil {
+		return nil, err
+	}
+	// 版本鏈很短，載入後再挑選；舊資料的 valid_from 為空，視為一直有效
+	var templates []models.ProcessCostTemplate
+	if err := r.db.Where("id IN ? AND deleted_at IS NULL", ids).Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	versions := make([]costversion.Version, len(templates))
+	for i, t := range templates {
+		versions[i] = costversion.Version{Number: t.Version, ValidFrom: t.ValidFrom, ValidTo: t.ValidTo}
+	}
+	i := costversion.At(versions, at)
+	if i < 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &templates[i], nil
+}
+
+// GetTemplateVersions 獲取模板的所有版本，新版本在前
+func (r *ProcessCostRepository) GetTemplateVersions(id, companyID string) ([]models.ProcessCostTemplateNew, error) {
+	ids, err := versionChainIDs(r.db, &models.ProcessCostTemplate{}, id, companyID)
+	if err != nil {
+		return nil, err
+	}
+	var versions []models.ProcessCostTemplateNew
+	err = r.db.Where("id IN ?", ids).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// ReviseTemplate 結束目前模板版本並建立新版本
+func (r *ProcessCostRepository) ReviseTemplate(currentID string, next *models.ProcessCostTemplate) error {
+	return reviseVersion(r.db, &models.ProcessCostTemplate{}, currentID, next.ValidFrom, next)
+}
+
+// GetProcessingRateVersions 獲取加工費率的所有版本，新版本在前
+func (r *ProcessCostRepository) GetProcessingRateVersions(id, companyID string) ([]models.ProcessingRate, error) {
+	ids, err := versionChainIDs(r.db, &models.ProcessingRate{}, id, companyID)
+	if err != nil {
+		return nil, err
+	}
+	var versions []models.ProcessingRate
+	err = r.db.Where("id IN ?", ids).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// ReviseProcessingRate 結束目前加工費率版本並建立新版本
+func (r *ProcessCostRepository) ReviseProcessingRate(currentID string, next *models.ProcessingRate) error {
+	return reviseVersion(r.db, &models.ProcessingRate{}, currentID, next.ValidFrom, next)
+}
+
+// GetSurfaceTreatmentRateVersions 獲取表面處理費率的所有版本，新版本在前
+func (r *ProcessCostRepository) GetSurfaceTreatmentRateVersions(id, companyID string) ([]models.SurfaceTreatmentRate, error) {
+	ids, err := versionChainIDs(r.db, &models.SurfaceTreatmentRate{}, id, companyID)
+	if err != nil {
+		return nil, err
+	}
+	var versions []models.SurfaceTreatmentRate
+	err = r.db.Where("id IN ?", ids).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// ReviseSurfaceTreatmentRate 結束目前表面處理費率版本並建立新版本
+func (r *ProcessCostRepository) ReviseSurfaceTreatmentRate(currentID string, next *models.SurfaceTreatmentRate) error {
+	return reviseVersion(r.db, &models.SurfaceTreatmentRate{}, currentID, next.ValidFrom, next)
+}
+
+// GetOverheadRateVersions 獲取管理費率的所有版本，新版本在前
+func (r *ProcessCostRepository) GetOverheadRateVersions(id, companyID string) ([]models.OverheadRate, error) {
+	ids, err := versionChainIDs(r.db, &models.OverheadRate{}, id, companyID)
+	if err != nil {
+		return nil, err
+	}
+	var versions []models.OverheadRate
+	err = r.db.Where("id IN ?", ids).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// ReviseOverheadRate 結束目前管理費率版本並建立新版本
+func (r *ProcessCostRepository) ReviseOverheadRate(currentID string, next *models.OverheadRate) error {
+	return reviseVersion(r.db, &models.OverheadRate{}, currentID, next.ValidFrom, next)
+}
+
 // GetCostDataForAnalysis 獲取成本分析數據
 func (r *ProcessCostRepository) GetCostDataForAnalysis(companyID, analysisType, startDate, endDate string) ([]models.CostData, error) {
 	var data []models.CostData
@@ -234,6 +437,59 @@ func (r *ProcessCostRepository) UpdateSettings(settings *models.CostSettings) er
 
 // 私有輔助函數
 
+// versionStore 以 gorm 讀寫某個資料表的版本鏈
+type versionStore struct {
+	db    *gorm.DB
+	model interface{}
+}
+
+func (v versionStore) take(query interface{}, arg string) (costversion.Link, bool, error) {
+	var link costversion.Link
+	err := v.db.Model(v.model).Select("id, supersedes_id").Where(query, arg).Take(&link).Error
+	if err == gorm.ErrRecordNotFound {
+		return link, false, nil
+	}
+	return link, err == nil, err
+}
+
+func (v versionStore) Get(id string) (costversion.Link, bool, error) {
+	return v.take("id = ?", id)
+}
+
+func (v versionStore) SupersededBy(id string) (costversion.Link, bool, error) {
+	return v.take("supersedes_id = ?", id)
+}
+
+func (v versionStore) End(id string, effective time.Time) (bool, error) {
+	result := v.db.Model(v.model).
+		Where("id = ? AND valid_to IS NULL", id).
+		Updates(map[string]interface{}{"valid_to": effective, "updated_at": time.Now()})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (v versionStore) Create(version interface{}) error {
+	return v.db.Create(version).Error
+}
+
+// versionChainIDs 沿 supersedes_id 往前、往後找出同一版本鏈的所有ID
+func versionChainIDs(db *gorm.DB, model interface{}, id, companyID string) ([]string, error) {
+	var start costversion.Link
+	if err := db.Model(model).Select("id, supersedes_id").
+		Where("id = ? AND company_id = ?", id, companyID).
+		Take(&start).Error; err != nil {
+		return nil, err
+	}
+	return costversion.Chain(versionStore{db: db, model: model}, start)
+}
+
+// reviseVersion 在同一交易中將目前版本的 valid_to 設為新版本生效日並建立新版本；
+// 目前版本已被其他修改結束時回傳 ErrVersionSuperseded
+func reviseVersion(db *gorm.DB, model interface{}, currentID string, effective time.Time, next interface{}) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return costversion.Revise(versionStore{db: tx, model: model}, currentID, effective, next)
+	})
+}
+
 func (r *ProcessCostRepository) getSummaryReportData(companyID, startDate, endDate string) (interface{}, error) {
 	type SummaryData struct {
 		TotalCost         float64 `json:"total_cost"`
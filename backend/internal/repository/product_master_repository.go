@@ -0,0 +1,428 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrRevisionFlagResolved is returned when resolving a revision change flag
+// that is no longer open
+var ErrRevisionFlagResolved = errors.New("revision change flag is already resolved")
+
+// Statuses of quotes, orders and production orders a drawing revision
+// change still matters to
+var (
+	openQuoteStatuses           = []string{"draft", "pending_review", "under_review", "approved", "sent"}
+	openOrderStatuses           = []string{"pending", "confirmed", "in_production", "quality_check", "ready_to_ship"}
+	openProductionOrderStatuses = []string{"planned", "released", "in_progress"}
+)
+
+// ProductMasterRepository persists fastener specifications, customer part
+// numbers with their drawing revisions, and the flags a revision raises on
+// open quotes and orders
+type ProductMasterRepository interface {
+	// Specifications
+
+	GetSpecification(ctx context.Context, inventoryID uuid.UUID) (*models.FastenerSpecification, error)
+	SaveSpecification(ctx context.Context, spec *models.FastenerSpecification) error
+	// ListSpecifications lists specifications by standard and size,
+	// filtered on company_id, standards ([]string), size, grade, finish and
+	// search
+	ListSpecifications(ctx context.Context, params map[string]interface{}) ([]*models.FastenerSpecification, int64, error)
+
+	// Customer parts
+
+	CreatePart(ctx context.Context, part *models.CustomerPart) error
+	UpdatePart(ctx context.Context, part *models.CustomerPart) error
+	GetPart(ctx context.Context, id uuid.UUID) (*models.CustomerPart, error)
+	// FindPart finds a part by the number its customer knows it by
+	FindPart(ctx context.Context, companyID, customerID uuid.UUID, partNo string) (*models.CustomerPart, error)
+	// ListParts lists parts by customer part number, filtered on
+	// company_id, customer_id, inventory_id, active and search
+	ListParts(ctx context.Context, params map[string]interface{}) ([]*models.CustomerPart, int64, error)
+
+	// Drawings
+
+	// ReviseDrawing supersedes the current drawing of a part, stores the
+	// new revision as current and flags the open quote items, order items
+	// and production orders of the part made to another revision, in one
+	// transaction. Open flags of the documents before are superseded.
+	ReviseDrawing(ctx context.Context, part *models.CustomerPart, drawing *models.DrawingRevision) ([]*models.RevisionChangeFlag, error)
+	GetDrawing(ctx context.Context, id uuid.UUID) (*models.DrawingRevision, error)
+
+	// Revision change flags
+
+	GetFlag(ctx context.Context, id uuid.UUID) (*models.RevisionChangeFlag, error)
+	// ListFlags lists flags, latest first, filtered on company_id, status,
+	// customer_part_id and document_type
+	ListFlags(ctx context.Context, params map[string]interface{}) ([]*models.RevisionChangeFlag, int64, error)
+	// ResolveFlag saves a flag resolved as updated or accepted, failing
+	// with ErrRevisionFlagResolved unless it was open. An updated flag
+	// moves its document to the flag's revision.
+	ResolveFlag(ctx context.Context, flag *models.RevisionChangeFlag) error
+}
+
+type productMasterRepository struct {
+	db *gorm.DB
+}
+
+// NewProductMasterRepository creates a new product master repository
+func NewProductMasterRepository(db *gorm.DB) ProductMasterRepository {
+	return &productMasterRepository{db: db}
+}
+
+// Specifications
+
+func (r *productMasterRepository) GetSpecification(ctx context.Context, inventoryID uuid.UUID) (*models.FastenerSpecification, error) {
+	var spec models.FastenerSpecification
+	err := r.db.WithContext(ctx).Where("inventory_id = ?", inventoryID).First(&spec).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &spec, nil
+}
+
+func (r *productMasterRepository) SaveSpecification(ctx context.Context, spec *models.FastenerSpecification) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(spec).Error
+}
+
+func (r *productMasterRepository) ListSpecifications(ctx context.Context, params map[string]interface{}) ([]*models.FastenerSpecification, int64, error) {
+	var specs []*models.FastenerSpecification
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.FastenerSpecification{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if standards, ok := params["standards"].([]string); ok && len(standards) > 0 {
+		query = query.Where("standard IN ?", standards)
+	}
+	if size, ok := params["size"].(string); ok && size != "" {
+		query = query.Where("size = ?", size)
+	}
+	if grade, ok := params["grade"].(string); ok && grade != "" {
+		query = query.Where("grade = ?", grade)
+	}
+	if finish, ok := params["finish"].(string); ok && finish != "" {
+		query = query.Where("finish ILIKE ?", "%"+finish+"%")
+	}
+	if search, ok := params["search"].(string); ok && search != "" {
+		query = query.Where("description ILIKE ?", "%"+search+"%")
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := productMasterPage(params)
+	err := query.Preload("Inventory").
+		Order("standard, size, length").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&specs).Error
+	return specs, total, err
+}
+
+// Customer parts
+
+func (r *productMasterRepository) CreatePart(ctx context.Context, part *models.CustomerPart) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Create(part).Error
+}
+
+func (r *productMasterRepository) UpdatePart(ctx context.Context, part *models.CustomerPart) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(part).Error
+}
+
+func (r *productMasterRepository) GetPart(ctx context.Context, id uuid.UUID) (*models.CustomerPart, error) {
+	var part models.CustomerPart
+	err := r.db.WithContext(ctx).
+		Preload("Customer").
+		Preload("Inventory").
+		Preload("Specification").
+		Preload("Drawings", func(db *gorm.DB) *gorm.DB { return db.Order("uploaded_at DESC") }).
+		Where("id = ?", id).
+		First(&part).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &part, nil
+}
+
+func (r *productMasterRepository) FindPart(ctx context.Context, companyID, customerID uuid.UUID, partNo string) (*models.CustomerPart, error) {
+	var part models.CustomerPart
+	err := r.db.WithContext(ctx).
+		Preload("Inventory").
+		Preload("Specification").
+		Where("company_id = ? AND customer_id = ? AND customer_part_no = ?", companyID, customerID, partNo).
+		First(&part).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &part, nil
+}
+
+func (r *productMasterRepository) ListParts(ctx context.Context, params map[string]interface{}) ([]*models.CustomerPart, int64, error) {
+	var parts []*models.CustomerPart
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.CustomerPart{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if customerID, ok := params["customer_id"].(uuid.UUID); ok {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if inventoryID, ok := params["inventory_id"].(uuid.UUID); ok {
+		query = query.Where("inventory_id = ?", inventoryID)
+	}
+	if active, ok := params["active"].(bool); ok {
+		query = query.Where("is_active = ?", active)
+	}
+	if search, ok := params["search"].(string); ok && search != "" {
+		query = query.Where("customer_part_no ILIKE ? OR customer_part_name ILIKE ?", "%"+search+"%", "%"+search+"%")
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := productMasterPage(params)
+	err := query.Preload("Customer").
+		Preload("Inventory").
+		Preload("Specification").
+		Order("customer_part_no").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&parts).Error
+	return parts, total, err
+}
+
+// Drawings
+
+func (r *productMasterRepository) ReviseDrawing(ctx context.Context, part *models.CustomerPart, drawing *models.DrawingRevision) ([]*models.RevisionChangeFlag, error) {
+	var flags []*models.RevisionChangeFlag
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.DrawingRevision{}).
+			Where("customer_part_id = ? AND status = ?", part.ID, models.DrawingStatusCurrent).
+			Update("status", models.DrawingStatusSuperseded).Error; err != nil {
+			return err
+		}
+		drawing.Status = models.DrawingStatusCurrent
+		if err := tx.Create(drawing).Error; err != nil {
+			return err
+		}
+		part.CurrentRevision = drawing.Revision
+		part.CurrentDrawingID = &drawing.ID
+		if err := tx.Model(part).Updates(map[string]interface{}{
+			"current_revision":   part.CurrentRevision,
+			"current_drawing_id": part.CurrentDrawingID,
+		}).Error; err != nil {
+			return err
+		}
+
+		documents, err := openRevisionDocuments(tx, part, drawing.Revision)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, doc := range documents {
+			if err := tx.Model(&models.RevisionChangeFlag{}).
+				Where("document_type = ? AND document_id = ? AND status = ?", doc.Type, doc.ID, models.RevisionFlagOpen).
+				Updates(map[string]interface{}{
+					"status":      models.RevisionFlagSuperseded,
+					"resolved_at": now,
+				}).Error; err != nil {
+				return err
+			}
+			flag := &models.RevisionChangeFlag{
+				CompanyID:         part.CompanyID,
+				CustomerPartID:    part.ID,
+				DrawingRevisionID: drawing.ID,
+				DocumentType:      doc.Type,
+				DocumentID:        doc.ID,
+				DocumentNo:        doc.DocumentNo,
+				ParentID:          doc.ParentID,
+				DocumentRevision:  doc.DrawingRevision,
+				Revision:          drawing.Revision,
+				Status:            models.RevisionFlagOpen,
+				CreatedAt:         now,
+			}
+			if err := tx.Create(flag).Error; err != nil {
+				return err
+			}
+			flags = append(flags, flag)
+		}
+		return nil
+	})
+	return flags, err
+}
+
+func (r *productMasterRepository) GetDrawing(ctx context.Context, id uuid.UUID) (*models.DrawingRevision, error) {
+	var drawing models.DrawingRevision
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&drawing).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &drawing, nil
+}
+
+// revisionDocument is an open quote item, order item or production order
+// of a part
+type revisionDocument struct {
+	Type            string
+	ID              uuid.UUID
+	ParentID        *uuid.UUID
+	DocumentNo      string
+	DrawingRevision string
+}
+
+// openRevisionDocuments finds the open documents of a part made to another
+// revision than revision
+func openRevisionDocuments(tx *gorm.DB, part *models.CustomerPart, revision string) ([]revisionDocument, error) {
+	var quoteItems, orderItems, productionOrders []revisionDocument
+
+	if err := tx.Table("quote_items AS qi").
+		Select("qi.id, q.id AS parent_id, q.quote_no AS document_no, COALESCE(qi.drawing_revision, '') AS drawing_revision").
+		Joins("JOIN quote_versions qv ON qv.id = qi.quote_version_id AND qv.is_current").
+		Joins("JOIN quotes q ON q.id = qv.quote_id").
+		Where("qi.customer_part_id = ? AND q.company_id = ? AND q.status IN ?", part.ID, part.CompanyID, openQuoteStatuses).
+		Where("COALESCE(qi.drawing_revision, '') <> ?", revision).
+		Scan(&quoteItems).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Table("order_items AS oi").
+		Select("oi.id, o.id AS parent_id, o.order_no AS document_no, COALESCE(oi.drawing_revision, '') AS drawing_revision").
+		Joins("JOIN orders o ON o.id = oi.order_id").
+		Where("oi.customer_part_id = ? AND o.company_id = ? AND o.status IN ?", part.ID, part.CompanyID, openOrderStatuses).
+		Where("COALESCE(oi.drawing_revision, '') <> ?", revision).
+		Scan(&orderItems).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Table("production_orders").
+		Select("id, order_no AS document_no, COALESCE(drawing_revision, '') AS drawing_revision").
+		Where("customer_part_id = ? AND company_id = ? AND status IN ?", part.ID, part.CompanyID, openProductionOrderStatuses).
+		Where("COALESCE(drawing_revision, '') <> ?", revision).
+		Scan(&productionOrders).Error; err != nil {
+		return nil, err
+	}
+
+	documents := make([]revisionDocument, 0, len(quoteItems)+len(orderItems)+len(productionOrders))
+	for _, d := range quoteItems {
+		d.Type = models.RevisionDocumentQuoteItem
+		documents = append(documents, d)
+	}
+	for _, d := range orderItems {
+		d.Type = models.RevisionDocumentOrderItem
+		documents = append(documents, d)
+	}
+	for _, d := range productionOrders {
+		d.Type = models.RevisionDocumentProductionOrder
+		documents = append(documents, d)
+	}
+	return documents, nil
+}
+
+// Revision change flags
+
+func (r *productMasterRepository) GetFlag(ctx context.Context, id uuid.UUID) (*models.RevisionChangeFlag, error) {
+	var flag models.RevisionChangeFlag
+	if err := r.db.WithContext(ctx).Preload("CustomerPart").Where("id = ?", id).First(&flag).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &flag, nil
+}
+
+func (r *productMasterRepository) ListFlags(ctx context.Context, params map[string]interface{}) ([]*models.RevisionChangeFlag, int64, error) {
+	var flags []*models.RevisionChangeFlag
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.RevisionChangeFlag{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if partID, ok := params["customer_part_id"].(uuid.UUID); ok {
+		query = query.Where("customer_part_id = ?", partID)
+	}
+	if documentType, ok := params["document_type"].(string); ok && documentType != "" {
+		query = query.Where("document_type = ?", documentType)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := productMasterPage(params)
+	err := query.Preload("CustomerPart").
+		Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&flags).Error
+	return flags, total, err
+}
+
+func (r *productMasterRepository) ResolveFlag(ctx context.Context, flag *models.RevisionChangeFlag) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RevisionChangeFlag{}).
+			Where("id = ? AND status = ?", flag.ID, models.RevisionFlagOpen).
+			Updates(map[string]interface{}{
+				"status":      flag.Status,
+				"resolution":  flag.Resolution,
+				"resolved_by": flag.ResolvedBy,
+				"resolved_at": flag.ResolvedAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRevisionFlagResolved
+		}
+		if flag.Status != models.RevisionFlagUpdated {
+			return nil
+		}
+
+		table := map[string]string{
+			models.RevisionDocumentQuoteItem:       "quote_items",
+			models.RevisionDocumentOrderItem:       "order_items",
+			models.RevisionDocumentProductionOrder: "production_orders",
+		}[flag.DocumentType]
+		if table == "" {
+			return nil
+		}
+		return tx.Table(table).Where("id = ?", flag.DocumentID).Update("drawing_revision", flag.Revision).Error
+	})
+}
+
+func productMasterPage(params map[string]interface{}) (int, int) {
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+	return page, pageSize
+}
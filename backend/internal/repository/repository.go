@@ -4,6 +4,7 @@ import "gorm.io/gorm"
 
 // Repositories holds all repository instances
 type Repositories struct {
+	Transactor         Transactor
 	Account            AccountRepository
 	Company            CompanyRepository
 	Customer           CustomerRepository
@@ -20,16 +21,43 @@ type Repositories struct {
 	Quote              QuoteRepository
 	Order              OrderRepository
 	Inventory          InventoryRepository
+	Production         ProductionRepository
+	JobCost            JobCostRepository
+	CostCalibration    CostCalibrationRepository
+	Sampling           SamplingRepository
+	SPC                SPCRepository
+	NCR                NCRRepository
+	Certificate        CertificateRepository
+	PPAP               PPAPRepository
+	Supplier           SupplierRepository
+	Scorecard          ScorecardRepository
+	InvoiceMatch       InvoiceMatchRepository
+	Subcontract        SubcontractRepository
+	ProductMaster      ProductMasterRepository
+	Finance            FinanceRepository
+	Ledger             LedgerRepository
+	Credit             CreditRepository
+	Dunning            DunningRepository
+	CashForecast       CashForecastRepository
+	EInvoice           EInvoiceRepository
+	BankStatement      BankStatementRepository
 	Trade              TradeRepository
+	Screening          ScreeningRepository
+	Tracking           TrackingRepository
+	LoadPlan           LoadPlanRepository
 	Advanced           AdvancedRepository
 	Integration        IntegrationRepository
 	Report             ReportRepository
 	User               UserRepository
+	System             SystemRepository
+	Mobile             MobileRepository
+	JobRun             JobRunRepository
 }
 
 // NewRepositories creates new repository instances
 func NewRepositories(db *gorm.DB) *Repositories {
 	return &Repositories{
+		Transactor:         NewTransactor(db),
 		Account:            NewAccountRepositoryGorm(db),
 		Company:            NewCompanyRepository(db),
 		Customer:           NewCustomerRepository(db),
@@ -46,10 +74,36 @@ func NewRepositories(db *gorm.DB) *Repositories {
 		Quote:              NewQuoteRepository(db),
 		Order:              NewOrderRepository(db),
 		Inventory:          NewInventoryRepository(db),
+		Production:         NewProductionRepository(db),
+		JobCost:            NewJobCostRepository(db),
+		CostCalibration:    NewCostCalibrationRepository(db),
+		Sampling:           NewSamplingRepository(db),
+		SPC:                NewSPCRepository(db),
+		NCR:                NewNCRRepository(db),
+		Certificate:        NewCertificateRepository(db),
+		PPAP:               NewPPAPRepository(db),
+		Supplier:           NewSupplierRepository(db),
+		Scorecard:          NewScorecardRepository(db),
+		InvoiceMatch:       NewInvoiceMatchRepository(db),
+		Subcontract:        NewSubcontractRepository(db),
+		ProductMaster:      NewProductMasterRepository(db),
+		Finance:            NewFinanceRepository(db),
+		Ledger:             NewLedgerRepository(db),
+		Credit:             NewCreditRepository(db),
+		Dunning:            NewDunningRepository(db),
+		CashForecast:       NewCashForecastRepository(db),
+		EInvoice:           NewEInvoiceRepository(db),
+		BankStatement:      NewBankStatementRepository(db),
 		Trade:              NewTradeRepository(db),
+		Screening:          NewScreeningRepository(db),
+		Tracking:           NewTrackingRepository(db),
+		LoadPlan:           NewLoadPlanRepository(db),
 		Advanced:           NewAdvancedRepository(db),
 		Integration:        NewIntegrationRepository(db),
 		Report:             NewReportRepository(db),
 		User:               NewUserRepository(db),
+		System:             NewSystemRepository(db),
+		Mobile:             NewMobileRepository(db),
+		JobRun:             NewJobRunRepository(db),
 	}
 }
\ No newline at end of file
@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SamplingRepository persists sampling plans and the switching state of
+// the suppliers and products inspected under them
+type SamplingRepository interface {
+	// Plans
+	CreatePlan(ctx context.Context, plan *models.SamplingPlan) error
+	UpdatePlan(ctx context.Context, plan *models.SamplingPlan) error
+	GetPlan(ctx context.Context, id uuid.UUID) (*models.SamplingPlan, error)
+	ListPlans(ctx context.Context, params map[string]interface{}) ([]*models.SamplingPlan, int64, error)
+	FindPlan(ctx context.Context, companyID uuid.UUID, inspectionType string, supplierID, inventoryID *uuid.UUID) (*models.SamplingPlan, error)
+
+	// States
+	FindState(ctx context.Context, planID uuid.UUID, supplierID, inventoryID *uuid.UUID) (*models.SamplingState, error)
+	CreateState(ctx context.Context, state *models.SamplingState) error
+	GetState(ctx context.Context, id uuid.UUID) (*models.SamplingState, error)
+	ListStates(ctx context.Context, params map[string]interface{}) ([]*models.SamplingState, int64, error)
+	SaveState(ctx context.Context, state *models.SamplingState, change *models.SamplingSwitch) error
+
+	// RecordDecision stores the decided inspection together with the
+	// switching state it moved
+	RecordDecision(ctx context.Context, inspection *models.QualityInspection, state *models.SamplingState, change *models.SamplingSwitch) error
+}
+
+type samplingRepository struct {
+	db *gorm.DB
+}
+
+// NewSamplingRepository creates a new sampling repository
+func NewSamplingRepository(db *gorm.DB) SamplingRepository {
+	return &samplingRepository{db: db}
+}
+
+// Plans
+
+func (r *samplingRepository) CreatePlan(ctx context.Context, plan *models.SamplingPlan) error {
+	return r.db.WithContext(ctx).Create(plan).Error
+}
+
+func (r *samplingRepository) UpdatePlan(ctx context.Context, plan *models.SamplingPlan) error {
+	return r.db.WithContext(ctx).Save(plan).Error
+}
+
+func (r *samplingRepository) GetPlan(ctx context.Context, id uuid.UUID) (*models.SamplingPlan, error) {
+	var plan models.SamplingPlan
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&plan).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// ListPlans lists sampling plans by name, filtered on company_id,
+// inspection_type, supplier_id, inventory_id and is_active
+func (r *samplingRepository) ListPlans(ctx context.Context, params map[string]interface{}) ([]*models.SamplingPlan, int64, error) {
+	var plans []*models.SamplingPlan
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.SamplingPlan{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if inspectionType, ok := params["inspection_type"].(string); ok && inspectionType != "" {
+		query = query.Where("inspection_type = ?", inspectionType)
+	}
+	if supplierID, ok := params["supplier_id"].(uuid.UUID); ok {
+		query = query.Where("supplier_id = ?", supplierID)
+	}
+	if inventoryID, ok := params["inventory_id"].(uuid.UUID); ok {
+		query = query.Where("inventory_id = ?", inventoryID)
+	}
+	if isActive, ok := params["is_active"].(bool); ok {
+		query = query.Where("is_active = ?", isActive)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := samplingPage(params)
+	err := query.Order("name").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&plans).Error
+	return plans, total, err
+}
+
+// FindPlan returns the most specific active plan for an inspection: one for
+// the product beats one for the supplier, which beats one for the
+// inspection type only
+func (r *samplingRepository) FindPlan(ctx context.Context, companyID uuid.UUID, inspectionType string, supplierID, inventoryID *uuid.UUID) (*models.SamplingPlan, error) {
+	query := r.db.WithContext(ctx).
+		Where("company_id = ? AND is_active = ?", companyID, true).
+		Where("inspection_type = '' OR inspection_type IS NULL OR inspection_type = ?", inspectionType)
+	if supplierID != nil {
+		query = query.Where("supplier_id IS NULL OR supplier_id = ?", *supplierID)
+	} else {
+		query = query.Where("supplier_id IS NULL")
+	}
+	if inventoryID != nil {
+		query = query.Where("inventory_id IS NULL OR inventory_id = ?", *inventoryID)
+	} else {
+		query = query.Where("inventory_id IS NULL")
+	}
+
+	var plan models.SamplingPlan
+	err := query.
+		Order("CASE WHEN inventory_id IS NULL THEN 0 ELSE 2 END + CASE WHEN supplier_id IS NULL THEN 0 ELSE 1 END DESC").
+		Order("CASE WHEN inspection_type = '' OR inspection_type IS NULL THEN 0 ELSE 1 END DESC").
+		Order("created_at DESC").
+		First(&plan).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// States
+
+// FindState returns the switching state of a plan for a supplier and
+// product; a nil id matches a state without one
+func (r *samplingRepository) FindState(ctx context.Context, planID uuid.UUID, supplierID, inventoryID *uuid.UUID) (*models.SamplingState, error) {
+	query := r.db.WithContext(ctx).Where("plan_id = ?", planID)
+	if supplierID != nil {
+		query = query.Where("supplier_id = ?", *supplierID)
+	} else {
+		query = query.Where("supplier_id IS NULL")
+	}
+	if inventoryID != nil {
+		query = query.Where("inventory_id = ?", *inventoryID)
+	} else {
+		query = query.Where("inventory_id IS NULL")
+	}
+
+	var state models.SamplingState
+	if err := query.First(&state).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (r *samplingRepository) CreateState(ctx context.Context, state *models.SamplingState) error {
+	return r.db.WithContext(ctx).Create(state).Error
+}
+
+// GetState returns a switching state with its plan and switches, latest
+// first
+func (r *samplingRepository) GetState(ctx context.Context, id uuid.UUID) (*models.SamplingState, error) {
+	var state models.SamplingState
+	err := r.db.WithContext(ctx).
+		Preload("Plan").
+		Preload("Switches", func(db *gorm.DB) *gorm.DB { return db.Order("created_at DESC") }).
+		Where("id = ?", id).
+		First(&state).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &state, nil
+}
+
+// ListStates lists switching states, most recently changed first, filtered
+// on company_id, plan_id, supplier_id, inventory_id and severity
+func (r *samplingRepository) ListStates(ctx context.Context, params map[string]interface{}) ([]*models.SamplingState, int64, error) {
+	var states []*models.SamplingState
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.SamplingState{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if planID, ok := params["plan_id"].(uuid.UUID); ok {
+		query = query.Where("plan_id = ?", planID)
+	}
+	if supplierID, ok := params["supplier_id"].(uuid.UUID); ok {
+		query = query.Where("supplier_id = ?", supplierID)
+	}
+	if inventoryID, ok := params["inventory_id"].(uuid.UUID); ok {
+		query = query.Where("inventory_id = ?", inventoryID)
+	}
+	if severity, ok := params["severity"].(string); ok && severity != "" {
+		query = query.Where("severity = ?", severity)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := samplingPage(params)
+	err := query.Preload("Plan").
+		Order("updated_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&states).Error
+	return states, total, err
+}
+
+// SaveState stores a switching state and, when the severity changed, the
+// switch
+func (r *samplingRepository) SaveState(ctx context.Context, state *models.SamplingState, change *models.SamplingSwitch) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Plan", "Switches").Save(state).Error; err != nil {
+			return err
+		}
+		if change != nil {
+			return tx.Create(change).Error
+		}
+		return nil
+	})
+}
+
+func (r *samplingRepository) RecordDecision(ctx context.Context, inspection *models.QualityInspection, state *models.SamplingState, change *models.SamplingSwitch) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(inspection).Error; err != nil {
+			return err
+		}
+		if err := tx.Omit("Plan", "Switches").Save(state).Error; err != nil {
+			return err
+		}
+		if change != nil {
+			return tx.Create(change).Error
+		}
+		return nil
+	})
+}
+
+func samplingPage(params map[string]interface{}) (int, int) {
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+	return page, pageSize
+}
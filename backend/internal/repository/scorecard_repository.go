@@ -0,0 +1,258 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ScorecardRepository persists supplier scorecards and their configuration
+// and reads the purchasing and inspection records they are computed from
+type ScorecardRepository interface {
+	GetConfig(ctx context.Context, companyID uuid.UUID) (*models.SupplierScorecardConfig, error)
+	SaveConfig(ctx context.Context, config *models.SupplierScorecardConfig) error
+
+	// Metrics
+
+	// ListCompanyIDs returns the companies with active suppliers
+	ListCompanyIDs(ctx context.Context) ([]uuid.UUID, error)
+	ListActiveSuppliers(ctx context.Context, companyID uuid.UUID) ([]*models.Supplier, error)
+	GetSupplier(ctx context.Context, id uuid.UUID) (*models.Supplier, error)
+	// ListReceipts returns the receipts of a supplier in [from, to) with
+	// their purchase orders
+	ListReceipts(ctx context.Context, companyID, supplierID uuid.UUID, from, to time.Time) ([]*models.PurchaseOrderReceipt, error)
+	// ListIncomingInspections returns the completed incoming inspections of
+	// a supplier's lots in [from, to)
+	ListIncomingInspections(ctx context.Context, companyID, supplierID uuid.UUID, from, to time.Time) ([]*models.QualityInspection, error)
+	// ListOrderItems returns the items of a supplier's orders dated in
+	// [from, to) with their orders and supplier products, leaving out
+	// drafts and cancelled orders
+	ListOrderItems(ctx context.Context, companyID, supplierID uuid.UUID, from, to time.Time) ([]*models.PurchaseOrderItem, error)
+	// ListSentOrders returns a supplier's orders sent in [from, to)
+	ListSentOrders(ctx context.Context, companyID, supplierID uuid.UUID, from, to time.Time) ([]*models.PurchaseOrder, error)
+
+	// Scorecards
+
+	SaveScorecard(ctx context.Context, scorecard *models.SupplierScorecard) error
+	FindScorecard(ctx context.Context, companyID, supplierID uuid.UUID, periodStart time.Time) (*models.SupplierScorecard, error)
+	GetScorecard(ctx context.Context, id uuid.UUID) (*models.SupplierScorecard, error)
+	ListScorecards(ctx context.Context, params map[string]interface{}) ([]*models.SupplierScorecard, int64, error)
+	// ListSupplierScorecards returns the scorecards of a supplier from a
+	// period on, oldest first
+	ListSupplierScorecards(ctx context.Context, companyID, supplierID uuid.UUID, from time.Time) ([]*models.SupplierScorecard, error)
+	// LatestPeriod returns the start of the latest period scored for a
+	// supplier, zero if none
+	LatestPeriod(ctx context.Context, supplierID uuid.UUID) (time.Time, error)
+	// UpdateSupplierRating sets the ratings and risk of a supplier
+	UpdateSupplierRating(ctx context.Context, supplierID uuid.UUID, values map[string]interface{}) error
+}
+
+type scorecardRepository struct {
+	db *gorm.DB
+}
+
+// NewScorecardRepository creates a new scorecard repository
+func NewScorecardRepository(db *gorm.DB) ScorecardRepository {
+	return &scorecardRepository{db: db}
+}
+
+func (r *scorecardRepository) GetConfig(ctx context.Context, companyID uuid.UUID) (*models.SupplierScorecardConfig, error) {
+	var config models.SupplierScorecardConfig
+	err := r.db.WithContext(ctx).Where("company_id = ?", companyID).First(&config).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (r *scorecardRepository) SaveConfig(ctx context.Context, config *models.SupplierScorecardConfig) error {
+	return r.db.WithContext(ctx).Save(config).Error
+}
+
+// Metrics
+
+func (r *scorecardRepository) ListCompanyIDs(ctx context.Context) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).Model(&models.Supplier{}).
+		Distinct("company_id").
+		Where("status = ?", "active").
+		Pluck("company_id", &ids).Error
+	return ids, err
+}
+
+func (r *scorecardRepository) ListActiveSuppliers(ctx context.Context, companyID uuid.UUID) ([]*models.Supplier, error) {
+	var suppliers []*models.Supplier
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND status = ?", companyID, "active").
+		Order("supplier_no").
+		Find(&suppliers).Error
+	return suppliers, err
+}
+
+func (r *scorecardRepository) GetSupplier(ctx context.Context, id uuid.UUID) (*models.Supplier, error) {
+	var supplier models.Supplier
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&supplier).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &supplier, nil
+}
+
+func (r *scorecardRepository) ListReceipts(ctx context.Context, companyID, supplierID uuid.UUID, from, to time.Time) ([]*models.PurchaseOrderReceipt, error) {
+	var receipts []*models.PurchaseOrderReceipt
+	err := r.db.WithContext(ctx).
+		Preload("PurchaseOrder").
+		Where("company_id = ? AND supplier_id = ?", companyID, supplierID).
+		Where("received_at >= ? AND received_at < ?", from, to).
+		Order("received_at").
+		Find(&receipts).Error
+	return receipts, err
+}
+
+func (r *scorecardRepository) ListIncomingInspections(ctx context.Context, companyID, supplierID uuid.UUID, from, to time.Time) ([]*models.QualityInspection, error) {
+	var inspections []*models.QualityInspection
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND supplier_id = ? AND type = ?", companyID, supplierID, "incoming").
+		Where("status IN ?", []string{"passed", "failed"}).
+		Where("inspected_at >= ? AND inspected_at < ?", from, to).
+		Order("inspected_at").
+		Find(&inspections).Error
+	return inspections, err
+}
+
+func (r *scorecardRepository) ListOrderItems(ctx context.Context, companyID, supplierID uuid.UUID, from, to time.Time) ([]*models.PurchaseOrderItem, error) {
+	var items []*models.PurchaseOrderItem
+	err := r.db.WithContext(ctx).
+		Preload("PurchaseOrder").
+		Preload("SupplierProduct").
+		Joins("JOIN purchase_orders ON purchase_orders.id = purchase_order_items.purchase_order_id").
+		Where("purchase_orders.company_id = ? AND purchase_orders.supplier_id = ?", companyID, supplierID).
+		Where("purchase_orders.status NOT IN ?", []string{"draft", "cancelled"}).
+		Where("purchase_orders.order_date >= ? AND purchase_orders.order_date < ?", from, to).
+		Where("purchase_order_items.status <> ?", "cancelled").
+		Find(&items).Error
+	return items, err
+}
+
+func (r *scorecardRepository) ListSentOrders(ctx context.Context, companyID, supplierID uuid.UUID, from, to time.Time) ([]*models.PurchaseOrder, error) {
+	var orders []*models.PurchaseOrder
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND supplier_id = ? AND status <> ?", companyID, supplierID, "cancelled").
+		Where("approved_at >= ? AND approved_at < ?", from, to).
+		Order("approved_at").
+		Find(&orders).Error
+	return orders, err
+}
+
+// Scorecards
+
+func (r *scorecardRepository) SaveScorecard(ctx context.Context, scorecard *models.SupplierScorecard) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(scorecard).Error
+}
+
+func (r *scorecardRepository) FindScorecard(ctx context.Context, companyID, supplierID uuid.UUID, periodStart time.Time) (*models.SupplierScorecard, error) {
+	var scorecard models.SupplierScorecard
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND supplier_id = ? AND period_start = ?", companyID, supplierID, periodStart).
+		First(&scorecard).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &scorecard, nil
+}
+
+func (r *scorecardRepository) GetScorecard(ctx context.Context, id uuid.UUID) (*models.SupplierScorecard, error) {
+	var scorecard models.SupplierScorecard
+	err := r.db.WithContext(ctx).Preload("Supplier").Where("id = ?", id).First(&scorecard).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &scorecard, nil
+}
+
+// ListScorecards lists scorecards, latest period first, filtered on
+// company_id, supplier_id, period_start and risk_level
+func (r *scorecardRepository) ListScorecards(ctx context.Context, params map[string]interface{}) ([]*models.SupplierScorecard, int64, error) {
+	var scorecards []*models.SupplierScorecard
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.SupplierScorecard{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if supplierID, ok := params["supplier_id"].(uuid.UUID); ok {
+		query = query.Where("supplier_id = ?", supplierID)
+	}
+	if period, ok := params["period_start"].(time.Time); ok {
+		query = query.Where("period_start = ?", period)
+	}
+	if riskLevel, ok := params["risk_level"].(string); ok && riskLevel != "" {
+		query = query.Where("risk_level = ?", riskLevel)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := scorecardPage(params)
+	err := query.Preload("Supplier").
+		Order("period_start DESC, overall_score ASC NULLS LAST").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&scorecards).Error
+	return scorecards, total, err
+}
+
+func (r *scorecardRepository) ListSupplierScorecards(ctx context.Context, companyID, supplierID uuid.UUID, from time.Time) ([]*models.SupplierScorecard, error) {
+	var scorecards []*models.SupplierScorecard
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND supplier_id = ? AND period_start >= ?", companyID, supplierID, from).
+		Order("period_start").
+		Find(&scorecards).Error
+	return scorecards, err
+}
+
+func (r *scorecardRepository) LatestPeriod(ctx context.Context, supplierID uuid.UUID) (time.Time, error) {
+	var scorecard models.SupplierScorecard
+	err := r.db.WithContext(ctx).
+		Select("period_start").
+		Where("supplier_id = ?", supplierID).
+		Order("period_start DESC").
+		First(&scorecard).Error
+	if err == gorm.ErrRecordNotFound {
+		return time.Time{}, nil
+	}
+	return scorecard.PeriodStart, err
+}
+
+func (r *scorecardRepository) UpdateSupplierRating(ctx context.Context, supplierID uuid.UUID, values map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&models.Supplier{}).Where("id = ?", supplierID).Updates(values).Error
+}
+
+func scorecardPage(params map[string]interface{}) (int, int) {
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+	return page, pageSize
+}
@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ScreeningRepository persists sanctions lists, screening policies and hits
+type ScreeningRepository interface {
+	// Sanctions lists
+	GetSanctionsList(ctx context.Context, source string) (*models.SanctionsList, error)
+	ListSanctionsLists(ctx context.Context) ([]*models.SanctionsList, error)
+	ReplaceSanctionsList(ctx context.Context, list *models.SanctionsList, entries []*models.SanctionsEntry) error
+	ListSanctionsEntries(ctx context.Context) ([]*models.SanctionsEntry, error)
+
+	// Policies
+	GetScreeningPolicy(ctx context.Context, companyID uuid.UUID) (*models.ScreeningPolicy, error)
+	SaveScreeningPolicy(ctx context.Context, policy *models.ScreeningPolicy) error
+
+	// Hits
+	CreateScreeningHit(ctx context.Context, hit *models.ScreeningHit) error
+	GetScreeningHit(ctx context.Context, companyID, id uuid.UUID) (*models.ScreeningHit, error)
+	UpdateScreeningHit(ctx context.Context, hit *models.ScreeningHit) error
+	ListScreeningHits(ctx context.Context, params map[string]interface{}) ([]*models.ScreeningHit, int64, error)
+	FindScreeningHit(ctx context.Context, partyType string, partyID uuid.UUID, listSource, externalID string) (*models.ScreeningHit, error)
+	CountBlockingHits(ctx context.Context, partyType string, partyID uuid.UUID) (int64, error)
+
+	// Partners
+	GetCustomer(ctx context.Context, id uuid.UUID) (*models.Customer, error)
+	GetSupplier(ctx context.Context, id uuid.UUID) (*models.Supplier, error)
+	ListCustomers(ctx context.Context, companyID uuid.UUID) ([]*models.Customer, error)
+	ListSuppliers(ctx context.Context, companyID uuid.UUID) ([]*models.Supplier, error)
+}
+
+type screeningRepository struct {
+	db *gorm.DB
+}
+
+// NewScreeningRepository creates a new screening repository
+func NewScreeningRepository(db *gorm.DB) ScreeningRepository {
+	return &screeningRepository{db: db}
+}
+
+// Sanctions lists
+
+func (r *screeningRepository) GetSanctionsList(ctx context.Context, source string) (*models.SanctionsList, error) {
+	var list models.SanctionsList
+	err := r.db.WithContext(ctx).Where("source = ?", source).First(&list).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (r *screeningRepository) ListSanctionsLists(ctx context.Context) ([]*models.SanctionsList, error) {
+	var lists []*models.SanctionsList
+	err := r.db.WithContext(ctx).Order("source").Find(&lists).Error
+	return lists, err
+}
+
+// ReplaceSanctionsList swaps all entries of a list source in one transaction
+func (r *screeningRepository) ReplaceSanctionsList(ctx context.Context, list *models.SanctionsList, entries []*models.SanctionsEntry) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing models.SanctionsList
+		err := tx.Where("source = ?", list.Source).First(&existing).Error
+		switch {
+		case err == nil:
+			list.ID = existing.ID
+			list.CreatedAt = existing.CreatedAt
+		case err != gorm.ErrRecordNotFound:
+			return err
+		}
+		if err := tx.Save(list).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("source = ?", list.Source).Delete(&models.SanctionsEntry{}).Error; err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			entry.ListID = list.ID
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(entries, 500).Error
+	})
+}
+
+func (r *screeningRepository) ListSanctionsEntries(ctx context.Context) ([]*models.SanctionsEntry, error) {
+	var entries []*models.SanctionsEntry
+	err := r.db.WithContext(ctx).Order("source, external_id").Find(&entries).Error
+	return entries, err
+}
+
+// Policies
+
+func (r *screeningRepository) GetScreeningPolicy(ctx context.Context, companyID uuid.UUID) (*models.ScreeningPolicy, error) {
+	var policy models.ScreeningPolicy
+	err := r.db.WithContext(ctx).Where("company_id = ?", companyID).First(&policy).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *screeningRepository) SaveScreeningPolicy(ctx context.Context, policy *models.ScreeningPolicy) error {
+	return r.db.WithContext(ctx).Save(policy).Error
+}
+
+// Hits
+
+func (r *screeningRepository) CreateScreeningHit(ctx context.Context, hit *models.ScreeningHit) error {
+	return r.db.WithContext(ctx).Create(hit).Error
+}
+
+func (r *screeningRepository) GetScreeningHit(ctx context.Context, companyID, id uuid.UUID) (*models.ScreeningHit, error) {
+	var hit models.ScreeningHit
+	err := r.db.WithContext(ctx).Where("id = ? AND company_id = ?", id, companyID).First(&hit).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &hit, nil
+}
+
+func (r *screeningRepository) UpdateScreeningHit(ctx context.Context, hit *models.ScreeningHit) error {
+	return r.db.WithContext(ctx).Omit("Company", "Reviewer").Save(hit).Error
+}
+
+func (r *screeningRepository) ListScreeningHits(ctx context.Context, params map[string]interface{}) ([]*models.ScreeningHit, int64, error) {
+	var hits []*models.ScreeningHit
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.ScreeningHit{})
+
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if partyType, ok := params["party_type"].(string); ok && partyType != "" {
+		query = query.Where("party_type = ?", partyType)
+	}
+	if partyID, ok := params["party_id"].(uuid.UUID); ok {
+		query = query.Where("party_id = ?", partyID)
+	}
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if source, ok := params["list_source"].(string); ok && source != "" {
+		query = query.Where("list_source = ?", source)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if page, ok := params["page"].(int); ok && page > 0 {
+		if pageSize, ok := params["page_size"].(int); ok && pageSize > 0 {
+			query = query.Offset((page - 1) * pageSize).Limit(pageSize)
+		}
+	}
+
+	err := query.Preload("Reviewer").Order("score DESC, created_at DESC").Find(&hits).Error
+	return hits, total, err
+}
+
+func (r *screeningRepository) FindScreeningHit(ctx context.Context, partyType string, partyID uuid.UUID, listSource, externalID string) (*models.ScreeningHit, error) {
+	var hit models.ScreeningHit
+	err := r.db.WithContext(ctx).
+		Where("party_type = ? AND party_id = ? AND list_source = ? AND entry_external_id = ?", partyType, partyID, listSource, externalID).
+		Order("created_at DESC").
+		First(&hit).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &hit, nil
+}
+
+// CountBlockingHits counts hits that are still open or were confirmed as true matches
+func (r *screeningRepository) CountBlockingHits(ctx context.Context, partyType string, partyID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.ScreeningHit{}).
+		Where("party_type = ? AND party_id = ? AND status IN ?", partyType, partyID, []string{"open", "confirmed"}).
+		Count(&count).Error
+	return count, err
+}
+
+// Partners
+
+func (r *screeningRepository) GetCustomer(ctx context.Context, id uuid.UUID) (*models.Customer, error) {
+	var customer models.Customer
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&customer).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &customer, nil
+}
+
+func (r *screeningRepository) GetSupplier(ctx context.Context, id uuid.UUID) (*models.Supplier, error) {
+	var supplier models.Supplier
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&supplier).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &supplier, nil
+}
+
+// ListCustomers returns the customers of a company, or of all companies when companyID is uuid.Nil
+func (r *screeningRepository) ListCustomers(ctx context.Context, companyID uuid.UUID) ([]*models.Customer, error) {
+	var customers []*models.Customer
+	query := r.db.WithContext(ctx)
+	if companyID != uuid.Nil {
+		query = query.Where("company_id = ?", companyID)
+	}
+	err := query.Find(&customers).Error
+	return customers, err
+}
+
+// ListSuppliers returns the suppliers of a company, or of all companies when companyID is uuid.Nil
+func (r *screeningRepository) ListSuppliers(ctx context.Context, companyID uuid.UUID) ([]*models.Supplier, error) {
+	var suppliers []*models.Supplier
+	query := r.db.WithContext(ctx)
+	if companyID != uuid.Nil {
+		query = query.Where("company_id = ?", companyID)
+	}
+	err := query.Find(&suppliers).Error
+	return suppliers, err
+}
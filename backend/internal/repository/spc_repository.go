@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SPCRepository persists quality characteristics, their measurements and
+// the out-of-control alerts raised on them
+type SPCRepository interface {
+	// Characteristics
+	CreateCharacteristic(ctx context.Context, characteristic *models.QualityCharacteristic) error
+	UpdateCharacteristic(ctx context.Context, characteristic *models.QualityCharacteristic) error
+	GetCharacteristic(ctx context.Context, id uuid.UUID) (*models.QualityCharacteristic, error)
+	ListCharacteristics(ctx context.Context, params map[string]interface{}) ([]*models.QualityCharacteristic, int64, error)
+
+	// Measurements
+
+	// AddMeasurements numbers the measurements' subgroups after the last
+	// one of the characteristic, keeping the relative numbering given, and
+	// stores them
+	AddMeasurements(ctx context.Context, characteristicID uuid.UUID, measurements []*models.CharacteristicMeasurement) error
+	ListMeasurements(ctx context.Context, characteristicID uuid.UUID, params map[string]interface{}) ([]*models.CharacteristicMeasurement, error)
+
+	// Alerts
+
+	// CreateAlerts stores the alerts not raised before and returns those
+	CreateAlerts(ctx context.Context, alerts []*models.SPCAlert) ([]*models.SPCAlert, error)
+	SetAlertNotification(ctx context.Context, alertID, notificationID uuid.UUID) error
+	ListAlerts(ctx context.Context, params map[string]interface{}) ([]*models.SPCAlert, int64, error)
+}
+
+type spcRepository struct {
+	db *gorm.DB
+}
+
+// NewSPCRepository creates a new SPC repository
+func NewSPCRepository(db *gorm.DB) SPCRepository {
+	return &spcRepository{db: db}
+}
+
+// Characteristics
+
+func (r *spcRepository) CreateCharacteristic(ctx context.Context, characteristic *models.QualityCharacteristic) error {
+	return r.db.WithContext(ctx).Create(characteristic).Error
+}
+
+func (r *spcRepository) UpdateCharacteristic(ctx context.Context, characteristic *models.QualityCharacteristic) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(characteristic).Error
+}
+
+func (r *spcRepository) GetCharacteristic(ctx context.Context, id uuid.UUID) (*models.QualityCharacteristic, error) {
+	var characteristic models.QualityCharacteristic
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&characteristic).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &characteristic, nil
+}
+
+// ListCharacteristics lists characteristics by product and code, filtered
+// on company_id, inventory_id, type and is_active
+func (r *spcRepository) ListCharacteristics(ctx context.Context, params map[string]interface{}) ([]*models.QualityCharacteristic, int64, error) {
+	var characteristics []*models.QualityCharacteristic
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.QualityCharacteristic{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if inventoryID, ok := params["inventory_id"].(uuid.UUID); ok {
+		query = query.Where("inventory_id = ?", inventoryID)
+	}
+	if characteristicType, ok := params["type"].(string); ok && characteristicType != "" {
+		query = query.Where("type = ?", characteristicType)
+	}
+	if isActive, ok := params["is_active"].(bool); ok {
+		query = query.Where("is_active = ?", isActive)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := spcPage(params)
+	err := query.Order("inventory_id, code, name").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&characteristics).Error
+	return characteristics, total, err
+}
+
+// Measurements
+
+func (r *spcRepository) AddMeasurements(ctx context.Context, characteristicID uuid.UUID, measurements []*models.CharacteristicMeasurement) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Serialize the numbering of concurrent captures
+		var characteristic models.QualityCharacteristic
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", characteristicID).
+			First(&characteristic).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		var last int
+		if err := tx.Model(&models.CharacteristicMeasurement{}).
+			Where("characteristic_id = ?", characteristicID).
+			Select("COALESCE(MAX(subgroup), 0)").
+			Scan(&last).Error; err != nil {
+			return err
+		}
+		for _, m := range measurements {
+			m.CharacteristicID = characteristicID
+			m.Subgroup += last
+		}
+		return tx.Create(measurements).Error
+	})
+}
+
+// ListMeasurements lists the measurements of a characteristic by subgroup,
+// filtered on inspection_id, production_order_id, from and to (measured_at)
+// and limited to the last "subgroups" subgroups
+func (r *spcRepository) ListMeasurements(ctx context.Context, characteristicID uuid.UUID, params map[string]interface{}) ([]*models.CharacteristicMeasurement, error) {
+	var measurements []*models.CharacteristicMeasurement
+
+	query := r.db.WithContext(ctx).Where("characteristic_id = ?", characteristicID)
+	if inspectionID, ok := params["inspection_id"].(uuid.UUID); ok {
+		query = query.Where("inspection_id = ?", inspectionID)
+	}
+	if orderID, ok := params["production_order_id"].(uuid.UUID); ok {
+		query = query.Where("production_order_id = ?", orderID)
+	}
+	if from, ok := params["from"].(time.Time); ok {
+		query = query.Where("measured_at >= ?", from)
+	}
+	if to, ok := params["to"].(time.Time); ok {
+		query = query.Where("measured_at < ?", to)
+	}
+	if subgroups, ok := params["subgroups"].(int); ok && subgroups > 0 {
+		// Subgroups are numbered without gaps, so the last n start after
+		// the largest number less n
+		last := r.db.WithContext(ctx).Model(&models.CharacteristicMeasurement{}).
+			Where("characteristic_id = ?", characteristicID).
+			Select("COALESCE(MAX(subgroup), 0) - ?", subgroups)
+		if to, ok := params["to"].(time.Time); ok {
+			last = last.Where("measured_at < ?", to)
+		}
+		query = query.Where("subgroup > (?)", last)
+	}
+
+	err := query.Order("subgroup, sequence").Find(&measurements).Error
+	return measurements, err
+}
+
+// Alerts
+
+func (r *spcRepository) CreateAlerts(ctx context.Context, alerts []*models.SPCAlert) ([]*models.SPCAlert, error) {
+	var created []*models.SPCAlert
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, alert := range alerts {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(alert)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				created = append(created, alert)
+			}
+		}
+		return nil
+	})
+	return created, err
+}
+
+func (r *spcRepository) SetAlertNotification(ctx context.Context, alertID, notificationID uuid.UUID) error {
+	return r.db.WithContext(ctx).Model(&models.SPCAlert{}).
+		Where("id = ?", alertID).
+		Update("notification_id", notificationID).Error
+}
+
+// ListAlerts lists alerts, latest first, filtered on company_id,
+// characteristic_id and rule
+func (r *spcRepository) ListAlerts(ctx context.Context, params map[string]interface{}) ([]*models.SPCAlert, int64, error) {
+	var alerts []*models.SPCAlert
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.SPCAlert{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if characteristicID, ok := params["characteristic_id"].(uuid.UUID); ok {
+		query = query.Where("characteristic_id = ?", characteristicID)
+	}
+	if rule, ok := params["rule"].(int); ok && rule > 0 {
+		query = query.Where("rule = ?", rule)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := spcPage(params)
+	err := query.Preload("Characteristic").
+		Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&alerts).Error
+	return alerts, total, err
+}
+
+func spcPage(params map[string]interface{}) (int, int) {
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+	return page, pageSize
+}
@@ -168,6 +168,7 @@ func (r *orderRepositoryGorm) UpdateShipment(shipment *models.Shipment) error {
 // Inventory Repository
 type inventoryRepositoryGorm struct{ db *gorm.DB }
 func NewInventoryRepositoryGorm(db *gorm.DB) InventoryRepository { return &inventoryRepositoryGorm{db: db} }
+func (r *inventoryRepositoryGorm) WithContext(ctx context.Context) InventoryRepository { return r }
 func (r *inventoryRepositoryGorm) CreateMaterial(material *models.Material) error { return ErrNotImplemented }
 func (r *inventoryRepositoryGorm) GetMaterialByID(id uuid.UUID) (*models.Material, error) { return nil, ErrNotImplemented }
 func (r *inventoryRepositoryGorm) UpdateMaterial(material *models.Material) error { return ErrNotImplemented }
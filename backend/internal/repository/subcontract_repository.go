@@ -0,0 +1,406 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInsufficientStock is returned when shipping more material to a
+	// subcontractor than is available
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrStaleSubcontractOrder is returned when a subcontract order changed
+	// between reading and saving it
+	ErrStaleSubcontractOrder = errors.New("subcontract order was changed concurrently")
+)
+
+// VendorStock is our material at a subcontractor
+type VendorStock struct {
+	SupplierID  uuid.UUID `json:"supplier_id"`
+	InventoryID uuid.UUID `json:"inventory_id"`
+	SKU         string    `json:"sku"`
+	Name        string    `json:"name"`
+	Quantity    float64   `json:"quantity"`
+	Orders      int       `json:"orders"`
+}
+
+// SubcontractRepository persists subcontract orders and moves the stock
+// they ship out and receive back
+type SubcontractRepository interface {
+	// Master data
+	GetRouteOperation(ctx context.Context, id uuid.UUID) (*models.RouteOperation, error)
+	GetProductionOrder(ctx context.Context, id uuid.UUID) (*models.ProductionOrder, error)
+	GetInventory(ctx context.Context, id uuid.UUID) (*models.Inventory, error)
+	GetSupplier(ctx context.Context, id uuid.UUID) (*models.Supplier, error)
+	// FindVendorWarehouse returns the location of a subcontractor
+	FindVendorWarehouse(ctx context.Context, companyID, supplierID uuid.UUID) (*models.Warehouse, error)
+	CreateWarehouse(ctx context.Context, warehouse *models.Warehouse) error
+
+	// Orders
+
+	// CreateOrder creates a subcontract order with the purchase order for
+	// its processing fee
+	CreateOrder(ctx context.Context, order *models.SubcontractOrder, purchaseOrder *models.PurchaseOrder) error
+	GetOrder(ctx context.Context, id uuid.UUID) (*models.SubcontractOrder, error)
+	ListOrders(ctx context.Context, params map[string]interface{}) ([]*models.SubcontractOrder, int64, error)
+	// CancelOrder saves a cancelled order, unless its balance changed since
+	// previousAtVendor was read, and cancels its fee purchase order
+	CancelOrder(ctx context.Context, order *models.SubcontractOrder, previousAtVendor float64) error
+	// Ship moves material out of stock to the subcontractor and saves the
+	// order, failing with ErrInsufficientStock when not enough is
+	// available. A draft purchase order is marked sent.
+	Ship(ctx context.Context, order *models.SubcontractOrder, previousAtVendor float64, shipment *models.SubcontractShipment, movement *models.StockMovement) error
+	// Receive takes the processed goods into stock, consumes the material
+	// at the subcontractor, receives the fee on the purchase order and
+	// saves the order. movement is nil when nothing good came back.
+	Receive(ctx context.Context, order *models.SubcontractOrder, previousAtVendor float64, receipt *models.SubcontractReceipt, movement *models.StockMovement, orderReceipt *models.PurchaseOrderReceipt) error
+	// ListVendorStock totals the material at each subcontractor
+	ListVendorStock(ctx context.Context, companyID uuid.UUID) ([]*VendorStock, error)
+}
+
+type subcontractRepository struct {
+	db *gorm.DB
+}
+
+// NewSubcontractRepository creates a new subcontract repository
+func NewSubcontractRepository(db *gorm.DB) SubcontractRepository {
+	return &subcontractRepository{db: db}
+}
+
+// Master data
+
+func (r *subcontractRepository) GetRouteOperation(ctx context.Context, id uuid.UUID) (*models.RouteOperation, error) {
+	var operation models.RouteOperation
+	err := r.db.WithContext(ctx).Preload("Route").Where("id = ?", id).First(&operation).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &operation, nil
+}
+
+func (r *subcontractRepository) GetProductionOrder(ctx context.Context, id uuid.UUID) (*models.ProductionOrder, error) {
+	var order models.ProductionOrder
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&order).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *subcontractRepository) GetInventory(ctx context.Context, id uuid.UUID) (*models.Inventory, error) {
+	var inventory models.Inventory
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&inventory).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &inventory, nil
+}
+
+func (r *subcontractRepository) GetSupplier(ctx context.Context, id uuid.UUID) (*models.Supplier, error) {
+	var supplier models.Supplier
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&supplier).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &supplier, nil
+}
+
+func (r *subcontractRepository) FindVendorWarehouse(ctx context.Context, companyID, supplierID uuid.UUID) (*models.Warehouse, error) {
+	var warehouse models.Warehouse
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND supplier_id = ? AND type = ?", companyID, supplierID, "subcontractor").
+		Order("created_at").
+		First(&warehouse).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &warehouse, nil
+}
+
+func (r *subcontractRepository) CreateWarehouse(ctx context.Context, warehouse *models.Warehouse) error {
+	return r.db.WithContext(ctx).Create(warehouse).Error
+}
+
+// Orders
+
+func (r *subcontractRepository) CreateOrder(ctx context.Context, order *models.SubcontractOrder, purchaseOrder *models.PurchaseOrder) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		items := purchaseOrder.Items
+		if err := tx.Omit(clause.Associations).Create(purchaseOrder).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].PurchaseOrderID = purchaseOrder.ID
+			if err := tx.Omit(clause.Associations).Create(&items[i]).Error; err != nil {
+				return err
+			}
+		}
+		purchaseOrder.Items = items
+		order.PurchaseOrderID = purchaseOrder.ID
+		if len(items) > 0 {
+			order.PurchaseOrderItemID = items[0].ID
+		}
+		return tx.Omit(clause.Associations).Create(order).Error
+	})
+}
+
+func (r *subcontractRepository) GetOrder(ctx context.Context, id uuid.UUID) (*models.SubcontractOrder, error) {
+	var order models.SubcontractOrder
+	err := r.db.WithContext(ctx).
+		Preload("Supplier").
+		Preload("VendorWarehouse").
+		Preload("PurchaseOrder").
+		Preload("Inventory").
+		Preload("OutputInventory").
+		Preload("Shipments", func(db *gorm.DB) *gorm.DB { return db.Order("shipped_at") }).
+		Preload("Receipts", func(db *gorm.DB) *gorm.DB { return db.Order("received_at") }).
+		Where("id = ?", id).
+		First(&order).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+// ListOrders lists orders, latest first, filtered on company_id, status,
+// supplier_id, production_order_id, process and open (still expecting
+// goods back)
+func (r *subcontractRepository) ListOrders(ctx context.Context, params map[string]interface{}) ([]*models.SubcontractOrder, int64, error) {
+	var orders []*models.SubcontractOrder
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.SubcontractOrder{})
+	if companyID, ok := params["company_id"].(uuid.UUID); ok {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if supplierID, ok := params["supplier_id"].(uuid.UUID); ok {
+		query = query.Where("supplier_id = ?", supplierID)
+	}
+	if orderID, ok := params["production_order_id"].(uuid.UUID); ok {
+		query = query.Where("production_order_id = ?", orderID)
+	}
+	if process, ok := params["process"].(string); ok && process != "" {
+		query = query.Where("process = ?", process)
+	}
+	if open, ok := params["open"].(bool); ok && open {
+		query = query.Where("status IN ?", []string{
+			models.SubcontractStatusOpen, models.SubcontractStatusAtVendor, models.SubcontractStatusPartialReceived,
+		})
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := subcontractPage(params)
+	err := query.Preload("Supplier").
+		Preload("Inventory").
+		Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&orders).Error
+	return orders, total, err
+}
+
+func (r *subcontractRepository) CancelOrder(ctx context.Context, order *models.SubcontractOrder, previousAtVendor float64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := updateSubcontractOrder(tx, order, previousAtVendor); err != nil {
+			return err
+		}
+		return tx.Model(&models.PurchaseOrder{}).
+			Where("id = ? AND status IN ?", order.PurchaseOrderID, []string{"draft", "sent"}).
+			Update("status", "cancelled").Error
+	})
+}
+
+func (r *subcontractRepository) Ship(ctx context.Context, order *models.SubcontractOrder, previousAtVendor float64, shipment *models.SubcontractShipment, movement *models.StockMovement) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := updateSubcontractOrder(tx, order, previousAtVendor); err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Inventory{}).
+			Where("id = ? AND available_stock >= ?", order.InventoryID, shipment.Quantity).
+			Updates(map[string]interface{}{
+				"current_stock":   gorm.Expr("current_stock - ?", shipment.Quantity),
+				"available_stock": gorm.Expr("available_stock - ?", shipment.Quantity),
+				"at_vendor_stock": gorm.Expr("at_vendor_stock + ?", shipment.Quantity),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInsufficientStock
+		}
+		if err := createStockMovement(tx, movement, order.InventoryID); err != nil {
+			return err
+		}
+
+		shipment.StockMovementID = &movement.ID
+		if err := tx.Create(shipment).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.PurchaseOrder{}).
+			Where("id = ? AND status = ?", order.PurchaseOrderID, "draft").
+			Update("status", "sent").Error
+	})
+}
+
+func (r *subcontractRepository) Receive(ctx context.Context, order *models.SubcontractOrder, previousAtVendor float64, receipt *models.SubcontractReceipt, movement *models.StockMovement, orderReceipt *models.PurchaseOrderReceipt) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := updateSubcontractOrder(tx, order, previousAtVendor); err != nil {
+			return err
+		}
+
+		returned := receipt.Quantity + receipt.ScrapQuantity
+		if err := tx.Model(&models.Inventory{}).Where("id = ?", order.InventoryID).
+			Update("at_vendor_stock", gorm.Expr("GREATEST(at_vendor_stock - ?, 0)", returned)).Error; err != nil {
+			return err
+		}
+		if movement != nil {
+			if err := tx.Model(&models.Inventory{}).Where("id = ?", order.OutputInventoryID).
+				Updates(map[string]interface{}{
+					"current_stock":   gorm.Expr("current_stock + ?", receipt.Quantity),
+					"available_stock": gorm.Expr("available_stock + ?", receipt.Quantity),
+				}).Error; err != nil {
+				return err
+			}
+			if err := createStockMovement(tx, movement, order.OutputInventoryID); err != nil {
+				return err
+			}
+			receipt.StockMovementID = &movement.ID
+		}
+
+		if orderReceipt != nil {
+			if err := tx.Create(orderReceipt).Error; err != nil {
+				return err
+			}
+			receipt.PurchaseOrderReceiptID = &orderReceipt.ID
+			if err := receivePurchaseOrderItem(tx, orderReceipt); err != nil {
+				return err
+			}
+		}
+		return tx.Create(receipt).Error
+	})
+}
+
+func (r *subcontractRepository) ListVendorStock(ctx context.Context, companyID uuid.UUID) ([]*VendorStock, error) {
+	var stock []*VendorStock
+	err := r.db.WithContext(ctx).Table("subcontract_orders").
+		Select("subcontract_orders.supplier_id, subcontract_orders.inventory_id, inventories.sku, inventories.name, "+
+			"SUM(subcontract_orders.at_vendor_quantity) AS quantity, COUNT(*) AS orders").
+		Joins("JOIN inventories ON inventories.id = subcontract_orders.inventory_id").
+		Where("subcontract_orders.company_id = ? AND subcontract_orders.at_vendor_quantity > 0", companyID).
+		Where("subcontract_orders.status <> ?", models.SubcontractStatusCancelled).
+		Group("subcontract_orders.supplier_id, subcontract_orders.inventory_id, inventories.sku, inventories.name").
+		Order("subcontract_orders.supplier_id, inventories.sku").
+		Scan(&stock).Error
+	return stock, err
+}
+
+// updateSubcontractOrder saves an order, guarded on the quantity at the
+// subcontractor it was read with
+func updateSubcontractOrder(tx *gorm.DB, order *models.SubcontractOrder, previousAtVendor float64) error {
+	result := tx.Model(order).
+		Select("*").
+		Omit("id", "created_at", clause.Associations).
+		Where("at_vendor_quantity = ?", previousAtVendor).
+		Updates(order)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStaleSubcontractOrder
+	}
+	return nil
+}
+
+// createStockMovement records a movement with the stock of its item after
+// it was updated
+func createStockMovement(tx *gorm.DB, movement *models.StockMovement, inventoryID uuid.UUID) error {
+	var inventory models.Inventory
+	if err := tx.Select("current_stock").Where("id = ?", inventoryID).First(&inventory).Error; err != nil {
+		return err
+	}
+	movement.InventoryID = inventoryID
+	movement.AfterQuantity = inventory.CurrentStock
+	movement.BeforeQuantity = inventory.CurrentStock - movement.Quantity
+	if movement.CreatedAt.IsZero() {
+		movement.CreatedAt = time.Now()
+	}
+	return tx.Create(movement).Error
+}
+
+// receivePurchaseOrderItem adds a receipt to its purchase order line and
+// updates the status of the line and the order
+func receivePurchaseOrderItem(tx *gorm.DB, receipt *models.PurchaseOrderReceipt) error {
+	var item models.PurchaseOrderItem
+	if err := tx.Where("id = ?", receipt.PurchaseOrderItemID).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrNotFound
+		}
+		return err
+	}
+	item.ReceivedQuantity += receipt.Quantity
+	item.Status = "partial_received"
+	if item.ReceivedQuantity >= item.OrderedQuantity {
+		item.Status = "received"
+	}
+	if err := tx.Model(&item).Updates(map[string]interface{}{
+		"received_quantity": item.ReceivedQuantity,
+		"status":            item.Status,
+	}).Error; err != nil {
+		return err
+	}
+
+	var open int64
+	if err := tx.Model(&models.PurchaseOrderItem{}).
+		Where("purchase_order_id = ? AND status NOT IN ?", receipt.PurchaseOrderID, []string{"received", "cancelled"}).
+		Count(&open).Error; err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"status": "partial_received"}
+	if open == 0 {
+		updates = map[string]interface{}{"status": "received", "actual_end_date": receipt.ReceivedAt}
+	}
+	return tx.Model(&models.PurchaseOrder{}).Where("id = ?", receipt.PurchaseOrderID).Updates(updates).Error
+}
+
+func subcontractPage(params map[string]interface{}) (int, int) {
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+	return page, pageSize
+}
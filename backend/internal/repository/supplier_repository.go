@@ -36,12 +36,32 @@ type SupplierRepository interface {
 	UpdatePurchaseOrderItem(item *models.PurchaseOrderItem) error
 	GetPurchaseOrderItems(purchaseOrderID uuid.UUID) ([]models.PurchaseOrderItem, error)
 	DeletePurchaseOrderItem(id uuid.UUID) error
+	CreatePurchaseOrderReceipt(receipt *models.PurchaseOrderReceipt) error
 	
 	// Supplier Evaluation operations
 	CreateSupplierEvaluation(evaluation *models.SupplierEvaluation) error
 	UpdateSupplierEvaluation(evaluation *models.SupplierEvaluation) error
 	GetSupplierEvaluation(id uuid.UUID) (*models.SupplierEvaluation, error)
 	ListSupplierEvaluations(companyID uuid.UUID, params map[string]interface{}) ([]models.SupplierEvaluation, int64, error)
+	
+	// Purchase Requisition operations
+	CreateRequisition(requisition *models.PurchaseRequisition) error
+	UpdateRequisition(requisition *models.PurchaseRequisition) error
+	GetRequisition(id uuid.UUID) (*models.PurchaseRequisition, error)
+	ListRequisitions(companyID uuid.UUID, params map[string]interface{}) ([]models.PurchaseRequisition, int64, error)
+	
+	// RFQ operations
+	CreateRFQ(rfq *models.SupplierRFQ) error
+	UpdateRFQ(rfq *models.SupplierRFQ) error
+	GetRFQ(id uuid.UUID) (*models.SupplierRFQ, error)
+	ListRFQs(companyID uuid.UUID, params map[string]interface{}) ([]models.SupplierRFQ, int64, error)
+	CreateRFQInvitation(invitation *models.SupplierRFQInvitation) error
+	UpdateRFQInvitation(invitation *models.SupplierRFQInvitation) error
+	GetRFQInvitationByToken(token string) (*models.SupplierRFQInvitation, error)
+	SaveBid(bid *models.SupplierBid, invitation *models.SupplierRFQInvitation) error
+	GetBidByInvitation(invitationID uuid.UUID) (*models.SupplierBid, error)
+	ListRFQBids(rfqID uuid.UUID) ([]models.SupplierBid, error)
+	AwardRFQ(rfq *models.SupplierRFQ, bid *models.SupplierBid, order *models.PurchaseOrder) error
 }
 
 type supplierRepository struct {
@@ -297,6 +317,10 @@ func (r *supplierRepository) UpdatePurchaseOrderItem(item *models.PurchaseOrderI
 	return r.db.Save(item).Error
 }
 
+func (r *supplierRepository) CreatePurchaseOrderReceipt(receipt *models.PurchaseOrderReceipt) error {
+	return r.db.Create(receipt).Error
+}
+
 func (r *supplierRepository) GetPurchaseOrderItems(purchaseOrderID uuid.UUID) ([]models.PurchaseOrderItem, error) {
 	var items []models.PurchaseOrderItem
 	err := r.db.Where("purchase_order_id = ?", purchaseOrderID).
@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrRFQNotSent is returned when awarding an RFQ that is no longer open for
+// bids, e.g. because it was awarded or cancelled concurrently
+var ErrRFQNotSent = errors.New("RFQ is not open for bids")
+
+// Purchase Requisition operations
+func (r *supplierRepository) CreateRequisition(requisition *models.PurchaseRequisition) error {
+	return r.db.Create(requisition).Error
+}
+
+func (r *supplierRepository) UpdateRequisition(requisition *models.PurchaseRequisition) error {
+	return r.db.Omit(clause.Associations).Save(requisition).Error
+}
+
+func (r *supplierRepository) GetRequisition(id uuid.UUID) (*models.PurchaseRequisition, error) {
+	var requisition models.PurchaseRequisition
+	err := r.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("line_no")
+	}).First(&requisition, "id = ?", id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &requisition, nil
+}
+
+func (r *supplierRepository) ListRequisitions(companyID uuid.UUID, params map[string]interface{}) ([]models.PurchaseRequisition, int64, error) {
+	var requisitions []models.PurchaseRequisition
+	var total int64
+
+	query := r.db.Model(&models.PurchaseRequisition{}).Where("company_id = ?", companyID)
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if search, ok := params["search"].(string); ok && search != "" {
+		query = query.Where("requisition_no LIKE ? OR title LIKE ?", "%"+search+"%", "%"+search+"%")
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := rfqPage(params)
+	err := query.Preload("Items").
+		Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&requisitions).Error
+	return requisitions, total, err
+}
+
+// RFQ operations
+
+// CreateRFQ creates an RFQ with its items and marks its requisition as
+// being quoted
+func (r *supplierRepository) CreateRFQ(rfq *models.SupplierRFQ) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Invitations").Create(rfq).Error; err != nil {
+			return err
+		}
+		if rfq.RequisitionID == nil {
+			return nil
+		}
+		return tx.Model(&models.PurchaseRequisition{}).
+			Where("id = ? AND status = ?", *rfq.RequisitionID, models.RequisitionStatusOpen).
+			Updates(map[string]interface{}{"status": models.RequisitionStatusRFQ, "updated_at": time.Now()}).Error
+	})
+}
+
+func (r *supplierRepository) UpdateRFQ(rfq *models.SupplierRFQ) error {
+	return r.db.Omit(clause.Associations).Save(rfq).Error
+}
+
+func (r *supplierRepository) GetRFQ(id uuid.UUID) (*models.SupplierRFQ, error) {
+	var rfq models.SupplierRFQ
+	err := r.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("line_no")
+	}).
+		Preload("Invitations", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at")
+		}).
+		Preload("Invitations.Supplier").
+		First(&rfq, "id = ?", id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &rfq, nil
+}
+
+func (r *supplierRepository) ListRFQs(companyID uuid.UUID, params map[string]interface{}) ([]models.SupplierRFQ, int64, error) {
+	var rfqs []models.SupplierRFQ
+	var total int64
+
+	query := r.db.Model(&models.SupplierRFQ{}).Where("company_id = ?", companyID)
+	if status, ok := params["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if requisitionID, ok := params["requisition_id"].(uuid.UUID); ok {
+		query = query.Where("requisition_id = ?", requisitionID)
+	}
+	if supplierID, ok := params["supplier_id"].(uuid.UUID); ok {
+		query = query.Where("id IN (?)", r.db.Model(&models.SupplierRFQInvitation{}).Select("rfq_id").Where("supplier_id = ?", supplierID))
+	}
+	if search, ok := params["search"].(string); ok && search != "" {
+		query = query.Where("rfq_no LIKE ? OR title LIKE ?", "%"+search+"%", "%"+search+"%")
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := rfqPage(params)
+	err := query.Preload("Invitations").
+		Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&rfqs).Error
+	return rfqs, total, err
+}
+
+func (r *supplierRepository) CreateRFQInvitation(invitation *models.SupplierRFQInvitation) error {
+	return r.db.Omit(clause.Associations).Create(invitation).Error
+}
+
+func (r *supplierRepository) UpdateRFQInvitation(invitation *models.SupplierRFQInvitation) error {
+	return r.db.Omit(clause.Associations).Save(invitation).Error
+}
+
+func (r *supplierRepository) GetRFQInvitationByToken(token string) (*models.SupplierRFQInvitation, error) {
+	var invitation models.SupplierRFQInvitation
+	err := r.db.Preload("Supplier").Where("token = ?", token).First(&invitation).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// SaveBid saves a bid, replacing the lines of an earlier submission, and
+// the invitation it answers
+func (r *supplierRepository) SaveBid(bid *models.SupplierBid, invitation *models.SupplierRFQInvitation) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(bid).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("bid_id = ?", bid.ID).Delete(&models.SupplierBidLine{}).Error; err != nil {
+			return err
+		}
+		for i := range bid.Lines {
+			bid.Lines[i].ID = uuid.Nil
+			bid.Lines[i].BidID = bid.ID
+		}
+		if len(bid.Lines) > 0 {
+			if err := tx.Create(&bid.Lines).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Omit(clause.Associations).Save(invitation).Error
+	})
+}
+
+func (r *supplierRepository) GetBidByInvitation(invitationID uuid.UUID) (*models.SupplierBid, error) {
+	var bid models.SupplierBid
+	err := r.db.Preload("Lines").Where("invitation_id = ?", invitationID).First(&bid).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &bid, nil
+}
+
+func (r *supplierRepository) ListRFQBids(rfqID uuid.UUID) ([]models.SupplierBid, error) {
+	var bids []models.SupplierBid
+	err := r.db.Preload("Lines").
+		Preload("Supplier").
+		Where("rfq_id = ?", rfqID).
+		Order("submitted_at").
+		Find(&bids).Error
+	return bids, err
+}
+
+// AwardRFQ creates the purchase order of the awarded bid with its items,
+// rejects the other bids and closes the RFQ and its requisition. The RFQ is
+// locked and awarded only while still sent, so of two concurrent awards one
+// fails with ErrRFQNotSent.
+func (r *supplierRepository) AwardRFQ(rfq *models.SupplierRFQ, bid *models.SupplierBid, order *models.PurchaseOrder) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var locked models.SupplierRFQ
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "status").
+			First(&locked, "id = ?", rfq.ID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrNotFound
+			}
+			return err
+		}
+		if locked.Status != models.RFQStatusSent {
+			return ErrRFQNotSent
+		}
+		if err := tx.Omit("Company", "Supplier", "Creator", "Approver").Create(order).Error; err != nil {
+			return err
+		}
+		rfq.PurchaseOrderID = &order.ID
+		result := tx.Model(&models.SupplierRFQ{}).
+			Where("id = ? AND status = ?", rfq.ID, models.RFQStatusSent).
+			Updates(map[string]interface{}{
+				"status":            rfq.Status,
+				"awarded_bid_id":    rfq.AwardedBidID,
+				"awarded_by":        rfq.AwardedBy,
+				"awarded_at":        rfq.AwardedAt,
+				"purchase_order_id": rfq.PurchaseOrderID,
+				"updated_at":        time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRFQNotSent
+		}
+		if err := tx.Model(&models.SupplierBid{}).
+			Where("rfq_id = ? AND id <> ?", rfq.ID, bid.ID).
+			Update("status", models.BidStatusRejected).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(bid).Update("status", models.BidStatusAwarded).Error; err != nil {
+			return err
+		}
+		if rfq.RequisitionID == nil {
+			return nil
+		}
+		return tx.Model(&models.PurchaseRequisition{}).
+			Where("id = ?", *rfq.RequisitionID).
+			Updates(map[string]interface{}{"status": models.RequisitionStatusOrdered, "updated_at": time.Now()}).Error
+	})
+}
+
+func rfqPage(params map[string]interface{}) (int, int) {
+	page := 1
+	if p, ok := params["page"].(int); ok && p > 0 {
+		page = p
+	}
+	pageSize := 20
+	if ps, ok := params["page_size"].(int); ok && ps > 0 {
+		pageSize = ps
+	}
+	return page, pageSize
+}
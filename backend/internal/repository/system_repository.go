@@ -96,6 +96,7 @@ type SystemRepository interface {
 	GetSystemStatistics(companyID *uuid.UUID) (map[string]interface{}, error)
 	GetUserPermissions(userID uuid.UUID) ([]models.Permission, error)
 	HasPermission(userID uuid.UUID, module, action string) (bool, error)
+	IsSystemAdmin(userID uuid.UUID) (bool, error)
 }
 
 type systemRepository struct {
@@ -948,5 +949,19 @@ func (r *systemRepository) HasPermission(userID uuid.UUID, module, action string
 			userID, module, action, true, true).
 		Count(&count).Error
 	
+	return count > 0, err
+}
+
+// IsSystemAdmin reports whether the user holds the level 1 system role, the
+// role without a company that administers data shared by all companies
+func (r *systemRepository) IsSystemAdmin(userID uuid.UUID) (bool, error) {
+	var count int64
+	
+	err := r.db.Table("users").
+		Joins("JOIN roles ON users.role = roles.name").
+		Where("users.id = ? AND roles.company_id IS NULL AND roles.level = ? AND roles.is_active = ?",
+			userID, 1, true).
+		Count(&count).Error
+	
 	return count > 0, err
 }
\ No newline at end of file
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TrackingRepository persists carrier integrations and carrier tracking events
+type TrackingRepository interface {
+	// Carrier integrations
+	CreateCarrierIntegration(ctx context.Context, integration *models.CarrierIntegration) error
+	GetCarrierIntegration(ctx context.Context, id uuid.UUID) (*models.CarrierIntegration, error)
+	FindCarrierIntegration(ctx context.Context, companyID uuid.UUID, carrierName string) (*models.CarrierIntegration, error)
+	ListCarrierIntegrations(ctx context.Context, companyID uuid.UUID) ([]*models.CarrierIntegration, error)
+	ListPollableIntegrations(ctx context.Context) ([]*models.CarrierIntegration, error)
+	UpdateCarrierIntegration(ctx context.Context, integration *models.CarrierIntegration) error
+	DeleteCarrierIntegration(ctx context.Context, id uuid.UUID) error
+
+	// Shipments
+	GetShipment(ctx context.Context, id uuid.UUID) (*models.Shipment, error)
+	FindShipmentsByReference(ctx context.Context, companyID uuid.UUID, references []string) ([]*models.Shipment, error)
+	ListOpenShipments(ctx context.Context, companyID uuid.UUID, carrierName string) ([]*models.Shipment, error)
+	ShipmentEventExists(ctx context.Context, shipmentID uuid.UUID, eventType, source string, eventTime time.Time) (bool, error)
+	ApplyTrackingEvents(ctx context.Context, shipment *models.Shipment, events []*models.ShipmentEvent) error
+}
+
+type trackingRepository struct {
+	db *gorm.DB
+}
+
+// NewTrackingRepository creates a new tracking repository
+func NewTrackingRepository(db *gorm.DB) TrackingRepository {
+	return &trackingRepository{db: db}
+}
+
+// Carrier integrations
+
+func (r *trackingRepository) CreateCarrierIntegration(ctx context.Context, integration *models.CarrierIntegration) error {
+	return r.db.WithContext(ctx).Create(integration).Error
+}
+
+func (r *trackingRepository) GetCarrierIntegration(ctx context.Context, id uuid.UUID) (*models.CarrierIntegration, error) {
+	var integration models.CarrierIntegration
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&integration).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &integration, nil
+}
+
+// FindCarrierIntegration looks up the integration of a carrier by name, case-insensitively
+func (r *trackingRepository) FindCarrierIntegration(ctx context.Context, companyID uuid.UUID, carrierName string) (*models.CarrierIntegration, error) {
+	var integration models.CarrierIntegration
+	err := r.db.WithContext(ctx).
+		Where("company_id = ? AND LOWER(carrier_name) = LOWER(?)", companyID, carrierName).
+		First(&integration).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &integration, nil
+}
+
+func (r *trackingRepository) ListCarrierIntegrations(ctx context.Context, companyID uuid.UUID) ([]*models.CarrierIntegration, error) {
+	var integrations []*models.CarrierIntegration
+	err := r.db.WithContext(ctx).Where("company_id = ?", companyID).Order("carrier_name").Find(&integrations).Error
+	return integrations, err
+}
+
+// ListPollableIntegrations returns the active integrations of all companies that fetch over HTTP
+func (r *trackingRepository) ListPollableIntegrations(ctx context.Context) ([]*models.CarrierIntegration, error) {
+	var integrations []*models.CarrierIntegration
+	err := r.db.WithContext(ctx).
+		Where("is_active = ? AND adapter_type = ?", true, "http").
+		Order("company_id, carrier_name").
+		Find(&integrations).Error
+	return integrations, err
+}
+
+func (r *trackingRepository) UpdateCarrierIntegration(ctx context.Context, integration *models.CarrierIntegration) error {
+	return r.db.WithContext(ctx).Save(integration).Error
+}
+
+func (r *trackingRepository) DeleteCarrierIntegration(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Delete(&models.CarrierIntegration{}, "id = ?", id).Error
+}
+
+// Shipments
+
+func (r *trackingRepository) GetShipment(ctx context.Context, id uuid.UUID) (*models.Shipment, error) {
+	var shipment models.Shipment
+	err := r.db.WithContext(ctx).Preload("Order").Where("id = ?", id).First(&shipment).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &shipment, nil
+}
+
+// FindShipmentsByReference returns the shipments whose tracking or container number is one of references
+func (r *trackingRepository) FindShipmentsByReference(ctx context.Context, companyID uuid.UUID, references []string) ([]*models.Shipment, error) {
+	var shipments []*models.Shipment
+	if len(references) == 0 {
+		return shipments, nil
+	}
+	err := r.db.WithContext(ctx).
+		Preload("Order").
+		Where("company_id = ?", companyID).
+		Where("tracking_no IN ? OR container_no IN ?", references, references).
+		Find(&shipments).Error
+	return shipments, err
+}
+
+// ListOpenShipments returns the shipments of a carrier that are neither delivered nor cancelled
+func (r *trackingRepository) ListOpenShipments(ctx context.Context, companyID uuid.UUID, carrierName string) ([]*models.Shipment, error) {
+	var shipments []*models.Shipment
+	err := r.db.WithContext(ctx).
+		Preload("Order").
+		Where("company_id = ? AND LOWER(carrier_name) = LOWER(?)", companyID, carrierName).
+		Where("status NOT IN ?", []string{"delivered", "cancelled"}).
+		Where("tracking_no <> '' OR container_no <> ''").
+		Find(&shipments).Error
+	return shipments, err
+}
+
+func (r *trackingRepository) ShipmentEventExists(ctx context.Context, shipmentID uuid.UUID, eventType, source string, eventTime time.Time) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.ShipmentEvent{}).
+		Where("shipment_id = ? AND event_type = ? AND source = ? AND event_time = ?", shipmentID, eventType, source, eventTime).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ApplyTrackingEvents stores new events together with the resulting shipment state
+func (r *trackingRepository) ApplyTrackingEvents(ctx context.Context, shipment *models.Shipment, events []*models.ShipmentEvent) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, event := range events {
+			if err := tx.Create(event).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Omit("Company", "Order", "Items", "Events", "Documents").Save(shipment).Error
+	})
+}
@@ -39,12 +39,28 @@ type TradeRepository interface {
 	GetTradeDocument(ctx context.Context, id uuid.UUID) (*models.TradeDocument, error)
 	ListTradeDocuments(ctx context.Context, params map[string]interface{}) ([]*models.TradeDocument, error)
 	UpdateTradeDocument(ctx context.Context, doc *models.TradeDocument) error
+	ListShipmentDocuments(ctx context.Context, shipmentID uuid.UUID, docType string) ([]*models.TradeDocument, error)
+	ReplaceShipmentDocuments(ctx context.Context, shipmentID uuid.UUID, supersededIDs []uuid.UUID, docs []*models.TradeDocument) error
+	LockShipment(ctx context.Context, id uuid.UUID) error
 
 	// Letter of Credit Management
 	CreateLetterOfCredit(ctx context.Context, lc *models.LetterOfCredit) error
 	GetLetterOfCredit(ctx context.Context, id uuid.UUID) (*models.LetterOfCredit, error)
 	ListLettersOfCredit(ctx context.Context, params map[string]interface{}) ([]*models.LetterOfCredit, int64, error)
 	UpdateLetterOfCredit(ctx context.Context, lc *models.LetterOfCredit) error
+	LockLetterOfCredit(ctx context.Context, id uuid.UUID) (*models.LetterOfCredit, error)
+
+	// LC Amendment Management
+	CreateLCAmendment(ctx context.Context, amendment *models.LCAmendment) error
+	GetLCAmendment(ctx context.Context, id uuid.UUID) (*models.LCAmendment, error)
+	ListLCAmendments(ctx context.Context, lcID uuid.UUID) ([]*models.LCAmendment, error)
+	LockLCAmendment(ctx context.Context, id uuid.UUID) (*models.LCAmendment, error)
+	RespondLCAmendment(ctx context.Context, amendment *models.LCAmendment) error
+	ApplyLCAmendment(ctx context.Context, amendment *models.LCAmendment, lc *models.LetterOfCredit) error
+
+	// LC Utilization Management
+	CreateLCUtilization(ctx context.Context, utilization *models.LCUtilization, lc *models.LetterOfCredit) error
+	ListLCUtilizations(ctx context.Context, lcID uuid.UUID) ([]*models.LCUtilization, error)
 
 	// Exchange Rate Management
 	GetLatestExchangeRate(ctx context.Context, fromCurrency, toCurrency string) (*models.ExchangeRate, error)
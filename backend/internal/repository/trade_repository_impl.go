@@ -2,13 +2,18 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/fastenmind/fastener-api/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrLCAmendmentNotPending is returned when responding to an amendment that was already answered
+var ErrLCAmendmentNotPending = errors.New("LC amendment is not pending")
+
 type tradeRepositoryImpl struct {
 	db *gorm.DB
 }
@@ -173,6 +178,7 @@ func (r *tradeRepositoryImpl) CreateShipment(ctx context.Context, shipment *mode
 func (r *tradeRepositoryImpl) GetShipment(ctx context.Context, id uuid.UUID) (*models.Shipment, error) {
 	var shipment models.Shipment
 	err := r.db.WithContext(ctx).
+		Preload("Company").
 		Preload("Items").
 		Preload("Documents").
 		Preload("Events").
@@ -280,6 +286,10 @@ func (r *tradeRepositoryImpl) ListTradeDocuments(ctx context.Context, params map
 	query := r.db.WithContext(ctx).Model(&models.TradeDocument{})
 
 	// Apply filters
+	if shipmentID, ok := params["shipment_id"].(uuid.UUID); ok {
+		query = query.Joins("JOIN shipment_documents sd ON sd.trade_document_id = trade_documents.id").
+			Where("sd.shipment_id = ?", shipmentID)
+	}
 	if resourceType, ok := params["resource_type"].(string); ok && resourceType != "" {
 		query = query.Where("resource_type = ?", resourceType)
 	}
@@ -305,6 +315,59 @@ func (r *tradeRepositoryImpl) UpdateTradeDocument(ctx context.Context, doc *mode
 	return r.db.WithContext(ctx).Save(doc).Error
 }
 
+func (r *tradeRepositoryImpl) ListShipmentDocuments(ctx context.Context, shipmentID uuid.UUID, docType string) ([]*models.TradeDocument, error) {
+	var docs []*models.TradeDocument
+
+	query := dbFor(ctx, r.db).
+		Joins("JOIN shipment_documents sd ON sd.trade_document_id = trade_documents.id").
+		Where("sd.shipment_id = ?", shipmentID)
+	if docType != "" {
+		query = query.Where("trade_documents.document_type = ?", docType)
+	}
+
+	err := query.Order("trade_documents.version DESC, trade_documents.created_at DESC").Find(&docs).Error
+	return docs, err
+}
+
+// ReplaceShipmentDocuments marks the superseded documents and links the new version to the shipment
+func (r *tradeRepositoryImpl) ReplaceShipmentDocuments(ctx context.Context, shipmentID uuid.UUID, supersededIDs []uuid.UUID, docs []*models.TradeDocument) error {
+	return dbFor(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if len(supersededIDs) > 0 {
+			err := tx.Model(&models.TradeDocument{}).
+				Where("id IN ?", supersededIDs).
+				Update("status", "superseded").Error
+			if err != nil {
+				return err
+			}
+		}
+
+		shipment := models.Shipment{ID: shipmentID}
+		for _, doc := range docs {
+			if err := tx.Create(doc).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&shipment).Association("Documents").Append(doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LockShipment locks the shipment row until the transaction in ctx ends, so
+// document versions of the shipment are numbered one generation at a time
+func (r *tradeRepositoryImpl) LockShipment(ctx context.Context, id uuid.UUID) error {
+	var shipment models.Shipment
+	err := dbFor(ctx, r.db).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		Where("id = ?", id).
+		First(&shipment).Error
+	if err == gorm.ErrRecordNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
 // Letter of Credit Management
 
 func (r *tradeRepositoryImpl) CreateLetterOfCredit(ctx context.Context, lc *models.LetterOfCredit) error {
@@ -369,10 +432,158 @@ func (r *tradeRepositoryImpl) ListLettersOfCredit(ctx context.Context, params ma
 	return lcs, total, nil
 }
 
+// LockLetterOfCredit loads an LC and locks it until the transaction carried
+// by ctx ends
+func (r *tradeRepositoryImpl) LockLetterOfCredit(ctx context.Context, id uuid.UUID) (*models.LetterOfCredit, error) {
+	var lc models.LetterOfCredit
+	err := dbFor(ctx, r.db).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&lc).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &lc, nil
+}
+
 func (r *tradeRepositoryImpl) UpdateLetterOfCredit(ctx context.Context, lc *models.LetterOfCredit) error {
 	return r.db.WithContext(ctx).Save(lc).Error
 }
 
+// LC Amendment Management
+
+// CreateLCAmendment numbers the amendment after the last one of its LC and
+// stores it. The LC row stays locked until the amendment is stored, so
+// concurrent proposals are numbered one after the other.
+func (r *tradeRepositoryImpl) CreateLCAmendment(ctx context.Context, amendment *models.LCAmendment) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var lc models.LetterOfCredit
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			Where("id = ?", amendment.LCID).
+			First(&lc).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		var last int
+		err = tx.Model(&models.LCAmendment{}).
+			Where("lc_id = ?", amendment.LCID).
+			Select("COALESCE(MAX(amendment_no), 0)").
+			Scan(&last).Error
+		if err != nil {
+			return err
+		}
+
+		amendment.AmendmentNo = last + 1
+		return tx.Create(amendment).Error
+	})
+}
+
+func (r *tradeRepositoryImpl) GetLCAmendment(ctx context.Context, id uuid.UUID) (*models.LCAmendment, error) {
+	var amendment models.LCAmendment
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&amendment).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &amendment, nil
+}
+
+func (r *tradeRepositoryImpl) ListLCAmendments(ctx context.Context, lcID uuid.UUID) ([]*models.LCAmendment, error) {
+	var amendments []*models.LCAmendment
+	err := r.db.WithContext(ctx).
+		Where("lc_id = ?", lcID).
+		Order("amendment_no ASC").
+		Find(&amendments).Error
+	return amendments, err
+}
+
+// LockLCAmendment loads an amendment and locks it until the transaction
+// carried by ctx ends
+func (r *tradeRepositoryImpl) LockLCAmendment(ctx context.Context, id uuid.UUID) (*models.LCAmendment, error) {
+	var amendment models.LCAmendment
+	err := dbFor(ctx, r.db).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&amendment).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &amendment, nil
+}
+
+// RespondLCAmendment stores the beneficiary's response to a pending
+// amendment. It fails with ErrLCAmendmentNotPending when the amendment was
+// answered in the meantime.
+func (r *tradeRepositoryImpl) RespondLCAmendment(ctx context.Context, amendment *models.LCAmendment) error {
+	result := dbFor(ctx, r.db).Model(&models.LCAmendment{}).
+		Where("id = ? AND status = ?", amendment.ID, "pending").
+		Select("status", "old_amount", "old_expiry_date", "old_last_shipment_date", "old_port_of_loading", "old_port_of_discharge",
+			"effective_at", "responded_at", "responded_by", "rejected_reason", "updated_at").
+		Updates(amendment)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLCAmendmentNotPending
+	}
+	return nil
+}
+
+// ApplyLCAmendment accepts a pending amendment and writes the amended terms
+// and balance of the LC. Run it in a transaction with the LC locked.
+func (r *tradeRepositoryImpl) ApplyLCAmendment(ctx context.Context, amendment *models.LCAmendment, lc *models.LetterOfCredit) error {
+	if err := r.RespondLCAmendment(ctx, amendment); err != nil {
+		return err
+	}
+	return dbFor(ctx, r.db).Model(&models.LetterOfCredit{}).
+		Where("id = ?", lc.ID).
+		Updates(map[string]interface{}{
+			"amount":             lc.Amount,
+			"expiry_date":        lc.ExpiryDate,
+			"last_shipment_date": lc.LastShipmentDate,
+			"port_of_loading":    lc.PortOfLoading,
+			"port_of_discharge":  lc.PortOfDischarge,
+			"available_amount":   lc.AvailableAmount,
+			"status":             lc.Status,
+			"updated_at":         lc.UpdatedAt,
+		}).Error
+}
+
+// LC Utilization Management
+
+// CreateLCUtilization records a drawing and the resulting LC balance. Run
+// it in a transaction with the LC locked.
+func (r *tradeRepositoryImpl) CreateLCUtilization(ctx context.Context, utilization *models.LCUtilization, lc *models.LetterOfCredit) error {
+	db := dbFor(ctx, r.db)
+	if err := db.Create(utilization).Error; err != nil {
+		return err
+	}
+	return db.Model(&models.LetterOfCredit{}).
+		Where("id = ?", lc.ID).
+		Updates(map[string]interface{}{
+			"utilized_amount":  lc.UtilizedAmount,
+			"available_amount": lc.AvailableAmount,
+			"status":           lc.Status,
+			"updated_at":       lc.UpdatedAt,
+		}).Error
+}
+
+func (r *tradeRepositoryImpl) ListLCUtilizations(ctx context.Context, lcID uuid.UUID) ([]*models.LCUtilization, error) {
+	var utilizations []*models.LCUtilization
+	err := r.db.WithContext(ctx).
+		Where("lc_id = ?", lcID).
+		Order("utilized_at DESC").
+		Find(&utilizations).Error
+	return utilizations, err
+}
+
 // Exchange Rate Management
 
 func (r *tradeRepositoryImpl) GetLatestExchangeRate(ctx context.Context, fromCurrency, toCurrency string) (*models.ExchangeRate, error) {
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Transactor runs the work of several repositories in one database
+// transaction. Repositories join the transaction carried by the context fn
+// receives; calls outside fn run on their own.
+type Transactor interface {
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txKey struct{}
+
+type gormTransactor struct {
+	db *gorm.DB
+}
+
+// NewTransactor creates a new transactor
+func NewTransactor(db *gorm.DB) Transactor {
+	return &gormTransactor{db: db}
+}
+
+// Transaction commits when fn returns nil and rolls back otherwise. Called
+// inside another transaction, fn joins it.
+func (t *gormTransactor) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return fn(ctx)
+	}
+	return t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// dbFor returns the transaction carried by ctx, or db outside a transaction
+func dbFor(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
+
+// nextSequence returns the next number of a named sequence of a company.
+// floor is a query returning the highest number used before the sequence
+// existed; it only runs when the sequence is created. The sequence row stays
+// locked until the surrounding transaction ends, so numbers are never handed
+// out twice.
+func nextSequence(db *gorm.DB, companyID uuid.UUID, name string, floor *gorm.DB) (int64, error) {
+	var next int64
+	err := db.Raw(`INSERT INTO document_sequences (company_id, name, last_value, updated_at)
+		VALUES (?, ?, COALESCE((?), 0) + 1, NOW())
+		ON CONFLICT (company_id, name)
+		DO UPDATE SET last_value = document_sequences.last_value + 1, updated_at = NOW()
+		RETURNING last_value`, companyID, name, floor).
+		Scan(&next).Error
+	return next, err
+}
@@ -278,7 +278,7 @@ type TLSConfig struct {
 	CAFile         string
 	MinVersion     uint16
 	CipherSuites   []uint16
-	ClientAuthType int
+	ClientAuthType tls.ClientAuthType
 }
 
 // GetTLSConfig returns a secure TLS configuration
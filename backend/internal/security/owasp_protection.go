@@ -1,7 +1,6 @@
 package security
 
 import (
-	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
@@ -13,7 +12,6 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
-	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/time/rate"
 )
 
@@ -91,7 +89,7 @@ func (op *OWASPProtection) SQLInjectionProtection() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			// Check all query parameters
-			for key, values := range c.QueryParams() {
+			for _, values := range c.QueryParams() {
 				for _, value := range values {
 					if op.sqlInjectionRe.MatchString(value) {
 						return echo.NewHTTPError(http.StatusBadRequest, "Potential SQL injection detected")
@@ -273,7 +271,7 @@ func (sl *SecurityLogger) LogSecurityEvent(event SecurityEvent) {
 }
 
 func (sl *SecurityLogger) processEvents() {
-	for event := range sl.events {
+	for range sl.events {
 		// Write to secure log file
 		// Implement log rotation and encryption
 	}
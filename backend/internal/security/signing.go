@@ -0,0 +1,141 @@
+package security
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// XML signature method identifiers
+const (
+	SignatureRSASHA256  = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	SignatureHMACSHA256 = "http://www.w3.org/2001/04/xmldsig-more#hmac-sha256"
+)
+
+var (
+	// ErrInvalidSignature is returned when a signature does not match the data
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrNoSigningKey is returned when neither a private key file nor a
+	// signing secret is configured
+	ErrNoSigningKey = errors.New("no document signing key: set SIGNING_PRIVATE_KEY_FILE or SIGNING_SECRET")
+)
+
+// DocumentSigner signs the documents a company issues, such as e-invoices
+// and certificates, so their integrity can be verified later
+type DocumentSigner interface {
+	// KeyID identifies the key, so verifiers can pick the right one
+	KeyID() string
+	// Algorithm is the XML signature method of the signatures
+	Algorithm() string
+	Sign(data []byte) ([]byte, error)
+	Verify(data, signature []byte) error
+}
+
+// RSASigner signs with an RSA private key using PKCS #1 v1.5 and SHA-256
+type RSASigner struct {
+	key   *rsa.PrivateKey
+	keyID string
+}
+
+// NewRSASigner creates a signer from a PKCS #1 PEM encoded private key
+func NewRSASigner(privateKeyPEM string) (*RSASigner, error) {
+	key, err := parseRSAPrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse RSA private key: %w", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	return &RSASigner{key: key, keyID: "rsa-" + hex.EncodeToString(sum[:8])}, nil
+}
+
+func (s *RSASigner) KeyID() string     { return s.keyID }
+func (s *RSASigner) Algorithm() string { return SignatureRSASHA256 }
+
+func (s *RSASigner) Sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+}
+
+func (s *RSASigner) Verify(data, signature []byte) error {
+	digest := sha256.Sum256(data)
+	if err := rsa.VerifyPKCS1v15(&s.key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// PublicKeyPEM returns the public key for verification by third parties
+func (s *RSASigner) PublicKeyPEM() (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// HMACSigner signs with a shared secret using HMAC-SHA256. Only the holder
+// of the secret can verify its signatures.
+type HMACSigner struct {
+	key   []byte
+	keyID string
+}
+
+// NewHMACSigner derives a signing key from a secret. The derived key is
+// separate from other uses of the same secret.
+func NewHMACSigner(secret string) *HMACSigner {
+	key := sha256.Sum256([]byte("document-signing:" + secret))
+	id := sha256.Sum256(key[:])
+	return &HMACSigner{key: key[:], keyID: "hmac-" + hex.EncodeToString(id[:8])}
+}
+
+func (s *HMACSigner) KeyID() string     { return s.keyID }
+func (s *HMACSigner) Algorithm() string { return SignatureHMACSHA256 }
+
+func (s *HMACSigner) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (s *HMACSigner) Verify(data, signature []byte) error {
+	expected, _ := s.Sign(data)
+	if !hmac.Equal(expected, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// LoadDocumentSigner returns an RSA signer for the key in keyFile, or an
+// HMAC signer derived from secret when no key file is configured. The secret
+// is a signing secret of its own, never one used for other purposes such as
+// session tokens.
+func LoadDocumentSigner(keyFile, secret string) (DocumentSigner, error) {
+	if keyFile == "" {
+		if secret == "" {
+			return nil, ErrNoSigningKey
+		}
+		return NewHMACSigner(secret), nil
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key %s: %w", keyFile, err)
+	}
+	return NewRSASigner(string(keyPEM))
+}
+
+// PubliclyVerifiable reports whether third parties can verify the signatures
+// of signer without holding its secret
+func PubliclyVerifiable(signer DocumentSigner) bool {
+	return signer.Algorithm() == SignatureRSASHA256
+}
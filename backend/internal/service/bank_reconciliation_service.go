@@ -0,0 +1,858 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/bankstatement"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrBankAccountNotFound is returned when a bank account is not found
+	ErrBankAccountNotFound = errors.New("bank account not found")
+	// ErrBankStatementNotFound is returned when a bank statement is not found
+	ErrBankStatementNotFound = errors.New("bank statement not found")
+	// ErrBankStatementLineNotFound is returned when a statement line is not found
+	ErrBankStatementLineNotFound = errors.New("bank statement line not found")
+	// ErrInvalidBankStatement is returned when a statement file cannot be read
+	ErrInvalidBankStatement = errors.New("invalid bank statement")
+	// ErrDuplicateBankStatement is returned when every statement of a file was imported before
+	ErrDuplicateBankStatement = errors.New("bank statement already imported")
+	// ErrStatementCurrencyMismatch is returned when a statement is not in the bank account's currency
+	ErrStatementCurrencyMismatch = errors.New("statement currency differs from the bank account")
+	// ErrLineAlreadyReconciled is returned when reconciling or ignoring a closed line
+	ErrLineAlreadyReconciled = errors.New("bank statement line is already reconciled")
+	// ErrInvoiceNotFound is returned when an allocated invoice is not found
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	// ErrPaymentNotFound is returned when an allocated payment is not found
+	ErrPaymentNotFound = errors.New("payment not found")
+	// ErrInvalidReconciliation is returned when allocations do not fit the line or the items they settle
+	ErrInvalidReconciliation = errors.New("invalid reconciliation")
+)
+
+// Statement and line statuses
+const (
+	bankStatementOpen       = "open"
+	bankStatementReconciled = "reconciled"
+
+	bankLineUnmatched  = "unmatched"
+	bankLineSuggested  = "suggested"
+	bankLinePartial    = "partially_reconciled"
+	bankLineReconciled = "reconciled"
+	bankLineIgnored    = "ignored"
+)
+
+// Reconciliation allocation types
+const (
+	ReconcileInvoice   = "invoice"    // creates a completed payment for an open invoice
+	ReconcilePayment   = "payment"    // settles a pending payment
+	ReconcileOnAccount = "on_account" // over-payment or prepayment kept as a partner credit
+	ReconcileCharge    = "charge"     // fee deducted by the bank
+)
+
+// bankSuggestionLimit caps the suggestions stored per line
+const bankSuggestionLimit = 5
+
+// BankReconciliationService imports bank statements and reconciles their
+// lines against open invoices and pending payments
+type BankReconciliationService interface {
+	// Statements
+	ImportStatement(ctx context.Context, req ImportBankStatementRequest) (*BankStatementImportResult, error)
+	GetStatement(ctx context.Context, id uuid.UUID) (*models.BankStatement, error)
+	ListStatements(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.BankStatement, int64, error)
+
+	// Reconciliation workspace
+	GetLine(ctx context.Context, id uuid.UUID) (*models.BankStatementLine, error)
+	ListLines(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.BankStatementLine, int64, error)
+	RefreshSuggestions(ctx context.Context, lineID uuid.UUID) (*models.BankStatementLine, error)
+	AutoReconcile(ctx context.Context, statementID, userID uuid.UUID) (*BankStatementImportResult, error)
+	ReconcileLine(ctx context.Context, req ReconcileLineRequest) (*models.BankStatementLine, error)
+	IgnoreLine(ctx context.Context, lineID, userID uuid.UUID) (*models.BankStatementLine, error)
+}
+
+// ImportBankStatementRequest is an uploaded statement file of a bank account
+type ImportBankStatementRequest struct {
+	CompanyID     uuid.UUID
+	BankAccountID uuid.UUID
+	Format        string // camt053, mt940 or csv
+	FileName      string
+	Reader        io.Reader
+	Mapping       *bankstatement.CSVMapping // CSV columns; detected from the header when nil
+	AutoReconcile bool                      // apply confident exact suggestions right away
+	UserID        uuid.UUID
+}
+
+// BankStatementImportResult summarizes an import or auto-reconcile run
+type BankStatementImportResult struct {
+	Statements []*models.BankStatement `json:"statements"`
+	Lines      int                     `json:"lines"`
+	Duplicates int                     `json:"duplicates"` // statements imported before
+	Suggested  int                     `json:"suggested"`  // lines with at least one suggestion
+	Reconciled int                     `json:"reconciled"` // lines reconciled automatically
+	Errors     []string                `json:"errors,omitempty"`
+}
+
+// ReconcileLineRequest allocates a statement line. Allocations may cover the
+// line partially; the line stays open for the rest.
+type ReconcileLineRequest struct {
+	LineID      uuid.UUID             `json:"-"`
+	UserID      uuid.UUID             `json:"-"`
+	Allocations []ReconcileAllocation `json:"allocations"`
+}
+
+// ReconcileAllocation is the part of a line settling one item. Amount is
+// positive in the line currency.
+type ReconcileAllocation struct {
+	Type       string     `json:"type"` // invoice, payment, on_account, charge
+	InvoiceID  *uuid.UUID `json:"invoice_id"`
+	PaymentID  *uuid.UUID `json:"payment_id"`
+	CustomerID *uuid.UUID `json:"customer_id"` // on_account allocations of money received
+	SupplierID *uuid.UUID `json:"supplier_id"` // on_account allocations of money paid
+	Amount     float64    `json:"amount"`
+	Notes      string     `json:"notes"`
+}
+
+type bankReconciliationService struct {
+	repo        repository.BankStatementRepository
+	financeRepo repository.FinanceRepository
+	transactor  repository.Transactor
+	ledger      LedgerService
+}
+
+// NewBankReconciliationService creates a new bank reconciliation service
+func NewBankReconciliationService(repo repository.BankStatementRepository, financeRepo repository.FinanceRepository, transactor repository.Transactor, ledger LedgerService) BankReconciliationService {
+	return &bankReconciliationService{
+		repo:        repo,
+		financeRepo: financeRepo,
+		transactor:  transactor,
+		ledger:      ledger,
+	}
+}
+
+// Statements
+
+// ImportStatement parses a statement file, stores its statements with their
+// lines and suggests matches for every line. Statements imported before are
+// skipped. The bank account balance follows the latest closing balance.
+func (s *bankReconciliationService) ImportStatement(ctx context.Context, req ImportBankStatementRequest) (*BankStatementImportResult, error) {
+	account, err := s.bankAccount(req.CompanyID, req.BankAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(req.Reader)
+	if err != nil {
+		return nil, err
+	}
+	statements, err := bankstatement.Parse(req.Format, bytes.NewReader(data), req.Mapping)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBankStatement, err)
+	}
+	fileHash := sha256.Sum256(data)
+
+	currency := strings.ToUpper(account.Currency)
+	for _, parsed := range statements {
+		if parsed.Currency != "" && !strings.EqualFold(parsed.Currency, currency) {
+			return nil, fmt.Errorf("%w: %s, account is %s", ErrStatementCurrencyMismatch, parsed.Currency, account.Currency)
+		}
+	}
+
+	result := &BankStatementImportResult{}
+	for i, parsed := range statements {
+		hash := statementHash(fileHash[:], i, parsed.StatementNo)
+		if _, err := s.repo.FindStatementByHash(ctx, account.ID, hash); err == nil {
+			result.Duplicates++
+			continue
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+
+		statement := &models.BankStatement{
+			CompanyID:      req.CompanyID,
+			BankAccountID:  account.ID,
+			Format:         strings.ToLower(req.Format),
+			StatementNo:    parsed.StatementNo,
+			FromDate:       parsed.FromDate,
+			ToDate:         parsed.ToDate,
+			Currency:       currency,
+			OpeningBalance: parsed.OpeningBalance,
+			ClosingBalance: parsed.ClosingBalance,
+			HasBalances:    parsed.HasBalances,
+			LineCount:      len(parsed.Lines),
+			FileName:       req.FileName,
+			FileHash:       hash,
+			Status:         bankStatementOpen,
+			ImportedBy:     req.UserID,
+		}
+		for n, l := range parsed.Lines {
+			lineCurrency := strings.ToUpper(l.Currency)
+			if lineCurrency == "" {
+				lineCurrency = currency
+			}
+			statement.Lines = append(statement.Lines, models.BankStatementLine{
+				CompanyID:           req.CompanyID,
+				BankAccountID:       account.ID,
+				LineNo:              n + 1,
+				BookingDate:         l.BookingDate,
+				ValueDate:           l.ValueDate,
+				Amount:              l.Amount,
+				Currency:            lineCurrency,
+				Reference:           l.Reference,
+				BankReference:       l.BankReference,
+				Description:         l.Description,
+				CounterpartyName:    l.CounterpartyName,
+				CounterpartyAccount: l.CounterpartyAccount,
+				Status:              bankLineUnmatched,
+			})
+		}
+		if len(statement.Lines) == 0 {
+			statement.Status = bankStatementReconciled
+		}
+		if err := s.repo.CreateStatement(ctx, statement); err != nil {
+			return nil, err
+		}
+		result.Statements = append(result.Statements, statement)
+		result.Lines += len(statement.Lines)
+	}
+	if len(result.Statements) == 0 {
+		return nil, ErrDuplicateBankStatement
+	}
+
+	for _, statement := range result.Statements {
+		if err := s.matchStatement(ctx, statement, req.AutoReconcile, req.UserID, result); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.syncBalance(ctx, account); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// statementHash identifies a statement by the file it came from and its
+// position and number in the file
+func statementHash(fileHash []byte, index int, statementNo string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%x:%d:%s", fileHash, index, statementNo)))
+	return hex.EncodeToString(sum[:])
+}
+
+// syncBalance sets the bank account balance to the closing balance of its
+// latest statement with balances
+func (s *bankReconciliationService) syncBalance(ctx context.Context, account *models.BankAccount) error {
+	latest, err := s.repo.LatestStatement(ctx, account.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if account.CurrentBalance == latest.ClosingBalance {
+		return nil
+	}
+	account.CurrentBalance = latest.ClosingBalance
+	account.AvailableBalance = latest.ClosingBalance
+	return s.financeRepo.UpdateBankAccount(account)
+}
+
+func (s *bankReconciliationService) GetStatement(ctx context.Context, id uuid.UUID) (*models.BankStatement, error) {
+	statement, err := s.repo.GetStatement(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrBankStatementNotFound
+		}
+		return nil, err
+	}
+	return statement, nil
+}
+
+func (s *bankReconciliationService) ListStatements(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.BankStatement, int64, error) {
+	return s.repo.ListStatements(ctx, companyID, params)
+}
+
+// Reconciliation workspace
+
+func (s *bankReconciliationService) GetLine(ctx context.Context, id uuid.UUID) (*models.BankStatementLine, error) {
+	line, err := s.repo.GetLine(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrBankStatementLineNotFound
+		}
+		return nil, err
+	}
+	return line, nil
+}
+
+func (s *bankReconciliationService) ListLines(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.BankStatementLine, int64, error) {
+	return s.repo.ListLines(ctx, companyID, params)
+}
+
+// RefreshSuggestions matches an open line again against the current open
+// items, e.g. after invoices were issued or payments recorded
+func (s *bankReconciliationService) RefreshSuggestions(ctx context.Context, lineID uuid.UUID) (*models.BankStatementLine, error) {
+	line, err := s.GetLine(ctx, lineID)
+	if err != nil {
+		return nil, err
+	}
+	if line.Status == bankLineReconciled || line.Status == bankLineIgnored {
+		return nil, ErrLineAlreadyReconciled
+	}
+	candidates, err := s.candidates(ctx, line.CompanyID, line.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.suggest(ctx, line, candidates); err != nil {
+		return nil, err
+	}
+	return line, nil
+}
+
+// AutoReconcile matches the open lines of a statement again and reconciles
+// those with a confident suggestion covering the open amount exactly
+func (s *bankReconciliationService) AutoReconcile(ctx context.Context, statementID, userID uuid.UUID) (*BankStatementImportResult, error) {
+	statement, err := s.GetStatement(ctx, statementID)
+	if err != nil {
+		return nil, err
+	}
+	result := &BankStatementImportResult{Statements: []*models.BankStatement{statement}, Lines: len(statement.Lines)}
+	if err := s.matchStatement(ctx, statement, true, userID, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// matchStatement stores suggestions for the open lines of a statement and,
+// with auto set, reconciles the confident ones. Candidates are reloaded after
+// each reconciliation so one invoice is not settled twice.
+func (s *bankReconciliationService) matchStatement(ctx context.Context, statement *models.BankStatement, auto bool, userID uuid.UUID, result *BankStatementImportResult) error {
+	candidates, err := s.candidates(ctx, statement.CompanyID, statement.Currency)
+	if err != nil {
+		return err
+	}
+	for i := range statement.Lines {
+		line := &statement.Lines[i]
+		if line.Status == bankLineReconciled || line.Status == bankLineIgnored {
+			continue
+		}
+		suggestions, err := s.suggest(ctx, line, candidates)
+		if err != nil {
+			return err
+		}
+		if len(suggestions) == 0 {
+			continue
+		}
+		result.Suggested++
+
+		best := suggestions[0]
+		if !auto || !best.AutoReconcilable() || line.ReconciledAmount > 0 {
+			continue
+		}
+		req := ReconcileLineRequest{LineID: line.ID, UserID: userID}
+		for _, a := range best.Allocations {
+			id, err := uuid.Parse(a.CandidateID)
+			if err != nil {
+				return err
+			}
+			allocation := ReconcileAllocation{Type: a.Kind, Amount: a.Amount, Notes: "auto-reconciled: " + strings.Join(best.Reasons, "; ")}
+			if a.Kind == bankstatement.KindInvoice {
+				allocation.InvoiceID = &id
+			} else {
+				allocation.PaymentID = &id
+			}
+			req.Allocations = append(req.Allocations, allocation)
+		}
+		reconciled, err := s.ReconcileLine(ctx, req)
+		if err != nil {
+			// A line that cannot be settled automatically stays for review
+			result.Errors = append(result.Errors, fmt.Sprintf("line %d: %v", line.LineNo, err))
+			continue
+		}
+		*line = *reconciled
+		result.Reconciled++
+
+		if candidates, err = s.candidates(ctx, statement.CompanyID, statement.Currency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// suggest stores the suggestions for the open part of a line
+func (s *bankReconciliationService) suggest(ctx context.Context, line *models.BankStatementLine, candidates []bankstatement.Candidate) ([]bankstatement.Suggestion, error) {
+	open := math.Abs(line.Amount) - line.ReconciledAmount
+	input := bankstatement.Line{
+		Amount:           math.Copysign(open, line.Amount),
+		Currency:         line.Currency,
+		Reference:        line.Reference,
+		BankReference:    line.BankReference,
+		Description:      line.Description,
+		CounterpartyName: line.CounterpartyName,
+	}
+	suggestions := bankstatement.Suggest(input, candidates, bankSuggestionLimit)
+
+	encoded, err := json.Marshal(suggestions)
+	if err != nil {
+		return nil, err
+	}
+	line.Suggestions = datatypes.JSON(encoded)
+	if line.Status == bankLineUnmatched || line.Status == bankLineSuggested {
+		line.Status = bankLineUnmatched
+		if len(suggestions) > 0 {
+			line.Status = bankLineSuggested
+		}
+	}
+	if err := s.repo.UpdateLine(ctx, line); err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
+
+// candidates lists the open invoices and pending payments a line in the
+// currency may settle
+func (s *bankReconciliationService) candidates(ctx context.Context, companyID uuid.UUID, currency string) ([]bankstatement.Candidate, error) {
+	invoices, err := s.repo.ListOpenInvoices(ctx, companyID, currency)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := s.repo.ListPendingPayments(ctx, companyID, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]bankstatement.Candidate, 0, len(invoices)+len(payments))
+	for _, invoice := range invoices {
+		c := bankstatement.Candidate{
+			ID:       invoice.ID.String(),
+			Kind:     bankstatement.KindInvoice,
+			Number:   invoice.InvoiceNo,
+			Amount:   invoice.BalanceAmount,
+			Currency: invoice.Currency,
+			Date:     invoice.DueDate,
+			Incoming: invoiceIncoming(invoice),
+		}
+		c.Partner, c.PartnerID = partnerOf(invoice.Customer, invoice.Supplier, invoice.CustomerID, invoice.SupplierID)
+		candidates = append(candidates, c)
+	}
+	for _, payment := range payments {
+		reconciled, err := s.repo.SumReconciledForPayment(ctx, payment.ID)
+		if err != nil {
+			return nil, err
+		}
+		c := bankstatement.Candidate{
+			ID:        payment.ID.String(),
+			Kind:      bankstatement.KindPayment,
+			Number:    payment.PaymentNo,
+			Reference: firstNonBlank(payment.TransactionNo, payment.CheckNo),
+			Amount:    payment.Amount - reconciled,
+			Currency:  payment.Currency,
+			Date:      payment.PaymentDate,
+			Incoming:  payment.Type != "outgoing",
+		}
+		// Remittance text names the invoice rather than our payment number
+		if payment.Invoice != nil {
+			c.Reference = payment.Invoice.InvoiceNo
+		}
+		c.Partner, c.PartnerID = partnerOf(payment.Customer, payment.Supplier, payment.CustomerID, payment.SupplierID)
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// invoiceIncoming reports whether settling the invoice brings money in,
+// following the sales and purchase split of ledger posting
+func invoiceIncoming(invoice *models.Invoice) bool {
+	purchase := invoice.Type == "purchase" || (invoice.Type != "sales" && invoice.SupplierID != nil && invoice.CustomerID == nil)
+	incoming := !purchase
+	if invoice.Type == "credit_note" {
+		incoming = !incoming
+	}
+	return incoming
+}
+
+func partnerOf(customer *models.Customer, supplier *models.Supplier, customerID, supplierID *uuid.UUID) (string, string) {
+	switch {
+	case customer != nil:
+		return customer.Name, customer.ID.String()
+	case supplier != nil:
+		return supplier.Name, supplier.ID.String()
+	case customerID != nil:
+		return "", customerID.String()
+	case supplierID != nil:
+		return "", supplierID.String()
+	}
+	return "", ""
+}
+
+func firstNonBlank(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ReconcileLine applies allocations to a line. Invoice and on-account
+// allocations create completed payments, payment allocations complete the
+// pending payment once fully matched, and charges book the bank fee. The
+// allocations may not exceed the open amount of the line; fees reduce what
+// is left of money received and add to money paid out. The line and the
+// allocated invoices and payments are locked while the allocations are
+// checked and applied, so concurrent reconciliations cannot both settle the
+// same open amount.
+func (s *bankReconciliationService) ReconcileLine(ctx context.Context, req ReconcileLineRequest) (*models.BankStatementLine, error) {
+	if len(req.Allocations) == 0 {
+		return nil, fmt.Errorf("%w: no allocations", ErrInvalidReconciliation)
+	}
+	for i := range req.Allocations {
+		a := &req.Allocations[i]
+		a.Amount = math.Round(a.Amount*100) / 100
+		if a.Amount <= 0 {
+			return nil, fmt.Errorf("%w: allocation amounts must be positive", ErrInvalidReconciliation)
+		}
+	}
+
+	err := s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		line, err := s.repo.LockLine(ctx, req.LineID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrBankStatementLineNotFound
+			}
+			return err
+		}
+		if line.Status == bankLineReconciled || line.Status == bankLineIgnored {
+			return ErrLineAlreadyReconciled
+		}
+		account, err := s.bankAccount(line.CompanyID, line.BankAccountID)
+		if err != nil {
+			return err
+		}
+
+		incoming := line.Amount > 0
+		open := math.Abs(line.Amount) - line.ReconciledAmount
+		var effect float64
+		invoices := make(map[uuid.UUID]*models.Invoice)
+		payments := make(map[uuid.UUID]*models.Payment)
+		allocated := make(map[uuid.UUID]float64)
+		for i := range req.Allocations {
+			a := &req.Allocations[i]
+			switch a.Type {
+			case ReconcileInvoice:
+				invoice, err := s.allocatedInvoice(ctx, line, a, allocated, incoming)
+				if err != nil {
+					return err
+				}
+				invoices[invoice.ID] = invoice
+				effect += a.Amount
+			case ReconcilePayment:
+				payment, err := s.allocatedPayment(ctx, line, a, allocated, incoming)
+				if err != nil {
+					return err
+				}
+				payments[payment.ID] = payment
+				effect += a.Amount
+			case ReconcileOnAccount:
+				if (incoming && a.CustomerID == nil) || (!incoming && a.SupplierID == nil) {
+					return fmt.Errorf("%w: on-account allocations need the customer of money received or the supplier of money paid", ErrInvalidReconciliation)
+				}
+				effect += a.Amount
+			case ReconcileCharge:
+				if incoming {
+					effect -= a.Amount
+				} else {
+					effect += a.Amount
+				}
+			default:
+				return fmt.Errorf("%w: unknown allocation type %q", ErrInvalidReconciliation, a.Type)
+			}
+		}
+		effect = math.Round(effect*100) / 100
+		if effect <= 0 || effect > open+0.005 {
+			return fmt.Errorf("%w: allocations settle %.2f of an open %.2f", ErrInvalidReconciliation, effect, open)
+		}
+
+		if err := s.ledger.EnsurePeriodOpen(ctx, line.CompanyID, line.BookingDate); err != nil {
+			return err
+		}
+
+		for _, a := range req.Allocations {
+			reconciliation := &models.BankReconciliation{
+				CompanyID: line.CompanyID,
+				LineID:    line.ID,
+				Type:      a.Type,
+				Amount:    a.Amount,
+				Notes:     a.Notes,
+				CreatedBy: req.UserID,
+			}
+			switch a.Type {
+			case ReconcileInvoice:
+				invoice := invoices[*a.InvoiceID]
+				payment, err := s.linePayment(ctx, line, account, a.Amount, req.UserID)
+				if err != nil {
+					return err
+				}
+				payment.InvoiceID = &invoice.ID
+				payment.CustomerID, payment.SupplierID = invoice.CustomerID, invoice.SupplierID
+				payment.Notes = fmt.Sprintf("Bank statement line %s", lineLabel(line))
+				if err := s.completePayment(ctx, payment, true); err != nil {
+					return err
+				}
+				reconciliation.InvoiceID = &invoice.ID
+				reconciliation.PaymentID = &payment.ID
+				reconciliation.CustomerID, reconciliation.SupplierID = invoice.CustomerID, invoice.SupplierID
+			case ReconcilePayment:
+				payment := payments[*a.PaymentID]
+				reconciliation.PaymentID = &payment.ID
+				reconciliation.InvoiceID = payment.InvoiceID
+				reconciliation.CustomerID, reconciliation.SupplierID = payment.CustomerID, payment.SupplierID
+			case ReconcileOnAccount:
+				payment, err := s.linePayment(ctx, line, account, a.Amount, req.UserID)
+				if err != nil {
+					return err
+				}
+				if incoming {
+					payment.CustomerID = a.CustomerID
+				} else {
+					payment.SupplierID = a.SupplierID
+				}
+				payment.Notes = fmt.Sprintf("On account from bank statement line %s", lineLabel(line))
+				if err := s.completePayment(ctx, payment, true); err != nil {
+					return err
+				}
+				reconciliation.PaymentID = &payment.ID
+				reconciliation.CustomerID, reconciliation.SupplierID = payment.CustomerID, payment.SupplierID
+			}
+
+			if err := s.repo.CreateReconciliation(ctx, reconciliation); err != nil {
+				return err
+			}
+
+			switch a.Type {
+			case ReconcilePayment:
+				payment := payments[*a.PaymentID]
+				settled, err := s.repo.SumReconciledForPayment(ctx, payment.ID)
+				if err != nil {
+					return err
+				}
+				if settled >= payment.Amount-0.005 {
+					if err := s.completePayment(ctx, payment, false); err != nil {
+						return err
+					}
+				}
+			case ReconcileCharge:
+				if _, err := s.ledger.PostBankCharge(ctx, reconciliation, line); err != nil {
+					return err
+				}
+			}
+		}
+
+		now := time.Now()
+		line.ReconciledAmount = math.Round((line.ReconciledAmount+effect)*100) / 100
+		line.Status = bankLinePartial
+		if line.ReconciledAmount >= math.Abs(line.Amount)-0.005 {
+			line.Status = bankLineReconciled
+		}
+		line.ReconciledAt = &now
+		line.ReconciledBy = &req.UserID
+		if err := s.repo.UpdateLine(ctx, line); err != nil {
+			return err
+		}
+		return s.closeStatement(ctx, line.StatementID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetLine(ctx, req.LineID)
+}
+
+// allocatedInvoice locks the invoice of an allocation and checks it: same
+// company and currency, the direction of the line and no more than the open
+// balance, counting earlier allocations of the request. Paying more than an
+// invoice is open needs an on-account allocation for the rest.
+func (s *bankReconciliationService) allocatedInvoice(ctx context.Context, line *models.BankStatementLine, a *ReconcileAllocation, allocated map[uuid.UUID]float64, incoming bool) (*models.Invoice, error) {
+	if a.InvoiceID == nil {
+		return nil, fmt.Errorf("%w: invoice allocation without invoice_id", ErrInvalidReconciliation)
+	}
+	invoice, err := s.repo.LockInvoice(ctx, *a.InvoiceID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, err
+	}
+	allocated[invoice.ID] += a.Amount
+	switch {
+	case invoice.CompanyID != line.CompanyID:
+		return nil, ErrInvoiceNotFound
+	case !strings.EqualFold(invoice.Currency, line.Currency):
+		return nil, fmt.Errorf("%w: invoice %s is in %s, the line in %s", ErrInvalidReconciliation, invoice.InvoiceNo, invoice.Currency, line.Currency)
+	case invoiceIncoming(invoice) != incoming:
+		return nil, fmt.Errorf("%w: invoice %s is settled in the other direction", ErrInvalidReconciliation, invoice.InvoiceNo)
+	case invoice.Status == "draft" || invoice.Status == "cancelled":
+		return nil, fmt.Errorf("%w: invoice %s is %s", ErrInvalidReconciliation, invoice.InvoiceNo, invoice.Status)
+	case allocated[invoice.ID] > invoice.BalanceAmount+0.005:
+		return nil, fmt.Errorf("%w: %.2f exceeds the open %.2f of invoice %s", ErrInvalidReconciliation, allocated[invoice.ID], invoice.BalanceAmount, invoice.InvoiceNo)
+	}
+	return invoice, nil
+}
+
+// allocatedPayment locks the pending payment of an allocation and checks the
+// allocation against what is still open of it, counting earlier allocations
+// of the request
+func (s *bankReconciliationService) allocatedPayment(ctx context.Context, line *models.BankStatementLine, a *ReconcileAllocation, allocated map[uuid.UUID]float64, incoming bool) (*models.Payment, error) {
+	if a.PaymentID == nil {
+		return nil, fmt.Errorf("%w: payment allocation without payment_id", ErrInvalidReconciliation)
+	}
+	payment, err := s.repo.LockPayment(ctx, *a.PaymentID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, err
+	}
+	switch {
+	case payment.CompanyID != line.CompanyID:
+		return nil, ErrPaymentNotFound
+	case payment.Status != "pending":
+		return nil, fmt.Errorf("%w: payment %s is %s", ErrInvalidReconciliation, payment.PaymentNo, payment.Status)
+	case !strings.EqualFold(payment.Currency, line.Currency):
+		return nil, fmt.Errorf("%w: payment %s is in %s, the line in %s", ErrInvalidReconciliation, payment.PaymentNo, payment.Currency, line.Currency)
+	case (payment.Type != "outgoing") != incoming:
+		return nil, fmt.Errorf("%w: payment %s is in the other direction", ErrInvalidReconciliation, payment.PaymentNo)
+	}
+	settled, err := s.repo.SumReconciledForPayment(ctx, payment.ID)
+	if err != nil {
+		return nil, err
+	}
+	allocated[payment.ID] += a.Amount
+	if allocated[payment.ID] > payment.Amount-settled+0.005 {
+		return nil, fmt.Errorf("%w: %.2f exceeds the open %.2f of payment %s", ErrInvalidReconciliation, allocated[payment.ID], payment.Amount-settled, payment.PaymentNo)
+	}
+	return payment, nil
+}
+
+// linePayment prepares the payment recording money moved on a statement
+// line, at the rate of the booking date
+func (s *bankReconciliationService) linePayment(ctx context.Context, line *models.BankStatementLine, account *models.BankAccount, amount float64, userID uuid.UUID) (*models.Payment, error) {
+	rate, err := s.ledger.BaseRate(ctx, line.CompanyID, line.Currency, line.BookingDate)
+	if err != nil {
+		return nil, err
+	}
+	paymentNo, err := nextPaymentNo(s.financeRepo.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	paymentType := "incoming"
+	if line.Amount < 0 {
+		paymentType = "outgoing"
+	}
+	return &models.Payment{
+		CompanyID:     line.CompanyID,
+		PaymentNo:     paymentNo,
+		Type:          paymentType,
+		PaymentDate:   line.BookingDate,
+		Amount:        amount,
+		Currency:      line.Currency,
+		ExchangeRate:  rate,
+		PaymentMethod: "bank_transfer",
+		BankName:      account.BankName,
+		BankAccount:   account.AccountNo,
+		TransactionNo: firstNonBlank(line.BankReference, line.Reference),
+		CreatedBy:     userID,
+	}, nil
+}
+
+// completePayment creates a new payment as completed, or completes a pending
+// one, applying it to its invoice, and posts it to the ledger. Run it inside
+// the reconciliation's transaction.
+func (s *bankReconciliationService) completePayment(ctx context.Context, payment *models.Payment, create bool) error {
+	financeRepo := s.financeRepo.WithContext(ctx)
+	if create {
+		payment.Status = "completed"
+		if err := financeRepo.CreatePayment(payment); err != nil {
+			return err
+		}
+	} else if err := financeRepo.CompletePayment(payment); err != nil {
+		if errors.Is(err, repository.ErrPaymentNotPending) {
+			return fmt.Errorf("%w: payment %s is no longer pending", ErrInvalidReconciliation, payment.PaymentNo)
+		}
+		return err
+	}
+	_, err := s.ledger.PostPayment(ctx, payment)
+	return err
+}
+
+// closeStatement marks a statement reconciled once no line is left open
+func (s *bankReconciliationService) closeStatement(ctx context.Context, statementID uuid.UUID) error {
+	open, err := s.repo.CountOpenLines(ctx, statementID)
+	if err != nil || open > 0 {
+		return err
+	}
+	statement, err := s.repo.GetStatement(ctx, statementID)
+	if err != nil {
+		return err
+	}
+	if statement.Status == bankStatementReconciled {
+		return nil
+	}
+	statement.Status = bankStatementReconciled
+	return s.repo.UpdateStatement(ctx, statement)
+}
+
+// IgnoreLine closes a line that settles nothing in the books, such as a
+// transfer between own accounts booked elsewhere
+func (s *bankReconciliationService) IgnoreLine(ctx context.Context, lineID, userID uuid.UUID) (*models.BankStatementLine, error) {
+	line, err := s.GetLine(ctx, lineID)
+	if err != nil {
+		return nil, err
+	}
+	if line.Status == bankLineReconciled || line.Status == bankLineIgnored || line.ReconciledAmount > 0 {
+		return nil, ErrLineAlreadyReconciled
+	}
+	now := time.Now()
+	line.Status = bankLineIgnored
+	line.ReconciledAt = &now
+	line.ReconciledBy = &userID
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.UpdateLine(ctx, line); err != nil {
+			return err
+		}
+		return s.closeStatement(ctx, line.StatementID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return line, nil
+}
+
+func (s *bankReconciliationService) bankAccount(companyID, id uuid.UUID) (*models.BankAccount, error) {
+	account, err := s.financeRepo.GetBankAccount(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBankAccountNotFound
+		}
+		return nil, err
+	}
+	if account.CompanyID != companyID {
+		return nil, ErrBankAccountNotFound
+	}
+	return account, nil
+}
+
+func lineLabel(line *models.BankStatementLine) string {
+	return fmt.Sprintf("%d (%s)", line.LineNo, line.BookingDate.Format("2006-01-02"))
+}
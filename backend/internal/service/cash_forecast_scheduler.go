@@ -0,0 +1,25 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/repository"
+)
+
+// NewCashForecastScheduler creates a runner that stores the weekly base
+// forecast snapshots forecast accuracy is measured against. It checks for
+// due snapshots every interval.
+func NewCashForecastScheduler(forecast CashForecastService, runs repository.JobRunRepository, interval time.Duration) *PeriodicRunner {
+	return NewPeriodicRunner("cash-forecast-scheduler", interval, runs, func(ctx context.Context) error {
+		result, err := forecast.SnapshotWeekly(ctx)
+		if err != nil {
+			return err
+		}
+		if result != nil && len(result.Errors) > 0 {
+			log.Printf("cash forecast snapshot: %d snapshots, %d errors, first: %s", result.Snapshots, len(result.Errors), result.Errors[0])
+		}
+		return nil
+	})
+}
@@ -0,0 +1,721 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/cashforecast"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrRecurringExpenseNotFound is returned when a recurring expense is not found
+	ErrRecurringExpenseNotFound = errors.New("recurring expense not found")
+	// ErrCashForecastScenarioNotFound is returned when a forecast scenario is not found
+	ErrCashForecastScenarioNotFound = errors.New("cash forecast scenario not found")
+	// ErrCashForecastSnapshotNotFound is returned when a forecast snapshot is not found
+	ErrCashForecastSnapshotNotFound = errors.New("cash forecast snapshot not found")
+	// ErrInvalidRecurringExpense is returned when a recurring expense has no
+	// name, amount, currency, start date or a known frequency
+	ErrInvalidRecurringExpense = errors.New("recurring expense needs a name, positive amount, currency, start date and frequency")
+	// ErrInvalidCashForecastScenario is returned when a scenario has no name,
+	// scales an unknown source or has an incomplete adjustment
+	ErrInvalidCashForecastScenario = errors.New("invalid cash forecast scenario")
+)
+
+// Forecast assumptions for documents without dates of their own
+const (
+	// forecastDefaultTermsDays applies to orders and purchase orders whose
+	// payment terms name no number of days
+	forecastDefaultTermsDays = 30
+	// forecastDownPaymentDays is how long after confirmation a down payment
+	// is expected
+	forecastDownPaymentDays = 7
+	// forecastLCSightDays and forecastLCUsanceDays are the usual times from
+	// presentation to payment under sight and usance credits
+	forecastLCSightDays  = 7
+	forecastLCUsanceDays = 90
+	// forecastHistoryDays is the payment history used to learn how late
+	// each customer pays
+	forecastHistoryDays = 365
+)
+
+// CashForecastService forecasts cash per currency for the next 13 weeks
+// from open receivables and payables, orders, purchase orders, recurring
+// expenses and letter of credit drawings, and tracks how accurate earlier
+// forecasts were
+type CashForecastService interface {
+	// Forecast
+	GetForecast(ctx context.Context, req CashForecastRequest) (*CashForecast, error)
+
+	// Recurring expenses
+	CreateRecurringExpense(ctx context.Context, companyID, userID uuid.UUID, req RecurringExpenseRequest) (*models.RecurringExpense, error)
+	UpdateRecurringExpense(ctx context.Context, id, userID uuid.UUID, req RecurringExpenseRequest) (*models.RecurringExpense, error)
+	GetRecurringExpense(ctx context.Context, id uuid.UUID) (*models.RecurringExpense, error)
+	ListRecurringExpenses(ctx context.Context, companyID uuid.UUID) ([]*models.RecurringExpense, error)
+
+	// Scenarios
+	CreateScenario(ctx context.Context, companyID, userID uuid.UUID, req CashForecastScenarioRequest) (*models.CashForecastScenario, error)
+	UpdateScenario(ctx context.Context, id, userID uuid.UUID, req CashForecastScenarioRequest) (*models.CashForecastScenario, error)
+	GetScenario(ctx context.Context, id uuid.UUID) (*models.CashForecastScenario, error)
+	ListScenarios(ctx context.Context, companyID uuid.UUID) ([]*models.CashForecastScenario, error)
+
+	// Snapshots and accuracy
+	TakeSnapshot(ctx context.Context, req CashForecastRequest, userID *uuid.UUID) (*models.CashForecastSnapshot, error)
+	SnapshotWeekly(ctx context.Context) (*CashForecastSnapshotRun, error)
+	GetSnapshot(ctx context.Context, id uuid.UUID) (*models.CashForecastSnapshot, error)
+	ListSnapshots(ctx context.Context, params map[string]interface{}) ([]*models.CashForecastSnapshot, int64, error)
+	GetAccuracy(ctx context.Context, snapshotID uuid.UUID, through time.Time) (*CashForecastAccuracy, error)
+}
+
+type CashForecastRequest struct {
+	CompanyID    uuid.UUID  `json:"-"`
+	ScenarioID   *uuid.UUID `json:"scenario_id"` // nil for the base forecast
+	AsOf         time.Time  `json:"as_of"`       // defaults to today
+	IncludeFlows bool       `json:"include_flows"`
+}
+
+// CashForecast is the 13-week forecast per currency, with the weekly totals
+// converted to the base currency
+type CashForecast struct {
+	AsOf         time.Time               `json:"as_of"`
+	WeekStart    time.Time               `json:"week_start"`
+	ScenarioID   *uuid.UUID              `json:"scenario_id"`
+	ScenarioName string                  `json:"scenario_name"`
+	BaseCurrency string                  `json:"base_currency"`
+	Currencies   []cashforecast.Forecast `json:"currencies"`
+	Base         []CashForecastBaseWeek  `json:"base"`
+	Flows        []cashforecast.Flow     `json:"flows,omitempty"`
+	Warnings     []string                `json:"warnings,omitempty"`
+}
+
+// CashForecastBaseWeek totals a week across currencies in the base currency
+type CashForecastBaseWeek struct {
+	Start    time.Time `json:"start"`
+	Inflows  float64   `json:"inflows"`
+	Outflows float64   `json:"outflows"`
+	Net      float64   `json:"net"`
+	Closing  float64   `json:"closing"`
+}
+
+type RecurringExpenseRequest struct {
+	Name      string     `json:"name"`
+	Category  string     `json:"category"`
+	Amount    float64    `json:"amount"`
+	Currency  string     `json:"currency"`
+	Frequency string     `json:"frequency"`
+	StartDate time.Time  `json:"start_date"`
+	EndDate   *time.Time `json:"end_date"`
+	IsActive  *bool      `json:"is_active"`
+}
+
+type CashForecastScenarioRequest struct {
+	Name             string                    `json:"name"`
+	Description      string                    `json:"description"`
+	ReceiptDelayDays int                       `json:"receipt_delay_days"`
+	PaymentDelayDays int                       `json:"payment_delay_days"`
+	Factors          map[string]float64        `json:"factors"`
+	Adjustments      []cashforecast.Adjustment `json:"adjustments"`
+	IsActive         *bool                     `json:"is_active"`
+}
+
+type CashForecastSnapshotRun struct {
+	WeekStart time.Time `json:"week_start"`
+	Companies int       `json:"companies"`
+	Snapshots int       `json:"snapshots"`
+	Errors    []string  `json:"errors,omitempty"`
+}
+
+// CashForecastAccuracy compares a snapshot with the payments made in the
+// weeks it forecast
+type CashForecastAccuracy struct {
+	Snapshot *models.CashForecastSnapshot `json:"snapshot"`
+	Through  time.Time                    `json:"through"`
+	cashforecast.Accuracy
+}
+
+type cashForecastService struct {
+	forecastRepo repository.CashForecastRepository
+	ledger       LedgerService
+}
+
+// NewCashForecastService creates a new cash forecast service
+func NewCashForecastService(forecastRepo repository.CashForecastRepository, ledger LedgerService) CashForecastService {
+	return &cashForecastService{
+		forecastRepo: forecastRepo,
+		ledger:       ledger,
+	}
+}
+
+// Forecast
+
+// GetForecast builds the forecast as of a date, under a scenario when one
+// is given
+func (s *cashForecastService) GetForecast(ctx context.Context, req CashForecastRequest) (*CashForecast, error) {
+	asOf := req.AsOf
+	if asOf.IsZero() {
+		asOf = time.Now()
+	}
+	asOf = time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+
+	result := &CashForecast{
+		AsOf:         asOf,
+		WeekStart:    cashforecast.WeekStart(asOf),
+		ScenarioName: "Base",
+		BaseCurrency: ledgerBaseCurrency,
+	}
+
+	flows, err := s.collectFlows(ctx, req.CompanyID, asOf)
+	if err != nil {
+		return nil, err
+	}
+	if req.ScenarioID != nil {
+		scenario, err := s.GetScenario(ctx, *req.ScenarioID)
+		if err != nil {
+			return nil, err
+		}
+		if scenario.CompanyID != req.CompanyID {
+			return nil, ErrCashForecastScenarioNotFound
+		}
+		flows = scenarioOf(scenario).Apply(flows)
+		result.ScenarioID = &scenario.ID
+		result.ScenarioName = scenario.Name
+	}
+
+	accounts, err := s.forecastRepo.ListBankAccounts(ctx, req.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	opening := map[string]float64{}
+	for _, account := range accounts {
+		opening[strings.ToUpper(account.Currency)] += account.CurrentBalance
+	}
+
+	result.Currencies = cashforecast.Build(asOf, opening, flows)
+	result.Base, result.Warnings = s.baseTotals(ctx, req.CompanyID, asOf, result.Currencies)
+	if req.IncludeFlows {
+		sort.Slice(flows, func(i, j int) bool { return flows[i].Date.Before(flows[j].Date) })
+		result.Flows = flows
+	}
+	return result, nil
+}
+
+// collectFlows gathers the expected receipts and payments of a company
+func (s *cashForecastService) collectFlows(ctx context.Context, companyID uuid.UUID, asOf time.Time) ([]cashforecast.Flow, error) {
+	weekStart := cashforecast.WeekStart(asOf)
+	horizon := weekStart.AddDate(0, 0, 7*cashforecast.Weeks)
+	var flows []cashforecast.Flow
+
+	// How late each customer pays, from a year of payments
+	settlements, err := s.forecastRepo.ListSettlements(ctx, companyID, asOf.AddDate(0, 0, -forecastHistoryDays))
+	if err != nil {
+		return nil, err
+	}
+	history := map[uuid.UUID][]cashforecast.Settlement{}
+	for _, st := range settlements {
+		history[st.CustomerID] = append(history[st.CustomerID], cashforecast.Settlement{
+			DueDate:  st.DueDate,
+			PaidDate: st.PaymentDate,
+			Amount:   st.Amount,
+		})
+	}
+	delays := map[uuid.UUID]float64{}
+	for customerID, h := range history {
+		if days, ok := cashforecast.AverageDelay(h); ok {
+			delays[customerID] = days
+		}
+	}
+
+	// Open receivables, shifted by the customer's payment behaviour
+	invoices, err := s.forecastRepo.ListOpenReceivables(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, inv := range invoices {
+		var delay float64
+		if inv.CustomerID != nil {
+			delay = delays[*inv.CustomerID]
+		}
+		flows = append(flows, cashforecast.Flow{
+			Source:    cashforecast.SourceReceivable,
+			Reference: inv.InvoiceNo,
+			Currency:  inv.Currency,
+			Date:      cashforecast.ExpectedDate(inv.DueDate, delay, asOf),
+			Amount:    inv.BalanceAmount,
+		})
+	}
+
+	// Open payables on their due date
+	payables, err := s.forecastRepo.ListOpenPayables(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ap := range payables {
+		currency, reference := ap.Currency, ""
+		if ap.Invoice != nil {
+			reference = ap.Invoice.InvoiceNo
+			if currency == "" {
+				currency = ap.Invoice.Currency
+			}
+		}
+		flows = append(flows, cashforecast.Flow{
+			Source:    cashforecast.SourcePayable,
+			Reference: reference,
+			Currency:  currency,
+			Date:      cashforecast.ExpectedDate(ap.DueDate, 0, asOf),
+			Amount:    -ap.BalanceAmount,
+		})
+	}
+
+	// Orders not yet invoiced: the outstanding down payment soon after
+	// confirmation, the balance after delivery on the order's terms
+	orders, err := s.forecastRepo.ListOpenOrders(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, order := range orders {
+		remaining := order.TotalAmount - order.PaidAmount
+		if remaining <= 0 {
+			continue
+		}
+		down := order.DownPayment - order.PaidAmount
+		if down > remaining {
+			down = remaining
+		}
+		if down > 0 {
+			due := asOf
+			if order.ConfirmedAt != nil {
+				due = order.ConfirmedAt.AddDate(0, 0, forecastDownPaymentDays)
+			}
+			flows = append(flows, cashforecast.Flow{
+				Source:    cashforecast.SourceOrderDownPayment,
+				Reference: order.OrderNo,
+				Currency:  order.Currency,
+				Date:      cashforecast.ExpectedDate(due, 0, asOf),
+				Amount:    down,
+			})
+		} else {
+			down = 0
+		}
+		delivery := order.DeliveryDate
+		if delivery.IsZero() {
+			delivery = asOf
+		}
+		due := delivery.AddDate(0, 0, cashforecast.TermsDays(order.PaymentTerms, forecastDefaultTermsDays))
+		flows = append(flows, cashforecast.Flow{
+			Source:    cashforecast.SourceOrderBalance,
+			Reference: order.OrderNo,
+			Currency:  order.Currency,
+			Date:      cashforecast.ExpectedDate(due, delays[order.CustomerID], asOf),
+			Amount:    remaining - down,
+		})
+	}
+
+	// Purchase orders: what is still to be received, paid on the order's
+	// terms after the promised or required date
+	purchaseOrders, err := s.forecastRepo.ListOpenPurchaseOrders(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, po := range purchaseOrders {
+		open := purchaseOrderOpenValue(po)
+		if open <= 0 {
+			continue
+		}
+		receipt := po.RequiredDate
+		if po.PromisedDate != nil {
+			receipt = *po.PromisedDate
+		}
+		due := receipt.AddDate(0, 0, cashforecast.TermsDays(po.PaymentTerms, forecastDefaultTermsDays))
+		flows = append(flows, cashforecast.Flow{
+			Source:    cashforecast.SourcePurchaseOrder,
+			Reference: po.OrderNo,
+			Currency:  po.Currency,
+			Date:      cashforecast.ExpectedDate(due, 0, asOf),
+			Amount:    -open,
+		})
+	}
+
+	// Recurring expenses in the horizon
+	expenses, err := s.forecastRepo.ListRecurringExpenses(ctx, companyID, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, exp := range expenses {
+		for _, d := range cashforecast.Occurrences(exp.StartDate, exp.Frequency, exp.EndDate, asOf, horizon) {
+			flows = append(flows, cashforecast.Flow{
+				Source:    cashforecast.SourceRecurring,
+				Reference: exp.Name,
+				Currency:  exp.Currency,
+				Date:      d,
+				Amount:    -exp.Amount,
+			})
+		}
+	}
+
+	// Drawings under letters of credit, paid a tenor after presentation.
+	// Drawings that should have been paid before this week are assumed
+	// collected.
+	utilizations, err := s.forecastRepo.ListOpenLCUtilizations(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range utilizations {
+		days := forecastLCSightDays
+		reference := ""
+		if u.LC != nil {
+			reference = u.LC.LCNumber
+			if u.LC.Type == "usance" {
+				days = forecastLCUsanceDays
+			}
+		}
+		expected := u.UtilizedAt.AddDate(0, 0, days)
+		if expected.Before(weekStart) {
+			continue
+		}
+		flows = append(flows, cashforecast.Flow{
+			Source:    cashforecast.SourceLC,
+			Reference: reference,
+			Currency:  u.Currency,
+			Date:      cashforecast.ExpectedDate(expected, 0, asOf),
+			Amount:    u.Amount,
+		})
+	}
+
+	for i := range flows {
+		flows[i].Currency = strings.ToUpper(flows[i].Currency)
+		flows[i].Amount = cashforecast.Round(flows[i].Amount)
+	}
+	return flows, nil
+}
+
+// purchaseOrderOpenValue is the value of the quantities not yet received,
+// including tax; the order total when it has no items
+func purchaseOrderOpenValue(po *models.PurchaseOrder) float64 {
+	if len(po.Items) == 0 {
+		return po.TotalAmount
+	}
+	var open float64
+	for _, item := range po.Items {
+		if item.Status == "cancelled" || item.ReceivedQuantity >= item.OrderedQuantity {
+			continue
+		}
+		open += (item.OrderedQuantity - item.ReceivedQuantity) * item.UnitPrice
+	}
+	return open * (1 + po.TaxRate/100)
+}
+
+// baseTotals converts the weekly totals of every currency at the rate of
+// asOf. Currencies without a rate are left out with a warning.
+func (s *cashForecastService) baseTotals(ctx context.Context, companyID uuid.UUID, asOf time.Time, forecasts []cashforecast.Forecast) ([]CashForecastBaseWeek, []string) {
+	weeks := make([]CashForecastBaseWeek, cashforecast.Weeks)
+	var warnings []string
+	var opening float64
+	for i := range weeks {
+		weeks[i].Start = cashforecast.WeekStart(asOf).AddDate(0, 0, 7*i)
+	}
+	for _, f := range forecasts {
+		rate, err := s.ledger.BaseRate(ctx, companyID, f.Currency, asOf)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s is left out of the base currency totals: %v", f.Currency, err))
+			continue
+		}
+		opening += f.Opening * rate
+		for i, w := range f.Weeks {
+			weeks[i].Inflows += w.Inflows * rate
+			weeks[i].Outflows += w.Outflows * rate
+		}
+	}
+	balance := opening
+	for i := range weeks {
+		weeks[i].Inflows = cashforecast.Round(weeks[i].Inflows)
+		weeks[i].Outflows = cashforecast.Round(weeks[i].Outflows)
+		weeks[i].Net = cashforecast.Round(weeks[i].Inflows - weeks[i].Outflows)
+		balance += weeks[i].Net
+		weeks[i].Closing = cashforecast.Round(balance)
+	}
+	return weeks, warnings
+}
+
+// Recurring expenses
+
+func (s *cashForecastService) CreateRecurringExpense(ctx context.Context, companyID, userID uuid.UUID, req RecurringExpenseRequest) (*models.RecurringExpense, error) {
+	expense := &models.RecurringExpense{CompanyID: companyID, IsActive: true}
+	if err := applyRecurringExpense(expense, req); err != nil {
+		return nil, err
+	}
+	expense.UpdatedBy = &userID
+	if err := s.forecastRepo.CreateRecurringExpense(ctx, expense); err != nil {
+		return nil, err
+	}
+	return expense, nil
+}
+
+func (s *cashForecastService) UpdateRecurringExpense(ctx context.Context, id, userID uuid.UUID, req RecurringExpenseRequest) (*models.RecurringExpense, error) {
+	expense, err := s.GetRecurringExpense(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyRecurringExpense(expense, req); err != nil {
+		return nil, err
+	}
+	expense.UpdatedBy = &userID
+	if err := s.forecastRepo.UpdateRecurringExpense(ctx, expense); err != nil {
+		return nil, err
+	}
+	return expense, nil
+}
+
+func applyRecurringExpense(expense *models.RecurringExpense, req RecurringExpenseRequest) error {
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if strings.TrimSpace(req.Name) == "" || req.Amount <= 0 || len(currency) != 3 ||
+		req.StartDate.IsZero() || !cashforecast.ValidFrequency(req.Frequency) {
+		return ErrInvalidRecurringExpense
+	}
+	if req.EndDate != nil && req.EndDate.Before(req.StartDate) {
+		return ErrInvalidRecurringExpense
+	}
+	expense.Name = strings.TrimSpace(req.Name)
+	expense.Category = req.Category
+	expense.Amount = req.Amount
+	expense.Currency = currency
+	expense.Frequency = req.Frequency
+	expense.StartDate = req.StartDate
+	expense.EndDate = req.EndDate
+	if req.IsActive != nil {
+		expense.IsActive = *req.IsActive
+	}
+	return nil
+}
+
+func (s *cashForecastService) GetRecurringExpense(ctx context.Context, id uuid.UUID) (*models.RecurringExpense, error) {
+	expense, err := s.forecastRepo.GetRecurringExpense(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrRecurringExpenseNotFound
+		}
+		return nil, err
+	}
+	return expense, nil
+}
+
+func (s *cashForecastService) ListRecurringExpenses(ctx context.Context, companyID uuid.UUID) ([]*models.RecurringExpense, error) {
+	return s.forecastRepo.ListRecurringExpenses(ctx, companyID, false)
+}
+
+// Scenarios
+
+func (s *cashForecastService) CreateScenario(ctx context.Context, companyID, userID uuid.UUID, req CashForecastScenarioRequest) (*models.CashForecastScenario, error) {
+	scenario := &models.CashForecastScenario{CompanyID: companyID, IsActive: true}
+	if err := applyCashForecastScenario(scenario, req); err != nil {
+		return nil, err
+	}
+	scenario.UpdatedBy = &userID
+	if err := s.forecastRepo.CreateScenario(ctx, scenario); err != nil {
+		return nil, err
+	}
+	return scenario, nil
+}
+
+func (s *cashForecastService) UpdateScenario(ctx context.Context, id, userID uuid.UUID, req CashForecastScenarioRequest) (*models.CashForecastScenario, error) {
+	scenario, err := s.GetScenario(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyCashForecastScenario(scenario, req); err != nil {
+		return nil, err
+	}
+	scenario.UpdatedBy = &userID
+	if err := s.forecastRepo.UpdateScenario(ctx, scenario); err != nil {
+		return nil, err
+	}
+	return scenario, nil
+}
+
+func applyCashForecastScenario(scenario *models.CashForecastScenario, req CashForecastScenarioRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidCashForecastScenario)
+	}
+	for source, factor := range req.Factors {
+		if !cashforecast.ValidSource(source) || factor < 0 {
+			return fmt.Errorf("%w: factor for %q", ErrInvalidCashForecastScenario, source)
+		}
+	}
+	for i, a := range req.Adjustments {
+		if len(strings.TrimSpace(a.Currency)) != 3 || a.WeekStart.IsZero() || a.Amount == 0 {
+			return fmt.Errorf("%w: adjustment %d needs a currency, week and amount", ErrInvalidCashForecastScenario, i+1)
+		}
+	}
+	factors, _ := json.Marshal(req.Factors)
+	adjustments, _ := json.Marshal(req.Adjustments)
+
+	scenario.Name = strings.TrimSpace(req.Name)
+	scenario.Description = req.Description
+	scenario.ReceiptDelayDays = req.ReceiptDelayDays
+	scenario.PaymentDelayDays = req.PaymentDelayDays
+	scenario.Factors = factors
+	scenario.Adjustments = adjustments
+	if req.IsActive != nil {
+		scenario.IsActive = *req.IsActive
+	}
+	return nil
+}
+
+// scenarioOf reads the overrides stored on a scenario
+func scenarioOf(scenario *models.CashForecastScenario) cashforecast.Scenario {
+	s := cashforecast.Scenario{
+		ReceiptDelayDays: scenario.ReceiptDelayDays,
+		PaymentDelayDays: scenario.PaymentDelayDays,
+	}
+	if len(scenario.Factors) > 0 {
+		_ = json.Unmarshal(scenario.Factors, &s.Factors)
+	}
+	if len(scenario.Adjustments) > 0 {
+		_ = json.Unmarshal(scenario.Adjustments, &s.Adjustments)
+	}
+	return s
+}
+
+func (s *cashForecastService) GetScenario(ctx context.Context, id uuid.UUID) (*models.CashForecastScenario, error) {
+	scenario, err := s.forecastRepo.GetScenario(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrCashForecastScenarioNotFound
+		}
+		return nil, err
+	}
+	return scenario, nil
+}
+
+func (s *cashForecastService) ListScenarios(ctx context.Context, companyID uuid.UUID) ([]*models.CashForecastScenario, error) {
+	return s.forecastRepo.ListScenarios(ctx, companyID)
+}
+
+// Snapshots and accuracy
+
+// TakeSnapshot stores the forecast so it can be compared with actuals once
+// its weeks have passed
+func (s *cashForecastService) TakeSnapshot(ctx context.Context, req CashForecastRequest, userID *uuid.UUID) (*models.CashForecastSnapshot, error) {
+	forecast, err := s.GetForecast(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &models.CashForecastSnapshot{
+		CompanyID:    req.CompanyID,
+		ScenarioID:   forecast.ScenarioID,
+		ScenarioName: forecast.ScenarioName,
+		WeekStart:    forecast.WeekStart,
+		Automatic:    userID == nil,
+		CreatedBy:    userID,
+	}
+	for _, f := range forecast.Currencies {
+		for _, w := range f.Weeks {
+			bySource, _ := json.Marshal(w.BySource)
+			snapshot.Lines = append(snapshot.Lines, models.CashForecastSnapshotLine{
+				Currency:  f.Currency,
+				WeekStart: w.Start,
+				Inflows:   w.Inflows,
+				Outflows:  w.Outflows,
+				Closing:   w.Closing,
+				BySource:  bySource,
+			})
+		}
+	}
+	if err := s.forecastRepo.CreateSnapshot(ctx, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// SnapshotWeekly stores the base forecast of every company once a week, so
+// accuracy is tracked without anyone having to remember
+func (s *cashForecastService) SnapshotWeekly(ctx context.Context) (*CashForecastSnapshotRun, error) {
+	today := time.Now().UTC()
+	run := &CashForecastSnapshotRun{WeekStart: cashforecast.WeekStart(today)}
+	companyIDs, err := s.forecastRepo.ListCompanyIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, companyID := range companyIDs {
+		if ctx.Err() != nil {
+			return run, ctx.Err()
+		}
+		run.Companies++
+		_, err := s.forecastRepo.FindSnapshot(ctx, companyID, nil, run.WeekStart)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			run.Errors = append(run.Errors, fmt.Sprintf("%s: %v", companyID, err))
+			continue
+		}
+		if _, err := s.TakeSnapshot(ctx, CashForecastRequest{CompanyID: companyID, AsOf: today}, nil); err != nil {
+			run.Errors = append(run.Errors, fmt.Sprintf("%s: %v", companyID, err))
+			continue
+		}
+		run.Snapshots++
+	}
+	return run, nil
+}
+
+func (s *cashForecastService) GetSnapshot(ctx context.Context, id uuid.UUID) (*models.CashForecastSnapshot, error) {
+	snapshot, err := s.forecastRepo.GetSnapshot(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrCashForecastSnapshotNotFound
+		}
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (s *cashForecastService) ListSnapshots(ctx context.Context, params map[string]interface{}) ([]*models.CashForecastSnapshot, int64, error) {
+	return s.forecastRepo.ListSnapshots(ctx, params)
+}
+
+// GetAccuracy compares a snapshot with the completed payments of the weeks
+// that have ended by through
+func (s *cashForecastService) GetAccuracy(ctx context.Context, snapshotID uuid.UUID, through time.Time) (*CashForecastAccuracy, error) {
+	snapshot, err := s.GetSnapshot(ctx, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if through.IsZero() {
+		through = time.Now()
+	}
+
+	forecast := make([]cashforecast.Line, 0, len(snapshot.Lines))
+	for _, l := range snapshot.Lines {
+		forecast = append(forecast, cashforecast.Line{Currency: l.Currency, WeekStart: l.WeekStart, Inflows: l.Inflows, Outflows: l.Outflows})
+	}
+
+	end := snapshot.WeekStart.AddDate(0, 0, 7*cashforecast.Weeks)
+	payments, err := s.forecastRepo.ListPayments(ctx, snapshot.CompanyID, snapshot.WeekStart, end)
+	if err != nil {
+		return nil, err
+	}
+	actual := make([]cashforecast.Line, 0, len(payments))
+	for _, p := range payments {
+		line := cashforecast.Line{Currency: p.Currency, WeekStart: cashforecast.WeekStart(p.PaymentDate)}
+		if p.Type == "incoming" {
+			line.Inflows = p.Amount
+		} else {
+			line.Outflows = p.Amount
+		}
+		actual = append(actual, line)
+	}
+
+	snapshot.Lines = nil
+	return &CashForecastAccuracy{
+		Snapshot: snapshot,
+		Through:  through,
+		Accuracy: cashforecast.Compare(forecast, actual, through),
+	}, nil
+}
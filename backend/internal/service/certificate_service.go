@@ -0,0 +1,679 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/certificate"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/fastenmind/fastener-api/internal/security"
+	"github.com/fastenmind/fastener-api/pkg/resources"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrMillCertificateNotFound is returned when a mill certificate does not exist
+	ErrMillCertificateNotFound = errors.New("mill certificate not found")
+	// ErrMillCertificateExists is returned when the heat already has a mill certificate
+	ErrMillCertificateExists = errors.New("heat already has a mill certificate")
+	// ErrInvalidMillCertificate is returned for a mill certificate without a
+	// heat or with malformed properties
+	ErrInvalidMillCertificate = errors.New("invalid mill certificate")
+	// ErrCertificateNotFound is returned when an inspection certificate does not exist
+	ErrCertificateNotFound = errors.New("inspection certificate not found")
+	// ErrCertificateIncomplete is returned when a shipment line lacks the
+	// final inspection, heats or measurements to certify it
+	ErrCertificateIncomplete = errors.New("certificate data incomplete")
+	// ErrCertificateNonconforming is returned when a heat property or
+	// inspection result is out of specification
+	ErrCertificateNonconforming = errors.New("products do not conform to specification")
+	// ErrCertificateRevoked is returned when revoking a revoked certificate
+	ErrCertificateRevoked = errors.New("certificate is revoked")
+	// ErrCertificateSigningKey is returned when issuing a certificate without
+	// an RSA signing key, whose signatures customers can verify
+	ErrCertificateSigningKey = errors.New("certificates need an RSA signing key: set SIGNING_PRIVATE_KEY_FILE")
+)
+
+// CertificateService keeps the mill certificates of material heats and
+// issues signed EN 10204 3.1 inspection certificates for shipments
+type CertificateService interface {
+	// Mill certificates
+	CreateMillCertificate(ctx context.Context, cert *models.MillCertificate) error
+	UpdateMillCertificate(ctx context.Context, id uuid.UUID, req *models.MillCertificate) (*models.MillCertificate, error)
+	GetMillCertificate(ctx context.Context, id uuid.UUID) (*models.MillCertificate, error)
+	ListMillCertificates(ctx context.Context, params map[string]interface{}) ([]*models.MillCertificate, int64, error)
+
+	// Inspection certificates
+
+	// IssueCertificate renders the certificate of a shipment, signs it and
+	// attaches it to the shipment, superseding the one issued before
+	IssueCertificate(ctx context.Context, req IssueCertificateRequest) (*models.InspectionCertificate, error)
+	GetCertificate(ctx context.Context, id uuid.UUID) (*models.InspectionCertificate, error)
+	ListCertificates(ctx context.Context, params map[string]interface{}) ([]*models.InspectionCertificate, int64, error)
+	// OpenCertificate returns a certificate with its PDF
+	OpenCertificate(ctx context.Context, id uuid.UUID) (*models.InspectionCertificate, []byte, error)
+	RevokeCertificate(ctx context.Context, id uuid.UUID, reason string, userID uuid.UUID) (*models.InspectionCertificate, error)
+	// VerifyCertificate looks a certificate up by the SHA-256 hash of its
+	// PDF and checks its signature
+	VerifyCertificate(ctx context.Context, hash string) (*CertificateVerification, error)
+}
+
+// IssueCertificateRequest issues the certificate of a shipment. Lines
+// left out are certified by the passed final inspection of the sales
+// order for the same product and the heats issued to its production order.
+type IssueCertificateRequest struct {
+	CompanyID      uuid.UUID                `json:"-"`
+	ShipmentID     uuid.UUID                `json:"-"`
+	UserID         uuid.UUID                `json:"-"`
+	VerifyURL      string                   `json:"-"`
+	Representative string                   `json:"representative"` // defaults to the inspector
+	Lines          []CertificateLineRequest `json:"lines"`
+}
+
+// CertificateLineRequest names the final inspection and heats of a
+// shipment line
+type CertificateLineRequest struct {
+	ShipmentItemID uuid.UUID  `json:"shipment_item_id"`
+	InspectionID   *uuid.UUID `json:"inspection_id"`
+	HeatNos        []string   `json:"heat_nos"`
+}
+
+// CertificateVerification is the public result of looking a certificate
+// up by its hash. Valid means the file is authentic and the certificate
+// is neither superseded nor revoked.
+type CertificateVerification struct {
+	Valid         bool                          `json:"valid"`
+	Authentic     bool                          `json:"authentic"`
+	Reason        string                        `json:"reason,omitempty"`
+	CertificateNo string                        `json:"certificate_no"`
+	Type          string                        `json:"type"`
+	Status        string                        `json:"status"`
+	Manufacturer  string                        `json:"manufacturer"`
+	Purchaser     string                        `json:"purchaser"`
+	ShipmentNo    string                        `json:"shipment_no"`
+	IssuedAt      time.Time                     `json:"issued_at"`
+	RevokedAt     *time.Time                    `json:"revoked_at,omitempty"`
+	RevokedReason string                        `json:"revoked_reason,omitempty"`
+	Hash          string                        `json:"hash"`
+	KeyID         string                        `json:"key_id"`
+	Algorithm     string                        `json:"signature_algorithm"`
+	Lines         []CertificateVerificationLine `json:"lines"`
+}
+
+// CertificateVerificationLine is a certified line as shown to verifiers
+type CertificateVerificationLine struct {
+	Item        int     `json:"item"`
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	Unit        string  `json:"unit"`
+	HeatNos     string  `json:"heat_nos"`
+}
+
+type certificateService struct {
+	certificateRepo repository.CertificateRepository
+	tradeRepo       repository.TradeRepository
+	orderRepo       repository.OrderRepository
+	signer          security.DocumentSigner
+	storagePath     string
+}
+
+// NewCertificateService creates a new certificate service. Certificates are
+// signed with signer and stored with the shipment's trade documents under
+// storagePath.
+func NewCertificateService(
+	certificateRepo repository.CertificateRepository,
+	tradeRepo repository.TradeRepository,
+	orderRepo repository.OrderRepository,
+	signer security.DocumentSigner,
+	storagePath string,
+) CertificateService {
+	return &certificateService{
+		certificateRepo: certificateRepo,
+		tradeRepo:       tradeRepo,
+		orderRepo:       orderRepo,
+		signer:          signer,
+		storagePath:     storagePath,
+	}
+}
+
+// Mill certificates
+
+func (s *certificateService) CreateMillCertificate(ctx context.Context, cert *models.MillCertificate) error {
+	cert.HeatNo = strings.TrimSpace(cert.HeatNo)
+	if err := validateMillCertificate(cert); err != nil {
+		return err
+	}
+	existing, err := s.certificateRepo.FindMillCertificatesByHeat(ctx, cert.CompanyID, []string{cert.HeatNo})
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return ErrMillCertificateExists
+	}
+	if cert.CertificateType == "" {
+		cert.CertificateType = certificate.Type31
+	}
+	return s.certificateRepo.CreateMillCertificate(ctx, cert)
+}
+
+// UpdateMillCertificate corrects a mill certificate. The heat stays, as
+// issued certificates quote it.
+func (s *certificateService) UpdateMillCertificate(ctx context.Context, id uuid.UUID, req *models.MillCertificate) (*models.MillCertificate, error) {
+	cert, err := s.GetMillCertificate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	cert.CertificateNo = req.CertificateNo
+	if req.CertificateType != "" {
+		cert.CertificateType = req.CertificateType
+	}
+	cert.Mill = req.Mill
+	cert.SupplierID = req.SupplierID
+	cert.InventoryID = req.InventoryID
+	cert.MaterialGrade = req.MaterialGrade
+	cert.Standard = req.Standard
+	cert.Chemical = req.Chemical
+	cert.Mechanical = req.Mechanical
+	cert.IssuedAt = req.IssuedAt
+	cert.Notes = req.Notes
+	if err := validateMillCertificate(cert); err != nil {
+		return nil, err
+	}
+
+	if err := s.certificateRepo.UpdateMillCertificate(ctx, cert); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+func (s *certificateService) GetMillCertificate(ctx context.Context, id uuid.UUID) (*models.MillCertificate, error) {
+	cert, err := s.certificateRepo.GetMillCertificate(ctx, id)
+	if err == repository.ErrNotFound {
+		return nil, ErrMillCertificateNotFound
+	}
+	return cert, err
+}
+
+func (s *certificateService) ListMillCertificates(ctx context.Context, params map[string]interface{}) ([]*models.MillCertificate, int64, error) {
+	return s.certificateRepo.ListMillCertificates(ctx, params)
+}
+
+// Inspection certificates
+
+func (s *certificateService) IssueCertificate(ctx context.Context, req IssueCertificateRequest) (*models.InspectionCertificate, error) {
+	if !security.PubliclyVerifiable(s.signer) {
+		return nil, ErrCertificateSigningKey
+	}
+	shipment, err := s.tradeRepo.GetShipment(ctx, req.ShipmentID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrShipmentNotFound
+		}
+		return nil, err
+	}
+	if shipment.CompanyID != req.CompanyID {
+		return nil, ErrShipmentNotFound
+	}
+	if len(shipment.Items) == 0 {
+		return nil, ErrShipmentHasNoItems
+	}
+
+	var order *models.Order
+	if shipment.OrderID != nil {
+		order, err = s.orderRepo.GetWithDetails(*shipment.OrderID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load order: %w", err)
+		}
+	}
+
+	inShipment := make(map[uuid.UUID]bool, len(shipment.Items))
+	for _, item := range shipment.Items {
+		inShipment[item.ID] = true
+	}
+	requested := make(map[uuid.UUID]CertificateLineRequest, len(req.Lines))
+	for _, line := range req.Lines {
+		if !inShipment[line.ShipmentItemID] {
+			return nil, fmt.Errorf("%w: shipment item %s is not in the shipment", ErrCertificateIncomplete, line.ShipmentItemID)
+		}
+		requested[line.ShipmentItemID] = line
+	}
+
+	now := time.Now()
+	doc := &certificate.Document{
+		CertificateNo:  fmt.Sprintf("CERT-%s-%06d", now.Format("200601"), now.UnixMicro()%1000000),
+		Type:           certificate.Type31,
+		IssuedAt:       now.Truncate(time.Second),
+		ShipmentNo:     shipment.ShipmentNo,
+		Representative: req.Representative,
+		KeyID:          s.signer.KeyID(),
+		VerifyURL:      req.VerifyURL,
+	}
+	// Parties as on the export documents of the shipment
+	parties := exportDocumentParties(shipment, order)
+	doc.Manufacturer = parties.ExporterName
+	doc.ManufacturerAddress = parties.ExporterAddress
+	doc.Purchaser = parties.ConsigneeName
+	doc.OrderNo = parties.OrderNo
+	doc.CustomerPO = parties.CustomerPO
+
+	var candidates []*models.QualityInspection
+	var lines []models.InspectionCertificateLine
+	for i, item := range shipment.Items {
+		line := certificate.Line{
+			Item:        i + 1,
+			Description: item.ProductName,
+			Quantity:    item.Quantity,
+			Unit:        item.Unit,
+		}
+		if item.Description != "" {
+			line.Description = item.ProductName + " - " + item.Description
+		}
+
+		// Final inspection
+		var inspection *models.QualityInspection
+		lineReq := requested[item.ID]
+		if lineReq.InspectionID != nil {
+			inspection, err = s.certificateRepo.GetInspection(ctx, *lineReq.InspectionID)
+			if err != nil && err != repository.ErrNotFound {
+				return nil, err
+			}
+			if inspection == nil || inspection.CompanyID != shipment.CompanyID {
+				return nil, fmt.Errorf("%w: inspection %s not found", ErrCertificateIncomplete, *lineReq.InspectionID)
+			}
+			if inspection.Type != "final" || inspection.Status != "passed" {
+				return nil, fmt.Errorf("%w: inspection %s is not a passed final inspection", ErrCertificateIncomplete, inspection.InspectionNo)
+			}
+		} else {
+			if candidates == nil && shipment.OrderID != nil {
+				candidates, err = s.certificateRepo.ListFinalInspections(ctx, shipment.CompanyID, *shipment.OrderID)
+				if err != nil {
+					return nil, err
+				}
+			}
+			inspection = matchFinalInspection(item, candidates)
+			if inspection == nil {
+				return nil, fmt.Errorf("%w: no passed final inspection for item %d %s", ErrCertificateIncomplete, line.Item, item.ProductName)
+			}
+		}
+		line.InspectionNo = inspection.InspectionNo
+		line.InspectedQuantity = inspection.InspectedQuantity
+		line.SampleSize = inspection.SampleSize
+		line.InspectedAt = inspection.InspectedAt.Format("2006-01-02")
+		if doc.Representative == "" && inspection.Inspector != nil {
+			doc.Representative = inspection.Inspector.FullName
+		}
+
+		// Material heats
+		heatNos := lineReq.HeatNos
+		if len(heatNos) == 0 && inspection.ProductionOrderID != nil {
+			heatNos, err = s.certificateRepo.ListHeatNos(ctx, *inspection.ProductionOrderID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(heatNos) == 0 {
+			return nil, fmt.Errorf("%w: no material heat for item %d %s", ErrCertificateIncomplete, line.Item, item.ProductName)
+		}
+		line.Heats, err = s.heats(ctx, shipment.CompanyID, heatNos)
+		if err != nil {
+			return nil, err
+		}
+
+		// Inspection results
+		line.Results, err = s.inspectionResults(ctx, inspection)
+		if err != nil {
+			return nil, err
+		}
+
+		content, _ := json.Marshal(line)
+		lines = append(lines, models.InspectionCertificateLine{
+			ShipmentItemID: item.ID,
+			Item:           line.Item,
+			Description:    line.Description,
+			Quantity:       line.Quantity,
+			Unit:           line.Unit,
+			InspectionID:   inspection.ID,
+			HeatNos:        strings.Join(heatNos, ","),
+			Content:        content,
+		})
+		doc.Lines = append(doc.Lines, line)
+	}
+
+	if found := certificate.Nonconformities(doc); len(found) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrCertificateNonconforming, strings.Join(found, "; "))
+	}
+
+	pdf, err := certificate.Render(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render certificate: %w", err)
+	}
+	signature, err := s.signer.Sign(pdf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate: %w", err)
+	}
+
+	dir := filepath.Join(s.storagePath, "trade-documents", shipment.ID.String())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, doc.CertificateNo+".pdf")
+	err = resources.WriteFileWithCleanup(ctx, path, func(w io.Writer) error {
+		_, writeErr := w.Write(pdf)
+		return writeErr
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store %s: %w", path, err)
+	}
+
+	version, err := s.certificateRepo.LatestCertificateVersion(ctx, shipment.ID)
+	if err != nil {
+		return nil, err
+	}
+	version++
+
+	cert := &models.InspectionCertificate{
+		CompanyID:          shipment.CompanyID,
+		CertificateNo:      doc.CertificateNo,
+		Type:               doc.Type,
+		Status:             models.CertificateStatusIssued,
+		Version:            version,
+		ShipmentID:         shipment.ID,
+		ShipmentNo:         shipment.ShipmentNo,
+		OrderID:            shipment.OrderID,
+		Manufacturer:       doc.Manufacturer,
+		Purchaser:          doc.Purchaser,
+		FilePath:           path,
+		Hash:               certificate.Digest(pdf),
+		Signature:          base64.StdEncoding.EncodeToString(signature),
+		SignatureAlgorithm: s.signer.Algorithm(),
+		KeyID:              s.signer.KeyID(),
+		IssuedBy:           req.UserID,
+		IssuedAt:           doc.IssuedAt,
+		Lines:              lines,
+	}
+	if order != nil {
+		cert.CustomerID = &order.CustomerID
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"generated":           true,
+		"shipment_id":         shipment.ID,
+		"certificate_type":    "EN 10204 " + doc.Type,
+		"hash":                cert.Hash,
+		"key_id":              cert.KeyID,
+		"signature_algorithm": cert.SignatureAlgorithm,
+	})
+	tradeDoc := &models.TradeDocument{
+		ID:           uuid.New(),
+		CompanyID:    shipment.CompanyID,
+		DocumentType: models.TradeDocumentInspectionCertificate,
+		DocumentNo:   doc.CertificateNo,
+		Title:        fmt.Sprintf("Inspection certificate EN 10204 %s %s", doc.Type, shipment.ShipmentNo),
+		FilePath:     path,
+		FileSize:     int64(len(pdf)),
+		FileType:     "pdf",
+		Version:      version,
+		Status:       "approved",
+		IssuedBy:     doc.Manufacturer,
+		IssuedAt:     &now,
+		ApprovedBy:   &req.UserID,
+		ApprovedAt:   &now,
+		Metadata:     string(metadata),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		CreatedBy:    req.UserID,
+	}
+
+	if err := s.certificateRepo.IssueCertificate(ctx, cert, tradeDoc); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+func (s *certificateService) GetCertificate(ctx context.Context, id uuid.UUID) (*models.InspectionCertificate, error) {
+	cert, err := s.certificateRepo.GetCertificate(ctx, id)
+	if err == repository.ErrNotFound {
+		return nil, ErrCertificateNotFound
+	}
+	return cert, err
+}
+
+func (s *certificateService) ListCertificates(ctx context.Context, params map[string]interface{}) ([]*models.InspectionCertificate, int64, error) {
+	return s.certificateRepo.ListCertificates(ctx, params)
+}
+
+func (s *certificateService) OpenCertificate(ctx context.Context, id uuid.UUID) (*models.InspectionCertificate, []byte, error) {
+	cert, err := s.GetCertificate(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := readCertificateFile(ctx, cert.FilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, content, nil
+}
+
+// RevokeCertificate withdraws a certificate issued in error; verifying it
+// reports it as revoked from then on
+func (s *certificateService) RevokeCertificate(ctx context.Context, id uuid.UUID, reason string, userID uuid.UUID) (*models.InspectionCertificate, error) {
+	cert, err := s.GetCertificate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Status == models.CertificateStatusRevoked {
+		return nil, ErrCertificateRevoked
+	}
+
+	now := time.Now()
+	cert.Status = models.CertificateStatusRevoked
+	cert.RevokedBy = &userID
+	cert.RevokedAt = &now
+	cert.RevokedReason = reason
+	if err := s.certificateRepo.UpdateCertificate(ctx, cert); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+func (s *certificateService) VerifyCertificate(ctx context.Context, hash string) (*CertificateVerification, error) {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != 32 {
+		return nil, ErrCertificateNotFound
+	}
+	cert, err := s.certificateRepo.FindCertificateByHash(ctx, hash)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrCertificateNotFound
+		}
+		return nil, err
+	}
+
+	result := &CertificateVerification{
+		CertificateNo: cert.CertificateNo,
+		Type:          cert.Type,
+		Status:        cert.Status,
+		Manufacturer:  cert.Manufacturer,
+		Purchaser:     cert.Purchaser,
+		ShipmentNo:    cert.ShipmentNo,
+		IssuedAt:      cert.IssuedAt,
+		RevokedAt:     cert.RevokedAt,
+		RevokedReason: cert.RevokedReason,
+		Hash:          cert.Hash,
+		KeyID:         cert.KeyID,
+		Algorithm:     cert.SignatureAlgorithm,
+	}
+	for _, line := range cert.Lines {
+		result.Lines = append(result.Lines, CertificateVerificationLine{
+			Item:        line.Item,
+			Description: line.Description,
+			Quantity:    line.Quantity,
+			Unit:        line.Unit,
+			HeatNos:     line.HeatNos,
+		})
+	}
+
+	result.Authentic, result.Reason = s.checkSignature(ctx, cert)
+	switch {
+	case !result.Authentic:
+	case cert.Status == models.CertificateStatusRevoked:
+		result.Reason = "certificate was revoked"
+	case cert.Status == models.CertificateStatusSuperseded:
+		result.Reason = "certificate was superseded by a later issue for the shipment"
+	default:
+		result.Valid = true
+	}
+	return result, nil
+}
+
+// checkSignature checks the stored certificate against its hash and
+// signature
+func (s *certificateService) checkSignature(ctx context.Context, cert *models.InspectionCertificate) (bool, string) {
+	if cert.KeyID != s.signer.KeyID() {
+		return false, "signed with key " + cert.KeyID + ", which is no longer configured"
+	}
+	content, err := readCertificateFile(ctx, cert.FilePath)
+	if err != nil {
+		return false, "certificate file unavailable"
+	}
+	if certificate.Digest(content) != cert.Hash {
+		return false, "stored certificate does not match its hash"
+	}
+	signature, err := base64.StdEncoding.DecodeString(cert.Signature)
+	if err != nil {
+		return false, security.ErrInvalidSignature.Error()
+	}
+	if err := s.signer.Verify(content, signature); err != nil {
+		return false, err.Error()
+	}
+	return true, ""
+}
+
+// heats returns the mill certificate data of heats, in the given order
+func (s *certificateService) heats(ctx context.Context, companyID uuid.UUID, heatNos []string) ([]certificate.Heat, error) {
+	certs, err := s.certificateRepo.FindMillCertificatesByHeat(ctx, companyID, heatNos)
+	if err != nil {
+		return nil, err
+	}
+	byHeat := make(map[string]*models.MillCertificate, len(certs))
+	for _, cert := range certs {
+		byHeat[cert.HeatNo] = cert
+	}
+
+	heats := make([]certificate.Heat, 0, len(heatNos))
+	for _, heatNo := range heatNos {
+		cert, ok := byHeat[heatNo]
+		if !ok {
+			return nil, fmt.Errorf("%w: no mill certificate for heat %s", ErrCertificateIncomplete, heatNo)
+		}
+		heat := certificate.Heat{
+			HeatNo:        cert.HeatNo,
+			Mill:          cert.Mill,
+			CertificateNo: cert.CertificateNo,
+			MaterialGrade: cert.MaterialGrade,
+			Standard:      cert.Standard,
+		}
+		if err := unmarshalProperties(cert.Chemical, &heat.Chemical); err != nil {
+			return nil, err
+		}
+		if err := unmarshalProperties(cert.Mechanical, &heat.Mechanical); err != nil {
+			return nil, err
+		}
+		heats = append(heats, heat)
+	}
+	return heats, nil
+}
+
+// inspectionResults summarizes the characteristics measured in an
+// inspection
+func (s *certificateService) inspectionResults(ctx context.Context, inspection *models.QualityInspection) ([]certificate.Result, error) {
+	measurements, err := s.certificateRepo.ListInspectionMeasurements(ctx, inspection.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(measurements) == 0 {
+		return nil, fmt.Errorf("%w: no measurements recorded in inspection %s", ErrCertificateIncomplete, inspection.InspectionNo)
+	}
+
+	values := map[uuid.UUID][]float64{}
+	var ids []uuid.UUID
+	for _, m := range measurements {
+		if _, ok := values[m.CharacteristicID]; !ok {
+			ids = append(ids, m.CharacteristicID)
+		}
+		values[m.CharacteristicID] = append(values[m.CharacteristicID], m.Value)
+	}
+	characteristics, err := s.certificateRepo.GetCharacteristics(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]certificate.Result, 0, len(characteristics))
+	for _, c := range characteristics {
+		lsl, usl := c.Limits()
+		results = append(results, certificate.Summarize(c.Name, c.Unit, c.Nominal, lsl, usl, values[c.ID]))
+	}
+	return results, nil
+}
+
+// matchFinalInspection picks the inspection of the production order for
+// the shipped product, or the only inspection of the sales order
+func matchFinalInspection(item models.ShipmentItem, candidates []*models.QualityInspection) *models.QualityInspection {
+	for _, inspection := range candidates {
+		if inspection.ProductionOrder != nil && strings.EqualFold(inspection.ProductionOrder.ProductName, item.ProductName) {
+			return inspection
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	return nil
+}
+
+func validateMillCertificate(cert *models.MillCertificate) error {
+	if cert.HeatNo == "" {
+		return fmt.Errorf("%w: heat_no is required", ErrInvalidMillCertificate)
+	}
+	for _, properties := range []struct {
+		name string
+		data []byte
+	}{{"chemical", cert.Chemical}, {"mechanical", cert.Mechanical}} {
+		var parsed []certificate.Property
+		if err := unmarshalProperties(properties.data, &parsed); err != nil {
+			return fmt.Errorf("%w: %s must be a list of {name, unit, value, min, max}", ErrInvalidMillCertificate, properties.name)
+		}
+		for _, p := range parsed {
+			if p.Name == "" {
+				return fmt.Errorf("%w: %s property without name", ErrInvalidMillCertificate, properties.name)
+			}
+		}
+	}
+	return nil
+}
+
+func unmarshalProperties(data []byte, properties *[]certificate.Property) error {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, properties)
+}
+
+func readCertificateFile(ctx context.Context, path string) ([]byte, error) {
+	var content []byte
+	err := resources.ReadFileWithCleanup(ctx, path, func(r io.Reader) error {
+		var readErr error
+		content, readErr = io.ReadAll(r)
+		return readErr
+	})
+	return content, err
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/repository"
+)
+
+// NewCostCalibrationScheduler creates a runner that recalibrates the cost
+// model of each company monthly against its completed production orders,
+// leaving the rate suggestions for engineers to review. It checks for due
+// calibrations every interval.
+func NewCostCalibrationScheduler(calibration CostCalibrationService, runs repository.JobRunRepository, interval time.Duration) *PeriodicRunner {
+	return NewPeriodicRunner("cost-calibration-scheduler", interval, runs, func(ctx context.Context) error {
+		result, err := calibration.CalibrateDue(ctx)
+		if err != nil {
+			return err
+		}
+		if result != nil && len(result.Errors) > 0 {
+			log.Printf("cost calibration: %d calibrations, %d errors, first: %s", result.Calibrations, len(result.Errors), result.Errors[0])
+		}
+		return nil
+	})
+}
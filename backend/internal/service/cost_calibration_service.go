@@ -0,0 +1,494 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/calibration"
+	"github.com/fastenmind/fastener-api/internal/infrastructure/jobcost"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrCostCalibrationNotFound is returned when a calibration is not found
+	ErrCostCalibrationNotFound = errors.New("cost calibration not found")
+	// ErrCostSuggestionNotFound is returned when a rate suggestion is not found
+	ErrCostSuggestionNotFound = errors.New("cost rate suggestion not found")
+	// ErrCostSuggestionDecided is returned when a suggestion was already
+	// accepted or dismissed
+	ErrCostSuggestionDecided = errors.New("cost rate suggestion has already been decided")
+	// ErrCostSuggestionStale is returned when the template a suggestion was
+	// calibrated against has since been replaced
+	ErrCostSuggestionStale = errors.New("process cost template changed since the suggestion was made; calibrate again")
+	// ErrInvalidCostSuggestion is returned when an accepted rate is not positive
+	ErrInvalidCostSuggestion = errors.New("accepted base rate must be positive")
+	// ErrNoCalibrationJobs is returned when no completed job with a cost
+	// calculation falls in the calibration period
+	ErrNoCalibrationJobs = errors.New("no completed production orders with a cost calculation in the period")
+)
+
+// The scheduler recalibrates each company monthly over the last year
+const (
+	costCalibrationInterval = 30 * 24 * time.Hour
+	costCalibrationWindow   = 365 * 24 * time.Hour
+)
+
+// Template units whose base rate is charged per hour rather than per piece
+var hourlyTemplateUnits = map[string]bool{"hour": true, "hours": true, "hr": true, "per_hour": true}
+
+// CostCalibrationService regresses what completed production orders
+// actually took per process against the cost calculations they were
+// estimated with, suggests calibrated template and processing rates with
+// confidence intervals, and turns accepted suggestions into new template
+// versions
+type CostCalibrationService interface {
+	Calibrate(ctx context.Context, req CostCalibrationRequest, userID *uuid.UUID) (*models.CostCalibration, error)
+	// CalibrateDue calibrates every company not calibrated in the last month
+	CalibrateDue(ctx context.Context) (*CostCalibrationRun, error)
+	GetCalibration(ctx context.Context, id uuid.UUID) (*models.CostCalibration, error)
+	ListCalibrations(ctx context.Context, params map[string]interface{}) ([]*models.CostCalibration, int64, error)
+
+	GetSuggestion(ctx context.Context, id uuid.UUID) (*models.CostRateSuggestion, error)
+	ListSuggestions(ctx context.Context, params map[string]interface{}) ([]*models.CostRateSuggestion, int64, error)
+	// AcceptSuggestion creates a new version of the process's template at
+	// the suggested, or the engineer's own, base rate and retires the
+	// version it supersedes
+	AcceptSuggestion(ctx context.Context, id uuid.UUID, req AcceptCostSuggestionRequest, userID uuid.UUID) (*models.ProcessCostTemplate, error)
+	DismissSuggestion(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.CostRateSuggestion, error)
+}
+
+type CostCalibrationRequest struct {
+	CompanyID uuid.UUID  `json:"-"`
+	From      *time.Time `json:"from"` // completion dates; to is exclusive
+	To        *time.Time `json:"to"`
+	Automatic bool       `json:"-"`
+}
+
+type AcceptCostSuggestionRequest struct {
+	BaseRate    *float64 `json:"base_rate"` // defaults to the suggested base rate
+	Name        string   `json:"name"`      // defaults to the superseded template's name
+	Description string   `json:"description"`
+}
+
+// CostCalibrationSkip is a process that could not be calibrated
+type CostCalibrationSkip struct {
+	ProcessType string `json:"process_type"`
+	ProcessName string `json:"process_name"`
+	Samples     int    `json:"samples"`
+	Reason      string `json:"reason"`
+}
+
+// CostCalibrationRun is the outcome of calibrating the companies that were due
+type CostCalibrationRun struct {
+	Companies    int      `json:"companies"`
+	Calibrations int      `json:"calibrations"`
+	Errors       []string `json:"errors,omitempty"`
+}
+
+type costCalibrationService struct {
+	calibrationRepo repository.CostCalibrationRepository
+}
+
+// NewCostCalibrationService creates a new cost calibration service
+func NewCostCalibrationService(calibrationRepo repository.CostCalibrationRepository) CostCalibrationService {
+	return &costCalibrationService{calibrationRepo: calibrationRepo}
+}
+
+// costProcess collects the samples of one process step
+type costProcess struct {
+	name    string
+	samples []calibration.Sample
+}
+
+func (s *costCalibrationService) Calibrate(ctx context.Context, req CostCalibrationRequest, userID *uuid.UUID) (*models.CostCalibration, error) {
+	jobs, err := s.calibrationRepo.ListCalibrationJobs(ctx, req.CompanyID, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, ErrNoCalibrationJobs
+	}
+
+	record := &models.CostCalibration{
+		CompanyID: req.CompanyID,
+		From:      req.From,
+		To:        req.To,
+		Automatic: req.Automatic,
+		CreatedBy: userID,
+	}
+	processes := map[string]*costProcess{}
+	calculations := map[uuid.UUID]*models.CostCalculation{}
+	for _, job := range jobs {
+		calculation, ok := calculations[*job.CostCalculationID]
+		if !ok {
+			calculation, err = s.calibrationRepo.GetCostCalculation(ctx, *job.CostCalculationID)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return nil, err
+			}
+			calculations[*job.CostCalculationID] = calculation
+		}
+		if calculation == nil || calculation.Quantity <= 0 {
+			continue
+		}
+		tasks, err := s.calibrationRepo.ListProductionTasks(ctx, job.ProductionOrderID)
+		if err != nil {
+			return nil, err
+		}
+
+		samples := calibrationSamples(job, calculation, tasks)
+		if len(samples) > 0 {
+			record.Jobs++
+		}
+		for code, sample := range samples {
+			process, ok := processes[code]
+			if !ok {
+				process = &costProcess{name: sample.name}
+				processes[code] = process
+			}
+			process.samples = append(process.samples, sample.Sample)
+			record.Samples++
+		}
+	}
+
+	codes := make([]string, 0, len(processes))
+	for code := range processes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	var skipped []CostCalibrationSkip
+	for _, code := range codes {
+		process := processes[code]
+		fit := calibration.Calibrate(process.samples)
+		if fit.Samples < calibration.MinSamples {
+			skipped = append(skipped, CostCalibrationSkip{
+				ProcessType: code,
+				ProcessName: process.name,
+				Samples:     fit.Samples,
+				Reason:      fmt.Sprintf("%d timed runs, %d needed", fit.Samples, calibration.MinSamples),
+			})
+			continue
+		}
+		suggestion, err := s.suggest(ctx, req.CompanyID, code, process.name, fit)
+		if err != nil {
+			return nil, err
+		}
+		record.Suggestions = append(record.Suggestions, *suggestion)
+	}
+	record.Skipped, _ = json.Marshal(skipped)
+
+	if err := s.calibrationRepo.CreateCalibration(ctx, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// calibrationSample is a sample with the name of its process step
+type calibrationSample struct {
+	calibration.Sample
+	name string
+}
+
+// calibrationSamples matches the steps of a job's cost calculation with the
+// tasks that ran them, by sequence and otherwise by name, and returns a
+// sample per process step code. Estimates are scaled from the calculated to
+// the produced quantity.
+func calibrationSamples(job *models.ProductionJobCost, calculation *models.CostCalculation, tasks []*models.ProductionTask) map[string]calibrationSample {
+	diameter, length := calculation.Diameter, calculation.Length
+	material := calculation.MaterialType
+	if calculation.Inquiry != nil {
+		if material == "" {
+			material = calculation.Inquiry.Material
+		}
+		if diameter == 0 || length == 0 {
+			diameter, length, _ = calibration.ParseSize(calculation.Inquiry.Specifications)
+		}
+	}
+	if diameter == 0 || length == 0 {
+		diameter, length, _ = calibration.ParseSize(calculation.ProductName)
+	}
+
+	completedAt := job.CalculatedAt
+	if job.CompletedAt != nil {
+		completedAt = *job.CompletedAt
+	}
+	scale := job.Quantity / float64(calculation.Quantity)
+
+	samples := map[string]calibrationSample{}
+	used := map[uuid.UUID]bool{}
+	for _, detail := range calculation.Details {
+		if detail.ProcessStep == nil || detail.ProcessStep.Code == "" {
+			continue
+		}
+		task := matchCalibrationTask(detail, tasks, used)
+		if task == nil {
+			continue
+		}
+		used[task.ID] = true
+
+		hours := jobcost.Hours(task.ActualStartTime, task.ActualEndTime, completedAt)
+		var hourlyCost float64
+		if task.WorkStation != nil {
+			hourlyCost = task.WorkStation.HourlyCost
+		}
+		quantity := task.CompletedQuantity
+		if quantity <= 0 {
+			quantity = job.Quantity
+		}
+
+		// A step run twice on a job is one sample of the process
+		sample := samples[detail.ProcessStep.Code]
+		sample.name = detail.ProcessStep.Name
+		sample.Reference = job.OrderNo
+		sample.Diameter, sample.Length, sample.Material = diameter, length, material
+		sample.Quantity = quantity
+		sample.Defects += task.DefectQuantity
+		sample.EstimatedHours += detail.TotalTimeHours * scale
+		sample.EstimatedCost += (detail.SubtotalCost + detail.YieldLossCost) * scale
+		sample.ActualHours += hours
+		sample.ActualCost += hours * hourlyCost
+		samples[detail.ProcessStep.Code] = sample
+	}
+	return samples
+}
+
+func matchCalibrationTask(detail models.CostCalculationDetail, tasks []*models.ProductionTask, used map[uuid.UUID]bool) *models.ProductionTask {
+	for _, task := range tasks {
+		if !used[task.ID] && task.TaskNo == detail.Sequence && sameProcess(task.Name, detail.ProcessStep) {
+			return task
+		}
+	}
+	for _, task := range tasks {
+		if !used[task.ID] && sameProcess(task.Name, detail.ProcessStep) {
+			return task
+		}
+	}
+	return nil
+}
+
+func sameProcess(taskName string, step *models.ProcessStep) bool {
+	taskName = strings.TrimSpace(taskName)
+	return strings.EqualFold(taskName, step.Name) ||
+		strings.EqualFold(taskName, step.Code) ||
+		(step.NameEN != "" && strings.EqualFold(taskName, step.NameEN))
+}
+
+// suggest turns the fit of a process into rates next to those in force.
+// The template base rate is scaled by the actual to estimated cost ratio,
+// or taken as the hourly cost for hourly templates; without a template the
+// actual cost per piece is suggested.
+func (s *costCalibrationService) suggest(ctx context.Context, companyID uuid.UUID, code, name string, fit calibration.Fit) (*models.CostRateSuggestion, error) {
+	suggestion := &models.CostRateSuggestion{
+		CompanyID:   companyID,
+		ProcessType: code,
+		ProcessName: name,
+		Samples:     fit.Samples,
+		ScrapRate:   fit.ScrapRate.Value,
+		Status:      models.CostSuggestionPending,
+	}
+	suggestion.Fit, _ = json.Marshal(fit)
+
+	base := fit.CostPerPiece
+	template, err := s.calibrationRepo.FindActiveTemplate(ctx, companyID, code)
+	switch {
+	case err == nil:
+		suggestion.TemplateID = template.ID
+		suggestion.TemplateVersion = templateVersion(template)
+		suggestion.CurrentBaseRate = template.BaseRate
+		if hourlyTemplateUnits[strings.ToLower(template.Unit)] {
+			base = fit.HourlyCost
+		} else if template.BaseRate > 0 && fit.CostFactor.N > 0 {
+			base = fit.CostFactor.Scale(template.BaseRate)
+		}
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, err
+	}
+	suggestion.SuggestedBaseRate = calibration.Round(base.Value)
+	suggestion.BaseRateLower = calibration.Round(base.Lower)
+	suggestion.BaseRateUpper = calibration.Round(base.Upper)
+
+	rate, err := s.calibrationRepo.FindProcessingRate(ctx, companyID, code)
+	switch {
+	case err == nil:
+		suggestion.CurrentHourlyRate = rate.HourlyRate
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, err
+	}
+	suggestion.SuggestedHourlyRate = fit.HourlyCost.Value
+	suggestion.HourlyRateLower = fit.HourlyCost.Lower
+	suggestion.HourlyRateUpper = fit.HourlyCost.Upper
+	return suggestion, nil
+}
+
+// templateVersion treats templates from before versioning as version 1
+func templateVersion(template *models.ProcessCostTemplate) int {
+	if template.Version < 1 {
+		return 1
+	}
+	return template.Version
+}
+
+func (s *costCalibrationService) CalibrateDue(ctx context.Context) (*CostCalibrationRun, error) {
+	now := time.Now().UTC()
+	run := &CostCalibrationRun{}
+	companyIDs, err := s.calibrationRepo.ListCompanyIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, companyID := range companyIDs {
+		if ctx.Err() != nil {
+			return run, ctx.Err()
+		}
+		run.Companies++
+		latest, err := s.calibrationRepo.FindLatestCalibration(ctx, companyID)
+		if err == nil && now.Sub(latest.CreatedAt) < costCalibrationInterval {
+			continue
+		}
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			run.Errors = append(run.Errors, fmt.Sprintf("%s: %v", companyID, err))
+			continue
+		}
+
+		from := now.Add(-costCalibrationWindow)
+		_, err = s.Calibrate(ctx, CostCalibrationRequest{CompanyID: companyID, From: &from, Automatic: true}, nil)
+		if errors.Is(err, ErrNoCalibrationJobs) {
+			continue
+		}
+		if err != nil {
+			run.Errors = append(run.Errors, fmt.Sprintf("%s: %v", companyID, err))
+			continue
+		}
+		run.Calibrations++
+	}
+	return run, nil
+}
+
+func (s *costCalibrationService) GetCalibration(ctx context.Context, id uuid.UUID) (*models.CostCalibration, error) {
+	record, err := s.calibrationRepo.GetCalibration(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrCostCalibrationNotFound
+	}
+	return record, err
+}
+
+func (s *costCalibrationService) ListCalibrations(ctx context.Context, params map[string]interface{}) ([]*models.CostCalibration, int64, error) {
+	return s.calibrationRepo.ListCalibrations(ctx, params)
+}
+
+func (s *costCalibrationService) GetSuggestion(ctx context.Context, id uuid.UUID) (*models.CostRateSuggestion, error) {
+	suggestion, err := s.calibrationRepo.GetSuggestion(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrCostSuggestionNotFound
+	}
+	return suggestion, err
+}
+
+func (s *costCalibrationService) ListSuggestions(ctx context.Context, params map[string]interface{}) ([]*models.CostRateSuggestion, int64, error) {
+	return s.calibrationRepo.ListSuggestions(ctx, params)
+}
+
+func (s *costCalibrationService) AcceptSuggestion(ctx context.Context, id uuid.UUID, req AcceptCostSuggestionRequest, userID uuid.UUID) (*models.ProcessCostTemplate, error) {
+	suggestion, err := s.GetSuggestion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if suggestion.Status != models.CostSuggestionPending {
+		return nil, ErrCostSuggestionDecided
+	}
+
+	baseRate := suggestion.SuggestedBaseRate
+	if req.BaseRate != nil {
+		baseRate = *req.BaseRate
+	}
+	if baseRate <= 0 {
+		return nil, ErrInvalidCostSuggestion
+	}
+
+	current, err := s.calibrationRepo.FindActiveTemplate(ctx, suggestion.CompanyID, suggestion.ProcessType)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		current = nil
+	}
+	currentID := ""
+	if current != nil {
+		currentID = current.ID
+	}
+	if currentID != suggestion.TemplateID {
+		return nil, ErrCostSuggestionStale
+	}
+
+	now := time.Now()
+	template := &models.ProcessCostTemplate{
+		ID:           uuid.New().String(),
+		CompanyID:    suggestion.CompanyID.String(),
+		ProcessType:  suggestion.ProcessType,
+		Name:         suggestion.ProcessName,
+		BaseRate:     baseRate,
+		Unit:         "piece",
+		Version:      1,
+		SuggestionID: suggestion.ID.String(),
+		ValidFrom:    now,
+		IsActive:     true,
+		CreatedBy:    userID.String(),
+		UpdatedBy:    userID.String(),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if current != nil {
+		template.Category = current.Category
+		template.Name = current.Name
+		template.Description = current.Description
+		template.SetupCost = current.SetupCost
+		template.MinQuantity = current.MinQuantity
+		template.MaxQuantity = current.MaxQuantity
+		template.Unit = current.Unit
+		template.Version = templateVersion(current) + 1
+		template.SupersedesID = current.ID
+	}
+	if req.Name != "" {
+		template.Name = req.Name
+	}
+	if req.Description != "" {
+		template.Description = req.Description
+	}
+
+	suggestion.Status = models.CostSuggestionAccepted
+	suggestion.AcceptedTemplateID = template.ID
+	suggestion.DecidedBy = &userID
+	suggestion.DecidedAt = &now
+	if err := s.calibrationRepo.AcceptSuggestion(ctx, suggestion, template, current); err != nil {
+		if errors.Is(err, repository.ErrVersionSuperseded) {
+			return nil, ErrCostSuggestionStale
+		}
+		return nil, err
+	}
+	return template, nil
+}
+
+func (s *costCalibrationService) DismissSuggestion(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.CostRateSuggestion, error) {
+	suggestion, err := s.GetSuggestion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if suggestion.Status != models.CostSuggestionPending {
+		return nil, ErrCostSuggestionDecided
+	}
+
+	now := time.Now()
+	suggestion.Status = models.CostSuggestionDismissed
+	suggestion.DecidedBy = &userID
+	suggestion.DecidedAt = &now
+	if err := s.calibrationRepo.UpdateSuggestion(ctx, suggestion); err != nil {
+		return nil, err
+	}
+	return suggestion, nil
+}
@@ -0,0 +1,678 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/domain/valueobject"
+	"github.com/fastenmind/fastener-api/internal/infrastructure/credit"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrCreditHold is returned when an order or shipment is held for credit
+	ErrCreditHold = errors.New("customer is on credit hold")
+	// ErrCreditHoldNotFound is returned when a credit hold is not found
+	ErrCreditHoldNotFound = errors.New("credit hold not found")
+	// ErrCreditHoldDecided is returned when acting on a hold that was already approved, rejected or released
+	ErrCreditHoldDecided = errors.New("credit hold is already decided")
+	// ErrCreditOverrideReason is returned when an override is requested without a reason
+	ErrCreditOverrideReason = errors.New("a reason is required to request a credit override")
+	// ErrCreditOverrideNotRequested is returned when approving a hold nobody requested an override for
+	ErrCreditOverrideNotRequested = errors.New("no credit override was requested for this hold")
+	// ErrCreditSelfApproval is returned when the requester of an override tries to approve it
+	ErrCreditSelfApproval = errors.New("a credit override must be approved by someone other than the requester")
+	// ErrInvalidCreditStatus is returned for credit statuses other than NEW, GOOD, WARNING and BLOCKED
+	ErrInvalidCreditStatus = errors.New("invalid credit status")
+	// ErrInvalidInsuredAmount is returned when the insured amount is negative
+	ErrInvalidInsuredAmount = errors.New("insured amount cannot be negative")
+)
+
+// Credit hold sources
+const (
+	CreditHoldOrder    = "order"
+	CreditHoldShipment = "shipment"
+)
+
+// creditHistoryWindow is how far back payments count towards the payment behavior
+const creditHistoryWindow = 365 * 24 * time.Hour
+
+// CreditService computes customer credit exposure, holds orders and
+// shipments that exceed the credit limit and adjusts the credit status from
+// payment behavior
+type CreditService interface {
+	// Exposure
+	GetExposure(ctx context.Context, customerID uuid.UUID) (*CustomerExposure, error)
+
+	// Checks used when orders are created and released and shipments leave
+	CheckOrder(ctx context.Context, order *models.Order, userID uuid.UUID) (*models.CreditHold, error)
+	EnsureOrderReleased(ctx context.Context, order *models.Order, userID uuid.UUID) error
+	EnsureShipmentReleased(ctx context.Context, shipment *models.Shipment) error
+
+	// Profiles
+	GetProfile(ctx context.Context, customerID uuid.UUID) (*models.CustomerCreditProfile, error)
+	UpdateProfile(ctx context.Context, customerID, userID uuid.UUID, req UpdateCreditProfileRequest) (*models.CustomerCreditProfile, error)
+	AssessCustomer(ctx context.Context, customerID uuid.UUID) (*models.CustomerCreditProfile, error)
+	AssessCompany(ctx context.Context, companyID uuid.UUID) (*CreditAssessmentResult, error)
+
+	// Dunning holds, lifted by the assessment once the overdue balance is cleared
+	HoldForDunning(ctx context.Context, customerID uuid.UUID, reason string) (*models.CustomerCreditProfile, error)
+
+	// Holds
+	ListHolds(ctx context.Context, params map[string]interface{}) ([]*models.CreditHold, int64, error)
+	GetHold(ctx context.Context, id uuid.UUID) (*models.CreditHold, error)
+	RequestOverride(ctx context.Context, id, userID uuid.UUID, reason string) (*models.CreditHold, error)
+	ApproveHold(ctx context.Context, id, userID uuid.UUID, notes string) (*models.CreditHold, error)
+	RejectHold(ctx context.Context, id, userID uuid.UUID, notes string) (*models.CreditHold, error)
+}
+
+// CustomerExposure is the live exposure of a customer in the currency of
+// its credit limit
+type CustomerExposure struct {
+	CompanyID    uuid.UUID `json:"company_id"`
+	CustomerID   uuid.UUID `json:"customer_id"`
+	CustomerName string    `json:"customer_name"`
+	credit.Exposure
+	StatusReason string `json:"status_reason"`
+}
+
+// UpdateCreditProfileRequest changes the manual parts of a credit profile.
+// Setting a status locks it against automatic adjustment until Locked is
+// cleared.
+type UpdateCreditProfileRequest struct {
+	CreditStatus       *string    `json:"credit_status"`
+	StatusReason       string     `json:"status_reason"`
+	Locked             *bool      `json:"locked"`
+	InsuredAmount      *float64   `json:"insured_amount"`
+	InsuranceCurrency  *string    `json:"insurance_currency"`
+	Insurer            *string    `json:"insurer"`
+	InsurancePolicyNo  *string    `json:"insurance_policy_no"`
+	InsuranceExpiresAt *time.Time `json:"insurance_expires_at"`
+	CustomerGroup      *string    `json:"customer_group"`
+}
+
+type CreditAssessmentResult struct {
+	Assessed int                  `json:"assessed"`
+	Changed  []CreditStatusChange `json:"changed"`
+	Errors   []string             `json:"errors,omitempty"`
+}
+
+// CreditStatusChange records a customer whose credit status was adjusted
+type CreditStatusChange struct {
+	CustomerID uuid.UUID `json:"customer_id"`
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	Reason     string    `json:"reason"`
+}
+
+type creditService struct {
+	creditRepo repository.CreditRepository
+	orderRepo  repository.OrderRepository
+	ledger     LedgerService
+	webhooks   *WebhookService
+}
+
+func NewCreditService(
+	creditRepo repository.CreditRepository,
+	orderRepo repository.OrderRepository,
+	ledger LedgerService,
+	webhooks *WebhookService,
+) CreditService {
+	return &creditService{
+		creditRepo: creditRepo,
+		orderRepo:  orderRepo,
+		ledger:     ledger,
+		webhooks:   webhooks,
+	}
+}
+
+// Exposure
+
+// GetExposure returns the exposure against the customer's credit limit,
+// under the credit status its current payment behavior calls for. Nothing
+// is stored; AssessCustomer and the credit checks store the assessment.
+func (s *creditService) GetExposure(ctx context.Context, customerID uuid.UUID) (*CustomerExposure, error) {
+	customer, err := s.getCustomer(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := s.appraise(ctx, customer)
+	if err != nil {
+		return nil, err
+	}
+	return s.exposure(ctx, customer, profile)
+}
+
+func (s *creditService) exposure(ctx context.Context, customer *models.Customer, profile *models.CustomerCreditProfile) (*CustomerExposure, error) {
+	currency := limitCurrency(customer)
+	now := time.Now()
+
+	sum := func(load func(context.Context, uuid.UUID) ([]repository.CurrencyAmount, error)) (float64, error) {
+		amounts, err := load(ctx, customer.ID)
+		if err != nil {
+			return 0, err
+		}
+		var total float64
+		for _, a := range amounts {
+			converted, err := s.convert(ctx, customer.CompanyID, a.Amount, a.Currency, currency, now)
+			if err != nil {
+				return 0, err
+			}
+			total += converted
+		}
+		return total, nil
+	}
+	openAR, err := sum(s.creditRepo.SumOpenReceivables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum open receivables: %w", err)
+	}
+	openOrders, err := sum(s.creditRepo.SumOpenOrders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum open orders: %w", err)
+	}
+	openQuotes, err := sum(s.creditRepo.SumOpenQuotes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum open quotes: %w", err)
+	}
+
+	var insured float64
+	if profile.InsuredAmount > 0 && (profile.InsuranceExpiresAt == nil || profile.InsuranceExpiresAt.After(now)) {
+		insuranceCurrency := profile.InsuranceCurrency
+		if insuranceCurrency == "" {
+			insuranceCurrency = currency
+		}
+		insured, err = s.convert(ctx, customer.CompanyID, profile.InsuredAmount, insuranceCurrency, currency, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var limit float64
+	if customer.CreditLimit != nil {
+		limit = *customer.CreditLimit
+	}
+
+	return &CustomerExposure{
+		CompanyID:    customer.CompanyID,
+		CustomerID:   customer.ID,
+		CustomerName: customer.Name,
+		Exposure:     credit.NewExposure(currency, openAR, openOrders, openQuotes, insured, limit, valueobject.CreditStatus(profile.CreditStatus)),
+		StatusReason: profile.StatusReason,
+	}, nil
+}
+
+// convert converts an amount between currencies through the base currency
+func (s *creditService) convert(ctx context.Context, companyID uuid.UUID, amount float64, from, to string, date time.Time) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if amount == 0 || from == "" || from == to {
+		return amount, nil
+	}
+	fromRate, err := s.ledger.BaseRate(ctx, companyID, from, date)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := s.ledger.BaseRate(ctx, companyID, to, date)
+	if err != nil {
+		return 0, err
+	}
+	return amount * fromRate / toRate, nil
+}
+
+// Checks
+
+// CheckOrder checks a new order against the credit limit and places it on
+// hold when it would exceed the limit. The order itself is not rejected.
+func (s *creditService) CheckOrder(ctx context.Context, order *models.Order, userID uuid.UUID) (*models.CreditHold, error) {
+	return s.evaluate(ctx, CreditHoldOrder, order.ID, order.OrderNo, order, userID)
+}
+
+// EnsureOrderReleased fails with ErrCreditHold while the order is held and
+// the customer is still beyond its limit
+func (s *creditService) EnsureOrderReleased(ctx context.Context, order *models.Order, userID uuid.UUID) error {
+	hold, err := s.evaluate(ctx, CreditHoldOrder, order.ID, order.OrderNo, order, userID)
+	if err != nil {
+		return err
+	}
+	return holdError(hold)
+}
+
+// EnsureShipmentReleased fails with ErrCreditHold while the customer of
+// the shipment's order is beyond its limit and no override was approved
+func (s *creditService) EnsureShipmentReleased(ctx context.Context, shipment *models.Shipment) error {
+	if shipment.OrderID == nil {
+		return nil
+	}
+	order, err := s.orderRepo.Get(*shipment.OrderID)
+	if err != nil {
+		return fmt.Errorf("failed to load order: %w", err)
+	}
+	hold, err := s.evaluate(ctx, CreditHoldShipment, shipment.ID, shipment.ShipmentNo, order, uuid.Nil)
+	if err != nil {
+		return err
+	}
+	return holdError(hold)
+}
+
+// evaluate checks the order behind a document against the customer's limit.
+// It returns the hold that blocks the document, or nil when it may proceed.
+// Holds are released once the customer is back within the limit; an
+// approved override stands for the life of the document.
+func (s *creditService) evaluate(ctx context.Context, sourceType string, sourceID uuid.UUID, sourceNo string, order *models.Order, userID uuid.UUID) (*models.CreditHold, error) {
+	existing, err := s.creditRepo.FindHold(ctx, sourceType, sourceID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if existing != nil && existing.Status == "approved" {
+		return nil, nil
+	}
+
+	customer, err := s.getCustomer(ctx, order.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := s.assess(ctx, customer)
+	if err != nil {
+		return nil, err
+	}
+	exposure, err := s.exposure(ctx, customer, profile)
+	if err != nil {
+		return nil, err
+	}
+	// Confirmed orders are part of the exposure already
+	var amount float64
+	if !orderInExposure(order) {
+		amount, err = s.convert(ctx, order.CompanyID, order.TotalAmount-order.PaidAmount, order.Currency, exposure.Currency, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+	decision := credit.Check(exposure.Exposure, amount)
+
+	now := time.Now()
+	if existing != nil && existing.Status != "released" {
+		if !decision.Hold {
+			existing.Status = "released"
+			existing.ReleasedAt = &now
+			return nil, s.creditRepo.UpdateHold(ctx, existing)
+		}
+		existing.Amount = decision.Amount
+		existing.Exposure = decision.Projected
+		existing.CreditLimit = exposure.EffectiveLimit
+		existing.CreditStatus = string(exposure.Status)
+		existing.Reason = decision.Reason
+		return existing, s.creditRepo.UpdateHold(ctx, existing)
+	}
+	if !decision.Hold {
+		return nil, nil
+	}
+
+	hold := &models.CreditHold{
+		CompanyID:    order.CompanyID,
+		CustomerID:   order.CustomerID,
+		CustomerName: exposure.CustomerName,
+		SourceType:   sourceType,
+		SourceID:     sourceID,
+		SourceNo:     sourceNo,
+		Currency:     exposure.Currency,
+		Amount:       decision.Amount,
+		Exposure:     decision.Projected,
+		CreditLimit:  exposure.EffectiveLimit,
+		CreditStatus: string(exposure.Status),
+		Reason:       decision.Reason,
+		Status:       "open",
+	}
+	if userID != uuid.Nil {
+		hold.CreatedBy = &userID
+	}
+	if err := s.creditRepo.CreateHold(ctx, hold); err != nil {
+		return nil, err
+	}
+
+	if s.webhooks != nil {
+		go s.webhooks.TriggerCustomerCreditLimitExceeded(order.CustomerID, decision.Projected, exposure.EffectiveLimit, order.CompanyID, userID)
+	}
+	return hold, nil
+}
+
+// orderInExposure reports whether the order is counted as an open order
+func orderInExposure(order *models.Order) bool {
+	if order.InvoiceID != nil {
+		return false
+	}
+	switch order.Status {
+	case "confirmed", "in_production", "quality_check", "ready_to_ship":
+		return true
+	}
+	return false
+}
+
+func holdError(hold *models.CreditHold) error {
+	if hold == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s: %s", ErrCreditHold, hold.SourceType, hold.SourceNo, hold.Reason)
+}
+
+// Profiles
+
+// GetProfile returns the credit profile of a customer, a NEW one when the
+// customer was never assessed
+func (s *creditService) GetProfile(ctx context.Context, customerID uuid.UUID) (*models.CustomerCreditProfile, error) {
+	customer, err := s.getCustomer(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	return s.profile(ctx, customer)
+}
+
+func (s *creditService) UpdateProfile(ctx context.Context, customerID, userID uuid.UUID, req UpdateCreditProfileRequest) (*models.CustomerCreditProfile, error) {
+	customer, err := s.getCustomer(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := s.profile(ctx, customer)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.CreditStatus != nil {
+		status := valueobject.CreditStatus(strings.ToUpper(*req.CreditStatus))
+		if err := status.Validate(); err != nil {
+			return nil, ErrInvalidCreditStatus
+		}
+		profile.CreditStatus = string(status)
+		profile.StatusReason = req.StatusReason
+		profile.StatusLocked = true
+	}
+	if req.Locked != nil {
+		profile.StatusLocked = *req.Locked
+	}
+	if req.InsuredAmount != nil {
+		if *req.InsuredAmount < 0 {
+			return nil, ErrInvalidInsuredAmount
+		}
+		profile.InsuredAmount = *req.InsuredAmount
+	}
+	if req.InsuranceCurrency != nil {
+		profile.InsuranceCurrency = strings.ToUpper(*req.InsuranceCurrency)
+	}
+	if req.Insurer != nil {
+		profile.Insurer = *req.Insurer
+	}
+	if req.InsurancePolicyNo != nil {
+		profile.InsurancePolicyNo = *req.InsurancePolicyNo
+	}
+	if req.InsuranceExpiresAt != nil {
+		profile.InsuranceExpiresAt = req.InsuranceExpiresAt
+	}
+	if req.CustomerGroup != nil {
+		profile.CustomerGroup = strings.TrimSpace(*req.CustomerGroup)
+	}
+	profile.UpdatedBy = &userID
+
+	if err := s.creditRepo.SaveProfile(ctx, profile); err != nil {
+		return nil, err
+	}
+	if !profile.StatusLocked {
+		return s.assess(ctx, customer)
+	}
+	return profile, nil
+}
+
+// AssessCustomer recomputes the payment behavior of a customer and adjusts
+// its credit status unless the status is locked
+func (s *creditService) AssessCustomer(ctx context.Context, customerID uuid.UUID) (*models.CustomerCreditProfile, error) {
+	customer, err := s.getCustomer(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	return s.assess(ctx, customer)
+}
+
+// HoldForDunning blocks the customer's credit until its overdue balance is
+// cleared. Unlike a manual status the hold does not lock the profile, so the
+// next assessment after payment lifts it; a locked profile keeps its status.
+func (s *creditService) HoldForDunning(ctx context.Context, customerID uuid.UUID, reason string) (*models.CustomerCreditProfile, error) {
+	customer, err := s.getCustomer(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := s.appraise(ctx, customer)
+	if err != nil {
+		return nil, err
+	}
+	if profile.OverdueAmount <= 0 {
+		// Paid since the notice was built
+		return profile, s.creditRepo.SaveProfile(ctx, profile)
+	}
+	profile.DunningHold = true
+	if !profile.StatusLocked {
+		profile.CreditStatus = string(valueobject.CreditStatusBlocked)
+		profile.StatusReason = reason
+	}
+	if err := s.creditRepo.SaveProfile(ctx, profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// AssessCompany assesses all active customers of a company
+func (s *creditService) AssessCompany(ctx context.Context, companyID uuid.UUID) (*CreditAssessmentResult, error) {
+	ids, err := s.creditRepo.ListCustomerIDs(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	result := &CreditAssessmentResult{Changed: []CreditStatusChange{}}
+	for _, id := range ids {
+		customer, err := s.getCustomer(ctx, id)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("customer %s: %v", id, err))
+			continue
+		}
+		before, err := s.profile(ctx, customer)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("customer %s: %v", id, err))
+			continue
+		}
+		previous := before.CreditStatus
+		after, err := s.assess(ctx, customer)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("customer %s: %v", id, err))
+			continue
+		}
+		result.Assessed++
+		if after.CreditStatus != previous {
+			result.Changed = append(result.Changed, CreditStatusChange{
+				CustomerID: id,
+				From:       previous,
+				To:         after.CreditStatus,
+				Reason:     after.StatusReason,
+			})
+		}
+	}
+	return result, nil
+}
+
+// assess appraises the customer's payment behavior and stores the profile
+func (s *creditService) assess(ctx context.Context, customer *models.Customer) (*models.CustomerCreditProfile, error) {
+	profile, err := s.appraise(ctx, customer)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.creditRepo.SaveProfile(ctx, profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// appraise derives the customer's payment behavior from the last year of
+// payments and its open invoices and moves the credit status of the
+// profile accordingly, without storing it
+func (s *creditService) appraise(ctx context.Context, customer *models.Customer) (*models.CustomerCreditProfile, error) {
+	profile, err := s.profile(ctx, customer)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	rows, err := s.creditRepo.ListSettlements(ctx, customer.ID, now.Add(-creditHistoryWindow))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load payment history: %w", err)
+	}
+	settlements := make([]credit.Settlement, 0, len(rows))
+	for _, row := range rows {
+		rate := row.ExchangeRate
+		if rate <= 0 {
+			rate = 1
+		}
+		settlements = append(settlements, credit.Settlement{
+			Amount:    row.Amount * rate,
+			DueDate:   row.DueDate,
+			SettledAt: row.SettledAt,
+		})
+	}
+
+	history := credit.PaymentHistory(settlements, now)
+	profile.DaysBeyondTerms = history.DaysBeyondTerms
+	profile.OverdueAmount = history.OverdueAmount
+	profile.MaxOverdueDays = history.MaxOverdueDays
+	profile.LastAssessedAt = &now
+	if profile.DunningHold && history.OverdueAmount <= 0 {
+		profile.DunningHold = false
+	}
+	if !profile.StatusLocked && !profile.DunningHold {
+		assessed, reason := credit.Assess(history, credit.DefaultPolicy())
+		next := credit.Next(valueobject.CreditStatus(profile.CreditStatus), assessed)
+		if next == assessed {
+			profile.StatusReason = reason
+		}
+		profile.CreditStatus = string(next)
+	}
+	return profile, nil
+}
+
+// profile loads the customer's credit profile or starts a NEW one
+func (s *creditService) profile(ctx context.Context, customer *models.Customer) (*models.CustomerCreditProfile, error) {
+	profile, err := s.creditRepo.GetProfile(ctx, customer.ID)
+	if err == nil {
+		return profile, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	return &models.CustomerCreditProfile{
+		CompanyID:    customer.CompanyID,
+		CustomerID:   customer.ID,
+		CreditStatus: string(valueobject.CreditStatusNew),
+		StatusReason: "no payment history",
+	}, nil
+}
+
+func (s *creditService) getCustomer(ctx context.Context, id uuid.UUID) (*models.Customer, error) {
+	customer, err := s.creditRepo.GetCustomer(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrCustomerNotFound
+		}
+		return nil, err
+	}
+	return customer, nil
+}
+
+// limitCurrency is the currency a customer's credit limit is kept in
+func limitCurrency(customer *models.Customer) string {
+	if currency := strings.ToUpper(strings.TrimSpace(customer.Currency)); currency != "" {
+		return currency
+	}
+	return ledgerBaseCurrency
+}
+
+// Holds
+
+func (s *creditService) ListHolds(ctx context.Context, params map[string]interface{}) ([]*models.CreditHold, int64, error) {
+	return s.creditRepo.ListHolds(ctx, params)
+}
+
+func (s *creditService) GetHold(ctx context.Context, id uuid.UUID) (*models.CreditHold, error) {
+	hold, err := s.creditRepo.GetHold(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrCreditHoldNotFound
+		}
+		return nil, err
+	}
+	return hold, nil
+}
+
+// RequestOverride asks for a held document to be released despite the limit
+func (s *creditService) RequestOverride(ctx context.Context, id, userID uuid.UUID, reason string) (*models.CreditHold, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, ErrCreditOverrideReason
+	}
+	hold, err := s.GetHold(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status != "open" && hold.Status != "override_requested" {
+		return nil, ErrCreditHoldDecided
+	}
+	now := time.Now()
+	hold.Status = "override_requested"
+	hold.OverrideRequestedBy = &userID
+	hold.OverrideRequestedAt = &now
+	hold.OverrideReason = reason
+	if err := s.creditRepo.UpdateHold(ctx, hold); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// ApproveHold approves a requested override, releasing the document. The
+// requester cannot approve their own request.
+func (s *creditService) ApproveHold(ctx context.Context, id, userID uuid.UUID, notes string) (*models.CreditHold, error) {
+	hold, err := s.GetHold(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case hold.Status == "open":
+		return nil, ErrCreditOverrideNotRequested
+	case hold.Status != "override_requested":
+		return nil, ErrCreditHoldDecided
+	case hold.OverrideRequestedBy != nil && *hold.OverrideRequestedBy == userID:
+		return nil, ErrCreditSelfApproval
+	}
+	return s.decide(ctx, hold, "approved", userID, notes)
+}
+
+// RejectHold rejects the override of a hold; the document stays held until
+// the customer is back within the limit
+func (s *creditService) RejectHold(ctx context.Context, id, userID uuid.UUID, notes string) (*models.CreditHold, error) {
+	hold, err := s.GetHold(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status != "open" && hold.Status != "override_requested" {
+		return nil, ErrCreditHoldDecided
+	}
+	return s.decide(ctx, hold, "rejected", userID, notes)
+}
+
+func (s *creditService) decide(ctx context.Context, hold *models.CreditHold, status string, userID uuid.UUID, notes string) (*models.CreditHold, error) {
+	now := time.Now()
+	hold.Status = status
+	hold.DecidedBy = &userID
+	hold.DecidedAt = &now
+	hold.DecisionNotes = notes
+	if status == "approved" {
+		hold.ReleasedAt = &now
+	}
+	if err := s.creditRepo.UpdateHold(ctx, hold); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/repository"
+)
+
+// NewDunningScheduler creates a runner that runs the dunning engine and
+// pushes the collection worklist every interval
+func NewDunningScheduler(dunning DunningService, runs repository.JobRunRepository, interval time.Duration) *PeriodicRunner {
+	return NewPeriodicRunner("dunning-scheduler", interval, runs, func(ctx context.Context) error {
+		result, err := dunning.RunDaily(ctx)
+		if err != nil {
+			return err
+		}
+		if result != nil && len(result.Errors) > 0 {
+			log.Printf("dunning run: %d notices, %d errors, first: %s", result.Notices, len(result.Errors), result.Errors[0])
+		}
+		return nil
+	})
+}
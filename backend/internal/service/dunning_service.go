@@ -0,0 +1,1112 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/dunning"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrDunningPolicyNotFound is returned when a dunning policy is not found
+	ErrDunningPolicyNotFound = errors.New("dunning policy not found")
+	// ErrDunningTemplateNotFound is returned when a dunning template is not found
+	ErrDunningTemplateNotFound = errors.New("dunning template not found")
+	// ErrDunningNoticeNotFound is returned when a dunning notice is not found
+	ErrDunningNoticeNotFound = errors.New("dunning notice not found")
+	// ErrPromiseNotFound is returned when a promise to pay is not found
+	ErrPromiseNotFound = errors.New("promise to pay not found")
+	// ErrInvalidDunningPolicy is returned when a policy has no group, no
+	// stages or stages that do not escalate
+	ErrInvalidDunningPolicy = errors.New("invalid dunning policy")
+	// ErrInvalidDunningTemplate is returned when a template cannot be parsed
+	ErrInvalidDunningTemplate = errors.New("invalid dunning template")
+	// ErrInvalidPromise is returned when a promise has no amount or date
+	ErrInvalidPromise = errors.New("promise to pay needs a positive amount and a date")
+	// ErrPromiseClosed is returned when a promise that is no longer open is changed
+	ErrPromiseClosed = errors.New("promise to pay is no longer open")
+	// ErrInvalidCollectorNote is returned when a collector note is empty
+	ErrInvalidCollectorNote = errors.New("collector note is empty")
+)
+
+// DefaultCustomerGroup is the policy group of customers without a group
+const DefaultCustomerGroup = "default"
+
+// Dunning channels and notice statuses
+const (
+	DunningChannelEmail  = "email"
+	DunningChannelLetter = "letter"
+
+	DunningNoticeGenerated = "generated"
+	DunningNoticeSent      = "sent"
+	DunningNoticeFailed    = "failed"
+)
+
+// DunningMailer sends notices by email
+type DunningMailer interface {
+	SendEmail(to []string, subject, body string) error
+}
+
+// DunningService chases overdue sales invoices: it marks them overdue,
+// sends escalating notices by policy, tracks promises to pay and collector
+// notes and builds the daily collection worklist
+type DunningService interface {
+	// Policies and templates
+	CreatePolicy(ctx context.Context, companyID, userID uuid.UUID, req DunningPolicyRequest) (*models.DunningPolicy, error)
+	UpdatePolicy(ctx context.Context, id, userID uuid.UUID, req DunningPolicyRequest) (*models.DunningPolicy, error)
+	GetPolicy(ctx context.Context, id uuid.UUID) (*models.DunningPolicy, error)
+	ListPolicies(ctx context.Context, companyID uuid.UUID) ([]*models.DunningPolicy, error)
+	CreateTemplate(ctx context.Context, companyID, userID uuid.UUID, req DunningTemplateRequest) (*models.DunningTemplate, error)
+	UpdateTemplate(ctx context.Context, id, userID uuid.UUID, req DunningTemplateRequest) (*models.DunningTemplate, error)
+	GetTemplate(ctx context.Context, id uuid.UUID) (*models.DunningTemplate, error)
+	ListTemplates(ctx context.Context, companyID uuid.UUID) ([]*models.DunningTemplate, error)
+
+	// Runs and notices
+	Run(ctx context.Context, req RunDunningRequest) (*DunningRunResult, error)
+	RunDaily(ctx context.Context) (*DunningDailyResult, error)
+	GetStatement(ctx context.Context, companyID, customerID uuid.UUID, date time.Time) (*CustomerStatement, error)
+	ListNotices(ctx context.Context, params map[string]interface{}) ([]*models.DunningNotice, int64, error)
+	GetNotice(ctx context.Context, id uuid.UUID) (*models.DunningNotice, error)
+	MarkNoticeSent(ctx context.Context, id uuid.UUID) (*models.DunningNotice, error)
+
+	// Promises to pay and collector notes
+	CreatePromise(ctx context.Context, companyID, userID uuid.UUID, req PromiseToPayRequest) (*models.PromiseToPay, error)
+	GetPromise(ctx context.Context, id uuid.UUID) (*models.PromiseToPay, error)
+	CancelPromise(ctx context.Context, id uuid.UUID) (*models.PromiseToPay, error)
+	ListPromises(ctx context.Context, params map[string]interface{}) ([]*models.PromiseToPay, int64, error)
+	CreateNote(ctx context.Context, companyID, userID uuid.UUID, req CollectorNoteRequest) (*models.CollectorNote, error)
+	ListNotes(ctx context.Context, params map[string]interface{}) ([]*models.CollectorNote, int64, error)
+
+	// Worklist
+	GetWorklist(ctx context.Context, companyID uuid.UUID, date time.Time) (*CollectionWorklist, error)
+	PushWorklist(ctx context.Context, companyID uuid.UUID, date time.Time) (*WorklistPushResult, error)
+}
+
+type DunningStageRequest struct {
+	Sequence    int        `json:"sequence"`
+	Level       string     `json:"level"`
+	DaysOverdue int        `json:"days_overdue"`
+	Channel     string     `json:"channel"`
+	TemplateID  *uuid.UUID `json:"template_id"`
+	Fee         float64    `json:"fee"`
+}
+
+type DunningPolicyRequest struct {
+	CustomerGroup     string                `json:"customer_group"`
+	Name              string                `json:"name"`
+	InterestRate      float64               `json:"interest_rate"`
+	InterestGraceDays int                   `json:"interest_grace_days"`
+	PayWithinDays     int                   `json:"pay_within_days"`
+	CollectorID       *uuid.UUID            `json:"collector_id"`
+	IsActive          *bool                 `json:"is_active"`
+	Stages            []DunningStageRequest `json:"stages"`
+}
+
+type DunningTemplateRequest struct {
+	Name     string `json:"name"`
+	Level    string `json:"level"`
+	Language string `json:"language"`
+	Subject  string `json:"subject"`
+	Body     string `json:"body"`
+}
+
+type RunDunningRequest struct {
+	CompanyID uuid.UUID `json:"-"`
+	UserID    uuid.UUID `json:"-"`
+	Date      time.Time `json:"date"`
+	DryRun    bool      `json:"dry_run"` // render notices without storing or sending them
+}
+
+type DunningRunResult struct {
+	Date           time.Time               `json:"date"`
+	DryRun         bool                    `json:"dry_run"`
+	MarkedOverdue  int64                   `json:"marked_overdue"`
+	PromisesKept   int                     `json:"promises_kept"`
+	PromisesBroken int                     `json:"promises_broken"`
+	Notices        []*models.DunningNotice `json:"notices"`
+	CreditHolds    []uuid.UUID             `json:"credit_holds"`
+	CreditReleases []uuid.UUID             `json:"credit_releases"`
+	Skipped        []string                `json:"skipped,omitempty"`
+}
+
+type DunningDailyResult struct {
+	Companies int      `json:"companies"`
+	Notices   int      `json:"notices"`
+	Pushed    int      `json:"pushed"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// CustomerStatement lists a customer's overdue invoices per currency with
+// the interest accrued at a date
+type CustomerStatement struct {
+	CustomerID uuid.UUID           `json:"customer_id"`
+	Date       time.Time           `json:"date"`
+	Statements []dunning.Statement `json:"statements"`
+}
+
+type PromiseToPayRequest struct {
+	CustomerID   uuid.UUID  `json:"customer_id"`
+	InvoiceID    *uuid.UUID `json:"invoice_id"`
+	Amount       float64    `json:"amount"`
+	Currency     string     `json:"currency"`
+	PromisedDate time.Time  `json:"promised_date"`
+	Notes        string     `json:"notes"`
+}
+
+type CollectorNoteRequest struct {
+	CustomerID    uuid.UUID  `json:"customer_id"`
+	InvoiceID     *uuid.UUID `json:"invoice_id"`
+	ContactMethod string     `json:"contact_method"`
+	Note          string     `json:"note"`
+	FollowUpDate  *time.Time `json:"follow_up_date"`
+}
+
+// WorklistItem is one customer account to chase today
+type WorklistItem struct {
+	CustomerID     uuid.UUID            `json:"customer_id"`
+	CustomerName   string               `json:"customer_name"`
+	CustomerGroup  string               `json:"customer_group"`
+	CollectorID    *uuid.UUID           `json:"collector_id"`
+	Invoices       int                  `json:"invoices"`
+	OverdueBase    float64              `json:"overdue_base"` // overdue balance at booked rates
+	MaxDaysOverdue int                  `json:"max_days_overdue"`
+	Level          string               `json:"level"`
+	BrokenPromises int                  `json:"broken_promises"`
+	OpenPromise    *models.PromiseToPay `json:"open_promise,omitempty"`
+	FollowUpDue    bool                 `json:"follow_up_due"`
+	Priority       float64              `json:"priority"`
+}
+
+type CollectionWorklist struct {
+	Date  time.Time       `json:"date"`
+	Items []*WorklistItem `json:"items"`
+}
+
+type WorklistPushResult struct {
+	Date       time.Time `json:"date"`
+	Collectors int       `json:"collectors"`
+	Accounts   int       `json:"accounts"`
+	Unassigned int       `json:"unassigned"` // accounts whose policy has no collector
+}
+
+type dunningService struct {
+	dunningRepo repository.DunningRepository
+	creditRepo  repository.CreditRepository
+	credit      CreditService
+	mobile      MobileService
+	mailer      DunningMailer
+}
+
+// NewDunningService creates a new dunning service
+func NewDunningService(dunningRepo repository.DunningRepository, creditRepo repository.CreditRepository, credit CreditService, mobile MobileService, mailer DunningMailer) DunningService {
+	return &dunningService{
+		dunningRepo: dunningRepo,
+		creditRepo:  creditRepo,
+		credit:      credit,
+		mobile:      mobile,
+		mailer:      mailer,
+	}
+}
+
+// Policies and templates
+
+func (s *dunningService) CreatePolicy(ctx context.Context, companyID, userID uuid.UUID, req DunningPolicyRequest) (*models.DunningPolicy, error) {
+	policy := &models.DunningPolicy{CompanyID: companyID, IsActive: true}
+	if err := s.applyPolicy(ctx, policy, userID, req); err != nil {
+		return nil, err
+	}
+	if err := s.dunningRepo.CreatePolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (s *dunningService) UpdatePolicy(ctx context.Context, id, userID uuid.UUID, req DunningPolicyRequest) (*models.DunningPolicy, error) {
+	policy, err := s.GetPolicy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyPolicy(ctx, policy, userID, req); err != nil {
+		return nil, err
+	}
+	if err := s.dunningRepo.UpdatePolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (s *dunningService) applyPolicy(ctx context.Context, policy *models.DunningPolicy, userID uuid.UUID, req DunningPolicyRequest) error {
+	group := strings.TrimSpace(req.CustomerGroup)
+	if group == "" {
+		group = DefaultCustomerGroup
+	}
+	if len(req.Stages) == 0 || req.InterestRate < 0 || req.InterestGraceDays < 0 || req.PayWithinDays < 0 {
+		return ErrInvalidDunningPolicy
+	}
+
+	sort.Slice(req.Stages, func(i, j int) bool { return req.Stages[i].Sequence < req.Stages[j].Sequence })
+	stages := make([]dunning.Stage, 0, len(req.Stages))
+	policyStages := make([]models.DunningStage, 0, len(req.Stages))
+	for _, r := range req.Stages {
+		channel := r.Channel
+		if channel == "" {
+			channel = DunningChannelEmail
+		}
+		if (channel != DunningChannelEmail && channel != DunningChannelLetter) || r.Fee < 0 {
+			return ErrInvalidDunningPolicy
+		}
+		if r.TemplateID != nil {
+			template, err := s.GetTemplate(ctx, *r.TemplateID)
+			if err != nil {
+				return err
+			}
+			if template.CompanyID != policy.CompanyID {
+				return ErrDunningTemplateNotFound
+			}
+		}
+		stages = append(stages, dunning.Stage{Sequence: r.Sequence, Level: r.Level, DaysOverdue: r.DaysOverdue})
+		policyStages = append(policyStages, models.DunningStage{
+			Sequence:    r.Sequence,
+			Level:       r.Level,
+			DaysOverdue: r.DaysOverdue,
+			Channel:     channel,
+			TemplateID:  r.TemplateID,
+			Fee:         r.Fee,
+		})
+	}
+	if err := dunning.ValidateStages(stages); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDunningPolicy, err)
+	}
+
+	policy.CustomerGroup = group
+	policy.Name = req.Name
+	if policy.Name == "" {
+		policy.Name = group
+	}
+	policy.InterestRate = req.InterestRate
+	policy.InterestGraceDays = req.InterestGraceDays
+	policy.PayWithinDays = req.PayWithinDays
+	policy.CollectorID = req.CollectorID
+	if req.IsActive != nil {
+		policy.IsActive = *req.IsActive
+	}
+	policy.Stages = policyStages
+	policy.UpdatedBy = &userID
+	return nil
+}
+
+func (s *dunningService) GetPolicy(ctx context.Context, id uuid.UUID) (*models.DunningPolicy, error) {
+	policy, err := s.dunningRepo.GetPolicy(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrDunningPolicyNotFound
+		}
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (s *dunningService) ListPolicies(ctx context.Context, companyID uuid.UUID) ([]*models.DunningPolicy, error) {
+	return s.dunningRepo.ListPolicies(ctx, companyID)
+}
+
+func (s *dunningService) CreateTemplate(ctx context.Context, companyID, userID uuid.UUID, req DunningTemplateRequest) (*models.DunningTemplate, error) {
+	template := &models.DunningTemplate{CompanyID: companyID}
+	if err := applyTemplate(template, userID, req); err != nil {
+		return nil, err
+	}
+	if err := s.dunningRepo.CreateTemplate(ctx, template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func (s *dunningService) UpdateTemplate(ctx context.Context, id, userID uuid.UUID, req DunningTemplateRequest) (*models.DunningTemplate, error) {
+	template, err := s.GetTemplate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyTemplate(template, userID, req); err != nil {
+		return nil, err
+	}
+	if err := s.dunningRepo.UpdateTemplate(ctx, template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func applyTemplate(template *models.DunningTemplate, userID uuid.UUID, req DunningTemplateRequest) error {
+	if req.Name == "" || !dunning.ValidLevel(req.Level) || req.Subject == "" || req.Body == "" {
+		return ErrInvalidDunningTemplate
+	}
+	if err := dunning.ParseTemplate(req.Subject, req.Body); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDunningTemplate, err)
+	}
+	// Render against an empty statement to catch unknown fields up front
+	if _, _, err := dunning.Render(req.Subject, req.Body, dunning.Statement{}); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDunningTemplate, err)
+	}
+	template.Name = req.Name
+	template.Level = req.Level
+	template.Language = req.Language
+	template.Subject = req.Subject
+	template.Body = req.Body
+	template.UpdatedBy = &userID
+	return nil
+}
+
+func (s *dunningService) GetTemplate(ctx context.Context, id uuid.UUID) (*models.DunningTemplate, error) {
+	template, err := s.dunningRepo.GetTemplate(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrDunningTemplateNotFound
+		}
+		return nil, err
+	}
+	return template, nil
+}
+
+func (s *dunningService) ListTemplates(ctx context.Context, companyID uuid.UUID) ([]*models.DunningTemplate, error) {
+	return s.dunningRepo.ListTemplates(ctx, companyID)
+}
+
+// Runs
+
+// Run marks invoices overdue, settles promises to pay and sends each
+// customer one notice per currency for the invoices that reached a new stage
+func (s *dunningService) Run(ctx context.Context, req RunDunningRequest) (*DunningRunResult, error) {
+	date := req.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	result := &DunningRunResult{Date: date, DryRun: req.DryRun}
+
+	if !req.DryRun {
+		marked, err := s.dunningRepo.MarkOverdue(ctx, req.CompanyID, date)
+		if err != nil {
+			return nil, err
+		}
+		result.MarkedOverdue = marked
+	}
+
+	promises, err := s.settlePromises(ctx, req.CompanyID, date, !req.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range promises {
+		switch p.Status {
+		case dunning.PromiseKept:
+			result.PromisesKept++
+		case dunning.PromiseBroken:
+			result.PromisesBroken++
+		}
+	}
+
+	invoices, err := s.dunningRepo.ListOverdueInvoices(ctx, req.CompanyID, date)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, account := range groupByCustomer(invoices) {
+		customer := account[0].Customer
+		if customer == nil {
+			continue
+		}
+		policy, _, err := s.customerPolicy(ctx, customer)
+		if err != nil {
+			if errors.Is(err, ErrDunningPolicyNotFound) {
+				result.Skipped = append(result.Skipped, fmt.Sprintf("%s: no dunning policy", customer.Name))
+				continue
+			}
+			return nil, err
+		}
+
+		open := openPromiseCover(promises, customer.ID)
+		byCurrency := map[string][]*models.Invoice{}
+		var currencies []string
+		for _, inv := range account {
+			if open.covers(inv.ID) {
+				continue
+			}
+			if _, ok := byCurrency[inv.Currency]; !ok {
+				currencies = append(currencies, inv.Currency)
+			}
+			byCurrency[inv.Currency] = append(byCurrency[inv.Currency], inv)
+		}
+
+		for _, currency := range currencies {
+			notice, err := s.buildNotice(ctx, policy, customer, currency, byCurrency[currency], date, req.UserID)
+			if err != nil {
+				result.Skipped = append(result.Skipped, fmt.Sprintf("%s %s: %v", customer.Name, currency, err))
+				continue
+			}
+			if notice == nil {
+				continue
+			}
+			if !req.DryRun {
+				if err := s.dunningRepo.CreateNotice(ctx, notice); err != nil {
+					return nil, err
+				}
+				if err := s.deliver(ctx, notice); err != nil {
+					return nil, err
+				}
+				if notice.Level == dunning.LevelCreditHold {
+					held, err := s.holdCredit(ctx, customer.ID, notice)
+					if err != nil {
+						return nil, err
+					}
+					if held {
+						result.CreditHolds = append(result.CreditHolds, customer.ID)
+					}
+				}
+			}
+			result.Notices = append(result.Notices, notice)
+		}
+	}
+
+	if !req.DryRun {
+		released, err := s.releaseCredit(ctx, req.CompanyID)
+		if err != nil {
+			return nil, err
+		}
+		result.CreditReleases = released
+	}
+	return result, nil
+}
+
+// RunDaily runs dunning and pushes the worklist for every company with an
+// active policy
+func (s *dunningService) RunDaily(ctx context.Context) (*DunningDailyResult, error) {
+	companies, err := s.dunningRepo.ListPolicyCompanies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	date := time.Now()
+	result := &DunningDailyResult{Companies: len(companies)}
+	for _, companyID := range companies {
+		run, err := s.Run(ctx, RunDunningRequest{CompanyID: companyID, Date: date})
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", companyID, err))
+			continue
+		}
+		result.Notices += len(run.Notices)
+
+		push, err := s.PushWorklist(ctx, companyID, date)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", companyID, err))
+			continue
+		}
+		result.Pushed += push.Collectors
+	}
+	return result, nil
+}
+
+// buildNotice renders the notice for a customer's overdue invoices in one
+// currency. It returns nil when no invoice reached a new stage.
+func (s *dunningService) buildNotice(ctx context.Context, policy *models.DunningPolicy, customer *models.Customer, currency string, invoices []*models.Invoice, date time.Time, userID uuid.UUID) (*models.DunningNotice, error) {
+	stages := policyStages(policy)
+	var stage *models.DunningStage
+	var lines []dunning.Line
+	var noticeLines []models.DunningNoticeLine
+	for _, inv := range invoices {
+		days := dunning.DaysOverdue(inv.DueDate, date)
+		interest := dunning.Interest(inv.BalanceAmount, policy.InterestRate, days, policy.InterestGraceDays)
+		line := models.DunningNoticeLine{
+			InvoiceID:   inv.ID,
+			InvoiceNo:   inv.InvoiceNo,
+			DueDate:     inv.DueDate,
+			DaysOverdue: days,
+			Balance:     inv.BalanceAmount,
+			Interest:    interest,
+			Level:       stageLevel(policy, inv.DunningLevel),
+		}
+		if next, ok := dunning.NextStage(stages, inv.DunningLevel, days); ok {
+			line.Sequence = next.Sequence
+			line.Level = next.Level
+			if stage == nil || next.Sequence > stage.Sequence {
+				stage = policyStage(policy, next.Sequence)
+			}
+		}
+		noticeLines = append(noticeLines, line)
+		lines = append(lines, dunning.Line{
+			InvoiceNo:   inv.InvoiceNo,
+			IssueDate:   inv.IssueDate,
+			DueDate:     inv.DueDate,
+			DaysOverdue: days,
+			Balance:     inv.BalanceAmount,
+			Interest:    interest,
+			Level:       line.Level,
+		})
+	}
+	if stage == nil {
+		return nil, nil
+	}
+
+	statement := dunning.NewStatement(customer.Name, currency, stage.Level, date, lines, stage.Fee, policy.PayWithinDays)
+	subjectTmpl, bodyTmpl := dunning.DefaultTemplate(stage.Level)
+	if stage.TemplateID != nil {
+		template, err := s.GetTemplate(ctx, *stage.TemplateID)
+		if err != nil {
+			return nil, err
+		}
+		subjectTmpl, bodyTmpl = template.Subject, template.Body
+	}
+	subject, body, err := dunning.Render(subjectTmpl, bodyTmpl, statement)
+	if err != nil {
+		return nil, err
+	}
+	statementJSON, err := json.Marshal(statement)
+	if err != nil {
+		return nil, err
+	}
+
+	notice := &models.DunningNotice{
+		CompanyID:  customer.CompanyID,
+		CustomerID: customer.ID,
+		PolicyID:   policy.ID,
+		Level:      stage.Level,
+		Channel:    stage.Channel,
+		NoticeDate: date,
+		Currency:   currency,
+		Balance:    statement.Balance,
+		Interest:   statement.Interest,
+		Fee:        statement.Fee,
+		TotalDue:   statement.TotalDue,
+		Subject:    subject,
+		Body:       body,
+		Statement:  statementJSON,
+		Status:     DunningNoticeGenerated,
+		Lines:      noticeLines,
+	}
+	if customer.ContactEmail != nil {
+		notice.Recipient = *customer.ContactEmail
+	}
+	if userID != uuid.Nil {
+		notice.CreatedBy = &userID
+	}
+	return notice, nil
+}
+
+// deliver emails a notice. Letters stay generated until marked sent after
+// printing.
+func (s *dunningService) deliver(ctx context.Context, notice *models.DunningNotice) error {
+	if notice.Channel != DunningChannelEmail {
+		return nil
+	}
+	if notice.Recipient == "" {
+		notice.Status = DunningNoticeFailed
+		notice.SendError = "customer has no contact email"
+	} else if err := s.mailer.SendEmail([]string{notice.Recipient}, notice.Subject, notice.Body); err != nil {
+		notice.Status = DunningNoticeFailed
+		notice.SendError = err.Error()
+	} else {
+		now := time.Now()
+		notice.Status = DunningNoticeSent
+		notice.SentAt = &now
+	}
+	if err := s.dunningRepo.UpdateNotice(ctx, notice); err != nil {
+		return fmt.Errorf("failed to record delivery of notice %s: %w", notice.ID, err)
+	}
+	return nil
+}
+
+// holdCredit blocks the customer's credit so new orders and shipments are
+// held until the overdue balance is cleared. It reports whether the hold
+// was placed.
+func (s *dunningService) holdCredit(ctx context.Context, customerID uuid.UUID, notice *models.DunningNotice) (bool, error) {
+	profile, err := s.credit.HoldForDunning(ctx, customerID,
+		fmt.Sprintf("dunning credit hold on %s %.2f overdue", notice.Currency, notice.Balance))
+	if err != nil {
+		return false, err
+	}
+	return profile.DunningHold, nil
+}
+
+// releaseCredit reassesses the customers on dunning hold, which lifts the
+// hold of those that have cleared their overdue balance. It returns the
+// released customers.
+func (s *dunningService) releaseCredit(ctx context.Context, companyID uuid.UUID) ([]uuid.UUID, error) {
+	held, err := s.creditRepo.ListDunningHoldCustomerIDs(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	var released []uuid.UUID
+	for _, customerID := range held {
+		profile, err := s.credit.AssessCustomer(ctx, customerID)
+		if err != nil {
+			return nil, err
+		}
+		if !profile.DunningHold {
+			released = append(released, customerID)
+		}
+	}
+	return released, nil
+}
+
+// settlePromises decides the open promises of a company at date and stores
+// the outcome when save is set. It returns every promise it looked at.
+func (s *dunningService) settlePromises(ctx context.Context, companyID uuid.UUID, date time.Time, save bool) ([]*models.PromiseToPay, error) {
+	promises, _, err := s.dunningRepo.ListPromises(ctx, map[string]interface{}{
+		"company_id": companyID,
+		"status":     dunning.PromiseOpen,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range promises {
+		paid, err := s.dunningRepo.SumPayments(ctx, p.CustomerID, p.InvoiceID, p.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		p.PaidAmount = dunning.Round(paid)
+		p.Status = dunning.PromiseOutcome(p.Amount, paid, p.PromisedDate, date)
+		if p.Status == dunning.PromiseOpen {
+			continue
+		}
+		resolved := date
+		p.ResolvedAt = &resolved
+		if save {
+			if err := s.dunningRepo.UpdatePromise(ctx, p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return promises, nil
+}
+
+// customerPolicy returns the policy of the customer's group, falling back
+// to the default group
+func (s *dunningService) customerPolicy(ctx context.Context, customer *models.Customer) (*models.DunningPolicy, string, error) {
+	group := DefaultCustomerGroup
+	if profile, err := s.creditRepo.GetProfile(ctx, customer.ID); err == nil && profile.CustomerGroup != "" {
+		group = profile.CustomerGroup
+	} else if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, "", err
+	}
+
+	policy, err := s.dunningRepo.FindPolicy(ctx, customer.CompanyID, group)
+	if errors.Is(err, repository.ErrNotFound) && group != DefaultCustomerGroup {
+		policy, err = s.dunningRepo.FindPolicy(ctx, customer.CompanyID, DefaultCustomerGroup)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, group, ErrDunningPolicyNotFound
+		}
+		return nil, group, err
+	}
+	return policy, group, nil
+}
+
+// promiseCover is the set of invoices suspended by open promises
+type promiseCover struct {
+	account  bool
+	invoices map[uuid.UUID]bool
+}
+
+func (c promiseCover) covers(invoiceID uuid.UUID) bool {
+	return c.account || c.invoices[invoiceID]
+}
+
+func openPromiseCover(promises []*models.PromiseToPay, customerID uuid.UUID) promiseCover {
+	cover := promiseCover{invoices: map[uuid.UUID]bool{}}
+	for _, p := range promises {
+		if p.CustomerID != customerID || p.Status != dunning.PromiseOpen {
+			continue
+		}
+		if p.InvoiceID == nil {
+			cover.account = true
+		} else {
+			cover.invoices[*p.InvoiceID] = true
+		}
+	}
+	return cover
+}
+
+// groupByCustomer splits invoices ordered by customer into accounts
+func groupByCustomer(invoices []*models.Invoice) [][]*models.Invoice {
+	var accounts [][]*models.Invoice
+	index := map[uuid.UUID]int{}
+	for _, inv := range invoices {
+		if inv.CustomerID == nil {
+			continue
+		}
+		i, ok := index[*inv.CustomerID]
+		if !ok {
+			i = len(accounts)
+			index[*inv.CustomerID] = i
+			accounts = append(accounts, nil)
+		}
+		accounts[i] = append(accounts[i], inv)
+	}
+	return accounts
+}
+
+func policyStages(policy *models.DunningPolicy) []dunning.Stage {
+	stages := make([]dunning.Stage, len(policy.Stages))
+	for i, st := range policy.Stages {
+		stages[i] = dunning.Stage{Sequence: st.Sequence, Level: st.Level, DaysOverdue: st.DaysOverdue}
+	}
+	return stages
+}
+
+func policyStage(policy *models.DunningPolicy, sequence int) *models.DunningStage {
+	for i := range policy.Stages {
+		if policy.Stages[i].Sequence == sequence {
+			return &policy.Stages[i]
+		}
+	}
+	return nil
+}
+
+// stageLevel is the level of the stage an invoice was last dunned at
+func stageLevel(policy *models.DunningPolicy, sequence int) string {
+	if st := policyStage(policy, sequence); st != nil {
+		return st.Level
+	}
+	return ""
+}
+
+// Statements and notices
+
+func (s *dunningService) GetStatement(ctx context.Context, companyID, customerID uuid.UUID, date time.Time) (*CustomerStatement, error) {
+	customer, err := s.creditRepo.GetCustomer(ctx, customerID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrCustomerNotFound
+		}
+		return nil, err
+	}
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	// Without a policy the statement carries no interest
+	policy, _, err := s.customerPolicy(ctx, customer)
+	if err != nil && !errors.Is(err, ErrDunningPolicyNotFound) {
+		return nil, err
+	}
+	if policy == nil {
+		policy = &models.DunningPolicy{}
+	}
+
+	invoices, err := s.dunningRepo.ListOverdueInvoices(ctx, customer.CompanyID, date)
+	if err != nil {
+		return nil, err
+	}
+	byCurrency := map[string][]dunning.Line{}
+	var currencies []string
+	for _, inv := range invoices {
+		if inv.CustomerID == nil || *inv.CustomerID != customerID {
+			continue
+		}
+		if _, ok := byCurrency[inv.Currency]; !ok {
+			currencies = append(currencies, inv.Currency)
+		}
+		days := dunning.DaysOverdue(inv.DueDate, date)
+		byCurrency[inv.Currency] = append(byCurrency[inv.Currency], dunning.Line{
+			InvoiceNo:   inv.InvoiceNo,
+			IssueDate:   inv.IssueDate,
+			DueDate:     inv.DueDate,
+			DaysOverdue: days,
+			Balance:     inv.BalanceAmount,
+			Interest:    dunning.Interest(inv.BalanceAmount, policy.InterestRate, days, policy.InterestGraceDays),
+			Level:       stageLevel(policy, inv.DunningLevel),
+		})
+	}
+
+	statement := &CustomerStatement{CustomerID: customerID, Date: date, Statements: []dunning.Statement{}}
+	for _, currency := range currencies {
+		statement.Statements = append(statement.Statements,
+			dunning.NewStatement(customer.Name, currency, "", date, byCurrency[currency], 0, policy.PayWithinDays))
+	}
+	return statement, nil
+}
+
+func (s *dunningService) ListNotices(ctx context.Context, params map[string]interface{}) ([]*models.DunningNotice, int64, error) {
+	return s.dunningRepo.ListNotices(ctx, params)
+}
+
+func (s *dunningService) GetNotice(ctx context.Context, id uuid.UUID) (*models.DunningNotice, error) {
+	notice, err := s.dunningRepo.GetNotice(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrDunningNoticeNotFound
+		}
+		return nil, err
+	}
+	return notice, nil
+}
+
+// MarkNoticeSent records that a printed letter was posted
+func (s *dunningService) MarkNoticeSent(ctx context.Context, id uuid.UUID) (*models.DunningNotice, error) {
+	notice, err := s.GetNotice(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notice.Status = DunningNoticeSent
+	notice.SendError = ""
+	notice.SentAt = &now
+	if err := s.dunningRepo.UpdateNotice(ctx, notice); err != nil {
+		return nil, err
+	}
+	return notice, nil
+}
+
+// Promises to pay and collector notes
+
+func (s *dunningService) CreatePromise(ctx context.Context, companyID, userID uuid.UUID, req PromiseToPayRequest) (*models.PromiseToPay, error) {
+	if req.Amount <= 0 || req.PromisedDate.IsZero() {
+		return nil, ErrInvalidPromise
+	}
+	customer, err := s.companyCustomer(ctx, companyID, req.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if currency == "" {
+		currency = limitCurrency(customer)
+	}
+
+	promise := &models.PromiseToPay{
+		CompanyID:    companyID,
+		CustomerID:   customer.ID,
+		InvoiceID:    req.InvoiceID,
+		Amount:       req.Amount,
+		Currency:     currency,
+		PromisedDate: req.PromisedDate,
+		Status:       dunning.PromiseOpen,
+		Notes:        req.Notes,
+		CreatedBy:    userID,
+	}
+	if err := s.dunningRepo.CreatePromise(ctx, promise); err != nil {
+		return nil, err
+	}
+	return promise, nil
+}
+
+func (s *dunningService) GetPromise(ctx context.Context, id uuid.UUID) (*models.PromiseToPay, error) {
+	promise, err := s.dunningRepo.GetPromise(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrPromiseNotFound
+		}
+		return nil, err
+	}
+	return promise, nil
+}
+
+func (s *dunningService) CancelPromise(ctx context.Context, id uuid.UUID) (*models.PromiseToPay, error) {
+	promise, err := s.GetPromise(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if promise.Status != dunning.PromiseOpen {
+		return nil, ErrPromiseClosed
+	}
+	now := time.Now()
+	promise.Status = "cancelled"
+	promise.ResolvedAt = &now
+	if err := s.dunningRepo.UpdatePromise(ctx, promise); err != nil {
+		return nil, err
+	}
+	return promise, nil
+}
+
+func (s *dunningService) ListPromises(ctx context.Context, params map[string]interface{}) ([]*models.PromiseToPay, int64, error) {
+	return s.dunningRepo.ListPromises(ctx, params)
+}
+
+func (s *dunningService) CreateNote(ctx context.Context, companyID, userID uuid.UUID, req CollectorNoteRequest) (*models.CollectorNote, error) {
+	if strings.TrimSpace(req.Note) == "" {
+		return nil, ErrInvalidCollectorNote
+	}
+	customer, err := s.companyCustomer(ctx, companyID, req.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	note := &models.CollectorNote{
+		CompanyID:     companyID,
+		CustomerID:    customer.ID,
+		InvoiceID:     req.InvoiceID,
+		ContactMethod: req.ContactMethod,
+		Note:          req.Note,
+		FollowUpDate:  req.FollowUpDate,
+		CreatedBy:     userID,
+	}
+	if err := s.dunningRepo.CreateNote(ctx, note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+func (s *dunningService) ListNotes(ctx context.Context, params map[string]interface{}) ([]*models.CollectorNote, int64, error) {
+	return s.dunningRepo.ListNotes(ctx, params)
+}
+
+func (s *dunningService) companyCustomer(ctx context.Context, companyID, customerID uuid.UUID) (*models.Customer, error) {
+	customer, err := s.creditRepo.GetCustomer(ctx, customerID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrCustomerNotFound
+		}
+		return nil, err
+	}
+	if customer.CompanyID != companyID {
+		return nil, ErrCustomerNotFound
+	}
+	return customer, nil
+}
+
+// Worklist
+
+// GetWorklist ranks the customers with overdue invoices by collection
+// priority
+func (s *dunningService) GetWorklist(ctx context.Context, companyID uuid.UUID, date time.Time) (*CollectionWorklist, error) {
+	if date.IsZero() {
+		date = time.Now()
+	}
+	invoices, err := s.dunningRepo.ListOverdueInvoices(ctx, companyID, date)
+	if err != nil {
+		return nil, err
+	}
+	open, _, err := s.dunningRepo.ListPromises(ctx, map[string]interface{}{
+		"company_id": companyID,
+		"status":     dunning.PromiseOpen,
+	})
+	if err != nil {
+		return nil, err
+	}
+	broken, _, err := s.dunningRepo.ListPromises(ctx, map[string]interface{}{
+		"company_id":     companyID,
+		"status":         dunning.PromiseBroken,
+		"resolved_since": date.AddDate(0, 0, -90),
+	})
+	if err != nil {
+		return nil, err
+	}
+	followUps, _, err := s.dunningRepo.ListNotes(ctx, map[string]interface{}{
+		"company_id":       companyID,
+		"follow_up_before": date.AddDate(0, 0, 1),
+		"follow_up_from":   date.AddDate(0, 0, -7),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	worklist := &CollectionWorklist{Date: date, Items: []*WorklistItem{}}
+	for _, account := range groupByCustomer(invoices) {
+		customer := account[0].Customer
+		if customer == nil {
+			continue
+		}
+		item := &WorklistItem{CustomerID: customer.ID, CustomerName: customer.Name}
+		policy, group, err := s.customerPolicy(ctx, customer)
+		if err != nil && !errors.Is(err, ErrDunningPolicyNotFound) {
+			return nil, err
+		}
+		item.CustomerGroup = group
+		if policy != nil {
+			item.CollectorID = policy.CollectorID
+		}
+
+		for _, inv := range account {
+			item.Invoices++
+			rate := inv.ExchangeRate
+			if rate <= 0 {
+				rate = 1
+			}
+			item.OverdueBase += inv.BalanceAmount * rate
+			if days := dunning.DaysOverdue(inv.DueDate, date); days > item.MaxDaysOverdue {
+				item.MaxDaysOverdue = days
+			}
+			if policy != nil {
+				if level := stageLevel(policy, inv.DunningLevel); dunning.Escalates(level, item.Level) {
+					item.Level = level
+				}
+			}
+		}
+		item.OverdueBase = dunning.Round(item.OverdueBase)
+
+		for _, p := range broken {
+			if p.CustomerID == customer.ID {
+				item.BrokenPromises++
+			}
+		}
+		for _, p := range open {
+			if p.CustomerID == customer.ID && (item.OpenPromise == nil || p.PromisedDate.Before(item.OpenPromise.PromisedDate)) {
+				item.OpenPromise = p
+			}
+		}
+		for _, n := range followUps {
+			if n.CustomerID == customer.ID {
+				item.FollowUpDue = true
+			}
+		}
+
+		item.Priority = dunning.Priority(item.OverdueBase, item.MaxDaysOverdue, item.BrokenPromises, item.Level)
+		// Accounts under an open promise wait unless a follow-up is due
+		if item.OpenPromise != nil && !item.FollowUpDue {
+			item.Priority = dunning.Round(item.Priority / 2)
+		}
+		worklist.Items = append(worklist.Items, item)
+	}
+
+	sort.SliceStable(worklist.Items, func(i, j int) bool {
+		return worklist.Items[i].Priority > worklist.Items[j].Priority
+	})
+	return worklist, nil
+}
+
+// PushWorklist sends each collector a push notification with their accounts
+// for the day
+func (s *dunningService) PushWorklist(ctx context.Context, companyID uuid.UUID, date time.Time) (*WorklistPushResult, error) {
+	worklist, err := s.GetWorklist(ctx, companyID, date)
+	if err != nil {
+		return nil, err
+	}
+	result := &WorklistPushResult{Date: worklist.Date, Accounts: len(worklist.Items)}
+
+	byCollector := map[uuid.UUID][]*WorklistItem{}
+	var collectors []uuid.UUID
+	for _, item := range worklist.Items {
+		if item.CollectorID == nil {
+			result.Unassigned++
+			continue
+		}
+		if _, ok := byCollector[*item.CollectorID]; !ok {
+			collectors = append(collectors, *item.CollectorID)
+		}
+		byCollector[*item.CollectorID] = append(byCollector[*item.CollectorID], item)
+	}
+
+	for _, collectorID := range collectors {
+		items := byCollector[collectorID]
+		var total float64
+		customerIDs := make([]string, 0, len(items))
+		for _, item := range items {
+			total += item.OverdueBase
+			customerIDs = append(customerIDs, item.CustomerID.String())
+		}
+		body := fmt.Sprintf("%d accounts, %.2f overdue. Start with %s.", len(items), dunning.Round(total), items[0].CustomerName)
+		err := s.mobile.SendNotificationToUsers(ctx, []uuid.UUID{collectorID}, "Collection worklist", body, "collection_worklist", map[string]interface{}{
+			"date":         worklist.Date.Format("2006-01-02"),
+			"accounts":     len(items),
+			"overdue_base": dunning.Round(total),
+			"customer_ids": customerIDs,
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Collectors++
+	}
+	return result, nil
+}
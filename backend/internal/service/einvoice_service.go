@@ -0,0 +1,590 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/einvoice"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/fastenmind/fastener-api/pkg/resources"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrEInvoiceNotFound is returned when an e-invoice is not found
+	ErrEInvoiceNotFound = errors.New("e-invoice not found")
+	// ErrUnsupportedEInvoiceFormat is returned for formats other than peppol_bis3 and tw_mig
+	ErrUnsupportedEInvoiceFormat = errors.New("unsupported e-invoice format")
+	// ErrInvoiceNotIssuable is returned for purchase, draft and cancelled invoices
+	ErrInvoiceNotIssuable = errors.New("only issued sales invoices and credit notes can be e-invoiced")
+	// ErrEInvoiceNotSigned is returned when transmitting an e-invoice that
+	// failed validation or was superseded
+	ErrEInvoiceNotSigned = errors.New("e-invoice is not signed")
+	// ErrEInvoiceAlreadySent is returned when transmitting an e-invoice twice
+	ErrEInvoiceAlreadySent = errors.New("e-invoice was already transmitted")
+	// ErrUnknownEInvoiceTransport is returned when a party names an unregistered transport
+	ErrUnknownEInvoiceTransport = errors.New("unknown e-invoice transport")
+	// ErrEInvoiceTransmissionFailed is returned when the transport rejects an e-invoice
+	ErrEInvoiceTransmissionFailed = errors.New("e-invoice transmission failed")
+)
+
+// E-invoice statuses
+const (
+	EInvoiceGenerated   = "generated"
+	EInvoiceInvalid     = "invalid"
+	EInvoiceSigned      = "signed"
+	EInvoiceTransmitted = "transmitted"
+	EInvoiceFailed      = "failed"
+	EInvoiceSuperseded  = "superseded"
+)
+
+// DefaultEInvoiceTransport is the transport used when a party names none
+const DefaultEInvoiceTransport = "outbox"
+
+// EInvoiceService turns issued invoices and credit notes into validated,
+// signed e-invoices and hands them to a transport
+type EInvoiceService interface {
+	// Parties
+	SaveParty(ctx context.Context, companyID, userID uuid.UUID, req EInvoicePartyRequest) (*models.EInvoiceParty, error)
+	ListParties(ctx context.Context, companyID uuid.UUID) ([]*models.EInvoiceParty, error)
+
+	// E-invoices
+	Generate(ctx context.Context, req GenerateEInvoiceRequest) (*models.EInvoice, error)
+	Validate(ctx context.Context, req GenerateEInvoiceRequest) (*EInvoiceValidation, error)
+	GetEInvoice(ctx context.Context, id uuid.UUID) (*models.EInvoice, error)
+	ListEInvoices(ctx context.Context, params map[string]interface{}) ([]*models.EInvoice, int64, error)
+	OpenEInvoice(ctx context.Context, id uuid.UUID, signature bool) (*models.EInvoice, []byte, error)
+	Verify(ctx context.Context, id uuid.UUID) (*EInvoiceVerification, error)
+	Transmit(ctx context.Context, id uuid.UUID) (*models.EInvoice, error)
+
+	// RegisterTransport makes a transport available to parties by its name
+	RegisterTransport(transport einvoice.Transport)
+}
+
+type EInvoicePartyRequest struct {
+	CustomerID     *uuid.UUID `json:"customer_id"` // nil for the company itself
+	Format         string     `json:"format"`
+	EndpointScheme string     `json:"endpoint_scheme"`
+	EndpointID     string     `json:"endpoint_id"`
+	BuyerReference string     `json:"buyer_reference"`
+	Transport      string     `json:"transport"`
+	IsActive       *bool      `json:"is_active"`
+}
+
+type GenerateEInvoiceRequest struct {
+	CompanyID uuid.UUID `json:"-"`
+	InvoiceID uuid.UUID `json:"-"`
+	UserID    uuid.UUID `json:"-"`
+	Format    string    `json:"format"` // defaults to the buyer's format, else by country
+}
+
+// EInvoiceValidation is the outcome of the business rules for an invoice
+type EInvoiceValidation struct {
+	Format     string               `json:"format"`
+	Valid      bool                 `json:"valid"`
+	Violations []einvoice.Violation `json:"violations"`
+	Totals     einvoice.Totals      `json:"totals"`
+}
+
+// EInvoiceVerification reports whether a stored e-invoice still matches its signature
+type EInvoiceVerification struct {
+	Valid  bool   `json:"valid"`
+	KeyID  string `json:"key_id"`
+	Digest string `json:"digest"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type einvoiceService struct {
+	einvoiceRepo repository.EInvoiceRepository
+	signer       einvoice.Signer
+	storagePath  string
+
+	mu         sync.RWMutex
+	transports map[string]einvoice.Transport
+}
+
+// NewEInvoiceService creates a new e-invoice service. Signed documents are
+// stored under storagePath and delivered through the file outbox unless a
+// party names another registered transport.
+func NewEInvoiceService(einvoiceRepo repository.EInvoiceRepository, signer einvoice.Signer, storagePath string) EInvoiceService {
+	s := &einvoiceService{
+		einvoiceRepo: einvoiceRepo,
+		signer:       signer,
+		storagePath:  storagePath,
+		transports:   map[string]einvoice.Transport{},
+	}
+	s.transports[DefaultEInvoiceTransport] = einvoice.NewFileOutbox(filepath.Join(storagePath, "einvoice-outbox"))
+	return s
+}
+
+func (s *einvoiceService) RegisterTransport(transport einvoice.Transport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transports[transport.Name()] = transport
+}
+
+// Parties
+
+// SaveParty creates or updates the e-invoicing address of the company or
+// of a customer
+func (s *einvoiceService) SaveParty(ctx context.Context, companyID, userID uuid.UUID, req EInvoicePartyRequest) (*models.EInvoiceParty, error) {
+	if req.Format != "" && !einvoice.ValidFormat(req.Format) {
+		return nil, ErrUnsupportedEInvoiceFormat
+	}
+	if req.Transport != "" && s.transport(req.Transport) == nil {
+		return nil, ErrUnknownEInvoiceTransport
+	}
+
+	party, err := s.einvoiceRepo.FindParty(ctx, companyID, req.CustomerID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+		party = &models.EInvoiceParty{CompanyID: companyID, CustomerID: req.CustomerID, IsActive: true}
+	}
+	party.Format = req.Format
+	party.EndpointScheme = strings.TrimSpace(req.EndpointScheme)
+	party.EndpointID = strings.TrimSpace(req.EndpointID)
+	party.BuyerReference = req.BuyerReference
+	party.Transport = req.Transport
+	if req.IsActive != nil {
+		party.IsActive = *req.IsActive
+	}
+	party.UpdatedBy = &userID
+
+	if err := s.einvoiceRepo.SaveParty(ctx, party); err != nil {
+		return nil, err
+	}
+	return party, nil
+}
+
+func (s *einvoiceService) ListParties(ctx context.Context, companyID uuid.UUID) ([]*models.EInvoiceParty, error) {
+	return s.einvoiceRepo.ListParties(ctx, companyID)
+}
+
+// E-invoices
+
+// Generate serializes an invoice, checks it against the business rules of
+// the format and signs it when no fatal rule is broken. Every call stores a
+// new version; documents that fail validation are kept with their
+// violations so they can be corrected.
+func (s *einvoiceService) Generate(ctx context.Context, req GenerateEInvoiceRequest) (*models.EInvoice, error) {
+	doc, format, err := s.buildDocument(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	violations := einvoice.Validate(doc, format)
+
+	var content []byte
+	if format == einvoice.FormatTWMIG {
+		content, err = einvoice.MarshalMIG(doc)
+	} else {
+		content, err = einvoice.MarshalUBL(doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize e-invoice: %w", err)
+	}
+
+	version, err := s.einvoiceRepo.LatestVersion(ctx, req.InvoiceID, format)
+	if err != nil {
+		return nil, err
+	}
+	version++
+
+	dir := filepath.Join(s.storagePath, "einvoices", req.InvoiceID.String())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	base := fmt.Sprintf("%s-%s-v%d", sanitizeFileName(doc.ID), format, version)
+	path := filepath.Join(dir, base+".xml")
+	if err := writeEInvoiceFile(ctx, path, content); err != nil {
+		return nil, err
+	}
+
+	violationJSON, _ := json.Marshal(violations)
+	record := &models.EInvoice{
+		CompanyID:    req.CompanyID,
+		InvoiceID:    req.InvoiceID,
+		Format:       format,
+		DocumentType: doc.Type,
+		DocumentNo:   doc.ID,
+		Version:      version,
+		Status:       EInvoiceGenerated,
+		FilePath:     path,
+		Violations:   violationJSON,
+		CreatedBy:    req.UserID,
+	}
+
+	if einvoice.Fatal(violations) {
+		record.Status = EInvoiceInvalid
+	} else {
+		sig, err := einvoice.Sign(base+".xml", content, s.signer)
+		if err != nil {
+			return nil, err
+		}
+		sigPath := filepath.Join(dir, base+".sig.xml")
+		if err := writeEInvoiceFile(ctx, sigPath, sig.XML); err != nil {
+			return nil, err
+		}
+		record.Status = EInvoiceSigned
+		record.SignaturePath = sigPath
+		record.Digest = sig.Digest
+		record.Signature = sig.Value
+		record.SignatureAlgorithm = sig.Algorithm
+		record.KeyID = sig.KeyID
+	}
+
+	if err := s.einvoiceRepo.Create(ctx, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Validate runs the business rules without storing anything
+func (s *einvoiceService) Validate(ctx context.Context, req GenerateEInvoiceRequest) (*EInvoiceValidation, error) {
+	doc, format, err := s.buildDocument(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	violations := einvoice.Validate(doc, format)
+	return &EInvoiceValidation{
+		Format:     format,
+		Valid:      !einvoice.Fatal(violations),
+		Violations: violations,
+		Totals:     doc.Totals,
+	}, nil
+}
+
+func (s *einvoiceService) GetEInvoice(ctx context.Context, id uuid.UUID) (*models.EInvoice, error) {
+	record, err := s.einvoiceRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrEInvoiceNotFound
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+func (s *einvoiceService) ListEInvoices(ctx context.Context, params map[string]interface{}) ([]*models.EInvoice, int64, error) {
+	return s.einvoiceRepo.List(ctx, params)
+}
+
+// OpenEInvoice returns the stored document, or its detached signature
+func (s *einvoiceService) OpenEInvoice(ctx context.Context, id uuid.UUID, signature bool) (*models.EInvoice, []byte, error) {
+	record, err := s.GetEInvoice(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	path := record.FilePath
+	if signature {
+		if record.SignaturePath == "" {
+			return nil, nil, ErrEInvoiceNotSigned
+		}
+		path = record.SignaturePath
+	}
+	content, err := readEInvoiceFile(ctx, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return record, content, nil
+}
+
+// Verify checks the stored document against its stored signature
+func (s *einvoiceService) Verify(ctx context.Context, id uuid.UUID) (*EInvoiceVerification, error) {
+	record, err := s.GetEInvoice(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if record.SignaturePath == "" {
+		return nil, ErrEInvoiceNotSigned
+	}
+	result := &EInvoiceVerification{KeyID: record.KeyID, Digest: record.Digest}
+	if record.KeyID != s.signer.KeyID() {
+		result.Reason = "signed with key " + record.KeyID + ", which is no longer configured"
+		return result, nil
+	}
+
+	content, err := readEInvoiceFile(ctx, record.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	sigXML, err := readEInvoiceFile(ctx, record.SignaturePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := einvoice.Verify(content, sigXML, s.signer); err != nil {
+		result.Reason = err.Error()
+		return result, nil
+	}
+	result.Valid = true
+	return result, nil
+}
+
+// Transmit hands a signed e-invoice to the transport of the buyer. A failed
+// attempt is recorded and can be retried.
+func (s *einvoiceService) Transmit(ctx context.Context, id uuid.UUID) (*models.EInvoice, error) {
+	record, err := s.GetEInvoice(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch record.Status {
+	case EInvoiceTransmitted:
+		return nil, ErrEInvoiceAlreadySent
+	case EInvoiceSigned, EInvoiceFailed:
+	default:
+		return nil, ErrEInvoiceNotSigned
+	}
+
+	invoice, err := s.einvoiceRepo.GetInvoice(ctx, record.InvoiceID)
+	if err != nil {
+		return nil, err
+	}
+	company, err := s.einvoiceRepo.GetCompany(ctx, record.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	sellerParty := s.findParty(ctx, record.CompanyID, nil)
+	var buyerParty *models.EInvoiceParty
+	if invoice.CustomerID != nil {
+		buyerParty = s.findParty(ctx, record.CompanyID, invoice.CustomerID)
+	}
+
+	name := DefaultEInvoiceTransport
+	if buyerParty != nil && buyerParty.Transport != "" {
+		name = buyerParty.Transport
+	}
+	transport := s.transport(name)
+	if transport == nil {
+		return nil, ErrUnknownEInvoiceTransport
+	}
+
+	content, err := readEInvoiceFile(ctx, record.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	sigXML, err := readEInvoiceFile(ctx, record.SignaturePath)
+	if err != nil {
+		return nil, err
+	}
+
+	sender := participant(sellerParty, stringValue(company.TaxID))
+	receiver := ""
+	if invoice.Customer != nil {
+		receiver = participant(buyerParty, stringValue(invoice.Customer.TaxID))
+	}
+	receipt, sendErr := transport.Send(ctx, einvoice.Envelope{
+		DocumentNo: record.DocumentNo,
+		Format:     record.Format,
+		Type:       record.DocumentType,
+		Sender:     sender,
+		Receiver:   receiver,
+		FileName:   filepath.Base(record.FilePath),
+		Digest:     record.Digest,
+		CreatedAt:  record.CreatedAt,
+		Content:    content,
+		Signature:  sigXML,
+	})
+
+	record.Transport = transport.Name()
+	if sendErr != nil {
+		record.Status = EInvoiceFailed
+		record.TransmitError = sendErr.Error()
+	} else {
+		record.Status = EInvoiceTransmitted
+		record.TransmitError = ""
+		record.TransmissionRef = receipt.Reference
+		record.TransmittedAt = &receipt.AcceptedAt
+	}
+	if err := s.einvoiceRepo.Update(ctx, record); err != nil {
+		return nil, err
+	}
+	if sendErr != nil {
+		return record, fmt.Errorf("%w: %v", ErrEInvoiceTransmissionFailed, sendErr)
+	}
+	return record, nil
+}
+
+// buildDocument maps an invoice, its items and the parties onto the
+// format-neutral document and picks the format
+func (s *einvoiceService) buildDocument(ctx context.Context, req GenerateEInvoiceRequest) (*einvoice.Document, string, error) {
+	if req.Format != "" && !einvoice.ValidFormat(req.Format) {
+		return nil, "", ErrUnsupportedEInvoiceFormat
+	}
+	invoice, err := s.einvoiceRepo.GetInvoice(ctx, req.InvoiceID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, "", ErrInvoiceNotFound
+		}
+		return nil, "", err
+	}
+	if invoice.CompanyID != req.CompanyID {
+		return nil, "", ErrInvoiceNotFound
+	}
+	if invoice.Type == "purchase" || invoice.Status == "draft" || invoice.Status == "cancelled" || invoice.Customer == nil {
+		return nil, "", ErrInvoiceNotIssuable
+	}
+	company, err := s.einvoiceRepo.GetCompany(ctx, invoice.CompanyID)
+	if err != nil {
+		return nil, "", err
+	}
+	items, err := s.einvoiceRepo.ListInvoiceItems(ctx, invoice.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	customer := invoice.Customer
+	sellerParty := s.findParty(ctx, invoice.CompanyID, nil)
+	buyerParty := s.findParty(ctx, invoice.CompanyID, invoice.CustomerID)
+
+	format := req.Format
+	if format == "" && buyerParty != nil {
+		format = buyerParty.Format
+	}
+	if format == "" {
+		format = einvoice.FormatPeppol
+		if company.Country == "TW" && customer.Country == "TW" {
+			format = einvoice.FormatTWMIG
+		}
+	}
+
+	doc := &einvoice.Document{
+		Type:         einvoice.TypeInvoice,
+		ID:           invoice.InvoiceNo,
+		IssueDate:    invoice.IssueDate,
+		DueDate:      invoice.DueDate,
+		Currency:     invoice.Currency,
+		ExchangeRate: invoice.ExchangeRate,
+		Note:         invoice.Notes,
+		PaymentTerms: invoice.PaymentTerms,
+		Seller: einvoice.Party{
+			Name:    company.Name,
+			TaxID:   stringValue(company.TaxID),
+			Country: company.Country,
+			Address: stringValue(company.Address),
+			Email:   stringValue(company.Email),
+		},
+		Buyer: einvoice.Party{
+			Name:    customer.Name,
+			TaxID:   stringValue(customer.TaxID),
+			Country: customer.Country,
+			Address: stringValue(customer.Address),
+			Email:   stringValue(customer.ContactEmail),
+		},
+	}
+	if invoice.Type == "credit_note" {
+		doc.Type = einvoice.TypeCreditNote
+		doc.DueDate = time.Time{}
+	}
+	if invoice.Order != nil {
+		doc.OrderReference = invoice.Order.PONumber
+		if doc.OrderReference == "" {
+			doc.OrderReference = invoice.Order.OrderNo
+		}
+	}
+	if sellerParty != nil {
+		doc.Seller.EndpointScheme = sellerParty.EndpointScheme
+		doc.Seller.EndpointID = sellerParty.EndpointID
+	}
+	if buyerParty != nil {
+		doc.Buyer.EndpointScheme = buyerParty.EndpointScheme
+		doc.Buyer.EndpointID = buyerParty.EndpointID
+		doc.BuyerReference = buyerParty.BuyerReference
+	}
+	if invoice.OriginalInvoiceID != nil {
+		original, err := s.einvoiceRepo.GetInvoice(ctx, *invoice.OriginalInvoiceID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return nil, "", err
+		}
+		if original != nil {
+			doc.Billing = &einvoice.Reference{ID: original.InvoiceNo, IssueDate: original.IssueDate}
+		}
+	}
+
+	export := customer.Country != company.Country
+	for i, item := range items {
+		percent := item.TaxRate
+		if percent == 0 {
+			percent = invoice.TaxRate
+		}
+		unit := einvoice.UnitCode(item.Unit)
+		if strings.TrimSpace(item.Unit) == "" {
+			unit = einvoice.UnitCode("pcs")
+		}
+		doc.Lines = append(doc.Lines, einvoice.Line{
+			ID:          fmt.Sprintf("%d", i+1),
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			UnitCode:    unit,
+			UnitPrice:   item.UnitPrice,
+			TaxCategory: einvoice.TaxCategory(percent, export),
+			TaxPercent:  percent,
+		})
+	}
+	doc.Allowances = einvoice.SplitAllowance("Discount", invoice.DiscountAmount, doc.Lines)
+	doc.Compute()
+	return doc, format, nil
+}
+
+// findParty returns the active e-invoicing address, or nil without one
+func (s *einvoiceService) findParty(ctx context.Context, companyID uuid.UUID, customerID *uuid.UUID) *models.EInvoiceParty {
+	party, err := s.einvoiceRepo.FindParty(ctx, companyID, customerID)
+	if err != nil || !party.IsActive {
+		return nil
+	}
+	return party
+}
+
+func (s *einvoiceService) transport(name string) einvoice.Transport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.transports[name]
+}
+
+// participant identifies a party to a transport by its electronic address,
+// or by its tax id without one
+func participant(party *models.EInvoiceParty, taxID string) string {
+	if party != nil && party.EndpointID != "" {
+		return party.EndpointScheme + ":" + party.EndpointID
+	}
+	return taxID
+}
+
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func writeEInvoiceFile(ctx context.Context, path string, content []byte) error {
+	err := resources.WriteFileWithCleanup(ctx, path, func(w io.Writer) error {
+		_, writeErr := io.Copy(w, bytes.NewReader(content))
+		return writeErr
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store %s: %w", path, err)
+	}
+	return nil
+}
+
+func readEInvoiceFile(ctx context.Context, path string) ([]byte, error) {
+	var content []byte
+	err := resources.ReadFileWithCleanup(ctx, path, func(r io.Reader) error {
+		var readErr error
+		content, readErr = io.ReadAll(r)
+		return readErr
+	})
+	return content, err
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/exportdoc"
+	"github.com/fastenmind/fastener-api/internal/models"
+)
+
+// Export document types, matching TradeDocument.DocumentType
+const (
+	ExportDocCommercialInvoice   = exportdoc.CommercialInvoice
+	ExportDocPackingList         = exportdoc.PackingList
+	ExportDocCertificateOfOrigin = exportdoc.CertificateOfOrigin
+)
+
+// buildExportDocumentData merges shipment, order and customer data into the template model
+func buildExportDocumentData(shipment *models.Shipment, order *models.Order) (*exportdoc.Data, error) {
+	data := exportDocumentParties(shipment, order)
+	for _, item := range shipment.Items {
+		origin := item.CountryOrigin
+		if origin == "" {
+			origin = shipment.OriginCountry
+		}
+		err := data.AddItem(exportdoc.Item{
+			Marks:                item.CartonMarks,
+			ProductName:          item.ProductName,
+			Description:          item.Description,
+			HSCode:               item.HSCode,
+			Quantity:             item.Quantity,
+			Unit:                 item.Unit,
+			UnitValue:            item.UnitValue,
+			TotalValue:           item.TotalValue,
+			Currency:             item.Currency,
+			CartonCount:          item.CartonCount,
+			QuantityPerCarton:    item.QuantityPerCarton,
+			NetWeightPerCarton:   item.NetWeightPerCarton,
+			GrossWeightPerCarton: item.GrossWeightPerCarton,
+			TotalWeight:          item.TotalWeight,
+			UnitWeight:           item.UnitWeight,
+			CountryOfOrigin:      origin,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	data.CompleteShipmentTotals()
+
+	return data, nil
+}
+
+// exportDocumentParties fills the header of the export documents: parties,
+// order references, routing and the shipment totals of the load plan
+func exportDocumentParties(shipment *models.Shipment, order *models.Order) *exportdoc.Data {
+	data := &exportdoc.Data{
+		Date:                time.Now(),
+		ShipmentNo:          shipment.ShipmentNo,
+		Incoterm:            shipment.Incoterm,
+		Method:              shipment.Method,
+		Carrier:             shipment.CarrierName,
+		PortOfLoading:       shipment.OriginPort,
+		PortOfDischarge:     shipment.DestPort,
+		ConsigneeName:       shipment.ConsigneeName,
+		ConsigneeAddress:    shipment.ConsigneeAddress,
+		ConsigneeCountry:    shipment.DestCountry,
+		PackageCount:        shipment.PackageCount,
+		PackageType:         shipment.PackageType,
+		ShipmentGrossWeight: shipment.GrossWeight,
+		ShipmentNetWeight:   shipment.NetWeight,
+		Volume:              shipment.Volume,
+		Containers:          shipment.ContainerType,
+	}
+	if data.ConsigneeAddress == "" {
+		data.ConsigneeAddress = shipment.DestAddress
+	}
+
+	if shipment.Company != nil {
+		data.ExporterName = shipment.Company.Name
+		if shipment.Company.NameEn != nil && *shipment.Company.NameEn != "" {
+			data.ExporterName = *shipment.Company.NameEn
+		}
+		if shipment.Company.Address != nil {
+			data.ExporterAddress = *shipment.Company.Address
+		}
+	}
+	if data.ExporterAddress == "" {
+		data.ExporterAddress = shipment.OriginAddress
+	}
+
+	if order != nil {
+		data.OrderNo = order.OrderNo
+		data.CustomerPO = order.PONumber
+		data.PaymentTerms = order.PaymentTerms
+		data.Currency = order.Currency
+		if data.Incoterm == "" {
+			data.Incoterm = order.DeliveryMethod
+		}
+		if data.ConsigneeAddress == "" {
+			data.ConsigneeAddress = order.ShippingAddress
+		}
+		if customer := order.Customer; customer != nil {
+			if data.ConsigneeName == "" {
+				data.ConsigneeName = customer.Name
+				if customer.NameEn != nil && *customer.NameEn != "" {
+					data.ConsigneeName = *customer.NameEn
+				}
+			}
+			if data.ConsigneeAddress == "" && customer.ShippingAddress != nil {
+				data.ConsigneeAddress = *customer.ShippingAddress
+			}
+			if data.ConsigneeAddress == "" && customer.Address != nil {
+				data.ConsigneeAddress = *customer.Address
+			}
+		}
+	}
+
+	return data
+}
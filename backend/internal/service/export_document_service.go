@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/exportdoc"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/fastenmind/fastener-api/pkg/resources"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrShipmentHasNoItems is returned when generating documents for an empty shipment
+	ErrShipmentHasNoItems = errors.New("shipment has no items")
+	// ErrUnsupportedDocumentFormat is returned for formats other than pdf and xlsx
+	ErrUnsupportedDocumentFormat = errors.New("unsupported document format")
+	// ErrMixedDocumentCurrency is returned when the shipment lines are valued
+	// in more than one currency
+	ErrMixedDocumentCurrency = exportdoc.ErrMixedCurrency
+)
+
+// ExportDocumentService generates the export document pack for a shipment
+type ExportDocumentService interface {
+	GenerateDocumentPack(ctx context.Context, req GenerateDocumentPackRequest) ([]*models.TradeDocument, error)
+	OpenDocument(ctx context.Context, id uuid.UUID) (*models.TradeDocument, []byte, error)
+}
+
+type GenerateDocumentPackRequest struct {
+	ShipmentID    uuid.UUID `json:"-"`
+	UserID        uuid.UUID `json:"-"`
+	DocumentTypes []string  `json:"document_types"` // invoice, packing_list, co; defaults to all three
+	Formats       []string  `json:"formats"`        // pdf, xlsx; defaults to both
+}
+
+type exportDocumentService struct {
+	tradeRepo   repository.TradeRepository
+	orderRepo   repository.OrderRepository
+	transactor  repository.Transactor
+	storagePath string
+	font        exportdoc.Font
+}
+
+func NewExportDocumentService(
+	tradeRepo repository.TradeRepository,
+	orderRepo repository.OrderRepository,
+	transactor repository.Transactor,
+	storagePath string,
+	font exportdoc.Font,
+) ExportDocumentService {
+	return &exportDocumentService{
+		tradeRepo:   tradeRepo,
+		orderRepo:   orderRepo,
+		transactor:  transactor,
+		storagePath: storagePath,
+		font:        font,
+	}
+}
+
+// GenerateDocumentPack renders the requested documents and registers each as a new TradeDocument version
+func (s *exportDocumentService) GenerateDocumentPack(ctx context.Context, req GenerateDocumentPackRequest) ([]*models.TradeDocument, error) {
+	docTypes := req.DocumentTypes
+	if len(docTypes) == 0 {
+		docTypes = []string{ExportDocCommercialInvoice, ExportDocPackingList, ExportDocCertificateOfOrigin}
+	}
+	formats := req.Formats
+	if len(formats) == 0 {
+		formats = []string{"pdf", "xlsx"}
+	}
+	for _, docType := range docTypes {
+		if _, ok := exportdoc.Titles[docType]; !ok {
+			return nil, fmt.Errorf("unsupported export document type: %s", docType)
+		}
+	}
+	for _, format := range formats {
+		if format != "pdf" && format != "xlsx" {
+			return nil, ErrUnsupportedDocumentFormat
+		}
+	}
+
+	shipment, err := s.tradeRepo.GetShipment(ctx, req.ShipmentID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrShipmentNotFound
+		}
+		return nil, err
+	}
+	if len(shipment.Items) == 0 {
+		return nil, ErrShipmentHasNoItems
+	}
+
+	var order *models.Order
+	if shipment.OrderID != nil {
+		order, err = s.orderRepo.GetWithDetails(*shipment.OrderID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load order: %w", err)
+		}
+	}
+
+	data, err := buildExportDocumentData(shipment, order)
+	if err != nil {
+		return nil, err
+	}
+
+	// The shipment stays locked while the next versions are numbered and
+	// stored, so concurrent generations cannot both store the same version
+	var generated []*models.TradeDocument
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.tradeRepo.LockShipment(ctx, shipment.ID); err != nil {
+			return err
+		}
+		for _, docType := range docTypes {
+			docs, err := s.generateVersion(ctx, shipment, docType, formats, data, req.UserID)
+			if err != nil {
+				return err
+			}
+			generated = append(generated, docs...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generated, nil
+}
+
+// generateVersion renders the next version of a document type in each
+// format and supersedes the versions before it
+func (s *exportDocumentService) generateVersion(ctx context.Context, shipment *models.Shipment, docType string, formats []string, data *exportdoc.Data, userID uuid.UUID) ([]*models.TradeDocument, error) {
+	existing, err := s.tradeRepo.ListShipmentDocuments(ctx, shipment.ID, docType)
+	if err != nil {
+		return nil, err
+	}
+	stored := make([]exportdoc.Stored, len(existing))
+	for i, doc := range existing {
+		stored[i] = exportdoc.Stored{ID: doc.ID, Version: doc.Version, Status: doc.Status}
+	}
+	version, supersedes := exportdoc.Revision(stored)
+
+	data.DocumentNo = exportdoc.DocumentNo(docType, shipment.ShipmentNo, version)
+
+	docs := make([]*models.TradeDocument, 0, len(formats))
+	for _, format := range formats {
+		doc, err := s.renderAndStore(ctx, shipment, docType, format, version, data, userID)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	if err := s.tradeRepo.ReplaceShipmentDocuments(ctx, shipment.ID, supersedes, docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// OpenDocument returns a trade document together with its stored file content
+func (s *exportDocumentService) OpenDocument(ctx context.Context, id uuid.UUID) (*models.TradeDocument, []byte, error) {
+	doc, err := s.tradeRepo.GetTradeDocument(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var content []byte
+	err = resources.ReadFileWithCleanup(ctx, doc.FilePath, func(r io.Reader) error {
+		var readErr error
+		content, readErr = io.ReadAll(r)
+		return readErr
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, content, nil
+}
+
+func (s *exportDocumentService) renderAndStore(ctx context.Context, shipment *models.Shipment, docType, format string, version int, data *exportdoc.Data, userID uuid.UUID) (*models.TradeDocument, error) {
+	var content []byte
+	var err error
+	if format == "pdf" {
+		content, err = exportdoc.RenderPDF(docType, data, s.font)
+	} else {
+		content, err = exportdoc.RenderXLSX(docType, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s %s: %w", docType, format, err)
+	}
+
+	dir := filepath.Join(s.storagePath, "trade-documents", shipment.ID.String())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s.%s", data.DocumentNo, format))
+	err = resources.WriteFileWithCleanup(ctx, path, func(w io.Writer) error {
+		_, writeErr := w.Write(content)
+		return writeErr
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store %s: %w", path, err)
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"generated":   true,
+		"shipment_id": shipment.ID,
+		"order_no":    data.OrderNo,
+		"incoterm":    data.Incoterm,
+		"total_value": data.TotalAmount,
+		"gross_kg":    data.TotalGrossWeight,
+		"net_kg":      data.TotalNetWeight,
+		"cartons":     data.TotalCartons,
+	})
+
+	now := time.Now()
+	return &models.TradeDocument{
+		ID:           uuid.New(),
+		CompanyID:    shipment.CompanyID,
+		DocumentType: docType,
+		DocumentNo:   data.DocumentNo,
+		Title:        fmt.Sprintf("%s %s", exportdoc.Titles[docType], shipment.ShipmentNo),
+		FilePath:     path,
+		FileSize:     int64(len(content)),
+		FileType:     format,
+		Version:      version,
+		Status:       "draft",
+		IssuedBy:     data.ExporterName,
+		IssuedAt:     &now,
+		Metadata:     string(metadata),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		CreatedBy:    userID,
+	}, nil
+}
@@ -1,13 +1,28 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/fx"
 	"github.com/fastenmind/fastener-api/internal/models"
 	"github.com/fastenmind/fastener-api/internal/repository"
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrInvoicePosted is returned when changing the amounts, currency,
+	// date or parties of an invoice that has been posted to the ledger
+	ErrInvoicePosted = errors.New("posted invoice cannot be changed; issue a credit or debit note")
+	// ErrInvoiceNotPayable is returned when paying a purchase invoice held
+	// or rejected by three-way matching
+	ErrInvoiceNotPayable = repository.ErrInvoiceNotPayable
+)
+
 type FinanceService interface {
 	// Invoice operations
 	CreateInvoice(invoice *models.Invoice) error
@@ -63,6 +78,9 @@ type financeService struct {
 	orderRepo    repository.OrderRepository
 	customerRepo repository.CustomerRepository
 	supplierRepo repository.SupplierRepository
+	transactor   repository.Transactor
+	ledger       LedgerService
+	matcher      InvoiceMatchService
 }
 
 func NewFinanceService(
@@ -70,12 +88,18 @@ func NewFinanceService(
 	orderRepo repository.OrderRepository,
 	customerRepo repository.CustomerRepository,
 	supplierRepo repository.SupplierRepository,
+	transactor repository.Transactor,
+	ledger LedgerService,
+	matcher InvoiceMatchService,
 ) FinanceService {
 	return &financeService{
 		financeRepo:  financeRepo,
 		orderRepo:    orderRepo,
 		customerRepo: customerRepo,
 		supplierRepo: supplierRepo,
+		transactor:   transactor,
+		ledger:       ledger,
+		matcher:      matcher,
 	}
 }
 
@@ -93,21 +117,55 @@ func (s *financeService) CreateInvoice(invoice *models.Invoice) error {
 		invoice.Status = "draft"
 	}
 	
-	if err := s.financeRepo.CreateInvoice(invoice); err != nil {
+	if invoice.Status != "issued" {
+		return s.financeRepo.CreateInvoice(invoice)
+	}
+	
+	// Issued invoices post to the ledger, so the period must be open and a
+	// foreign invoice needs its rate
+	ctx := context.Background()
+	if err := s.ledger.EnsurePeriodOpen(ctx, invoice.CompanyID, invoice.IssueDate); err != nil {
 		return err
 	}
+	rate, err := s.ledger.DocumentRate(ctx, invoice.CompanyID, invoice.Currency, invoice.ExchangeRate, invoice.IssueDate)
+	if err != nil {
+		return err
+	}
+	invoice.ExchangeRate = rate
 	
-	// Create AR/AP record if issued
-	if invoice.Status == "issued" {
-		if err := s.createARAPRecord(invoice); err != nil {
+	// The invoice, its AR/AP record and its journal entry are stored together
+	return s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.financeRepo.WithContext(ctx).CreateInvoice(invoice); err != nil {
 			return err
 		}
-	}
-	
-	return nil
+		if err := s.createARAPRecord(ctx, invoice); err != nil {
+			return err
+		}
+		_, err := s.ledger.PostInvoice(ctx, invoice)
+		return err
+	})
 }
 
+// UpdateInvoice edits an invoice. A draft moved to issued is posted with
+// its AR/AP record like a new issued invoice; an invoice that has been
+// posted keeps the amounts, currency, date and parties it was posted with.
 func (s *financeService) UpdateInvoice(invoice *models.Invoice) error {
+	existing, err := s.financeRepo.GetInvoice(invoice.ID)
+	if err != nil {
+		return err
+	}
+	
+	// Payments are applied by ProcessPayment, never through an edit
+	invoice.PaidAmount = existing.PaidAmount
+	
+	posted := existing.Status != "draft"
+	if posted && invoice.ExchangeRate == 0 {
+		invoice.ExchangeRate = existing.ExchangeRate
+	}
+	if posted && (invoice.Status == "draft" || invoiceLedgerFieldsChanged(existing, invoice)) {
+		return ErrInvoicePosted
+	}
+	
 	// Recalculate totals
 	invoice.TotalAmount = invoice.SubTotal - invoice.DiscountAmount + invoice.TaxAmount
 	invoice.BalanceAmount = invoice.TotalAmount - invoice.PaidAmount
@@ -119,7 +177,54 @@ func (s *financeService) UpdateInvoice(invoice *models.Invoice) error {
 		invoice.Status = "partial_paid"
 	}
 	
-	return s.financeRepo.UpdateInvoice(invoice)
+	if posted || invoice.Status != "issued" {
+		return s.financeRepo.UpdateInvoice(invoice)
+	}
+	
+	// Issuing a draft posts it, so the period must be open and a foreign
+	// invoice needs its rate
+	ctx := context.Background()
+	if err := s.ledger.EnsurePeriodOpen(ctx, invoice.CompanyID, invoice.IssueDate); err != nil {
+		return err
+	}
+	rate, err := s.ledger.DocumentRate(ctx, invoice.CompanyID, invoice.Currency, invoice.ExchangeRate, invoice.IssueDate)
+	if err != nil {
+		return err
+	}
+	invoice.ExchangeRate = rate
+	
+	return s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.financeRepo.WithContext(ctx).UpdateInvoice(invoice); err != nil {
+			return err
+		}
+		if err := s.createARAPRecord(ctx, invoice); err != nil {
+			return err
+		}
+		_, err := s.ledger.PostInvoice(ctx, invoice)
+		return err
+	})
+}
+
+// invoiceLedgerFieldsChanged reports whether an edit touches what the
+// invoice was posted with
+func invoiceLedgerFieldsChanged(existing, updated *models.Invoice) bool {
+	if existing.Type != updated.Type || existing.Currency != updated.Currency || existing.ExchangeRate != updated.ExchangeRate {
+		return true
+	}
+	if existing.SubTotal != updated.SubTotal || existing.DiscountAmount != updated.DiscountAmount || existing.TaxAmount != updated.TaxAmount {
+		return true
+	}
+	if !existing.IssueDate.Equal(updated.IssueDate) {
+		return true
+	}
+	return !sameUUID(existing.CustomerID, updated.CustomerID) || !sameUUID(existing.SupplierID, updated.SupplierID)
+}
+
+func sameUUID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
 
 func (s *financeService) GetInvoice(id uuid.UUID) (*models.Invoice, error) {
@@ -204,18 +309,50 @@ func (s *financeService) GenerateInvoiceFromOrder(orderID uuid.UUID, userID uuid
 
 // Payment operations
 func (s *financeService) ProcessPayment(payment *models.Payment) error {
-	// Generate payment number
-	payment.PaymentNo = s.generatePaymentNo(payment.CompanyID)
-	payment.Status = "pending"
-	
-	// Create payment and update invoice
-	if err := s.financeRepo.CreatePayment(payment); err != nil {
+	ctx := context.Background()
+	if payment.InvoiceID != nil {
+		// Checked again under the invoice lock when the payment is applied
+		invoice, err := s.financeRepo.GetInvoice(*payment.InvoiceID)
+		if err != nil {
+			return err
+		}
+		if !repository.InvoicePayable(invoice) {
+			return ErrInvoiceNotPayable
+		}
+	}
+	if err := s.ledger.EnsurePeriodOpen(ctx, payment.CompanyID, payment.PaymentDate); err != nil {
 		return err
 	}
+	rate, err := s.ledger.DocumentRate(ctx, payment.CompanyID, payment.Currency, payment.ExchangeRate, payment.PaymentDate)
+	if err != nil {
+		return err
+	}
+	payment.ExchangeRate = rate
+	
+	// Payments through the bank stay pending until a bank statement line is
+	// reconciled against them; only cash is completed, applied to the
+	// invoice and posted right away
+	payment.Status = "pending"
+	if payment.PaymentMethod == "cash" {
+		payment.Status = "completed"
+	}
 	
-	// Mark payment as completed (in real system, this would be after bank confirmation)
-	payment.Status = "completed"
-	return s.financeRepo.UpdatePayment(payment)
+	return s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		financeRepo := s.financeRepo.WithContext(ctx)
+		paymentNo, err := nextPaymentNo(financeRepo)
+		if err != nil {
+			return err
+		}
+		payment.PaymentNo = paymentNo
+		if err := financeRepo.CreatePayment(payment); err != nil {
+			return err
+		}
+		if payment.Status != "completed" {
+			return nil
+		}
+		_, err = s.ledger.PostPayment(ctx, payment)
+		return err
+	})
 }
 
 func (s *financeService) GetPayment(id uuid.UUID) (*models.Payment, error) {
@@ -263,12 +400,25 @@ func (s *financeService) ApproveExpense(id uuid.UUID, approverID uuid.UUID) erro
 		return fmt.Errorf("expense must be in submitted status to approve")
 	}
 	
+	// Approval posts the expense, so the period must be open
+	ctx := context.Background()
 	now := time.Now()
+	if err := s.ledger.EnsurePeriodOpen(ctx, expense.CompanyID, now); err != nil {
+		return err
+	}
+	
 	expense.Status = "approved"
 	expense.ApprovedBy = &approverID
 	expense.ApprovedAt = &now
 	
-	return s.financeRepo.UpdateExpense(expense)
+	// The approval and its journal entry are stored together
+	return s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.financeRepo.WithContext(ctx).UpdateExpense(expense); err != nil {
+			return err
+		}
+		_, err := s.ledger.PostExpense(ctx, expense)
+		return err
+	})
 }
 
 func (s *financeService) RejectExpense(id uuid.UUID, approverID uuid.UUID, reason string) error {
@@ -530,10 +680,29 @@ func (s *financeService) GetCashFlowReport(companyID uuid.UUID, startDate, endDa
 func (s *financeService) GetAgingReport(companyID uuid.UUID, reportType string) (*AgingReport, error) {
 	report := &AgingReport{
 		ReportType: reportType,
-		Currency:   "USD",
+		Currency:   ledgerBaseCurrency,
 		Date:       time.Now(),
 	}
-	
+	ctx := context.Background()
+	// Balances are converted at today's rate; the invoice rate is used for
+	// currencies without a stored rate
+	rates := map[string]float64{}
+	baseRate := func(currency string, invoice *models.Invoice) (float64, error) {
+		currency = strings.ToUpper(currency)
+		if rate, ok := rates[currency]; ok {
+			return rate, nil
+		}
+		rate, err := s.ledger.BaseRate(ctx, companyID, currency, report.Date)
+		if err != nil {
+			if invoice == nil {
+				return 0, err
+			}
+			return s.ledger.BookedRate(ctx, invoice)
+		}
+		rates[currency] = rate
+		return rate, nil
+	}
+
 	if reportType == "receivable" {
 		ars, _ := s.financeRepo.ListAccountReceivables(companyID, map[string]interface{}{})
 		for _, ar := range ars {
@@ -543,6 +712,7 @@ func (s *financeService) GetAgingReport(companyID uuid.UUID, reportType string)
 					InvoiceNo:    ar.Invoice.InvoiceNo,
 					InvoiceDate:  ar.InvoiceDate,
 					DueDate:      ar.DueDate,
+					Currency:     strings.ToUpper(ar.Currency),
 					Amount:       ar.InvoiceAmount,
 					PaidAmount:   ar.PaidAmount,
 					Balance:      ar.BalanceAmount,
@@ -554,21 +724,11 @@ func (s *financeService) GetAgingReport(companyID uuid.UUID, reportType string)
 					item.CustomerName = ar.Customer.Name
 				}
 				
-				report.Items = append(report.Items, item)
-				
-				// Update totals
-				switch ar.AgingCategory {
-				case "current":
-					report.Current += ar.BalanceAmount
-				case "30days":
-					report.Days30 += ar.BalanceAmount
-				case "60days":
-					report.Days60 += ar.BalanceAmount
-				case "90days":
-					report.Days90 += ar.BalanceAmount
-				case "over90days":
-					report.Over90 += ar.BalanceAmount
+				rate, err := baseRate(item.Currency, ar.Invoice)
+				if err != nil {
+					return nil, err
 				}
+				report.add(item, rate)
 			}
 		}
 	} else {
@@ -580,25 +740,90 @@ func (s *financeService) GetAgingReport(companyID uuid.UUID, reportType string)
 					InvoiceNo:    ap.Invoice.InvoiceNo,
 					InvoiceDate:  ap.InvoiceDate,
 					DueDate:      ap.DueDate,
+					Currency:     strings.ToUpper(ap.Currency),
 					Amount:       ap.InvoiceAmount,
 					PaidAmount:   ap.PaidAmount,
 					Balance:      ap.BalanceAmount,
 				}
+				item.DaysOverdue, item.AgingBucket = agingBucket(ap.DueDate, report.Date)
 				
 				if ap.Supplier != nil {
 					item.SupplierName = ap.Supplier.Name
 				}
 				
-				report.Items = append(report.Items, item)
+				rate, err := baseRate(item.Currency, ap.Invoice)
+				if err != nil {
+					return nil, err
+				}
+				report.add(item, rate)
 			}
 		}
 	}
 	
 	report.Total = report.Current + report.Days30 + report.Days60 + report.Days90 + report.Over90
+	sort.Slice(report.ByCurrency, func(i, j int) bool { return report.ByCurrency[i].Currency < report.ByCurrency[j].Currency })
 	
 	return report, nil
 }
 
+// add adds an item converted at rate to the base-currency buckets and to
+// the totals of its currency
+func (r *AgingReport) add(item AgingItem, rate float64) {
+	if item.Currency == "" {
+		item.Currency = r.Currency
+	}
+	item.ExchangeRate = rate
+	item.BaseBalance = fx.Round(item.Balance * rate)
+	r.Items = append(r.Items, item)
+
+	var total *AgingCurrencyTotal
+	for i := range r.ByCurrency {
+		if r.ByCurrency[i].Currency == item.Currency {
+			total = &r.ByCurrency[i]
+		}
+	}
+	if total == nil {
+		r.ByCurrency = append(r.ByCurrency, AgingCurrencyTotal{Currency: item.Currency, ExchangeRate: rate})
+		total = &r.ByCurrency[len(r.ByCurrency)-1]
+	}
+	total.Total += item.Balance
+	total.BaseTotal += item.BaseBalance
+
+	switch item.AgingBucket {
+	case "current":
+		r.Current += item.BaseBalance
+		total.Current += item.Balance
+	case "30days":
+		r.Days30 += item.BaseBalance
+		total.Days30 += item.Balance
+	case "60days":
+		r.Days60 += item.BaseBalance
+		total.Days60 += item.Balance
+	case "90days":
+		r.Days90 += item.BaseBalance
+		total.Days90 += item.Balance
+	case "over90days":
+		r.Over90 += item.BaseBalance
+		total.Over90 += item.Balance
+	}
+}
+
+// agingBucket returns the days past due and the aging bucket of a due date
+func agingBucket(dueDate, now time.Time) (int, string) {
+	days := int(now.Sub(dueDate).Hours() / 24)
+	switch {
+	case days <= 0:
+		return 0, "current"
+	case days <= 30:
+		return days, "30days"
+	case days <= 60:
+		return days, "60days"
+	case days <= 90:
+		return days, "90days"
+	}
+	return days, "over90days"
+}
+
 // Helper methods
 func (s *financeService) generateInvoiceNo(companyID uuid.UUID, invoiceType string) string {
 	prefix := "INV"
@@ -613,15 +838,22 @@ func (s *financeService) generateInvoiceNo(companyID uuid.UUID, invoiceType stri
 	return fmt.Sprintf("%s-%s-%06d", prefix, time.Now().Format("200601"), time.Now().Unix()%1000000)
 }
 
-func (s *financeService) generatePaymentNo(companyID uuid.UUID) string {
-	return fmt.Sprintf("PAY-%s-%06d", time.Now().Format("200601"), time.Now().Unix()%1000000)
+// nextPaymentNo numbers a payment PAY-YYYYMM-nnnnnn from the payment
+// sequence of the month
+func nextPaymentNo(financeRepo repository.FinanceRepository) (string, error) {
+	prefix := fmt.Sprintf("PAY-%s-", time.Now().Format("200601"))
+	next, err := financeRepo.NextPaymentNumber(prefix)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%06d", prefix, next), nil
 }
 
 func (s *financeService) generateExpenseNo(companyID uuid.UUID) string {
 	return fmt.Sprintf("EXP-%s-%06d", time.Now().Format("200601"), time.Now().Unix()%1000000)
 }
 
-func (s *financeService) createARAPRecord(invoice *models.Invoice) error {
+func (s *financeService) createARAPRecord(ctx context.Context, invoice *models.Invoice) error {
 	if invoice.Type == "sales" && invoice.CustomerID != nil {
 		ar := &models.AccountReceivable{
 			CompanyID:     invoice.CompanyID,
@@ -635,8 +867,13 @@ func (s *financeService) createARAPRecord(invoice *models.Invoice) error {
 			DueDate:       invoice.DueDate,
 			Status:        "open",
 		}
-		return s.financeRepo.CreateAccountReceivable(ar)
+		return s.financeRepo.WithContext(ctx).CreateAccountReceivable(ar)
 	} else if invoice.Type == "purchase" && invoice.SupplierID != nil {
+		// Invoices billing a purchase order reach AP only once matched
+		if invoice.PurchaseOrderID != nil && s.matcher != nil {
+			_, err := s.matcher.MatchInvoice(ctx, invoice.ID)
+			return err
+		}
 		ap := &models.AccountPayable{
 			CompanyID:      invoice.CompanyID,
 			SupplierID:     *invoice.SupplierID,
@@ -650,7 +887,7 @@ func (s *financeService) createARAPRecord(invoice *models.Invoice) error {
 			Status:         "open",
 			PaymentPriority: "medium",
 		}
-		return s.financeRepo.CreateAccountPayable(ap)
+		return s.financeRepo.WithContext(ctx).CreateAccountPayable(ap)
 	}
 	
 	return nil
@@ -694,17 +931,34 @@ type CashFlowReport struct {
 	Currency         string    `json:"currency"`
 }
 
+// AgingReport buckets open items by days past due. Bucket totals are in
+// the base currency; ByCurrency keeps the totals of each transaction
+// currency.
 type AgingReport struct {
-	ReportType string      `json:"report_type"`
-	Items      []AgingItem `json:"items"`
-	Current    float64     `json:"current"`
-	Days30     float64     `json:"days_30"`
-	Days60     float64     `json:"days_60"`
-	Days90     float64     `json:"days_90"`
-	Over90     float64     `json:"over_90"`
-	Total      float64     `json:"total"`
-	Currency   string      `json:"currency"`
-	Date       time.Time   `json:"date"`
+	ReportType string               `json:"report_type"`
+	Items      []AgingItem          `json:"items"`
+	Current    float64              `json:"current"`
+	Days30     float64              `json:"days_30"`
+	Days60     float64              `json:"days_60"`
+	Days90     float64              `json:"days_90"`
+	Over90     float64              `json:"over_90"`
+	Total      float64              `json:"total"`
+	Currency   string               `json:"currency"`
+	ByCurrency []AgingCurrencyTotal `json:"by_currency"`
+	Date       time.Time            `json:"date"`
+}
+
+// AgingCurrencyTotal are the aging buckets of one transaction currency
+type AgingCurrencyTotal struct {
+	Currency     string  `json:"currency"`
+	ExchangeRate float64 `json:"exchange_rate"` // to the base currency
+	Current      float64 `json:"current"`
+	Days30       float64 `json:"days_30"`
+	Days60       float64 `json:"days_60"`
+	Days90       float64 `json:"days_90"`
+	Over90       float64 `json:"over_90"`
+	Total        float64 `json:"total"`
+	BaseTotal    float64 `json:"base_total"`
 }
 
 type AgingItem struct {
@@ -715,9 +969,12 @@ type AgingItem struct {
 	InvoiceNo    string     `json:"invoice_no"`
 	InvoiceDate  time.Time  `json:"invoice_date"`
 	DueDate      time.Time  `json:"due_date"`
+	Currency     string     `json:"currency"`
 	Amount       float64    `json:"amount"`
 	PaidAmount   float64    `json:"paid_amount"`
 	Balance      float64    `json:"balance"`
+	ExchangeRate float64    `json:"exchange_rate"` // to the base currency
+	BaseBalance  float64    `json:"base_balance"`
 	DaysOverdue  int        `json:"days_overdue"`
 	AgingBucket  string     `json:"aging_bucket"`
 }
\ No newline at end of file
@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/fx"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrFXRevaluationNotFound is returned when a revaluation is not found
+	ErrFXRevaluationNotFound = errors.New("FX revaluation not found")
+	// ErrFXRevaluationExists is returned when open items were already revalued on the date
+	ErrFXRevaluationExists = errors.New("open items are already revalued on this date")
+)
+
+// FXService revalues open foreign-currency receivables and payables at
+// period end and reports exposure and realized exchange differences
+type FXService interface {
+	RunRevaluation(ctx context.Context, req RunFXRevaluationRequest) (*models.FXRevaluation, error)
+	GetRevaluation(ctx context.Context, id uuid.UUID) (*models.FXRevaluation, error)
+	ListRevaluations(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.FXRevaluation, int64, error)
+
+	// Reports
+	GetExposureReport(ctx context.Context, companyID uuid.UUID, asOf time.Time) (*FXExposureReport, error)
+	GetRealizedReport(ctx context.Context, companyID uuid.UUID, from, to time.Time) (*FXRealizedReport, error)
+}
+
+// RunFXRevaluationRequest revalues the open items of a company on a date,
+// normally the last day of a period. Without a date the last day of the
+// previous month is used.
+type RunFXRevaluationRequest struct {
+	CompanyID uuid.UUID `json:"-"`
+	UserID    uuid.UUID `json:"-"`
+	Date      time.Time `json:"date"`
+}
+
+// FXOpenItem is an open invoice in a foreign currency valued in the base
+// currency
+type FXOpenItem struct {
+	InvoiceID   uuid.UUID  `json:"invoice_id"`
+	InvoiceNo   string     `json:"invoice_no"`
+	DueDate     time.Time  `json:"due_date"`
+	PartnerType string     `json:"partner_type"`
+	PartnerID   *uuid.UUID `json:"partner_id,omitempty"`
+	PartnerName string     `json:"partner_name"`
+	fx.Valuation
+}
+
+// FXExposureReport lists open foreign-currency items in their transaction
+// currency and in the base currency at the rates of a date
+type FXExposureReport struct {
+	AsOf           time.Time          `json:"as_of"`
+	BaseCurrency   string             `json:"base_currency"`
+	Items          []FXOpenItem       `json:"items"`
+	Totals         []fx.CurrencyTotal `json:"totals"`
+	UnrealizedGain float64            `json:"unrealized_gain"`
+	MissingRates   []string           `json:"missing_rates,omitempty"` // currencies whose items are left out
+}
+
+// FXRealizedReport lists the exchange differences realized by payments in
+// a date range. To is inclusive.
+type FXRealizedReport struct {
+	From         time.Time                 `json:"from"`
+	To           time.Time                 `json:"to"`
+	BaseCurrency string                    `json:"base_currency"`
+	Items        []*models.FXRealization   `json:"items"`
+	Totals       []FXRealizedCurrencyTotal `json:"totals"`
+	TotalGain    float64                   `json:"total_gain"`
+}
+
+// FXRealizedCurrencyTotal sums the realized differences of one currency
+type FXRealizedCurrencyTotal struct {
+	Currency string  `json:"currency"`
+	Count    int     `json:"count"`
+	Amount   float64 `json:"amount"` // settled, in the currency
+	Gain     float64 `json:"gain"`   // in the base currency
+}
+
+type fxService struct {
+	repo       repository.LedgerRepository
+	transactor repository.Transactor
+	ledger     LedgerService
+}
+
+// NewFXService creates a new FX service
+func NewFXService(repo repository.LedgerRepository, transactor repository.Transactor, ledger LedgerService) FXService {
+	return &fxService{
+		repo:       repo,
+		transactor: transactor,
+		ledger:     ledger,
+	}
+}
+
+// RunRevaluation values the open foreign items at the closing rates of the
+// date, posts the adjustment and posts its reversal on the first day of the
+// next period, so payments are always compared with the invoice rate.
+// Every currency needs a stored rate for the date.
+func (s *fxService) RunRevaluation(ctx context.Context, req RunFXRevaluationRequest) (*models.FXRevaluation, error) {
+	date := req.Date
+	if date.IsZero() {
+		now := time.Now()
+		date = time.Date(now.Year(), now.Month(), 0, 0, 0, 0, 0, time.UTC)
+	}
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+
+	if _, err := s.repo.FindRevaluation(ctx, req.CompanyID, date); err == nil {
+		return nil, ErrFXRevaluationExists
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	revaluation := &models.FXRevaluation{
+		ID:              uuid.New(),
+		CompanyID:       req.CompanyID,
+		RevaluationDate: date,
+		BaseCurrency:    ledgerBaseCurrency,
+		ReversalDate:    date.AddDate(0, 0, 1),
+		Status:          "posted",
+		CreatedBy:       req.UserID,
+	}
+	period, err := s.repo.FindPeriodForDate(ctx, req.CompanyID, date)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if period != nil {
+		revaluation.PeriodID = &period.ID
+		end := period.EndDate
+		revaluation.ReversalDate = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, date.Location()).AddDate(0, 0, 1)
+	}
+	// Both dates must accept postings before anything is posted
+	if err := s.ledger.EnsurePeriodOpen(ctx, req.CompanyID, date); err != nil {
+		return nil, err
+	}
+	if err := s.ledger.EnsurePeriodOpen(ctx, req.CompanyID, revaluation.ReversalDate); err != nil {
+		return nil, err
+	}
+
+	items, rates, missing, err := s.openItems(ctx, req.CompanyID, date)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s on %s", ErrExchangeRateMissing, strings.Join(missing, ", "), date.Format("2006-01-02"))
+	}
+	if revaluation.Rates, err = json.Marshal(rates); err != nil {
+		return nil, err
+	}
+
+	valuations := make([]fx.Valuation, len(items))
+	for i, item := range items {
+		valuations[i] = item.Valuation
+		revaluation.Lines = append(revaluation.Lines, models.FXRevaluationLine{
+			InvoiceID:    item.InvoiceID,
+			InvoiceNo:    item.InvoiceNo,
+			Kind:         item.Kind,
+			PartnerType:  item.PartnerType,
+			PartnerID:    item.PartnerID,
+			PartnerName:  item.PartnerName,
+			Currency:     item.Currency,
+			OpenAmount:   item.Amount,
+			BookedRate:   item.BookedRate,
+			ClosingRate:  item.Rate,
+			BookedBase:   item.BookedBase,
+			RevaluedBase: item.ValuedBase,
+			Gain:         item.Gain,
+		})
+	}
+	_, _, revaluation.TotalGain, revaluation.TotalLoss = fx.Net(valuations)
+	revaluation.NetGain = fx.Round(revaluation.TotalGain - revaluation.TotalLoss)
+
+	// The entry, its reversal and the revaluation are stored together
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		entry, err := s.ledger.PostFXRevaluation(ctx, revaluation)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			revaluation.EntryID = &entry.ID
+			reversal, err := s.ledger.ReverseJournalEntry(ctx, ReverseJournalEntryRequest{
+				EntryID:   entry.ID,
+				UserID:    req.UserID,
+				EntryDate: &revaluation.ReversalDate,
+				Reason:    "automatic reversal of period-end revaluation",
+			})
+			if err != nil {
+				return err
+			}
+			revaluation.ReversalEntryID = &reversal.ID
+		}
+		return s.repo.CreateRevaluation(ctx, revaluation)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetRevaluation(ctx, revaluation.ID)
+}
+
+func (s *fxService) GetRevaluation(ctx context.Context, id uuid.UUID) (*models.FXRevaluation, error) {
+	revaluation, err := s.repo.GetRevaluation(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrFXRevaluationNotFound
+		}
+		return nil, err
+	}
+	return revaluation, nil
+}
+
+func (s *fxService) ListRevaluations(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.FXRevaluation, int64, error) {
+	return s.repo.ListRevaluations(ctx, companyID, params)
+}
+
+// Reports
+
+// GetExposureReport values the open foreign items at the rates of asOf.
+// Currencies without a rate are listed instead of failing the report.
+func (s *fxService) GetExposureReport(ctx context.Context, companyID uuid.UUID, asOf time.Time) (*FXExposureReport, error) {
+	asOf = time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, asOf.Location())
+	items, _, missing, err := s.openItems(ctx, companyID, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &FXExposureReport{
+		AsOf:         asOf,
+		BaseCurrency: ledgerBaseCurrency,
+		Items:        items,
+		MissingRates: missing,
+	}
+	valuations := make([]fx.Valuation, len(items))
+	for i, item := range items {
+		valuations[i] = item.Valuation
+		report.UnrealizedGain += item.Gain
+	}
+	report.Totals = fx.Summarize(valuations)
+	report.UnrealizedGain = fx.Round(report.UnrealizedGain)
+	return report, nil
+}
+
+// GetRealizedReport sums the exchange differences realized by payments
+// from from up to and including to
+func (s *fxService) GetRealizedReport(ctx context.Context, companyID uuid.UUID, from, to time.Time) (*FXRealizedReport, error) {
+	end := to.AddDate(0, 0, 1)
+	realizations, err := s.repo.ListRealizations(ctx, companyID, &from, &end)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &FXRealizedReport{
+		From:         from,
+		To:           to,
+		BaseCurrency: ledgerBaseCurrency,
+		Items:        realizations,
+		Totals:       []FXRealizedCurrencyTotal{},
+	}
+	index := map[string]int{}
+	for _, r := range realizations {
+		i, ok := index[r.Currency]
+		if !ok {
+			i = len(report.Totals)
+			index[r.Currency] = i
+			report.Totals = append(report.Totals, FXRealizedCurrencyTotal{Currency: r.Currency})
+		}
+		total := &report.Totals[i]
+		total.Count++
+		total.Amount = fx.Round(total.Amount + r.Amount)
+		total.Gain = fx.Round(total.Gain + r.Gain)
+		report.TotalGain += r.Gain
+	}
+	sort.Slice(report.Totals, func(i, j int) bool { return report.Totals[i].Currency < report.Totals[j].Currency })
+	report.TotalGain = fx.Round(report.TotalGain)
+	return report, nil
+}
+
+// openItems values the foreign invoices open on date, with their balance as
+// of date, at the rates of date.
+// It returns the rate used per currency and the currencies without a rate,
+// whose items are left out.
+func (s *fxService) openItems(ctx context.Context, companyID uuid.UUID, date time.Time) ([]FXOpenItem, map[string]float64, []string, error) {
+	invoices, err := s.repo.ListOpenForeignInvoices(ctx, companyID, ledgerBaseCurrency, date.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	rates := map[string]float64{}
+	var missing []string
+	items := []FXOpenItem{}
+	for _, invoice := range invoices {
+		currency := strings.ToUpper(invoice.Currency)
+		rate, ok := rates[currency]
+		if !ok {
+			rate, err = s.ledger.BaseRate(ctx, companyID, currency, date)
+			if err != nil {
+				if !errors.Is(err, ErrExchangeRateMissing) {
+					return nil, nil, nil, err
+				}
+				missing = append(missing, currency)
+			}
+			rates[currency] = rate
+		}
+		if rate == 0 {
+			continue
+		}
+
+		item := FXOpenItem{
+			InvoiceID: invoice.ID,
+			InvoiceNo: invoice.InvoiceNo,
+			DueDate:   invoice.DueDate,
+		}
+		kind, amount := fx.Receivable, invoice.BalanceAmount
+		item.PartnerType, item.PartnerID = "customer", invoice.CustomerID
+		if invoice.Customer != nil {
+			item.PartnerName = invoice.Customer.Name
+		}
+		if isPurchaseInvoice(invoice) {
+			kind = fx.Payable
+			item.PartnerType, item.PartnerID = "supplier", invoice.SupplierID
+			if invoice.Supplier != nil {
+				item.PartnerName = invoice.Supplier.Name
+			}
+		}
+		// Credit notes reduce the balance they belong to
+		if invoice.Type == "credit_note" {
+			amount = -amount
+		}
+
+		bookedRate, err := s.ledger.BookedRate(ctx, invoice)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		item.Valuation, err = fx.Revalue(fx.Item{
+			Kind:       kind,
+			Currency:   currency,
+			Amount:     amount,
+			BookedRate: bookedRate,
+		}, rate)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rates, missing, nil
+}
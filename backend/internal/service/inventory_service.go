@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -183,18 +184,24 @@ type InventoryValueItem struct {
 type inventoryService struct {
 	inventoryRepo repository.InventoryRepository
 	orderRepo     repository.OrderRepository
+	transactor    repository.Transactor
 	n8nService    N8NService
+	ledger        LedgerService
 }
 
 func NewInventoryService(
 	inventoryRepo repository.InventoryRepository,
 	orderRepo repository.OrderRepository,
+	transactor repository.Transactor,
 	n8nService N8NService,
+	ledger LedgerService,
 ) InventoryService {
 	return &inventoryService{
 		inventoryRepo: inventoryRepo,
 		orderRepo:     orderRepo,
+		transactor:    transactor,
 		n8nService:    n8nService,
+		ledger:        ledger,
 	}
 }
 
@@ -248,15 +255,11 @@ func (s *inventoryService) Create(companyID uuid.UUID, req CreateInventoryReques
 		inventory.Unit = "PCS"
 	}
 	
-	if err := s.inventoryRepo.Create(inventory); err != nil {
-		return nil, err
-	}
-	
 	// Create initial stock movement if there's initial stock
+	var movement *models.StockMovement
 	if req.InitialStock > 0 {
-		movement := &models.StockMovement{
+		movement = &models.StockMovement{
 			CompanyID:       companyID,
-			InventoryID:     inventory.ID,
 			MovementType:    "in",
 			Reason:          "initial",
 			Quantity:        req.InitialStock,
@@ -267,7 +270,20 @@ func (s *inventoryService) Create(companyID uuid.UUID, req CreateInventoryReques
 			Notes:           "Initial stock",
 			CreatedBy:       companyID, // Should be userID
 		}
-		s.inventoryRepo.CreateMovement(movement)
+	}
+	
+	err := s.transactor.Transaction(context.Background(), func(ctx context.Context) error {
+		if err := s.inventoryRepo.WithContext(ctx).Create(inventory); err != nil {
+			return err
+		}
+		if movement == nil {
+			return nil
+		}
+		movement.InventoryID = inventory.ID
+		return s.postMovement(ctx, movement, inventory)
+	})
+	if err != nil {
+		return nil, err
 	}
 	
 	// Trigger N8N workflow
@@ -331,6 +347,16 @@ func (s *inventoryService) Delete(id uuid.UUID) error {
 	return s.inventoryRepo.Update(inventory)
 }
 
+// postMovement records a stock movement and posts it to the ledger. Run it
+// inside a transaction so a movement is never stored without its posting.
+func (s *inventoryService) postMovement(ctx context.Context, movement *models.StockMovement, inventory *models.Inventory) error {
+	if err := s.inventoryRepo.WithContext(ctx).CreateMovement(movement); err != nil {
+		return err
+	}
+	_, err := s.ledger.PostStockMovement(ctx, movement, inventory)
+	return err
+}
+
 // Stock operations
 func (s *inventoryService) AdjustStock(id, userID uuid.UUID, req StockAdjustmentRequest) (*models.StockMovement, error) {
 	inventory, err := s.inventoryRepo.Get(id)
@@ -338,6 +364,10 @@ func (s *inventoryService) AdjustStock(id, userID uuid.UUID, req StockAdjustment
 		return nil, err
 	}
 	
+	if err := s.ledger.EnsurePeriodOpen(context.Background(), inventory.CompanyID, time.Now()); err != nil {
+		return nil, err
+	}
+	
 	movementType := "in"
 	if req.Quantity < 0 {
 		movementType = "out"
@@ -364,7 +394,10 @@ func (s *inventoryService) AdjustStock(id, userID uuid.UUID, req StockAdjustment
 		}
 	}
 	
-	if err := s.inventoryRepo.CreateMovement(movement); err != nil {
+	err = s.transactor.Transaction(context.Background(), func(ctx context.Context) error {
+		return s.postMovement(ctx, movement, inventory)
+	})
+	if err != nil {
 		return nil, err
 	}
 	
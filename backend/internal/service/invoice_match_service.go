@@ -0,0 +1,577 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/threeway"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvoiceMatchNotFound is returned for unknown invoice matches
+	ErrInvoiceMatchNotFound = errors.New("invoice match not found")
+	// ErrInvoiceNotMatchable is returned for invoices that are not supplier
+	// invoices billing a purchase order
+	ErrInvoiceNotMatchable = errors.New("invoice does not bill a purchase order")
+	// ErrInvoiceMatchNotHeld is returned when reviewing a match that is not
+	// held
+	ErrInvoiceMatchNotHeld = errors.New("invoice match is not held for review")
+	// ErrReviewNoteRequired is returned when releasing or rejecting a held
+	// invoice without a note
+	ErrReviewNoteRequired = errors.New("a review note is required")
+	// ErrPurchaseOrderNotFound is returned for unknown purchase orders
+	ErrPurchaseOrderNotFound = errors.New("purchase order not found")
+	// ErrDuplicateSupplierInvoice is returned when a supplier's invoice
+	// number was recorded before
+	ErrDuplicateSupplierInvoice = errors.New("supplier invoice already recorded")
+	// ErrInvalidSupplierInvoice is returned for supplier invoices without
+	// lines or with lines lacking a quantity
+	ErrInvalidSupplierInvoice = errors.New("invalid supplier invoice")
+	// ErrInvalidMatchTolerance is returned for negative tolerances
+	ErrInvalidMatchTolerance = threeway.ErrInvalidTolerance
+)
+
+// invoiceHoldRoles are notified of invoices held for review
+const invoiceHoldRoles = `["admin","manager"]`
+
+// InvoiceMatchService matches supplier invoices against their purchase
+// order and receipts. Matched invoices are released to accounts payable;
+// the others are held with their discrepancies until receipts catch up or
+// AP releases or rejects them.
+type InvoiceMatchService interface {
+	GetConfig(ctx context.Context, companyID uuid.UUID) (*models.InvoiceMatchConfig, error)
+	UpdateConfig(ctx context.Context, config *models.InvoiceMatchConfig) (*models.InvoiceMatchConfig, error)
+
+	// RecordSupplierInvoice records and posts a supplier invoice billing a
+	// purchase order and matches it
+	RecordSupplierInvoice(ctx context.Context, req *SupplierInvoiceRequest, userID uuid.UUID) (*models.InvoiceMatch, error)
+	// MatchInvoice matches an invoice; invoices already matched, released
+	// or rejected keep their outcome
+	MatchInvoice(ctx context.Context, invoiceID uuid.UUID) (*models.InvoiceMatch, error)
+	// RematchOrder matches the held invoices of a purchase order again,
+	// after more goods were received
+	RematchOrder(ctx context.Context, purchaseOrderID uuid.UUID) ([]*models.InvoiceMatch, error)
+	// Release releases a held invoice to accounts payable despite its
+	// discrepancies
+	Release(ctx context.Context, id uuid.UUID, userID uuid.UUID, note string) (*models.InvoiceMatch, error)
+	// Reject returns a held invoice to the supplier
+	Reject(ctx context.Context, id uuid.UUID, userID uuid.UUID, note string) (*models.InvoiceMatch, error)
+
+	GetMatch(ctx context.Context, id uuid.UUID) (*models.InvoiceMatch, error)
+	ListMatches(ctx context.Context, params map[string]interface{}) ([]*models.InvoiceMatch, int64, error)
+}
+
+// SupplierInvoiceRequest is a supplier invoice billing a purchase order.
+// Currency and exchange rate default to the order's, the due date to 30
+// days after issue and the subtotal to the sum of the lines.
+type SupplierInvoiceRequest struct {
+	CompanyID         uuid.UUID                    `json:"-"`
+	PurchaseOrderID   uuid.UUID                    `json:"purchase_order_id"`
+	SupplierInvoiceNo string                       `json:"supplier_invoice_no"`
+	IssueDate         time.Time                    `json:"issue_date"`
+	DueDate           *time.Time                   `json:"due_date"`
+	Currency          string                       `json:"currency"`
+	ExchangeRate      float64                      `json:"exchange_rate"`
+	SubTotal          float64                      `json:"sub_total"`
+	TaxAmount         float64                      `json:"tax_amount"`
+	Notes             string                       `json:"notes"`
+	Lines             []SupplierInvoiceLineRequest `json:"lines"`
+}
+
+type SupplierInvoiceLineRequest struct {
+	PurchaseOrderItemID *uuid.UUID `json:"purchase_order_item_id"`
+	Description         string     `json:"description"`
+	Quantity            float64    `json:"quantity"`
+	Unit                string     `json:"unit"`
+	UnitPrice           float64    `json:"unit_price"`
+	LotNo               string     `json:"lot_no"`
+}
+
+type invoiceMatchService struct {
+	repo       repository.InvoiceMatchRepository
+	transactor repository.Transactor
+	ledger     LedgerService
+	system     SystemService
+}
+
+// NewInvoiceMatchService creates a new invoice match service
+func NewInvoiceMatchService(repo repository.InvoiceMatchRepository, transactor repository.Transactor, ledger LedgerService, system SystemService) InvoiceMatchService {
+	return &invoiceMatchService{
+		repo:       repo,
+		transactor: transactor,
+		ledger:     ledger,
+		system:     system,
+	}
+}
+
+// GetConfig returns the company's tolerances, the defaults if none are set
+func (s *invoiceMatchService) GetConfig(ctx context.Context, companyID uuid.UUID) (*models.InvoiceMatchConfig, error) {
+	config, err := s.repo.GetConfig(ctx, companyID)
+	if errors.Is(err, repository.ErrNotFound) {
+		t := threeway.DefaultTolerance()
+		return &models.InvoiceMatchConfig{
+			CompanyID:            companyID,
+			PriceTolerancePct:    t.PricePct,
+			QuantityTolerancePct: t.QuantityPct,
+			AmountTolerance:      t.Amount,
+		}, nil
+	}
+	return config, err
+}
+
+func (s *invoiceMatchService) UpdateConfig(ctx context.Context, config *models.InvoiceMatchConfig) (*models.InvoiceMatchConfig, error) {
+	if err := matchTolerance(config).Validate(); err != nil {
+		return nil, err
+	}
+	existing, err := s.repo.GetConfig(ctx, config.CompanyID)
+	if err == nil {
+		config.ID = existing.ID
+		config.CreatedAt = existing.CreatedAt
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if err := s.repo.SaveConfig(ctx, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (s *invoiceMatchService) RecordSupplierInvoice(ctx context.Context, req *SupplierInvoiceRequest, userID uuid.UUID) (*models.InvoiceMatch, error) {
+	order, err := s.repo.GetPurchaseOrder(ctx, req.PurchaseOrderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrPurchaseOrderNotFound
+		}
+		return nil, err
+	}
+	if order.CompanyID != req.CompanyID {
+		return nil, ErrPurchaseOrderNotFound
+	}
+	if len(req.Lines) == 0 {
+		return nil, fmt.Errorf("%w: at least one line is required", ErrInvalidSupplierInvoice)
+	}
+	supplierInvoiceNo := strings.TrimSpace(req.SupplierInvoiceNo)
+	if supplierInvoiceNo == "" {
+		return nil, fmt.Errorf("%w: the supplier's invoice number is required", ErrInvalidSupplierInvoice)
+	}
+	exists, err := s.repo.SupplierInvoiceExists(ctx, order.CompanyID, order.SupplierID, supplierInvoiceNo)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicateSupplierInvoice, supplierInvoiceNo)
+	}
+
+	orderItems := make(map[uuid.UUID]models.PurchaseOrderItem, len(order.Items))
+	for _, item := range order.Items {
+		orderItems[item.ID] = item
+	}
+	var items []models.InvoiceItem
+	var subTotal float64
+	for i, line := range req.Lines {
+		if line.Quantity <= 0 || line.UnitPrice < 0 {
+			return nil, fmt.Errorf("%w: line %d needs a positive quantity and a price of 0 or more", ErrInvalidSupplierInvoice, i+1)
+		}
+		item := models.InvoiceItem{
+			Description:         strings.TrimSpace(line.Description),
+			Quantity:            line.Quantity,
+			Unit:                line.Unit,
+			UnitPrice:           line.UnitPrice,
+			TotalPrice:          line.Quantity * line.UnitPrice,
+			PurchaseOrderItemID: line.PurchaseOrderItemID,
+			LotNo:               strings.TrimSpace(line.LotNo),
+		}
+		if line.PurchaseOrderItemID != nil {
+			if orderItem, ok := orderItems[*line.PurchaseOrderItemID]; ok {
+				item.InventoryID = orderItem.InventoryID
+				if item.Description == "" {
+					item.Description = orderItem.ProductName
+				}
+				if item.Unit == "" {
+					item.Unit = orderItem.Unit
+				}
+			}
+		}
+		if item.Description == "" {
+			return nil, fmt.Errorf("%w: line %d needs a description", ErrInvalidSupplierInvoice, i+1)
+		}
+		subTotal += item.TotalPrice
+		items = append(items, item)
+	}
+
+	issueDate := req.IssueDate
+	if issueDate.IsZero() {
+		issueDate = time.Now()
+	}
+	if err := s.ledger.EnsurePeriodOpen(ctx, order.CompanyID, issueDate); err != nil {
+		return nil, err
+	}
+	invoice := &models.Invoice{
+		CompanyID:         order.CompanyID,
+		InvoiceNo:         fmt.Sprintf("PINV-%s-%06d", issueDate.Format("200601"), time.Now().UnixMicro()%1000000),
+		Type:              "purchase",
+		Status:            "issued",
+		SupplierID:        &order.SupplierID,
+		PurchaseOrderID:   &order.ID,
+		SupplierInvoiceNo: supplierInvoiceNo,
+		IssueDate:         issueDate,
+		DueDate:           issueDate.AddDate(0, 0, 30),
+		SubTotal:          req.SubTotal,
+		TaxAmount:         req.TaxAmount,
+		Currency:          strings.ToUpper(strings.TrimSpace(req.Currency)),
+		ExchangeRate:      req.ExchangeRate,
+		PaymentTerms:      order.PaymentTerms,
+		Notes:             req.Notes,
+		CreatedBy:         userID,
+	}
+	if req.DueDate != nil {
+		invoice.DueDate = *req.DueDate
+	}
+	if invoice.SubTotal == 0 {
+		invoice.SubTotal = subTotal
+	}
+	if invoice.Currency == "" {
+		invoice.Currency = order.Currency
+	}
+	if invoice.ExchangeRate <= 0 && invoice.Currency == order.Currency {
+		invoice.ExchangeRate = order.ExchangeRate
+	}
+	rate, err := s.ledger.DocumentRate(ctx, invoice.CompanyID, invoice.Currency, invoice.ExchangeRate, issueDate)
+	if err != nil {
+		return nil, err
+	}
+	invoice.ExchangeRate = rate
+	if invoice.SubTotal > 0 {
+		invoice.TaxRate = invoice.TaxAmount / invoice.SubTotal * 100
+	}
+	invoice.TotalAmount = invoice.SubTotal + invoice.TaxAmount
+	invoice.BalanceAmount = invoice.TotalAmount
+
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.CreateInvoice(ctx, invoice, items); err != nil {
+			return fmt.Errorf("failed to record supplier invoice: %w", err)
+		}
+		_, err := s.ledger.PostInvoice(ctx, invoice)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.MatchInvoice(ctx, invoice.ID)
+}
+
+func (s *invoiceMatchService) MatchInvoice(ctx context.Context, invoiceID uuid.UUID) (*models.InvoiceMatch, error) {
+	invoice, err := s.repo.GetInvoice(ctx, invoiceID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, err
+	}
+	if invoice.Type != "purchase" || invoice.PurchaseOrderID == nil || invoice.SupplierID == nil {
+		return nil, ErrInvoiceNotMatchable
+	}
+	match, err := s.repo.GetMatchByInvoice(ctx, invoice.ID)
+	switch {
+	case err == nil:
+		if match.Status != models.MatchStatusHeld {
+			return match, nil
+		}
+	case errors.Is(err, repository.ErrNotFound):
+		match = &models.InvoiceMatch{
+			CompanyID:       invoice.CompanyID,
+			InvoiceID:       invoice.ID,
+			PurchaseOrderID: *invoice.PurchaseOrderID,
+			SupplierID:      *invoice.SupplierID,
+		}
+	default:
+		return nil, err
+	}
+
+	order, err := s.repo.GetPurchaseOrder(ctx, *invoice.PurchaseOrderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrPurchaseOrderNotFound
+		}
+		return nil, err
+	}
+	items, err := s.repo.ListInvoiceItems(ctx, invoice.ID)
+	if err != nil {
+		return nil, err
+	}
+	receipts, err := s.repo.ListReceipts(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	invoiced, err := s.repo.InvoicedQuantities(ctx, order.ID, invoice.ID)
+	if err != nil {
+		return nil, err
+	}
+	config, err := s.GetConfig(ctx, invoice.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	tolerance := matchTolerance(config)
+
+	result := threeway.Match(
+		matchOrder(order, receipts, invoiced),
+		matchInvoice(invoice, items),
+		tolerance,
+	)
+
+	discrepancies, err := json.Marshal(result.Discrepancies)
+	if err != nil {
+		return nil, err
+	}
+	match.PriceTolerancePct = tolerance.PricePct
+	match.QuantityTolerancePct = tolerance.QuantityPct
+	match.AmountTolerance = tolerance.Amount
+	match.Discrepancies = discrepancies
+	match.Reasons = result.Reasons()
+	match.Attempts++
+	match.MatchedAt = time.Now()
+	match.Lines = nil
+	for _, line := range result.Lines {
+		ml := models.InvoiceMatchLine{
+			InvoicedQuantity:   line.Invoiced,
+			PreviouslyInvoiced: line.PreviouslyInvoiced,
+			OrderedQuantity:    line.Ordered,
+			ReceivedQuantity:   line.Received,
+			InvoicePrice:       line.InvoicePrice,
+			OrderPrice:         line.OrderPrice,
+			PriceVariancePct:   line.PriceVariancePct,
+			Matched:            line.Matched,
+			Reasons:            strings.Join(line.Reasons, "\n"),
+		}
+		ml.InvoiceItemID, _ = uuid.Parse(line.InvoiceLineID)
+		if id, err := uuid.Parse(line.OrderLineID); err == nil {
+			ml.PurchaseOrderItemID = &id
+		}
+		match.Lines = append(match.Lines, ml)
+	}
+
+	if result.Matched {
+		match.Status = models.MatchStatusMatched
+		if err := s.repo.ReleaseMatch(ctx, match, invoicePayable(invoice)); err != nil {
+			return nil, fmt.Errorf("failed to release matched invoice: %w", err)
+		}
+		return match, nil
+	}
+
+	first := match.Status == ""
+	match.Status = models.MatchStatusHeld
+	if err := s.repo.SaveMatch(ctx, match); err != nil {
+		return nil, fmt.Errorf("failed to hold invoice: %w", err)
+	}
+	if first {
+		s.notifyHold(ctx, invoice, order, match)
+	}
+	return match, nil
+}
+
+func (s *invoiceMatchService) RematchOrder(ctx context.Context, purchaseOrderID uuid.UUID) ([]*models.InvoiceMatch, error) {
+	ids, err := s.repo.ListHeldInvoiceIDs(ctx, purchaseOrderID)
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]*models.InvoiceMatch, 0, len(ids))
+	for _, id := range ids {
+		match, err := s.MatchInvoice(ctx, id)
+		if err != nil {
+			return matches, err
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+func (s *invoiceMatchService) Release(ctx context.Context, id uuid.UUID, userID uuid.UUID, note string) (*models.InvoiceMatch, error) {
+	match, err := s.heldMatch(ctx, id, note)
+	if err != nil {
+		return nil, err
+	}
+	invoice, err := s.repo.GetInvoice(ctx, match.InvoiceID)
+	if err != nil {
+		return nil, err
+	}
+	reviewMatch(match, models.MatchStatusReleased, userID, note)
+	if err := s.repo.ReleaseMatch(ctx, match, invoicePayable(invoice)); err != nil {
+		return nil, fmt.Errorf("failed to release invoice: %w", err)
+	}
+	return match, nil
+}
+
+func (s *invoiceMatchService) Reject(ctx context.Context, id uuid.UUID, userID uuid.UUID, note string) (*models.InvoiceMatch, error) {
+	match, err := s.heldMatch(ctx, id, note)
+	if err != nil {
+		return nil, err
+	}
+	reviewMatch(match, models.MatchStatusRejected, userID, note)
+	if err := s.repo.SaveMatch(ctx, match); err != nil {
+		return nil, fmt.Errorf("failed to reject invoice: %w", err)
+	}
+	return match, nil
+}
+
+func (s *invoiceMatchService) GetMatch(ctx context.Context, id uuid.UUID) (*models.InvoiceMatch, error) {
+	match, err := s.repo.GetMatch(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvoiceMatchNotFound
+		}
+		return nil, err
+	}
+	return match, nil
+}
+
+func (s *invoiceMatchService) ListMatches(ctx context.Context, params map[string]interface{}) ([]*models.InvoiceMatch, int64, error) {
+	return s.repo.ListMatches(ctx, params)
+}
+
+// heldMatch loads a match for review
+func (s *invoiceMatchService) heldMatch(ctx context.Context, id uuid.UUID, note string) (*models.InvoiceMatch, error) {
+	if strings.TrimSpace(note) == "" {
+		return nil, ErrReviewNoteRequired
+	}
+	match, err := s.GetMatch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if match.Status != models.MatchStatusHeld {
+		return nil, ErrInvoiceMatchNotHeld
+	}
+	return match, nil
+}
+
+// notifyHold raises a system notification for an invoice held for review;
+// a failure is logged
+func (s *invoiceMatchService) notifyHold(ctx context.Context, invoice *models.Invoice, order *models.PurchaseOrder, match *models.InvoiceMatch) {
+	if s.system == nil {
+		return
+	}
+	companyID := invoice.CompanyID
+	notification := &models.SystemNotification{
+		CompanyID:    &companyID,
+		Title:        fmt.Sprintf("Supplier invoice held: %s", invoice.SupplierInvoiceNo),
+		Message:      fmt.Sprintf("Invoice %s does not match purchase order %s:\n%s", invoice.InvoiceNo, order.OrderNo, match.Reasons),
+		Type:         "warning",
+		Priority:     "medium",
+		TargetRoles:  invoiceHoldRoles,
+		IsPersistent: true,
+		ActionLabel:  "Review invoice",
+		ActionURL:    fmt.Sprintf("/invoice-matches/%s", match.ID),
+	}
+	if err := s.system.CreateSystemNotification(ctx, notification, invoice.CreatedBy); err != nil {
+		log.Printf("Failed to raise hold notification for invoice %s: %v", invoice.ID, err)
+	}
+}
+
+func reviewMatch(match *models.InvoiceMatch, status string, userID uuid.UUID, note string) {
+	now := time.Now()
+	match.Status = status
+	match.ReviewedBy = &userID
+	match.ReviewedAt = &now
+	match.ReviewNote = strings.TrimSpace(note)
+}
+
+func matchTolerance(config *models.InvoiceMatchConfig) threeway.Tolerance {
+	return threeway.Tolerance{
+		PricePct:    config.PriceTolerancePct,
+		QuantityPct: config.QuantityTolerancePct,
+		Amount:      config.AmountTolerance,
+	}
+}
+
+// matchOrder builds the order side of a match. Received is what passed
+// incoming inspection; lines received before receipts were recorded count
+// their received quantity.
+func matchOrder(order *models.PurchaseOrder, receipts []models.PurchaseOrderReceipt, invoiced map[uuid.UUID]float64) threeway.Order {
+	type received struct {
+		recorded bool
+		accepted float64
+		lots     []string
+	}
+	byItem := make(map[uuid.UUID]*received)
+	for _, receipt := range receipts {
+		r, ok := byItem[receipt.PurchaseOrderItemID]
+		if !ok {
+			r = &received{recorded: true}
+			byItem[receipt.PurchaseOrderItemID] = r
+		}
+		if receipt.QualityPassed {
+			r.accepted += receipt.Quantity
+			if receipt.LotNo != "" {
+				r.lots = append(r.lots, receipt.LotNo)
+			}
+		}
+	}
+
+	o := threeway.Order{
+		SupplierID: order.SupplierID.String(),
+		Currency:   order.Currency,
+		Open:       order.Status != "draft" && order.Status != "cancelled",
+	}
+	for _, item := range order.Items {
+		line := threeway.OrderLine{
+			ID:                 item.ID.String(),
+			Description:        item.ProductName,
+			Ordered:            item.OrderedQuantity,
+			UnitPrice:          item.UnitPrice,
+			Received:           item.ReceivedQuantity,
+			PreviouslyInvoiced: invoiced[item.ID],
+		}
+		if r, ok := byItem[item.ID]; ok && r.recorded {
+			line.Received = r.accepted
+			line.Lots = r.lots
+		}
+		o.Lines = append(o.Lines, line)
+	}
+	return o
+}
+
+func matchInvoice(invoice *models.Invoice, items []models.InvoiceItem) threeway.Invoice {
+	inv := threeway.Invoice{
+		SupplierID: invoice.SupplierID.String(),
+		Currency:   invoice.Currency,
+		SubTotal:   invoice.SubTotal,
+	}
+	for _, item := range items {
+		line := threeway.InvoiceLine{
+			ID:          item.ID.String(),
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			LotNo:       item.LotNo,
+		}
+		if item.PurchaseOrderItemID != nil {
+			line.OrderLineID = item.PurchaseOrderItemID.String()
+		}
+		inv.Lines = append(inv.Lines, line)
+	}
+	return inv
+}
+
+// invoicePayable is the account payable an invoice is released into
+func invoicePayable(invoice *models.Invoice) *models.AccountPayable {
+	return &models.AccountPayable{
+		CompanyID:       invoice.CompanyID,
+		SupplierID:      *invoice.SupplierID,
+		InvoiceID:       invoice.ID,
+		InvoiceAmount:   invoice.TotalAmount,
+		PaidAmount:      invoice.PaidAmount,
+		BalanceAmount:   invoice.BalanceAmount,
+		Currency:        invoice.Currency,
+		InvoiceDate:     invoice.IssueDate,
+		DueDate:         invoice.DueDate,
+		Status:          "open",
+		PaymentPriority: "medium",
+	}
+}
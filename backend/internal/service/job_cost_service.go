@@ -0,0 +1,420 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/jobcost"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrJobCostNotFound is returned when a production order has not been costed yet
+	ErrJobCostNotFound = errors.New("job cost not found")
+	// ErrProductionOrderNotFound is returned when a production order is not found
+	ErrProductionOrderNotFound = errors.New("production order not found")
+)
+
+// Where the estimate of a job comes from
+const (
+	estimateSourceCostCalculation = "cost_calculation"
+	estimateSourceQuote           = "quote"
+	estimateSourceProductionOrder = "production_order"
+	estimateSourceNone            = "none"
+)
+
+// jobCostTopProducts is how many products the variance summary lists
+const jobCostTopProducts = 10
+
+// JobCostService accumulates the actual material, labor, subcontract and
+// overhead cost of production orders and compares it with the cost calculation or quote
+// they were sold on. Costs are taken to be in the production order's
+// currency.
+type JobCostService interface {
+	// Apply recalculates the job cost of an order and writes the actuals
+	// onto it without saving the order. The job cost is final once the
+	// order is completed.
+	Apply(ctx context.Context, order *models.ProductionOrder) (*models.ProductionJobCost, error)
+	// Recalculate applies the job cost to a stored order and saves it
+	Recalculate(ctx context.Context, productionOrderID uuid.UUID) (*models.ProductionJobCost, error)
+	GetJobCost(ctx context.Context, productionOrderID uuid.UUID) (*models.ProductionJobCost, error)
+	ListJobCosts(ctx context.Context, params map[string]interface{}) ([]*models.ProductionJobCost, int64, error)
+	// SummarizeVariances totals the variance per cost driver over the
+	// orders completed between from and to
+	SummarizeVariances(ctx context.Context, companyID uuid.UUID, from, to *time.Time) (*JobCostVarianceSummary, error)
+}
+
+// JobCostDetails is what a job cost was accumulated from
+type JobCostDetails struct {
+	Materials   []jobcost.MaterialIssue  `json:"materials"`
+	Labor       []jobcost.LaborEntry     `json:"labor"`
+	Subcontract []jobcost.SubcontractFee `json:"subcontract"`
+	Overheads   []jobcost.OverheadCharge `json:"overheads"`
+}
+
+// JobCostVarianceSummary is the variance of completed orders per cost
+// driver, and the products that deviated most from their estimates
+type JobCostVarianceSummary struct {
+	From     *time.Time               `json:"from"`
+	To       *time.Time               `json:"to"`
+	Jobs     int                      `json:"jobs"`
+	Drivers  []jobcost.DriverSummary  `json:"drivers"`
+	Products []JobCostProductVariance `json:"products"`
+}
+
+type JobCostProductVariance struct {
+	InventoryID uuid.UUID `json:"inventory_id"`
+	ProductName string    `json:"product_name"`
+	Jobs        int       `json:"jobs"`
+	Estimated   float64   `json:"estimated"`
+	Actual      float64   `json:"actual"`
+	Variance    float64   `json:"variance"`
+	Percent     float64   `json:"percent"`
+}
+
+type jobCostService struct {
+	jobCostRepo    repository.JobCostRepository
+	productionRepo repository.ProductionRepository
+}
+
+// NewJobCostService creates a new job cost service
+func NewJobCostService(jobCostRepo repository.JobCostRepository, productionRepo repository.ProductionRepository) JobCostService {
+	return &jobCostService{
+		jobCostRepo:    jobCostRepo,
+		productionRepo: productionRepo,
+	}
+}
+
+func (s *jobCostService) Apply(ctx context.Context, order *models.ProductionOrder) (*models.ProductionJobCost, error) {
+	now := time.Now()
+	final := order.Status == "completed"
+
+	materials, err := s.productionRepo.GetProductionMaterials(order.ID)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := s.productionRepo.GetTasksByProductionOrder(order.ID)
+	if err != nil {
+		return nil, err
+	}
+	receipts, err := s.jobCostRepo.ListSubcontractReceipts(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	rateDate := now
+	if order.ActualStartDate != nil {
+		rateDate = *order.ActualStartDate
+	}
+	rates, err := s.jobCostRepo.ListOverheadRates(ctx, order.CompanyID, rateDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var details JobCostDetails
+	for _, m := range materials {
+		quantity := m.IssuedQuantity - m.ReturnedQuantity
+		if quantity <= 0 {
+			continue
+		}
+		reference := m.InventoryID.String()
+		if m.Inventory != nil {
+			reference = m.Inventory.SKU
+		}
+		details.Materials = append(details.Materials, jobcost.MaterialIssue{
+			Reference: reference,
+			Quantity:  quantity,
+			UnitCost:  materialUnitCost(&m),
+		})
+	}
+	for _, t := range tasks {
+		// Time at a subcontractor is charged through its fee
+		if t.RouteOperation != nil && t.RouteOperation.Subcontracted {
+			continue
+		}
+		entry := jobcost.LaborEntry{
+			Reference: t.Name,
+			Hours:     jobcost.Hours(t.ActualStartTime, t.ActualEndTime, now),
+		}
+		if t.WorkStation != nil {
+			entry.Department = t.WorkStation.Department
+			entry.HourlyCost = t.WorkStation.HourlyCost
+		}
+		if entry.Hours > 0 {
+			details.Labor = append(details.Labor, entry)
+		}
+	}
+	for _, r := range receipts {
+		if r.FeeAmount == 0 {
+			continue
+		}
+		fee := jobcost.SubcontractFee{Quantity: r.ChargedQuantity, Amount: r.FeeAmount}
+		if r.SubcontractOrder != nil {
+			fee.Reference = r.SubcontractOrder.OrderNo
+			fee.Process = r.SubcontractOrder.Process
+			if r.SubcontractOrder.Supplier != nil {
+				fee.Supplier = r.SubcontractOrder.Supplier.Name
+			}
+		}
+		details.Subcontract = append(details.Subcontract, fee)
+	}
+	rules := make([]jobcost.OverheadRule, 0, len(rates))
+	for _, rate := range rates {
+		rules = append(rules, jobcost.OverheadRule{
+			Department: rate.Department,
+			Type:       rate.RateType,
+			Value:      rate.RateValue,
+			BasedOn:    rate.BasedOn,
+		})
+	}
+	actual := jobcost.Accumulate(details.Materials, details.Labor, details.Subcontract, rules)
+	details.Overheads = actual.Overheads
+
+	quantity := order.PlannedQuantity
+	if order.ProducedQuantity > 0 {
+		quantity = order.ProducedQuantity
+	}
+	estimate, calculationID, quoteID, err := s.estimate(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	estimate = estimate.Scale(quantity)
+
+	detailJSON, _ := json.Marshal(details)
+	varianceJSON, _ := json.Marshal(jobcost.Compare(estimate, actual))
+	record := &models.ProductionJobCost{
+		CompanyID:            order.CompanyID,
+		ProductionOrderID:    order.ID,
+		OrderNo:              order.OrderNo,
+		ProductName:          order.ProductName,
+		InventoryID:          order.InventoryID,
+		Currency:             order.Currency,
+		Quantity:             quantity,
+		Final:                final,
+		EstimateSource:       estimate.Source,
+		CostCalculationID:    calculationID,
+		QuoteID:              quoteID,
+		EstimateBreakdown:    estimate.Breakdown,
+		EstimatedMaterial:    estimate.Material,
+		EstimatedLabor:       estimate.Labor,
+		EstimatedSubcontract: estimate.Subcontract,
+		EstimatedOverhead:    estimate.Overhead,
+		EstimatedTotal:       estimate.Total,
+		EstimatedHours:       estimate.LaborHours,
+		ActualMaterial:       actual.Material,
+		ActualLabor:          actual.Labor,
+		ActualSubcontract:    actual.Subcontract,
+		ActualOverhead:       actual.Overhead,
+		ActualTotal:          actual.Total,
+		ActualHours:          actual.LaborHours,
+		Details:              detailJSON,
+		Variances:            varianceJSON,
+		CalculatedAt:         now,
+	}
+	if final {
+		record.CompletedAt = &now
+		if order.ActualEndDate != nil {
+			record.CompletedAt = order.ActualEndDate
+		}
+	}
+	if err := s.jobCostRepo.SaveJobCost(ctx, record); err != nil {
+		return nil, err
+	}
+
+	order.MaterialCost = actual.Material
+	order.LaborCost = actual.Labor
+	order.OverheadCost = actual.Overhead
+	order.ActualCost = actual.Total
+	return record, nil
+}
+
+// materialUnitCost values an issue at the cost recorded when it was issued,
+// otherwise at the item's average or standard cost
+func materialUnitCost(m *models.ProductionMaterial) float64 {
+	if m.UnitCost > 0 || m.Inventory == nil {
+		return m.UnitCost
+	}
+	return inventoryUnitCost(m.Inventory)
+}
+
+// inventoryUnitCost is the average cost of an item, its standard cost until
+// an average is known
+func inventoryUnitCost(inventory *models.Inventory) float64 {
+	if inventory.AverageCost > 0 {
+		return inventory.AverageCost
+	}
+	return inventory.StandardCost
+}
+
+// estimate finds what the order was expected to cost: the cost calculation
+// of the quote it was sold on, the quote itself, or the estimate on the
+// production order, in that order
+func (s *jobCostService) estimate(ctx context.Context, order *models.ProductionOrder) (jobcost.Estimate, *uuid.UUID, *uuid.UUID, error) {
+	if order.SalesOrder != nil && order.SalesOrder.QuoteID != uuid.Nil {
+		quoteID := order.SalesOrder.QuoteID
+
+		calculation, err := s.jobCostRepo.FindCostCalculation(ctx, quoteID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return jobcost.Estimate{}, nil, nil, err
+		}
+		if err == nil && calculation.Quantity > 0 {
+			var hours float64
+			for _, d := range calculation.Details {
+				hours += d.TotalTimeHours
+			}
+			return jobcost.Estimate{
+				Source:     estimateSourceCostCalculation,
+				Quantity:   float64(calculation.Quantity),
+				Material:   calculation.MaterialCost,
+				Labor:      calculation.ProcessCost,
+				Overhead:   calculation.OverheadCost,
+				Total:      calculation.MaterialCost + calculation.ProcessCost + calculation.OverheadCost,
+				LaborHours: hours,
+				Breakdown:  true,
+			}, &calculation.ID, &quoteID, nil
+		}
+
+		quote, err := s.jobCostRepo.GetQuote(ctx, quoteID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return jobcost.Estimate{}, nil, nil, err
+		}
+		if err == nil && order.SalesOrder.Quantity > 0 {
+			// Packaging, shipping and tariffs are not production costs;
+			// surface and heat treatment are usually subcontracted
+			subcontract := quote.SurfaceCost + quote.HeatTreatCost
+			overhead := (quote.MaterialCost + quote.ProcessCost + subcontract) * quote.OverheadRate / 100
+			return jobcost.Estimate{
+				Source:      estimateSourceQuote,
+				Quantity:    float64(order.SalesOrder.Quantity),
+				Material:    quote.MaterialCost,
+				Labor:       quote.ProcessCost,
+				Subcontract: subcontract,
+				Overhead:    overhead,
+				Total:       quote.MaterialCost + quote.ProcessCost + subcontract + overhead,
+				Breakdown:   true,
+			}, nil, &quoteID, nil
+		}
+	}
+
+	if order.EstimatedCost > 0 {
+		return jobcost.Estimate{
+			Source:   estimateSourceProductionOrder,
+			Quantity: order.PlannedQuantity,
+			Total:    order.EstimatedCost,
+		}, nil, nil, nil
+	}
+	return jobcost.Estimate{Source: estimateSourceNone}, nil, nil, nil
+}
+
+func (s *jobCostService) Recalculate(ctx context.Context, productionOrderID uuid.UUID) (*models.ProductionJobCost, error) {
+	order, err := s.productionRepo.GetProductionOrder(productionOrderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductionOrderNotFound
+		}
+		return nil, err
+	}
+	record, err := s.Apply(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.productionRepo.UpdateProductionOrder(order); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (s *jobCostService) GetJobCost(ctx context.Context, productionOrderID uuid.UUID) (*models.ProductionJobCost, error) {
+	record, err := s.jobCostRepo.GetJobCost(ctx, productionOrderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrJobCostNotFound
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+func (s *jobCostService) ListJobCosts(ctx context.Context, params map[string]interface{}) ([]*models.ProductionJobCost, int64, error) {
+	return s.jobCostRepo.ListJobCosts(ctx, params)
+}
+
+func (s *jobCostService) SummarizeVariances(ctx context.Context, companyID uuid.UUID, from, to *time.Time) (*JobCostVarianceSummary, error) {
+	params := map[string]interface{}{
+		"company_id": companyID,
+		"final":      true,
+		"all":        true,
+	}
+	if from != nil {
+		params["from"] = *from
+	}
+	if to != nil {
+		params["to"] = *to
+	}
+	records, _, err := s.jobCostRepo.ListJobCosts(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &JobCostVarianceSummary{From: from, To: to}
+	var jobs [][]jobcost.Variance
+	products := map[uuid.UUID]*JobCostProductVariance{}
+	for _, r := range records {
+		if r.EstimateSource == estimateSourceNone {
+			continue
+		}
+		estimate := jobcost.Estimate{
+			Quantity:    r.Quantity,
+			Material:    r.EstimatedMaterial,
+			Labor:       r.EstimatedLabor,
+			Subcontract: r.EstimatedSubcontract,
+			Overhead:    r.EstimatedOverhead,
+			Total:       r.EstimatedTotal,
+			LaborHours:  r.EstimatedHours,
+			Breakdown:   r.EstimateBreakdown,
+		}
+		actual := jobcost.Actual{
+			Material:    r.ActualMaterial,
+			Labor:       r.ActualLabor,
+			Subcontract: r.ActualSubcontract,
+			Overhead:    r.ActualOverhead,
+			Total:       r.ActualTotal,
+			LaborHours:  r.ActualHours,
+		}
+		jobs = append(jobs, jobcost.Compare(estimate, actual))
+
+		p, ok := products[r.InventoryID]
+		if !ok {
+			p = &JobCostProductVariance{InventoryID: r.InventoryID, ProductName: r.ProductName}
+			products[r.InventoryID] = p
+		}
+		p.Jobs++
+		p.Estimated += r.EstimatedTotal
+		p.Actual += r.ActualTotal
+	}
+	summary.Jobs = len(jobs)
+	summary.Drivers = jobcost.Summarize(jobs)
+
+	for _, p := range products {
+		p.Estimated = jobcost.Round(p.Estimated)
+		p.Actual = jobcost.Round(p.Actual)
+		p.Variance = jobcost.Round(p.Actual - p.Estimated)
+		if p.Estimated != 0 {
+			p.Percent = jobcost.Round(p.Variance / math.Abs(p.Estimated) * 100)
+		}
+		summary.Products = append(summary.Products, *p)
+	}
+	sort.Slice(summary.Products, func(i, j int) bool {
+		return math.Abs(summary.Products[i].Variance) > math.Abs(summary.Products[j].Variance)
+	})
+	if len(summary.Products) > jobCostTopProducts {
+		summary.Products = summary.Products[:jobCostTopProducts]
+	}
+	return summary, nil
+}
@@ -0,0 +1,1258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/fx"
+	"github.com/fastenmind/fastener-api/internal/infrastructure/ledger"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrGLAccountNotFound is returned when a GL account is not found
+	ErrGLAccountNotFound = errors.New("GL account not found")
+	// ErrInvalidGLAccount is returned when an account lacks its code or name or has an unknown type
+	ErrInvalidGLAccount = errors.New("invalid GL account")
+	// ErrDuplicateGLAccount is returned when an account code is already used in the chart
+	ErrDuplicateGLAccount = errors.New("GL account code already exists")
+	// ErrPostingRuleNotFound is returned when a posting rule is not found
+	ErrPostingRuleNotFound = errors.New("posting rule not found")
+	// ErrInvalidPostingRule is returned when a posting rule lacks its role or account
+	ErrInvalidPostingRule = errors.New("invalid posting rule")
+	// ErrJournalEntryNotFound is returned when a journal entry is not found
+	ErrJournalEntryNotFound = errors.New("journal entry not found")
+	// ErrUnbalancedEntry is returned when debits and credits of an entry differ
+	ErrUnbalancedEntry = errors.New("journal entry is not balanced")
+	// ErrPeriodClosed is returned when posting into a closed or locked financial period
+	ErrPeriodClosed = errors.New("financial period is closed")
+	// ErrPostingAccountMissing is returned when no account is mapped to a posting role
+	ErrPostingAccountMissing = errors.New("no GL account for posting role")
+	// ErrEntryAlreadyReversed is returned when reversing an entry twice
+	ErrEntryAlreadyReversed = errors.New("journal entry is already reversed")
+	// ErrExchangeRateMissing is returned when no exchange rate to the base currency is stored for a date
+	ErrExchangeRateMissing = errors.New("no exchange rate to the base currency")
+)
+
+// ledgerBaseCurrency is the currency journal lines are kept in
+const ledgerBaseCurrency = "TWD"
+
+// Journal entry statuses
+const (
+	journalEntryPosted   = "posted"
+	journalEntryReversed = "reversed"
+)
+
+// LedgerService keeps the general ledger: the chart of accounts, journal
+// entries generated from business events and the ledger reports
+type LedgerService interface {
+	// Chart of accounts
+	SetupChartOfAccounts(ctx context.Context, companyID uuid.UUID) ([]*models.GLAccount, error)
+	CreateAccount(ctx context.Context, account *models.GLAccount) error
+	UpdateAccount(ctx context.Context, account *models.GLAccount) error
+	GetAccount(ctx context.Context, id uuid.UUID) (*models.GLAccount, error)
+	ListAccounts(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.GLAccount, error)
+
+	// Posting rules
+	CreatePostingRule(ctx context.Context, rule *models.PostingRule) error
+	UpdatePostingRule(ctx context.Context, rule *models.PostingRule) error
+	DeletePostingRule(ctx context.Context, id uuid.UUID) error
+	GetPostingRule(ctx context.Context, id uuid.UUID) (*models.PostingRule, error)
+	ListPostingRules(ctx context.Context, companyID uuid.UUID) ([]*models.PostingRule, error)
+
+	// Journal entries
+	CreateJournalEntry(ctx context.Context, req CreateJournalEntryRequest) (*models.JournalEntry, error)
+	GetJournalEntry(ctx context.Context, id uuid.UUID) (*models.JournalEntry, error)
+	ListJournalEntries(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.JournalEntry, int64, error)
+	ReverseJournalEntry(ctx context.Context, req ReverseJournalEntryRequest) (*models.JournalEntry, error)
+	EnsurePeriodOpen(ctx context.Context, companyID uuid.UUID, date time.Time) error
+
+	// Posting from business events
+	PostInvoice(ctx context.Context, invoice *models.Invoice) (*models.JournalEntry, error)
+	PostPayment(ctx context.Context, payment *models.Payment) (*models.JournalEntry, error)
+	PostExpense(ctx context.Context, expense *models.Expense) (*models.JournalEntry, error)
+	PostStockMovement(ctx context.Context, movement *models.StockMovement, inventory *models.Inventory) (*models.JournalEntry, error)
+	PostProductionCompletion(ctx context.Context, order *models.ProductionOrder, inventory *models.Inventory, userID uuid.UUID) (*models.JournalEntry, error)
+	PostBankCharge(ctx context.Context, reconciliation *models.BankReconciliation, line *models.BankStatementLine) (*models.JournalEntry, error)
+	PostFXRevaluation(ctx context.Context, revaluation *models.FXRevaluation) (*models.JournalEntry, error)
+
+	// Currency
+	BaseRate(ctx context.Context, companyID uuid.UUID, currency string, date time.Time) (float64, error)
+	DocumentRate(ctx context.Context, companyID uuid.UUID, currency string, rate float64, date time.Time) (float64, error)
+	BookedRate(ctx context.Context, invoice *models.Invoice) (float64, error)
+
+	// Reports
+	GetTrialBalance(ctx context.Context, req LedgerReportRequest) (*TrialBalanceReport, error)
+	GetGeneralLedgerDetail(ctx context.Context, req LedgerReportRequest) (*GLDetailReport, error)
+}
+
+// CreateJournalEntryRequest is a manual journal entry
+type CreateJournalEntryRequest struct {
+	CompanyID    uuid.UUID                `json:"-"`
+	UserID       uuid.UUID                `json:"-"`
+	EntryDate    time.Time                `json:"entry_date"`
+	Description  string                   `json:"description"`
+	Currency     string                   `json:"currency"`      // defaults to the base currency
+	ExchangeRate float64                  `json:"exchange_rate"` // to the base currency
+	Lines        []CreateJournalLineInput `json:"lines"`
+}
+
+// CreateJournalLineInput is one line of a manual journal entry
+type CreateJournalLineInput struct {
+	AccountID   uuid.UUID  `json:"account_id"`
+	Debit       float64    `json:"debit"`
+	Credit      float64    `json:"credit"`
+	Memo        string     `json:"memo"`
+	PartnerType string     `json:"partner_type"`
+	PartnerID   *uuid.UUID `json:"partner_id"`
+}
+
+// ReverseJournalEntryRequest reverses a posted entry
+type ReverseJournalEntryRequest struct {
+	EntryID   uuid.UUID  `json:"-"`
+	UserID    uuid.UUID  `json:"-"`
+	EntryDate *time.Time `json:"entry_date"` // defaults to today
+	Reason    string     `json:"reason"`
+}
+
+// LedgerReportRequest selects the range of a ledger report. To is inclusive;
+// without From the report covers everything up to To.
+type LedgerReportRequest struct {
+	CompanyID uuid.UUID
+	AccountID *uuid.UUID
+	From      *time.Time
+	To        time.Time
+}
+
+// TrialBalanceReport is a trial balance in the base currency
+type TrialBalanceReport struct {
+	From     *time.Time `json:"from,omitempty"`
+	To       time.Time  `json:"to"`
+	Currency string     `json:"currency"`
+	*ledger.TrialBalance
+}
+
+// GLDetailReport lists the posted lines of each account with a running balance
+type GLDetailReport struct {
+	From     *time.Time        `json:"from,omitempty"`
+	To       time.Time         `json:"to"`
+	Currency string            `json:"currency"`
+	Accounts []GLDetailAccount `json:"accounts"`
+}
+
+// GLDetailAccount is one account of the GL detail report. Balances are on the
+// account's normal side.
+type GLDetailAccount struct {
+	AccountID uuid.UUID      `json:"account_id"`
+	Code      string         `json:"code"`
+	Name      string         `json:"name"`
+	Type      string         `json:"type"`
+	Opening   float64        `json:"opening"`
+	Debit     float64        `json:"debit"`
+	Credit    float64        `json:"credit"`
+	Closing   float64        `json:"closing"`
+	Lines     []GLDetailLine `json:"lines"`
+}
+
+// GLDetailLine is a posted line with the account balance after it
+type GLDetailLine struct {
+	EntryID        uuid.UUID `json:"entry_id"`
+	EntryNo        string    `json:"entry_no"`
+	EntryDate      time.Time `json:"entry_date"`
+	Event          string    `json:"event"`
+	SourceType     string    `json:"source_type"`
+	SourceNo       string    `json:"source_no"`
+	Description    string    `json:"description"`
+	Memo           string    `json:"memo"`
+	Debit          float64   `json:"debit"`
+	Credit         float64   `json:"credit"`
+	Balance        float64   `json:"balance"`
+	Currency       string    `json:"currency"`
+	AmountCurrency float64   `json:"amount_currency"`
+}
+
+// postingRequest is a business event to be posted through the posting rules
+type postingRequest struct {
+	companyID   uuid.UUID
+	userID      uuid.UUID
+	date        time.Time
+	event       string
+	match       string
+	sourceType  string
+	sourceID    uuid.UUID
+	sourceNo    string
+	description string
+	currency    string
+	rate        float64
+	partnerType string
+	partnerID   *uuid.UUID
+	lines       []ledger.Line
+}
+
+type ledgerService struct {
+	repo             repository.LedgerRepository
+	exchangeRateRepo *repository.ExchangeRateRepository
+}
+
+// NewLedgerService creates a new ledger service
+func NewLedgerService(repo repository.LedgerRepository, exchangeRateRepo *repository.ExchangeRateRepository) LedgerService {
+	return &ledgerService{
+		repo:             repo,
+		exchangeRateRepo: exchangeRateRepo,
+	}
+}
+
+// Chart of accounts
+
+// SetupChartOfAccounts seeds the default chart for a company without accounts
+// and returns the company's chart
+func (s *ledgerService) SetupChartOfAccounts(ctx context.Context, companyID uuid.UUID) ([]*models.GLAccount, error) {
+	if err := s.ensureChart(ctx, companyID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListAccounts(ctx, companyID, map[string]interface{}{})
+}
+
+func (s *ledgerService) ensureChart(ctx context.Context, companyID uuid.UUID) error {
+	count, err := s.repo.CountAccounts(ctx, companyID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	accounts := make([]*models.GLAccount, 0, len(ledger.DefaultChart))
+	for _, def := range ledger.DefaultChart {
+		accounts = append(accounts, &models.GLAccount{
+			CompanyID:     companyID,
+			Code:          def.Code,
+			Name:          def.Name,
+			Type:          def.Type,
+			NormalBalance: ledger.NormalBalance(def.Type),
+			Role:          def.Role,
+			IsActive:      true,
+		})
+	}
+	return s.repo.CreateAccounts(ctx, accounts)
+}
+
+func (s *ledgerService) CreateAccount(ctx context.Context, account *models.GLAccount) error {
+	if err := s.validateAccount(ctx, account); err != nil {
+		return err
+	}
+	account.IsActive = true
+	return s.repo.CreateAccounts(ctx, []*models.GLAccount{account})
+}
+
+func (s *ledgerService) UpdateAccount(ctx context.Context, account *models.GLAccount) error {
+	if err := s.validateAccount(ctx, account); err != nil {
+		return err
+	}
+	return s.repo.UpdateAccount(ctx, account)
+}
+
+func (s *ledgerService) validateAccount(ctx context.Context, account *models.GLAccount) error {
+	account.Code = strings.TrimSpace(account.Code)
+	account.Name = strings.TrimSpace(account.Name)
+	if account.Code == "" || account.Name == "" || !ledger.ValidAccountType(account.Type) {
+		return ErrInvalidGLAccount
+	}
+	account.NormalBalance = ledger.NormalBalance(account.Type)
+
+	existing, err := s.repo.FindAccountByCode(ctx, account.CompanyID, account.Code)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	if existing != nil && existing.ID != account.ID {
+		return ErrDuplicateGLAccount
+	}
+
+	if account.ParentID != nil {
+		parent, err := s.GetAccount(ctx, *account.ParentID)
+		if err != nil {
+			return err
+		}
+		if parent.CompanyID != account.CompanyID || parent.ID == account.ID {
+			return ErrInvalidGLAccount
+		}
+	}
+	return nil
+}
+
+func (s *ledgerService) GetAccount(ctx context.Context, id uuid.UUID) (*models.GLAccount, error) {
+	account, err := s.repo.GetAccount(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrGLAccountNotFound
+		}
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *ledgerService) ListAccounts(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.GLAccount, error) {
+	return s.repo.ListAccounts(ctx, companyID, params)
+}
+
+// Posting rules
+
+func (s *ledgerService) CreatePostingRule(ctx context.Context, rule *models.PostingRule) error {
+	if err := s.validatePostingRule(ctx, rule); err != nil {
+		return err
+	}
+	rule.IsActive = true
+	return s.repo.CreatePostingRule(ctx, rule)
+}
+
+func (s *ledgerService) UpdatePostingRule(ctx context.Context, rule *models.PostingRule) error {
+	if err := s.validatePostingRule(ctx, rule); err != nil {
+		return err
+	}
+	return s.repo.UpdatePostingRule(ctx, rule)
+}
+
+func (s *ledgerService) validatePostingRule(ctx context.Context, rule *models.PostingRule) error {
+	rule.Event = strings.TrimSpace(rule.Event)
+	rule.Match = strings.TrimSpace(rule.Match)
+	rule.Role = strings.TrimSpace(rule.Role)
+	if rule.Role == "" || rule.AccountID == uuid.Nil {
+		return ErrInvalidPostingRule
+	}
+	if rule.Event != "" {
+		known := false
+		for _, event := range ledger.Events {
+			if event == rule.Event {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("%w: unknown event %s", ErrInvalidPostingRule, rule.Event)
+		}
+	}
+
+	account, err := s.GetAccount(ctx, rule.AccountID)
+	if err != nil {
+		return err
+	}
+	if account.CompanyID != rule.CompanyID {
+		return ErrGLAccountNotFound
+	}
+	return nil
+}
+
+func (s *ledgerService) DeletePostingRule(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.GetPostingRule(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.DeletePostingRule(ctx, id)
+}
+
+func (s *ledgerService) GetPostingRule(ctx context.Context, id uuid.UUID) (*models.PostingRule, error) {
+	rule, err := s.repo.GetPostingRule(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrPostingRuleNotFound
+		}
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (s *ledgerService) ListPostingRules(ctx context.Context, companyID uuid.UUID) ([]*models.PostingRule, error) {
+	return s.repo.ListPostingRules(ctx, companyID)
+}
+
+// Journal entries
+
+// CreateJournalEntry posts a manual entry
+func (s *ledgerService) CreateJournalEntry(ctx context.Context, req CreateJournalEntryRequest) (*models.JournalEntry, error) {
+	if req.EntryDate.IsZero() {
+		req.EntryDate = time.Now()
+	}
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if currency == "" {
+		currency = ledgerBaseCurrency
+	}
+
+	lines := make([]ledger.Line, len(req.Lines))
+	accounts := make([]*models.GLAccount, len(req.Lines))
+	for i, input := range req.Lines {
+		account, err := s.GetAccount(ctx, input.AccountID)
+		if err != nil {
+			return nil, err
+		}
+		if account.CompanyID != req.CompanyID {
+			return nil, ErrGLAccountNotFound
+		}
+		if !account.IsActive {
+			return nil, fmt.Errorf("%w: account %s is inactive", ErrInvalidGLAccount, account.Code)
+		}
+		accounts[i] = account
+		lines[i] = ledger.Line{Debit: input.Debit, Credit: input.Credit, Memo: input.Memo}
+	}
+	if err := ledger.Validate(lines); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnbalancedEntry, err)
+	}
+
+	period, err := s.openPeriod(ctx, req.CompanyID, req.EntryDate)
+	if err != nil {
+		return nil, err
+	}
+
+	rate, err := s.rateFor(req.CompanyID, currency, req.ExchangeRate, req.EntryDate)
+	if err != nil {
+		return nil, err
+	}
+	converted := ledger.Convert(lines, rate)
+
+	entry := &models.JournalEntry{
+		CompanyID:    req.CompanyID,
+		EntryDate:    req.EntryDate,
+		Event:        ledger.EventManual,
+		SourceType:   "manual",
+		Description:  req.Description,
+		Currency:     currency,
+		ExchangeRate: rate,
+		Status:       journalEntryPosted,
+		CreatedBy:    req.UserID,
+	}
+	if period != nil {
+		entry.PeriodID = &period.ID
+	}
+	for i, line := range converted {
+		entry.Lines = append(entry.Lines, models.JournalLine{
+			CompanyID:      req.CompanyID,
+			AccountID:      accounts[i].ID,
+			LineNo:         i + 1,
+			Role:           accounts[i].Role,
+			Debit:          line.Debit,
+			Credit:         line.Credit,
+			AmountCurrency: ledger.Round(lines[i].Amount()),
+			PartnerType:    req.Lines[i].PartnerType,
+			PartnerID:      req.Lines[i].PartnerID,
+			Memo:           line.Memo,
+		})
+	}
+
+	if err := s.createEntry(ctx, entry); err != nil {
+		return nil, err
+	}
+	return s.GetJournalEntry(ctx, entry.ID)
+}
+
+func (s *ledgerService) GetJournalEntry(ctx context.Context, id uuid.UUID) (*models.JournalEntry, error) {
+	entry, err := s.repo.GetEntry(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrJournalEntryNotFound
+		}
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (s *ledgerService) ListJournalEntries(ctx context.Context, companyID uuid.UUID, params map[string]interface{}) ([]*models.JournalEntry, int64, error) {
+	return s.repo.ListEntries(ctx, companyID, params)
+}
+
+// ReverseJournalEntry posts the mirror image of an entry and marks the
+// original reversed
+func (s *ledgerService) ReverseJournalEntry(ctx context.Context, req ReverseJournalEntryRequest) (*models.JournalEntry, error) {
+	original, err := s.GetJournalEntry(ctx, req.EntryID)
+	if err != nil {
+		return nil, err
+	}
+	if original.Status != journalEntryPosted {
+		return nil, ErrEntryAlreadyReversed
+	}
+
+	date := time.Now()
+	if req.EntryDate != nil {
+		date = *req.EntryDate
+	}
+	period, err := s.openPeriod(ctx, original.CompanyID, date)
+	if err != nil {
+		return nil, err
+	}
+
+	description := fmt.Sprintf("Reversal of %s", original.EntryNo)
+	if req.Reason != "" {
+		description = fmt.Sprintf("%s: %s", description, req.Reason)
+	}
+	reversal := &models.JournalEntry{
+		CompanyID:    original.CompanyID,
+		EntryDate:    date,
+		Event:        ledger.EventReversal,
+		SourceType:   "journal_entry",
+		SourceID:     &original.ID,
+		SourceNo:     original.EntryNo,
+		Description:  description,
+		Currency:     original.Currency,
+		ExchangeRate: original.ExchangeRate,
+		Status:       journalEntryPosted,
+		ReversalOfID: &original.ID,
+		CreatedBy:    req.UserID,
+	}
+	if period != nil {
+		reversal.PeriodID = &period.ID
+	}
+	for _, line := range original.Lines {
+		reversal.Lines = append(reversal.Lines, models.JournalLine{
+			CompanyID:      line.CompanyID,
+			AccountID:      line.AccountID,
+			LineNo:         line.LineNo,
+			Role:           line.Role,
+			Debit:          line.Credit,
+			Credit:         line.Debit,
+			AmountCurrency: -line.AmountCurrency,
+			PartnerType:    line.PartnerType,
+			PartnerID:      line.PartnerID,
+			Memo:           line.Memo,
+		})
+	}
+
+	entryNo, err := s.nextEntryNo(ctx, reversal.CompanyID, reversal.EntryDate)
+	if err != nil {
+		return nil, err
+	}
+	reversal.EntryNo = entryNo
+	reversal.TotalDebit, reversal.TotalCredit = original.TotalCredit, original.TotalDebit
+
+	if err := s.repo.ReverseEntry(ctx, original, reversal); err != nil {
+		return nil, err
+	}
+	return s.GetJournalEntry(ctx, reversal.ID)
+}
+
+// EnsurePeriodOpen fails with ErrPeriodClosed when the financial period
+// covering date is closed or locked. Dates outside any defined period are
+// open.
+func (s *ledgerService) EnsurePeriodOpen(ctx context.Context, companyID uuid.UUID, date time.Time) error {
+	_, err := s.openPeriod(ctx, companyID, date)
+	return err
+}
+
+func (s *ledgerService) openPeriod(ctx context.Context, companyID uuid.UUID, date time.Time) (*models.FinancialPeriod, error) {
+	period, err := s.repo.FindPeriodForDate(ctx, companyID, date)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if period.Status != "open" {
+		return nil, fmt.Errorf("%w: %s is %s", ErrPeriodClosed, period.Name, period.Status)
+	}
+	return period, nil
+}
+
+// Posting from business events
+
+// PostInvoice books an issued invoice. Sales documents post to receivables
+// and revenue, purchase documents to payables; credit notes post the reverse.
+func (s *ledgerService) PostInvoice(ctx context.Context, invoice *models.Invoice) (*models.JournalEntry, error) {
+	net := invoice.SubTotal - invoice.DiscountAmount
+	purchase := isPurchaseInvoice(invoice)
+
+	req := postingRequest{
+		companyID:   invoice.CompanyID,
+		userID:      invoice.CreatedBy,
+		date:        invoice.IssueDate,
+		sourceType:  "invoice",
+		sourceID:    invoice.ID,
+		sourceNo:    invoice.InvoiceNo,
+		description: fmt.Sprintf("Invoice %s", invoice.InvoiceNo),
+		currency:    invoice.Currency,
+		rate:        invoice.ExchangeRate,
+	}
+	if purchase {
+		req.partnerType, req.partnerID = "supplier", invoice.SupplierID
+		req.event, req.lines = ledger.EventPurchaseInvoice, ledger.PurchaseInvoice(net, invoice.TaxAmount)
+		if invoice.Type == "credit_note" {
+			req.event, req.lines = ledger.EventPurchaseCreditNote, ledger.Reverse(req.lines)
+		}
+	} else {
+		req.partnerType, req.partnerID = "customer", invoice.CustomerID
+		req.event, req.lines = ledger.EventSalesInvoice, ledger.SalesInvoice(net, invoice.TaxAmount)
+		if invoice.Type == "credit_note" {
+			req.event, req.lines = ledger.EventSalesCreditNote, ledger.Reverse(req.lines)
+		}
+	}
+	return s.post(ctx, req)
+}
+
+// isPurchaseInvoice reports whether an invoice is owed to a supplier
+func isPurchaseInvoice(invoice *models.Invoice) bool {
+	return invoice.Type == "purchase" || (invoice.Type != "sales" && invoice.SupplierID != nil && invoice.CustomerID == nil)
+}
+
+// invoiceEvent returns the posting event of an invoice
+func invoiceEvent(invoice *models.Invoice) string {
+	switch {
+	case isPurchaseInvoice(invoice) && invoice.Type == "credit_note":
+		return ledger.EventPurchaseCreditNote
+	case isPurchaseInvoice(invoice):
+		return ledger.EventPurchaseInvoice
+	case invoice.Type == "credit_note":
+		return ledger.EventSalesCreditNote
+	}
+	return ledger.EventSalesInvoice
+}
+
+// PostPayment books a completed payment against receivables or payables.
+// The payment method is matched against posting rules so cash and bank
+// payments can post to different accounts. A foreign payment of an invoice
+// booked at another rate also posts the realized exchange difference.
+func (s *ledgerService) PostPayment(ctx context.Context, payment *models.Payment) (*models.JournalEntry, error) {
+	req := postingRequest{
+		companyID:   payment.CompanyID,
+		userID:      payment.CreatedBy,
+		date:        payment.PaymentDate,
+		match:       payment.PaymentMethod,
+		sourceType:  "payment",
+		sourceID:    payment.ID,
+		sourceNo:    payment.PaymentNo,
+		description: fmt.Sprintf("Payment %s", payment.PaymentNo),
+		currency:    payment.Currency,
+		rate:        payment.ExchangeRate,
+	}
+	if payment.Type == "outgoing" {
+		req.partnerType, req.partnerID = "supplier", payment.SupplierID
+		req.event, req.lines = ledger.EventPaymentMade, ledger.PaymentMade(payment.Amount)
+	} else {
+		req.partnerType, req.partnerID = "customer", payment.CustomerID
+		req.event, req.lines = ledger.EventPaymentReceived, ledger.PaymentReceived(payment.Amount)
+	}
+	entry, err := s.post(ctx, req)
+	if err != nil || entry == nil {
+		return entry, err
+	}
+	if err := s.postRealizedFX(ctx, payment, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// postRealizedFX clears the difference the payment entry left on the
+// receivable or payable: the invoice was booked at its rate and the payment
+// at the payment's. The difference is posted once, as its own entry in the
+// base currency, and recorded for the realized exchange report.
+func (s *ledgerService) postRealizedFX(ctx context.Context, payment *models.Payment, entry *models.JournalEntry) error {
+	if payment.InvoiceID == nil || entry.Currency == ledgerBaseCurrency {
+		return nil
+	}
+	kind, role, event := fx.Receivable, ledger.RoleReceivable, ledger.EventSalesInvoice
+	if payment.Type == "outgoing" {
+		kind, role, event = fx.Payable, ledger.RolePayable, ledger.EventPurchaseInvoice
+	}
+
+	invoiceEntry, err := s.repo.FindEntryBySource(ctx, payment.CompanyID, "invoice", *payment.InvoiceID, event)
+	if err != nil {
+		// Invoices booked before the ledger have no rate to compare with
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if invoiceEntry.Currency != entry.Currency {
+		return nil
+	}
+	if _, err := s.repo.FindEntryBySource(ctx, payment.CompanyID, "payment", payment.ID, ledger.EventFXRealized); err == nil {
+		return nil
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+
+	gain, err := fx.Realized(kind, payment.Amount, invoiceEntry.ExchangeRate, entry.ExchangeRate)
+	if err != nil || gain == 0 {
+		return nil
+	}
+	partnerType, partnerID := "customer", payment.CustomerID
+	if payment.Type == "outgoing" {
+		partnerType, partnerID = "supplier", payment.SupplierID
+	}
+	fxEntry, err := s.post(ctx, postingRequest{
+		companyID:   payment.CompanyID,
+		userID:      payment.CreatedBy,
+		date:        entry.EntryDate,
+		event:       ledger.EventFXRealized,
+		sourceType:  "payment",
+		sourceID:    payment.ID,
+		sourceNo:    payment.PaymentNo,
+		description: fmt.Sprintf("Exchange difference on payment %s: %s %.2f booked at %g, settled at %g", payment.PaymentNo, entry.Currency, payment.Amount, invoiceEntry.ExchangeRate, entry.ExchangeRate),
+		currency:    ledgerBaseCurrency,
+		partnerType: partnerType,
+		partnerID:   partnerID,
+		lines:       ledger.RealizedFX(role, gain),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.repo.CreateRealization(ctx, &models.FXRealization{
+		CompanyID:      payment.CompanyID,
+		PaymentID:      payment.ID,
+		PaymentNo:      payment.PaymentNo,
+		InvoiceID:      *payment.InvoiceID,
+		Kind:           kind,
+		PaymentDate:    entry.EntryDate,
+		Currency:       entry.Currency,
+		Amount:         payment.Amount,
+		BookedRate:     invoiceEntry.ExchangeRate,
+		SettlementRate: entry.ExchangeRate,
+		Gain:           gain,
+		EntryID:        &fxEntry.ID,
+	})
+}
+
+// PostExpense books an approved expense on the approval date. Expenses of a
+// supplier are owed on accounts payable, others on accrued expenses; the
+// category is matched against posting rules to pick the expense account.
+func (s *ledgerService) PostExpense(ctx context.Context, expense *models.Expense) (*models.JournalEntry, error) {
+	date := time.Now()
+	if expense.ApprovedAt != nil {
+		date = *expense.ApprovedAt
+	}
+	payable := ledger.RoleAccruedExpenses
+	if expense.SupplierID != nil {
+		payable = ledger.RolePayable
+	}
+	userID := expense.SubmittedBy
+	if expense.ApprovedBy != nil {
+		userID = *expense.ApprovedBy
+	}
+
+	return s.post(ctx, postingRequest{
+		companyID:   expense.CompanyID,
+		userID:      userID,
+		date:        date,
+		event:       ledger.EventExpenseApproved,
+		match:       expense.Category,
+		sourceType:  "expense",
+		sourceID:    expense.ID,
+		sourceNo:    expense.ExpenseNo,
+		description: fmt.Sprintf("Expense %s: %s", expense.ExpenseNo, expense.Description),
+		currency:    expense.Currency,
+		partnerType: "supplier",
+		partnerID:   expense.SupplierID,
+		lines:       ledger.ExpenseApproved(expense.Amount, expense.TaxAmount, payable),
+	})
+}
+
+// PostStockMovement books the value of a stock movement at standard cost.
+// The movement reason is matched against posting rules.
+func (s *ledgerService) PostStockMovement(ctx context.Context, movement *models.StockMovement, inventory *models.Inventory) (*models.JournalEntry, error) {
+	value := movement.TotalCost
+	if value == 0 {
+		value = movement.Quantity * movement.UnitCost
+	}
+	direction := movement.MovementType
+	if direction != ledger.DirectionIn && direction != ledger.DirectionOut {
+		direction = ledger.DirectionIn
+		if movement.Quantity < 0 {
+			direction = ledger.DirectionOut
+		}
+	}
+	date := movement.CreatedAt
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	return s.post(ctx, postingRequest{
+		companyID:   movement.CompanyID,
+		userID:      movement.CreatedBy,
+		date:        date,
+		event:       ledger.EventStockMovement,
+		match:       movement.Reason,
+		sourceType:  "stock_movement",
+		sourceID:    movement.ID,
+		sourceNo:    inventory.SKU,
+		description: fmt.Sprintf("Stock %s %s: %s", direction, movement.Reason, inventory.SKU),
+		currency:    ledgerBaseCurrency,
+		lines:       ledger.StockMovement(direction, movement.Reason, ledger.InventoryRole(inventory.Category), value),
+	})
+}
+
+// PostProductionCompletion moves the cost of a completed production order
+// from work in process to inventory. The actual cost is used when it has
+// been recorded, otherwise the qualified quantity at standard cost.
+func (s *ledgerService) PostProductionCompletion(ctx context.Context, order *models.ProductionOrder, inventory *models.Inventory, userID uuid.UUID) (*models.JournalEntry, error) {
+	value := order.ActualCost
+	if value <= 0 {
+		value = order.QualifiedQuantity * inventory.StandardCost
+	}
+	date := time.Now()
+	if order.ActualEndDate != nil {
+		date = *order.ActualEndDate
+	}
+
+	return s.post(ctx, postingRequest{
+		companyID:   order.CompanyID,
+		userID:      userID,
+		date:        date,
+		event:       ledger.EventProductionCompleted,
+		match:       inventory.Category,
+		sourceType:  "production_order",
+		sourceID:    order.ID,
+		sourceNo:    order.OrderNo,
+		description: fmt.Sprintf("Production order %s completed", order.OrderNo),
+		currency:    ledgerBaseCurrency,
+		lines:       ledger.ProductionCompleted(ledger.InventoryRole(inventory.Category), value),
+	})
+}
+
+// PostBankCharge books a fee the bank deducted, as allocated on a statement
+// line, on the line's booking date
+func (s *ledgerService) PostBankCharge(ctx context.Context, reconciliation *models.BankReconciliation, line *models.BankStatementLine) (*models.JournalEntry, error) {
+	return s.post(ctx, postingRequest{
+		companyID:   reconciliation.CompanyID,
+		userID:      reconciliation.CreatedBy,
+		date:        line.BookingDate,
+		event:       ledger.EventBankCharge,
+		sourceType:  "bank_reconciliation",
+		sourceID:    reconciliation.ID,
+		sourceNo:    line.BankReference,
+		description: fmt.Sprintf("Bank charge: %s", line.Description),
+		currency:    line.Currency,
+		lines:       ledger.BankCharge(reconciliation.Amount),
+	})
+}
+
+// PostFXRevaluation books the net revaluation of receivables and payables
+// on the revaluation date. Reversing it at the start of the next period is
+// left to the caller.
+func (s *ledgerService) PostFXRevaluation(ctx context.Context, revaluation *models.FXRevaluation) (*models.JournalEntry, error) {
+	var receivable, payable float64
+	for _, line := range revaluation.Lines {
+		if line.Kind == fx.Payable {
+			payable += line.Gain
+		} else {
+			receivable += line.Gain
+		}
+	}
+
+	return s.post(ctx, postingRequest{
+		companyID:   revaluation.CompanyID,
+		userID:      revaluation.CreatedBy,
+		date:        revaluation.RevaluationDate,
+		event:       ledger.EventFXRevaluation,
+		sourceType:  "fx_revaluation",
+		sourceID:    revaluation.ID,
+		sourceNo:    revaluation.RevaluationDate.Format("2006-01-02"),
+		description: fmt.Sprintf("Foreign currency revaluation at %s", revaluation.RevaluationDate.Format("2006-01-02")),
+		currency:    ledgerBaseCurrency,
+		lines:       ledger.Revaluation(fx.Round(receivable), fx.Round(payable)),
+	})
+}
+
+// post resolves the roles of a business event to accounts and stores the
+// entry. Events are posted once; posting an event again returns the existing
+// entry. Events without value produce no entry and return nil.
+func (s *ledgerService) post(ctx context.Context, req postingRequest) (*models.JournalEntry, error) {
+	if len(req.lines) == 0 {
+		return nil, nil
+	}
+	if err := ledger.Validate(req.lines); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnbalancedEntry, err)
+	}
+
+	existing, err := s.repo.FindEntryBySource(ctx, req.companyID, req.sourceType, req.sourceID, req.event)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	if req.date.IsZero() {
+		req.date = time.Now()
+	}
+	period, err := s.openPeriod(ctx, req.companyID, req.date)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureChart(ctx, req.companyID); err != nil {
+		return nil, err
+	}
+	rules, err := s.repo.ListPostingRules(ctx, req.companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(req.currency))
+	if currency == "" {
+		currency = ledgerBaseCurrency
+	}
+	rate, err := s.rateFor(req.companyID, currency, req.rate, req.date)
+	if err != nil {
+		return nil, err
+	}
+	converted := ledger.Convert(req.lines, rate)
+
+	entry := &models.JournalEntry{
+		CompanyID:    req.companyID,
+		EntryDate:    req.date,
+		Event:        req.event,
+		SourceType:   req.sourceType,
+		SourceID:     &req.sourceID,
+		SourceNo:     req.sourceNo,
+		Description:  req.description,
+		Currency:     currency,
+		ExchangeRate: rate,
+		Status:       journalEntryPosted,
+		CreatedBy:    req.userID,
+	}
+	if period != nil {
+		entry.PeriodID = &period.ID
+	}
+
+	accounts := map[string]*models.GLAccount{}
+	for i, line := range converted {
+		account, ok := accounts[line.Role]
+		if !ok {
+			account, err = s.resolveAccount(ctx, req.companyID, req.event, req.match, line.Role, rules)
+			if err != nil {
+				return nil, err
+			}
+			accounts[line.Role] = account
+		}
+
+		journalLine := models.JournalLine{
+			CompanyID:      req.companyID,
+			AccountID:      account.ID,
+			LineNo:         i + 1,
+			Role:           line.Role,
+			Debit:          line.Debit,
+			Credit:         line.Credit,
+			AmountCurrency: ledger.Round(req.lines[i].Amount()),
+			Memo:           line.Memo,
+		}
+		if line.Role == ledger.RoleReceivable || line.Role == ledger.RolePayable {
+			journalLine.PartnerType = req.partnerType
+			journalLine.PartnerID = req.partnerID
+		}
+		entry.Lines = append(entry.Lines, journalLine)
+	}
+
+	if err := s.createEntry(ctx, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// createEntry numbers, totals and stores an entry whose lines are already in
+// the base currency
+func (s *ledgerService) createEntry(ctx context.Context, entry *models.JournalEntry) error {
+	var debit, credit float64
+	for _, line := range entry.Lines {
+		debit += line.Debit
+		credit += line.Credit
+	}
+	entry.TotalDebit, entry.TotalCredit = ledger.Round(debit), ledger.Round(credit)
+	if entry.TotalDebit != entry.TotalCredit {
+		return ErrUnbalancedEntry
+	}
+
+	entryNo, err := s.nextEntryNo(ctx, entry.CompanyID, entry.EntryDate)
+	if err != nil {
+		return err
+	}
+	entry.EntryNo = entryNo
+	return s.repo.CreateEntry(ctx, entry)
+}
+
+// resolveAccount picks the account for a posting role. The most specific
+// active posting rule wins: event and match, then event only, then rules for
+// every event. Without a rule the account carrying the role is used.
+func (s *ledgerService) resolveAccount(ctx context.Context, companyID uuid.UUID, event, match, role string, rules []*models.PostingRule) (*models.GLAccount, error) {
+	var best *models.PostingRule
+	bestScore := -1
+	for _, rule := range rules {
+		if !rule.IsActive || rule.Role != role {
+			continue
+		}
+		if rule.Event != "" && rule.Event != event {
+			continue
+		}
+		if rule.Match != "" && !strings.EqualFold(rule.Match, match) {
+			continue
+		}
+		score := 0
+		if rule.Event != "" {
+			score += 2
+		}
+		if rule.Match != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = rule, score
+		}
+	}
+
+	if best != nil {
+		account, err := s.repo.GetAccount(ctx, best.AccountID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+		if account != nil && account.IsActive {
+			return account, nil
+		}
+	}
+
+	account, err := s.repo.FindAccountByRole(ctx, companyID, role)
+	// Charts seeded before a role existed post it on its fallback role
+	for fallback := role; errors.Is(err, repository.ErrNotFound); {
+		next, ok := ledger.FallbackRoles[fallback]
+		if !ok {
+			break
+		}
+		fallback = next
+		account, err = s.repo.FindAccountByRole(ctx, companyID, fallback)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrPostingAccountMissing, role)
+		}
+		return nil, err
+	}
+	return account, nil
+}
+
+// rateFor returns the rate converting currency into the base currency: the
+// document's own rate when it has one, otherwise the stored rate effective on
+// date. Without either it fails with ErrExchangeRateMissing rather than
+// booking the document at face value.
+func (s *ledgerService) rateFor(companyID uuid.UUID, currency string, rate float64, date time.Time) (float64, error) {
+	if currency == ledgerBaseCurrency {
+		return 1, nil
+	}
+	if rate > 0 {
+		return rate, nil
+	}
+	return s.storedRate(companyID, currency, date)
+}
+
+// DocumentRate returns the rate a document in currency is booked at: its
+// own rate when positive, otherwise the stored rate effective on date.
+// Documents without a rate take it from here before they are stored.
+func (s *ledgerService) DocumentRate(ctx context.Context, companyID uuid.UUID, currency string, rate float64, date time.Time) (float64, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		currency = ledgerBaseCurrency
+	}
+	return s.rateFor(companyID, currency, rate, date)
+}
+
+// BaseRate returns the stored rate converting currency into the base
+// currency effective on date. Rates stored the other way round are
+// inverted.
+func (s *ledgerService) BaseRate(ctx context.Context, companyID uuid.UUID, currency string, date time.Time) (float64, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" || currency == ledgerBaseCurrency {
+		return 1, nil
+	}
+	return s.storedRate(companyID, currency, date)
+}
+
+func (s *ledgerService) storedRate(companyID uuid.UUID, currency string, date time.Time) (float64, error) {
+	if s.exchangeRateRepo != nil {
+		rate, err := s.exchangeRateRepo.GetRateOn(currency, ledgerBaseCurrency, companyID.String(), date)
+		if err == nil && rate.Rate > 0 {
+			return rate.Rate, nil
+		}
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return 0, err
+		}
+		rate, err = s.exchangeRateRepo.GetRateOn(ledgerBaseCurrency, currency, companyID.String(), date)
+		if err == nil && rate.Rate > 0 {
+			return fx.Invert(rate.Rate), nil
+		}
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return 0, err
+		}
+	}
+	return 0, fmt.Errorf("%w: %s on %s", ErrExchangeRateMissing, currency, date.Format("2006-01-02"))
+}
+
+// BookedRate returns the rate an invoice was posted to the ledger at, or
+// the rate it would be posted at when it has not been
+func (s *ledgerService) BookedRate(ctx context.Context, invoice *models.Invoice) (float64, error) {
+	entry, err := s.repo.FindEntryBySource(ctx, invoice.CompanyID, "invoice", invoice.ID, invoiceEvent(invoice))
+	if err == nil && entry.ExchangeRate > 0 {
+		return entry.ExchangeRate, nil
+	}
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return 0, err
+	}
+	return s.DocumentRate(ctx, invoice.CompanyID, invoice.Currency, invoice.ExchangeRate, invoice.IssueDate)
+}
+
+// nextEntryNo numbers entries per company and month from a sequence, so
+// entries posted at the same time get different numbers
+func (s *ledgerService) nextEntryNo(ctx context.Context, companyID uuid.UUID, date time.Time) (string, error) {
+	prefix := fmt.Sprintf("JE-%s-", date.Format("200601"))
+	next, err := s.repo.NextEntryNumber(ctx, companyID, prefix)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%05d", prefix, next), nil
+}
+
+// Reports
+
+// GetTrialBalance reports opening balances, movements and closing balances
+// per account for the requested range
+func (s *ledgerService) GetTrialBalance(ctx context.Context, req LedgerReportRequest) (*TrialBalanceReport, error) {
+	accounts, err := s.repo.ListAccounts(ctx, req.CompanyID, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	opening, movements, err := s.accountTotals(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make([]ledger.AccountTotals, 0, len(accounts))
+	for _, account := range accounts {
+		totals = append(totals, ledger.AccountTotals{
+			ID:            account.ID.String(),
+			Code:          account.Code,
+			Name:          account.Name,
+			Type:          account.Type,
+			OpeningDebit:  opening[account.ID].Debit,
+			OpeningCredit: opening[account.ID].Credit,
+			Debit:         movements[account.ID].Debit,
+			Credit:        movements[account.ID].Credit,
+		})
+	}
+
+	return &TrialBalanceReport{
+		From:         req.From,
+		To:           req.To,
+		Currency:     ledgerBaseCurrency,
+		TrialBalance: ledger.BuildTrialBalance(totals),
+	}, nil
+}
+
+// GetGeneralLedgerDetail lists the posted lines per account with running
+// balances, for one account or for every account with activity
+func (s *ledgerService) GetGeneralLedgerDetail(ctx context.Context, req LedgerReportRequest) (*GLDetailReport, error) {
+	var accounts []*models.GLAccount
+	if req.AccountID != nil {
+		account, err := s.GetAccount(ctx, *req.AccountID)
+		if err != nil {
+			return nil, err
+		}
+		if account.CompanyID != req.CompanyID {
+			return nil, ErrGLAccountNotFound
+		}
+		accounts = []*models.GLAccount{account}
+	} else {
+		var err error
+		accounts, err = s.repo.ListAccounts(ctx, req.CompanyID, map[string]interface{}{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opening, _, err := s.accountTotals(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	end := req.To.AddDate(0, 0, 1)
+	lines, err := s.repo.ListLines(ctx, req.CompanyID, req.AccountID, req.From, &end)
+	if err != nil {
+		return nil, err
+	}
+
+	byAccount := map[uuid.UUID][]*models.JournalLine{}
+	for _, line := range lines {
+		byAccount[line.AccountID] = append(byAccount[line.AccountID], line)
+	}
+
+	report := &GLDetailReport{From: req.From, To: req.To, Currency: ledgerBaseCurrency, Accounts: []GLDetailAccount{}}
+	for _, account := range accounts {
+		open := opening[account.ID]
+		accountLines := byAccount[account.ID]
+		if open.Debit == 0 && open.Credit == 0 && len(accountLines) == 0 && req.AccountID == nil {
+			continue
+		}
+
+		detail := GLDetailAccount{
+			AccountID: account.ID,
+			Code:      account.Code,
+			Name:      account.Name,
+			Type:      account.Type,
+			Opening:   ledger.Signed(account.Type, open.Debit, open.Credit),
+			Lines:     []GLDetailLine{},
+		}
+		debit, credit := open.Debit, open.Credit
+		for _, line := range accountLines {
+			debit += line.Debit
+			credit += line.Credit
+			detail.Debit += line.Debit
+			detail.Credit += line.Credit
+
+			item := GLDetailLine{
+				EntryID:        line.EntryID,
+				Memo:           line.Memo,
+				Debit:          line.Debit,
+				Credit:         line.Credit,
+				Balance:        ledger.Signed(account.Type, debit, credit),
+				AmountCurrency: line.AmountCurrency,
+			}
+			if line.Entry != nil {
+				item.EntryNo = line.Entry.EntryNo
+				item.EntryDate = line.Entry.EntryDate
+				item.Event = line.Entry.Event
+				item.SourceType = line.Entry.SourceType
+				item.SourceNo = line.Entry.SourceNo
+				item.Description = line.Entry.Description
+				item.Currency = line.Entry.Currency
+			}
+			detail.Lines = append(detail.Lines, item)
+		}
+		detail.Debit = ledger.Round(detail.Debit)
+		detail.Credit = ledger.Round(detail.Credit)
+		detail.Closing = ledger.Signed(account.Type, debit, credit)
+		report.Accounts = append(report.Accounts, detail)
+	}
+	sort.Slice(report.Accounts, func(i, j int) bool { return report.Accounts[i].Code < report.Accounts[j].Code })
+
+	return report, nil
+}
+
+// accountTotals returns per-account totals before From and within the
+// report range
+func (s *ledgerService) accountTotals(ctx context.Context, req LedgerReportRequest) (opening, movements map[uuid.UUID]repository.LedgerAccountTotal, err error) {
+	end := req.To.AddDate(0, 0, 1)
+	opening = map[uuid.UUID]repository.LedgerAccountTotal{}
+	movements = map[uuid.UUID]repository.LedgerAccountTotal{}
+
+	if req.From != nil {
+		before, err := s.repo.SumAccountLines(ctx, req.CompanyID, nil, req.From)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, t := range before {
+			opening[t.AccountID] = t
+		}
+	}
+
+	within, err := s.repo.SumAccountLines(ctx, req.CompanyID, req.From, &end)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, t := range within {
+		movements[t.AccountID] = t
+	}
+	return opening, movements, nil
+}
@@ -0,0 +1,611 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/loadplan"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+var (
+	// ErrLoadPlanNotFound is returned when a load plan is not found
+	ErrLoadPlanNotFound = errors.New("load plan not found")
+	// ErrLoadPlanMissingData is returned when lines lack carton data in the shipment and product master
+	ErrLoadPlanMissingData = errors.New("missing packaging data for load planning")
+	// ErrLoadPlanNotDraft is returned when applying a plan that was already applied or superseded
+	ErrLoadPlanNotDraft = errors.New("load plan is not a draft")
+	// ErrLoadPlanStale is returned when the shipment lines changed after the plan was made
+	ErrLoadPlanStale = errors.New("shipment lines changed since the load plan was made")
+	// ErrUnknownContainerType is returned for container codes other than 20ft, 40ft and 40hc
+	ErrUnknownContainerType = errors.New("unknown container type")
+	// ErrFreightRateNotFound is returned when a freight rate is not found
+	ErrFreightRateNotFound = errors.New("freight rate not found")
+	// ErrInvalidFreightRate is returned when a freight rate lacks its lane, type or rate
+	ErrInvalidFreightRate = errors.New("invalid freight rate")
+)
+
+// freightLCL is the container type of less-than-container-load rates
+const freightLCL = "lcl"
+
+// LoadPlanService plans pallets and containers for shipments and estimates freight
+type LoadPlanService interface {
+	// Planning
+	PlanShipment(ctx context.Context, req PlanShipmentRequest) (*models.LoadPlan, error)
+	PlanProducts(ctx context.Context, req PlanProductsRequest) (*LoadPlanPreview, error)
+	GetLoadPlan(ctx context.Context, id uuid.UUID) (*models.LoadPlan, error)
+	ListLoadPlans(ctx context.Context, shipmentID uuid.UUID) ([]*models.LoadPlan, error)
+	ApplyLoadPlan(ctx context.Context, id, userID uuid.UUID) (*models.LoadPlan, error)
+
+	// Freight rates
+	CreateFreightRate(ctx context.Context, rate *models.FreightRate) error
+	GetFreightRate(ctx context.Context, id uuid.UUID) (*models.FreightRate, error)
+	UpdateFreightRate(ctx context.Context, rate *models.FreightRate) error
+	DeleteFreightRate(ctx context.Context, id uuid.UUID) error
+	ListFreightRates(ctx context.Context, params map[string]interface{}) ([]*models.FreightRate, error)
+}
+
+// LoadPlanOptions controls how a load is planned
+type LoadPlanOptions struct {
+	ContainerTypes []string           `json:"container_types"` // defaults to 20ft and 40ft
+	Loose          bool               `json:"loose"`           // floor-load cartons instead of palletizing
+	MaxPayload     map[string]float64 `json:"max_payload"`     // payload overrides in kg, e.g. road limits at destination
+}
+
+// PlanShipmentRequest plans the lines of a shipment
+type PlanShipmentRequest struct {
+	ShipmentID uuid.UUID
+	Options    LoadPlanOptions
+	UserID     uuid.UUID
+}
+
+// PlanProductsRequest plans products that are not on a shipment yet, e.g. for a quote
+type PlanProductsRequest struct {
+	CompanyID   uuid.UUID          `json:"-"`
+	Lines       []PlanProductsLine `json:"lines"`
+	Method      string             `json:"method"`
+	OriginPort  string             `json:"origin_port"`
+	DestPort    string             `json:"dest_port"`
+	CarrierName string             `json:"carrier_name"`
+	Options     LoadPlanOptions    `json:"options"`
+}
+
+// PlanProductsLine is a product quantity to plan
+type PlanProductsLine struct {
+	ProductID uuid.UUID `json:"product_id"`
+	Quantity  float64   `json:"quantity"`
+}
+
+// LoadPlanPreview is an unsaved plan with its freight estimate
+type LoadPlanPreview struct {
+	Plan    *loadplan.Plan   `json:"plan"`
+	Freight *FreightEstimate `json:"freight,omitempty"`
+}
+
+// FreightEstimate prices a plan against the lane's freight rates
+type FreightEstimate struct {
+	Basis     string                `json:"basis"` // fcl or lcl, whichever is cheaper
+	Amount    float64               `json:"amount"`
+	Currency  string                `json:"currency"`
+	FCLAmount float64               `json:"fcl_amount,omitempty"`
+	LCLAmount float64               `json:"lcl_amount,omitempty"`
+	Lines     []FreightEstimateLine `json:"lines"`
+	Warnings  []string              `json:"warnings,omitempty"`
+}
+
+// FreightEstimateLine is one priced container type, or the LCL revenue tons
+type FreightEstimateLine struct {
+	ContainerType string  `json:"container_type"`
+	Quantity      float64 `json:"quantity"`
+	Rate          float64 `json:"rate"`
+	Amount        float64 `json:"amount"`
+}
+
+// loadPlanDetails is stored in LoadPlan.Details
+type loadPlanDetails struct {
+	Options LoadPlanOptions  `json:"options"`
+	Plan    *loadplan.Plan   `json:"plan"`
+	Freight *FreightEstimate `json:"freight,omitempty"`
+}
+
+type loadPlanService struct {
+	repo repository.LoadPlanRepository
+}
+
+// NewLoadPlanService creates a new load plan service
+func NewLoadPlanService(repo repository.LoadPlanRepository) LoadPlanService {
+	return &loadPlanService{repo: repo}
+}
+
+// Planning
+
+func (s *loadPlanService) PlanShipment(ctx context.Context, req PlanShipmentRequest) (*models.LoadPlan, error) {
+	shipment, err := s.repo.GetShipmentWithProducts(ctx, req.ShipmentID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrShipmentNotFound
+		}
+		return nil, err
+	}
+
+	items, _, err := shipmentLoadItems(shipment, req.Options.Loose)
+	if err != nil {
+		return nil, err
+	}
+	preview, err := s.plan(ctx, shipment.CompanyID, items, req.Options, shipment.Method, shipment.OriginPort, shipment.DestPort, shipment.CarrierName)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := json.Marshal(loadPlanDetails{Options: req.Options, Plan: preview.Plan, Freight: preview.Freight})
+	if err != nil {
+		return nil, err
+	}
+	plan := &models.LoadPlan{
+		CompanyID:      shipment.CompanyID,
+		ShipmentID:     shipment.ID,
+		Status:         "draft",
+		ContainerMix:   preview.Plan.MixString(),
+		ContainerCount: len(preview.Plan.Containers),
+		TEU:            preview.Plan.TEU,
+		PalletCount:    preview.Plan.TotalPallets,
+		CartonCount:    preview.Plan.TotalCartons,
+		GrossWeight:    roundTo(preview.Plan.TotalGrossWeight, 2),
+		NetWeight:      roundTo(preview.Plan.TotalNetWeight, 2),
+		Volume:         roundTo(preview.Plan.TotalVolume, 3),
+		Details:        datatypes.JSON(details),
+		CreatedBy:      req.UserID,
+	}
+	if preview.Freight != nil {
+		plan.FreightBasis = preview.Freight.Basis
+		plan.FreightEstimate = preview.Freight.Amount
+		plan.FreightCurrency = preview.Freight.Currency
+	}
+	if err := s.repo.CreateLoadPlan(ctx, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (s *loadPlanService) PlanProducts(ctx context.Context, req PlanProductsRequest) (*LoadPlanPreview, error) {
+	ids := make([]uuid.UUID, 0, len(req.Lines))
+	for _, line := range req.Lines {
+		ids = append(ids, line.ProductID)
+	}
+	products, err := s.repo.GetProducts(ctx, req.CompanyID, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]*models.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+
+	// Plan the products as if they were shipment lines without carton data
+	shipment := &models.Shipment{CompanyID: req.CompanyID}
+	for _, line := range req.Lines {
+		product, ok := byID[line.ProductID]
+		if !ok {
+			return nil, fmt.Errorf("%w: product %s not found", ErrLoadPlanMissingData, line.ProductID)
+		}
+		productID := product.ID
+		shipment.Items = append(shipment.Items, models.ShipmentItem{
+			ID:          productID,
+			ProductID:   &productID,
+			ProductName: product.ProductName,
+			Quantity:    line.Quantity,
+			Product:     product,
+		})
+	}
+
+	items, _, err := shipmentLoadItems(shipment, req.Options.Loose)
+	if err != nil {
+		return nil, err
+	}
+	return s.plan(ctx, req.CompanyID, items, req.Options, req.Method, req.OriginPort, req.DestPort, req.CarrierName)
+}
+
+// plan computes the load plan and prices it when the lane has freight rates.
+// With FCL rates for every container type the cheapest mix is chosen.
+func (s *loadPlanService) plan(ctx context.Context, companyID uuid.UUID, items []loadplan.Item, opts LoadPlanOptions, method, origin, dest, carrier string) (*LoadPlanPreview, error) {
+	containerTypes, err := resolveContainerTypes(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rates, currency, warnings, err := s.laneRates(ctx, companyID, method, origin, dest, carrier)
+	if err != nil {
+		return nil, err
+	}
+
+	planOpts := loadplan.Options{ContainerTypes: containerTypes}
+	if len(rates) > 0 {
+		planOpts.Cost = make(map[string]float64)
+		for _, ct := range containerTypes {
+			if rate, ok := rates[ct.Code]; ok {
+				planOpts.Cost[ct.Code] = rate.Rate
+			}
+		}
+	}
+
+	plan, err := loadplan.Compute(items, planOpts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLoadPlanMissingData, err)
+	}
+	preview := &LoadPlanPreview{Plan: plan}
+	if len(rates) > 0 {
+		preview.Freight = estimateFreight(plan, rates, currency)
+		preview.Freight.Warnings = append(warnings, preview.Freight.Warnings...)
+	}
+	return preview, nil
+}
+
+// laneRates picks one valid rate per container type for the lane, preferring
+// carrier specific rates over generic ones. Rates in another currency than the
+// first one picked are skipped.
+func (s *loadPlanService) laneRates(ctx context.Context, companyID uuid.UUID, method, origin, dest, carrier string) (map[string]*models.FreightRate, string, []string, error) {
+	if origin == "" || dest == "" {
+		return nil, "", nil, nil
+	}
+	if method == "" {
+		method = "sea"
+	}
+	found, err := s.repo.FindFreightRates(ctx, companyID, method, origin, dest, time.Now())
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	rates := make(map[string]*models.FreightRate)
+	for _, rate := range found {
+		if rate.CarrierName != "" && !strings.EqualFold(rate.CarrierName, carrier) {
+			continue
+		}
+		current, ok := rates[rate.ContainerType]
+		if !ok || (current.CarrierName == "" && rate.CarrierName != "") {
+			rates[rate.ContainerType] = rate
+		}
+	}
+
+	var currency string
+	var warnings []string
+	for code, rate := range rates {
+		if currency == "" {
+			currency = rate.Currency
+		}
+		if rate.Currency != currency {
+			warnings = append(warnings, fmt.Sprintf("%s rate in %s ignored; other rates are in %s", code, rate.Currency, currency))
+			delete(rates, code)
+		}
+	}
+	return rates, currency, warnings, nil
+}
+
+func estimateFreight(plan *loadplan.Plan, rates map[string]*models.FreightRate, currency string) *FreightEstimate {
+	estimate := &FreightEstimate{Currency: currency}
+
+	fclComplete := len(plan.Mix) > 0
+	var fclLines []FreightEstimateLine
+	for code, count := range plan.Mix {
+		rate, ok := rates[code]
+		if !ok {
+			fclComplete = false
+			estimate.Warnings = append(estimate.Warnings, fmt.Sprintf("no %s rate for this lane", code))
+			continue
+		}
+		amount := float64(count) * rate.Rate
+		fclLines = append(fclLines, FreightEstimateLine{ContainerType: code, Quantity: float64(count), Rate: rate.Rate, Amount: roundTo(amount, 2)})
+		estimate.FCLAmount += amount
+	}
+	if !fclComplete {
+		estimate.FCLAmount = 0
+	}
+
+	// LCL only makes sense for cargo that fits in a single container
+	var lclLine *FreightEstimateLine
+	if rate, ok := rates[freightLCL]; ok && len(plan.Containers) <= 1 {
+		revenueTons := math.Max(plan.TotalVolume, plan.TotalGrossWeight/1000)
+		amount := math.Max(revenueTons*rate.Rate, rate.MinCharge)
+		lclLine = &FreightEstimateLine{ContainerType: freightLCL, Quantity: roundTo(revenueTons, 3), Rate: rate.Rate, Amount: roundTo(amount, 2)}
+		estimate.LCLAmount = roundTo(amount, 2)
+	}
+
+	switch {
+	case lclLine != nil && (estimate.FCLAmount == 0 || estimate.LCLAmount < estimate.FCLAmount):
+		estimate.Basis = "lcl"
+		estimate.Amount = estimate.LCLAmount
+		estimate.Lines = []FreightEstimateLine{*lclLine}
+	case estimate.FCLAmount > 0:
+		estimate.Basis = "fcl"
+		estimate.Amount = roundTo(estimate.FCLAmount, 2)
+		estimate.Lines = fclLines
+	}
+	estimate.FCLAmount = roundTo(estimate.FCLAmount, 2)
+	return estimate
+}
+
+func resolveContainerTypes(opts LoadPlanOptions) ([]loadplan.ContainerType, error) {
+	codes := opts.ContainerTypes
+	if len(codes) == 0 {
+		codes = []string{"20ft", "40ft"}
+	}
+	known := make(map[string]loadplan.ContainerType)
+	for _, ct := range loadplan.DefaultContainerTypes() {
+		known[ct.Code] = ct
+	}
+
+	types := make([]loadplan.ContainerType, 0, len(codes))
+	for _, code := range codes {
+		ct, ok := known[strings.ToLower(code)]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownContainerType, code)
+		}
+		if payload, ok := opts.MaxPayload[ct.Code]; ok && payload > 0 && payload < ct.MaxPayload {
+			ct.MaxPayload = payload
+		}
+		types = append(types, ct)
+	}
+	return types, nil
+}
+
+// shipmentLoadItems builds the planning input from the shipment lines, taking
+// carton data from the line when present and from the product master otherwise.
+// It returns the carton data it resolved per line, keyed like the items.
+func shipmentLoadItems(shipment *models.Shipment, loose bool) ([]loadplan.Item, map[string]loadplan.Carton, error) {
+	items := make([]loadplan.Item, 0, len(shipment.Items))
+	cartons := make(map[string]loadplan.Carton, len(shipment.Items))
+	var missing []string
+
+	for _, line := range shipment.Items {
+		product := line.Product
+
+		perCarton := line.QuantityPerCarton
+		if perCarton == 0 && product != nil {
+			perCarton = product.QuantityPerCarton
+		}
+		count := line.CartonCount
+		if count == 0 && perCarton > 0 {
+			count = int(math.Ceil(line.Quantity / perCarton))
+		}
+
+		unitWeight := line.UnitWeight
+		if unitWeight == 0 && product != nil {
+			unitWeight = product.Weight
+		}
+		carton := loadplan.Carton{
+			GrossWeight: line.GrossWeightPerCarton,
+			NetWeight:   line.NetWeightPerCarton,
+		}
+		if carton.NetWeight == 0 {
+			carton.NetWeight = perCarton * unitWeight
+		}
+		if carton.GrossWeight == 0 && product != nil {
+			carton.GrossWeight = product.CartonGrossWeight
+		}
+		if carton.GrossWeight == 0 {
+			carton.GrossWeight = carton.NetWeight
+		}
+		if product != nil {
+			carton.Length = product.CartonLength
+			carton.Width = product.CartonWidth
+			carton.Height = product.CartonHeight
+		}
+
+		if count == 0 || carton.GrossWeight == 0 || carton.Length == 0 || carton.Width == 0 || carton.Height == 0 {
+			missing = append(missing, line.ProductName)
+			continue
+		}
+
+		item := loadplan.Item{
+			Key:         line.ID.String(),
+			Description: line.ProductName,
+			Cartons:     count,
+			Carton:      carton,
+		}
+		if !loose {
+			pallet := productPallet(product)
+			item.Pallet = &pallet
+		}
+		items = append(items, item)
+		cartons[item.Key] = carton
+	}
+
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("%w: %s", ErrLoadPlanMissingData, strings.Join(missing, ", "))
+	}
+	return items, cartons, nil
+}
+
+// productPallet returns the product's pallet spec on top of the standard pallet
+func productPallet(product *models.Product) loadplan.PalletSpec {
+	pallet := loadplan.DefaultPallet()
+	if product == nil {
+		return pallet
+	}
+	if product.PalletLength > 0 && product.PalletWidth > 0 {
+		pallet.Length = product.PalletLength
+		pallet.Width = product.PalletWidth
+	}
+	if product.PalletMaxHeight > 0 {
+		pallet.MaxHeight = product.PalletMaxHeight
+	}
+	if product.PalletTareWeight > 0 {
+		pallet.TareWeight = product.PalletTareWeight
+	}
+	if product.PalletMaxWeight > 0 {
+		pallet.MaxWeight = product.PalletMaxWeight
+	}
+	pallet.CartonsPerPallet = product.CartonsPerPallet
+	pallet.Stackable = product.PalletStackable
+	return pallet
+}
+
+func (s *loadPlanService) GetLoadPlan(ctx context.Context, id uuid.UUID) (*models.LoadPlan, error) {
+	plan, err := s.repo.GetLoadPlan(ctx, id)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrLoadPlanNotFound
+		}
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (s *loadPlanService) ListLoadPlans(ctx context.Context, shipmentID uuid.UUID) ([]*models.LoadPlan, error) {
+	return s.repo.ListLoadPlans(ctx, shipmentID)
+}
+
+// ApplyLoadPlan writes the plan's weights, volume, packages, container mix and
+// freight estimate to the shipment, where the packing list and freight cost
+// pick them up. Lines without carton data get it from the product master.
+func (s *loadPlanService) ApplyLoadPlan(ctx context.Context, id, userID uuid.UUID) (*models.LoadPlan, error) {
+	plan, err := s.GetLoadPlan(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Status != "draft" {
+		return nil, ErrLoadPlanNotDraft
+	}
+	var details loadPlanDetails
+	if err := json.Unmarshal(plan.Details, &details); err != nil {
+		return nil, err
+	}
+
+	shipment, err := s.repo.GetShipmentWithProducts(ctx, plan.ShipmentID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrShipmentNotFound
+		}
+		return nil, err
+	}
+	items, cartons, err := shipmentLoadItems(shipment, details.Options.Loose)
+	if err != nil {
+		return nil, err
+	}
+	total := 0
+	for _, item := range items {
+		total += item.Cartons
+	}
+	if total != plan.CartonCount || len(items) != len(shipment.Items) {
+		return nil, ErrLoadPlanStale
+	}
+
+	for i := range shipment.Items {
+		line := &shipment.Items[i]
+		carton := cartons[line.ID.String()]
+		if line.CartonCount == 0 {
+			line.CartonCount = items[i].Cartons
+		}
+		if line.QuantityPerCarton == 0 && line.Product != nil {
+			line.QuantityPerCarton = line.Product.QuantityPerCarton
+		}
+		if line.NetWeightPerCarton == 0 {
+			line.NetWeightPerCarton = carton.NetWeight
+		}
+		if line.GrossWeightPerCarton == 0 {
+			line.GrossWeightPerCarton = carton.GrossWeight
+		}
+	}
+
+	shipment.GrossWeight = plan.GrossWeight
+	shipment.NetWeight = plan.NetWeight
+	shipment.Volume = plan.Volume
+	if plan.PalletCount > 0 {
+		shipment.PackageCount = plan.PalletCount
+		shipment.PackageType = "pallet"
+	} else {
+		shipment.PackageCount = plan.CartonCount
+		shipment.PackageType = "carton"
+	}
+	shipment.ContainerType = plan.ContainerMix
+	if plan.FreightBasis == freightLCL {
+		shipment.ContainerType = "LCL"
+	}
+	if plan.FreightEstimate > 0 {
+		shipment.FreightCost = plan.FreightEstimate
+		shipment.FreightCurrency = plan.FreightCurrency
+	}
+
+	now := time.Now()
+	plan.Status = "applied"
+	plan.AppliedAt = &now
+	if err := s.repo.ApplyLoadPlan(ctx, plan, shipment); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Freight rates
+
+func (s *loadPlanService) CreateFreightRate(ctx context.Context, rate *models.FreightRate) error {
+	if err := validateFreightRate(rate); err != nil {
+		return err
+	}
+	return s.repo.CreateFreightRate(ctx, rate)
+}
+
+func (s *loadPlanService) GetFreightRate(ctx context.Context, id uuid.UUID) (*models.FreightRate, error) {
+	rate, err := s.repo.GetFreightRate(ctx, id)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrFreightRateNotFound
+		}
+		return nil, err
+	}
+	return rate, nil
+}
+
+func (s *loadPlanService) UpdateFreightRate(ctx context.Context, rate *models.FreightRate) error {
+	if err := validateFreightRate(rate); err != nil {
+		return err
+	}
+	return s.repo.UpdateFreightRate(ctx, rate)
+}
+
+func (s *loadPlanService) DeleteFreightRate(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteFreightRate(ctx, id)
+}
+
+func (s *loadPlanService) ListFreightRates(ctx context.Context, params map[string]interface{}) ([]*models.FreightRate, error) {
+	return s.repo.ListFreightRates(ctx, params)
+}
+
+func validateFreightRate(rate *models.FreightRate) error {
+	if rate.OriginPort == "" || rate.DestPort == "" {
+		return fmt.Errorf("%w: origin and destination ports are required", ErrInvalidFreightRate)
+	}
+	rate.ContainerType = strings.ToLower(rate.ContainerType)
+	if rate.ContainerType != freightLCL {
+		if _, err := resolveContainerTypes(LoadPlanOptions{ContainerTypes: []string{rate.ContainerType}}); err != nil {
+			return fmt.Errorf("%w: container type must be 20ft, 40ft, 40hc or lcl", ErrInvalidFreightRate)
+		}
+	}
+	if rate.Rate <= 0 {
+		return fmt.Errorf("%w: rate must be positive", ErrInvalidFreightRate)
+	}
+	if rate.ValidTo != nil && rate.ValidTo.Before(rate.ValidFrom) {
+		return fmt.Errorf("%w: valid_to is before valid_from", ErrInvalidFreightRate)
+	}
+	if rate.Method == "" {
+		rate.Method = "sea"
+	}
+	if rate.Currency == "" {
+		rate.Currency = "USD"
+	}
+	if rate.ValidFrom.IsZero() {
+		rate.ValidFrom = time.Now()
+	}
+	return nil
+}
+
+func roundTo(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,692 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNCRNotFound is returned when a nonconformance report is not found
+	ErrNCRNotFound = errors.New("nonconformance report not found")
+	// ErrContainmentNotFound is returned when a containment action is not
+	// found on the report
+	ErrContainmentNotFound = errors.New("containment action not found")
+	// ErrInvalidNCR is returned for an unknown source, severity,
+	// disposition, responsibility or root cause category, or a missing
+	// title or supplier
+	ErrInvalidNCR = errors.New("invalid nonconformance report")
+	// ErrNCRClosed is returned when changing a closed or cancelled report
+	ErrNCRClosed = errors.New("nonconformance report is closed")
+	// ErrNCRStepOrder is returned when completing an 8D discipline before
+	// the one preceding it
+	ErrNCRStepOrder = errors.New("the preceding 8D discipline must be completed first")
+	// ErrNCRStepIncomplete is returned when a discipline's prerequisites
+	// are missing, e.g. closing containment with open actions
+	ErrNCRStepIncomplete = errors.New("8D discipline prerequisites are not met")
+)
+
+// Supplier quality score deducted per supplier-caused NCR in an evaluation
+// period, by severity
+var ncrQualityPenalty = map[string]float64{
+	models.DefectClassCritical: 25,
+	models.DefectClassMajor:    10,
+	models.DefectClassMinor:    5,
+}
+
+// ncrEvaluationType is the supplier evaluation period NCRs are counted in
+const ncrEvaluationType = "monthly"
+
+// NCRStepRequest changes an 8D discipline; Complete marks it done
+type NCRStepRequest struct {
+	OwnerID  *uuid.UUID `json:"owner_id"`
+	DueDate  *time.Time `json:"due_date"`
+	Notes    *string    `json:"notes"`
+	Complete bool       `json:"complete"`
+}
+
+// NCRDispositionRequest decides what happens to the nonconforming material
+type NCRDispositionRequest struct {
+	Disposition string  `json:"disposition"`
+	Quantity    float64 `json:"quantity"`
+	Notes       string  `json:"notes"`
+}
+
+// NCRRootCauseRequest records the root cause found in D4 and who is
+// responsible; a supplier responsibility needs the supplier
+type NCRRootCauseRequest struct {
+	Responsibility string     `json:"responsibility"`
+	SupplierID     *uuid.UUID `json:"supplier_id"`
+	Category       string     `json:"category"`
+	RootCause      string     `json:"root_cause"`
+}
+
+// NCRVerificationRequest records the effectiveness check of the corrective
+// actions
+type NCRVerificationRequest struct {
+	Result string `json:"result"` // effective, not_effective
+	Notes  string `json:"notes"`
+}
+
+// NCRService runs nonconformance reports through disposition and the 8D
+// corrective action process. Reports caused by a supplier are counted in
+// the supplier's monthly evaluation quality score.
+type NCRService interface {
+	// Reports
+	Create(ctx context.Context, ncr *models.NonconformanceReport, userID uuid.UUID) error
+	OpenFromInspection(ctx context.Context, inspection *models.QualityInspection, userID uuid.UUID) (*models.NonconformanceReport, error)
+	Update(ctx context.Context, id uuid.UUID, ncr *models.NonconformanceReport) (*models.NonconformanceReport, error)
+	Get(ctx context.Context, id uuid.UUID) (*models.NonconformanceReport, error)
+	List(ctx context.Context, params map[string]interface{}) ([]*models.NonconformanceReport, int64, error)
+	Cancel(ctx context.Context, id uuid.UUID, reason string, userID uuid.UUID) (*models.NonconformanceReport, error)
+
+	// Workflow
+	UpdateStep(ctx context.Context, id uuid.UUID, discipline int, req NCRStepRequest, userID uuid.UUID) (*models.NonconformanceReport, error)
+	SetDisposition(ctx context.Context, id uuid.UUID, req NCRDispositionRequest, userID uuid.UUID) (*models.NonconformanceReport, error)
+	SetRootCause(ctx context.Context, id uuid.UUID, req NCRRootCauseRequest, userID uuid.UUID) (*models.NonconformanceReport, error)
+	VerifyEffectiveness(ctx context.Context, id uuid.UUID, req NCRVerificationRequest, userID uuid.UUID) (*models.NonconformanceReport, error)
+
+	// Containment
+	AddContainment(ctx context.Context, id uuid.UUID, containment *models.NCRContainment) (*models.NCRContainment, error)
+	UpdateContainment(ctx context.Context, id, containmentID uuid.UUID, containment *models.NCRContainment) (*models.NCRContainment, error)
+	ListContainmentsByLot(ctx context.Context, companyID uuid.UUID, lotNo string) ([]*models.NCRContainment, error)
+}
+
+type ncrService struct {
+	ncrRepo      repository.NCRRepository
+	supplierRepo repository.SupplierRepository
+	supplier     SupplierService
+}
+
+// NewNCRService creates a new NCR service
+func NewNCRService(ncrRepo repository.NCRRepository, supplierRepo repository.SupplierRepository, supplier SupplierService) NCRService {
+	return &ncrService{
+		ncrRepo:      ncrRepo,
+		supplierRepo: supplierRepo,
+		supplier:     supplier,
+	}
+}
+
+// Reports
+
+// Create opens a report with its eight disciplines, D1 owned by the
+// reporter
+func (s *ncrService) Create(ctx context.Context, ncr *models.NonconformanceReport, userID uuid.UUID) error {
+	ncr.Title = strings.TrimSpace(ncr.Title)
+	if ncr.Source == "" {
+		ncr.Source = models.NCRSourceInternal
+	}
+	if ncr.Severity == "" {
+		ncr.Severity = models.DefectClassMajor
+	}
+	if err := validateNCR(ncr); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	ncr.NCRNo = fmt.Sprintf("NCR-%s-%06d", now.Format("200601"), now.UnixMicro()%1000000)
+	ncr.Status = models.NCRStatusOpen
+	ncr.ReportedBy = userID
+	if ncr.ReportedAt.IsZero() {
+		ncr.ReportedAt = now
+	}
+	ncr.Disposition, ncr.DispositionBy, ncr.DispositionAt = "", nil, nil
+	ncr.Effectiveness, ncr.VerifiedBy, ncr.VerifiedAt = "", nil, nil
+	ncr.ClosedBy, ncr.ClosedAt = nil, nil
+	ncr.Containments = nil
+	ncr.Steps = make([]models.NCRStep, 0, models.D8Closure)
+	for d := models.D1Team; d <= models.D8Closure; d++ {
+		step := models.NCRStep{Discipline: d, Title: models.EightDTitles[d], Status: "open"}
+		if d == models.D1Team {
+			step.OwnerID = &userID
+		}
+		ncr.Steps = append(ncr.Steps, step)
+	}
+
+	if err := s.ncrRepo.Create(ctx, ncr); err != nil {
+		return err
+	}
+	s.feedSupplierQuality(ctx, ncr, nil, userID)
+	return nil
+}
+
+// OpenFromInspection opens a report for a rejected inspection, or returns
+// the one already open. Rejected incoming material of a supplier is taken
+// as supplier-caused until the root cause says otherwise.
+func (s *ncrService) OpenFromInspection(ctx context.Context, inspection *models.QualityInspection, userID uuid.UUID) (*models.NonconformanceReport, error) {
+	existing, err := s.ncrRepo.FindByInspection(ctx, inspection.ID)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	ncr := &models.NonconformanceReport{
+		CompanyID:         inspection.CompanyID,
+		Source:            models.NCRSourceInspection,
+		Severity:          models.DefectClassMajor,
+		Title:             fmt.Sprintf("Inspection %s rejected", inspection.InspectionNo),
+		Description:       strings.TrimSpace(strings.Join([]string{inspection.CorrectiveAction, inspection.InspectionNotes}, "\n")),
+		InventoryID:       inspection.InventoryID,
+		InspectionID:      &inspection.ID,
+		ProductionOrderID: inspection.ProductionOrderID,
+		SupplierID:        inspection.SupplierID,
+		NonconformingQty:  inspection.DefectQuantity,
+		Unit:              inspection.Unit,
+	}
+	switch {
+	case inspection.CriticalDefects > 0:
+		ncr.Severity = models.DefectClassCritical
+	case inspection.MajorDefects == 0 && inspection.MinorDefects > 0:
+		ncr.Severity = models.DefectClassMinor
+	}
+	if inspection.Type == models.NCRSourceCustomerReturn {
+		ncr.Source = models.NCRSourceCustomerReturn
+	}
+	if inspection.Type == "incoming" && inspection.SupplierID != nil {
+		ncr.Responsibility = models.ResponsibilitySupplier
+	}
+	if inspection.Decision == models.InspectionReject {
+		ncr.Title = fmt.Sprintf("Lot rejected in sampling inspection %s", inspection.InspectionNo)
+	}
+
+	if err := s.Create(ctx, ncr, userID); err != nil {
+		return nil, err
+	}
+	return ncr, nil
+}
+
+// Update changes the description and references of an open report
+func (s *ncrService) Update(ctx context.Context, id uuid.UUID, ncr *models.NonconformanceReport) (*models.NonconformanceReport, error) {
+	existing, err := s.getOpen(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	previous := *existing
+
+	existing.Title = strings.TrimSpace(ncr.Title)
+	existing.Description = ncr.Description
+	existing.Severity = ncr.Severity
+	existing.InventoryID = ncr.InventoryID
+	existing.ProductionOrderID = ncr.ProductionOrderID
+	existing.PurchaseOrderID = ncr.PurchaseOrderID
+	existing.OrderID = ncr.OrderID
+	existing.CustomerID = ncr.CustomerID
+	existing.SupplierID = ncr.SupplierID
+	existing.ComplaintRef = ncr.ComplaintRef
+	existing.NonconformingQty = ncr.NonconformingQty
+	existing.Unit = ncr.Unit
+	existing.VerifyAfter = ncr.VerifyAfter
+	if err := validateNCR(existing); err != nil {
+		return nil, err
+	}
+	if err := s.ncrRepo.Update(ctx, existing); err != nil {
+		return nil, err
+	}
+	s.feedSupplierQuality(ctx, existing, &previous, existing.ReportedBy)
+	return existing, nil
+}
+
+func (s *ncrService) Get(ctx context.Context, id uuid.UUID) (*models.NonconformanceReport, error) {
+	ncr, err := s.ncrRepo.Get(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrNCRNotFound
+	}
+	return ncr, err
+}
+
+func (s *ncrService) List(ctx context.Context, params map[string]interface{}) ([]*models.NonconformanceReport, int64, error) {
+	return s.ncrRepo.List(ctx, params)
+}
+
+// Cancel withdraws a report raised in error; it no longer counts against
+// the supplier
+func (s *ncrService) Cancel(ctx context.Context, id uuid.UUID, reason string, userID uuid.UUID) (*models.NonconformanceReport, error) {
+	ncr, err := s.getOpen(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	previous := *ncr
+
+	now := time.Now()
+	ncr.Status = models.NCRStatusCancelled
+	ncr.ClosedBy = &userID
+	ncr.ClosedAt = &now
+	if reason = strings.TrimSpace(reason); reason != "" {
+		ncr.Description = strings.TrimSpace(ncr.Description + "\nCancelled: " + reason)
+	}
+	if err := s.ncrRepo.Update(ctx, ncr); err != nil {
+		return nil, err
+	}
+	s.feedSupplierQuality(ctx, ncr, &previous, userID)
+	return ncr, nil
+}
+
+// Workflow
+
+// UpdateStep assigns an 8D discipline or completes it. Disciplines complete
+// in order; D3 needs its containment actions done, D4 the root cause, D6
+// the disposition and D8 an effective verification. Completing D7 awaits
+// verification and completing D8 closes the report.
+func (s *ncrService) UpdateStep(ctx context.Context, id uuid.UUID, discipline int, req NCRStepRequest, userID uuid.UUID) (*models.NonconformanceReport, error) {
+	ncr, err := s.getOpen(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if discipline < models.D1Team || discipline > models.D8Closure || len(ncr.Steps) != models.D8Closure {
+		return nil, ErrInvalidNCR
+	}
+	step := &ncr.Steps[discipline-1]
+
+	if req.OwnerID != nil {
+		step.OwnerID = req.OwnerID
+	}
+	if req.DueDate != nil {
+		step.DueDate = req.DueDate
+	}
+	if req.Notes != nil {
+		step.Notes = *req.Notes
+	}
+
+	if req.Complete && step.Status != "done" {
+		if discipline > models.D1Team && ncr.Steps[discipline-2].Status != "done" {
+			return nil, ErrNCRStepOrder
+		}
+		if err := checkStepPrerequisites(ncr, discipline); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		step.Status = "done"
+		step.CompletedBy = &userID
+		step.CompletedAt = &now
+
+		switch discipline {
+		case models.D7Prevention:
+			ncr.Status = models.NCRStatusVerification
+		case models.D8Closure:
+			ncr.Status = models.NCRStatusClosed
+			ncr.ClosedBy = &userID
+			ncr.ClosedAt = &now
+		default:
+			ncr.Status = models.NCRStatusInProgress
+		}
+	}
+
+	if err := s.ncrRepo.SaveSteps(ctx, ncr, step); err != nil {
+		return nil, err
+	}
+	return ncr, nil
+}
+
+// SetDisposition decides what happens to the nonconforming material;
+// returning it needs the supplier on the report
+func (s *ncrService) SetDisposition(ctx context.Context, id uuid.UUID, req NCRDispositionRequest, userID uuid.UUID) (*models.NonconformanceReport, error) {
+	ncr, err := s.getOpen(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch req.Disposition {
+	case models.DispositionScrap, models.DispositionRework, models.DispositionUseAsIs:
+	case models.DispositionReturnToSupplier:
+		if ncr.SupplierID == nil {
+			return nil, fmt.Errorf("%w: returning to the supplier needs the supplier", ErrInvalidNCR)
+		}
+	default:
+		return nil, fmt.Errorf("%w: disposition must be scrap, rework, use_as_is or return_to_supplier", ErrInvalidNCR)
+	}
+	if req.Quantity < 0 {
+		return nil, fmt.Errorf("%w: disposition quantity cannot be negative", ErrInvalidNCR)
+	}
+
+	now := time.Now()
+	ncr.Disposition = req.Disposition
+	ncr.DispositionQty = req.Quantity
+	if ncr.DispositionQty == 0 {
+		ncr.DispositionQty = ncr.NonconformingQty
+	}
+	ncr.DispositionNotes = req.Notes
+	ncr.DispositionBy = &userID
+	ncr.DispositionAt = &now
+	if ncr.Status == models.NCRStatusOpen {
+		ncr.Status = models.NCRStatusInProgress
+	}
+	if err := s.ncrRepo.Update(ctx, ncr); err != nil {
+		return nil, err
+	}
+	return ncr, nil
+}
+
+// SetRootCause records the D4 root cause and responsibility; a supplier
+// responsibility counts the report in the supplier's quality score
+func (s *ncrService) SetRootCause(ctx context.Context, id uuid.UUID, req NCRRootCauseRequest, userID uuid.UUID) (*models.NonconformanceReport, error) {
+	ncr, err := s.getOpen(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	previous := *ncr
+
+	switch req.Responsibility {
+	case models.ResponsibilityInternal, models.ResponsibilitySupplier, models.ResponsibilityCustomer:
+	default:
+		return nil, fmt.Errorf("%w: responsibility must be internal, supplier or customer", ErrInvalidNCR)
+	}
+	if !validRootCauseCategory(req.Category) || strings.TrimSpace(req.RootCause) == "" {
+		return nil, fmt.Errorf("%w: root cause needs a known category and a description", ErrInvalidNCR)
+	}
+	if req.SupplierID != nil {
+		ncr.SupplierID = req.SupplierID
+	}
+	if req.Responsibility == models.ResponsibilitySupplier && ncr.SupplierID == nil {
+		return nil, fmt.Errorf("%w: a supplier responsibility needs the supplier", ErrInvalidNCR)
+	}
+
+	ncr.Responsibility = req.Responsibility
+	ncr.RootCauseCategory = req.Category
+	ncr.RootCause = strings.TrimSpace(req.RootCause)
+	if err := s.ncrRepo.Update(ctx, ncr); err != nil {
+		return nil, err
+	}
+	s.feedSupplierQuality(ctx, ncr, &previous, userID)
+	return ncr, nil
+}
+
+// VerifyEffectiveness records whether the corrective actions worked, once
+// D7 is done and the verification date is reached. Actions that did not
+// work reopen D4 to D7 for another pass.
+func (s *ncrService) VerifyEffectiveness(ctx context.Context, id uuid.UUID, req NCRVerificationRequest, userID uuid.UUID) (*models.NonconformanceReport, error) {
+	ncr, err := s.getOpen(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if ncr.Status != models.NCRStatusVerification {
+		return nil, fmt.Errorf("%w: D7 must be completed before verifying effectiveness", ErrNCRStepIncomplete)
+	}
+	now := time.Now()
+	if ncr.VerifyAfter != nil && now.Before(*ncr.VerifyAfter) {
+		return nil, fmt.Errorf("%w: effectiveness can be verified from %s", ErrNCRStepIncomplete, ncr.VerifyAfter.Format("2006-01-02"))
+	}
+
+	var reopened []*models.NCRStep
+	switch req.Result {
+	case models.EffectivenessEffective:
+	case models.EffectivenessNotEffective:
+		for i := range ncr.Steps {
+			step := &ncr.Steps[i]
+			if step.Discipline >= models.D4RootCause && step.Discipline <= models.D7Prevention {
+				step.Status = "open"
+				step.CompletedBy, step.CompletedAt = nil, nil
+				reopened = append(reopened, step)
+			}
+		}
+		ncr.Status = models.NCRStatusInProgress
+		ncr.VerifyAfter = nil
+	default:
+		return nil, fmt.Errorf("%w: result must be effective or not_effective", ErrInvalidNCR)
+	}
+
+	ncr.Effectiveness = req.Result
+	ncr.VerifiedBy = &userID
+	ncr.VerifiedAt = &now
+	note := fmt.Sprintf("%s %s", now.Format("2006-01-02"), req.Result)
+	if notes := strings.TrimSpace(req.Notes); notes != "" {
+		note += ": " + notes
+	}
+	ncr.EffectivenessNotes = strings.TrimSpace(ncr.EffectivenessNotes + "\n" + note)
+
+	if err := s.ncrRepo.SaveSteps(ctx, ncr, reopened...); err != nil {
+		return nil, err
+	}
+	return ncr, nil
+}
+
+// Containment
+
+// AddContainment adds an interim containment action, typically on a lot
+func (s *ncrService) AddContainment(ctx context.Context, id uuid.UUID, containment *models.NCRContainment) (*models.NCRContainment, error) {
+	ncr, err := s.getOpen(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	containment.ID = uuid.Nil
+	containment.NCRID = ncr.ID
+	containment.Action = strings.TrimSpace(containment.Action)
+	containment.LotNo = strings.TrimSpace(containment.LotNo)
+	if containment.Action == "" {
+		return nil, fmt.Errorf("%w: containment needs an action", ErrInvalidNCR)
+	}
+	if containment.InventoryID == nil {
+		containment.InventoryID = ncr.InventoryID
+	}
+	containment.Status = "open"
+	containment.CompletedAt = nil
+	if err := s.ncrRepo.CreateContainment(ctx, containment); err != nil {
+		return nil, err
+	}
+	if ncr.Status == models.NCRStatusOpen {
+		ncr.Status = models.NCRStatusInProgress
+		if err := s.ncrRepo.Update(ctx, ncr); err != nil {
+			return nil, err
+		}
+	}
+	return containment, nil
+}
+
+// UpdateContainment records the progress of a containment action; status
+// done completes it
+func (s *ncrService) UpdateContainment(ctx context.Context, id, containmentID uuid.UUID, containment *models.NCRContainment) (*models.NCRContainment, error) {
+	ncr, err := s.getOpen(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.ncrRepo.GetContainment(ctx, containmentID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && existing.NCRID != ncr.ID) {
+		return nil, ErrContainmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if action := strings.TrimSpace(containment.Action); action != "" {
+		existing.Action = action
+	}
+	existing.InventoryID = containment.InventoryID
+	existing.WarehouseID = containment.WarehouseID
+	existing.LotNo = strings.TrimSpace(containment.LotNo)
+	existing.Location = containment.Location
+	existing.SuspectQty = containment.SuspectQty
+	existing.NonconformingQty = containment.NonconformingQty
+	existing.OwnerID = containment.OwnerID
+	existing.DueDate = containment.DueDate
+	existing.Notes = containment.Notes
+	switch containment.Status {
+	case "done":
+		if existing.Status != "done" {
+			now := time.Now()
+			existing.Status = "done"
+			existing.CompletedAt = &now
+		}
+	case "open":
+		existing.Status = "open"
+		existing.CompletedAt = nil
+	}
+	if err := s.ncrRepo.UpdateContainment(ctx, existing); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (s *ncrService) ListContainmentsByLot(ctx context.Context, companyID uuid.UUID, lotNo string) ([]*models.NCRContainment, error) {
+	return s.ncrRepo.ListContainmentsByLot(ctx, companyID, strings.TrimSpace(lotNo))
+}
+
+// getOpen loads a report that can still change
+func (s *ncrService) getOpen(ctx context.Context, id uuid.UUID) (*models.NonconformanceReport, error) {
+	ncr, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if ncr.Status == models.NCRStatusClosed || ncr.Status == models.NCRStatusCancelled {
+		return nil, ErrNCRClosed
+	}
+	return ncr, nil
+}
+
+// feedSupplierQuality recomputes the quality score of the monthly
+// evaluations of the suppliers a change of a report touches, before and
+// after the change. Failures are logged; the report itself is saved.
+func (s *ncrService) feedSupplierQuality(ctx context.Context, ncr, previous *models.NonconformanceReport, userID uuid.UUID) {
+	type period struct {
+		supplierID uuid.UUID
+		month      time.Time
+	}
+	var periods []period
+	for _, n := range []*models.NonconformanceReport{previous, ncr} {
+		if n == nil || n.SupplierID == nil || n.Responsibility != models.ResponsibilitySupplier {
+			continue
+		}
+		reported := n.ReportedAt.UTC()
+		p := period{*n.SupplierID, time.Date(reported.Year(), reported.Month(), 1, 0, 0, 0, 0, time.UTC)}
+		if len(periods) == 0 || periods[0] != p {
+			periods = append(periods, p)
+		}
+	}
+
+	for _, p := range periods {
+		if err := s.scoreSupplierMonth(ctx, ncr.CompanyID, p.supplierID, p.month, userID); err != nil {
+			log.Printf("Failed to update the quality score of supplier %s for %s: %v", p.supplierID, p.month.Format("2006-01"), err)
+		}
+	}
+}
+
+// scoreSupplierMonth sets the quality defects and score of a supplier's
+// monthly evaluation from its supplier-caused NCRs, creating the draft
+// evaluation if there is none. The ratings of the supplier follow when the
+// evaluation was already approved.
+func (s *ncrService) scoreSupplierMonth(ctx context.Context, companyID, supplierID uuid.UUID, month time.Time, userID uuid.UUID) error {
+	end := month.AddDate(0, 1, 0)
+	counts, err := s.ncrRepo.CountSupplierNCRs(ctx, companyID, supplierID, month, end)
+	if err != nil {
+		return err
+	}
+	defects := 0
+	score := 100.0
+	for severity, n := range counts {
+		defects += n
+		penalty, ok := ncrQualityPenalty[severity]
+		if !ok {
+			penalty = ncrQualityPenalty[models.DefectClassMajor]
+		}
+		score -= penalty * float64(n)
+	}
+	score = math.Max(0, score)
+
+	evaluation, err := s.ncrRepo.FindSupplierEvaluation(ctx, companyID, supplierID, ncrEvaluationType, month)
+	if errors.Is(err, repository.ErrNotFound) {
+		if defects == 0 {
+			return nil
+		}
+		evaluation = &models.SupplierEvaluation{
+			CompanyID:      companyID,
+			SupplierID:     supplierID,
+			EvaluationNo:   fmt.Sprintf("EVL-%s-%s", month.Format("200601"), strings.ToUpper(supplierID.String()[:8])),
+			StartDate:      month,
+			EndDate:        end.AddDate(0, 0, -1),
+			EvaluationType: ncrEvaluationType,
+			Status:         "draft",
+			EvaluatedBy:    userID,
+			EvaluatedAt:    time.Now(),
+		}
+	} else if err != nil {
+		return err
+	}
+
+	evaluation.QualityDefects = defects
+	evaluation.QualityScore = score
+	evaluation.OverallScore = (evaluation.QualityScore + evaluation.DeliveryScore + evaluation.ServiceScore + evaluation.CostScore + evaluation.TechnicalScore) / 5
+	if evaluation.ID == uuid.Nil {
+		return s.supplierRepo.CreateSupplierEvaluation(evaluation)
+	}
+	if err := s.supplierRepo.UpdateSupplierEvaluation(evaluation); err != nil {
+		return err
+	}
+	if evaluation.Status == "approved" {
+		return s.supplier.UpdateSupplierPerformance(supplierID)
+	}
+	return nil
+}
+
+// checkStepPrerequisites checks what a discipline needs before it can be
+// completed
+func checkStepPrerequisites(ncr *models.NonconformanceReport, discipline int) error {
+	switch discipline {
+	case models.D3Containment:
+		if len(ncr.Containments) == 0 {
+			return fmt.Errorf("%w: D3 needs at least one containment action", ErrNCRStepIncomplete)
+		}
+		for _, c := range ncr.Containments {
+			if c.Status != "done" {
+				return fmt.Errorf("%w: containment action %q is still open", ErrNCRStepIncomplete, c.Action)
+			}
+		}
+	case models.D4RootCause:
+		if ncr.RootCause == "" || ncr.Responsibility == "" {
+			return fmt.Errorf("%w: D4 needs the root cause and responsibility", ErrNCRStepIncomplete)
+		}
+	case models.D6Implementation:
+		if ncr.Disposition == "" {
+			return fmt.Errorf("%w: D6 needs the disposition of the nonconforming material", ErrNCRStepIncomplete)
+		}
+	case models.D8Closure:
+		if ncr.Effectiveness != models.EffectivenessEffective {
+			return fmt.Errorf("%w: D8 needs the corrective actions verified effective", ErrNCRStepIncomplete)
+		}
+	}
+	return nil
+}
+
+func validateNCR(ncr *models.NonconformanceReport) error {
+	if ncr.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalidNCR)
+	}
+	switch ncr.Source {
+	case models.NCRSourceInspection, models.NCRSourceCustomerReturn, models.NCRSourceComplaint, models.NCRSourceInternal:
+	default:
+		return fmt.Errorf("%w: source must be inspection, customer_return, customer_complaint or internal", ErrInvalidNCR)
+	}
+	switch ncr.Severity {
+	case models.DefectClassCritical, models.DefectClassMajor, models.DefectClassMinor:
+	default:
+		return fmt.Errorf("%w: severity must be critical, major or minor", ErrInvalidNCR)
+	}
+	switch ncr.Responsibility {
+	case "", models.ResponsibilityInternal, models.ResponsibilityCustomer:
+	case models.ResponsibilitySupplier:
+		if ncr.SupplierID == nil {
+			return fmt.Errorf("%w: a supplier responsibility needs the supplier", ErrInvalidNCR)
+		}
+	default:
+		return fmt.Errorf("%w: responsibility must be internal, supplier or customer", ErrInvalidNCR)
+	}
+	if ncr.NonconformingQty < 0 {
+		return fmt.Errorf("%w: nonconforming quantity cannot be negative", ErrInvalidNCR)
+	}
+	return nil
+}
+
+func validRootCauseCategory(category string) bool {
+	switch category {
+	case models.RootCauseMan, models.RootCauseMachine, models.RootCauseMethod, models.RootCauseMaterial,
+		models.RootCauseMeasurement, models.RootCauseEnvironment, models.RootCauseDesign:
+		return true
+	}
+	return false
+}
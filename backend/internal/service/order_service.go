@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -88,6 +89,8 @@ type orderService struct {
 	quoteRepo    repository.QuoteRepository
 	customerRepo repository.CustomerRepository
 	n8nService   N8NService
+	screening    ScreeningService
+	credit       CreditService
 }
 
 func NewOrderService(
@@ -95,12 +98,16 @@ func NewOrderService(
 	quoteRepo repository.QuoteRepository,
 	customerRepo repository.CustomerRepository,
 	n8nService N8NService,
+	screening ScreeningService,
+	credit CreditService,
 ) OrderService {
 	return &orderService{
 		orderRepo:    orderRepo,
 		quoteRepo:    quoteRepo,
 		customerRepo: customerRepo,
 		n8nService:   n8nService,
+		screening:    screening,
+		credit:       credit,
 	}
 }
 
@@ -123,6 +130,11 @@ func (s *orderService) CreateFromQuote(companyID, userID, quoteID uuid.UUID, req
 		return nil, errors.New("quote must be sent or accepted to create order")
 	}
 	
+	// Orders cannot be placed for customers with unresolved sanctions hits
+	if err := s.screening.EnsureCustomerCleared(context.Background(), quote.CustomerID); err != nil {
+		return nil, err
+	}
+	
 	// Parse delivery date
 	deliveryDate, err := time.Parse("2006-01-02", req.DeliveryDate)
 	if err != nil {
@@ -185,6 +197,18 @@ func (s *orderService) CreateFromQuote(companyID, userID, quoteID uuid.UUID, req
 	// Log activity
 	s.logActivity(order.ID, userID, "created", fmt.Sprintf("Order created from quote %s", quote.QuoteNo))
 	
+	// Orders beyond the customer's credit limit are created on hold. The
+	// check is advisory: the order has been stored and stays pending, so a
+	// failed check is only logged. UpdateStatus enforces the limit through
+	// EnsureOrderReleased, which fails confirmation and shipping while the
+	// order is held or the check cannot be made.
+	hold, err := s.credit.CheckOrder(context.Background(), order, userID)
+	if err != nil {
+		s.logActivity(order.ID, userID, "credit_check_failed", fmt.Sprintf("Credit check failed: %v", err))
+	} else if hold != nil {
+		s.logActivity(order.ID, userID, "credit_hold", fmt.Sprintf("Order placed on credit hold: %s", hold.Reason))
+	}
+	
 	// Trigger N8N workflow
 	go s.n8nService.LogEvent(companyID, userID, "order.created", "order", order.ID, map[string]interface{}{
 		"order_no":     order.OrderNo,
@@ -247,6 +271,15 @@ func (s *orderService) UpdateStatus(id, userID uuid.UUID, status string, notes s
 		return nil, fmt.Errorf("invalid status transition from %s to %s", order.Status, status)
 	}
 	
+	if status == "confirmed" || status == "shipped" {
+		if err := s.screening.EnsureCustomerCleared(context.Background(), order.CustomerID); err != nil {
+			return nil, err
+		}
+		if err := s.credit.EnsureOrderReleased(context.Background(), order, userID); err != nil {
+			return nil, err
+		}
+	}
+	
 	// Update status and timestamps
 	previousStatus := order.Status
 	order.Status = status
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/schedule"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/fastenmind/fastener-api/pkg/concurrent"
+)
+
+// PeriodicRunner runs a job every interval in the background. It implements
+// concurrent.Service so background jobs can be run by the service registry.
+type PeriodicRunner struct {
+	name     string
+	interval time.Duration
+	runs     repository.JobRunRepository
+	job      func(ctx context.Context) error
+
+	mu     sync.Mutex
+	status concurrent.ServiceStatus
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPeriodicRunner creates a runner that calls job every interval. Errors
+// returned by job are logged; the next run happens as scheduled. The last
+// run is stored in runs, so the job runs on start when it is due and a
+// restart does not repeat or postpone a run; with nil runs the job runs on
+// start and then every interval.
+func NewPeriodicRunner(name string, interval time.Duration, runs repository.JobRunRepository, job func(ctx context.Context) error) *PeriodicRunner {
+	return &PeriodicRunner{
+		name:     name,
+		interval: interval,
+		runs:     runs,
+		job:      job,
+		status:   concurrent.StatusStopped,
+	}
+}
+
+// Name returns the service name
+func (p *PeriodicRunner) Name() string {
+	return p.name
+}
+
+// Status returns the service status
+func (p *PeriodicRunner) Status() concurrent.ServiceStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+// Start begins running the job in the background
+func (p *PeriodicRunner) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.status == concurrent.StatusRunning {
+		return nil
+	}
+
+	// The runner outlives the context it was started with
+	runCtx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	p.status = concurrent.StatusRunning
+
+	go p.run(runCtx)
+	return nil
+}
+
+// Stop cancels the runner and waits for a running job to finish
+func (p *PeriodicRunner) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if p.status != concurrent.StatusRunning {
+		p.mu.Unlock()
+		return nil
+	}
+	p.status = concurrent.StatusStopping
+	p.cancel()
+	done := p.done
+	p.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	p.mu.Lock()
+	p.status = concurrent.StatusStopped
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *PeriodicRunner) run(ctx context.Context) {
+	defer close(p.done)
+
+	var last *time.Time
+	for {
+		wait := p.wait(ctx, last)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		last = &now
+		if !p.claim(ctx, now) {
+			continue
+		}
+		if err := p.job(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("%s failed: %v", p.name, err)
+		}
+	}
+}
+
+// wait returns how long to wait for the next run, from the stored last run
+// when there is one and from the last run of this runner otherwise
+func (p *PeriodicRunner) wait(ctx context.Context, last *time.Time) time.Duration {
+	if p.runs != nil {
+		stored, err := p.runs.GetLastRun(ctx, p.name)
+		if err == nil {
+			return schedule.Wait(stored, p.interval, time.Now())
+		}
+		if ctx.Err() == nil {
+			log.Printf("%s failed to load last run: %v", p.name, err)
+		}
+	}
+	return schedule.Wait(last, p.interval, time.Now())
+}
+
+// claim records the run at now and reports whether this runner should run
+// the job, which it should not when another server ran it within the interval
+func (p *PeriodicRunner) claim(ctx context.Context, now time.Time) bool {
+	if p.runs == nil {
+		return true
+	}
+	claimed, err := p.runs.ClaimRun(ctx, p.name, now, schedule.DueBefore(p.interval, now))
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("%s failed to record run: %v", p.name, err)
+		}
+		// Better to run twice than not at all
+		return ctx.Err() == nil
+	}
+	return claimed
+}
@@ -0,0 +1,642 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/ppap"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/fastenmind/fastener-api/pkg/resources"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrPPAPNotFound is returned when a PPAP submission does not exist
+	ErrPPAPNotFound = errors.New("PPAP submission not found")
+	// ErrPPAPElementNotFound is returned for an element outside 1 to 18
+	ErrPPAPElementNotFound = errors.New("PPAP element not found")
+	// ErrPPAPDocumentNotFound is returned when a PPAP document does not exist
+	ErrPPAPDocumentNotFound = errors.New("PPAP document not found")
+	// ErrPPAPWarningNotFound is returned when a release warning does not exist
+	ErrPPAPWarningNotFound = errors.New("PPAP release warning not found")
+	// ErrInvalidPPAP is returned for a submission without customer part,
+	// part or a known level and reason
+	ErrInvalidPPAP = errors.New("invalid PPAP submission")
+	// ErrPPAPNotEditable is returned when changing a submission that is
+	// with the customer or decided
+	ErrPPAPNotEditable = errors.New("PPAP submission can only be changed while draft or rejected")
+	// ErrPPAPIncomplete is returned when submitting with elements outstanding
+	ErrPPAPIncomplete = errors.New("PPAP elements outstanding")
+	// ErrPPAPNotSubmitted is returned when recording a decision on a
+	// submission that is not with the customer
+	ErrPPAPNotSubmitted = errors.New("PPAP submission is not with the customer")
+	// ErrInvalidPPAPDecision is returned for an unknown decision, a
+	// rejection without comments or an interim approval without expiry
+	ErrInvalidPPAPDecision = errors.New("invalid PPAP decision")
+)
+
+const ppapWarningRoles = `["manager","engineer"]`
+
+// PPAPService keeps the production part approvals of customer part numbers
+// and warns when production orders are released for parts without one
+type PPAPService interface {
+	// Submissions
+
+	// CreateSubmission opens a draft with the element checklist of its level
+	CreateSubmission(ctx context.Context, submission *models.PPAPSubmission) error
+	UpdateSubmission(ctx context.Context, id uuid.UUID, req *models.PPAPSubmission) (*models.PPAPSubmission, error)
+	GetSubmission(ctx context.Context, id uuid.UUID) (*models.PPAPSubmission, error)
+	ListSubmissions(ctx context.Context, params map[string]interface{}) ([]*models.PPAPSubmission, int64, error)
+	UpdateElement(ctx context.Context, id uuid.UUID, element int, req UpdatePPAPElementRequest) (*models.PPAPElement, error)
+	// SubmitSubmission sends a draft to the customer once every element is
+	// complete or not applicable
+	SubmitSubmission(ctx context.Context, id, userID uuid.UUID) (*models.PPAPSubmission, error)
+	// DecideSubmission records the customer's decision; an approval
+	// supersedes the approval before of the same customer part
+	DecideSubmission(ctx context.Context, id uuid.UUID, req PPAPDecisionRequest) (*models.PPAPSubmission, error)
+
+	// Documents
+
+	// UploadDocument stores a new version of the document of an element
+	// and marks the element complete
+	UploadDocument(ctx context.Context, req UploadPPAPDocumentRequest) (*models.PPAPDocument, error)
+	// OpenDocument returns a document of a submission with its content
+	OpenDocument(ctx context.Context, submissionID, documentID uuid.UUID) (*models.PPAPDocument, []byte, error)
+
+	// Release warnings
+
+	// CheckRelease records and announces a warning when a production order
+	// is released for a part without an approved PPAP; nil when approved
+	CheckRelease(ctx context.Context, order *models.ProductionOrder, userID uuid.UUID) (*models.PPAPReleaseWarning, error)
+	GetReleaseWarning(ctx context.Context, id uuid.UUID) (*models.PPAPReleaseWarning, error)
+	ListReleaseWarnings(ctx context.Context, params map[string]interface{}) ([]*models.PPAPReleaseWarning, int64, error)
+	AcknowledgeReleaseWarning(ctx context.Context, id, userID uuid.UUID) (*models.PPAPReleaseWarning, error)
+}
+
+// UpdatePPAPElementRequest changes an element of a draft. Requirement can
+// only be set on elements the customer defines at level 4; status marks an
+// element not applicable or reopens it.
+type UpdatePPAPElementRequest struct {
+	Requirement string  `json:"requirement"`
+	Status      string  `json:"status"`
+	Notes       *string `json:"notes"`
+}
+
+// UploadPPAPDocumentRequest uploads the document of an element
+type UploadPPAPDocumentRequest struct {
+	SubmissionID uuid.UUID
+	Element      int
+	FileName     string
+	ContentType  string
+	Comment      string
+	UserID       uuid.UUID
+	Content      io.Reader
+}
+
+// PPAPDecisionRequest records the customer's decision on a submission
+type PPAPDecisionRequest struct {
+	UserID           uuid.UUID  `json:"-"`
+	Status           string     `json:"status"` // approved, interim_approved, rejected
+	DecidedBy        string     `json:"decided_by"`
+	DecidedAt        *time.Time `json:"decided_at"` // defaults to now
+	Comments         string     `json:"comments"`
+	InterimExpiresAt *time.Time `json:"interim_expires_at"`
+}
+
+type ppapService struct {
+	ppapRepo       repository.PPAPRepository
+	customerRepo   repository.CustomerRepository
+	inventoryRepo  repository.InventoryRepository
+	productionRepo repository.ProductionRepository
+	system         SystemService
+	storagePath    string
+}
+
+// NewPPAPService creates a new PPAP service. Documents are stored under
+// storagePath.
+func NewPPAPService(
+	ppapRepo repository.PPAPRepository,
+	customerRepo repository.CustomerRepository,
+	inventoryRepo repository.InventoryRepository,
+	productionRepo repository.ProductionRepository,
+	system SystemService,
+	storagePath string,
+) PPAPService {
+	return &ppapService{
+		ppapRepo:       ppapRepo,
+		customerRepo:   customerRepo,
+		inventoryRepo:  inventoryRepo,
+		productionRepo: productionRepo,
+		system:         system,
+		storagePath:    storagePath,
+	}
+}
+
+// Submissions
+
+func (s *ppapService) CreateSubmission(ctx context.Context, submission *models.PPAPSubmission) error {
+	if submission.Level == 0 {
+		submission.Level = ppap.Level3
+	}
+	if submission.Reason == "" {
+		submission.Reason = models.PPAPReasonInitial
+	}
+	if err := s.validateSubmission(ctx, submission); err != nil {
+		return err
+	}
+	items, err := ppap.Checklist(submission.Level)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPPAP, err)
+	}
+
+	now := time.Now()
+	submission.SubmissionNo = fmt.Sprintf("PPAP-%s-%06d", now.Format("200601"), now.UnixMicro()%1000000)
+	submission.Status = models.PPAPStatusDraft
+	submission.SubmittedBy, submission.SubmittedAt = nil, nil
+	submission.CustomerDecisionBy, submission.DecidedAt, submission.RecordedBy = "", nil, nil
+	submission.CustomerComments, submission.InterimExpiresAt = "", nil
+	submission.Elements = make([]models.PPAPElement, 0, len(items))
+	for _, item := range items {
+		submission.Elements = append(submission.Elements, models.PPAPElement{
+			Element:     item.Element,
+			Name:        item.Name,
+			Requirement: item.Requirement,
+			Status:      models.PPAPElementPending,
+		})
+	}
+	return s.ppapRepo.CreateSubmission(ctx, submission)
+}
+
+// UpdateSubmission changes a draft or rejected submission. A new level
+// re-derives the requirements of the elements; their documents stay.
+func (s *ppapService) UpdateSubmission(ctx context.Context, id uuid.UUID, req *models.PPAPSubmission) (*models.PPAPSubmission, error) {
+	submission, err := s.editableSubmission(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	submission.CustomerPartName = req.CustomerPartName
+	submission.DrawingRevision = req.DrawingRevision
+	submission.RouteID = req.RouteID
+	submission.Notes = req.Notes
+	if req.Reason != "" {
+		submission.Reason = req.Reason
+	}
+	levelChanged := req.Level != 0 && req.Level != submission.Level
+	if levelChanged {
+		submission.Level = req.Level
+	}
+	if err := s.validateSubmission(ctx, submission); err != nil {
+		return nil, err
+	}
+	if levelChanged {
+		for i := range submission.Elements {
+			element := &submission.Elements[i]
+			element.Requirement, err = ppap.Requirement(submission.Level, element.Element)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidPPAP, err)
+			}
+		}
+	}
+
+	if err := s.ppapRepo.SaveSubmission(ctx, submission); err != nil {
+		return nil, err
+	}
+	submission.Route = nil
+	return submission, nil
+}
+
+func (s *ppapService) GetSubmission(ctx context.Context, id uuid.UUID) (*models.PPAPSubmission, error) {
+	submission, err := s.ppapRepo.GetSubmission(ctx, id)
+	if err == repository.ErrNotFound {
+		return nil, ErrPPAPNotFound
+	}
+	return submission, err
+}
+
+func (s *ppapService) ListSubmissions(ctx context.Context, params map[string]interface{}) ([]*models.PPAPSubmission, int64, error) {
+	return s.ppapRepo.ListSubmissions(ctx, params)
+}
+
+func (s *ppapService) UpdateElement(ctx context.Context, id uuid.UUID, number int, req UpdatePPAPElementRequest) (*models.PPAPElement, error) {
+	submission, err := s.editableSubmission(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	element := findPPAPElement(submission, number)
+	if element == nil {
+		return nil, ErrPPAPElementNotFound
+	}
+
+	if req.Requirement != "" && req.Requirement != element.Requirement {
+		base, err := ppap.Requirement(submission.Level, number)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPPAP, err)
+		}
+		if base != ppap.CustomerDefined {
+			return nil, fmt.Errorf("%w: the requirement of element %d is fixed at level %d", ErrInvalidPPAP, number, submission.Level)
+		}
+		switch req.Requirement {
+		case ppap.Submit, ppap.Retain, ppap.CustomerDefined:
+			element.Requirement = req.Requirement
+		default:
+			return nil, fmt.Errorf("%w: requirement must be submit, retain or customer", ErrInvalidPPAP)
+		}
+	}
+
+	switch req.Status {
+	case "":
+	case models.PPAPElementNotApplicable:
+		if !ppap.Waivable(number) {
+			return nil, fmt.Errorf("%w: %s is always required", ErrInvalidPPAP, element.Name)
+		}
+		element.Status = models.PPAPElementNotApplicable
+	case models.PPAPElementPending, models.PPAPElementComplete:
+		// an element is complete while it has a document on file
+		if req.Status == models.PPAPElementComplete && element.CurrentVersion == 0 {
+			return nil, fmt.Errorf("%w: upload a document to complete %s", ErrInvalidPPAP, element.Name)
+		}
+		element.Status = models.PPAPElementPending
+		if element.CurrentVersion > 0 {
+			element.Status = models.PPAPElementComplete
+		}
+	default:
+		return nil, fmt.Errorf("%w: status must be pending, complete or not_applicable", ErrInvalidPPAP)
+	}
+	if req.Notes != nil {
+		element.Notes = *req.Notes
+	}
+
+	if err := s.ppapRepo.SaveSubmission(ctx, submission); err != nil {
+		return nil, err
+	}
+	return element, nil
+}
+
+func (s *ppapService) SubmitSubmission(ctx context.Context, id, userID uuid.UUID) (*models.PPAPSubmission, error) {
+	submission, err := s.editableSubmission(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]ppap.Status, 0, len(submission.Elements))
+	names := make(map[int]string, len(submission.Elements))
+	for _, element := range submission.Elements {
+		statuses = append(statuses, ppap.Status{
+			Element:       element.Element,
+			Complete:      element.Status == models.PPAPElementComplete,
+			NotApplicable: element.Status == models.PPAPElementNotApplicable,
+		})
+		names[element.Element] = element.Name
+	}
+	if outstanding := ppap.Outstanding(statuses); len(outstanding) > 0 {
+		missing := make([]string, 0, len(outstanding))
+		for _, number := range outstanding {
+			missing = append(missing, fmt.Sprintf("%d %s", number, names[number]))
+		}
+		return nil, fmt.Errorf("%w: %s", ErrPPAPIncomplete, strings.Join(missing, "; "))
+	}
+
+	now := time.Now()
+	submission.Status = models.PPAPStatusSubmitted
+	submission.SubmittedBy = &userID
+	submission.SubmittedAt = &now
+	submission.CustomerDecisionBy, submission.DecidedAt, submission.RecordedBy = "", nil, nil
+	submission.CustomerComments, submission.InterimExpiresAt = "", nil
+	if err := s.ppapRepo.UpdateSubmission(ctx, submission); err != nil {
+		return nil, err
+	}
+	return submission, nil
+}
+
+func (s *ppapService) DecideSubmission(ctx context.Context, id uuid.UUID, req PPAPDecisionRequest) (*models.PPAPSubmission, error) {
+	submission, err := s.GetSubmission(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if submission.Status != models.PPAPStatusSubmitted {
+		return nil, ErrPPAPNotSubmitted
+	}
+
+	decidedAt := time.Now()
+	if req.DecidedAt != nil {
+		decidedAt = *req.DecidedAt
+	}
+	submission.CustomerDecisionBy = strings.TrimSpace(req.DecidedBy)
+	submission.CustomerComments = strings.TrimSpace(req.Comments)
+	submission.DecidedAt = &decidedAt
+	submission.RecordedBy = &req.UserID
+	submission.InterimExpiresAt = nil
+
+	switch req.Status {
+	case models.PPAPStatusApproved:
+	case models.PPAPStatusInterimApproved:
+		if req.InterimExpiresAt == nil || !req.InterimExpiresAt.After(decidedAt) {
+			return nil, fmt.Errorf("%w: an interim approval needs an expiry after the decision", ErrInvalidPPAPDecision)
+		}
+		submission.InterimExpiresAt = req.InterimExpiresAt
+	case models.PPAPStatusRejected:
+		if submission.CustomerComments == "" {
+			return nil, fmt.Errorf("%w: a rejection needs the customer's comments", ErrInvalidPPAPDecision)
+		}
+		submission.Status = models.PPAPStatusRejected
+		if err := s.ppapRepo.UpdateSubmission(ctx, submission); err != nil {
+			return nil, err
+		}
+		return submission, nil
+	default:
+		return nil, fmt.Errorf("%w: status must be approved, interim_approved or rejected", ErrInvalidPPAPDecision)
+	}
+
+	submission.Status = req.Status
+	if err := s.ppapRepo.ApproveSubmission(ctx, submission); err != nil {
+		return nil, err
+	}
+	return submission, nil
+}
+
+// Documents
+
+func (s *ppapService) UploadDocument(ctx context.Context, req UploadPPAPDocumentRequest) (*models.PPAPDocument, error) {
+	submission, err := s.editableSubmission(ctx, req.SubmissionID)
+	if err != nil {
+		return nil, err
+	}
+	element := findPPAPElement(submission, req.Element)
+	if element == nil {
+		return nil, ErrPPAPElementNotFound
+	}
+	fileName := filepath.Base(strings.TrimSpace(req.FileName))
+	if fileName == "." || fileName == string(filepath.Separator) || fileName == "" {
+		return nil, fmt.Errorf("%w: document needs a file name", ErrInvalidPPAP)
+	}
+
+	version := element.CurrentVersion + 1
+	dir := filepath.Join(s.storagePath, "ppap", submission.ID.String())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%02d-v%d-%s", element.Element, version, fileName))
+	hash := sha256.New()
+	var size int64
+	err = resources.WriteFileWithCleanup(ctx, path, func(w io.Writer) error {
+		var copyErr error
+		size, copyErr = io.Copy(io.MultiWriter(w, hash), req.Content)
+		return copyErr
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store %s: %w", path, err)
+	}
+
+	doc := &models.PPAPDocument{
+		SubmissionID: submission.ID,
+		ElementID:    element.ID,
+		Version:      version,
+		FileName:     fileName,
+		FilePath:     path,
+		FileSize:     size,
+		ContentType:  req.ContentType,
+		Hash:         hex.EncodeToString(hash.Sum(nil)),
+		Comment:      req.Comment,
+		UploadedBy:   req.UserID,
+		UploadedAt:   time.Now(),
+	}
+	element.CurrentVersion = version
+	element.Status = models.PPAPElementComplete
+	if err := s.ppapRepo.AddDocument(ctx, element, doc); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (s *ppapService) OpenDocument(ctx context.Context, submissionID, documentID uuid.UUID) (*models.PPAPDocument, []byte, error) {
+	doc, err := s.ppapRepo.GetDocument(ctx, documentID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, nil, ErrPPAPDocumentNotFound
+		}
+		return nil, nil, err
+	}
+	if doc.SubmissionID != submissionID {
+		return nil, nil, ErrPPAPDocumentNotFound
+	}
+
+	var content []byte
+	err = resources.ReadFileWithCleanup(ctx, doc.FilePath, func(r io.Reader) error {
+		var readErr error
+		content, readErr = io.ReadAll(r)
+		return readErr
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", doc.FileName, err)
+	}
+	return doc, content, nil
+}
+
+// Release warnings
+
+// CheckRelease looks for an approval of the part of a production order.
+// A part needs one once it or any part of the order's customer has been
+// submitted. The approval must be for the order's customer when it has one,
+// interim approvals must not have expired and the order must run on the
+// approved route.
+func (s *ppapService) CheckRelease(ctx context.Context, order *models.ProductionOrder, userID uuid.UUID) (*models.PPAPReleaseWarning, error) {
+	submissions, err := s.ppapRepo.ListPartSubmissions(ctx, order.CompanyID, order.InventoryID)
+	if err != nil {
+		return nil, err
+	}
+	if order.CustomerID != nil {
+		// approvals of other customers do not count
+		var forCustomer []*models.PPAPSubmission
+		for _, submission := range submissions {
+			if submission.CustomerID == *order.CustomerID {
+				forCustomer = append(forCustomer, submission)
+			}
+		}
+		submissions = forCustomer
+	}
+	if len(submissions) == 0 {
+		if order.CustomerID == nil {
+			return nil, nil
+		}
+		required, err := s.ppapRepo.CustomerRequiresPPAP(ctx, order.CompanyID, *order.CustomerID)
+		if err != nil || !required {
+			return nil, err
+		}
+	}
+
+	reason := ""
+	var latest *models.PPAPSubmission
+	if len(submissions) > 0 {
+		latest = submissions[0]
+	}
+	approved, expired := approvedPPAP(submissions, time.Now())
+	switch {
+	case approved != nil:
+		if order.RouteID == nil || approved.RouteID == nil || *order.RouteID == *approved.RouteID {
+			return nil, nil
+		}
+		latest = approved
+		reason = fmt.Sprintf("order runs on a different production route than the one approved in %s", approved.SubmissionNo)
+	case expired != nil:
+		latest = expired
+		reason = fmt.Sprintf("interim approval %s expired on %s", expired.SubmissionNo, expired.InterimExpiresAt.Format("2006-01-02"))
+	case latest != nil:
+		reason = fmt.Sprintf("no approved PPAP; latest submission %s is %s", latest.SubmissionNo, latest.Status)
+	default:
+		reason = "no PPAP submitted for this part although the customer requires production part approval"
+	}
+
+	warning := &models.PPAPReleaseWarning{
+		CompanyID:         order.CompanyID,
+		ProductionOrderID: order.ID,
+		OrderNo:           order.OrderNo,
+		InventoryID:       order.InventoryID,
+		CustomerID:        order.CustomerID,
+		Reason:            reason,
+		ReleasedBy:        userID,
+	}
+	if latest != nil {
+		warning.SubmissionID = &latest.ID
+	}
+	if err := s.ppapRepo.CreateReleaseWarning(ctx, warning); err != nil {
+		return nil, err
+	}
+	s.notifyRelease(ctx, order, warning, userID)
+	return warning, nil
+}
+
+func (s *ppapService) GetReleaseWarning(ctx context.Context, id uuid.UUID) (*models.PPAPReleaseWarning, error) {
+	warning, err := s.ppapRepo.GetReleaseWarning(ctx, id)
+	if err == repository.ErrNotFound {
+		return nil, ErrPPAPWarningNotFound
+	}
+	return warning, err
+}
+
+func (s *ppapService) ListReleaseWarnings(ctx context.Context, params map[string]interface{}) ([]*models.PPAPReleaseWarning, int64, error) {
+	return s.ppapRepo.ListReleaseWarnings(ctx, params)
+}
+
+func (s *ppapService) AcknowledgeReleaseWarning(ctx context.Context, id, userID uuid.UUID) (*models.PPAPReleaseWarning, error) {
+	warning, err := s.GetReleaseWarning(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if warning.AcknowledgedAt != nil {
+		return warning, nil
+	}
+	now := time.Now()
+	warning.AcknowledgedBy = &userID
+	warning.AcknowledgedAt = &now
+	if err := s.ppapRepo.UpdateReleaseWarning(ctx, warning); err != nil {
+		return nil, err
+	}
+	return warning, nil
+}
+
+// notifyRelease raises a system notification for a release warning; a
+// failure is logged
+func (s *ppapService) notifyRelease(ctx context.Context, order *models.ProductionOrder, warning *models.PPAPReleaseWarning, userID uuid.UUID) {
+	companyID := order.CompanyID
+	notification := &models.SystemNotification{
+		CompanyID:    &companyID,
+		Title:        fmt.Sprintf("Released without approved PPAP: %s", order.OrderNo),
+		Message:      fmt.Sprintf("Production order %s for %s was released: %s.", order.OrderNo, order.ProductName, warning.Reason),
+		Type:         "warning",
+		Priority:     "high",
+		TargetRoles:  ppapWarningRoles,
+		IsPersistent: true,
+		ActionLabel:  "View warning",
+		ActionURL:    fmt.Sprintf("/ppap-warnings/%s", warning.ID),
+	}
+	if err := s.system.CreateSystemNotification(ctx, notification, userID); err != nil {
+		log.Printf("Failed to raise PPAP release notification for production order %s: %v", order.ID, err)
+	}
+}
+
+// editableSubmission loads a submission that is draft or rejected
+func (s *ppapService) editableSubmission(ctx context.Context, id uuid.UUID) (*models.PPAPSubmission, error) {
+	submission, err := s.GetSubmission(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if submission.Status != models.PPAPStatusDraft && submission.Status != models.PPAPStatusRejected {
+		return nil, ErrPPAPNotEditable
+	}
+	return submission, nil
+}
+
+func (s *ppapService) validateSubmission(ctx context.Context, submission *models.PPAPSubmission) error {
+	submission.CustomerPartNo = strings.TrimSpace(submission.CustomerPartNo)
+	if submission.CustomerPartNo == "" {
+		return fmt.Errorf("%w: customer part number is required", ErrInvalidPPAP)
+	}
+	if submission.Level < ppap.Level1 || submission.Level > ppap.Level5 {
+		return fmt.Errorf("%w: %v", ErrInvalidPPAP, ppap.ErrInvalidLevel)
+	}
+	switch submission.Reason {
+	case models.PPAPReasonInitial, models.PPAPReasonEngineeringChange, models.PPAPReasonTooling,
+		models.PPAPReasonCorrection, models.PPAPReasonSubcontractor, models.PPAPReasonProcess, models.PPAPReasonOther:
+	default:
+		return fmt.Errorf("%w: unknown reason %q", ErrInvalidPPAP, submission.Reason)
+	}
+
+	if _, err := s.customerRepo.GetByID(ctx, submission.CustomerID, submission.CompanyID); err != nil {
+		return fmt.Errorf("%w: unknown customer", ErrInvalidPPAP)
+	}
+	inventory, err := s.inventoryRepo.Get(submission.InventoryID)
+	if err != nil || inventory.CompanyID != submission.CompanyID {
+		return fmt.Errorf("%w: unknown part", ErrInvalidPPAP)
+	}
+	if submission.RouteID != nil {
+		route, err := s.productionRepo.GetProductionRoute(*submission.RouteID)
+		if err != nil || route.CompanyID != submission.CompanyID {
+			return fmt.Errorf("%w: unknown production route", ErrInvalidPPAP)
+		}
+		if route.InventoryID != nil && *route.InventoryID != submission.InventoryID {
+			return fmt.Errorf("%w: production route %s makes another part", ErrInvalidPPAP, route.RouteNo)
+		}
+	}
+	return nil
+}
+
+func findPPAPElement(submission *models.PPAPSubmission, number int) *models.PPAPElement {
+	for i := range submission.Elements {
+		if submission.Elements[i].Element == number {
+			return &submission.Elements[i]
+		}
+	}
+	return nil
+}
+
+// approvedPPAP returns the latest approval in force among submissions,
+// latest first, or else the latest interim approval that expired
+func approvedPPAP(submissions []*models.PPAPSubmission, now time.Time) (approved, expired *models.PPAPSubmission) {
+	today := now.Truncate(24 * time.Hour)
+	for _, submission := range submissions {
+		switch submission.Status {
+		case models.PPAPStatusApproved:
+			return submission, nil
+		case models.PPAPStatusInterimApproved:
+			if submission.InterimExpiresAt != nil && submission.InterimExpiresAt.Before(today) {
+				if expired == nil {
+					expired = submission
+				}
+				continue
+			}
+			return submission, nil
+		}
+	}
+	return nil, expired
+}
@@ -1,21 +1,31 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
+	"github.com/fastenmind/fastener-api/internal/infrastructure/costversion"
+	"github.com/fastenmind/fastener-api/internal/infrastructure/jobcost"
 	"github.com/fastenmind/fastener-api/internal/models"
 	"github.com/fastenmind/fastener-api/internal/repository"
 	"github.com/google/uuid"
 	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
 )
 
+// ErrInvalidEffectiveDate 新版本的生效日須晚於目前版本
+var ErrInvalidEffectiveDate = costversion.ErrInvalidEffectiveDate
+
 type ProcessCostService struct {
 	costRepo      *repository.ProcessCostRepository
 	materialRepo  *repository.MaterialRepository
 	equipmentRepo *repository.EquipmentRepository
 	exchangeRepo  *repository.ExchangeRateRepository
+	jobCost       JobCostService
 }
 
 func NewProcessCostService(
@@ -23,12 +33,14 @@ func NewProcessCostService(
 	materialRepo *repository.MaterialRepository,
 	equipmentRepo *repository.EquipmentRepository,
 	exchangeRepo *repository.ExchangeRateRepository,
+	jobCost JobCostService,
 ) *ProcessCostService {
 	return &ProcessCostService{
 		costRepo:      costRepo,
 		materialRepo:  materialRepo,
 		equipmentRepo: equipmentRepo,
 		exchangeRepo:  exchangeRepo,
+		jobCost:       jobCost,
 	}
 }
 
@@ -44,22 +56,27 @@ func (s *ProcessCostService) GetCostTemplates(companyID, processType, category s
 	var newTemplates []models.ProcessCostTemplateNew
 	for _, t := range templates {
 		newTemplates = append(newTemplates, models.ProcessCostTemplateNew{
-			ID:          t.ID,
-			CompanyID:   t.CompanyID,
-			ProcessType: t.ProcessType,
-			Category:    t.Category,
-			Name:        t.Name,
-			Description: t.Description,
-			BaseRate:    t.BaseRate,
-			SetupCost:   t.SetupCost,
-			MinQuantity: t.MinQuantity,
-			MaxQuantity: t.MaxQuantity,
-			Unit:        t.Unit,
-			IsActive:    t.IsActive,
-			CreatedBy:   t.CreatedBy,
-			UpdatedBy:   t.UpdatedBy,
-			CreatedAt:   t.CreatedAt,
-			UpdatedAt:   t.UpdatedAt,
+			ID:           t.ID,
+			CompanyID:    t.CompanyID,
+			ProcessType:  t.ProcessType,
+			Category:     t.Category,
+			Name:         t.Name,
+			Description:  t.Description,
+			BaseRate:     t.BaseRate,
+			SetupCost:    t.SetupCost,
+			MinQuantity:  t.MinQuantity,
+			MaxQuantity:  t.MaxQuantity,
+			Unit:         t.Unit,
+			Version:      t.Version,
+			SupersedesID: t.SupersedesID,
+			SuggestionID: t.SuggestionID,
+			ValidFrom:    t.ValidFrom,
+			ValidTo:      t.ValidTo,
+			IsActive:     t.IsActive,
+			CreatedBy:    t.CreatedBy,
+			UpdatedBy:    t.UpdatedBy,
+			CreatedAt:    t.CreatedAt,
+			UpdatedAt:    t.UpdatedAt,
 		})
 	}
 	
@@ -75,6 +92,11 @@ func (s *ProcessCostService) CreateCostTemplate(template *models.ProcessCostTemp
 	template.CreatedAt = time.Now()
 	template.UpdatedAt = time.Now()
 	template.IsActive = true
+	template.Version = 1
+	template.SupersedesID = ""
+	template.SuggestionID = ""
+	template.ValidFrom = effectiveFrom(template.ValidFrom)
+	template.ValidTo = nil
 	
 	// 驗證模板參數
 	if err := s.validateCostTemplate(template); err != nil {
@@ -94,6 +116,8 @@ func (s *ProcessCostService) CreateCostTemplate(template *models.ProcessCostTemp
 		MinQuantity: template.MinQuantity,
 		MaxQuantity: template.MaxQuantity,
 		Unit:        template.Unit,
+		Version:     template.Version,
+		ValidFrom:   template.ValidFrom,
 		IsActive:    template.IsActive,
 		CreatedBy:   template.CreatedBy,
 		UpdatedBy:   template.UpdatedBy,
@@ -108,51 +132,71 @@ func (s *ProcessCostService) CreateCostTemplate(template *models.ProcessCostTemp
 	return template, nil
 }
 
-// UpdateCostTemplate 更新成本模板
+// UpdateCostTemplate 更新成本模板：結束目前版本並建立自 valid_from（預設現在）起生效的新版本
 func (s *ProcessCostService) UpdateCostTemplate(templateID string, template *models.ProcessCostTemplateNew, companyID, userID string) (*models.ProcessCostTemplateNew, error) {
 	existing, err := s.costRepo.GetTemplateByID(templateID, companyID)
 	if err != nil {
 		return nil, err
 	}
 	
-	// 更新欄位
-	existing.Name = template.Name
-	existing.Description = template.Description
-	existing.ProcessType = template.ProcessType
-	existing.Category = template.Category
-	existing.BaseRate = template.BaseRate
-	existing.SetupCost = template.SetupCost
-	existing.MinQuantity = template.MinQuantity
-	existing.MaxQuantity = template.MaxQuantity
-	existing.Unit = template.Unit
-	existing.UpdatedBy = userID
-	existing.UpdatedAt = time.Now()
+	effective := effectiveFrom(template.ValidFrom)
+	if err := costversion.CheckRevision(costversion.Version{ValidFrom: existing.ValidFrom, ValidTo: existing.ValidTo}, effective); err != nil {
+		return nil, err
+	}
 	
-	// 轉換為 ProcessCostTemplate 以更新
-	oldTemplate := &models.ProcessCostTemplate{
-		ID:          existing.ID,
-		CompanyID:   existing.CompanyID,
-		ProcessType: existing.ProcessType,
-		Category:    existing.Category,
-		Name:        existing.Name,
-		Description: existing.Description,
-		BaseRate:    existing.BaseRate,
-		SetupCost:   existing.SetupCost,
-		MinQuantity: existing.MinQuantity,
-		MaxQuantity: existing.MaxQuantity,
-		Unit:        existing.Unit,
-		IsActive:    existing.IsActive,
-		CreatedBy:   existing.CreatedBy,
-		UpdatedBy:   existing.UpdatedBy,
-		CreatedAt:   existing.CreatedAt,
-		UpdatedAt:   existing.UpdatedAt,
-	}
-	
-	if err := s.costRepo.UpdateTemplate(oldTemplate); err != nil {
+	now := time.Now()
+	next := &models.ProcessCostTemplate{
+		ID:           uuid.New().String(),
+		CompanyID:    existing.CompanyID,
+		ProcessType:  template.ProcessType,
+		Category:     template.Category,
+		Name:         template.Name,
+		Description:  template.Description,
+		BaseRate:     template.BaseRate,
+		SetupCost:    template.SetupCost,
+		MinQuantity:  template.MinQuantity,
+		MaxQuantity:  template.MaxQuantity,
+		Unit:         template.Unit,
+		Version:      costversion.NextNumber(existing.Version),
+		SupersedesID: existing.ID,
+		ValidFrom:    effective,
+		IsActive:     existing.IsActive,
+		CreatedBy:    userID,
+		UpdatedBy:    userID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	
+	if err := s.costRepo.ReviseTemplate(existing.ID, next); err != nil {
 		return nil, err
 	}
 	
-	return existing, nil
+	return &models.ProcessCostTemplateNew{
+		ID:           next.ID,
+		CompanyID:    next.CompanyID,
+		ProcessType:  next.ProcessType,
+		Category:     next.Category,
+		Name:         next.Name,
+		Description:  next.Description,
+		BaseRate:     next.BaseRate,
+		SetupCost:    next.SetupCost,
+		MinQuantity:  next.MinQuantity,
+		MaxQuantity:  next.MaxQuantity,
+		Unit:         next.Unit,
+		Version:      next.Version,
+		SupersedesID: next.SupersedesID,
+		ValidFrom:    next.ValidFrom,
+		IsActive:     next.IsActive,
+		CreatedBy:    next.CreatedBy,
+		UpdatedBy:    next.UpdatedBy,
+		CreatedAt:    next.CreatedAt,
+		UpdatedAt:    next.UpdatedAt,
+	}, nil
+}
+
+// GetCostTemplateVersions 獲取成本模板的所有版本
+func (s *ProcessCostService) GetCostTemplateVersions(templateID, companyID string) ([]models.ProcessCostTemplateNew, error) {
+	return s.costRepo.GetTemplateVersions(templateID, companyID)
 }
 
 // DeleteCostTemplate 刪除成本模板
@@ -160,17 +204,25 @@ func (s *ProcessCostService) DeleteCostTemplate(templateID, companyID string) er
 	return s.costRepo.DeleteTemplate(templateID, companyID)
 }
 
-// CalculateProcessCost 計算製程成本
+// CalculateProcessCost 計算製程成本，使用 as_of（預設現在）當日有效的模板與費率版本，
+// 並記錄所使用的版本
 func (s *ProcessCostService) CalculateProcessCost(req *models.ProcessCostCalculationRequestNew, companyID string) (*models.ProcessCostResult, error) {
+	asOf := time.Now()
+	if req.AsOf != nil && !req.AsOf.IsZero() {
+		asOf = *req.AsOf
+	}
+	
 	result := &models.ProcessCostResult{
 		ID:            uuid.New().String(),
 		CalculationNo: fmt.Sprintf("CALC-%s", time.Now().Format("20060102150405")),
 		ProductName:   req.ProductName,
 		Quantity:      req.Quantity,
+		AsOf:          asOf,
+		RateVersions:  []models.RateVersionPin{},
 	}
 	
 	// 1. 計算材料成本
-	materialCost, materialDetails, err := s.calculateMaterialCost(req, companyID)
+	materialCost, materialDetails, err := s.calculateMaterialCost(req, companyID, asOf, &result.RateVersions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate material cost: %w", err)
 	}
@@ -178,7 +230,7 @@ func (s *ProcessCostService) CalculateProcessCost(req *models.ProcessCostCalcula
 	result.CostBreakdown = append(result.CostBreakdown, materialDetails...)
 	
 	// 2. 計算加工成本
-	processingCost, processingDetails, err := s.calculateProcessingCost(req, companyID)
+	processingCost, processingDetails, err := s.calculateProcessingCost(req, companyID, asOf, &result.RateVersions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate processing cost: %w", err)
 	}
@@ -187,7 +239,7 @@ func (s *ProcessCostService) CalculateProcessCost(req *models.ProcessCostCalcula
 	
 	// 3. 計算表面處理成本
 	if req.SurfaceTreatment != "" {
-		surfaceCost, surfaceDetails, err := s.calculateSurfaceTreatmentCost(req, companyID)
+		surfaceCost, surfaceDetails, err := s.calculateSurfaceTreatmentCost(req, companyID, asOf, &result.RateVersions)
 		if err != nil {
 			return nil, fmt.Errorf("failed to calculate surface treatment cost: %w", err)
 		}
@@ -200,14 +252,19 @@ func (s *ProcessCostService) CalculateProcessCost(req *models.ProcessCostCalcula
 	// 將包裝成本加入到 OverheadCost
 	result.CostBreakdown = append(result.CostBreakdown, packagingDetails...)
 	
-	// 5. 計算管理費用
-	result.OverheadCost = (result.MaterialCost + result.ProcessCost) * req.OverheadRate / 100 + packagingCost
+	// 5. 計算管理費用：請求未指定費率時使用當日有效的管理費率
+	overheadCost, overheadNotes, err := s.calculateOverheadCost(req, companyID, asOf, result, &result.RateVersions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate overhead cost: %w", err)
+	}
+	result.OverheadCost = overheadCost + packagingCost
 	result.CostBreakdown = append(result.CostBreakdown, models.CostDetail{
 		Category:    "overhead",
 		Description: "管理費用",
 		UnitCost:    result.OverheadCost / float64(req.Quantity),
 		Quantity:    float64(req.Quantity),
 		TotalCost:   result.OverheadCost,
+		Notes:       overheadNotes,
 	})
 	
 	// 6. 計算總成本
@@ -243,14 +300,35 @@ func (s *ProcessCostService) CalculateProcessCost(req *models.ProcessCostCalcula
 }
 
 // calculateMaterialCost 計算材料成本
-func (s *ProcessCostService) calculateMaterialCost(req *models.ProcessCostCalculationRequestNew, companyID string) (float64, []models.CostDetail, error) {
-	// 簡化版本：使用預設值
-	weight := 1.0 // 預設重量 1kg
+func (s *ProcessCostService) calculateMaterialCost(req *models.ProcessCostCalculationRequestNew, companyID string, asOf time.Time, pins *[]models.RateVersionPin) (float64, []models.CostDetail, error) {
+	weight := productWeight(req) // 預設重量 1kg
 	unitPrice := 10.0 // 預設單價 $10/kg
-	
-	// 從 product spec 中獲取重量（如果有的話）
-	if spec, ok := req.ProductSpec["weight"].(float64); ok {
-		weight = spec
+	notes := "預設材料單價"
+	
+	// 使用當日有效的材料成本版本
+	if req.MaterialID != "" {
+		material, err := s.materialRepo.GetVersionAt(req.MaterialID, companyID, asOf)
+		switch {
+		case err == nil:
+			price := material.UnitCost
+			if price <= 0 {
+				price = material.UnitPrice
+			}
+			if price > 0 {
+				unitPrice = price
+				notes = ""
+				*pins = append(*pins, models.RateVersionPin{
+					Kind:      models.RateKindMaterial,
+					ID:        material.ID,
+					Key:       material.MaterialCode,
+					Version:   material.Version,
+					ValidFrom: material.ValidFrom,
+					Value:     price,
+				})
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return 0, nil, err
+		}
 	}
 	
 	// 計算材料成本
@@ -268,79 +346,204 @@ func (s *ProcessCostService) calculateMaterialCost(req *models.ProcessCostCalcul
 			UnitCost:    unitPrice,
 			Quantity:    weight * float64(req.Quantity),
 			TotalCost:   materialCost,
+			Notes:       notes,
 		},
 	}
 	
 	return materialCost, details, nil
 }
 
-// calculateProcessingCost 計算加工成本
-func (s *ProcessCostService) calculateProcessingCost(req *models.ProcessCostCalculationRequestNew, companyID string) (float64, []models.CostDetail, error) {
+// calculateProcessingCost 計算加工成本：依序使用製程指定的時薪、模板（template_id）、
+// 當日有效的加工費率（process_type、equipment_id），最後才是預設費率
+func (s *ProcessCostService) calculateProcessingCost(req *models.ProcessCostCalculationRequestNew, companyID string, asOf time.Time, pins *[]models.RateVersionPin) (float64, []models.CostDetail, error) {
 	totalCost := 0.0
 	details := make([]models.CostDetail, 0)
 	
 	for i, process := range req.Processes {
-		// 簡化版本：使用預設費率
 		hourlyRate := 50.0 // 預設每小時 $50
 		processingTime := 0.5 // 預設加工時間 0.5 小時
+		notes := ""
 		
 		// 從 process 中獲取參數（如果有的話）
 		if time, ok := process["processing_time"].(float64); ok {
 			processingTime = time
 		}
-		if rate, ok := process["hourly_rate"].(float64); ok {
-			hourlyRate = rate
-		}
-		
-		// 計算加工成本
-		processCost := processingTime * hourlyRate * float64(req.Quantity)
-		
-		totalCost += processCost
+		processType, _ := process["process_type"].(string)
+		equipmentID, _ := process["equipment_id"].(string)
+		templateID, _ := process["template_id"].(string)
 		
 		processName := "Process"
 		if name, ok := process["name"].(string); ok {
 			processName = name
 		}
 		
+		var processCost float64
+		rate, hasRate := process["hourly_rate"].(float64)
+		switch {
+		case hasRate:
+			hourlyRate = rate
+			processCost = processingTime * hourlyRate * float64(req.Quantity)
+		case templateID != "":
+			template, err := s.costRepo.GetTemplateAt(templateID, companyID, asOf)
+			if err != nil {
+				return 0, nil, fmt.Errorf("template %s not valid on %s: %w", templateID, asOf.Format("2006-01-02"), err)
+			}
+			hourlyRate = template.BaseRate
+			if hourlyTemplateUnits[strings.ToLower(template.Unit)] {
+				processCost = processingTime * template.BaseRate * float64(req.Quantity)
+			} else {
+				processCost = template.BaseRate * float64(req.Quantity)
+			}
+			*pins = append(*pins, models.RateVersionPin{
+				Kind:      models.RateKindTemplate,
+				ID:        template.ID,
+				Key:       template.ProcessType,
+				Version:   template.Version,
+				ValidFrom: template.ValidFrom,
+				Value:     template.BaseRate,
+			})
+		default:
+			notes = "預設時薪"
+			if processType != "" {
+				found, err := s.costRepo.GetProcessingRateAt(processType, equipmentID, companyID, asOf)
+				switch {
+				case err == nil:
+					hourlyRate = found.HourlyRate
+					notes = ""
+					*pins = append(*pins, models.RateVersionPin{
+						Kind:      models.RateKindProcessingRate,
+						ID:        found.ID,
+						Key:       found.ProcessType,
+						Version:   found.Version,
+						ValidFrom: found.ValidFrom,
+						Value:     found.HourlyRate,
+					})
+				case !errors.Is(err, gorm.ErrRecordNotFound):
+					return 0, nil, err
+				}
+			}
+			processCost = processingTime * hourlyRate * float64(req.Quantity)
+		}
+		
+		totalCost += processCost
+		
 		details = append(details, models.CostDetail{
 			Category:    "processing",
 			Description: fmt.Sprintf("%s #%d (%.2f小時)", processName, i+1, processingTime),
 			UnitCost:    hourlyRate,
 			Quantity:    processingTime * float64(req.Quantity),
 			TotalCost:   processCost,
+			Notes:       notes,
 		})
 	}
 	
 	return totalCost, details, nil
 }
 
-// calculateSurfaceTreatmentCost 計算表面處理成本
-func (s *ProcessCostService) calculateSurfaceTreatmentCost(req *models.ProcessCostCalculationRequestNew, companyID string) (float64, []models.CostDetail, error) {
-	// 簡化版本：使用預設費率
-	unitPrice := 5.0 // 預設每平方公分 $5
-	
+// calculateSurfaceTreatmentCost 計算表面處理成本：使用當日有效的表面處理費率，沒有費率時才用預設費率
+func (s *ProcessCostService) calculateSurfaceTreatmentCost(req *models.ProcessCostCalculationRequestNew, companyID string, asOf time.Time, pins *[]models.RateVersionPin) (float64, []models.CostDetail, error) {
 	// 計算表面積（簡化版本）
 	surfaceArea := 100.0 // 預設 100 平方公分
 	if area, ok := req.ProductSpec["surface_area"].(float64); ok {
 		surfaceArea = area
 	}
 	
-	// 計算成本
-	cost := surfaceArea * unitPrice * float64(req.Quantity)
+	rate, err := s.costRepo.GetSurfaceTreatmentRateAt(req.SurfaceTreatment, companyID, asOf)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil, err
+	}
+	if err != nil {
+		// 簡化版本：使用預設費率
+		unitPrice := 5.0 // 預設每平方公分 $5
+		cost := surfaceArea * unitPrice * float64(req.Quantity)
+		return cost, []models.CostDetail{
+			{
+				Category:    "surface_treatment",
+				Description: fmt.Sprintf("%s (%.2f平方公分)", req.SurfaceTreatment, surfaceArea),
+				UnitCost:    unitPrice,
+				Quantity:    surfaceArea * float64(req.Quantity),
+				TotalCost:   cost,
+				Notes:       "預設表面處理費率",
+			},
+		}, nil
+	}
+	
+	billed, cost, minimum := costversion.SurfaceCharge(costversion.SurfaceRate{
+		BaseRate:  rate.BaseRate,
+		Unit:      rate.Unit,
+		MinCharge: rate.MinCharge,
+	}, req.Quantity, productWeight(req), surfaceArea)
+	
+	description := fmt.Sprintf("%s (%d件)", rate.TreatmentName, req.Quantity)
+	switch rate.Unit {
+	case "per_kg":
+		description = fmt.Sprintf("%s (%.2fkg)", rate.TreatmentName, billed)
+	case "per_m2":
+		description = fmt.Sprintf("%s (%.4f平方公尺)", rate.TreatmentName, billed)
+	}
+	notes := ""
+	if minimum {
+		notes = "最低收費"
+	}
+	
+	*pins = append(*pins, models.RateVersionPin{
+		Kind:      models.RateKindSurfaceTreatment,
+		ID:        rate.ID,
+		Key:       rate.TreatmentType,
+		Version:   rate.Version,
+		ValidFrom: rate.ValidFrom,
+		Value:     rate.BaseRate,
+	})
 	
 	details := []models.CostDetail{
 		{
 			Category:    "surface_treatment",
-			Description: fmt.Sprintf("%s (%.2f平方公分)", req.SurfaceTreatment, surfaceArea),
-			UnitCost:    unitPrice,
-			Quantity:    surfaceArea * float64(req.Quantity),
+			Description: description,
+			Unit:        rate.Unit,
+			UnitCost:    rate.BaseRate,
+			Quantity:    billed,
 			TotalCost:   cost,
+			Notes:       notes,
 		},
 	}
 	
 	return cost, details, nil
 }
 
+// calculateOverheadCost 計算管理費用（不含包裝）：請求指定 overhead_rate 時依材料加工成本計算，
+// 否則加總當日有效的各部門管理費率
+func (s *ProcessCostService) calculateOverheadCost(req *models.ProcessCostCalculationRequestNew, companyID string, asOf time.Time, result *models.ProcessCostResult, pins *[]models.RateVersionPin) (float64, string, error) {
+	if req.OverheadRate > 0 {
+		return (result.MaterialCost + result.ProcessCost) * req.OverheadRate / 100, "", nil
+	}
+	
+	rates, err := s.costRepo.GetOverheadRatesAt(companyID, asOf)
+	if err != nil {
+		return 0, "", err
+	}
+	if len(rates) == 0 {
+		return 0, "無有效管理費率", nil
+	}
+	
+	applied := make([]costversion.OverheadRate, len(rates))
+	for i, rate := range rates {
+		applied[i] = costversion.OverheadRate{RateType: rate.RateType, RateValue: rate.RateValue, BasedOn: rate.BasedOn}
+		*pins = append(*pins, models.RateVersionPin{
+			Kind:      models.RateKindOverheadRate,
+			ID:        rate.ID,
+			Key:       rate.Department,
+			Version:   rate.Version,
+			ValidFrom: rate.ValidFrom,
+			Value:     rate.RateValue,
+		})
+	}
+	return costversion.Overhead(applied, costversion.CostBase{
+		Material: result.MaterialCost,
+		Process:  result.ProcessCost,
+		Surface:  result.SurfaceCost,
+	}), "", nil
+}
+
 // calculatePackagingCost 計算包裝成本
 func (s *ProcessCostService) calculatePackagingCost(req *models.ProcessCostCalculationRequestNew) (float64, []models.CostDetail) {
 	// 簡化的包裝成本計算
@@ -372,25 +575,45 @@ func (s *ProcessCostService) GetMaterialCosts(companyID, materialType string, pa
 	return s.materialRepo.GetMaterials(companyID, materialType, offset, limit)
 }
 
-// UpdateMaterialCost 更新材料成本
+// UpdateMaterialCost 更新材料成本：結束目前版本並建立自 valid_from（預設現在）起生效的新版本
 func (s *ProcessCostService) UpdateMaterialCost(materialID string, material *models.MaterialCostNew, companyID, userID string) (*models.MaterialCostNew, error) {
 	existing, err := s.materialRepo.GetByID(materialID, companyID)
 	if err != nil {
 		return nil, err
 	}
 	
-	// 更新基本欄位
-	existing.UnitPrice = material.UnitPrice
-	existing.Currency = material.Currency
-	existing.Supplier = material.Supplier
-	existing.UpdatedBy = userID
-	existing.UpdatedAt = time.Now()
+	effective := effectiveFrom(material.ValidFrom)
+	if err := costversion.CheckRevision(costversion.Version{ValidFrom: existing.ValidFrom, ValidTo: existing.ValidTo}, effective); err != nil {
+		return nil, err
+	}
 	
-	if err := s.materialRepo.Update(existing); err != nil {
+	next := *existing
+	next.ID = uuid.New().String()
+	next.UnitPrice = material.UnitPrice
+	if material.UnitCost > 0 {
+		next.UnitCost = material.UnitCost
+	}
+	next.Currency = material.Currency
+	next.Supplier = material.Supplier
+	next.ValidFrom = effective
+	next.ValidTo = nil
+	next.Version = costversion.NextNumber(existing.Version)
+	next.SupersedesID = existing.ID
+	next.CreatedBy = userID
+	next.UpdatedBy = userID
+	next.CreatedAt = time.Now()
+	next.UpdatedAt = time.Now()
+	
+	if err := s.materialRepo.Revise(existing.ID, &next); err != nil {
 		return nil, err
 	}
 	
-	return existing, nil
+	return &next, nil
+}
+
+// GetMaterialCostVersions 獲取材料成本的所有版本
+func (s *ProcessCostService) GetMaterialCostVersions(materialID, companyID string) ([]models.MaterialCostNew, error) {
+	return s.materialRepo.GetVersions(materialID, companyID)
 }
 
 // GetProcessingRates 獲取加工費率
@@ -398,23 +621,136 @@ func (s *ProcessCostService) GetProcessingRates(companyID, processType, equipmen
 	return s.costRepo.GetProcessingRates(companyID, processType, equipmentID)
 }
 
-// UpdateProcessingRate 更新加工費率
+// UpdateProcessingRate 更新加工費率：結束目前版本並建立自 valid_from（預設現在）起生效的新版本
 func (s *ProcessCostService) UpdateProcessingRate(rateID string, rate *models.ProcessingRate, companyID, userID string) (*models.ProcessingRate, error) {
 	existing, err := s.costRepo.GetProcessingRateByID(rateID, companyID)
 	if err != nil {
 		return nil, err
 	}
 	
-	existing.HourlyRate = rate.HourlyRate
-	existing.SetupRate = rate.SetupRate
-	existing.UpdatedBy = userID
-	existing.UpdatedAt = time.Now()
+	effective := effectiveFrom(rate.ValidFrom)
+	if err := costversion.CheckRevision(costversion.Version{ValidFrom: existing.ValidFrom, ValidTo: existing.ValidTo}, effective); err != nil {
+		return nil, err
+	}
 	
-	if err := s.costRepo.UpdateProcessingRate(existing); err != nil {
+	next := *existing
+	next.ID = uuid.New().String()
+	next.HourlyRate = rate.HourlyRate
+	next.SetupRate = rate.SetupRate
+	next.ValidFrom = effective
+	next.ValidTo = nil
+	next.Version = costversion.NextNumber(existing.Version)
+	next.SupersedesID = existing.ID
+	next.CreatedBy = userID
+	next.UpdatedBy = userID
+	next.CreatedAt = time.Now()
+	next.UpdatedAt = time.Now()
+	
+	if err := s.costRepo.ReviseProcessingRate(existing.ID, &next); err != nil {
 		return nil, err
 	}
 	
-	return existing, nil
+	return &next, nil
+}
+
+// GetProcessingRateVersions 獲取加工費率的所有版本
+func (s *ProcessCostService) GetProcessingRateVersions(rateID, companyID string) ([]models.ProcessingRate, error) {
+	return s.costRepo.GetProcessingRateVersions(rateID, companyID)
+}
+
+// GetSurfaceTreatmentRates 獲取表面處理費率
+func (s *ProcessCostService) GetSurfaceTreatmentRates(companyID, treatmentType string) ([]models.SurfaceTreatmentRate, error) {
+	return s.costRepo.GetSurfaceTreatmentRates(companyID, treatmentType)
+}
+
+// UpdateSurfaceTreatmentRate 更新表面處理費率：結束目前版本並建立自 valid_from（預設現在）起生效的新版本
+func (s *ProcessCostService) UpdateSurfaceTreatmentRate(rateID string, rate *models.SurfaceTreatmentRate, companyID, userID string) (*models.SurfaceTreatmentRate, error) {
+	existing, err := s.costRepo.GetSurfaceTreatmentRateByID(rateID, companyID)
+	if err != nil {
+		return nil, err
+	}
+	
+	effective := effectiveFrom(rate.ValidFrom)
+	if err := costversion.CheckRevision(costversion.Version{ValidFrom: existing.ValidFrom, ValidTo: existing.ValidTo}, effective); err != nil {
+		return nil, err
+	}
+	
+	next := *existing
+	next.ID = uuid.New().String()
+	if rate.TreatmentName != "" {
+		next.TreatmentName = rate.TreatmentName
+	}
+	if rate.Unit != "" {
+		next.Unit = rate.Unit
+	}
+	next.BaseRate = rate.BaseRate
+	next.MinCharge = rate.MinCharge
+	next.ValidFrom = effective
+	next.ValidTo = nil
+	next.Version = costversion.NextNumber(existing.Version)
+	next.SupersedesID = existing.ID
+	next.CreatedBy = userID
+	next.UpdatedBy = userID
+	next.CreatedAt = time.Now()
+	next.UpdatedAt = time.Now()
+	
+	if err := s.costRepo.ReviseSurfaceTreatmentRate(existing.ID, &next); err != nil {
+		return nil, err
+	}
+	
+	return &next, nil
+}
+
+// GetSurfaceTreatmentRateVersions 獲取表面處理費率的所有版本
+func (s *ProcessCostService) GetSurfaceTreatmentRateVersions(rateID, companyID string) ([]models.SurfaceTreatmentRate, error) {
+	return s.costRepo.GetSurfaceTreatmentRateVersions(rateID, companyID)
+}
+
+// GetOverheadRates 獲取管理費率
+func (s *ProcessCostService) GetOverheadRates(companyID, department string) ([]models.OverheadRate, error) {
+	return s.costRepo.GetOverheadRates(companyID, department)
+}
+
+// UpdateOverheadRate 更新管理費率：結束目前版本並建立自 valid_from（預設現在）起生效的新版本
+func (s *ProcessCostService) UpdateOverheadRate(rateID string, rate *models.OverheadRate, companyID, userID string) (*models.OverheadRate, error) {
+	existing, err := s.costRepo.GetOverheadRateByID(rateID, companyID)
+	if err != nil {
+		return nil, err
+	}
+	
+	effective := effectiveFrom(rate.ValidFrom)
+	if err := costversion.CheckRevision(costversion.Version{ValidFrom: existing.ValidFrom, ValidTo: existing.ValidTo}, effective); err != nil {
+		return nil, err
+	}
+	
+	next := *existing
+	next.ID = uuid.New().String()
+	if rate.RateType != "" {
+		next.RateType = rate.RateType
+	}
+	if rate.BasedOn != "" {
+		next.BasedOn = rate.BasedOn
+	}
+	next.RateValue = rate.RateValue
+	next.ValidFrom = effective
+	next.ValidTo = nil
+	next.Version = costversion.NextNumber(existing.Version)
+	next.SupersedesID = existing.ID
+	next.CreatedBy = userID
+	next.UpdatedBy = userID
+	next.CreatedAt = time.Now()
+	next.UpdatedAt = time.Now()
+	
+	if err := s.costRepo.ReviseOverheadRate(existing.ID, &next); err != nil {
+		return nil, err
+	}
+	
+	return &next, nil
+}
+
+// GetOverheadRateVersions 獲取管理費率的所有版本
+func (s *ProcessCostService) GetOverheadRateVersions(rateID, companyID string) ([]models.OverheadRate, error) {
+	return s.costRepo.GetOverheadRateVersions(rateID, companyID)
 }
 
 // BatchCalculateCost 批量計算成本
@@ -466,9 +802,64 @@ func (s *ProcessCostService) GetCostAnalysis(companyID, analysisType, period, st
 		{Factor: "Overhead Cost", Impact: 0.1, Percentage: 10, Description: "Minor cost driver"},
 	}
 	
+	// 實際成本差異：已完工製令與報價估算比較
+	if id, err := uuid.Parse(companyID); err == nil {
+		from, to := analysisDateRange(startDate, endDate)
+		summary, err := s.jobCost.SummarizeVariances(context.Background(), id, from, to)
+		if err != nil {
+			return nil, err
+		}
+		analysis.JobsCosted = summary.Jobs
+		for _, d := range summary.Drivers {
+			analysis.VarianceDrivers = append(analysis.VarianceDrivers, models.CostVariance{
+				Driver:       d.Driver,
+				Jobs:         d.Jobs,
+				Estimated:    d.Estimated,
+				Actual:       d.Actual,
+				Variance:     d.Variance,
+				Percentage:   d.Percent,
+				Factor:       d.Factor,
+				Unfavourable: d.Unfavourable,
+				Description:  describeCostVariance(d),
+			})
+		}
+	}
+	
 	return analysis, nil
 }
 
+// analysisDateRange 解析分析期間，結束日包含當日
+func analysisDateRange(startDate, endDate string) (*time.Time, *time.Time) {
+	var from, to *time.Time
+	if t, err := time.Parse("2006-01-02", startDate); err == nil {
+		from = &t
+	}
+	if t, err := time.Parse("2006-01-02", endDate); err == nil {
+		t = t.AddDate(0, 0, 1)
+		to = &t
+	}
+	return from, to
+}
+
+// describeCostVariance 說明成本差異及建議的模板調整
+func describeCostVariance(d jobcost.DriverSummary) string {
+	direction := "over"
+	if d.Variance < 0 {
+		direction = "under"
+	}
+	switch d.Driver {
+	case jobcost.DriverLaborRate:
+		return fmt.Sprintf("Hourly costs ran %.2f %s estimate on %d jobs; review processing rates", math.Abs(d.Variance), direction, d.Jobs)
+	case jobcost.DriverLaborEfficiency:
+		return fmt.Sprintf("Hours taken ran %.2f %s estimate on %d jobs; review setup and cycle times", math.Abs(d.Variance), direction, d.Jobs)
+	}
+	text := fmt.Sprintf("%s cost %.2f%% %s estimate, %d of %d jobs over", d.Driver, math.Abs(d.Percent), direction, d.Unfavourable, d.Jobs)
+	if d.Factor > 0 && d.Driver != jobcost.DriverTotal {
+		text += fmt.Sprintf("; multiply template rates by %.4f", d.Factor)
+	}
+	return text
+}
+
 // ExportCostReport 導出成本報告
 func (s *ProcessCostService) ExportCostReport(companyID, format, reportType, startDate, endDate string) ([]byte, string, error) {
 	// 獲取報告數據
@@ -529,6 +920,22 @@ func (s *ProcessCostService) UpdateCostSettings(settings *models.CostSettings, c
 
 // 輔助函數
 
+// effectiveFrom 新版本生效日，未指定時為現在
+func effectiveFrom(validFrom time.Time) time.Time {
+	if validFrom.IsZero() {
+		return time.Now()
+	}
+	return validFrom
+}
+
+// productWeight 產品單件重量（kg），未提供時預設 1kg
+func productWeight(req *models.ProcessCostCalculationRequestNew) float64 {
+	if weight, ok := req.ProductSpec["weight"].(float64); ok && weight > 0 {
+		return weight
+	}
+	return 1.0
+}
+
 func (s *ProcessCostService) validateCostTemplate(template *models.ProcessCostTemplateNew) error {
 	if template.Name == "" {
 		return errors.New("template name is required")
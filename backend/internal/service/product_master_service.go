@@ -0,0 +1,574 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/fastenerspec"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/fastenmind/fastener-api/pkg/resources"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrCustomerPartNotFound is returned for unknown customer parts
+	ErrCustomerPartNotFound = errors.New("customer part not found")
+	// ErrInvalidCustomerPart is returned for customer parts without a
+	// customer, part number or inventory item of the company
+	ErrInvalidCustomerPart = errors.New("invalid customer part")
+	// ErrDuplicateCustomerPart is returned when the customer already has a
+	// part with the number
+	ErrDuplicateCustomerPart = errors.New("customer part number already exists")
+	// ErrInvalidFastenerSpec is returned for specifications with an unknown
+	// standard or a size, length or grade the standard does not use
+	ErrInvalidFastenerSpec = fastenerspec.ErrInvalidSpec
+	// ErrInventoryItemNotFound is returned for specifications of unknown
+	// inventory items
+	ErrInventoryItemNotFound = errors.New("inventory item not found")
+	// ErrFastenerSpecNotFound is returned for inventory items without a
+	// specification
+	ErrFastenerSpecNotFound = errors.New("fastener specification not found")
+	// ErrDrawingNotFound is returned for unknown drawing revisions
+	ErrDrawingNotFound = errors.New("drawing revision not found")
+	// ErrInvalidDrawing is returned for drawings without a revision or file
+	ErrInvalidDrawing = errors.New("invalid drawing revision")
+	// ErrDrawingRevisionExists is returned when uploading a revision the
+	// part already has
+	ErrDrawingRevisionExists = errors.New("drawing revision already exists")
+	// ErrDrawingRevisionNotNewer is returned when uploading a revision
+	// before the part's current one
+	ErrDrawingRevisionNotNewer = errors.New("drawing revision is not newer than the current revision")
+	// ErrRevisionFlagNotFound is returned for unknown revision change flags
+	ErrRevisionFlagNotFound = errors.New("revision change flag not found")
+	// ErrRevisionFlagResolved is returned when resolving a flag twice
+	ErrRevisionFlagResolved = repository.ErrRevisionFlagResolved
+	// ErrInvalidRevisionResolution is returned for resolutions other than
+	// update and accept, and for accepting without a note
+	ErrInvalidRevisionResolution = errors.New("invalid revision change resolution")
+)
+
+// revisionChangeRoles are notified when a drawing revision flags open
+// quotes and orders
+const revisionChangeRoles = `["manager","engineer","sales"]`
+
+// maxRevisionLength is the length of the drawing revision column of quote
+// items
+const maxRevisionLength = 20
+
+// Revision change resolutions
+const (
+	RevisionResolutionUpdate = "update" // move the document to the new revision
+	RevisionResolutionAccept = "accept" // keep the document on its revision
+)
+
+// ProductMasterService keeps the product master: fastener specifications of
+// inventory items, the numbers customers know our parts by, and the
+// revision history of their drawings. A new drawing revision flags the open
+// quotes, orders and production orders of the part made to another
+// revision until each is moved to the new revision or accepted as is.
+type ProductMasterService interface {
+	// Specifications
+
+	// ListStandards returns the product standards known
+	ListStandards() []fastenerspec.Standard
+	// SaveSpecification sets the specification of an inventory item
+	SaveSpecification(ctx context.Context, req *FastenerSpecRequest) (*models.FastenerSpecification, error)
+	GetSpecification(ctx context.Context, inventoryID uuid.UUID) (*models.FastenerSpecification, error)
+	// ListSpecifications searches the specification library; a standard
+	// also finds its equivalents, so DIN 933 finds ISO 4017
+	ListSpecifications(ctx context.Context, params map[string]interface{}) ([]*models.FastenerSpecification, int64, error)
+
+	// Customer parts
+
+	CreatePart(ctx context.Context, req *CustomerPartRequest, userID uuid.UUID) (*models.CustomerPart, error)
+	UpdatePart(ctx context.Context, id uuid.UUID, req *CustomerPartRequest) (*models.CustomerPart, error)
+	GetPart(ctx context.Context, id uuid.UUID) (*models.CustomerPart, error)
+	// ResolvePart maps a customer's part number to our inventory item, with
+	// its current drawing revision and specification
+	ResolvePart(ctx context.Context, companyID, customerID uuid.UUID, partNo string) (*models.CustomerPart, error)
+	ListParts(ctx context.Context, params map[string]interface{}) ([]*models.CustomerPart, int64, error)
+
+	// Drawings
+
+	// UploadDrawing stores a new revision of a part's drawing and flags the
+	// open documents of the part made to another revision
+	UploadDrawing(ctx context.Context, req UploadDrawingRequest) (*DrawingRevisionResult, error)
+	// OpenDrawing returns a drawing revision of a part with its content
+	OpenDrawing(ctx context.Context, partID, drawingID uuid.UUID) (*models.DrawingRevision, []byte, error)
+
+	// Revision change flags
+
+	GetFlag(ctx context.Context, id uuid.UUID) (*models.RevisionChangeFlag, error)
+	ListFlags(ctx context.Context, params map[string]interface{}) ([]*models.RevisionChangeFlag, int64, error)
+	// ResolveFlag moves a flagged document to the new revision or accepts
+	// it on its own revision
+	ResolveFlag(ctx context.Context, id uuid.UUID, req *ResolveRevisionFlagRequest, userID uuid.UUID) (*models.RevisionChangeFlag, error)
+}
+
+// FastenerSpecRequest sets the specification of an inventory item
+type FastenerSpecRequest struct {
+	CompanyID   uuid.UUID `json:"-"`
+	InventoryID uuid.UUID `json:"-"`
+	UserID      uuid.UUID `json:"-"`
+	fastenerspec.Spec
+	Notes string `json:"notes"`
+}
+
+// CustomerPartRequest creates or updates a customer part. The customer of
+// a part does not change.
+type CustomerPartRequest struct {
+	CompanyID        uuid.UUID `json:"-"`
+	CustomerID       uuid.UUID `json:"customer_id"`
+	CustomerPartNo   string    `json:"customer_part_no"`
+	CustomerPartName string    `json:"customer_part_name"`
+	InventoryID      uuid.UUID `json:"inventory_id"`
+	IsActive         *bool     `json:"is_active"`
+	Notes            string    `json:"notes"`
+}
+
+// UploadDrawingRequest uploads a revision of a part's drawing
+type UploadDrawingRequest struct {
+	PartID            uuid.UUID
+	Revision          string
+	DrawingNo         string
+	ChangeDescription string
+	EffectiveDate     *time.Time
+	FileName          string
+	ContentType       string
+	UserID            uuid.UUID
+	Content           io.Reader
+}
+
+// DrawingRevisionResult is an uploaded drawing revision with the flags it
+// raised
+type DrawingRevisionResult struct {
+	Drawing *models.DrawingRevision      `json:"drawing"`
+	Flags   []*models.RevisionChangeFlag `json:"flags"`
+}
+
+// ResolveRevisionFlagRequest resolves a revision change flag
+type ResolveRevisionFlagRequest struct {
+	Resolution string `json:"resolution"` // update, accept
+	Note       string `json:"note"`       // required to accept
+}
+
+type productMasterService struct {
+	repo          repository.ProductMasterRepository
+	customerRepo  repository.CustomerRepository
+	inventoryRepo repository.InventoryRepository
+	system        SystemService
+	files         *resources.FileManager
+	storagePath   string
+}
+
+// NewProductMasterService creates a new product master service. Drawings
+// are written with files under storagePath.
+func NewProductMasterService(
+	repo repository.ProductMasterRepository,
+	customerRepo repository.CustomerRepository,
+	inventoryRepo repository.InventoryRepository,
+	system SystemService,
+	files *resources.FileManager,
+	storagePath string,
+) ProductMasterService {
+	return &productMasterService{
+		repo:          repo,
+		customerRepo:  customerRepo,
+		inventoryRepo: inventoryRepo,
+		system:        system,
+		files:         files,
+		storagePath:   storagePath,
+	}
+}
+
+// Specifications
+
+func (s *productMasterService) ListStandards() []fastenerspec.Standard {
+	return fastenerspec.Standards
+}
+
+func (s *productMasterService) SaveSpecification(ctx context.Context, req *FastenerSpecRequest) (*models.FastenerSpecification, error) {
+	inventory, err := s.inventoryRepo.Get(req.InventoryID)
+	if err != nil || inventory.CompanyID != req.CompanyID {
+		return nil, ErrInventoryItemNotFound
+	}
+	normalized, err := req.Spec.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := s.repo.GetSpecification(ctx, inventory.ID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+		spec = &models.FastenerSpecification{
+			CompanyID:   inventory.CompanyID,
+			InventoryID: inventory.ID,
+		}
+	}
+	spec.Standard = normalized.Standard
+	spec.System = normalized.System()
+	spec.Size = normalized.Size
+	spec.Length = normalized.Length
+	spec.Grade = normalized.Grade
+	spec.Finish = normalized.Finish
+	spec.Material = normalized.Material
+	spec.Description = normalized.Describe()
+	spec.Notes = req.Notes
+	spec.UpdatedBy = &req.UserID
+
+	if err := s.repo.SaveSpecification(ctx, spec); err != nil {
+		return nil, fmt.Errorf("failed to save specification: %w", err)
+	}
+	return spec, nil
+}
+
+func (s *productMasterService) GetSpecification(ctx context.Context, inventoryID uuid.UUID) (*models.FastenerSpecification, error) {
+	spec, err := s.repo.GetSpecification(ctx, inventoryID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrFastenerSpecNotFound
+		}
+		return nil, err
+	}
+	return spec, nil
+}
+
+func (s *productMasterService) ListSpecifications(ctx context.Context, params map[string]interface{}) ([]*models.FastenerSpecification, int64, error) {
+	if standard, ok := params["standard"].(string); ok && standard != "" {
+		codes := fastenerspec.EquivalentCodes(standard)
+		if codes == nil {
+			codes = []string{standard}
+		}
+		params["standards"] = codes
+	}
+	if size, ok := params["size"].(string); ok && size != "" {
+		params["size"] = fastenerspec.NormalizeSize(size)
+	}
+	return s.repo.ListSpecifications(ctx, params)
+}
+
+// Customer parts
+
+func (s *productMasterService) CreatePart(ctx context.Context, req *CustomerPartRequest, userID uuid.UUID) (*models.CustomerPart, error) {
+	partNo := strings.TrimSpace(req.CustomerPartNo)
+	if partNo == "" {
+		return nil, fmt.Errorf("%w: a customer part number is required", ErrInvalidCustomerPart)
+	}
+	if _, err := s.customerRepo.GetByID(ctx, req.CustomerID, req.CompanyID); err != nil {
+		return nil, fmt.Errorf("%w: unknown customer", ErrInvalidCustomerPart)
+	}
+	if err := s.checkInventory(req.CompanyID, req.InventoryID); err != nil {
+		return nil, err
+	}
+	if err := s.checkPartNo(ctx, req.CompanyID, req.CustomerID, partNo, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	part := &models.CustomerPart{
+		CompanyID:        req.CompanyID,
+		CustomerID:       req.CustomerID,
+		CustomerPartNo:   partNo,
+		CustomerPartName: strings.TrimSpace(req.CustomerPartName),
+		InventoryID:      req.InventoryID,
+		IsActive:         true,
+		Notes:            req.Notes,
+		CreatedBy:        userID,
+	}
+	if req.IsActive != nil {
+		part.IsActive = *req.IsActive
+	}
+	if err := s.repo.CreatePart(ctx, part); err != nil {
+		return nil, fmt.Errorf("failed to create customer part: %w", err)
+	}
+	return s.GetPart(ctx, part.ID)
+}
+
+func (s *productMasterService) UpdatePart(ctx context.Context, id uuid.UUID, req *CustomerPartRequest) (*models.CustomerPart, error) {
+	part, err := s.GetPart(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if partNo := strings.TrimSpace(req.CustomerPartNo); partNo != "" && partNo != part.CustomerPartNo {
+		if err := s.checkPartNo(ctx, part.CompanyID, part.CustomerID, partNo, part.ID); err != nil {
+			return nil, err
+		}
+		part.CustomerPartNo = partNo
+	}
+	if req.InventoryID != uuid.Nil && req.InventoryID != part.InventoryID {
+		if err := s.checkInventory(part.CompanyID, req.InventoryID); err != nil {
+			return nil, err
+		}
+		part.InventoryID = req.InventoryID
+	}
+	if name := strings.TrimSpace(req.CustomerPartName); name != "" {
+		part.CustomerPartName = name
+	}
+	if req.IsActive != nil {
+		part.IsActive = *req.IsActive
+	}
+	if req.Notes != "" {
+		part.Notes = req.Notes
+	}
+
+	if err := s.repo.UpdatePart(ctx, part); err != nil {
+		return nil, fmt.Errorf("failed to update customer part: %w", err)
+	}
+	return s.GetPart(ctx, part.ID)
+}
+
+func (s *productMasterService) GetPart(ctx context.Context, id uuid.UUID) (*models.CustomerPart, error) {
+	part, err := s.repo.GetPart(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrCustomerPartNotFound
+		}
+		return nil, err
+	}
+	return part, nil
+}
+
+func (s *productMasterService) ResolvePart(ctx context.Context, companyID, customerID uuid.UUID, partNo string) (*models.CustomerPart, error) {
+	part, err := s.repo.FindPart(ctx, companyID, customerID, strings.TrimSpace(partNo))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrCustomerPartNotFound
+		}
+		return nil, err
+	}
+	return part, nil
+}
+
+func (s *productMasterService) ListParts(ctx context.Context, params map[string]interface{}) ([]*models.CustomerPart, int64, error) {
+	return s.repo.ListParts(ctx, params)
+}
+
+func (s *productMasterService) checkInventory(companyID, inventoryID uuid.UUID) error {
+	inventory, err := s.inventoryRepo.Get(inventoryID)
+	if err != nil || inventory.CompanyID != companyID {
+		return fmt.Errorf("%w: unknown inventory item", ErrInvalidCustomerPart)
+	}
+	return nil
+}
+
+// checkPartNo fails when another part than except of the customer has the
+// number
+func (s *productMasterService) checkPartNo(ctx context.Context, companyID, customerID uuid.UUID, partNo string, except uuid.UUID) error {
+	existing, err := s.repo.FindPart(ctx, companyID, customerID, partNo)
+	if err == nil && existing.ID != except {
+		return fmt.Errorf("%w: %s", ErrDuplicateCustomerPart, partNo)
+	}
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Drawings
+
+func (s *productMasterService) UploadDrawing(ctx context.Context, req UploadDrawingRequest) (*DrawingRevisionResult, error) {
+	part, err := s.GetPart(ctx, req.PartID)
+	if err != nil {
+		return nil, err
+	}
+	revision := fastenerspec.NormalizeRevision(req.Revision)
+	if revision == "" || len(revision) > maxRevisionLength {
+		return nil, fmt.Errorf("%w: a revision of up to %d characters is required", ErrInvalidDrawing, maxRevisionLength)
+	}
+	fileName := filepath.Base(strings.TrimSpace(req.FileName))
+	if fileName == "." || fileName == string(filepath.Separator) || fileName == "" {
+		return nil, fmt.Errorf("%w: drawing needs a file name", ErrInvalidDrawing)
+	}
+	for _, d := range part.Drawings {
+		if fastenerspec.CompareRevisions(d.Revision, revision) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrDrawingRevisionExists, revision)
+		}
+	}
+	if part.CurrentRevision != "" && fastenerspec.CompareRevisions(revision, part.CurrentRevision) < 0 {
+		return nil, fmt.Errorf("%w: %s is before %s", ErrDrawingRevisionNotNewer, revision, part.CurrentRevision)
+	}
+
+	dir := filepath.Join(s.storagePath, "drawings", part.ID.String())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, revision+"-"+fileName)
+	size, hash, err := s.storeDrawing(path, req.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	drawing := &models.DrawingRevision{
+		CustomerPartID:    part.ID,
+		Revision:          revision,
+		DrawingNo:         strings.TrimSpace(req.DrawingNo),
+		ChangeDescription: req.ChangeDescription,
+		EffectiveDate:     req.EffectiveDate,
+		FileName:          fileName,
+		FilePath:          path,
+		FileSize:          size,
+		ContentType:       req.ContentType,
+		Hash:              hash,
+		UploadedBy:        req.UserID,
+		UploadedAt:        time.Now(),
+	}
+	previous := part.CurrentRevision
+	flags, err := s.repo.ReviseDrawing(ctx, part, drawing)
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to store drawing revision: %w", err)
+	}
+
+	if len(flags) > 0 {
+		s.notifyRevisionChange(ctx, part, previous, drawing, flags, req.UserID)
+	}
+	return &DrawingRevisionResult{Drawing: drawing, Flags: flags}, nil
+}
+
+// storeDrawing writes a drawing through the file manager, never over an
+// existing file, and returns its size and hex SHA-256
+func (s *productMasterService) storeDrawing(path string, content io.Reader) (int64, string, error) {
+	file, err := s.files.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return 0, "", fmt.Errorf("%w: %s", ErrDrawingRevisionExists, filepath.Base(path))
+		}
+		return 0, "", fmt.Errorf("failed to store drawing: %w", err)
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), content)
+	if closeErr := s.files.CloseFile(path); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, "", fmt.Errorf("failed to store drawing: %w", err)
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (s *productMasterService) OpenDrawing(ctx context.Context, partID, drawingID uuid.UUID) (*models.DrawingRevision, []byte, error) {
+	drawing, err := s.repo.GetDrawing(ctx, drawingID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrDrawingNotFound
+		}
+		return nil, nil, err
+	}
+	if drawing.CustomerPartID != partID {
+		return nil, nil, ErrDrawingNotFound
+	}
+
+	var content []byte
+	err = resources.ReadFileWithCleanup(ctx, drawing.FilePath, func(r io.Reader) error {
+		var readErr error
+		content, readErr = io.ReadAll(r)
+		return readErr
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", drawing.FileName, err)
+	}
+	return drawing, content, nil
+}
+
+// notifyRevisionChange raises a system notification listing the documents
+// a new revision flagged; a failure is logged
+func (s *productMasterService) notifyRevisionChange(ctx context.Context, part *models.CustomerPart, previous string, drawing *models.DrawingRevision, flags []*models.RevisionChangeFlag, userID uuid.UUID) {
+	if s.system == nil {
+		return
+	}
+	seen := make(map[string]bool)
+	var documents []string
+	for _, f := range flags {
+		if !seen[f.DocumentNo] {
+			seen[f.DocumentNo] = true
+			documents = append(documents, f.DocumentNo)
+		}
+	}
+	change := drawing.Revision
+	if previous != "" {
+		change = previous + " to " + drawing.Revision
+	}
+	companyID := part.CompanyID
+	notification := &models.SystemNotification{
+		CompanyID: &companyID,
+		Title:     fmt.Sprintf("Drawing revision change: %s", part.CustomerPartNo),
+		Message: fmt.Sprintf("The drawing of %s changed from revision %s. Open quotes and orders made to another revision: %s",
+			part.CustomerPartNo, change, strings.Join(documents, ", ")),
+		Type:         "warning",
+		Priority:     "high",
+		TargetRoles:  revisionChangeRoles,
+		IsPersistent: true,
+		ActionLabel:  "Review revision changes",
+		ActionURL:    fmt.Sprintf("/revision-flags?customer_part_id=%s", part.ID),
+	}
+	if err := s.system.CreateSystemNotification(ctx, notification, userID); err != nil {
+		log.Printf("Failed to raise revision change notification for customer part %s: %v", part.ID, err)
+	}
+}
+
+// Revision change flags
+
+func (s *productMasterService) GetFlag(ctx context.Context, id uuid.UUID) (*models.RevisionChangeFlag, error) {
+	flag, err := s.repo.GetFlag(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrRevisionFlagNotFound
+		}
+		return nil, err
+	}
+	return flag, nil
+}
+
+func (s *productMasterService) ListFlags(ctx context.Context, params map[string]interface{}) ([]*models.RevisionChangeFlag, int64, error) {
+	return s.repo.ListFlags(ctx, params)
+}
+
+func (s *productMasterService) ResolveFlag(ctx context.Context, id uuid.UUID, req *ResolveRevisionFlagRequest, userID uuid.UUID) (*models.RevisionChangeFlag, error) {
+	flag, err := s.GetFlag(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if flag.Status != models.RevisionFlagOpen {
+		return nil, ErrRevisionFlagResolved
+	}
+
+	note := strings.TrimSpace(req.Note)
+	switch req.Resolution {
+	case RevisionResolutionUpdate:
+		flag.Status = models.RevisionFlagUpdated
+		if note == "" {
+			note = fmt.Sprintf("moved from revision %s to %s", flag.DocumentRevision, flag.Revision)
+		}
+	case RevisionResolutionAccept:
+		if note == "" {
+			return nil, fmt.Errorf("%w: a note is required to keep %s on revision %s", ErrInvalidRevisionResolution, flag.DocumentNo, flag.DocumentRevision)
+		}
+		flag.Status = models.RevisionFlagAccepted
+	default:
+		return nil, fmt.Errorf("%w: resolution must be update or accept", ErrInvalidRevisionResolution)
+	}
+	now := time.Now()
+	flag.Resolution = note
+	flag.ResolvedBy = &userID
+	flag.ResolvedAt = &now
+
+	if err := s.repo.ResolveFlag(ctx, flag); err != nil {
+		if errors.Is(err, repository.ErrRevisionFlagResolved) {
+			return nil, ErrRevisionFlagResolved
+		}
+		return nil, fmt.Errorf("failed to resolve revision change flag: %w", err)
+	}
+	return flag, nil
+}
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"time"
 	"github.com/fastenmind/fastener-api/internal/models"
 	"github.com/fastenmind/fastener-api/internal/repository"
@@ -68,17 +70,32 @@ type productionService struct {
 	productionRepo repository.ProductionRepository
 	inventoryRepo  repository.InventoryRepository
 	orderRepo      repository.OrderRepository
+	ledger         LedgerService
+	jobCost        JobCostService
+	sampling       SamplingService
+	ncr            NCRService
+	ppap           PPAPService
 }
 
 func NewProductionService(
 	productionRepo repository.ProductionRepository,
 	inventoryRepo repository.InventoryRepository,
 	orderRepo repository.OrderRepository,
+	ledger LedgerService,
+	jobCost JobCostService,
+	sampling SamplingService,
+	ncr NCRService,
+	ppap PPAPService,
 ) ProductionService {
 	return &productionService{
 		productionRepo: productionRepo,
 		inventoryRepo:  inventoryRepo,
 		orderRepo:      orderRepo,
+		ledger:         ledger,
+		jobCost:        jobCost,
+		sampling:       sampling,
+		ncr:            ncr,
+		ppap:           ppap,
 	}
 }
 
@@ -170,7 +187,15 @@ func (s *productionService) ReleaseProductionOrder(id uuid.UUID, userID uuid.UUI
 	}
 	
 	order.Status = "released"
-	return s.productionRepo.UpdateProductionOrder(order)
+	if err := s.productionRepo.UpdateProductionOrder(order); err != nil {
+		return err
+	}
+	
+	// 未核准 PPAP 的料號僅警示, 不阻擋下達
+	if _, err := s.ppap.CheckRelease(context.Background(), order, userID); err != nil {
+		log.Printf("Failed to check PPAP approval of production order %s: %v", order.ID, err)
+	}
+	return nil
 }
 
 func (s *productionService) StartProductionOrder(id uuid.UUID, userID uuid.UUID) error {
@@ -218,9 +243,18 @@ func (s *productionService) CompleteProductionOrder(id uuid.UUID, userID uuid.UU
 	}
 	
 	now := time.Now()
+	if err := s.ledger.EnsurePeriodOpen(context.Background(), order.CompanyID, now); err != nil {
+		return err
+	}
+	
 	order.Status = "completed"
 	order.ActualEndDate = &now
 	
+	// Close the job cost; its actual cost is what moves to inventory
+	if _, err := s.jobCost.Apply(context.Background(), order); err != nil {
+		return err
+	}
+	
 	// Update inventory with produced quantity
 	if order.QualifiedQuantity > 0 {
 		if err := s.updateInventoryAfterProduction(order); err != nil {
@@ -228,7 +262,22 @@ func (s *productionService) CompleteProductionOrder(id uuid.UUID, userID uuid.UU
 		}
 	}
 	
-	return s.productionRepo.UpdateProductionOrder(order)
+	if err := s.productionRepo.UpdateProductionOrder(order); err != nil {
+		return err
+	}
+	
+	// Move the production cost from work in process to inventory
+	if order.QualifiedQuantity > 0 {
+		inventory, err := s.inventoryRepo.Get(order.InventoryID)
+		if err != nil {
+			return err
+		}
+		if _, err := s.ledger.PostProductionCompletion(context.Background(), order, inventory, userID); err != nil {
+			return err
+		}
+	}
+	
+	return nil
 }
 
 func (s *productionService) CancelProductionOrder(id uuid.UUID, userID uuid.UUID, reason string) error {
@@ -274,10 +323,16 @@ func (s *productionService) ListProductionRoutes(companyID uuid.UUID, params map
 
 // Route Operation operations
 func (s *productionService) CreateRouteOperation(operation *models.RouteOperation) error {
+	if err := validateSubcontractOperation(operation); err != nil {
+		return err
+	}
 	return s.productionRepo.CreateRouteOperation(operation)
 }
 
 func (s *productionService) UpdateRouteOperation(operation *models.RouteOperation) error {
+	if err := validateSubcontractOperation(operation); err != nil {
+		return err
+	}
 	return s.productionRepo.UpdateRouteOperation(operation)
 }
 
@@ -449,6 +504,12 @@ func (s *productionService) IssueMaterials(productionOrderID uuid.UUID, userID u
 			material.IssuedQuantity = material.PlannedQuantity
 			material.IssuedAt = &now
 			
+			// Value the issue at inventory cost for job costing
+			if unitCost := inventoryUnitCost(inventory); unitCost > 0 {
+				material.UnitCost = unitCost
+			}
+			material.TotalCost = material.IssuedQuantity * material.UnitCost
+			
 			if err := s.productionRepo.UpdateProductionMaterial(&material); err != nil {
 				return err
 			}
@@ -471,11 +532,36 @@ func (s *productionService) CreateQualityInspection(inspection *models.QualityIn
 		inspection.Status = "pending"
 	}
 	
+	// 依 ISO 2859-1 抽樣計畫決定樣本數與允收/拒收數
+	if err := s.sampling.PlanInspection(context.Background(), inspection); err != nil {
+		return err
+	}
+	
 	return s.productionRepo.CreateQualityInspection(inspection)
 }
 
 func (s *productionService) UpdateQualityInspection(inspection *models.QualityInspection) error {
-	return s.productionRepo.UpdateQualityInspection(inspection)
+	existing, err := s.productionRepo.GetQualityInspection(inspection.ID)
+	if err != nil {
+		return err
+	}
+	if existing.SamplingPlanID == nil {
+		return s.productionRepo.UpdateQualityInspection(inspection)
+	}
+	
+	// 抽樣檢驗：依各缺點等級的允收數自動判定批次並更新轉換狀態
+	if err := s.sampling.DecideInspection(context.Background(), existing, inspection); err != nil {
+		return err
+	}
+	*inspection = *existing
+	
+	// 批次判退時開立不合格報告 (NCR)
+	if inspection.Decision == models.InspectionReject {
+		if _, err := s.ncr.OpenFromInspection(context.Background(), inspection, inspection.InspectorID); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *productionService) GetQualityInspection(id uuid.UUID) (*models.QualityInspection, error) {
@@ -520,7 +606,13 @@ func (s *productionService) RejectInspection(id uuid.UUID, approverID uuid.UUID,
 	inspection.ApprovedAt = &now
 	inspection.CorrectiveAction = reason
 	
-	return s.productionRepo.UpdateQualityInspection(inspection)
+	if err := s.productionRepo.UpdateQualityInspection(inspection); err != nil {
+		return err
+	}
+	
+	// 判退後開立不合格報告 (NCR)，以 8D 流程處理矯正措施
+	_, err = s.ncr.OpenFromInspection(context.Background(), inspection, approverID)
+	return err
 }
 
 // Dashboard and Reports
@@ -701,6 +793,11 @@ func (s *productionService) updateProductionOrderProgress(productionOrderID uuid
 		order.Status = "quality_check" // Ready for final QC
 	}
 	
+	// Labor accumulates as tasks complete
+	if _, err := s.jobCost.Apply(context.Background(), order); err != nil {
+		return err
+	}
+	
 	return s.productionRepo.UpdateProductionOrder(order)
 }
 
@@ -741,6 +838,7 @@ func (s *productionService) returnIssuedMaterials(productionOrderID uuid.UUID) e
 			
 			material.Status = "returned"
 			material.ReturnedQuantity = unusedQuantity
+			material.TotalCost = (material.IssuedQuantity - material.ReturnedQuantity) * material.UnitCost
 			s.productionRepo.UpdateProductionMaterial(&material)
 		}
 	}
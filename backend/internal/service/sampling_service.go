@@ -0,0 +1,462 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/sampling"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrSamplingPlanNotFound is returned when a sampling plan is not found
+	ErrSamplingPlanNotFound = errors.New("sampling plan not found")
+	// ErrSamplingStateNotFound is returned when a switching state is not found
+	ErrSamplingStateNotFound = errors.New("sampling state not found")
+	// ErrInvalidSamplingPlan is returned for an unknown inspection level,
+	// AQL or switching scope
+	ErrInvalidSamplingPlan = errors.New("sampling plan needs a known inspection level, preferred AQLs and a switching scope of supplier, product or supplier_product")
+	// ErrSamplingDiscontinued is returned when acceptance inspection of a
+	// supplier or product is discontinued pending corrective action
+	ErrSamplingDiscontinued = errors.New("acceptance inspection is discontinued until corrective action is taken")
+	// ErrSampleIncomplete is returned when fewer units were inspected than
+	// the sample size
+	ErrSampleIncomplete = errors.New("inspected quantity is below the sample size")
+	// ErrInspectionDecided is returned when the sampling decision of an
+	// inspection was already made
+	ErrInspectionDecided = errors.New("sampling decision has already been recorded")
+)
+
+// SamplingService manages ISO 2859-1 sampling plans, sets the sample size
+// and Ac/Re numbers of quality inspections from the lot quantity, decides
+// them from the submitted defect counts and applies the switching rules
+// per supplier or product
+type SamplingService interface {
+	// Plans
+	CreatePlan(ctx context.Context, plan *models.SamplingPlan) error
+	UpdatePlan(ctx context.Context, id uuid.UUID, plan *models.SamplingPlan) (*models.SamplingPlan, error)
+	GetPlan(ctx context.Context, id uuid.UUID) (*models.SamplingPlan, error)
+	ListPlans(ctx context.Context, params map[string]interface{}) ([]*models.SamplingPlan, int64, error)
+
+	// States
+	GetState(ctx context.Context, id uuid.UUID) (*models.SamplingState, error)
+	ListStates(ctx context.Context, params map[string]interface{}) ([]*models.SamplingState, int64, error)
+	SwitchState(ctx context.Context, id uuid.UUID, severity, reason string, userID uuid.UUID) (*models.SamplingState, error)
+
+	// Inspections
+	PlanInspection(ctx context.Context, inspection *models.QualityInspection) error
+	DecideInspection(ctx context.Context, inspection, submitted *models.QualityInspection) error
+}
+
+type samplingService struct {
+	samplingRepo repository.SamplingRepository
+}
+
+// NewSamplingService creates a new sampling service
+func NewSamplingService(samplingRepo repository.SamplingRepository) SamplingService {
+	return &samplingService{samplingRepo: samplingRepo}
+}
+
+// Plans
+
+func (s *samplingService) CreatePlan(ctx context.Context, plan *models.SamplingPlan) error {
+	if err := normalizeSamplingPlan(plan); err != nil {
+		return err
+	}
+	plan.IsActive = true
+	return s.samplingRepo.CreatePlan(ctx, plan)
+}
+
+// UpdatePlan changes a plan; switching states already built up under it
+// are kept
+func (s *samplingService) UpdatePlan(ctx context.Context, id uuid.UUID, plan *models.SamplingPlan) (*models.SamplingPlan, error) {
+	existing, err := s.GetPlan(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	existing.Name = plan.Name
+	existing.InspectionType = plan.InspectionType
+	existing.SupplierID = plan.SupplierID
+	existing.InventoryID = plan.InventoryID
+	existing.InspectionLevel = plan.InspectionLevel
+	existing.CriticalAQL = plan.CriticalAQL
+	existing.MajorAQL = plan.MajorAQL
+	existing.MinorAQL = plan.MinorAQL
+	existing.SwitchingScope = plan.SwitchingScope
+	existing.IsActive = plan.IsActive
+	if err := normalizeSamplingPlan(existing); err != nil {
+		return nil, err
+	}
+	if err := s.samplingRepo.UpdatePlan(ctx, existing); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (s *samplingService) GetPlan(ctx context.Context, id uuid.UUID) (*models.SamplingPlan, error) {
+	plan, err := s.samplingRepo.GetPlan(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrSamplingPlanNotFound
+	}
+	return plan, err
+}
+
+func (s *samplingService) ListPlans(ctx context.Context, params map[string]interface{}) ([]*models.SamplingPlan, int64, error) {
+	return s.samplingRepo.ListPlans(ctx, params)
+}
+
+// States
+
+func (s *samplingService) GetState(ctx context.Context, id uuid.UUID) (*models.SamplingState, error) {
+	state, err := s.samplingRepo.GetState(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrSamplingStateNotFound
+	}
+	return state, err
+}
+
+func (s *samplingService) ListStates(ctx context.Context, params map[string]interface{}) ([]*models.SamplingState, int64, error) {
+	return s.samplingRepo.ListStates(ctx, params)
+}
+
+// SwitchState records a decision of the responsible authority: approving
+// reduced inspection once the switching score allows it, returning to
+// normal from reduced, or resuming tightened inspection after
+// discontinuation
+func (s *samplingService) SwitchState(ctx context.Context, id uuid.UUID, severity, reason string, userID uuid.UUID) (*models.SamplingState, error) {
+	state, err := s.GetState(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := switchingState(state)
+	from := rules.Severity
+	if err := rules.Switch(severity); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSamplingPlan, err)
+	}
+	if reason == "" {
+		reason = "switched to " + severity + " inspection"
+	}
+	change := applySwitchingState(state, rules, from, reason, time.Now())
+	change.SwitchedBy = &userID
+	state.Plan, state.Switches = nil, nil
+
+	if err := s.samplingRepo.SaveState(ctx, state, change); err != nil {
+		return nil, err
+	}
+	return s.GetState(ctx, id)
+}
+
+// Inspections
+
+// PlanInspection sets the sample size and Ac/Re numbers of an inspection
+// from its lot quantity under the plan given or the most specific plan for
+// its type, supplier and product, at the severity the switching rules have
+// reached. Inspections without lot quantity or plan are left alone.
+func (s *samplingService) PlanInspection(ctx context.Context, inspection *models.QualityInspection) error {
+	if inspection.LotQuantity <= 0 {
+		return nil
+	}
+
+	var plan *models.SamplingPlan
+	var err error
+	if inspection.SamplingPlanID != nil {
+		plan, err = s.GetPlan(ctx, *inspection.SamplingPlanID)
+		if err == nil && plan.CompanyID != inspection.CompanyID {
+			err = ErrSamplingPlanNotFound
+		}
+	} else {
+		plan, err = s.samplingRepo.FindPlan(ctx, inspection.CompanyID, inspection.Type, inspection.SupplierID, inspection.InventoryID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	state, err := s.findOrCreateState(ctx, plan, inspection)
+	if err != nil {
+		return err
+	}
+	if state.Severity == sampling.Discontinued {
+		return ErrSamplingDiscontinued
+	}
+
+	lot := int(math.Ceil(inspection.LotQuantity))
+	plans := make([]models.SamplingClassPlan, 0, 3)
+	sampleSize := 0
+	for _, class := range samplingClasses(plan) {
+		p, err := sampling.Single(lot, plan.InspectionLevel, class.aql, state.Severity)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSamplingPlan, err)
+		}
+		plans = append(plans, models.SamplingClassPlan{
+			Class:          class.name,
+			AQL:            class.aql,
+			CodeLetter:     p.CodeLetter,
+			SampleSize:     p.SampleSize,
+			Ac:             p.Ac,
+			Re:             p.Re,
+			FullInspection: p.FullInspection,
+		})
+		if p.SampleSize > sampleSize {
+			sampleSize = p.SampleSize
+		}
+	}
+	data, err := json.Marshal(plans)
+	if err != nil {
+		return err
+	}
+
+	inspection.SamplingPlanID = &plan.ID
+	inspection.SamplingStateID = &state.ID
+	inspection.InspectionLevel = plan.InspectionLevel
+	inspection.Severity = state.Severity
+	inspection.SampleSize = sampleSize
+	inspection.SamplingPlans = data
+	inspection.Decision = ""
+	inspection.DecidedAt = nil
+	if inspection.InspectedQuantity == 0 {
+		inspection.InspectedQuantity = float64(sampleSize)
+	}
+	return nil
+}
+
+// DecideInspection applies the defect counts submitted for an inspection
+// under a sampling plan: each defect class is accepted up to its Ac, the
+// lot passes when every class is accepted, and the outcome moves the
+// switching state. Defects not split by class count as major.
+func (s *samplingService) DecideInspection(ctx context.Context, inspection, submitted *models.QualityInspection) error {
+	if inspection.Decision != "" {
+		return ErrInspectionDecided
+	}
+
+	var plans []models.SamplingClassPlan
+	if err := json.Unmarshal(inspection.SamplingPlans, &plans); err != nil {
+		return fmt.Errorf("invalid sampling plans on inspection: %w", err)
+	}
+	if submitted.InspectedQuantity < float64(inspection.SampleSize) {
+		return ErrSampleIncomplete
+	}
+
+	// Submitted results
+	inspection.InspectedQuantity = submitted.InspectedQuantity
+	inspection.QualifiedQuantity = submitted.QualifiedQuantity
+	inspection.DefectQuantity = submitted.DefectQuantity
+	inspection.CriticalDefects = submitted.CriticalDefects
+	inspection.MajorDefects = submitted.MajorDefects
+	inspection.MinorDefects = submitted.MinorDefects
+	inspection.DefectTypes = submitted.DefectTypes
+	inspection.DefectReasons = submitted.DefectReasons
+	inspection.InspectionNotes = submitted.InspectionNotes
+	inspection.CorrectiveAction = submitted.CorrectiveAction
+	inspection.AttachmentPath = submitted.AttachmentPath
+
+	defects := map[string]int{
+		models.DefectClassCritical: inspection.CriticalDefects,
+		models.DefectClassMajor:    inspection.MajorDefects,
+		models.DefectClassMinor:    inspection.MinorDefects,
+	}
+	if inspection.CriticalDefects+inspection.MajorDefects+inspection.MinorDefects == 0 && inspection.DefectQuantity > 0 {
+		defects[models.DefectClassMajor] = int(math.Ceil(inspection.DefectQuantity))
+	}
+
+	state, err := s.samplingRepo.GetState(ctx, *inspection.SamplingStateID)
+	if err != nil {
+		return err
+	}
+
+	lot := sampling.Lot{Accepted: true, TighterAccepted: true}
+	for i := range plans {
+		plan := &plans[i]
+		count := defects[plan.Class]
+		accepted := count <= plan.Ac
+		plan.Defects = &count
+		plan.Accepted = &accepted
+
+		lot.Accepted = lot.Accepted && accepted
+		if plan.Ac > lot.Ac {
+			lot.Ac = plan.Ac
+		}
+		if plan.Ac >= 2 {
+			lot.TighterAccepted = lot.TighterAccepted && acceptedOneStepTighter(*plan, count)
+		}
+	}
+	data, err := json.Marshal(plans)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	inspection.SamplingPlans = data
+	inspection.DecidedAt = &now
+	inspection.InspectedAt = now
+	if lot.Accepted {
+		inspection.Decision = models.InspectionAccept
+		inspection.Status = "passed"
+	} else {
+		inspection.Decision = models.InspectionReject
+		inspection.Status = "failed"
+	}
+
+	// A lot inspected at a severity the state has since left, e.g. planned
+	// before a switch, does not count towards the new severity
+	var change *models.SamplingSwitch
+	if state.Severity == inspection.Severity {
+		rules := switchingState(state)
+		from := rules.Severity
+		if reason := rules.Record(lot); reason != "" {
+			change = applySwitchingState(state, rules, from, reason, now)
+			change.InspectionID = &inspection.ID
+		} else {
+			applySwitchingState(state, rules, from, "", now)
+		}
+	}
+	state.LotsInspected++
+	state.LastInspectionID = &inspection.ID
+	state.Plan, state.Switches = nil, nil
+
+	return s.samplingRepo.RecordDecision(ctx, inspection, state, change)
+}
+
+// findOrCreateState returns the switching state of a plan for the supplier
+// and product of an inspection, as far as the plan's scope tracks them
+func (s *samplingService) findOrCreateState(ctx context.Context, plan *models.SamplingPlan, inspection *models.QualityInspection) (*models.SamplingState, error) {
+	var supplierID, inventoryID *uuid.UUID
+	switch plan.SwitchingScope {
+	case models.SamplingScopeProduct:
+		inventoryID = inspection.InventoryID
+	case models.SamplingScopeSupplierProduct:
+		supplierID, inventoryID = inspection.SupplierID, inspection.InventoryID
+	default:
+		supplierID = inspection.SupplierID
+	}
+
+	state, err := s.samplingRepo.FindState(ctx, plan.ID, supplierID, inventoryID)
+	if err == nil {
+		return state, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	state = &models.SamplingState{
+		CompanyID:   plan.CompanyID,
+		PlanID:      plan.ID,
+		SupplierID:  supplierID,
+		InventoryID: inventoryID,
+		Severity:    sampling.Normal,
+	}
+	if err := s.samplingRepo.CreateState(ctx, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+type samplingClass struct {
+	name string
+	aql  float64
+}
+
+// samplingClasses are the defect classes a plan inspects: critical always,
+// with zero acceptance when its AQL is zero, major and minor when they
+// have an AQL
+func samplingClasses(plan *models.SamplingPlan) []samplingClass {
+	classes := []samplingClass{{models.DefectClassCritical, plan.CriticalAQL}}
+	if plan.MajorAQL > 0 {
+		classes = append(classes, samplingClass{models.DefectClassMajor, plan.MajorAQL})
+	}
+	if plan.MinorAQL > 0 {
+		classes = append(classes, samplingClass{models.DefectClassMinor, plan.MinorAQL})
+	}
+	return classes
+}
+
+// acceptedOneStepTighter reports whether a class would also have been
+// accepted with the AQL one preferred step tighter, for the switching score
+func acceptedOneStepTighter(plan models.SamplingClassPlan, defects int) bool {
+	aql, ok := sampling.TighterAQL(plan.AQL)
+	if !ok {
+		return defects == 0
+	}
+	tighter, err := sampling.Lookup(plan.CodeLetter, aql, sampling.Normal)
+	if err != nil {
+		return false
+	}
+	return tighter.Accepts(defects)
+}
+
+func normalizeSamplingPlan(plan *models.SamplingPlan) error {
+	plan.Name = strings.TrimSpace(plan.Name)
+	if plan.InspectionLevel == "" {
+		plan.InspectionLevel = sampling.LevelII
+	}
+	if plan.SwitchingScope == "" {
+		plan.SwitchingScope = models.SamplingScopeSupplier
+	}
+	switch {
+	case plan.Name == "",
+		!sampling.ValidLevel(plan.InspectionLevel),
+		!sampling.ValidAQL(plan.CriticalAQL),
+		!sampling.ValidAQL(plan.MajorAQL),
+		!sampling.ValidAQL(plan.MinorAQL):
+		return ErrInvalidSamplingPlan
+	}
+	switch plan.SwitchingScope {
+	case models.SamplingScopeSupplier, models.SamplingScopeProduct, models.SamplingScopeSupplierProduct:
+		return nil
+	}
+	return ErrInvalidSamplingPlan
+}
+
+// switchingState converts a stored state to the switching rules
+func switchingState(state *models.SamplingState) sampling.State {
+	rules := sampling.State{
+		Severity: state.Severity,
+		Score:    state.SwitchingScore,
+		Accepted: state.ConsecutiveAccepted,
+		Rejected: state.TightenedRejected,
+	}
+	for _, r := range state.RecentResults {
+		rules.Recent = append(rules.Recent, r == 'A')
+	}
+	return rules
+}
+
+// applySwitchingState copies the switching rules back to a stored state and
+// returns the switch when the severity changed
+func applySwitchingState(state *models.SamplingState, rules sampling.State, from, reason string, at time.Time) *models.SamplingSwitch {
+	var recent strings.Builder
+	for _, accepted := range rules.Recent {
+		if accepted {
+			recent.WriteByte('A')
+		} else {
+			recent.WriteByte('R')
+		}
+	}
+	state.Severity = rules.Severity
+	state.SwitchingScore = rules.Score
+	state.RecentResults = recent.String()
+	state.ConsecutiveAccepted = rules.Accepted
+	state.TightenedRejected = rules.Rejected
+	state.ReducedEligible = rules.ReducedEligible()
+
+	if rules.Severity == from {
+		return nil
+	}
+	state.SwitchedAt = &at
+	state.SwitchReason = reason
+	return &models.SamplingSwitch{
+		StateID:      state.ID,
+		FromSeverity: from,
+		ToSeverity:   rules.Severity,
+		Reason:       reason,
+	}
+}
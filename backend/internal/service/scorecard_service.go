@@ -0,0 +1,471 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/scorecard"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrScorecardNotFound is returned when a supplier scorecard does not exist
+	ErrScorecardNotFound = errors.New("supplier scorecard not found")
+	// ErrInvalidScorecardConfig is returned for weights or limits that
+	// cannot be scored with
+	ErrInvalidScorecardConfig = scorecard.ErrInvalidConfig
+)
+
+// SupplierScorecardService computes monthly supplier scorecards from
+// receipts, incoming inspections, order prices and order confirmations,
+// and keeps the ratings and risk level of suppliers in step with them
+type SupplierScorecardService interface {
+	// GetConfig returns the scorecard configuration of a company, the
+	// defaults if it has none
+	GetConfig(ctx context.Context, companyID uuid.UUID) (*models.SupplierScorecardConfig, error)
+	UpdateConfig(ctx context.Context, config *models.SupplierScorecardConfig) (*models.SupplierScorecardConfig, error)
+
+	// ComputeScorecard scores a supplier for the month of period
+	ComputeScorecard(ctx context.Context, companyID, supplierID uuid.UUID, period time.Time) (*models.SupplierScorecard, error)
+	// ComputeScorecards scores every active supplier of a company for the
+	// month of period
+	ComputeScorecards(ctx context.Context, companyID uuid.UUID, period time.Time) (*ScorecardRun, error)
+	// ScoreDue rescores the previous and the current month of every
+	// company; run daily so that ratings and risk levels follow new data
+	ScoreDue(ctx context.Context) (*ScorecardRun, error)
+
+	GetScorecard(ctx context.Context, id uuid.UUID) (*models.SupplierScorecard, error)
+	ListScorecards(ctx context.Context, params map[string]interface{}) ([]*models.SupplierScorecard, int64, error)
+	// GetTrend returns the scorecards of a supplier over the last months
+	// for charting
+	GetTrend(ctx context.Context, companyID, supplierID uuid.UUID, months int) (*ScorecardTrend, error)
+}
+
+// ScorecardRun is the outcome of scoring suppliers
+type ScorecardRun struct {
+	Companies  int      `json:"companies"`
+	Scorecards int      `json:"scorecards"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+// ScorecardTrend is the scorecard history of a supplier, oldest first.
+// Direction compares the latest overall score with the mean of the ones
+// before: improving or declining by 5 points or more, else stable.
+type ScorecardTrend struct {
+	SupplierID uuid.UUID                   `json:"supplier_id"`
+	Months     int                         `json:"months"`
+	Points     []*models.SupplierScorecard `json:"points"`
+	Direction  string                      `json:"direction"` // improving, declining, stable, unknown
+	Change     *float64                    `json:"change"`
+}
+
+type supplierScorecardService struct {
+	scorecardRepo repository.ScorecardRepository
+}
+
+// NewSupplierScorecardService creates a new supplier scorecard service
+func NewSupplierScorecardService(scorecardRepo repository.ScorecardRepository) SupplierScorecardService {
+	return &supplierScorecardService{scorecardRepo: scorecardRepo}
+}
+
+func (s *supplierScorecardService) GetConfig(ctx context.Context, companyID uuid.UUID) (*models.SupplierScorecardConfig, error) {
+	config, err := s.scorecardRepo.GetConfig(ctx, companyID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return scorecardConfigModel(companyID, scorecard.DefaultConfig()), nil
+	}
+	return config, err
+}
+
+func (s *supplierScorecardService) UpdateConfig(ctx context.Context, req *models.SupplierScorecardConfig) (*models.SupplierScorecardConfig, error) {
+	config, err := s.GetConfig(ctx, req.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	config.DeliveryWeight = req.DeliveryWeight
+	config.QualityWeight = req.QualityWeight
+	config.PriceWeight = req.PriceWeight
+	config.ResponseWeight = req.ResponseWeight
+	config.LateToleranceDays = req.LateToleranceDays
+	config.PPMLimit = req.PPMLimit
+	config.PriceVarianceLimit = req.PriceVarianceLimit
+	config.ResponseTargetHours = req.ResponseTargetHours
+	config.ResponseLimitHours = req.ResponseLimitHours
+	config.UpdatedBy = req.UpdatedBy
+	if err := scorecardConfig(config).Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.scorecardRepo.SaveConfig(ctx, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (s *supplierScorecardService) ComputeScorecard(ctx context.Context, companyID, supplierID uuid.UUID, period time.Time) (*models.SupplierScorecard, error) {
+	supplier, err := s.scorecardRepo.GetSupplier(ctx, supplierID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrSupplierNotFound
+		}
+		return nil, err
+	}
+	if supplier.CompanyID != companyID {
+		return nil, ErrSupplierNotFound
+	}
+	config, err := s.GetConfig(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	return s.compute(ctx, supplier, scorecardConfig(config), period)
+}
+
+func (s *supplierScorecardService) ComputeScorecards(ctx context.Context, companyID uuid.UUID, period time.Time) (*ScorecardRun, error) {
+	run := &ScorecardRun{Companies: 1}
+	if err := s.computeCompany(ctx, companyID, period, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func (s *supplierScorecardService) ScoreDue(ctx context.Context) (*ScorecardRun, error) {
+	now := time.Now().UTC()
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	run := &ScorecardRun{}
+	companyIDs, err := s.scorecardRepo.ListCompanyIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, companyID := range companyIDs {
+		if ctx.Err() != nil {
+			return run, ctx.Err()
+		}
+		run.Companies++
+		// the previous month first, so the current one trends against its
+		// final figures
+		for _, period := range []time.Time{current.AddDate(0, -1, 0), current} {
+			if err := s.computeCompany(ctx, companyID, period, run); err != nil {
+				run.Errors = append(run.Errors, fmt.Sprintf("%s: %v", companyID, err))
+			}
+		}
+	}
+	return run, nil
+}
+
+func (s *supplierScorecardService) GetScorecard(ctx context.Context, id uuid.UUID) (*models.SupplierScorecard, error) {
+	card, err := s.scorecardRepo.GetScorecard(ctx, id)
+	if err == repository.ErrNotFound {
+		return nil, ErrScorecardNotFound
+	}
+	return card, err
+}
+
+func (s *supplierScorecardService) ListScorecards(ctx context.Context, params map[string]interface{}) ([]*models.SupplierScorecard, int64, error) {
+	return s.scorecardRepo.ListScorecards(ctx, params)
+}
+
+func (s *supplierScorecardService) GetTrend(ctx context.Context, companyID, supplierID uuid.UUID, months int) (*ScorecardTrend, error) {
+	if months <= 0 {
+		months = 12
+	}
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1-months, 0)
+	points, err := s.scorecardRepo.ListSupplierScorecards(ctx, companyID, supplierID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	trend := &ScorecardTrend{SupplierID: supplierID, Months: months, Points: points, Direction: "unknown"}
+	var scored []float64
+	for _, point := range points {
+		if point.OverallScore != nil {
+			scored = append(scored, *point.OverallScore)
+		}
+	}
+	if len(scored) < 2 {
+		return trend, nil
+	}
+	var sum float64
+	for _, v := range scored[:len(scored)-1] {
+		sum += v
+	}
+	change := scored[len(scored)-1] - sum/float64(len(scored)-1)
+	change = math.Round(change*10) / 10
+	trend.Change = &change
+	switch {
+	case change >= 5:
+		trend.Direction = "improving"
+	case change <= -5:
+		trend.Direction = "declining"
+	default:
+		trend.Direction = "stable"
+	}
+	return trend, nil
+}
+
+// computeCompany scores the active suppliers of a company for a month,
+// collecting failures of single suppliers in the run
+func (s *supplierScorecardService) computeCompany(ctx context.Context, companyID uuid.UUID, period time.Time, run *ScorecardRun) error {
+	config, err := s.GetConfig(ctx, companyID)
+	if err != nil {
+		return err
+	}
+	suppliers, err := s.scorecardRepo.ListActiveSuppliers(ctx, companyID)
+	if err != nil {
+		return err
+	}
+	for _, supplier := range suppliers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := s.compute(ctx, supplier, scorecardConfig(config), period); err != nil {
+			run.Errors = append(run.Errors, fmt.Sprintf("%s %s: %v", supplier.SupplierNo, period.Format("2006-01"), err))
+			continue
+		}
+		run.Scorecards++
+	}
+	return nil
+}
+
+// compute measures and scores a supplier's month and stores the scorecard.
+// When the month is the latest scored, the supplier's ratings and risk level
+// follow it; a month without data leaves the ratings and assesses the risk
+// on the month before.
+func (s *supplierScorecardService) compute(ctx context.Context, supplier *models.Supplier, config scorecard.Config, period time.Time) (*models.SupplierScorecard, error) {
+	start := time.Date(period.Year(), period.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	metrics, open, err := s.measure(ctx, supplier, config, start, end)
+	if err != nil {
+		return nil, err
+	}
+	scores := scorecard.Score(metrics, config)
+
+	card, err := s.scorecardRepo.FindScorecard(ctx, supplier.CompanyID, supplier.ID, start)
+	if errors.Is(err, repository.ErrNotFound) {
+		card = &models.SupplierScorecard{CompanyID: supplier.CompanyID, SupplierID: supplier.ID, PeriodStart: start}
+	} else if err != nil {
+		return nil, err
+	}
+	card.PeriodEnd = end.AddDate(0, 0, -1)
+	card.Deliveries, card.OnTimeDeliveries = metrics.Deliveries, metrics.OnTimeDeliveries
+	card.OnTimeRate = metricValue(metrics.OnTimeRate())
+	card.InspectedQuantity, card.DefectQuantity = metrics.InspectedQuantity, metrics.DefectQuantity
+	card.PPM = metricValue(metrics.PPM())
+	card.ListValue, card.PaidValue = metrics.ListValue, metrics.PaidValue
+	card.PriceVariance = metricValue(metrics.PriceVariance())
+	card.Responses, card.OpenConfirmations = metrics.Responses, open
+	card.AvgResponseHours = metricValue(metrics.AverageResponseHours())
+	card.DeliveryScore, card.QualityScore = scores.Delivery, scores.Quality
+	card.PriceScore, card.ResponseScore = scores.Price, scores.Response
+	card.OverallScore = scores.Overall
+	card.Weights, _ = json.Marshal(config)
+
+	// the month's risk trends against the month before; without data of
+	// its own it is assessed on the month before
+	basis, basisStart := scores, start
+	previous, err := s.findScorecard(ctx, supplier, start.AddDate(0, -1, 0))
+	if err != nil {
+		return nil, err
+	}
+	if scores.Overall == nil && previous != nil && previous.OverallScore != nil {
+		basis, basisStart = scorecardScores(previous), previous.PeriodStart
+		previous, err = s.findScorecard(ctx, supplier, basisStart.AddDate(0, -1, 0))
+		if err != nil {
+			return nil, err
+		}
+	}
+	var previousOverall *float64
+	if previous != nil {
+		previousOverall = previous.OverallScore
+	}
+	risk := scorecard.Assess(basis, previousOverall, scorecardProfile(supplier))
+	card.RiskLevel, card.RiskPoints = risk.Level, risk.Points
+	card.RiskFactors, _ = json.Marshal(risk.Factors)
+	card.Explanation = risk.Explain()
+	if !basisStart.Equal(start) {
+		card.Explanation += fmt.Sprintf(" (no data in %s; assessed on %s)", start.Format("2006-01"), basisStart.Format("2006-01"))
+	}
+	card.ComputedAt = time.Now()
+
+	latest, err := s.scorecardRepo.LatestPeriod(ctx, supplier.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.scorecardRepo.SaveScorecard(ctx, card); err != nil {
+		return nil, err
+	}
+	if start.Before(latest) {
+		return card, nil
+	}
+
+	values := map[string]interface{}{
+		"risk_level":   risk.Level,
+		"risk_factors": string(card.RiskFactors),
+	}
+	if basis.Delivery != nil {
+		values["delivery_rating"] = *basis.Delivery
+	}
+	if basis.Quality != nil {
+		values["quality_rating"] = *basis.Quality
+	}
+	if basis.Response != nil {
+		values["service_rating"] = *basis.Response
+	}
+	if basis.Overall != nil {
+		values["overall_rating"] = *basis.Overall
+	}
+	if err := s.scorecardRepo.UpdateSupplierRating(ctx, supplier.ID, values); err != nil {
+		return nil, fmt.Errorf("failed to update supplier rating: %w", err)
+	}
+	return card, nil
+}
+
+// measure collects the metrics of a supplier in [start, end). A receipt is
+// on time up to the tolerance after the promised date, or the required
+// date if none was promised. Orders not yet confirmed count at their age
+// once they are past the response target, and are returned as open.
+func (s *supplierScorecardService) measure(ctx context.Context, supplier *models.Supplier, config scorecard.Config, start, end time.Time) (scorecard.Metrics, int, error) {
+	var m scorecard.Metrics
+
+	receipts, err := s.scorecardRepo.ListReceipts(ctx, supplier.CompanyID, supplier.ID, start, end)
+	if err != nil {
+		return m, 0, err
+	}
+	for _, receipt := range receipts {
+		if receipt.PurchaseOrder == nil {
+			continue
+		}
+		due := receipt.PurchaseOrder.RequiredDate
+		if receipt.PurchaseOrder.PromisedDate != nil {
+			due = *receipt.PurchaseOrder.PromisedDate
+		}
+		if due.IsZero() {
+			continue
+		}
+		m.Deliveries++
+		deadline := time.Date(due.Year(), due.Month(), due.Day()+config.LateToleranceDays+1, 0, 0, 0, 0, due.Location())
+		if receipt.ReceivedAt.Before(deadline) {
+			m.OnTimeDeliveries++
+		}
+	}
+
+	inspections, err := s.scorecardRepo.ListIncomingInspections(ctx, supplier.CompanyID, supplier.ID, start, end)
+	if err != nil {
+		return m, 0, err
+	}
+	for _, inspection := range inspections {
+		m.InspectedQuantity += inspection.InspectedQuantity
+		m.DefectQuantity += inspection.DefectQuantity
+	}
+
+	items, err := s.scorecardRepo.ListOrderItems(ctx, supplier.CompanyID, supplier.ID, start, end)
+	if err != nil {
+		return m, 0, err
+	}
+	for _, item := range items {
+		product := item.SupplierProduct
+		if product == nil || product.UnitPrice <= 0 || item.PurchaseOrder == nil {
+			continue
+		}
+		if product.Currency != "" && item.PurchaseOrder.Currency != "" && product.Currency != item.PurchaseOrder.Currency {
+			continue
+		}
+		m.ListValue += item.OrderedQuantity * product.UnitPrice
+		m.PaidValue += item.OrderedQuantity * item.UnitPrice
+	}
+
+	orders, err := s.scorecardRepo.ListSentOrders(ctx, supplier.CompanyID, supplier.ID, start, end)
+	if err != nil {
+		return m, 0, err
+	}
+	open := 0
+	now := time.Now()
+	for _, order := range orders {
+		if order.ApprovedAt == nil {
+			continue
+		}
+		if order.ConfirmedAt != nil {
+			m.Responses++
+			m.ResponseHours += order.ConfirmedAt.Sub(*order.ApprovedAt).Hours()
+			continue
+		}
+		if age := now.Sub(*order.ApprovedAt).Hours(); age > config.ResponseTargetHours {
+			m.Responses++
+			m.ResponseHours += age
+			open++
+		}
+	}
+	return m, open, nil
+}
+
+func (s *supplierScorecardService) findScorecard(ctx context.Context, supplier *models.Supplier, start time.Time) (*models.SupplierScorecard, error) {
+	card, err := s.scorecardRepo.FindScorecard(ctx, supplier.CompanyID, supplier.ID, start)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	return card, err
+}
+
+func scorecardConfig(config *models.SupplierScorecardConfig) scorecard.Config {
+	return scorecard.Config{
+		Weights: scorecard.Weights{
+			Delivery: config.DeliveryWeight,
+			Quality:  config.QualityWeight,
+			Price:    config.PriceWeight,
+			Response: config.ResponseWeight,
+		},
+		LateToleranceDays:   config.LateToleranceDays,
+		PPMLimit:            config.PPMLimit,
+		PriceVarianceLimit:  config.PriceVarianceLimit,
+		ResponseTargetHours: config.ResponseTargetHours,
+		ResponseLimitHours:  config.ResponseLimitHours,
+	}
+}
+
+func scorecardConfigModel(companyID uuid.UUID, config scorecard.Config) *models.SupplierScorecardConfig {
+	return &models.SupplierScorecardConfig{
+		CompanyID:           companyID,
+		DeliveryWeight:      config.Weights.Delivery,
+		QualityWeight:       config.Weights.Quality,
+		PriceWeight:         config.Weights.Price,
+		ResponseWeight:      config.Weights.Response,
+		LateToleranceDays:   config.LateToleranceDays,
+		PPMLimit:            config.PPMLimit,
+		PriceVarianceLimit:  config.PriceVarianceLimit,
+		ResponseTargetHours: config.ResponseTargetHours,
+		ResponseLimitHours:  config.ResponseLimitHours,
+	}
+}
+
+func scorecardScores(card *models.SupplierScorecard) scorecard.Scores {
+	return scorecard.Scores{
+		Delivery: card.DeliveryScore,
+		Quality:  card.QualityScore,
+		Price:    card.PriceScore,
+		Response: card.ResponseScore,
+		Overall:  card.OverallScore,
+	}
+}
+
+func scorecardProfile(supplier *models.Supplier) scorecard.Profile {
+	return scorecard.Profile{
+		FinancialHealth: supplier.FinancialHealth,
+		CreditRating:    supplier.CreditRating,
+		Certified:       supplier.ISO9001 || supplier.ISO14001 || supplier.TS16949,
+		CertExpired:     supplier.CertExpiry != nil && supplier.CertExpiry.Before(time.Now()),
+	}
+}
+
+func metricValue(v float64, ok bool) *float64 {
+	if !ok {
+		return nil
+	}
+	v = math.Round(v*100) / 100
+	return &v
+}
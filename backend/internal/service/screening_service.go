@@ -0,0 +1,746 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/screening"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+var (
+	// ErrPartyBlockedByScreening is returned when a transaction involves a party with unresolved screening hits
+	ErrPartyBlockedByScreening = errors.New("party has unresolved sanctions screening hits")
+	// ErrScreeningHitNotFound is returned when a screening hit is not found
+	ErrScreeningHitNotFound = errors.New("screening hit not found")
+	// ErrScreeningHitNotOpen is returned when reviewing a hit that was already reviewed
+	ErrScreeningHitNotOpen = errors.New("screening hit is not open")
+	// ErrScreeningReviewNotes is returned when a hit is cleared without a justification
+	ErrScreeningReviewNotes = errors.New("review notes are required to clear a screening hit")
+	// ErrUnknownSanctionsSource is returned for list sources other than ofac_sdn, eu and un
+	ErrUnknownSanctionsSource = errors.New("unknown sanctions list source")
+	// ErrSanctionsListForbidden is returned when someone other than a system
+	// administrator loads a list; the lists are shared by all companies
+	ErrSanctionsListForbidden = errors.New("only a system administrator can load sanctions lists")
+	// ErrSupplierNotFound is returned when a supplier is not found
+	ErrSupplierNotFound = errors.New("supplier not found")
+	// ErrInvalidScreeningThresholds is returned when thresholds are outside [0, 1]
+	ErrInvalidScreeningThresholds = errors.New("screening thresholds must be between 0 and 1")
+)
+
+// Screening party types
+const (
+	ScreeningPartyCustomer = "customer"
+	ScreeningPartySupplier = "supplier"
+	ScreeningPartyShipment = "shipment"
+)
+
+// sanctionsListSources describes the lists the engine knows how to load.
+// Lists are only ever downloaded from these publisher URLs.
+var sanctionsListSources = map[string]struct {
+	Name string
+	URL  string
+	// AltURL and AddURL are OFAC's alternate name and address files
+	AltURL string
+	AddURL string
+}{
+	screening.SourceOFAC: {
+		Name:   "OFAC Specially Designated Nationals",
+		URL:    "https://www.treasury.gov/ofac/downloads/sdn.csv",
+		AltURL: "https://www.treasury.gov/ofac/downloads/alt.csv",
+		AddURL: "https://www.treasury.gov/ofac/downloads/add.csv",
+	},
+	screening.SourceEU: {
+		Name: "EU Consolidated Financial Sanctions",
+		URL:  "https://webgate.ec.europa.eu/fsd/fsf/public/files/xmlFullSanctionsList_1_1/content?token=dG9rZW4tMjAxNw",
+	},
+	screening.SourceUN: {
+		Name: "UN Security Council Consolidated List",
+		URL:  "https://scsanctions.un.org/resources/xml/en/consolidated.xml",
+	},
+}
+
+// ScreeningService screens customers, suppliers and shipment consignees against sanctions lists
+type ScreeningService interface {
+	// Sanctions lists
+	ImportSanctionsList(ctx context.Context, req ImportSanctionsListRequest) (*SanctionsImportResult, error)
+	DownloadSanctionsList(ctx context.Context, source string, userID uuid.UUID) (*SanctionsImportResult, error)
+	ListSanctionsLists(ctx context.Context) ([]*models.SanctionsList, error)
+
+	// Policy
+	GetPolicy(ctx context.Context, companyID uuid.UUID) (*models.ScreeningPolicy, error)
+	UpdatePolicy(ctx context.Context, companyID, userID uuid.UUID, thresholds screening.Thresholds) (*models.ScreeningPolicy, error)
+
+	// Screening
+	ScreenCustomer(ctx context.Context, customerID uuid.UUID, trigger string) ([]*models.ScreeningHit, error)
+	ScreenSupplier(ctx context.Context, supplierID uuid.UUID, trigger string) ([]*models.ScreeningHit, error)
+	ScreenShipment(ctx context.Context, shipment *models.Shipment, trigger string) ([]*models.ScreeningHit, error)
+	RescreenAll(ctx context.Context, companyID uuid.UUID, trigger string) (*RescreenResult, error)
+
+	// Review
+	ListHits(ctx context.Context, params map[string]interface{}) ([]*models.ScreeningHit, int64, error)
+	GetHit(ctx context.Context, companyID, id uuid.UUID) (*models.ScreeningHit, error)
+	ClearHit(ctx context.Context, companyID, id, userID uuid.UUID, notes string) (*models.ScreeningHit, error)
+	ConfirmHit(ctx context.Context, companyID, id, userID uuid.UUID, notes string) (*models.ScreeningHit, error)
+
+	// Blocking checks used before orders and shipments are released
+	EnsureCustomerCleared(ctx context.Context, customerID uuid.UUID) error
+	EnsureShipmentCleared(ctx context.Context, shipment *models.Shipment) error
+}
+
+// ImportSanctionsListRequest carries the files of one list source.
+// OFAC needs sdn.csv as Primary and accepts alt.csv and add.csv; EU and UN take a single XML file.
+// UserID must be a system administrator.
+type ImportSanctionsListRequest struct {
+	Source    string
+	SourceURL string
+	Primary   io.Reader
+	AltNames  io.Reader
+	Addresses io.Reader
+	UserID    uuid.UUID
+}
+
+type SanctionsImportResult struct {
+	List      *models.SanctionsList `json:"list"`
+	Unchanged bool                  `json:"unchanged"` // the files matched the loaded version, nothing was re-screened
+	Rescreen  *RescreenResult       `json:"rescreen,omitempty"`
+}
+
+type RescreenResult struct {
+	Customers int      `json:"customers"`
+	Suppliers int      `json:"suppliers"`
+	OpenHits  int      `json:"open_hits"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+type screeningService struct {
+	screeningRepo repository.ScreeningRepository
+	orderRepo     repository.OrderRepository
+	system        SystemService
+	httpClient    *http.Client
+
+	mu           sync.RWMutex
+	matcher      *screening.Matcher
+	entries      []*models.SanctionsEntry
+	matcherStamp string
+}
+
+func NewScreeningService(
+	screeningRepo repository.ScreeningRepository,
+	orderRepo repository.OrderRepository,
+	system SystemService,
+) ScreeningService {
+	return &screeningService{
+		screeningRepo: screeningRepo,
+		orderRepo:     orderRepo,
+		system:        system,
+		httpClient:    &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Sanctions lists
+
+// ImportSanctionsList replaces a list with the given files and re-screens all partners when its content changed
+func (s *screeningService) ImportSanctionsList(ctx context.Context, req ImportSanctionsListRequest) (*SanctionsImportResult, error) {
+	meta, ok := sanctionsListSources[req.Source]
+	if !ok {
+		return nil, ErrUnknownSanctionsSource
+	}
+	if req.Primary == nil {
+		return nil, fmt.Errorf("%s list file is required", req.Source)
+	}
+	admin, err := s.system.IsSystemAdmin(ctx, req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user role: %w", err)
+	}
+	if !admin {
+		return nil, ErrSanctionsListForbidden
+	}
+
+	hash := sha256.New()
+	readAll := func(r io.Reader) ([]byte, error) {
+		if r == nil {
+			return nil, nil
+		}
+		data, err := io.ReadAll(r)
+		hash.Write(data)
+		return data, err
+	}
+	primary, err := readAll(req.Primary)
+	if err != nil {
+		return nil, err
+	}
+	alt, err := readAll(req.AltNames)
+	if err != nil {
+		return nil, err
+	}
+	add, err := readAll(req.Addresses)
+	if err != nil {
+		return nil, err
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	if existing, err := s.screeningRepo.GetSanctionsList(ctx, req.Source); err == nil && existing.Checksum == checksum {
+		return &SanctionsImportResult{List: existing, Unchanged: true}, nil
+	}
+
+	var parsed []screening.Entry
+	switch req.Source {
+	case screening.SourceOFAC:
+		parsed, err = screening.ParseOFAC(bytes.NewReader(primary), optionalReader(alt), optionalReader(add))
+	case screening.SourceEU:
+		parsed, err = screening.ParseEU(bytes.NewReader(primary))
+	case screening.SourceUN:
+		parsed, err = screening.ParseUN(bytes.NewReader(primary))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("%s list contains no entries", req.Source)
+	}
+
+	now := time.Now()
+	list := &models.SanctionsList{
+		Source:     req.Source,
+		Name:       meta.Name,
+		SourceURL:  req.SourceURL,
+		Checksum:   checksum,
+		EntryCount: len(parsed),
+		LoadedAt:   now,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if req.UserID != uuid.Nil {
+		list.LoadedBy = &req.UserID
+	}
+
+	entries := make([]*models.SanctionsEntry, 0, len(parsed))
+	for _, e := range parsed {
+		entries = append(entries, &models.SanctionsEntry{
+			Source:     e.Source,
+			ExternalID: e.ExternalID,
+			EntryType:  e.EntryType,
+			Name:       e.Name,
+			Aliases:    jsonStrings(e.Aliases),
+			Addresses:  jsonStrings(e.Addresses),
+			Countries:  jsonStrings(e.Countries),
+			Programs:   jsonStrings(e.Programs),
+			Remarks:    e.Remarks,
+			CreatedAt:  now,
+		})
+	}
+	if err := s.screeningRepo.ReplaceSanctionsList(ctx, list, entries); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.matcher = nil
+	s.mu.Unlock()
+
+	result := &SanctionsImportResult{List: list}
+	result.Rescreen, err = s.RescreenAll(ctx, uuid.Nil, "list_update")
+	if err != nil {
+		return result, fmt.Errorf("list loaded but re-screening failed: %w", err)
+	}
+	return result, nil
+}
+
+// DownloadSanctionsList fetches a list from its publisher and imports it.
+// For OFAC the alternate name and address files are fetched as well.
+func (s *screeningService) DownloadSanctionsList(ctx context.Context, source string, userID uuid.UUID) (*SanctionsImportResult, error) {
+	meta, ok := sanctionsListSources[source]
+	if !ok {
+		return nil, ErrUnknownSanctionsSource
+	}
+	// Check before downloading, ImportSanctionsList checks again
+	admin, err := s.system.IsSystemAdmin(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user role: %w", err)
+	}
+	if !admin {
+		return nil, ErrSanctionsListForbidden
+	}
+
+	req := ImportSanctionsListRequest{Source: source, SourceURL: meta.URL, UserID: userID}
+	primary, err := s.download(ctx, meta.URL)
+	if err != nil {
+		return nil, err
+	}
+	req.Primary = bytes.NewReader(primary)
+
+	if source == screening.SourceOFAC {
+		alt, err := s.download(ctx, meta.AltURL)
+		if err != nil {
+			return nil, err
+		}
+		add, err := s.download(ctx, meta.AddURL)
+		if err != nil {
+			return nil, err
+		}
+		req.AltNames = bytes.NewReader(alt)
+		req.Addresses = bytes.NewReader(add)
+	}
+
+	return s.ImportSanctionsList(ctx, req)
+}
+
+func (s *screeningService) download(ctx context.Context, url string) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: status %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (s *screeningService) ListSanctionsLists(ctx context.Context) ([]*models.SanctionsList, error) {
+	return s.screeningRepo.ListSanctionsLists(ctx)
+}
+
+// Policy
+
+// GetPolicy returns the company's thresholds, falling back to the defaults
+func (s *screeningService) GetPolicy(ctx context.Context, companyID uuid.UUID) (*models.ScreeningPolicy, error) {
+	policy, err := s.screeningRepo.GetScreeningPolicy(ctx, companyID)
+	if err == repository.ErrNotFound {
+		defaults := screening.DefaultThresholds()
+		return &models.ScreeningPolicy{
+			CompanyID:     companyID,
+			MatchScore:    defaults.MatchScore,
+			NameScore:     defaults.NameScore,
+			AddressWeight: defaults.AddressWeight,
+		}, nil
+	}
+	return policy, err
+}
+
+func (s *screeningService) UpdatePolicy(ctx context.Context, companyID, userID uuid.UUID, thresholds screening.Thresholds) (*models.ScreeningPolicy, error) {
+	for _, v := range []float64{thresholds.MatchScore, thresholds.NameScore, thresholds.AddressWeight} {
+		if v < 0 || v > 1 {
+			return nil, ErrInvalidScreeningThresholds
+		}
+	}
+
+	policy, err := s.GetPolicy(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if policy.ID == uuid.Nil {
+		policy.CreatedAt = now
+	}
+	policy.MatchScore = thresholds.MatchScore
+	policy.NameScore = thresholds.NameScore
+	policy.AddressWeight = thresholds.AddressWeight
+	policy.UpdatedAt = now
+	policy.UpdatedBy = &userID
+
+	if err := s.screeningRepo.SaveScreeningPolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (s *screeningService) thresholds(ctx context.Context, companyID uuid.UUID) (screening.Thresholds, error) {
+	policy, err := s.GetPolicy(ctx, companyID)
+	if err != nil {
+		return screening.Thresholds{}, err
+	}
+	return screening.Thresholds{
+		MatchScore:    policy.MatchScore,
+		NameScore:     policy.NameScore,
+		AddressWeight: policy.AddressWeight,
+	}, nil
+}
+
+// Screening
+
+func (s *screeningService) ScreenCustomer(ctx context.Context, customerID uuid.UUID, trigger string) ([]*models.ScreeningHit, error) {
+	customer, err := s.screeningRepo.GetCustomer(ctx, customerID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrCustomerNotFound
+		}
+		return nil, err
+	}
+	return s.screenCustomer(ctx, customer, trigger)
+}
+
+func (s *screeningService) screenCustomer(ctx context.Context, customer *models.Customer, trigger string) ([]*models.ScreeningHit, error) {
+	names := []string{customer.Name}
+	if customer.NameEn != nil {
+		names = append(names, *customer.NameEn)
+	}
+	address := stringValue(customer.Address)
+	if address == "" {
+		address = stringValue(customer.ShippingAddress)
+	}
+	return s.screenParty(ctx, customer.CompanyID, ScreeningPartyCustomer, customer.ID, trigger, screening.Party{
+		Names:   names,
+		Address: address,
+		Country: customer.Country,
+	})
+}
+
+func (s *screeningService) ScreenSupplier(ctx context.Context, supplierID uuid.UUID, trigger string) ([]*models.ScreeningHit, error) {
+	supplier, err := s.screeningRepo.GetSupplier(ctx, supplierID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrSupplierNotFound
+		}
+		return nil, err
+	}
+	return s.screenSupplier(ctx, supplier, trigger)
+}
+
+func (s *screeningService) screenSupplier(ctx context.Context, supplier *models.Supplier, trigger string) ([]*models.ScreeningHit, error) {
+	address := strings.TrimSpace(strings.Join([]string{supplier.Address, supplier.City}, " "))
+	return s.screenParty(ctx, supplier.CompanyID, ScreeningPartySupplier, supplier.ID, trigger, screening.Party{
+		Names:   []string{supplier.Name, supplier.NameEn},
+		Address: address,
+		Country: supplier.Country,
+	})
+}
+
+// ScreenShipment screens the shipment consignee, which defaults to the order's customer
+func (s *screeningService) ScreenShipment(ctx context.Context, shipment *models.Shipment, trigger string) ([]*models.ScreeningHit, error) {
+	party := screening.Party{
+		Address: shipment.ConsigneeAddress,
+		Country: shipment.DestCountry,
+	}
+	if shipment.ConsigneeName != "" {
+		party.Names = []string{shipment.ConsigneeName}
+	}
+	if party.Address == "" {
+		party.Address = shipment.DestAddress
+	}
+
+	if len(party.Names) == 0 && shipment.OrderID != nil {
+		order, err := s.orderRepo.GetWithDetails(*shipment.OrderID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load order: %w", err)
+		}
+		if order.Customer != nil {
+			party.Names = []string{order.Customer.Name}
+			if order.Customer.NameEn != nil {
+				party.Names = append(party.Names, *order.Customer.NameEn)
+			}
+		}
+		if party.Address == "" {
+			party.Address = order.ShippingAddress
+		}
+	}
+	if len(party.Names) == 0 {
+		return nil, nil
+	}
+
+	return s.screenParty(ctx, shipment.CompanyID, ScreeningPartyShipment, shipment.ID, trigger, party)
+}
+
+// RescreenAll screens every customer and supplier of a company, or of all companies when companyID is uuid.Nil
+func (s *screeningService) RescreenAll(ctx context.Context, companyID uuid.UUID, trigger string) (*RescreenResult, error) {
+	customers, err := s.screeningRepo.ListCustomers(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	suppliers, err := s.screeningRepo.ListSuppliers(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RescreenResult{}
+	countOpen := func(hits []*models.ScreeningHit) {
+		for _, hit := range hits {
+			if hit.Status == "open" {
+				result.OpenHits++
+			}
+		}
+	}
+	for _, customer := range customers {
+		hits, err := s.screenCustomer(ctx, customer, trigger)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("customer %s: %v", customer.ID, err))
+			continue
+		}
+		result.Customers++
+		countOpen(hits)
+	}
+	for _, supplier := range suppliers {
+		hits, err := s.screenSupplier(ctx, supplier, trigger)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("supplier %s: %v", supplier.ID, err))
+			continue
+		}
+		result.Suppliers++
+		countOpen(hits)
+	}
+	return result, nil
+}
+
+// screenParty matches a party against all loaded lists and records new hits.
+// A hit that was cleared stays cleared unless the party's name or address
+// changed since the review.
+func (s *screeningService) screenParty(ctx context.Context, companyID uuid.UUID, partyType string, partyID uuid.UUID, trigger string, party screening.Party) ([]*models.ScreeningHit, error) {
+	matcher, entries, err := s.loadMatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	thresholds, err := s.thresholds(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	partyName := strings.Join(nonEmpty(party.Names), " / ")
+	var hits []*models.ScreeningHit
+	for _, match := range matcher.Screen(party, thresholds) {
+		entry := entries[match.Index]
+		now := time.Now()
+
+		hit, err := s.screeningRepo.FindScreeningHit(ctx, partyType, partyID, entry.Source, entry.ExternalID)
+		switch {
+		case err == nil:
+			hit.Score = match.Score
+			hit.NameScore = match.NameScore
+			hit.AddressScore = match.AddressScore
+			hit.MatchedName = match.MatchedName
+			hit.EntryName = entry.Name
+			if hit.Status == "cleared" && (hit.PartyName != partyName || hit.PartyAddress != party.Address) {
+				hit.Status = "open"
+				hit.Trigger = trigger
+				hit.ReviewNotes = strings.TrimSpace(hit.ReviewNotes + "\nReopened: party details changed after review")
+			}
+			hit.PartyName = partyName
+			hit.PartyAddress = party.Address
+			hit.PartyCountry = party.Country
+			hit.UpdatedAt = now
+			if err := s.screeningRepo.UpdateScreeningHit(ctx, hit); err != nil {
+				return nil, err
+			}
+		case err == repository.ErrNotFound:
+			hit = &models.ScreeningHit{
+				CompanyID:       companyID,
+				PartyType:       partyType,
+				PartyID:         partyID,
+				PartyName:       partyName,
+				PartyAddress:    party.Address,
+				PartyCountry:    party.Country,
+				ListSource:      entry.Source,
+				EntryExternalID: entry.ExternalID,
+				EntryName:       entry.Name,
+				EntryType:       entry.EntryType,
+				MatchedName:     match.MatchedName,
+				Programs:        strings.Join(decodeJSONStrings(entry.Programs), ", "),
+				Score:           match.Score,
+				NameScore:       match.NameScore,
+				AddressScore:    match.AddressScore,
+				Trigger:         trigger,
+				Status:          "open",
+				CreatedAt:       now,
+				UpdatedAt:       now,
+			}
+			if err := s.screeningRepo.CreateScreeningHit(ctx, hit); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// loadMatcher returns a matcher over all loaded entries, rebuilding it when a list was reloaded
+func (s *screeningService) loadMatcher(ctx context.Context) (*screening.Matcher, []*models.SanctionsEntry, error) {
+	lists, err := s.screeningRepo.ListSanctionsLists(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	stamps := make([]string, 0, len(lists))
+	for _, list := range lists {
+		stamps = append(stamps, list.Source+":"+list.Checksum)
+	}
+	stamp := strings.Join(stamps, ",")
+
+	s.mu.RLock()
+	if s.matcher != nil && s.matcherStamp == stamp {
+		matcher, entries := s.matcher, s.entries
+		s.mu.RUnlock()
+		return matcher, entries, nil
+	}
+	s.mu.RUnlock()
+
+	entries, err := s.screeningRepo.ListSanctionsEntries(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed := make([]screening.Entry, len(entries))
+	for i, e := range entries {
+		parsed[i] = screening.Entry{
+			Source:     e.Source,
+			ExternalID: e.ExternalID,
+			EntryType:  e.EntryType,
+			Name:       e.Name,
+			Aliases:    decodeJSONStrings(e.Aliases),
+			Addresses:  decodeJSONStrings(e.Addresses),
+			Countries:  decodeJSONStrings(e.Countries),
+		}
+	}
+	matcher := screening.NewMatcher(parsed)
+
+	s.mu.Lock()
+	s.matcher, s.entries, s.matcherStamp = matcher, entries, stamp
+	s.mu.Unlock()
+	return matcher, entries, nil
+}
+
+// Review
+
+func (s *screeningService) ListHits(ctx context.Context, params map[string]interface{}) ([]*models.ScreeningHit, int64, error) {
+	return s.screeningRepo.ListScreeningHits(ctx, params)
+}
+
+func (s *screeningService) GetHit(ctx context.Context, companyID, id uuid.UUID) (*models.ScreeningHit, error) {
+	hit, err := s.screeningRepo.GetScreeningHit(ctx, companyID, id)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrScreeningHitNotFound
+		}
+		return nil, err
+	}
+	return hit, nil
+}
+
+// ClearHit marks a hit as a false positive, releasing the party
+func (s *screeningService) ClearHit(ctx context.Context, companyID, id, userID uuid.UUID, notes string) (*models.ScreeningHit, error) {
+	if strings.TrimSpace(notes) == "" {
+		return nil, ErrScreeningReviewNotes
+	}
+	return s.reviewHit(ctx, companyID, id, userID, "cleared", notes)
+}
+
+// ConfirmHit marks a hit as a true match; the party stays blocked
+func (s *screeningService) ConfirmHit(ctx context.Context, companyID, id, userID uuid.UUID, notes string) (*models.ScreeningHit, error) {
+	return s.reviewHit(ctx, companyID, id, userID, "confirmed", notes)
+}
+
+func (s *screeningService) reviewHit(ctx context.Context, companyID, id, userID uuid.UUID, status, notes string) (*models.ScreeningHit, error) {
+	hit, err := s.GetHit(ctx, companyID, id)
+	if err != nil {
+		return nil, err
+	}
+	if hit.Status != "open" {
+		return nil, ErrScreeningHitNotOpen
+	}
+
+	now := time.Now()
+	hit.Status = status
+	hit.ReviewedBy = &userID
+	hit.ReviewedAt = &now
+	hit.ReviewNotes = strings.TrimSpace(hit.ReviewNotes + "\n" + notes)
+	hit.UpdatedAt = now
+	if err := s.screeningRepo.UpdateScreeningHit(ctx, hit); err != nil {
+		return nil, err
+	}
+	return hit, nil
+}
+
+// Blocking checks
+
+// EnsureCustomerCleared screens the customer and fails while any hit is open or confirmed
+func (s *screeningService) EnsureCustomerCleared(ctx context.Context, customerID uuid.UUID) error {
+	if _, err := s.ScreenCustomer(ctx, customerID, "order"); err != nil {
+		return err
+	}
+	return s.ensureCleared(ctx, ScreeningPartyCustomer, customerID)
+}
+
+// EnsureShipmentCleared screens the consignee and fails while the consignee
+// or the order's customer has an open or confirmed hit
+func (s *screeningService) EnsureShipmentCleared(ctx context.Context, shipment *models.Shipment) error {
+	if _, err := s.ScreenShipment(ctx, shipment, "shipment"); err != nil {
+		return err
+	}
+	if err := s.ensureCleared(ctx, ScreeningPartyShipment, shipment.ID); err != nil {
+		return err
+	}
+	if shipment.OrderID != nil {
+		order, err := s.orderRepo.Get(*shipment.OrderID)
+		if err != nil {
+			return fmt.Errorf("failed to load order: %w", err)
+		}
+		return s.ensureCleared(ctx, ScreeningPartyCustomer, order.CustomerID)
+	}
+	return nil
+}
+
+func (s *screeningService) ensureCleared(ctx context.Context, partyType string, partyID uuid.UUID) error {
+	count, err := s.screeningRepo.CountBlockingHits(ctx, partyType, partyID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %d unresolved hit(s) for %s %s", ErrPartyBlockedByScreening, count, partyType, partyID)
+	}
+	return nil
+}
+
+func optionalReader(data []byte) io.Reader {
+	if data == nil {
+		return nil
+	}
+	return bytes.NewReader(data)
+}
+
+func jsonStrings(values []string) datatypes.JSON {
+	if values == nil {
+		values = []string{}
+	}
+	data, _ := json.Marshal(values)
+	return datatypes.JSON(data)
+}
+
+func decodeJSONStrings(data datatypes.JSON) []string {
+	var values []string
+	if len(data) > 0 {
+		_ = json.Unmarshal(data, &values)
+	}
+	return values
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func nonEmpty(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -1,8 +1,14 @@
 package service
 
 import (
+	"fmt"
+
 	"github.com/fastenmind/fastener-api/internal/config"
+	"github.com/fastenmind/fastener-api/internal/infrastructure/exportdoc"
 	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/fastenmind/fastener-api/internal/security"
+	"github.com/fastenmind/fastener-api/internal/services"
+	"github.com/fastenmind/fastener-api/pkg/resources"
 	"gorm.io/gorm"
 )
 
@@ -24,18 +30,67 @@ type Services struct {
 	Quote              QuoteService
 	Order              OrderService
 	Inventory          InventoryService
+	Production         ProductionService
+	JobCost            JobCostService
+	CostCalibration    CostCalibrationService
+	Sampling           SamplingService
+	SPC                SPCService
+	NCR                NCRService
+	Certificate        CertificateService
+	PPAP               PPAPService
+	Supplier           SupplierService
+	InvoiceMatch       InvoiceMatchService
+	Subcontract        SubcontractService
+	ProductMaster      ProductMasterService
+	SupplierScorecard  SupplierScorecardService
+	System             SystemService
+	Finance            FinanceService
+	Ledger             LedgerService
+	BankReconciliation BankReconciliationService
+	FX                 FXService
+	Credit             CreditService
+	Dunning            DunningService
+	EInvoice           EInvoiceService
+	CashForecast       CashForecastService
 	Trade              TradeService
+	Screening          ScreeningService
+	Tracking           TrackingService
+	LoadPlan           LoadPlanService
+	ExportDocument     ExportDocumentService
 	Advanced           AdvancedService
 	Integration        IntegrationService
 	Report             ReportService
+	Mobile             MobileService
 }
 
-// NewServices creates new service instances
-func NewServices(repos *repository.Repositories, cfg *config.Config, db *gorm.DB) *Services {
+// NewServices creates new service instances. It fails when a configured
+// document signing key cannot be loaded.
+func NewServices(repos *repository.Repositories, cfg *config.Config, db *gorm.DB) (*Services, error) {
 	n8nService := NewN8NService(repos.N8N)
 	pdfGenerator := NewPDFGenerator()
 	
 	exchangeRateRepo := repository.NewExchangeRateRepository(db)
+	webhookService := NewWebhookService(n8nService)
+	ledgerService := NewLedgerService(repos.Ledger, exchangeRateRepo)
+	creditService := NewCreditService(repos.Credit, repos.Order, ledgerService, webhookService)
+	mobileService := NewMobileService(repos.Mobile, repos.User)
+	emailService := services.NewEmailService(cfg.Email.SMTPHost, cfg.Email.SMTPPort, cfg.Email.SMTPUser, cfg.Email.SMTPPassword)
+	jobCostService := NewJobCostService(repos.JobCost, repos.Production)
+	samplingService := NewSamplingService(repos.Sampling)
+	systemService := NewSystemService(repos.System, repos.User)
+	screeningService := NewScreeningService(repos.Screening, repos.Order, systemService)
+	invoiceMatchService := NewInvoiceMatchService(repos.InvoiceMatch, repos.Transactor, ledgerService, systemService)
+	supplierService := NewSupplierService(repos.Supplier, repos.Inventory, ledgerService, emailService, invoiceMatchService)
+	ncrService := NewNCRService(repos.NCR, repos.Supplier, supplierService)
+	ppapService := NewPPAPService(repos.PPAP, repos.Customer, repos.Inventory, repos.Production, systemService, cfg.Upload.Path)
+	documentSigner, err := security.LoadDocumentSigner(cfg.Signing.PrivateKeyFile, cfg.Signing.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("document signing: %w", err)
+	}
+	documentFont, err := exportdoc.LoadFont(cfg.Documents.FontFile)
+	if err != nil {
+		return nil, fmt.Errorf("document font %s: %w", cfg.Documents.FontFile, err)
+	}
 	
 	return &Services{
 		Account:            NewAccountService(repos.Account, cfg),
@@ -47,16 +102,43 @@ func NewServices(repos *repository.Repositories, cfg *config.Config, db *gorm.DB
 		Equipment:          NewEquipmentService(repos.Equipment),
 		AssignmentRule:     NewAssignmentRuleService(repos.AssignmentRule),
 		EngineerAssignment: NewEngineerAssignmentService(repos.EngineerAssignment, repos.Inquiry, repos.Account),
-		ProcessCost:        NewProcessCostService(repos.ProcessCost, repos.Material, repos.Equipment.(*repository.EquipmentRepository), exchangeRateRepo),
+		ProcessCost:        NewProcessCostService(repos.ProcessCost, repos.Material, repos.Equipment.(*repository.EquipmentRepository), exchangeRateRepo, jobCostService),
 		Tariff:             NewTariffService(repos.Tariff),
 		Compliance:         NewComplianceService(repos.Compliance),
 		N8N:                n8nService,
 		Quote:              NewQuoteService(repos.Quote, repos.Inquiry, repos.Customer, n8nService, pdfGenerator),
-		Order:              NewOrderService(repos.Order, repos.Quote, repos.Customer, n8nService),
-		Inventory:          NewInventoryService(repos.Inventory, repos.Order, n8nService),
-		Trade:              NewTradeService(repos.Trade),
+		Order:              NewOrderService(repos.Order, repos.Quote, repos.Customer, n8nService, screeningService, creditService),
+		Inventory:          NewInventoryService(repos.Inventory, repos.Order, repos.Transactor, n8nService, ledgerService),
+		Production:         NewProductionService(repos.Production, repos.Inventory, repos.Order, ledgerService, jobCostService, samplingService, ncrService, ppapService),
+		JobCost:            jobCostService,
+		CostCalibration:    NewCostCalibrationService(repos.CostCalibration),
+		Sampling:           samplingService,
+		SPC:                NewSPCService(repos.SPC, systemService),
+		NCR:                ncrService,
+		Certificate:        NewCertificateService(repos.Certificate, repos.Trade, repos.Order, documentSigner, cfg.Upload.Path),
+		PPAP:               ppapService,
+		Supplier:           supplierService,
+		InvoiceMatch:       invoiceMatchService,
+		Subcontract:        NewSubcontractService(repos.Subcontract, jobCostService, invoiceMatchService, systemService),
+		ProductMaster:      NewProductMasterService(repos.ProductMaster, repos.Customer, repos.Inventory, systemService, resources.GetGlobalResourceManager().Files(), cfg.Upload.Path),
+		SupplierScorecard:  NewSupplierScorecardService(repos.Scorecard),
+		System:             systemService,
+		Finance:            NewFinanceService(repos.Finance, repos.Order, repos.Customer, repos.Supplier, repos.Transactor, ledgerService, invoiceMatchService),
+		Ledger:             ledgerService,
+		BankReconciliation: NewBankReconciliationService(repos.BankStatement, repos.Finance, repos.Transactor, ledgerService),
+		FX:                 NewFXService(repos.Ledger, repos.Transactor, ledgerService),
+		Credit:             creditService,
+		Dunning:            NewDunningService(repos.Dunning, repos.Credit, creditService, mobileService, emailService),
+		EInvoice:           NewEInvoiceService(repos.EInvoice, documentSigner, cfg.Upload.Path),
+		CashForecast:       NewCashForecastService(repos.CashForecast, ledgerService),
+		Trade:              NewTradeService(repos.Trade, repos.Transactor, screeningService, creditService),
+		Screening:          screeningService,
+		Tracking:           NewTrackingService(repos.Tracking, webhookService),
+		LoadPlan:           NewLoadPlanService(repos.LoadPlan),
+		ExportDocument:     NewExportDocumentService(repos.Trade, repos.Order, repos.Transactor, cfg.Upload.Path, documentFont),
 		Advanced:           NewAdvancedService(),
 		Integration:        NewIntegrationService(),
 		Report:             NewReportService(repos.Report, repos.Company, repos.User),
-	}
+		Mobile:             mobileService,
+	}, nil
 }
\ No newline at end of file
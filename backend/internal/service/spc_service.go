@@ -0,0 +1,342 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/spc"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrCharacteristicNotFound is returned when a quality characteristic is
+	// not found
+	ErrCharacteristicNotFound = errors.New("quality characteristic not found")
+	// ErrInvalidCharacteristic is returned for a characteristic without
+	// name or product, with a subgroup size outside 1 to 10 or with a lower
+	// specification limit above the upper
+	ErrInvalidCharacteristic = errors.New("characteristic needs a name, a product, a subgroup size of 1 to 10 and a lower limit below the upper")
+	// ErrInvalidMeasurements is returned when no values are given or they
+	// do not fill whole subgroups
+	ErrInvalidMeasurements = errors.New("measurements must fill whole subgroups of the characteristic's subgroup size")
+	// ErrCharacteristicInactive is returned when measuring an inactive
+	// characteristic
+	ErrCharacteristicInactive = errors.New("quality characteristic is inactive")
+)
+
+// SPC alert notification targets
+const spcAlertRoles = `["manager","engineer"]`
+
+// MeasurementRequest is a capture of one or more subgroups of a
+// characteristic, in measuring order
+type MeasurementRequest struct {
+	Values            []float64  `json:"values"`
+	InspectionID      *uuid.UUID `json:"inspection_id"`
+	ProductionOrderID *uuid.UUID `json:"production_order_id"`
+	GaugeID           string     `json:"gauge_id"`
+	MeasuredAt        *time.Time `json:"measured_at"`
+}
+
+// MeasurementResult is a stored capture with the control charts it was
+// checked against and the alerts it raised
+type MeasurementResult struct {
+	Measurements []*models.CharacteristicMeasurement `json:"measurements"`
+	Analysis     *spc.Analysis                       `json:"analysis,omitempty"`
+	Alerts       []*models.SPCAlert                  `json:"alerts"`
+}
+
+// SPCReport is the control charts and capability of a characteristic
+type SPCReport struct {
+	Characteristic *models.QualityCharacteristic `json:"characteristic"`
+	Analysis       *spc.Analysis                 `json:"analysis"`
+}
+
+// SPCService manages the measured characteristics of products, captures
+// their measurements and charts them, raising a system notification for
+// every new Western Electric rule violation
+type SPCService interface {
+	// Characteristics
+	CreateCharacteristic(ctx context.Context, characteristic *models.QualityCharacteristic) error
+	UpdateCharacteristic(ctx context.Context, id uuid.UUID, characteristic *models.QualityCharacteristic) (*models.QualityCharacteristic, error)
+	GetCharacteristic(ctx context.Context, id uuid.UUID) (*models.QualityCharacteristic, error)
+	ListCharacteristics(ctx context.Context, params map[string]interface{}) ([]*models.QualityCharacteristic, int64, error)
+
+	// Measurements
+	RecordMeasurements(ctx context.Context, id uuid.UUID, req MeasurementRequest, userID uuid.UUID) (*MeasurementResult, error)
+	ListMeasurements(ctx context.Context, id uuid.UUID, params map[string]interface{}) ([]*models.CharacteristicMeasurement, error)
+
+	// Charts
+	GetSPC(ctx context.Context, id uuid.UUID, params map[string]interface{}) (*SPCReport, error)
+	ListAlerts(ctx context.Context, params map[string]interface{}) ([]*models.SPCAlert, int64, error)
+}
+
+type spcService struct {
+	spcRepo repository.SPCRepository
+	system  SystemService
+}
+
+// NewSPCService creates a new SPC service
+func NewSPCService(spcRepo repository.SPCRepository, system SystemService) SPCService {
+	return &spcService{
+		spcRepo: spcRepo,
+		system:  system,
+	}
+}
+
+// Characteristics
+
+func (s *spcService) CreateCharacteristic(ctx context.Context, characteristic *models.QualityCharacteristic) error {
+	if err := normalizeCharacteristic(characteristic); err != nil {
+		return err
+	}
+	characteristic.IsActive = true
+	return s.spcRepo.CreateCharacteristic(ctx, characteristic)
+}
+
+// UpdateCharacteristic changes a characteristic; measurements already taken
+// keep their out-of-spec flag
+func (s *spcService) UpdateCharacteristic(ctx context.Context, id uuid.UUID, characteristic *models.QualityCharacteristic) (*models.QualityCharacteristic, error) {
+	existing, err := s.GetCharacteristic(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	existing.Code = characteristic.Code
+	existing.Name = characteristic.Name
+	existing.Type = characteristic.Type
+	existing.Unit = characteristic.Unit
+	existing.Nominal = characteristic.Nominal
+	existing.LowerTolerance = characteristic.LowerTolerance
+	existing.UpperTolerance = characteristic.UpperTolerance
+	existing.Gauge = characteristic.Gauge
+	existing.SubgroupSize = characteristic.SubgroupSize
+	existing.ChartWindow = characteristic.ChartWindow
+	existing.IsActive = characteristic.IsActive
+	if err := normalizeCharacteristic(existing); err != nil {
+		return nil, err
+	}
+	if err := s.spcRepo.UpdateCharacteristic(ctx, existing); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (s *spcService) GetCharacteristic(ctx context.Context, id uuid.UUID) (*models.QualityCharacteristic, error) {
+	characteristic, err := s.spcRepo.GetCharacteristic(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrCharacteristicNotFound
+	}
+	return characteristic, err
+}
+
+func (s *spcService) ListCharacteristics(ctx context.Context, params map[string]interface{}) ([]*models.QualityCharacteristic, int64, error) {
+	return s.spcRepo.ListCharacteristics(ctx, params)
+}
+
+// Measurements
+
+// RecordMeasurements stores the values as whole subgroups after the last
+// one measured, charts the characteristic over its chart window and raises
+// an alert for each rule violation completed by the new subgroups
+func (s *spcService) RecordMeasurements(ctx context.Context, id uuid.UUID, req MeasurementRequest, userID uuid.UUID) (*MeasurementResult, error) {
+	characteristic, err := s.GetCharacteristic(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !characteristic.IsActive {
+		return nil, ErrCharacteristicInactive
+	}
+	n := characteristic.SubgroupSize
+	if len(req.Values) == 0 || len(req.Values)%n != 0 {
+		return nil, ErrInvalidMeasurements
+	}
+
+	measuredAt := time.Now()
+	if req.MeasuredAt != nil {
+		measuredAt = *req.MeasuredAt
+	}
+	lsl, usl := characteristic.Limits()
+	measurements := make([]*models.CharacteristicMeasurement, len(req.Values))
+	for i, v := range req.Values {
+		measurements[i] = &models.CharacteristicMeasurement{
+			CompanyID:         characteristic.CompanyID,
+			Subgroup:          i/n + 1, // renumbered after the last subgroup on save
+			Sequence:          i%n + 1,
+			Value:             v,
+			OutOfSpec:         (lsl != nil && v < *lsl) || (usl != nil && v > *usl),
+			InspectionID:      req.InspectionID,
+			ProductionOrderID: req.ProductionOrderID,
+			GaugeID:           req.GaugeID,
+			MeasuredBy:        &userID,
+			MeasuredAt:        measuredAt,
+		}
+	}
+	if err := s.spcRepo.AddMeasurements(ctx, characteristic.ID, measurements); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrCharacteristicNotFound
+		}
+		return nil, err
+	}
+
+	result := &MeasurementResult{Measurements: measurements, Alerts: []*models.SPCAlert{}}
+	analysis, err := s.analyze(ctx, characteristic, map[string]interface{}{"subgroups": characteristic.ChartWindow})
+	if errors.Is(err, spc.ErrTooFewSubgroups) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Analysis = analysis
+
+	// Only violations completed by the new subgroups are alerted; earlier
+	// ones were checked when they were captured
+	first := measurements[0].Subgroup
+	var alerts []*models.SPCAlert
+	for _, chart := range analysis.Charts {
+		for _, v := range chart.Violations {
+			if v.Subgroup < first {
+				continue
+			}
+			alerts = append(alerts, &models.SPCAlert{
+				CompanyID:        characteristic.CompanyID,
+				CharacteristicID: characteristic.ID,
+				Chart:            v.Chart,
+				Rule:             v.Rule,
+				Subgroup:         v.Subgroup,
+				Value:            v.Value,
+				Center:           chart.Center,
+				UCL:              chart.UCL,
+				LCL:              chart.LCL,
+				Description:      v.Description,
+			})
+		}
+	}
+	if len(alerts) == 0 {
+		return result, nil
+	}
+	created, err := s.spcRepo.CreateAlerts(ctx, alerts)
+	if err != nil {
+		return nil, err
+	}
+	for _, alert := range created {
+		s.notify(ctx, characteristic, alert, userID)
+	}
+	if created != nil {
+		result.Alerts = created
+	}
+	return result, nil
+}
+
+func (s *spcService) ListMeasurements(ctx context.Context, id uuid.UUID, params map[string]interface{}) ([]*models.CharacteristicMeasurement, error) {
+	return s.spcRepo.ListMeasurements(ctx, id, params)
+}
+
+// Charts
+
+// GetSPC charts a characteristic over the subgroups selected by params
+// (from, to, subgroups), by default its chart window
+func (s *spcService) GetSPC(ctx context.Context, id uuid.UUID, params map[string]interface{}) (*SPCReport, error) {
+	characteristic, err := s.GetCharacteristic(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := params["subgroups"]; !ok {
+		if _, ok := params["from"]; !ok {
+			params["subgroups"] = characteristic.ChartWindow
+		}
+	}
+	analysis, err := s.analyze(ctx, characteristic, params)
+	if err != nil {
+		return nil, err
+	}
+	return &SPCReport{Characteristic: characteristic, Analysis: analysis}, nil
+}
+
+func (s *spcService) ListAlerts(ctx context.Context, params map[string]interface{}) ([]*models.SPCAlert, int64, error) {
+	return s.spcRepo.ListAlerts(ctx, params)
+}
+
+// analyze charts the measurements of a characteristic selected by params
+func (s *spcService) analyze(ctx context.Context, characteristic *models.QualityCharacteristic, params map[string]interface{}) (*spc.Analysis, error) {
+	measurements, err := s.spcRepo.ListMeasurements(ctx, characteristic.ID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []spc.Subgroup
+	for _, m := range measurements {
+		if k := len(groups); k == 0 || groups[k-1].No != m.Subgroup {
+			groups = append(groups, spc.Subgroup{No: m.Subgroup})
+		}
+		g := &groups[len(groups)-1]
+		g.Values = append(g.Values, m.Value)
+	}
+	lsl, usl := characteristic.Limits()
+	return spc.Analyze(groups, characteristic.SubgroupSize, lsl, usl)
+}
+
+// notify raises a system notification for an alert; a failure is logged
+// and leaves the alert without notification
+func (s *spcService) notify(ctx context.Context, characteristic *models.QualityCharacteristic, alert *models.SPCAlert, userID uuid.UUID) {
+	name := characteristic.Name
+	if characteristic.Code != "" {
+		name = characteristic.Code + " " + name
+	}
+	companyID := characteristic.CompanyID
+	notification := &models.SystemNotification{
+		CompanyID: &companyID,
+		Title:     fmt.Sprintf("SPC out of control: %s", name),
+		Message: fmt.Sprintf("%s chart, subgroup %d: %s (rule %d). Value %.4g %s, center %.4g, limits %.4g to %.4g.",
+			strings.ToUpper(alert.Chart), alert.Subgroup, alert.Description, alert.Rule,
+			alert.Value, characteristic.Unit, alert.Center, alert.LCL, alert.UCL),
+		Type:         "warning",
+		Priority:     "high",
+		TargetRoles:  spcAlertRoles,
+		IsPersistent: true,
+		ActionLabel:  "View chart",
+		ActionURL:    fmt.Sprintf("/quality-characteristics/%s/spc", characteristic.ID),
+	}
+	if err := s.system.CreateSystemNotification(ctx, notification, userID); err != nil {
+		log.Printf("Failed to raise SPC alert notification for characteristic %s: %v", characteristic.ID, err)
+		return
+	}
+	if err := s.spcRepo.SetAlertNotification(ctx, alert.ID, notification.ID); err != nil {
+		log.Printf("Failed to link SPC alert %s to its notification: %v", alert.ID, err)
+		return
+	}
+	alert.NotificationID = &notification.ID
+}
+
+func normalizeCharacteristic(characteristic *models.QualityCharacteristic) error {
+	characteristic.Name = strings.TrimSpace(characteristic.Name)
+	characteristic.Code = strings.TrimSpace(characteristic.Code)
+	if characteristic.Type == "" {
+		characteristic.Type = models.CharacteristicOther
+	}
+	if characteristic.SubgroupSize == 0 {
+		characteristic.SubgroupSize = 5
+	}
+	if characteristic.ChartWindow < 2 {
+		characteristic.ChartWindow = 25
+	}
+
+	lsl, usl := characteristic.Limits()
+	switch {
+	case characteristic.Name == "",
+		characteristic.InventoryID == uuid.Nil,
+		characteristic.SubgroupSize < 1 || characteristic.SubgroupSize > spc.MaxSubgroupSize,
+		lsl != nil && usl != nil && *lsl >= *usl:
+		return ErrInvalidCharacteristic
+	}
+	switch characteristic.Type {
+	case models.CharacteristicPitchDiameter, models.CharacteristicHeadHeight, models.CharacteristicHardness,
+		models.CharacteristicTorque, models.CharacteristicOther:
+		return nil
+	}
+	return ErrInvalidCharacteristic
+}
@@ -0,0 +1,719 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/subcontract"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrSubcontractOrderNotFound is returned for unknown subcontract orders
+	ErrSubcontractOrderNotFound = errors.New("subcontract order not found")
+	// ErrInvalidSubcontractOrder is returned for subcontract orders missing
+	// what to process, how much or at what fee
+	ErrInvalidSubcontractOrder = errors.New("invalid subcontract order")
+	// ErrOperationNotSubcontracted is returned when subcontracting a route
+	// operation done in house
+	ErrOperationNotSubcontracted = errors.New("route operation is not subcontracted")
+	// ErrSubcontractOrderClosed is returned when shipping or receiving on a
+	// received or cancelled order
+	ErrSubcontractOrderClosed = errors.New("subcontract order is closed")
+	// ErrSubcontractOverReceipt is returned when receiving more than is at
+	// the subcontractor
+	ErrSubcontractOverReceipt = errors.New("more received than is at the subcontractor")
+	// ErrSubcontractShipped is returned when cancelling an order after
+	// material was shipped on it
+	ErrSubcontractShipped = errors.New("material was shipped on the subcontract order")
+	// ErrInsufficientStock is returned when shipping more material than is
+	// available
+	ErrInsufficientStock = repository.ErrInsufficientStock
+	// ErrSubcontractOrderChanged is returned when an order was shipped or
+	// received on concurrently; retry on the reloaded order
+	ErrSubcontractOrderChanged = repository.ErrStaleSubcontractOrder
+	// ErrInvalidSubcontractFee is returned for unknown fee bases and
+	// negative rates
+	ErrInvalidSubcontractFee = subcontract.ErrInvalidFee
+)
+
+// subcontractDeviationRoles are notified when processed goods come back
+// outside the expected weight change or yield
+const subcontractDeviationRoles = `["manager","engineer"]`
+
+// subcontractLeadDays is the due date of a subcontract order without one
+const subcontractLeadDays = 7
+
+// SubcontractService ships our own material to subcontractors for the
+// subcontracted operations of its route, such as plating and heat
+// treatment, and receives the processed goods back into stock. Material
+// shipped leaves CurrentStock for the item's AtVendorStock until it comes
+// back; it stays on the books at material cost, and the processing fee
+// reaches the ledger through the subcontractor's invoice, matched against
+// the fee purchase order of the subcontract order.
+type SubcontractService interface {
+	CreateOrder(ctx context.Context, req *SubcontractOrderRequest, userID uuid.UUID) (*models.SubcontractOrder, error)
+	// Ship ships material out of stock to the subcontractor
+	Ship(ctx context.Context, id uuid.UUID, req *SubcontractShipmentRequest, userID uuid.UUID) (*models.SubcontractOrder, error)
+	// Receive receives processed goods back into stock, charges the fee to
+	// the job and checks the weight change and yield
+	Receive(ctx context.Context, id uuid.UUID, req *SubcontractReceiptRequest, userID uuid.UUID) (*models.SubcontractOrder, error)
+	// Cancel cancels an order and its fee purchase order before anything
+	// was shipped
+	Cancel(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.SubcontractOrder, error)
+	GetOrder(ctx context.Context, id uuid.UUID) (*models.SubcontractOrder, error)
+	ListOrders(ctx context.Context, params map[string]interface{}) ([]*models.SubcontractOrder, int64, error)
+	// ListVendorStock totals our material at each subcontractor
+	ListVendorStock(ctx context.Context, companyID uuid.UUID) ([]*repository.VendorStock, error)
+}
+
+// SubcontractOrderRequest subcontracts an operation. Given a route
+// operation, the subcontractor, process, fee and expectations default to
+// the operation's; given a production order, the material and quantity to
+// the order's. OutputInventoryID defaults to the material shipped, for
+// processes that do not change the item.
+type SubcontractOrderRequest struct {
+	CompanyID         uuid.UUID  `json:"-"`
+	ProductionOrderID *uuid.UUID `json:"production_order_id"`
+	RouteOperationID  *uuid.UUID `json:"route_operation_id"`
+	SupplierID        *uuid.UUID `json:"supplier_id"`
+	Process           string     `json:"process"`
+	InventoryID       *uuid.UUID `json:"inventory_id"`
+	OutputInventoryID *uuid.UUID `json:"output_inventory_id"`
+	Quantity          float64    `json:"quantity"`
+	Weight            float64    `json:"weight"` // expected kg, ordered on a kg fee basis
+	FeeBasis          string     `json:"fee_basis"`
+	FeeRate           *float64   `json:"fee_rate"`
+	MinimumFee        *float64   `json:"minimum_fee"`
+	Currency          string     `json:"currency"`
+	DueDate           *time.Time `json:"due_date"`
+	Notes             string     `json:"notes"`
+
+	ExpectedWeightChangePct *float64 `json:"expected_weight_change_pct"`
+	WeightTolerancePct      *float64 `json:"weight_tolerance_pct"`
+	MinYieldPct             *float64 `json:"min_yield_pct"`
+}
+
+type SubcontractShipmentRequest struct {
+	Quantity  float64    `json:"quantity"`
+	Weight    float64    `json:"weight"` // kg
+	LotNo     string     `json:"lot_no"`
+	ShippedAt *time.Time `json:"shipped_at"`
+	Notes     string     `json:"notes"`
+}
+
+type SubcontractReceiptRequest struct {
+	Quantity      float64    `json:"quantity"`
+	ScrapQuantity float64    `json:"scrap_quantity"`
+	Weight        float64    `json:"weight"` // kg of the good parts
+	LotNo         string     `json:"lot_no"`
+	ReceivedAt    *time.Time `json:"received_at"`
+	Notes         string     `json:"notes"`
+}
+
+type subcontractService struct {
+	repo    repository.SubcontractRepository
+	jobCost JobCostService
+	matcher InvoiceMatchService
+	system  SystemService
+}
+
+// NewSubcontractService creates a new subcontract service
+func NewSubcontractService(repo repository.SubcontractRepository, jobCost JobCostService, matcher InvoiceMatchService, system SystemService) SubcontractService {
+	return &subcontractService{
+		repo:    repo,
+		jobCost: jobCost,
+		matcher: matcher,
+		system:  system,
+	}
+}
+
+func (s *subcontractService) CreateOrder(ctx context.Context, req *SubcontractOrderRequest, userID uuid.UUID) (*models.SubcontractOrder, error) {
+	order := &models.SubcontractOrder{
+		CompanyID:         req.CompanyID,
+		Status:            models.SubcontractStatusOpen,
+		ProductionOrderID: req.ProductionOrderID,
+		RouteOperationID:  req.RouteOperationID,
+		PlannedQuantity:   req.Quantity,
+		DueDate:           req.DueDate,
+		Notes:             req.Notes,
+		CreatedBy:         userID,
+	}
+	supplierID := req.SupplierID
+	var operation *models.RouteOperation
+
+	if req.RouteOperationID != nil {
+		op, err := s.repo.GetRouteOperation(ctx, *req.RouteOperationID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, fmt.Errorf("%w: route operation not found", ErrInvalidSubcontractOrder)
+			}
+			return nil, err
+		}
+		if op.Route == nil || op.Route.CompanyID != req.CompanyID {
+			return nil, fmt.Errorf("%w: route operation not found", ErrInvalidSubcontractOrder)
+		}
+		if !op.Subcontracted {
+			return nil, ErrOperationNotSubcontracted
+		}
+		operation = op
+		if supplierID == nil {
+			supplierID = op.SubcontractorID
+		}
+		order.Process = op.SubcontractProcess
+		order.FeeBasis = op.SubcontractFeeBasis
+		order.FeeRate = op.SubcontractFeeRate
+		order.MinimumFee = op.SubcontractMinimumFee
+		order.Currency = op.SubcontractCurrency
+		order.ExpectedWeightChangePct = op.ExpectedWeightChangePct
+		order.WeightTolerancePct = op.WeightTolerancePct
+		order.MinYieldPct = op.MinYieldPct
+	}
+
+	inventoryID := req.InventoryID
+	if req.ProductionOrderID != nil {
+		production, err := s.repo.GetProductionOrder(ctx, *req.ProductionOrderID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, ErrProductionOrderNotFound
+			}
+			return nil, err
+		}
+		if production.CompanyID != req.CompanyID {
+			return nil, ErrProductionOrderNotFound
+		}
+		if operation != nil && (production.RouteID == nil || *production.RouteID != operation.RouteID) {
+			return nil, fmt.Errorf("%w: the operation is not on the production order's route", ErrInvalidSubcontractOrder)
+		}
+		if inventoryID == nil {
+			inventoryID = &production.InventoryID
+		}
+		if order.PlannedQuantity == 0 {
+			order.PlannedQuantity = production.PlannedQuantity
+		}
+		if order.Currency == "" {
+			order.Currency = production.Currency
+		}
+	}
+
+	if req.Process != "" {
+		order.Process = req.Process
+	}
+	if order.Process == "" {
+		order.Process = models.SubcontractProcessOther
+	}
+	if req.FeeBasis != "" {
+		order.FeeBasis = req.FeeBasis
+	}
+	if order.FeeBasis == "" {
+		order.FeeBasis = subcontract.BasisPiece
+	}
+	if req.FeeRate != nil {
+		order.FeeRate = *req.FeeRate
+	}
+	if req.MinimumFee != nil {
+		order.MinimumFee = *req.MinimumFee
+	}
+	if req.Currency != "" {
+		order.Currency = strings.ToUpper(strings.TrimSpace(req.Currency))
+	}
+	if order.Currency == "" {
+		order.Currency = ledgerBaseCurrency
+	}
+	if req.ExpectedWeightChangePct != nil {
+		order.ExpectedWeightChangePct = *req.ExpectedWeightChangePct
+	}
+	if req.WeightTolerancePct != nil {
+		order.WeightTolerancePct = *req.WeightTolerancePct
+	}
+	if req.MinYieldPct != nil {
+		order.MinYieldPct = *req.MinYieldPct
+	}
+
+	switch order.Process {
+	case models.SubcontractProcessPlating, models.SubcontractProcessHeatTreatment, models.SubcontractProcessOther:
+	default:
+		return nil, fmt.Errorf("%w: unknown process %q", ErrInvalidSubcontractOrder, order.Process)
+	}
+	if err := subcontractFee(order).Validate(); err != nil {
+		return nil, err
+	}
+	if order.PlannedQuantity <= 0 {
+		return nil, fmt.Errorf("%w: a quantity is required", ErrInvalidSubcontractOrder)
+	}
+	if order.FeeBasis == subcontract.BasisKg && req.Weight <= 0 {
+		return nil, fmt.Errorf("%w: a fee per kg needs the expected weight", ErrInvalidSubcontractOrder)
+	}
+	if order.WeightTolerancePct < 0 || order.MinYieldPct < 0 || order.MinYieldPct > 100 {
+		return nil, fmt.Errorf("%w: tolerance and minimum yield must be between 0 and 100", ErrInvalidSubcontractOrder)
+	}
+
+	if supplierID == nil {
+		return nil, fmt.Errorf("%w: a subcontractor is required", ErrInvalidSubcontractOrder)
+	}
+	supplier, err := s.repo.GetSupplier(ctx, *supplierID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrSupplierNotFound
+		}
+		return nil, err
+	}
+	if supplier.CompanyID != req.CompanyID {
+		return nil, ErrSupplierNotFound
+	}
+	order.SupplierID = supplier.ID
+
+	if inventoryID == nil {
+		return nil, fmt.Errorf("%w: the material to ship is required", ErrInvalidSubcontractOrder)
+	}
+	inventory, err := s.companyInventory(ctx, req.CompanyID, *inventoryID)
+	if err != nil {
+		return nil, err
+	}
+	order.InventoryID = inventory.ID
+	order.OutputInventoryID = inventory.ID
+	if req.OutputInventoryID != nil && *req.OutputInventoryID != inventory.ID {
+		output, err := s.companyInventory(ctx, req.CompanyID, *req.OutputInventoryID)
+		if err != nil {
+			return nil, err
+		}
+		order.OutputInventoryID = output.ID
+	}
+
+	warehouse, err := s.vendorWarehouse(ctx, supplier)
+	if err != nil {
+		return nil, err
+	}
+	order.VendorWarehouseID = warehouse.ID
+
+	now := time.Now()
+	order.OrderNo = fmt.Sprintf("SCO-%s-%06d", now.Format("200601"), now.UnixMicro()%1000000)
+	if order.DueDate == nil {
+		due := now.AddDate(0, 0, subcontractLeadDays)
+		order.DueDate = &due
+	}
+	purchaseOrder := subcontractPurchaseOrder(order, supplier, inventory, req.Weight, now)
+
+	if err := s.repo.CreateOrder(ctx, order, purchaseOrder); err != nil {
+		return nil, fmt.Errorf("failed to create subcontract order: %w", err)
+	}
+	return s.GetOrder(ctx, order.ID)
+}
+
+func (s *subcontractService) Ship(ctx context.Context, id uuid.UUID, req *SubcontractShipmentRequest, userID uuid.UUID) (*models.SubcontractOrder, error) {
+	if req.Quantity <= 0 || req.Weight < 0 {
+		return nil, fmt.Errorf("%w: a positive quantity is required", ErrInvalidSubcontractOrder)
+	}
+	order, err := s.GetOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status == models.SubcontractStatusReceived || order.Status == models.SubcontractStatusCancelled {
+		return nil, ErrSubcontractOrderClosed
+	}
+	inventory := order.Inventory
+	if inventory == nil {
+		return nil, fmt.Errorf("%w: material not found", ErrInvalidSubcontractOrder)
+	}
+	if inventory.AvailableStock < req.Quantity {
+		return nil, fmt.Errorf("%w: available %.2f, requested %.2f", ErrInsufficientStock, inventory.AvailableStock, req.Quantity)
+	}
+
+	shippedAt := time.Now()
+	if req.ShippedAt != nil {
+		shippedAt = *req.ShippedAt
+	}
+	lotNo := strings.TrimSpace(req.LotNo)
+	unitCost := inventoryUnitCost(inventory)
+	movement := &models.StockMovement{
+		CompanyID:       order.CompanyID,
+		MovementType:    "transfer",
+		Reason:          "subcontract",
+		Quantity:        -req.Quantity,
+		UnitCost:        unitCost,
+		TotalCost:       -req.Quantity * unitCost,
+		ReferenceType:   "subcontract_order",
+		ReferenceID:     &order.ID,
+		ReferenceNo:     order.OrderNo,
+		FromWarehouseID: inventory.WarehouseID,
+		ToWarehouseID:   &order.VendorWarehouseID,
+		FromLocation:    inventory.Location,
+		BatchNo:         lotNo,
+		Notes:           req.Notes,
+		CreatedBy:       userID,
+		CreatedAt:       shippedAt,
+	}
+	shipment := &models.SubcontractShipment{
+		SubcontractOrderID: order.ID,
+		Quantity:           req.Quantity,
+		Weight:             req.Weight,
+		LotNo:              lotNo,
+		ShippedAt:          shippedAt,
+		ShippedBy:          userID,
+		Notes:              req.Notes,
+	}
+
+	previous := order.AtVendorQuantity
+	order.ShippedQuantity += req.Quantity
+	order.ShippedWeight += req.Weight
+	applySubcontractBalance(order)
+
+	if err := s.repo.Ship(ctx, order, previous, shipment, movement); err != nil {
+		if errors.Is(err, repository.ErrInsufficientStock) {
+			return nil, ErrInsufficientStock
+		}
+		return nil, fmt.Errorf("failed to ship to subcontractor: %w", err)
+	}
+	return s.GetOrder(ctx, order.ID)
+}
+
+func (s *subcontractService) Receive(ctx context.Context, id uuid.UUID, req *SubcontractReceiptRequest, userID uuid.UUID) (*models.SubcontractOrder, error) {
+	if req.Quantity < 0 || req.ScrapQuantity < 0 || req.Weight < 0 || req.Quantity+req.ScrapQuantity <= 0 {
+		return nil, fmt.Errorf("%w: a positive quantity received or scrapped is required", ErrInvalidSubcontractOrder)
+	}
+	order, err := s.GetOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status == models.SubcontractStatusReceived || order.Status == models.SubcontractStatusCancelled {
+		return nil, ErrSubcontractOrderClosed
+	}
+	if req.Quantity+req.ScrapQuantity > order.AtVendorQuantity+1e-9 {
+		return nil, fmt.Errorf("%w: %g returned, %g at the subcontractor",
+			ErrSubcontractOverReceipt, req.Quantity+req.ScrapQuantity, order.AtVendorQuantity)
+	}
+	if order.FeeBasis == subcontract.BasisKg && req.Quantity > 0 && req.Weight <= 0 {
+		return nil, fmt.Errorf("%w: a fee per kg needs the weight received", ErrInvalidSubcontractOrder)
+	}
+
+	receivedAt := time.Now()
+	if req.ReceivedAt != nil {
+		receivedAt = *req.ReceivedAt
+	}
+	lotNo := strings.TrimSpace(req.LotNo)
+	charge := subcontractFee(order).Charge(req.Quantity, req.ScrapQuantity, req.Weight)
+
+	receipt := &models.SubcontractReceipt{
+		SubcontractOrderID: order.ID,
+		Quantity:           req.Quantity,
+		ScrapQuantity:      req.ScrapQuantity,
+		Weight:             req.Weight,
+		LotNo:              lotNo,
+		ChargedQuantity:    charge.Quantity,
+		FeeAmount:          charge.Amount,
+		ReceivedAt:         receivedAt,
+		ReceivedBy:         userID,
+		Notes:              req.Notes,
+	}
+
+	var movement *models.StockMovement
+	if req.Quantity > 0 {
+		// Processed goods are valued at the material cost plus the fee
+		unitCost := charge.Amount / req.Quantity
+		if order.Inventory != nil {
+			unitCost += inventoryUnitCost(order.Inventory)
+		}
+		movement = &models.StockMovement{
+			CompanyID:       order.CompanyID,
+			MovementType:    "transfer",
+			Reason:          "subcontract",
+			Quantity:        req.Quantity,
+			UnitCost:        unitCost,
+			TotalCost:       req.Quantity * unitCost,
+			ReferenceType:   "subcontract_order",
+			ReferenceID:     &order.ID,
+			ReferenceNo:     order.OrderNo,
+			FromWarehouseID: &order.VendorWarehouseID,
+			BatchNo:         lotNo,
+			Notes:           req.Notes,
+			CreatedBy:       userID,
+			CreatedAt:       receivedAt,
+		}
+		if order.OutputInventory != nil {
+			movement.ToWarehouseID = order.OutputInventory.WarehouseID
+			movement.ToLocation = order.OutputInventory.Location
+		}
+	}
+
+	var orderReceipt *models.PurchaseOrderReceipt
+	if charge.Quantity > 0 {
+		orderReceipt = &models.PurchaseOrderReceipt{
+			CompanyID:           order.CompanyID,
+			PurchaseOrderID:     order.PurchaseOrderID,
+			PurchaseOrderItemID: order.PurchaseOrderItemID,
+			SupplierID:          order.SupplierID,
+			Quantity:            charge.Quantity,
+			LotNo:               lotNo,
+			ReceivedAt:          receivedAt,
+			QualityPassed:       true,
+			InspectionNotes:     req.Notes,
+		}
+	}
+
+	previous := order.AtVendorQuantity
+	previousDeviations := len(subcontractDeviations(order))
+	order.ReceivedQuantity += req.Quantity
+	order.ReceivedWeight += req.Weight
+	order.ScrapQuantity += req.ScrapQuantity
+	order.FeeAmount += charge.Amount
+	deviations := applySubcontractBalance(order)
+
+	if err := s.repo.Receive(ctx, order, previous, receipt, movement, orderReceipt); err != nil {
+		return nil, fmt.Errorf("failed to receive from subcontractor: %w", err)
+	}
+
+	if len(deviations) > previousDeviations {
+		s.notifyDeviations(ctx, order, deviations, userID)
+	}
+	if s.matcher != nil {
+		if _, err := s.matcher.RematchOrder(ctx, order.PurchaseOrderID); err != nil {
+			log.Printf("Failed to rematch held invoices of purchase order %s: %v", order.PurchaseOrderID, err)
+		}
+	}
+	if s.jobCost != nil && order.ProductionOrderID != nil {
+		if _, err := s.jobCost.Recalculate(ctx, *order.ProductionOrderID); err != nil {
+			log.Printf("Failed to recalculate job cost of production order %s: %v", *order.ProductionOrderID, err)
+		}
+	}
+	return s.GetOrder(ctx, order.ID)
+}
+
+func (s *subcontractService) Cancel(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.SubcontractOrder, error) {
+	order, err := s.GetOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status == models.SubcontractStatusCancelled {
+		return order, nil
+	}
+	if order.ShippedQuantity > 0 {
+		return nil, ErrSubcontractShipped
+	}
+	now := time.Now()
+	order.Status = models.SubcontractStatusCancelled
+	order.ClosedAt = &now
+	if err := s.repo.CancelOrder(ctx, order, order.AtVendorQuantity); err != nil {
+		return nil, fmt.Errorf("failed to cancel subcontract order: %w", err)
+	}
+	return order, nil
+}
+
+func (s *subcontractService) GetOrder(ctx context.Context, id uuid.UUID) (*models.SubcontractOrder, error) {
+	order, err := s.repo.GetOrder(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrSubcontractOrderNotFound
+		}
+		return nil, err
+	}
+	return order, nil
+}
+
+func (s *subcontractService) ListOrders(ctx context.Context, params map[string]interface{}) ([]*models.SubcontractOrder, int64, error) {
+	return s.repo.ListOrders(ctx, params)
+}
+
+func (s *subcontractService) ListVendorStock(ctx context.Context, companyID uuid.UUID) ([]*repository.VendorStock, error) {
+	return s.repo.ListVendorStock(ctx, companyID)
+}
+
+func (s *subcontractService) companyInventory(ctx context.Context, companyID, id uuid.UUID) (*models.Inventory, error) {
+	inventory, err := s.repo.GetInventory(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("%w: inventory item not found", ErrInvalidSubcontractOrder)
+		}
+		return nil, err
+	}
+	if inventory.CompanyID != companyID {
+		return nil, fmt.Errorf("%w: inventory item not found", ErrInvalidSubcontractOrder)
+	}
+	return inventory, nil
+}
+
+// vendorWarehouse returns the location our material is kept at while at a
+// subcontractor, creating it on the first order
+func (s *subcontractService) vendorWarehouse(ctx context.Context, supplier *models.Supplier) (*models.Warehouse, error) {
+	warehouse, err := s.repo.FindVendorWarehouse(ctx, supplier.CompanyID, supplier.ID)
+	if err == nil {
+		return warehouse, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	warehouse = &models.Warehouse{
+		CompanyID:  supplier.CompanyID,
+		Code:       "SUB-" + supplier.SupplierNo,
+		Name:       supplier.Name,
+		Type:       "subcontractor",
+		SupplierID: &supplier.ID,
+		Address:    supplier.Address,
+		Manager:    supplier.ContactPerson,
+		Phone:      supplier.Phone,
+		IsActive:   true,
+	}
+	if err := s.repo.CreateWarehouse(ctx, warehouse); err != nil {
+		return nil, fmt.Errorf("failed to create subcontractor location: %w", err)
+	}
+	return warehouse, nil
+}
+
+// notifyDeviations raises a system notification for goods back outside
+// the expected weight change or yield; a failure is logged
+func (s *subcontractService) notifyDeviations(ctx context.Context, order *models.SubcontractOrder, deviations []subcontract.Deviation, userID uuid.UUID) {
+	if s.system == nil {
+		return
+	}
+	messages := make([]string, 0, len(deviations))
+	for _, d := range deviations {
+		messages = append(messages, d.Message)
+	}
+	supplier := order.SupplierID.String()
+	if order.Supplier != nil {
+		supplier = order.Supplier.Name
+	}
+	companyID := order.CompanyID
+	notification := &models.SystemNotification{
+		CompanyID:    &companyID,
+		Title:        fmt.Sprintf("Subcontract deviation: %s", order.OrderNo),
+		Message:      fmt.Sprintf("%s returned %s outside expectations:\n%s", supplier, order.Process, strings.Join(messages, "\n")),
+		Type:         "warning",
+		Priority:     "medium",
+		TargetRoles:  subcontractDeviationRoles,
+		IsPersistent: true,
+		ActionLabel:  "View subcontract order",
+		ActionURL:    fmt.Sprintf("/subcontract-orders/%s", order.ID),
+	}
+	if err := s.system.CreateSystemNotification(ctx, notification, userID); err != nil {
+		log.Printf("Failed to raise deviation notification for subcontract order %s: %v", order.ID, err)
+	}
+}
+
+// validateSubcontractOperation checks a subcontracted route operation
+// names its subcontractor and a valid fee, defaulting to a fee per piece
+func validateSubcontractOperation(op *models.RouteOperation) error {
+	if !op.Subcontracted {
+		return nil
+	}
+	if op.SubcontractorID == nil {
+		return fmt.Errorf("%w: a subcontracted operation needs a subcontractor", ErrInvalidSubcontractOrder)
+	}
+	if op.SubcontractFeeBasis == "" {
+		op.SubcontractFeeBasis = subcontract.BasisPiece
+	}
+	if op.SubcontractProcess == "" {
+		op.SubcontractProcess = models.SubcontractProcessOther
+	}
+	fee := subcontract.Fee{Basis: op.SubcontractFeeBasis, Rate: op.SubcontractFeeRate, Minimum: op.SubcontractMinimumFee}
+	return fee.Validate()
+}
+
+func subcontractFee(order *models.SubcontractOrder) subcontract.Fee {
+	return subcontract.Fee{Basis: order.FeeBasis, Rate: order.FeeRate, Minimum: order.MinimumFee}
+}
+
+func subcontractBalance(order *models.SubcontractOrder) subcontract.Balance {
+	return subcontract.Balance{
+		ShippedQuantity:  order.ShippedQuantity,
+		ShippedWeight:    order.ShippedWeight,
+		ReceivedQuantity: order.ReceivedQuantity,
+		ReceivedWeight:   order.ReceivedWeight,
+		ScrapQuantity:    order.ScrapQuantity,
+	}
+}
+
+func subcontractDeviations(order *models.SubcontractOrder) []subcontract.Deviation {
+	var deviations []subcontract.Deviation
+	if len(order.Deviations) > 0 {
+		_ = json.Unmarshal(order.Deviations, &deviations)
+	}
+	return deviations
+}
+
+// applySubcontractBalance recomputes what is at the subcontractor, the
+// yield, the weight change and the status of an order from its totals
+func applySubcontractBalance(order *models.SubcontractOrder) []subcontract.Deviation {
+	balance := subcontractBalance(order)
+	deviations := subcontract.Check(balance, subcontract.Expectation{
+		WeightChangePct:    order.ExpectedWeightChangePct,
+		WeightTolerancePct: order.WeightTolerancePct,
+		MinYieldPct:        order.MinYieldPct,
+	})
+	order.AtVendorQuantity = balance.AtVendor()
+	order.YieldPct = balance.YieldPct()
+	order.WeightChangePct = balance.WeightChangePct()
+	order.Deviations, _ = json.Marshal(deviations)
+
+	switch {
+	case order.ReceivedQuantity+order.ScrapQuantity == 0:
+		order.Status = models.SubcontractStatusAtVendor
+	case order.AtVendorQuantity <= 0 && order.ShippedQuantity >= order.PlannedQuantity:
+		order.Status = models.SubcontractStatusReceived
+		now := time.Now()
+		order.ClosedAt = &now
+	default:
+		order.Status = models.SubcontractStatusPartialReceived
+	}
+	return deviations
+}
+
+// subcontractPurchaseOrder is the draft purchase order for the processing
+// fee of a subcontract order, sent with the first shipment
+func subcontractPurchaseOrder(order *models.SubcontractOrder, supplier *models.Supplier, inventory *models.Inventory, weight float64, now time.Time) *models.PurchaseOrder {
+	quantity, unit := order.PlannedQuantity, "PCS"
+	switch order.FeeBasis {
+	case subcontract.BasisKg:
+		quantity, unit = weight, "KG"
+	case subcontract.BasisLot:
+		quantity, unit = 1, "LOT"
+	}
+	total := quantity * order.FeeRate
+	if total < order.MinimumFee {
+		total = order.MinimumFee
+	}
+
+	process := map[string]string{
+		models.SubcontractProcessPlating:       "Plating",
+		models.SubcontractProcessHeatTreatment: "Heat treatment",
+	}[order.Process]
+	if process == "" {
+		process = "Processing"
+	}
+	item := models.PurchaseOrderItem{
+		ProductName:     fmt.Sprintf("%s: %s", process, inventory.Name),
+		ProductCode:     inventory.SKU,
+		Specification:   inventory.SurfaceTreatment,
+		OrderedQuantity: quantity,
+		Unit:            unit,
+		UnitPrice:       order.FeeRate,
+		TotalPrice:      total,
+	}
+	if order.Process == models.SubcontractProcessHeatTreatment {
+		item.Specification = inventory.HeatTreatment
+	}
+
+	return &models.PurchaseOrder{
+		CompanyID:       order.CompanyID,
+		OrderNo:         fmt.Sprintf("PO%d", now.Unix()),
+		Status:          "draft",
+		SupplierID:      supplier.ID,
+		OrderDate:       now,
+		RequiredDate:    *order.DueDate,
+		SubTotal:        total,
+		TotalAmount:     total,
+		Currency:        order.Currency,
+		ExchangeRate:    1,
+		PaymentTerms:    supplier.PaymentTerms,
+		ShippingAddress: supplier.Address,
+		Notes:           fmt.Sprintf("Subcontract order %s: %g %s of %s", order.OrderNo, order.PlannedQuantity, inventory.Unit, inventory.SKU),
+		CreatedBy:       order.CreatedBy,
+		Items:           []models.PurchaseOrderItem{item},
+	}
+}
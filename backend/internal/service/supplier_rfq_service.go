@@ -0,0 +1,774 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/bidding"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrRequisitionNotFound is returned for unknown purchase requisitions
+	ErrRequisitionNotFound = errors.New("purchase requisition not found")
+	// ErrRequisitionClosed is returned when quoting a requisition that is
+	// already being quoted, ordered or cancelled
+	ErrRequisitionClosed = errors.New("purchase requisition is not open")
+	// ErrInvalidRequisition is returned for requisitions without items or
+	// with items lacking a description, quantity or unit
+	ErrInvalidRequisition = errors.New("invalid purchase requisition")
+	// ErrRFQNotFound is returned for unknown RFQs and invitation tokens
+	ErrRFQNotFound = errors.New("RFQ not found")
+	// ErrRFQClosed is returned when an RFQ no longer takes invitations or
+	// bids, or cannot be awarded
+	ErrRFQClosed = errors.New("RFQ is closed")
+	// ErrRFQNoSuppliers is returned when sending an RFQ nobody is invited to
+	ErrRFQNoSuppliers = errors.New("no suppliers are invited to the RFQ")
+	// ErrBidNotFound is returned for bids not made on the RFQ
+	ErrBidNotFound = errors.New("bid not found")
+	// ErrInvalidBid is returned for bids with unusable lines or validity
+	ErrInvalidBid = bidding.ErrInvalidBid
+	// ErrBidNotAwardable is returned for bids that do not quote every item
+	// or are no longer valid
+	ErrBidNotAwardable = errors.New("bid cannot be awarded")
+)
+
+// RFQMailer sends RFQ invitations by email
+type RFQMailer interface {
+	SendEmail(to []string, subject, body string) error
+}
+
+// Request structs
+type CreateRequisitionRequest struct {
+	CompanyID uuid.UUID                      `json:"-"`
+	Title     string                         `json:"title"`
+	NeededBy  *time.Time                     `json:"needed_by"`
+	Notes     string                         `json:"notes"`
+	Items     []CreateRequisitionItemRequest `json:"items"`
+}
+
+type CreateRequisitionItemRequest struct {
+	InventoryID   *uuid.UUID `json:"inventory_id"`
+	Category      string     `json:"category"`
+	Description   string     `json:"description"`
+	Specification string     `json:"specification"`
+	Quantity      float64    `json:"quantity"`
+	Unit          string     `json:"unit"`
+}
+
+type CreateRFQRequest struct {
+	Title       string      `json:"title"`
+	ResponseDue time.Time   `json:"response_due"`
+	Terms       string      `json:"terms"`
+	Weights     *RFQWeights `json:"weights"`
+	SupplierIDs []uuid.UUID `json:"supplier_ids"`
+}
+
+// RFQWeights are the relative weights of total cost of ownership, lead
+// time and supplier rating in the bid comparison
+type RFQWeights struct {
+	Cost     float64 `json:"cost"`
+	LeadTime float64 `json:"lead_time"`
+	Rating   float64 `json:"rating"`
+}
+
+type InviteSuppliersRequest struct {
+	SupplierIDs []uuid.UUID `json:"supplier_ids"`
+	// BidURL is the supplier-facing bid endpoint the invitation token is
+	// appended to; set by the handler
+	BidURL string `json:"-"`
+}
+
+type SubmitBidRequest struct {
+	Currency     string                 `json:"currency"`
+	ValidUntil   time.Time              `json:"valid_until"`
+	PaymentTerms string                 `json:"payment_terms"`
+	Incoterm     string                 `json:"incoterm"`
+	FreightCost  float64                `json:"freight_cost"`
+	ToolingCost  float64                `json:"tooling_cost"`
+	Notes        string                 `json:"notes"`
+	Lines        []SubmitBidLineRequest `json:"lines"`
+}
+
+type SubmitBidLineRequest struct {
+	RFQItemID    uuid.UUID            `json:"rfq_item_id"`
+	PriceBreaks  []bidding.PriceBreak `json:"price_breaks"`
+	MOQ          float64              `json:"moq"`
+	LeadTimeDays int                  `json:"lead_time_days"`
+	Notes        string               `json:"notes"`
+}
+
+// RFQBidderView is what an invited supplier sees of an RFQ
+type RFQBidderView struct {
+	RFQNo        string                   `json:"rfq_no"`
+	Title        string                   `json:"title"`
+	Terms        string                   `json:"terms"`
+	ResponseDue  time.Time                `json:"response_due"`
+	NeededBy     *time.Time               `json:"needed_by"`
+	Open         bool                     `json:"open"` // bids are still taken
+	SupplierName string                   `json:"supplier_name"`
+	Status       string                   `json:"status"` // of the invitation
+	Items        []models.SupplierRFQItem `json:"items"`
+	Bid          *models.SupplierBid      `json:"bid,omitempty"`
+}
+
+// BidComparison compares the bids on an RFQ in the base currency. Matrix
+// has a row per item with a cell per bid, in the order of Bids.
+type BidComparison struct {
+	RFQID            uuid.UUID       `json:"rfq_id"`
+	RFQNo            string          `json:"rfq_no"`
+	BaseCurrency     string          `json:"base_currency"`
+	Weights          RFQWeights      `json:"weights"`
+	Bids             []ComparedBid   `json:"bids"`
+	Matrix           []ComparisonRow `json:"matrix"`
+	RecommendedBidID *uuid.UUID      `json:"recommended_bid_id"`
+}
+
+// ComparedBid is a bid with its valuation and score
+type ComparedBid struct {
+	BidID        uuid.UUID          `json:"bid_id"`
+	SupplierID   uuid.UUID          `json:"supplier_id"`
+	SupplierName string             `json:"supplier_name"`
+	Status       string             `json:"status"`
+	Currency     string             `json:"currency"`
+	Rate         float64            `json:"rate"` // into the base currency
+	ValidUntil   time.Time          `json:"valid_until"`
+	PaymentTerms string             `json:"payment_terms"`
+	Incoterm     string             `json:"incoterm"`
+	Evaluation   bidding.Evaluation `json:"evaluation"`
+}
+
+// ComparisonRow is an RFQ item across the bids
+type ComparisonRow struct {
+	Item        models.SupplierRFQItem `json:"item"`
+	Cells       []bidding.Line         `json:"cells"`
+	LowestBidID *uuid.UUID             `json:"lowest_bid_id"` // lowest unit price in the base currency
+}
+
+// Purchase Requisition operations
+
+func (s *supplierService) CreateRequisition(req *CreateRequisitionRequest, userID uuid.UUID) (*models.PurchaseRequisition, error) {
+	if strings.TrimSpace(req.Title) == "" || len(req.Items) == 0 {
+		return nil, fmt.Errorf("%w: a title and at least one item are required", ErrInvalidRequisition)
+	}
+	now := time.Now()
+	requisition := &models.PurchaseRequisition{
+		CompanyID:     req.CompanyID,
+		RequisitionNo: fmt.Sprintf("PR-%s-%06d", now.Format("200601"), now.UnixMicro()%1000000),
+		Title:         strings.TrimSpace(req.Title),
+		Status:        models.RequisitionStatusOpen,
+		NeededBy:      req.NeededBy,
+		Notes:         req.Notes,
+		RequestedBy:   userID,
+	}
+	for i, item := range req.Items {
+		if strings.TrimSpace(item.Description) == "" || item.Quantity <= 0 || strings.TrimSpace(item.Unit) == "" {
+			return nil, fmt.Errorf("%w: item %d needs a description, a positive quantity and a unit", ErrInvalidRequisition, i+1)
+		}
+		requisition.Items = append(requisition.Items, models.PurchaseRequisitionItem{
+			LineNo:        i + 1,
+			InventoryID:   item.InventoryID,
+			Category:      item.Category,
+			Description:   strings.TrimSpace(item.Description),
+			Specification: item.Specification,
+			Quantity:      item.Quantity,
+			Unit:          strings.TrimSpace(item.Unit),
+		})
+	}
+
+	if err := s.supplierRepo.CreateRequisition(requisition); err != nil {
+		return nil, fmt.Errorf("failed to create purchase requisition: %w", err)
+	}
+	return requisition, nil
+}
+
+func (s *supplierService) GetRequisition(id uuid.UUID) (*models.PurchaseRequisition, error) {
+	requisition, err := s.supplierRepo.GetRequisition(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrRequisitionNotFound
+		}
+		return nil, err
+	}
+	return requisition, nil
+}
+
+func (s *supplierService) ListRequisitions(companyID uuid.UUID, params map[string]interface{}) ([]models.PurchaseRequisition, int64, error) {
+	return s.supplierRepo.ListRequisitions(companyID, params)
+}
+
+// RFQ operations
+
+// CreateRFQ creates an RFQ quoting the items of an open requisition and
+// invites the given suppliers. The RFQ is a draft until it is sent.
+func (s *supplierService) CreateRFQ(requisitionID uuid.UUID, req *CreateRFQRequest, userID uuid.UUID) (*models.SupplierRFQ, error) {
+	requisition, err := s.GetRequisition(requisitionID)
+	if err != nil {
+		return nil, err
+	}
+	if requisition.Status != models.RequisitionStatusOpen {
+		return nil, ErrRequisitionClosed
+	}
+	if !req.ResponseDue.After(time.Now()) {
+		return nil, fmt.Errorf("%w: the response due date must be in the future", ErrInvalidRequisition)
+	}
+	weights := RFQWeights(bidding.DefaultWeights())
+	if req.Weights != nil {
+		weights = *req.Weights
+		if weights.Cost < 0 || weights.LeadTime < 0 || weights.Rating < 0 || weights.Cost+weights.LeadTime+weights.Rating == 0 {
+			return nil, fmt.Errorf("%w: weights must not be negative and at least one must be positive", ErrInvalidRequisition)
+		}
+	}
+
+	now := time.Now()
+	rfq := &models.SupplierRFQ{
+		CompanyID:      requisition.CompanyID,
+		RFQNo:          fmt.Sprintf("RFQ-%s-%06d", now.Format("200601"), now.UnixMicro()%1000000),
+		RequisitionID:  &requisition.ID,
+		Title:          strings.TrimSpace(req.Title),
+		Status:         models.RFQStatusDraft,
+		ResponseDue:    req.ResponseDue,
+		NeededBy:       requisition.NeededBy,
+		Terms:          req.Terms,
+		BaseCurrency:   ledgerBaseCurrency,
+		CostWeight:     weights.Cost,
+		LeadTimeWeight: weights.LeadTime,
+		RatingWeight:   weights.Rating,
+		CreatedBy:      userID,
+	}
+	if rfq.Title == "" {
+		rfq.Title = requisition.Title
+	}
+	for _, item := range requisition.Items {
+		itemID := item.ID
+		rfq.Items = append(rfq.Items, models.SupplierRFQItem{
+			LineNo:            item.LineNo,
+			RequisitionItemID: &itemID,
+			InventoryID:       item.InventoryID,
+			Category:          item.Category,
+			Description:       item.Description,
+			Specification:     item.Specification,
+			Quantity:          item.Quantity,
+			Unit:              item.Unit,
+		})
+	}
+
+	if err := s.supplierRepo.CreateRFQ(rfq); err != nil {
+		return nil, fmt.Errorf("failed to create RFQ: %w", err)
+	}
+	if len(req.SupplierIDs) > 0 {
+		if _, err := s.InviteSuppliers(rfq.ID, &InviteSuppliersRequest{SupplierIDs: req.SupplierIDs}); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetRFQ(rfq.ID)
+}
+
+func (s *supplierService) GetRFQ(id uuid.UUID) (*models.SupplierRFQ, error) {
+	rfq, err := s.supplierRepo.GetRFQ(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrRFQNotFound
+		}
+		return nil, err
+	}
+	return rfq, nil
+}
+
+func (s *supplierService) ListRFQs(companyID uuid.UUID, params map[string]interface{}) ([]models.SupplierRFQ, int64, error) {
+	return s.supplierRepo.ListRFQs(companyID, params)
+}
+
+// InviteSuppliers invites suppliers of the RFQ's company that are not yet
+// invited. Invitations to an RFQ already sent are emailed right away.
+func (s *supplierService) InviteSuppliers(rfqID uuid.UUID, req *InviteSuppliersRequest) ([]models.SupplierRFQInvitation, error) {
+	rfq, err := s.GetRFQ(rfqID)
+	if err != nil {
+		return nil, err
+	}
+	if rfq.Status != models.RFQStatusDraft && rfq.Status != models.RFQStatusSent {
+		return nil, ErrRFQClosed
+	}
+	invited := make(map[uuid.UUID]bool, len(rfq.Invitations))
+	for _, inv := range rfq.Invitations {
+		invited[inv.SupplierID] = true
+	}
+
+	var invitations []models.SupplierRFQInvitation
+	for _, supplierID := range req.SupplierIDs {
+		if invited[supplierID] {
+			continue
+		}
+		supplier, err := s.supplierRepo.GetSupplier(supplierID)
+		if err != nil || supplier.CompanyID != rfq.CompanyID {
+			return nil, fmt.Errorf("%w: %s", ErrSupplierNotFound, supplierID)
+		}
+		token, err := generateToken(24)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate invitation token: %w", err)
+		}
+		invitation := models.SupplierRFQInvitation{
+			RFQID:      rfq.ID,
+			SupplierID: supplier.ID,
+			Token:      token,
+			Email:      supplier.Email,
+			Status:     models.RFQInvitationInvited,
+		}
+		if err := s.supplierRepo.CreateRFQInvitation(&invitation); err != nil {
+			return nil, fmt.Errorf("failed to invite supplier: %w", err)
+		}
+		invitation.Supplier = supplier
+		if rfq.Status == models.RFQStatusSent {
+			s.sendInvitation(rfq, &invitation, req.BidURL)
+		}
+		invited[supplierID] = true
+		invitations = append(invitations, invitation)
+	}
+	return invitations, nil
+}
+
+// SendRFQ opens a draft RFQ for bids and emails the invited suppliers
+// their bid links
+func (s *supplierService) SendRFQ(rfqID uuid.UUID, bidURL string) (*models.SupplierRFQ, error) {
+	rfq, err := s.GetRFQ(rfqID)
+	if err != nil {
+		return nil, err
+	}
+	if rfq.Status != models.RFQStatusDraft || !rfq.ResponseDue.After(time.Now()) {
+		return nil, ErrRFQClosed
+	}
+	if len(rfq.Invitations) == 0 {
+		return nil, ErrRFQNoSuppliers
+	}
+
+	now := time.Now()
+	rfq.Status = models.RFQStatusSent
+	rfq.SentAt = &now
+	if err := s.supplierRepo.UpdateRFQ(rfq); err != nil {
+		return nil, fmt.Errorf("failed to send RFQ: %w", err)
+	}
+	for i := range rfq.Invitations {
+		s.sendInvitation(rfq, &rfq.Invitations[i], bidURL)
+	}
+	return rfq, nil
+}
+
+// sendInvitation emails a supplier its bid link. Failures are kept on the
+// invitation so purchasing can pass the link on another way.
+func (s *supplierService) sendInvitation(rfq *models.SupplierRFQ, invitation *models.SupplierRFQInvitation, bidURL string) {
+	if invitation.Email == "" {
+		invitation.SendError = "supplier has no email"
+	} else if s.mailer == nil {
+		invitation.SendError = "no mailer configured"
+	} else {
+		subject := fmt.Sprintf("Request for quotation %s: %s", rfq.RFQNo, rfq.Title)
+		body := fmt.Sprintf("You are invited to quote on %s (%s).\n\nPlease submit your bid by %s at:\n%s/%s\n",
+			rfq.RFQNo, rfq.Title, rfq.ResponseDue.Format("2006-01-02 15:04"), strings.TrimRight(bidURL, "/"), invitation.Token)
+		if err := s.mailer.SendEmail([]string{invitation.Email}, subject, body); err != nil {
+			invitation.SendError = err.Error()
+		} else {
+			now := time.Now()
+			invitation.SentAt = &now
+			invitation.SendError = ""
+		}
+	}
+	if err := s.supplierRepo.UpdateRFQInvitation(invitation); err != nil {
+		log.Printf("Failed to record RFQ invitation %s: %v", invitation.ID, err)
+	}
+}
+
+// GetRFQForBidder returns the RFQ an invitation token gives access to and
+// the supplier's bid so far
+func (s *supplierService) GetRFQForBidder(token string) (*RFQBidderView, error) {
+	invitation, rfq, err := s.invitationRFQ(token)
+	if err != nil {
+		return nil, err
+	}
+	if invitation.Status == models.RFQInvitationInvited {
+		now := time.Now()
+		invitation.Status = models.RFQInvitationViewed
+		invitation.ViewedAt = &now
+		if err := s.supplierRepo.UpdateRFQInvitation(invitation); err != nil {
+			log.Printf("Failed to record RFQ invitation %s as viewed: %v", invitation.ID, err)
+		}
+	}
+
+	view := &RFQBidderView{
+		RFQNo:       rfq.RFQNo,
+		Title:       rfq.Title,
+		Terms:       rfq.Terms,
+		ResponseDue: rfq.ResponseDue,
+		NeededBy:    rfq.NeededBy,
+		Open:        rfqOpen(rfq),
+		Status:      invitation.Status,
+		Items:       rfq.Items,
+	}
+	if invitation.Supplier != nil {
+		view.SupplierName = invitation.Supplier.Name
+	}
+	if bid, err := s.supplierRepo.GetBidByInvitation(invitation.ID); err == nil {
+		view.Bid = bid
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	return view, nil
+}
+
+// SubmitBid records or replaces the supplier's bid while the RFQ is open.
+// Items may be left out; such bids are compared but cannot be awarded.
+func (s *supplierService) SubmitBid(token string, req *SubmitBidRequest) (*models.SupplierBid, error) {
+	invitation, rfq, err := s.invitationRFQ(token)
+	if err != nil {
+		return nil, err
+	}
+	if !rfqOpen(rfq) {
+		return nil, ErrRFQClosed
+	}
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if currency == "" && invitation.Supplier != nil {
+		currency = invitation.Supplier.Currency
+	}
+	if currency == "" {
+		return nil, fmt.Errorf("%w: currency is required", ErrInvalidBid)
+	}
+	if req.ValidUntil.Before(time.Now().Truncate(24 * time.Hour)) {
+		return nil, fmt.Errorf("%w: the bid must be valid until today or later", ErrInvalidBid)
+	}
+	if req.FreightCost < 0 || req.ToolingCost < 0 {
+		return nil, fmt.Errorf("%w: freight and tooling costs must not be negative", ErrInvalidBid)
+	}
+	if len(req.Lines) == 0 {
+		return nil, fmt.Errorf("%w: at least one item must be quoted", ErrInvalidBid)
+	}
+
+	items := make(map[uuid.UUID]bool, len(rfq.Items))
+	for _, item := range rfq.Items {
+		items[item.ID] = true
+	}
+	quoted := make(map[uuid.UUID]bool, len(req.Lines))
+	var lines []models.SupplierBidLine
+	for _, line := range req.Lines {
+		if !items[line.RFQItemID] || quoted[line.RFQItemID] {
+			return nil, fmt.Errorf("%w: unknown or repeated item %s", ErrInvalidBid, line.RFQItemID)
+		}
+		quoted[line.RFQItemID] = true
+		if err := bidding.ValidateBreaks(line.PriceBreaks); err != nil {
+			return nil, err
+		}
+		if line.MOQ < 0 || line.LeadTimeDays < 0 {
+			return nil, fmt.Errorf("%w: MOQ and lead time must not be negative", ErrInvalidBid)
+		}
+		breaks, err := json.Marshal(line.PriceBreaks)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, models.SupplierBidLine{
+			RFQItemID:    line.RFQItemID,
+			PriceBreaks:  breaks,
+			MOQ:          line.MOQ,
+			LeadTimeDays: line.LeadTimeDays,
+			Notes:        line.Notes,
+		})
+	}
+
+	bid, err := s.supplierRepo.GetBidByInvitation(invitation.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		bid = &models.SupplierBid{
+			RFQID:        rfq.ID,
+			InvitationID: invitation.ID,
+			SupplierID:   invitation.SupplierID,
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	bid.Status = models.BidStatusSubmitted
+	bid.Currency = currency
+	bid.ValidUntil = req.ValidUntil
+	bid.PaymentTerms = req.PaymentTerms
+	bid.Incoterm = req.Incoterm
+	bid.FreightCost = req.FreightCost
+	bid.ToolingCost = req.ToolingCost
+	bid.Notes = req.Notes
+	bid.SubmittedAt = now
+	bid.Lines = lines
+
+	invitation.Status = models.RFQInvitationSubmitted
+	invitation.RespondedAt = &now
+	invitation.DeclineReason = ""
+	if err := s.supplierRepo.SaveBid(bid, invitation); err != nil {
+		return nil, fmt.Errorf("failed to save bid: %w", err)
+	}
+	return bid, nil
+}
+
+// DeclineRFQ records that the supplier will not bid. A bid already
+// submitted is left for comparison.
+func (s *supplierService) DeclineRFQ(token string, reason string) error {
+	invitation, rfq, err := s.invitationRFQ(token)
+	if err != nil {
+		return err
+	}
+	if !rfqOpen(rfq) {
+		return ErrRFQClosed
+	}
+	if invitation.Status == models.RFQInvitationSubmitted {
+		return fmt.Errorf("%w: a bid has already been submitted", ErrInvalidBid)
+	}
+	now := time.Now()
+	invitation.Status = models.RFQInvitationDeclined
+	invitation.RespondedAt = &now
+	invitation.DeclineReason = reason
+	return s.supplierRepo.UpdateRFQInvitation(invitation)
+}
+
+// CompareBids values every bid in the base currency at today's rates and
+// scores the complete, valid ones on total cost of ownership, lead time
+// and supplier rating with the RFQ's weights
+func (s *supplierService) CompareBids(rfqID uuid.UUID) (*BidComparison, error) {
+	rfq, err := s.GetRFQ(rfqID)
+	if err != nil {
+		return nil, err
+	}
+	bids, err := s.supplierRepo.ListRFQBids(rfq.ID)
+	if err != nil {
+		return nil, err
+	}
+	evaluations, rates, err := s.evaluateBids(rfq, bids)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &BidComparison{
+		RFQID:        rfq.ID,
+		RFQNo:        rfq.RFQNo,
+		BaseCurrency: rfq.BaseCurrency,
+		Weights:      RFQWeights{Cost: rfq.CostWeight, LeadTime: rfq.LeadTimeWeight, Rating: rfq.RatingWeight},
+		Bids:         []ComparedBid{},
+		Matrix:       []ComparisonRow{},
+	}
+	for i, bid := range bids {
+		compared := ComparedBid{
+			BidID:        bid.ID,
+			SupplierID:   bid.SupplierID,
+			Status:       bid.Status,
+			Currency:     bid.Currency,
+			Rate:         rates[i],
+			ValidUntil:   bid.ValidUntil,
+			PaymentTerms: bid.PaymentTerms,
+			Incoterm:     bid.Incoterm,
+			Evaluation:   evaluations[i],
+		}
+		if bid.Supplier != nil {
+			compared.SupplierName = bid.Supplier.Name
+		}
+		if evaluations[i].Rank == 1 {
+			id := bid.ID
+			comparison.RecommendedBidID = &id
+		}
+		comparison.Bids = append(comparison.Bids, compared)
+	}
+
+	for row, item := range rfq.Items {
+		r := ComparisonRow{Item: item, Cells: []bidding.Line{}}
+		lowest := 0.0
+		for i, e := range evaluations {
+			cell := e.Lines[row]
+			r.Cells = append(r.Cells, cell)
+			if cell.Quoted && e.Eligible() && (r.LowestBidID == nil || cell.UnitPriceBase < lowest) {
+				id := bids[i].ID
+				r.LowestBidID = &id
+				lowest = cell.UnitPriceBase
+			}
+		}
+		comparison.Matrix = append(comparison.Matrix, r)
+	}
+	return comparison, nil
+}
+
+// AwardBid awards a complete, valid bid and creates its draft purchase
+// order at the quoted break prices and MOQ-adjusted quantities; tooling is
+// ordered as a line of its own. The other bids are rejected.
+func (s *supplierService) AwardBid(rfqID, bidID uuid.UUID, userID uuid.UUID) (*models.PurchaseOrder, error) {
+	rfq, err := s.GetRFQ(rfqID)
+	if err != nil {
+		return nil, err
+	}
+	if rfq.Status != models.RFQStatusSent {
+		return nil, ErrRFQClosed
+	}
+	bids, err := s.supplierRepo.ListRFQBids(rfq.ID)
+	if err != nil {
+		return nil, err
+	}
+	var bid *models.SupplierBid
+	for i := range bids {
+		if bids[i].ID == bidID {
+			bid = &bids[i]
+		}
+	}
+	if bid == nil {
+		return nil, ErrBidNotFound
+	}
+	evaluations, rates, err := s.evaluateBids(rfq, []models.SupplierBid{*bid})
+	if err != nil {
+		return nil, err
+	}
+	evaluation := evaluations[0]
+	if !evaluation.Complete {
+		return nil, fmt.Errorf("%w: not every item is quoted", ErrBidNotAwardable)
+	}
+	if evaluation.Expired {
+		return nil, fmt.Errorf("%w: the bid expired on %s", ErrBidNotAwardable, bid.ValidUntil.Format("2006-01-02"))
+	}
+
+	now := time.Now()
+	promised := now.AddDate(0, 0, evaluation.LeadTimeDays)
+	required := promised
+	if rfq.NeededBy != nil {
+		required = *rfq.NeededBy
+	}
+	order := &models.PurchaseOrder{
+		CompanyID:    rfq.CompanyID,
+		OrderNo:      fmt.Sprintf("PO%d", now.Unix()),
+		Status:       "draft",
+		SupplierID:   bid.SupplierID,
+		OrderDate:    now,
+		RequiredDate: required,
+		PromisedDate: &promised,
+		Currency:     bid.Currency,
+		ExchangeRate: rates[0],
+		PaymentTerms: bid.PaymentTerms,
+		ShippingCost: bid.FreightCost,
+		Notes:        fmt.Sprintf("Awarded from %s", rfq.RFQNo),
+		CreatedBy:    userID,
+	}
+	for i, item := range rfq.Items {
+		line := evaluation.Lines[i]
+		order.Items = append(order.Items, models.PurchaseOrderItem{
+			InventoryID:     item.InventoryID,
+			ProductName:     item.Description,
+			Specification:   item.Specification,
+			OrderedQuantity: line.OrderQuantity,
+			Unit:            item.Unit,
+			UnitPrice:       line.UnitPrice,
+			TotalPrice:      line.OrderQuantity * line.UnitPrice,
+			Status:          "pending",
+		})
+	}
+	if bid.ToolingCost > 0 {
+		order.Items = append(order.Items, models.PurchaseOrderItem{
+			ProductName:     "Tooling",
+			OrderedQuantity: 1,
+			Unit:            "lot",
+			UnitPrice:       bid.ToolingCost,
+			TotalPrice:      bid.ToolingCost,
+			Status:          "pending",
+		})
+	}
+	for _, item := range order.Items {
+		order.SubTotal += item.TotalPrice
+	}
+	order.TotalAmount = order.SubTotal + order.ShippingCost
+
+	rfq.Status = models.RFQStatusAwarded
+	rfq.AwardedBidID = &bid.ID
+	rfq.AwardedBy = &userID
+	rfq.AwardedAt = &now
+	if err := s.supplierRepo.AwardRFQ(rfq, bid, order); err != nil {
+		if errors.Is(err, repository.ErrRFQNotSent) {
+			return nil, ErrRFQClosed
+		}
+		return nil, fmt.Errorf("failed to award bid: %w", err)
+	}
+	return order, nil
+}
+
+// evaluateBids converts the bids into the base currency at today's rates
+// and evaluates them against the RFQ items. Suppliers without an overall
+// rating yet are compared on cost and lead time only.
+func (s *supplierService) evaluateBids(rfq *models.SupplierRFQ, bids []models.SupplierBid) ([]bidding.Evaluation, []float64, error) {
+	items := make([]bidding.Item, 0, len(rfq.Items))
+	for _, item := range rfq.Items {
+		items = append(items, bidding.Item{ID: item.ID.String(), Quantity: item.Quantity})
+	}
+
+	today := time.Now().Truncate(24 * time.Hour)
+	rates := make([]float64, len(bids))
+	input := make([]bidding.Bid, 0, len(bids))
+	for i, bid := range bids {
+		rate := 1.0
+		if bid.Currency != rfq.BaseCurrency {
+			var err error
+			if s.ledger == nil {
+				return nil, nil, fmt.Errorf("%w: %s", ErrExchangeRateMissing, bid.Currency)
+			}
+			if rate, err = s.ledger.BaseRate(context.Background(), rfq.CompanyID, bid.Currency, time.Now()); err != nil {
+				return nil, nil, err
+			}
+		}
+		rates[i] = rate
+
+		b := bidding.Bid{
+			ID:          bid.ID.String(),
+			Rate:        rate,
+			FreightCost: bid.FreightCost,
+			ToolingCost: bid.ToolingCost,
+			Expired:     bid.ValidUntil.Before(today),
+		}
+		if bid.Supplier != nil && bid.Supplier.OverallRating > 0 {
+			rating := bid.Supplier.OverallRating
+			b.Rating = &rating
+		}
+		for _, line := range bid.Lines {
+			var breaks []bidding.PriceBreak
+			if err := json.Unmarshal(line.PriceBreaks, &breaks); err != nil {
+				return nil, nil, fmt.Errorf("failed to read price breaks of bid %s: %w", bid.ID, err)
+			}
+			b.Quotes = append(b.Quotes, bidding.Quote{
+				ItemID:       line.RFQItemID.String(),
+				Breaks:       breaks,
+				MOQ:          line.MOQ,
+				LeadTimeDays: line.LeadTimeDays,
+			})
+		}
+		input = append(input, b)
+	}
+
+	weights := bidding.Weights{Cost: rfq.CostWeight, LeadTime: rfq.LeadTimeWeight, Rating: rfq.RatingWeight}
+	return bidding.Evaluate(items, input, weights), rates, nil
+}
+
+// invitationRFQ resolves an invitation token to the invitation and its RFQ
+func (s *supplierService) invitationRFQ(token string) (*models.SupplierRFQInvitation, *models.SupplierRFQ, error) {
+	if token == "" {
+		return nil, nil, ErrRFQNotFound
+	}
+	invitation, err := s.supplierRepo.GetRFQInvitationByToken(token)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrRFQNotFound
+		}
+		return nil, nil, err
+	}
+	rfq, err := s.GetRFQ(invitation.RFQID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rfq.Status == models.RFQStatusDraft || rfq.Status == models.RFQStatusCancelled {
+		return nil, nil, ErrRFQNotFound
+	}
+	return invitation, rfq, nil
+}
+
+// rfqOpen reports whether an RFQ still takes bids
+func rfqOpen(rfq *models.SupplierRFQ) bool {
+	return rfq.Status == models.RFQStatusSent && time.Now().Before(rfq.ResponseDue)
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/repository"
+)
+
+// NewSupplierScorecardScheduler creates a runner that rescores the suppliers
+// of each company every interval, so that their scorecards, ratings and risk
+// levels follow the receipts, inspections and confirmations recorded since
+// the last run.
+func NewSupplierScorecardScheduler(scorecards SupplierScorecardService, runs repository.JobRunRepository, interval time.Duration) *PeriodicRunner {
+	return NewPeriodicRunner("supplier-scorecard-scheduler", interval, runs, func(ctx context.Context) error {
+		result, err := scorecards.ScoreDue(ctx)
+		if err != nil {
+			return err
+		}
+		if result != nil && len(result.Errors) > 0 {
+			log.Printf("supplier scoring: %d scorecards, %d errors, first: %s", result.Scorecards, len(result.Errors), result.Errors[0])
+		}
+		return nil
+	})
+}
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/fastenmind/fastener-api/internal/models"
@@ -54,17 +56,42 @@ type SupplierService interface {
 	UpdateSupplierPerformance(supplierID uuid.UUID) error
 	CalculateSupplierRisk(supplierID uuid.UUID) (string, error)
 	GetSupplierDashboard(companyID uuid.UUID) (*SupplierDashboard, error)
+	
+	// Purchase Requisition operations
+	CreateRequisition(req *CreateRequisitionRequest, userID uuid.UUID) (*models.PurchaseRequisition, error)
+	GetRequisition(id uuid.UUID) (*models.PurchaseRequisition, error)
+	ListRequisitions(companyID uuid.UUID, params map[string]interface{}) ([]models.PurchaseRequisition, int64, error)
+	
+	// RFQ operations
+	CreateRFQ(requisitionID uuid.UUID, req *CreateRFQRequest, userID uuid.UUID) (*models.SupplierRFQ, error)
+	GetRFQ(id uuid.UUID) (*models.SupplierRFQ, error)
+	ListRFQs(companyID uuid.UUID, params map[string]interface{}) ([]models.SupplierRFQ, int64, error)
+	InviteSuppliers(rfqID uuid.UUID, req *InviteSuppliersRequest) ([]models.SupplierRFQInvitation, error)
+	SendRFQ(rfqID uuid.UUID, bidURL string) (*models.SupplierRFQ, error)
+	CompareBids(rfqID uuid.UUID) (*BidComparison, error)
+	AwardBid(rfqID, bidID uuid.UUID, userID uuid.UUID) (*models.PurchaseOrder, error)
+	
+	// Supplier-facing bid operations, authorized by the invitation token
+	GetRFQForBidder(token string) (*RFQBidderView, error)
+	SubmitBid(token string, req *SubmitBidRequest) (*models.SupplierBid, error)
+	DeclineRFQ(token string, reason string) error
 }
 
 type supplierService struct {
 	supplierRepo  repository.SupplierRepository
 	inventoryRepo repository.InventoryRepository
+	ledger        LedgerService
+	mailer        RFQMailer
+	matcher       InvoiceMatchService
 }
 
-func NewSupplierService(supplierRepo repository.SupplierRepository, inventoryRepo repository.InventoryRepository) SupplierService {
+func NewSupplierService(supplierRepo repository.SupplierRepository, inventoryRepo repository.InventoryRepository, ledger LedgerService, mailer RFQMailer, matcher InvoiceMatchService) SupplierService {
 	return &supplierService{
 		supplierRepo:  supplierRepo,
 		inventoryRepo: inventoryRepo,
+		ledger:        ledger,
+		mailer:        mailer,
+		matcher:       matcher,
 	}
 }
 
@@ -296,6 +323,7 @@ type UpdatePurchaseOrderItemRequest struct {
 type PurchaseOrderReceiptItem struct {
 	ItemID           uuid.UUID `json:"item_id" validate:"required"`
 	ReceivedQuantity float64   `json:"received_quantity" validate:"required,gt=0"`
+	LotNo            string    `json:"lot_no"`
 	QualityPassed    bool      `json:"quality_passed"`
 	InspectionNotes  string    `json:"inspection_notes"`
 }
@@ -721,7 +749,9 @@ func (s *supplierService) SendPurchaseOrder(id uuid.UUID) error {
 		return fmt.Errorf("purchase order is not approved")
 	}
 
+	now := time.Now()
 	order.Status = "confirmed"
+	order.ConfirmedAt = &now
 
 	return s.supplierRepo.UpdatePurchaseOrder(order)
 }
@@ -733,6 +763,7 @@ func (s *supplierService) ReceivePurchaseOrder(id uuid.UUID, items []PurchaseOrd
 	}
 
 	// Update item received quantities
+	now := time.Now()
 	for _, receiptItem := range items {
 		orderItems, err := s.supplierRepo.GetPurchaseOrderItems(id)
 		if err != nil {
@@ -741,6 +772,7 @@ func (s *supplierService) ReceivePurchaseOrder(id uuid.UUID, items []PurchaseOrd
 
 		for _, orderItem := range orderItems {
 			if orderItem.ID == receiptItem.ItemID {
+				received := receiptItem.ReceivedQuantity - orderItem.ReceivedQuantity
 				orderItem.ReceivedQuantity = receiptItem.ReceivedQuantity
 				
 				if orderItem.ReceivedQuantity >= orderItem.OrderedQuantity {
@@ -752,6 +784,25 @@ func (s *supplierService) ReceivePurchaseOrder(id uuid.UUID, items []PurchaseOrd
 				if err := s.supplierRepo.UpdatePurchaseOrderItem(&orderItem); err != nil {
 					return fmt.Errorf("failed to update purchase order item: %w", err)
 				}
+				
+				// Record the delivery for the supplier scorecard
+				if received > 0 {
+					receipt := &models.PurchaseOrderReceipt{
+						CompanyID:           order.CompanyID,
+						PurchaseOrderID:     order.ID,
+						PurchaseOrderItemID: orderItem.ID,
+						SupplierID:          order.SupplierID,
+						InventoryID:         orderItem.InventoryID,
+						Quantity:            received,
+						LotNo:               receiptItem.LotNo,
+						ReceivedAt:          now,
+						QualityPassed:       receiptItem.QualityPassed,
+						InspectionNotes:     receiptItem.InspectionNotes,
+					}
+					if err := s.supplierRepo.CreatePurchaseOrderReceipt(receipt); err != nil {
+						return fmt.Errorf("failed to record purchase order receipt: %w", err)
+					}
+				}
 				break
 			}
 		}
@@ -775,11 +826,22 @@ func (s *supplierService) ReceivePurchaseOrder(id uuid.UUID, items []PurchaseOrd
 
 	if allReceived {
 		order.Status = "received"
+		order.ActualEndDate = &now
 	} else if partialReceived {
 		order.Status = "partial_received"
 	}
 
-	return s.supplierRepo.UpdatePurchaseOrder(order)
+	if err := s.supplierRepo.UpdatePurchaseOrder(order); err != nil {
+		return err
+	}
+
+	// Invoices held for goods not yet received may match now
+	if s.matcher != nil {
+		if _, err := s.matcher.RematchOrder(context.Background(), id); err != nil {
+			log.Printf("Failed to rematch held invoices of purchase order %s: %v", id, err)
+		}
+	}
+	return nil
 }
 
 // Purchase Order Item operations
@@ -104,6 +104,7 @@ type SystemService interface {
 	GetSystemStatistics(ctx context.Context, companyID *uuid.UUID) (map[string]interface{}, error)
 	GetUserPermissions(ctx context.Context, userID uuid.UUID) ([]models.Permission, error)
 	HasPermission(ctx context.Context, userID uuid.UUID, module, action string) (bool, error)
+	IsSystemAdmin(ctx context.Context, userID uuid.UUID) (bool, error)
 	InitializeDefaultRoles(ctx context.Context, companyID *uuid.UUID, userID uuid.UUID) error
 	GetSystemInfo(ctx context.Context) (map[string]interface{}, error)
 }
@@ -723,6 +724,13 @@ func (s *systemService) HasPermission(ctx context.Context, userID uuid.UUID, mod
 	return s.systemRepo.HasPermission(userID, module, action)
 }
 
+func (s *systemService) IsSystemAdmin(ctx context.Context, userID uuid.UUID) (bool, error) {
+	if userID == uuid.Nil {
+		return false, nil
+	}
+	return s.systemRepo.IsSystemAdmin(userID)
+}
+
 func (s *systemService) InitializeDefaultRoles(ctx context.Context, companyID *uuid.UUID, userID uuid.UUID) error {
 	defaultRoles := []models.Role{
 		{
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/repository"
+)
+
+// NewTrackingPoller creates a runner that polls carrier integrations for new
+// tracking events every interval
+func NewTrackingPoller(tracking TrackingService, runs repository.JobRunRepository, interval time.Duration) *PeriodicRunner {
+	return NewPeriodicRunner("tracking-poller", interval, runs, func(ctx context.Context) error {
+		result, err := tracking.PollDue(ctx)
+		if err != nil {
+			return err
+		}
+		if result != nil && len(result.Errors) > 0 {
+			log.Printf("tracking poll: %d applied, %d errors, first: %s", result.Applied, len(result.Errors), result.Errors[0])
+		}
+		return nil
+	})
+}
@@ -0,0 +1,572 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fastenmind/fastener-api/internal/infrastructure/tracking"
+	"github.com/fastenmind/fastener-api/internal/models"
+	"github.com/fastenmind/fastener-api/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrCarrierIntegrationNotFound is returned when a carrier integration is not found
+	ErrCarrierIntegrationNotFound = errors.New("carrier integration not found")
+	// ErrInvalidCarrierIntegration is returned when an integration has an unknown adapter type or format
+	ErrInvalidCarrierIntegration = errors.New("invalid carrier integration")
+	// ErrCarrierNotPollable is returned when tracking is requested for a carrier without an adapter
+	ErrCarrierNotPollable = errors.New("carrier has no tracking adapter")
+	// ErrShipmentNotTrackable is returned when a shipment has no carrier, tracking or container number
+	ErrShipmentNotTrackable = errors.New("shipment has no carrier tracking reference")
+)
+
+// Carrier integration adapter types
+const (
+	CarrierAdapterHTTP = "http" // polled from Endpoint
+	CarrierAdapterFile = "file" // events are uploaded
+)
+
+// defaultDelayThreshold applies when an integration does not set one
+const defaultDelayThreshold = 24 * time.Hour
+
+// TrackingService imports carrier tracking events and applies them to shipments
+type TrackingService interface {
+	// Carrier integrations
+	CreateCarrierIntegration(ctx context.Context, integration *models.CarrierIntegration) error
+	GetCarrierIntegration(ctx context.Context, id uuid.UUID) (*models.CarrierIntegration, error)
+	ListCarrierIntegrations(ctx context.Context, companyID uuid.UUID) ([]*models.CarrierIntegration, error)
+	UpdateCarrierIntegration(ctx context.Context, integration *models.CarrierIntegration) error
+	DeleteCarrierIntegration(ctx context.Context, id uuid.UUID) error
+
+	// RegisterAdapter installs a code adapter for a carrier; it takes precedence
+	// over the HTTP adapter built from the carrier's integration settings
+	RegisterAdapter(adapter tracking.Adapter)
+
+	// Event ingestion
+	ImportEvents(ctx context.Context, req ImportTrackingEventsRequest) (*TrackingResult, error)
+	PollShipment(ctx context.Context, shipmentID, userID uuid.UUID) (*TrackingResult, error)
+	PollDue(ctx context.Context) (*TrackingResult, error)
+}
+
+// ImportTrackingEventsRequest is an uploaded carrier tracking file
+type ImportTrackingEventsRequest struct {
+	CompanyID   uuid.UUID
+	CarrierName string
+	Format      string // json, csv or iftsta; defaults to the carrier integration's format
+	Reader      io.Reader
+	UserID      uuid.UUID
+}
+
+// TrackingResult summarizes an import or polling run
+type TrackingResult struct {
+	Events           int         `json:"events"`            // events read from the carrier
+	Applied          int         `json:"applied"`           // new shipment events stored
+	Duplicates       int         `json:"duplicates"`        // events already recorded
+	ShipmentsUpdated int         `json:"shipments_updated"` // shipments that received new events
+	Delayed          []uuid.UUID `json:"delayed"`           // shipments whose ETA slipped beyond the threshold
+	Unmatched        []string    `json:"unmatched"`         // references without a shipment
+	Errors           []string    `json:"errors,omitempty"`
+}
+
+func (r *TrackingResult) merge(other *TrackingResult) {
+	r.Events += other.Events
+	r.Applied += other.Applied
+	r.Duplicates += other.Duplicates
+	r.ShipmentsUpdated += other.ShipmentsUpdated
+	r.Delayed = append(r.Delayed, other.Delayed...)
+	r.Unmatched = append(r.Unmatched, other.Unmatched...)
+	r.Errors = append(r.Errors, other.Errors...)
+}
+
+type trackingService struct {
+	repo    repository.TrackingRepository
+	webhook *WebhookService
+
+	mu       sync.RWMutex
+	adapters map[string]tracking.Adapter
+}
+
+// NewTrackingService creates a new tracking service
+func NewTrackingService(repo repository.TrackingRepository, webhook *WebhookService) TrackingService {
+	return &trackingService{
+		repo:     repo,
+		webhook:  webhook,
+		adapters: make(map[string]tracking.Adapter),
+	}
+}
+
+// Carrier integrations
+
+func (s *trackingService) CreateCarrierIntegration(ctx context.Context, integration *models.CarrierIntegration) error {
+	if err := validateCarrierIntegration(integration); err != nil {
+		return err
+	}
+	return s.repo.CreateCarrierIntegration(ctx, integration)
+}
+
+func (s *trackingService) GetCarrierIntegration(ctx context.Context, id uuid.UUID) (*models.CarrierIntegration, error) {
+	integration, err := s.repo.GetCarrierIntegration(ctx, id)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrCarrierIntegrationNotFound
+		}
+		return nil, err
+	}
+	return integration, nil
+}
+
+func (s *trackingService) ListCarrierIntegrations(ctx context.Context, companyID uuid.UUID) ([]*models.CarrierIntegration, error) {
+	return s.repo.ListCarrierIntegrations(ctx, companyID)
+}
+
+func (s *trackingService) UpdateCarrierIntegration(ctx context.Context, integration *models.CarrierIntegration) error {
+	if err := validateCarrierIntegration(integration); err != nil {
+		return err
+	}
+	return s.repo.UpdateCarrierIntegration(ctx, integration)
+}
+
+func (s *trackingService) DeleteCarrierIntegration(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteCarrierIntegration(ctx, id)
+}
+
+func validateCarrierIntegration(integration *models.CarrierIntegration) error {
+	integration.CarrierName = strings.TrimSpace(integration.CarrierName)
+	if integration.CarrierName == "" {
+		return fmt.Errorf("%w: carrier name is required", ErrInvalidCarrierIntegration)
+	}
+	switch integration.AdapterType {
+	case CarrierAdapterHTTP:
+		if integration.Endpoint == "" {
+			return fmt.Errorf("%w: endpoint is required for http adapters", ErrInvalidCarrierIntegration)
+		}
+	case CarrierAdapterFile:
+	default:
+		return fmt.Errorf("%w: adapter type must be http or file", ErrInvalidCarrierIntegration)
+	}
+	switch integration.Format {
+	case tracking.FormatJSON, tracking.FormatCSV, tracking.FormatIFTSTA:
+	default:
+		return fmt.Errorf("%w: format must be json, csv or iftsta", ErrInvalidCarrierIntegration)
+	}
+	if _, err := integrationFieldMap(integration); err != nil {
+		return fmt.Errorf("%w: field_map: %v", ErrInvalidCarrierIntegration, err)
+	}
+	if _, err := integrationStatusMap(integration); err != nil {
+		return fmt.Errorf("%w: status_map: %v", ErrInvalidCarrierIntegration, err)
+	}
+	for _, milestone := range mustStatusMap(integration) {
+		if tracking.Rank(milestone) == 0 {
+			return fmt.Errorf("%w: unknown milestone %q in status_map", ErrInvalidCarrierIntegration, milestone)
+		}
+	}
+	if integration.PollIntervalMinutes <= 0 {
+		integration.PollIntervalMinutes = 60
+	}
+	if integration.DelayThresholdHours <= 0 {
+		integration.DelayThresholdHours = int(defaultDelayThreshold / time.Hour)
+	}
+	return nil
+}
+
+func (s *trackingService) RegisterAdapter(adapter tracking.Adapter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.adapters[strings.ToLower(adapter.Name())] = adapter
+}
+
+// Event ingestion
+
+// ImportEvents parses an uploaded carrier file and applies its events to the
+// shipments whose tracking or container number appears in the event references
+func (s *trackingService) ImportEvents(ctx context.Context, req ImportTrackingEventsRequest) (*TrackingResult, error) {
+	integration, err := s.repo.FindCarrierIntegration(ctx, req.CompanyID, req.CarrierName)
+	if err != nil && err != repository.ErrNotFound {
+		return nil, err
+	}
+	if integration == nil {
+		// Uploads work without configuration, using the generic field names
+		integration = &models.CarrierIntegration{CompanyID: req.CompanyID, CarrierName: req.CarrierName, Format: req.Format}
+	}
+	format := req.Format
+	if format == "" {
+		format = integration.Format
+	}
+
+	fields, err := integrationFieldMap(integration)
+	if err != nil {
+		return nil, err
+	}
+	events, err := tracking.Parse(format, req.Reader, fields)
+	if err != nil {
+		return nil, err
+	}
+	tracking.NewNormalizer(mustStatusMap(integration)).Apply(events)
+
+	var references []string
+	for _, event := range events {
+		references = append(references, event.References...)
+	}
+	shipments, err := s.repo.FindShipmentsByReference(ctx, req.CompanyID, uniqueStrings(references))
+	if err != nil {
+		return nil, err
+	}
+	byReference := make(map[string]*models.Shipment)
+	for _, shipment := range shipments {
+		for _, ref := range []string{shipment.TrackingNo, shipment.ContainerNo} {
+			if ref != "" {
+				byReference[strings.ToUpper(ref)] = shipment
+			}
+		}
+	}
+
+	grouped := make(map[uuid.UUID][]tracking.Event)
+	unmatched := make(map[string]bool)
+	for _, event := range events {
+		matched := make(map[uuid.UUID]bool)
+		for _, ref := range event.References {
+			if shipment, ok := byReference[strings.ToUpper(ref)]; ok {
+				matched[shipment.ID] = true
+			} else {
+				unmatched[ref] = true
+			}
+		}
+		for id := range matched {
+			grouped[id] = append(grouped[id], event)
+		}
+	}
+
+	result := &TrackingResult{Events: len(events)}
+	for _, shipment := range shipments {
+		if len(grouped[shipment.ID]) == 0 {
+			continue
+		}
+		applied, err := s.applyEvents(ctx, shipment, integration, grouped[shipment.ID], req.UserID)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", shipment.ShipmentNo, err))
+			continue
+		}
+		result.merge(applied)
+	}
+	for ref := range unmatched {
+		if _, ok := byReference[strings.ToUpper(ref)]; !ok {
+			result.Unmatched = append(result.Unmatched, ref)
+		}
+	}
+	sort.Strings(result.Unmatched)
+	return result, nil
+}
+
+// PollShipment fetches the latest events of one shipment from its carrier
+func (s *trackingService) PollShipment(ctx context.Context, shipmentID, userID uuid.UUID) (*TrackingResult, error) {
+	shipment, err := s.repo.GetShipment(ctx, shipmentID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrShipmentNotFound
+		}
+		return nil, err
+	}
+	if shipment.CarrierName == "" || (shipment.TrackingNo == "" && shipment.ContainerNo == "") {
+		return nil, ErrShipmentNotTrackable
+	}
+
+	integration, err := s.repo.FindCarrierIntegration(ctx, shipment.CompanyID, shipment.CarrierName)
+	if err != nil && err != repository.ErrNotFound {
+		return nil, err
+	}
+	if integration == nil {
+		integration = &models.CarrierIntegration{CompanyID: shipment.CompanyID, CarrierName: shipment.CarrierName}
+	}
+	adapter, err := s.adapterFor(integration)
+	if err != nil {
+		return nil, err
+	}
+	return s.pollShipment(ctx, adapter, integration, shipment, userID)
+}
+
+// PollDue polls every active HTTP integration whose poll interval has elapsed.
+// It is run periodically by the tracking poller.
+func (s *trackingService) PollDue(ctx context.Context) (*TrackingResult, error) {
+	integrations, err := s.repo.ListPollableIntegrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TrackingResult{}
+	now := time.Now()
+	for _, integration := range integrations {
+		interval := time.Duration(integration.PollIntervalMinutes) * time.Minute
+		if integration.LastPolledAt != nil && now.Sub(*integration.LastPolledAt) < interval {
+			continue
+		}
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		polled, err := s.pollIntegration(ctx, integration)
+		if polled != nil {
+			result.merge(polled)
+		}
+
+		integration.LastPolledAt = &now
+		integration.LastError = ""
+		if err != nil {
+			integration.LastError = err.Error()
+		} else if polled != nil && len(polled.Errors) > 0 {
+			integration.LastError = polled.Errors[len(polled.Errors)-1]
+		}
+		if err := s.repo.UpdateCarrierIntegration(ctx, integration); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func (s *trackingService) pollIntegration(ctx context.Context, integration *models.CarrierIntegration) (*TrackingResult, error) {
+	adapter, err := s.adapterFor(integration)
+	if err != nil {
+		return nil, err
+	}
+	shipments, err := s.repo.ListOpenShipments(ctx, integration.CompanyID, integration.CarrierName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TrackingResult{}
+	for _, shipment := range shipments {
+		polled, err := s.pollShipment(ctx, adapter, integration, shipment, uuid.Nil)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", shipment.ShipmentNo, err))
+			continue
+		}
+		result.merge(polled)
+	}
+	return result, nil
+}
+
+func (s *trackingService) pollShipment(ctx context.Context, adapter tracking.Adapter, integration *models.CarrierIntegration, shipment *models.Shipment, userID uuid.UUID) (*TrackingResult, error) {
+	events, err := adapter.Fetch(ctx, tracking.Reference{TrackingNo: shipment.TrackingNo, ContainerNo: shipment.ContainerNo})
+	if err != nil {
+		return nil, err
+	}
+	tracking.NewNormalizer(mustStatusMap(integration)).Apply(events)
+	return s.applyEvents(ctx, shipment, integration, events, userID)
+}
+
+func (s *trackingService) adapterFor(integration *models.CarrierIntegration) (tracking.Adapter, error) {
+	s.mu.RLock()
+	adapter, ok := s.adapters[strings.ToLower(integration.CarrierName)]
+	s.mu.RUnlock()
+	if ok {
+		return adapter, nil
+	}
+
+	if integration.AdapterType != CarrierAdapterHTTP || integration.Endpoint == "" {
+		return nil, ErrCarrierNotPollable
+	}
+	fields, err := integrationFieldMap(integration)
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[string]string)
+	if len(integration.Headers) > 0 {
+		if err := json.Unmarshal(integration.Headers, &headers); err != nil {
+			return nil, fmt.Errorf("invalid headers: %w", err)
+		}
+	}
+	return tracking.NewHTTPAdapter(integration.CarrierName, integration.Endpoint, integration.Format, fields, headers), nil
+}
+
+// applyEvents records the events that are new for the shipment and moves the
+// shipment forward. Milestones only advance: a late "loaded" event after
+// "departed" is recorded but does not change the status.
+func (s *trackingService) applyEvents(ctx context.Context, shipment *models.Shipment, integration *models.CarrierIntegration, events []tracking.Event, userID uuid.UUID) (*TrackingResult, error) {
+	result := &TrackingResult{Events: len(events)}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].EventTime.Before(events[j].EventTime) })
+
+	source := "tracking:" + strings.ToLower(integration.CarrierName)
+	threshold := defaultDelayThreshold
+	if integration.DelayThresholdHours > 0 {
+		threshold = time.Duration(integration.DelayThresholdHours) * time.Hour
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool)
+	var records []*models.ShipmentEvent
+	var delayedFrom, delayedTo *time.Time
+
+	for _, event := range events {
+		eventType := event.Milestone
+		if eventType == "" {
+			eventType = "status_update"
+		}
+		key := eventType + "|" + event.EventTime.UTC().Format(time.RFC3339)
+		if seen[key] {
+			result.Duplicates++
+			continue
+		}
+		seen[key] = true
+		exists, err := s.repo.ShipmentEventExists(ctx, shipment.ID, eventType, source, event.EventTime)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			result.Duplicates++
+			continue
+		}
+
+		description := event.Description
+		if description == "" {
+			description = event.RawStatus
+		}
+		records = append(records, &models.ShipmentEvent{
+			CompanyID:     shipment.CompanyID,
+			ShipmentID:    shipment.ID,
+			EventType:     eventType,
+			CarrierStatus: event.RawStatus,
+			Status:        "completed",
+			Location:      event.Location,
+			Description:   description,
+			EventTime:     event.EventTime,
+			RecordedAt:    now,
+			Source:        source,
+			CreatedBy:     userID,
+		})
+		advanceShipment(shipment, event)
+
+		if event.EstimatedArrival != nil && shipment.ActualArrival == nil {
+			eta := *event.EstimatedArrival
+			previous := shipment.EstimatedArrival
+			if previous != nil && eta.Sub(*previous) > threshold {
+				if delayedFrom == nil {
+					delayedFrom = previous
+				}
+				delayedTo = &eta
+			}
+			shipment.EstimatedArrival = &eta
+		}
+	}
+
+	if len(records) == 0 {
+		return result, nil
+	}
+	if delayedFrom != nil && delayedTo.Sub(*delayedFrom) > threshold {
+		records = append(records, &models.ShipmentEvent{
+			CompanyID:   shipment.CompanyID,
+			ShipmentID:  shipment.ID,
+			EventType:   "delay",
+			Status:      "completed",
+			Description: fmt.Sprintf("ETA moved from %s to %s", delayedFrom.Format("2006-01-02 15:04"), delayedTo.Format("2006-01-02 15:04")),
+			EventTime:   now,
+			RecordedAt:  now,
+			Source:      source,
+			CreatedBy:   userID,
+		})
+	} else {
+		delayedFrom = nil
+	}
+
+	if err := s.repo.ApplyTrackingEvents(ctx, shipment, records); err != nil {
+		return nil, err
+	}
+	result.Applied = len(records)
+	result.ShipmentsUpdated = 1
+
+	if delayedFrom != nil {
+		result.Delayed = append(result.Delayed, shipment.ID)
+		if s.webhook != nil {
+			var customerID *uuid.UUID
+			if shipment.Order != nil {
+				customerID = &shipment.Order.CustomerID
+			}
+			// Notification failures must not roll back the recorded events
+			_ = s.webhook.TriggerShipmentDelayed(shipment.ID, shipment.ShipmentNo, customerID, *delayedFrom, *delayedTo, shipment.LastMilestone, shipment.CompanyID, userID)
+		}
+	}
+	return result, nil
+}
+
+// advanceShipment moves the shipment status forward for a milestone that is
+// later than the last one seen. Delivered and cancelled shipments keep their status.
+func advanceShipment(shipment *models.Shipment, event tracking.Event) {
+	if tracking.Rank(event.Milestone) <= tracking.Rank(shipment.LastMilestone) {
+		return
+	}
+	shipment.LastMilestone = event.Milestone
+	if shipment.Status == "delivered" || shipment.Status == "cancelled" {
+		return
+	}
+
+	eventTime := event.EventTime
+	switch event.Milestone {
+	case tracking.MilestoneDeparted:
+		shipment.Status = "in_transit"
+		if shipment.ActualDeparture == nil {
+			shipment.ActualDeparture = &eventTime
+		}
+	case tracking.MilestoneArrived:
+		shipment.Status = "customs"
+		if shipment.ActualArrival == nil {
+			shipment.ActualArrival = &eventTime
+		}
+	case tracking.MilestoneCustomsCleared:
+		// On-carriage from the port to the consignee
+		shipment.Status = "in_transit"
+		if shipment.ActualArrival == nil {
+			shipment.ActualArrival = &eventTime
+		}
+	case tracking.MilestoneDelivered:
+		shipment.Status = "delivered"
+		if shipment.ActualArrival == nil {
+			shipment.ActualArrival = &eventTime
+		}
+	}
+}
+
+func integrationFieldMap(integration *models.CarrierIntegration) (tracking.FieldMap, error) {
+	var fields tracking.FieldMap
+	if len(integration.FieldMap) > 0 {
+		if err := json.Unmarshal(integration.FieldMap, &fields); err != nil {
+			return fields, err
+		}
+	}
+	return fields, nil
+}
+
+func integrationStatusMap(integration *models.CarrierIntegration) (map[string]string, error) {
+	statuses := make(map[string]string)
+	if len(integration.StatusMap) > 0 {
+		if err := json.Unmarshal(integration.StatusMap, &statuses); err != nil {
+			return nil, err
+		}
+	}
+	return statuses, nil
+}
+
+// mustStatusMap returns the status overrides, ignoring a malformed map that
+// validation would have rejected
+func mustStatusMap(integration *models.CarrierIntegration) map[string]string {
+	statuses, _ := integrationStatusMap(integration)
+	return statuses
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	return out
+}
@@ -45,6 +45,18 @@ type TradeService interface {
 	ListLettersOfCredit(ctx context.Context, params map[string]interface{}) ([]*models.LetterOfCredit, int64, error)
 	UpdateLetterOfCredit(ctx context.Context, lc *models.LetterOfCredit) error
 
+	// LC Amendment Management
+	ProposeLCAmendment(ctx context.Context, amendment *models.LCAmendment) error
+	AcceptLCAmendment(ctx context.Context, id, userID uuid.UUID) (*models.LCAmendment, error)
+	RejectLCAmendment(ctx context.Context, id, userID uuid.UUID, reason string) (*models.LCAmendment, error)
+	ListLCAmendments(ctx context.Context, lcID uuid.UUID) ([]*models.LCAmendment, error)
+	GetLCTermsAsOf(ctx context.Context, lcID uuid.UUID, asOf time.Time) (*models.LCTerms, error)
+
+	// LC Utilization Management
+	CreateLCUtilization(ctx context.Context, utilization *models.LCUtilization) error
+	ListLCUtilizations(ctx context.Context, lcID uuid.UUID) ([]*models.LCUtilization, error)
+	CheckShipmentAgainstLC(ctx context.Context, lcID, shipmentID uuid.UUID) ([]string, error)
+
 	// Exchange Rate Management
 	GetLatestExchangeRate(ctx context.Context, fromCurrency, toCurrency string) (*models.ExchangeRate, error)
 	CreateExchangeRate(ctx context.Context, rate *models.ExchangeRate) error
@@ -58,6 +70,6 @@ type TradeService interface {
 }
 
 // NewTradeService creates a new trade service
-func NewTradeService(tradeRepo repository.TradeRepository) TradeService {
-	return NewTradeServiceImpl(tradeRepo)
+func NewTradeService(tradeRepo repository.TradeRepository, transactor repository.Transactor, screening ScreeningService, credit CreditService) TradeService {
+	return NewTradeServiceImpl(tradeRepo, transactor, screening, credit)
 }
\ No newline at end of file
@@ -2,6 +2,8 @@ package service
 
 import (
 	"fmt"
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -223,4 +225,25 @@ func (s *WebhookService) TriggerEquipmentMaintenanceDue(equipmentID uuid.UUID, d
 			"action":       "maintenance_due",
 		},
 	)
-}
\ No newline at end of file
+}
+
+// TriggerShipmentDelayed triggers N8N workflow when a carrier pushes a shipment's ETA back
+func (s *WebhookService) TriggerShipmentDelayed(shipmentID uuid.UUID, shipmentNo string, customerID *uuid.UUID, previousETA, newETA time.Time, milestone string, companyID, userID uuid.UUID) error {
+	return s.n8nService.LogEvent(
+		companyID,
+		userID,
+		"shipment.delayed",
+		"shipment",
+		shipmentID,
+		map[string]interface{}{
+			"shipment_id":    shipmentID,
+			"shipment_no":    shipmentNo,
+			"customer_id":    customerID,
+			"previous_eta":   previousETA.Format(time.RFC3339),
+			"new_eta":        newETA.Format(time.RFC3339),
+			"delay_hours":    fmt.Sprintf("%.1f", newETA.Sub(previousETA).Hours()),
+			"last_milestone": milestone,
+			"action":         "delayed",
+		},
+	)
+}
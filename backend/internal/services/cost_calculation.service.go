@@ -1,14 +1,18 @@
 package services
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"time"
 
+	"github.com/fastenmind/fastener-api/internal/infrastructure/calibration"
 	"github.com/fastenmind/fastener-api/internal/models"
 	"github.com/fastenmind/fastener-api/internal/repositories"
 	"github.com/google/uuid"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -35,11 +39,19 @@ func (s *CostCalculationService) CalculateCost(req models.CostCalculationRequest
 		return nil, fmt.Errorf("failed to get process route: %w", err)
 	}
 
-	// 獲取當前成本參數
-	params, err := s.costRepo.GetCurrentCostParameters()
+	// 獲取基準日有效的成本參數，並記錄所使用的版本
+	asOf := time.Now()
+	if req.AsOf != nil && !req.AsOf.IsZero() {
+		asOf = *req.AsOf
+	}
+	params, err := s.costRepo.GetCostParametersAt(asOf)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cost parameters: %w", err)
 	}
+	rateVersions, err := json.Marshal(costParameterPins(params))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record cost parameter versions: %w", err)
+	}
 
 	// 開始事務
 	tx := s.db.Begin()
@@ -54,11 +66,26 @@ func (s *CostCalculationService) CalculateCost(req models.CostCalculationRequest
 		InquiryID:        req.InquiryID,
 		CalculationNo:    calcNo,
 		ProductName:      req.ProductName,
+		Diameter:         req.Diameter,
+		Length:           req.Length,
+		MaterialType:     req.MaterialType,
 		Quantity:         req.Quantity,
 		MaterialCost:     req.MaterialCost,
 		RouteID:          &route.ID,
 		Status:           "draft",
 		MarginPercentage: req.MarginPercentage,
+		AsOf:             asOf,
+		RateVersions:     datatypes.JSON(rateVersions),
+	}
+
+	// 尺寸供成本校準使用，未提供時由規格或品名解析
+	if calculation.Diameter == 0 || calculation.Length == 0 {
+		for _, text := range []string{req.SizeRange, req.ProductName} {
+			if diameter, length, ok := calibration.ParseSize(text); ok {
+				calculation.Diameter, calculation.Length = diameter, length
+				break
+			}
+		}
 	}
 
 	if err := tx.Create(calculation).Error; err != nil {
@@ -117,6 +144,22 @@ func (s *CostCalculationService) CalculateCost(req models.CostCalculationRequest
 	return s.costRepo.GetCalculationByID(calculation.ID)
 }
 
+// costParameterPins 依參數類型排序的成本參數版本
+func costParameterPins(params map[string]models.CostParameter) []models.RateVersionPin {
+	pins := make([]models.RateVersionPin, 0, len(params))
+	for _, param := range params {
+		pins = append(pins, models.RateVersionPin{
+			Kind:      models.RateKindCostParameter,
+			ID:        param.ID.String(),
+			Key:       param.ParameterType,
+			ValidFrom: param.EffectiveDate,
+			Value:     param.Value,
+		})
+	}
+	sort.Slice(pins, func(i, j int) bool { return pins[i].Key < pins[j].Key })
+	return pins
+}
+
 // GetCostSummary 獲取成本摘要
 func (s *CostCalculationService) GetCostSummary(calculationID uuid.UUID) (*models.CostSummary, error) {
 	calc, err := s.costRepo.GetCalculationByID(calculationID)
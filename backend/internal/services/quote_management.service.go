@@ -94,6 +94,8 @@ func (s *QuoteManagementService) CreateQuote(req models.CreateQuoteRequest, crea
 			ItemNo:            i + 1,
 			ProductName:       itemReq.ProductName,
 			ProductSpecs:      itemReq.ProductSpecs,
+			CustomerPartID:    itemReq.CustomerPartID,
+			DrawingRevision:   itemReq.DrawingRevision,
 			Quantity:          itemReq.Quantity,
 			Unit:              itemReq.Unit,
 			UnitPrice:         itemReq.UnitPrice,
@@ -262,6 +264,8 @@ func (s *QuoteManagementService) UpdateQuote(quoteID uuid.UUID, req models.Updat
 				ItemNo:            i + 1,
 				ProductName:       itemReq.ProductName,
 				ProductSpecs:      itemReq.ProductSpecs,
+				CustomerPartID:    itemReq.CustomerPartID,
+				DrawingRevision:   itemReq.DrawingRevision,
 				Quantity:          itemReq.Quantity,
 				Unit:              itemReq.Unit,
 				UnitPrice:         itemReq.UnitPrice,
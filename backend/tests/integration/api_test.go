@@ -64,7 +64,8 @@ func (suite *APITestSuite) SetupSuite() {
 
 	// Initialize repositories, services, and handlers
 	repos := repository.NewRepositories(db.GormDB)
-	services := service.NewServices(repos, cfg, db.GormDB)
+	services, err := service.NewServices(repos, cfg, db.GormDB)
+	suite.Require().NoError(err)
 	handlers := handler.NewHandlers(services)
 
 	// Setup routes